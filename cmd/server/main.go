@@ -5,19 +5,22 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/golang-migrate/migrate/v4"
-	_ "github.com/golang-migrate/migrate/v4/database/mysql"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
 
 	"reconciliation-service/internal/config"
+	"reconciliation-service/internal/currency"
 	"reconciliation-service/internal/database"
 	"reconciliation-service/internal/handlers"
+	"reconciliation-service/internal/services"
 )
 
 func main() {
@@ -40,14 +43,173 @@ func main() {
 		handleMigration(cfg, *migrateCmd, *steps)
 		return
 	}
+	// An in-memory database starts empty on every run
+	if cfg.Database.InMemory() {
+		handleMigration(cfg, "up", 0)
+	}
+
+	if cfg.Auth.JWTSecret == "" {
+		if strings.EqualFold(cfg.Environment, "production") {
+			log.Fatalf("JWT_SECRET is required in production")
+		}
+		log.Printf("JWT_SECRET is not set, API authentication is disabled")
+	}
+
+	if !currency.Supported(cfg.Matching.BaseCurrency) {
+		log.Fatalf("BASE_CURRENCY %q is not a supported currency", cfg.Matching.BaseCurrency)
+	}
+
+	// Each ingestion lane gets connections of its own, so a file load cannot
+	// starve real-time posting nor the rest of the service
+	realtimePool, err := database.NewPool(cfg, cfg.Ingestion.RealtimeConnections)
+	if err != nil {
+		log.Fatalf("Error opening the real-time ingestion pool: %v", err)
+	}
+	defer realtimePool.Close()
+	bulkPool, err := database.NewPool(cfg, cfg.Ingestion.BulkConnections)
+	if err != nil {
+		log.Fatalf("Error opening the bulk ingestion pool: %v", err)
+	}
+	defer bulkPool.Close()
+	lanes := services.IngestionLanes{
+		Realtime:           realtimePool,
+		Bulk:               bulkPool,
+		RealtimeMaxRecords: cfg.Ingestion.RealtimeMaxRecords,
+		BulkChunkSize:      cfg.Ingestion.BulkChunkSize,
+		MaxJSONBytes:       cfg.Ingestion.MaxJSONBytes,
+		MaxStatementBytes:  cfg.Ingestion.MaxStatementBytes,
+	}
+
+	graphs, err := services.NewTenantServices(db, lanes, cfg, instanceID())
+	if err != nil {
+		log.Fatalf("Error initializing services: %v", err)
+	}
+	// The primary tenant's services also run everything deployment-wide
+	svc := graphs[cfg.Tenants.Primary()]
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: cfg.Log.Level}))
+	setupRouter := func(graphs map[string]*services.Services) http.Handler {
+		if cfg.Tenants.Enabled() || cfg.Sandbox.Enabled() {
+			return handlers.SetupTenantRouter(graphs, cfg.Tenants, cfg.Sandbox, cfg.Latency, cfg.OpenAPI, logger)
+		}
+		return handlers.SetupRouter(graphs[cfg.Tenants.Primary()], cfg.Latency, cfg.OpenAPI, logger)
+	}
+
+	// While the primary database is unavailable, reads go to the replica
+	// when one is configured
+	replica, err := database.NewReplica(cfg)
+	if err != nil {
+		log.Fatalf("Error opening the read replica: %v", err)
+	}
+	var replicaRouter http.Handler
+	if replica != nil {
+		defer replica.Close()
+		replicaGraphs, err := services.NewReplicaServices(replica, graphs, lanes, cfg, instanceID())
+		if err != nil {
+			log.Fatalf("Error initializing replica services: %v", err)
+		}
+		replicaRouter = setupRouter(replicaGraphs)
+	}
+	router := handlers.ReadOnlyRouter(setupRouter(graphs), replicaRouter, svc.Failover)
+
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	// Every worker beats while it runs, so one that died with its instance
+	// shows at /api/v1/admin/workers
+	track := func(tenantSvc *services.Services, worker string, run func(ctx context.Context)) {
+		go tenantSvc.Heartbeats.Track(workerCtx, worker, run)
+	}
+	for _, tenantSvc := range graphs {
+		go tenantSvc.Heartbeats.RunBeater(workerCtx)
+		if cfg.Heartbeat.MonitorEnabled {
+			go tenantSvc.Heartbeats.RunMonitor(workerCtx)
+		}
+		if cfg.Partition.WorkerEnabled {
+			track(tenantSvc, "partition_worker", func(ctx context.Context) {
+				tenantSvc.Partitions.RunWorker(ctx, cfg.Partition.PollInterval)
+			})
+		}
+		if tenantSvc.Sandbox != nil {
+			track(tenantSvc, "sandbox_resetter", tenantSvc.Sandbox.RunResetter)
+		}
+		if cfg.Digest.SenderEnabled {
+			track(tenantSvc, "digest_sender", tenantSvc.Digests.RunSender)
+		}
+	}
+	track(svc, "primary_monitor", svc.Failover.RunMonitor)
+	if cfg.Queue.WorkerEnabled {
+		// One worker claims for every tenant, so the queue is shared fairly
+		queue := services.NewQueueScheduler(graphs)
+		track(svc, "queue_worker", func(ctx context.Context) {
+			queue.RunWorker(ctx, cfg.Queue.PollInterval)
+		})
+	}
+	if cfg.Scheduler.Enabled {
+		track(svc, "scheduler", func(ctx context.Context) {
+			svc.Schedules.RunWorker(ctx, cfg.Scheduler.PollInterval)
+		})
+	}
+	if cfg.Export.WorkerEnabled {
+		track(svc, "export_worker", func(ctx context.Context) {
+			svc.Exports.RunWorker(ctx, cfg.Export.PollInterval)
+		})
+	}
+	track(svc, "request_audit_retention", func(ctx context.Context) {
+		svc.RequestAudits.RunRetention(ctx, time.Hour)
+	})
+	if cfg.Retention.PurgerEnabled {
+		track(svc, "retention_purger", func(ctx context.Context) {
+			svc.Retention.RunPurger(ctx, cfg.Retention.PurgeInterval, cfg.Retention.DryRun)
+		})
+	}
+	if cfg.Expectations.WatcherEnabled {
+		track(svc, "expectation_watcher", func(ctx context.Context) {
+			svc.Expectations.RunWatcher(ctx, cfg.Expectations.CheckInterval, cfg.Expectations.GraceDays)
+		})
+	}
+	if cfg.Exceptions.SweeperEnabled {
+		track(svc, "exception_sweeper", func(ctx context.Context) {
+			svc.Exceptions.RunSweeper(ctx, cfg.Exceptions.SweepInterval, cfg.Exceptions.AgeDays)
+		})
+	}
+	if cfg.Integrity.CheckerEnabled {
+		track(svc, "integrity_checker", func(ctx context.Context) {
+			svc.Integrity.RunChecker(ctx, cfg.Integrity.CheckInterval)
+		})
+	}
+	if cfg.Kafka.Enabled() {
+		track(svc, "stream_consumer", svc.Streams.RunConsumer)
+	}
+	if cfg.SFTP.Enabled() {
+		track(svc, "sftp_fetcher", func(ctx context.Context) {
+			svc.Fetches.RunFetcher(ctx, cfg.SFTP.PollInterval)
+		})
+	}
+	if cfg.S3.Enabled() {
+		track(svc, "s3_fetcher", func(ctx context.Context) {
+			svc.ObjectFetches.RunFetcher(ctx, cfg.S3.PollInterval)
+		})
+	}
+	if len(cfg.Anomalies.ExpectedFeeds) > 0 {
+		track(svc, "feed_watcher", svc.Anomalies.RunFeedWatcher)
+	}
+	if cfg.Webhooks.SenderEnabled {
+		track(svc, "webhook_sender", func(ctx context.Context) {
+			svc.Webhooks.RunSender(ctx, cfg.Webhooks.PollInterval)
+		})
+	}
 
-	router := handlers.SetupRouter(db, cfg)
+	// Route deadlines answer before the connection's write timeout cuts the
+	// response off
+	writeTimeout := 15 * time.Second
+	if budget := cfg.Latency.MaxBudget() + 5*time.Second; budget > writeTimeout {
+		writeTimeout = budget
+	}
 
 	srv := &http.Server{
 		Addr:         cfg.ServerAddress,
 		Handler:      router,
 		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
+		WriteTimeout: writeTimeout,
 	}
 
 	go func() {
@@ -58,18 +220,45 @@ func main() {
 	}()
 
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 	<-quit
 	log.Println("Shutting down server...")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("Server Shutdown Failed:%+v", err)
+	stopWorkers()
+
+	// Stop accepting connections before draining: the listener closes at once,
+	// and requests in flight, starts running their batch among them, share the
+	// drain deadline with the jobs that outlive their request. Whatever still
+	// runs at the deadline is checkpointed.
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), cfg.Shutdown.DrainTimeout)
+	defer drainCancel()
+	if err := srv.Shutdown(drainCtx); err != nil {
+		log.Printf("Requests still in flight at the drain deadline: %v", err)
+	}
+
+	var drained sync.WaitGroup
+	for tenant, tenantSvc := range graphs {
+		drained.Add(1)
+		go func(tenant string, tenantSvc *services.Services) {
+			defer drained.Done()
+			if err := tenantSvc.Jobs.Drain(drainCtx); err != nil {
+				log.Printf("Job drain of tenant %s incomplete: %v", tenant, err)
+			}
+		}(tenant, tenantSvc)
 	}
+	drained.Wait()
 	log.Println("Server exited gracefully")
 }
 
+// instanceID identifies this process in the job table
+func instanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
 func handleMigration(cfg *config.Config, command string, steps int) {
 	db, err := database.NewConnection(cfg)
 	if err != nil {
@@ -77,10 +266,7 @@ func handleMigration(cfg *config.Config, command string, steps int) {
 	}
 	db.Close()
 
-	m, err := migrate.New(
-		fmt.Sprintf("file://%s", cfg.Migration.Dir),
-		cfg.GetMigrationDBURL(),
-	)
+	m, err := database.NewMigration(cfg)
 	if err != nil {
 		if strings.Contains(err.Error(), "no change") {
 			log.Printf("No migration changes to apply")
@@ -0,0 +1,118 @@
+package banking
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+var (
+	ErrInvalidIBAN = errors.New("invalid IBAN")
+	ErrInvalidBIC  = errors.New("invalid BIC")
+)
+
+// NormalizeIBAN strips whitespace and upper-cases an IBAN
+func NormalizeIBAN(iban string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(iban), ""))
+}
+
+// NormalizeBIC strips whitespace and upper-cases a BIC
+func NormalizeBIC(bic string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(bic), ""))
+}
+
+// ValidateIBAN checks the length, character set and ISO 7064 mod-97 checksum
+func ValidateIBAN(iban string) error {
+	iban = NormalizeIBAN(iban)
+	if len(iban) < 15 || len(iban) > 34 {
+		return ErrInvalidIBAN
+	}
+	for i, c := range iban {
+		switch {
+		case i < 2 && (c < 'A' || c > 'Z'):
+			return ErrInvalidIBAN
+		case i >= 2 && i < 4 && (c < '0' || c > '9'):
+			return ErrInvalidIBAN
+		case (c < 'A' || c > 'Z') && (c < '0' || c > '9'):
+			return ErrInvalidIBAN
+		}
+	}
+
+	if !mod97Valid(iban) {
+		return ErrInvalidIBAN
+	}
+	return nil
+}
+
+// mod97Valid applies the ISO 7064 MOD 97-10 check shared by IBANs and
+// ISO 11649 creditor references: the four leading characters are moved to the
+// end, letters expanded to two digits, and the result must leave remainder 1.
+func mod97Valid(s string) bool {
+	n, ok := mod97(s[4:] + s[:4])
+	return ok && n == 1
+}
+
+// mod97 expands letters to two digits and returns the remainder of the
+// resulting number by 97
+func mod97(s string) (int64, bool) {
+	var digits strings.Builder
+	for _, c := range s {
+		if c >= 'A' && c <= 'Z' {
+			digits.WriteString(big.NewInt(int64(c-'A') + 10).String())
+		} else {
+			digits.WriteRune(c)
+		}
+	}
+
+	n, ok := new(big.Int).SetString(digits.String(), 10)
+	if !ok {
+		return 0, false
+	}
+	return new(big.Int).Mod(n, big.NewInt(97)).Int64(), true
+}
+
+// WithCheckDigits completes an IBAN from its country code and BBAN, or an RF
+// creditor reference from "RF" and its reference, with the mod-97 check
+// digits that make it valid. body must be upper-case letters and digits.
+func WithCheckDigits(prefix, body string) string {
+	n, _ := mod97(body + prefix + "00")
+	return fmt.Sprintf("%s%02d%s", prefix, 98-n, body)
+}
+
+// ValidateBIC checks the ISO 9362 structure of an 8 or 11 character BIC
+func ValidateBIC(bic string) error {
+	bic = NormalizeBIC(bic)
+	if len(bic) != 8 && len(bic) != 11 {
+		return ErrInvalidBIC
+	}
+	for i, c := range bic {
+		isLetter := c >= 'A' && c <= 'Z'
+		isDigit := c >= '0' && c <= '9'
+		if i < 6 && !isLetter {
+			return ErrInvalidBIC
+		}
+		if i >= 6 && !isLetter && !isDigit {
+			return ErrInvalidBIC
+		}
+	}
+	return nil
+}
+
+// IBANCountry returns the ISO 3166 country code embedded in an IBAN
+func IBANCountry(iban string) string {
+	iban = NormalizeIBAN(iban)
+	if len(iban) < 2 {
+		return ""
+	}
+	return iban[:2]
+}
+
+// BICCountry returns the ISO 3166 country code embedded in a BIC
+func BICCountry(bic string) string {
+	bic = NormalizeBIC(bic)
+	if len(bic) < 6 {
+		return ""
+	}
+	return bic[4:6]
+}
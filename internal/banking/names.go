@@ -0,0 +1,83 @@
+package banking
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// NormalizeName reduces a party name or free-text description to upper-case
+// words separated by single spaces, so "Acme, Inc." and "ACME INC" compare
+// equal and names can be found inside descriptions word by word
+func NormalizeName(name string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToUpper(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// AliasDictionary rewrites known aliases in normalized text to their
+// canonical names, e.g. "GOJEK" to "PT APLIKASI KARYA ANAK BANGSA". Aliases
+// match whole words, the longest alias at a position wins, and replacements
+// are not rewritten again.
+type AliasDictionary struct {
+	byFirstWord map[string][]aliasEntry
+}
+
+type aliasEntry struct {
+	words     []string
+	canonical string
+}
+
+// NewAliasDictionary builds a dictionary from normalized alias to normalized
+// canonical name
+func NewAliasDictionary(aliases map[string]string) *AliasDictionary {
+	d := &AliasDictionary{byFirstWord: make(map[string][]aliasEntry)}
+	for alias, canonical := range aliases {
+		words := strings.Fields(alias)
+		if len(words) == 0 {
+			continue
+		}
+		d.byFirstWord[words[0]] = append(d.byFirstWord[words[0]], aliasEntry{words: words, canonical: canonical})
+	}
+	for _, entries := range d.byFirstWord {
+		sort.Slice(entries, func(i, j int) bool { return len(entries[i].words) > len(entries[j].words) })
+	}
+	return d
+}
+
+// Apply normalizes text and replaces every alias in it. A nil dictionary only
+// normalizes.
+func (d *AliasDictionary) Apply(text string) string {
+	normalized := NormalizeName(text)
+	if d == nil || len(d.byFirstWord) == 0 {
+		return normalized
+	}
+
+	words := strings.Fields(normalized)
+	out := make([]string, 0, len(words))
+	for i := 0; i < len(words); {
+		matched := false
+		for _, entry := range d.byFirstWord[words[i]] {
+			if i+len(entry.words) <= len(words) && equalWords(words[i:i+len(entry.words)], entry.words) {
+				out = append(out, entry.canonical)
+				i += len(entry.words)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			out = append(out, words[i])
+			i++
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+func equalWords(a, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package banking
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"strings"
+	"sync"
+)
+
+//go:embed bic_registry.csv
+var bicRegistryCSV string
+
+type BankInfo struct {
+	BIC     string `json:"bic"`
+	Name    string `json:"name"`
+	Country string `json:"country"`
+}
+
+var (
+	registryOnce sync.Once
+	registry     map[string]BankInfo
+)
+
+func loadRegistry() {
+	registry = make(map[string]BankInfo)
+
+	records, err := csv.NewReader(strings.NewReader(bicRegistryCSV)).ReadAll()
+	if err != nil {
+		return
+	}
+	for i, record := range records {
+		if i == 0 || len(record) < 3 {
+			continue
+		}
+		bic := NormalizeBIC(record[0])
+		registry[bic] = BankInfo{
+			BIC:     bic,
+			Name:    strings.TrimSpace(record[1]),
+			Country: strings.TrimSpace(record[2]),
+		}
+	}
+}
+
+// LookupBIC resolves a BIC against the embedded registry. Branch codes are
+// ignored, so an 11 character BIC falls back to its 8 character institution code.
+func LookupBIC(bic string) (BankInfo, bool) {
+	registryOnce.Do(loadRegistry)
+
+	bic = NormalizeBIC(bic)
+	if info, ok := registry[bic]; ok {
+		return info, true
+	}
+	if len(bic) == 11 {
+		if info, ok := registry[bic[:8]]; ok {
+			return info, true
+		}
+	}
+	return BankInfo{}, false
+}
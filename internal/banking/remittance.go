@@ -0,0 +1,59 @@
+package banking
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var ErrInvalidCreditorReference = errors.New("invalid creditor reference")
+
+var creditorReferencePattern = regexp.MustCompile(`RF[0-9]{2}[A-Z0-9]{1,21}`)
+
+// NormalizeCreditorReference strips whitespace and upper-cases an RF reference
+func NormalizeCreditorReference(ref string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(ref), ""))
+}
+
+// ValidateCreditorReference checks an ISO 11649 (RF) creditor reference
+func ValidateCreditorReference(ref string) error {
+	ref = NormalizeCreditorReference(ref)
+	if len(ref) < 5 || len(ref) > 25 || !strings.HasPrefix(ref, "RF") {
+		return ErrInvalidCreditorReference
+	}
+	if creditorReferencePattern.FindString(ref) != ref {
+		return ErrInvalidCreditorReference
+	}
+	if !mod97Valid(ref) {
+		return ErrInvalidCreditorReference
+	}
+	return nil
+}
+
+// ExtractCreditorReference looks for a checksum-valid RF reference inside
+// free-form remittance information, as banks often flatten the ISO 20022
+// structured <CdtrRefInf> block into the unstructured text.
+func ExtractCreditorReference(remittance string) (string, bool) {
+	upper := strings.ToUpper(remittance)
+	for _, candidate := range creditorReferencePattern.FindAllString(upper, -1) {
+		if ValidateCreditorReference(candidate) == nil {
+			return candidate, true
+		}
+	}
+
+	// References are frequently printed in groups of four ("RF18 5390 0754 7034")
+	tokens := strings.Fields(upper)
+	for i, token := range tokens {
+		if !strings.HasPrefix(token, "RF") {
+			continue
+		}
+		candidate := token
+		for j := i + 1; j < len(tokens) && len(candidate) < 25; j++ {
+			candidate += tokens[j]
+			if ValidateCreditorReference(candidate) == nil {
+				return candidate, true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,74 @@
+package calendar
+
+import "time"
+
+const dateLayout = "2006-01-02"
+
+// DefaultWeekend is Saturday and Sunday
+var DefaultWeekend = []time.Weekday{time.Saturday, time.Sunday}
+
+// Calendar answers business-day questions for one set of weekend days and
+// holidays. It is immutable once built and safe for concurrent use.
+type Calendar struct {
+	weekend  map[time.Weekday]bool
+	holidays map[string]bool
+}
+
+// New builds a calendar from weekend days and holiday dates in YYYY-MM-DD
+// form. Unparseable holiday dates are ignored.
+func New(weekend []time.Weekday, holidays []string) *Calendar {
+	c := &Calendar{
+		weekend:  make(map[time.Weekday]bool, len(weekend)),
+		holidays: make(map[string]bool, len(holidays)),
+	}
+	for _, day := range weekend {
+		c.weekend[day] = true
+	}
+	for _, holiday := range holidays {
+		if date, err := time.Parse(dateLayout, holiday); err == nil {
+			c.holidays[date.Format(dateLayout)] = true
+		}
+	}
+	return c
+}
+
+func (c *Calendar) IsBusinessDay(t time.Time) bool {
+	return !c.weekend[t.Weekday()] && !c.holidays[t.Format(dateLayout)]
+}
+
+// BusinessDaysBetween counts the business days after the earlier date up to
+// and including the later one, so a Friday and the following Monday are one
+// business day apart. The order of the arguments does not matter.
+func (c *Calendar) BusinessDaysBetween(a, b time.Time) int {
+	from, to := truncate(a), truncate(b)
+	if from.After(to) {
+		from, to = to, from
+	}
+	days := 0
+	for d := from.AddDate(0, 0, 1); !d.After(to); d = d.AddDate(0, 0, 1) {
+		if c.IsBusinessDay(d) {
+			days++
+		}
+	}
+	return days
+}
+
+// AddBusinessDays moves n business days forward (or backward for negative n)
+func (c *Calendar) AddBusinessDays(t time.Time, n int) time.Time {
+	step := 1
+	if n < 0 {
+		step, n = -1, -n
+	}
+	d := truncate(t)
+	for n > 0 {
+		d = d.AddDate(0, 0, step)
+		if c.IsBusinessDay(d) {
+			n--
+		}
+	}
+	return d
+}
+
+func truncate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -2,6 +2,10 @@ package config
 
 import (
 	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -11,43 +15,1140 @@ type Config struct {
 	Environment   string `env:"ENVIRONMENT,required"`
 	Database      DatabaseConfig
 	Migration     MigrationConfig
+	Matching      MatchingConfig
+	Quota         QuotaConfig
+	Shutdown      ShutdownConfig
+	Partition     PartitionConfig
+	Queue         QueueConfig
+	Scheduler     SchedulerConfig
+	I18n          I18nConfig
+	Export        ExportConfig
+	Artifacts     ArtifactsConfig
+	Results       ResultsConfig
+	Safety        SafetyConfig
+	Auth          AuthConfig
+	Latency       LatencyConfig
+	Access        AccessConfig
+	RequestAudit  RequestAuditConfig
+	Retention     RetentionConfig
+	Expectations  ExpectationsConfig
+	Returns       ReturnsConfig
+	Exceptions    ExceptionsConfig
+	Integrity     IntegrityConfig
+	Fixtures      FixturesConfig
+	Notification  NotificationConfig
+	OpenAPI       OpenAPIConfig
+	KPI           KPIConfig
+	Log           LogConfig
+	Metrics       MetricsConfig
+	Idempotency   IdempotencyConfig
+	Kafka         KafkaConfig
+	SFTP          SFTPConfig
+	S3            S3Config
+	Email         EmailConfig
+	Tenants       TenantsConfig
+	Sandbox       SandboxConfig
+	BatchIDs      BatchIDConfig
+	Heartbeat     HeartbeatConfig
+	Ingestion     IngestionConfig
+	Failover      FailoverConfig
+	Anomalies     AnomalyConfig
+	Webhooks      WebhookConfig
+	Digest        DigestConfig
+	APIKeys       APIKeyConfig
 }
 
+// Database drivers. SQLite runs the service on a file, or in memory when
+// DB_NAME is SQLiteMemory, for tests and local runs without MySQL.
+const (
+	DriverMySQL  = "mysql"
+	DriverSQLite = "sqlite"
+
+	SQLiteMemory = ":memory:"
+)
+
 type DatabaseConfig struct {
+	Driver   string `env:"DB_DRIVER"`
 	Host     string `env:"DB_HOST,required"`
 	Port     int    `env:"DB_PORT,required"`
 	User     string `env:"DB_USER,required"`
 	Password string `env:"DB_PASSWORD,required"`
 	Name     string `env:"DB_NAME,required"`
 	Params   string `env:"DB_PARAMS,required"`
+	// Read replica that serves reads while the primary is unavailable;
+	// empty serves none. It takes the primary's credentials and port
+	// unless DB_REPLICA_PORT is set.
+	ReplicaHost string `env:"DB_REPLICA_HOST"`
+	ReplicaPort int    `env:"DB_REPLICA_PORT"`
+}
+
+// SQLite reports whether the database is SQLite, whose file DB_NAME names
+func (c DatabaseConfig) SQLite() bool {
+	return c.Driver == DriverSQLite
+}
+
+// InMemory reports whether the database is an in-memory SQLite database,
+// which lives only as long as the process
+func (c DatabaseConfig) InMemory() bool {
+	return c.SQLite() && c.Name == SQLiteMemory
 }
 
 type MigrationConfig struct {
 	Dir string `env:"MIGRATION_DIR"`
 }
 
+type ShutdownConfig struct {
+	DrainTimeout time.Duration `env:"SHUTDOWN_DRAIN_TIMEOUT"`
+}
+
+type PartitionConfig struct {
+	WorkerEnabled bool          `env:"PARTITION_WORKER_ENABLED"`
+	PollInterval  time.Duration `env:"PARTITION_POLL_INTERVAL"`
+}
+
+type QueueConfig struct {
+	WorkerEnabled     bool          `env:"QUEUE_WORKER_ENABLED"`
+	PollInterval      time.Duration `env:"QUEUE_POLL_INTERVAL"`
+	MaxConcurrentJobs int           `env:"QUEUE_MAX_CONCURRENT_JOBS"`
+	// Jobs one tenant may run at once across all instances; 0 leaves tenants
+	// bounded by MaxConcurrentJobs alone
+	TenantMaxConcurrentJobs int `env:"QUEUE_TENANT_MAX_CONCURRENT_JOBS"`
+	// Share of the claims each tenant gets while several have jobs queued,
+	// read from QUEUE_TENANT_WEIGHTS as comma-separated tenant=weight pairs
+	TenantWeights map[string]int `env:"QUEUE_TENANT_WEIGHTS"`
+}
+
+// TenantWeight is the weight of a tenant in the queue; tenants without one
+// weigh 1
+func (c QueueConfig) TenantWeight(tenant string) int {
+	if weight, ok := c.TenantWeights[tenant]; ok {
+		return weight
+	}
+	return 1
+}
+
+// parseTenantWeights reads comma-separated tenant=weight pairs
+func parseTenantWeights(value string) (map[string]int, error) {
+	weights := make(map[string]int)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		tenant, weight, ok := strings.Cut(pair, "=")
+		tenant = strings.TrimSpace(tenant)
+		if !ok || tenant == "" {
+			return nil, fmt.Errorf("tenant weight %q must be tenant=weight", pair)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(weight))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("tenant weight %q must be a whole number of at least 1", pair)
+		}
+		weights[tenant] = n
+	}
+	return weights, nil
+}
+
+type SchedulerConfig struct {
+	Enabled      bool          `env:"SCHEDULER_ENABLED"`
+	PollInterval time.Duration `env:"SCHEDULER_POLL_INTERVAL"`
+}
+
+type RetentionConfig struct {
+	PurgerEnabled bool          `env:"RETENTION_PURGER_ENABLED"`
+	PurgeInterval time.Duration `env:"RETENTION_PURGE_INTERVAL"`
+	// Only report what the purger would delete, without deleting it
+	DryRun bool `env:"RETENTION_DRY_RUN"`
+}
+
+type ExpectationsConfig struct {
+	WatcherEnabled bool          `env:"EXPECTATIONS_WATCHER_ENABLED"`
+	CheckInterval  time.Duration `env:"EXPECTATIONS_CHECK_INTERVAL"`
+	// Days after its window ends before a pending expectation is missed
+	GraceDays int `env:"EXPECTATIONS_GRACE_DAYS"`
+}
+
+type ReturnsConfig struct {
+	// What a batch does to the match of a transaction a return gives back:
+	// unmatch it, releasing its accounting entries, or flag it as disputed
+	Action string `env:"RETURNS_ACTION"`
+}
+
+type ExceptionsConfig struct {
+	SweeperEnabled bool          `env:"EXCEPTIONS_SWEEPER_ENABLED"`
+	SweepInterval  time.Duration `env:"EXCEPTIONS_SWEEP_INTERVAL"`
+	// Days a record stays unmatched before it moves into the exception queue
+	AgeDays int `env:"EXCEPTIONS_AGE_DAYS"`
+}
+
+type IntegrityConfig struct {
+	CheckerEnabled bool          `env:"INTEGRITY_CHECKER_ENABLED"`
+	CheckInterval  time.Duration `env:"INTEGRITY_CHECK_INTERVAL"`
+}
+
+type HeartbeatConfig struct {
+	// How often an instance beats for its workers and running jobs
+	Interval time.Duration `env:"HEARTBEAT_INTERVAL"`
+	// A running job without a beat for this long is stuck
+	StuckThreshold time.Duration `env:"STUCK_JOB_THRESHOLD"`
+	MonitorEnabled bool          `env:"STUCK_JOB_MONITOR_ENABLED"`
+	// Put stuck reconciliation and partition jobs back on the queue
+	Requeue bool `env:"STUCK_JOB_REQUEUE"`
+}
+
+type FailoverConfig struct {
+	// How often the primary database is pinged
+	CheckInterval time.Duration `env:"DB_FAILOVER_CHECK_INTERVAL"`
+	// Failed pings in a row that switch the service to read-only
+	FailureThreshold int `env:"DB_FAILOVER_THRESHOLD"`
+	// Idempotent writes held while read-only, to be replayed once the
+	// primary is back; 0 queues none
+	OutboxSize int `env:"DB_FAILOVER_OUTBOX_SIZE"`
+}
+
+type AnomalyConfig struct {
+	// Data-quality score below which an ingested file raises an
+	// ingestion.quality_below_threshold webhook; 0 raises none
+	QualityThreshold float64 `env:"INGEST_QUALITY_THRESHOLD"`
+	// Sources expected to bring transactions every weekday, named as on
+	// ingestion files: sftp:<directory>, s3:<bucket> or email:<mailbox>
+	ExpectedFeeds []string `env:"INGEST_EXPECTED_FEEDS"`
+	// Hour of the day, UTC, by which an expected feed must have brought
+	// transactions
+	FeedCutoffHour    int           `env:"INGEST_FEED_CUTOFF_HOUR"`
+	FeedCheckInterval time.Duration `env:"INGEST_FEED_CHECK_INTERVAL"`
+}
+
+type WebhookConfig struct {
+	SenderEnabled bool          `env:"WEBHOOK_SENDER_ENABLED"`
+	PollInterval  time.Duration `env:"WEBHOOK_POLL_INTERVAL"`
+	// How long an endpoint has to answer a delivery
+	Timeout time.Duration `env:"WEBHOOK_TIMEOUT"`
+	// Attempts before a delivery is given up as failed; the wait before a
+	// retry doubles from RetryBackoff
+	MaxAttempts  int           `env:"WEBHOOK_MAX_ATTEMPTS"`
+	RetryBackoff time.Duration `env:"WEBHOOK_RETRY_BACKOFF"`
+}
+
+type DigestConfig struct {
+	SenderEnabled bool `env:"DIGEST_SENDER_ENABLED"`
+	// Hour of the day, UTC, after which yesterday's digest is sent
+	Hour          int           `env:"DIGEST_HOUR"`
+	CheckInterval time.Duration `env:"DIGEST_CHECK_INTERVAL"`
+	// Ages in days an unmatched record is reported at on the day it reaches
+	// them
+	AgingThresholds []int `env:"DIGEST_AGING_THRESHOLDS"`
+}
+
+type APIKeyConfig struct {
+	// How long a rotated key keeps working next to its replacement
+	RotationGrace time.Duration `env:"API_KEY_ROTATION_GRACE"`
+}
+
+// parseDays reads a comma-separated list of day counts of at least 1
+func parseDays(key, value string) ([]int, error) {
+	days := []int{}
+	for _, item := range parseList(value) {
+		n, err := strconv.Atoi(item)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("%s item %q must be a whole number of at least 1", key, item)
+		}
+		days = append(days, n)
+	}
+	return days, nil
+}
+
+type IngestionConfig struct {
+	// Largest JSON array ingested on the real-time lane; larger arrays and
+	// every statement file take the bulk lane
+	RealtimeMaxRecords int `env:"INGEST_REALTIME_MAX_RECORDS"`
+	// Database connections each lane may hold, in pools of their own, so a
+	// file load cannot take the connections real-time posting needs
+	RealtimeConnections int `env:"INGEST_REALTIME_CONNECTIONS"`
+	BulkConnections     int `env:"INGEST_BULK_CONNECTIONS"`
+	// Records the bulk lane commits per transaction
+	BulkChunkSize int `env:"INGEST_BULK_CHUNK_SIZE"`
+	// Largest request bodies, in bytes, of an uploaded JSON array, which is
+	// decoded as it streams in, and of a statement file, which is read whole
+	MaxJSONBytes      int64 `env:"INGEST_MAX_JSON_BYTES"`
+	MaxStatementBytes int64 `env:"INGEST_MAX_STATEMENT_BYTES"`
+}
+
+type FixturesConfig struct {
+	// Allows loading anonymized fixture bundles; set only in staging and
+	// other environments whose data may be overwritten
+	ImportEnabled bool `env:"FIXTURE_IMPORT_ENABLED"`
+}
+
+type OpenAPIConfig struct {
+	// Serves Swagger UI at /api/v1/docs; the OpenAPI document itself is
+	// always served at /api/v1/openapi.json
+	SwaggerUI bool `env:"OPENAPI_SWAGGER_UI"`
+}
+
+type LogConfig struct {
+	// Least level of the JSON request log: debug, info, warn or error.
+	// Requests answered 5xx log at error and 4xx at warn.
+	Level slog.Level `env:"LOG_LEVEL"`
+}
+
+type MetricsConfig struct {
+	// Bearer token GET /metrics requires; empty leaves it public like
+	// /health
+	Token string `env:"METRICS_TOKEN"`
+}
+
+type IdempotencyConfig struct {
+	// How long a reconciliation start's Idempotency-Key replays its first
+	// response; after that the key may start a new run
+	KeyTTL time.Duration `env:"IDEMPOTENCY_KEY_TTL"`
+}
+
+type KafkaConfig struct {
+	// Brokers of the cluster transactions are streamed from; none leaves
+	// the consumer off
+	Brokers []string `env:"KAFKA_BROKERS"`
+	// Consumer group whose offsets every instance shares
+	GroupID string `env:"KAFKA_GROUP_ID"`
+	// Topics of bank transactions and of accounting entries, one record per
+	// message; an empty topic is not consumed
+	BankTopic       string `env:"KAFKA_BANK_TOPIC"`
+	AccountingTopic string `env:"KAFKA_ACCOUNTING_TOPIC"`
+	// Most records ingested at once, and the longest a record waits for
+	// its batch to fill
+	BatchSize int           `env:"KAFKA_BATCH_SIZE"`
+	BatchWait time.Duration `env:"KAFKA_BATCH_WAIT"`
+}
+
+// Enabled reports whether anything is to be consumed
+func (c KafkaConfig) Enabled() bool {
+	return len(c.Brokers) > 0 && (c.BankTopic != "" || c.AccountingTopic != "")
+}
+
+type SFTPConfig struct {
+	// host:port of the server banks drop statement files on; without it,
+	// or without directories, the fetcher is off
+	Host string `env:"SFTP_HOST"`
+	User string `env:"SFTP_USER"`
+	// Password or private key (PEM) the user logs in with
+	Password       string `env:"SFTP_PASSWORD"`
+	PrivateKeyFile string `env:"SFTP_PRIVATE_KEY_FILE"`
+	// known_hosts file the server's host key must be listed in
+	KnownHostsFile string `env:"SFTP_KNOWN_HOSTS_FILE"`
+	// Remote directories polled for statement files
+	Directories []string `env:"SFTP_DIRECTORIES"`
+	// Where ingested files and files that cannot be ingested are moved,
+	// relative to the directory they were found in unless absolute
+	ArchiveDir   string        `env:"SFTP_ARCHIVE_DIR"`
+	RejectedDir  string        `env:"SFTP_REJECTED_DIR"`
+	PollInterval time.Duration `env:"SFTP_POLL_INTERVAL"`
+	// Files changed more recently than this may still be uploading and are
+	// left for the next poll
+	SettleTime time.Duration `env:"SFTP_SETTLE_TIME"`
+}
+
+// Enabled reports whether there is anything to poll
+func (c SFTPConfig) Enabled() bool {
+	return c.Host != "" && len(c.Directories) > 0
+}
+
+type S3Config struct {
+	// host[:port] of an S3-compatible endpoint, such as MinIO; without it
+	// nothing is pulled from buckets
+	Endpoint  string `env:"S3_ENDPOINT"`
+	AccessKey string `env:"S3_ACCESS_KEY"`
+	SecretKey string `env:"S3_SECRET_KEY"`
+	Region    string `env:"S3_REGION"`
+	UseSSL    bool   `env:"S3_USE_SSL"`
+	// bucket or bucket/prefix entries polled for statement files
+	Sources      []string      `env:"S3_SOURCES"`
+	PollInterval time.Duration `env:"S3_POLL_INTERVAL"`
+}
+
+// Enabled reports whether there are buckets to poll
+func (c S3Config) Enabled() bool {
+	return c.Endpoint != "" && len(c.Sources) > 0
+}
+
+type EmailConfig struct {
+	// Key the email provider signs every message it forwards with, an
+	// HMAC-SHA256 of the raw message; without it, or without mailboxes, no
+	// email is accepted
+	SigningKey string `env:"EMAIL_INGEST_SIGNING_KEY"`
+	// Addresses statements are mailed to, each with the senders allowed to
+	// mail it, read from EMAIL_INGEST_MAILBOXES as comma-separated
+	// mailbox=sender|sender pairs. A sender is an address or an @domain.
+	Mailboxes map[string][]string `env:"EMAIL_INGEST_MAILBOXES"`
+}
+
+// Enabled reports whether there are mailboxes to accept email for
+func (c EmailConfig) Enabled() bool {
+	return c.SigningKey != "" && len(c.Mailboxes) > 0
+}
+
+// parseMailboxes reads comma-separated mailbox=sender|sender pairs, lower
+// casing every address
+func parseMailboxes(value string) (map[string][]string, error) {
+	mailboxes := make(map[string][]string)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		mailbox, senders, ok := strings.Cut(pair, "=")
+		mailbox = strings.ToLower(strings.TrimSpace(mailbox))
+		if !ok || !strings.Contains(mailbox, "@") {
+			return nil, fmt.Errorf("mailbox %q must be address=sender|sender", pair)
+		}
+		if _, seen := mailboxes[mailbox]; seen {
+			return nil, fmt.Errorf("mailbox %s is listed twice", mailbox)
+		}
+		var allowed []string
+		for _, sender := range strings.Split(senders, "|") {
+			sender = strings.ToLower(strings.TrimSpace(sender))
+			if sender == "" {
+				continue
+			}
+			if !strings.Contains(sender, "@") || strings.HasSuffix(sender, "@") {
+				return nil, fmt.Errorf("sender %q of mailbox %s must be an address or an @domain", sender, mailbox)
+			}
+			allowed = append(allowed, sender)
+		}
+		if len(allowed) == 0 {
+			return nil, fmt.Errorf("mailbox %s allows no senders", mailbox)
+		}
+		mailboxes[mailbox] = allowed
+	}
+	return mailboxes, nil
+}
+
+// DefaultTenant owns every record of a deployment that isolates no tenants,
+// and every record stored before tenants were isolated
+const DefaultTenant = "default"
+
+type TenantsConfig struct {
+	// tenants whose records are kept apart; the first one also runs the
+	// deployment-wide features. Empty keeps every record in DefaultTenant.
+	IDs []string `env:"TENANTS"`
+}
+
+// Enabled reports whether requests are isolated by tenant
+func (c TenantsConfig) Enabled() bool {
+	return len(c.IDs) > 0
+}
+
+type SandboxConfig struct {
+	// Tenant holding synthetic data that integrating teams reach with a
+	// sandbox API key; without keys there is no sandbox
+	Tenant  string   `env:"SANDBOX_TENANT"`
+	APIKeys []string `env:"SANDBOX_API_KEYS"`
+	// UTC hour at which the sandbox data is reset each night
+	ResetHour int `env:"SANDBOX_RESET_HOUR"`
+	// invoices generated on each reset, most with the bank transaction that
+	// pays them
+	Transactions int `env:"SANDBOX_TRANSACTIONS"`
+}
+
+// Enabled reports whether sandbox API keys are configured
+func (c SandboxConfig) Enabled() bool {
+	return len(c.APIKeys) > 0
+}
+
+// Primary is the tenant deployment-wide features and background ingestion
+// work for
+func (c TenantsConfig) Primary() string {
+	if len(c.IDs) == 0 {
+		return DefaultTenant
+	}
+	return c.IDs[0]
+}
+
+type KPIConfig struct {
+	// KPI file (YAML or JSON) of the expressions batch summaries report, by
+	// default and per tenant; empty reports none
+	File string `env:"KPI_FILE"`
+}
+
+type I18nConfig struct {
+	DefaultLocale string `env:"I18N_DEFAULT_LOCALE"`
+	TenantLocales string `env:"I18N_TENANT_LOCALES"`
+}
+
+type ExportConfig struct {
+	Currency string `env:"EXPORT_CURRENCY"`
+	// Batch reports with more rows than this are written by the export
+	// worker instead of streamed in the request; 0 streams every report
+	AsyncRowThreshold int `env:"EXPORT_ASYNC_ROW_THRESHOLD"`
+	// Directory export files are stored in, shared by all instances
+	StorageDir string `env:"EXPORT_STORAGE_DIR"`
+	// Secret download links are signed with; empty uses JWT_SECRET
+	SigningKey string `env:"EXPORT_SIGNING_KEY"`
+	// How long a download link stays valid
+	LinkTTL time.Duration `env:"EXPORT_LINK_TTL"`
+	// Base URL download links start with, such as https://recon.example.com;
+	// empty makes them relative
+	PublicURL     string        `env:"EXPORT_PUBLIC_URL"`
+	WorkerEnabled bool          `env:"EXPORT_WORKER_ENABLED"`
+	PollInterval  time.Duration `env:"EXPORT_POLL_INTERVAL"`
+}
+
+type ArtifactsConfig struct {
+	// Secret report artifacts are signed with; empty uses the export
+	// signing key. Changing it invalidates every signature issued before.
+	SigningKey string `env:"ARTIFACT_SIGNING_KEY"`
+}
+
+type ResultsConfig struct {
+	InlineLimit int `env:"RESULTS_INLINE_LIMIT"`
+}
+
+// Formats new batch IDs are generated in
+const (
+	BatchIDFormatTimestamp = "timestamp"
+	BatchIDFormatUUID      = "uuid"
+)
+
+type BatchIDConfig struct {
+	// How new batch IDs look: timestamp (REC-20060102-150405-abcd) or uuid
+	// (a random UUID). IDs already issued keep working either way.
+	Format string `env:"BATCH_ID_FORMAT"`
+}
+
+type SafetyConfig struct {
+	// Token confirming destructive operations in production; empty refuses
+	// them there altogether
+	ConfirmToken string `env:"SAFETY_CONFIRM_TOKEN"`
+}
+
+type AuthConfig struct {
+	// HS256 secret bearer tokens are signed with; empty turns authentication
+	// off, which only non-production environments allow
+	JWTSecret   string        `env:"JWT_SECRET"`
+	JWTIssuer   string        `env:"JWT_ISSUER"`
+	JWTAudience string        `env:"JWT_AUDIENCE"`
+	ClockSkew   time.Duration `env:"JWT_CLOCK_SKEW"`
+}
+
+type AccessConfig struct {
+	// Comma-separated token subjects that are admins without a users row,
+	// so a fresh installation can assign the first roles
+	BootstrapAdmins []string `env:"RBAC_BOOTSTRAP_ADMINS"`
+}
+
+type RequestAuditConfig struct {
+	// How long request audits are kept; 0 keeps them forever
+	Retention time.Duration `env:"REQUEST_AUDIT_RETENTION"`
+	// Largest request body stored in an audit, in bytes; larger bodies keep
+	// only their size and hash
+	MaxPayload int `env:"REQUEST_AUDIT_MAX_PAYLOAD"`
+}
+
+type NotificationConfig struct {
+	// Repeats of an event for the same entity inside this window are
+	// suppressed instead of delivered; 0 delivers every occurrence
+	DedupWindow time.Duration `env:"NOTIFICATION_DEDUP_WINDOW"`
+}
+
+type LatencyConfig struct {
+	// Deadline of routes without their own; 0 leaves them unbounded
+	DefaultBudget time.Duration `env:"LATENCY_DEFAULT_BUDGET"`
+	// Per-route deadlines keyed by "METHOD /path/template", read from
+	// LATENCY_ROUTE_BUDGETS as comma-separated "METHOD /path=duration" pairs
+	RouteBudgets map[string]time.Duration `env:"LATENCY_ROUTE_BUDGETS"`
+	// How long before its deadline a synchronous reconciliation start stops
+	// waiting, answers 202 with its job and finishes in the background; 0
+	// keeps it waiting into a 504
+	AsyncHandoff time.Duration `env:"LATENCY_ASYNC_HANDOFF"`
+}
+
+// StartRoute is the route budget key of a synchronous reconciliation start,
+// the one route LatencyConfig.AsyncHandoff applies to
+const StartRoute = "POST /reconciliation/start"
+
+// MaxBudget is the longest deadline any route has
+func (c LatencyConfig) MaxBudget() time.Duration {
+	longest := c.DefaultBudget
+	for _, budget := range c.RouteBudgets {
+		if budget > longest {
+			longest = budget
+		}
+	}
+	return longest
+}
+
+// parseRouteBudgets reads comma-separated "METHOD /path=duration" pairs
+// parseList splits a comma-separated setting, dropping empty items
+func parseList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// nettingEntryTypes parses MATCH_NETTING_ENTRY_TYPES, where none nets nothing
+func nettingEntryTypes(value string) []string {
+	if strings.EqualFold(strings.TrimSpace(value), "none") {
+		return []string{}
+	}
+	return parseList(strings.ToLower(value))
+}
+
+func parseRouteBudgets(value string) (map[string]time.Duration, error) {
+	budgets := make(map[string]time.Duration)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		split := strings.LastIndex(pair, "=")
+		if split < 0 {
+			return nil, fmt.Errorf("route budget %q must be METHOD /path=duration", pair)
+		}
+		method, path, ok := strings.Cut(strings.TrimSpace(pair[:split]), " ")
+		if !ok || strings.TrimSpace(path) == "" {
+			return nil, fmt.Errorf("route budget %q must be METHOD /path=duration", pair)
+		}
+		budget, err := time.ParseDuration(strings.TrimSpace(pair[split+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("route budget %q: %w", pair, err)
+		}
+		budgets[strings.ToUpper(method)+" "+strings.TrimSpace(path)] = budget
+	}
+	return budgets, nil
+}
+
+type QuotaConfig struct {
+	MonthlyRequests     int64 `env:"QUOTA_MONTHLY_REQUESTS"`
+	MonthlyRowsIngested int64 `env:"QUOTA_MONTHLY_ROWS_INGESTED"`
+	MonthlyBatches      int64 `env:"QUOTA_MONTHLY_BATCHES"`
+}
+
+type MatchingConfig struct {
+	CreditorReferenceMatching bool   `env:"MATCH_CREDITOR_REFERENCE"`
+	Calendar                  string `env:"MATCH_CALENDAR"`
+	// Currency of records ingested or stored without one
+	BaseCurrency string `env:"BASE_CURRENCY"`
+	// Extra amount tolerance for pairs compared through an exchange rate
+	FXToleranceBasisPoints int64 `env:"MATCH_FX_TOLERANCE_BASIS_POINTS"`
+	// Match strategies in the order the engine runs them; empty runs the
+	// default pipeline
+	Strategies []string `env:"MATCH_STRATEGIES"`
+	// Entry types netted against the entries one payment settles; none
+	// turns netting off
+	NettingEntryTypes []string `env:"MATCH_NETTING_ENTRY_TYPES"`
+	// Days within which a record and its reversal are paired and netted
+	// out before matching; 0 turns pairing off
+	ReversalWindowDays int `env:"MATCH_REVERSAL_WINDOW_DAYS"`
+	// Declarative rule file (YAML or JSON) read at startup; empty uses the
+	// built-in rules
+	RulesFile string `env:"MATCH_RULES_FILE"`
+	// Matches below this confidence are stored pending review instead of
+	// matched; 0 stores every match as matched
+	ReviewConfidence float64 `env:"MATCH_REVIEW_CONFIDENCE"`
+}
+
 func LoadConfig() (*Config, error) {
 	viper.SetConfigFile(".env")
 	viper.AutomaticEnv()
 
+	viper.SetDefault("DB_DRIVER", DriverMySQL)
+	viper.SetDefault("MATCH_CREDITOR_REFERENCE", true)
+	viper.SetDefault("MATCH_NETTING_ENTRY_TYPES", "credit_note")
+	viper.SetDefault("MATCH_REVERSAL_WINDOW_DAYS", 5)
+	viper.SetDefault("BASE_CURRENCY", "USD")
+	viper.SetDefault("MATCH_FX_TOLERANCE_BASIS_POINTS", 50)
+	viper.SetDefault("SHUTDOWN_DRAIN_TIMEOUT", "60s")
+	viper.SetDefault("PARTITION_WORKER_ENABLED", true)
+	viper.SetDefault("PARTITION_POLL_INTERVAL", "5s")
+	viper.SetDefault("QUEUE_WORKER_ENABLED", true)
+	viper.SetDefault("QUEUE_POLL_INTERVAL", "5s")
+	viper.SetDefault("SCHEDULER_ENABLED", true)
+	viper.SetDefault("SCHEDULER_POLL_INTERVAL", "30s")
+	viper.SetDefault("QUEUE_MAX_CONCURRENT_JOBS", 2)
+	viper.SetDefault("QUEUE_TENANT_MAX_CONCURRENT_JOBS", 0)
+	viper.SetDefault("QUEUE_TENANT_WEIGHTS", "")
+	viper.SetDefault("I18N_DEFAULT_LOCALE", "en")
+	viper.SetDefault("EXPORT_CURRENCY", "USD")
+	viper.SetDefault("EXPORT_ASYNC_ROW_THRESHOLD", 50000)
+	viper.SetDefault("EXPORT_STORAGE_DIR", "data/exports")
+	viper.SetDefault("EXPORT_LINK_TTL", "24h")
+	viper.SetDefault("EXPORT_WORKER_ENABLED", true)
+	viper.SetDefault("EXPORT_POLL_INTERVAL", "5s")
+	viper.SetDefault("RESULTS_INLINE_LIMIT", 500)
+	viper.SetDefault("JWT_CLOCK_SKEW", "30s")
+	viper.SetDefault("LATENCY_DEFAULT_BUDGET", "30s")
+	viper.SetDefault("REQUEST_AUDIT_RETENTION", "2160h")
+	viper.SetDefault("REQUEST_AUDIT_MAX_PAYLOAD", 1<<20)
+	viper.SetDefault("NOTIFICATION_DEDUP_WINDOW", "15m")
+	viper.SetDefault("RETENTION_PURGER_ENABLED", true)
+	viper.SetDefault("RETENTION_PURGE_INTERVAL", "24h")
+	viper.SetDefault("EXPECTATIONS_WATCHER_ENABLED", true)
+	viper.SetDefault("EXPECTATIONS_CHECK_INTERVAL", "1h")
+	viper.SetDefault("RETURNS_ACTION", "unmatch")
+	viper.SetDefault("EXCEPTIONS_SWEEPER_ENABLED", true)
+	viper.SetDefault("EXCEPTIONS_SWEEP_INTERVAL", "1h")
+	viper.SetDefault("EXCEPTIONS_AGE_DAYS", 7)
+	viper.SetDefault("INTEGRITY_CHECKER_ENABLED", true)
+	viper.SetDefault("INTEGRITY_CHECK_INTERVAL", "24h")
+	viper.SetDefault("FIXTURE_IMPORT_ENABLED", false)
+	viper.SetDefault("SANDBOX_TENANT", "sandbox")
+	viper.SetDefault("SANDBOX_RESET_HOUR", 2)
+	viper.SetDefault("SANDBOX_TRANSACTIONS", 200)
+	viper.SetDefault("OPENAPI_SWAGGER_UI", false)
+	viper.SetDefault("LOG_LEVEL", "info")
+	viper.SetDefault("IDEMPOTENCY_KEY_TTL", "24h")
+	viper.SetDefault("LATENCY_ROUTE_BUDGETS", "GET /reconciliation/{batch_id}/status=2s,POST /reconciliation/start=120s")
+	viper.SetDefault("LATENCY_ASYNC_HANDOFF", "10s")
+	viper.SetDefault("KAFKA_GROUP_ID", "reconciliation-service")
+	viper.SetDefault("KAFKA_BATCH_SIZE", 500)
+	viper.SetDefault("KAFKA_BATCH_WAIT", "2s")
+	viper.SetDefault("SFTP_ARCHIVE_DIR", "archive")
+	viper.SetDefault("SFTP_REJECTED_DIR", "rejected")
+	viper.SetDefault("SFTP_POLL_INTERVAL", "15m")
+	viper.SetDefault("SFTP_SETTLE_TIME", "1m")
+	viper.SetDefault("S3_REGION", "us-east-1")
+	viper.SetDefault("S3_USE_SSL", true)
+	viper.SetDefault("S3_POLL_INTERVAL", "15m")
+	viper.SetDefault("BATCH_ID_FORMAT", BatchIDFormatTimestamp)
+	viper.SetDefault("HEARTBEAT_INTERVAL", "30s")
+	viper.SetDefault("STUCK_JOB_THRESHOLD", "5m")
+	viper.SetDefault("STUCK_JOB_MONITOR_ENABLED", true)
+	viper.SetDefault("STUCK_JOB_REQUEUE", false)
+	viper.SetDefault("INGEST_REALTIME_MAX_RECORDS", 100)
+	viper.SetDefault("INGEST_REALTIME_CONNECTIONS", 10)
+	viper.SetDefault("INGEST_BULK_CONNECTIONS", 4)
+	viper.SetDefault("INGEST_BULK_CHUNK_SIZE", 1000)
+	viper.SetDefault("INGEST_MAX_JSON_BYTES", 256<<20)
+	viper.SetDefault("INGEST_MAX_STATEMENT_BYTES", 10<<20)
+	viper.SetDefault("DB_FAILOVER_CHECK_INTERVAL", "5s")
+	viper.SetDefault("DB_FAILOVER_THRESHOLD", 3)
+	viper.SetDefault("DB_FAILOVER_OUTBOX_SIZE", 500)
+	viper.SetDefault("INGEST_QUALITY_THRESHOLD", 0.5)
+	viper.SetDefault("INGEST_FEED_CUTOFF_HOUR", 10)
+	viper.SetDefault("INGEST_FEED_CHECK_INTERVAL", "15m")
+	viper.SetDefault("WEBHOOK_SENDER_ENABLED", true)
+	viper.SetDefault("WEBHOOK_POLL_INTERVAL", "10s")
+	viper.SetDefault("WEBHOOK_TIMEOUT", "10s")
+	viper.SetDefault("WEBHOOK_MAX_ATTEMPTS", 8)
+	viper.SetDefault("WEBHOOK_RETRY_BACKOFF", "30s")
+	viper.SetDefault("DIGEST_SENDER_ENABLED", true)
+	viper.SetDefault("DIGEST_HOUR", 6)
+	viper.SetDefault("DIGEST_CHECK_INTERVAL", "15m")
+	viper.SetDefault("DIGEST_AGING_THRESHOLDS", "30,60,90")
+	viper.SetDefault("API_KEY_ROTATION_GRACE", "24h")
+
 	if err := viper.ReadInConfig(); err != nil {
 		return nil, fmt.Errorf("error reading config file: %w", err)
 	}
 
+	driver := viper.GetString("DB_DRIVER")
+	if driver != DriverMySQL && driver != DriverSQLite {
+		return nil, fmt.Errorf("DB_DRIVER must be %s or %s, got %q", DriverMySQL, DriverSQLite, driver)
+	}
+	if driver == DriverSQLite && viper.GetString("DB_REPLICA_HOST") != "" {
+		return nil, fmt.Errorf("DB_REPLICA_HOST is not supported with DB_DRIVER=%s", DriverSQLite)
+	}
+
+	routeBudgets, err := parseRouteBudgets(viper.GetString("LATENCY_ROUTE_BUDGETS"))
+	if err != nil {
+		return nil, err
+	}
+
+	handoff := viper.GetDuration("LATENCY_ASYNC_HANDOFF")
+	if handoff < 0 {
+		return nil, fmt.Errorf("LATENCY_ASYNC_HANDOFF must not be negative, got %v", handoff)
+	}
+	startBudget := viper.GetDuration("LATENCY_DEFAULT_BUDGET")
+	if budget, ok := routeBudgets[StartRoute]; ok {
+		startBudget = budget
+	}
+	if handoff > 0 && startBudget > 0 && handoff >= startBudget {
+		return nil, fmt.Errorf("LATENCY_ASYNC_HANDOFF (%v) must be shorter than the %s budget (%v)", handoff, StartRoute, startBudget)
+	}
+
+	if size := viper.GetInt("KAFKA_BATCH_SIZE"); size <= 0 {
+		return nil, fmt.Errorf("KAFKA_BATCH_SIZE must be positive, got %d", size)
+	}
+	if wait := viper.GetDuration("KAFKA_BATCH_WAIT"); wait <= 0 {
+		return nil, fmt.Errorf("KAFKA_BATCH_WAIT must be positive, got %v", wait)
+	}
+
+	if viper.GetString("SFTP_HOST") != "" {
+		if viper.GetString("SFTP_KNOWN_HOSTS_FILE") == "" {
+			return nil, fmt.Errorf("SFTP_KNOWN_HOSTS_FILE is required with SFTP_HOST")
+		}
+		if viper.GetString("SFTP_PASSWORD") == "" && viper.GetString("SFTP_PRIVATE_KEY_FILE") == "" {
+			return nil, fmt.Errorf("SFTP_PASSWORD or SFTP_PRIVATE_KEY_FILE is required with SFTP_HOST")
+		}
+		if interval := viper.GetDuration("SFTP_POLL_INTERVAL"); interval <= 0 {
+			return nil, fmt.Errorf("SFTP_POLL_INTERVAL must be positive, got %v", interval)
+		}
+	}
+
+	if viper.GetString("S3_ENDPOINT") != "" {
+		if viper.GetString("S3_ACCESS_KEY") == "" || viper.GetString("S3_SECRET_KEY") == "" {
+			return nil, fmt.Errorf("S3_ACCESS_KEY and S3_SECRET_KEY are required with S3_ENDPOINT")
+		}
+		if interval := viper.GetDuration("S3_POLL_INTERVAL"); interval <= 0 {
+			return nil, fmt.Errorf("S3_POLL_INTERVAL must be positive, got %v", interval)
+		}
+	}
+
+	mailboxes, err := parseMailboxes(viper.GetString("EMAIL_INGEST_MAILBOXES"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid EMAIL_INGEST_MAILBOXES: %w", err)
+	}
+	if len(mailboxes) > 0 && viper.GetString("EMAIL_INGEST_SIGNING_KEY") == "" {
+		return nil, fmt.Errorf("EMAIL_INGEST_SIGNING_KEY is required with EMAIL_INGEST_MAILBOXES")
+	}
+
+	tenants := parseList(viper.GetString("TENANTS"))
+	seenTenants := make(map[string]bool, len(tenants))
+	for _, tenant := range tenants {
+		if len(tenant) > 64 {
+			return nil, fmt.Errorf("TENANTS entry %q is longer than 64 characters", tenant)
+		}
+		if seenTenants[tenant] {
+			return nil, fmt.Errorf("TENANTS lists %q twice", tenant)
+		}
+		seenTenants[tenant] = true
+	}
+
+	if viper.GetString("SANDBOX_API_KEYS") != "" {
+		sandboxTenant := viper.GetString("SANDBOX_TENANT")
+		if sandboxTenant == "" || len(sandboxTenant) > 64 {
+			return nil, fmt.Errorf("SANDBOX_TENANT must be 1 to 64 characters, got %q", sandboxTenant)
+		}
+		if seenTenants[sandboxTenant] || sandboxTenant == DefaultTenant {
+			return nil, fmt.Errorf("SANDBOX_TENANT %q holds real data, name another tenant", sandboxTenant)
+		}
+		if hour := viper.GetInt("SANDBOX_RESET_HOUR"); hour < 0 || hour > 23 {
+			return nil, fmt.Errorf("SANDBOX_RESET_HOUR must be between 0 and 23, got %d", hour)
+		}
+		if count := viper.GetInt("SANDBOX_TRANSACTIONS"); count <= 0 || count > 10000 {
+			return nil, fmt.Errorf("SANDBOX_TRANSACTIONS must be between 1 and 10000, got %d", count)
+		}
+	}
+
+	if limit := viper.GetInt("QUEUE_TENANT_MAX_CONCURRENT_JOBS"); limit < 0 {
+		return nil, fmt.Errorf("QUEUE_TENANT_MAX_CONCURRENT_JOBS must not be negative, got %d", limit)
+	}
+	tenantWeights, err := parseTenantWeights(viper.GetString("QUEUE_TENANT_WEIGHTS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid QUEUE_TENANT_WEIGHTS: %w", err)
+	}
+	for tenant := range tenantWeights {
+		if !seenTenants[tenant] && tenant != viper.GetString("SANDBOX_TENANT") && tenant != DefaultTenant {
+			return nil, fmt.Errorf("QUEUE_TENANT_WEIGHTS names %q, which is not a configured tenant", tenant)
+		}
+	}
+
+	if format := viper.GetString("BATCH_ID_FORMAT"); format != BatchIDFormatTimestamp && format != BatchIDFormatUUID {
+		return nil, fmt.Errorf("BATCH_ID_FORMAT must be %s or %s, got %q", BatchIDFormatTimestamp, BatchIDFormatUUID, format)
+	}
+
+	heartbeatInterval := viper.GetDuration("HEARTBEAT_INTERVAL")
+	if heartbeatInterval <= 0 {
+		return nil, fmt.Errorf("HEARTBEAT_INTERVAL must be positive, got %v", heartbeatInterval)
+	}
+	// A single late beat must not make a job look stuck
+	if threshold := viper.GetDuration("STUCK_JOB_THRESHOLD"); threshold < 2*heartbeatInterval {
+		return nil, fmt.Errorf("STUCK_JOB_THRESHOLD must be at least twice HEARTBEAT_INTERVAL, got %v", threshold)
+	}
+
+	for _, key := range []string{"INGEST_REALTIME_MAX_RECORDS", "INGEST_REALTIME_CONNECTIONS", "INGEST_BULK_CONNECTIONS", "INGEST_BULK_CHUNK_SIZE"} {
+		if value := viper.GetInt(key); value < 1 {
+			return nil, fmt.Errorf("%s must be at least 1, got %d", key, value)
+		}
+	}
+	for _, key := range []string{"INGEST_MAX_JSON_BYTES", "INGEST_MAX_STATEMENT_BYTES"} {
+		if value := viper.GetInt64(key); value < 1 {
+			return nil, fmt.Errorf("%s must be at least 1, got %d", key, value)
+		}
+	}
+
+	if interval := viper.GetDuration("DB_FAILOVER_CHECK_INTERVAL"); interval <= 0 {
+		return nil, fmt.Errorf("DB_FAILOVER_CHECK_INTERVAL must be positive, got %v", interval)
+	}
+	if threshold := viper.GetInt("DB_FAILOVER_THRESHOLD"); threshold < 1 {
+		return nil, fmt.Errorf("DB_FAILOVER_THRESHOLD must be at least 1, got %d", threshold)
+	}
+	if size := viper.GetInt("DB_FAILOVER_OUTBOX_SIZE"); size < 0 {
+		return nil, fmt.Errorf("DB_FAILOVER_OUTBOX_SIZE must not be negative, got %d", size)
+	}
+
+	if threshold := viper.GetFloat64("INGEST_QUALITY_THRESHOLD"); threshold < 0 || threshold > 1 {
+		return nil, fmt.Errorf("INGEST_QUALITY_THRESHOLD must be between 0 and 1, got %v", threshold)
+	}
+	if hour := viper.GetInt("INGEST_FEED_CUTOFF_HOUR"); hour < 0 || hour > 23 {
+		return nil, fmt.Errorf("INGEST_FEED_CUTOFF_HOUR must be between 0 and 23, got %d", hour)
+	}
+	if interval := viper.GetDuration("INGEST_FEED_CHECK_INTERVAL"); interval <= 0 {
+		return nil, fmt.Errorf("INGEST_FEED_CHECK_INTERVAL must be positive, got %v", interval)
+	}
+	for _, key := range []string{"WEBHOOK_POLL_INTERVAL", "WEBHOOK_TIMEOUT", "WEBHOOK_RETRY_BACKOFF"} {
+		if value := viper.GetDuration(key); value <= 0 {
+			return nil, fmt.Errorf("%s must be positive, got %v", key, value)
+		}
+	}
+	if attempts := viper.GetInt("WEBHOOK_MAX_ATTEMPTS"); attempts < 1 {
+		return nil, fmt.Errorf("WEBHOOK_MAX_ATTEMPTS must be at least 1, got %d", attempts)
+	}
+
+	if hour := viper.GetInt("DIGEST_HOUR"); hour < 0 || hour > 23 {
+		return nil, fmt.Errorf("DIGEST_HOUR must be between 0 and 23, got %d", hour)
+	}
+	if interval := viper.GetDuration("DIGEST_CHECK_INTERVAL"); interval <= 0 {
+		return nil, fmt.Errorf("DIGEST_CHECK_INTERVAL must be positive, got %v", interval)
+	}
+	agingThresholds, err := parseDays("DIGEST_AGING_THRESHOLDS", viper.GetString("DIGEST_AGING_THRESHOLDS"))
+	if err != nil {
+		return nil, err
+	}
+
+	if grace := viper.GetDuration("API_KEY_ROTATION_GRACE"); grace < 0 {
+		return nil, fmt.Errorf("API_KEY_ROTATION_GRACE must not be negative, got %v", grace)
+	}
+
+	reviewConfidence := viper.GetFloat64("MATCH_REVIEW_CONFIDENCE")
+	if reviewConfidence < 0 || reviewConfidence > 1 {
+		return nil, fmt.Errorf("MATCH_REVIEW_CONFIDENCE must be between 0 and 1, got %v", reviewConfidence)
+	}
+
+	if window := viper.GetInt("MATCH_REVERSAL_WINDOW_DAYS"); window < 0 {
+		return nil, fmt.Errorf("MATCH_REVERSAL_WINDOW_DAYS must not be negative, got %d", window)
+	}
+
+	var logLevel slog.Level
+	if err := logLevel.UnmarshalText([]byte(viper.GetString("LOG_LEVEL"))); err != nil {
+		return nil, fmt.Errorf("invalid LOG_LEVEL: %w", err)
+	}
+
 	config := &Config{
 		ServerAddress: viper.GetString("SERVER_ADDRESS"),
 		Environment:   viper.GetString("ENVIRONMENT"),
 		Database: DatabaseConfig{
+			Driver:   driver,
 			Host:     viper.GetString("DB_HOST"),
 			Port:     viper.GetInt("DB_PORT"),
 			User:     viper.GetString("DB_USER"),
 			Password: viper.GetString("DB_PASSWORD"),
 			Name:     viper.GetString("DB_NAME"),
 			Params:   viper.GetString("DB_PARAMS"),
+
+			ReplicaHost: viper.GetString("DB_REPLICA_HOST"),
+			ReplicaPort: viper.GetInt("DB_REPLICA_PORT"),
 		},
 		Migration: MigrationConfig{
 			Dir: viper.GetString("MIGRATION_DIR"),
 		},
+		Matching: MatchingConfig{
+			CreditorReferenceMatching: viper.GetBool("MATCH_CREDITOR_REFERENCE"),
+			Calendar:                  viper.GetString("MATCH_CALENDAR"),
+			BaseCurrency:              strings.ToUpper(viper.GetString("BASE_CURRENCY")),
+			FXToleranceBasisPoints:    viper.GetInt64("MATCH_FX_TOLERANCE_BASIS_POINTS"),
+			Strategies:                parseList(viper.GetString("MATCH_STRATEGIES")),
+			NettingEntryTypes:         nettingEntryTypes(viper.GetString("MATCH_NETTING_ENTRY_TYPES")),
+			RulesFile:                 viper.GetString("MATCH_RULES_FILE"),
+			ReviewConfidence:          reviewConfidence,
+			ReversalWindowDays:        viper.GetInt("MATCH_REVERSAL_WINDOW_DAYS"),
+		},
+		Shutdown: ShutdownConfig{
+			DrainTimeout: viper.GetDuration("SHUTDOWN_DRAIN_TIMEOUT"),
+		},
+		Partition: PartitionConfig{
+			WorkerEnabled: viper.GetBool("PARTITION_WORKER_ENABLED"),
+			PollInterval:  viper.GetDuration("PARTITION_POLL_INTERVAL"),
+		},
+		Queue: QueueConfig{
+			WorkerEnabled:           viper.GetBool("QUEUE_WORKER_ENABLED"),
+			PollInterval:            viper.GetDuration("QUEUE_POLL_INTERVAL"),
+			MaxConcurrentJobs:       viper.GetInt("QUEUE_MAX_CONCURRENT_JOBS"),
+			TenantMaxConcurrentJobs: viper.GetInt("QUEUE_TENANT_MAX_CONCURRENT_JOBS"),
+			TenantWeights:           tenantWeights,
+		},
+		Scheduler: SchedulerConfig{
+			Enabled:      viper.GetBool("SCHEDULER_ENABLED"),
+			PollInterval: viper.GetDuration("SCHEDULER_POLL_INTERVAL"),
+		},
+		I18n: I18nConfig{
+			DefaultLocale: viper.GetString("I18N_DEFAULT_LOCALE"),
+			TenantLocales: viper.GetString("I18N_TENANT_LOCALES"),
+		},
+		Export: ExportConfig{
+			Currency:          viper.GetString("EXPORT_CURRENCY"),
+			AsyncRowThreshold: viper.GetInt("EXPORT_ASYNC_ROW_THRESHOLD"),
+			StorageDir:        viper.GetString("EXPORT_STORAGE_DIR"),
+			SigningKey:        viper.GetString("EXPORT_SIGNING_KEY"),
+			LinkTTL:           viper.GetDuration("EXPORT_LINK_TTL"),
+			PublicURL:         viper.GetString("EXPORT_PUBLIC_URL"),
+			WorkerEnabled:     viper.GetBool("EXPORT_WORKER_ENABLED"),
+			PollInterval:      viper.GetDuration("EXPORT_POLL_INTERVAL"),
+		},
+		Artifacts: ArtifactsConfig{
+			SigningKey: viper.GetString("ARTIFACT_SIGNING_KEY"),
+		},
+		Results: ResultsConfig{
+			InlineLimit: viper.GetInt("RESULTS_INLINE_LIMIT"),
+		},
+		Auth: AuthConfig{
+			JWTSecret:   viper.GetString("JWT_SECRET"),
+			JWTIssuer:   viper.GetString("JWT_ISSUER"),
+			JWTAudience: viper.GetString("JWT_AUDIENCE"),
+			ClockSkew:   viper.GetDuration("JWT_CLOCK_SKEW"),
+		},
+		Access: AccessConfig{
+			BootstrapAdmins: strings.Split(viper.GetString("RBAC_BOOTSTRAP_ADMINS"), ","),
+		},
+		Latency: LatencyConfig{
+			DefaultBudget: viper.GetDuration("LATENCY_DEFAULT_BUDGET"),
+			RouteBudgets:  routeBudgets,
+			AsyncHandoff:  viper.GetDuration("LATENCY_ASYNC_HANDOFF"),
+		},
+		RequestAudit: RequestAuditConfig{
+			Retention:  viper.GetDuration("REQUEST_AUDIT_RETENTION"),
+			MaxPayload: viper.GetInt("REQUEST_AUDIT_MAX_PAYLOAD"),
+		},
+		Retention: RetentionConfig{
+			PurgerEnabled: viper.GetBool("RETENTION_PURGER_ENABLED"),
+			PurgeInterval: viper.GetDuration("RETENTION_PURGE_INTERVAL"),
+			DryRun:        viper.GetBool("RETENTION_DRY_RUN"),
+		},
+		Expectations: ExpectationsConfig{
+			WatcherEnabled: viper.GetBool("EXPECTATIONS_WATCHER_ENABLED"),
+			CheckInterval:  viper.GetDuration("EXPECTATIONS_CHECK_INTERVAL"),
+			GraceDays:      viper.GetInt("EXPECTATIONS_GRACE_DAYS"),
+		},
+		Returns: ReturnsConfig{
+			Action: viper.GetString("RETURNS_ACTION"),
+		},
+		Exceptions: ExceptionsConfig{
+			SweeperEnabled: viper.GetBool("EXCEPTIONS_SWEEPER_ENABLED"),
+			SweepInterval:  viper.GetDuration("EXCEPTIONS_SWEEP_INTERVAL"),
+			AgeDays:        viper.GetInt("EXCEPTIONS_AGE_DAYS"),
+		},
+		Integrity: IntegrityConfig{
+			CheckerEnabled: viper.GetBool("INTEGRITY_CHECKER_ENABLED"),
+			CheckInterval:  viper.GetDuration("INTEGRITY_CHECK_INTERVAL"),
+		},
+		Fixtures: FixturesConfig{
+			ImportEnabled: viper.GetBool("FIXTURE_IMPORT_ENABLED"),
+		},
+		Notification: NotificationConfig{
+			DedupWindow: viper.GetDuration("NOTIFICATION_DEDUP_WINDOW"),
+		},
+		OpenAPI: OpenAPIConfig{
+			SwaggerUI: viper.GetBool("OPENAPI_SWAGGER_UI"),
+		},
+		KPI: KPIConfig{
+			File: viper.GetString("KPI_FILE"),
+		},
+		Log: LogConfig{
+			Level: logLevel,
+		},
+		Metrics: MetricsConfig{
+			Token: viper.GetString("METRICS_TOKEN"),
+		},
+		Idempotency: IdempotencyConfig{
+			KeyTTL: viper.GetDuration("IDEMPOTENCY_KEY_TTL"),
+		},
+		Kafka: KafkaConfig{
+			Brokers:         parseList(viper.GetString("KAFKA_BROKERS")),
+			GroupID:         viper.GetString("KAFKA_GROUP_ID"),
+			BankTopic:       viper.GetString("KAFKA_BANK_TOPIC"),
+			AccountingTopic: viper.GetString("KAFKA_ACCOUNTING_TOPIC"),
+			BatchSize:       viper.GetInt("KAFKA_BATCH_SIZE"),
+			BatchWait:       viper.GetDuration("KAFKA_BATCH_WAIT"),
+		},
+		SFTP: SFTPConfig{
+			Host:           viper.GetString("SFTP_HOST"),
+			User:           viper.GetString("SFTP_USER"),
+			Password:       viper.GetString("SFTP_PASSWORD"),
+			PrivateKeyFile: viper.GetString("SFTP_PRIVATE_KEY_FILE"),
+			KnownHostsFile: viper.GetString("SFTP_KNOWN_HOSTS_FILE"),
+			Directories:    parseList(viper.GetString("SFTP_DIRECTORIES")),
+			ArchiveDir:     viper.GetString("SFTP_ARCHIVE_DIR"),
+			RejectedDir:    viper.GetString("SFTP_REJECTED_DIR"),
+			PollInterval:   viper.GetDuration("SFTP_POLL_INTERVAL"),
+			SettleTime:     viper.GetDuration("SFTP_SETTLE_TIME"),
+		},
+		S3: S3Config{
+			Endpoint:     viper.GetString("S3_ENDPOINT"),
+			AccessKey:    viper.GetString("S3_ACCESS_KEY"),
+			SecretKey:    viper.GetString("S3_SECRET_KEY"),
+			Region:       viper.GetString("S3_REGION"),
+			UseSSL:       viper.GetBool("S3_USE_SSL"),
+			Sources:      parseList(viper.GetString("S3_SOURCES")),
+			PollInterval: viper.GetDuration("S3_POLL_INTERVAL"),
+		},
+		Email: EmailConfig{
+			SigningKey: viper.GetString("EMAIL_INGEST_SIGNING_KEY"),
+			Mailboxes:  mailboxes,
+		},
+		Tenants: TenantsConfig{
+			IDs: tenants,
+		},
+		Sandbox: SandboxConfig{
+			Tenant:       viper.GetString("SANDBOX_TENANT"),
+			APIKeys:      parseList(viper.GetString("SANDBOX_API_KEYS")),
+			ResetHour:    viper.GetInt("SANDBOX_RESET_HOUR"),
+			Transactions: viper.GetInt("SANDBOX_TRANSACTIONS"),
+		},
+		BatchIDs: BatchIDConfig{
+			Format: viper.GetString("BATCH_ID_FORMAT"),
+		},
+		Heartbeat: HeartbeatConfig{
+			Interval:       heartbeatInterval,
+			StuckThreshold: viper.GetDuration("STUCK_JOB_THRESHOLD"),
+			MonitorEnabled: viper.GetBool("STUCK_JOB_MONITOR_ENABLED"),
+			Requeue:        viper.GetBool("STUCK_JOB_REQUEUE"),
+		},
+		Ingestion: IngestionConfig{
+			RealtimeMaxRecords:  viper.GetInt("INGEST_REALTIME_MAX_RECORDS"),
+			RealtimeConnections: viper.GetInt("INGEST_REALTIME_CONNECTIONS"),
+			BulkConnections:     viper.GetInt("INGEST_BULK_CONNECTIONS"),
+			BulkChunkSize:       viper.GetInt("INGEST_BULK_CHUNK_SIZE"),
+			MaxJSONBytes:        viper.GetInt64("INGEST_MAX_JSON_BYTES"),
+			MaxStatementBytes:   viper.GetInt64("INGEST_MAX_STATEMENT_BYTES"),
+		},
+		Failover: FailoverConfig{
+			CheckInterval:    viper.GetDuration("DB_FAILOVER_CHECK_INTERVAL"),
+			FailureThreshold: viper.GetInt("DB_FAILOVER_THRESHOLD"),
+			OutboxSize:       viper.GetInt("DB_FAILOVER_OUTBOX_SIZE"),
+		},
+		Anomalies: AnomalyConfig{
+			QualityThreshold:  viper.GetFloat64("INGEST_QUALITY_THRESHOLD"),
+			ExpectedFeeds:     parseList(viper.GetString("INGEST_EXPECTED_FEEDS")),
+			FeedCutoffHour:    viper.GetInt("INGEST_FEED_CUTOFF_HOUR"),
+			FeedCheckInterval: viper.GetDuration("INGEST_FEED_CHECK_INTERVAL"),
+		},
+		Webhooks: WebhookConfig{
+			SenderEnabled: viper.GetBool("WEBHOOK_SENDER_ENABLED"),
+			PollInterval:  viper.GetDuration("WEBHOOK_POLL_INTERVAL"),
+			Timeout:       viper.GetDuration("WEBHOOK_TIMEOUT"),
+			MaxAttempts:   viper.GetInt("WEBHOOK_MAX_ATTEMPTS"),
+			RetryBackoff:  viper.GetDuration("WEBHOOK_RETRY_BACKOFF"),
+		},
+		Digest: DigestConfig{
+			SenderEnabled:   viper.GetBool("DIGEST_SENDER_ENABLED"),
+			Hour:            viper.GetInt("DIGEST_HOUR"),
+			CheckInterval:   viper.GetDuration("DIGEST_CHECK_INTERVAL"),
+			AgingThresholds: agingThresholds,
+		},
+		APIKeys: APIKeyConfig{
+			RotationGrace: viper.GetDuration("API_KEY_ROTATION_GRACE"),
+		},
+		Safety: SafetyConfig{
+			ConfirmToken: viper.GetString("SAFETY_CONFIRM_TOKEN"),
+		},
+		Quota: QuotaConfig{
+			MonthlyRequests:     viper.GetInt64("QUOTA_MONTHLY_REQUESTS"),
+			MonthlyRowsIngested: viper.GetInt64("QUOTA_MONTHLY_ROWS_INGESTED"),
+			MonthlyBatches:      viper.GetInt64("QUOTA_MONTHLY_BATCHES"),
+		},
 	}
 
 	return config, nil
@@ -60,8 +1161,11 @@ func LoadConfig() (*Config, error) {
 	// return &cfg, nil
 }
 
-// GetDSN returns the MySQL DSN string
+// GetDSN returns the MySQL DSN string, or the SQLite one with DB_DRIVER=sqlite
 func (c *Config) GetDSN() string {
+	if c.Database.SQLite() {
+		return c.sqliteDSN()
+	}
 	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?%s",
 		c.Database.User,
 		c.Database.Password,
@@ -72,7 +1176,42 @@ func (c *Config) GetDSN() string {
 	)
 }
 
-// GetMigrationDBURL returns the database URL for migrations
+// GetReplicaDSN returns the DSN of the read replica, or "" when none is
+// configured
+func (c *Config) GetReplicaDSN() string {
+	if c.Database.ReplicaHost == "" {
+		return ""
+	}
+	port := c.Database.ReplicaPort
+	if port == 0 {
+		port = c.Database.Port
+	}
+	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?%s",
+		c.Database.User,
+		c.Database.Password,
+		c.Database.ReplicaHost,
+		port,
+		c.Database.Name,
+		c.Database.Params,
+	)
+}
+
+// sqliteDSN opens DB_NAME with foreign keys enforced. A file is opened in WAL
+// mode, where reads do not wait for writes, and its transactions take the
+// write lock when they begin, so two of them wait for each other instead of
+// failing when one would upgrade its lock. An in-memory database is shared by
+// every connection of the process; a write there locks out reads, so its
+// transactions lock only as they read and write, and one that only reads
+// does not hold off the others.
+func (c *Config) sqliteDSN() string {
+	params := "_foreign_keys=on&_busy_timeout=5000"
+	if c.Database.InMemory() {
+		return "file:/reconciliation?vfs=memdb&" + params
+	}
+	return "file:" + c.Database.Name + "?_journal_mode=WAL&_txlock=immediate&" + params
+}
+
+// GetMigrationDBURL returns the MySQL database URL for migrations
 func (c *Config) GetMigrationDBURL() string {
 	return fmt.Sprintf("mysql://%s:%s@tcp(%s:%d)/%s?%s",
 		c.Database.User,
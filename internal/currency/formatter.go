@@ -0,0 +1,181 @@
+package currency
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"reconciliation-service/internal/i18n"
+	"reconciliation-service/internal/money"
+)
+
+type currencyInfo struct {
+	symbol     string
+	minorUnits int
+}
+
+// ISO 4217 currencies the exports know how to print
+var currencies = map[string]currencyInfo{
+	"IDR": {"Rp", 2},
+	"USD": {"$", 2},
+	"EUR": {"€", 2},
+	"GBP": {"£", 2},
+	"SGD": {"S$", 2},
+	"MYR": {"RM", 2},
+	"AUD": {"A$", 2},
+	"JPY": {"¥", 0},
+}
+
+type separators struct {
+	thousands string
+	decimal   string
+}
+
+var localeSeparators = map[string]separators{
+	i18n.English:    {",", "."},
+	i18n.Indonesian: {".", ","},
+}
+
+// Supported reports whether the currency code is known
+func Supported(code string) bool {
+	_, ok := currencies[strings.ToUpper(code)]
+	return ok
+}
+
+// Codes lists the supported currency codes
+func Codes() []string {
+	var codes []string
+	for code := range currencies {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// Formatter renders amounts of one currency for one locale. It is the single
+// place exports turn money into text, so every generator prints amounts the
+// same way.
+type Formatter struct {
+	code      string
+	currency  currencyInfo
+	separator separators
+}
+
+func NewFormatter(locale, code string) (*Formatter, error) {
+	code = strings.ToUpper(code)
+	info, ok := currencies[code]
+	if !ok {
+		return nil, fmt.Errorf("unsupported currency %q", code)
+	}
+	sep, ok := localeSeparators[locale]
+	if !ok {
+		sep = localeSeparators[i18n.DefaultLocale]
+	}
+	return &Formatter{
+		code:      code,
+		currency:  info,
+		separator: sep,
+	}, nil
+}
+
+// Code returns the ISO 4217 code of the formatter's currency
+func (f *Formatter) Code() string {
+	return f.code
+}
+
+// Format renders the amount with the currency symbol, locale separators and
+// exactly the currency's minor units, e.g. $1,234.50 or Rp1.234,50
+func (f *Formatter) Format(amount float64) string {
+	number := f.FormatNumber(amount)
+	if strings.HasPrefix(number, "-") {
+		return "-" + f.currency.symbol + number[1:]
+	}
+	return f.currency.symbol + number
+}
+
+// FormatAmount renders an exact amount like Format
+func (f *Formatter) FormatAmount(amount money.Amount) string {
+	number := f.formatUnits(f.minorUnits(amount))
+	if strings.HasPrefix(number, "-") {
+		return "-" + f.currency.symbol + number[1:]
+	}
+	return f.currency.symbol + number
+}
+
+// minorUnits converts hundredths to the currency's minor units, rounding
+// half away from zero for currencies with fewer than two
+func (f *Formatter) minorUnits(amount money.Amount) int64 {
+	units := int64(amount)
+	for i := f.currency.minorUnits; i < 2; i++ {
+		if units < 0 {
+			units = (units - 5) / 10
+		} else {
+			units = (units + 5) / 10
+		}
+	}
+	for i := 2; i < f.currency.minorUnits; i++ {
+		units *= 10
+	}
+	return units
+}
+
+// FormatNumber renders the amount like Format but without the symbol
+func (f *Formatter) FormatNumber(amount float64) string {
+	// Round on the integer count of minor units so binary float noise never
+	// reaches the output
+	scale := math.Pow10(f.currency.minorUnits)
+	return f.formatUnits(int64(math.Round(amount * scale)))
+}
+
+func (f *Formatter) formatUnits(units int64) string {
+	scale := int64(math.Pow10(f.currency.minorUnits))
+
+	negative := units < 0
+	if negative {
+		units = -units
+	}
+	whole := strconv.FormatInt(units/scale, 10)
+
+	var b strings.Builder
+	if negative {
+		b.WriteByte('-')
+	}
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(f.separator.thousands)
+		}
+		b.WriteRune(digit)
+	}
+	if f.currency.minorUnits > 0 {
+		b.WriteString(f.separator.decimal)
+		b.WriteString(fmt.Sprintf("%0*d", f.currency.minorUnits, units%scale))
+	}
+	return b.String()
+}
+
+// FormatValue formats a database value holding an amount. Values that are
+// not numeric are returned as printed.
+func (f *Formatter) FormatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case money.Amount:
+		return f.FormatAmount(v)
+	case float64:
+		return f.Format(v)
+	case float32:
+		return f.Format(float64(v))
+	case int64:
+		return f.Format(float64(v))
+	case string:
+		// DECIMAL columns arrive as text
+		if parsed, err := money.Parse(v); err == nil {
+			return f.FormatAmount(parsed)
+		}
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,119 @@
+package currency
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"reconciliation-service/internal/money"
+)
+
+type currencyPair struct {
+	from string
+	to   string
+}
+
+type datedRate struct {
+	date string // YYYY-MM-DD
+	rate *big.Rat
+}
+
+// RateTable holds exchange rates by currency pair and day. Rates are exact
+// decimals, so a conversion rounds only once, to the hundredth.
+type RateTable struct {
+	rates map[currencyPair][]datedRate
+}
+
+func NewRateTable() *RateTable {
+	return &RateTable{rates: make(map[currencyPair][]datedRate)}
+}
+
+// Add records that on date one unit of from is worth rate units of to. A
+// second rate for the same pair and day replaces the first.
+func (t *RateTable) Add(from, to, date, rate string) error {
+	value, ok := new(big.Rat).SetString(rate)
+	if !ok || value.Sign() <= 0 {
+		return fmt.Errorf("invalid rate %q", rate)
+	}
+	key := currencyPair{strings.ToUpper(from), strings.ToUpper(to)}
+	date = dayOf(date)
+
+	rates := t.rates[key]
+	i := sort.Search(len(rates), func(i int) bool { return rates[i].date >= date })
+	if i < len(rates) && rates[i].date == date {
+		rates[i].rate = value
+		return nil
+	}
+	rates = append(rates, datedRate{})
+	copy(rates[i+1:], rates[i:])
+	rates[i] = datedRate{date: date, rate: value}
+	t.rates[key] = rates
+	return nil
+}
+
+// Rate is the value of one unit of from in to on date: the latest rate on or
+// before that day, taken from the pair itself or inverted from the opposite
+// pair, whichever is more recent. Equal currencies convert at 1.
+func (t *RateTable) Rate(from, to, date string) (*big.Rat, bool) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	if from == to {
+		return big.NewRat(1, 1), true
+	}
+	if t == nil {
+		return nil, false
+	}
+	date = dayOf(date)
+
+	direct, hasDirect := latestRate(t.rates[currencyPair{from, to}], date)
+	inverse, hasInverse := latestRate(t.rates[currencyPair{to, from}], date)
+	switch {
+	case hasDirect && (!hasInverse || direct.date >= inverse.date):
+		return direct.rate, true
+	case hasInverse:
+		return new(big.Rat).Inv(inverse.rate), true
+	default:
+		return nil, false
+	}
+}
+
+// Convert expresses an amount of from in to at the rate of date, rounding
+// half away from zero to the hundredth
+func (t *RateTable) Convert(amount money.Amount, from, to, date string) (money.Amount, bool) {
+	rate, ok := t.Rate(from, to, date)
+	if !ok {
+		return 0, false
+	}
+	converted := new(big.Rat).Mul(new(big.Rat).SetInt64(int64(amount)), rate)
+
+	quotient, remainder := new(big.Int).QuoRem(converted.Num(), converted.Denom(), new(big.Int))
+	remainder.Abs(remainder).Lsh(remainder, 1)
+	if remainder.Cmp(converted.Denom()) >= 0 {
+		if converted.Sign() < 0 {
+			quotient.Sub(quotient, big.NewInt(1))
+		} else {
+			quotient.Add(quotient, big.NewInt(1))
+		}
+	}
+	if !quotient.IsInt64() {
+		return 0, false
+	}
+	return money.Amount(quotient.Int64()), true
+}
+
+// latestRate finds the last of the date-ordered rates on or before date
+func latestRate(rates []datedRate, date string) (datedRate, bool) {
+	i := sort.Search(len(rates), func(i int) bool { return rates[i].date > date })
+	if i == 0 {
+		return datedRate{}, false
+	}
+	return rates[i-1], true
+}
+
+// dayOf drops the time the driver appends to DATE columns
+func dayOf(date string) string {
+	if len(date) > 10 {
+		return date[:10]
+	}
+	return date
+}
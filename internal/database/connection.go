@@ -13,6 +13,10 @@ import (
 )
 
 func NewConnection(cfg *config.Config) (*sql.DB, error) {
+	if cfg.Database.SQLite() {
+		return openSQLite(cfg, 25)
+	}
+
 	db, err := sql.Open("mysql", cfg.GetDSN())
 	if err != nil {
 		return nil, fmt.Errorf("error opening database: %v", err)
@@ -59,6 +63,73 @@ func NewConnection(cfg *config.Config) (*sql.DB, error) {
 	return db, nil
 }
 
+// NewPool opens a further pool on the database NewConnection connected to,
+// holding at most size connections, for work that must not compete with the
+// rest of the service for its connections
+func NewPool(cfg *config.Config, size int) (*sql.DB, error) {
+	if cfg.Database.SQLite() {
+		return openSQLite(cfg, size)
+	}
+
+	db, err := sql.Open("mysql", cfg.GetDSN())
+	if err != nil {
+		return nil, fmt.Errorf("error opening database: %v", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error pinging database: %v", err)
+	}
+
+	db.SetMaxOpenConns(size)
+	db.SetMaxIdleConns(size)
+	db.SetConnMaxLifetime(5 * time.Minute)
+	return db, nil
+}
+
+// NewReplica opens the read replica, or returns nil when none is configured.
+// An unreachable replica is not fatal: the pool connects once it is up.
+func NewReplica(cfg *config.Config) (*sql.DB, error) {
+	dsn := cfg.GetReplicaDSN()
+	if dsn == "" {
+		return nil, nil
+	}
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error opening replica: %v", err)
+	}
+	if err := db.Ping(); err != nil {
+		log.Printf("Read replica %s is not reachable yet: %v", cfg.Database.ReplicaHost, err)
+	}
+
+	db.SetMaxOpenConns(25)
+	db.SetMaxIdleConns(25)
+	db.SetConnMaxLifetime(5 * time.Minute)
+	return db, nil
+}
+
+// openSQLite opens the SQLite database DB_NAME names, holding at most size
+// connections. An in-memory database lasts as long as a connection to it is
+// open, so its connections are not closed for age.
+func openSQLite(cfg *config.Config, size int) (*sql.DB, error) {
+	db, err := sql.Open(sqliteDriverName, cfg.GetDSN())
+	if err != nil {
+		return nil, fmt.Errorf("error opening database: %v", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error pinging database: %v", err)
+	}
+
+	db.SetMaxOpenConns(size)
+	db.SetMaxIdleConns(size)
+	if !cfg.Database.InMemory() {
+		db.SetConnMaxLifetime(5 * time.Minute)
+	}
+
+	log.Printf("Successfully connected to SQLite database %s", cfg.Database.Name)
+	return db, nil
+}
+
 func getRootDSN(cfg *config.Config) string {
 	return fmt.Sprintf("%s:%s@tcp(%s:%d)/?parseTime=true",
 		cfg.Database.User,
@@ -0,0 +1,348 @@
+package database
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// sqliteQuery is a query of the repositories rewritten for SQLite. returnsID
+// marks a write that read back the id of its row through LAST_INSERT_ID,
+// which now returns it from a RETURNING clause instead.
+type sqliteQuery struct {
+	text      string
+	returnsID bool
+}
+
+// sqliteQueries caches the rewritten queries, which are a fixed set
+var sqliteQueries sync.Map
+
+var (
+	lockingRead   = regexp.MustCompile(`(?i)\s+(FOR\s+UPDATE(\s+(SKIP\s+LOCKED|NOWAIT))?|LOCK\s+IN\s+SHARE\s+MODE)\b`)
+	insertIgnore  = regexp.MustCompile(`(?i)\bINSERT\s+IGNORE\b`)
+	nowCall       = regexp.MustCompile(`(?i)\bNOW\(\)`)
+	ifCall        = regexp.MustCompile(`(?i)\bIF\(`)
+	greatestCall  = regexp.MustCompile(`(?i)\bGREATEST\(`)
+	leastCall     = regexp.MustCompile(`(?i)\bLEAST\(`)
+	nullSafeEqual = regexp.MustCompile(`\s*<=>\s*`)
+	castInteger   = regexp.MustCompile(`(?i)\bAS\s+(UNSIGNED|SIGNED)(\s+INTEGER)?\s*\)`)
+	diffUnit      = regexp.MustCompile(`(?i)\bTIMESTAMPDIFF\(\s*(\w+)\s*,`)
+
+	leftCall        = regexp.MustCompile(`(?i)\bLEFT\(`)
+	dateShiftCall   = regexp.MustCompile(`(?i)\bDATE_(ADD|SUB)\(`)
+	groupConcatCall = regexp.MustCompile(`(?i)\bGROUP_CONCAT\(`)
+	interval        = regexp.MustCompile(`(?is)^INTERVAL\s+(.+)\s+(MICROSECOND|SECOND|MINUTE|HOUR|DAY|MONTH|YEAR)$`)
+	concatClauses   = regexp.MustCompile(`(?is)^DISTINCT\s+(.+?)(?:\s+ORDER\s+BY\s+(.+?))?(?:\s+SEPARATOR\s+('(?:[^'\\]|\\.)*'))?$`)
+
+	onDuplicateKey = regexp.MustCompile(`(?i)\s+ON\s+DUPLICATE\s+KEY\s+UPDATE\s+`)
+	valuesRef      = regexp.MustCompile(`(?i)\bVALUES\(\s*(\w+)\s*\)`)
+	lastInsertID   = regexp.MustCompile(`(?i)^LAST_INSERT_ID\(\s*(\w+)\s*\)$`)
+	claimedID      = regexp.MustCompile(`(?i)\bid\s*=\s*LAST_INSERT_ID\(\s*id\s*\)\s*,\s*`)
+
+	writeTable = regexp.MustCompile(`(?is)^\s*(UPDATE|DELETE\s+FROM)\s+(\w+)\s`)
+	updateJoin = regexp.MustCompile(`(?is)^\s*UPDATE\s+`)
+	setClause  = regexp.MustCompile(`(?i)\sSET\s`)
+	whereWord  = regexp.MustCompile(`(?i)\sWHERE\s`)
+	orderBy    = regexp.MustCompile(`(?i)\sORDER\s+BY\s`)
+	limitWord  = regexp.MustCompile(`(?i)\sLIMIT\s`)
+	joinWord   = regexp.MustCompile(`(?i)\s+(INNER\s+)?JOIN\s+`)
+	outerJoin  = regexp.MustCompile(`(?i)\b(LEFT|RIGHT|CROSS|STRAIGHT_JOIN)\b`)
+	onWord     = regexp.MustCompile(`(?i)\sON\s`)
+)
+
+// toSQLite rewrites a query written for MySQL into SQLite's dialect. It
+// covers the MySQL the repositories use: locking reads, which SQLite needs
+// no clause for as a write transaction holds the whole database, upserts,
+// multi-table updates, updates and deletes bounded by LIMIT, and the
+// functions with no SQLite counterpart of the same shape. The functions
+// SQLite lacks by name are registered on every connection instead; see
+// registerFunctions.
+func toSQLite(query string) sqliteQuery {
+	if cached, ok := sqliteQueries.Load(query); ok {
+		return cached.(sqliteQuery)
+	}
+
+	q := lockingRead.ReplaceAllString(query, "")
+	q = insertIgnore.ReplaceAllString(q, "INSERT OR IGNORE")
+	q = nowCall.ReplaceAllString(q, "CURRENT_TIMESTAMP")
+	q = ifCall.ReplaceAllString(q, "iif(")
+	q = greatestCall.ReplaceAllString(q, "max(")
+	q = leastCall.ReplaceAllString(q, "min(")
+	q = nullSafeEqual.ReplaceAllString(q, " IS ")
+	q = castInteger.ReplaceAllString(q, "AS INTEGER)")
+	q = diffUnit.ReplaceAllString(q, "timestampdiff('$1',")
+
+	q = rewriteCalls(q, leftCall, func(_ string, args []string) (string, bool) {
+		if len(args) != 2 {
+			return "", false
+		}
+		return "substr(" + strings.TrimSpace(args[0]) + ", 1, " + strings.TrimSpace(args[1]) + ")", true
+	})
+	q = rewriteCalls(q, dateShiftCall, func(name string, args []string) (string, bool) {
+		if len(args) != 2 {
+			return "", false
+		}
+		m := interval.FindStringSubmatch(strings.TrimSpace(args[1]))
+		if m == nil {
+			return "", false
+		}
+		sign := "'+'"
+		if strings.EqualFold(name, "DATE_SUB(") {
+			sign = "'-'"
+		}
+		return "datetime(" + args[0] + ", " + sign + " || (" + m[1] + ") || ' " + strings.ToLower(m[2]) + "')", true
+	})
+	q = rewriteCalls(q, groupConcatCall, func(_ string, args []string) (string, bool) {
+		if len(args) != 1 {
+			return "", false
+		}
+		m := concatClauses.FindStringSubmatch(strings.TrimSpace(args[0]))
+		if m == nil {
+			return "", false
+		}
+		separator := m[3]
+		if separator == "" {
+			separator = "','"
+		}
+		call := "group_concat_distinct(" + m[1] + ", " + separator
+		if m[2] != "" {
+			call += " ORDER BY " + m[2]
+		}
+		return call + ")", true
+	})
+
+	rewritten := sqliteQuery{text: q}
+	rewritten.text, rewritten.returnsID = rewriteUpsert(rewritten.text)
+	if !rewritten.returnsID && writeTable.MatchString(rewritten.text) && claimedID.MatchString(rewritten.text) {
+		rewritten.text = claimedID.ReplaceAllString(rewritten.text, "")
+		rewritten.returnsID = true
+	}
+	rewritten.text = rewriteLimitedWrite(rewritten.text)
+	rewritten.text = rewriteJoinedUpdate(rewritten.text)
+	if rewritten.returnsID {
+		rewritten.text = strings.TrimRight(rewritten.text, " \t\n;") + " RETURNING id"
+	}
+
+	sqliteQueries.Store(query, rewritten)
+	return rewritten
+}
+
+// rewriteUpsert turns ON DUPLICATE KEY UPDATE into SQLite's ON CONFLICT DO
+// UPDATE, where VALUES(col) is excluded.col. The assignment id =
+// LAST_INSERT_ID(id), which hands the id of an updated row to LastInsertId,
+// is dropped; the id is returned instead.
+func rewriteUpsert(query string) (string, bool) {
+	loc := topLevel(query, onDuplicateKey)
+	if loc == nil {
+		return query, false
+	}
+
+	returnsID := false
+	var assignments []string
+	for _, assignment := range splitTopLevel(query[loc[1]:]) {
+		column, value, ok := strings.Cut(assignment, "=")
+		if !ok {
+			return query, false
+		}
+		column = strings.TrimSpace(column)
+		if dot := strings.LastIndex(column, "."); dot >= 0 {
+			column = column[dot+1:]
+		}
+		value = strings.TrimSpace(value)
+		if m := lastInsertID.FindStringSubmatch(value); m != nil && strings.EqualFold(m[1], column) {
+			returnsID = true
+			continue
+		}
+		assignments = append(assignments, column+" = "+valuesRef.ReplaceAllString(value, "excluded.$1"))
+	}
+	if len(assignments) == 0 {
+		assignments = []string{"id = id"}
+	}
+	return query[:loc[0]] + "\n\t\tON CONFLICT DO UPDATE SET " + strings.Join(assignments, ", "), returnsID
+}
+
+// rewriteLimitedWrite bounds an UPDATE or DELETE with ORDER BY and LIMIT,
+// which SQLite does not take on a write, by selecting the rows it writes in
+// a subquery
+func rewriteLimitedWrite(query string) string {
+	m := writeTable.FindStringSubmatch(query)
+	if m == nil {
+		return query
+	}
+	limit := topLevel(query, limitWord)
+	if limit == nil {
+		return query
+	}
+	bound := limit[0]
+	if order := topLevel(query, orderBy); order != nil {
+		bound = order[0]
+	}
+
+	head, condition := query[:bound], ""
+	if where := topLevel(query[:bound], whereWord); where != nil {
+		head, condition = query[:where[0]], " WHERE"+query[where[1]-1:bound]
+	}
+	return head + " WHERE rowid IN (SELECT rowid FROM " + m[2] + condition + query[bound:] + ")"
+}
+
+// rewriteJoinedUpdate turns a multi-table UPDATE of one of its tables into
+// SQLite's UPDATE ... FROM, the other tables in FROM and their join
+// conditions in WHERE. The join conditions move behind the assignments, so
+// a join taking placeholders is left alone rather than bound out of order,
+// as are outer joins.
+func rewriteJoinedUpdate(query string) string {
+	start := updateJoin.FindStringIndex(query)
+	set := topLevel(query, setClause)
+	if start == nil || set == nil {
+		return query
+	}
+	tables := query[start[1]:set[0]]
+	if joinWord.FindStringIndex(tables) == nil || outerJoin.MatchString(tables) || strings.Contains(tables, "?") {
+		return query
+	}
+
+	rest, where := query[set[1]:], ""
+	if loc := topLevel(rest, whereWord); loc != nil {
+		rest, where = rest[:loc[0]], rest[loc[1]:]
+	}
+
+	// Every assignment must name the same table alias
+	alias := ""
+	var assignments []string
+	for _, assignment := range splitTopLevel(rest) {
+		column, value, ok := strings.Cut(assignment, "=")
+		if !ok {
+			return query
+		}
+		qualifier, name, ok := strings.Cut(strings.TrimSpace(column), ".")
+		if !ok || (alias != "" && qualifier != alias) {
+			return query
+		}
+		alias = qualifier
+		assignments = append(assignments, name+" = "+strings.TrimSpace(value))
+	}
+
+	target := ""
+	var from, conditions []string
+	for i, joined := range joinWord.Split(tables, -1) {
+		table := joined
+		if i > 0 {
+			loc := topLevel(joined, onWord)
+			if loc == nil {
+				return query
+			}
+			table = joined[:loc[0]]
+			conditions = append(conditions, "("+strings.TrimSpace(joined[loc[1]:])+")")
+		}
+		fields := strings.Fields(table)
+		if len(fields) == 3 && strings.EqualFold(fields[1], "AS") {
+			fields = []string{fields[0], fields[2]}
+		}
+		if len(fields) != 2 {
+			return query
+		}
+		if fields[1] == alias {
+			target = fields[0] + " AS " + fields[1]
+			continue
+		}
+		from = append(from, fields[0]+" "+fields[1])
+	}
+	if target == "" {
+		return query
+	}
+
+	if where != "" {
+		conditions = append(conditions, "("+strings.TrimSpace(where)+")")
+	}
+	return query[:start[1]] + target + " SET " + strings.Join(assignments, ", ") +
+		" FROM " + strings.Join(from, ", ") + " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// rewriteCalls rewrites each call of the function name matches, innermost
+// first, with the arguments of the call. A call rewrite declines is kept.
+func rewriteCalls(query string, name *regexp.Regexp, rewrite func(name string, args []string) (string, bool)) string {
+	matches := name.FindAllStringIndex(query, -1)
+	for i := len(matches) - 1; i >= 0; i-- {
+		start, open := matches[i][0], matches[i][1]-1
+		depths := levels(query)
+		if depths[start] < 0 {
+			continue
+		}
+		end := -1
+		for j := open + 1; j < len(query); j++ {
+			if depths[j] == depths[open] && query[j] == ')' {
+				end = j
+				break
+			}
+		}
+		if end < 0 {
+			continue
+		}
+		call, ok := rewrite(query[start:open+1], splitTopLevel(query[open+1:end]))
+		if ok {
+			query = query[:start] + call + query[end+1:]
+		}
+	}
+	return query
+}
+
+// topLevel returns the location of the first match of keyword in query that
+// is neither inside parentheses nor inside a quoted string, or nil
+func topLevel(query string, keyword *regexp.Regexp) []int {
+	depths := levels(query)
+	for _, loc := range keyword.FindAllStringIndex(query, -1) {
+		if depths[loc[0]] == 0 {
+			return loc
+		}
+	}
+	return nil
+}
+
+// splitTopLevel splits a list at the commas outside parentheses and quoted
+// strings
+func splitTopLevel(list string) []string {
+	depths := levels(list)
+	var parts []string
+	from := 0
+	for i := 0; i < len(list); i++ {
+		if list[i] == ',' && depths[i] == 0 {
+			parts = append(parts, list[from:i])
+			from = i + 1
+		}
+	}
+	return append(parts, list[from:])
+}
+
+// levels gives the parenthesis depth of each byte of query, a pair of
+// parentheses counting as outside itself, and -1 for the bytes of quoted
+// strings and identifiers
+func levels(query string) []int {
+	depths := make([]int, len(query))
+	depth := 0
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			depths[i] = -1
+			if c == '\\' && i+1 < len(query) {
+				i++
+				depths[i] = -1
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+			depths[i] = -1
+			continue
+		case c == ')':
+			depth--
+		}
+		depths[i] = depth
+		if c == '(' {
+			depth++
+		}
+	}
+	return depths
+}
@@ -0,0 +1,86 @@
+package database
+
+import "testing"
+
+func TestToSQLite(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		want      string
+		returnsID bool
+	}{
+		{
+			name:  "locking read",
+			query: "SELECT id FROM t WHERE a = ? FOR UPDATE",
+			want:  "SELECT id FROM t WHERE a = ?",
+		},
+		{
+			name:  "insert ignore",
+			query: "INSERT IGNORE INTO t (a) VALUES (?)",
+			want:  "INSERT OR IGNORE INTO t (a) VALUES (?)",
+		},
+		{
+			name:      "upsert reading back the id",
+			query:     "INSERT INTO t (a, b) VALUES (?, ?) ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id), a = VALUES(a), t.b = b + VALUES(b)",
+			want:      "INSERT INTO t (a, b) VALUES (?, ?)\n\t\tON CONFLICT DO UPDATE SET a = excluded.a, b = b + excluded.b RETURNING id",
+			returnsID: true,
+		},
+		{
+			name:      "claim of the first row",
+			query:     "UPDATE jobs SET id = LAST_INSERT_ID(id), status = ? WHERE status = ? OR (status = ? AND started_at < ?) ORDER BY id LIMIT 1",
+			want:      "UPDATE jobs SET status = ? WHERE rowid IN (SELECT rowid FROM jobs WHERE status = ? OR (status = ? AND started_at < ?) ORDER BY id LIMIT 1) RETURNING id",
+			returnsID: true,
+		},
+		{
+			name:  "bounded delete",
+			query: "DELETE FROM keys WHERE expires_at < ? LIMIT ?",
+			want:  "DELETE FROM keys WHERE rowid IN (SELECT rowid FROM keys WHERE expires_at < ? LIMIT ?)",
+		},
+		{
+			name:  "bounded delete with a bounded subquery",
+			query: "DELETE FROM keys WHERE id IN (SELECT id FROM old LIMIT 5)",
+			want:  "DELETE FROM keys WHERE id IN (SELECT id FROM old LIMIT 5)",
+		},
+		{
+			name:  "multi-table update",
+			query: "UPDATE mappings m JOIN entries e ON e.id = m.entry_id JOIN runs r ON r.id = m.run_id SET e.party = r.party, e.version = e.version + 1 WHERE r.tenant = ?",
+			want:  "UPDATE entries AS e SET party = r.party, version = e.version + 1 FROM mappings m, runs r WHERE (e.id = m.entry_id) AND (r.id = m.run_id) AND (r.tenant = ?)",
+		},
+		{
+			name:  "multi-table update with a placeholder in a join",
+			query: "UPDATE mappings m JOIN entries e ON e.id = m.entry_id AND e.tenant = ? SET e.party = ? WHERE m.run_id = ?",
+			want:  "UPDATE mappings m JOIN entries e ON e.id = m.entry_id AND e.tenant = ? SET e.party = ? WHERE m.run_id = ?",
+		},
+		{
+			name:  "distinct group concat",
+			query: "SELECT GROUP_CONCAT(DISTINCT r.id ORDER BY r.id SEPARATOR ','), GROUP_CONCAT(DISTINCT r.b SEPARATOR '\\n') FROM r",
+			want:  "SELECT group_concat_distinct(r.id, ',' ORDER BY r.id), group_concat_distinct(r.b, '\\n') FROM r",
+		},
+		{
+			name:  "date arithmetic",
+			query: "SELECT 1 FROM a WHERE a.created_at < DATE_ADD(?, INTERVAL 1 DAY) AND b > DATE_SUB(NOW(), INTERVAL ? SECOND)",
+			want:  "SELECT 1 FROM a WHERE a.created_at < datetime(?, '+' || (1) || ' day') AND b > datetime(CURRENT_TIMESTAMP, '-' || (?) || ' second')",
+		},
+		{
+			name:  "functions",
+			query: "SELECT TIMESTAMPDIFF(SECOND, a, b), LEFT(k, ?), CAST(s AS UNSIGNED), IF(a <=> b, 1, GREATEST(c, LEAST(d, e))) FROM x",
+			want:  "SELECT timestampdiff('SECOND', a, b), substr(k, 1, ?), CAST(s AS INTEGER), iif(a IS b, 1, max(c, min(d, e))) FROM x",
+		},
+		{
+			name:  "function names in strings are kept",
+			query: "SELECT LEFT(name, 2) FROM t WHERE note = 'LEFT(x'",
+			want:  "SELECT substr(name, 1, 2) FROM t WHERE note = 'LEFT(x'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := toSQLite(tt.query)
+			if got.text != tt.want {
+				t.Errorf("toSQLite(%q)\n got %q\nwant %q", tt.query, got.text, tt.want)
+			}
+			if got.returnsID != tt.returnsID {
+				t.Errorf("returnsID = %v, want %v", got.returnsID, tt.returnsID)
+			}
+		})
+	}
+}
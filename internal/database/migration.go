@@ -0,0 +1,34 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/mysql"
+	migratesqlite "github.com/golang-migrate/migrate/v4/database/sqlite3"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+
+	"reconciliation-service/internal/config"
+)
+
+// NewMigration returns the migrations of the configured database: those in
+// MIGRATION_DIR for MySQL, and for SQLite the versions of them in its sqlite
+// directory
+func NewMigration(cfg *config.Config) (*migrate.Migrate, error) {
+	if !cfg.Database.SQLite() {
+		return migrate.New("file://"+cfg.Migration.Dir, cfg.GetMigrationDBURL())
+	}
+
+	db, err := sql.Open("sqlite3", cfg.GetDSN())
+	if err != nil {
+		return nil, fmt.Errorf("error opening database: %v", err)
+	}
+	driver, err := migratesqlite.WithInstance(db, &migratesqlite.Config{})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return migrate.NewWithDatabaseInstance("file://"+filepath.Join(cfg.Migration.Dir, "sqlite"), "sqlite3", driver)
+}
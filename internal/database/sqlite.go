@@ -0,0 +1,474 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteDriverName is the SQLite driver the service opens. It takes the
+// repositories' MySQL: queries are rewritten by toSQLite, the MySQL
+// functions they call are registered on every connection, and errors come
+// back as the MySQL errors the repositories check for.
+const sqliteDriverName = "sqlite3_mysql"
+
+func init() {
+	sql.Register(sqliteDriverName, &sqliteDriver{base: &sqlite3.SQLiteDriver{}})
+}
+
+// sqliteTimeLayout is how times are stored, the layout of SQLite's
+// CURRENT_TIMESTAMP, so the two compare as strings
+const sqliteTimeLayout = "2006-01-02 15:04:05.999999"
+
+type sqliteDriver struct {
+	base *sqlite3.SQLiteDriver
+}
+
+func (d *sqliteDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := d.base.Open(dsn)
+	if err != nil {
+		return nil, translateSQLiteError(err)
+	}
+	c := &sqliteConn{SQLiteConn: conn.(*sqlite3.SQLiteConn)}
+	if err := c.registerFunctions(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// sqliteConn is a SQLite connection taking MySQL
+type sqliteConn struct {
+	*sqlite3.SQLiteConn
+}
+
+func (c *sqliteConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *sqliteConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	rewritten := toSQLite(query)
+	stmt, err := c.SQLiteConn.PrepareContext(ctx, rewritten.text)
+	if err != nil {
+		return nil, translateSQLiteError(err)
+	}
+	return &sqliteStmt{SQLiteStmt: stmt.(*sqlite3.SQLiteStmt), returnsID: rewritten.returnsID}, nil
+}
+
+func (c *sqliteConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *sqliteConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	tx, err := c.SQLiteConn.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, translateSQLiteError(err)
+	}
+	return sqliteTx{tx}, nil
+}
+
+func (c *sqliteConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	rewritten := toSQLite(query)
+	if rewritten.returnsID {
+		rows, err := c.SQLiteConn.QueryContext(ctx, rewritten.text, args)
+		if err != nil {
+			return nil, translateSQLiteError(err)
+		}
+		return returnedID(rows)
+	}
+	result, err := c.SQLiteConn.ExecContext(ctx, rewritten.text, args)
+	if err != nil {
+		return nil, translateSQLiteError(err)
+	}
+	return result, nil
+}
+
+func (c *sqliteConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := c.SQLiteConn.QueryContext(ctx, toSQLite(query).text, args)
+	if err != nil {
+		return nil, translateSQLiteError(err)
+	}
+	return &sqliteRows{rows.(*sqlite3.SQLiteRows)}, nil
+}
+
+// CheckNamedValue stores times in UTC in sqliteTimeLayout; SQLite would
+// otherwise store them with their zone, which does not compare with
+// CURRENT_TIMESTAMP
+func (c *sqliteConn) CheckNamedValue(value *driver.NamedValue) error {
+	v, err := driver.DefaultParameterConverter.ConvertValue(value.Value)
+	if err != nil {
+		return err
+	}
+	if t, ok := v.(time.Time); ok {
+		v = t.UTC().Format(sqliteTimeLayout)
+	}
+	value.Value = v
+	return nil
+}
+
+// Close releases the named locks the connection holds, as MySQL does when a
+// session ends
+func (c *sqliteConn) Close() error {
+	namedLocks.releaseAll(c)
+	return c.SQLiteConn.Close()
+}
+
+type sqliteStmt struct {
+	*sqlite3.SQLiteStmt
+	returnsID bool
+}
+
+func (s *sqliteStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	if s.returnsID {
+		rows, err := s.SQLiteStmt.QueryContext(ctx, args)
+		if err != nil {
+			return nil, translateSQLiteError(err)
+		}
+		return returnedID(rows)
+	}
+	result, err := s.SQLiteStmt.ExecContext(ctx, args)
+	if err != nil {
+		return nil, translateSQLiteError(err)
+	}
+	return result, nil
+}
+
+func (s *sqliteStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := s.SQLiteStmt.QueryContext(ctx, args)
+	if err != nil {
+		return nil, translateSQLiteError(err)
+	}
+	return &sqliteRows{rows.(*sqlite3.SQLiteRows)}, nil
+}
+
+// sqliteRows returns the times an expression computes, such as
+// CURRENT_TIMESTAMP, as times, as MySQL does. SQLite returns a time only
+// from a column declared as one.
+type sqliteRows struct {
+	*sqlite3.SQLiteRows
+}
+
+var timestampText = regexp.MustCompile(`^\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}(\.\d+)?$`)
+
+func (r *sqliteRows) Next(dest []driver.Value) error {
+	if err := r.SQLiteRows.Next(dest); err != nil {
+		return translateSQLiteError(err)
+	}
+	for i, value := range dest {
+		text, ok := value.(string)
+		if !ok || r.ColumnTypeDatabaseTypeName(i) != "" || !timestampText.MatchString(text) {
+			continue
+		}
+		if t, err := time.Parse(sqliteTimeLayout, text); err == nil {
+			dest[i] = t
+		}
+	}
+	return nil
+}
+
+type sqliteTx struct {
+	driver.Tx
+}
+
+func (tx sqliteTx) Commit() error {
+	return translateSQLiteError(tx.Tx.Commit())
+}
+
+// idResult is the result of a write returning the id of its row, which
+// MySQL would have handed to LastInsertId
+type idResult struct {
+	id   int64
+	rows int64
+}
+
+func (r idResult) LastInsertId() (int64, error) { return r.id, nil }
+func (r idResult) RowsAffected() (int64, error) { return r.rows, nil }
+
+// returnedID reads the ids a write returned
+func returnedID(rows driver.Rows) (driver.Result, error) {
+	defer rows.Close()
+	var result idResult
+	values := make([]driver.Value, len(rows.Columns()))
+	for {
+		err := rows.Next(values)
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return nil, translateSQLiteError(err)
+		}
+		result.id, _ = values[0].(int64)
+		result.rows++
+	}
+}
+
+// translateSQLiteError returns a SQLite error as the MySQL error the
+// repositories check for: a violated key, foreign key or check, or a
+// deadlock for a database that stayed locked
+func translateSQLiteError(err error) error {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return err
+	}
+	var number uint16
+	switch {
+	case sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique, sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey:
+		number = 1062
+	case sqliteErr.ExtendedCode == sqlite3.ErrConstraintForeignKey:
+		number = 1452
+	case sqliteErr.ExtendedCode == sqlite3.ErrConstraintCheck:
+		number = 3819
+	case sqliteErr.ExtendedCode == sqlite3.ErrConstraintTrigger:
+		// The triggers standing in for MySQL's check constraints say so
+		number = 1644
+		if strings.HasPrefix(sqliteErr.Error(), "CHECK constraint failed") {
+			number = 3819
+		}
+	case sqliteErr.Code == sqlite3.ErrBusy, sqliteErr.Code == sqlite3.ErrLocked:
+		number = 1213
+	default:
+		return err
+	}
+	return &mysql.MySQLError{Number: number, Message: sqliteErr.Error()}
+}
+
+// registerFunctions registers the MySQL functions the repositories call that
+// SQLite has not, or has under another name or shape
+func (c *sqliteConn) registerFunctions() error {
+	functions := map[string]interface{}{
+		"date_format":    dateFormat,
+		"unix_timestamp": unixTimestamp,
+		"timestampdiff":  timestampDiff,
+		"year":           year,
+		"json_contains":  jsonContains,
+		"json_unquote":   jsonUnquote,
+		"crc32":          checksum,
+		"mod":            mod,
+		"get_lock": func(name string, timeout int64) int64 {
+			return namedLocks.acquire(c, name, time.Duration(timeout)*time.Second)
+		},
+		"release_lock": func(name string) int64 {
+			return namedLocks.release(c, name)
+		},
+	}
+	for name, impl := range functions {
+		pure := name != "get_lock" && name != "release_lock"
+		if err := c.RegisterFunc(name, impl, pure); err != nil {
+			return fmt.Errorf("error registering %s: %w", name, err)
+		}
+	}
+	if err := c.RegisterAggregator("group_concat_distinct", newDistinctConcat, true); err != nil {
+		return fmt.Errorf("error registering group_concat_distinct: %w", err)
+	}
+	return nil
+}
+
+// sqliteTime parses a date or time SQLite holds as text
+func sqliteTime(value interface{}) (time.Time, bool) {
+	var text string
+	switch v := value.(type) {
+	case string:
+		text = v
+	case []byte:
+		text = string(v)
+	case time.Time:
+		return v, true
+	default:
+		return time.Time{}, false
+	}
+	for _, layout := range []string{sqliteTimeLayout, time.DateOnly, time.RFC3339Nano} {
+		if t, err := time.Parse(layout, text); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// dateFormat is DATE_FORMAT for the specifiers the repositories use
+func dateFormat(value interface{}, format string) interface{} {
+	t, ok := sqliteTime(value)
+	if !ok {
+		return nil
+	}
+	layout := strings.NewReplacer("%Y", "2006", "%m", "01", "%d", "02", "%H", "15", "%i", "04", "%s", "05", "%%", "%").Replace(format)
+	return t.Format(layout)
+}
+
+func unixTimestamp(value interface{}) interface{} {
+	t, ok := sqliteTime(value)
+	if !ok {
+		return nil
+	}
+	return t.Unix()
+}
+
+func timestampDiff(unit string, from, to interface{}) interface{} {
+	a, okA := sqliteTime(from)
+	b, okB := sqliteTime(to)
+	if !okA || !okB {
+		return nil
+	}
+	units := map[string]time.Duration{"SECOND": time.Second, "MINUTE": time.Minute, "HOUR": time.Hour, "DAY": 24 * time.Hour}
+	size, ok := units[strings.ToUpper(unit)]
+	if !ok {
+		return nil
+	}
+	return int64(b.Sub(a) / size)
+}
+
+func year(value interface{}) interface{} {
+	t, ok := sqliteTime(value)
+	if !ok {
+		return nil
+	}
+	return int64(t.Year())
+}
+
+// jsonContains is JSON_CONTAINS: whether candidate is target, or an element
+// of the array target is
+func jsonContains(target, candidate interface{}) interface{} {
+	if target == nil || candidate == nil {
+		return nil
+	}
+	var doc, value interface{}
+	if json.Unmarshal([]byte(fmt.Sprint(target)), &doc) != nil || json.Unmarshal([]byte(fmt.Sprint(candidate)), &value) != nil {
+		return nil
+	}
+	if reflect.DeepEqual(doc, value) {
+		return int64(1)
+	}
+	if elements, ok := doc.([]interface{}); ok {
+		for _, element := range elements {
+			if reflect.DeepEqual(element, value) {
+				return int64(1)
+			}
+		}
+	}
+	return int64(0)
+}
+
+// jsonUnquote is JSON_UNQUOTE. SQLite's json_extract already unquotes the
+// strings it extracts, which then pass through.
+func jsonUnquote(value interface{}) interface{} {
+	text, ok := value.(string)
+	if !ok {
+		return value
+	}
+	var unquoted string
+	if strings.HasPrefix(text, `"`) && json.Unmarshal([]byte(text), &unquoted) == nil {
+		return unquoted
+	}
+	return text
+}
+
+func checksum(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	return int64(crc32.ChecksumIEEE([]byte(fmt.Sprint(value))))
+}
+
+func mod(n, m int64) interface{} {
+	if m == 0 {
+		return nil
+	}
+	return n % m
+}
+
+// distinctConcat is GROUP_CONCAT(DISTINCT ... SEPARATOR ...), which SQLite's
+// group_concat takes only with its default separator
+type distinctConcat struct {
+	seen   map[string]bool
+	values []string
+	sep    string
+}
+
+func newDistinctConcat() *distinctConcat {
+	return &distinctConcat{seen: make(map[string]bool)}
+}
+
+func (g *distinctConcat) Step(value interface{}, sep string) {
+	if value == nil {
+		return
+	}
+	text := fmt.Sprint(value)
+	if b, ok := value.([]byte); ok {
+		text = string(b)
+	}
+	if g.seen[text] {
+		return
+	}
+	g.seen[text] = true
+	g.values = append(g.values, text)
+	// The separator is a MySQL string literal, whose escapes SQLite keeps
+	g.sep = strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\\`, `\`).Replace(sep)
+}
+
+func (g *distinctConcat) Done() interface{} {
+	if len(g.values) == 0 {
+		return nil
+	}
+	return strings.Join(g.values, g.sep)
+}
+
+// namedLocks are the locks of GET_LOCK, held by a connection until it
+// releases them or closes
+var namedLocks = &lockTable{owners: make(map[string]*sqliteConn)}
+
+type lockTable struct {
+	mu     sync.Mutex
+	owners map[string]*sqliteConn
+}
+
+// acquire takes the lock name for c, waiting up to timeout for another
+// connection to release it; it returns 1 once taken and 0 on timeout
+func (l *lockTable) acquire(c *sqliteConn, name string, timeout time.Duration) int64 {
+	deadline := time.Now().Add(timeout)
+	for {
+		l.mu.Lock()
+		if owner := l.owners[name]; owner == nil || owner == c {
+			l.owners[name] = c
+			l.mu.Unlock()
+			return 1
+		}
+		l.mu.Unlock()
+		if time.Now().After(deadline) {
+			return 0
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// release frees the lock name if c holds it, returning 1 if it did
+func (l *lockTable) release(c *sqliteConn, name string) int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.owners[name] != c {
+		return 0
+	}
+	delete(l.owners, name)
+	return 1
+}
+
+func (l *lockTable) releaseAll(c *sqliteConn) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for name, owner := range l.owners {
+		if owner == c {
+			delete(l.owners, name)
+		}
+	}
+}
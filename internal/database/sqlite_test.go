@@ -0,0 +1,157 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"reconciliation-service/internal/config"
+)
+
+func openTestSQLite(t *testing.T) *sql.DB {
+	t.Helper()
+	cfg := &config.Config{Database: config.DatabaseConfig{
+		Driver: config.DriverSQLite,
+		Name:   filepath.Join(t.TempDir(), "test.db"),
+	}}
+	db, err := NewConnection(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(`
+		CREATE TABLE jobs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'queued',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			started_at TIMESTAMP NULL
+		);
+		CREATE UNIQUE INDEX idx_name ON jobs (name);
+		CREATE TABLE steps (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			job_id INTEGER NOT NULL REFERENCES jobs (id),
+			label TEXT NOT NULL
+		);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestSQLiteErrorsAreMySQLErrors(t *testing.T) {
+	db := openTestSQLite(t)
+	if _, err := db.Exec("INSERT INTO jobs (name) VALUES ('a')"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		number uint16
+	}{
+		{name: "duplicate key", query: "INSERT INTO jobs (name) VALUES ('a')", number: 1062},
+		{name: "missing parent", query: "INSERT INTO steps (job_id, label) VALUES (99, 'x')", number: 1452},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := db.Exec(tt.query)
+			var mysqlErr *mysql.MySQLError
+			if !errors.As(err, &mysqlErr) {
+				t.Fatalf("error = %v, want a MySQL error", err)
+			}
+			if mysqlErr.Number != tt.number {
+				t.Errorf("error number = %d, want %d", mysqlErr.Number, tt.number)
+			}
+		})
+	}
+}
+
+func TestSQLiteUpsertAndClaimReturnTheirRow(t *testing.T) {
+	db := openTestSQLite(t)
+	upsert := "INSERT INTO jobs (name) VALUES (?) ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id), attempts = attempts + 1"
+	first, err := db.Exec(upsert, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(upsert, "b"); err != nil {
+		t.Fatal(err)
+	}
+	again, err := db.Exec(upsert, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstID, _ := first.LastInsertId()
+	againID, _ := again.LastInsertId()
+	if firstID != againID {
+		t.Errorf("upsert of an existing row returned id %d, want %d", againID, firstID)
+	}
+
+	claim := "UPDATE jobs SET id = LAST_INSERT_ID(id), status = 'running', started_at = ? WHERE status = 'queued' ORDER BY id DESC LIMIT 1"
+	var claimed []int64
+	for range 3 {
+		result, err := db.Exec(claim, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			break
+		}
+		id, _ := result.LastInsertId()
+		claimed = append(claimed, id)
+	}
+	if len(claimed) != 2 || claimed[0] <= claimed[1] {
+		t.Errorf("claimed %v, want both jobs, newest first", claimed)
+	}
+
+	// Times are stored the way CURRENT_TIMESTAMP is, so they compare with it
+	var started int
+	err = db.QueryRow("SELECT COUNT(*) FROM jobs WHERE started_at > DATE_SUB(CURRENT_TIMESTAMP, INTERVAL 1 MINUTE)").Scan(&started)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if started != 2 {
+		t.Errorf("jobs started within the minute = %d, want 2", started)
+	}
+}
+
+func TestSQLiteNamedLocks(t *testing.T) {
+	db := openTestSQLite(t)
+	ctx := context.Background()
+	holder, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer holder.Close()
+	other, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	lock := func(conn *sql.Conn, timeout int) int64 {
+		var acquired int64
+		if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK('guard', ?)", timeout).Scan(&acquired); err != nil {
+			t.Fatal(err)
+		}
+		return acquired
+	}
+	if lock(holder, 0) != 1 {
+		t.Fatal("first GET_LOCK failed")
+	}
+	if lock(other, 0) != 0 {
+		t.Error("GET_LOCK took a lock another connection holds")
+	}
+	if _, err := holder.ExecContext(ctx, "SELECT RELEASE_LOCK('guard')"); err != nil {
+		t.Fatal(err)
+	}
+	if lock(other, 0) != 1 {
+		t.Error("GET_LOCK failed once the lock was released")
+	}
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"reconciliation-service/internal/i18n"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+	"reconciliation-service/internal/services"
+)
+
+type AccessHandler struct {
+	accessService *services.AccessService
+}
+
+func NewAccessHandler(accessService *services.AccessService) *AccessHandler {
+	return &AccessHandler{
+		accessService: accessService,
+	}
+}
+
+// Require wraps a handler so only callers holding at least role reach it.
+// Without authentication there is no caller to check and every route is
+// open.
+func (h *AccessHandler) Require(role string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			identity := requestIdentity(r)
+			if identity == nil {
+				next(w, r)
+				return
+			}
+
+			var err error
+			if requestAPIKey(r) != nil {
+				err = h.accessService.AuthorizeRole(services.APIKeyRole, role)
+			} else {
+				err = h.accessService.Authorize(identity.Subject, role)
+			}
+			switch {
+			case err == nil:
+				next(w, r)
+			case errors.Is(err, services.ErrNoRole):
+				respondWithError(w, http.StatusForbidden, err.Error())
+			case errors.Is(err, services.ErrForbidden):
+				respondWithJSON(w, http.StatusForbidden, map[string]string{
+					"error":         i18n.T(responseLocale(w), services.ErrForbidden.Error()),
+					"required_role": role,
+					"request_id":    responseRequestID(w),
+				})
+			default:
+				respondWithError(w, http.StatusInternalServerError, err.Error())
+			}
+		}
+	}
+}
+
+// Me returns the authenticated caller and their role
+func (h *AccessHandler) Me(w http.ResponseWriter, r *http.Request) {
+	identity := requestIdentity(r)
+	if identity == nil {
+		respondWithError(w, http.StatusNotFound, "Authentication is disabled")
+		return
+	}
+
+	if key := requestAPIKey(r); key != nil {
+		respondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"id":     identity.Subject,
+			"name":   identity.Name,
+			"role":   services.APIKeyRole,
+			"scope":  key.Scope,
+			"tenant": key.Tenant,
+		})
+		return
+	}
+
+	role, err := h.accessService.Role(identity.Subject)
+	if err != nil && !errors.Is(err, services.ErrNoRole) {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"id":    identity.Subject,
+		"name":  identity.Name,
+		"email": identity.Email,
+		"role":  role,
+	})
+}
+
+func (h *AccessHandler) ListRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := h.accessService.ListRoles()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"roles": roles,
+	})
+}
+
+func (h *AccessHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := h.accessService.ListUsers()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"users": users,
+	})
+}
+
+func (h *AccessHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	user, err := h.accessService.GetUser(mux.Vars(r)["user_id"])
+	if err != nil {
+		respondWithUserError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, user)
+}
+
+// SaveUser assigns the role in the body to the user in the path
+func (h *AccessHandler) SaveUser(w http.ResponseWriter, r *http.Request) {
+	var user models.User
+	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	user.ID = mux.Vars(r)["user_id"]
+	user.UpdatedBy = actingUser(r, user.UpdatedBy)
+
+	created, err := h.accessService.SaveUser(&user)
+	if err != nil {
+		respondWithUserError(w, err)
+		return
+	}
+
+	saved, err := h.accessService.GetUser(user.ID)
+	if err != nil {
+		respondWithUserError(w, err)
+		return
+	}
+	code := http.StatusOK
+	if created {
+		code = http.StatusCreated
+	}
+	respondWithJSON(w, code, saved)
+}
+
+func (h *AccessHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	if err := h.accessService.DeleteUser(mux.Vars(r)["user_id"]); err != nil {
+		respondWithUserError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, SuccessResponse{Message: i18n.T(responseLocale(w), "User deleted")})
+}
+
+func respondWithUserError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidUser):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, repositories.ErrUserNotFound):
+		respondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, repositories.ErrLastAdmin):
+		respondWithError(w, http.StatusConflict, err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"reconciliation-service/internal/i18n"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+	"reconciliation-service/internal/services"
+)
+
+type AliasHandler struct {
+	aliasService *services.AliasService
+}
+
+func NewAliasHandler(aliasService *services.AliasService) *AliasHandler {
+	return &AliasHandler{
+		aliasService: aliasService,
+	}
+}
+
+// CreateAlias adds a dictionary entry. The suggestion review screen sends
+// the bank_transaction_id and accounting_entry_id of the match the operator
+// confirmed along with the alias.
+func (h *AliasHandler) CreateAlias(w http.ResponseWriter, r *http.Request) {
+	var alias models.NameAlias
+	if err := json.NewDecoder(r.Body).Decode(&alias); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	alias.UserID = actingUser(r, alias.UserID)
+
+	if err := h.aliasService.CreateAlias(&alias); err != nil {
+		respondWithAliasError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, alias)
+}
+
+func (h *AliasHandler) ListAliases(w http.ResponseWriter, r *http.Request) {
+	aliases, err := h.aliasService.ListAliases()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"aliases": aliases,
+	})
+}
+
+func (h *AliasHandler) DeleteAlias(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid alias ID")
+		return
+	}
+
+	if err := h.aliasService.DeleteAlias(id); err != nil {
+		respondWithAliasError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, SuccessResponse{Message: i18n.T(responseLocale(w), "Alias deleted")})
+}
+
+func respondWithAliasError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidAlias):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, repositories.ErrAliasNotFound):
+		respondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, repositories.ErrAliasConflict):
+		respondWithError(w, http.StatusConflict, err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
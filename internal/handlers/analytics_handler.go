@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"reconciliation-service/internal/services"
+)
+
+type AnalyticsHandler struct {
+	analyticsService *services.AnalyticsService
+}
+
+func NewAnalyticsHandler(analyticsService *services.AnalyticsService) *AnalyticsHandler {
+	return &AnalyticsHandler{
+		analyticsService: analyticsService,
+	}
+}
+
+// CashPosition reports the cash of each bank account on a date, today by
+// default, optionally of one account
+func (h *AnalyticsHandler) CashPosition(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	date := query.Get("date")
+	if date == "" {
+		date = time.Now().Format("2006-01-02")
+	}
+	horizonDays, err := intQuery(query.Get("horizon_days"), services.DefaultCashHorizonDays)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "horizon_days must be a number")
+		return
+	}
+
+	positions, err := h.analyticsService.CashPositions(date, query.Get("account_number"), horizonDays)
+	if err != nil {
+		respondWithAnalyticsError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"date":         date,
+		"horizon_days": horizonDays,
+		"accounts":     positions,
+	})
+}
+
+// ReconciliationStats sums up how the bank transactions of a date range were
+// reconciled, for management dashboards
+func (h *AnalyticsHandler) ReconciliationStats(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	fromDate, toDate := query.Get("from_date"), query.Get("to_date")
+	if fromDate == "" || toDate == "" {
+		respondWithError(w, http.StatusBadRequest, "Both from_date and to_date are required")
+		return
+	}
+
+	stats, err := h.analyticsService.ReconciliationStats(fromDate, toDate)
+	if err != nil {
+		respondWithAnalyticsError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, stats)
+}
+
+func respondWithAnalyticsError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidAnalyticsQuery):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
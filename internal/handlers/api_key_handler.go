@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+	"reconciliation-service/internal/services"
+)
+
+type APIKeyHandler struct {
+	apiKeyService *services.APIKeyService
+}
+
+func NewAPIKeyHandler(apiKeyService *services.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyService: apiKeyService,
+	}
+}
+
+// apiKeyRequest is the body of an issue; a key never expires unless
+// expires_at is sent
+type apiKeyRequest struct {
+	Name      string     `json:"name"`
+	Scope     string     `json:"scope"`
+	Tenant    string     `json:"tenant"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	UserID    string     `json:"user_id"`
+}
+
+// IssueKey issues a key and answers with its secret, which is not shown
+// again
+func (h *APIKeyHandler) IssueKey(w http.ResponseWriter, r *http.Request) {
+	var req apiKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	key := &models.APIKey{
+		Name:      req.Name,
+		Scope:     req.Scope,
+		Tenant:    req.Tenant,
+		ExpiresAt: req.ExpiresAt,
+	}
+	issued, err := h.apiKeyService.Issue(key, actingUser(r, req.UserID))
+	if err != nil {
+		respondWithAPIKeyError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, issued)
+}
+
+// ListKeys lists the keys of every tenant, or of the tenant query parameter
+func (h *APIKeyHandler) ListKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.apiKeyService.ListKeys(r.URL.Query().Get("tenant"))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": keys,
+	})
+}
+
+func (h *APIKeyHandler) GetKey(w http.ResponseWriter, r *http.Request) {
+	id, ok := apiKeyID(w, r)
+	if !ok {
+		return
+	}
+
+	key, err := h.apiKeyService.GetKey(id)
+	if err != nil {
+		respondWithAPIKeyError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, key)
+}
+
+// RotateKey answers with the replacement of a key and its secret; the old
+// key keeps working for the rotation grace period
+func (h *APIKeyHandler) RotateKey(w http.ResponseWriter, r *http.Request) {
+	id, ok := apiKeyID(w, r)
+	if !ok {
+		return
+	}
+
+	rotated, err := h.apiKeyService.Rotate(id, actingUser(r, r.URL.Query().Get("user_id")))
+	if err != nil {
+		respondWithAPIKeyError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, rotated)
+}
+
+func (h *APIKeyHandler) RevokeKey(w http.ResponseWriter, r *http.Request) {
+	id, ok := apiKeyID(w, r)
+	if !ok {
+		return
+	}
+
+	revoked, err := h.apiKeyService.Revoke(id, actingUser(r, r.URL.Query().Get("user_id")))
+	if err != nil {
+		respondWithAPIKeyError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, revoked)
+}
+
+func respondWithAPIKeyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidAPIKey):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, repositories.ErrAPIKeyNotFound):
+		respondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrAPIKeyInactive):
+		respondWithError(w, http.StatusConflict, err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func apiKeyID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid API key ID")
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+	"reconciliation-service/internal/services"
+)
+
+type ArtifactHandler struct {
+	artifactService *services.ArtifactService
+}
+
+func NewArtifactHandler(artifactService *services.ArtifactService) *ArtifactHandler {
+	return &ArtifactHandler{
+		artifactService: artifactService,
+	}
+}
+
+// setArtifactHeaders sends the registration of a report file along with it
+func setArtifactHeaders(w http.ResponseWriter, artifact *models.ReportArtifact) {
+	w.Header().Set("X-Artifact-ID", strconv.FormatInt(artifact.ID, 10))
+	w.Header().Set("X-Artifact-SHA256", artifact.SHA256)
+	w.Header().Set("X-Artifact-Signature", artifact.Signature)
+}
+
+// VerifyArtifact checks the report file in the request body against the
+// signed artifacts. A file that does not verify is still answered 200, with
+// valid false and the reason.
+func (h *ArtifactHandler) VerifyArtifact(w http.ResponseWriter, r *http.Request) {
+	verification, err := h.artifactService.Verify(r.Body)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, verification)
+}
+
+func (h *ArtifactHandler) GetArtifact(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid artifact ID")
+		return
+	}
+
+	artifact, err := h.artifactService.GetArtifact(id)
+	switch {
+	case errors.Is(err, repositories.ErrArtifactNotFound):
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	case err != nil:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, artifact)
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"reconciliation-service/internal/auth"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/services"
+)
+
+type identityKey struct{}
+
+type apiKeyKey struct{}
+
+// ingestRoutes are the routes a key of the ingest scope reaches: the uploads,
+// the jobs they hand off to, and the caller's own identity
+var ingestRoutes = map[string]bool{
+	apiPrefix + "/me":                           true,
+	apiPrefix + "/data/bank-transactions":       true,
+	apiPrefix + "/data/bank-statements":         true,
+	apiPrefix + "/data/bank-statements/detect":  true,
+	apiPrefix + "/data/bank-statements/mt940":   true,
+	apiPrefix + "/data/bank-statements/camt053": true,
+	apiPrefix + "/data/accounting-entries":      true,
+	apiPrefix + "/admin/jobs/{id:[0-9]+}":       true,
+}
+
+// authMiddleware requires a valid bearer token or API key on every request
+// and puts the caller's identity into the request context. A nil verifier
+// turns authentication off, leaving callers to name themselves.
+func authMiddleware(verifier *auth.Verifier, apiKeys *services.APIKeyService) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// A key the tenant router already authenticated, such as a
+			// sandbox key, acts as an API key even where no tokens are verified
+			if requestAPIKey(r) != nil {
+				serveAPIKey(w, r, apiKeys, next)
+				return
+			}
+			if verifier == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token, ok := bearerToken(r)
+			if !ok && strings.TrimSpace(r.Header.Get("X-API-Key")) != "" {
+				serveAPIKey(w, r, apiKeys, next)
+				return
+			}
+			if !ok {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="reconciliation-service"`)
+				respondWithError(w, http.StatusUnauthorized, "Authentication required")
+				return
+			}
+
+			identity, err := verifier.Verify(token)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="reconciliation-service", error="invalid_token"`)
+				if errors.Is(err, auth.ErrTokenExpired) {
+					respondWithError(w, http.StatusUnauthorized, auth.ErrTokenExpired.Error())
+					return
+				}
+				respondWithError(w, http.StatusUnauthorized, auth.ErrInvalidToken.Error())
+				return
+			}
+
+			logCaller(r, "user:"+identity.Subject)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, identity)))
+		})
+	}
+}
+
+// serveAPIKey authenticates a machine caller by its API key, which acts for
+// its own tenant only and, in the ingest scope, on the ingestRoutes only
+func serveAPIKey(w http.ResponseWriter, r *http.Request, apiKeys *services.APIKeyService, next http.Handler) {
+	key := requestAPIKey(r)
+	if key == nil {
+		var err error
+		key, err = apiKeys.Authenticate(r.Header.Get("X-API-Key"))
+		if errors.Is(err, services.ErrAPIKeyRejected) {
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	caller := apiKeyCaller(key)
+	logCaller(r, caller)
+	if tenant, ok := r.Context().Value(tenantKey{}).(string); ok && tenant != key.Tenant {
+		respondWithError(w, http.StatusForbidden, "X-Tenant-ID does not match the tenant of the API key")
+		return
+	}
+	if key.Scope == models.APIKeyScopeIngest {
+		template := ""
+		if route := mux.CurrentRoute(r); route != nil {
+			template, _ = route.GetPathTemplate()
+		}
+		if !ingestRoutes[template] {
+			respondWithError(w, http.StatusForbidden, "This API key may only ingest data")
+			return
+		}
+	}
+
+	identity := &auth.Identity{Subject: caller, Name: key.Name, Tenant: key.Tenant}
+	ctx := context.WithValue(r.Context(), identityKey{}, identity)
+	next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, apiKeyKey{}, key)))
+}
+
+// apiKeyCaller names the caller of an API key: its ID, or the name of a key
+// that is not stored, such as a sandbox key
+func apiKeyCaller(key *models.APIKey) string {
+	if key.ID == 0 {
+		return "api-key:" + key.Name
+	}
+	return "api-key:" + strconv.FormatInt(key.ID, 10)
+}
+
+// requestAPIKey returns the API key the caller authenticated with, if any
+func requestAPIKey(r *http.Request) *models.APIKey {
+	key, _ := r.Context().Value(apiKeyKey{}).(*models.APIKey)
+	return key
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return "", false
+	}
+	token := strings.TrimSpace(header[7:])
+	return token, token != ""
+}
+
+// requestIdentity returns the authenticated caller, or nil when
+// authentication is off
+func requestIdentity(r *http.Request) *auth.Identity {
+	identity, _ := r.Context().Value(identityKey{}).(*auth.Identity)
+	return identity
+}
+
+// actingUser is the user a change is attributed to: the authenticated caller,
+// whatever the request claims, or the claimed user when authentication is off
+func actingUser(r *http.Request, claimed string) string {
+	if identity := requestIdentity(r); identity != nil {
+		return identity.Subject
+	}
+	return claimed
+}
+
+// requestCaller names the caller in audit trails: the authenticated user or
+// API key, or the usage entity when authentication is off
+func requestCaller(r *http.Request) string {
+	if key := requestAPIKey(r); key != nil {
+		return requestIdentity(r).Subject
+	}
+	if identity := requestIdentity(r); identity != nil {
+		return "user:" + identity.Subject
+	}
+	return usageEntity(r)
+}
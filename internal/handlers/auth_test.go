@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"reconciliation-service/internal/auth"
+	"reconciliation-service/internal/config"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories/repotest"
+	"reconciliation-service/internal/services"
+)
+
+func TestAuthMiddlewareAPIKeys(t *testing.T) {
+	verifier := auth.NewVerifier(testJWTSecret, "", "", 0)
+	apiKeys := services.NewAPIKeyService(repotest.NewAPIKeys(), []string{"acme", "globex"}, "acme", config.APIKeyConfig{RotationGrace: time.Hour})
+	issue := func(scope, tenant string) *models.APIKey {
+		issued, err := apiKeys.Issue(&models.APIKey{Name: "caller", Scope: scope, Tenant: tenant}, "admin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return issued
+	}
+	ingestKey := issue(models.APIKeyScopeIngest, "acme")
+	fullKey := issue(models.APIKeyScopeFull, "acme")
+	revokedKey := issue(models.APIKeyScopeFull, "acme")
+	if _, err := apiKeys.Revoke(revokedKey.ID, "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every route answers with the caller it authenticated
+	router := mux.NewRouter()
+	api := router.PathPrefix(apiPrefix).Subrouter()
+	api.Use(authMiddleware(verifier, apiKeys))
+	whoami := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(requestCaller(r)))
+	}
+	api.HandleFunc("/data/bank-transactions", whoami).Methods(http.MethodPost)
+	api.HandleFunc("/admin/jobs/{id:[0-9]+}", whoami).Methods(http.MethodGet)
+	api.HandleFunc("/reconciliation/start", whoami).Methods(http.MethodPost)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		key        string
+		tenant     string
+		wantCode   int
+		wantCaller string
+	}{
+		{name: "ingest key uploads", method: http.MethodPost, path: "/data/bank-transactions", key: ingestKey.Key, wantCode: http.StatusOK, wantCaller: "api-key:1"},
+		{name: "ingest key follows its job", method: http.MethodGet, path: "/admin/jobs/7", key: ingestKey.Key, wantCode: http.StatusOK, wantCaller: "api-key:1"},
+		{name: "ingest key cannot reconcile", method: http.MethodPost, path: "/reconciliation/start", key: ingestKey.Key, wantCode: http.StatusForbidden},
+		{name: "full key reconciles", method: http.MethodPost, path: "/reconciliation/start", key: fullKey.Key, wantCode: http.StatusOK, wantCaller: "api-key:2"},
+		{name: "revoked key", method: http.MethodPost, path: "/data/bank-transactions", key: revokedKey.Key, wantCode: http.StatusUnauthorized},
+		{name: "unknown key", method: http.MethodPost, path: "/data/bank-transactions", key: "rk_unknown", wantCode: http.StatusUnauthorized},
+		{name: "key of another tenant than the routed one", method: http.MethodPost, path: "/data/bank-transactions", key: fullKey.Key, tenant: "globex", wantCode: http.StatusForbidden},
+		{name: "key of the routed tenant", method: http.MethodPost, path: "/data/bank-transactions", key: fullKey.Key, tenant: "acme", wantCode: http.StatusOK, wantCaller: "api-key:2"},
+		{name: "bearer token", method: http.MethodPost, path: "/reconciliation/start", token: signTestToken(t, "alice", "acme"), wantCode: http.StatusOK, wantCaller: "user:alice"},
+		{name: "bearer token wins over a key", method: http.MethodPost, path: "/reconciliation/start", token: signTestToken(t, "alice", "acme"), key: ingestKey.Key, wantCode: http.StatusOK, wantCaller: "user:alice"},
+		{name: "no credentials", method: http.MethodPost, path: "/data/bank-transactions", wantCode: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, apiPrefix+tt.path, nil)
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			if tt.key != "" {
+				r.Header.Set("X-API-Key", tt.key)
+			}
+			if tt.tenant != "" {
+				r = r.WithContext(context.WithValue(r.Context(), tenantKey{}, tt.tenant))
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if tt.wantCaller != "" && w.Body.String() != tt.wantCaller {
+				t.Errorf("caller = %q, want %q", w.Body, tt.wantCaller)
+			}
+		})
+	}
+}
+
+func TestSandboxKeyActsAsAPIKey(t *testing.T) {
+	sandbox := config.SandboxConfig{Tenant: "sandbox", APIKeys: []string{"sk_test"}}
+	access := NewAccessHandler(services.NewAccessService(nil, nil))
+
+	// The sandbox verifies no tokens, as when authentication is off
+	router := mux.NewRouter()
+	api := router.PathPrefix(apiPrefix).Subrouter()
+	api.Use(authMiddleware(nil, nil))
+	whoami := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(requestCaller(r)))
+	}
+	api.HandleFunc("/reconciliation/start", access.Require(models.RoleOperator)(whoami)).Methods(http.MethodPost)
+	api.HandleFunc("/admin/api-keys", access.Require(models.RoleAdmin)(whoami)).Methods(http.MethodPost)
+
+	tests := []struct {
+		name       string
+		path       string
+		sandboxKey bool
+		wantCode   int
+		wantCaller string
+	}{
+		{name: "sandbox key reconciles", path: "/reconciliation/start", sandboxKey: true, wantCode: http.StatusOK, wantCaller: "api-key:sandbox"},
+		{name: "sandbox key cannot manage keys", path: "/admin/api-keys", sandboxKey: true, wantCode: http.StatusForbidden},
+		{name: "authentication off", path: "/admin/api-keys", wantCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, apiPrefix+tt.path, nil)
+			ctx := context.WithValue(r.Context(), tenantKey{}, sandbox.Tenant)
+			if tt.sandboxKey {
+				ctx = context.WithValue(ctx, apiKeyKey{}, sandboxAPIKey(sandbox))
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r.WithContext(ctx))
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if tt.wantCaller != "" && w.Body.String() != tt.wantCaller {
+				t.Errorf("caller = %q, want %q", w.Body, tt.wantCaller)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"reconciliation-service/internal/i18n"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/money"
+	"reconciliation-service/internal/repositories"
+	"reconciliation-service/internal/services"
+)
+
+type BudgetHandler struct {
+	budgetService *services.BudgetService
+}
+
+func NewBudgetHandler(budgetService *services.BudgetService) *BudgetHandler {
+	return &BudgetHandler{
+		budgetService: budgetService,
+	}
+}
+
+type budgetUploadRequest struct {
+	Budgets []struct {
+		AccountNumber string       `json:"account_number"`
+		Period        string       `json:"period"`
+		Kind          string       `json:"kind"`
+		Amount        money.Amount `json:"amount"`
+		Currency      string       `json:"currency"`
+	} `json:"budgets"`
+	UserID string `json:"user_id"`
+}
+
+// UploadBudgets stores budget or forecast figures, replacing those already
+// uploaded for the same account, period and kind
+func (h *BudgetHandler) UploadBudgets(w http.ResponseWriter, r *http.Request) {
+	var req budgetUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	budgets := make([]*models.Budget, 0, len(req.Budgets))
+	for _, budget := range req.Budgets {
+		budgets = append(budgets, &models.Budget{
+			AccountNumber: budget.AccountNumber,
+			Period:        budget.Period,
+			Kind:          budget.Kind,
+			Amount:        budget.Amount,
+			Currency:      budget.Currency,
+		})
+	}
+	saved, err := h.budgetService.SaveBudgets(budgets, actingUser(r, req.UserID))
+	if err != nil {
+		respondWithBudgetError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"saved": saved,
+	})
+}
+
+// ListBudgets lists the uploaded figures, optionally filtered by period and
+// kind
+func (h *BudgetHandler) ListBudgets(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	budgets, err := h.budgetService.ListBudgets(query.Get("period"), query.Get("kind"))
+	if err != nil {
+		respondWithBudgetError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"budgets": budgets,
+	})
+}
+
+func (h *BudgetHandler) DeleteBudget(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid budget ID")
+		return
+	}
+
+	if err := h.budgetService.DeleteBudget(id); err != nil {
+		respondWithBudgetError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, SuccessResponse{Message: i18n.T(responseLocale(w), "Budget deleted")})
+}
+
+// Variance compares each budget of a period with the cash that moved on its
+// account. The period defaults to the previous month and the kind to budget.
+func (h *BudgetHandler) Variance(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	period := query.Get("period")
+	if period == "" {
+		now := time.Now()
+		period = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, -1, 0).Format("2006-01")
+	}
+
+	variances, err := h.budgetService.Variances(period, query.Get("kind"), query.Get("account_number"))
+	if err != nil {
+		respondWithBudgetError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"period":    period,
+		"variances": variances,
+	})
+}
+
+func respondWithBudgetError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidBudget):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, repositories.ErrBudgetNotFound):
+		respondWithError(w, http.StatusNotFound, err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"reconciliation-service/internal/i18n"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+	"reconciliation-service/internal/services"
+)
+
+type CalendarHandler struct {
+	calendarService *services.CalendarService
+}
+
+func NewCalendarHandler(calendarService *services.CalendarService) *CalendarHandler {
+	return &CalendarHandler{
+		calendarService: calendarService,
+	}
+}
+
+func (h *CalendarHandler) CreateCalendar(w http.ResponseWriter, r *http.Request) {
+	var cal models.BusinessCalendar
+	if err := json.NewDecoder(r.Body).Decode(&cal); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := h.calendarService.CreateCalendar(&cal); err != nil {
+		respondWithCalendarError(w, err)
+		return
+	}
+
+	created, err := h.calendarService.GetCalendar(cal.Code)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, created)
+}
+
+func (h *CalendarHandler) ListCalendars(w http.ResponseWriter, r *http.Request) {
+	calendars, err := h.calendarService.ListCalendars()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"calendars": calendars,
+	})
+}
+
+func (h *CalendarHandler) GetCalendar(w http.ResponseWriter, r *http.Request) {
+	cal, err := h.calendarService.GetCalendar(mux.Vars(r)["code"])
+	if err != nil {
+		respondWithCalendarError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, cal)
+}
+
+func (h *CalendarHandler) UpdateCalendar(w http.ResponseWriter, r *http.Request) {
+	var cal models.BusinessCalendar
+	if err := json.NewDecoder(r.Body).Decode(&cal); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	cal.Code = mux.Vars(r)["code"]
+
+	updated, err := h.calendarService.UpdateCalendar(&cal)
+	if err != nil {
+		respondWithCalendarError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, updated)
+}
+
+func (h *CalendarHandler) DeleteCalendar(w http.ResponseWriter, r *http.Request) {
+	if err := h.calendarService.DeleteCalendar(mux.Vars(r)["code"]); err != nil {
+		respondWithCalendarError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, SuccessResponse{Message: i18n.T(responseLocale(w), "Calendar deleted")})
+}
+
+func (h *CalendarHandler) AddHoliday(w http.ResponseWriter, r *http.Request) {
+	var holiday models.CalendarHoliday
+	if err := json.NewDecoder(r.Body).Decode(&holiday); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	code := mux.Vars(r)["code"]
+	if err := h.calendarService.AddHoliday(code, holiday); err != nil {
+		respondWithCalendarError(w, err)
+		return
+	}
+
+	h.GetCalendar(w, r)
+}
+
+func (h *CalendarHandler) DeleteHoliday(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if err := h.calendarService.DeleteHoliday(vars["code"], vars["date"]); err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	h.GetCalendar(w, r)
+}
+
+// ImportHolidays replaces one year of holidays with a published list, sent
+// either as a JSON array of {date, name} or as text/csv with date,name rows
+func (h *CalendarHandler) ImportHolidays(w http.ResponseWriter, r *http.Request) {
+	year, err := strconv.Atoi(r.URL.Query().Get("year"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "year query parameter is required")
+		return
+	}
+
+	var holidays []models.CalendarHoliday
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+		holidays, err = parseHolidayCSV(r.Body)
+	} else {
+		err = json.NewDecoder(r.Body).Decode(&holidays)
+	}
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	cal, err := h.calendarService.ImportHolidays(mux.Vars(r)["code"], year, holidays)
+	if err != nil {
+		respondWithCalendarError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, cal)
+}
+
+// BusinessDays counts the business days between from_date and to_date
+func (h *CalendarHandler) BusinessDays(w http.ResponseWriter, r *http.Request) {
+	fromDate := r.URL.Query().Get("from_date")
+	toDate := r.URL.Query().Get("to_date")
+	if fromDate == "" || toDate == "" {
+		respondWithError(w, http.StatusBadRequest, "Both from_date and to_date query parameters are required")
+		return
+	}
+
+	days, err := h.calendarService.BusinessDaysBetween(mux.Vars(r)["code"], fromDate, toDate)
+	if err != nil {
+		respondWithCalendarError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"from_date":     fromDate,
+		"to_date":       toDate,
+		"business_days": days,
+	})
+}
+
+// parseHolidayCSV reads date,name rows; a header row starting with "date" is
+// skipped
+func parseHolidayCSV(body io.Reader) ([]models.CalendarHoliday, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var holidays []models.CalendarHoliday
+	for i, record := range records {
+		if len(record) == 0 {
+			continue
+		}
+		if i == 0 && strings.EqualFold(strings.TrimSpace(record[0]), "date") {
+			continue
+		}
+		holiday := models.CalendarHoliday{Date: strings.TrimSpace(record[0])}
+		if len(record) > 1 {
+			holiday.Name = record[1]
+		}
+		holidays = append(holidays, holiday)
+	}
+	return holidays, nil
+}
+
+func respondWithCalendarError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidCalendar):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, repositories.ErrCalendarNotFound):
+		respondWithError(w, http.StatusNotFound, err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
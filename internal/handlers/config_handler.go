@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"reconciliation-service/internal/services"
+)
+
+// Largest configuration bundle accepted for import
+const maxConfigBundleSize = 32 << 20
+
+type ConfigHandler struct {
+	configService *services.ConfigBundleService
+}
+
+func NewConfigHandler(configService *services.ConfigBundleService) *ConfigHandler {
+	return &ConfigHandler{
+		configService: configService,
+	}
+}
+
+// ExportConfig returns the whole configuration as one bundle, served as a
+// download
+func (h *ConfigHandler) ExportConfig(w http.ResponseWriter, r *http.Request) {
+	bundle, err := h.configService.Export()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Disposition", `attachment; filename="configuration.json"`)
+	respondWithJSON(w, http.StatusOK, bundle)
+}
+
+// ImportConfig applies an exported bundle. The operator, the authenticated
+// caller or else user_id, becomes the author of any rule change the import
+// proposes.
+func (h *ConfigHandler) ImportConfig(w http.ResponseWriter, r *http.Request) {
+	var bundle services.ConfigBundle
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxConfigBundleSize)).Decode(&bundle); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	result, err := h.configService.Import(&bundle, actingUser(r, r.URL.Query().Get("user_id")))
+	if errors.Is(err, services.ErrInvalidConfigBundle) {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	status := http.StatusOK
+	if !result.Success {
+		status = http.StatusPartialContent
+	}
+	respondWithJSON(w, status, result)
+}
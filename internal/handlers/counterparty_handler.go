@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"reconciliation-service/internal/i18n"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+	"reconciliation-service/internal/services"
+)
+
+type CounterpartyHandler struct {
+	counterpartyService *services.CounterpartyService
+}
+
+func NewCounterpartyHandler(counterpartyService *services.CounterpartyService) *CounterpartyHandler {
+	return &CounterpartyHandler{
+		counterpartyService: counterpartyService,
+	}
+}
+
+func (h *CounterpartyHandler) CreateCounterparty(w http.ResponseWriter, r *http.Request) {
+	var cp models.Counterparty
+	if err := json.NewDecoder(r.Body).Decode(&cp); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := h.counterpartyService.CreateCounterparty(&cp); err != nil {
+		respondWithCounterpartyError(w, err)
+		return
+	}
+
+	created, err := h.counterpartyService.GetCounterparty(cp.Code)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, created)
+}
+
+func (h *CounterpartyHandler) ListCounterparties(w http.ResponseWriter, r *http.Request) {
+	counterparties, err := h.counterpartyService.ListCounterparties()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"counterparties": counterparties,
+	})
+}
+
+func (h *CounterpartyHandler) GetCounterparty(w http.ResponseWriter, r *http.Request) {
+	cp, err := h.counterpartyService.GetCounterparty(mux.Vars(r)["code"])
+	if err != nil {
+		respondWithCounterpartyError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, cp)
+}
+
+func (h *CounterpartyHandler) UpdateCounterparty(w http.ResponseWriter, r *http.Request) {
+	var cp models.Counterparty
+	if err := json.NewDecoder(r.Body).Decode(&cp); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	cp.Code = mux.Vars(r)["code"]
+
+	updated, err := h.counterpartyService.UpdateCounterparty(&cp)
+	if err != nil {
+		respondWithCounterpartyError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, updated)
+}
+
+func (h *CounterpartyHandler) DeleteCounterparty(w http.ResponseWriter, r *http.Request) {
+	if err := h.counterpartyService.DeleteCounterparty(mux.Vars(r)["code"]); err != nil {
+		respondWithCounterpartyError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, SuccessResponse{Message: i18n.T(responseLocale(w), "Counterparty deleted")})
+}
+
+func respondWithCounterpartyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidCounterparty):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, repositories.ErrCounterpartyNotFound):
+		respondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, repositories.ErrCounterpartyConflict):
+		respondWithError(w, http.StatusConflict, err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
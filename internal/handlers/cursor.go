@@ -0,0 +1,10 @@
+package handlers
+
+// withNextCursor adds the cursor of the following page to a list response,
+// leaving it out once the list is exhausted
+func withNextCursor(body map[string]interface{}, next string) map[string]interface{} {
+	if next != "" {
+		body["next_cursor"] = next
+	}
+	return body
+}
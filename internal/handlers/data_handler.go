@@ -1,75 +1,253 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
 
+	"github.com/gorilla/mux"
+
+	"reconciliation-service/internal/i18n"
+	"reconciliation-service/internal/ingestion/charset"
+	"reconciliation-service/internal/ingestion/detect"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
 	"reconciliation-service/internal/services"
 )
 
 type DataHandler struct {
 	dataIngestionService *services.DataIngestionService
+	usage                *UsageHandler
+	jobService           *services.JobService
 }
 
-func NewDataHandler(dataIngestionService *services.DataIngestionService) *DataHandler {
+func NewDataHandler(dataIngestionService *services.DataIngestionService, usage *UsageHandler, jobService *services.JobService) *DataHandler {
 	return &DataHandler{
 		dataIngestionService: dataIngestionService,
+		usage:                usage,
+		jobService:           jobService,
 	}
 }
 
+// IngestBankTransactions ingests a JSON array of bank transactions as it is
+// decoded, so a large upload is never held whole
 func (h *DataHandler) IngestBankTransactions(w http.ResponseWriter, r *http.Request) {
-	var transactions []services.BankTransactionInput
+	body := http.MaxBytesReader(w, r.Body, h.dataIngestionService.MaxJSONBytes())
+	job, ok := h.beginIngestion(w)
+	if !ok {
+		return
+	}
 
-	// Parse request body
-	if err := json.NewDecoder(r.Body).Decode(&transactions); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+	result, err := h.dataIngestionService.IngestBankTransactionStream(jsonArrayStream[services.BankTransactionInput](body), partialCommit(r), h.checkpointStream(job, "bank_transactions"))
+	h.jobService.Finish(job, "", err)
+	if err != nil {
+		h.respondWithStreamError(w, r, result, err, "No transactions provided")
 		return
 	}
+	h.respondWithIngestion(w, r, result)
+}
 
-	// Validate request
+// IngestMT940 accepts a raw MT940 statement file as the request body
+func (h *DataHandler) IngestMT940(w http.ResponseWriter, r *http.Request) {
+	decoded, ok := h.readStatement(w, r)
+	if !ok {
+		return
+	}
+	transactions, balances, err := services.ParseMT940(bytes.NewReader(decoded.Text))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	if len(transactions) == 0 {
 		respondWithError(w, http.StatusBadRequest, "No transactions provided")
 		return
 	}
 
-	// Process transactions
-	result, err := h.dataIngestionService.IngestBankTransactions(transactions)
+	h.ingestBankTransactions(w, r, "mt940", transactions, balances, decoded)
+}
+
+// IngestCAMT053 accepts a camt.053 XML statement as the request body
+func (h *DataHandler) IngestCAMT053(w http.ResponseWriter, r *http.Request) {
+	decoded, ok := h.readStatement(w, r)
+	if !ok {
+		return
+	}
+	transactions, balances, err := services.ParseCAMT053(bytes.NewReader(decoded.Text))
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(transactions) == 0 {
+		respondWithError(w, http.StatusBadRequest, "No transactions provided")
 		return
 	}
 
-	// Return response
-	status := http.StatusOK
-	if !result.Success {
-		status = http.StatusPartialContent
+	h.ingestBankTransactions(w, r, "camt053", transactions, balances, decoded)
+}
+
+// readStatement reads an uploaded statement file and converts it to UTF-8
+// from the encoding named by the encoding query parameter, detecting it when
+// none is named. It responds itself when the file cannot be read.
+func (h *DataHandler) readStatement(w http.ResponseWriter, r *http.Request) (*charset.Result, bool) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.dataIngestionService.MaxStatementBytes()))
+	if err != nil {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "Statement file is too large")
+		return nil, false
 	}
-	respondWithJSON(w, status, result)
+	decoded, err := charset.Decode(data, r.URL.Query().Get("encoding"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	return decoded, true
 }
 
-func (h *DataHandler) IngestAccountingEntries(w http.ResponseWriter, r *http.Request) {
-	var entries []services.AccountingEntryInput
+// DetectStatement reports the encoding and format of an uploaded file
+// without ingesting it
+func (h *DataHandler) DetectStatement(w http.ResponseWriter, r *http.Request) {
+	decoded, ok := h.readStatement(w, r)
+	if !ok {
+		return
+	}
 
-	// Parse request body
-	if err := json.NewDecoder(r.Body).Decode(&entries); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+	detection := detect.Detect(decoded.Text)
+	respondWithJSON(w, http.StatusOK, struct {
+		detect.Detection
+		Ingestible bool            `json:"ingestible"`
+		Encoding   *charset.Result `json:"encoding"`
+	}{detection, services.StatementIngestible(detection), decoded})
+}
+
+// IngestStatement accepts a statement file of any supported format and
+// ingests it with the parser of its detected format. A file that is not
+// confidently one of them is refused with the detection result.
+func (h *DataHandler) IngestStatement(w http.ResponseWriter, r *http.Request) {
+	decoded, ok := h.readStatement(w, r)
+	if !ok {
 		return
 	}
 
-	// Validate request
-	if len(entries) == 0 {
-		respondWithError(w, http.StatusBadRequest, "No entries provided")
+	detection := detect.Detect(decoded.Text)
+	if !services.StatementIngestible(detection) {
+		respondWithJSON(w, http.StatusUnsupportedMediaType, map[string]interface{}{
+			"error":      i18n.T(responseLocale(w), "Statement format is not supported"),
+			"detection":  detection,
+			"encoding":   decoded,
+			"request_id": responseRequestID(w),
+		})
 		return
 	}
 
-	// Process entries
-	result, err := h.dataIngestionService.IngestAccountingEntries(entries)
+	transactions, balances, err := services.ParseStatement(detection, decoded.Text)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(transactions) == 0 {
+		respondWithError(w, http.StatusBadRequest, "No transactions provided")
+		return
+	}
+
+	h.ingestBankTransactions(w, r, detection.Format, transactions, balances, decoded)
+}
+
+// ingestBankTransactions stores parsed transactions, and the statement
+// balances that came with them, as an ingestion job. decoded is the
+// conversion of an uploaded file, reported with the result; it is nil for
+// JSON input. Files take the bulk lane, JSON input the lane of its size.
+func (h *DataHandler) ingestBankTransactions(w http.ResponseWriter, r *http.Request, source string, transactions []services.BankTransactionInput, balances []*models.StatementBalance, decoded *charset.Result) {
+	lane := h.dataIngestionService.LaneFor(len(transactions))
+	if decoded != nil {
+		lane = services.IngestionLaneBulk
+	}
+
+	job, err := h.jobService.Begin(models.JobTypeIngestion, "", "")
+	if err == services.ErrDraining {
+		respondDraining(w)
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	h.jobService.Checkpoint(job, map[string]interface{}{
+		"source":  source,
+		"records": len(transactions),
+		"lane":    lane,
+	})
+
+	// Process transactions
+	result, err := h.dataIngestionService.IngestBankTransactions(lane, transactions, balances, partialCommit(r))
+	h.jobService.Finish(job, "", err)
+	if err != nil {
+		h.respondWithIngestionError(w, r, result, http.StatusInternalServerError, err.Error())
+		return
+	}
+	result.Encoding = decoded
+	h.respondWithIngestion(w, r, result)
+}
+
+// partialCommit reports whether an ingestion asked with ?partial_commit=true
+// to store its valid records even if others fail
+func partialCommit(r *http.Request) bool {
+	return r.URL.Query().Get("partial_commit") == "true"
+}
+
+// IngestAccountingEntries ingests a JSON array of accounting entries as it is
+// decoded, so a large upload is never held whole
+func (h *DataHandler) IngestAccountingEntries(w http.ResponseWriter, r *http.Request) {
+	body := http.MaxBytesReader(w, r.Body, h.dataIngestionService.MaxJSONBytes())
+	job, ok := h.beginIngestion(w)
+	if !ok {
+		return
+	}
+
+	result, err := h.dataIngestionService.IngestAccountingEntryStream(jsonArrayStream[services.AccountingEntryInput](body), partialCommit(r), h.checkpointStream(job, "accounting_entries"))
+	h.jobService.Finish(job, "", err)
+	if err != nil {
+		h.respondWithStreamError(w, r, result, err, "No entries provided")
+		return
+	}
+	h.respondWithIngestion(w, r, result)
+}
+
+// beginIngestion begins the job of a streamed upload. It responds itself
+// when no job can be begun.
+func (h *DataHandler) beginIngestion(w http.ResponseWriter) (*models.ReconciliationJob, bool) {
+	job, err := h.jobService.Begin(models.JobTypeIngestion, "", "")
+	if err == services.ErrDraining {
+		respondDraining(w)
+		return nil, false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	return job, true
+}
+
+// checkpointStream records in its job how far a streamed upload was decoded
+// and the lane it takes
+func (h *DataHandler) checkpointStream(job *models.ReconciliationJob, source string) func(lane string, decoded int) {
+	return func(lane string, decoded int) {
+		h.jobService.Checkpoint(job, map[string]interface{}{
+			"source":  source,
+			"records": decoded,
+			"lane":    lane,
+		})
+	}
+}
+
+// respondWithIngestion answers with the result of an ingestion, counting the
+// rows it stored against the caller's quota
+func (h *DataHandler) respondWithIngestion(w http.ResponseWriter, r *http.Request, result *services.IngestionResult) {
+	if result.Committed {
+		h.usage.recordRowsIngested(r, result.RecordsCount)
+	}
 
-	// Return response
 	status := http.StatusOK
 	if !result.Success {
 		status = http.StatusPartialContent
@@ -77,6 +255,79 @@ func (h *DataHandler) IngestAccountingEntries(w http.ResponseWriter, r *http.Req
 	respondWithJSON(w, status, result)
 }
 
+// respondWithStreamError answers a streamed upload that failed, with empty
+// as the message of an empty array. An upload that failed after committing
+// chunks is answered with what they stored as well as the error.
+func (h *DataHandler) respondWithStreamError(w http.ResponseWriter, r *http.Request, result *services.IngestionResult, err error, empty string) {
+	code, message := http.StatusInternalServerError, err.Error()
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		code, message = http.StatusRequestEntityTooLarge, "Request payload is too large"
+	case errors.Is(err, services.ErrNoRecords):
+		code, message = http.StatusBadRequest, empty
+	case errors.Is(err, services.ErrInvalidPayload):
+		code = http.StatusBadRequest
+	}
+	h.respondWithIngestionError(w, r, result, code, message)
+}
+
+// ingestionFailure answers an ingestion that failed after committing some
+// of its records: their result, and the error that ended it
+type ingestionFailure struct {
+	*services.IngestionResult
+	ErrorResponse
+}
+
+// respondWithIngestionError answers an ingestion that failed. When it had
+// committed records before it failed, their result is part of the answer and
+// their rows count against the caller's quota.
+func (h *DataHandler) respondWithIngestionError(w http.ResponseWriter, r *http.Request, result *services.IngestionResult, code int, message string) {
+	if result == nil || !result.Committed {
+		respondWithError(w, code, message)
+		return
+	}
+	h.usage.recordRowsIngested(r, result.RecordsCount)
+	respondWithJSON(w, code, ingestionFailure{
+		IngestionResult: result,
+		ErrorResponse:   ErrorResponse{Error: i18n.T(responseLocale(w), message), RequestID: responseRequestID(w)},
+	})
+}
+
+// jsonArrayStream decodes a JSON array body one element at a time
+func jsonArrayStream[T any](body io.Reader) services.RecordStream[T] {
+	decoder := json.NewDecoder(body)
+	started, ended := false, false
+	return func() (T, bool, error) {
+		var record T
+		if ended {
+			return record, false, nil
+		}
+		if !started {
+			token, err := decoder.Token()
+			if err != nil {
+				return record, false, err
+			}
+			if delim, ok := token.(json.Delim); !ok || delim != '[' {
+				return record, false, errors.New("expected a JSON array")
+			}
+			started = true
+		}
+		if !decoder.More() {
+			// The closing bracket, or the error of a truncated array
+			if _, err := decoder.Token(); err != nil {
+				return record, false, err
+			}
+			ended = true
+			return record, false, nil
+		}
+		if err := decoder.Decode(&record); err != nil {
+			return record, false, err
+		}
+		return record, true, nil
+	}
+}
+
 type BankTransactionsRequest struct {
 	Transactions []services.BankTransactionInput `json:"transactions"`
 }
@@ -84,3 +335,130 @@ type BankTransactionsRequest struct {
 type AccountingEntriesRequest struct {
 	Entries []services.AccountingEntryInput `json:"entries"`
 }
+
+// bankTransactionCorrection is a corrected bank transaction plus the version
+// it was read at and the operator making the correction
+type bankTransactionCorrection struct {
+	services.BankTransactionInput
+	Version int    `json:"version"`
+	UserID  string `json:"user_id"`
+}
+
+type accountingEntryCorrection struct {
+	services.AccountingEntryInput
+	Version int    `json:"version"`
+	UserID  string `json:"user_id"`
+}
+
+func (h *DataHandler) GetBankTransaction(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseRecordID(w, r)
+	if !ok {
+		return
+	}
+	fields, ok := requestFields(w, r)
+	if !ok {
+		return
+	}
+
+	transaction, err := h.dataIngestionService.GetBankTransaction(id)
+	if err != nil {
+		respondWithRecordError(w, err)
+		return
+	}
+
+	respondWithFields(w, http.StatusOK, transaction, fields)
+}
+
+func (h *DataHandler) CorrectBankTransaction(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseRecordID(w, r)
+	if !ok {
+		return
+	}
+
+	var correction bankTransactionCorrection
+	if err := json.NewDecoder(r.Body).Decode(&correction); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	transaction, err := h.dataIngestionService.CorrectBankTransaction(id, correction.BankTransactionInput, correction.Version, actingUser(r, correction.UserID))
+	if err != nil {
+		respondWithRecordError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, transaction)
+}
+
+func (h *DataHandler) GetAccountingEntry(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseRecordID(w, r)
+	if !ok {
+		return
+	}
+	fields, ok := requestFields(w, r)
+	if !ok {
+		return
+	}
+
+	entry, err := h.dataIngestionService.GetAccountingEntry(id)
+	if err != nil {
+		respondWithRecordError(w, err)
+		return
+	}
+
+	respondWithFields(w, http.StatusOK, entry, fields)
+}
+
+func (h *DataHandler) CorrectAccountingEntry(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseRecordID(w, r)
+	if !ok {
+		return
+	}
+
+	var correction accountingEntryCorrection
+	if err := json.NewDecoder(r.Body).Decode(&correction); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	entry, err := h.dataIngestionService.CorrectAccountingEntry(id, correction.AccountingEntryInput, correction.Version, actingUser(r, correction.UserID))
+	if err != nil {
+		respondWithRecordError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, entry)
+}
+
+func parseRecordID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid record ID")
+		return 0, false
+	}
+	return id, true
+}
+
+// respondWithRecordError maps errors from edits of bank transactions,
+// accounting entries and reconciliations; a stale version or a voided record
+// is a 409 and held data a 423
+func respondWithRecordError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrLegalHold):
+		respondWithError(w, http.StatusLocked, err.Error())
+	case errors.Is(err, services.ErrInvalidCorrection),
+		errors.Is(err, services.ErrInvalidVoid):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, repositories.ErrVersionConflict),
+		errors.Is(err, services.ErrNothingToUnmatch),
+		errors.Is(err, services.ErrSettledLater),
+		errors.Is(err, services.ErrRecordVoided):
+		respondWithError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, repositories.ErrBankTransactionNotFound),
+		errors.Is(err, repositories.ErrAccountingEntryNotFound),
+		errors.Is(err, repositories.ErrReconciliationNotFound):
+		respondWithError(w, http.StatusNotFound, err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
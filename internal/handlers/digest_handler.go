@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"reconciliation-service/internal/services"
+)
+
+type DigestHandler struct {
+	digestService *services.DigestService
+}
+
+func NewDigestHandler(digestService *services.DigestService) *DigestHandler {
+	return &DigestHandler{
+		digestService: digestService,
+	}
+}
+
+// Daily sums up a day of the tenant, yesterday by default
+func (h *DigestHandler) Daily(w http.ResponseWriter, r *http.Request) {
+	digest, err := h.digestService.Daily(r.URL.Query().Get("date"))
+	if err != nil {
+		respondWithDigestError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, digest)
+}
+
+func respondWithDigestError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidDigestQuery):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const errPreconditionFailed = "batch was modified since the If-Match ETag was read"
+
+// etag is the strong entity tag of a response body
+func etag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match or If-Match header names tag
+// or is *. If-None-Match compares weakly, ignoring a W/ prefix; If-Match
+// compares strongly.
+func etagMatches(header, tag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// conditionalWriter holds a response back until its ETag is known
+type conditionalWriter struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (w *conditionalWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *conditionalWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+}
+
+func (w *conditionalWriter) Write(data []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.body.Write(data)
+}
+
+// conditionalGet tags the successful responses of next with an ETag of
+// their body and answers 304 Not Modified, without the body, when the
+// request's If-None-Match names it
+func conditionalGet(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cw := &conditionalWriter{header: w.Header()}
+		next(cw, r)
+		if cw.code == 0 {
+			cw.code = http.StatusOK
+		}
+		if cw.code != http.StatusOK {
+			w.WriteHeader(cw.code)
+			w.Write(cw.body.Bytes())
+			return
+		}
+
+		tag := etag(cw.body.Bytes())
+		w.Header().Set("ETag", tag)
+		if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, tag, true) {
+			w.Header().Del("Content-Type")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.WriteHeader(cw.code)
+		w.Write(cw.body.Bytes())
+	}
+}
+
+// checkIfMatch answers 412 unless the request's If-Match names the ETag
+// current has now, the ETag a GET of it is served with. It passes requests
+// without If-Match.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, current interface{}) bool {
+	match := r.Header.Get("If-Match")
+	if match == "" {
+		return true
+	}
+	body, err := json.Marshal(current)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	if !etagMatches(match, etag(body), false) {
+		respondWithError(w, http.StatusPreconditionFailed, errPreconditionFailed)
+		return false
+	}
+	return true
+}
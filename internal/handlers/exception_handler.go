@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"reconciliation-service/internal/pagination"
+	"reconciliation-service/internal/repositories"
+	"reconciliation-service/internal/services"
+)
+
+type ExceptionHandler struct {
+	exceptionService *services.ExceptionService
+}
+
+func NewExceptionHandler(exceptionService *services.ExceptionService) *ExceptionHandler {
+	return &ExceptionHandler{
+		exceptionService: exceptionService,
+	}
+}
+
+// ListExceptions lists the exception queue oldest record first, optionally
+// filtered by status, owner and record type
+func (h *ExceptionHandler) ListExceptions(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, err := intQuery(query.Get("limit"), services.DefaultExceptionLimit)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "limit must be a number")
+		return
+	}
+
+	exceptions, next, err := h.exceptionService.ListExceptions(query.Get("status"), query.Get("owner"), query.Get("record_type"), query.Get("cursor"), limit)
+	if err != nil {
+		respondWithExceptionError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, withNextCursor(map[string]interface{}{
+		"exceptions": exceptions,
+	}, next))
+}
+
+// GetException returns an exception with its audit trail
+func (h *ExceptionHandler) GetException(w http.ResponseWriter, r *http.Request) {
+	id, ok := exceptionID(w, r)
+	if !ok {
+		return
+	}
+
+	exception, err := h.exceptionService.GetException(id)
+	if err != nil {
+		respondWithExceptionError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, exception)
+}
+
+type exceptionTransitionRequest struct {
+	Status  string `json:"status"`
+	Comment string `json:"comment"`
+	Version int    `json:"version"`
+	UserID  string `json:"user_id"`
+}
+
+// Transition moves an exception to another workflow state. Version, when
+// given, must be the exception's current version.
+func (h *ExceptionHandler) Transition(w http.ResponseWriter, r *http.Request) {
+	id, ok := exceptionID(w, r)
+	if !ok {
+		return
+	}
+	var req exceptionTransitionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	exception, err := h.exceptionService.Transition(id, req.Version, req.Status, req.Comment, actingUser(r, req.UserID))
+	if err != nil {
+		respondWithExceptionError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, exception)
+}
+
+type exceptionAssignRequest struct {
+	Owner   string `json:"owner"`
+	Comment string `json:"comment"`
+	Version int    `json:"version"`
+	UserID  string `json:"user_id"`
+}
+
+// Assign hands an exception to an owner, or unassigns it with an empty one
+func (h *ExceptionHandler) Assign(w http.ResponseWriter, r *http.Request) {
+	id, ok := exceptionID(w, r)
+	if !ok {
+		return
+	}
+	var req exceptionAssignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	exception, err := h.exceptionService.Assign(id, req.Version, req.Owner, req.Comment, actingUser(r, req.UserID))
+	if err != nil {
+		respondWithExceptionError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, exception)
+}
+
+type exceptionCommentRequest struct {
+	Comment string `json:"comment"`
+	UserID  string `json:"user_id"`
+}
+
+func (h *ExceptionHandler) AddComment(w http.ResponseWriter, r *http.Request) {
+	id, ok := exceptionID(w, r)
+	if !ok {
+		return
+	}
+	var req exceptionCommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	event, err := h.exceptionService.AddComment(id, req.Comment, actingUser(r, req.UserID))
+	if err != nil {
+		respondWithExceptionError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, event)
+}
+
+func exceptionID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid exception ID")
+		return 0, false
+	}
+	return id, true
+}
+
+func respondWithExceptionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidException), errors.Is(err, pagination.ErrInvalidCursor):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, repositories.ErrExceptionNotFound):
+		respondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, repositories.ErrExceptionConflict):
+		respondWithError(w, http.StatusConflict, err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"reconciliation-service/internal/i18n"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/pagination"
+	"reconciliation-service/internal/repositories"
+	"reconciliation-service/internal/services"
+)
+
+type ExpectationHandler struct {
+	expectationService *services.ExpectationService
+}
+
+func NewExpectationHandler(expectationService *services.ExpectationService) *ExpectationHandler {
+	return &ExpectationHandler{
+		expectationService: expectationService,
+	}
+}
+
+type expectationRequest struct {
+	models.ExpectedPayment
+	UserID string `json:"user_id"`
+}
+
+// Register records a payment an upstream system expects on a bank account
+func (h *ExpectationHandler) Register(w http.ResponseWriter, r *http.Request) {
+	var req expectationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	expectation, err := h.expectationService.Register(&models.ExpectedPayment{
+		Source:        req.Source,
+		ExternalID:    req.ExternalID,
+		Direction:     req.Direction,
+		AccountNumber: req.AccountNumber,
+		Amount:        req.Amount,
+		Currency:      req.Currency,
+		Reference:     req.Reference,
+		WindowStart:   req.WindowStart,
+		WindowEnd:     req.WindowEnd,
+	}, actingUser(r, req.UserID))
+	if err != nil {
+		respondWithExpectationError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, expectation)
+}
+
+// ListExpectations lists the latest expectations, optionally filtered by
+// status and source
+func (h *ExpectationHandler) ListExpectations(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, err := intQuery(query.Get("limit"), services.DefaultExpectationLimit)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "limit must be a number")
+		return
+	}
+
+	expectations, next, err := h.expectationService.ListExpectations(query.Get("status"), query.Get("source"), query.Get("cursor"), limit)
+	if err != nil {
+		respondWithExpectationError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, withNextCursor(map[string]interface{}{
+		"expectations": expectations,
+	}, next))
+}
+
+func (h *ExpectationHandler) GetExpectation(w http.ResponseWriter, r *http.Request) {
+	id, ok := expectationID(w, r)
+	if !ok {
+		return
+	}
+
+	expectation, err := h.expectationService.GetExpectation(id)
+	if err != nil {
+		respondWithExpectationError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, expectation)
+}
+
+// Cancel withdraws an expectation that has not been matched
+func (h *ExpectationHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	id, ok := expectationID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.expectationService.Cancel(id); err != nil {
+		respondWithExpectationError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, SuccessResponse{Message: i18n.T(responseLocale(w), "Expectation cancelled")})
+}
+
+func expectationID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid expectation ID")
+		return 0, false
+	}
+	return id, true
+}
+
+func respondWithExpectationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidExpectation), errors.Is(err, pagination.ErrInvalidCursor):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, repositories.ErrExpectationNotFound):
+		respondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, repositories.ErrExpectationConflict),
+		errors.Is(err, services.ErrExpectationClosed):
+		respondWithError(w, http.StatusConflict, err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"reconciliation-service/internal/i18n"
+	"reconciliation-service/internal/repositories"
+	"reconciliation-service/internal/services"
+)
+
+type ExportHandler struct {
+	reconciliationService *services.ReconciliationService
+	exportService         *services.ExportService
+}
+
+func NewExportHandler(reconciliationService *services.ReconciliationService, exportService *services.ExportService) *ExportHandler {
+	return &ExportHandler{
+		reconciliationService: reconciliationService,
+		exportService:         exportService,
+	}
+}
+
+// BatchReport streams a batch's full report, its matches followed by the
+// accounting entries it left unmatched, as CSV or as an XLSX workbook. A
+// report over the row threshold, or one requested with async=true, is
+// queued as an export job instead and answered with 202.
+func (h *ExportHandler) BatchReport(w http.ResponseWriter, r *http.Request) {
+	batchID := mux.Vars(r)["batch_id"]
+	query := r.URL.Query()
+
+	format := query.Get("format")
+	if format == "" {
+		format = services.ReportFormatCSV
+	}
+	if format != services.ReportFormatCSV && format != services.ReportFormatXLSX {
+		respondWithError(w, http.StatusBadRequest, services.ErrInvalidReportFormat.Error())
+		return
+	}
+
+	async := query.Get("async") == "true" || query.Get("callback_url") != ""
+	if !async {
+		exceeds, err := h.exportService.ExceedsThreshold(batchID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		async = exceeds
+	}
+	locale := responseLocale(w)
+
+	if async {
+		export, err := h.exportService.RequestBatchReport(r.Context(), batchID, format, locale, query.Get("callback_url"), requestCaller(r))
+		if err != nil {
+			respondWithExportError(w, err)
+			return
+		}
+		w.Header().Set("Location", fmt.Sprintf("/api/v1/exports/%d", export.ID))
+		respondWithJSON(w, http.StatusAccepted, export)
+		return
+	}
+
+	labels := make([]string, len(services.BatchReportColumns))
+	for i, column := range services.BatchReportColumns {
+		labels[i] = i18n.Label(locale, column)
+	}
+
+	// Nothing is written until the batch is known to exist, so a missing
+	// batch still gets a JSON error
+	started := false
+	err := h.reconciliationService.WriteBatchReport(r.Context(), batchID, format, labels, func() (io.Writer, error) {
+		started = true
+		filename := services.BatchReportFilename(batchID, format)
+		w.Header().Set("Content-Type", services.ReportContentType(format))
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+		w.WriteHeader(http.StatusOK)
+		return w, nil
+	})
+	if err != nil && !started {
+		respondWithExportError(w, err)
+		return
+	}
+	if err != nil {
+		// The status is sent; the client sees a truncated file
+		log.Printf("Batch report for %s failed: %v", batchID, err)
+	}
+}
+
+// GetExport reports an export job's status, with a signed download link
+// once it has completed
+func (h *ExportHandler) GetExport(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid export ID")
+		return
+	}
+
+	export, err := h.exportService.GetExport(id)
+	if err != nil {
+		respondWithExportError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, export)
+}
+
+// Download serves a completed export's file. It takes no bearer token: the
+// signed link is the authorization.
+func (h *ExportHandler) Download(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid export ID")
+		return
+	}
+
+	query := r.URL.Query()
+	export, file, err := h.exportService.OpenDownload(id, query.Get("expires"), query.Get("signature"))
+	if err != nil {
+		respondWithExportError(w, err)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", services.ExportContentType(export))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, services.ExportFilename(export)))
+	w.Header().Set("Content-Length", strconv.FormatInt(export.SizeBytes, 10))
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, file); err != nil {
+		log.Printf("Download of export %d failed: %v", id, err)
+	}
+}
+
+func respondWithExportError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidExport),
+		errors.Is(err, services.ErrInvalidReportFormat):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrInvalidDownloadLink):
+		respondWithError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, services.ErrExportNotReady):
+		respondWithError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, repositories.ErrReconciliationNotFound):
+		respondWithError(w, http.StatusNotFound, repositories.ErrReconciliationNotFound.Error())
+	case errors.Is(err, repositories.ErrExportNotFound):
+		respondWithError(w, http.StatusNotFound, err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/services"
+)
+
+// maxQueuedWriteSize bounds the body of a write held in the failover outbox;
+// larger ones are refused while read-only
+const maxQueuedWriteSize = 1 << 20
+
+// queueableRoutes are the writes safe to replay later: ingestion is
+// idempotent on record IDs, and a start is when it carries an
+// Idempotency-Key
+var queueableRoutes = map[string]bool{
+	apiPrefix + "/data/bank-transactions":       true,
+	apiPrefix + "/data/bank-statements":         true,
+	apiPrefix + "/data/bank-statements/mt940":   true,
+	apiPrefix + "/data/bank-statements/camt053": true,
+	apiPrefix + "/data/accounting-entries":      true,
+	apiPrefix + "/reconciliation/start":         false,
+}
+
+type replayKey struct{}
+
+type FailoverHandler struct {
+	failoverService *services.FailoverService
+	accessService   *services.AccessService
+}
+
+func NewFailoverHandler(failoverService *services.FailoverService, accessService *services.AccessService) *FailoverHandler {
+	return &FailoverHandler{
+		failoverService: failoverService,
+		accessService:   accessService,
+	}
+}
+
+// ReadOnlyRouter serves reads from replica while the service is read-only,
+// when there is a replica, and everything else from primary. Writes queued
+// while read-only are replayed through primary.
+func ReadOnlyRouter(primary, replica http.Handler, failover *services.FailoverService) http.Handler {
+	failover.SetReplayer(func(write *models.QueuedWrite) int {
+		return replayWrite(primary, write)
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if replica != nil && isReadOnlyMethod(r.Method) && failover.ReadOnly() {
+			replica.ServeHTTP(w, r)
+			return
+		}
+		primary.ServeHTTP(w, r)
+	})
+}
+
+// replayWrite sends a queued write through handler as it was received and
+// returns the status it was answered with
+func replayWrite(handler http.Handler, write *models.QueuedWrite) int {
+	r, err := http.NewRequestWithContext(context.WithValue(context.Background(), replayKey{}, true), write.Method, write.URI, bytes.NewReader(write.Body))
+	if err != nil {
+		log.Printf("queued write %d cannot be replayed: %v", write.ID, err)
+		return http.StatusInternalServerError
+	}
+	r.Header = http.Header(write.Header).Clone()
+	recorder := &replayRecorder{header: make(http.Header)}
+	handler.ServeHTTP(recorder, r)
+	if recorder.code == 0 {
+		return http.StatusOK
+	}
+	return recorder.code
+}
+
+// replayRecorder keeps the status of a replayed write and drops its body
+type replayRecorder struct {
+	header http.Header
+	code   int
+}
+
+func (w *replayRecorder) Header() http.Header { return w.header }
+
+func (w *replayRecorder) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+}
+
+func (w *replayRecorder) Write(data []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return len(data), nil
+}
+
+// ReadOnlyMiddleware answers writes while the primary database is
+// unavailable: those safe to replay are queued and accepted with 202, the
+// rest refused with 503 instead of failing against the database. Writes
+// being replayed go through.
+func (h *FailoverHandler) ReadOnlyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isReadOnlyMethod(r.Method) || !h.failoverService.ReadOnly() || r.Context().Value(replayKey{}) != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !queueable(r) {
+			h.refuse(w)
+			return
+		}
+
+		// Queued writes skip the role check of their route until they are
+		// replayed, so a caller whose role cannot be confirmed is refused
+		if identity := requestIdentity(r); identity != nil {
+			err := h.accessService.Authorize(identity.Subject, models.RoleOperator)
+			switch {
+			case err == nil:
+			case errors.Is(err, services.ErrNoRole), errors.Is(err, services.ErrForbidden):
+				respondWithError(w, http.StatusForbidden, err.Error())
+				return
+			default:
+				h.refuse(w)
+				return
+			}
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxQueuedWriteSize+1))
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+		if len(body) > maxQueuedWriteSize {
+			h.refuse(w)
+			return
+		}
+
+		position, err := h.failoverService.Enqueue(&models.QueuedWrite{
+			Method: r.Method,
+			URI:    r.URL.RequestURI(),
+			Header: r.Header.Clone(),
+			Body:   body,
+			Caller: requestCaller(r),
+		})
+		if err != nil {
+			if !errors.Is(err, services.ErrNotQueueing) {
+				log.Printf("write not queued: %v", err)
+			}
+			h.refuse(w)
+			return
+		}
+		respondWithJSON(w, http.StatusAccepted, map[string]interface{}{
+			"queued":          true,
+			"outbox_position": position,
+			"read_only":       true,
+			"request_id":      responseRequestID(w),
+		})
+	})
+}
+
+func (h *FailoverHandler) refuse(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(h.failoverService.RetryAfter().Seconds())))
+	respondWithJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+		"error":      services.ErrReadOnly.Error(),
+		"read_only":  true,
+		"request_id": responseRequestID(w),
+	})
+}
+
+// queueable reports whether a write may be held for replay
+func queueable(r *http.Request) bool {
+	route := mux.CurrentRoute(r)
+	if route == nil || r.Method != http.MethodPost {
+		return false
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return false
+	}
+	always, ok := queueableRoutes[template]
+	return ok && (always || r.Header.Get(idempotencyKeyHeader) != "")
+}
+
+func (h *FailoverHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, h.failoverService.Status())
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"reconciliation-service/internal/i18n"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/money"
+	"reconciliation-service/internal/repositories"
+	"reconciliation-service/internal/services"
+)
+
+type FeeHandler struct {
+	feeService *services.FeeService
+}
+
+func NewFeeHandler(feeService *services.FeeService) *FeeHandler {
+	return &FeeHandler{
+		feeService: feeService,
+	}
+}
+
+// feeScheduleRequest is the body of a create or update; a schedule is
+// active unless active is sent as false
+type feeScheduleRequest struct {
+	AccountNumber      string       `json:"account_number"`
+	Name               string       `json:"name"`
+	FeeType            string       `json:"fee_type"`
+	Amount             money.Amount `json:"amount"`
+	Currency           string       `json:"currency"`
+	Tolerance          money.Amount `json:"tolerance"`
+	DescriptionPattern string       `json:"description_pattern"`
+	Active             *bool        `json:"active"`
+	UserID             string       `json:"user_id"`
+}
+
+func (req feeScheduleRequest) schedule() *models.FeeSchedule {
+	schedule := &models.FeeSchedule{
+		AccountNumber:      req.AccountNumber,
+		Name:               req.Name,
+		FeeType:            req.FeeType,
+		Amount:             req.Amount,
+		Currency:           req.Currency,
+		Tolerance:          req.Tolerance,
+		DescriptionPattern: req.DescriptionPattern,
+		Active:             true,
+	}
+	if req.Active != nil {
+		schedule.Active = *req.Active
+	}
+	return schedule
+}
+
+func (h *FeeHandler) CreateSchedule(w http.ResponseWriter, r *http.Request) {
+	var req feeScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	created, err := h.feeService.CreateSchedule(req.schedule(), actingUser(r, req.UserID))
+	if err != nil {
+		respondWithFeeError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, created)
+}
+
+// ListSchedules lists the fee schedules, optionally of one account_number
+func (h *FeeHandler) ListSchedules(w http.ResponseWriter, r *http.Request) {
+	schedules, err := h.feeService.ListSchedules(r.URL.Query().Get("account_number"))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"fee_schedules": schedules,
+	})
+}
+
+func (h *FeeHandler) GetSchedule(w http.ResponseWriter, r *http.Request) {
+	id, ok := feeScheduleID(w, r)
+	if !ok {
+		return
+	}
+
+	schedule, err := h.feeService.GetSchedule(id)
+	if err != nil {
+		respondWithFeeError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, schedule)
+}
+
+func (h *FeeHandler) UpdateSchedule(w http.ResponseWriter, r *http.Request) {
+	id, ok := feeScheduleID(w, r)
+	if !ok {
+		return
+	}
+	var req feeScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	schedule := req.schedule()
+	schedule.ID = id
+
+	updated, err := h.feeService.UpdateSchedule(schedule, actingUser(r, req.UserID))
+	if err != nil {
+		respondWithFeeError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, updated)
+}
+
+func (h *FeeHandler) DeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	id, ok := feeScheduleID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.feeService.DeleteSchedule(id); err != nil {
+		respondWithFeeError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, SuccessResponse{Message: i18n.T(responseLocale(w), "Fee schedule deleted")})
+}
+
+// Expectations compares the fees each schedule expects in a period with
+// those charged. The period defaults to the previous month; exceptions=true
+// leaves out the fees that are as the contract says.
+func (h *FeeHandler) Expectations(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	period := query.Get("period")
+	if period == "" {
+		now := time.Now()
+		period = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, -1, 0).Format("2006-01")
+	}
+
+	expectations, err := h.feeService.Expectations(period)
+	if err != nil {
+		respondWithFeeError(w, err)
+		return
+	}
+	if query.Get("exceptions") == "true" {
+		exceptions := []*models.FeeExpectation{}
+		for _, expectation := range expectations {
+			if expectation.Status != models.FeeStatusOK {
+				exceptions = append(exceptions, expectation)
+			}
+		}
+		expectations = exceptions
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"period":       period,
+		"expectations": expectations,
+	})
+}
+
+func feeScheduleID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid fee schedule ID")
+		return 0, false
+	}
+	return id, true
+}
+
+func respondWithFeeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidFeeSchedule):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, repositories.ErrFeeScheduleNotFound):
+		respondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, repositories.ErrFeeScheduleConflict):
+		respondWithError(w, http.StatusConflict, err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
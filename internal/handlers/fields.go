@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var errInvalidFields = errors.New("fields must be a comma-separated list of field names")
+
+var fieldName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// fieldSelection is the set of fields a ?fields= query keeps in each record
+// of a response, by lower case name. A nil selection keeps them all.
+type fieldSelection map[string]bool
+
+// parseFields reads a fields query such as "id,amount,transaction_date".
+// Names match the JSON keys of a record whatever their case.
+func parseFields(value string) (fieldSelection, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	fields := make(fieldSelection)
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if !fieldName.MatchString(name) {
+			return nil, errInvalidFields
+		}
+		fields[strings.ToLower(name)] = true
+	}
+	return fields, nil
+}
+
+// requestFields parses the fields query of a request, answering 400 when it
+// is malformed
+func requestFields(w http.ResponseWriter, r *http.Request) (fieldSelection, bool) {
+	fields, err := parseFields(r.URL.Query().Get("fields"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	return fields, true
+}
+
+func (f fieldSelection) project(record map[string]interface{}) map[string]interface{} {
+	kept := make(map[string]interface{}, len(f))
+	for key, value := range record {
+		if f[strings.ToLower(key)] {
+			kept[key] = value
+		}
+	}
+	return kept
+}
+
+// respondWithFields answers with payload reduced to the selected fields. The
+// records are the objects in the payload's lists named by lists, or the
+// payload itself when none are named; the rest of the payload is kept whole.
+func respondWithFields(w http.ResponseWriter, code int, payload interface{}, fields fieldSelection, lists ...string) {
+	if fields == nil {
+		respondWithJSON(w, code, payload)
+		return
+	}
+
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var document map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	if err := decoder.Decode(&document); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if len(lists) == 0 {
+		respondWithJSON(w, code, fields.project(document))
+		return
+	}
+	for _, list := range lists {
+		records, _ := document[list].([]interface{})
+		for i, record := range records {
+			if object, ok := record.(map[string]interface{}); ok {
+				records[i] = fields.project(object)
+			}
+		}
+	}
+	respondWithJSON(w, code, document)
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"reconciliation-service/internal/services"
+)
+
+// Largest fixture bundle accepted for import
+const maxFixtureBundleSize = 256 << 20
+
+type FixtureHandler struct {
+	fixtureService *services.FixtureService
+}
+
+func NewFixtureHandler(fixtureService *services.FixtureService) *FixtureHandler {
+	return &FixtureHandler{
+		fixtureService: fixtureService,
+	}
+}
+
+// ExportFixture returns the records of a date range as an anonymized
+// fixture bundle, served as a download
+func (h *FixtureHandler) ExportFixture(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	fromDate, toDate := query.Get("from_date"), query.Get("to_date")
+	if fromDate == "" || toDate == "" {
+		respondWithError(w, http.StatusBadRequest, "Both from_date and to_date are required")
+		return
+	}
+	if _, err := time.Parse("2006-01-02", fromDate); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid from_date format. Use YYYY-MM-DD")
+		return
+	}
+	if _, err := time.Parse("2006-01-02", toDate); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid to_date format. Use YYYY-MM-DD")
+		return
+	}
+	jitter := services.DefaultFixtureJitter
+	if value := query.Get("jitter"); value != "" {
+		var err error
+		if jitter, err = strconv.ParseFloat(value, 64); err != nil {
+			respondWithError(w, http.StatusBadRequest, "jitter must be a number")
+			return
+		}
+	}
+
+	bundle, err := h.fixtureService.Export(fromDate, toDate, jitter)
+	if err != nil {
+		respondWithFixtureError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="fixture-%s-%s.json"`, fromDate, toDate))
+	respondWithJSON(w, http.StatusOK, bundle)
+}
+
+// ImportFixture loads the records of an exported bundle
+func (h *FixtureHandler) ImportFixture(w http.ResponseWriter, r *http.Request) {
+	var bundle services.FixtureBundle
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxFixtureBundleSize)).Decode(&bundle); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	result, err := h.fixtureService.Import(&bundle)
+	if err != nil {
+		respondWithFixtureError(w, err)
+		return
+	}
+
+	status := http.StatusOK
+	if !result.BankTransactions.Success || !result.AccountingEntries.Success {
+		status = http.StatusPartialContent
+	}
+	respondWithJSON(w, status, result)
+}
+
+// respondWithFixtureError maps fixture errors; loading where it is not
+// enabled is a 403
+func respondWithFixtureError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidFixture):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrFixtureImportDisabled):
+		respondWithError(w, http.StatusForbidden, err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
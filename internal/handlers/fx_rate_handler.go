@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/services"
+)
+
+type FXRateHandler struct {
+	fxRateService *services.FXRateService
+}
+
+func NewFXRateHandler(fxRateService *services.FXRateService) *FXRateHandler {
+	return &FXRateHandler{
+		fxRateService: fxRateService,
+	}
+}
+
+type fxRateRequest struct {
+	FromCurrency string      `json:"from_currency"`
+	ToCurrency   string      `json:"to_currency"`
+	Rate         json.Number `json:"rate"`
+	RateDate     string      `json:"rate_date"`
+	UserID       string      `json:"user_id"`
+}
+
+// SaveRate stores the rate of a currency pair for a day. The rate may be sent
+// as a JSON number or as decimal text.
+func (h *FXRateHandler) SaveRate(w http.ResponseWriter, r *http.Request) {
+	var req fxRateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	rate, err := h.fxRateService.SaveRate(&models.FXRate{
+		FromCurrency: req.FromCurrency,
+		ToCurrency:   req.ToCurrency,
+		Rate:         req.Rate.String(),
+		RateDate:     req.RateDate,
+	}, actingUser(r, req.UserID))
+	if err != nil {
+		respondWithFXRateError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, rate)
+}
+
+// ListRates lists stored rates, optionally filtered by from_currency and
+// to_currency
+func (h *FXRateHandler) ListRates(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	rates, err := h.fxRateService.ListRates(query.Get("from_currency"), query.Get("to_currency"))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"fx_rates": rates,
+	})
+}
+
+func respondWithFXRateError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidFXRate):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/pagination"
+	"reconciliation-service/internal/services"
+)
+
+type IngestionFileHandler struct {
+	fetchService       *services.StatementFetchService
+	objectFetchService *services.ObjectFetchService
+	emailService       *services.EmailIngestionService
+}
+
+func NewIngestionFileHandler(fetchService *services.StatementFetchService, objectFetchService *services.ObjectFetchService, emailService *services.EmailIngestionService) *IngestionFileHandler {
+	return &IngestionFileHandler{
+		fetchService:       fetchService,
+		objectFetchService: objectFetchService,
+		emailService:       emailService,
+	}
+}
+
+// Fetch polls the SFTP directories now, instead of waiting for the next poll
+func (h *IngestionFileHandler) Fetch(w http.ResponseWriter, r *http.Request) {
+	result, err := h.fetchService.Fetch(requestCaller(r))
+	if err != nil {
+		respondWithIngestionFileError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, result)
+}
+
+type objectFetchRequest struct {
+	Bucket string `json:"bucket"`
+	Prefix string `json:"prefix"`
+}
+
+// FetchObjects pulls new objects below a bucket prefix now, or every
+// configured source when the body names no bucket
+func (h *IngestionFileHandler) FetchObjects(w http.ResponseWriter, r *http.Request) {
+	var req objectFetchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	var result *services.FetchResult
+	var err error
+	if req.Bucket == "" && req.Prefix == "" {
+		result, err = h.objectFetchService.Fetch(requestCaller(r))
+	} else {
+		result, err = h.objectFetchService.FetchPrefix(req.Bucket, req.Prefix, requestCaller(r))
+	}
+	if err != nil {
+		respondWithIngestionFileError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, result)
+}
+
+// ListFiles lists fetched statement files newest first, optionally of one
+// status
+func (h *IngestionFileHandler) ListFiles(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, err := intQuery(query.Get("limit"), 0)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "limit must be a number")
+		return
+	}
+
+	files, next, err := h.fetchService.ListFiles(query.Get("status"), query.Get("cursor"), limit)
+	if err != nil {
+		respondWithIngestionFileError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, withNextCursor(map[string]interface{}{
+		"files": files,
+	}, next))
+}
+
+// ReceiveEmail ingests the statements attached to an email the email
+// provider forwards, raw and signed in X-Email-Signature. It answers 503
+// when an attachment failed for a reason that may pass, so the provider
+// delivers the email again.
+func (h *IngestionFileHandler) ReceiveEmail(w http.ResponseWriter, r *http.Request) {
+	// Routed ahead of the API, so without its JSON content type middleware
+	w.Header().Set("Content-Type", "application/json")
+	raw, err := io.ReadAll(io.LimitReader(r.Body, services.MaxEmailSize+1))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Failed to read the email")
+		return
+	}
+
+	email, err := h.emailService.Receive(raw, r.Header.Get("X-Email-Signature"))
+	switch {
+	case errors.Is(err, services.ErrEmailSignature):
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	case errors.Is(err, services.ErrEmailRefused):
+		respondWithError(w, http.StatusForbidden, err.Error())
+		return
+	case errors.Is(err, services.ErrInvalidEmail):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, services.ErrEmailDisabled):
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	case errors.Is(err, services.ErrEmailPaused):
+		respondWithError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	case err != nil:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	status := http.StatusOK
+	for _, attachment := range email.Attachments {
+		if attachment.Status == models.IngestionFileFailed {
+			status = http.StatusServiceUnavailable
+		}
+	}
+	respondWithJSON(w, status, email)
+}
+
+// ListEmails lists received statement emails newest first, optionally of
+// one status
+func (h *IngestionFileHandler) ListEmails(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, err := intQuery(query.Get("limit"), 0)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "limit must be a number")
+		return
+	}
+
+	emails, next, err := h.emailService.ListEmails(query.Get("status"), query.Get("cursor"), limit)
+	if err != nil {
+		respondWithIngestionFileError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, withNextCursor(map[string]interface{}{
+		"emails": emails,
+	}, next))
+}
+
+// respondWithIngestionFileError maps fetch errors; a fetch already running
+// is a 409 and one with no server configured a 503
+func respondWithIngestionFileError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidIngestionFiles), errors.Is(err, pagination.ErrInvalidCursor):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrFetchRunning):
+		respondWithError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrFetchDisabled):
+		respondWithError(w, http.StatusServiceUnavailable, err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"reconciliation-service/internal/pagination"
+	"reconciliation-service/internal/repositories"
+	"reconciliation-service/internal/services"
+)
+
+type IntegrityHandler struct {
+	integrityService *services.IntegrityService
+}
+
+func NewIntegrityHandler(integrityService *services.IntegrityService) *IntegrityHandler {
+	return &IntegrityHandler{
+		integrityService: integrityService,
+	}
+}
+
+// Check runs the integrity checker now, instead of waiting for its next run
+func (h *IntegrityHandler) Check(w http.ResponseWriter, r *http.Request) {
+	run, err := h.integrityService.Check(requestCaller(r))
+	if err != nil {
+		respondWithIntegrityError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, run)
+}
+
+// ListRuns lists the latest integrity runs with what each found
+func (h *IntegrityHandler) ListRuns(w http.ResponseWriter, r *http.Request) {
+	limit, err := intQuery(r.URL.Query().Get("limit"), 0)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "limit must be a number")
+		return
+	}
+
+	runs, next, err := h.integrityService.ListRuns(r.URL.Query().Get("cursor"), limit)
+	if err != nil {
+		respondWithIntegrityError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, withNextCursor(map[string]interface{}{
+		"runs": runs,
+	}, next))
+}
+
+// ListFindings lists findings newest first, optionally of one run, kind or
+// status
+func (h *IntegrityHandler) ListFindings(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, err := intQuery(query.Get("limit"), 0)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "limit must be a number")
+		return
+	}
+	runID, err := int64Query(query.Get("run_id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "run_id must be a number")
+		return
+	}
+
+	findings, next, err := h.integrityService.ListFindings(runID, query.Get("kind"), query.Get("status"), query.Get("cursor"), limit)
+	if err != nil {
+		respondWithIntegrityError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, withNextCursor(map[string]interface{}{
+		"findings": findings,
+	}, next))
+}
+
+type integrityRepairRequest struct {
+	UserID string `json:"user_id"`
+}
+
+// RepairFinding applies the repair of an open finding
+func (h *IntegrityHandler) RepairFinding(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid finding ID")
+		return
+	}
+	var req integrityRepairRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	finding, err := h.integrityService.RepairFinding(id, actingUser(r, req.UserID))
+	if err != nil {
+		respondWithIntegrityError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, finding)
+}
+
+// respondWithIntegrityError maps integrity errors; a finding no longer open
+// or a reconciliation changed meanwhile is a 409 and held data a 423
+func respondWithIntegrityError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidIntegrity), errors.Is(err, pagination.ErrInvalidCursor):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, repositories.ErrIntegrityFindingNotFound):
+		respondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, repositories.ErrIntegrityFindingClosed),
+		errors.Is(err, repositories.ErrVersionConflict),
+		errors.Is(err, services.ErrNothingToUnmatch),
+		errors.Is(err, services.ErrSettledLater):
+		respondWithError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrLegalHold):
+		respondWithError(w, http.StatusLocked, err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
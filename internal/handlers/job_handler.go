@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"reconciliation-service/internal/pagination"
+	"reconciliation-service/internal/repositories"
+	"reconciliation-service/internal/services"
+)
+
+type JobHandler struct {
+	jobService       *services.JobService
+	heartbeatService *services.HeartbeatService
+}
+
+func NewJobHandler(jobService *services.JobService, heartbeatService *services.HeartbeatService) *JobHandler {
+	return &JobHandler{
+		jobService:       jobService,
+		heartbeatService: heartbeatService,
+	}
+}
+
+func (h *JobHandler) ListJobs(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+	jobs, next, err := h.jobService.ListJobs(status, r.URL.Query().Get("cursor"), limit)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, withNextCursor(map[string]interface{}{
+		"jobs":     jobs,
+		"draining": h.jobService.Draining(),
+	}, next))
+}
+
+func (h *JobHandler) GetJob(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid job ID")
+		return
+	}
+
+	job, err := h.jobService.GetJob(id)
+	if errors.Is(err, repositories.ErrJobNotFound) {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, job)
+}
+
+// GetStuckJobs lists the running jobs whose instance stopped beating for them
+func (h *JobHandler) GetStuckJobs(w http.ResponseWriter, r *http.Request) {
+	stuck, err := h.heartbeatService.StuckJobs()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, stuck)
+}
+
+// ListWorkers lists the background workers of every instance with their last
+// heartbeat
+func (h *JobHandler) ListWorkers(w http.ResponseWriter, r *http.Request) {
+	workers, err := h.heartbeatService.Workers()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"workers": workers,
+	})
+}
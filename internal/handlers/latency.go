@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"reconciliation-service/internal/i18n"
+)
+
+// latencyBudgets maps "METHOD /path/template" (the route's template without
+// the /api/v1 prefix) to its deadline; other routes get fallback
+type latencyBudgets struct {
+	fallback time.Duration
+	routes   map[string]time.Duration
+}
+
+func (b latencyBudgets) budget(r *http.Request) (string, time.Duration) {
+	route := r.URL.Path
+	if current := mux.CurrentRoute(r); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			route = template
+		}
+	}
+	key := r.Method + " " + strings.TrimPrefix(route, "/api/v1")
+	if budget, ok := b.routes[key]; ok {
+		return key, budget
+	}
+	return key, b.fallback
+}
+
+type progressKey struct{}
+
+// requestProgress collects what a handler got done, reported when the
+// request runs out of its budget
+type requestProgress struct {
+	mu     sync.Mutex
+	fields map[string]interface{}
+}
+
+// reportProgress records a step of the request's work for the 504 response
+func reportProgress(r *http.Request, key string, value interface{}) {
+	progressReporter(r)(key, value)
+}
+
+// progressReporter returns reportProgress bound to the progress of r, for
+// work that may outlive the request
+func progressReporter(r *http.Request) func(key string, value interface{}) {
+	progress, ok := r.Context().Value(progressKey{}).(*requestProgress)
+	if !ok {
+		return func(string, interface{}) {}
+	}
+	return func(key string, value interface{}) {
+		progress.mu.Lock()
+		defer progress.mu.Unlock()
+		progress.fields[key] = value
+	}
+}
+
+func (p *requestProgress) snapshot() map[string]interface{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fields := make(map[string]interface{}, len(p.fields))
+	for key, value := range p.fields {
+		fields[key] = value
+	}
+	return fields
+}
+
+// budgetWriter buffers a response so it can be dropped in favour of the 504
+// once the deadline has passed
+type budgetWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	body     bytes.Buffer
+	code     int
+	timedOut bool
+}
+
+func (w *budgetWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *budgetWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut || w.code != 0 {
+		return
+	}
+	w.code = code
+}
+
+func (w *budgetWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.body.Write(data)
+}
+
+// latencyMiddleware gives every request the deadline of its route through
+// its context. A handler still running at the deadline is answered with 504
+// and the progress it reported; its later writes are discarded.
+func latencyMiddleware(budgets latencyBudgets) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route, budget := budgets.budget(r)
+			if budget <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), budget)
+			defer cancel()
+			progress := &requestProgress{fields: make(map[string]interface{})}
+			ctx = context.WithValue(ctx, progressKey{}, progress)
+			r = r.WithContext(ctx)
+
+			// Headers set by earlier middleware, such as Content-Language,
+			// stay visible to the handler
+			bw := &budgetWriter{header: w.Header().Clone()}
+			done := make(chan struct{})
+			panicked := make(chan interface{}, 1)
+			started := time.Now()
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicked <- p
+					}
+				}()
+				next.ServeHTTP(bw, r)
+				close(done)
+			}()
+
+			select {
+			case p := <-panicked:
+				panic(p)
+			case <-done:
+				bw.mu.Lock()
+				defer bw.mu.Unlock()
+				for key, values := range bw.header {
+					w.Header()[key] = values
+				}
+				if bw.code == 0 {
+					bw.code = http.StatusOK
+				}
+				w.WriteHeader(bw.code)
+				w.Write(bw.body.Bytes())
+			case <-ctx.Done():
+				bw.mu.Lock()
+				bw.timedOut = true
+				bw.mu.Unlock()
+				respondWithJSON(w, http.StatusGatewayTimeout, map[string]interface{}{
+					"error":      i18n.T(responseLocale(w), "Request exceeded its latency budget"),
+					"route":      route,
+					"budget_ms":  budget.Milliseconds(),
+					"elapsed_ms": time.Since(started).Milliseconds(),
+					"progress":   progress.snapshot(),
+					"request_id": responseRequestID(w),
+				})
+			}
+		})
+	}
+}
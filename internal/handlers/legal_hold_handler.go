@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/pagination"
+	"reconciliation-service/internal/repositories"
+	"reconciliation-service/internal/services"
+)
+
+type LegalHoldHandler struct {
+	legalHoldService *services.LegalHoldService
+}
+
+func NewLegalHoldHandler(legalHoldService *services.LegalHoldService) *LegalHoldHandler {
+	return &LegalHoldHandler{
+		legalHoldService: legalHoldService,
+	}
+}
+
+type legalHoldRequest struct {
+	Scope   string `json:"scope"`
+	ScopeID string `json:"scope_id"`
+	Reason  string `json:"reason"`
+	UserID  string `json:"user_id"`
+}
+
+func (h *LegalHoldHandler) PlaceHold(w http.ResponseWriter, r *http.Request) {
+	var req legalHoldRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	hold := &models.LegalHold{Scope: req.Scope, ScopeID: req.ScopeID, Reason: req.Reason}
+	created, err := h.legalHoldService.PlaceHold(hold, actingUser(r, req.UserID))
+	if err != nil {
+		respondWithLegalHoldError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, created)
+}
+
+func (h *LegalHoldHandler) ListHolds(w http.ResponseWriter, r *http.Request) {
+	holds, err := h.legalHoldService.ListHolds()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"holds": holds,
+	})
+}
+
+func (h *LegalHoldHandler) GetHold(w http.ResponseWriter, r *http.Request) {
+	id, ok := legalHoldID(w, r)
+	if !ok {
+		return
+	}
+
+	hold, err := h.legalHoldService.GetHold(id)
+	if err != nil {
+		respondWithLegalHoldError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, hold)
+}
+
+// LiftHold releases a hold and returns it as it was. The caller is taken
+// from the user_id query parameter when authentication is off.
+func (h *LegalHoldHandler) LiftHold(w http.ResponseWriter, r *http.Request) {
+	id, ok := legalHoldID(w, r)
+	if !ok {
+		return
+	}
+
+	hold, err := h.legalHoldService.LiftHold(id, actingUser(r, r.URL.Query().Get("user_id")))
+	if err != nil {
+		respondWithLegalHoldError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, hold)
+}
+
+// ListAudit lists the latest placements and lifts of holds, of one hold when
+// hold_id is given
+func (h *LegalHoldHandler) ListAudit(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var holdID int64
+	if value := query.Get("hold_id"); value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid legal hold ID")
+			return
+		}
+		holdID = id
+	}
+	limit, err := intQuery(query.Get("limit"), 0)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "limit must be a number")
+		return
+	}
+
+	entries, next, err := h.legalHoldService.ListAudit(holdID, query.Get("cursor"), limit)
+	if err != nil {
+		respondWithLegalHoldError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, withNextCursor(map[string]interface{}{
+		"audit": entries,
+	}, next))
+}
+
+func legalHoldID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid legal hold ID")
+		return 0, false
+	}
+	return id, true
+}
+
+func respondWithLegalHoldError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidLegalHold), errors.Is(err, pagination.ErrInvalidCursor):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, repositories.ErrLegalHoldNotFound):
+		respondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, repositories.ErrLegalHoldConflict):
+		respondWithError(w, http.StatusConflict, err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// clientRequestID is the shape of a caller's X-Request-ID the service adopts;
+// anything else is replaced so it cannot forge log lines
+var clientRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// requestIDMiddleware gives every request an ID, the caller's X-Request-ID
+// when it sends a usable one, and echoes it in the response header, which
+// the request log and error responses read back
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !clientRequestID.MatchString(id) {
+			id = newRequestID()
+			r.Header.Set(requestIDHeader, id)
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// responseRequestID returns the ID requestIDMiddleware gave the request
+func responseRequestID(w http.ResponseWriter) string {
+	return w.Header().Get(requestIDHeader)
+}
+
+type logEntryKey struct{}
+
+// logEntry carries what the request log learns inside the handler chain,
+// such as the caller authMiddleware identifies
+type logEntry struct {
+	caller string
+}
+
+// logCaller names the caller of the request in its log line
+func logCaller(r *http.Request, caller string) {
+	if entry, ok := r.Context().Value(logEntryKey{}).(*logEntry); ok {
+		entry.caller = caller
+	}
+}
+
+// statusWriter records the status and size of a response
+type statusWriter struct {
+	http.ResponseWriter
+	code  int
+	bytes int64
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(data []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(data)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// loggingMiddleware writes a structured line for every answered request:
+// server errors at error level, client errors at warn, the rest at info
+func loggingMiddleware(logger *slog.Logger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			entry := &logEntry{}
+			sw := &statusWriter{ResponseWriter: w}
+			started := time.Now()
+			next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), logEntryKey{}, entry)))
+			if sw.code == 0 {
+				sw.code = http.StatusOK
+			}
+
+			level := slog.LevelInfo
+			switch {
+			case sw.code >= http.StatusInternalServerError:
+				level = slog.LevelError
+			case sw.code >= http.StatusBadRequest:
+				level = slog.LevelWarn
+			}
+			if !logger.Enabled(r.Context(), level) {
+				return
+			}
+
+			route := r.URL.Path
+			if current := mux.CurrentRoute(r); current != nil {
+				if template, err := current.GetPathTemplate(); err == nil {
+					route = template
+				}
+			}
+			caller := entry.caller
+			if caller == "" {
+				caller = usageEntity(r)
+			}
+			logger.LogAttrs(r.Context(), level, "request",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("route", route),
+				slog.Int("status", sw.code),
+				slog.Float64("latency_ms", float64(time.Since(started).Microseconds())/1000),
+				slog.Int64("bytes", sw.bytes),
+				slog.String("request_id", responseRequestID(w)),
+				slog.String("caller", caller),
+				slog.String("remote_addr", r.RemoteAddr),
+			)
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"reconciliation-service/internal/services"
+)
+
+type MaintenanceHandler struct {
+	maintenanceService *services.MaintenanceService
+}
+
+func NewMaintenanceHandler(maintenanceService *services.MaintenanceService) *MaintenanceHandler {
+	return &MaintenanceHandler{
+		maintenanceService: maintenanceService,
+	}
+}
+
+// MaintenanceMiddleware lets reads through and answers writes with 503 while
+// maintenance mode is on. The admin switch itself stays reachable.
+func (h *MaintenanceHandler) MaintenanceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isReadOnlyMethod(r.Method) || r.URL.Path == "/api/v1/admin/maintenance" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		mode, err := h.maintenanceService.GetMode()
+		if err != nil || !mode.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Retry-After", strconv.Itoa(mode.RetryAfterSeconds))
+		respondWithJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"error":       mode.Message,
+			"maintenance": true,
+			"request_id":  responseRequestID(w),
+		})
+	})
+}
+
+func isReadOnlyMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+func (h *MaintenanceHandler) GetMaintenanceMode(w http.ResponseWriter, r *http.Request) {
+	mode, err := h.maintenanceService.GetMode()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, mode)
+}
+
+type maintenanceRequest struct {
+	Enabled           bool   `json:"enabled"`
+	Message           string `json:"message"`
+	RetryAfterSeconds int    `json:"retry_after_seconds"`
+	UpdatedBy         string `json:"updated_by"`
+}
+
+func (h *MaintenanceHandler) SetMaintenanceMode(w http.ResponseWriter, r *http.Request) {
+	var request maintenanceRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	mode, err := h.maintenanceService.SetMode(request.Enabled, request.Message, request.RetryAfterSeconds, actingUser(r, request.UpdatedBy))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, mode)
+}
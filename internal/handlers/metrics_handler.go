@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"reconciliation-service/internal/metrics"
+	"reconciliation-service/internal/services"
+)
+
+type MetricsHandler struct {
+	metricsService *services.OperatorMetricsService
+}
+
+func NewMetricsHandler(metricsService *services.OperatorMetricsService) *MetricsHandler {
+	return &MetricsHandler{
+		metricsService: metricsService,
+	}
+}
+
+// GetMetrics serves the operator backlog of every tenant in the Prometheus
+// text format. With METRICS_TOKEN set, the scrape must carry it as a bearer
+// token.
+func (h *MetricsHandler) GetMetrics(w http.ResponseWriter, r *http.Request) {
+	token, _ := bearerToken(r)
+	if err := h.metricsService.Authorize(token); err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", metrics.ContentType)
+	w.WriteHeader(http.StatusOK)
+	if err := metrics.Write(w, h.metricsService.Collect()); err != nil {
+		log.Printf("Failed to write metrics: %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"reconciliation-service/internal/i18n"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+	"reconciliation-service/internal/services"
+)
+
+type NotificationHandler struct {
+	notificationService *services.NotificationService
+}
+
+func NewNotificationHandler(notificationService *services.NotificationService) *NotificationHandler {
+	return &NotificationHandler{
+		notificationService: notificationService,
+	}
+}
+
+func (h *NotificationHandler) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	prefs, err := h.notificationService.GetPreferences(mux.Vars(r)["user_id"])
+	if err != nil {
+		respondWithNotificationError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, prefs)
+}
+
+func (h *NotificationHandler) SavePreferences(w http.ResponseWriter, r *http.Request) {
+	var prefs models.NotificationPreferences
+	if err := json.NewDecoder(r.Body).Decode(&prefs); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	prefs.UserID = mux.Vars(r)["user_id"]
+
+	saved, err := h.notificationService.SavePreferences(&prefs)
+	if err != nil {
+		respondWithNotificationError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, saved)
+}
+
+func (h *NotificationHandler) DeletePreferences(w http.ResponseWriter, r *http.Request) {
+	if err := h.notificationService.DeletePreferences(mux.Vars(r)["user_id"]); err != nil {
+		respondWithNotificationError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, SuccessResponse{Message: i18n.T(responseLocale(w), "Notification preferences deleted")})
+}
+
+// GetRoutes shows who would receive an event, for checking preferences
+func (h *NotificationHandler) GetRoutes(w http.ResponseWriter, r *http.Request) {
+	eventType := r.URL.Query().Get("event_type")
+	if eventType == "" {
+		respondWithError(w, http.StatusBadRequest, "event_type query parameter is required")
+		return
+	}
+
+	routes, err := h.notificationService.Routes(eventType)
+	if err != nil {
+		respondWithNotificationError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"event_type": eventType,
+		"routes":     routes,
+	})
+}
+
+type dispatchRequest struct {
+	EventType string `json:"event_type"`
+	Entity    string `json:"entity"`
+}
+
+// Dispatch is called by a sender before delivering an event for an entity.
+// It answers the routes to deliver to, or sent false when the occurrence is a
+// repeat inside the dedup window.
+func (h *NotificationHandler) Dispatch(w http.ResponseWriter, r *http.Request) {
+	var req dispatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	dispatch, err := h.notificationService.Dispatch(req.EventType, req.Entity)
+	if err != nil {
+		respondWithNotificationError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, dispatch)
+}
+
+func respondWithNotificationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidPreferences):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, repositories.ErrPreferencesNotFound):
+		respondWithError(w, http.StatusNotFound, err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,1170 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+
+	"reconciliation-service/internal/ingestion/charset"
+	"reconciliation-service/internal/ingestion/detect"
+	"reconciliation-service/internal/matching"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/openapi"
+	"reconciliation-service/internal/services"
+)
+
+const (
+	apiPrefix       = "/api/v1"
+	openAPIPath     = apiPrefix + "/openapi.json"
+	swaggerUIPath   = apiPrefix + "/docs"
+	openAPITitle    = "Reconciliation Service API"
+	openAPIRevision = "1.0.0"
+)
+
+// apiOperation documents a route of the API. The router supplies the paths,
+// methods and path parameters; everything else about an operation is here.
+type apiOperation struct {
+	Summary string
+	// Role is the least role the route requires, empty when any caller may
+	// use it
+	Role string
+	// Query lists the query parameters as name:type, type being one of
+	// string, integer, number, boolean, date or month; a trailing ! marks a
+	// required one
+	Query []string
+	// Guarded routes need the confirmation token in production
+	Guarded bool
+	// Idempotent routes take an Idempotency-Key header
+	Idempotent bool
+	// Conditional routes take If-None-Match when they read, answering 304,
+	// and If-Match when they change, answering 412
+	Conditional bool
+
+	// Body is a value of the type the request body decodes into, in JSON
+	// unless BodyType names another media type
+	Body     interface{}
+	BodyType string
+
+	// Status is the success status, 200 when zero. Response is a value of
+	// the type encoded in the response body, in JSON unless ResponseType
+	// names another media type.
+	Status       int
+	Response     interface{}
+	ResponseType string
+	// Accepted is a value of the type answered with 202 when the route hands
+	// its work off to a job instead of finishing it
+	Accepted interface{}
+}
+
+var (
+	deletedResponse = SuccessResponse{}
+	listingByDate   = []string{"from_date:date!", "to_date:date!"}
+)
+
+// apiOperations documents every route by method and path, the path relative
+// to /api/v1 with its parameters stripped of their patterns
+var apiOperations = map[string]apiOperation{
+	// Reconciliation
+	"POST /reconciliation/start": {
+		Summary: "Reconcile a date range inline", Role: models.RoleOperator, Idempotent: true,
+		Body: startReconciliationRequest{}, Response: services.ReconciliationResult{},
+		Accepted: startHandoff{},
+	},
+	"GET /reconciliation/{batch_id}/status": {
+		Summary: "Get the result of a batch", Role: models.RoleViewer, Conditional: true,
+		Response: services.ReconciliationResult{},
+	},
+	"POST /reconciliation/{batch_id}/resolve": {
+		Summary: "Resolve a disputed batch", Role: models.RoleOperator, Conditional: true,
+		Body:     map[string]interface{}{},
+		Response: openapi.Fields("message", "", "batch_id", ""),
+	},
+	"GET /reconciliation/{batch_id}/results": {
+		Summary: "Page through the matches or unmatched items of a batch", Role: models.RoleViewer, Conditional: true,
+		Query:    []string{"kind:string", "page:integer", "page_size:integer", "cursor:string", "fields:string"},
+		Response: services.ResultPage{},
+	},
+	"GET /reconciliation/{batch_id}/details": {
+		Summary: "Get a batch as it stands now", Role: models.RoleViewer, Conditional: true,
+		Response: services.BatchDetails{},
+	},
+	"GET /reconciliation/{batch_id}/deltas": {
+		Summary: "List the manual changes to a batch", Role: models.RoleViewer,
+		Response: []*models.BatchDelta{},
+	},
+	"GET /reconciliation/{batch_id}/audit": {
+		Summary: "List the audit trail of a batch", Role: models.RoleViewer,
+		Query: []string{
+			"user_id:string", "action:string", "from:date", "to:date",
+			"before_id:integer", "cursor:string", "limit:integer",
+		},
+		Response: openapi.Fields("audit", []*models.AuditTrailEntry{}, "next_cursor", ""),
+	},
+	"GET /audit": {
+		Summary: "Search the audit trail of every batch", Role: models.RoleViewer,
+		Query: []string{
+			"user_id:string", "action:string", "from:date", "to:date",
+			"before_id:integer", "cursor:string", "limit:integer",
+		},
+		Response: openapi.Fields("audit", []*models.AuditTrailEntry{}, "next_cursor", ""),
+	},
+	"GET /reconciliation/{batch_id}/report": {
+		Summary: "Download a batch report, or export it in the background", Role: models.RoleViewer,
+		Query:        []string{"format:string", "async:boolean", "callback_url:string"},
+		Response:     []byte{},
+		ResponseType: "application/octet-stream",
+	},
+	"GET /reconciliation/{batch_id}/shadow": {
+		Summary: "List the shadow runs of a batch", Role: models.RoleViewer,
+		Response: openapi.Fields("shadow_runs", []*models.ShadowRun{}),
+	},
+	"POST /reconciliation/matches/{id}/unmatch": {
+		Summary: "Undo a match", Role: models.RoleOperator, Guarded: true, Conditional: true,
+		Body: unmatchRequest{}, Response: models.Reconciliation{},
+	},
+	"GET /reconciliation/pending-review": {
+		Summary: "List matches pending review", Role: models.RoleViewer,
+		Query:    []string{"batch_id:string", "cursor:string", "limit:integer"},
+		Response: openapi.Fields("matches", []*services.PendingMatch{}, "next_cursor", ""),
+	},
+	"GET /reconciliation/stats": {
+		Summary: "Summarize how the bank transactions of a date range were reconciled", Role: models.RoleViewer,
+		Query:    []string{"from_date:string", "to_date:string"},
+		Response: models.ReconciliationStats{},
+	},
+	"POST /reconciliation/matches/review": {
+		Summary: "Approve or reject several matches pending review", Role: models.RoleOperator,
+		Body:     bulkReviewRequest{},
+		Response: openapi.Fields("decision", "", "results", []*services.ReviewOutcome{}),
+	},
+	"POST /reconciliation/matches/{id}/approve": {
+		Summary: "Approve a match pending review", Role: models.RoleOperator,
+		Body: reviewRequest{}, Response: models.Reconciliation{},
+	},
+	"POST /reconciliation/matches/{id}/reject": {
+		Summary: "Reject a match pending review", Role: models.RoleOperator,
+		Body: reviewRequest{}, Response: models.Reconciliation{},
+	},
+	"GET /reconciliation/unmatched": {
+		Summary: "List the records left unmatched in a date range", Role: models.RoleViewer,
+		Query:    []string{"from_date:date!", "to_date:date!", "fields:string"},
+		Response: map[string]interface{}{},
+	},
+	"POST /reconciliation/unmatched/bulk-action": {
+		Summary: "Assign, hold, release, tag or set the reason code of unmatched records in bulk", Role: models.RoleOperator,
+		Body: unmatchedBulkActionRequest{}, Response: services.BulkActionResult{},
+	},
+	"GET /reconciliation/suggestions": {
+		Summary: "Suggest accounts for unmatched bank transactions", Role: models.RoleViewer,
+		Query:    listingByDate,
+		Response: openapi.Fields("from_date", "", "to_date", "", "suggestions", []*services.BankSuggestion{}),
+	},
+	"POST /reconciliation/queue": {
+		Summary: "Queue a reconciliation", Role: models.RoleOperator,
+		Body: enqueueRequest{}, Status: http.StatusAccepted, Response: models.ReconciliationJob{},
+	},
+	"POST /reconciliation/partitioned": {
+		Summary: "Start a reconciliation split into partitions", Role: models.RoleOperator,
+		Body: partitionedRunRequest{}, Status: http.StatusAccepted, Response: services.PartitionedRun{},
+	},
+	"GET /reconciliation/partitioned/{batch_id}": {
+		Summary: "Get the progress of a partitioned run", Role: models.RoleViewer,
+		Response: services.PartitionedRun{},
+	},
+
+	// Ingestion
+	"POST /data/bank-transactions": {
+		Summary: "Ingest bank transactions", Role: models.RoleOperator,
+		Query: []string{"partial_commit:boolean"},
+		Body:  []services.BankTransactionInput{}, Response: services.IngestionResult{},
+	},
+	"POST /data/bank-statements": {
+		Summary: "Ingest a statement file of any supported format", Role: models.RoleOperator,
+		Query: []string{"encoding:string", "partial_commit:boolean"},
+		Body:  "", BodyType: "application/octet-stream",
+		Response: services.IngestionResult{},
+	},
+	"POST /data/bank-statements/detect": {
+		Summary: "Detect the encoding and format of a statement file", Role: models.RoleOperator,
+		Query: []string{"encoding:string"},
+		Body:  "", BodyType: "application/octet-stream",
+		Response: struct {
+			detect.Detection
+			Ingestible bool            `json:"ingestible"`
+			Encoding   *charset.Result `json:"encoding"`
+		}{},
+	},
+	"POST /data/bank-statements/mt940": {
+		Summary: "Ingest an MT940 statement", Role: models.RoleOperator,
+		Query: []string{"encoding:string", "partial_commit:boolean"},
+		Body:  "", BodyType: "text/plain",
+		Response: services.IngestionResult{},
+	},
+	"POST /data/bank-statements/camt053": {
+		Summary: "Ingest a camt.053 statement", Role: models.RoleOperator,
+		Query: []string{"encoding:string", "partial_commit:boolean"},
+		Body:  "", BodyType: "application/xml",
+		Response: services.IngestionResult{},
+	},
+	"POST /data/accounting-entries": {
+		Summary: "Ingest accounting entries", Role: models.RoleOperator,
+		Query: []string{"partial_commit:boolean"},
+		Body:  []services.AccountingEntryInput{}, Response: services.IngestionResult{},
+	},
+	"GET /data/bank-transactions/{id}": {
+		Summary: "Get a bank transaction", Role: models.RoleViewer,
+		Query:    []string{"fields:string"},
+		Response: models.BankTransaction{},
+	},
+	"PUT /data/bank-transactions/{id}": {
+		Summary: "Correct a bank transaction", Role: models.RoleOperator,
+		Body: bankTransactionCorrection{}, Response: models.BankTransaction{},
+	},
+	"GET /data/accounting-entries/{id}": {
+		Summary: "Get an accounting entry", Role: models.RoleViewer,
+		Query:    []string{"fields:string"},
+		Response: models.AccountingEntry{},
+	},
+	"PUT /data/accounting-entries/{id}": {
+		Summary: "Correct an accounting entry", Role: models.RoleOperator,
+		Body: accountingEntryCorrection{}, Response: models.AccountingEntry{},
+	},
+	"POST /data/bank-transactions/{id}/void": {
+		Summary: "Void a bank transaction, unmatching its reconciliations", Role: models.RoleOperator,
+		Body: voidRequest{}, Response: models.BankTransaction{},
+	},
+	"POST /data/accounting-entries/{id}/void": {
+		Summary: "Void an accounting entry, unmatching its reconciliations", Role: models.RoleOperator,
+		Body: voidRequest{}, Response: models.AccountingEntry{},
+	},
+	"GET /data/correlations/{correlation_id}": {
+		Summary: "Find the records and reconciliations of an upstream payment ID", Role: models.RoleViewer,
+		Response: models.CorrelationLookup{},
+	},
+
+	// Snapshots
+	"POST /snapshots": {
+		Summary: "Take a period-end snapshot", Role: models.RoleOperator,
+		Body: snapshotRequest{}, Status: http.StatusCreated, Response: models.ReconciliationSnapshot{},
+	},
+	"GET /snapshots": {
+		Summary: "List snapshots", Role: models.RoleViewer,
+		Query:    []string{"from_date:date", "to_date:date"},
+		Response: openapi.Fields("snapshots", []*models.ReconciliationSnapshot{}),
+	},
+	"GET /snapshots/{snapshot_id}": {
+		Summary: "Get a snapshot", Role: models.RoleViewer,
+		Response: models.ReconciliationSnapshot{},
+	},
+	"GET /snapshots/{snapshot_id}/journal": {
+		Summary: "Download the differences journal of a snapshot", Role: models.RoleViewer,
+		Query:        []string{"format:string"},
+		Response:     []byte{},
+		ResponseType: "application/octet-stream",
+	},
+	"POST /artifacts/verify": {
+		Summary: "Verify a report file against the signed artifacts issued", Role: models.RoleViewer,
+		Body: "", BodyType: "application/octet-stream",
+		Response: models.ArtifactVerification{},
+	},
+	"GET /artifacts/{id}": {
+		Summary: "Get a signed report artifact", Role: models.RoleViewer,
+		Response: models.ReportArtifact{},
+	},
+
+	// Custom reports
+	"GET /reports/sources": {
+		Summary: "List the report sources and their fields", Role: models.RoleViewer,
+		Response: openapi.Fields("sources", map[string]map[string]string{}),
+	},
+	"POST /reports": {
+		Summary: "Define a report", Role: models.RoleOperator,
+		Body: reportRequest{}, Status: http.StatusCreated, Response: models.ReportDefinition{},
+	},
+	"GET /reports": {
+		Summary: "List reports", Role: models.RoleViewer,
+		Response: openapi.Fields("reports", []*models.ReportDefinition{}),
+	},
+	"GET /reports/{report_id}": {
+		Summary: "Get a report", Role: models.RoleViewer,
+		Response: models.ReportDefinition{},
+	},
+	"PUT /reports/{report_id}": {
+		Summary: "Update a report", Role: models.RoleOperator,
+		Body: reportRequest{}, Response: models.ReportDefinition{},
+	},
+	"DELETE /reports/{report_id}": {
+		Summary: "Delete a report", Role: models.RoleOperator, Guarded: true,
+		Response: deletedResponse,
+	},
+	"GET /reports/{report_id}/run": {
+		Summary: "Run a report, as JSON or CSV", Role: models.RoleViewer,
+		Query:    []string{"from_date:date", "to_date:date", "currency:string", "format:string"},
+		Response: models.ReportResult{},
+	},
+
+	// Business calendars
+	"POST /calendars": {
+		Summary: "Create a business calendar", Role: models.RoleOperator,
+		Body: models.BusinessCalendar{}, Status: http.StatusCreated, Response: models.BusinessCalendar{},
+	},
+	"GET /calendars": {
+		Summary: "List business calendars", Role: models.RoleViewer,
+		Response: openapi.Fields("calendars", []*models.BusinessCalendar{}),
+	},
+	"GET /calendars/{code}": {
+		Summary: "Get a business calendar", Role: models.RoleViewer,
+		Response: models.BusinessCalendar{},
+	},
+	"PUT /calendars/{code}": {
+		Summary: "Update a business calendar", Role: models.RoleOperator,
+		Body: models.BusinessCalendar{}, Response: models.BusinessCalendar{},
+	},
+	"DELETE /calendars/{code}": {
+		Summary: "Delete a business calendar", Role: models.RoleOperator, Guarded: true,
+		Response: deletedResponse,
+	},
+	"POST /calendars/{code}/holidays": {
+		Summary: "Add a holiday", Role: models.RoleOperator,
+		Body: models.CalendarHoliday{}, Response: models.BusinessCalendar{},
+	},
+	"POST /calendars/{code}/holidays/import": {
+		Summary: "Replace the holidays of a year, from JSON or CSV", Role: models.RoleOperator,
+		Query: []string{"year:integer!"},
+		Body:  []models.CalendarHoliday{}, Response: models.BusinessCalendar{},
+	},
+	"DELETE /calendars/{code}/holidays/{date}": {
+		Summary: "Remove a holiday", Role: models.RoleOperator, Guarded: true,
+		Response: deletedResponse,
+	},
+	"GET /calendars/{code}/business-days": {
+		Summary: "Count the business days between two dates", Role: models.RoleViewer,
+		Query:    listingByDate,
+		Response: openapi.Fields("from_date", "", "to_date", "", "business_days", 0),
+	},
+
+	// Counterparties
+	"POST /counterparties": {
+		Summary: "Create a counterparty", Role: models.RoleOperator,
+		Body: models.Counterparty{}, Status: http.StatusCreated, Response: models.Counterparty{},
+	},
+	"GET /counterparties": {
+		Summary: "List counterparties", Role: models.RoleViewer,
+		Response: openapi.Fields("counterparties", []*models.Counterparty{}),
+	},
+	"GET /counterparties/{code}": {
+		Summary: "Get a counterparty", Role: models.RoleViewer,
+		Response: models.Counterparty{},
+	},
+	"PUT /counterparties/{code}": {
+		Summary: "Update a counterparty", Role: models.RoleOperator,
+		Body: models.Counterparty{}, Response: models.Counterparty{},
+	},
+	"DELETE /counterparties/{code}": {
+		Summary: "Delete a counterparty", Role: models.RoleOperator, Guarded: true,
+		Response: deletedResponse,
+	},
+
+	// Aliases
+	"POST /aliases": {
+		Summary: "Add a name alias", Role: models.RoleOperator,
+		Body: models.NameAlias{}, Status: http.StatusCreated, Response: models.NameAlias{},
+	},
+	"GET /aliases": {
+		Summary: "List name aliases", Role: models.RoleViewer,
+		Response: openapi.Fields("aliases", []*models.NameAlias{}),
+	},
+	"DELETE /aliases/{id}": {
+		Summary: "Delete a name alias", Role: models.RoleOperator, Guarded: true,
+		Response: deletedResponse,
+	},
+
+	// Exchange rates
+	"POST /fx-rates": {
+		Summary: "Save an exchange rate", Role: models.RoleOperator,
+		Body: fxRateRequest{}, Status: http.StatusCreated, Response: models.FXRate{},
+	},
+	"GET /fx-rates": {
+		Summary: "List exchange rates", Role: models.RoleViewer,
+		Query:    []string{"from_currency:string", "to_currency:string"},
+		Response: openapi.Fields("fx_rates", []*models.FXRate{}),
+	},
+
+	// Fee schedules
+	"POST /fee-schedules": {
+		Summary: "Create a bank fee schedule", Role: models.RoleOperator,
+		Body: feeScheduleRequest{}, Status: http.StatusCreated, Response: models.FeeSchedule{},
+	},
+	"GET /fee-schedules": {
+		Summary: "List bank fee schedules", Role: models.RoleViewer,
+		Query:    []string{"account_number:string"},
+		Response: openapi.Fields("fee_schedules", []*models.FeeSchedule{}),
+	},
+	"GET /fee-schedules/expectations": {
+		Summary: "Compare expected with charged fees for a month", Role: models.RoleViewer,
+		Query:    []string{"period:month", "exceptions:boolean"},
+		Response: openapi.Fields("period", "", "expectations", []*models.FeeExpectation{}),
+	},
+	"GET /fee-schedules/{id}": {
+		Summary: "Get a bank fee schedule", Role: models.RoleViewer,
+		Response: models.FeeSchedule{},
+	},
+	"PUT /fee-schedules/{id}": {
+		Summary: "Update a bank fee schedule", Role: models.RoleOperator,
+		Body: feeScheduleRequest{}, Response: models.FeeSchedule{},
+	},
+	"DELETE /fee-schedules/{id}": {
+		Summary: "Delete a bank fee schedule", Role: models.RoleOperator, Guarded: true,
+		Response: deletedResponse,
+	},
+
+	// Expected payments
+	"POST /expectations": {
+		Summary: "Register an expected payment", Role: models.RoleOperator,
+		Body: expectationRequest{}, Status: http.StatusCreated, Response: models.ExpectedPayment{},
+	},
+	"GET /expectations": {
+		Summary: "List expected payments", Role: models.RoleViewer,
+		Query:    []string{"status:string", "source:string", "cursor:string", "limit:integer"},
+		Response: openapi.Fields("expectations", []*models.ExpectedPayment{}, "next_cursor", ""),
+	},
+	"GET /expectations/{id}": {
+		Summary: "Get an expected payment", Role: models.RoleViewer,
+		Response: models.ExpectedPayment{},
+	},
+	"DELETE /expectations/{id}": {
+		Summary: "Cancel an expected payment", Role: models.RoleOperator,
+		Response: deletedResponse,
+	},
+
+	// Returns
+	"GET /returns": {
+		Summary: "List direct debit and standing order returns", Role: models.RoleViewer,
+		Query:    []string{"cursor:string", "limit:integer"},
+		Response: openapi.Fields("returns", []*models.BankReturn{}, "next_cursor", ""),
+	},
+	"GET /returns/rates": {
+		Summary: "Return rates per counterparty", Role: models.RoleViewer,
+		Query:    []string{"from_date:date", "to_date:date"},
+		Response: openapi.Fields("from_date", "", "to_date", "", "rates", []*models.CounterpartyReturnRate{}),
+	},
+
+	// Budgets
+	"PUT /budgets": {
+		Summary: "Upload budget or forecast figures", Role: models.RoleOperator,
+		Body: budgetUploadRequest{}, Response: openapi.Fields("saved", 0),
+	},
+	"GET /budgets": {
+		Summary: "List budget and forecast figures", Role: models.RoleViewer,
+		Query:    []string{"period:month", "kind:string"},
+		Response: openapi.Fields("budgets", []*models.Budget{}),
+	},
+	"GET /budgets/variance": {
+		Summary: "Compare budgets with actual cash movement", Role: models.RoleViewer,
+		Query:    []string{"period:month!", "kind:string", "account_number:string"},
+		Response: openapi.Fields("period", "", "variances", []*models.BudgetVariance{}),
+	},
+	"DELETE /budgets/{id}": {
+		Summary: "Delete a budget figure", Role: models.RoleOperator,
+		Response: deletedResponse,
+	},
+
+	// Exceptions
+	"GET /exceptions": {
+		Summary: "List the exception queue", Role: models.RoleViewer,
+		Query:    []string{"status:string", "owner:string", "record_type:string", "cursor:string", "limit:integer"},
+		Response: openapi.Fields("exceptions", []*models.ReconciliationException{}, "next_cursor", ""),
+	},
+	"GET /exceptions/{id}": {
+		Summary: "Get an exception with its audit trail", Role: models.RoleViewer,
+		Response: models.ReconciliationException{},
+	},
+	"POST /exceptions/{id}/transition": {
+		Summary: "Move an exception to another state", Role: models.RoleOperator,
+		Body: exceptionTransitionRequest{}, Response: models.ReconciliationException{},
+	},
+	"POST /exceptions/{id}/assign": {
+		Summary: "Assign an exception", Role: models.RoleOperator,
+		Body: exceptionAssignRequest{}, Response: models.ReconciliationException{},
+	},
+	"POST /exceptions/{id}/comments": {
+		Summary: "Comment on an exception", Role: models.RoleOperator,
+		Body: exceptionCommentRequest{}, Status: http.StatusCreated, Response: models.ExceptionEvent{},
+	},
+
+	// Analytics
+	"GET /analytics/cash-position": {
+		Summary: "Reconciled and projected cash position per account", Role: models.RoleViewer,
+		Query:    []string{"date:date", "account_number:string", "horizon_days:integer"},
+		Response: openapi.Fields("date", "", "horizon_days", 0, "accounts", []*models.CashPosition{}),
+	},
+	"GET /digest/daily": {
+		Summary: "Daily digest of ingestion, matching and unmatched items", Role: models.RoleViewer,
+		Query:    []string{"date:date"},
+		Response: models.DailyDigest{},
+	},
+
+	// Schedules
+	"POST /schedules": {
+		Summary: "Schedule a recurring reconciliation", Role: models.RoleOperator,
+		Body: scheduleRequest{}, Status: http.StatusCreated, Response: models.ReconciliationSchedule{},
+	},
+	"GET /schedules": {
+		Summary: "List schedules", Role: models.RoleViewer,
+		Response: openapi.Fields("schedules", []*models.ReconciliationSchedule{}),
+	},
+	"GET /schedules/{id}": {
+		Summary: "Get a schedule", Role: models.RoleViewer,
+		Response: models.ReconciliationSchedule{},
+	},
+	"PUT /schedules/{id}": {
+		Summary: "Update a schedule", Role: models.RoleOperator,
+		Body: scheduleRequest{}, Response: models.ReconciliationSchedule{},
+	},
+	"DELETE /schedules/{id}": {
+		Summary: "Delete a schedule", Role: models.RoleOperator, Guarded: true,
+		Response: deletedResponse,
+	},
+	"GET /schedules/{id}/runs": {
+		Summary: "List the runs of a schedule", Role: models.RoleViewer,
+		Query:    []string{"cursor:string", "limit:integer"},
+		Response: openapi.Fields("schedule_id", int64(0), "runs", []*models.ScheduleRun{}, "next_cursor", ""),
+	},
+
+	// Exports
+	"GET /exports/{id}": {
+		Summary: "Get an export job, with a signed download link once completed", Role: models.RoleViewer,
+		Response: models.ExportJob{},
+	},
+	"GET /exports/{id}/download": {
+		Summary:      "Download an export through its signed link",
+		Query:        []string{"expires:integer!", "signature:string!"},
+		Response:     []byte{},
+		ResponseType: "application/octet-stream",
+	},
+
+	// Matching rules
+	"GET /rules": {
+		Summary: "Get the active matching rules", Role: models.RoleViewer,
+		Response: matching.Rules{},
+	},
+	"POST /rules/changes": {
+		Summary: "Propose a matching rule change", Role: models.RoleOperator,
+		Body: ruleChangeRequest{}, Status: http.StatusCreated, Response: models.RuleSetChange{},
+	},
+	"GET /rules/changes": {
+		Summary: "List matching rule changes", Role: models.RoleViewer,
+		Response: openapi.Fields("changes", []*models.RuleSetChange{}),
+	},
+	"GET /rules/changes/{id}": {
+		Summary: "Get a matching rule change", Role: models.RoleViewer,
+		Response: models.RuleSetChange{},
+	},
+	"POST /rules/changes/{id}/approve": {
+		Summary: "Approve and activate a matching rule change", Role: models.RoleAdmin,
+		Body: ruleReviewRequest{}, Response: models.RuleSetChange{},
+	},
+	"POST /rules/changes/{id}/reject": {
+		Summary: "Reject a matching rule change", Role: models.RoleAdmin,
+		Body: ruleReviewRequest{}, Response: models.RuleSetChange{},
+	},
+
+	// Shadow evaluation
+	"POST /shadow/candidates": {
+		Summary: "Add candidate matching rules to evaluate in shadow", Role: models.RoleOperator,
+		Body: shadowCandidateRequest{}, Status: http.StatusCreated, Response: models.ShadowCandidate{},
+	},
+	"GET /shadow/candidates": {
+		Summary: "List shadow candidates", Role: models.RoleViewer,
+		Response: openapi.Fields("candidates", []*models.ShadowCandidate{}),
+	},
+	"PUT /shadow/candidates/{version}": {
+		Summary: "Enable or disable a shadow candidate", Role: models.RoleOperator,
+		Body: shadowCandidateUpdateRequest{}, Response: SuccessResponse{},
+	},
+	"DELETE /shadow/candidates/{version}": {
+		Summary: "Delete a shadow candidate", Role: models.RoleOperator, Guarded: true,
+		Response: deletedResponse,
+	},
+	"GET /shadow/runs/{id}/matches": {
+		Summary: "Compare the matches of a shadow run with the batch's", Role: models.RoleViewer,
+		Query:    []string{"agreement:string"},
+		Response: openapi.Fields("matches", []*models.ShadowMatch{}),
+	},
+
+	// Notifications
+	"GET /notifications/preferences/{user_id}": {
+		Summary: "Get a user's notification preferences", Role: models.RoleViewer,
+		Response: models.NotificationPreferences{},
+	},
+	"PUT /notifications/preferences/{user_id}": {
+		Summary: "Save a user's notification preferences", Role: models.RoleOperator,
+		Body: models.NotificationPreferences{}, Response: models.NotificationPreferences{},
+	},
+	"DELETE /notifications/preferences/{user_id}": {
+		Summary: "Delete a user's notification preferences", Role: models.RoleOperator, Guarded: true,
+		Response: deletedResponse,
+	},
+	"GET /notifications/routes": {
+		Summary: "List where an event type is delivered", Role: models.RoleViewer,
+		Query:    []string{"event_type:string!"},
+		Response: openapi.Fields("event_type", "", "routes", []models.NotificationRoute{}),
+	},
+	"POST /notifications/dispatches": {
+		Summary: "Dispatch a notification event", Role: models.RoleOperator,
+		Body: dispatchRequest{}, Response: models.NotificationDispatch{},
+	},
+
+	// Usage
+	"GET /usage": {
+		Summary: "Get the caller's usage and quota for a month", Role: models.RoleViewer,
+		Query:    []string{"period:month"},
+		Response: services.UsageReport{},
+	},
+	"GET /usage/entities": {
+		Summary: "List the usage of every entity for a month", Role: models.RoleAdmin,
+		Query:    []string{"period:month"},
+		Response: openapi.Fields("period", "", "entities", []*models.APIUsage{}),
+	},
+	"PUT /usage/quotas/{entity}": {
+		Summary: "Set an entity's quota", Role: models.RoleAdmin,
+		Body: models.APIQuota{}, Response: models.APIQuota{},
+	},
+
+	// Sandbox
+	"GET /sandbox": {
+		Summary: "Get the sandbox's last reset and the next one", Role: models.RoleViewer,
+		Response: services.SandboxStatus{},
+	},
+	"POST /sandbox/reset": {
+		Summary: "Reset the sandbox data now", Role: models.RoleOperator,
+		Response: models.SandboxReset{},
+	},
+
+	// Access
+	"GET /me": {
+		Summary:  "Get the authenticated caller and their role; an API key also gets its scope and tenant",
+		Response: openapi.Fields("id", "", "name", "", "email", "", "role", "", "scope", "", "tenant", ""),
+	},
+	"GET /admin/roles": {
+		Summary: "List roles", Role: models.RoleAdmin,
+		Response: openapi.Fields("roles", []*models.Role{}),
+	},
+	"GET /admin/users": {
+		Summary: "List users and their roles", Role: models.RoleAdmin,
+		Response: openapi.Fields("users", []*models.User{}),
+	},
+	"GET /admin/users/{user_id}": {
+		Summary: "Get a user", Role: models.RoleAdmin,
+		Response: models.User{},
+	},
+	"PUT /admin/users/{user_id}": {
+		Summary: "Create or update a user's role", Role: models.RoleAdmin,
+		Body: models.User{}, Response: models.User{},
+	},
+	"DELETE /admin/users/{user_id}": {
+		Summary: "Delete a user", Role: models.RoleAdmin,
+		Response: deletedResponse,
+	},
+
+	// Administration
+	"GET /admin/failover": {
+		Summary: "Get the read-only failover state and the write outbox", Role: models.RoleAdmin,
+		Response: models.FailoverStatus{},
+	},
+	"GET /admin/maintenance": {
+		Summary: "Get the maintenance mode", Role: models.RoleAdmin,
+		Response: models.MaintenanceMode{},
+	},
+	"PUT /admin/maintenance": {
+		Summary: "Turn maintenance mode on or off", Role: models.RoleAdmin,
+		Body: maintenanceRequest{}, Response: models.MaintenanceMode{},
+	},
+	"GET /admin/config/export": {
+		Summary: "Export the configuration as a bundle", Role: models.RoleAdmin,
+		Response: services.ConfigBundle{},
+	},
+	"POST /admin/config/import": {
+		Summary: "Import a configuration bundle", Role: models.RoleAdmin, Guarded: true,
+		Query: []string{"user_id:string"},
+		Body:  services.ConfigBundle{}, Response: services.ConfigImportResult{},
+	},
+	"GET /admin/fixtures/export": {
+		Summary: "Export a date range as an anonymized fixture bundle", Role: models.RoleAdmin,
+		Query:    []string{"from_date:date!", "to_date:date!", "jitter:number"},
+		Response: services.FixtureBundle{},
+	},
+	"POST /admin/fixtures/import": {
+		Summary: "Load a fixture bundle", Role: models.RoleAdmin,
+		Body: services.FixtureBundle{}, Response: services.FixtureImportResult{},
+	},
+	"GET /admin/safety/overrides": {
+		Summary: "List the confirmed destructive operations", Role: models.RoleAdmin,
+		Response: openapi.Fields("guarded", false, "overrides", []*models.SafetyOverride{}),
+	},
+	"GET /admin/request-audits": {
+		Summary: "Search the request audit log", Role: models.RoleAdmin,
+		Query: []string{
+			"user_id:string", "method:string", "route:string", "from_date:date", "to_date:date",
+			"before_id:integer", "cursor:string", "limit:integer",
+		},
+		Response: openapi.Fields("request_audits", []*models.RequestAudit{}, "next_cursor", ""),
+	},
+	"GET /admin/retention/policies": {
+		Summary: "List retention policies", Role: models.RoleAdmin,
+		Response: openapi.Fields("policies", []*models.RetentionPolicy{}),
+	},
+	"GET /policy-packs": {
+		Summary: "List the policy packs and the tenant's assignments", Role: models.RoleViewer,
+		Response: openapi.Fields("packs", []*models.PolicyPack{}, "assignments", []*models.PolicyPackAssignment{}),
+	},
+	"PUT /admin/policy-packs/assignments": {
+		Summary: "Put the tenant or one of its accounts under a policy pack", Role: models.RoleAdmin,
+		Body: policyPackAssignmentRequest{}, Response: openapi.Fields("assignments", []*models.PolicyPackAssignment{}),
+	},
+	"PUT /admin/retention/policies/{data_class}": {
+		Summary: "Set the retention of a data class", Role: models.RoleAdmin,
+		Body: retentionPolicyRequest{}, Response: models.RetentionPolicy{},
+	},
+	"POST /admin/retention/dry-run": {
+		Summary: "Report what a purge would delete", Role: models.RoleAdmin,
+		Response: models.RetentionRun{},
+	},
+	"POST /admin/retention/purge": {
+		Summary: "Purge data past its retention now", Role: models.RoleAdmin, Guarded: true,
+		Response: models.RetentionRun{},
+	},
+	"GET /admin/retention/runs": {
+		Summary: "List purges and dry runs", Role: models.RoleAdmin,
+		Query:    []string{"cursor:string", "limit:integer"},
+		Response: openapi.Fields("runs", []*models.RetentionRun{}, "next_cursor", ""),
+	},
+	"POST /admin/integrity/check": {
+		Summary: "Check mapping integrity now", Role: models.RoleAdmin,
+		Response: models.IntegrityRun{},
+	},
+	"GET /admin/integrity/runs": {
+		Summary: "List integrity checker runs", Role: models.RoleAdmin,
+		Query:    []string{"cursor:string", "limit:integer"},
+		Response: openapi.Fields("runs", []*models.IntegrityRun{}, "next_cursor", ""),
+	},
+	"GET /admin/integrity/findings": {
+		Summary: "List integrity findings", Role: models.RoleAdmin,
+		Query:    []string{"run_id:integer", "kind:string", "status:string", "cursor:string", "limit:integer"},
+		Response: openapi.Fields("findings", []*models.IntegrityFinding{}, "next_cursor", ""),
+	},
+	"POST /admin/integrity/findings/{id}/repair": {
+		Summary: "Repair an integrity finding", Role: models.RoleAdmin, Guarded: true,
+		Body: integrityRepairRequest{}, Response: models.IntegrityFinding{},
+	},
+	"GET /admin/ingestion-files": {
+		Summary: "List statement files fetched from SFTP", Role: models.RoleAdmin,
+		Query:    []string{"status:string", "cursor:string", "limit:integer"},
+		Response: openapi.Fields("files", []*models.IngestionFile{}, "next_cursor", ""),
+	},
+	"POST /admin/ingestion-files/fetch": {
+		Summary: "Fetch statement files from SFTP now", Role: models.RoleAdmin,
+		Response: services.FetchResult{},
+	},
+	"POST /admin/ingestion-files/fetch-s3": {
+		Summary: "Pull statement files from an S3 bucket now", Role: models.RoleAdmin,
+		Body: objectFetchRequest{}, Response: services.FetchResult{},
+	},
+	"GET /admin/ingestion-emails": {
+		Summary: "List statement emails received", Role: models.RoleAdmin,
+		Query:    []string{"status:string", "cursor:string", "limit:integer"},
+		Response: openapi.Fields("emails", []*models.IngestionEmail{}, "next_cursor", ""),
+	},
+	"POST /admin/webhooks": {
+		Summary: "Register an endpoint for ingestion anomaly webhooks; the signing secret is returned only here", Role: models.RoleAdmin,
+		Body: webhookEndpointRequest{}, Status: http.StatusCreated, Response: models.WebhookEndpoint{},
+	},
+	"GET /admin/webhooks": {
+		Summary: "List the webhook endpoints", Role: models.RoleAdmin,
+		Response: openapi.Fields("endpoints", []*models.WebhookEndpoint{}),
+	},
+	"GET /admin/webhooks/deliveries": {
+		Summary: "List webhook deliveries with their events", Role: models.RoleAdmin,
+		Query:    []string{"endpoint_id:integer", "status:string", "cursor:string", "limit:integer"},
+		Response: openapi.Fields("deliveries", []*models.WebhookDelivery{}, "next_cursor", ""),
+	},
+	"GET /admin/webhooks/{id}": {
+		Summary: "Get a webhook endpoint", Role: models.RoleAdmin,
+		Response: models.WebhookEndpoint{},
+	},
+	"PUT /admin/webhooks/{id}": {
+		Summary: "Replace a webhook endpoint, keeping its secret", Role: models.RoleAdmin,
+		Body: webhookEndpointRequest{}, Response: models.WebhookEndpoint{},
+	},
+	"DELETE /admin/webhooks/{id}": {
+		Summary: "Delete a webhook endpoint and its deliveries", Role: models.RoleAdmin,
+		Response: deletedResponse,
+	},
+	"POST /admin/api-keys": {
+		Summary: "Issue an API key for a machine caller; the key is returned only here", Role: models.RoleAdmin,
+		Body: apiKeyRequest{}, Status: http.StatusCreated, Response: models.APIKey{},
+	},
+	"GET /admin/api-keys": {
+		Summary: "List API keys, newest first", Role: models.RoleAdmin,
+		Query:    []string{"tenant:string"},
+		Response: openapi.Fields("keys", []*models.APIKey{}),
+	},
+	"GET /admin/api-keys/{id}": {
+		Summary: "Get an API key", Role: models.RoleAdmin,
+		Response: models.APIKey{},
+	},
+	"POST /admin/api-keys/{id}/rotate": {
+		Summary: "Replace an API key; the old key keeps working for the rotation grace period", Role: models.RoleAdmin,
+		Query:  []string{"user_id:string"},
+		Status: http.StatusCreated, Response: models.APIKey{},
+	},
+	"POST /admin/api-keys/{id}/revoke": {
+		Summary: "Revoke an API key at once", Role: models.RoleAdmin,
+		Query:    []string{"user_id:string"},
+		Response: models.APIKey{},
+	},
+	"POST /ingestion/email": {
+		Summary: "Receive a statement email from the email provider, signed in X-Email-Signature",
+		Body:    "", BodyType: "message/rfc822",
+		Response: models.IngestionEmail{},
+	},
+	"POST /admin/legal-holds": {
+		Summary: "Place a legal hold", Role: models.RoleAdmin,
+		Body: legalHoldRequest{}, Status: http.StatusCreated, Response: models.LegalHold{},
+	},
+	"GET /admin/legal-holds": {
+		Summary: "List legal holds", Role: models.RoleAdmin,
+		Response: openapi.Fields("holds", []*models.LegalHold{}),
+	},
+	"GET /admin/legal-holds/audit": {
+		Summary: "List the legal hold audit trail", Role: models.RoleAdmin,
+		Query:    []string{"hold_id:integer", "cursor:string", "limit:integer"},
+		Response: openapi.Fields("audit", []*models.LegalHoldAudit{}, "next_cursor", ""),
+	},
+	"GET /admin/legal-holds/{id}": {
+		Summary: "Get a legal hold", Role: models.RoleAdmin,
+		Response: models.LegalHold{},
+	},
+	"DELETE /admin/legal-holds/{id}": {
+		Summary: "Lift a legal hold", Role: models.RoleAdmin, Guarded: true,
+		Query:    []string{"user_id:string"},
+		Response: models.LegalHold{},
+	},
+	"GET /admin/jobs": {
+		Summary: "List reconciliation and ingestion jobs", Role: models.RoleOperator,
+		Query:    []string{"status:string", "cursor:string", "limit:integer"},
+		Response: openapi.Fields("jobs", []*models.ReconciliationJob{}, "draining", false, "next_cursor", ""),
+	},
+	"GET /admin/jobs/{id}": {
+		Summary: "Get a job", Role: models.RoleOperator,
+		Response: models.ReconciliationJob{},
+	},
+	"GET /admin/jobs/stuck": {
+		Summary: "List running jobs whose instance stopped beating for them", Role: models.RoleOperator,
+		Response: services.StuckJobs{},
+	},
+	"GET /admin/workers": {
+		Summary: "List the background workers of every instance with their last heartbeat", Role: models.RoleOperator,
+		Response: openapi.Fields("workers", []*models.WorkerHeartbeat{}),
+	},
+	"GET /admin/queue": {
+		Summary: "Get the reconciliation queue", Role: models.RoleOperator,
+		Response: services.QueueStatus{},
+	},
+	"POST /admin/queue/reorder": {
+		Summary: "Reorder the queued reconciliations", Role: models.RoleAdmin,
+		Body: reorderRequest{}, Response: services.QueueStatus{},
+	},
+	"PATCH /admin/queue/{job_id}": {
+		Summary: "Set the priority of a queued reconciliation", Role: models.RoleAdmin,
+		Body: priorityRequest{}, Response: openapi.Fields("job_id", "", "priority", 0),
+	},
+
+	// Service
+	"GET /openapi.json": {
+		Summary:  "Get this OpenAPI document",
+		Response: map[string]interface{}{},
+	},
+	"GET /health": {
+		Summary:  "Check the service is up",
+		Response: openapi.Fields("status", ""),
+	},
+	"GET /metrics": {
+		Summary:      "Get the operator backlog of every tenant in the Prometheus text format",
+		Response:     "",
+		ResponseType: "text/plain",
+	},
+}
+
+// pathParameter matches a mux path variable with its optional pattern
+var pathParameter = regexp.MustCompile(`\{([^}:]+)(?::([^}]+))?\}`)
+
+// buildOpenAPI describes every route registered on router. Routes outside
+// the /api/v1 subrouter take no bearer token, so they are marked public when
+// authenticated is set.
+func buildOpenAPI(router *mux.Router, authenticated bool) (*openapi.Document, error) {
+	schemas := openapi.NewSchemas()
+	doc := &openapi.Document{
+		OpenAPI: openapi.Version,
+		Info: openapi.Info{
+			Title:       openAPITitle,
+			Description: "Bank to ledger reconciliation. Operations carry the least role they require in x-required-role.",
+			Version:     openAPIRevision,
+		},
+		Paths: make(map[string]openapi.PathItem),
+	}
+	errorSchema := schemas.Of(ErrorResponse{})
+	tags := make(map[string]bool)
+
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			// Subrouters and prefixes serve no requests of their own
+			return nil
+		}
+		if template == swaggerUIPath {
+			return nil
+		}
+
+		path := pathParameter.ReplaceAllString(template, "{$1}")
+		key := strings.TrimPrefix(path, apiPrefix)
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(openapi.PathItem)
+		}
+		for _, method := range methods {
+			spec := apiOperations[method+" "+key]
+			operation := &openapi.Operation{
+				Summary:      spec.Summary,
+				OperationID:  operationID(method, key),
+				RequiredRole: spec.Role,
+				Responses:    make(map[string]*openapi.Response),
+			}
+			if tag := strings.SplitN(strings.TrimPrefix(key, "/"), "/", 2)[0]; tag != "" {
+				operation.Tags = []string{tag}
+				tags[tag] = true
+			}
+			if authenticated && len(ancestors) == 0 {
+				public := []map[string][]string{}
+				operation.Security = &public
+			}
+
+			for _, match := range pathParameter.FindAllStringSubmatch(template, -1) {
+				schema := &openapi.Schema{Type: "string"}
+				if match[2] == "[0-9]+" {
+					schema = &openapi.Schema{Type: "integer", Format: "int64"}
+				}
+				parameter := openapi.Parameter{
+					Name: match[1], In: "path", Required: true, Schema: schema,
+				}
+				if match[1] == "batch_id" {
+					parameter.Description = "The batch ID, or the external reference the batch was started with"
+				}
+				operation.Parameters = append(operation.Parameters, parameter)
+			}
+			for _, query := range spec.Query {
+				operation.Parameters = append(operation.Parameters, queryParameter(query))
+			}
+			operation.Parameters = append(operation.Parameters, openapi.Parameter{
+				Name:        requestIDHeader,
+				In:          "header",
+				Description: "Request ID echoed in the response and its log line; one is generated when absent",
+				Schema:      &openapi.Schema{Type: "string"},
+			})
+			if len(ancestors) > 0 {
+				operation.Parameters = append(operation.Parameters, openapi.Parameter{
+					Name:        "X-Tenant-ID",
+					In:          "header",
+					Description: "Tenant the request acts for, when the token carries no tenant claim; required when TENANTS is set. Sandbox API keys need none.",
+					Schema:      &openapi.Schema{Type: "string"},
+				})
+			}
+			if spec.Idempotent {
+				operation.Parameters = append(operation.Parameters, openapi.Parameter{
+					Name:        idempotencyKeyHeader,
+					In:          "header",
+					Description: "Key a retry repeats to get the first response back instead of running again",
+					Schema:      &openapi.Schema{Type: "string"},
+				})
+			}
+			if spec.Conditional && method == http.MethodGet {
+				operation.Parameters = append(operation.Parameters, openapi.Parameter{
+					Name:        "If-None-Match",
+					In:          "header",
+					Description: "ETag of a previous response; 304 answers when it still holds",
+					Schema:      &openapi.Schema{Type: "string"},
+				})
+				operation.Responses[fmt.Sprint(http.StatusNotModified)] = &openapi.Response{
+					Description: http.StatusText(http.StatusNotModified),
+				}
+			} else if spec.Conditional {
+				operation.Parameters = append(operation.Parameters, openapi.Parameter{
+					Name:        "If-Match",
+					In:          "header",
+					Description: "ETag of the batch's details the change was decided on; 412 answers when they changed since",
+					Schema:      &openapi.Schema{Type: "string"},
+				})
+			}
+			if spec.Guarded {
+				operation.Parameters = append(operation.Parameters, openapi.Parameter{
+					Name:        "X-Confirm-Token",
+					In:          "header",
+					Description: "Confirmation token, required in production",
+					Schema:      &openapi.Schema{Type: "string"},
+				})
+			}
+
+			if spec.Body != nil {
+				operation.RequestBody = &openapi.RequestBody{
+					Required: true,
+					Content:  mediaType(spec.BodyType, schemas.Of(spec.Body)),
+				}
+			}
+			status := spec.Status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			operation.Responses[fmt.Sprint(status)] = &openapi.Response{
+				Description: http.StatusText(status),
+				Content:     mediaType(spec.ResponseType, schemas.Of(spec.Response)),
+			}
+			if spec.Accepted != nil {
+				operation.Responses[fmt.Sprint(http.StatusAccepted)] = &openapi.Response{
+					Description: http.StatusText(http.StatusAccepted),
+					Content:     mediaType("", schemas.Of(spec.Accepted)),
+				}
+			}
+			operation.Responses["default"] = &openapi.Response{
+				Description: "Error",
+				Content:     mediaType("", errorSchema),
+			}
+
+			doc.Paths[path][strings.ToLower(method)] = operation
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	doc.Components.Schemas = schemas.Components()
+	if authenticated {
+		doc.Components.SecuritySchemes = map[string]*openapi.SecurityScheme{
+			"bearerAuth": {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+			"apiKeyAuth": {Type: "apiKey", In: "header", Name: "X-API-Key",
+				Description: "API key of a machine caller; a key of the ingest scope reaches the ingestion endpoints only"},
+		}
+		doc.Security = []map[string][]string{{"bearerAuth": {}}, {"apiKeyAuth": {}}}
+	}
+	names := make([]string, 0, len(tags))
+	for tag := range tags {
+		names = append(names, tag)
+	}
+	sort.Strings(names)
+	for _, tag := range names {
+		doc.Tags = append(doc.Tags, openapi.Tag{Name: tag})
+	}
+	return doc, nil
+}
+
+// queryParameter parses a query parameter documented as name:type
+func queryParameter(query string) openapi.Parameter {
+	name, kind, _ := strings.Cut(query, ":")
+	required := strings.HasSuffix(kind, "!")
+	kind = strings.TrimSuffix(kind, "!")
+
+	schema := &openapi.Schema{Type: kind}
+	switch kind {
+	case "integer":
+		schema.Format = "int64"
+	case "date":
+		schema = &openapi.Schema{Type: "string", Format: "date"}
+	case "month":
+		schema = &openapi.Schema{Type: "string", Pattern: `^\d{4}-\d{2}$`, Description: "YYYY-MM"}
+	}
+	return openapi.Parameter{Name: name, In: "query", Required: required, Schema: schema}
+}
+
+// mediaType wraps a schema in the content of the given type, JSON when empty
+func mediaType(contentType string, schema *openapi.Schema) map[string]openapi.MediaType {
+	if schema == nil {
+		return nil
+	}
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	if contentType != "application/json" {
+		schema = &openapi.Schema{Type: "string", Format: "binary"}
+	}
+	return map[string]openapi.MediaType{contentType: {Schema: schema}}
+}
+
+// operationID names an operation after its method and path, e.g.
+// getExceptionsId for GET /exceptions/{id}
+func operationID(method, path string) string {
+	id := strings.ToLower(method)
+	for _, word := range strings.FieldsFunc(path, func(r rune) bool {
+		return strings.ContainsRune("/{}-_.", r)
+	}) {
+		id += strings.ToUpper(word[:1]) + word[1:]
+	}
+	return id
+}
+
+// openAPIHandler serves the document of router, built on first request so
+// that it describes every route registered by then
+func openAPIHandler(router *mux.Router, authenticated bool) http.HandlerFunc {
+	var (
+		once sync.Once
+		body []byte
+		err  error
+	)
+	return func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() {
+			var doc *openapi.Document
+			if doc, err = buildOpenAPI(router, authenticated); err == nil {
+				body, err = json.Marshal(doc)
+			}
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}
+}
+
+// swaggerUIPage loads Swagger UI from its CDN, pointed at the document
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>` + openAPITitle + `</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({url: "` + openAPIPath + `", dom_id: "#swagger-ui"});
+  </script>
+</body>
+</html>
+`
+
+func swaggerUIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(swaggerUIPage))
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"reconciliation-service/internal/services"
+)
+
+type PartitionHandler struct {
+	partitionService *services.PartitionService
+}
+
+func NewPartitionHandler(partitionService *services.PartitionService) *PartitionHandler {
+	return &PartitionHandler{
+		partitionService: partitionService,
+	}
+}
+
+type partitionedRunRequest struct {
+	FromDate   string `json:"from_date"`
+	ToDate     string `json:"to_date"`
+	Partitions int    `json:"partitions"`
+	Strategy   string `json:"strategy"`
+}
+
+func (h *PartitionHandler) StartPartitionedRun(w http.ResponseWriter, r *http.Request) {
+	var request partitionedRunRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if request.FromDate == "" || request.ToDate == "" {
+		respondWithError(w, http.StatusBadRequest, "Both from_date and to_date are required")
+		return
+	}
+
+	_, err := time.Parse("2006-01-02", request.FromDate)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid from_date format. Use YYYY-MM-DD")
+		return
+	}
+
+	_, err = time.Parse("2006-01-02", request.ToDate)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid to_date format. Use YYYY-MM-DD")
+		return
+	}
+
+	run, err := h.partitionService.StartPartitionedRun(request.FromDate, request.ToDate, request.Strategy, request.Partitions, actingUser(r, ""), usageEntity(r))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusAccepted, run)
+}
+
+func (h *PartitionHandler) GetPartitionedRun(w http.ResponseWriter, r *http.Request) {
+	batchID := mux.Vars(r)["batch_id"]
+
+	run, err := h.partitionService.GetPartitionedRun(batchID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, run)
+}
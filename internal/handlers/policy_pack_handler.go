@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"reconciliation-service/internal/services"
+)
+
+type PolicyPackHandler struct {
+	policyPackService *services.PolicyPackService
+}
+
+func NewPolicyPackHandler(policyPackService *services.PolicyPackService) *PolicyPackHandler {
+	return &PolicyPackHandler{
+		policyPackService: policyPackService,
+	}
+}
+
+type policyPackAssignmentRequest struct {
+	// Empty assigns the tenant's own pack
+	Account string `json:"account"`
+	// Empty lifts the assignment
+	Pack   string `json:"pack"`
+	UserID string `json:"user_id"`
+}
+
+// ListPolicyPacks lists the packs that can be assigned and the tenant's
+// assignments
+func (h *PolicyPackHandler) ListPolicyPacks(w http.ResponseWriter, r *http.Request) {
+	assignments, err := h.policyPackService.ListAssignments()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"packs":       h.policyPackService.ListPacks(),
+		"assignments": assignments,
+	})
+}
+
+// AssignPolicyPack puts the tenant or one of its accounts under a pack
+func (h *PolicyPackHandler) AssignPolicyPack(w http.ResponseWriter, r *http.Request) {
+	var req policyPackAssignmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	assignments, err := h.policyPackService.Assign(req.Account, req.Pack, actingUser(r, req.UserID))
+	switch {
+	case errors.Is(err, services.ErrInvalidPolicyPack):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"assignments": assignments,
+	})
+}
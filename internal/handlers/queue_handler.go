@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"reconciliation-service/internal/services"
+)
+
+type QueueHandler struct {
+	queueService *services.QueueService
+}
+
+func NewQueueHandler(queueService *services.QueueService) *QueueHandler {
+	return &QueueHandler{
+		queueService: queueService,
+	}
+}
+
+type enqueueRequest struct {
+	FromDate string `json:"from_date"`
+	ToDate   string `json:"to_date"`
+	Priority string `json:"priority"`
+}
+
+func (h *QueueHandler) EnqueueReconciliation(w http.ResponseWriter, r *http.Request) {
+	var request enqueueRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if request.FromDate == "" || request.ToDate == "" {
+		respondWithError(w, http.StatusBadRequest, "Both from_date and to_date are required")
+		return
+	}
+
+	_, err := time.Parse("2006-01-02", request.FromDate)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid from_date format. Use YYYY-MM-DD")
+		return
+	}
+
+	_, err = time.Parse("2006-01-02", request.ToDate)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid to_date format. Use YYYY-MM-DD")
+		return
+	}
+
+	priority, err := services.ParseJobPriority(request.Priority)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	job, err := h.queueService.Enqueue(request.FromDate, request.ToDate, priority, actingUser(r, ""), usageEntity(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusAccepted, job)
+}
+
+func (h *QueueHandler) GetQueue(w http.ResponseWriter, r *http.Request) {
+	queue, err := h.queueService.GetQueue()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, queue)
+}
+
+type priorityRequest struct {
+	Priority *int `json:"priority"`
+}
+
+func (h *QueueHandler) SetPriority(w http.ResponseWriter, r *http.Request) {
+	jobID, err := strconv.ParseInt(mux.Vars(r)["job_id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid job ID")
+		return
+	}
+
+	var request priorityRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Priority == nil {
+		respondWithError(w, http.StatusBadRequest, "priority is required")
+		return
+	}
+
+	if err := h.queueService.SetPriority(jobID, *request.Priority); err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"job_id":   jobID,
+		"priority": *request.Priority,
+	})
+}
+
+type reorderRequest struct {
+	JobIDs []int64 `json:"job_ids"`
+}
+
+func (h *QueueHandler) Reorder(w http.ResponseWriter, r *http.Request) {
+	var request reorderRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := h.queueService.Reorder(request.JobIDs); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.GetQueue(w, r)
+}
@@ -1,35 +1,58 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/gorilla/mux"
 
+	"reconciliation-service/internal/i18n"
 	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/pagination"
+	"reconciliation-service/internal/repositories"
 	"reconciliation-service/internal/services"
 )
 
 type ReconciliationHandler struct {
 	reconciliationService *services.ReconciliationService
-	processingMutex       sync.Mutex
-	activeProcesses       map[string]bool
+	usage                 *UsageHandler
+	jobService            *services.JobService
+	idempotencyService    *services.IdempotencyService
+	// How long before its deadline a start is handed off to its job
+	asyncHandoff time.Duration
 }
 
-func NewReconciliationHandler(reconciliationService *services.ReconciliationService) *ReconciliationHandler {
+func NewReconciliationHandler(reconciliationService *services.ReconciliationService, usage *UsageHandler, jobService *services.JobService, idempotencyService *services.IdempotencyService, asyncHandoff time.Duration) *ReconciliationHandler {
 	return &ReconciliationHandler{
 		reconciliationService: reconciliationService,
-		activeProcesses:       make(map[string]bool),
+		usage:                 usage,
+		jobService:            jobService,
+		idempotencyService:    idempotencyService,
+		asyncHandoff:          asyncHandoff,
 	}
 }
 
+type startReconciliationRequest struct {
+	FromDate string `json:"from_date"`
+	ToDate   string `json:"to_date"`
+	// Match the period and return what the batch would record, keeping none
+	// of it
+	DryRun bool `json:"dry_run"`
+	// The caller's own ID for the batch, unique within the tenant; the
+	// batch is looked up by it as well as by its ID
+	ExternalReference string `json:"external_reference"`
+}
+
 func (h *ReconciliationHandler) StartReconciliation(w http.ResponseWriter, r *http.Request) {
-	var request struct {
-		FromDate string `json:"from_date"`
-		ToDate   string `json:"to_date"`
-	}
+	var request startReconciliationRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
@@ -54,22 +77,176 @@ func (h *ReconciliationHandler) StartReconciliation(w http.ResponseWriter, r *ht
 		return
 	}
 
-	processKey := request.FromDate + "_" + request.ToDate
+	if request.DryRun {
+		h.previewReconciliation(w, r, request)
+		return
+	}
+
+	// A retry with the key of a run that succeeded gets that run's response;
+	// the key is released again when this run fails before its batch commits
+	var claim *models.IdempotencyKey
+	if key := r.Header.Get(idempotencyKeyHeader); key != "" {
+		fingerprint := request.FromDate + "/" + request.ToDate
+		if request.ExternalReference != "" {
+			fingerprint += "/" + request.ExternalReference
+		}
+		claim, err = h.idempotencyService.Begin(requestCaller(r), key, models.IdempotencyOperationStart, fingerprint)
+		if err != nil {
+			respondWithIdempotencyError(w, err)
+			return
+		}
+		if claim.Status == models.IdempotencyStatusCompleted {
+			w.Header().Set("Idempotent-Replayed", "true")
+			respondWithJSON(w, claim.ResponseStatus, claim.Response)
+			return
+		}
+	}
+	release := func() {
+		if claim == nil {
+			return
+		}
+		if err := h.idempotencyService.Release(claim); err != nil {
+			log.Printf("%v", err)
+		}
+	}
+
+	// A taken reference is refused before the run starts; one taken while
+	// it runs fails the batch
+	if request.ExternalReference != "" {
+		if err := h.reconciliationService.CheckExternalReference(request.ExternalReference); err != nil {
+			release()
+			respondWithReferenceError(w, err)
+			return
+		}
+	}
 
-	h.processingMutex.Lock()
-	if h.activeProcesses[processKey] {
-		h.processingMutex.Unlock()
-		respondWithError(w, http.StatusConflict, "Reconciliation for this date range is already in progress")
+	accounts, err := h.reconciliationService.AccountScope(request.FromDate, request.ToDate)
+	if err != nil {
+		release()
+		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	h.activeProcesses[processKey] = true
-	h.processingMutex.Unlock()
 
+	job, err := h.jobService.BeginExclusive(models.JobTypeReconciliation, request.FromDate, request.ToDate, accounts)
+	if err == services.ErrDraining {
+		release()
+		respondDraining(w)
+		return
+	}
+	if errors.Is(err, services.ErrOverlappingRun) {
+		release()
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		release()
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	run := startRun{
+		request:  request,
+		userID:   actingUser(r, ""),
+		tenant:   requestTenant(r),
+		entity:   usageEntity(r),
+		progress: progressReporter(r),
+	}
+	run.progress("job_id", job.ID)
+
+	// A run that would outlast the deadline is handed off before the load
+	// balancer gives up on it: it continues as its job, detached from the
+	// request, and the client gets the job to follow instead of a 504
+	ctx := r.Context()
+	var handoff <-chan time.Time
+	if deadline, ok := ctx.Deadline(); ok && h.asyncHandoff > 0 {
+		timer := time.NewTimer(handoffDelay(deadline, h.asyncHandoff))
+		defer timer.Stop()
+		handoff = timer.C
+		ctx = context.WithoutCancel(ctx)
+		run.detached = true
+	}
+
+	done := make(chan startOutcome, 1)
+	go func() {
+		outcome := h.runReconciliation(ctx, run, job, claim)
+		// A committed batch keeps its claim even if completing it failed,
+		// so a retry with the key can't start a second batch
+		if !outcome.committed {
+			release()
+		}
+		done <- outcome
+	}()
+
+	select {
+	case outcome := <-done:
+		if outcome.err != nil {
+			respondWithError(w, outcome.status, outcome.message)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, outcome.result)
+	case <-handoff:
+		location := fmt.Sprintf("/api/v1/admin/jobs/%d", job.ID)
+		w.Header().Set("Location", location)
+		respondWithJSON(w, http.StatusAccepted, startHandoff{
+			JobID:  job.ID,
+			Status: models.JobStatusRunning,
+			Links:  map[string]string{"job": location},
+		})
+	}
+}
+
+// handoffDelay is how long a start waits for its run before handing it off,
+// handoff before its deadline; a start left with less time than that is
+// handed off at once
+func handoffDelay(deadline time.Time, handoff time.Duration) time.Duration {
+	return max(time.Until(deadline)-handoff, 0)
+}
+
+// startRun is what a started run takes from its request. It is captured
+// before the run starts, since a run handed off outlives the request.
+type startRun struct {
+	request startReconciliationRequest
+	userID  string
+	tenant  string
+	// entity is the usage entity the batch run is counted for
+	entity   string
+	progress func(key string, value interface{})
+	// detached runs can be handed off, so they never give up on the deadline
+	detached bool
+}
+
+// startHandoff answers a start handed off to its job. The job carries the
+// batch ID once the run completes.
+type startHandoff struct {
+	JobID  int64             `json:"job_id"`
+	Status string            `json:"status"`
+	Links  map[string]string `json:"links"`
+}
+
+// startOutcome is how a started run ended: its result, or the error the job
+// records and the status and message to answer it with
+type startOutcome struct {
+	result  *services.ReconciliationResult
+	status  int
+	message string
+	err     error
+	// committed is set once the batch is stored
+	committed bool
+}
+
+// runReconciliation loads and matches the period of a started job, finishes
+// the job and completes the run's Idempotency-Key claim, if any. It touches
+// neither the request nor the response, so it can outlive a run handed off
+// to its job.
+func (h *ReconciliationHandler) runReconciliation(ctx context.Context, run startRun, job *models.ReconciliationJob, claim *models.IdempotencyKey) (outcome startOutcome) {
+	request := run.request
+	var batchID string
 	defer func() {
-		h.processingMutex.Lock()
-		delete(h.activeProcesses, processKey)
-		h.processingMutex.Unlock()
+		h.jobService.Finish(job, batchID, outcome.err)
 	}()
+	failed := func(status int, err error) startOutcome {
+		return startOutcome{status: status, message: err.Error(), err: err}
+	}
+	run.progress("phase", "loading")
 
 	bankChan := make(chan []*models.BankTransaction, 1)
 	accountingChan := make(chan []*models.AccountingEntry, 1)
@@ -80,7 +257,7 @@ func (h *ReconciliationHandler) StartReconciliation(w http.ResponseWriter, r *ht
 
 	go func() {
 		defer wg.Done()
-		bankTransactions, err := h.reconciliationService.GetBankTransactions(request.FromDate, request.ToDate)
+		bankTransactions, err := h.reconciliationService.GetBankTransactions(ctx, request.FromDate, request.ToDate)
 		if err != nil {
 			errorChan <- err
 			return
@@ -90,7 +267,7 @@ func (h *ReconciliationHandler) StartReconciliation(w http.ResponseWriter, r *ht
 
 	go func() {
 		defer wg.Done()
-		accountingEntries, err := h.reconciliationService.GetAccountingEntries(request.FromDate, request.ToDate)
+		accountingEntries, err := h.reconciliationService.GetAccountingEntries(ctx, request.FromDate, request.ToDate)
 		if err != nil {
 			errorChan <- err
 			return
@@ -106,8 +283,7 @@ func (h *ReconciliationHandler) StartReconciliation(w http.ResponseWriter, r *ht
 	select {
 	case err := <-errorChan:
 		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, err.Error())
-			return
+			return failed(http.StatusInternalServerError, err)
 		}
 	default:
 		// No errors, continue processing
@@ -119,26 +295,204 @@ func (h *ReconciliationHandler) StartReconciliation(w http.ResponseWriter, r *ht
 	select {
 	case bankTransactions = <-bankChan:
 	default:
-		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve bank transactions")
-		return
+		return startOutcome{status: http.StatusInternalServerError, message: "Failed to retrieve bank transactions", err: errors.New("failed to retrieve bank transactions")}
 	}
 
 	select {
 	case accountingEntries = <-accountingChan:
 	default:
-		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve accounting entries")
+		return startOutcome{status: http.StatusInternalServerError, message: "Failed to retrieve accounting entries", err: errors.New("failed to retrieve accounting entries")}
+	}
+
+	h.jobService.Checkpoint(job, map[string]interface{}{
+		"phase":              "matching",
+		"bank_transactions":  len(bankTransactions),
+		"accounting_entries": len(accountingEntries),
+	})
+	run.progress("phase", "matching")
+	run.progress("bank_transactions", len(bankTransactions))
+	run.progress("accounting_entries", len(accountingEntries))
+
+	// Loading used up the budget; don't start a batch nobody waits for. A
+	// batch already matching runs to completion and is found through its job,
+	// as is a detached run, which is handed off instead of giving up.
+	if !run.detached {
+		if err := ctx.Err(); err != nil {
+			return failed(http.StatusGatewayTimeout, fmt.Errorf("latency budget exceeded before matching: %w", err))
+		}
+	}
+
+	result, err := h.reconciliationService.ProcessReconciliationWithData(request.FromDate, request.ToDate, bankTransactions, accountingEntries, run.userID, run.tenant, request.ExternalReference)
+	if err != nil {
+		// A mapping the schema refused means the records changed under the
+		// batch, and a reference recorded meanwhile was taken by another
+		// run; neither means the service failed
+		if errors.Is(err, repositories.ErrMappingConflict) || errors.Is(err, repositories.ErrMappingRecordMissing) ||
+			errors.Is(err, repositories.ErrDuplicateReference) {
+			return failed(http.StatusConflict, err)
+		}
+		return failed(http.StatusInternalServerError, err)
+	}
+	batchID = result.BatchID
+	h.usage.recordBatchRun(run.entity)
+
+	if h.reconciliationService.CapInline(result) {
+		result.Links = resultLinks(batchID)
+	}
+	if claim != nil {
+		if err := h.idempotencyService.Complete(claim, batchID, http.StatusOK, result); err != nil {
+			log.Printf("batch %s: %v; its key stays claimed until it expires", batchID, err)
+		}
+	}
+	return startOutcome{result: result, status: http.StatusOK, committed: true}
+}
+
+// previewReconciliation answers a dry run start with everything the batch
+// would record, inline and uncapped. A preview runs no job, so it neither
+// waits for nor blocks a run over the same period, and it claims no
+// Idempotency-Key.
+func (h *ReconciliationHandler) previewReconciliation(w http.ResponseWriter, r *http.Request, request startReconciliationRequest) {
+	if h.jobService.Draining() {
+		respondDraining(w)
 		return
 	}
+	if request.ExternalReference != "" {
+		if err := h.reconciliationService.CheckExternalReference(request.ExternalReference); err != nil {
+			respondWithReferenceError(w, err)
+			return
+		}
+	}
 
-	result, err := h.reconciliationService.ProcessReconciliationWithData(request.FromDate, request.ToDate, bankTransactions, accountingEntries)
+	bankTransactions, err := h.reconciliationService.GetBankTransactions(r.Context(), request.FromDate, request.ToDate)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	accountingEntries, err := h.reconciliationService.GetAccountingEntries(r.Context(), request.FromDate, request.ToDate)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := r.Context().Err(); err != nil {
+		respondWithError(w, http.StatusGatewayTimeout, fmt.Sprintf("latency budget exceeded before matching: %v", err))
+		return
+	}
 
+	result, err := h.reconciliationService.PreviewReconciliationWithData(request.FromDate, request.ToDate, bankTransactions, accountingEntries, actingUser(r, ""), requestTenant(r), request.ExternalReference)
+	if err != nil {
+		respondWithReferenceError(w, err)
+		return
+	}
 	respondWithJSON(w, http.StatusOK, result)
 }
 
+const idempotencyKeyHeader = "Idempotency-Key"
+
+func respondWithReferenceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidReference):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, repositories.ErrDuplicateReference):
+		respondWithError(w, http.StatusConflict, err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func respondWithIdempotencyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidIdempotencyKey):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrIdempotencyKeyReused):
+		respondWithError(w, http.StatusUnprocessableEntity, err.Error())
+	case errors.Is(err, services.ErrIdempotencyKeyInProgress):
+		w.Header().Set("Retry-After", "5")
+		respondWithError(w, http.StatusConflict, err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// GetResults pages through the persisted matches or unmatched items of a batch
+func (h *ReconciliationHandler) GetResults(w http.ResponseWriter, r *http.Request) {
+	batchID := mux.Vars(r)["batch_id"]
+	query := r.URL.Query()
+
+	kind := query.Get("kind")
+	if kind == "" {
+		kind = models.ResultKindMatch
+	}
+	page, err := intQuery(query.Get("page"), 0)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "page must be a number")
+		return
+	}
+	pageSize, err := intQuery(query.Get("page_size"), services.DefaultResultPageSize)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "page_size must be a number")
+		return
+	}
+	fields, ok := requestFields(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := h.reconciliationService.GetResults(batchID, kind, page, pageSize, query.Get("cursor"))
+	if errors.Is(err, services.ErrInvalidResultQuery) || errors.Is(err, pagination.ErrInvalidCursor) {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithFields(w, http.StatusOK, result, fields, "items")
+}
+
+// GetBatchDetails returns a batch's matches and unmatched items as they stand
+// now, rebuilt from its mappings and audit trail
+func (h *ReconciliationHandler) GetBatchDetails(w http.ResponseWriter, r *http.Request) {
+	batchID := mux.Vars(r)["batch_id"]
+
+	details, err := h.reconciliationService.GetBatchDetails(batchID)
+	if err != nil {
+		respondWithRecordError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, details)
+}
+
+// GetBatchDeltas lists the manual changes recorded against a batch
+func (h *ReconciliationHandler) GetBatchDeltas(w http.ResponseWriter, r *http.Request) {
+	batchID := mux.Vars(r)["batch_id"]
+
+	deltas, err := h.reconciliationService.GetBatchDeltas(batchID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve batch deltas")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, deltas)
+}
+
+func intQuery(value string, fallback int) (int, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// resultLinks points a truncated response to the first page of each list
+func resultLinks(batchID string) map[string]string {
+	base := "/api/v1/reconciliation/" + url.PathEscape(batchID) + "/results"
+	return map[string]string{
+		"matches":   fmt.Sprintf("%s?kind=%s&page=1&page_size=%d", base, models.ResultKindMatch, services.DefaultResultPageSize),
+		"unmatched": fmt.Sprintf("%s?kind=%s&page=1&page_size=%d", base, models.ResultKindUnmatched, services.DefaultResultPageSize),
+	}
+}
+
 func (h *ReconciliationHandler) GetReconciliationStatus(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	batchID := vars["batch_id"]
@@ -148,7 +502,7 @@ func (h *ReconciliationHandler) GetReconciliationStatus(w http.ResponseWriter, r
 		return
 	}
 
-	result, err := h.reconciliationService.GetReconciliationStatus(batchID)
+	result, err := h.reconciliationService.GetReconciliationStatus(r.Context(), batchID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -172,9 +526,41 @@ func (h *ReconciliationHandler) ResolveDispute(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	err := h.reconciliationService.ResolveDispute(batchID, resolution)
+	// The optional version is the one the operator resolved against and
+	// user_id the operator, overridden by the authenticated caller; neither
+	// is part of the audited resolution
+	var version int
+	if v, ok := resolution["version"].(float64); ok {
+		version = int(v)
+		delete(resolution, "version")
+	}
+	userID, _ := resolution["user_id"].(string)
+	delete(resolution, "user_id")
+
+	// An If-Match must name the ETag the batch's details have now; the
+	// version read before them then fails a resolution racing a later change
+	conditional := r.Header.Get("If-Match") != ""
+	if conditional {
+		status, err := h.reconciliationService.GetReconciliationStatus(r.Context(), batchID)
+		if err != nil {
+			respondWithRecordError(w, err)
+			return
+		}
+		if !h.checkBatchIfMatch(w, r, batchID) {
+			return
+		}
+		if version == 0 {
+			version = status.Version
+		}
+	}
+
+	err := h.reconciliationService.ResolveDispute(batchID, resolution, version, actingUser(r, userID))
+	if conditional && errors.Is(err, repositories.ErrVersionConflict) {
+		respondWithError(w, http.StatusPreconditionFailed, errPreconditionFailed)
+		return
+	}
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithRecordError(w, err)
 		return
 	}
 
@@ -184,6 +570,67 @@ func (h *ReconciliationHandler) ResolveDispute(w http.ResponseWriter, r *http.Re
 	})
 }
 
+type unmatchRequest struct {
+	Version int    `json:"version"`
+	UserID  string `json:"user_id"`
+	Reason  string `json:"reason"`
+}
+
+// UnmatchReconciliation reverses a wrong match and returns the reconciliation
+// as it is after the undo
+func (h *ReconciliationHandler) UnmatchReconciliation(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseRecordID(w, r)
+	if !ok {
+		return
+	}
+
+	var req unmatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	// As for a resolution, an If-Match names the ETag of the details of the
+	// match's batch
+	conditional := r.Header.Get("If-Match") != ""
+	if conditional {
+		current, err := h.reconciliationService.GetReconciliation(id)
+		if err != nil {
+			respondWithRecordError(w, err)
+			return
+		}
+		if !h.checkBatchIfMatch(w, r, current.BatchID) {
+			return
+		}
+		if req.Version == 0 {
+			req.Version = current.Version
+		}
+	}
+
+	reconciliation, err := h.reconciliationService.UnmatchReconciliation(id, req.Version, actingUser(r, req.UserID), req.Reason)
+	if conditional && errors.Is(err, repositories.ErrVersionConflict) {
+		respondWithError(w, http.StatusPreconditionFailed, errPreconditionFailed)
+		return
+	}
+	if err != nil {
+		respondWithRecordError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, reconciliation)
+}
+
+// checkBatchIfMatch answers 412 unless the If-Match of a change to a batch
+// names the ETag of the batch's details as they are now
+func (h *ReconciliationHandler) checkBatchIfMatch(w http.ResponseWriter, r *http.Request, batchID string) bool {
+	details, err := h.reconciliationService.GetBatchDetails(batchID)
+	if err != nil {
+		respondWithRecordError(w, err)
+		return false
+	}
+	return checkIfMatch(w, r, details)
+}
+
 func (h *ReconciliationHandler) GetUnmatchedRecords(w http.ResponseWriter, r *http.Request) {
 	fromDate := r.URL.Query().Get("from_date")
 	toDate := r.URL.Query().Get("to_date")
@@ -204,6 +651,10 @@ func (h *ReconciliationHandler) GetUnmatchedRecords(w http.ResponseWriter, r *ht
 		respondWithError(w, http.StatusBadRequest, "Invalid to_date format. Use YYYY-MM-DD")
 		return
 	}
+	fields, ok := requestFields(w, r)
+	if !ok {
+		return
+	}
 
 	result, err := h.reconciliationService.GetUnmatchedRecords(fromDate, toDate)
 	if err != nil {
@@ -211,11 +662,136 @@ func (h *ReconciliationHandler) GetUnmatchedRecords(w http.ResponseWriter, r *ht
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, result)
+	respondWithFields(w, http.StatusOK, result, fields, "unmatched_bank_transactions", "unmatched_accounting_entries")
+}
+
+type voidRequest struct {
+	Version int    `json:"version"`
+	UserID  string `json:"user_id"`
+	Reason  string `json:"reason"`
+}
+
+// VoidBankTransaction soft deletes a bank transaction, unmatching the
+// reconciliations that map it
+func (h *ReconciliationHandler) VoidBankTransaction(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseRecordID(w, r)
+	if !ok {
+		return
+	}
+
+	var req voidRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	transaction, err := h.reconciliationService.VoidBankTransaction(id, req.Version, actingUser(r, req.UserID), req.Reason)
+	if err != nil {
+		respondWithRecordError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, transaction)
+}
+
+// VoidAccountingEntry soft deletes an accounting entry, unmatching the
+// reconciliations that map it
+func (h *ReconciliationHandler) VoidAccountingEntry(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseRecordID(w, r)
+	if !ok {
+		return
+	}
+
+	var req voidRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	entry, err := h.reconciliationService.VoidAccountingEntry(id, req.Version, actingUser(r, req.UserID), req.Reason)
+	if err != nil {
+		respondWithRecordError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, entry)
+}
+
+// LookupCorrelation finds the records ingested with an upstream payment ID
+// and the reconciliations they are mapped in
+func (h *ReconciliationHandler) LookupCorrelation(w http.ResponseWriter, r *http.Request) {
+	lookup, err := h.reconciliationService.LookupCorrelation(mux.Vars(r)["correlation_id"])
+	switch {
+	case errors.Is(err, services.ErrInvalidCorrelationID):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, services.ErrCorrelationNotFound):
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	case err != nil:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, lookup)
+}
+
+// GetBatchAudit lists the audit trail of a batch, newest first
+func (h *ReconciliationHandler) GetBatchAudit(w http.ResponseWriter, r *http.Request) {
+	h.listAuditTrail(w, r, mux.Vars(r)["batch_id"])
+}
+
+// ListAuditTrail searches the audit trail of every batch, newest first. Pass
+// the next_cursor of a page as cursor, or its last ID as before_id, to get
+// the next one.
+func (h *ReconciliationHandler) ListAuditTrail(w http.ResponseWriter, r *http.Request) {
+	h.listAuditTrail(w, r, "")
+}
+
+func (h *ReconciliationHandler) listAuditTrail(w http.ResponseWriter, r *http.Request, batchID string) {
+	query := r.URL.Query()
+	filter := models.AuditTrailFilter{
+		BatchID: batchID,
+		UserID:  query.Get("user_id"),
+		Action:  query.Get("action"),
+		From:    query.Get("from"),
+		To:      query.Get("to"),
+	}
+	var err error
+	if filter.BeforeID, err = int64Query(query.Get("before_id")); err != nil {
+		respondWithError(w, http.StatusBadRequest, "before_id must be a number")
+		return
+	}
+	if filter.Limit, err = intQuery(query.Get("limit"), 0); err != nil {
+		respondWithError(w, http.StatusBadRequest, "limit must be a number")
+		return
+	}
+
+	entries, next, err := h.reconciliationService.ListAuditTrail(r.Context(), filter, query.Get("cursor"))
+	switch {
+	case errors.Is(err, services.ErrInvalidAuditQuery), errors.Is(err, pagination.ErrInvalidCursor):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, repositories.ErrReconciliationNotFound):
+		respondWithError(w, http.StatusNotFound, repositories.ErrReconciliationNotFound.Error())
+		return
+	case err != nil:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, withNextCursor(map[string]interface{}{
+		"audit": entries,
+	}, next))
+}
+
+func respondDraining(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", "30")
+	respondWithError(w, http.StatusServiceUnavailable, services.ErrDraining.Error())
 }
 
 func respondWithError(w http.ResponseWriter, code int, message string) {
-	respondWithJSON(w, code, map[string]string{"error": message})
+	respondWithJSON(w, code, ErrorResponse{Error: i18n.T(responseLocale(w), message), RequestID: responseRequestID(w)})
 }
 
 func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
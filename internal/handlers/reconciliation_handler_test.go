@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHandoffDelay(t *testing.T) {
+	tests := []struct {
+		name      string
+		remaining time.Duration
+		handoff   time.Duration
+		min, max  time.Duration
+	}{
+		{name: "hands off before the deadline", remaining: time.Minute, handoff: 10 * time.Second, min: 49 * time.Second, max: 50 * time.Second},
+		{name: "less time left than the handoff", remaining: 5 * time.Second, handoff: 10 * time.Second, min: 0, max: 0},
+		{name: "deadline already passed", remaining: -time.Second, handoff: 10 * time.Second, min: 0, max: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := handoffDelay(time.Now().Add(tt.remaining), tt.handoff)
+			if got < tt.min || got > tt.max {
+				t.Errorf("handoffDelay = %v, want between %v and %v", got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+// TestProgressReporterOutlivesRequest reports progress from a run that
+// carries on after its request, as a start handed off to its job does,
+// while the latency middleware reads it
+func TestProgressReporterOutlivesRequest(t *testing.T) {
+	progress := &requestProgress{fields: make(map[string]interface{})}
+	r := httptest.NewRequest("POST", "/api/v1/reconciliation/start", nil)
+	ctx, cancel := context.WithCancel(context.WithValue(r.Context(), progressKey{}, progress))
+	report := progressReporter(r.WithContext(ctx))
+	cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				report(fmt.Sprintf("step_%d", i), j)
+				progress.snapshot()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	fields := progress.snapshot()
+	for i := 0; i < 4; i++ {
+		if got := fields[fmt.Sprintf("step_%d", i)]; got != 99 {
+			t.Errorf("step_%d = %v, want 99", i, got)
+		}
+	}
+
+	// Without the latency middleware there is nothing to report to
+	progressReporter(httptest.NewRequest("POST", "/", nil))("phase", "loading")
+}
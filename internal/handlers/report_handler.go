@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"reconciliation-service/internal/currency"
+	"reconciliation-service/internal/i18n"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/reports"
+	"reconciliation-service/internal/repositories"
+	"reconciliation-service/internal/services"
+)
+
+type ReportHandler struct {
+	reportService *services.ReportService
+}
+
+func NewReportHandler(reportService *services.ReportService) *ReportHandler {
+	return &ReportHandler{
+		reportService: reportService,
+	}
+}
+
+type reportRequest struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Source      string          `json:"source"`
+	Definition  json.RawMessage `json:"definition"`
+	CreatedBy   string          `json:"created_by"`
+}
+
+func (h *ReportHandler) ListSources(w http.ResponseWriter, r *http.Request) {
+	sources := make(map[string]map[string]string)
+	for _, source := range reports.Sources() {
+		sources[source] = reports.SourceFields(source)
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"sources": sources,
+	})
+}
+
+func (h *ReportHandler) CreateReport(w http.ResponseWriter, r *http.Request) {
+	var request reportRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	report := &models.ReportDefinition{
+		Name:        request.Name,
+		Description: request.Description,
+		Source:      request.Source,
+		Definition:  request.Definition,
+		CreatedBy:   request.CreatedBy,
+	}
+	if err := h.reportService.CreateReport(report); err != nil {
+		respondWithReportError(w, err)
+		return
+	}
+
+	created, err := h.reportService.GetReport(report.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, created)
+}
+
+func (h *ReportHandler) ListReports(w http.ResponseWriter, r *http.Request) {
+	list, err := h.reportService.ListReports()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"reports": list,
+	})
+}
+
+func (h *ReportHandler) GetReport(w http.ResponseWriter, r *http.Request) {
+	reportID, ok := parseReportID(w, r)
+	if !ok {
+		return
+	}
+
+	report, err := h.reportService.GetReport(reportID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, report)
+}
+
+func (h *ReportHandler) UpdateReport(w http.ResponseWriter, r *http.Request) {
+	reportID, ok := parseReportID(w, r)
+	if !ok {
+		return
+	}
+
+	var request reportRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	report, err := h.reportService.UpdateReport(&models.ReportDefinition{
+		ID:          reportID,
+		Name:        request.Name,
+		Description: request.Description,
+		Source:      request.Source,
+		Definition:  request.Definition,
+	})
+	if err != nil {
+		respondWithReportError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, report)
+}
+
+func (h *ReportHandler) DeleteReport(w http.ResponseWriter, r *http.Request) {
+	reportID, ok := parseReportID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.reportService.DeleteReport(reportID); err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, SuccessResponse{Message: i18n.T(responseLocale(w), "Report deleted")})
+}
+
+// RunReport executes a stored report. The optional from_date/to_date query
+// parameters restrict the period; format=csv returns a CSV download instead
+// of JSON, with amounts printed in the requested currency.
+func (h *ReportHandler) RunReport(w http.ResponseWriter, r *http.Request) {
+	reportID, ok := parseReportID(w, r)
+	if !ok {
+		return
+	}
+
+	fromDate := r.URL.Query().Get("from_date")
+	toDate := r.URL.Query().Get("to_date")
+	if (fromDate == "") != (toDate == "") {
+		respondWithError(w, http.StatusBadRequest, "from_date and to_date must be given together")
+		return
+	}
+	if fromDate != "" {
+		if _, err := time.Parse("2006-01-02", fromDate); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid from_date format. Use YYYY-MM-DD")
+			return
+		}
+		if _, err := time.Parse("2006-01-02", toDate); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid to_date format. Use YYYY-MM-DD")
+			return
+		}
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		respondWithError(w, http.StatusBadRequest, "format must be json or csv")
+		return
+	}
+
+	result, err := h.reportService.RunReport(reportID, fromDate, toDate, r.URL.Query().Get("currency"))
+	if err != nil {
+		respondWithReportError(w, err)
+		return
+	}
+
+	locale := responseLocale(w)
+	result.Labels = make([]string, len(result.Columns))
+	for i, column := range result.Columns {
+		result.Labels[i] = i18n.Label(locale, column)
+	}
+
+	if format == "csv" {
+		formatter, err := currency.NewFormatter(locale, result.Currency)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		respondWithCSV(w, fmt.Sprintf("report-%d.csv", reportID), result, formatter)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, result)
+}
+
+func parseReportID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	reportID, err := strconv.ParseInt(mux.Vars(r)["report_id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid report ID")
+		return 0, false
+	}
+	return reportID, true
+}
+
+func respondWithReportError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidReport):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, repositories.ErrReportNotFound):
+		respondWithError(w, http.StatusNotFound, err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func respondWithCSV(w http.ResponseWriter, filename string, result *models.ReportResult, formatter *currency.Formatter) {
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.WriteHeader(http.StatusOK)
+
+	writer := csv.NewWriter(w)
+	writer.Write(result.Labels)
+	amounts := make([]bool, len(result.Columns))
+	for i, column := range result.Columns {
+		for _, amountColumn := range result.AmountColumns {
+			if column == amountColumn {
+				amounts[i] = true
+			}
+		}
+	}
+
+	record := make([]string, len(result.Columns))
+	for _, row := range result.Rows {
+		for i, value := range row {
+			if amounts[i] {
+				record[i] = formatter.FormatValue(value)
+				continue
+			}
+			record[i] = csvValue(value)
+		}
+		writer.Write(record)
+	}
+
+	// Manual changes to the reported batches follow the rows, after a blank
+	// line, so the exported document carries them too
+	if len(result.Deltas) > 0 {
+		locale := responseLocale(w)
+		writer.Write(nil)
+		writer.Write([]string{i18n.T(locale, "Batch changes")})
+		var labels []string
+		for _, column := range []string{"batch_id", "action", "user_id", "created_at", "summary_before", "summary_after", "changes"} {
+			labels = append(labels, i18n.Label(locale, column))
+		}
+		writer.Write(labels)
+		for _, delta := range result.Deltas {
+			before, _ := json.Marshal(delta.SummaryBefore)
+			after, _ := json.Marshal(delta.SummaryAfter)
+			writer.Write([]string{
+				delta.BatchID,
+				delta.Action,
+				delta.UserID,
+				delta.CreatedAt.Format(time.RFC3339),
+				string(before),
+				string(after),
+				string(delta.Changes),
+			})
+		}
+	}
+	writer.Flush()
+}
+
+func csvValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/pagination"
+	"reconciliation-service/internal/services"
+)
+
+// maxAuditResponse bounds the part of a response read for resource IDs
+const maxAuditResponse = 64 << 10
+
+// auditBody passes a request body through to the handler, hashing all of it
+// and keeping up to limit bytes for the audit
+type auditBody struct {
+	io.ReadCloser
+	hash      hash.Hash
+	captured  bytes.Buffer
+	limit     int
+	size      int64
+	truncated bool
+}
+
+func (b *auditBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.hash.Write(p[:n])
+		b.size += int64(n)
+		if room := b.limit - b.captured.Len(); room > 0 {
+			b.captured.Write(p[:min(n, room)])
+		}
+		if b.size > int64(b.limit) {
+			b.truncated = true
+		}
+	}
+	return n, err
+}
+
+// auditWriter records the status and the start of the response body
+type auditWriter struct {
+	http.ResponseWriter
+	code int
+	body bytes.Buffer
+}
+
+func (w *auditWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *auditWriter) Write(data []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	if room := maxAuditResponse - w.body.Len(); room > 0 {
+		w.body.Write(data[:min(len(data), room)])
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// requestAuditMiddleware records every mutating request once it has been
+// answered: the caller, the body the handler read and the resources named by
+// the route and the response. A failure to record is logged; the response
+// has already been sent.
+func requestAuditMiddleware(auditService *services.RequestAuditService) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+			default:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			body := &auditBody{ReadCloser: r.Body, hash: sha256.New(), limit: auditService.MaxPayload()}
+			r.Body = body
+			aw := &auditWriter{ResponseWriter: w}
+			started := time.Now()
+			next.ServeHTTP(aw, r)
+			if aw.code == 0 {
+				aw.code = http.StatusOK
+			}
+
+			route := r.URL.Path
+			if current := mux.CurrentRoute(r); current != nil {
+				if template, err := current.GetPathTemplate(); err == nil {
+					route = template
+				}
+			}
+			audit := &models.RequestAudit{
+				Method:           r.Method,
+				Route:            route,
+				Path:             r.URL.RequestURI(),
+				Caller:           requestCaller(r),
+				RemoteAddr:       r.RemoteAddr,
+				UserAgent:        truncate(r.UserAgent(), 255),
+				ContentType:      truncate(r.Header.Get("Content-Type"), 255),
+				PayloadBytes:     body.size,
+				PayloadSHA256:    hex.EncodeToString(body.hash.Sum(nil)),
+				PayloadTruncated: body.truncated,
+				ResourceIDs:      resourceIDs(r, aw.body.Bytes()),
+				StatusCode:       aw.code,
+				DurationMS:       time.Since(started).Milliseconds(),
+			}
+			if identity := requestIdentity(r); identity != nil {
+				audit.UserID = identity.Subject
+			}
+			if err := auditService.Record(audit, body.captured.Bytes()); err != nil {
+				log.Printf("failed to record request audit for %s %s: %v", r.Method, r.URL.Path, err)
+			}
+		})
+	}
+}
+
+// resourceIDs collects the route's path variables and the top-level "id" and
+// "*_id" fields of a JSON response object
+func resourceIDs(r *http.Request, response []byte) map[string]string {
+	ids := make(map[string]string)
+	for name, value := range mux.Vars(r) {
+		ids[name] = value
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(response))
+	decoder.UseNumber()
+	var fields map[string]interface{}
+	if decoder.Decode(&fields) == nil {
+		for name, value := range fields {
+			if name != "id" && !strings.HasSuffix(name, "_id") {
+				continue
+			}
+			switch v := value.(type) {
+			case string:
+				if v != "" {
+					ids[name] = v
+				}
+			case json.Number:
+				ids[name] = v.String()
+			}
+		}
+	}
+	return ids
+}
+
+func truncate(value string, length int) string {
+	if len(value) > length {
+		return value[:length]
+	}
+	return value
+}
+
+type RequestAuditHandler struct {
+	requestAuditService *services.RequestAuditService
+}
+
+func NewRequestAuditHandler(requestAuditService *services.RequestAuditService) *RequestAuditHandler {
+	return &RequestAuditHandler{
+		requestAuditService: requestAuditService,
+	}
+}
+
+// ListRequests searches the request audit trail, newest first. Pass the
+// next_cursor of a page as cursor, or its last ID as before_id, to get the
+// next one.
+func (h *RequestAuditHandler) ListRequests(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := models.RequestAuditFilter{
+		UserID: query.Get("user_id"),
+		Route:  query.Get("route"),
+		Method: query.Get("method"),
+		From:   query.Get("from_date"),
+		To:     query.Get("to_date"),
+	}
+	var err error
+	if filter.BeforeID, err = int64Query(query.Get("before_id")); err != nil {
+		respondWithError(w, http.StatusBadRequest, "before_id must be a number")
+		return
+	}
+	if filter.Limit, err = intQuery(query.Get("limit"), 0); err != nil {
+		respondWithError(w, http.StatusBadRequest, "limit must be a number")
+		return
+	}
+
+	audits, next, err := h.requestAuditService.ListRequests(filter, query.Get("cursor"))
+	if errors.Is(err, services.ErrInvalidRequestAuditQuery) || errors.Is(err, pagination.ErrInvalidCursor) {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, withNextCursor(map[string]interface{}{
+		"request_audits": audits,
+	}, next))
+}
+
+func int64Query(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"reconciliation-service/internal/pagination"
+	"reconciliation-service/internal/repositories"
+	"reconciliation-service/internal/services"
+)
+
+type RetentionHandler struct {
+	retentionService *services.RetentionService
+}
+
+func NewRetentionHandler(retentionService *services.RetentionService) *RetentionHandler {
+	return &RetentionHandler{
+		retentionService: retentionService,
+	}
+}
+
+type retentionPolicyRequest struct {
+	RetentionDays *int   `json:"retention_days"`
+	UserID        string `json:"user_id"`
+}
+
+func (h *RetentionHandler) ListPolicies(w http.ResponseWriter, r *http.Request) {
+	policies, err := h.retentionService.ListPolicies()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"policies": policies,
+	})
+}
+
+func (h *RetentionHandler) SetPolicy(w http.ResponseWriter, r *http.Request) {
+	var req retentionPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.RetentionDays == nil {
+		respondWithError(w, http.StatusBadRequest, "retention_days is required")
+		return
+	}
+
+	policy, err := h.retentionService.SetPolicy(mux.Vars(r)["data_class"], *req.RetentionDays, actingUser(r, req.UserID))
+	if err != nil {
+		respondWithRetentionError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, policy)
+}
+
+// DryRun reports what a purge would delete now, without deleting anything
+func (h *RetentionHandler) DryRun(w http.ResponseWriter, r *http.Request) {
+	h.run(w, r, true)
+}
+
+// Purge deletes every record past its retention policy now, instead of
+// waiting for the purger
+func (h *RetentionHandler) Purge(w http.ResponseWriter, r *http.Request) {
+	h.run(w, r, false)
+}
+
+func (h *RetentionHandler) run(w http.ResponseWriter, r *http.Request, dryRun bool) {
+	run, err := h.retentionService.Run(r.Context(), dryRun, requestCaller(r))
+	if err != nil {
+		respondWithRetentionError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, run)
+}
+
+// ListRuns lists the latest purges and dry runs with what each found
+func (h *RetentionHandler) ListRuns(w http.ResponseWriter, r *http.Request) {
+	limit, err := intQuery(r.URL.Query().Get("limit"), 0)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "limit must be a number")
+		return
+	}
+
+	runs, next, err := h.retentionService.ListRuns(r.URL.Query().Get("cursor"), limit)
+	if err != nil {
+		respondWithRetentionError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, withNextCursor(map[string]interface{}{
+		"runs": runs,
+	}, next))
+}
+
+func respondWithRetentionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidRetention), errors.Is(err, pagination.ErrInvalidCursor):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, repositories.ErrRetentionPolicyNotFound):
+		respondWithError(w, http.StatusNotFound, err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"reconciliation-service/internal/pagination"
+	"reconciliation-service/internal/services"
+)
+
+type ReturnHandler struct {
+	returnService *services.ReturnService
+}
+
+func NewReturnHandler(returnService *services.ReturnService) *ReturnHandler {
+	return &ReturnHandler{
+		returnService: returnService,
+	}
+}
+
+// ListReturns lists the latest returns linked to the transactions they give
+// back
+func (h *ReturnHandler) ListReturns(w http.ResponseWriter, r *http.Request) {
+	limit, err := intQuery(r.URL.Query().Get("limit"), services.DefaultReturnLimit)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "limit must be a number")
+		return
+	}
+
+	returns, next, err := h.returnService.ListReturns(r.URL.Query().Get("cursor"), limit)
+	if err != nil {
+		respondWithReturnError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, withNextCursor(map[string]interface{}{
+		"returns": returns,
+	}, next))
+}
+
+// ReturnRates reports per counterparty how many of its transactions between
+// from_date and to_date were returned
+func (h *ReturnHandler) ReturnRates(w http.ResponseWriter, r *http.Request) {
+	fromDate := r.URL.Query().Get("from_date")
+	toDate := r.URL.Query().Get("to_date")
+	if fromDate == "" || toDate == "" {
+		respondWithError(w, http.StatusBadRequest, "Both from_date and to_date query parameters are required")
+		return
+	}
+
+	rates, err := h.returnService.ReturnRates(fromDate, toDate)
+	if err != nil {
+		respondWithReturnError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"from_date": fromDate,
+		"to_date":   toDate,
+		"rates":     rates,
+	})
+}
+
+func respondWithReturnError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidReturnQuery), errors.Is(err, pagination.ErrInvalidCursor):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"reconciliation-service/internal/pagination"
+	"reconciliation-service/internal/services"
+)
+
+type ReviewHandler struct {
+	reconciliationService *services.ReconciliationService
+}
+
+func NewReviewHandler(reconciliationService *services.ReconciliationService) *ReviewHandler {
+	return &ReviewHandler{
+		reconciliationService: reconciliationService,
+	}
+}
+
+// ListPendingReview lists the matches waiting for review oldest first,
+// optionally of one batch
+func (h *ReviewHandler) ListPendingReview(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, err := intQuery(query.Get("limit"), 0)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "limit must be a number")
+		return
+	}
+
+	matches, next, err := h.reconciliationService.ListPendingReview(query.Get("batch_id"), query.Get("cursor"), limit)
+	if err != nil {
+		respondWithReviewError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, withNextCursor(map[string]interface{}{
+		"matches": matches,
+	}, next))
+}
+
+type reviewRequest struct {
+	Version int    `json:"version"`
+	UserID  string `json:"user_id"`
+	Reason  string `json:"reason"`
+}
+
+// ApproveMatch makes a match pending review matched
+func (h *ReviewHandler) ApproveMatch(w http.ResponseWriter, r *http.Request) {
+	h.review(w, r, services.ReviewApprove)
+}
+
+// RejectMatch releases the records of a match pending review and leaves it
+// unmatched
+func (h *ReviewHandler) RejectMatch(w http.ResponseWriter, r *http.Request) {
+	h.review(w, r, services.ReviewReject)
+}
+
+func (h *ReviewHandler) review(w http.ResponseWriter, r *http.Request, decision string) {
+	id, ok := parseRecordID(w, r)
+	if !ok {
+		return
+	}
+
+	var req reviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	reconciliation, err := h.reconciliationService.ReviewMatch(id, decision, req.Version, actingUser(r, req.UserID), req.Reason)
+	if err != nil {
+		respondWithReviewError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, reconciliation)
+}
+
+type bulkReviewRequest struct {
+	Decision string  `json:"decision"`
+	IDs      []int64 `json:"ids"`
+	UserID   string  `json:"user_id"`
+	Reason   string  `json:"reason"`
+}
+
+// ReviewMatches approves or rejects several matches pending review, each on
+// its own, and reports what became of every one
+func (h *ReviewHandler) ReviewMatches(w http.ResponseWriter, r *http.Request) {
+	var req bulkReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	outcomes, err := h.reconciliationService.ReviewMatches(req.IDs, req.Decision, actingUser(r, req.UserID), req.Reason)
+	if err != nil {
+		respondWithReviewError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"decision": req.Decision,
+		"results":  outcomes,
+	})
+}
+
+func respondWithReviewError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidReview), errors.Is(err, pagination.ErrInvalidCursor):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrNotPendingReview):
+		respondWithError(w, http.StatusConflict, err.Error())
+	default:
+		respondWithRecordError(w, err)
+	}
+}
@@ -1,75 +1,338 @@
 package handlers
 
 import (
-	"database/sql"
+	"log/slog"
 	"net/http"
 
 	"github.com/gorilla/mux"
 
 	"reconciliation-service/internal/config"
-	"reconciliation-service/internal/repositories"
+	"reconciliation-service/internal/i18n"
+	"reconciliation-service/internal/models"
 	"reconciliation-service/internal/services"
 )
 
-func SetupRouter(db *sql.DB, cfg *config.Config) *mux.Router {
+// exportDownloadPath is the signed export download, the one API path routed
+// ahead of the API subrouter
+const exportDownloadPath = "/api/v1/exports/{id:[0-9]+}/download"
+
+// emailInboundPath receives statement emails from the email provider, which
+// signs them instead of holding a token
+const emailInboundPath = "/api/v1/ingestion/email"
+
+func SetupRouter(svc *services.Services, latency config.LatencyConfig, docs config.OpenAPIConfig, logger *slog.Logger) *mux.Router {
 	router := mux.NewRouter()
 
-	// Initialize repositories
-	bankRepo := repositories.NewBankRepository(db)
-	accountingRepo := repositories.NewAccountingRepository(db)
-	reconciliationRepo := repositories.NewReconciliationRepository(db)
-
-	// Initialize services
-	reconciliationService := services.NewReconciliationService(
-		db,
-		bankRepo,
-		accountingRepo,
-		reconciliationRepo,
-	)
-
-	dataIngestionService := services.NewDataIngestionService(
-		db,
-		bankRepo,
-		accountingRepo,
-		reconciliationRepo,
-	)
+	// Every route, the public ones included, is identified and logged
+	router.Use(requestIDMiddleware)
+	router.Use(loggingMiddleware(logger))
 
 	// Initialize handlers
-	reconciliationHandler := NewReconciliationHandler(reconciliationService)
-	dataHandler := NewDataHandler(dataIngestionService)
+	usageHandler := NewUsageHandler(svc.Usage)
+	maintenanceHandler := NewMaintenanceHandler(svc.Maintenance)
+	failoverHandler := NewFailoverHandler(svc.Failover, svc.Access)
+	reconciliationHandler := NewReconciliationHandler(svc.Reconciliation, usageHandler, svc.Jobs, svc.Idempotency, latency.AsyncHandoff)
+	reviewHandler := NewReviewHandler(svc.Reconciliation)
+	dataHandler := NewDataHandler(svc.DataIngestion, usageHandler, svc.Jobs)
+	jobHandler := NewJobHandler(svc.Jobs, svc.Heartbeats)
+	partitionHandler := NewPartitionHandler(svc.Partitions)
+	queueHandler := NewQueueHandler(svc.Queue)
+	snapshotHandler := NewSnapshotHandler(svc.Snapshots, svc.Artifacts)
+	reportHandler := NewReportHandler(svc.Reports)
+	calendarHandler := NewCalendarHandler(svc.Calendars)
+	notificationHandler := NewNotificationHandler(svc.Notifications)
+	counterpartyHandler := NewCounterpartyHandler(svc.Counterparties)
+	aliasHandler := NewAliasHandler(svc.Aliases)
+	fxRateHandler := NewFXRateHandler(svc.FXRates)
+	feeHandler := NewFeeHandler(svc.Fees)
+	expectationHandler := NewExpectationHandler(svc.Expectations)
+	returnHandler := NewReturnHandler(svc.Returns)
+	budgetHandler := NewBudgetHandler(svc.Budgets)
+	exceptionHandler := NewExceptionHandler(svc.Exceptions)
+	unmatchedItemHandler := NewUnmatchedItemHandler(svc.UnmatchedItems)
+	analyticsHandler := NewAnalyticsHandler(svc.Analytics)
+	digestHandler := NewDigestHandler(svc.Digests)
+	requestAuditHandler := NewRequestAuditHandler(svc.RequestAudits)
+	scheduleHandler := NewScheduleHandler(svc.Schedules)
+	exportHandler := NewExportHandler(svc.Reconciliation, svc.Exports)
+	artifactHandler := NewArtifactHandler(svc.Artifacts)
+	retentionHandler := NewRetentionHandler(svc.Retention)
+	policyPackHandler := NewPolicyPackHandler(svc.PolicyPacks)
+	legalHoldHandler := NewLegalHoldHandler(svc.LegalHolds)
+	integrityHandler := NewIntegrityHandler(svc.Integrity)
+	ingestionFileHandler := NewIngestionFileHandler(svc.Fetches, svc.ObjectFetches, svc.Emails)
+	webhookHandler := NewWebhookHandler(svc.Webhooks)
+	apiKeyHandler := NewAPIKeyHandler(svc.APIKeys)
+	shadowHandler := NewShadowHandler(svc.Shadows)
+	ruleSetHandler := NewRuleSetHandler(svc.RuleSets)
+	configHandler := NewConfigHandler(svc.ConfigBundles)
+	fixtureHandler := NewFixtureHandler(svc.Fixtures)
+	sandboxHandler := NewSandboxHandler(svc.Sandbox)
+	suggestionHandler := NewSuggestionHandler(svc.Suggestions)
+	metricsHandler := NewMetricsHandler(svc.Metrics)
+	safetyHandler := NewSafetyHandler(svc.Safety)
+	guard := safetyHandler.Guard
+	accessHandler := NewAccessHandler(svc.Access)
+	viewer := accessHandler.Require(models.RoleViewer)
+	operator := accessHandler.Require(models.RoleOperator)
+	admin := accessHandler.Require(models.RoleAdmin)
+
+	// Signed export downloads carry their own authorization, so they are
+	// routed ahead of the API and its bearer token middleware
+	router.HandleFunc(exportDownloadPath, exportHandler.Download).Methods(http.MethodGet)
+	router.HandleFunc(emailInboundPath, ingestionFileHandler.ReceiveEmail).Methods(http.MethodPost)
+
+	// The API contract is public, like the health check
+	router.HandleFunc(openAPIPath, openAPIHandler(router, svc.Auth != nil)).Methods(http.MethodGet)
+	if docs.SwaggerUI {
+		router.HandleFunc(swaggerUIPath, swaggerUIHandler).Methods(http.MethodGet)
+	}
 
 	// API versioning
 	api := router.PathPrefix("/api/v1").Subrouter()
 
 	// Middleware
-	api.Use(loggingMiddleware)
 	api.Use(jsonContentTypeMiddleware)
+	api.Use(localeMiddleware(svc.Locales))
+	api.Use(authMiddleware(svc.Auth, svc.APIKeys))
+	api.Use(failoverHandler.ReadOnlyMiddleware)
+	api.Use(requestAuditMiddleware(svc.RequestAudits))
+	api.Use(latencyMiddleware(latencyBudgets{fallback: latency.DefaultBudget, routes: latency.RouteBudgets}))
+	api.Use(maintenanceHandler.MaintenanceMiddleware)
+	api.Use(usageHandler.QuotaMiddleware)
+	api.Use(batchReferenceMiddleware(svc.Reconciliation))
 
 	// Reconciliation endpoints
-	api.HandleFunc("/reconciliation/start", reconciliationHandler.StartReconciliation).Methods(http.MethodPost)
-	api.HandleFunc("/reconciliation/{batch_id}/status", reconciliationHandler.GetReconciliationStatus).Methods(http.MethodGet)
-	api.HandleFunc("/reconciliation/{batch_id}/resolve", reconciliationHandler.ResolveDispute).Methods(http.MethodPost)
-	api.HandleFunc("/reconciliation/unmatched", reconciliationHandler.GetUnmatchedRecords).Methods(http.MethodGet)
+	api.HandleFunc("/reconciliation/start", operator(reconciliationHandler.StartReconciliation)).Methods(http.MethodPost)
+	api.HandleFunc("/reconciliation/{batch_id}/status", viewer(conditionalGet(reconciliationHandler.GetReconciliationStatus))).Methods(http.MethodGet)
+	api.HandleFunc("/reconciliation/{batch_id}/resolve", operator(reconciliationHandler.ResolveDispute)).Methods(http.MethodPost)
+	api.HandleFunc("/reconciliation/{batch_id}/results", viewer(conditionalGet(reconciliationHandler.GetResults))).Methods(http.MethodGet)
+	api.HandleFunc("/reconciliation/{batch_id}/details", viewer(conditionalGet(reconciliationHandler.GetBatchDetails))).Methods(http.MethodGet)
+	api.HandleFunc("/reconciliation/{batch_id}/deltas", viewer(reconciliationHandler.GetBatchDeltas)).Methods(http.MethodGet)
+	api.HandleFunc("/reconciliation/{batch_id}/audit", viewer(reconciliationHandler.GetBatchAudit)).Methods(http.MethodGet)
+	api.HandleFunc("/reconciliation/{batch_id}/report", viewer(exportHandler.BatchReport)).Methods(http.MethodGet)
+	api.HandleFunc("/reconciliation/{batch_id}/shadow", viewer(shadowHandler.GetShadowRuns)).Methods(http.MethodGet)
+	api.HandleFunc("/reconciliation/matches/{id:[0-9]+}/unmatch", operator(guard(services.SafetyOperationUnmatch, reconciliationHandler.UnmatchReconciliation))).Methods(http.MethodPost)
+	api.HandleFunc("/reconciliation/unmatched", viewer(reconciliationHandler.GetUnmatchedRecords)).Methods(http.MethodGet)
+	api.HandleFunc("/reconciliation/unmatched/bulk-action", operator(unmatchedItemHandler.BulkAction)).Methods(http.MethodPost)
+	api.HandleFunc("/reconciliation/pending-review", viewer(reviewHandler.ListPendingReview)).Methods(http.MethodGet)
+	api.HandleFunc("/reconciliation/stats", viewer(analyticsHandler.ReconciliationStats)).Methods(http.MethodGet)
+	api.HandleFunc("/reconciliation/matches/review", operator(reviewHandler.ReviewMatches)).Methods(http.MethodPost)
+	api.HandleFunc("/reconciliation/matches/{id:[0-9]+}/approve", operator(reviewHandler.ApproveMatch)).Methods(http.MethodPost)
+	api.HandleFunc("/reconciliation/matches/{id:[0-9]+}/reject", operator(reviewHandler.RejectMatch)).Methods(http.MethodPost)
+	api.HandleFunc("/reconciliation/suggestions", viewer(suggestionHandler.GetSuggestions)).Methods(http.MethodGet)
+	api.HandleFunc("/reconciliation/queue", operator(queueHandler.EnqueueReconciliation)).Methods(http.MethodPost)
+	api.HandleFunc("/reconciliation/partitioned", operator(partitionHandler.StartPartitionedRun)).Methods(http.MethodPost)
+	api.HandleFunc("/reconciliation/partitioned/{batch_id}", viewer(partitionHandler.GetPartitionedRun)).Methods(http.MethodGet)
+	api.HandleFunc("/audit", viewer(reconciliationHandler.ListAuditTrail)).Methods(http.MethodGet)
+
+	api.HandleFunc("/data/bank-transactions", operator(dataHandler.IngestBankTransactions)).Methods(http.MethodPost)
+	api.HandleFunc("/data/bank-statements", operator(dataHandler.IngestStatement)).Methods(http.MethodPost)
+	api.HandleFunc("/data/bank-statements/detect", operator(dataHandler.DetectStatement)).Methods(http.MethodPost)
+	api.HandleFunc("/data/bank-statements/mt940", operator(dataHandler.IngestMT940)).Methods(http.MethodPost)
+	api.HandleFunc("/data/bank-statements/camt053", operator(dataHandler.IngestCAMT053)).Methods(http.MethodPost)
+	api.HandleFunc("/data/accounting-entries", operator(dataHandler.IngestAccountingEntries)).Methods(http.MethodPost)
+	api.HandleFunc("/data/bank-transactions/{id:[0-9]+}", viewer(dataHandler.GetBankTransaction)).Methods(http.MethodGet)
+	api.HandleFunc("/data/bank-transactions/{id:[0-9]+}", operator(dataHandler.CorrectBankTransaction)).Methods(http.MethodPut)
+	api.HandleFunc("/data/accounting-entries/{id:[0-9]+}", viewer(dataHandler.GetAccountingEntry)).Methods(http.MethodGet)
+	api.HandleFunc("/data/accounting-entries/{id:[0-9]+}", operator(dataHandler.CorrectAccountingEntry)).Methods(http.MethodPut)
+	api.HandleFunc("/data/bank-transactions/{id:[0-9]+}/void", operator(reconciliationHandler.VoidBankTransaction)).Methods(http.MethodPost)
+	api.HandleFunc("/data/accounting-entries/{id:[0-9]+}/void", operator(reconciliationHandler.VoidAccountingEntry)).Methods(http.MethodPost)
+	api.HandleFunc("/data/correlations/{correlation_id}", viewer(reconciliationHandler.LookupCorrelation)).Methods(http.MethodGet)
+
+	// Period-end snapshots
+	api.HandleFunc("/snapshots", operator(snapshotHandler.CreateSnapshot)).Methods(http.MethodPost)
+	api.HandleFunc("/snapshots", viewer(snapshotHandler.ListSnapshots)).Methods(http.MethodGet)
+	api.HandleFunc("/snapshots/{snapshot_id}", viewer(snapshotHandler.GetSnapshot)).Methods(http.MethodGet)
+	api.HandleFunc("/snapshots/{snapshot_id}/journal", viewer(snapshotHandler.GetJournal)).Methods(http.MethodGet)
+	api.HandleFunc("/artifacts/verify", viewer(artifactHandler.VerifyArtifact)).Methods(http.MethodPost)
+	api.HandleFunc("/artifacts/{id:[0-9]+}", viewer(artifactHandler.GetArtifact)).Methods(http.MethodGet)
+
+	// Custom reports
+	api.HandleFunc("/reports/sources", viewer(reportHandler.ListSources)).Methods(http.MethodGet)
+	api.HandleFunc("/reports", operator(reportHandler.CreateReport)).Methods(http.MethodPost)
+	api.HandleFunc("/reports", viewer(reportHandler.ListReports)).Methods(http.MethodGet)
+	api.HandleFunc("/reports/{report_id:[0-9]+}", viewer(reportHandler.GetReport)).Methods(http.MethodGet)
+	api.HandleFunc("/reports/{report_id:[0-9]+}", operator(reportHandler.UpdateReport)).Methods(http.MethodPut)
+	api.HandleFunc("/reports/{report_id:[0-9]+}", operator(guard(services.SafetyOperationDeleteReport, reportHandler.DeleteReport))).Methods(http.MethodDelete)
+	api.HandleFunc("/reports/{report_id:[0-9]+}/run", viewer(reportHandler.RunReport)).Methods(http.MethodGet)
+
+	// Business calendars
+	api.HandleFunc("/calendars", operator(calendarHandler.CreateCalendar)).Methods(http.MethodPost)
+	api.HandleFunc("/calendars", viewer(calendarHandler.ListCalendars)).Methods(http.MethodGet)
+	api.HandleFunc("/calendars/{code}", viewer(calendarHandler.GetCalendar)).Methods(http.MethodGet)
+	api.HandleFunc("/calendars/{code}", operator(calendarHandler.UpdateCalendar)).Methods(http.MethodPut)
+	api.HandleFunc("/calendars/{code}", operator(guard(services.SafetyOperationDeleteCalendar, calendarHandler.DeleteCalendar))).Methods(http.MethodDelete)
+	api.HandleFunc("/calendars/{code}/holidays", operator(calendarHandler.AddHoliday)).Methods(http.MethodPost)
+	api.HandleFunc("/calendars/{code}/holidays/import", operator(calendarHandler.ImportHolidays)).Methods(http.MethodPost)
+	api.HandleFunc("/calendars/{code}/holidays/{date}", operator(guard(services.SafetyOperationDeleteHoliday, calendarHandler.DeleteHoliday))).Methods(http.MethodDelete)
+	api.HandleFunc("/calendars/{code}/business-days", viewer(calendarHandler.BusinessDays)).Methods(http.MethodGet)
+
+	// Counterparty master data
+	api.HandleFunc("/counterparties", operator(counterpartyHandler.CreateCounterparty)).Methods(http.MethodPost)
+	api.HandleFunc("/counterparties", viewer(counterpartyHandler.ListCounterparties)).Methods(http.MethodGet)
+	api.HandleFunc("/counterparties/{code}", viewer(counterpartyHandler.GetCounterparty)).Methods(http.MethodGet)
+	api.HandleFunc("/counterparties/{code}", operator(counterpartyHandler.UpdateCounterparty)).Methods(http.MethodPut)
+	api.HandleFunc("/counterparties/{code}", operator(guard(services.SafetyOperationDeleteCounterparty, counterpartyHandler.DeleteCounterparty))).Methods(http.MethodDelete)
+
+	// Alias dictionary
+	api.HandleFunc("/aliases", operator(aliasHandler.CreateAlias)).Methods(http.MethodPost)
+	api.HandleFunc("/aliases", viewer(aliasHandler.ListAliases)).Methods(http.MethodGet)
+	api.HandleFunc("/aliases/{id:[0-9]+}", operator(guard(services.SafetyOperationDeleteAlias, aliasHandler.DeleteAlias))).Methods(http.MethodDelete)
+
+	// Exchange rates for matching across currencies
+	api.HandleFunc("/fx-rates", operator(fxRateHandler.SaveRate)).Methods(http.MethodPost)
+	api.HandleFunc("/fx-rates", viewer(fxRateHandler.ListRates)).Methods(http.MethodGet)
+
+	// Bank fee schedules, whose debits batches classify as fees
+	api.HandleFunc("/fee-schedules", operator(feeHandler.CreateSchedule)).Methods(http.MethodPost)
+	api.HandleFunc("/fee-schedules", viewer(feeHandler.ListSchedules)).Methods(http.MethodGet)
+	api.HandleFunc("/fee-schedules/expectations", viewer(feeHandler.Expectations)).Methods(http.MethodGet)
+	api.HandleFunc("/fee-schedules/{id:[0-9]+}", viewer(feeHandler.GetSchedule)).Methods(http.MethodGet)
+	api.HandleFunc("/fee-schedules/{id:[0-9]+}", operator(feeHandler.UpdateSchedule)).Methods(http.MethodPut)
+	api.HandleFunc("/fee-schedules/{id:[0-9]+}", operator(guard(services.SafetyOperationDeleteFeeSchedule, feeHandler.DeleteSchedule))).Methods(http.MethodDelete)
+
+	// Payments registered by upstream systems as expected on the accounts
+	api.HandleFunc("/expectations", operator(expectationHandler.Register)).Methods(http.MethodPost)
+	api.HandleFunc("/expectations", viewer(expectationHandler.ListExpectations)).Methods(http.MethodGet)
+	api.HandleFunc("/expectations/{id:[0-9]+}", viewer(expectationHandler.GetExpectation)).Methods(http.MethodGet)
+	api.HandleFunc("/expectations/{id:[0-9]+}", operator(expectationHandler.Cancel)).Methods(http.MethodDelete)
+
+	// Direct debit and standing order returns linked to their originals
+	api.HandleFunc("/returns", viewer(returnHandler.ListReturns)).Methods(http.MethodGet)
+	api.HandleFunc("/returns/rates", viewer(returnHandler.ReturnRates)).Methods(http.MethodGet)
+
+	// Budget and forecast figures compared with actual cash movement
+	api.HandleFunc("/budgets", operator(budgetHandler.UploadBudgets)).Methods(http.MethodPut)
+	api.HandleFunc("/budgets", viewer(budgetHandler.ListBudgets)).Methods(http.MethodGet)
+	api.HandleFunc("/budgets/variance", viewer(budgetHandler.Variance)).Methods(http.MethodGet)
+	api.HandleFunc("/budgets/{id:[0-9]+}", operator(budgetHandler.DeleteBudget)).Methods(http.MethodDelete)
+
+	// Exception queue of records left unmatched, worked through its states
+	api.HandleFunc("/exceptions", viewer(exceptionHandler.ListExceptions)).Methods(http.MethodGet)
+	api.HandleFunc("/exceptions/{id:[0-9]+}", viewer(exceptionHandler.GetException)).Methods(http.MethodGet)
+	api.HandleFunc("/exceptions/{id:[0-9]+}/transition", operator(exceptionHandler.Transition)).Methods(http.MethodPost)
+	api.HandleFunc("/exceptions/{id:[0-9]+}/assign", operator(exceptionHandler.Assign)).Methods(http.MethodPost)
+	api.HandleFunc("/exceptions/{id:[0-9]+}/comments", operator(exceptionHandler.AddComment)).Methods(http.MethodPost)
+
+	// Cash analytics from statement balances and outstanding items
+	api.HandleFunc("/analytics/cash-position", viewer(analyticsHandler.CashPosition)).Methods(http.MethodGet)
+
+	// Daily digest of ingestion, matching and what is left unmatched
+	api.HandleFunc("/digest/daily", viewer(digestHandler.Daily)).Methods(http.MethodGet)
+
+	// Scheduled reconciliations
+	api.HandleFunc("/schedules", operator(scheduleHandler.CreateSchedule)).Methods(http.MethodPost)
+	api.HandleFunc("/schedules", viewer(scheduleHandler.ListSchedules)).Methods(http.MethodGet)
+	api.HandleFunc("/schedules/{id:[0-9]+}", viewer(scheduleHandler.GetSchedule)).Methods(http.MethodGet)
+	api.HandleFunc("/schedules/{id:[0-9]+}", operator(scheduleHandler.UpdateSchedule)).Methods(http.MethodPut)
+	api.HandleFunc("/schedules/{id:[0-9]+}", operator(guard(services.SafetyOperationDeleteSchedule, scheduleHandler.DeleteSchedule))).Methods(http.MethodDelete)
+	api.HandleFunc("/schedules/{id:[0-9]+}/runs", viewer(scheduleHandler.ListRuns)).Methods(http.MethodGet)
+
+	// Exports written in the background
+	api.HandleFunc("/exports/{id:[0-9]+}", viewer(exportHandler.GetExport)).Methods(http.MethodGet)
 
-	api.HandleFunc("/data/bank-transactions", dataHandler.IngestBankTransactions).Methods(http.MethodPost)
-	api.HandleFunc("/data/accounting-entries", dataHandler.IngestAccountingEntries).Methods(http.MethodPost)
+	// Matching rules and their changelog
+	api.HandleFunc("/rules", viewer(ruleSetHandler.GetActiveRules)).Methods(http.MethodGet)
+	api.HandleFunc("/rules/changes", operator(ruleSetHandler.ProposeChange)).Methods(http.MethodPost)
+	api.HandleFunc("/rules/changes", viewer(ruleSetHandler.ListChanges)).Methods(http.MethodGet)
+	api.HandleFunc("/rules/changes/{id:[0-9]+}", viewer(ruleSetHandler.GetChange)).Methods(http.MethodGet)
+	api.HandleFunc("/rules/changes/{id:[0-9]+}/approve", admin(ruleSetHandler.ApproveChange)).Methods(http.MethodPost)
+	api.HandleFunc("/rules/changes/{id:[0-9]+}/reject", admin(ruleSetHandler.RejectChange)).Methods(http.MethodPost)
+
+	// Shadow evaluation of candidate matching rules
+	api.HandleFunc("/shadow/candidates", operator(shadowHandler.CreateCandidate)).Methods(http.MethodPost)
+	api.HandleFunc("/shadow/candidates", viewer(shadowHandler.ListCandidates)).Methods(http.MethodGet)
+	api.HandleFunc("/shadow/candidates/{version}", operator(shadowHandler.UpdateCandidate)).Methods(http.MethodPut)
+	api.HandleFunc("/shadow/candidates/{version}", operator(guard(services.SafetyOperationDeleteShadowCandidate, shadowHandler.DeleteCandidate))).Methods(http.MethodDelete)
+	api.HandleFunc("/shadow/runs/{id:[0-9]+}/matches", viewer(shadowHandler.GetShadowMatches)).Methods(http.MethodGet)
+
+	// Notification preferences
+	api.HandleFunc("/notifications/preferences/{user_id}", viewer(notificationHandler.GetPreferences)).Methods(http.MethodGet)
+	api.HandleFunc("/notifications/preferences/{user_id}", operator(notificationHandler.SavePreferences)).Methods(http.MethodPut)
+	api.HandleFunc("/notifications/preferences/{user_id}", operator(guard(services.SafetyOperationDeleteNotificationPrefs, notificationHandler.DeletePreferences))).Methods(http.MethodDelete)
+	api.HandleFunc("/notifications/routes", viewer(notificationHandler.GetRoutes)).Methods(http.MethodGet)
+	api.HandleFunc("/notifications/dispatches", operator(notificationHandler.Dispatch)).Methods(http.MethodPost)
+
+	// Usage and quota endpoints
+	api.HandleFunc("/usage", viewer(usageHandler.GetUsage)).Methods(http.MethodGet)
+	api.HandleFunc("/usage/entities", admin(usageHandler.ListUsage)).Methods(http.MethodGet)
+	api.HandleFunc("/usage/quotas/{entity}", admin(usageHandler.SetQuota)).Methods(http.MethodPut)
+
+	// Sandbox of integrating teams
+	api.HandleFunc("/sandbox", viewer(sandboxHandler.Status)).Methods(http.MethodGet)
+	api.HandleFunc("/sandbox/reset", operator(sandboxHandler.Reset)).Methods(http.MethodPost)
+
+	// Caller identity and role assignments
+	api.HandleFunc("/me", accessHandler.Me).Methods(http.MethodGet)
+	api.HandleFunc("/admin/roles", admin(accessHandler.ListRoles)).Methods(http.MethodGet)
+	api.HandleFunc("/admin/users", admin(accessHandler.ListUsers)).Methods(http.MethodGet)
+	api.HandleFunc("/admin/users/{user_id}", admin(accessHandler.GetUser)).Methods(http.MethodGet)
+	api.HandleFunc("/admin/users/{user_id}", admin(accessHandler.SaveUser)).Methods(http.MethodPut)
+	api.HandleFunc("/admin/users/{user_id}", admin(accessHandler.DeleteUser)).Methods(http.MethodDelete)
+
+	// Admin endpoints
+	api.HandleFunc("/admin/maintenance", admin(maintenanceHandler.GetMaintenanceMode)).Methods(http.MethodGet)
+	api.HandleFunc("/admin/maintenance", admin(maintenanceHandler.SetMaintenanceMode)).Methods(http.MethodPut)
+	api.HandleFunc("/admin/config/export", admin(configHandler.ExportConfig)).Methods(http.MethodGet)
+	api.HandleFunc("/admin/config/import", admin(guard(services.SafetyOperationConfigImport, configHandler.ImportConfig))).Methods(http.MethodPost)
+	api.HandleFunc("/admin/fixtures/export", admin(fixtureHandler.ExportFixture)).Methods(http.MethodGet)
+	api.HandleFunc("/admin/fixtures/import", admin(fixtureHandler.ImportFixture)).Methods(http.MethodPost)
+	api.HandleFunc("/admin/safety/overrides", admin(safetyHandler.ListOverrides)).Methods(http.MethodGet)
+	api.HandleFunc("/admin/request-audits", admin(requestAuditHandler.ListRequests)).Methods(http.MethodGet)
+	api.HandleFunc("/admin/retention/policies", admin(retentionHandler.ListPolicies)).Methods(http.MethodGet)
+	api.HandleFunc("/admin/retention/policies/{data_class}", admin(retentionHandler.SetPolicy)).Methods(http.MethodPut)
+	api.HandleFunc("/admin/retention/dry-run", admin(retentionHandler.DryRun)).Methods(http.MethodPost)
+	api.HandleFunc("/admin/retention/purge", admin(guard(services.SafetyOperationRetentionPurge, retentionHandler.Purge))).Methods(http.MethodPost)
+	api.HandleFunc("/admin/retention/runs", admin(retentionHandler.ListRuns)).Methods(http.MethodGet)
+	api.HandleFunc("/policy-packs", viewer(policyPackHandler.ListPolicyPacks)).Methods(http.MethodGet)
+	api.HandleFunc("/admin/policy-packs/assignments", admin(policyPackHandler.AssignPolicyPack)).Methods(http.MethodPut)
+	api.HandleFunc("/admin/legal-holds", admin(legalHoldHandler.PlaceHold)).Methods(http.MethodPost)
+	api.HandleFunc("/admin/legal-holds", admin(legalHoldHandler.ListHolds)).Methods(http.MethodGet)
+	api.HandleFunc("/admin/legal-holds/audit", admin(legalHoldHandler.ListAudit)).Methods(http.MethodGet)
+	api.HandleFunc("/admin/legal-holds/{id:[0-9]+}", admin(legalHoldHandler.GetHold)).Methods(http.MethodGet)
+	api.HandleFunc("/admin/legal-holds/{id:[0-9]+}", admin(guard(services.SafetyOperationLiftLegalHold, legalHoldHandler.LiftHold))).Methods(http.MethodDelete)
+	api.HandleFunc("/admin/integrity/check", admin(integrityHandler.Check)).Methods(http.MethodPost)
+	api.HandleFunc("/admin/integrity/runs", admin(integrityHandler.ListRuns)).Methods(http.MethodGet)
+	api.HandleFunc("/admin/integrity/findings", admin(integrityHandler.ListFindings)).Methods(http.MethodGet)
+	api.HandleFunc("/admin/integrity/findings/{id:[0-9]+}/repair", admin(guard(services.SafetyOperationIntegrityRepair, integrityHandler.RepairFinding))).Methods(http.MethodPost)
+	api.HandleFunc("/admin/ingestion-files", admin(ingestionFileHandler.ListFiles)).Methods(http.MethodGet)
+	api.HandleFunc("/admin/ingestion-files/fetch", admin(ingestionFileHandler.Fetch)).Methods(http.MethodPost)
+	api.HandleFunc("/admin/ingestion-files/fetch-s3", admin(ingestionFileHandler.FetchObjects)).Methods(http.MethodPost)
+	api.HandleFunc("/admin/ingestion-emails", admin(ingestionFileHandler.ListEmails)).Methods(http.MethodGet)
+	// Endpoints told of ingestion anomalies
+	api.HandleFunc("/admin/webhooks", admin(webhookHandler.CreateEndpoint)).Methods(http.MethodPost)
+	api.HandleFunc("/admin/webhooks", admin(webhookHandler.ListEndpoints)).Methods(http.MethodGet)
+	api.HandleFunc("/admin/webhooks/deliveries", admin(webhookHandler.ListDeliveries)).Methods(http.MethodGet)
+	api.HandleFunc("/admin/webhooks/{id:[0-9]+}", admin(webhookHandler.GetEndpoint)).Methods(http.MethodGet)
+	api.HandleFunc("/admin/webhooks/{id:[0-9]+}", admin(webhookHandler.UpdateEndpoint)).Methods(http.MethodPut)
+	api.HandleFunc("/admin/webhooks/{id:[0-9]+}", admin(webhookHandler.DeleteEndpoint)).Methods(http.MethodDelete)
+	// API keys of machine callers
+	api.HandleFunc("/admin/api-keys", admin(apiKeyHandler.IssueKey)).Methods(http.MethodPost)
+	api.HandleFunc("/admin/api-keys", admin(apiKeyHandler.ListKeys)).Methods(http.MethodGet)
+	api.HandleFunc("/admin/api-keys/{id:[0-9]+}", admin(apiKeyHandler.GetKey)).Methods(http.MethodGet)
+	api.HandleFunc("/admin/api-keys/{id:[0-9]+}/rotate", admin(apiKeyHandler.RotateKey)).Methods(http.MethodPost)
+	api.HandleFunc("/admin/api-keys/{id:[0-9]+}/revoke", admin(apiKeyHandler.RevokeKey)).Methods(http.MethodPost)
+	api.HandleFunc("/admin/failover", admin(failoverHandler.GetStatus)).Methods(http.MethodGet)
+	api.HandleFunc("/admin/jobs", operator(jobHandler.ListJobs)).Methods(http.MethodGet)
+	api.HandleFunc("/admin/jobs/{id:[0-9]+}", operator(jobHandler.GetJob)).Methods(http.MethodGet)
+	api.HandleFunc("/admin/jobs/stuck", operator(jobHandler.GetStuckJobs)).Methods(http.MethodGet)
+	api.HandleFunc("/admin/workers", operator(jobHandler.ListWorkers)).Methods(http.MethodGet)
+	api.HandleFunc("/admin/queue", operator(queueHandler.GetQueue)).Methods(http.MethodGet)
+	api.HandleFunc("/admin/queue/reorder", admin(queueHandler.Reorder)).Methods(http.MethodPost)
+	api.HandleFunc("/admin/queue/{job_id}", admin(queueHandler.SetPriority)).Methods(http.MethodPatch)
 
 	// Health check endpoint
 	router.HandleFunc("/health", healthCheckHandler).Methods(http.MethodGet)
 
+	// Operator backlog for Prometheus, guarded by METRICS_TOKEN when set
+	router.HandleFunc("/metrics", metricsHandler.GetMetrics).Methods(http.MethodGet)
+
 	return router
 }
 
 // Middleware functions
 
-func loggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Log the request
-		// log.Printf("%s %s %s", r.RemoteAddr, r.Method, r.URL)
-		next.ServeHTTP(w, r)
-	})
-}
-
 func jsonContentTypeMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -77,6 +340,52 @@ func jsonContentTypeMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// localeMiddleware announces the response language in Content-Language, which
+// respondWithError and report exports read back to localize their output
+func localeMiddleware(resolver *i18n.Resolver) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Language", resolver.Resolve(r.Header.Get("Accept-Language"), requestTenant(r)))
+			w.Header().Add("Vary", "Accept-Language")
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// batchReferenceMiddleware lets every route naming a {batch_id} take the
+// external reference the batch was started with in its place
+func batchReferenceMiddleware(reconciliationService *services.ReconciliationService) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			vars := mux.Vars(r)
+			if id := vars["batch_id"]; id != "" {
+				batchID, err := reconciliationService.ResolveBatchID(id)
+				if err != nil {
+					respondWithError(w, http.StatusInternalServerError, err.Error())
+					return
+				}
+				if batchID != id {
+					resolved := make(map[string]string, len(vars))
+					for name, value := range vars {
+						resolved[name] = value
+					}
+					resolved["batch_id"] = batchID
+					r = mux.SetURLVars(r, resolved)
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// responseLocale returns the locale chosen by localeMiddleware
+func responseLocale(w http.ResponseWriter) string {
+	if locale := w.Header().Get("Content-Language"); locale != "" {
+		return locale
+	}
+	return i18n.DefaultLocale
+}
+
 func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
 	response := map[string]string{
 		"status": "healthy",
@@ -85,7 +394,8 @@ func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 type ErrorResponse struct {
-	Error string `json:"error"`
+	Error     string `json:"error"`
+	RequestID string `json:"request_id,omitempty"`
 }
 
 type SuccessResponse struct {
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+	"reconciliation-service/internal/services"
+)
+
+type RuleSetHandler struct {
+	ruleSetService *services.RuleSetService
+}
+
+func NewRuleSetHandler(ruleSetService *services.RuleSetService) *RuleSetHandler {
+	return &RuleSetHandler{
+		ruleSetService: ruleSetService,
+	}
+}
+
+// GetActiveRules returns the rules production matching uses now
+func (h *RuleSetHandler) GetActiveRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := h.ruleSetService.ActiveRules()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, rules)
+}
+
+type ruleChangeRequest struct {
+	Version string          `json:"version"`
+	Rules   json.RawMessage `json:"rules"`
+	Author  string          `json:"author"`
+	Reason  string          `json:"reason"`
+}
+
+// ProposeChange records a pending rule change; it takes effect only once a
+// second operator approves it
+func (h *RuleSetHandler) ProposeChange(w http.ResponseWriter, r *http.Request) {
+	var req ruleChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	change, err := h.ruleSetService.ProposeChange(req.Version, req.Rules, actingUser(r, req.Author), req.Reason)
+	if err != nil {
+		respondWithRuleSetError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, change)
+}
+
+// ListChanges is the changelog of the production rules, newest first
+func (h *RuleSetHandler) ListChanges(w http.ResponseWriter, r *http.Request) {
+	changes, err := h.ruleSetService.ListChanges()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"changes": changes,
+	})
+}
+
+func (h *RuleSetHandler) GetChange(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseRuleSetChangeID(w, r)
+	if !ok {
+		return
+	}
+
+	change, err := h.ruleSetService.GetChange(id)
+	if err != nil {
+		respondWithRuleSetError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, change)
+}
+
+type ruleReviewRequest struct {
+	Reviewer string `json:"reviewer"`
+	Note     string `json:"note"`
+}
+
+func (h *RuleSetHandler) ApproveChange(w http.ResponseWriter, r *http.Request) {
+	h.review(w, r, h.ruleSetService.ApproveChange)
+}
+
+func (h *RuleSetHandler) RejectChange(w http.ResponseWriter, r *http.Request) {
+	h.review(w, r, h.ruleSetService.RejectChange)
+}
+
+func (h *RuleSetHandler) review(w http.ResponseWriter, r *http.Request, decide func(id int64, reviewer, note string) (*models.RuleSetChange, error)) {
+	id, ok := parseRuleSetChangeID(w, r)
+	if !ok {
+		return
+	}
+
+	var req ruleReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	change, err := decide(id, actingUser(r, req.Reviewer), req.Note)
+	if err != nil {
+		respondWithRuleSetError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, change)
+}
+
+func parseRuleSetChangeID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid rule set change ID")
+		return 0, false
+	}
+	return id, true
+}
+
+func respondWithRuleSetError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidRuleSetChange):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrSelfApproval):
+		respondWithError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, repositories.ErrRuleSetChangeNotFound):
+		respondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, repositories.ErrRuleSetConflict),
+		errors.Is(err, repositories.ErrRuleSetChangeNotPending),
+		errors.Is(err, repositories.ErrRuleSetStale):
+		respondWithError(w, http.StatusConflict, err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"reconciliation-service/internal/services"
+)
+
+type SafetyHandler struct {
+	safetyService *services.SafetyService
+}
+
+func NewSafetyHandler(safetyService *services.SafetyService) *SafetyHandler {
+	return &SafetyHandler{
+		safetyService: safetyService,
+	}
+}
+
+// Guard wraps a destructive handler so that in production it only runs with
+// the confirmation token in X-Confirm-Token. A missing token answers 428, a
+// wrong one or none configured 403.
+func (h *SafetyHandler) Guard(operation string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := h.safetyService.Confirm(operation, r.Header.Get("X-Confirm-Token"), r.Method, r.URL.Path, requestCaller(r))
+		switch {
+		case err == nil:
+			next(w, r)
+		case errors.Is(err, services.ErrConfirmationRequired):
+			respondWithError(w, http.StatusPreconditionRequired, err.Error())
+		case errors.Is(err, services.ErrConfirmationInvalid), errors.Is(err, services.ErrConfirmationUnavailable):
+			respondWithError(w, http.StatusForbidden, err.Error())
+		default:
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+		}
+	}
+}
+
+func (h *SafetyHandler) ListOverrides(w http.ResponseWriter, r *http.Request) {
+	overrides, err := h.safetyService.ListOverrides()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve safety overrides")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"guarded":   h.safetyService.Guarded(),
+		"overrides": overrides,
+	})
+}
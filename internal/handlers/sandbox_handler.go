@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"reconciliation-service/internal/repositories"
+	"reconciliation-service/internal/services"
+)
+
+type SandboxHandler struct {
+	sandboxService *services.SandboxService
+}
+
+func NewSandboxHandler(sandboxService *services.SandboxService) *SandboxHandler {
+	return &SandboxHandler{
+		sandboxService: sandboxService,
+	}
+}
+
+// Status returns the sandbox's last reset and when the next one is due
+func (h *SandboxHandler) Status(w http.ResponseWriter, r *http.Request) {
+	if h.sandboxService == nil {
+		respondWithSandboxError(w, services.ErrSandboxDisabled)
+		return
+	}
+
+	status, err := h.sandboxService.Status()
+	if err != nil {
+		respondWithSandboxError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, status)
+}
+
+// Reset wipes the sandbox and generates its data now, instead of waiting for
+// the nightly reset
+func (h *SandboxHandler) Reset(w http.ResponseWriter, r *http.Request) {
+	if h.sandboxService == nil {
+		respondWithSandboxError(w, services.ErrSandboxDisabled)
+		return
+	}
+
+	reset, err := h.sandboxService.Reset(requestCaller(r))
+	if err != nil {
+		respondWithSandboxError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, reset)
+}
+
+// respondWithSandboxError maps sandbox errors; a reset that cannot run now is
+// a 409
+func respondWithSandboxError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrSandboxDisabled):
+		respondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrSandboxResetting), errors.Is(err, repositories.ErrSandboxBusy):
+		respondWithError(w, http.StatusConflict, err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"reconciliation-service/internal/i18n"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/pagination"
+	"reconciliation-service/internal/repositories"
+	"reconciliation-service/internal/services"
+)
+
+type ScheduleHandler struct {
+	scheduleService *services.ScheduleService
+}
+
+func NewScheduleHandler(scheduleService *services.ScheduleService) *ScheduleHandler {
+	return &ScheduleHandler{
+		scheduleService: scheduleService,
+	}
+}
+
+// scheduleRequest is the body of a create or update; a schedule is enabled
+// unless enabled is sent as false
+type scheduleRequest struct {
+	Name           string `json:"name"`
+	CronExpression string `json:"cron_expression"`
+	Period         string `json:"period"`
+	Timezone       string `json:"timezone"`
+	Enabled        *bool  `json:"enabled"`
+	UserID         string `json:"user_id"`
+}
+
+func (req scheduleRequest) schedule() *models.ReconciliationSchedule {
+	sched := &models.ReconciliationSchedule{
+		Name:           req.Name,
+		CronExpression: req.CronExpression,
+		Period:         req.Period,
+		Timezone:       req.Timezone,
+		Enabled:        true,
+	}
+	if req.Enabled != nil {
+		sched.Enabled = *req.Enabled
+	}
+	return sched
+}
+
+func (h *ScheduleHandler) CreateSchedule(w http.ResponseWriter, r *http.Request) {
+	var req scheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	created, err := h.scheduleService.CreateSchedule(req.schedule(), actingUser(r, req.UserID))
+	if err != nil {
+		respondWithScheduleError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, created)
+}
+
+func (h *ScheduleHandler) ListSchedules(w http.ResponseWriter, r *http.Request) {
+	schedules, err := h.scheduleService.ListSchedules()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"schedules": schedules,
+	})
+}
+
+func (h *ScheduleHandler) GetSchedule(w http.ResponseWriter, r *http.Request) {
+	id, ok := scheduleID(w, r)
+	if !ok {
+		return
+	}
+
+	sched, err := h.scheduleService.GetSchedule(id)
+	if err != nil {
+		respondWithScheduleError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, sched)
+}
+
+func (h *ScheduleHandler) UpdateSchedule(w http.ResponseWriter, r *http.Request) {
+	id, ok := scheduleID(w, r)
+	if !ok {
+		return
+	}
+	var req scheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	sched := req.schedule()
+	sched.ID = id
+
+	updated, err := h.scheduleService.UpdateSchedule(sched, actingUser(r, req.UserID))
+	if err != nil {
+		respondWithScheduleError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, updated)
+}
+
+func (h *ScheduleHandler) DeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	id, ok := scheduleID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.scheduleService.DeleteSchedule(id); err != nil {
+		respondWithScheduleError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, SuccessResponse{Message: i18n.T(responseLocale(w), "Schedule deleted")})
+}
+
+// ListRuns lists the latest firings of a schedule and the reconciliations
+// they started
+func (h *ScheduleHandler) ListRuns(w http.ResponseWriter, r *http.Request) {
+	id, ok := scheduleID(w, r)
+	if !ok {
+		return
+	}
+	limit, err := intQuery(r.URL.Query().Get("limit"), 0)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "limit must be a number")
+		return
+	}
+
+	runs, next, err := h.scheduleService.ListRuns(id, r.URL.Query().Get("cursor"), limit)
+	if err != nil {
+		respondWithScheduleError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, withNextCursor(map[string]interface{}{
+		"schedule_id": id,
+		"runs":        runs,
+	}, next))
+}
+
+func scheduleID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid schedule ID")
+		return 0, false
+	}
+	return id, true
+}
+
+func respondWithScheduleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidSchedule), errors.Is(err, pagination.ErrInvalidCursor):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, repositories.ErrScheduleNotFound):
+		respondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, repositories.ErrScheduleConflict):
+		respondWithError(w, http.StatusConflict, err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
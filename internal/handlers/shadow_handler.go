@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"reconciliation-service/internal/i18n"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+	"reconciliation-service/internal/services"
+)
+
+type ShadowHandler struct {
+	shadowService *services.ShadowService
+}
+
+func NewShadowHandler(shadowService *services.ShadowService) *ShadowHandler {
+	return &ShadowHandler{
+		shadowService: shadowService,
+	}
+}
+
+type shadowCandidateRequest struct {
+	Version string          `json:"version"`
+	Rules   json.RawMessage `json:"rules"`
+}
+
+// CreateCandidate registers a candidate rule set. Rules left out of the
+// request keep their production values.
+func (h *ShadowHandler) CreateCandidate(w http.ResponseWriter, r *http.Request) {
+	var req shadowCandidateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	candidate, err := h.shadowService.CreateCandidate(req.Version, req.Rules)
+	if err != nil {
+		respondWithShadowError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, candidate)
+}
+
+func (h *ShadowHandler) ListCandidates(w http.ResponseWriter, r *http.Request) {
+	candidates, err := h.shadowService.ListCandidates()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"candidates": candidates,
+	})
+}
+
+type shadowCandidateUpdateRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// UpdateCandidate pauses or resumes a candidate; its rules are fixed, a
+// changed rule set is a new version
+func (h *ShadowHandler) UpdateCandidate(w http.ResponseWriter, r *http.Request) {
+	var req shadowCandidateUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Enabled == nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	version := mux.Vars(r)["version"]
+	if err := h.shadowService.SetCandidateEnabled(version, *req.Enabled); err != nil {
+		respondWithShadowError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, SuccessResponse{Message: i18n.T(responseLocale(w), "Shadow candidate updated")})
+}
+
+func (h *ShadowHandler) DeleteCandidate(w http.ResponseWriter, r *http.Request) {
+	if err := h.shadowService.DeleteCandidate(mux.Vars(r)["version"]); err != nil {
+		respondWithShadowError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, SuccessResponse{Message: i18n.T(responseLocale(w), "Shadow candidate deleted")})
+}
+
+// GetShadowRuns reports how each candidate did on a batch
+func (h *ShadowHandler) GetShadowRuns(w http.ResponseWriter, r *http.Request) {
+	runs, err := h.shadowService.GetShadowRuns(mux.Vars(r)["batch_id"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve shadow runs")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"shadow_runs": runs,
+	})
+}
+
+// GetShadowMatches lists the would-be matches of a run; agreement=shadow_only
+// narrows them to the ones production did not make
+func (h *ShadowHandler) GetShadowMatches(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid shadow run ID")
+		return
+	}
+	agreement := r.URL.Query().Get("agreement")
+	switch agreement {
+	case "", models.ShadowAgreementAgreed, models.ShadowAgreementShadowOnly:
+	default:
+		respondWithError(w, http.StatusBadRequest, "agreement must be agreed or shadow_only")
+		return
+	}
+
+	matches, err := h.shadowService.GetShadowMatches(id, agreement)
+	if err != nil {
+		respondWithShadowError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"matches": matches,
+	})
+}
+
+func respondWithShadowError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidShadowCandidate):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, repositories.ErrShadowCandidateNotFound),
+		errors.Is(err, repositories.ErrShadowRunNotFound):
+		respondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, repositories.ErrShadowCandidateConflict):
+		respondWithError(w, http.StatusConflict, err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+	"reconciliation-service/internal/services"
+)
+
+type SnapshotHandler struct {
+	snapshotService *services.SnapshotService
+	artifactService *services.ArtifactService
+}
+
+func NewSnapshotHandler(snapshotService *services.SnapshotService, artifactService *services.ArtifactService) *SnapshotHandler {
+	return &SnapshotHandler{
+		snapshotService: snapshotService,
+		artifactService: artifactService,
+	}
+}
+
+type snapshotRequest struct {
+	FromDate  string `json:"from_date"`
+	ToDate    string `json:"to_date"`
+	Label     string `json:"label"`
+	CreatedBy string `json:"created_by"`
+}
+
+func (h *SnapshotHandler) CreateSnapshot(w http.ResponseWriter, r *http.Request) {
+	var request snapshotRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if request.FromDate == "" || request.ToDate == "" {
+		respondWithError(w, http.StatusBadRequest, "Both from_date and to_date are required")
+		return
+	}
+
+	_, err := time.Parse("2006-01-02", request.FromDate)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid from_date format. Use YYYY-MM-DD")
+		return
+	}
+
+	_, err = time.Parse("2006-01-02", request.ToDate)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid to_date format. Use YYYY-MM-DD")
+		return
+	}
+
+	snapshot, err := h.snapshotService.CreateSnapshot(request.FromDate, request.ToDate, request.Label, request.CreatedBy)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// The item list can be large; it is returned by the GET endpoint
+	snapshot.Items = nil
+	respondWithJSON(w, http.StatusCreated, snapshot)
+}
+
+func (h *SnapshotHandler) GetSnapshot(w http.ResponseWriter, r *http.Request) {
+	snapshot, err := h.snapshotService.GetSnapshot(mux.Vars(r)["snapshot_id"])
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, snapshot)
+}
+
+// GetJournal downloads the differences journal stored with a snapshot, as
+// CSV or, with format=pdf, as PDF. The file is registered as a signed
+// artifact, whose ID, hash and signature accompany it in headers.
+func (h *SnapshotHandler) GetJournal(w http.ResponseWriter, r *http.Request) {
+	snapshotID := mux.Vars(r)["snapshot_id"]
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = services.ReportFormatCSV
+	}
+
+	content, err := h.snapshotService.GetJournal(snapshotID, format)
+	switch {
+	case errors.Is(err, services.ErrInvalidJournalFormat):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, repositories.ErrJournalNotFound):
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	case err != nil:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	filename := services.JournalFilename(snapshotID, format)
+	artifact, err := h.artifactService.Sign(models.ArtifactKindDifferencesJournal, snapshotID, format, filename, content)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", services.JournalContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	setArtifactHeaders(w, artifact)
+	w.WriteHeader(http.StatusOK)
+	w.Write(content)
+}
+
+func (h *SnapshotHandler) ListSnapshots(w http.ResponseWriter, r *http.Request) {
+	fromDate := r.URL.Query().Get("from_date")
+	toDate := r.URL.Query().Get("to_date")
+
+	if fromDate == "" || toDate == "" {
+		respondWithError(w, http.StatusBadRequest, "Both from_date and to_date query parameters are required")
+		return
+	}
+
+	snapshots, err := h.snapshotService.ListSnapshots(fromDate, toDate)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"snapshots": snapshots,
+	})
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"reconciliation-service/internal/services"
+)
+
+type SuggestionHandler struct {
+	suggestionService *services.SuggestionService
+}
+
+func NewSuggestionHandler(suggestionService *services.SuggestionService) *SuggestionHandler {
+	return &SuggestionHandler{
+		suggestionService: suggestionService,
+	}
+}
+
+// GetSuggestions lists the unmatched bank transactions of the period with
+// the ledger accounts they are likely to be booked on
+func (h *SuggestionHandler) GetSuggestions(w http.ResponseWriter, r *http.Request) {
+	fromDate := r.URL.Query().Get("from_date")
+	toDate := r.URL.Query().Get("to_date")
+
+	if fromDate == "" || toDate == "" {
+		respondWithError(w, http.StatusBadRequest, "Both from_date and to_date query parameters are required")
+		return
+	}
+	if _, err := time.Parse("2006-01-02", fromDate); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid from_date format. Use YYYY-MM-DD")
+		return
+	}
+	if _, err := time.Parse("2006-01-02", toDate); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid to_date format. Use YYYY-MM-DD")
+		return
+	}
+
+	suggestions, err := h.suggestionService.SuggestAccounts(fromDate, toDate)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"from_date":   fromDate,
+		"to_date":     toDate,
+		"suggestions": suggestions,
+	})
+}
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"reconciliation-service/internal/auth"
+	"reconciliation-service/internal/config"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/services"
+)
+
+type tenantKey struct{}
+
+// tenantRoutePrefixes and tenantRoutes are the API routes whose records are
+// kept per tenant. Every other API route is deployment-wide and answers only
+// for the primary tenant.
+var tenantRoutePrefixes = []string{
+	apiPrefix + "/reconciliation/",
+	apiPrefix + "/data/",
+	apiPrefix + "/analytics/",
+	apiPrefix + "/admin/jobs",
+	apiPrefix + "/admin/queue",
+}
+
+var tenantRoutes = map[string]bool{
+	apiPrefix + "/me":                             true,
+	apiPrefix + "/usage":                          true,
+	apiPrefix + "/reports/sources":                true,
+	apiPrefix + "/reports/{report_id:[0-9]+}/run": true,
+	apiPrefix + "/sandbox":                        true,
+	apiPrefix + "/sandbox/reset":                  true,
+}
+
+// deploymentRoutes are deployment-wide routes below the tenant prefixes:
+// shadow runs, and reports that may be exported by the primary tenant's
+// export worker
+var deploymentRoutes = map[string]bool{
+	apiPrefix + "/reconciliation/{batch_id}/shadow": true,
+	apiPrefix + "/reconciliation/{batch_id}/report": true,
+}
+
+// publicRoutes are the API paths routed ahead of the API subrouter, which
+// need no tenant
+var publicRoutes = map[string]bool{
+	exportDownloadPath: true,
+	emailInboundPath:   true,
+	openAPIPath:        true,
+	swaggerUIPath:      true,
+}
+
+func tenantRoute(template string) bool {
+	if deploymentRoutes[template] {
+		return false
+	}
+	if tenantRoutes[template] {
+		return true
+	}
+	for _, prefix := range tenantRoutePrefixes {
+		if strings.HasPrefix(template, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetupTenantRouter routes every request to the router of its tenant. A
+// sandbox API key in X-API-Key routes to the sandbox, and only such a key
+// reaches it. Otherwise, when tenants are isolated, the tenant is named by
+// selectTenant; an API request naming no tenant, or an unknown one, is
+// refused. Routes outside the API, and the public ones in it, belong to the
+// primary tenant.
+func SetupTenantRouter(graphs map[string]*services.Services, tenants config.TenantsConfig, sandbox config.SandboxConfig, latency config.LatencyConfig, docs config.OpenAPIConfig, logger *slog.Logger) http.Handler {
+	routers := make(map[string]*mux.Router, len(graphs))
+	for tenant, svc := range graphs {
+		routers[tenant] = SetupRouter(svc, latency, docs, logger)
+	}
+	primary := tenants.Primary()
+	primarySvc := graphs[primary]
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, apiPrefix+"/") || publicRoutes[matchedTemplate(routers[primary], r)] {
+			routers[primary].ServeHTTP(w, r)
+			return
+		}
+
+		tenant := strings.TrimSpace(r.Header.Get("X-Tenant-ID"))
+		if sandbox.Enabled() {
+			if sandboxKey(sandbox, r.Header.Get("X-API-Key")) {
+				if tenant != "" && tenant != sandbox.Tenant {
+					refuseTenant(w, r, primarySvc, tenant, http.StatusForbidden, "X-Tenant-ID does not match the sandbox API key")
+					return
+				}
+				// The sandbox's router takes the key as authenticated, with
+				// the role of any API key
+				r = r.WithContext(context.WithValue(r.Context(), apiKeyKey{}, sandboxAPIKey(sandbox)))
+				serveTenant(w, r, routers[sandbox.Tenant], sandbox.Tenant, primarySvc, false)
+				return
+			}
+			if tenant == sandbox.Tenant {
+				refuseTenant(w, r, primarySvc, tenant, http.StatusForbidden, "The sandbox requires a sandbox API key")
+				return
+			}
+		}
+		if !tenants.Enabled() {
+			routers[primary].ServeHTTP(w, r)
+			return
+		}
+
+		tenant, apiKey, refusal := selectTenant(r, tenant, primarySvc.Auth, primarySvc.APIKeys)
+		if refusal != nil {
+			refuseTenant(w, r, primarySvc, tenant, refusal.code, refusal.message)
+			return
+		}
+		if apiKey != nil {
+			// The tenant's router takes the key as authenticated
+			r = r.WithContext(context.WithValue(r.Context(), apiKeyKey{}, apiKey))
+		}
+		if tenant == "" {
+			refuseTenant(w, r, primarySvc, tenant, http.StatusBadRequest, "X-Tenant-ID is required")
+			return
+		}
+		router, ok := routers[tenant]
+		if !ok {
+			refuseTenant(w, r, primarySvc, tenant, http.StatusForbidden, "Unknown tenant")
+			return
+		}
+		serveTenant(w, r, router, tenant, primarySvc, tenant == primary)
+	})
+}
+
+// tenantRefusal is why a request is refused before it reaches a tenant
+type tenantRefusal struct {
+	code    int
+	message string
+}
+
+// selectTenant names the tenant an API request acts for when tenants are
+// isolated, given the one it names in X-Tenant-ID. A valid bearer token must
+// carry a tenant claim, and an API key sent without a token acts for the
+// tenant it was issued for; the header may only repeat that tenant. The key
+// is returned once authenticated. The header alone names the tenant only when
+// authentication is off. An invalid token is left for the tenant's router
+// to refuse.
+func selectTenant(r *http.Request, tenant string, verifier *auth.Verifier, apiKeys *services.APIKeyService) (string, *models.APIKey, *tenantRefusal) {
+	if verifier == nil {
+		return tenant, nil, nil
+	}
+
+	token, hasToken := bearerToken(r)
+	if hasToken {
+		identity, err := verifier.Verify(token)
+		if err != nil {
+			return tenant, nil, nil
+		}
+		if identity.Tenant == "" {
+			return tenant, nil, &tenantRefusal{http.StatusForbidden, "The token names no tenant"}
+		}
+		if tenant != "" && tenant != identity.Tenant {
+			return tenant, nil, &tenantRefusal{http.StatusForbidden, "X-Tenant-ID does not match the tenant of the token"}
+		}
+		return identity.Tenant, nil, nil
+	}
+
+	key := r.Header.Get("X-API-Key")
+	if strings.TrimSpace(key) == "" {
+		return tenant, nil, nil
+	}
+	apiKey, err := apiKeys.Authenticate(key)
+	if errors.Is(err, services.ErrAPIKeyRejected) {
+		return tenant, nil, &tenantRefusal{http.StatusUnauthorized, err.Error()}
+	}
+	if err != nil {
+		return tenant, nil, &tenantRefusal{http.StatusInternalServerError, err.Error()}
+	}
+	if tenant != "" && tenant != apiKey.Tenant {
+		return tenant, nil, &tenantRefusal{http.StatusForbidden, "X-Tenant-ID does not match the tenant of the API key"}
+	}
+	return apiKey.Tenant, apiKey, nil
+}
+
+// serveTenant hands a request to its tenant's router, refusing the
+// deployment-wide routes unless the tenant is the primary one
+func serveTenant(w http.ResponseWriter, r *http.Request, router *mux.Router, tenant string, primarySvc *services.Services, primary bool) {
+	r = r.WithContext(context.WithValue(r.Context(), tenantKey{}, tenant))
+	if template := matchedTemplate(router, r); !primary && template != "" && !tenantRoute(template) {
+		refuseTenant(w, r, primarySvc, tenant, http.StatusForbidden, "This endpoint is only available to the primary tenant")
+		return
+	}
+	router.ServeHTTP(w, r)
+}
+
+// sandboxKey reports whether key is one of the sandbox API keys
+func sandboxKey(sandbox config.SandboxConfig, key string) bool {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return false
+	}
+	found := false
+	for _, candidate := range sandbox.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(candidate)) == 1 {
+			found = true
+		}
+	}
+	return found
+}
+
+// sandboxAPIKey is the API key a sandbox key acts as. It is not stored, so it
+// has no ID.
+func sandboxAPIKey(sandbox config.SandboxConfig) *models.APIKey {
+	return &models.APIKey{Name: "sandbox", Tenant: sandbox.Tenant, Scope: models.APIKeyScopeFull}
+}
+
+// matchedTemplate returns the path template of the route a request matches,
+// or "" when none does and the router answers 404 or 405
+func matchedTemplate(router *mux.Router, r *http.Request) string {
+	var match mux.RouteMatch
+	if !router.Match(r, &match) || match.Route == nil {
+		return ""
+	}
+	template, err := match.Route.GetPathTemplate()
+	if err != nil {
+		return ""
+	}
+	return template
+}
+
+// refuseTenant answers a request refused before reaching a tenant's router,
+// in the locale that router would have chosen
+func refuseTenant(w http.ResponseWriter, r *http.Request, svc *services.Services, tenant string, code int, message string) {
+	w.Header().Set("Content-Language", svc.Locales.Resolve(r.Header.Get("Accept-Language"), tenant))
+	w.Header().Add("Vary", "Accept-Language")
+	respondWithError(w, code, message)
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"reconciliation-service/internal/auth"
+	"reconciliation-service/internal/config"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories/repotest"
+	"reconciliation-service/internal/services"
+)
+
+const testJWTSecret = "tenant-test-secret"
+
+func TestSelectTenant(t *testing.T) {
+	verifier := auth.NewVerifier(testJWTSecret, "", "", 0)
+	apiKeys := services.NewAPIKeyService(repotest.NewAPIKeys(), []string{"acme", "globex"}, "acme", config.APIKeyConfig{RotationGrace: time.Hour})
+	acmeKey := issueTestKey(t, apiKeys, "acme")
+	globexKey := issueTestKey(t, apiKeys, "globex")
+
+	tests := []struct {
+		name     string
+		verifier *auth.Verifier
+		token    string
+		apiKey   string
+		header   string
+		want     string
+		wantKey  bool
+		code     int
+	}{
+		{
+			name:     "authentication off trusts the header",
+			verifier: nil,
+			header:   "globex",
+			want:     "globex",
+		},
+		{
+			name:     "token tenant",
+			verifier: verifier,
+			token:    signTestToken(t, "alice", "acme"),
+			want:     "acme",
+		},
+		{
+			name:     "header repeating the token tenant",
+			verifier: verifier,
+			token:    signTestToken(t, "alice", "acme"),
+			header:   "acme",
+			want:     "acme",
+		},
+		{
+			name:     "header naming another tenant than the token",
+			verifier: verifier,
+			token:    signTestToken(t, "alice", "acme"),
+			header:   "globex",
+			code:     http.StatusForbidden,
+		},
+		{
+			name:     "token without a tenant cannot pick one by header",
+			verifier: verifier,
+			token:    signTestToken(t, "alice", ""),
+			header:   "globex",
+			code:     http.StatusForbidden,
+		},
+		{
+			name:     "token without a tenant",
+			verifier: verifier,
+			token:    signTestToken(t, "alice", ""),
+			code:     http.StatusForbidden,
+		},
+		{
+			name:     "invalid token is left to the tenant router",
+			verifier: verifier,
+			token:    "not.a.token",
+			header:   "globex",
+			want:     "globex",
+		},
+		{
+			name:     "API key tenant",
+			verifier: verifier,
+			apiKey:   globexKey,
+			want:     "globex",
+			wantKey:  true,
+		},
+		{
+			name:     "header naming another tenant than the API key",
+			verifier: verifier,
+			apiKey:   acmeKey,
+			header:   "globex",
+			code:     http.StatusForbidden,
+		},
+		{
+			name:     "unknown API key",
+			verifier: verifier,
+			apiKey:   "rk_0000000000000000",
+			header:   "globex",
+			code:     http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/reconciliation/batches", nil)
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			if tt.apiKey != "" {
+				r.Header.Set("X-API-Key", tt.apiKey)
+			}
+
+			tenant, key, refusal := selectTenant(r, tt.header, tt.verifier, apiKeys)
+			if tt.code != 0 {
+				if refusal == nil {
+					t.Fatalf("expected a %d refusal, got tenant %q", tt.code, tenant)
+				}
+				if refusal.code != tt.code {
+					t.Errorf("refusal code = %d, want %d (%s)", refusal.code, tt.code, refusal.message)
+				}
+				return
+			}
+			if refusal != nil {
+				t.Fatalf("unexpected refusal %d: %s", refusal.code, refusal.message)
+			}
+			if tenant != tt.want {
+				t.Errorf("tenant = %q, want %q", tenant, tt.want)
+			}
+			if (key != nil) != tt.wantKey {
+				t.Errorf("authenticated key = %v, want one: %v", key, tt.wantKey)
+			}
+		})
+	}
+}
+
+// signTestToken signs an HS256 token for subject, carrying tenant unless it
+// is empty
+func signTestToken(t *testing.T, subject, tenant string) string {
+	t.Helper()
+	encode := func(v interface{}) string {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(raw)
+	}
+	claims := map[string]interface{}{
+		"sub": subject,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	if tenant != "" {
+		claims["tenant"] = tenant
+	}
+	unsigned := encode(map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + encode(claims)
+	mac := hmac.New(sha256.New, []byte(testJWTSecret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func issueTestKey(t *testing.T, apiKeys *services.APIKeyService, tenant string) string {
+	t.Helper()
+	issued, err := apiKeys.Issue(&models.APIKey{Name: "uploader", Scope: models.APIKeyScopeIngest, Tenant: tenant}, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return issued.Key
+}
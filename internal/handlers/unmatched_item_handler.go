@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"reconciliation-service/internal/services"
+)
+
+type UnmatchedItemHandler struct {
+	unmatchedItemService *services.UnmatchedItemService
+}
+
+func NewUnmatchedItemHandler(unmatchedItemService *services.UnmatchedItemService) *UnmatchedItemHandler {
+	return &UnmatchedItemHandler{
+		unmatchedItemService: unmatchedItemService,
+	}
+}
+
+type unmatchedBulkActionRequest struct {
+	services.UnmatchedBulkAction
+	UserID string `json:"user_id"`
+}
+
+// BulkAction assigns, holds, releases, tags or sets the reason code of the
+// unmatched records a filter or ID list selects, and reports what became of
+// every one; a dry run only counts them
+func (h *UnmatchedItemHandler) BulkAction(w http.ResponseWriter, r *http.Request) {
+	var req unmatchedBulkActionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	result, err := h.unmatchedItemService.BulkAction(req.UnmatchedBulkAction, actingUser(r, req.UserID))
+	switch {
+	case errors.Is(err, services.ErrInvalidBulkAction):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/services"
+)
+
+type UsageHandler struct {
+	usageService *services.UsageService
+}
+
+func NewUsageHandler(usageService *services.UsageService) *UsageHandler {
+	return &UsageHandler{
+		usageService: usageService,
+	}
+}
+
+// usageEntity identifies the caller for usage accounting by what it
+// authenticated as: the tenant it was routed to when tenants are isolated,
+// otherwise its API key or user, otherwise "anonymous". Headers the caller
+// sets freely, such as X-Tenant-ID, never pick the entity.
+func usageEntity(r *http.Request) string {
+	if tenant, ok := r.Context().Value(tenantKey{}).(string); ok {
+		return "tenant:" + tenant
+	}
+	if key := requestAPIKey(r); key != nil {
+		return "api-key:" + strconv.FormatInt(key.ID, 10)
+	}
+	if identity := requestIdentity(r); identity != nil {
+		return "user:" + identity.Subject
+	}
+	return "anonymous"
+}
+
+// requestTenant returns the tenant the request was routed to when tenants are
+// isolated, otherwise the one it names in X-Tenant-ID, if any. Without
+// isolation the header only picks defaults such as the locale and KPIs, so it
+// must not decide anything a caller could gain from.
+func requestTenant(r *http.Request) string {
+	if tenant, ok := r.Context().Value(tenantKey{}).(string); ok {
+		return tenant
+	}
+	return strings.TrimSpace(r.Header.Get("X-Tenant-ID"))
+}
+
+// batchRoutes start a batch run, directly or through a queued job, so they
+// take the batch quota
+var batchRoutes = map[string]bool{
+	"/api/v1/reconciliation/start":       true,
+	"/api/v1/reconciliation/queue":       true,
+	"/api/v1/reconciliation/partitioned": true,
+}
+
+// QuotaMiddleware rejects callers that used up their monthly quota and counts
+// every admitted request. Request quotas answer 429, billable ingestion and
+// batch quotas answer 402.
+func (h *UsageHandler) QuotaMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/v1/usage") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		entity := usageEntity(r)
+		ingests := r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/api/v1/data/")
+		runsBatch := r.Method == http.MethodPost && batchRoutes[r.URL.Path]
+
+		err := h.usageService.CheckQuota(entity, ingests, runsBatch)
+		switch err {
+		case nil:
+		case services.ErrRequestQuotaExceeded:
+			retryAfter := int(time.Until(services.NextPeriodStart()).Seconds()) + 1
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			respondWithError(w, http.StatusTooManyRequests, err.Error())
+			return
+		case services.ErrRowQuotaExceeded, services.ErrBatchQuotaExceeded:
+			respondWithError(w, http.StatusPaymentRequired, err.Error())
+			return
+		default:
+			log.Printf("quota check failed for %s: %v", entity, err)
+		}
+
+		if err := h.usageService.RecordRequest(entity); err != nil {
+			log.Printf("failed to record request usage for %s: %v", entity, err)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (h *UsageHandler) GetUsage(w http.ResponseWriter, r *http.Request) {
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = services.CurrentPeriod()
+	} else if _, err := time.Parse("2006-01", period); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid period format. Use YYYY-MM")
+		return
+	}
+
+	report, err := h.usageService.GetUsageReport(usageEntity(r), period)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, report)
+}
+
+func (h *UsageHandler) ListUsage(w http.ResponseWriter, r *http.Request) {
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = services.CurrentPeriod()
+	} else if _, err := time.Parse("2006-01", period); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid period format. Use YYYY-MM")
+		return
+	}
+
+	usages, err := h.usageService.ListUsage(period)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"period":   period,
+		"entities": usages,
+	})
+}
+
+func (h *UsageHandler) SetQuota(w http.ResponseWriter, r *http.Request) {
+	var quota models.APIQuota
+	if err := json.NewDecoder(r.Body).Decode(&quota); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	quota.Entity = mux.Vars(r)["entity"]
+
+	if err := h.usageService.SetQuota(&quota); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, quota)
+}
+
+func (h *UsageHandler) recordRowsIngested(r *http.Request, rows int) {
+	entity := usageEntity(r)
+	if err := h.usageService.RecordRowsIngested(entity, rows); err != nil {
+		log.Printf("failed to record ingestion usage for %s: %v", entity, err)
+	}
+}
+
+// recordBatchRun counts a batch run for a usage entity, which the run
+// captures from its request since it may outlive it
+func (h *UsageHandler) recordBatchRun(entity string) {
+	if err := h.usageService.RecordBatchRun(entity); err != nil {
+		log.Printf("failed to record batch usage for %s: %v", entity, err)
+	}
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"reconciliation-service/internal/auth"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+	"reconciliation-service/internal/services"
+)
+
+func TestUsageEntity(t *testing.T) {
+	tests := []struct {
+		name     string
+		tenant   string
+		key      *models.APIKey
+		identity *auth.Identity
+		headers  map[string]string
+		want     string
+	}{
+		{
+			name: "anonymous",
+			want: "anonymous",
+		},
+		{
+			name:    "unauthenticated headers are ignored",
+			headers: map[string]string{"X-Tenant-ID": "acme", "X-API-Key": "rk_forged"},
+			want:    "anonymous",
+		},
+		{
+			name:     "bearer token",
+			identity: &auth.Identity{Subject: "alice"},
+			headers:  map[string]string{"X-Tenant-ID": "acme"},
+			want:     "user:alice",
+		},
+		{
+			name:     "API key",
+			key:      &models.APIKey{ID: 7, Tenant: "default"},
+			identity: &auth.Identity{Subject: "api-key:7", Tenant: "default"},
+			headers:  map[string]string{"X-Tenant-ID": "acme"},
+			want:     "api-key:7",
+		},
+		{
+			name:     "routed tenant",
+			tenant:   "globex",
+			identity: &auth.Identity{Subject: "alice", Tenant: "globex"},
+			headers:  map[string]string{"X-Tenant-ID": "acme"},
+			want:     "tenant:globex",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/v1/usage", nil)
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			ctx := r.Context()
+			if tt.tenant != "" {
+				ctx = context.WithValue(ctx, tenantKey{}, tt.tenant)
+			}
+			if tt.key != nil {
+				ctx = context.WithValue(ctx, apiKeyKey{}, tt.key)
+			}
+			if tt.identity != nil {
+				ctx = context.WithValue(ctx, identityKey{}, tt.identity)
+			}
+
+			if got := usageEntity(r.WithContext(ctx)); got != tt.want {
+				t.Errorf("usageEntity() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// spentUsage reports every entity as having run batches batches this period.
+// Any other method of the repository panics.
+type spentUsage struct {
+	repositories.UsageRepository
+	batches int64
+}
+
+func (u *spentUsage) IncrementUsage(entity, period string, requests, rowsIngested, batchesRun int64) error {
+	return nil
+}
+
+func (u *spentUsage) GetUsage(entity, period string) (*models.APIUsage, error) {
+	return &models.APIUsage{Entity: entity, Period: period, BatchesRun: u.batches}, nil
+}
+
+func (u *spentUsage) GetQuota(entity string) (*models.APIQuota, error) {
+	return nil, nil
+}
+
+func TestQuotaMiddlewareBatchRoutes(t *testing.T) {
+	usage := services.NewUsageService(&spentUsage{batches: 1}, models.APIQuota{MaxBatches: 1})
+	handler := NewUsageHandler(usage).QuotaMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{http.MethodPost, "/api/v1/reconciliation/start", http.StatusPaymentRequired},
+		{http.MethodPost, "/api/v1/reconciliation/queue", http.StatusPaymentRequired},
+		{http.MethodPost, "/api/v1/reconciliation/partitioned", http.StatusPaymentRequired},
+		{http.MethodGet, "/api/v1/reconciliation/queue", http.StatusOK},
+		{http.MethodGet, "/api/v1/reconciliation/partitioned/batch-1", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
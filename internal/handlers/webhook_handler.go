@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"reconciliation-service/internal/i18n"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/pagination"
+	"reconciliation-service/internal/repositories"
+	"reconciliation-service/internal/services"
+)
+
+type WebhookHandler struct {
+	webhookService *services.WebhookService
+}
+
+func NewWebhookHandler(webhookService *services.WebhookService) *WebhookHandler {
+	return &WebhookHandler{
+		webhookService: webhookService,
+	}
+}
+
+// webhookEndpointRequest is the body of a create or update; an endpoint is
+// active unless active is sent as false
+type webhookEndpointRequest struct {
+	URL         string   `json:"url"`
+	EventTypes  []string `json:"event_types"`
+	Description string   `json:"description"`
+	Active      *bool    `json:"active"`
+	UserID      string   `json:"user_id"`
+}
+
+func (req webhookEndpointRequest) endpoint() *models.WebhookEndpoint {
+	endpoint := &models.WebhookEndpoint{
+		URL:         req.URL,
+		EventTypes:  req.EventTypes,
+		Description: req.Description,
+		Active:      true,
+	}
+	if req.Active != nil {
+		endpoint.Active = *req.Active
+	}
+	return endpoint
+}
+
+// CreateEndpoint registers an endpoint and answers with its signing secret,
+// which is not shown again
+func (h *WebhookHandler) CreateEndpoint(w http.ResponseWriter, r *http.Request) {
+	var req webhookEndpointRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	created, err := h.webhookService.CreateEndpoint(req.endpoint(), actingUser(r, req.UserID))
+	if err != nil {
+		respondWithWebhookError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, created)
+}
+
+func (h *WebhookHandler) ListEndpoints(w http.ResponseWriter, r *http.Request) {
+	endpoints, err := h.webhookService.ListEndpoints()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"endpoints": endpoints,
+	})
+}
+
+func (h *WebhookHandler) GetEndpoint(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookEndpointID(w, r)
+	if !ok {
+		return
+	}
+
+	endpoint, err := h.webhookService.GetEndpoint(id)
+	if err != nil {
+		respondWithWebhookError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, endpoint)
+}
+
+func (h *WebhookHandler) UpdateEndpoint(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookEndpointID(w, r)
+	if !ok {
+		return
+	}
+	var req webhookEndpointRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	endpoint := req.endpoint()
+	endpoint.ID = id
+
+	updated, err := h.webhookService.UpdateEndpoint(endpoint, actingUser(r, req.UserID))
+	if err != nil {
+		respondWithWebhookError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, updated)
+}
+
+func (h *WebhookHandler) DeleteEndpoint(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookEndpointID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.webhookService.DeleteEndpoint(id); err != nil {
+		respondWithWebhookError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, SuccessResponse{Message: i18n.T(responseLocale(w), "Webhook endpoint deleted")})
+}
+
+// ListDeliveries lists deliveries newest first with their events, optionally
+// of one endpoint_id or status
+func (h *WebhookHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, err := intQuery(query.Get("limit"), 0)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "limit must be a number")
+		return
+	}
+	var endpointID int64
+	if value := query.Get("endpoint_id"); value != "" {
+		if endpointID, err = strconv.ParseInt(value, 10, 64); err != nil {
+			respondWithError(w, http.StatusBadRequest, "endpoint_id must be a number")
+			return
+		}
+	}
+
+	deliveries, next, err := h.webhookService.ListDeliveries(endpointID, query.Get("status"), query.Get("cursor"), limit)
+	if err != nil {
+		respondWithWebhookError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, withNextCursor(map[string]interface{}{
+		"deliveries": deliveries,
+	}, next))
+}
+
+func webhookEndpointID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid webhook endpoint ID")
+		return 0, false
+	}
+	return id, true
+}
+
+func respondWithWebhookError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidWebhookEndpoint),
+		errors.Is(err, services.ErrInvalidWebhookDeliveries),
+		errors.Is(err, pagination.ErrInvalidCursor):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, repositories.ErrWebhookEndpointNotFound):
+		respondWithError(w, http.StatusNotFound, err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,249 @@
+package i18n
+
+var catalogs = map[string]map[string]string{
+	English: {
+		"report.column.batch_id":                "Batch ID",
+		"report.column.status":                  "Status",
+		"report.column.match_confidence":        "Match Confidence",
+		"report.column.amount_difference":       "Amount Difference",
+		"report.column.mapping_type":            "Mapping Type",
+		"report.column.transaction_id":          "Transaction ID",
+		"report.column.account_number":          "Account Number",
+		"report.column.bank_amount":             "Bank Amount",
+		"report.column.transaction_date":        "Transaction Date",
+		"report.column.entry_id":                "Entry ID",
+		"report.column.account_code":            "Account Code",
+		"report.column.accounting_amount":       "Accounting Amount",
+		"report.column.entry_date":              "Entry Date",
+		"report.column.matched_at":              "Matched At",
+		"report.column.amount":                  "Amount",
+		"report.column.description":             "Description",
+		"report.column.reference_number":        "Reference Number",
+		"report.column.end_to_end_id":           "End-to-End ID",
+		"report.column.external_correlation_id": "External Correlation ID",
+		"report.column.counterparty_iban":       "Counterparty IBAN",
+		"report.column.invoice_number":          "Invoice Number",
+		"report.column.reconciliation_id":       "Reconciliation ID",
+		"report.column.action":                  "Action",
+		"report.column.user_id":                 "User ID",
+		"report.column.details":                 "Details",
+		"report.column.created_at":              "Created At",
+		"report.column.count":                   "Count",
+		"report.column.summary_before":          "Summary Before",
+		"report.column.summary_after":           "Summary After",
+		"report.column.changes":                 "Changes",
+		"report.column.counterparty":            "Counterparty",
+		"report.column.section":                 "Section",
+		"report.column.bank_currency":           "Bank Currency",
+		"report.column.entry_currency":          "Entry Currency",
+
+		"notification.reconciliation_completed.subject": "Reconciliation %s completed",
+		"notification.reconciliation_completed.body":    "Reconciliation %s finished with %d matched and %d unmatched records.",
+		"notification.reconciliation_failed.subject":    "Reconciliation %s failed",
+		"notification.reconciliation_failed.body":       "Reconciliation %s failed: %s",
+		"notification.quota_exceeded.subject":           "API quota exceeded",
+		"notification.quota_exceeded.body":              "%s has used up its monthly quota: %s",
+		"notification.maintenance_enabled.subject":      "Maintenance mode enabled",
+		"notification.maintenance_enabled.body":         "Write operations are paused: %s",
+		"notification.batch_changed.subject":            "Reconciliation %s changed after completion",
+		"notification.batch_changed.body":               "%s by %s changed reconciliation %s: %d matched and %d unmatched before, %d matched and %d unmatched after.",
+		"notification.expectation_missed.subject":       "Expected payment %s did not arrive",
+		"notification.expectation_missed.body":          "The %s payment %s of %s expected between %s and %s has not been seen on the bank account.",
+		"notification.daily_digest.subject":             "Daily digest of %s for %s",
+		"notification.daily_digest.body":                "On %s, %d bank transactions and %d accounting entries were ingested and %d batches run, with %d matched and %d unmatched (%s%% matched). %d new records worth %s %s are unmatched, %d unmatched records worth %s %s crossed an aging threshold, and %d disputes are open.",
+	},
+	Indonesian: {
+		"report.column.batch_id":                "ID Batch",
+		"report.column.status":                  "Status",
+		"report.column.match_confidence":        "Tingkat Kecocokan",
+		"report.column.amount_difference":       "Selisih Jumlah",
+		"report.column.mapping_type":            "Jenis Pemetaan",
+		"report.column.transaction_id":          "ID Transaksi",
+		"report.column.account_number":          "Nomor Rekening",
+		"report.column.bank_amount":             "Jumlah Bank",
+		"report.column.transaction_date":        "Tanggal Transaksi",
+		"report.column.entry_id":                "ID Jurnal",
+		"report.column.account_code":            "Kode Akun",
+		"report.column.accounting_amount":       "Jumlah Akuntansi",
+		"report.column.entry_date":              "Tanggal Jurnal",
+		"report.column.matched_at":              "Dicocokkan Pada",
+		"report.column.amount":                  "Jumlah",
+		"report.column.description":             "Keterangan",
+		"report.column.reference_number":        "Nomor Referensi",
+		"report.column.end_to_end_id":           "ID End-to-End",
+		"report.column.external_correlation_id": "ID Korelasi Eksternal",
+		"report.column.counterparty_iban":       "IBAN Lawan Transaksi",
+		"report.column.invoice_number":          "Nomor Faktur",
+		"report.column.reconciliation_id":       "ID Rekonsiliasi",
+		"report.column.action":                  "Tindakan",
+		"report.column.user_id":                 "ID Pengguna",
+		"report.column.details":                 "Rincian",
+		"report.column.created_at":              "Dibuat Pada",
+		"report.column.count":                   "Jumlah Data",
+		"report.column.summary_before":          "Ringkasan Sebelum",
+		"report.column.summary_after":           "Ringkasan Sesudah",
+		"report.column.changes":                 "Perubahan",
+		"report.column.counterparty":            "Lawan Transaksi",
+		"report.column.section":                 "Bagian",
+		"report.column.bank_currency":           "Mata Uang Bank",
+		"report.column.entry_currency":          "Mata Uang Jurnal",
+
+		"notification.reconciliation_completed.subject": "Rekonsiliasi %s selesai",
+		"notification.reconciliation_completed.body":    "Rekonsiliasi %s selesai dengan %d data cocok dan %d data tidak cocok.",
+		"notification.reconciliation_failed.subject":    "Rekonsiliasi %s gagal",
+		"notification.reconciliation_failed.body":       "Rekonsiliasi %s gagal: %s",
+		"notification.quota_exceeded.subject":           "Kuota API terlampaui",
+		"notification.quota_exceeded.body":              "%s telah menghabiskan kuota bulanannya: %s",
+		"notification.maintenance_enabled.subject":      "Mode pemeliharaan aktif",
+		"notification.maintenance_enabled.body":         "Operasi tulis dihentikan sementara: %s",
+		"notification.batch_changed.subject":            "Rekonsiliasi %s berubah setelah selesai",
+		"notification.batch_changed.body":               "%s oleh %s mengubah rekonsiliasi %s: %d cocok dan %d tidak cocok sebelumnya, %d cocok dan %d tidak cocok sesudahnya.",
+		"notification.expectation_missed.subject":       "Pembayaran yang diharapkan %s tidak masuk",
+		"notification.expectation_missed.body":          "Pembayaran %s %s sebesar %s yang diharapkan antara %s dan %s tidak terlihat di rekening bank.",
+		"notification.daily_digest.subject":             "Ringkasan harian %s untuk %s",
+		"notification.daily_digest.body":                "Pada %s, %d transaksi bank dan %d jurnal akuntansi diterima dan %d batch dijalankan, dengan %d cocok dan %d tidak cocok (%s%% cocok). %d data baru senilai %s %s belum cocok, %d data tidak cocok senilai %s %s melewati ambang umur, dan %d sengketa masih terbuka.",
+
+		"Invalid request payload":                                             "Payload permintaan tidak valid",
+		"Invalid from_date format. Use YYYY-MM-DD":                            "Format from_date tidak valid. Gunakan YYYY-MM-DD",
+		"Invalid to_date format. Use YYYY-MM-DD":                              "Format to_date tidak valid. Gunakan YYYY-MM-DD",
+		"Invalid period format. Use YYYY-MM":                                  "Format periode tidak valid. Gunakan YYYY-MM",
+		"Both from_date and to_date are required":                             "from_date dan to_date wajib diisi",
+		"Both from_date and to_date query parameters are required":            "Parameter query from_date dan to_date wajib diisi",
+		"from_date and to_date must be given together":                        "from_date dan to_date harus diisi bersamaan",
+		"Batch ID is required":                                                "ID batch wajib diisi",
+		"priority is required":                                                "priority wajib diisi",
+		"format must be json or csv":                                          "format harus json atau csv",
+		"No transactions provided":                                            "Tidak ada transaksi yang dikirim",
+		"No entries provided":                                                 "Tidak ada jurnal yang dikirim",
+		"Invalid report ID":                                                   "ID laporan tidak valid",
+		"Invalid job ID":                                                      "ID job tidak valid",
+		"limit must be a number":                                              "limit harus berupa angka",
+		"before_id must be a number":                                          "before_id harus berupa angka",
+		"page must be a number":                                               "page harus berupa angka",
+		"page_size must be a number":                                          "page_size harus berupa angka",
+		"invalid cursor":                                                      "cursor tidak valid",
+		"fields must be a comma-separated list of field names":                "fields harus berupa daftar nama field yang dipisahkan koma",
+		"Invalid record ID":                                                   "ID data tidak valid",
+		"bank transaction not found":                                          "transaksi bank tidak ditemukan",
+		"accounting entry not found":                                          "jurnal akuntansi tidak ditemukan",
+		"reconciliation not found":                                            "rekonsiliasi tidak ditemukan",
+		"record was modified by someone else":                                 "data telah diubah oleh pengguna lain",
+		"batch was modified since the If-Match ETag was read":                 "batch telah diubah sejak ETag If-Match dibaca",
+		"reconciliation has no match to undo":                                 "rekonsiliasi tidak memiliki pencocokan untuk dibatalkan",
+		"reconciliation is not pending review":                                "rekonsiliasi tidak sedang menunggu peninjauan",
+		"Invalid rule set change ID":                                          "ID perubahan aturan tidak valid",
+		"rule set change not found":                                           "perubahan aturan tidak ditemukan",
+		"rule set version already exists":                                     "versi aturan sudah ada",
+		"rule set change is not pending":                                      "perubahan aturan tidak lagi menunggu persetujuan",
+		"rule set change is based on a rule set that is no longer active":     "perubahan aturan didasarkan pada aturan yang sudah tidak aktif",
+		"a rule set change must be reviewed by someone other than its author": "perubahan aturan harus ditinjau oleh orang selain pembuatnya",
+		"Shadow candidate updated":                                            "Kandidat shadow diperbarui",
+		"Shadow candidate deleted":                                            "Kandidat shadow dihapus",
+		"shadow candidate not found":                                          "kandidat shadow tidak ditemukan",
+		"shadow candidate already exists":                                     "kandidat shadow sudah ada",
+		"shadow run not found":                                                "shadow run tidak ditemukan",
+		"Failed to retrieve shadow runs":                                      "Gagal mengambil shadow run",
+		"Invalid shadow run ID":                                               "ID shadow run tidak valid",
+		"agreement must be agreed or shadow_only":                             "agreement harus agreed atau shadow_only",
+		"this operation requires a confirmation token in production":          "operasi ini memerlukan token konfirmasi di production",
+		"Request exceeded its latency budget":                                 "Permintaan melebihi batas waktu",
+		"no role is assigned to this user":                                    "pengguna ini belum memiliki peran",
+		"your role does not allow this operation":                             "peran Anda tidak mengizinkan operasi ini",
+		"Authentication is disabled":                                          "Autentikasi dinonaktifkan",
+		"User deleted":                                                        "Pengguna dihapus",
+		"user not found":                                                      "pengguna tidak ditemukan",
+		"at least one admin must remain":                                      "harus tersisa setidaknya satu admin",
+		"Authentication required":                                             "Autentikasi diperlukan",
+		"X-Tenant-ID is required":                                             "X-Tenant-ID wajib diisi",
+		"X-Tenant-ID does not match the tenant of the token":                  "X-Tenant-ID tidak sesuai dengan tenant pada token",
+		"The token names no tenant":                                           "Token tidak menyebutkan tenant",
+		"Unknown tenant":                                                      "Tenant tidak dikenal",
+		"This endpoint is only available to the primary tenant":               "Endpoint ini hanya tersedia bagi tenant utama",
+		"X-Tenant-ID does not match the sandbox API key":                      "X-Tenant-ID tidak sesuai dengan API key sandbox",
+		"The sandbox requires a sandbox API key":                              "Sandbox memerlukan API key sandbox",
+		"sandbox is not enabled for this tenant":                              "sandbox tidak diaktifkan untuk tenant ini",
+		"sandbox reset is already running":                                    "reset sandbox sedang berjalan",
+		"a sandbox job is running, reset it once the job finishes":            "job sandbox sedang berjalan, reset setelah job selesai",
+		"external reference already names a batch":                            "referensi eksternal sudah menamai sebuah batch",
+		"external_reference must be 1-100 letters, digits or . _ : -":         "external_reference harus 1-100 huruf, angka atau . _ : -",
+		"invalid token":                                                       "token tidak valid",
+		"token expired":                                                       "token kedaluwarsa",
+		"invalid confirmation token":                                          "token konfirmasi tidak valid",
+		"destructive operations are disabled in production":                   "operasi destruktif dinonaktifkan di production",
+		"Failed to retrieve safety overrides":                                 "Gagal mengambil catatan override keamanan",
+		"Failed to retrieve batch deltas":                                     "Gagal mengambil perubahan batch",
+		"Batch changes":                                                       "Perubahan batch",
+		"Failed to retrieve bank transactions":                                "Gagal mengambil transaksi bank",
+		"Failed to retrieve accounting entries":                               "Gagal mengambil jurnal akuntansi",
+		"year query parameter is required":                                    "parameter query year wajib diisi",
+		"Calendar deleted":                                                    "Kalender dihapus",
+		"calendar not found":                                                  "kalender tidak ditemukan",
+		"holiday not found":                                                   "hari libur tidak ditemukan",
+		"Counterparty deleted":                                                "Lawan transaksi dihapus",
+		"counterparty not found":                                              "lawan transaksi tidak ditemukan",
+		"counterparty code, alias or IBAN already in use":                     "kode, alias, atau IBAN lawan transaksi sudah digunakan",
+		"Statement file is too large":                                         "Berkas rekening koran terlalu besar",
+		"Request payload is too large":                                        "Payload permintaan terlalu besar",
+		"format must be csv or xlsx":                                          "format harus csv atau xlsx",
+		"Invalid export ID":                                                   "ID ekspor tidak valid",
+		"export not found":                                                    "ekspor tidak ditemukan",
+		"export is not ready":                                                 "ekspor belum siap",
+		"download link is invalid or expired":                                 "tautan unduhan tidak valid atau kedaluwarsa",
+		"Invalid legal hold ID":                                               "ID penahanan hukum tidak valid",
+		"legal hold not found":                                                "penahanan hukum tidak ditemukan",
+		"legal hold already exists":                                           "penahanan hukum sudah ada",
+		"retention policy not found":                                          "kebijakan retensi tidak ditemukan",
+		"retention_days is required":                                          "retention_days wajib diisi",
+		"Fee schedule deleted":                                                "Jadwal biaya bank dihapus",
+		"fee schedule not found":                                              "jadwal biaya bank tidak ditemukan",
+		"fee schedule already exists":                                         "jadwal biaya bank sudah ada",
+		"Expectation cancelled":                                               "Harapan pembayaran dibatalkan",
+		"expectation not found":                                               "harapan pembayaran tidak ditemukan",
+		"expectation already registered":                                      "harapan pembayaran sudah terdaftar",
+		"Budget deleted":                                                      "Anggaran dihapus",
+		"Invalid budget ID":                                                   "ID anggaran tidak valid",
+		"Invalid exception ID":                                                "ID pengecualian tidak valid",
+		"Invalid finding ID":                                                  "ID temuan tidak valid",
+		"run_id must be a number":                                             "run_id harus berupa angka",
+		"integrity finding not found":                                         "temuan integritas tidak ditemukan",
+		"integrity finding is no longer open":                                 "temuan integritas sudah tidak terbuka",
+		"statement fetch is already running":                                  "pengambilan rekening koran sedang berjalan",
+		"statement fetch is not configured":                                   "pengambilan rekening koran belum dikonfigurasi",
+		"Invalid webhook endpoint ID":                                         "ID endpoint webhook tidak valid",
+		"Webhook endpoint deleted":                                            "Endpoint webhook dihapus",
+		"webhook endpoint not found":                                          "endpoint webhook tidak ditemukan",
+		"Invalid API key ID":                                                  "ID API key tidak valid",
+		"API key not found":                                                   "API key tidak ditemukan",
+		"API key is not valid":                                                "API key tidak valid",
+		"API key is no longer active":                                         "API key sudah tidak aktif",
+		"This API key may only ingest data":                                   "API key ini hanya boleh mengirim data",
+		"X-Tenant-ID does not match the tenant of the API key":                "X-Tenant-ID tidak sesuai dengan tenant pada API key",
+		"endpoint_id must be a number":                                        "endpoint_id harus berupa angka",
+		"jitter must be a number":                                             "jitter harus berupa angka",
+		"fixture import is disabled":                                          "impor fixture dinonaktifkan",
+		"horizon_days must be a number":                                       "horizon_days harus berupa angka",
+		"Statement format is not supported":                                   "Format rekening koran tidak didukung",
+		"Invalid alias ID":                                                    "ID alias tidak valid",
+		"Alias deleted":                                                       "Alias dihapus",
+		"alias not found":                                                     "alias tidak ditemukan",
+		"alias already exists":                                                "alias sudah ada",
+		"Invalid schedule ID":                                                 "ID jadwal tidak valid",
+		"Schedule deleted":                                                    "Jadwal dihapus",
+		"schedule not found":                                                  "jadwal tidak ditemukan",
+		"schedule already exists":                                             "jadwal sudah ada",
+		"Notification preferences deleted":                                    "Preferensi notifikasi dihapus",
+		"notification preferences not found":                                  "preferensi notifikasi tidak ditemukan",
+		"event_type query parameter is required":                              "parameter query event_type wajib diisi",
+		"Report deleted":                                                      "Laporan dihapus",
+		"report not found":                                                    "laporan tidak ditemukan",
+		"snapshot not found":                                                  "snapshot tidak ditemukan",
+		"snapshot has no differences journal":                                 "snapshot tidak memiliki jurnal selisih",
+		"format must be csv or pdf":                                           "format harus csv atau pdf",
+		"stored journal does not match its checksum":                          "jurnal tersimpan tidak cocok dengan checksum-nya",
+		"monthly request quota exceeded":                                      "kuota permintaan bulanan terlampaui",
+		"monthly ingestion row quota exceeded":                                "kuota baris impor bulanan terlampaui",
+		"monthly reconciliation batch quota exceeded":                         "kuota batch rekonsiliasi bulanan terlampaui",
+		"a reconciliation covering overlapping dates and accounts is already in progress": "rekonsiliasi untuk tanggal dan rekening yang tumpang tindih sedang berjalan",
+		"service is shutting down and not accepting new work":                             "layanan sedang dihentikan dan tidak menerima pekerjaan baru",
+	},
+}
@@ -0,0 +1,128 @@
+package i18n
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	English    = "en"
+	Indonesian = "id"
+)
+
+const DefaultLocale = English
+
+// Supported reports whether a catalog exists for the locale
+func Supported(locale string) bool {
+	_, ok := catalogs[locale]
+	return ok
+}
+
+// Locales lists the supported locales
+func Locales() []string {
+	var locales []string
+	for locale := range catalogs {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// T looks up a message in the locale's catalog, falling back to English and
+// then to the key itself. API messages are keyed by their English text, so
+// untranslated messages pass through unchanged. Args are applied with
+// fmt.Sprintf.
+func T(locale, key string, args ...interface{}) string {
+	message, ok := catalogs[locale][key]
+	if !ok {
+		message, ok = catalogs[English][key]
+	}
+	if !ok {
+		message = key
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(message, args...)
+	}
+	return message
+}
+
+// Label returns the localized header for a report column, or the column name
+// when no label is defined
+func Label(locale, column string) string {
+	key := "report.column." + column
+	if label := T(locale, key); label != key {
+		return label
+	}
+	return column
+}
+
+// Resolver picks the locale of a request: an explicit Accept-Language wins,
+// then the tenant's configured locale, then the default
+type Resolver struct {
+	defaultLocale string
+	tenantLocales map[string]string
+}
+
+func NewResolver(defaultLocale string, tenantLocales map[string]string) *Resolver {
+	if !Supported(defaultLocale) {
+		defaultLocale = DefaultLocale
+	}
+	locales := make(map[string]string, len(tenantLocales))
+	for tenant, locale := range tenantLocales {
+		if Supported(locale) {
+			locales[tenant] = locale
+		}
+	}
+	return &Resolver{
+		defaultLocale: defaultLocale,
+		tenantLocales: locales,
+	}
+}
+
+func (r *Resolver) Resolve(acceptLanguage, tenant string) string {
+	if locale := Negotiate(acceptLanguage); locale != "" {
+		return locale
+	}
+	if locale, ok := r.tenantLocales[tenant]; ok {
+		return locale
+	}
+	return r.defaultLocale
+}
+
+// Negotiate returns the supported locale with the highest quality in an
+// Accept-Language header, or "" when none matches. Region subtags are
+// ignored, so id-ID selects id.
+func Negotiate(acceptLanguage string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		base, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if Supported(base) && q > bestQ {
+			best, bestQ = base, q
+		}
+	}
+	return best
+}
+
+// ParseTenantLocales reads "tenant:locale" pairs separated by commas
+func ParseTenantLocales(value string) map[string]string {
+	locales := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		tenant, locale, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || tenant == "" {
+			continue
+		}
+		locales[strings.TrimSpace(tenant)] = strings.ToLower(strings.TrimSpace(locale))
+	}
+	return locales
+}
@@ -0,0 +1,369 @@
+// Package camt053 parses ISO 20022 camt.053 bank-to-customer statements.
+package camt053
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"reconciliation-service/internal/money"
+)
+
+// Statement is one <Stmt> of the message
+type Statement struct {
+	ID             string
+	SequenceNumber string
+	AccountID      string // IBAN, or the proprietary account ID
+	Currency       string
+	Entries        []Entry
+
+	// Closing booked balance (CLBD), signed, and its date; ClosingDate is
+	// empty when the statement has none
+	ClosingBalance money.Amount
+	ClosingDate    string
+}
+
+// Entry is one booked <Ntry>. Batch bookings carry one Transaction per
+// <TxDtls>; single bookings have at most one.
+type Entry struct {
+	Reference         string       // NtryRef
+	ServicerReference string       // AcctSvcrRef
+	Amount            money.Amount // negative for debits
+	Currency          string
+	Reversal          bool
+	BookingDate       string // YYYY-MM-DD
+	ValueDate         string // YYYY-MM-DD, the booking date when absent
+	AdditionalInfo    string
+	Transactions      []Transaction
+}
+
+// Transaction is one <TxDtls> of an entry
+type Transaction struct {
+	EndToEndID        string
+	ServicerReference string
+	TransactionID     string
+	Amount            money.Amount // signed like the entry; 0 when the bank omits it
+
+	CounterpartyName string
+	CounterpartyIBAN string
+	CounterpartyBIC  string
+
+	Remittance        string // <Ustrd> lines joined
+	CreditorReference string // <Strd><CdtrRefInf><Ref>
+	AdditionalInfo    string
+	ReturnReason      string // <RtrInf><Rsn><Cd> of a returned payment
+}
+
+// Parse reads every statement of a camt.053 document. Element names are
+// matched without their namespace, so versions 001.02 through 001.08 parse
+// alike. Only booked entries are returned.
+func Parse(r io.Reader) ([]Statement, error) {
+	var doc document
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid XML: %v", err)
+	}
+	if len(doc.Statements) == 0 {
+		return nil, fmt.Errorf("no camt.053 statement found")
+	}
+
+	statements := make([]Statement, 0, len(doc.Statements))
+	for _, s := range doc.Statements {
+		statement := Statement{
+			ID:             strings.TrimSpace(s.ID),
+			SequenceNumber: strings.TrimSpace(s.SequenceNumber),
+			AccountID:      strings.TrimSpace(s.Account.IBAN),
+			Currency:       strings.TrimSpace(s.Account.Currency),
+		}
+		if statement.AccountID == "" {
+			statement.AccountID = strings.TrimSpace(s.Account.OtherID)
+		}
+		if statement.AccountID == "" {
+			return nil, fmt.Errorf("statement %s has no account", statement.ID)
+		}
+
+		if err := closingBalance(&statement, s.Balances); err != nil {
+			return nil, fmt.Errorf("statement %s: %v", statement.ID, err)
+		}
+
+		for i, e := range s.Entries {
+			if !e.booked() {
+				continue
+			}
+			entry, err := convertEntry(e)
+			if err != nil {
+				return nil, fmt.Errorf("statement %s entry %d: %v", statement.ID, i+1, err)
+			}
+			statement.Entries = append(statement.Entries, entry)
+		}
+		statements = append(statements, statement)
+	}
+	return statements, nil
+}
+
+// closingBalance sets the closing booked balance of a statement from its
+// <Bal> elements
+func closingBalance(statement *Statement, balances []balance) error {
+	for _, b := range balances {
+		if strings.TrimSpace(b.Type) != "CLBD" {
+			continue
+		}
+		amount, err := parseAmount(b.Amount.Value)
+		if err != nil {
+			return err
+		}
+		debit, err := isDebit(b.CreditDebit)
+		if err != nil {
+			return err
+		}
+		if debit {
+			amount = -amount
+		}
+		if statement.ClosingDate = b.Date.date(); statement.ClosingDate == "" {
+			return fmt.Errorf("closing balance has no date")
+		}
+		statement.ClosingBalance = amount
+		if statement.Currency == "" {
+			statement.Currency = b.Amount.Currency
+		}
+	}
+	return nil
+}
+
+func convertEntry(e entry) (Entry, error) {
+	amount, err := parseAmount(e.Amount.Value)
+	if err != nil {
+		return Entry{}, err
+	}
+	debit, err := isDebit(e.CreditDebit)
+	if err != nil {
+		return Entry{}, err
+	}
+	if debit {
+		amount = -amount
+	}
+
+	converted := Entry{
+		Reference:         strings.TrimSpace(e.Reference),
+		ServicerReference: strings.TrimSpace(e.ServicerReference),
+		Amount:            amount,
+		Currency:          e.Amount.Currency,
+		Reversal:          e.Reversal == "true",
+		BookingDate:       e.BookingDate.date(),
+		ValueDate:         e.ValueDate.date(),
+		AdditionalInfo:    strings.TrimSpace(e.AdditionalInfo),
+	}
+	if converted.BookingDate == "" && converted.ValueDate == "" {
+		return Entry{}, fmt.Errorf("no booking or value date")
+	}
+	if converted.ValueDate == "" {
+		converted.ValueDate = converted.BookingDate
+	}
+
+	for _, details := range e.Details {
+		for _, tx := range details.Transactions {
+			t, err := convertTransaction(tx, debit)
+			if err != nil {
+				return Entry{}, err
+			}
+			converted.Transactions = append(converted.Transactions, t)
+		}
+	}
+	return converted, nil
+}
+
+func convertTransaction(tx transactionDetails, debit bool) (Transaction, error) {
+	t := Transaction{
+		EndToEndID:        strings.TrimSpace(tx.Refs.EndToEndID),
+		ServicerReference: strings.TrimSpace(tx.Refs.ServicerReference),
+		TransactionID:     strings.TrimSpace(tx.Refs.TransactionID),
+		AdditionalInfo:    strings.TrimSpace(tx.AdditionalInfo),
+		ReturnReason:      strings.TrimSpace(tx.ReturnInfo.Reason),
+	}
+	if tx.Amount.Value != "" {
+		amount, err := parseAmount(tx.Amount.Value)
+		if err != nil {
+			return Transaction{}, err
+		}
+		if debit {
+			amount = -amount
+		}
+		t.Amount = amount
+	}
+
+	// The counterparty is the debtor of an incoming payment and the creditor
+	// of an outgoing one
+	party, account, agent := tx.Parties.Debtor, tx.Parties.DebtorAccount, tx.Agents.DebtorAgent
+	if debit {
+		party, account, agent = tx.Parties.Creditor, tx.Parties.CreditorAccount, tx.Agents.CreditorAgent
+	}
+	t.CounterpartyName = strings.TrimSpace(party.name())
+	t.CounterpartyIBAN = strings.TrimSpace(account.IBAN)
+	t.CounterpartyBIC = strings.TrimSpace(agent.bic())
+
+	var lines []string
+	for _, line := range tx.Remittance.Unstructured {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	t.Remittance = strings.Join(lines, " ")
+	for _, s := range tx.Remittance.Structured {
+		if ref := strings.TrimSpace(s.CreditorReference); ref != "" {
+			t.CreditorReference = ref
+			break
+		}
+	}
+	return t, nil
+}
+
+func isDebit(indicator string) (bool, error) {
+	switch strings.TrimSpace(indicator) {
+	case "DBIT":
+		return true, nil
+	case "CRDT":
+		return false, nil
+	default:
+		return false, fmt.Errorf("invalid credit/debit indicator %q", indicator)
+	}
+}
+
+func parseAmount(value string) (money.Amount, error) {
+	amount, err := money.Parse(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+	return amount, nil
+}
+
+type document struct {
+	Statements []statement `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type statement struct {
+	ID             string    `xml:"Id"`
+	SequenceNumber string    `xml:"ElctrncSeqNb"`
+	Account        account   `xml:"Acct"`
+	Balances       []balance `xml:"Bal"`
+	Entries        []entry   `xml:"Ntry"`
+}
+
+type balance struct {
+	Type        string     `xml:"Tp>CdOrPrtry>Cd"`
+	Amount      amount     `xml:"Amt"`
+	CreditDebit string     `xml:"CdtDbtInd"`
+	Date        dateChoice `xml:"Dt"`
+}
+
+type account struct {
+	IBAN     string `xml:"Id>IBAN"`
+	OtherID  string `xml:"Id>Othr>Id"`
+	Currency string `xml:"Ccy"`
+}
+
+type amount struct {
+	Value    string `xml:",chardata"`
+	Currency string `xml:"Ccy,attr"`
+}
+
+type dateChoice struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+func (d dateChoice) date() string {
+	if d.Date != "" {
+		return strings.TrimSpace(d.Date)
+	}
+	if len(strings.TrimSpace(d.DateTime)) >= 10 {
+		return strings.TrimSpace(d.DateTime)[:10]
+	}
+	return ""
+}
+
+type entry struct {
+	Reference         string         `xml:"NtryRef"`
+	Amount            amount         `xml:"Amt"`
+	CreditDebit       string         `xml:"CdtDbtInd"`
+	Reversal          string         `xml:"RvslInd"`
+	Status            status         `xml:"Sts"`
+	BookingDate       dateChoice     `xml:"BookgDt"`
+	ValueDate         dateChoice     `xml:"ValDt"`
+	ServicerReference string         `xml:"AcctSvcrRef"`
+	Details           []entryDetails `xml:"NtryDtls"`
+	AdditionalInfo    string         `xml:"AddtlNtryInf"`
+}
+
+// booked reports whether the entry is final: <Sts>BOOK</Sts> up to version
+// 001.07, <Sts><Cd>BOOK</Cd></Sts> from 001.08. A missing status counts as booked.
+func (e entry) booked() bool {
+	code := strings.TrimSpace(e.Status.Code)
+	if code == "" {
+		code = strings.TrimSpace(e.Status.Value)
+	}
+	return code == "" || code == "BOOK"
+}
+
+type status struct {
+	Value string `xml:",chardata"`
+	Code  string `xml:"Cd"`
+}
+
+type entryDetails struct {
+	Transactions []transactionDetails `xml:"TxDtls"`
+}
+
+type transactionDetails struct {
+	Refs struct {
+		EndToEndID        string `xml:"EndToEndId"`
+		ServicerReference string `xml:"AcctSvcrRef"`
+		TransactionID     string `xml:"TxId"`
+	} `xml:"Refs"`
+	Amount  amount `xml:"Amt"`
+	Parties struct {
+		Debtor          party   `xml:"Dbtr"`
+		DebtorAccount   account `xml:"DbtrAcct"`
+		Creditor        party   `xml:"Cdtr"`
+		CreditorAccount account `xml:"CdtrAcct"`
+	} `xml:"RltdPties"`
+	Agents struct {
+		DebtorAgent   agent `xml:"DbtrAgt"`
+		CreditorAgent agent `xml:"CdtrAgt"`
+	} `xml:"RltdAgts"`
+	Remittance struct {
+		Unstructured []string `xml:"Ustrd"`
+		Structured   []struct {
+			CreditorReference string `xml:"CdtrRefInf>Ref"`
+		} `xml:"Strd"`
+	} `xml:"RmtInf"`
+	AdditionalInfo string `xml:"AddtlTxInf"`
+	ReturnInfo     struct {
+		Reason string `xml:"Rsn>Cd"`
+	} `xml:"RtrInf"`
+}
+
+// party holds <Nm> directly up to 001.07 and under <Pty> from 001.08
+type party struct {
+	Name      string `xml:"Nm"`
+	PartyName string `xml:"Pty>Nm"`
+}
+
+func (p party) name() string {
+	if p.Name != "" {
+		return p.Name
+	}
+	return p.PartyName
+}
+
+// agent holds <BIC> in 001.02 and <BICFI> from 001.03
+type agent struct {
+	BIC   string `xml:"FinInstnId>BIC"`
+	BICFI string `xml:"FinInstnId>BICFI"`
+}
+
+func (a agent) bic() string {
+	if a.BICFI != "" {
+		return a.BICFI
+	}
+	return a.BIC
+}
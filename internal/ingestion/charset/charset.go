@@ -0,0 +1,294 @@
+// Package charset converts uploaded statement files to UTF-8 from the
+// encodings banks export in, recording every byte sequence that has no
+// character in the source encoding instead of silently dropping it.
+package charset
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const (
+	Auto        = "auto"
+	UTF8        = "utf-8"
+	UTF16LE     = "utf-16le"
+	UTF16BE     = "utf-16be"
+	Windows1252 = "windows-1252"
+	ISO88591    = "iso-8859-1"
+
+	// Binary is reported for zip archives such as workbooks, which are not
+	// text and are not converted
+	Binary = "binary"
+)
+
+// maxReported bounds how many unmapped sequences a result lists; the count
+// covers them all
+const maxReported = 100
+
+// aliases maps the names an encoding is commonly given to its canonical
+// name. "utf-16" without an order is read from the byte order mark.
+var aliases = map[string]string{
+	"auto":         Auto,
+	"utf-8":        UTF8,
+	"utf8":         UTF8,
+	"utf-16":       "utf-16",
+	"utf16":        "utf-16",
+	"utf-16le":     UTF16LE,
+	"utf-16be":     UTF16BE,
+	"windows-1252": Windows1252,
+	"cp1252":       Windows1252,
+	"iso-8859-1":   ISO88591,
+	"iso8859-1":    ISO88591,
+	"latin-1":      ISO88591,
+	"latin1":       ISO88591,
+}
+
+// windows1252 holds the characters of bytes 0x80 to 0x9F; the rest of the
+// code page is Latin-1. Zero marks the five bytes with no character.
+var windows1252 = [32]rune{
+	0x20AC, 0, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0, 0x017D, 0,
+	0, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0, 0x017E, 0x0178,
+}
+
+var (
+	utf8BOM    = []byte{0xEF, 0xBB, 0xBF}
+	utf16LEBOM = []byte{0xFF, 0xFE}
+	utf16BEBOM = []byte{0xFE, 0xFF}
+	zipMagic   = []byte("PK\x03\x04")
+
+	xmlDeclaration = regexp.MustCompile(`^<\?xml[^>]*?encoding\s*=\s*["']([A-Za-z0-9._-]+)["']`)
+)
+
+// Unmapped is a byte sequence of the source with no character in its
+// encoding. It is replaced by U+FFFD in the converted text.
+type Unmapped struct {
+	Offset int    `json:"offset"`
+	Bytes  string `json:"bytes"`
+}
+
+// Result is a file converted to UTF-8. Detected is set when the encoding was
+// not given; Unmapped lists the first of the UnmappedCount sequences that
+// could not be converted.
+type Result struct {
+	Text          []byte     `json:"-"`
+	Encoding      string     `json:"encoding"`
+	Detected      bool       `json:"detected"`
+	UnmappedCount int        `json:"unmapped_count"`
+	Unmapped      []Unmapped `json:"unmapped,omitempty"`
+}
+
+// Normalize turns an encoding name into its canonical form. An empty name
+// is Auto.
+func Normalize(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return Auto, nil
+	}
+	canonical, ok := aliases[name]
+	if !ok {
+		return "", fmt.Errorf("unsupported encoding %q", name)
+	}
+	return canonical, nil
+}
+
+// Detect guesses the encoding of a file: a byte order mark first, then the
+// encoding an XML declaration names, then UTF-16 from the pattern of zero
+// bytes, then UTF-8 if the file is valid UTF-8, and Windows-1252 otherwise,
+// which reads Latin-1 text alike
+func Detect(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, utf8BOM):
+		return UTF8
+	case bytes.HasPrefix(data, utf16LEBOM):
+		return UTF16LE
+	case bytes.HasPrefix(data, utf16BEBOM):
+		return UTF16BE
+	}
+	if match := xmlDeclaration.FindSubmatch(data); match != nil {
+		if declared, err := Normalize(string(match[1])); err == nil && declared != "utf-16" {
+			return declared
+		}
+	}
+	if order := utf16Order(data); order != "" {
+		return order
+	}
+	if utf8.Valid(data) {
+		return UTF8
+	}
+	return Windows1252
+}
+
+// utf16Order recognizes UTF-16 text without a byte order mark from the zero
+// high bytes of its ASCII characters
+func utf16Order(data []byte) string {
+	sample := data[:min(len(data), 1024)]
+	if len(sample) < 4 {
+		return ""
+	}
+	var evenZeros, oddZeros int
+	for i, b := range sample {
+		if b != 0 {
+			continue
+		}
+		if i%2 == 0 {
+			evenZeros++
+		} else {
+			oddZeros++
+		}
+	}
+	pairs := len(sample) / 2
+	switch {
+	case oddZeros*10 > pairs*4 && evenZeros*10 < pairs:
+		return UTF16LE
+	case evenZeros*10 > pairs*4 && oddZeros*10 < pairs:
+		return UTF16BE
+	}
+	return ""
+}
+
+// Decode converts data from the named encoding, or from the detected one
+// for Auto, to UTF-8 without a byte order mark. Workbooks and other zip
+// archives are binary and left as they are. An XML declaration is rewritten
+// to name UTF-8, so XML parsers read the converted text.
+func Decode(data []byte, name string) (*Result, error) {
+	encoding, err := Normalize(name)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{Encoding: encoding}
+	if bytes.HasPrefix(data, zipMagic) {
+		result.Text = data
+		if encoding == Auto {
+			result.Encoding, result.Detected = Binary, true
+		}
+		return result, nil
+	}
+
+	switch encoding {
+	case Auto:
+		result.Encoding, result.Detected = Detect(data), true
+	case "utf-16":
+		result.Encoding = UTF16LE
+		if bytes.HasPrefix(data, utf16BEBOM) {
+			result.Encoding = UTF16BE
+		}
+	}
+
+	switch result.Encoding {
+	case UTF8:
+		text := bytes.TrimPrefix(data, utf8BOM)
+		result.Text = decodeUTF8(text, len(data)-len(text), result)
+	case UTF16LE:
+		text := bytes.TrimPrefix(data, utf16LEBOM)
+		result.Text = decodeUTF16(text, len(data)-len(text), false, result)
+	case UTF16BE:
+		text := bytes.TrimPrefix(data, utf16BEBOM)
+		result.Text = decodeUTF16(text, len(data)-len(text), true, result)
+	case Windows1252:
+		result.Text = decodeSingleByte(data, true, result)
+	case ISO88591:
+		result.Text = decodeSingleByte(data, false, result)
+	}
+	result.Text = declareUTF8(result.Text)
+	return result, nil
+}
+
+func (r *Result) unmapped(offset int, sequence []byte) {
+	r.UnmappedCount++
+	if len(r.Unmapped) < maxReported {
+		r.Unmapped = append(r.Unmapped, Unmapped{Offset: offset, Bytes: hex.EncodeToString(sequence)})
+	}
+}
+
+// decodeUTF8 replaces invalid sequences; base is the offset of data in the
+// file
+func decodeUTF8(data []byte, base int, result *Result) []byte {
+	if utf8.Valid(data) {
+		return data
+	}
+	out := make([]byte, 0, len(data))
+	for i := 0; i < len(data); {
+		r, size := utf8.DecodeRune(data[i:])
+		if r == utf8.RuneError && size <= 1 {
+			result.unmapped(base+i, data[i:i+1])
+			out = utf8.AppendRune(out, utf8.RuneError)
+			i++
+			continue
+		}
+		out = append(out, data[i:i+size]...)
+		i += size
+	}
+	return out
+}
+
+// decodeUTF16 reads code units in the given byte order; base is the offset
+// of data in the file. Unpaired surrogates and a trailing odd byte are
+// unmapped.
+func decodeUTF16(data []byte, base int, bigEndian bool, result *Result) []byte {
+	unit := func(i int) rune {
+		if bigEndian {
+			return rune(data[i])<<8 | rune(data[i+1])
+		}
+		return rune(data[i+1])<<8 | rune(data[i])
+	}
+
+	out := make([]byte, 0, len(data))
+	for i := 0; i+1 < len(data); i += 2 {
+		u := unit(i)
+		if !utf16.IsSurrogate(u) {
+			out = utf8.AppendRune(out, u)
+			continue
+		}
+		if i+3 < len(data) {
+			if r := utf16.DecodeRune(u, unit(i+2)); r != utf8.RuneError {
+				out = utf8.AppendRune(out, r)
+				i += 2
+				continue
+			}
+		}
+		result.unmapped(base+i, data[i:i+2])
+		out = utf8.AppendRune(out, utf8.RuneError)
+	}
+	if len(data)%2 == 1 {
+		result.unmapped(base+len(data)-1, data[len(data)-1:])
+		out = utf8.AppendRune(out, utf8.RuneError)
+	}
+	return out
+}
+
+// decodeSingleByte reads Latin-1, or Windows-1252 whose 0x80 to 0x9F range
+// holds printable characters instead of control codes
+func decodeSingleByte(data []byte, cp1252 bool, result *Result) []byte {
+	out := make([]byte, 0, len(data)+len(data)/8)
+	for i, b := range data {
+		r := rune(b)
+		if cp1252 && b >= 0x80 && b <= 0x9F {
+			r = windows1252[b-0x80]
+			if r == 0 {
+				result.unmapped(i, data[i:i+1])
+				r = utf8.RuneError
+			}
+		}
+		out = utf8.AppendRune(out, r)
+	}
+	return out
+}
+
+// declareUTF8 makes an XML declaration name the encoding the text is now in
+func declareUTF8(text []byte) []byte {
+	match := xmlDeclaration.FindSubmatchIndex(text)
+	if match == nil || strings.EqualFold(string(text[match[2]:match[3]]), UTF8) {
+		return text
+	}
+	converted := make([]byte, 0, len(text))
+	converted = append(converted, text[:match[2]]...)
+	converted = append(converted, UTF8...)
+	return append(converted, text[match[3]:]...)
+}
@@ -0,0 +1,212 @@
+// Package detect identifies the format of an uploaded statement file from
+// its content, without relying on its name or declared content type.
+package detect
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"io"
+	"regexp"
+	"strings"
+)
+
+const (
+	FormatCSV     = "csv"
+	FormatMT940   = "mt940"
+	FormatCAMT053 = "camt053"
+	FormatOFX     = "ofx"
+	FormatXLSX    = "xlsx"
+	FormatUnknown = "unknown"
+)
+
+// sniffLimit bounds how much of a text file is inspected
+const sniffLimit = 64 << 10
+
+// csvSampleLines is how many lines the delimiter is guessed from
+const csvSampleLines = 20
+
+var csvDelimiters = []rune{',', ';', '\t', '|'}
+
+var (
+	utf8BOM       = []byte{0xEF, 0xBB, 0xBF}
+	zipSignature  = []byte("PK\x03\x04")
+	mt940Tag      = regexp.MustCompile(`(?m)^:(20|25|28C|60[FM]|61|62[FM]|86):`)
+	camt053Schema = regexp.MustCompile(`urn:iso:std:iso:20022:tech:xsd:camt\.053`)
+)
+
+// Detection is the most likely format of a file. Confidence runs from 0 to
+// 1; Delimiter is set for CSV only.
+type Detection struct {
+	Format     string  `json:"format"`
+	Confidence float64 `json:"confidence"`
+	Delimiter  string  `json:"delimiter,omitempty"`
+}
+
+// Detect inspects a file's content. A file matching none of the formats is
+// FormatUnknown with no confidence.
+func Detect(data []byte) Detection {
+	if bytes.HasPrefix(data, zipSignature) {
+		return detectZip(data)
+	}
+
+	text := bytes.TrimPrefix(data, utf8BOM)
+	if len(text) > sniffLimit {
+		text = text[:sniffLimit]
+	}
+	text = bytes.TrimSpace(text)
+	if len(text) == 0 || bytes.IndexByte(text, 0) >= 0 {
+		return Detection{Format: FormatUnknown}
+	}
+
+	if detection, ok := detectOFX(text); ok {
+		return detection
+	}
+	if text[0] == '<' {
+		return detectXML(text)
+	}
+	if detection, ok := detectMT940(text); ok {
+		return detection
+	}
+	return detectCSV(text)
+}
+
+// detectZip tells a workbook from any other zip archive
+func detectZip(data []byte) Detection {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		// A truncated upload still starts like one
+		return Detection{Format: FormatXLSX, Confidence: 0.3}
+	}
+	for _, file := range archive.File {
+		if file.Name == "xl/workbook.xml" {
+			return Detection{Format: FormatXLSX, Confidence: 0.99}
+		}
+	}
+	return Detection{Format: FormatUnknown}
+}
+
+// detectOFX recognizes the SGML header of OFX 1.x and the processing
+// instruction or root element of OFX 2.x
+func detectOFX(text []byte) (Detection, bool) {
+	head := strings.ToUpper(string(text[:min(len(text), 4096)]))
+	switch {
+	case strings.HasPrefix(head, "OFXHEADER:"):
+		return Detection{Format: FormatOFX, Confidence: 0.99}, true
+	case strings.Contains(head, "<?OFX "):
+		return Detection{Format: FormatOFX, Confidence: 0.98}, true
+	case strings.Contains(head, "<OFX>"):
+		return Detection{Format: FormatOFX, Confidence: 0.9}, true
+	}
+	return Detection{}, false
+}
+
+func detectXML(text []byte) Detection {
+	switch {
+	case camt053Schema.Match(text):
+		return Detection{Format: FormatCAMT053, Confidence: 0.99}
+	case bytes.Contains(text, []byte("<BkToCstmrStmt")):
+		// The message without its namespace
+		return Detection{Format: FormatCAMT053, Confidence: 0.8}
+	}
+	return Detection{Format: FormatUnknown}
+}
+
+// detectMT940 scores the statement tags found at line starts. The
+// transaction reference and account tags must be there; each of the others
+// raises the confidence, as does a SWIFT block header.
+func detectMT940(text []byte) (Detection, bool) {
+	tags := make(map[string]bool)
+	for _, match := range mt940Tag.FindAllSubmatch(text, -1) {
+		tag := string(match[1])
+		if tag == "60M" || tag == "62M" {
+			tag = tag[:2] + "F"
+		}
+		tags[tag] = true
+	}
+	if !tags["20"] || !tags["25"] {
+		return Detection{}, false
+	}
+
+	confidence := 0.5
+	for _, tag := range []string{"28C", "60F", "61", "62F", "86"} {
+		if tags[tag] {
+			confidence += 0.1
+		}
+	}
+	if bytes.HasPrefix(text, []byte("{1:")) {
+		confidence = 0.99
+	}
+	return Detection{Format: FormatMT940, Confidence: min(confidence, 0.99)}, true
+}
+
+// detectCSV picks the delimiter that splits the most sampled lines into the
+// same number of fields. Confidence is the share of lines agreeing on it.
+func detectCSV(text []byte) Detection {
+	if !printable(text) {
+		return Detection{Format: FormatUnknown}
+	}
+
+	best := Detection{Format: FormatUnknown}
+	var bestFields int
+	for _, delimiter := range csvDelimiters {
+		agreeing, total, fields := sampleCSV(text, delimiter)
+		if total == 0 || fields < 2 {
+			continue
+		}
+		confidence := 0.9 * float64(agreeing) / float64(total)
+		// A single line says little about its layout
+		if total == 1 {
+			confidence /= 2
+		}
+		if confidence > best.Confidence || (confidence == best.Confidence && fields > bestFields) {
+			best = Detection{Format: FormatCSV, Confidence: confidence, Delimiter: string(delimiter)}
+			bestFields = fields
+		}
+	}
+	return best
+}
+
+// sampleCSV splits the leading lines of text and reports how many of them
+// have the most common field count, how many were read, and that count
+func sampleCSV(text []byte, delimiter rune) (int, int, int) {
+	reader := csv.NewReader(bytes.NewReader(text))
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	counts := make(map[int]int)
+	total := 0
+	for total < csvSampleLines {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// The sample may end mid-record
+			break
+		}
+		counts[len(record)]++
+		total++
+	}
+
+	agreeing, fields := 0, 0
+	for count, lines := range counts {
+		if lines > agreeing || (lines == agreeing && count > fields) {
+			agreeing, fields = lines, count
+		}
+	}
+	return agreeing, total, fields
+}
+
+// printable rejects text with control characters other than whitespace.
+// Bytes of UTF-8 sequences and of single-byte encodings such as Latin-1
+// are all above them.
+func printable(text []byte) bool {
+	for _, b := range text {
+		if b < 0x20 && b != '\n' && b != '\r' && b != '\t' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,293 @@
+// Package mt940 parses SWIFT MT940 customer statement messages.
+package mt940
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"reconciliation-service/internal/money"
+)
+
+// Statement is one MT940 message: an account statement with its entries
+type Statement struct {
+	TransactionReference string        // :20:
+	AccountID            string        // :25:
+	StatementNumber      string        // :28C:
+	Currency             string        // from :60F:/:60M:
+	OpeningBalance       money.Amount  // :60F:/:60M:, signed
+	ClosingBalance       money.Amount  // :62F:/:62M:, signed
+	ClosingDate          string        // YYYY-MM-DD of :62F:/:62M:, empty when absent
+	Transactions         []Transaction // :61: with its :86:
+}
+
+// Transaction is one :61: statement line and the :86: information that follows it
+type Transaction struct {
+	ValueDate            string       // YYYY-MM-DD
+	EntryDate            string       // YYYY-MM-DD, the value date when absent
+	Amount               money.Amount // negative for debits
+	TransactionType      string       // e.g. NTRF
+	CustomerReference    string
+	BankReference        string
+	SupplementaryDetails string
+	Information          string // :86:, lines joined
+
+	// Reversal is set for the RC and RD marks; ReturnReason is the code of
+	// a /RTRN/ field in :86:
+	Reversal     bool
+	ReturnReason string
+
+	// Decoded from a structured (?-subfield) :86:, when present
+	CounterpartyName    string
+	CounterpartyAccount string
+	CounterpartyBankID  string
+	Remittance          string
+}
+
+// statementLine matches the fixed part of a :61: field
+var statementLine = regexp.MustCompile(`^(\d{6})(\d{4})?(RC|RD|C|D)([A-Z])?(\d+,\d*)([NFS][A-Z0-9]{3})(.*)$`)
+
+// returnReason matches the SWIFT /RTRN/ code of a returned payment in :86:
+var returnReason = regexp.MustCompile(`/RTRN/([A-Z0-9]{2,4})\b`)
+
+// balance matches :60F:, :60M:, :62F: and :62M: contents
+var balance = regexp.MustCompile(`^([CD])(\d{6})([A-Z]{3})(\d+,\d*)$`)
+
+// Parse reads every statement in an MT940 file. SWIFT block headers ({1:...}
+// {2:...}{4:) and trailers (-}) are tolerated, so both raw bank downloads and
+// bare field lists parse.
+func Parse(r io.Reader) ([]Statement, error) {
+	fields, err := readFields(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var statements []Statement
+	var current *Statement
+	for _, f := range fields {
+		if f.tag == "20" {
+			statements = append(statements, Statement{TransactionReference: f.value})
+			current = &statements[len(statements)-1]
+			continue
+		}
+		if current == nil {
+			return nil, fmt.Errorf("line %d: field :%s: before :20:", f.line, f.tag)
+		}
+
+		switch f.tag {
+		case "25":
+			current.AccountID = f.value
+		case "28C", "28":
+			current.StatementNumber = f.value
+		case "60F", "60M":
+			amount, currency, _, err := parseBalance(f.value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", f.line, err)
+			}
+			current.OpeningBalance = amount
+			current.Currency = currency
+		case "62F", "62M":
+			amount, _, date, err := parseBalance(f.value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", f.line, err)
+			}
+			current.ClosingBalance = amount
+			current.ClosingDate = date
+		case "61":
+			tx, err := parseStatementLine(f.value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", f.line, err)
+			}
+			current.Transactions = append(current.Transactions, tx)
+		case "86":
+			// :86: after the balances describes the statement, not an entry
+			if n := len(current.Transactions); n > 0 && current.Transactions[n-1].Information == "" {
+				decodeInformation(&current.Transactions[n-1], f.value)
+			}
+		}
+	}
+
+	if len(statements) == 0 {
+		return nil, fmt.Errorf("no MT940 statement found")
+	}
+	for _, s := range statements {
+		if s.AccountID == "" {
+			return nil, fmt.Errorf("statement %s has no :25: account", s.TransactionReference)
+		}
+	}
+	return statements, nil
+}
+
+type field struct {
+	tag   string
+	value string
+	line  int
+}
+
+var fieldTag = regexp.MustCompile(`^:([0-9]{2}[A-Z]?):(.*)$`)
+
+// readFields splits the message into tagged fields, joining continuation lines
+// with newlines
+func readFields(r io.Reader) ([]field, error) {
+	var fields []field
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimRight(scanner.Text(), "\r ")
+
+		// Strip SWIFT block framing around the text block
+		if strings.HasPrefix(line, "{") {
+			if i := strings.Index(line, "{4:"); i >= 0 {
+				line = line[i+3:]
+			} else {
+				continue
+			}
+		}
+		if line == "" || line == "-" || line == "-}" || strings.HasPrefix(line, "-}") {
+			continue
+		}
+
+		if m := fieldTag.FindStringSubmatch(line); m != nil {
+			fields = append(fields, field{tag: m[1], value: m[2], line: lineNo})
+			continue
+		}
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("line %d: expected a field tag", lineNo)
+		}
+		fields[len(fields)-1].value += "\n" + line
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// parseBalance returns the signed amount, currency and date (YYYY-MM-DD) of
+// a balance field
+func parseBalance(value string) (money.Amount, string, string, error) {
+	m := balance.FindStringSubmatch(strings.TrimSpace(value))
+	if m == nil {
+		return 0, "", "", fmt.Errorf("invalid balance %q", value)
+	}
+	date, err := time.Parse("060102", m[2])
+	if err != nil {
+		return 0, "", "", fmt.Errorf("invalid balance date %q", m[2])
+	}
+	amount, err := parseAmount(m[4])
+	if err != nil {
+		return 0, "", "", err
+	}
+	if m[1] == "D" {
+		amount = -amount
+	}
+	return amount, m[3], date.Format("2006-01-02"), nil
+}
+
+func parseStatementLine(value string) (Transaction, error) {
+	first, supplementary, _ := strings.Cut(value, "\n")
+	m := statementLine.FindStringSubmatch(first)
+	if m == nil {
+		return Transaction{}, fmt.Errorf("invalid :61: statement line %q", first)
+	}
+
+	valueDate, err := time.Parse("060102", m[1])
+	if err != nil {
+		return Transaction{}, fmt.Errorf("invalid value date %q", m[1])
+	}
+	tx := Transaction{
+		ValueDate:            valueDate.Format("2006-01-02"),
+		EntryDate:            valueDate.Format("2006-01-02"),
+		TransactionType:      m[6],
+		SupplementaryDetails: strings.TrimSpace(supplementary),
+	}
+	if m[2] != "" {
+		tx.EntryDate = entryDate(valueDate, m[2])
+	}
+
+	amount, err := parseAmount(m[5])
+	if err != nil {
+		return Transaction{}, err
+	}
+	// Debits and reversals of credits reduce the balance
+	if m[3] == "D" || m[3] == "RC" {
+		amount = -amount
+	}
+	tx.Amount = amount
+	tx.Reversal = m[3] == "RC" || m[3] == "RD"
+
+	reference := m[7]
+	if customer, bank, ok := strings.Cut(reference, "//"); ok {
+		tx.CustomerReference = strings.TrimSpace(customer)
+		tx.BankReference = strings.TrimSpace(bank)
+	} else {
+		tx.CustomerReference = strings.TrimSpace(reference)
+	}
+	if tx.CustomerReference == "NONREF" {
+		tx.CustomerReference = ""
+	}
+	return tx, nil
+}
+
+// entryDate resolves the MMDD booking date against the value date's year,
+// allowing for bookings that cross the year end
+func entryDate(valueDate time.Time, mmdd string) string {
+	month, _ := strconv.Atoi(mmdd[:2])
+	day, _ := strconv.Atoi(mmdd[2:])
+	date := time.Date(valueDate.Year(), time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if diff := date.Sub(valueDate).Hours() / 24; diff > 180 {
+		date = date.AddDate(-1, 0, 0)
+	} else if diff < -180 {
+		date = date.AddDate(1, 0, 0)
+	}
+	return date.Format("2006-01-02")
+}
+
+func parseAmount(value string) (money.Amount, error) {
+	amount, err := money.Parse(strings.Replace(value, ",", ".", 1))
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+	return amount, nil
+}
+
+// decodeInformation stores the :86: text and, for the structured
+// "NNN?20...?32..." layout used by German and Dutch banks, its subfields
+func decodeInformation(tx *Transaction, value string) {
+	info := strings.ReplaceAll(value, "\n", "")
+	tx.Information = strings.ReplaceAll(value, "\n", " ")
+	if m := returnReason.FindStringSubmatch(info); m != nil {
+		tx.ReturnReason = m[1]
+	}
+
+	if len(info) < 4 || info[3] != '?' {
+		tx.Remittance = tx.Information
+		return
+	}
+
+	var remittance, name []string
+	for _, part := range strings.Split(info[4:], "?") {
+		if len(part) < 2 {
+			continue
+		}
+		code, text := part[:2], strings.TrimSpace(part[2:])
+		switch {
+		case code >= "20" && code <= "29", code >= "60" && code <= "63":
+			remittance = append(remittance, text)
+		case code == "30":
+			tx.CounterpartyBankID = text
+		case code == "31":
+			tx.CounterpartyAccount = text
+		case code == "32" || code == "33":
+			name = append(name, text)
+		}
+	}
+	tx.Remittance = strings.TrimSpace(strings.Join(remittance, " "))
+	tx.CounterpartyName = strings.TrimSpace(strings.Join(name, " "))
+}
@@ -0,0 +1,282 @@
+// Package kpi evaluates the summary figures tenants define over a batch's
+// results: small arithmetic expressions over the batch's metrics.
+package kpi
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expression is a parsed KPI expression. It supports numbers, metric names,
+// + - * / with the usual precedence, parentheses, unary minus and the
+// functions abs, min, max and round.
+type Expression struct {
+	root node
+}
+
+type node interface {
+	eval(metrics map[string]float64) (float64, bool)
+}
+
+type number float64
+
+func (n number) eval(map[string]float64) (float64, bool) { return float64(n), true }
+
+type variable string
+
+func (v variable) eval(metrics map[string]float64) (float64, bool) {
+	return metrics[string(v)], true
+}
+
+type negation struct{ operand node }
+
+func (n negation) eval(metrics map[string]float64) (float64, bool) {
+	value, ok := n.operand.eval(metrics)
+	return -value, ok
+}
+
+type binary struct {
+	op          byte
+	left, right node
+}
+
+// eval leaves a division by zero undefined rather than infinite
+func (b binary) eval(metrics map[string]float64) (float64, bool) {
+	left, ok := b.left.eval(metrics)
+	if !ok {
+		return 0, false
+	}
+	right, ok := b.right.eval(metrics)
+	if !ok {
+		return 0, false
+	}
+	switch b.op {
+	case '+':
+		return left + right, true
+	case '-':
+		return left - right, true
+	case '*':
+		return left * right, true
+	default:
+		if right == 0 {
+			return 0, false
+		}
+		return left / right, true
+	}
+}
+
+type call struct {
+	name string
+	args []node
+}
+
+// functions maps the callable names to their arity, -1 for two or more
+var functions = map[string]int{"abs": 1, "min": -1, "max": -1, "round": 2}
+
+func (c call) eval(metrics map[string]float64) (float64, bool) {
+	args := make([]float64, len(c.args))
+	for i, arg := range c.args {
+		value, ok := arg.eval(metrics)
+		if !ok {
+			return 0, false
+		}
+		args[i] = value
+	}
+	switch c.name {
+	case "abs":
+		return math.Abs(args[0]), true
+	case "round":
+		scale := math.Pow(10, math.Round(args[1]))
+		return math.Round(args[0]*scale) / scale, true
+	case "min":
+		result := args[0]
+		for _, arg := range args[1:] {
+			result = math.Min(result, arg)
+		}
+		return result, true
+	default:
+		result := args[0]
+		for _, arg := range args[1:] {
+			result = math.Max(result, arg)
+		}
+		return result, true
+	}
+}
+
+// Parse parses an expression, rejecting names that are not in metrics
+func Parse(source string, metrics map[string]bool) (*Expression, error) {
+	p := &parser{source: source, metrics: metrics}
+	p.next()
+	root, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if p.token != "" {
+		return nil, fmt.Errorf("unexpected %q at %d", p.token, p.offset)
+	}
+	return &Expression{root: root}, nil
+}
+
+// Eval evaluates the expression over metrics. It is undefined, and false,
+// when it divides by zero or its result is not a finite number.
+func (e *Expression) Eval(metrics map[string]float64) (float64, bool) {
+	value, ok := e.root.eval(metrics)
+	if !ok || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, false
+	}
+	return value, true
+}
+
+// parser is a recursive descent parser over one token of lookahead
+type parser struct {
+	source  string
+	metrics map[string]bool
+	pos     int
+	token   string
+	offset  int
+}
+
+func (p *parser) next() {
+	for p.pos < len(p.source) && unicode.IsSpace(rune(p.source[p.pos])) {
+		p.pos++
+	}
+	p.offset = p.pos
+	if p.pos >= len(p.source) {
+		p.token = ""
+		return
+	}
+
+	start := p.pos
+	c := p.source[p.pos]
+	switch {
+	case c >= '0' && c <= '9' || c == '.':
+		for p.pos < len(p.source) && (p.source[p.pos] >= '0' && p.source[p.pos] <= '9' || p.source[p.pos] == '.') {
+			p.pos++
+		}
+	case c == '_' || unicode.IsLetter(rune(c)):
+		for p.pos < len(p.source) && (p.source[p.pos] == '_' || unicode.IsLetter(rune(p.source[p.pos])) || unicode.IsDigit(rune(p.source[p.pos]))) {
+			p.pos++
+		}
+	default:
+		p.pos++
+	}
+	p.token = p.source[start:p.pos]
+}
+
+// expression := term (("+" | "-") term)*
+func (p *parser) expression() (node, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for p.token == "+" || p.token == "-" {
+		op := p.token[0]
+		p.next()
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// term := factor (("*" | "/") factor)*
+func (p *parser) term() (node, error) {
+	left, err := p.factor()
+	if err != nil {
+		return nil, err
+	}
+	for p.token == "*" || p.token == "/" {
+		op := p.token[0]
+		p.next()
+		right, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// factor := number | metric | function "(" expression ("," expression)* ")"
+// | "(" expression ")" | "-" factor
+func (p *parser) factor() (node, error) {
+	token, offset := p.token, p.offset
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case token == "-":
+		p.next()
+		operand, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		return negation{operand: operand}, nil
+	case token == "(":
+		p.next()
+		inner, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		if p.token != ")" {
+			return nil, fmt.Errorf("missing ) at %d", p.offset)
+		}
+		p.next()
+		return inner, nil
+	case token[0] >= '0' && token[0] <= '9' || token[0] == '.':
+		value, err := strconv.ParseFloat(token, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at %d", token, offset)
+		}
+		p.next()
+		return number(value), nil
+	case token[0] == '_' || unicode.IsLetter(rune(token[0])):
+		name := strings.ToLower(token)
+		p.next()
+		if p.token == "(" {
+			return p.call(name, offset)
+		}
+		if !p.metrics[name] {
+			return nil, fmt.Errorf("unknown metric %q at %d", token, offset)
+		}
+		return variable(name), nil
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", token, offset)
+}
+
+func (p *parser) call(name string, offset int) (node, error) {
+	arity, ok := functions[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q at %d", name, offset)
+	}
+	p.next()
+
+	var args []node
+	for {
+		arg, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.token != "," {
+			break
+		}
+		p.next()
+	}
+	if p.token != ")" {
+		return nil, fmt.Errorf("missing ) at %d", p.offset)
+	}
+	p.next()
+
+	if arity == -1 && len(args) < 2 {
+		return nil, fmt.Errorf("%s takes at least 2 arguments", name)
+	}
+	if arity > 0 && len(args) != arity {
+		return nil, fmt.Errorf("%s takes %d argument(s)", name, arity)
+	}
+	return call{name: name, args: args}, nil
+}
@@ -0,0 +1,180 @@
+package kpi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"reconciliation-service/internal/models"
+)
+
+// Metric is a figure of a batch that KPI expressions may use
+type Metric struct {
+	Name        string
+	Description string
+}
+
+// Metrics lists what a batch measures. Amounts are gross, the sum of
+// absolute values, in the base currency at the rate of each record's date.
+var Metrics = []Metric{
+	{"bank_transactions", "bank transactions in the batch"},
+	{"accounting_entries", "accounting entries in the batch"},
+	{"matched", "matches kept"},
+	{"matched_bank_transactions", "bank transactions in a match"},
+	{"matched_entries", "accounting entries in a match"},
+	{"unmatched", "bank transactions left unmatched"},
+	{"unmatched_entries", "accounting entries left unmatched"},
+	{"fees", "debits classified as bank fees"},
+	{"returns", "returns linked to their original"},
+	{"expected_paid", "expected payments fulfilled"},
+	{"disputed", "matches disputed by a return"},
+	{"bank_amount", "amount of the bank transactions"},
+	{"matched_amount", "amount of the bank transactions in a match"},
+	{"unmatched_amount", "amount of the bank transactions left unmatched"},
+	{"fee_amount", "amount of the fees"},
+	{"ledger_amount", "amount of the accounting entries"},
+	{"matched_ledger_amount", "amount of the accounting entries in a match"},
+	{"unmatched_ledger_amount", "amount of the accounting entries left unmatched"},
+	{"amount_difference", "absolute differences between matched sides"},
+	{"unconverted", "records left out of the amounts for want of an exchange rate"},
+}
+
+var metricNames = func() map[string]bool {
+	names := make(map[string]bool, len(Metrics))
+	for _, metric := range Metrics {
+		names[metric.Name] = true
+	}
+	return names
+}()
+
+var namePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// Definition is a KPI as configured: a name, the label reports show and the
+// expression computing it
+type Definition struct {
+	Name       string `json:"name"`
+	Label      string `json:"label,omitempty"`
+	Expression string `json:"expression"`
+
+	compiled *Expression
+}
+
+// File holds the KPIs every batch summary reports, and those only the
+// batches of a tenant add. A tenant KPI named like a default one replaces it.
+type File struct {
+	KPIs    []Definition            `json:"kpis,omitempty"`
+	Tenants map[string][]Definition `json:"tenants,omitempty"`
+}
+
+// LoadFile reads a KPI file, as YAML when its extension is .yaml or .yml and
+// as JSON otherwise, and compiles every expression in it
+func LoadFile(path string) (*File, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read KPI file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var document interface{}
+		if err := yaml.Unmarshal(content, &document); err != nil {
+			return nil, fmt.Errorf("KPI file %s: %v", path, err)
+		}
+		if content, err = json.Marshal(document); err != nil {
+			return nil, fmt.Errorf("KPI file %s: %v", path, err)
+		}
+	}
+
+	file := &File{}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(file); err != nil {
+		return nil, fmt.Errorf("KPI file %s: %v", path, err)
+	}
+	if err := compile(file.KPIs); err != nil {
+		return nil, fmt.Errorf("KPI file %s: %w", path, err)
+	}
+	for tenant, definitions := range file.Tenants {
+		if err := compile(definitions); err != nil {
+			return nil, fmt.Errorf("KPI file %s: tenant %s: %w", path, tenant, err)
+		}
+	}
+	return file, nil
+}
+
+func compile(definitions []Definition) error {
+	seen := make(map[string]bool, len(definitions))
+	for i := range definitions {
+		definition := &definitions[i]
+		definition.Name = strings.TrimSpace(definition.Name)
+		if !namePattern.MatchString(definition.Name) {
+			return fmt.Errorf("KPI %d: name must be lower case letters, digits and underscores", i+1)
+		}
+		if seen[definition.Name] {
+			return fmt.Errorf("KPI %s is defined twice", definition.Name)
+		}
+		seen[definition.Name] = true
+		if definition.Label == "" {
+			definition.Label = definition.Name
+		}
+
+		expression, err := Parse(definition.Expression, metricNames)
+		if err != nil {
+			return fmt.Errorf("KPI %s: %v", definition.Name, err)
+		}
+		definition.compiled = expression
+	}
+	return nil
+}
+
+// For returns the KPIs of a tenant's batches: the defaults in order, then
+// the tenant's own. A nil file defines none.
+func (f *File) For(tenant string) []Definition {
+	if f == nil {
+		return nil
+	}
+	own := f.Tenants[tenant]
+	definitions := make([]Definition, 0, len(f.KPIs)+len(own))
+	for _, definition := range f.KPIs {
+		if !defines(own, definition.Name) {
+			definitions = append(definitions, definition)
+		}
+	}
+	return append(definitions, own...)
+}
+
+func defines(definitions []Definition, name string) bool {
+	for _, definition := range definitions {
+		if definition.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate computes each KPI over a batch's metrics, rounded to four
+// decimals. A KPI undefined for the batch, such as a share of nothing, has
+// no value.
+func Evaluate(definitions []Definition, metrics map[string]float64) []*models.BatchKPI {
+	kpis := make([]*models.BatchKPI, 0, len(definitions))
+	for _, definition := range definitions {
+		kpi := &models.BatchKPI{
+			Name:       definition.Name,
+			Label:      definition.Label,
+			Expression: definition.Expression,
+		}
+		if value, ok := definition.compiled.Eval(metrics); ok {
+			rounded := math.Round(value*1e4) / 1e4
+			kpi.Value = &rounded
+		}
+		kpis = append(kpis, kpi)
+	}
+	return kpis
+}
@@ -1,11 +1,17 @@
 package matching
 
 import (
+	"fmt"
 	"math"
+	"sort"
 	"strings"
 	"time"
 
+	"reconciliation-service/internal/banking"
+	"reconciliation-service/internal/calendar"
+	"reconciliation-service/internal/currency"
 	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/money"
 )
 
 const (
@@ -15,29 +21,121 @@ const (
 	MediumMatchConfidence  = 0.80
 	LowMatchConfidence     = 0.60
 
-	// Amount difference tolerance (in percentage)
-	AmountTolerancePercent = 0.01 // 1%
+	// Amount difference tolerance (in basis points of the target amount)
+	AmountToleranceBasisPoints = 100 // 1%
 
 	// Date difference tolerance (in days)
 	DateToleranceDays = 3
+
+	// Confidence added when both sides carry the same counterparty IBAN
+	CounterpartyIBANWeight = 0.3
+
+	// Confidence added when both sides are linked to the same counterparty
+	// and the IBANs did not already say so
+	CounterpartyWeight = 0.2
+
+	// Confidence added when the descriptions name the same party: at least
+	// DescriptionMinSharedWords words in common, making up at least
+	// DescriptionOverlap of the shorter description
+	DescriptionWeight         = 0.1
+	DescriptionMinSharedWords = 2
+	DescriptionOverlap        = 0.8
+
+	// Version of the rules built from the constants above
+	DefaultRulesVersion = "default"
 )
 
+// Rules are the thresholds and weights the engine scores with. The version
+// names a rule set, so matches can be traced to the rules that made them and
+// a candidate rule set can be compared against the production one.
+type Rules struct {
+	Version string `json:"version"`
+
+	// Lowest confidence of a one-to-one match, and of a match that groups
+	// several records on one side
+	MinConfidence      float64 `json:"min_confidence"`
+	MinGroupConfidence float64 `json:"min_group_confidence"`
+
+	AmountToleranceBasisPoints int64 `json:"amount_tolerance_basis_points"`
+	DateToleranceDays          int   `json:"date_tolerance_days"`
+
+	CounterpartyIBANWeight    float64 `json:"counterparty_iban_weight"`
+	CounterpartyWeight        float64 `json:"counterparty_weight"`
+	DescriptionWeight         float64 `json:"description_weight"`
+	DescriptionMinSharedWords int     `json:"description_min_shared_words"`
+	DescriptionOverlap        float64 `json:"description_overlap"`
+}
+
+func DefaultRules() Rules {
+	return Rules{
+		Version:                    DefaultRulesVersion,
+		MinConfidence:              LowMatchConfidence,
+		MinGroupConfidence:         MediumMatchConfidence,
+		AmountToleranceBasisPoints: AmountToleranceBasisPoints,
+		DateToleranceDays:          DateToleranceDays,
+		CounterpartyIBANWeight:     CounterpartyIBANWeight,
+		CounterpartyWeight:         CounterpartyWeight,
+		DescriptionWeight:          DescriptionWeight,
+		DescriptionMinSharedWords:  DescriptionMinSharedWords,
+		DescriptionOverlap:         DescriptionOverlap,
+	}
+}
+
 type MatchResult struct {
-	Type              string  // one_to_one, one_to_many
+	Type              string  // one_to_one, one_to_many, many_to_one
 	Confidence        float64 // 0.00 to 1.00
 	BankTransaction   *models.BankTransaction
 	AccountingEntries []*models.AccountingEntry
-	AmountDifference  float64
+	AmountDifference  money.Amount
 	MatchCriteria     []string
+
+	// Every bank transaction of a many_to_one match, by ID; BankTransaction
+	// is the first of them
+	BankTransactions []*models.BankTransaction
+
+	// How a one_to_many match netted its entries, when some offset others
+	Netting *Netting
+
+	// What a partial match settled of its records, in the currency of both.
+	// The rest stays open rather than counting as an amount difference.
+	SettledAmount money.Amount
+}
+
+// Netting is how a payment settled entries net of those offsetting them, in
+// the currency of the payment
+type Netting struct {
+	Gross    money.Amount  `json:"gross"`
+	Offsets  money.Amount  `json:"offsets"`
+	Net      money.Amount  `json:"net"`
+	Currency string        `json:"currency"`
+	Entries  []NettedEntry `json:"entries"`
+}
+
+// NettedEntry is an entry of a netted match and what it counted for
+type NettedEntry struct {
+	EntryID   string       `json:"entry_id"`
+	EntryType string       `json:"entry_type"`
+	Amount    money.Amount `json:"amount"`
+	Offset    bool         `json:"offset"`
+}
+
+// AllBankTransactions lists the bank side of the match, whatever its type
+func (r *MatchResult) AllBankTransactions() []*models.BankTransaction {
+	if len(r.BankTransactions) > 0 {
+		return r.BankTransactions
+	}
+	return []*models.BankTransaction{r.BankTransaction}
 }
 
 type MatchesResult struct {
-	Type             string  // one_to_one, one_to_many
+	Type             string  // one_to_one, one_to_many, many_to_one
 	Confidence       float64 // 0.00 to 1.00
 	BankTransaction  string
 	AccountingEntry  string
-	AmountDifference float64
+	AmountDifference money.Amount
 	MatchCriteria    []string
+	Netting          *Netting     `json:",omitempty"`
+	SettledAmount    money.Amount `json:",omitempty"`
 }
 
 type UnmatchResult struct {
@@ -45,94 +143,229 @@ type UnmatchResult struct {
 	AccountingEntries []string
 }
 
+type Config struct {
+	// Treat equal, checksum-valid ISO 11649 creditor references as an exact
+	// match that takes precedence over invoice/reference number comparison
+	CreditorReferenceMatching bool
+
+	// Business calendar for the date tolerance; nil counts calendar days
+	Calendar *calendar.Calendar
+
+	// Expected lag in days by counterparty ID. Entries of a counterparty
+	// with a lag are compared against bank dates that many days later.
+	ExpectedLags map[int64]int
+
+	// Alias dictionary applied to descriptions before they are compared;
+	// nil only normalizes them
+	Aliases *banking.AliasDictionary
+
+	// Thresholds and weights; a config without a rules version uses
+	// DefaultRules
+	Rules Rules
+
+	// Currency of records stored without one
+	BaseCurrency string
+
+	// Exchange rates records in different currencies are compared at; nil
+	// keeps every cross-currency pair apart
+	FXRates *currency.RateTable
+
+	// Amount tolerance added, in basis points, when one side was converted,
+	// for the spread between the booked rate and the one the bank applied
+	FXToleranceBasisPoints int64
+
+	// Names of the strategies to run, in order; none runs
+	// DefaultStrategies
+	Strategies []string
+
+	// Records kept out of matching, as compiled by LoadRuleFile
+	Exclusions []Exclusion
+
+	// Entry types netted against the entries one payment settles when they
+	// take off what is owed, as CheckNettingEntryTypes allows; none nets
+	// nothing
+	NettingEntryTypes []string
+
+	// Days within which a record and one reversing it are paired and taken
+	// out of matching; 0 pairs none
+	ReversalWindowDays int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		CreditorReferenceMatching: true,
+		Rules:                     DefaultRules(),
+		NettingEntryTypes:         []string{models.EntryTypeCreditNote},
+	}
+}
+
+// CheckNettingEntryTypes rejects an entry type that cannot be netted: only
+// credit notes, reversals and adjustments offset what a payment settles
+func CheckNettingEntryTypes(types []string) error {
+	for _, entryType := range types {
+		switch entryType {
+		case models.EntryTypeCreditNote, models.EntryTypeReversal, models.EntryTypeAdjustment:
+		default:
+			return fmt.Errorf("unknown netting entry type %q, use credit_note, reversal or adjustment", entryType)
+		}
+	}
+	return nil
+}
+
 type MatchEngine struct {
+	config            Config
 	bankTransactions  []*models.BankTransaction
 	accountingEntries []*models.AccountingEntry
+
+	// Description words by record ID, after alias replacement
+	bankWords  map[int64]map[string]bool
+	entryWords map[int64]map[string]bool
+
+	// Entry types that may be netted
+	netting map[string]bool
+
+	// Reversal pairs taken out of the run
+	reversals []*Reversal
 }
 
-func NewMatchEngine() *MatchEngine {
-	return &MatchEngine{}
+func NewMatchEngine(config Config) *MatchEngine {
+	if config.Rules.Version == "" {
+		config.Rules = DefaultRules()
+	}
+	netting := make(map[string]bool, len(config.NettingEntryTypes))
+	for _, entryType := range config.NettingEntryTypes {
+		netting[entryType] = true
+	}
+	return &MatchEngine{config: config, netting: netting}
 }
 
+// SetData loads the records of a run. Records an exclusion matches are left
+// out, so they stay unmatched; reversal pairs are left out as well and listed
+// by Reversals. Records a partial match settled part of take part with what
+// it left open, so the results hold copies of them carrying that amount.
 func (m *MatchEngine) SetData(bankTransactions []*models.BankTransaction, accountingEntries []*models.AccountingEntry) {
+	bankTransactions, accountingEntries = openRecords(bankTransactions, accountingEntries)
+	if len(m.config.Exclusions) > 0 {
+		bankTransactions, accountingEntries = m.exclude(bankTransactions, accountingEntries)
+	}
+	bankTransactions, accountingEntries = m.pairReversals(bankTransactions, accountingEntries)
 	m.bankTransactions = bankTransactions
 	m.accountingEntries = accountingEntries
-}
 
-func (m *MatchEngine) ProcessMatches() ([]*MatchResult, error) {
-	var results []*MatchResult
-
-	processedBankIDs := make(map[int64]bool)
-	processedAccountingIDs := make(map[int64]bool)
+	m.bankWords = make(map[int64]map[string]bool, len(bankTransactions))
+	for _, bt := range bankTransactions {
+		m.bankWords[bt.ID] = m.descriptionWords(bt.Description)
+	}
+	m.entryWords = make(map[int64]map[string]bool, len(accountingEntries))
+	for _, ae := range accountingEntries {
+		m.entryWords[ae.ID] = m.descriptionWords(ae.Description)
+	}
+}
 
-	for _, bt := range m.bankTransactions {
-		if processedBankIDs[bt.ID] {
-			continue
+// openRecords replaces the records with open amounts by copies whose amount
+// is what is left open
+func openRecords(bankTransactions []*models.BankTransaction, accountingEntries []*models.AccountingEntry) ([]*models.BankTransaction, []*models.AccountingEntry) {
+	openBank := make([]*models.BankTransaction, len(bankTransactions))
+	for i, bt := range bankTransactions {
+		if bt.OpenAmount != nil {
+			open := *bt
+			open.Amount = *bt.OpenAmount
+			bt = &open
 		}
+		openBank[i] = bt
+	}
+	openEntries := make([]*models.AccountingEntry, len(accountingEntries))
+	for i, ae := range accountingEntries {
+		if ae.OpenAmount != nil {
+			open := *ae
+			open.Amount = *ae.OpenAmount
+			ae = &open
+		}
+		openEntries[i] = ae
+	}
+	return openBank, openEntries
+}
 
-		for _, ae := range m.accountingEntries {
-			if processedAccountingIDs[ae.ID] {
-				continue
-			}
-
-			if result := m.checkOneToOneMatch(bt, ae); result != nil && result.Confidence == PerfectMatchConfidence {
-				results = append(results, result)
-				processedBankIDs[bt.ID] = true
-				processedAccountingIDs[ae.ID] = true
+func (m *MatchEngine) exclude(bankTransactions []*models.BankTransaction, accountingEntries []*models.AccountingEntry) ([]*models.BankTransaction, []*models.AccountingEntry) {
+	var keptBank []*models.BankTransaction
+	for _, bt := range bankTransactions {
+		excluded := false
+		for i := range m.config.Exclusions {
+			if m.config.Exclusions[i].excludesBank(bt) {
+				excluded = true
 				break
 			}
 		}
-	}
-
-	for _, bt := range m.bankTransactions {
-		if processedBankIDs[bt.ID] {
-			continue
+		if !excluded {
+			keptBank = append(keptBank, bt)
 		}
+	}
 
-		if result := m.findOneToManyMatch(bt, processedAccountingIDs); result != nil {
-			results = append(results, result)
-			processedBankIDs[bt.ID] = true
-			for _, ae := range result.AccountingEntries {
-				processedAccountingIDs[ae.ID] = true
+	var keptEntries []*models.AccountingEntry
+	for _, ae := range accountingEntries {
+		excluded := false
+		for i := range m.config.Exclusions {
+			if m.config.Exclusions[i].excludesEntry(ae) {
+				excluded = true
+				break
 			}
 		}
-	}
-
-	for _, bt := range m.bankTransactions {
-		if processedBankIDs[bt.ID] {
-			continue
+		if !excluded {
+			keptEntries = append(keptEntries, ae)
 		}
+	}
+	return keptBank, keptEntries
+}
 
-		var bestMatch *MatchResult
-		var bestConfidence float64
-
-		for _, ae := range m.accountingEntries {
-			if processedAccountingIDs[ae.ID] {
-				continue
-			}
+func (m *MatchEngine) descriptionWords(description string) map[string]bool {
+	words := make(map[string]bool)
+	for _, word := range strings.Fields(m.config.Aliases.Apply(description)) {
+		words[word] = true
+	}
+	return words
+}
 
-			if result := m.checkOneToOneMatch(bt, ae); result != nil && result.Confidence > bestConfidence {
-				bestMatch = result
-				bestConfidence = result.Confidence
-			}
+// descriptionsAgree compares the description words of a pair. Single shared
+// words such as "PAYMENT" are too common to count.
+func (m *MatchEngine) descriptionsAgree(bt *models.BankTransaction, ae *models.AccountingEntry) bool {
+	bankWords, entryWords := m.bankWords[bt.ID], m.entryWords[ae.ID]
+	shorter := min(len(bankWords), len(entryWords))
+	if shorter < m.config.Rules.DescriptionMinSharedWords {
+		return false
+	}
+	shared := 0
+	for word := range bankWords {
+		if entryWords[word] {
+			shared++
 		}
+	}
+	return shared >= m.config.Rules.DescriptionMinSharedWords && float64(shared) >= m.config.Rules.DescriptionOverlap*float64(shorter)
+}
 
-		if bestMatch != nil && bestMatch.Confidence >= LowMatchConfidence {
-			results = append(results, bestMatch)
-			processedBankIDs[bt.ID] = true
-			processedAccountingIDs[bestMatch.AccountingEntries[0].ID] = true
-		}
+// ProcessMatches runs the strategies of the configured pipeline in order
+func (m *MatchEngine) ProcessMatches() ([]*MatchResult, error) {
+	pipeline, err := Pipeline(m.config.Strategies)
+	if err != nil {
+		return nil, err
 	}
 
-	return results, nil
+	state := newMatchState()
+	for _, strategy := range pipeline {
+		strategy.Match(m, state)
+	}
+	return state.results, nil
 }
 
 func (m *MatchEngine) checkOneToOneMatch(bt *models.BankTransaction, ae *models.AccountingEntry) *MatchResult {
 	var matchCriteria []string
 	var confidence float64
 
-	amountDiff := math.Abs(bt.Amount - ae.Amount)
-	amountTolerance := bt.Amount * AmountTolerancePercent
+	entryAmount, converted, ok := m.entryAmount(bt, ae)
+	if !ok {
+		return nil // Different currencies and no rate between them
+	}
+	amountDiff := (bt.Amount - entryAmount).Abs()
+	amountTolerance := m.tolerance(bt.Amount, converted)
 
 	if amountDiff == 0 {
 		matchCriteria = append(matchCriteria, "amount")
@@ -143,29 +376,70 @@ func (m *MatchEngine) checkOneToOneMatch(bt *models.BankTransaction, ae *models.
 	} else {
 		return nil // Amount difference too large
 	}
+	if converted {
+		matchCriteria = append(matchCriteria, "fx_converted")
+	}
 
-	btDate, _ := time.Parse("2006-01-02", bt.TransactionDate)
-	aeDate, _ := time.Parse("2006-01-02", ae.EntryDate)
-	dateDiff := math.Abs(float64(btDate.Sub(aeDate).Hours() / 24))
+	dateDiff := m.entryDayDiff(bt, ae)
 
 	if dateDiff == 0 {
 		matchCriteria = append(matchCriteria, "date")
 		confidence += 0.3
-	} else if dateDiff <= float64(DateToleranceDays) {
+	} else if dateDiff <= float64(m.config.Rules.DateToleranceDays) {
 		matchCriteria = append(matchCriteria, "date")
 		confidence += 0.2
 	}
 
-	if bt.ReferenceNumber != "" && ae.InvoiceNumber != "" {
-		if bt.ReferenceNumber == ae.InvoiceNumber {
-			matchCriteria = append(matchCriteria, "reference")
-			confidence += 0.3
-		} else {
-			confidence = 0
+	if bt.ExternalCorrelationID != "" && ae.ExternalCorrelationID != "" {
+		// Both sides name the upstream payment they record, which settles it either way
+		if bt.ExternalCorrelationID != ae.ExternalCorrelationID {
+			return nil
+		}
+		matchCriteria = append(matchCriteria, "external_correlation_id")
+		confidence = PerfectMatchConfidence
+	} else if m.hasCreditorReferences(bt, ae) {
+		// A structured reference is authoritative: equal means exact, different means no match
+		if bt.CreditorReference != ae.CreditorReference {
+			return nil
 		}
+		matchCriteria = append(matchCriteria, "creditor_reference")
+		confidence = PerfectMatchConfidence
+	} else if bt.EndToEndID != "" && ae.EndToEndID != "" {
+		// The payer's end-to-end ID is unique per payment, so it decides like a creditor reference
+		if bt.EndToEndID != ae.EndToEndID {
+			return nil
+		}
+		matchCriteria = append(matchCriteria, "end_to_end_id")
+		confidence = PerfectMatchConfidence
+	} else if ref := bankReference(bt); ref != "" && ae.InvoiceNumber != "" {
+		// Conflicting references rule the pair out, whatever the description
+		// and counterparty weights would add
+		if ref != ae.InvoiceNumber {
+			return nil
+		}
+		matchCriteria = append(matchCriteria, "reference")
+		confidence += 0.3
 	}
 
-	if confidence >= LowMatchConfidence {
+	if m.descriptionsAgree(bt, ae) {
+		matchCriteria = append(matchCriteria, "description")
+		confidence += m.config.Rules.DescriptionWeight
+	}
+
+	// Same counterparty account on both sides is a strong signal on its own
+	if bt.CounterpartyIBAN != "" && ae.CounterpartyIBAN != "" && bt.CounterpartyIBAN == ae.CounterpartyIBAN {
+		matchCriteria = append(matchCriteria, "counterparty_iban")
+		confidence += m.config.Rules.CounterpartyIBANWeight
+	} else if bt.CounterpartyID != 0 && bt.CounterpartyID == ae.CounterpartyID {
+		matchCriteria = append(matchCriteria, "counterparty")
+		confidence += m.config.Rules.CounterpartyWeight
+	}
+
+	if confidence > PerfectMatchConfidence {
+		confidence = PerfectMatchConfidence
+	}
+
+	if confidence >= m.config.Rules.MinConfidence {
 		return &MatchResult{
 			Type:              models.MappingOneToOne,
 			Confidence:        confidence,
@@ -179,51 +453,238 @@ func (m *MatchEngine) checkOneToOneMatch(bt *models.BankTransaction, ae *models.
 	return nil
 }
 
+// dayDiff is the distance between two dates in days, counted in business days
+// when a calendar is configured so weekends and holidays do not eat into the
+// tolerance
+func (m *MatchEngine) dayDiff(bankDate, entryDate string) float64 {
+	btDate, _ := time.Parse("2006-01-02", bankDate)
+	aeDate, _ := time.Parse("2006-01-02", entryDate)
+	if m.config.Calendar != nil {
+		return float64(m.config.Calendar.BusinessDaysBetween(btDate, aeDate))
+	}
+	return math.Abs(float64(btDate.Sub(aeDate).Hours() / 24))
+}
+
+// entryDayDiff is dayDiff between a bank transaction and an entry moved
+// forward by the expected lag of their counterparty
+func (m *MatchEngine) entryDayDiff(bt *models.BankTransaction, ae *models.AccountingEntry) float64 {
+	counterpartyID := ae.CounterpartyID
+	if counterpartyID == 0 {
+		counterpartyID = bt.CounterpartyID
+	}
+	lag := m.config.ExpectedLags[counterpartyID]
+	if lag == 0 {
+		return m.dayDiff(bt.TransactionDate, ae.EntryDate)
+	}
+
+	entryDate, err := time.Parse("2006-01-02", ae.EntryDate)
+	if err != nil {
+		return m.dayDiff(bt.TransactionDate, ae.EntryDate)
+	}
+	if m.config.Calendar != nil {
+		entryDate = m.config.Calendar.AddBusinessDays(entryDate, lag)
+	} else {
+		entryDate = entryDate.AddDate(0, 0, lag)
+	}
+	return m.dayDiff(bt.TransactionDate, entryDate.Format("2006-01-02"))
+}
+
+// tolerance is the largest amount difference accepted against target,
+// widened by the FX tolerance when an amount was converted to compare it
+func (m *MatchEngine) tolerance(target money.Amount, converted bool) money.Amount {
+	basisPoints := m.config.Rules.AmountToleranceBasisPoints
+	if converted {
+		basisPoints += m.config.FXToleranceBasisPoints
+	}
+	return target.BasisPoints(basisPoints)
+}
+
+// currencyOf is the currency of a record, the base currency when it has none
+func (m *MatchEngine) currencyOf(code string) string {
+	if code == "" {
+		return strings.ToUpper(m.config.BaseCurrency)
+	}
+	return strings.ToUpper(code)
+}
+
+// entryAmount expresses an entry in the currency of the bank transaction, at
+// the rate of the bank date. converted reports whether a rate was applied; ok
+// is false when the currencies differ and there is no rate between them.
+func (m *MatchEngine) entryAmount(bt *models.BankTransaction, ae *models.AccountingEntry) (amount money.Amount, converted, ok bool) {
+	from, to := m.currencyOf(ae.Currency), m.currencyOf(bt.Currency)
+	if from == to {
+		return ledgerAmount(ae), false, true
+	}
+	amount, ok = m.config.FXRates.Convert(ledgerAmount(ae), from, to, bt.TransactionDate)
+	return amount, true, ok
+}
+
+// ledgerAmount is what an entry adds to the sum of the entries a payment
+// settles: a credit note takes its amount off, whichever sign it was booked
+// with
+func ledgerAmount(ae *models.AccountingEntry) money.Amount {
+	if isCreditNote(ae) {
+		return -ae.Amount.Abs()
+	}
+	return ae.Amount
+}
+
+// isCreditNote reports whether an entry is a credit note
+func isCreditNote(ae *models.AccountingEntry) bool {
+	return ae.EntryType == models.EntryTypeCreditNote
+}
+
+// offsets reports whether an entry may be netted against the entries a
+// payment settles: one of a netting type, of the payment's counterparty,
+// that takes off what it is summed with
+func (m *MatchEngine) offsets(bt *models.BankTransaction, ae *models.AccountingEntry) bool {
+	if !m.netting[ae.EntryType] || !sameCounterparty(bt, ae) {
+		return false
+	}
+	amount, _, ok := m.entryAmount(bt, ae)
+	return ok && amount < 0
+}
+
+// nettingOf records how a payment's entries net out, or nil when none offsets
+// another
+func (m *MatchEngine) nettingOf(bt *models.BankTransaction, entries []*models.AccountingEntry) *Netting {
+	netting := &Netting{Currency: m.currencyOf(bt.Currency)}
+	for _, ae := range entries {
+		amount, _, _ := m.entryAmount(bt, ae)
+		offset := m.offsets(bt, ae)
+		if offset {
+			netting.Offsets += amount
+		} else {
+			netting.Gross += amount
+		}
+		netting.Entries = append(netting.Entries, NettedEntry{
+			EntryID:   ae.EntryID,
+			EntryType: ae.EntryType,
+			Amount:    amount,
+			Offset:    offset,
+		})
+	}
+	if netting.Offsets == 0 {
+		return nil
+	}
+	netting.Net = netting.Gross + netting.Offsets
+	return netting
+}
+
+// sameCounterparty reports whether a bank transaction and an entry name the
+// same counterparty, by IBAN or by the counterparty they were linked to
+func sameCounterparty(bt *models.BankTransaction, ae *models.AccountingEntry) bool {
+	if bt.CounterpartyIBAN != "" && bt.CounterpartyIBAN == ae.CounterpartyIBAN {
+		return true
+	}
+	return bt.CounterpartyID != 0 && bt.CounterpartyID == ae.CounterpartyID
+}
+
+// bankAmount is entryAmount the other way round, for bank transactions
+// settling an entry
+func (m *MatchEngine) bankAmount(bt *models.BankTransaction, ae *models.AccountingEntry) (amount money.Amount, converted, ok bool) {
+	from, to := m.currencyOf(bt.Currency), m.currencyOf(ae.Currency)
+	if from == to {
+		return bt.Amount, false, true
+	}
+	amount, ok = m.config.FXRates.Convert(bt.Amount, from, to, bt.TransactionDate)
+	return amount, true, ok
+}
+
+// entryTotal sums entries in the currency of the bank transaction
+func (m *MatchEngine) entryTotal(bt *models.BankTransaction, entries []*models.AccountingEntry) (total money.Amount, converted, ok bool) {
+	for _, ae := range entries {
+		amount, entryConverted, entryOK := m.entryAmount(bt, ae)
+		if !entryOK {
+			return 0, false, false
+		}
+		total += amount
+		converted = converted || entryConverted
+	}
+	return total, converted, true
+}
+
+// bankTotal sums bank transactions in the currency of the entry
+func (m *MatchEngine) bankTotal(ae *models.AccountingEntry, transactions []*models.BankTransaction) (total money.Amount, converted, ok bool) {
+	for _, bt := range transactions {
+		amount, bankConverted, bankOK := m.bankAmount(bt, ae)
+		if !bankOK {
+			return 0, false, false
+		}
+		total += amount
+		converted = converted || bankConverted
+	}
+	return total, converted, true
+}
+
+// bankReference is the reference compared with invoice numbers: the bank's
+// reference number, or the payer's end-to-end ID when the statement has none
+func bankReference(bt *models.BankTransaction) string {
+	if bt.ReferenceNumber != "" {
+		return bt.ReferenceNumber
+	}
+	return bt.EndToEndID
+}
+
+func (m *MatchEngine) hasCreditorReferences(bt *models.BankTransaction, ae *models.AccountingEntry) bool {
+	return m.config.CreditorReferenceMatching && bt.CreditorReference != "" && ae.CreditorReference != ""
+}
+
 func (m *MatchEngine) findOneToManyMatch(bt *models.BankTransaction, processedIDs map[int64]bool) *MatchResult {
 	var bestMatch *MatchResult
-	var minDifference float64 = bt.Amount // Start with the full amount as the difference
+	minDifference := bt.Amount // Start with the full amount as the difference
 
 	combinations := m.findPossibleEntryCombinations(bt, bt.Amount, processedIDs)
 
 	for _, entries := range combinations {
-		var totalAmount float64
-		for _, ae := range entries {
-			totalAmount += ae.Amount
-		}
+		totalAmount, converted, _ := m.entryTotal(bt, entries)
 
-		difference := math.Abs(bt.Amount - totalAmount)
+		difference := (bt.Amount - totalAmount).Abs()
 		if difference < minDifference {
 			minDifference = difference
 
-			confidence := m.calculateOneToManyConfidence(bt, entries, difference)
+			confidence := m.calculateOneToManyConfidence(bt, entries, difference, converted)
 
 			var matchCriteria []string
 			matchCriteria = append(matchCriteria, "amount")
+			if converted {
+				matchCriteria = append(matchCriteria, "fx_converted")
+			}
 
-			btDate, _ := time.Parse("2006-01-02", bt.TransactionDate)
 			var maxDateDiff float64
 			for _, ae := range entries {
-				aeDate, _ := time.Parse("2006-01-02", ae.EntryDate)
-				dateDiff := math.Abs(float64(btDate.Sub(aeDate).Hours() / 24))
+				dateDiff := m.entryDayDiff(bt, ae)
 				if dateDiff > maxDateDiff {
 					maxDateDiff = dateDiff
 				}
 			}
 
-			if maxDateDiff <= float64(DateToleranceDays) {
+			if maxDateDiff <= float64(m.config.Rules.DateToleranceDays) {
 				matchCriteria = append(matchCriteria, "date")
 			}
 
-			if bt.ReferenceNumber != "" {
+			if ref := bankReference(bt); ref != "" {
 				for _, ae := range entries {
-					if ae.InvoiceNumber != "" && strings.Contains(ae.InvoiceNumber, bt.ReferenceNumber) {
+					if ae.InvoiceNumber != "" && strings.Contains(ae.InvoiceNumber, ref) {
 						matchCriteria = append(matchCriteria, "reference")
 						break
 					}
 				}
 			}
 
-			if confidence >= MediumMatchConfidence {
+			for _, ae := range entries {
+				if m.hasCreditorReferences(bt, ae) && bt.CreditorReference == ae.CreditorReference {
+					matchCriteria = append(matchCriteria, "creditor_reference")
+					break
+				}
+			}
+
+			netting := m.nettingOf(bt, entries)
+			if netting != nil {
+				matchCriteria = append(matchCriteria, "netting")
+			}
+
+			if confidence >= m.config.Rules.MinGroupConfidence {
 				bestMatch = &MatchResult{
 					Type:              models.MappingOneToMany,
 					Confidence:        confidence,
@@ -231,6 +692,7 @@ func (m *MatchEngine) findOneToManyMatch(bt *models.BankTransaction, processedID
 					AccountingEntries: entries,
 					AmountDifference:  difference,
 					MatchCriteria:     matchCriteria,
+					Netting:           netting,
 				}
 			}
 		}
@@ -239,34 +701,64 @@ func (m *MatchEngine) findOneToManyMatch(bt *models.BankTransaction, processedID
 	return bestMatch
 }
 
-func (m *MatchEngine) findPossibleEntryCombinations(bt *models.BankTransaction, targetAmount float64, processedIDs map[int64]bool) [][]*models.AccountingEntry {
+// findPossibleEntryCombinations lists the sets of up to three entries whose
+// sum pays targetAmount. Entries must name the bank transaction's reference;
+// entries of its counterparty that may be netted join them, as the payment
+// is short of what they took off.
+func (m *MatchEngine) findPossibleEntryCombinations(bt *models.BankTransaction, targetAmount money.Amount, processedIDs map[int64]bool) [][]*models.AccountingEntry {
 	var result [][]*models.AccountingEntry
-	var candidates []*models.AccountingEntry
+	var candidates, offsets []*models.AccountingEntry
+
+	// An entry may exceed the payment by what offsetting entries took off it
+	var offset money.Amount
+	for _, ae := range m.accountingEntries {
+		if processedIDs[ae.ID] || !m.offsets(bt, ae) {
+			continue
+		}
+		amount, _, _ := m.entryAmount(bt, ae)
+		offsets = append(offsets, ae)
+		offset -= amount
+	}
 
 	for _, ae := range m.accountingEntries {
-		if !processedIDs[ae.ID] && ae.Amount <= targetAmount {
-			if bt.ReferenceNumber != "" && ae.InvoiceNumber != "" &&
-				strings.Contains(ae.InvoiceNumber, bt.ReferenceNumber) {
+		// Credit notes are only ever summed to offset
+		if processedIDs[ae.ID] || isCreditNote(ae) || m.offsets(bt, ae) {
+			continue
+		}
+		if amount, _, ok := m.entryAmount(bt, ae); ok && amount <= targetAmount+offset {
+			if m.hasCreditorReferences(bt, ae) {
+				if bt.CreditorReference == ae.CreditorReference {
+					candidates = append([]*models.AccountingEntry{ae}, candidates...)
+				}
+				continue
+			}
+			if ref := bankReference(bt); ref != "" && ae.InvoiceNumber != "" &&
+				strings.Contains(ae.InvoiceNumber, ref) {
 				candidates = append([]*models.AccountingEntry{ae}, candidates...)
 			}
 		}
 	}
 
+	if len(candidates) == 0 {
+		return nil
+	}
+	candidates = append(candidates, offsets...)
+
 	for i := 1; i <= 3; i++ {
-		m.findCombinations(candidates, i, targetAmount, nil, &result)
+		m.findCombinations(bt, candidates, i, targetAmount, nil, &result)
 	}
 
 	return result
 }
 
-func (m *MatchEngine) findCombinations(candidates []*models.AccountingEntry, size int, targetAmount float64, current []*models.AccountingEntry, result *[][]*models.AccountingEntry) {
+func (m *MatchEngine) findCombinations(bt *models.BankTransaction, candidates []*models.AccountingEntry, size int, targetAmount money.Amount, current []*models.AccountingEntry, result *[][]*models.AccountingEntry) {
 	if size == 0 {
-		var sum float64
-		for _, ae := range current {
-			sum += ae.Amount
+		if len(current) == 0 || m.offsets(bt, current[0]) {
+			return // Offsetting entries come last, so this one offsets nothing
 		}
+		sum, converted, ok := m.entryTotal(bt, current)
 
-		if math.Abs(targetAmount-sum) <= (targetAmount * AmountTolerancePercent) {
+		if ok && (targetAmount-sum).Abs() <= m.tolerance(targetAmount, converted) {
 			combination := make([]*models.AccountingEntry, len(current))
 			copy(combination, current)
 			*result = append(*result, combination)
@@ -278,43 +770,243 @@ func (m *MatchEngine) findCombinations(candidates []*models.AccountingEntry, siz
 		return
 	}
 
-	m.findCombinations(candidates[1:], size-1, targetAmount, append(current, candidates[0]), result)
-	m.findCombinations(candidates[1:], size, targetAmount, current, result)
+	m.findCombinations(bt, candidates[1:], size-1, targetAmount, append(current, candidates[0]), result)
+	m.findCombinations(bt, candidates[1:], size, targetAmount, current, result)
 }
 
-func (m *MatchEngine) calculateOneToManyConfidence(bt *models.BankTransaction, entries []*models.AccountingEntry, amountDiff float64) float64 {
+func (m *MatchEngine) calculateOneToManyConfidence(bt *models.BankTransaction, entries []*models.AccountingEntry, amountDiff money.Amount, converted bool) float64 {
 	var confidence float64 = 0.7 // Base confidence for matching sum
 
 	if amountDiff == 0 {
 		confidence += 0.2
-	} else if amountDiff <= (bt.Amount * AmountTolerancePercent) {
+	} else if amountDiff <= m.tolerance(bt.Amount, converted) {
 		confidence += 0.1
 	}
 
-	btDate, _ := time.Parse("2006-01-02", bt.TransactionDate)
 	var maxDateDiff float64
 	for _, ae := range entries {
-		aeDate, _ := time.Parse("2006-01-02", ae.EntryDate)
-		dateDiff := math.Abs(float64(btDate.Sub(aeDate).Hours() / 24))
+		dateDiff := m.entryDayDiff(bt, ae)
 		if dateDiff > maxDateDiff {
 			maxDateDiff = dateDiff
 		}
 	}
 
-	if maxDateDiff <= float64(DateToleranceDays) {
+	if maxDateDiff <= float64(m.config.Rules.DateToleranceDays) {
 		confidence += 0.1
 	}
 
-	if bt.ReferenceNumber != "" {
-		matchCount := 0
-		for _, ae := range entries {
-			if ae.InvoiceNumber != "" && strings.Contains(ae.InvoiceNumber, bt.ReferenceNumber) {
-				matchCount++
+	matchCount := 0
+	for _, ae := range entries {
+		if m.hasCreditorReferences(bt, ae) && bt.CreditorReference == ae.CreditorReference {
+			matchCount++
+		} else if ref := bankReference(bt); ref != "" && ae.InvoiceNumber != "" && strings.Contains(ae.InvoiceNumber, ref) {
+			matchCount++
+		} else if m.offsets(bt, ae) {
+			matchCount++
+		}
+	}
+	if matchCount > 0 {
+		confidence += 0.1 * float64(matchCount) / float64(len(entries))
+	}
+
+	if confidence > HighMatchConfidence {
+		confidence = HighMatchConfidence
+	}
+
+	return confidence
+}
+
+// findManyToOneMatch looks for two or three bank transactions that together
+// pay the accounting entry. Every part must be tied to the entry by a creditor
+// reference, end-to-end ID or reference number, so unrelated payments that
+// happen to add up are not combined.
+func (m *MatchEngine) findManyToOneMatch(ae *models.AccountingEntry, processedIDs map[int64]bool) *MatchResult {
+	var candidates []*models.BankTransaction
+	for _, bt := range m.bankTransactions {
+		if processedIDs[bt.ID] {
+			continue
+		}
+		if amount, _, ok := m.bankAmount(bt, ae); !ok || amount > ledgerAmount(ae) {
+			continue
+		}
+		if m.sharesReference(bt, ae) {
+			candidates = append(candidates, bt)
+		}
+	}
+
+	var combinations [][]*models.BankTransaction
+	for size := 2; size <= 3; size++ {
+		m.findBankCombinations(ae, candidates, size, ledgerAmount(ae), nil, &combinations)
+	}
+
+	var bestMatch *MatchResult
+	minDifference := money.Amount(math.MaxInt64)
+	for _, transactions := range combinations {
+		totalAmount, converted, _ := m.bankTotal(ae, transactions)
+
+		difference := (ledgerAmount(ae) - totalAmount).Abs()
+		if difference >= minDifference {
+			continue
+		}
+		minDifference = difference
+
+		confidence := m.calculateManyToOneConfidence(ae, transactions, difference, converted)
+		if confidence < m.config.Rules.MinGroupConfidence {
+			continue
+		}
+
+		matchCriteria := []string{"amount"}
+		if converted {
+			matchCriteria = append(matchCriteria, "fx_converted")
+		}
+		var maxDateDiff float64
+		for _, bt := range transactions {
+			if dateDiff := m.entryDayDiff(bt, ae); dateDiff > maxDateDiff {
+				maxDateDiff = dateDiff
 			}
 		}
-		if matchCount > 0 {
-			confidence += 0.1 * float64(matchCount) / float64(len(entries))
+		if maxDateDiff <= float64(m.config.Rules.DateToleranceDays) {
+			matchCriteria = append(matchCriteria, "date")
+		}
+		matchCriteria = append(matchCriteria, m.referenceCriterion(transactions[0], ae))
+
+		sorted := append([]*models.BankTransaction(nil), transactions...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+		bestMatch = &MatchResult{
+			Type:              models.MappingManyToOne,
+			Confidence:        confidence,
+			BankTransaction:   sorted[0],
+			BankTransactions:  sorted,
+			AccountingEntries: []*models.AccountingEntry{ae},
+			AmountDifference:  difference,
+			MatchCriteria:     matchCriteria,
+		}
+	}
+
+	return bestMatch
+}
+
+// checkPartialMatch pairs a bank transaction with an entry for the smaller of
+// their amounts when both name each other by reference but their amounts are
+// too far apart for a whole match. Both must be in one currency and of the
+// same sign; credit notes are only ever netted.
+func (m *MatchEngine) checkPartialMatch(bt *models.BankTransaction, ae *models.AccountingEntry) *MatchResult {
+	if isCreditNote(ae) || m.currencyOf(bt.Currency) != m.currencyOf(ae.Currency) {
+		return nil
+	}
+	if bt.Amount == 0 || ae.Amount == 0 || (bt.Amount < 0) != (ae.Amount < 0) {
+		return nil
+	}
+	criterion := m.referenceCriterion(bt, ae)
+	if criterion == "" {
+		return nil
+	}
+
+	settled, larger := bt.Amount, ae.Amount
+	if settled.Abs() > larger.Abs() {
+		settled, larger = larger, settled
+	}
+	if (larger - settled).Abs() <= m.tolerance(larger, false) {
+		return nil // Close enough for a whole match
+	}
+
+	// A shared reference ties the pair, but what it settles is a guess
+	confidence := MediumMatchConfidence
+	if criterion != "reference" {
+		confidence = 0.9
+	}
+	matchCriteria := []string{"partial_amount", criterion}
+	if m.entryDayDiff(bt, ae) <= float64(m.config.Rules.DateToleranceDays) {
+		matchCriteria = append(matchCriteria, "date")
+	} else {
+		confidence -= 0.1
+	}
+	if confidence < m.config.Rules.MinConfidence {
+		return nil
+	}
+
+	return &MatchResult{
+		Type:              models.MappingPartial,
+		Confidence:        confidence,
+		BankTransaction:   bt,
+		AccountingEntries: []*models.AccountingEntry{ae},
+		MatchCriteria:     matchCriteria,
+		SettledAmount:     settled,
+	}
+}
+
+// sharesReference reports whether a bank transaction names the entry, by the
+// strongest reference both sides carry
+func (m *MatchEngine) sharesReference(bt *models.BankTransaction, ae *models.AccountingEntry) bool {
+	return m.referenceCriterion(bt, ae) != ""
+}
+
+func (m *MatchEngine) referenceCriterion(bt *models.BankTransaction, ae *models.AccountingEntry) string {
+	if bt.ExternalCorrelationID != "" && ae.ExternalCorrelationID != "" {
+		if bt.ExternalCorrelationID == ae.ExternalCorrelationID {
+			return "external_correlation_id"
+		}
+		return ""
+	}
+	if m.hasCreditorReferences(bt, ae) {
+		if bt.CreditorReference == ae.CreditorReference {
+			return "creditor_reference"
+		}
+		return ""
+	}
+	if bt.EndToEndID != "" && ae.EndToEndID != "" {
+		if bt.EndToEndID == ae.EndToEndID {
+			return "end_to_end_id"
 		}
+		return ""
+	}
+	if ref := bankReference(bt); ref != "" && ae.InvoiceNumber != "" && strings.Contains(ae.InvoiceNumber, ref) {
+		return "reference"
+	}
+	return ""
+}
+
+func (m *MatchEngine) findBankCombinations(ae *models.AccountingEntry, candidates []*models.BankTransaction, size int, targetAmount money.Amount, current []*models.BankTransaction, result *[][]*models.BankTransaction) {
+	if size == 0 {
+		sum, converted, ok := m.bankTotal(ae, current)
+
+		if ok && (targetAmount-sum).Abs() <= m.tolerance(targetAmount, converted) {
+			combination := make([]*models.BankTransaction, len(current))
+			copy(combination, current)
+			*result = append(*result, combination)
+		}
+		return
+	}
+
+	if len(candidates) < size {
+		return
+	}
+
+	m.findBankCombinations(ae, candidates[1:], size-1, targetAmount, append(current, candidates[0]), result)
+	m.findBankCombinations(ae, candidates[1:], size, targetAmount, current, result)
+}
+
+// calculateManyToOneConfidence starts above the one-to-many base because
+// every part is already tied to the entry by a reference
+func (m *MatchEngine) calculateManyToOneConfidence(ae *models.AccountingEntry, transactions []*models.BankTransaction, amountDiff money.Amount, converted bool) float64 {
+	confidence := 0.8 // Base confidence for matching sum plus shared references
+
+	if amountDiff == 0 {
+		confidence += 0.2
+	} else if amountDiff <= m.tolerance(ledgerAmount(ae), converted) {
+		confidence += 0.1
+	}
+
+	var maxDateDiff float64
+	for _, bt := range transactions {
+		if dateDiff := m.entryDayDiff(bt, ae); dateDiff > maxDateDiff {
+			maxDateDiff = dateDiff
+		}
+	}
+	// Partial payments are often spread out; a late part lowers confidence
+	// instead of ruling the combination out
+	if maxDateDiff > float64(m.config.Rules.DateToleranceDays) {
+		confidence -= 0.1
 	}
 
 	if confidence > HighMatchConfidence {
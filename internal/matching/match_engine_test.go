@@ -0,0 +1,118 @@
+package matching
+
+import (
+	"testing"
+
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/money"
+)
+
+func TestCheckOneToOneMatch(t *testing.T) {
+	bank := func(amount, date, reference, description, iban string) *models.BankTransaction {
+		return &models.BankTransaction{
+			ID:               1,
+			TransactionID:    "BT-1",
+			Amount:           mustAmount(t, amount),
+			TransactionDate:  date,
+			ReferenceNumber:  reference,
+			Description:      description,
+			CounterpartyIBAN: iban,
+		}
+	}
+	entry := func(amount, date, invoice, description, iban string) *models.AccountingEntry {
+		return &models.AccountingEntry{
+			ID:               1,
+			EntryID:          "AE-1",
+			Amount:           mustAmount(t, amount),
+			EntryDate:        date,
+			InvoiceNumber:    invoice,
+			Description:      description,
+			CounterpartyIBAN: iban,
+		}
+	}
+
+	tests := []struct {
+		name       string
+		bt         *models.BankTransaction
+		ae         *models.AccountingEntry
+		match      bool
+		confidence float64
+		difference string
+	}{
+		{
+			name:       "exact amount, date and reference",
+			bt:         bank("100.00", "2024-01-15", "INV-1", "", ""),
+			ae:         entry("100.00", "2024-01-15", "INV-1", "", ""),
+			match:      true,
+			confidence: 1.0,
+			difference: "0.00",
+		},
+		{
+			name:       "amount within tolerance keeps the exact difference",
+			bt:         bank("100.00", "2024-01-15", "", "", ""),
+			ae:         entry("99.99", "2024-01-15", "", "", ""),
+			match:      true,
+			confidence: 0.6,
+			difference: "0.01",
+		},
+		{
+			name:  "amount beyond tolerance",
+			bt:    bank("100.00", "2024-01-15", "INV-1", "", ""),
+			ae:    entry("98.00", "2024-01-15", "INV-1", "", ""),
+			match: false,
+		},
+		{
+			name:  "conflicting references",
+			bt:    bank("100.00", "2024-01-15", "INV-1", "", ""),
+			ae:    entry("100.00", "2024-01-15", "INV-2", "", ""),
+			match: false,
+		},
+		{
+			name:  "conflicting references are not outweighed by description and IBAN",
+			bt:    bank("100.00", "2024-01-15", "INV-1", "ACME TRADING MONTHLY FEE", "NL91ABNA0417164300"),
+			ae:    entry("100.00", "2024-01-15", "INV-2", "ACME TRADING MONTHLY FEE", "NL91ABNA0417164300"),
+			match: false,
+		},
+		{
+			name:       "same counterparty IBAN without references",
+			bt:         bank("100.00", "2024-01-17", "", "", "NL91ABNA0417164300"),
+			ae:         entry("100.00", "2024-01-15", "", "", "NL91ABNA0417164300"),
+			match:      true,
+			confidence: 0.9,
+			difference: "0.00",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := NewMatchEngine(DefaultConfig())
+			engine.SetData([]*models.BankTransaction{tt.bt}, []*models.AccountingEntry{tt.ae})
+
+			result := engine.checkOneToOneMatch(tt.bt, tt.ae)
+			if !tt.match {
+				if result != nil {
+					t.Fatalf("expected no match, got confidence %v on %v", result.Confidence, result.MatchCriteria)
+				}
+				return
+			}
+			if result == nil {
+				t.Fatal("expected a match, got none")
+			}
+			if diff := result.Confidence - tt.confidence; diff > 1e-9 || diff < -1e-9 {
+				t.Errorf("confidence = %v, want %v", result.Confidence, tt.confidence)
+			}
+			if got := result.AmountDifference.String(); got != tt.difference {
+				t.Errorf("amount difference = %s, want %s", got, tt.difference)
+			}
+		})
+	}
+}
+
+func mustAmount(t *testing.T, value string) money.Amount {
+	t.Helper()
+	amount, err := money.Parse(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return amount
+}
@@ -0,0 +1,151 @@
+package matching
+
+import (
+	"sort"
+
+	"reconciliation-service/internal/models"
+)
+
+// Reversal is a record and the one undoing it, on the same side: the same
+// amount with the opposite sign, under a shared reference and within the
+// reversal window. The pair nets to zero, so neither is matched against the
+// other side.
+type Reversal struct {
+	// The original first, then its reversal; one of the two is set
+	BankTransactions  []*models.BankTransaction
+	AccountingEntries []*models.AccountingEntry
+
+	MatchCriteria []string
+}
+
+// Reversals lists the pairs SetData took out of the run
+func (m *MatchEngine) Reversals() []*Reversal {
+	return m.reversals
+}
+
+// pairReversals takes reversal pairs out of the records of a run. Records
+// are paired in date order, each with the earliest counterpart it can take,
+// so the earlier record of a pair counts as the original.
+func (m *MatchEngine) pairReversals(bankTransactions []*models.BankTransaction, accountingEntries []*models.AccountingEntry) ([]*models.BankTransaction, []*models.AccountingEntry) {
+	m.reversals = nil
+	if m.config.ReversalWindowDays <= 0 {
+		return bankTransactions, accountingEntries
+	}
+
+	banks := append([]*models.BankTransaction(nil), bankTransactions...)
+	sort.SliceStable(banks, func(i, j int) bool {
+		if banks[i].TransactionDate != banks[j].TransactionDate {
+			return banks[i].TransactionDate < banks[j].TransactionDate
+		}
+		return banks[i].ID < banks[j].ID
+	})
+	pairedBank := make(map[int64]bool)
+	for i, original := range banks {
+		if pairedBank[original.ID] || original.Amount == 0 {
+			continue
+		}
+		for _, reversal := range banks[i+1:] {
+			if pairedBank[reversal.ID] || !m.bankReverses(original, reversal) {
+				continue
+			}
+			pairedBank[original.ID], pairedBank[reversal.ID] = true, true
+			m.reversals = append(m.reversals, &Reversal{
+				BankTransactions: []*models.BankTransaction{original, reversal},
+				MatchCriteria:    []string{"reversal", "amount", "reference", "date"},
+			})
+			break
+		}
+	}
+
+	entries := append([]*models.AccountingEntry(nil), accountingEntries...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].EntryDate != entries[j].EntryDate {
+			return entries[i].EntryDate < entries[j].EntryDate
+		}
+		return entries[i].ID < entries[j].ID
+	})
+	pairedEntries := make(map[int64]bool)
+	for i, original := range entries {
+		if pairedEntries[original.ID] || original.Amount == 0 || isCreditNote(original) {
+			continue
+		}
+		for _, reversal := range entries[i+1:] {
+			if pairedEntries[reversal.ID] || !m.entryReverses(original, reversal) {
+				continue
+			}
+			pairedEntries[original.ID], pairedEntries[reversal.ID] = true, true
+			m.reversals = append(m.reversals, &Reversal{
+				AccountingEntries: []*models.AccountingEntry{original, reversal},
+				MatchCriteria:     []string{"reversal", "amount", "reference", "date"},
+			})
+			break
+		}
+	}
+
+	if len(m.reversals) == 0 {
+		return bankTransactions, accountingEntries
+	}
+	var keptBank []*models.BankTransaction
+	for _, bt := range bankTransactions {
+		if !pairedBank[bt.ID] {
+			keptBank = append(keptBank, bt)
+		}
+	}
+	var keptEntries []*models.AccountingEntry
+	for _, ae := range accountingEntries {
+		if !pairedEntries[ae.ID] {
+			keptEntries = append(keptEntries, ae)
+		}
+	}
+	return keptBank, keptEntries
+}
+
+// bankReverses reports whether reversal undoes original: same account and
+// currency, opposite amount, a shared reference and close enough in time
+func (m *MatchEngine) bankReverses(original, reversal *models.BankTransaction) bool {
+	if original.AccountNumber != reversal.AccountNumber || reversal.Amount != -original.Amount {
+		return false
+	}
+	if m.currencyOf(original.Currency) != m.currencyOf(reversal.Currency) {
+		return false
+	}
+	if !sharesAny(
+		[2]string{bankReference(original), bankReference(reversal)},
+		[2]string{original.EndToEndID, reversal.EndToEndID},
+		[2]string{original.CreditorReference, reversal.CreditorReference},
+		[2]string{original.ExternalCorrelationID, reversal.ExternalCorrelationID},
+	) {
+		return false
+	}
+	return m.dayDiff(original.TransactionDate, reversal.TransactionDate) <= float64(m.config.ReversalWindowDays)
+}
+
+// entryReverses is bankReverses for accounting entries. Credit notes are
+// left to netting, which takes them off the invoices a payment settles.
+func (m *MatchEngine) entryReverses(original, reversal *models.AccountingEntry) bool {
+	if isCreditNote(reversal) || original.AccountCode != reversal.AccountCode || reversal.Amount != -original.Amount {
+		return false
+	}
+	if m.currencyOf(original.Currency) != m.currencyOf(reversal.Currency) {
+		return false
+	}
+	if !sharesAny(
+		[2]string{original.InvoiceNumber, reversal.InvoiceNumber},
+		[2]string{original.EndToEndID, reversal.EndToEndID},
+		[2]string{original.CreditorReference, reversal.CreditorReference},
+		[2]string{original.ExternalCorrelationID, reversal.ExternalCorrelationID},
+	) {
+		return false
+	}
+	return m.dayDiff(original.EntryDate, reversal.EntryDate) <= float64(m.config.ReversalWindowDays)
+}
+
+// sharesAny reports whether any pair holds the same non-empty reference
+func sharesAny(pairs ...[2]string) bool {
+	for _, pair := range pairs {
+		if pair[0] != "" && pair[0] == pair[1] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,191 @@
+package matching
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"reconciliation-service/internal/models"
+)
+
+// RuleFile is the declarative match configuration business users maintain
+// without a code change. Rules overlays the built-in defaults; the other
+// sections, when present, replace the matching settings of the environment.
+type RuleFile struct {
+	Version string          `json:"version"`
+	Rules   json.RawMessage `json:"rules,omitempty"`
+
+	// Treat equal creditor references as an exact match
+	CreditorReferenceMatching *bool `json:"creditor_reference_matching,omitempty"`
+
+	// Match strategies in the order they run
+	Strategies []string `json:"strategies,omitempty"`
+
+	// Entry types netted against the entries one payment settles; an empty
+	// list turns netting off
+	NettingEntryTypes *[]string `json:"netting_entry_types,omitempty"`
+
+	// Days within which reversal pairs are netted out; 0 turns pairing off
+	ReversalWindowDays *int `json:"reversal_window_days,omitempty"`
+
+	// Records the engine leaves alone
+	Exclusions []Exclusion `json:"exclusions,omitempty"`
+}
+
+// Sides of a record an exclusion applies to
+const (
+	SideBank   = "bank"
+	SideLedger = "ledger"
+	SideBoth   = "both"
+)
+
+// Exclusion keeps the records whose field is LIKE a pattern out of matching.
+// The pattern uses SQL wildcards, % for any run of characters and _ for one,
+// and ignores case.
+type Exclusion struct {
+	Side  string `json:"side,omitempty"`
+	Field string `json:"field"`
+	Like  string `json:"like"`
+
+	pattern *regexp.Regexp
+}
+
+// exclusionFields reads the fields an exclusion may test, per side
+var exclusionFields = map[string]struct {
+	bank   func(*models.BankTransaction) string
+	ledger func(*models.AccountingEntry) string
+}{
+	"description": {
+		bank:   func(bt *models.BankTransaction) string { return bt.Description },
+		ledger: func(ae *models.AccountingEntry) string { return ae.Description },
+	},
+	"reference": {
+		bank:   func(bt *models.BankTransaction) string { return bt.ReferenceNumber },
+		ledger: func(ae *models.AccountingEntry) string { return ae.InvoiceNumber },
+	},
+	"account": {
+		bank:   func(bt *models.BankTransaction) string { return bt.AccountNumber },
+		ledger: func(ae *models.AccountingEntry) string { return ae.AccountCode },
+	},
+	"counterparty_iban": {
+		bank:   func(bt *models.BankTransaction) string { return bt.CounterpartyIBAN },
+		ledger: func(ae *models.AccountingEntry) string { return ae.CounterpartyIBAN },
+	},
+	"currency": {
+		bank:   func(bt *models.BankTransaction) string { return bt.Currency },
+		ledger: func(ae *models.AccountingEntry) string { return ae.Currency },
+	},
+	"remittance_information": {
+		bank: func(bt *models.BankTransaction) string { return bt.RemittanceInformation },
+	},
+}
+
+// LoadRuleFile reads a rule file, as YAML when its extension is .yaml or
+// .yml and as JSON otherwise. Unknown keys are rejected so a misspelt rule
+// does not go unnoticed.
+func LoadRuleFile(path string) (*RuleFile, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rule file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var document interface{}
+		if err := yaml.Unmarshal(content, &document); err != nil {
+			return nil, fmt.Errorf("rule file %s: %v", path, err)
+		}
+		if content, err = json.Marshal(document); err != nil {
+			return nil, fmt.Errorf("rule file %s: %v", path, err)
+		}
+	}
+
+	file := &RuleFile{}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(file); err != nil {
+		return nil, fmt.Errorf("rule file %s: %v", path, err)
+	}
+	if err := file.compile(); err != nil {
+		return nil, fmt.Errorf("rule file %s: %w", path, err)
+	}
+	return file, nil
+}
+
+func (f *RuleFile) compile() error {
+	if _, err := Pipeline(f.Strategies); err != nil {
+		return err
+	}
+	if f.NettingEntryTypes != nil {
+		if err := CheckNettingEntryTypes(*f.NettingEntryTypes); err != nil {
+			return err
+		}
+	}
+	if f.ReversalWindowDays != nil && *f.ReversalWindowDays < 0 {
+		return fmt.Errorf("reversal_window_days must not be negative, got %d", *f.ReversalWindowDays)
+	}
+	for i := range f.Exclusions {
+		exclusion := &f.Exclusions[i]
+		exclusion.Field = strings.ToLower(strings.TrimSpace(exclusion.Field))
+		exclusion.Side = strings.ToLower(strings.TrimSpace(exclusion.Side))
+		if exclusion.Side == "" {
+			exclusion.Side = SideBoth
+		}
+
+		fields, ok := exclusionFields[exclusion.Field]
+		switch {
+		case !ok:
+			return fmt.Errorf("exclusion %d: unknown field %q", i+1, exclusion.Field)
+		case exclusion.Side != SideBank && exclusion.Side != SideLedger && exclusion.Side != SideBoth:
+			return fmt.Errorf("exclusion %d: side must be %s, %s or %s", i+1, SideBank, SideLedger, SideBoth)
+		case exclusion.Side != SideBank && fields.ledger == nil:
+			return fmt.Errorf("exclusion %d: accounting entries have no %s", i+1, exclusion.Field)
+		case exclusion.Like == "":
+			return fmt.Errorf("exclusion %d: like is required", i+1)
+		}
+		exclusion.pattern = likePattern(exclusion.Like)
+	}
+	return nil
+}
+
+// likePattern translates a SQL LIKE pattern to a case-insensitive regexp
+func likePattern(like string) *regexp.Regexp {
+	var pattern strings.Builder
+	pattern.WriteString(`(?is)^`)
+	for _, r := range like {
+		switch r {
+		case '%':
+			pattern.WriteString(`.*`)
+		case '_':
+			pattern.WriteString(`.`)
+		default:
+			pattern.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	pattern.WriteString(`$`)
+	return regexp.MustCompile(pattern.String())
+}
+
+// excludesBank reports whether an exclusion keeps a bank transaction out of
+// matching
+func (e *Exclusion) excludesBank(bt *models.BankTransaction) bool {
+	if e.Side == SideLedger || e.pattern == nil {
+		return false
+	}
+	return e.pattern.MatchString(exclusionFields[e.Field].bank(bt))
+}
+
+// excludesEntry reports whether an exclusion keeps an accounting entry out of
+// matching
+func (e *Exclusion) excludesEntry(ae *models.AccountingEntry) bool {
+	if e.Side == SideBank || e.pattern == nil {
+		return false
+	}
+	return e.pattern.MatchString(exclusionFields[e.Field].ledger(ae))
+}
@@ -0,0 +1,298 @@
+package matching
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"reconciliation-service/internal/models"
+)
+
+// Names of the built-in strategies
+const (
+	StrategyExactReference = "exact_reference"
+	StrategyOneToMany      = "one_to_many"
+	StrategyManyToOne      = "many_to_one"
+	StrategyAmountDate     = "amount_date"
+	StrategyFuzzy          = "fuzzy"
+	StrategyPartial        = "partial"
+)
+
+var (
+	// ErrUnknownStrategy rejects a pipeline naming a strategy nobody
+	// registered
+	ErrUnknownStrategy = errors.New("unknown match strategy")
+
+	// ErrStrategyExists rejects registering a second strategy under a name
+	ErrStrategyExists = errors.New("match strategy already registered")
+)
+
+// MatchStrategy is one pass of the match engine. The engine runs the
+// strategies of its pipeline in order; each sees only the records no earlier
+// pass matched and claims its matches on the state, so later passes skip
+// them.
+type MatchStrategy interface {
+	// Name identifies the strategy in the pipeline configuration
+	Name() string
+
+	Match(engine *MatchEngine, state *MatchState)
+}
+
+// DefaultStrategies is the pipeline of a config that names none: exact
+// references first, then groups on either side, then the best scored pair,
+// then what is left settled in part.
+func DefaultStrategies() []string {
+	return []string{StrategyExactReference, StrategyOneToMany, StrategyManyToOne, StrategyFuzzy, StrategyPartial}
+}
+
+var (
+	strategiesMu sync.RWMutex
+	strategies   = map[string]MatchStrategy{
+		StrategyExactReference: exactReferenceStrategy{},
+		StrategyOneToMany:      oneToManyStrategy{},
+		StrategyManyToOne:      manyToOneStrategy{},
+		StrategyAmountDate:     amountDateStrategy{},
+		StrategyFuzzy:          fuzzyStrategy{},
+		StrategyPartial:        partialStrategy{},
+	}
+)
+
+// RegisterStrategy makes a strategy available to pipelines under its name.
+// Register custom strategies at startup, before the first batch runs.
+func RegisterStrategy(strategy MatchStrategy) error {
+	strategiesMu.Lock()
+	defer strategiesMu.Unlock()
+	if _, ok := strategies[strategy.Name()]; ok {
+		return fmt.Errorf("%w: %s", ErrStrategyExists, strategy.Name())
+	}
+	strategies[strategy.Name()] = strategy
+	return nil
+}
+
+// Pipeline resolves strategy names in order; no names is the default
+// pipeline
+func Pipeline(names []string) ([]MatchStrategy, error) {
+	if len(names) == 0 {
+		names = DefaultStrategies()
+	}
+	strategiesMu.RLock()
+	defer strategiesMu.RUnlock()
+	pipeline := make([]MatchStrategy, 0, len(names))
+	for _, name := range names {
+		strategy, ok := strategies[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownStrategy, name)
+		}
+		pipeline = append(pipeline, strategy)
+	}
+	return pipeline, nil
+}
+
+// MatchState tracks what the strategies of one run have matched
+type MatchState struct {
+	results      []*MatchResult
+	bankClaimed  map[int64]bool
+	entryClaimed map[int64]bool
+}
+
+func newMatchState() *MatchState {
+	return &MatchState{
+		bankClaimed:  make(map[int64]bool),
+		entryClaimed: make(map[int64]bool),
+	}
+}
+
+func (s *MatchState) BankMatched(id int64) bool  { return s.bankClaimed[id] }
+func (s *MatchState) EntryMatched(id int64) bool { return s.entryClaimed[id] }
+
+// Claim adds a match unless one of its records was matched already, and
+// reports whether it did
+func (s *MatchState) Claim(result *MatchResult) bool {
+	bankTransactions := result.AllBankTransactions()
+	for _, bt := range bankTransactions {
+		if s.bankClaimed[bt.ID] {
+			return false
+		}
+	}
+	for _, ae := range result.AccountingEntries {
+		if s.entryClaimed[ae.ID] {
+			return false
+		}
+	}
+	for _, bt := range bankTransactions {
+		s.bankClaimed[bt.ID] = true
+	}
+	for _, ae := range result.AccountingEntries {
+		s.entryClaimed[ae.ID] = true
+	}
+	s.results = append(s.results, result)
+	return true
+}
+
+// exactReferenceStrategy matches pairs an external correlation ID, creditor
+// reference or end-to-end ID ties together, or that agree on everything, with
+// perfect confidence
+type exactReferenceStrategy struct{}
+
+func (exactReferenceStrategy) Name() string { return StrategyExactReference }
+
+func (exactReferenceStrategy) Match(m *MatchEngine, state *MatchState) {
+	for _, bt := range m.bankTransactions {
+		if state.BankMatched(bt.ID) {
+			continue
+		}
+		for _, ae := range m.accountingEntries {
+			if state.EntryMatched(ae.ID) {
+				continue
+			}
+			if result := m.checkOneToOneMatch(bt, ae); result != nil && result.Confidence == PerfectMatchConfidence {
+				state.Claim(result)
+				break
+			}
+		}
+	}
+}
+
+// oneToManyStrategy settles several entries with one bank transaction
+type oneToManyStrategy struct{}
+
+func (oneToManyStrategy) Name() string { return StrategyOneToMany }
+
+func (oneToManyStrategy) Match(m *MatchEngine, state *MatchState) {
+	for _, bt := range m.bankTransactions {
+		if state.BankMatched(bt.ID) {
+			continue
+		}
+		if result := m.findOneToManyMatch(bt, state.entryClaimed); result != nil {
+			state.Claim(result)
+		}
+	}
+}
+
+// manyToOneStrategy settles one entry with several partial payments
+type manyToOneStrategy struct{}
+
+func (manyToOneStrategy) Name() string { return StrategyManyToOne }
+
+func (manyToOneStrategy) Match(m *MatchEngine, state *MatchState) {
+	for _, ae := range m.accountingEntries {
+		if state.EntryMatched(ae.ID) {
+			continue
+		}
+		if result := m.findManyToOneMatch(ae, state.bankClaimed); result != nil {
+			state.Claim(result)
+		}
+	}
+}
+
+// amountDateStrategy is fuzzyStrategy restricted to pairs whose amounts and
+// dates are both within tolerance
+type amountDateStrategy struct{}
+
+func (amountDateStrategy) Name() string { return StrategyAmountDate }
+
+func (amountDateStrategy) Match(m *MatchEngine, state *MatchState) {
+	matchBestPairs(m, state, func(result *MatchResult) bool {
+		return hasCriterion(result, "amount") && hasCriterion(result, "date")
+	})
+}
+
+// fuzzyStrategy pairs each bank transaction with the entry it scores highest
+// with, at the minimum confidence of the rules
+type fuzzyStrategy struct{}
+
+func (fuzzyStrategy) Name() string { return StrategyFuzzy }
+
+func (fuzzyStrategy) Match(m *MatchEngine, state *MatchState) {
+	matchBestPairs(m, state, nil)
+}
+
+// partialStrategy settles part of an entry with a smaller payment naming it,
+// a short payment, or part of a payment with a smaller entry it names. The
+// larger side keeps the rest open for later runs; a record is settled in
+// part once per run.
+type partialStrategy struct{}
+
+func (partialStrategy) Name() string { return StrategyPartial }
+
+func (partialStrategy) Match(m *MatchEngine, state *MatchState) {
+	for _, ae := range m.accountingEntries {
+		if state.EntryMatched(ae.ID) {
+			continue
+		}
+
+		var bestMatch *MatchResult
+		for _, bt := range m.bankTransactions {
+			if state.BankMatched(bt.ID) {
+				continue
+			}
+			result := m.checkPartialMatch(bt, ae)
+			if result != nil && (bestMatch == nil || result.Confidence > bestMatch.Confidence) {
+				bestMatch = result
+			}
+		}
+
+		if bestMatch != nil {
+			state.Claim(bestMatch)
+		}
+	}
+}
+
+// matchBestPairs claims for each unmatched bank transaction the highest
+// scored one-to-one match that accept, when given, lets through
+func matchBestPairs(m *MatchEngine, state *MatchState, accept func(*MatchResult) bool) {
+	for _, bt := range m.bankTransactions {
+		if state.BankMatched(bt.ID) {
+			continue
+		}
+
+		var bestMatch *MatchResult
+		var bestConfidence float64
+		for _, ae := range m.accountingEntries {
+			if state.EntryMatched(ae.ID) {
+				continue
+			}
+			result := m.checkOneToOneMatch(bt, ae)
+			if result == nil || result.Confidence <= bestConfidence || (accept != nil && !accept(result)) {
+				continue
+			}
+			bestMatch = result
+			bestConfidence = result.Confidence
+		}
+
+		if bestMatch != nil && bestMatch.Confidence >= m.config.Rules.MinConfidence {
+			state.Claim(bestMatch)
+		}
+	}
+}
+
+func hasCriterion(result *MatchResult, criterion string) bool {
+	for _, c := range result.MatchCriteria {
+		if c == criterion {
+			return true
+		}
+	}
+	return false
+}
+
+// BankTransactions lists the bank side of the run in input order
+func (m *MatchEngine) BankTransactions() []*models.BankTransaction {
+	return m.bankTransactions
+}
+
+// AccountingEntries lists the ledger side of the run in input order
+func (m *MatchEngine) AccountingEntries() []*models.AccountingEntry {
+	return m.accountingEntries
+}
+
+// Rules are the thresholds and weights of the run
+func (m *MatchEngine) Rules() Rules {
+	return m.config.Rules
+}
+
+// ScorePair scores a bank transaction against an entry the way the built-in
+// strategies do, returning nil when they cannot match or score below the
+// minimum confidence
+func (m *MatchEngine) ScorePair(bt *models.BankTransaction, ae *models.AccountingEntry) *MatchResult {
+	return m.checkOneToOneMatch(bt, ae)
+}
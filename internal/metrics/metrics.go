@@ -0,0 +1,92 @@
+// Package metrics writes metric families in the Prometheus text exposition
+// format, version 0.0.4.
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ContentType is the media type of the text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Metric types
+const (
+	TypeGauge   = "gauge"
+	TypeCounter = "counter"
+	TypeSummary = "summary"
+)
+
+// Family is a metric with its samples. The samples of a summary are named
+// with their _sum and _count suffixes in Suffix.
+type Family struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []Sample
+}
+
+// Sample is one value of a family
+type Sample struct {
+	// Appended to the family name, as in _sum and _count
+	Suffix string
+	Labels map[string]string
+	Value  float64
+}
+
+// Write writes families in the order given. Labels are written sorted by
+// name, so the output of the same samples is always the same.
+func Write(w io.Writer, families []Family) error {
+	out := bufio.NewWriter(w)
+	for _, family := range families {
+		out.WriteString("# HELP " + family.Name + " " + helpEscaper.Replace(family.Help) + "\n")
+		out.WriteString("# TYPE " + family.Name + " " + family.Type + "\n")
+		for _, sample := range family.Samples {
+			out.WriteString(family.Name + sample.Suffix)
+			writeLabels(out, sample.Labels)
+			out.WriteString(" " + formatValue(sample.Value) + "\n")
+		}
+	}
+	return out.Flush()
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func writeLabels(out *bufio.Writer, labels map[string]string) {
+	if len(labels) == 0 {
+		return
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			out.WriteByte(',')
+		}
+		out.WriteString(name + `="` + labelEscaper.Replace(labels[name]) + `"`)
+	}
+	out.WriteByte('}')
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsNaN(value):
+		return "NaN"
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
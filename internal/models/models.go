@@ -4,40 +4,101 @@ import (
 	"database/sql"
 	"encoding/json"
 	"time"
+
+	"reconciliation-service/internal/money"
 )
 
 type BankTransaction struct {
-	ID              int64     `db:"id" json:"id"`
-	TransactionID   string    `db:"transaction_id" json:"transaction_id"`
-	AccountNumber   string    `db:"account_number" json:"account_number"`
-	Amount          float64   `db:"amount" json:"amount"`
-	TransactionDate string    `db:"transaction_date" json:"transaction_date"`
-	Description     string    `db:"description" json:"description"`
-	ReferenceNumber string    `db:"reference_number" json:"reference_number"`
-	CreatedAt       time.Time `db:"created_at" json:"-"`
-	UpdatedAt       time.Time `db:"updated_at" json:"-"`
+	ID              int64        `db:"id" json:"id"`
+	TransactionID   string       `db:"transaction_id" json:"transaction_id"`
+	AccountNumber   string       `db:"account_number" json:"account_number"`
+	Amount          money.Amount `db:"amount" json:"amount"`
+	Currency        string       `db:"currency" json:"currency"`
+	TransactionDate string       `db:"transaction_date" json:"transaction_date"`
+	Description     string       `db:"description" json:"description"`
+	ReferenceNumber string       `db:"reference_number" json:"reference_number"`
+
+	CounterpartyIBAN        string `db:"counterparty_iban" json:"counterparty_iban,omitempty"`
+	CounterpartyBIC         string `db:"counterparty_bic" json:"counterparty_bic,omitempty"`
+	CounterpartyBankName    string `db:"counterparty_bank_name" json:"counterparty_bank_name,omitempty"`
+	CounterpartyBankCountry string `db:"counterparty_bank_country" json:"counterparty_bank_country,omitempty"`
+	CounterpartyID          int64  `db:"counterparty_id" json:"counterparty_id,omitempty"`
+
+	RemittanceInformation string `db:"remittance_information" json:"remittance_information,omitempty"`
+	CreditorReference     string `db:"creditor_reference" json:"creditor_reference,omitempty"`
+	EndToEndID            string `db:"end_to_end_id" json:"end_to_end_id,omitempty"`
+	// ID of the payment in an upstream system, such as a PSP payment ID
+	ExternalCorrelationID string `db:"external_correlation_id" json:"external_correlation_id,omitempty"`
+
+	// Set when the bank reports the booking as a return or reversal of an
+	// earlier one (an R-transaction)
+	Reversal     bool   `db:"reversal" json:"reversal,omitempty"`
+	ReturnReason string `db:"return_reason" json:"return_reason,omitempty"`
+
+	// Set once the transaction is voided: it stays stored but leaves
+	// matching and the unmatched pool
+	VoidedAt   *time.Time `db:"voided_at" json:"voided_at,omitempty"`
+	VoidReason string     `db:"void_reason" json:"void_reason,omitempty"`
+	VoidedBy   string     `db:"voided_by" json:"voided_by,omitempty"`
+
+	// Set once a partial match settled part of the transaction: what is
+	// left of it for later runs, 0 when the rest was matched too
+	OpenAmount *money.Amount `db:"open_amount" json:"open_amount,omitempty"`
+
+	Version   int       `db:"version" json:"version"`
+	CreatedAt time.Time `db:"created_at" json:"-"`
+	UpdatedAt time.Time `db:"updated_at" json:"-"`
 }
 
 type AccountingEntry struct {
-	ID            int64     `db:"id" json:"id"`
-	EntryID       string    `db:"entry_id" json:"entry_id"`
-	AccountCode   string    `db:"account_code" json:"account_code"`
-	Amount        float64   `db:"amount" json:"amount"`
-	EntryDate     string    `db:"entry_date" json:"entry_date"`
-	Description   string    `db:"description" json:"description"`
-	InvoiceNumber string    `db:"invoice_number" json:"invoice_number"`
-	CreatedAt     time.Time `db:"created_at" json:"-"`
-	UpdatedAt     time.Time `db:"updated_at" json:"-"`
+	ID            int64        `db:"id" json:"id"`
+	EntryID       string       `db:"entry_id" json:"entry_id"`
+	AccountCode   string       `db:"account_code" json:"account_code"`
+	Amount        money.Amount `db:"amount" json:"amount"`
+	Currency      string       `db:"currency" json:"currency"`
+	EntryDate     string       `db:"entry_date" json:"entry_date"`
+	Description   string       `db:"description" json:"description"`
+	InvoiceNumber string       `db:"invoice_number" json:"invoice_number"`
+	EntryType     string       `db:"entry_type" json:"entry_type"`
+
+	CounterpartyIBAN  string `db:"counterparty_iban" json:"counterparty_iban,omitempty"`
+	CounterpartyID    int64  `db:"counterparty_id" json:"counterparty_id,omitempty"`
+	CreditorReference string `db:"creditor_reference" json:"creditor_reference,omitempty"`
+	EndToEndID        string `db:"end_to_end_id" json:"end_to_end_id,omitempty"`
+	// ID of the payment in an upstream system, such as a PSP payment ID
+	ExternalCorrelationID string `db:"external_correlation_id" json:"external_correlation_id,omitempty"`
+
+	// Set once the entry is voided, as for bank transactions
+	VoidedAt   *time.Time `db:"voided_at" json:"voided_at,omitempty"`
+	VoidReason string     `db:"void_reason" json:"void_reason,omitempty"`
+	VoidedBy   string     `db:"voided_by" json:"voided_by,omitempty"`
+
+	// What is left of a partly settled entry, as for bank transactions
+	OpenAmount *money.Amount `db:"open_amount" json:"open_amount,omitempty"`
+
+	Version   int       `db:"version" json:"version"`
+	CreatedAt time.Time `db:"created_at" json:"-"`
+	UpdatedAt time.Time `db:"updated_at" json:"-"`
 }
 
+// Kinds of accounting entry. A credit note lowers what its counterparty owes,
+// so it offsets the invoices it is summed with.
+const (
+	EntryTypeInvoice    = "invoice"
+	EntryTypeCreditNote = "credit_note"
+	EntryTypeReversal   = "reversal"
+	EntryTypeAdjustment = "adjustment"
+)
+
 type Reconciliation struct {
-	ID               int64     `db:"id" json:"id"`
-	BatchID          string    `db:"reconciliation_batch_id" json:"reconciliation_batch_id"`
-	Status           string    `db:"status" json:"status"`
-	MatchConfidence  float64   `db:"match_confidence" json:"match_confidence"`
-	AmountDifference float64   `db:"amount_difference" json:"amount_difference"`
-	CreatedAt        time.Time `db:"created_at" json:"-"`
-	UpdatedAt        time.Time `db:"updated_at" json:"-"`
+	ID               int64        `db:"id" json:"id"`
+	BatchID          string       `db:"reconciliation_batch_id" json:"reconciliation_batch_id"`
+	Status           string       `db:"status" json:"status"`
+	MatchConfidence  float64      `db:"match_confidence" json:"match_confidence"`
+	AmountDifference money.Amount `db:"amount_difference" json:"amount_difference"`
+	Version          int          `db:"version" json:"version"`
+	CreatedAt        time.Time    `db:"created_at" json:"-"`
+	UpdatedAt        time.Time    `db:"updated_at" json:"-"`
 }
 
 type ReconciliationMapping struct {
@@ -46,7 +107,12 @@ type ReconciliationMapping struct {
 	BankTransactionID sql.NullInt64 `db:"bank_transaction_id" json:"bank_transaction_id"`
 	AccountingEntryID sql.NullInt64 `db:"accounting_entry_id" json:"accounting_entry_id"`
 	MappingType       string        `db:"mapping_type" json:"mapping_type"`
-	CreatedAt         time.Time     `db:"created_at" json:"-"`
+	// Amount is what a partial mapping settled of its records
+	Amount *money.Amount `db:"amount" json:"amount,omitempty"`
+	// Details records what the match rests on beyond its records, such as
+	// how its entries were netted
+	Details   json.RawMessage `db:"details" json:"details,omitempty"`
+	CreatedAt time.Time       `db:"created_at" json:"-"`
 }
 
 type ReconciliationAudit struct {
@@ -58,17 +124,83 @@ type ReconciliationAudit struct {
 	CreatedAt        time.Time       `db:"created_at" json:"-"`
 }
 
+// RecordMapping is a mapping of a bank transaction or accounting entry with
+// the reconciliation it belongs to
+type RecordMapping struct {
+	ReconciliationID  int64   `json:"reconciliation_id"`
+	BatchID           string  `json:"batch_id"`
+	Status            string  `json:"status"`
+	MatchConfidence   float64 `json:"match_confidence"`
+	MappingType       string  `json:"mapping_type"`
+	BankTransactionID int64   `json:"bank_transaction_id,omitempty"`
+	AccountingEntryID int64   `json:"accounting_entry_id,omitempty"`
+}
+
+// CorrelationLookup is what the service holds of one upstream payment: the
+// records carrying its ID and the reconciliations they are mapped in. A
+// record no mapping names is unmatched.
+type CorrelationLookup struct {
+	ExternalCorrelationID string             `json:"external_correlation_id"`
+	BankTransactions      []*BankTransaction `json:"bank_transactions"`
+	AccountingEntries     []*AccountingEntry `json:"accounting_entries"`
+	Mappings              []*RecordMapping   `json:"mappings"`
+}
+
+// AuditTrailEntry is a reconciliation audit entry as the audit trail API
+// reports it, with the batch of its reconciliation
+type AuditTrailEntry struct {
+	ID               int64           `db:"id" json:"id"`
+	ReconciliationID int64           `db:"reconciliation_id" json:"reconciliation_id"`
+	BatchID          string          `db:"reconciliation_batch_id" json:"batch_id"`
+	Action           string          `db:"action" json:"action"`
+	Details          json.RawMessage `db:"details" json:"details,omitempty"`
+	UserID           string          `db:"user_id" json:"user_id,omitempty"`
+	CreatedAt        time.Time       `db:"created_at" json:"created_at"`
+}
+
+// AuditTrailFilter selects reconciliation audit entries, newest first. Zero
+// fields don't filter; BeforeID pages past the last ID of the previous page.
+type AuditTrailFilter struct {
+	BatchID  string
+	UserID   string
+	Action   string
+	From     string
+	To       string
+	BeforeID int64
+	Limit    int
+}
+
 const (
 	StatusMatched             = "matched"
+	StatusUnmatched           = "unmatched"
 	StatusUnmatchedBank       = "unmatched_bank"
 	StatusUnmatchedAccounting = "unmatched_accounting"
 	StatusDisputed            = "disputed"
+	// StatusPendingReview is a match below the review confidence, holding
+	// its records until it is approved or rejected
+	StatusPendingReview = "pending_review"
 )
 
 const (
 	MappingOneToOne  = "one_to_one"
 	MappingOneToMany = "one_to_many"
 	MappingManyToOne = "many_to_one"
+
+	// MappingFee maps a bank debit classified as a scheduled bank fee, which
+	// has no accounting entry
+	MappingFee = "fee"
+
+	// MappingReturn pairs a returned bank transaction with its return,
+	// which cancel out without an accounting entry
+	MappingReturn = "return"
+
+	// MappingReversal pairs a record with the one reversing it on the same
+	// side, which cancel out without a counterpart
+	MappingReversal = "reversal"
+
+	// MappingPartial settles part of a record with a smaller counterpart,
+	// leaving the rest open for later runs
+	MappingPartial = "partial"
 )
 
 const (
@@ -77,4 +209,1641 @@ const (
 	AuditActionUnmatched = "unmatched"
 	AuditActionDisputed  = "disputed"
 	AuditActionResolved  = "resolved"
+	AuditActionApproved  = "approved"
+	AuditActionRejected  = "rejected"
+	// AuditActionRepaired records an integrity finding being repaired
+	AuditActionRepaired = "repaired"
+)
+
+// ClassifiedTransaction is a matched bank transaction with the ledger account
+// its entry was booked on, the history account suggestions learn from
+type ClassifiedTransaction struct {
+	Description    string
+	CounterpartyID int64
+	AccountCode    string
+}
+
+// BatchKPI is a summary figure a tenant defined, as evaluated over a batch.
+// Value is nil when the expression is undefined for the batch.
+type BatchKPI struct {
+	BatchID    string    `db:"reconciliation_batch_id" json:"-"`
+	Tenant     string    `db:"tenant" json:"-"`
+	Name       string    `db:"name" json:"name"`
+	Label      string    `db:"label" json:"label"`
+	Expression string    `db:"expression" json:"expression"`
+	Value      *float64  `db:"value" json:"value"`
+	CreatedAt  time.Time `db:"created_at" json:"-"`
+}
+
+// AccountOutcome is what a batch matched and left unmatched of one account:
+// a bank account number on the bank side, an account code on the ledger
+// side. Amounts are gross, in the base currency; records without a rate to
+// it are counted but add nothing.
+type AccountOutcome struct {
+	BatchID         string       `db:"reconciliation_batch_id" json:"-"`
+	Side            string       `db:"side" json:"side"`
+	Account         string       `db:"account" json:"account"`
+	MatchedCount    int          `db:"matched_count" json:"matched_count"`
+	MatchedAmount   money.Amount `db:"matched_amount" json:"matched_amount"`
+	UnmatchedCount  int          `db:"unmatched_count" json:"unmatched_count"`
+	UnmatchedAmount money.Amount `db:"unmatched_amount" json:"unmatched_amount"`
+}
+
+// Sides of an account outcome
+const (
+	AccountSideBank   = "bank"
+	AccountSideLedger = "ledger"
+)
+
+// BatchSummary is the headline numbers of a persisted batch
+type BatchSummary struct {
+	Matched          int          `json:"matched"`
+	Unmatched        int          `json:"unmatched"`
+	Disputed         int          `json:"disputed"`
+	PendingReview    int          `json:"pending_review"`
+	PartiallyMatched int          `json:"partially_matched"`
+	MatchedAmount    money.Amount `json:"matched_amount"`
+	AmountDifference money.Amount `json:"amount_difference"`
+}
+
+// BatchDelta records how one manual change moved a batch's summary
+type BatchDelta struct {
+	ID            int64           `db:"id" json:"id"`
+	BatchID       string          `db:"reconciliation_batch_id" json:"reconciliation_batch_id"`
+	Action        string          `db:"action" json:"action"`
+	UserID        string          `db:"user_id" json:"user_id,omitempty"`
+	Changes       json.RawMessage `db:"changes" json:"changes"`
+	SummaryBefore BatchSummary    `db:"summary_before" json:"summary_before"`
+	SummaryAfter  BatchSummary    `db:"summary_after" json:"summary_after"`
+	CreatedAt     time.Time       `db:"created_at" json:"created_at"`
+}
+
+// Manual changes recorded as batch deltas
+const (
+	DeltaActionResolve              = "resolve"
+	DeltaActionBankCorrection       = "bank_transaction_correction"
+	DeltaActionAccountingCorrection = "accounting_entry_correction"
+	DeltaActionUnmatch              = "unmatch"
+	DeltaActionReturn               = "direct_debit_return"
+	DeltaActionApprove              = "approve"
+	DeltaActionReject               = "reject"
+	DeltaActionIntegrityRepair      = "integrity_repair"
+	DeltaActionBankVoid             = "bank_transaction_void"
+	DeltaActionAccountingVoid       = "accounting_entry_void"
+)
+
+// Kinds of persisted batch result items
+const (
+	ResultKindMatch     = "match"
+	ResultKindUnmatched = "unmatched"
+)
+
+// ResultItem is a persisted result item, in the format of the inline lists,
+// with the ID that orders it
+type ResultItem struct {
+	ID      int64
+	Payload json.RawMessage
+}
+
+type APIUsage struct {
+	Entity       string    `db:"entity" json:"entity"`
+	Period       string    `db:"period" json:"period"`
+	Requests     int64     `db:"requests" json:"requests"`
+	RowsIngested int64     `db:"rows_ingested" json:"rows_ingested"`
+	BatchesRun   int64     `db:"batches_run" json:"batches_run"`
+	UpdatedAt    time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type APIQuota struct {
+	Entity          string    `db:"entity" json:"entity"`
+	MaxRequests     int64     `db:"max_requests" json:"max_requests"`
+	MaxRowsIngested int64     `db:"max_rows_ingested" json:"max_rows_ingested"`
+	MaxBatches      int64     `db:"max_batches" json:"max_batches"`
+	UpdatedAt       time.Time `db:"updated_at" json:"-"`
+}
+
+type MaintenanceMode struct {
+	Enabled           bool       `db:"enabled" json:"enabled"`
+	Message           string     `db:"message" json:"message"`
+	RetryAfterSeconds int        `db:"retry_after_seconds" json:"retry_after_seconds"`
+	UpdatedBy         string     `db:"updated_by" json:"updated_by,omitempty"`
+	EnabledAt         *time.Time `db:"enabled_at" json:"enabled_at,omitempty"`
+	UpdatedAt         time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+// FailoverStatus is whether the service runs read-only because its primary
+// database is unavailable, and what it holds until the primary is back
+type FailoverStatus struct {
+	ReadOnly bool       `json:"read_only"`
+	Since    *time.Time `json:"since,omitempty"`
+	// Error of the latest failed ping and failed pings in a row
+	LastError           string `json:"last_error,omitempty"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	// Whether reads go to a replica while read-only
+	Replica bool `json:"replica"`
+
+	QueuedWrites   int `json:"queued_writes"`
+	OutboxCapacity int `json:"outbox_capacity"`
+	// Queued writes replayed since startup, and those the primary refused
+	Replayed     int `json:"replayed"`
+	ReplayFailed int `json:"replay_failed"`
+}
+
+// QueuedWrite is a write request held in the failover outbox, replayed as it
+// was received once the primary is back
+type QueuedWrite struct {
+	ID       int64
+	Method   string
+	URI      string
+	Header   map[string][]string
+	Body     []byte
+	Caller   string
+	QueuedAt time.Time
+}
+
+type ReconciliationJob struct {
+	ID         int64  `db:"id" json:"id"`
+	JobType    string `db:"job_type" json:"job_type"`
+	BatchID    string `db:"reconciliation_batch_id" json:"reconciliation_batch_id,omitempty"`
+	Status     string `db:"status" json:"status"`
+	Priority   int    `db:"priority" json:"priority"`
+	FromDate   string `db:"from_date" json:"from_date,omitempty"`
+	ToDate     string `db:"to_date" json:"to_date,omitempty"`
+	InstanceID string `db:"instance_id" json:"instance_id"`
+	// RequestedBy is the user who started or queued the job
+	RequestedBy string `db:"requested_by" json:"requested_by,omitempty"`
+	// UsageEntity is who a queued or partitioned run's batch is counted for
+	UsageEntity string          `db:"usage_entity" json:"-"`
+	Checkpoint  json.RawMessage `db:"checkpoint" json:"checkpoint,omitempty"`
+	Error       string          `db:"error" json:"error,omitempty"`
+	QueuedAt    time.Time       `db:"queued_at" json:"queued_at"`
+	StartedAt   time.Time       `db:"started_at" json:"started_at"`
+	HeartbeatAt *time.Time      `db:"heartbeat_at" json:"heartbeat_at,omitempty"`
+	FinishedAt  *time.Time      `db:"finished_at" json:"finished_at,omitempty"`
+	UpdatedAt   time.Time       `db:"updated_at" json:"updated_at"`
+}
+
+const (
+	JobTypeReconciliation = "reconciliation"
+	JobTypeIngestion      = "ingestion"
+	JobTypePartitionedRun = "reconciliation_partitioned"
+	JobTypePartition      = "reconciliation_partition"
+)
+
+const (
+	JobPriorityUrgent  = 100
+	JobPriorityHigh    = 50
+	JobPriorityNormal  = 0
+	JobPriorityRoutine = -50
+)
+
+const (
+	JobStatusQueued       = "queued"
+	JobStatusRunning      = "running"
+	JobStatusCompleted    = "completed"
+	JobStatusFailed       = "failed"
+	JobStatusCheckpointed = "checkpointed"
+)
+
+// IdempotencyKey is a key a caller sent with a request, and once the request
+// succeeded the response it got, replayed to retries with the same key
+type IdempotencyKey struct {
+	ID             int64           `db:"id" json:"id"`
+	Caller         string          `db:"caller" json:"caller"`
+	Key            string          `db:"idempotency_key" json:"idempotency_key"`
+	Operation      string          `db:"operation" json:"operation"`
+	RequestHash    string          `db:"request_hash" json:"request_hash"`
+	Status         string          `db:"status" json:"status"`
+	BatchID        string          `db:"reconciliation_batch_id" json:"reconciliation_batch_id,omitempty"`
+	ResponseStatus int             `db:"response_status" json:"response_status,omitempty"`
+	Response       json.RawMessage `db:"response" json:"response,omitempty"`
+	CreatedAt      time.Time       `db:"created_at" json:"created_at"`
+	CompletedAt    *time.Time      `db:"completed_at" json:"completed_at,omitempty"`
+	ExpiresAt      time.Time       `db:"expires_at" json:"expires_at"`
+}
+
+const (
+	IdempotencyStatusPending   = "pending"
+	IdempotencyStatusCompleted = "completed"
+)
+
+const IdempotencyOperationStart = "reconciliation_start"
+
+const (
+	PartitionByAccountHash = "account_hash"
+	PartitionByIDRange     = "id_range"
+	// Each partition reconciles a window of dates against only the entries
+	// that can match it, so no partition holds the whole period in memory
+	PartitionByDateRange = "date_range"
+)
+
+type ReconciliationSnapshot struct {
+	ID         int64           `db:"id" json:"-"`
+	SnapshotID string          `db:"snapshot_id" json:"snapshot_id"`
+	PeriodFrom string          `db:"period_from" json:"period_from"`
+	PeriodTo   string          `db:"period_to" json:"period_to"`
+	Label      string          `db:"label" json:"label,omitempty"`
+	CreatedBy  string          `db:"created_by" json:"created_by,omitempty"`
+	Summary    json.RawMessage `db:"summary" json:"summary"`
+	Items      json.RawMessage `db:"items" json:"items,omitempty"`
+	Checksum   string          `db:"checksum" json:"checksum"`
+	CreatedAt  time.Time       `db:"created_at" json:"created_at"`
+}
+
+type SnapshotMatchedItem struct {
+	ReconciliationID  int64        `json:"reconciliation_id"`
+	BatchID           string       `json:"reconciliation_batch_id"`
+	Status            string       `json:"status"`
+	MatchConfidence   float64      `json:"match_confidence"`
+	MappingType       string       `json:"mapping_type"`
+	BankTransactionID string       `json:"transaction_id"`
+	BankAmount        money.Amount `json:"bank_amount"`
+	AccountingEntryID string       `json:"entry_id"`
+	AccountingAmount  money.Amount `json:"accounting_amount"`
+}
+
+// SnapshotJournal is the differences journal of a snapshot: every record the
+// period ended with unmatched, in CSV and PDF, stored with their checksums
+type SnapshotJournal struct {
+	ID          int64     `db:"id" json:"-"`
+	SnapshotID  string    `db:"snapshot_id" json:"snapshot_id"`
+	LineCount   int       `db:"line_count" json:"line_count"`
+	CSV         []byte    `db:"csv" json:"-"`
+	CSVChecksum string    `db:"csv_checksum" json:"csv_checksum"`
+	PDF         []byte    `db:"pdf" json:"-"`
+	PDFChecksum string    `db:"pdf_checksum" json:"pdf_checksum"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+}
+
+// JournalLine is one difference of a differences journal
+type JournalLine struct {
+	Section         string       `json:"section"`
+	ReasonCode      string       `json:"reason_code"`
+	RecordType      string       `json:"record_type"`
+	Reference       string       `json:"reference"`
+	Account         string       `json:"account"`
+	RecordDate      string       `json:"record_date"`
+	Amount          money.Amount `json:"amount"`
+	Currency        string       `json:"currency"`
+	AgeDays         int          `json:"age_days"`
+	AgeBucket       string       `json:"age_bucket"`
+	ExceptionStatus string       `json:"exception_status"`
+	Owner           string       `json:"owner"`
+	Comment         string       `json:"comment"`
+}
+
+// Sections of a differences journal
+const (
+	JournalSectionUnmatched  = "unmatched"
+	JournalSectionWrittenOff = "written_off"
+)
+
+type ReportDefinition struct {
+	ID          int64           `db:"id" json:"id"`
+	Name        string          `db:"name" json:"name"`
+	Description string          `db:"description" json:"description,omitempty"`
+	Source      string          `db:"source" json:"source"`
+	Definition  json.RawMessage `db:"definition" json:"definition"`
+	CreatedBy   string          `db:"created_by" json:"created_by,omitempty"`
+	CreatedAt   time.Time       `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time       `db:"updated_at" json:"updated_at"`
+}
+
+type ReportResult struct {
+	ReportID      int64           `json:"report_id"`
+	Name          string          `json:"name"`
+	FromDate      string          `json:"from_date,omitempty"`
+	ToDate        string          `json:"to_date,omitempty"`
+	Currency      string          `json:"currency"`
+	Columns       []string        `json:"columns"`
+	Labels        []string        `json:"labels"`
+	AmountColumns []string        `json:"amount_columns,omitempty"`
+	Rows          [][]interface{} `json:"rows"`
+
+	// Deltas recorded against the batches in Rows, so a report regenerated
+	// after manual changes shows what moved since sign-off
+	Deltas []*BatchDelta `json:"batch_deltas,omitempty"`
+}
+
+type BusinessCalendar struct {
+	ID          int64             `db:"id" json:"-"`
+	Code        string            `db:"code" json:"code"`
+	Country     string            `db:"country" json:"country"`
+	Name        string            `db:"name" json:"name"`
+	WeekendDays []int             `db:"weekend_days" json:"weekend_days"`
+	Holidays    []CalendarHoliday `json:"holidays,omitempty"`
+	CreatedAt   time.Time         `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time         `db:"updated_at" json:"updated_at"`
+}
+
+type CalendarHoliday struct {
+	Date string `db:"holiday_date" json:"date"`
+	Name string `db:"name" json:"name"`
+}
+
+// Counterparty is a party the organisation pays or is paid by. Aliases are
+// the normalized names it appears under in descriptions, IBANs the accounts it
+// pays from or to, and DefaultAccounts the ledger accounts it is booked on.
+// ExpectedLagDays is how many days its bank postings usually trail the books.
+type Counterparty struct {
+	ID              int64     `db:"id" json:"id"`
+	Code            string    `db:"code" json:"code"`
+	Name            string    `db:"name" json:"name"`
+	ExpectedLagDays int       `db:"expected_lag_days" json:"expected_lag_days"`
+	Aliases         []string  `json:"aliases"`
+	IBANs           []string  `json:"ibans"`
+	DefaultAccounts []string  `json:"default_accounts"`
+	CreatedAt       time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt       time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// Name alias sources
+const (
+	AliasSourceManual           = "manual"
+	AliasSourceSuggestionReview = "suggestion_review"
+)
+
+// NameAlias makes the alias dictionary read Alias as Canonical wherever it
+// appears in a description or counterparty name. An alias confirmed from a
+// reviewed match records the bank transaction and entry it was confirmed on.
+type NameAlias struct {
+	ID                int64     `db:"id" json:"id"`
+	Alias             string    `db:"alias" json:"alias"`
+	Canonical         string    `db:"canonical" json:"canonical"`
+	Source            string    `db:"source" json:"source"`
+	UserID            string    `db:"user_id" json:"user_id,omitempty"`
+	BankTransactionID int64     `db:"bank_transaction_id" json:"bank_transaction_id,omitempty"`
+	AccountingEntryID int64     `db:"accounting_entry_id" json:"accounting_entry_id,omitempty"`
+	CreatedAt         time.Time `db:"created_at" json:"created_at"`
+}
+
+const (
+	RuleSetStatusPending    = "pending"
+	RuleSetStatusActive     = "active"
+	RuleSetStatusSuperseded = "superseded"
+	RuleSetStatusRejected   = "rejected"
+)
+
+// RuleSetChange is one proposed version of the production matching rules.
+// Rules is the complete rule set; Diff maps each field that differs from the
+// base version to its old and new value.
+type RuleSetChange struct {
+	ID          int64           `db:"id" json:"id"`
+	Version     string          `db:"version" json:"version"`
+	BaseVersion string          `db:"base_version" json:"base_version"`
+	Rules       json.RawMessage `db:"rules" json:"rules"`
+	Diff        json.RawMessage `db:"diff" json:"diff"`
+	Status      string          `db:"status" json:"status"`
+	Author      string          `db:"author" json:"author"`
+	Reason      string          `db:"reason" json:"reason,omitempty"`
+	ReviewedBy  string          `db:"reviewed_by" json:"reviewed_by,omitempty"`
+	ReviewNote  string          `db:"review_note" json:"review_note,omitempty"`
+	ReviewedAt  *time.Time      `db:"reviewed_at" json:"reviewed_at,omitempty"`
+	CreatedAt   time.Time       `db:"created_at" json:"created_at"`
+}
+
+// Access roles, each allowed everything the roles below it are
+const (
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+type Role struct {
+	Name        string `db:"name" json:"name"`
+	Level       int    `db:"level" json:"level"`
+	Description string `db:"description" json:"description"`
+}
+
+// User assigns a role to the subject of a bearer token
+type User struct {
+	ID          string    `db:"id" json:"id"`
+	DisplayName string    `db:"display_name" json:"display_name,omitempty"`
+	Role        string    `db:"role" json:"role"`
+	UpdatedBy   string    `db:"updated_by" json:"updated_by,omitempty"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// SafetyOverride records a destructive operation confirmed in a guarded
+// environment
+type SafetyOverride struct {
+	ID          int64     `db:"id" json:"id"`
+	Environment string    `db:"environment" json:"environment"`
+	Operation   string    `db:"operation" json:"operation"`
+	Method      string    `db:"method" json:"method"`
+	Path        string    `db:"path" json:"path"`
+	Caller      string    `db:"caller" json:"caller"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+}
+
+// RequestAudit is one mutating API request as it was received. Payload is
+// the request body with credentials redacted, empty when the body was larger
+// than the capture limit; PayloadSHA256 always covers the full body read.
+// ResourceIDs are the route's path variables and the IDs the response named.
+type RequestAudit struct {
+	ID               int64             `db:"id" json:"id"`
+	Method           string            `db:"method" json:"method"`
+	Route            string            `db:"route" json:"route"`
+	Path             string            `db:"path" json:"path"`
+	UserID           string            `db:"user_id" json:"user_id,omitempty"`
+	Caller           string            `db:"caller" json:"caller"`
+	RemoteAddr       string            `db:"remote_addr" json:"remote_addr,omitempty"`
+	UserAgent        string            `db:"user_agent" json:"user_agent,omitempty"`
+	ContentType      string            `db:"content_type" json:"content_type,omitempty"`
+	Payload          string            `db:"payload" json:"payload,omitempty"`
+	PayloadBytes     int64             `db:"payload_bytes" json:"payload_bytes"`
+	PayloadSHA256    string            `db:"payload_sha256" json:"payload_sha256"`
+	PayloadTruncated bool              `db:"payload_truncated" json:"payload_truncated"`
+	ResourceIDs      map[string]string `db:"resource_ids" json:"resource_ids,omitempty"`
+	StatusCode       int               `db:"status_code" json:"status_code"`
+	DurationMS       int64             `db:"duration_ms" json:"duration_ms"`
+	CreatedAt        time.Time         `db:"created_at" json:"created_at"`
+}
+
+// RequestAuditFilter selects request audits, newest first. Zero fields
+// don't filter; BeforeID pages past the last ID of the previous page.
+type RequestAuditFilter struct {
+	UserID   string
+	Route    string
+	Method   string
+	From     string
+	To       string
+	BeforeID int64
+	Limit    int
+}
+
+// ShadowCandidate is a matching rule set evaluated in shadow: while enabled
+// it runs on the inputs of every batch and its results are stored apart from
+// the batch's, without mapping anything
+type ShadowCandidate struct {
+	ID        int64           `db:"id" json:"id"`
+	Version   string          `db:"version" json:"version"`
+	Rules     json.RawMessage `db:"rules" json:"rules"`
+	Enabled   bool            `db:"enabled" json:"enabled"`
+	CreatedAt time.Time       `db:"created_at" json:"created_at"`
+}
+
+// ShadowRun compares one candidate's matches on a batch with the matches the
+// batch kept. Matches agree when they pair exactly the same records.
+type ShadowRun struct {
+	ID                int64           `db:"id" json:"id"`
+	BatchID           string          `db:"reconciliation_batch_id" json:"reconciliation_id"`
+	CandidateVersion  string          `db:"candidate_version" json:"candidate_version"`
+	Rules             json.RawMessage `db:"rules" json:"rules"`
+	ProductionMatches int             `db:"production_matches" json:"production_matches"`
+	ShadowMatches     int             `db:"shadow_matches" json:"shadow_matches"`
+	Agreed            int             `db:"agreed" json:"agreed"`
+	ConfidenceChanged int             `db:"confidence_changed" json:"confidence_changed"`
+	ProductionOnly    int             `db:"production_only" json:"production_only"`
+	ShadowOnly        int             `db:"shadow_only" json:"shadow_only"`
+	AgreementRate     float64         `db:"agreement_rate" json:"agreement_rate"`
+	CreatedAt         time.Time       `db:"created_at" json:"created_at"`
+}
+
+const (
+	ShadowAgreementAgreed     = "agreed"
+	ShadowAgreementShadowOnly = "shadow_only"
+)
+
+// ShadowMatch is a match a candidate would have made
+type ShadowMatch struct {
+	ID                 int64        `db:"id" json:"id"`
+	ShadowRunID        int64        `db:"shadow_run_id" json:"shadow_run_id"`
+	MatchType          string       `db:"match_type" json:"match_type"`
+	Confidence         float64      `db:"confidence" json:"confidence"`
+	AmountDifference   money.Amount `db:"amount_difference" json:"amount_difference"`
+	BankTransactionIDs []int64      `db:"bank_transaction_ids" json:"bank_transaction_ids"`
+	AccountingEntryIDs []int64      `db:"accounting_entry_ids" json:"accounting_entry_ids"`
+	MatchCriteria      []string     `db:"match_criteria" json:"match_criteria"`
+	Agreement          string       `db:"agreement" json:"agreement"`
+}
+
+type NotificationPreferences struct {
+	UserID        string                     `db:"user_id" json:"user_id"`
+	Email         string                     `db:"email" json:"email,omitempty"`
+	WebhookURL    string                     `db:"webhook_url" json:"webhook_url,omitempty"`
+	Locale        string                     `db:"locale" json:"locale,omitempty"`
+	Subscriptions []NotificationSubscription `json:"subscriptions"`
+	UpdatedAt     time.Time                  `db:"updated_at" json:"updated_at"`
+}
+
+type NotificationSubscription struct {
+	EventType string `db:"event_type" json:"event_type"`
+	Channel   string `db:"channel" json:"channel"`
+	Delivery  string `db:"delivery" json:"delivery"`
+}
+
+// NotificationRoute is one recipient of an event on one channel, as resolved
+// from the operators' preferences
+type NotificationRoute struct {
+	UserID   string `json:"user_id"`
+	Channel  string `json:"channel"`
+	Delivery string `json:"delivery"`
+	Address  string `json:"address"`
+	Locale   string `json:"locale"`
+}
+
+// NotificationDispatch is the verdict on one occurrence of an event for an
+// entity: sent to Routes, or suppressed as a repeat inside the dedup window.
+// Suppressed counts the repeats held back since the previous delivery.
+type NotificationDispatch struct {
+	EventType  string              `json:"event_type"`
+	Entity     string              `json:"entity"`
+	Sent       bool                `json:"sent"`
+	Suppressed int                 `json:"suppressed"`
+	LastSentAt time.Time           `json:"last_sent_at"`
+	Routes     []NotificationRoute `json:"routes"`
+}
+
+const (
+	NotificationEventReconciliationCompleted = "reconciliation_completed"
+	NotificationEventReconciliationFailed    = "reconciliation_failed"
+	NotificationEventQuotaExceeded           = "quota_exceeded"
+	NotificationEventMaintenanceEnabled      = "maintenance_enabled"
+	NotificationEventBatchChanged            = "batch_changed"
+	NotificationEventExpectationMissed       = "expectation_missed"
+	NotificationEventDailyDigest             = "daily_digest"
+)
+
+const (
+	NotificationChannelEmail   = "email"
+	NotificationChannelWebhook = "webhook"
+)
+
+const (
+	NotificationDeliveryImmediate = "immediate"
+	NotificationDeliveryDigest    = "digest"
+)
+
+// FXRate is the value of one unit of FromCurrency in ToCurrency on RateDate.
+// Rate is decimal text so it is stored and compared without rounding.
+type FXRate struct {
+	ID           int64     `db:"id" json:"id"`
+	FromCurrency string    `db:"from_currency" json:"from_currency"`
+	ToCurrency   string    `db:"to_currency" json:"to_currency"`
+	Rate         string    `db:"rate" json:"rate"`
+	RateDate     string    `db:"rate_date" json:"rate_date"`
+	UpdatedBy    string    `db:"updated_by" json:"updated_by,omitempty"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt    time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// FeeSchedule is a fee a bank charges an account under its contract. Debits
+// of the account whose description contains DescriptionPattern are the fee.
+type FeeSchedule struct {
+	ID                 int64        `db:"id" json:"id"`
+	AccountNumber      string       `db:"account_number" json:"account_number"`
+	Name               string       `db:"name" json:"name"`
+	FeeType            string       `db:"fee_type" json:"fee_type"`
+	Amount             money.Amount `db:"amount" json:"amount"`
+	Currency           string       `db:"currency" json:"currency,omitempty"`
+	Tolerance          money.Amount `db:"tolerance" json:"tolerance"`
+	DescriptionPattern string       `db:"description_pattern" json:"description_pattern"`
+	Active             bool         `db:"active" json:"active"`
+	UpdatedBy          string       `db:"updated_by" json:"updated_by,omitempty"`
+	CreatedAt          time.Time    `db:"created_at" json:"created_at"`
+	UpdatedAt          time.Time    `db:"updated_at" json:"updated_at"`
+}
+
+const (
+	// FeeTypeMonthly is a flat fee charged once a month, such as account
+	// maintenance
+	FeeTypeMonthly = "monthly"
+	// FeeTypePerTransaction is charged for every other transaction on the
+	// account
+	FeeTypePerTransaction = "per_transaction"
+)
+
+// FeeCharge is a bank debit recognized as the fee of a schedule, in the
+// period (YYYY-MM) it was charged. Amount is the fee charged, positive.
+type FeeCharge struct {
+	ID                int64        `db:"id" json:"id"`
+	FeeScheduleID     int64        `db:"fee_schedule_id" json:"fee_schedule_id"`
+	BankTransactionID int64        `db:"bank_transaction_id" json:"bank_transaction_id"`
+	Period            string       `db:"period" json:"period"`
+	Amount            money.Amount `db:"amount" json:"amount"`
+	ReconciliationID  int64        `db:"reconciliation_id" json:"reconciliation_id,omitempty"`
+	BatchID           string       `db:"batch_id" json:"batch_id,omitempty"`
+	CreatedAt         time.Time    `db:"created_at" json:"created_at"`
+}
+
+// FeeExpectation compares what a schedule's contract expects to be charged
+// in a period with the fees recognized for it. Transactions is the number of
+// transactions a per-transaction fee was expected for.
+type FeeExpectation struct {
+	FeeScheduleID  int64        `json:"fee_schedule_id"`
+	Name           string       `json:"name"`
+	AccountNumber  string       `json:"account_number"`
+	FeeType        string       `json:"fee_type"`
+	Currency       string       `json:"currency,omitempty"`
+	Period         string       `json:"period"`
+	Transactions   int          `json:"transactions,omitempty"`
+	ExpectedAmount money.Amount `json:"expected_amount"`
+	ChargedAmount  money.Amount `json:"charged_amount"`
+	Difference     money.Amount `json:"difference"`
+	Charges        int          `json:"charges"`
+	Status         string       `json:"status"`
+}
+
+const (
+	FeeStatusOK        = "ok"
+	FeeStatusMissing   = "missing"
+	FeeStatusDifferent = "different"
+)
+
+// ExpectedPayment is a payment an upstream system expects on a bank account,
+// registered under its own ExternalID. Amount is positive; Direction says
+// whether it is credited or debited. A bank transaction in the window whose
+// reference fields mention Reference fulfils it.
+type ExpectedPayment struct {
+	ID                int64        `db:"id" json:"id"`
+	Source            string       `db:"source" json:"source,omitempty"`
+	ExternalID        string       `db:"external_id" json:"external_id"`
+	Direction         string       `db:"direction" json:"direction"`
+	AccountNumber     string       `db:"account_number" json:"account_number,omitempty"`
+	Amount            money.Amount `db:"amount" json:"amount"`
+	Currency          string       `db:"currency" json:"currency,omitempty"`
+	Reference         string       `db:"reference" json:"reference"`
+	WindowStart       string       `db:"window_start" json:"window_start"`
+	WindowEnd         string       `db:"window_end" json:"window_end"`
+	Status            string       `db:"status" json:"status"`
+	BankTransactionID int64        `db:"bank_transaction_id" json:"bank_transaction_id,omitempty"`
+	BatchID           string       `db:"batch_id" json:"batch_id,omitempty"`
+	MatchedAt         *time.Time   `db:"matched_at" json:"matched_at,omitempty"`
+	MissedAt          *time.Time   `db:"missed_at" json:"missed_at,omitempty"`
+	CreatedBy         string       `db:"created_by" json:"created_by,omitempty"`
+	CreatedAt         time.Time    `db:"created_at" json:"created_at"`
+	UpdatedAt         time.Time    `db:"updated_at" json:"updated_at"`
+}
+
+const (
+	ExpectedDirectionIncoming = "incoming"
+	ExpectedDirectionOutgoing = "outgoing"
+)
+
+const (
+	ExpectedStatusPending   = "pending"
+	ExpectedStatusMatched   = "matched"
+	ExpectedStatusMissed    = "missed"
+	ExpectedStatusCancelled = "cancelled"
+)
+
+// BankReturn links a return or reversal to the bank transaction it returns.
+// ReconciliationID is the original's match that was undone or flagged.
+type BankReturn struct {
+	ID                    int64     `db:"id" json:"id"`
+	ReturnTransactionID   int64     `db:"return_transaction_id" json:"return_transaction_id"`
+	OriginalTransactionID int64     `db:"original_transaction_id" json:"original_transaction_id"`
+	ReconciliationID      int64     `db:"reconciliation_id" json:"reconciliation_id,omitempty"`
+	ReasonCode            string    `db:"reason_code" json:"reason_code,omitempty"`
+	Action                string    `db:"action" json:"action"`
+	BatchID               string    `db:"batch_id" json:"batch_id,omitempty"`
+	CreatedAt             time.Time `db:"created_at" json:"created_at"`
+}
+
+const (
+	// ReturnActionUnmatched means the original's match was undone, so its
+	// accounting entries are open again
+	ReturnActionUnmatched = "unmatched"
+	// ReturnActionFlagged means the original's match was marked disputed
+	ReturnActionFlagged = "flagged"
+	// ReturnActionHeld means a legal hold kept the original's match as it was
+	ReturnActionHeld = "held"
+	// ReturnActionPaired means the original was never matched
+	ReturnActionPaired = "paired"
+)
+
+// CounterpartyReturnRate is the share of a counterparty's bank transactions
+// in a range that were returned. A zero CounterpartyID collects the
+// transactions linked to no counterparty.
+type CounterpartyReturnRate struct {
+	CounterpartyID int64        `json:"counterparty_id,omitempty"`
+	Code           string       `json:"code,omitempty"`
+	Name           string       `json:"name,omitempty"`
+	Transactions   int          `json:"transactions"`
+	Returns        int          `json:"returns"`
+	ReturnRate     float64      `json:"return_rate"`
+	ReturnedAmount money.Amount `json:"returned_amount"`
+}
+
+// Budget is the net cash movement finance expects on a bank account in a
+// month (YYYY-MM), as budgeted or forecast
+type Budget struct {
+	ID            int64        `db:"id" json:"id"`
+	AccountNumber string       `db:"account_number" json:"account_number"`
+	Period        string       `db:"period" json:"period"`
+	Kind          string       `db:"kind" json:"kind"`
+	Amount        money.Amount `db:"amount" json:"amount"`
+	Currency      string       `db:"currency" json:"currency,omitempty"`
+	UpdatedBy     string       `db:"updated_by" json:"updated_by,omitempty"`
+	CreatedAt     time.Time    `db:"created_at" json:"created_at"`
+	UpdatedAt     time.Time    `db:"updated_at" json:"updated_at"`
+}
+
+const (
+	BudgetKindBudget   = "budget"
+	BudgetKindForecast = "forecast"
+)
+
+// BudgetVariance compares a budget with the cash that actually moved on the
+// account in its period. Reconciled is the part of Actual in matched
+// reconciliations; VariancePercent is left out for a zero budget.
+type BudgetVariance struct {
+	AccountNumber   string       `json:"account_number"`
+	Period          string       `json:"period"`
+	Kind            string       `json:"kind"`
+	Currency        string       `json:"currency,omitempty"`
+	Budget          money.Amount `json:"budget"`
+	Actual          money.Amount `json:"actual"`
+	Reconciled      money.Amount `json:"reconciled"`
+	Variance        money.Amount `json:"variance"`
+	VariancePercent *float64     `json:"variance_percent,omitempty"`
+	Transactions    int          `json:"transactions"`
+}
+
+// ReconciliationException is a bank transaction or accounting entry left
+// unmatched long enough to be worked as an exception. Reference, Account,
+// Amount, Currency and RecordDate are copied from the record.
+type ReconciliationException struct {
+	ID         int64        `db:"id" json:"id"`
+	RecordType string       `db:"record_type" json:"record_type"`
+	RecordID   int64        `db:"record_id" json:"record_id"`
+	Reference  string       `db:"reference" json:"reference"`
+	Account    string       `db:"account" json:"account"`
+	Amount     money.Amount `db:"amount" json:"amount"`
+	Currency   string       `db:"currency" json:"currency,omitempty"`
+	RecordDate string       `db:"record_date" json:"record_date"`
+	Status     string       `db:"status" json:"status"`
+	Owner      string       `db:"owner" json:"owner,omitempty"`
+	Version    int          `db:"version" json:"version"`
+	ClosedAt   *time.Time   `db:"closed_at" json:"closed_at,omitempty"`
+	CreatedAt  time.Time    `db:"created_at" json:"created_at"`
+	UpdatedAt  time.Time    `db:"updated_at" json:"updated_at"`
+
+	Events []*ExceptionEvent `json:"events,omitempty"`
+}
+
+// Kinds of record an exception is raised for
+const (
+	ExceptionRecordBankTransaction = "bank_transaction"
+	ExceptionRecordAccountingEntry = "accounting_entry"
+)
+
+// Workflow states of an exception; written_off and resolved close it
+const (
+	ExceptionStatusNew           = "new"
+	ExceptionStatusInvestigating = "investigating"
+	ExceptionStatusEscalated     = "escalated"
+	ExceptionStatusWrittenOff    = "written_off"
+	ExceptionStatusResolved      = "resolved"
+)
+
+// ExceptionEvent is an entry in the audit trail of an exception
+type ExceptionEvent struct {
+	ID           int64     `db:"id" json:"id"`
+	ExceptionID  int64     `db:"exception_id" json:"exception_id"`
+	Action       string    `db:"action" json:"action"`
+	StatusBefore string    `db:"status_before" json:"status_before,omitempty"`
+	StatusAfter  string    `db:"status_after" json:"status_after,omitempty"`
+	Owner        string    `db:"owner" json:"owner,omitempty"`
+	Comment      string    `db:"comment" json:"comment,omitempty"`
+	UserID       string    `db:"user_id" json:"user_id,omitempty"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+}
+
+const (
+	ExceptionEventCreated      = "created"
+	ExceptionEventTransitioned = "transitioned"
+	ExceptionEventAssigned     = "assigned"
+	ExceptionEventCommented    = "commented"
+)
+
+// UnmatchedItem is a bank transaction or accounting entry still unmatched,
+// with the work state operators set on it. RecordType takes the exception
+// record kinds.
+type UnmatchedItem struct {
+	RecordType string       `json:"record_type"`
+	RecordID   int64        `json:"record_id"`
+	Reference  string       `json:"reference"`
+	Account    string       `json:"account"`
+	Amount     money.Amount `json:"amount"`
+	Currency   string       `json:"currency,omitempty"`
+	RecordDate string       `json:"record_date"`
+	// What a partial match left open of the record, when one settled part
+	// of it
+	OpenAmount *money.Amount `json:"open_amount,omitempty"`
+	UnmatchedItemState
+}
+
+// UnmatchedItemState is the owner, hold, tags and reason code of an
+// unmatched record
+type UnmatchedItemState struct {
+	Owner      string   `json:"owner,omitempty"`
+	OnHold     bool     `json:"on_hold"`
+	Tags       []string `json:"tags,omitempty"`
+	ReasonCode string   `json:"reason_code,omitempty"`
+	UpdatedBy  string   `json:"updated_by,omitempty"`
+}
+
+// UnmatchedItemFilter selects unmatched records for a bulk action. Empty
+// fields select everything; OnHold, when set, selects held or released
+// records only.
+type UnmatchedItemFilter struct {
+	RecordType string `json:"record_type,omitempty"`
+	FromDate   string `json:"from_date,omitempty"`
+	ToDate     string `json:"to_date,omitempty"`
+	Account    string `json:"account,omitempty"`
+	Currency   string `json:"currency,omitempty"`
+	Owner      string `json:"owner,omitempty"`
+	Tag        string `json:"tag,omitempty"`
+	ReasonCode string `json:"reason_code,omitempty"`
+	OnHold     *bool  `json:"on_hold,omitempty"`
+}
+
+// UnmatchedItemRef names one unmatched record of a bulk action
+type UnmatchedItemRef struct {
+	RecordType string `json:"record_type"`
+	ID         int64  `json:"id"`
+}
+
+// StatementBalance is the closing booked balance of a bank account on a day,
+// taken from an ingested statement
+type StatementBalance struct {
+	ID            int64        `db:"id" json:"id"`
+	AccountNumber string       `db:"account_number" json:"account_number"`
+	BalanceDate   string       `db:"balance_date" json:"balance_date"`
+	Balance       money.Amount `db:"balance" json:"balance"`
+	Currency      string       `db:"currency" json:"currency,omitempty"`
+	Source        string       `db:"source" json:"source,omitempty"`
+	CreatedAt     time.Time    `db:"created_at" json:"created_at"`
+	UpdatedAt     time.Time    `db:"updated_at" json:"updated_at"`
+}
+
+// CashPosition is the cash of a bank account on a date: the latest statement
+// balance rolled forward with the transactions booked since, split into the
+// part reconciled with the ledger and the unreconciled inflows and outflows,
+// and projected with the outstanding expected payments weighted by how
+// likely they are to arrive.
+type CashPosition struct {
+	AccountNumber        string       `json:"account_number"`
+	Currency             string       `json:"currency,omitempty"`
+	StatementDate        string       `json:"statement_date"`
+	StatementBalance     money.Amount `json:"statement_balance"`
+	Balance              money.Amount `json:"balance"`
+	ReconciledBalance    money.Amount `json:"reconciled_balance"`
+	UnreconciledInflows  money.Amount `json:"unreconciled_inflows"`
+	UnreconciledOutflows money.Amount `json:"unreconciled_outflows"`
+	UnreconciledItems    int          `json:"unreconciled_items"`
+	ExpectedInflows      money.Amount `json:"expected_inflows"`
+	ExpectedOutflows     money.Amount `json:"expected_outflows"`
+	OutstandingItems     int          `json:"outstanding_items"`
+	ProjectedBalance     money.Amount `json:"projected_balance"`
+}
+
+// OutstandingPayment is a pending expected payment counted in a cash
+// projection, with its amount as registered. Matched and Missed count the
+// expectations of the same source and direction that were matched and missed.
+type OutstandingPayment struct {
+	AccountNumber string       `json:"account_number"`
+	Source        string       `json:"source,omitempty"`
+	Direction     string       `json:"direction"`
+	Amount        money.Amount `json:"amount"`
+	Currency      string       `json:"currency,omitempty"`
+	Matched       int          `json:"-"`
+	Missed        int          `json:"-"`
+}
+
+// DailyBankActivity counts the bank transactions of one day in one currency,
+// and how many of them a matched reconciliation maps. Amounts are absolute.
+type DailyBankActivity struct {
+	Date            string
+	Currency        string
+	Count           int
+	Matched         int
+	MatchedAmount   money.Amount
+	UnmatchedAmount money.Amount
+}
+
+// MatchTypeStats counts the matched reconciliations of one mapping type, with
+// their average confidence
+type MatchTypeStats struct {
+	MappingType       string
+	Count             int
+	AverageConfidence float64
+}
+
+// AccountCount counts the records of one account in some state, such as the
+// unmatched bank transactions of a bank account
+type AccountCount struct {
+	Account string
+	Status  string
+	Count   int
+}
+
+// ExceptionResolution sums how long the closed exceptions of an account took
+// from being raised to being closed
+type ExceptionResolution struct {
+	Account string
+	Count   int
+	Seconds float64
+}
+
+// OperatorBacklog is the work waiting on operators, by account: unmatched
+// bank transactions by bank account and accounting entries by ledger
+// account, matches pending review and disputed matches by the bank account
+// of their transactions, and open exceptions by account and status
+type OperatorBacklog struct {
+	UnmatchedBank   []*AccountCount
+	UnmatchedLedger []*AccountCount
+	PendingReview   []*AccountCount
+	Disputed        []*AccountCount
+	OpenExceptions  []*AccountCount
+	Resolutions     []*ExceptionResolution
+}
+
+// ReconciliationStats sums up how the bank transactions of a date range were
+// reconciled. Amounts are absolute and in Currency; transactions without a
+// rate to it are counted but add no amount.
+type ReconciliationStats struct {
+	FromDate          string                `json:"from_date"`
+	ToDate            string                `json:"to_date"`
+	Currency          string                `json:"currency"`
+	BankTransactions  int                   `json:"bank_transactions"`
+	Matched           int                   `json:"matched"`
+	Unmatched         int                   `json:"unmatched"`
+	MatchRate         float64               `json:"match_rate"`
+	MatchesByType     map[string]int        `json:"matches_by_type"`
+	AverageConfidence float64               `json:"average_confidence"`
+	MatchedAmount     money.Amount          `json:"matched_amount"`
+	UnmatchedAmount   money.Amount          `json:"unmatched_amount"`
+	UnconvertedCount  int                   `json:"unconverted_count,omitempty"`
+	UnmatchedByAge    []*UnmatchedAgeBucket `json:"unmatched_by_age"`
+	Trend             []*DailyMatchStats    `json:"trend"`
+}
+
+// UnmatchedAgeBucket is what is left unmatched of the bank transactions
+// between MinDays and MaxDays old, MaxDays zero for no upper bound
+type UnmatchedAgeBucket struct {
+	Bucket  string       `json:"bucket"`
+	MinDays int          `json:"min_days"`
+	MaxDays int          `json:"max_days,omitempty"`
+	Count   int          `json:"count"`
+	Amount  money.Amount `json:"amount"`
+}
+
+// DailyMatchStats is the reconciliation of one day's bank transactions
+type DailyMatchStats struct {
+	Date             string       `json:"date"`
+	BankTransactions int          `json:"bank_transactions"`
+	Matched          int          `json:"matched"`
+	MatchRate        float64      `json:"match_rate"`
+	MatchedAmount    money.Amount `json:"matched_amount"`
+	UnmatchedAmount  money.Amount `json:"unmatched_amount"`
+}
+
+// DailyDigest sums up one day of a tenant: the records ingested, the batches
+// run with the matches and unmatched records they wrote, the records
+// ingested that day still unmatched, the unmatched records that crossed an
+// aging threshold that day, and the disputes open now. Amounts are absolute
+// and in Currency; records without a rate to it are counted but add no
+// amount.
+type DailyDigest struct {
+	Tenant                    string             `json:"tenant"`
+	Date                      string             `json:"date"`
+	Currency                  string             `json:"currency"`
+	BankTransactionsIngested  int                `json:"bank_transactions_ingested"`
+	AccountingEntriesIngested int                `json:"accounting_entries_ingested"`
+	BatchesRun                int                `json:"batches_run"`
+	Matched                   int                `json:"matched"`
+	Unmatched                 int                `json:"unmatched"`
+	MatchRate                 float64            `json:"match_rate"`
+	NewUnmatchedCount         int                `json:"new_unmatched_count"`
+	NewUnmatchedAmount        money.Amount       `json:"new_unmatched_amount"`
+	AgedItems                 []*DigestAgedItems `json:"aged_items"`
+	OpenDisputes              int                `json:"open_disputes"`
+	UnconvertedCount          int                `json:"unconverted_count,omitempty"`
+}
+
+// DigestAgedItems are the unmatched records that turned ThresholdDays old on
+// the day of a digest
+type DigestAgedItems struct {
+	ThresholdDays int          `json:"threshold_days"`
+	Count         int          `json:"count"`
+	Amount        money.Amount `json:"amount"`
+}
+
+// DigestActivity counts what a tenant ingested and reconciled on one day,
+// and the disputes open now
+type DigestActivity struct {
+	BankTransactions  int
+	AccountingEntries int
+	Batches           int
+	Matched           int
+	Unmatched         int
+	OpenDisputes      int
+}
+
+// CurrencyTotal counts records in one currency with their absolute amount
+type CurrencyTotal struct {
+	Currency string
+	Count    int
+	Amount   money.Amount
+}
+
+// ReconciliationSchedule starts a reconciliation of Period whenever
+// CronExpression fires in Timezone
+type ReconciliationSchedule struct {
+	ID             int64      `db:"id" json:"id"`
+	Name           string     `db:"name" json:"name"`
+	CronExpression string     `db:"cron_expression" json:"cron_expression"`
+	Period         string     `db:"period" json:"period"`
+	Timezone       string     `db:"timezone" json:"timezone"`
+	Enabled        bool       `db:"enabled" json:"enabled"`
+	NextRunAt      *time.Time `db:"next_run_at" json:"next_run_at,omitempty"`
+	LastRunAt      *time.Time `db:"last_run_at" json:"last_run_at,omitempty"`
+	UpdatedBy      string     `db:"updated_by" json:"updated_by,omitempty"`
+	CreatedAt      time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt      time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+// ScheduleRun is one firing of a schedule and the reconciliation it started
+type ScheduleRun struct {
+	ID           int64      `db:"id" json:"id"`
+	ScheduleID   int64      `db:"schedule_id" json:"schedule_id"`
+	ScheduledFor time.Time  `db:"scheduled_for" json:"scheduled_for"`
+	FromDate     string     `db:"from_date" json:"from_date"`
+	ToDate       string     `db:"to_date" json:"to_date"`
+	Status       string     `db:"status" json:"status"`
+	JobID        int64      `db:"job_id" json:"job_id,omitempty"`
+	BatchID      string     `db:"reconciliation_batch_id" json:"reconciliation_batch_id,omitempty"`
+	Error        string     `db:"error" json:"error,omitempty"`
+	StartedAt    time.Time  `db:"started_at" json:"started_at"`
+	FinishedAt   *time.Time `db:"finished_at" json:"finished_at,omitempty"`
+}
+
+const (
+	SchedulePeriodPreviousDay  = "previous_day"
+	SchedulePeriodPreviousWeek = "previous_week"
+)
+
+const (
+	ScheduleRunStatusRunning   = "running"
+	ScheduleRunStatusCompleted = "completed"
+	ScheduleRunStatusFailed    = "failed"
+	// ScheduleRunStatusSkipped means the run could not start, such as while
+	// an overlapping reconciliation was in progress
+	ScheduleRunStatusSkipped = "skipped"
+)
+
+// ReconciliationDetail is one reconciliation of a batch as it stands now,
+// with the records it maps and its audit trail, oldest first
+type ReconciliationDetail struct {
+	Reconciliation
+	Mappings []*MappedPair
+	Audit    []*ReconciliationAudit
+}
+
+// MappedPair is a mapping with the IDs its records are known by
+type MappedPair struct {
+	MappingType       string
+	BankTransactionID int64
+	TransactionID     string
+	AccountingEntryID int64
+	EntryID           string
+	Amount            *money.Amount
+	Details           json.RawMessage
+}
+
+// BatchReportRow is one line of a batch report: a bank transaction and an
+// accounting entry mapped to each other by a reconciliation, or one of them
+// left unmatched. The side that is missing has an empty ID.
+type BatchReportRow struct {
+	Section          string       `json:"section"`
+	ReconciliationID int64        `json:"reconciliation_id,omitempty"`
+	Status           string       `json:"status"`
+	MappingType      string       `json:"mapping_type,omitempty"`
+	MatchConfidence  float64      `json:"match_confidence"`
+	AmountDifference money.Amount `json:"amount_difference"`
+	TransactionID    string       `json:"transaction_id,omitempty"`
+	AccountNumber    string       `json:"account_number,omitempty"`
+	TransactionDate  string       `json:"transaction_date,omitempty"`
+	BankAmount       money.Amount `json:"bank_amount"`
+	BankCurrency     string       `json:"bank_currency,omitempty"`
+	EntryID          string       `json:"entry_id,omitempty"`
+	AccountCode      string       `json:"account_code,omitempty"`
+	EntryDate        string       `json:"entry_date,omitempty"`
+	AccountingAmount money.Amount `json:"accounting_amount"`
+	EntryCurrency    string       `json:"entry_currency,omitempty"`
+}
+
+// ExportJob is an export written to object storage by the export worker
+// instead of streamed in its request
+type ExportJob struct {
+	ID          int64           `db:"id" json:"id"`
+	Kind        string          `db:"kind" json:"kind"`
+	Format      string          `db:"format" json:"format"`
+	Params      json.RawMessage `db:"params" json:"params"`
+	Locale      string          `db:"locale" json:"locale"`
+	Status      string          `db:"status" json:"status"`
+	CallbackURL string          `db:"callback_url" json:"callback_url,omitempty"`
+	RequestedBy string          `db:"requested_by" json:"requested_by,omitempty"`
+	InstanceID  string          `db:"instance_id" json:"-"`
+	ObjectKey   string          `db:"object_key" json:"-"`
+	SizeBytes   int64           `db:"size_bytes" json:"size_bytes,omitempty"`
+	Error       string          `db:"error" json:"error,omitempty"`
+	CreatedAt   time.Time       `db:"created_at" json:"created_at"`
+	StartedAt   *time.Time      `db:"started_at" json:"started_at,omitempty"`
+	FinishedAt  *time.Time      `db:"finished_at" json:"finished_at,omitempty"`
+	ArtifactID  *int64          `db:"artifact_id" json:"-"`
+
+	// Artifact is the registration of a completed export's file, with the
+	// hash and signature recipients verify it by
+	Artifact *ReportArtifact `db:"-" json:"artifact,omitempty"`
+	// DownloadURL is a signed link to a completed export, valid until
+	// DownloadExpiresAt
+	DownloadURL       string     `db:"-" json:"download_url,omitempty"`
+	DownloadExpiresAt *time.Time `db:"-" json:"download_expires_at,omitempty"`
+}
+
+const (
+	ExportKindBatchReport = "batch_report"
+
+	ExportStatusQueued    = "queued"
+	ExportStatusRunning   = "running"
+	ExportStatusCompleted = "completed"
+	ExportStatusFailed    = "failed"
+)
+
+// ReportArtifact registers a report file handed out, by the SHA-256 of its
+// content. Signature is an HMAC over the registration, so neither the file
+// nor its entry can be altered unnoticed.
+type ReportArtifact struct {
+	ID        int64     `db:"id" json:"id"`
+	Tenant    string    `db:"tenant_id" json:"-"`
+	Kind      string    `db:"kind" json:"kind"`
+	Reference string    `db:"reference" json:"reference"`
+	Format    string    `db:"format" json:"format"`
+	Filename  string    `db:"filename" json:"filename"`
+	SHA256    string    `db:"sha256" json:"sha256"`
+	SizeBytes int64     `db:"size_bytes" json:"size_bytes"`
+	Signature string    `db:"signature" json:"signature"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// Kinds of report artifacts; the reference of a differences journal is its
+// snapshot, that of a batch report its batch
+const (
+	ArtifactKindDifferencesJournal = "differences_journal"
+	ArtifactKindBatchReport        = "batch_report"
+)
+
+// ArtifactVerification is the outcome of checking a file against the
+// artifact registry. Valid is set when the file matches a registered
+// artifact whose signature holds; Artifacts lists every registration of its
+// hash either way.
+type ArtifactVerification struct {
+	Valid     bool              `json:"valid"`
+	SHA256    string            `json:"sha256"`
+	SizeBytes int64             `json:"size_bytes"`
+	Reason    string            `json:"reason,omitempty"`
+	Artifacts []*ReportArtifact `json:"artifacts"`
+}
+
+// PolicyPack bundles the settings a tenant or an account reconciles under:
+// the matching thresholds, the confidence below which a match waits for
+// review, the largest amount an exception may be written off for, and the
+// least number of days each data class is kept
+type PolicyPack struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+
+	MinConfidence              float64 `json:"min_confidence"`
+	MinGroupConfidence         float64 `json:"min_group_confidence"`
+	AmountToleranceBasisPoints int64   `json:"amount_tolerance_basis_points"`
+	DateToleranceDays          int     `json:"date_tolerance_days"`
+
+	ReviewConfidence float64        `json:"review_confidence"`
+	WriteOffLimit    money.Amount   `json:"write_off_limit"`
+	RetentionDays    map[string]int `json:"retention_days"`
+}
+
+// PolicyPackAssignment puts a tenant, or one of its bank or ledger accounts
+// when Account is set, under a policy pack
+type PolicyPackAssignment struct {
+	Account    string    `db:"account" json:"account,omitempty"`
+	Pack       string    `db:"pack" json:"pack"`
+	AssignedBy string    `db:"assigned_by" json:"assigned_by,omitempty"`
+	UpdatedAt  time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// BatchPolicy records the packs a batch ran under: its tenant's, empty when
+// the tenant has none, and those of the accounts with one of their own
+type BatchPolicy struct {
+	PolicyPack   string            `json:"policy_pack,omitempty"`
+	AccountPacks map[string]string `json:"account_packs,omitempty"`
+}
+
+// RetentionPolicy is how long one class of data is kept; zero days keeps it
+// forever
+type RetentionPolicy struct {
+	DataClass     string    `db:"data_class" json:"data_class"`
+	RetentionDays int       `db:"retention_days" json:"retention_days"`
+	UpdatedBy     string    `db:"updated_by" json:"updated_by,omitempty"`
+	UpdatedAt     time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// Data classes under retention
+const (
+	// RetentionClassResults is the per-item results stored with each batch
+	RetentionClassResults = "results"
+	// RetentionClassAudit is the reconciliation audit trail
+	RetentionClassAudit = "audit"
+	// RetentionClassExports is finished export jobs and their stored files
+	RetentionClassExports = "exports"
+)
+
+// LegalHold freezes a batch, an account, a bank transaction or an
+// accounting entry until it is lifted: held data is not purged, unmatched or
+// corrected. A tenant hold suspends purging altogether.
+type LegalHold struct {
+	ID        int64     `db:"id" json:"id"`
+	Scope     string    `db:"scope" json:"scope"`
+	ScopeID   string    `db:"scope_id" json:"scope_id"`
+	Reason    string    `db:"reason" json:"reason,omitempty"`
+	CreatedBy string    `db:"created_by" json:"created_by,omitempty"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+const (
+	LegalHoldScopeBatch  = "batch"
+	LegalHoldScopeTenant = "tenant"
+	// LegalHoldScopeAccount holds a bank account number or ledger account
+	// code
+	LegalHoldScopeAccount         = "account"
+	LegalHoldScopeBankTransaction = "bank_transaction"
+	LegalHoldScopeAccountingEntry = "accounting_entry"
+)
+
+// LegalHoldAudit records a legal hold being placed or lifted
+type LegalHoldAudit struct {
+	ID          int64     `db:"id" json:"id"`
+	LegalHoldID int64     `db:"legal_hold_id" json:"legal_hold_id"`
+	Action      string    `db:"action" json:"action"`
+	Scope       string    `db:"scope" json:"scope"`
+	ScopeID     string    `db:"scope_id" json:"scope_id"`
+	Reason      string    `db:"reason" json:"reason,omitempty"`
+	UserID      string    `db:"user_id" json:"user_id,omitempty"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+}
+
+const (
+	LegalHoldActionPlaced = "placed"
+	LegalHoldActionLifted = "lifted"
+)
+
+// LegalHoldSubjects is what a change touches, to be checked against legal
+// holds. Holds on the accounts of the listed records apply too.
+type LegalHoldSubjects struct {
+	BatchIDs           []string
+	BankTransactionIDs []int64
+	AccountingEntryIDs []int64
+}
+
+// RetentionRun is one pass of the purger, or a dry run reporting what it
+// would purge
+type RetentionRun struct {
+	ID          int64                   `db:"id" json:"id"`
+	DryRun      bool                    `db:"dry_run" json:"dry_run"`
+	TriggeredBy string                  `db:"triggered_by" json:"triggered_by,omitempty"`
+	Classes     []*RetentionClassReport `db:"report" json:"classes"`
+	StartedAt   time.Time               `db:"started_at" json:"started_at"`
+	FinishedAt  time.Time               `db:"finished_at" json:"finished_at"`
+}
+
+// RetentionClassReport is what a run found for one data class: the records
+// past their retention, how many of them a legal hold kept, and how many
+// were purged. Suspended is set when a tenant hold stopped all purging.
+type RetentionClassReport struct {
+	DataClass     string     `json:"data_class"`
+	RetentionDays int        `json:"retention_days"`
+	Cutoff        *time.Time `json:"cutoff,omitempty"`
+	Expired       int64      `json:"expired"`
+	Held          int64      `json:"held"`
+	Purged        int64      `json:"purged"`
+	Suspended     bool       `json:"suspended,omitempty"`
+	// Set when a policy pack raised RetentionDays above the class's policy
+	PolicyPackFloor bool `json:"policy_pack_floor,omitempty"`
+}
+
+// IntegrityRun is one pass of the mapping integrity checker
+type IntegrityRun struct {
+	ID          int64            `db:"id" json:"id"`
+	TriggeredBy string           `db:"triggered_by" json:"triggered_by,omitempty"`
+	Metrics     IntegrityMetrics `db:"metrics" json:"metrics"`
+	StartedAt   time.Time        `db:"started_at" json:"started_at"`
+	FinishedAt  time.Time        `db:"finished_at" json:"finished_at"`
+}
+
+// IntegrityMetrics counts what a run found of each kind. SumUnchecked counts
+// the groups whose records are in more than one currency, whose totals are
+// not compared. Truncated is set when a kind had more findings than a run
+// records.
+type IntegrityMetrics struct {
+	OrphanMappings int  `json:"orphan_mappings"`
+	MultiplyMapped int  `json:"multiply_mapped"`
+	SumMismatches  int  `json:"sum_mismatches"`
+	SumUnchecked   int  `json:"sum_unchecked"`
+	Truncated      bool `json:"truncated,omitempty"`
+}
+
+// IntegrityFinding is a mapping that drifted from the records it ties
+// together, and the repair that sets it right
+type IntegrityFinding struct {
+	ID               int64            `db:"id" json:"id"`
+	RunID            int64            `db:"run_id" json:"run_id"`
+	Kind             string           `db:"kind" json:"kind"`
+	ReconciliationID int64            `db:"reconciliation_id" json:"reconciliation_id,omitempty"`
+	MappingID        int64            `db:"mapping_id" json:"mapping_id,omitempty"`
+	RecordType       string           `db:"record_type" json:"record_type,omitempty"`
+	RecordID         int64            `db:"record_id" json:"record_id,omitempty"`
+	Details          IntegrityDetails `db:"details" json:"details"`
+	Repair           string           `db:"repair" json:"repair"`
+	Status           string           `db:"status" json:"status"`
+	ResolvedBy       string           `db:"resolved_by" json:"resolved_by,omitempty"`
+	ResolvedAt       *time.Time       `db:"resolved_at" json:"resolved_at,omitempty"`
+	CreatedAt        time.Time        `db:"created_at" json:"created_at"`
+}
+
+// IntegrityDetails is what a finding found: for an orphan mapping, why it is
+// one and the records it names; for a multiply mapped record, the
+// reconciliations and batches mapping it; for a sum mismatch, the group's
+// totals and the difference they now make. Totals are in Currency.
+type IntegrityDetails struct {
+	Reason            string        `json:"reason,omitempty"`
+	MappingType       string        `json:"mapping_type,omitempty"`
+	BankTransactionID int64         `json:"bank_transaction_id,omitempty"`
+	AccountingEntryID int64         `json:"accounting_entry_id,omitempty"`
+	ReconciliationIDs []int64       `json:"reconciliation_ids,omitempty"`
+	BatchIDs          []string      `json:"batch_ids,omitempty"`
+	Currency          string        `json:"currency,omitempty"`
+	BankTotal         *money.Amount `json:"bank_total,omitempty"`
+	LedgerTotal       *money.Amount `json:"ledger_total,omitempty"`
+	AmountDifference  *money.Amount `json:"amount_difference,omitempty"`
+	ActualDifference  *money.Amount `json:"actual_difference,omitempty"`
+}
+
+// Reasons a mapping is an orphan
+const (
+	IntegrityReasonReconciliationMissing   = "reconciliation_missing"
+	IntegrityReasonReconciliationUnmatched = "reconciliation_unmatched"
+	IntegrityReasonBankTransactionMissing  = "bank_transaction_missing"
+	IntegrityReasonAccountingEntryMissing  = "accounting_entry_missing"
+	IntegrityReasonNoRecords               = "no_records"
+)
+
+// Kinds of integrity finding
+const (
+	// IntegrityOrphanMapping is a mapping to a bank transaction, accounting
+	// entry or reconciliation that no longer exists, to no record at all, or
+	// kept by a reconciliation that was unmatched
+	IntegrityOrphanMapping = "orphan_mapping"
+	// IntegrityMultiplyMapped is a record mapped by more than one batch
+	IntegrityMultiplyMapped = "multiply_mapped"
+	// IntegritySumMismatch is a one-to-many or many-to-one group whose
+	// totals no longer differ by the amount difference it was matched with
+	IntegritySumMismatch = "sum_mismatch"
+)
+
+// Repairs of integrity findings
+const (
+	// IntegrityRepairDeleteMapping deletes the orphan mapping
+	IntegrityRepairDeleteMapping = "delete_mapping"
+	// IntegrityRepairUnmatchDuplicates unmatches every reconciliation of the
+	// record but the earliest
+	IntegrityRepairUnmatchDuplicates = "unmatch_duplicates"
+	// IntegrityRepairReviewMatch records the group's actual difference and
+	// holds the match for review
+	IntegrityRepairReviewMatch = "review_match"
+)
+
+// States of an integrity finding. A finding found to no longer hold when it
+// is repaired is stale; one left open when a later run ran is superseded.
+const (
+	IntegrityStatusOpen       = "open"
+	IntegrityStatusRepaired   = "repaired"
+	IntegrityStatusStale      = "stale"
+	IntegrityStatusSuperseded = "superseded"
+)
+
+// IngestionFile is a statement file fetched from SFTP or an S3 bucket, and
+// what became of it. Files are told apart by the SHA-256 of their content.
+// QualityScore is the share of the data-quality checks its transactions
+// passed, from 0 to 1, and nil until the file was parsed.
+type IngestionFile struct {
+	ID           int64     `db:"id" json:"id"`
+	Source       string    `db:"source" json:"source"`
+	FileName     string    `db:"file_name" json:"file_name"`
+	Checksum     string    `db:"checksum" json:"checksum"`
+	Size         int64     `db:"size" json:"size"`
+	Format       string    `db:"format" json:"format,omitempty"`
+	Status       string    `db:"status" json:"status"`
+	Records      int       `db:"records" json:"records"`
+	QualityScore *float64  `db:"quality_score" json:"quality_score,omitempty"`
+	Error        string    `db:"error" json:"error,omitempty"`
+	ArchivedPath string    `db:"archived_path" json:"archived_path,omitempty"`
+	JobID        int64     `db:"job_id" json:"job_id,omitempty"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt    time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// Statuses of an ingestion file
+const (
+	IngestionFileProcessing = "processing"
+	IngestionFileIngested   = "ingested"
+	// IngestionFileFailed could not be ingested for a reason that may pass,
+	// such as the database being unavailable; it is fetched again
+	IngestionFileFailed = "failed"
+	// IngestionFileRejected is not an ingestible statement, or holds
+	// transactions that fail validation; it is moved aside and not fetched
+	// again
+	IngestionFileRejected = "rejected"
+)
+
+// IngestionEmail is one delivery of a statement email by the email provider,
+// and what became of its attachments: the lineage from a mailbox and sender
+// to the ingestion files, and their jobs, the statements were ingested as
+type IngestionEmail struct {
+	ID          int64                       `db:"id" json:"id"`
+	MessageID   string                      `db:"message_id" json:"message_id,omitempty"`
+	Mailbox     string                      `db:"mailbox" json:"mailbox,omitempty"`
+	Sender      string                      `db:"sender" json:"sender,omitempty"`
+	Subject     string                      `db:"subject" json:"subject,omitempty"`
+	Status      string                      `db:"status" json:"status"`
+	Error       string                      `db:"error" json:"error,omitempty"`
+	Attachments []*IngestionEmailAttachment `db:"attachments" json:"attachments"`
+	CreatedAt   time.Time                   `db:"created_at" json:"created_at"`
+}
+
+// IngestionEmailAttachment is one attachment of a statement email. Status is
+// that of an ingestion file, or duplicate when its content was ingested or
+// rejected before, or skipped while another delivery is ingesting it.
+type IngestionEmailAttachment struct {
+	FileName        string `json:"file_name"`
+	Checksum        string `json:"checksum,omitempty"`
+	Size            int64  `json:"size"`
+	Status          string `json:"status"`
+	Error           string `json:"error,omitempty"`
+	IngestionFileID int64  `json:"ingestion_file_id,omitempty"`
+}
+
+// Statuses of an ingestion email
+const (
+	IngestionEmailProcessed = "processed"
+	// IngestionEmailRefused was sent to a mailbox that is not configured,
+	// or by a sender the mailbox does not allow; nothing was ingested
+	IngestionEmailRefused = "refused"
+	// IngestionEmailEmpty had no attachments
+	IngestionEmailEmpty = "empty"
+)
+
+// Statuses of an email attachment besides those of an ingestion file
+const (
+	IngestionAttachmentDuplicate = "duplicate"
+	IngestionAttachmentSkipped   = "skipped"
+)
+
+// WebhookEndpoint is a URL an upstream team registered to be told of the
+// ingestion anomalies in EventTypes. Deliveries are signed with Secret,
+// which is returned only by the create that generated it.
+type WebhookEndpoint struct {
+	ID          int64     `db:"id" json:"id"`
+	URL         string    `db:"url" json:"url"`
+	Secret      string    `db:"secret" json:"secret,omitempty"`
+	EventTypes  []string  `db:"event_types" json:"event_types"`
+	Description string    `db:"description" json:"description,omitempty"`
+	Active      bool      `db:"active" json:"active"`
+	UpdatedBy   string    `db:"updated_by" json:"updated_by,omitempty"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// WebhookEvent is one anomaly as delivered to the endpoints subscribed to
+// its type. Data is the event-specific part of the payload.
+type WebhookEvent struct {
+	ID        int64                  `db:"id" json:"id"`
+	EventType string                 `db:"event_type" json:"event_type"`
+	Data      map[string]interface{} `db:"payload" json:"data"`
+	CreatedAt time.Time              `db:"created_at" json:"created_at"`
+}
+
+// WebhookDelivery is the delivery of one event to one endpoint and the
+// outcome of its last attempt. LastStatus is the HTTP status the endpoint
+// answered with, 0 when it could not be reached.
+type WebhookDelivery struct {
+	ID            int64         `db:"id" json:"id"`
+	EventID       int64         `db:"event_id" json:"event_id"`
+	EndpointID    int64         `db:"endpoint_id" json:"endpoint_id"`
+	Status        string        `db:"status" json:"status"`
+	Attempts      int           `db:"attempts" json:"attempts"`
+	LastStatus    int           `db:"last_status" json:"last_status,omitempty"`
+	LastError     string        `db:"last_error" json:"last_error,omitempty"`
+	NextAttemptAt *time.Time    `db:"next_attempt_at" json:"next_attempt_at,omitempty"`
+	DeliveredAt   *time.Time    `db:"delivered_at" json:"delivered_at,omitempty"`
+	CreatedAt     time.Time     `db:"created_at" json:"created_at"`
+	Event         *WebhookEvent `json:"event,omitempty"`
+
+	// Where the sender posts the delivery; not listed
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+// Statuses of a webhook delivery. A failed delivery ran out of attempts.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// Ingestion anomalies webhooks are raised for
+const (
+	// WebhookEventDuplicateFile is a fetched file whose content was
+	// ingested or rejected before
+	WebhookEventDuplicateFile = "ingestion.duplicate_file"
+	// WebhookEventSequenceGap is a statement whose sequence number skips
+	// some after the last one ingested for its account
+	WebhookEventSequenceGap = "ingestion.sequence_gap"
+	// WebhookEventQualityBelowThreshold is an ingested file whose
+	// data-quality score is below the configured threshold
+	WebhookEventQualityBelowThreshold = "ingestion.quality_below_threshold"
+	// WebhookEventFeedEmpty is an expected daily feed that brought no
+	// transactions by the cutoff
+	WebhookEventFeedEmpty = "ingestion.feed_empty"
+)
+
+// SandboxReset is one wipe of the sandbox tenant's records and the synthetic
+// data generated in their place
+type SandboxReset struct {
+	ID                int64      `db:"id" json:"id"`
+	ResetDate         string     `db:"reset_date" json:"reset_date,omitempty"`
+	TriggeredBy       string     `db:"triggered_by" json:"triggered_by"`
+	BankTransactions  int        `db:"bank_transactions" json:"bank_transactions"`
+	AccountingEntries int        `db:"accounting_entries" json:"accounting_entries"`
+	Error             string     `db:"error" json:"error,omitempty"`
+	StartedAt         time.Time  `db:"started_at" json:"started_at"`
+	FinishedAt        *time.Time `db:"finished_at" json:"finished_at,omitempty"`
+}
+
+// WorkerHeartbeat is the last sign of life of a background worker on an
+// instance. Stale is set when the worker has not beaten within the stuck
+// threshold.
+type WorkerHeartbeat struct {
+	InstanceID string    `db:"instance_id" json:"instance_id"`
+	Worker     string    `db:"worker" json:"worker"`
+	Tenant     string    `db:"tenant_id" json:"tenant,omitempty"`
+	StartedAt  time.Time `db:"started_at" json:"started_at"`
+	BeatAt     time.Time `db:"beat_at" json:"beat_at"`
+	Stale      bool      `json:"stale"`
+}
+
+// MappedRecord is one record of a reconciliation, by the business ID of the
+// bank transaction or accounting entry, with what the reconciliation made
+// of it
+type MappedRecord struct {
+	ReconciliationID int64        `db:"reconciliation_id" json:"reconciliation_id"`
+	BatchID          string       `db:"reconciliation_batch_id" json:"reconciliation_batch_id"`
+	Status           string       `db:"status" json:"status"`
+	MatchConfidence  float64      `db:"match_confidence" json:"match_confidence"`
+	AmountDifference money.Amount `db:"amount_difference" json:"amount_difference"`
+	MappingType      string       `db:"mapping_type" json:"mapping_type"`
+	TransactionID    string       `db:"transaction_id" json:"transaction_id,omitempty"`
+	EntryID          string       `db:"entry_id" json:"entry_id,omitempty"`
+}
+
+// APIKey is a credential a machine caller presents in X-API-Key instead of
+// a user's bearer token, acting for Tenant within Scope. Key is the secret
+// itself, returned only by the issue or rotation that generated it; Prefix
+// tells keys apart in listings. A rotated key names the key that replaced it
+// in ReplacedBy and expires shortly after.
+type APIKey struct {
+	ID         int64      `db:"id" json:"id"`
+	Tenant     string     `db:"tenant_id" json:"tenant"`
+	Name       string     `db:"name" json:"name"`
+	Prefix     string     `db:"prefix" json:"prefix"`
+	Key        string     `json:"key,omitempty"`
+	Scope      string     `db:"scope" json:"scope"`
+	ExpiresAt  *time.Time `db:"expires_at" json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `db:"last_used_at" json:"last_used_at,omitempty"`
+	ReplacedBy *int64     `db:"replaced_by" json:"replaced_by,omitempty"`
+	RevokedAt  *time.Time `db:"revoked_at" json:"revoked_at,omitempty"`
+	RevokedBy  string     `db:"revoked_by" json:"revoked_by,omitempty"`
+	CreatedBy  string     `db:"created_by" json:"created_by,omitempty"`
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+}
+
+// Scopes of an API key. An ingest key only uploads records and follows the
+// jobs loading them; a full key acts as an operator.
+const (
+	APIKeyScopeIngest = "ingest"
+	APIKeyScopeFull   = "full"
 )
@@ -0,0 +1,199 @@
+// Package money holds monetary amounts as a whole number of hundredths, the
+// precision of the DECIMAL(15,2) amount columns, so sums and differences are
+// exact and never pick up binary floating point noise.
+package money
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Amount is a signed amount in hundredths of the currency unit
+type Amount int64
+
+// Scale is the number of hundredths in one currency unit
+const Scale = 100
+
+// Parse reads a decimal amount such as "1234.5", "-0.01" or "+12". Digits
+// beyond the second decimal place are rounded half away from zero, as MySQL
+// does when storing into a DECIMAL(15,2) column.
+func Parse(value string) (Amount, error) {
+	s := strings.TrimSpace(value)
+	negative := false
+	switch {
+	case strings.HasPrefix(s, "-"):
+		negative = true
+		s = s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+
+	whole, fraction, _ := strings.Cut(s, ".")
+	if whole == "" && fraction == "" {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+	if !digits(whole) || !digits(fraction) {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+	if whole == "" {
+		whole = "0"
+	}
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || units > math.MaxInt64/Scale-1 {
+		return 0, fmt.Errorf("amount %q out of range", value)
+	}
+	units *= Scale
+
+	fraction += "00"
+	cents, _ := strconv.ParseInt(fraction[:2], 10, 64)
+	units += cents
+	if len(fraction) > 2 && fraction[2] >= '5' {
+		units++
+	}
+
+	if negative {
+		units = -units
+	}
+	return Amount(units), nil
+}
+
+func digits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// FromFloat converts a float amount, rounding to the nearest hundredth
+func FromFloat(f float64) Amount {
+	return Amount(math.Round(f * Scale))
+}
+
+// FromUnits converts a whole number of currency units
+func FromUnits(units int64) Amount {
+	return Amount(units * Scale)
+}
+
+// Float64 returns the amount as a float, for display and ratios only
+func (a Amount) Float64() float64 {
+	return float64(a) / Scale
+}
+
+// Abs returns the absolute value of the amount
+func (a Amount) Abs() Amount {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+// BasisPoints returns the given share of the amount in hundredths of a
+// percent, truncated toward zero
+func (a Amount) BasisPoints(bp int64) Amount {
+	return a * Amount(bp) / 10000
+}
+
+// String renders the amount with exactly two decimals, e.g. -1234.50
+func (a Amount) String() string {
+	units := int64(a)
+	sign := ""
+	if units < 0 {
+		sign = "-"
+		units = -units
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, units/Scale, units%Scale)
+}
+
+// MarshalJSON writes the amount as a JSON number with two decimals
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON reads a JSON number or a numeric string without going
+// through float64
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	parsed, err := parseJSONNumber(s)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// parseJSONNumber accepts the exponent form JSON allows, e.g. 1.5e3, by
+// shifting the decimal point before parsing
+func parseJSONNumber(s string) (Amount, error) {
+	mantissa, exponent, found := strings.Cut(strings.ToLower(s), "e")
+	if !found {
+		return Parse(s)
+	}
+	exp, err := strconv.Atoi(exponent)
+	if err != nil || exp < -20 || exp > 20 {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+
+	sign := ""
+	if strings.HasPrefix(mantissa, "-") || strings.HasPrefix(mantissa, "+") {
+		sign, mantissa = mantissa[:1], mantissa[1:]
+	}
+	whole, fraction, _ := strings.Cut(mantissa, ".")
+	number := whole + fraction
+	point := len(whole) + exp
+	switch {
+	case point <= 0:
+		number = strings.Repeat("0", 1-point) + number
+		point = 1
+	case point > len(number):
+		number += strings.Repeat("0", point-len(number))
+	}
+	return Parse(sign + number[:point] + "." + number[point:])
+}
+
+// Scan reads a DECIMAL column, which the MySQL driver returns as text
+func (a *Amount) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*a = 0
+		return nil
+	case []byte:
+		parsed, err := Parse(string(v))
+		if err != nil {
+			return err
+		}
+		*a = parsed
+		return nil
+	case string:
+		parsed, err := Parse(v)
+		if err != nil {
+			return err
+		}
+		*a = parsed
+		return nil
+	case int64:
+		*a = FromUnits(v)
+		return nil
+	case float64:
+		*a = FromFloat(v)
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into money.Amount", src)
+	}
+}
+
+// Value stores the amount as decimal text so the column gets it exactly
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
@@ -0,0 +1,164 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Amount
+		err   bool
+	}{
+		{value: "0", want: 0},
+		{value: "1234.5", want: 123450},
+		{value: "-0.01", want: -1},
+		{value: "+12", want: 1200},
+		{value: ".5", want: 50},
+		{value: "0.005", want: 1},
+		{value: "-0.005", want: -1},
+		{value: "0.004", want: 0},
+		{value: "19.999", want: 2000},
+		{value: " 7.10 ", want: 710},
+		{value: "", err: true},
+		{value: ".", err: true},
+		{value: "1,50", err: true},
+		{value: "1e3", err: true},
+		{value: "abc", err: true},
+		{value: "99999999999999999999", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := Parse(tt.value)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("Parse(%q) = %v, want an error", tt.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.value, err)
+			}
+			if got != tt.want {
+				t.Errorf("Parse(%q) = %d, want %d", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestArithmeticIsExact(t *testing.T) {
+	// 0.1 + 0.2 and 100.00 - 99.99 pick up noise as float64
+	a, _ := Parse("0.1")
+	b, _ := Parse("0.2")
+	if got := (a + b).String(); got != "0.30" {
+		t.Errorf("0.1 + 0.2 = %s, want 0.30", got)
+	}
+	c, _ := Parse("100.00")
+	d, _ := Parse("99.99")
+	if got := (c - d).String(); got != "0.01" {
+		t.Errorf("100.00 - 99.99 = %s, want 0.01", got)
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		amount Amount
+		want   string
+	}{
+		{0, "0.00"},
+		{1, "0.01"},
+		{-1, "-0.01"},
+		{123450, "1234.50"},
+		{-123456, "-1234.56"},
+	}
+	for _, tt := range tests {
+		if got := tt.amount.String(); got != tt.want {
+			t.Errorf("Amount(%d).String() = %q, want %q", tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestBasisPoints(t *testing.T) {
+	tests := []struct {
+		amount Amount
+		bp     int64
+		want   Amount
+	}{
+		{10000, 100, 100},
+		{12345, 100, 123},
+		{-12345, 100, -123},
+		{99, 100, 0},
+		{10000, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.amount.BasisPoints(tt.bp); got != tt.want {
+			t.Errorf("Amount(%d).BasisPoints(%d) = %d, want %d", tt.amount, tt.bp, got, tt.want)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	tests := []struct {
+		json string
+		want Amount
+		err  bool
+	}{
+		{json: `12.34`, want: 1234},
+		{json: `"12.34"`, want: 1234},
+		{json: `1.5e3`, want: 150000},
+		{json: `-2.5E-1`, want: -25},
+		{json: `0.1`, want: 10},
+		{json: `"twelve"`, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.json, func(t *testing.T) {
+			var got Amount
+			err := json.Unmarshal([]byte(tt.json), &got)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("Unmarshal(%s) = %v, want an error", tt.json, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unmarshal(%s): %v", tt.json, err)
+			}
+			if got != tt.want {
+				t.Errorf("Unmarshal(%s) = %d, want %d", tt.json, got, tt.want)
+			}
+		})
+	}
+
+	out, err := json.Marshal(struct {
+		Amount Amount `json:"amount"`
+	}{Amount: -5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != `{"amount":-0.05}` {
+		t.Errorf("Marshal = %s, want {\"amount\":-0.05}", out)
+	}
+}
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		src  interface{}
+		want Amount
+	}{
+		{[]byte("1234.56"), 123456},
+		{"-0.10", -10},
+		{int64(3), 300},
+		{float64(0.1) + float64(0.2), 30},
+		{nil, 0},
+	}
+	for _, tt := range tests {
+		var got Amount = 99
+		if err := got.Scan(tt.src); err != nil {
+			t.Fatalf("Scan(%v): %v", tt.src, err)
+		}
+		if got != tt.want {
+			t.Errorf("Scan(%v) = %d, want %d", tt.src, got, tt.want)
+		}
+	}
+}
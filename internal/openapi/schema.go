@@ -0,0 +1,178 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+
+	"reconciliation-service/internal/money"
+)
+
+var (
+	amountType      = reflect.TypeOf(money.Amount(0))
+	timeType        = reflect.TypeOf(time.Time{})
+	rawType         = reflect.TypeOf(json.RawMessage(nil))
+	bytesType       = reflect.TypeOf([]byte(nil))
+	anyType         = reflect.TypeOf((*interface{})(nil)).Elem()
+	componentPrefix = "#/components/schemas/"
+)
+
+// Schemas derives schemas from Go values the way encoding/json encodes
+// them. Named struct types become components, referenced wherever they are
+// used; anonymous ones are inlined.
+type Schemas struct {
+	components map[string]*Schema
+	names      map[reflect.Type]string
+}
+
+func NewSchemas() *Schemas {
+	return &Schemas{
+		components: make(map[string]*Schema),
+		names:      make(map[reflect.Type]string),
+	}
+}
+
+// Components returns the component schemas derived so far
+func (s *Schemas) Components() map[string]*Schema {
+	return s.components
+}
+
+// Of returns the schema of the JSON encoding of v, nil for a nil v
+func (s *Schemas) Of(v interface{}) *Schema {
+	if v == nil {
+		return nil
+	}
+	return s.schema(reflect.TypeOf(v))
+}
+
+func (s *Schemas) schema(t reflect.Type) *Schema {
+	switch t {
+	case amountType:
+		return &Schema{Type: "number", Format: "double", Description: "Amount with two decimal places"}
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case rawType, anyType:
+		return &Schema{}
+	case bytesType:
+		return &Schema{Type: "string", Format: "byte"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := s.schema(t.Elem())
+		if schema.Ref == "" {
+			schema.Nullable = true
+		}
+		return schema
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: s.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		return &Schema{Ref: componentPrefix + s.component(t)}
+	}
+	return &Schema{}
+}
+
+// component registers a named struct type once and returns its component
+// name: the type name with its first letter upper cased, prefixed with the
+// package name when another package already took it
+func (s *Schemas) component(t reflect.Type) string {
+	if name, ok := s.names[t]; ok {
+		return name
+	}
+	name := exported(t.Name())
+	if _, taken := s.components[name]; taken {
+		pkg := t.PkgPath()
+		name = exported(pkg[strings.LastIndex(pkg, "/")+1:]) + name
+	}
+	s.names[t] = name
+	// Registered before its fields are derived so recursive types terminate
+	s.components[name] = &Schema{}
+	*s.components[name] = *s.object(t)
+	return name
+}
+
+// object derives the properties of a struct, flattening embedded structs as
+// encoding/json does
+func (s *Schemas) object(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, ok := jsonName(field)
+		if !ok {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				for property, fieldSchema := range s.object(embedded).Properties {
+					if _, ok := schema.Properties[property]; !ok {
+						schema.Properties[property] = fieldSchema
+					}
+				}
+				continue
+			}
+			name = field.Name
+		}
+		if name == "" {
+			name = field.Name
+		}
+		schema.Properties[name] = s.schema(field.Type)
+	}
+	return schema
+}
+
+// jsonName returns the name a field is encoded under, empty for an untagged
+// field, and false for a field encoding/json leaves out
+func jsonName(field reflect.StructField) (string, bool) {
+	if !field.IsExported() && !field.Anonymous {
+		return "", false
+	}
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	return name, true
+}
+
+func exported(name string) string {
+	for i, r := range name {
+		return string(unicode.ToUpper(r)) + name[i+len(string(r)):]
+	}
+	return name
+}
+
+// Fields returns a value of an anonymous struct encoding as an object of the
+// given name and value pairs, to describe bodies built from maps
+func Fields(pairs ...interface{}) interface{} {
+	fields := make([]reflect.StructField, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		fields = append(fields, reflect.StructField{
+			Name: fmt.Sprintf("Field%d", i/2),
+			Type: reflect.TypeOf(pairs[i+1]),
+			Tag:  reflect.StructTag(fmt.Sprintf(`json:"%s"`, pairs[i])),
+		})
+	}
+	return reflect.New(reflect.StructOf(fields)).Elem().Interface()
+}
@@ -0,0 +1,65 @@
+// Package pagination hands out the opaque cursors list endpoints page with.
+// A cursor holds the sort key of the last row of a page, so the next page
+// starts right after it however many rows were added or removed meanwhile.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// ErrInvalidCursor rejects a cursor that was not handed out by the list it
+// is sent to
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is the sort key of a row: its ID, and the date for lists ordered
+// by a date before the ID
+type Cursor struct {
+	List string `json:"l"`
+	ID   int64  `json:"i"`
+	Date string `json:"d,omitempty"`
+}
+
+// Encode returns the cursor as an opaque token
+func (c Cursor) Encode() string {
+	encoded, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+// Decode reads a token handed out by list. An empty token is the start of
+// the list and decodes to nil.
+func Decode(token, list string) (*Cursor, error) {
+	if token == "" {
+		return nil, nil
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	cursor := &Cursor{}
+	if err := json.Unmarshal(decoded, cursor); err != nil || cursor.List != list || cursor.ID <= 0 {
+		return nil, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+// Key returns the date and ID of the row the cursor is at, empty and zero
+// for the start of the list
+func (c *Cursor) Key() (string, int64) {
+	if c == nil {
+		return "", 0
+	}
+	return c.Date, c.ID
+}
+
+// Next cuts rows, read one past limit, to the page and returns the token of
+// the page after it, empty when the list ends with this page. key gives the
+// cursor of a row.
+func Next[T any](rows []T, limit int, key func(T) Cursor) ([]T, string) {
+	if len(rows) <= limit {
+		return rows, ""
+	}
+	rows = rows[:limit]
+	return rows, key(rows[limit-1]).Encode()
+}
@@ -0,0 +1,165 @@
+// Package pdf writes plain text documents as PDF: lines of a monospaced font
+// on landscape A4 pages, for fixed layouts meant to be printed and filed.
+// The same text always writes the same bytes, so a document can be
+// checksummed.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// Columns is how many characters fit on a line
+	Columns = 180
+
+	pageWidth  = 842
+	pageHeight = 595
+	margin     = 36
+	fontSize   = 7
+	leading    = 9
+
+	// linesPerPage counts every line of a page, its footer included
+	linesPerPage = (pageHeight - 2*margin) / leading
+)
+
+// Document collects the lines of a document, which are laid out on pages
+// when it is written
+type Document struct {
+	title  string
+	header []string
+	lines  []string
+}
+
+// New starts a document whose footer and metadata carry title
+func New(title string) *Document {
+	return &Document{title: title}
+}
+
+// SetHeader sets the lines repeated at the top of every page
+func (d *Document) SetHeader(lines ...string) {
+	d.header = lines
+}
+
+// Line adds a line; longer lines than Columns are cut
+func (d *Document) Line(line string) {
+	d.lines = append(d.lines, line)
+}
+
+// Lines adds several lines
+func (d *Document) Lines(lines ...string) {
+	d.lines = append(d.lines, lines...)
+}
+
+// pages splits the lines into pages, each starting with the header and
+// ending with a footer numbering it
+func (d *Document) pages() [][]string {
+	// A blank line and the footer close each page
+	body := linesPerPage - len(d.header) - 2
+	if body < 1 {
+		body = 1
+	}
+	count := (len(d.lines) + body - 1) / body
+	if count == 0 {
+		count = 1
+	}
+
+	pages := make([][]string, 0, count)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * body
+		if end > len(d.lines) {
+			end = len(d.lines)
+		}
+		page := append([]string{}, d.header...)
+		page = append(page, d.lines[i*body:end]...)
+		for len(page) < linesPerPage-1 {
+			page = append(page, "")
+		}
+		footer := fmt.Sprintf("Page %d of %d", i+1, count)
+		page = append(page, d.title+strings.Repeat(" ", max(1, Columns-len(d.title)-len(footer)))+footer)
+		pages = append(pages, page)
+	}
+	return pages
+}
+
+// WriteTo writes the document as a PDF
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	pages := d.pages()
+
+	// Objects 1 to 4 are the catalog, the page tree, the font and the
+	// document information; each page adds itself and its content stream
+	var objects []string
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Title (%s) /Producer (reconciliation-service) >>", escape(d.title)),
+	)
+	for i, page := range pages {
+		var content strings.Builder
+		fmt.Fprintf(&content, "BT\n/F1 %d Tf\n%d TL\n%d %d Td\n", fontSize, leading, margin, pageHeight-margin-fontSize)
+		for _, line := range page {
+			fmt.Fprintf(&content, "(%s) Tj T*\n", escape(line))
+		}
+		content.WriteString("ET")
+
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+				pageWidth, pageHeight, 6+2*i),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()),
+		)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info 4 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	n, err := w.Write(buf.Bytes())
+	return int64(n), err
+}
+
+// Bytes returns the document as a PDF
+func (d *Document) Bytes() []byte {
+	var buf bytes.Buffer
+	d.WriteTo(&buf)
+	return buf.Bytes()
+}
+
+// escape makes line a PDF string of at most Columns characters the font
+// can show; characters outside printable ASCII become question marks
+func escape(line string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range line {
+		if n == Columns {
+			break
+		}
+		n++
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r > 0x7e:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,285 @@
+package reports
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	SourceMatches             = "matches"
+	SourceUnmatchedBank       = "unmatched_bank"
+	SourceUnmatchedAccounting = "unmatched_accounting"
+	SourceAudits              = "audits"
+	SourceBatchDeltas         = "batch_deltas"
+	SourceBatchKPIs           = "batch_kpis"
+)
+
+const maxRowLimit = 100000
+
+type Filter struct {
+	Field string      `json:"field"`
+	Op    string      `json:"op"`
+	Value interface{} `json:"value"`
+}
+
+type Aggregate struct {
+	Func  string `json:"func"`
+	Field string `json:"field,omitempty"`
+	As    string `json:"as,omitempty"`
+}
+
+type OrderBy struct {
+	Field string `json:"field"`
+	Desc  bool   `json:"desc,omitempty"`
+}
+
+// Definition describes a report: which fields of a source to return, how to
+// filter, group and aggregate them. Field names are resolved against a fixed
+// per-source whitelist, never interpolated from user input.
+type Definition struct {
+	Fields     []string    `json:"fields,omitempty"`
+	Filters    []Filter    `json:"filters,omitempty"`
+	GroupBy    []string    `json:"group_by,omitempty"`
+	Aggregates []Aggregate `json:"aggregates,omitempty"`
+	OrderBy    []OrderBy   `json:"order_by,omitempty"`
+	Limit      int         `json:"limit,omitempty"`
+}
+
+var aliasPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+var aggregateFuncs = map[string]string{
+	"count": "COUNT",
+	"sum":   "SUM",
+	"avg":   "AVG",
+	"min":   "MIN",
+	"max":   "MAX",
+}
+
+var filterOps = map[string]string{
+	"eq":   "=",
+	"ne":   "<>",
+	"gt":   ">",
+	"gte":  ">=",
+	"lt":   "<",
+	"lte":  "<=",
+	"like": "LIKE",
+	"in":   "IN",
+}
+
+// Validate checks the definition against the source schema
+func (d *Definition) Validate(source string) error {
+	schema, ok := schemas[source]
+	if !ok {
+		return fmt.Errorf("unknown source %q", source)
+	}
+
+	for _, f := range d.Fields {
+		if _, ok := schema.fields[f]; !ok {
+			return fmt.Errorf("unknown field %q for source %s", f, source)
+		}
+	}
+	for _, f := range d.GroupBy {
+		if _, ok := schema.fields[f]; !ok {
+			return fmt.Errorf("unknown group_by field %q for source %s", f, source)
+		}
+	}
+	if d.grouped() {
+		for _, f := range d.Fields {
+			if !contains(d.GroupBy, f) {
+				return fmt.Errorf("field %q must be part of group_by when aggregating", f)
+			}
+		}
+	}
+
+	aliases := make(map[string]bool)
+	for _, a := range d.Aggregates {
+		if _, ok := aggregateFuncs[a.Func]; !ok {
+			return fmt.Errorf("unknown aggregate function %q", a.Func)
+		}
+		if a.Field == "" && a.Func != "count" {
+			return fmt.Errorf("aggregate %s requires a field", a.Func)
+		}
+		if a.Field != "" {
+			field, ok := schema.fields[a.Field]
+			if !ok {
+				return fmt.Errorf("unknown aggregate field %q for source %s", a.Field, source)
+			}
+			if a.Func != "count" && a.Func != "min" && a.Func != "max" && !field.numeric() {
+				return fmt.Errorf("aggregate %s requires a numeric field", a.Func)
+			}
+		}
+		alias := a.alias()
+		if !aliasPattern.MatchString(alias) {
+			return fmt.Errorf("invalid aggregate alias %q", alias)
+		}
+		aliases[alias] = true
+	}
+
+	for _, f := range d.Filters {
+		if _, ok := schema.fields[f.Field]; !ok {
+			return fmt.Errorf("unknown filter field %q for source %s", f.Field, source)
+		}
+		if _, ok := filterOps[f.Op]; !ok {
+			return fmt.Errorf("unknown filter operator %q", f.Op)
+		}
+		if f.Op == "in" {
+			if values, ok := f.Value.([]interface{}); !ok || len(values) == 0 {
+				return fmt.Errorf("filter %q with op in requires a non-empty list", f.Field)
+			}
+		}
+	}
+
+	for _, o := range d.OrderBy {
+		_, isField := schema.fields[o.Field]
+		if !isField && !aliases[o.Field] {
+			return fmt.Errorf("unknown order_by field %q", o.Field)
+		}
+		if d.grouped() && isField && !contains(d.GroupBy, o.Field) {
+			return fmt.Errorf("order_by field %q must be part of group_by when aggregating", o.Field)
+		}
+	}
+
+	if d.Limit < 0 || d.Limit > maxRowLimit {
+		return fmt.Errorf("limit must be between 0 and %d", maxRowLimit)
+	}
+	return nil
+}
+
+func (d *Definition) grouped() bool {
+	return len(d.GroupBy) > 0 || len(d.Aggregates) > 0
+}
+
+func (a Aggregate) alias() string {
+	if a.As != "" {
+		return a.As
+	}
+	if a.Field == "" {
+		return a.Func
+	}
+	return a.Func + "_" + a.Field
+}
+
+// BuildQuery renders the definition as SQL over the records of a tenant for
+// the given period. The definition must have been validated.
+func (d *Definition) BuildQuery(source, tenant, fromDate, toDate string) (string, []interface{}, []string) {
+	schema := schemas[source]
+
+	var selects, columns []string
+	if d.grouped() {
+		for _, f := range d.GroupBy {
+			selects = append(selects, schema.fields[f].expr+" AS "+f)
+			columns = append(columns, f)
+		}
+		for _, a := range d.Aggregates {
+			expr := "*"
+			if a.Field != "" {
+				expr = schema.fields[a.Field].expr
+			}
+			selects = append(selects, aggregateFuncs[a.Func]+"("+expr+") AS "+a.alias())
+			columns = append(columns, a.alias())
+		}
+	} else {
+		fields := d.Fields
+		if len(fields) == 0 {
+			fields = schema.defaultFields
+		}
+		for _, f := range fields {
+			selects = append(selects, schema.fields[f].expr+" AS "+f)
+			columns = append(columns, f)
+		}
+	}
+
+	query := "SELECT " + strings.Join(selects, ", ") + " " + schema.from
+	conditions := append([]string{schema.tenant + " = ?"}, schema.conditions...)
+	args := []interface{}{tenant}
+	if fromDate != "" && toDate != "" {
+		conditions = append(conditions, schema.dateExpr+" BETWEEN ? AND ?")
+		args = append(args, fromDate, toDate)
+	}
+	for _, f := range d.Filters {
+		expr := schema.fields[f.Field].expr
+		if f.Op == "in" {
+			values := f.Value.([]interface{})
+			conditions = append(conditions, expr+" IN ("+strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")+")")
+			args = append(args, values...)
+			continue
+		}
+		conditions = append(conditions, expr+" "+filterOps[f.Op]+" ?")
+		args = append(args, f.Value)
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	if len(d.GroupBy) > 0 {
+		var groups []string
+		for _, f := range d.GroupBy {
+			groups = append(groups, schema.fields[f].expr)
+		}
+		query += " GROUP BY " + strings.Join(groups, ", ")
+	}
+
+	if len(d.OrderBy) > 0 {
+		var orders []string
+		for _, o := range d.OrderBy {
+			order := o.Field
+			if o.Desc {
+				order += " DESC"
+			}
+			orders = append(orders, order)
+		}
+		query += " ORDER BY " + strings.Join(orders, ", ")
+	}
+
+	limit := d.Limit
+	if limit == 0 {
+		limit = maxRowLimit
+	}
+	query += " LIMIT ?"
+	args = append(args, limit)
+
+	return query, args, columns
+}
+
+// AmountColumns lists the result columns holding money: amount fields and
+// their sum, avg, min and max aggregates. The definition must have been
+// validated.
+func (d *Definition) AmountColumns(source string) []string {
+	schema := schemas[source]
+
+	var columns []string
+	if d.grouped() {
+		for _, f := range d.GroupBy {
+			if schema.fields[f].kind == kindAmount {
+				columns = append(columns, f)
+			}
+		}
+		for _, a := range d.Aggregates {
+			if a.Func != "count" && schema.fields[a.Field].kind == kindAmount {
+				columns = append(columns, a.alias())
+			}
+		}
+		return columns
+	}
+
+	fields := d.Fields
+	if len(fields) == 0 {
+		fields = schema.defaultFields
+	}
+	for _, f := range fields {
+		if schema.fields[f].kind == kindAmount {
+			columns = append(columns, f)
+		}
+	}
+	return columns
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,172 @@
+package reports
+
+import "sort"
+
+const (
+	kindString = "string"
+	kindNumber = "number"
+	kindAmount = "amount"
+	kindDate   = "date"
+)
+
+type field struct {
+	expr string
+	kind string
+}
+
+func (f field) numeric() bool {
+	return f.kind == kindNumber || f.kind == kindAmount
+}
+
+type schema struct {
+	from string
+	// tenant is the tenant column of the source's records
+	tenant        string
+	conditions    []string
+	dateExpr      string
+	fields        map[string]field
+	defaultFields []string
+}
+
+var schemas = map[string]schema{
+	SourceMatches: {
+		from: `FROM reconciliation_mappings rm
+			JOIN reconciliations r ON r.id = rm.reconciliation_id
+			LEFT JOIN bank_transactions bt ON bt.id = rm.bank_transaction_id
+			LEFT JOIN accounting_entries ae ON ae.id = rm.accounting_entry_id
+			LEFT JOIN counterparties cp ON cp.id = COALESCE(bt.counterparty_id, ae.counterparty_id)`,
+		tenant:   "r.tenant_id",
+		dateExpr: "bt.transaction_date",
+		fields: map[string]field{
+			"batch_id":          {"r.reconciliation_batch_id", kindString},
+			"status":            {"r.status", kindString},
+			"match_confidence":  {"r.match_confidence", kindNumber},
+			"amount_difference": {"r.amount_difference", kindAmount},
+			"mapping_type":      {"rm.mapping_type", kindString},
+			"transaction_id":    {"bt.transaction_id", kindString},
+			"account_number":    {"bt.account_number", kindString},
+			"bank_amount":       {"bt.amount", kindAmount},
+			"bank_currency":     {"bt.currency", kindString},
+			"transaction_date":  {"bt.transaction_date", kindDate},
+			"entry_id":          {"ae.entry_id", kindString},
+			"account_code":      {"ae.account_code", kindString},
+			"accounting_amount": {"ae.amount", kindAmount},
+			"entry_currency":    {"ae.currency", kindString},
+			"entry_date":        {"ae.entry_date", kindDate},
+			"matched_at":        {"r.created_at", kindDate},
+			"counterparty":      {"cp.code", kindString},
+		},
+		defaultFields: []string{"batch_id", "status", "match_confidence", "transaction_id", "bank_amount", "entry_id", "accounting_amount"},
+	},
+	SourceUnmatchedBank: {
+		from: `FROM bank_transactions bt
+			LEFT JOIN reconciliation_mappings rm ON bt.id = rm.bank_transaction_id
+			LEFT JOIN counterparties cp ON cp.id = bt.counterparty_id`,
+		tenant:     "bt.tenant_id",
+		conditions: []string{"rm.id IS NULL"},
+		dateExpr:   "bt.transaction_date",
+		fields: map[string]field{
+			"transaction_id":          {"bt.transaction_id", kindString},
+			"account_number":          {"bt.account_number", kindString},
+			"amount":                  {"bt.amount", kindAmount},
+			"currency":                {"bt.currency", kindString},
+			"transaction_date":        {"bt.transaction_date", kindDate},
+			"description":             {"bt.description", kindString},
+			"reference_number":        {"bt.reference_number", kindString},
+			"counterparty_iban":       {"bt.counterparty_iban", kindString},
+			"end_to_end_id":           {"bt.end_to_end_id", kindString},
+			"external_correlation_id": {"bt.external_correlation_id", kindString},
+			"counterparty":            {"cp.code", kindString},
+		},
+		defaultFields: []string{"transaction_id", "account_number", "amount", "transaction_date", "reference_number"},
+	},
+	SourceUnmatchedAccounting: {
+		from: `FROM accounting_entries ae
+			LEFT JOIN reconciliation_mappings rm ON ae.id = rm.accounting_entry_id
+			LEFT JOIN counterparties cp ON cp.id = ae.counterparty_id`,
+		tenant:     "ae.tenant_id",
+		conditions: []string{"rm.id IS NULL"},
+		dateExpr:   "ae.entry_date",
+		fields: map[string]field{
+			"entry_id":                {"ae.entry_id", kindString},
+			"account_code":            {"ae.account_code", kindString},
+			"amount":                  {"ae.amount", kindAmount},
+			"currency":                {"ae.currency", kindString},
+			"entry_date":              {"ae.entry_date", kindDate},
+			"description":             {"ae.description", kindString},
+			"invoice_number":          {"ae.invoice_number", kindString},
+			"end_to_end_id":           {"ae.end_to_end_id", kindString},
+			"external_correlation_id": {"ae.external_correlation_id", kindString},
+			"counterparty":            {"cp.code", kindString},
+		},
+		defaultFields: []string{"entry_id", "account_code", "amount", "entry_date", "invoice_number"},
+	},
+	SourceAudits: {
+		from: `FROM reconciliation_audit a
+			JOIN reconciliations r ON r.id = a.reconciliation_id`,
+		tenant:   "a.tenant_id",
+		dateExpr: "DATE(a.created_at)",
+		fields: map[string]field{
+			"reconciliation_id": {"a.reconciliation_id", kindNumber},
+			"batch_id":          {"r.reconciliation_batch_id", kindString},
+			"action":            {"a.action", kindString},
+			"user_id":           {"a.user_id", kindString},
+			"details":           {"a.details", kindString},
+			"created_at":        {"a.created_at", kindDate},
+		},
+		defaultFields: []string{"batch_id", "action", "user_id", "created_at"},
+	},
+	SourceBatchDeltas: {
+		from:     `FROM reconciliation_batch_deltas d`,
+		tenant:   "d.tenant_id",
+		dateExpr: "DATE(d.created_at)",
+		fields: map[string]field{
+			"batch_id":       {"d.reconciliation_batch_id", kindString},
+			"action":         {"d.action", kindString},
+			"user_id":        {"d.user_id", kindString},
+			"changes":        {"d.changes", kindString},
+			"summary_before": {"d.summary_before", kindString},
+			"summary_after":  {"d.summary_after", kindString},
+			"created_at":     {"d.created_at", kindDate},
+		},
+		defaultFields: []string{"batch_id", "action", "user_id", "summary_before", "summary_after", "created_at"},
+	},
+	SourceBatchKPIs: {
+		from:     `FROM batch_kpis k`,
+		tenant:   "k.tenant_id",
+		dateExpr: "DATE(k.created_at)",
+		fields: map[string]field{
+			"batch_id":   {"k.reconciliation_batch_id", kindString},
+			"tenant":     {"k.tenant", kindString},
+			"name":       {"k.name", kindString},
+			"label":      {"k.label", kindString},
+			"expression": {"k.expression", kindString},
+			"value":      {"k.value", kindNumber},
+			"created_at": {"k.created_at", kindDate},
+		},
+		defaultFields: []string{"batch_id", "name", "label", "value", "created_at"},
+	},
+}
+
+// SourceFields lists the selectable fields of a source with their types
+func SourceFields(source string) map[string]string {
+	s, ok := schemas[source]
+	if !ok {
+		return nil
+	}
+	fields := make(map[string]string, len(s.fields))
+	for name, f := range s.fields {
+		fields[name] = f.kind
+	}
+	return fields
+}
+
+// Sources lists the report sources
+func Sources() []string {
+	var sources []string
+	for name := range schemas {
+		sources = append(sources, name)
+	}
+	sort.Strings(sources)
+	return sources
+}
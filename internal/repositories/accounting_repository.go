@@ -1,44 +1,117 @@
 package repositories
 
 import (
+	"context"
 	"database/sql"
-	"errors"
 	"time"
 
 	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/money"
 )
 
 type AccountingRepository interface {
 	InsertAccountingEntry(tx *sql.Tx, ae *models.AccountingEntry) error
 	GetAccountingEntryByID(id int64) (*models.AccountingEntry, error)
 	GetAccountingEntryByEntryID(entryID string) (*models.AccountingEntry, error)
-	GetUnreconciledEntries(fromDate, toDate string) ([]*models.AccountingEntry, error)
-	GetEntriesByAmount(amount float64, fromDate, toDate string) ([]*models.AccountingEntry, error)
+	GetAccountingEntriesByCorrelationID(correlationID string) ([]*models.AccountingEntry, error)
+	GetUnreconciledEntries(ctx context.Context, fromDate, toDate string) ([]*models.AccountingEntry, error)
+	GetEntriesByAmount(amount money.Amount, fromDate, toDate string) ([]*models.AccountingEntry, error)
 	UpdateAccountingEntry(tx *sql.Tx, ae *models.AccountingEntry) error
+	VoidAccountingEntry(tx *sql.Tx, ae *models.AccountingEntry) error
 }
 
 type accountingRepository struct {
-	db *sql.DB
+	db     *sql.DB
+	tenant string
 }
 
-func NewAccountingRepository(db *sql.DB) AccountingRepository {
-	return &accountingRepository{db: db}
+// NewAccountingRepository reads and writes the accounting entries of one
+// tenant
+func NewAccountingRepository(db *sql.DB, tenant string) AccountingRepository {
+	return &accountingRepository{db: db, tenant: tenant}
+}
+
+const accountingEntryColumns = `
+		ae.id, ae.entry_id, ae.account_code, ae.amount, ae.currency,
+		ae.entry_date, ae.description, ae.invoice_number, ae.entry_type,
+		ae.counterparty_iban, ae.counterparty_id, ae.creditor_reference, ae.end_to_end_id,
+		ae.external_correlation_id, ae.voided_at, ae.void_reason, ae.voided_by,
+		ae.open_amount, ae.version, ae.created_at, ae.updated_at`
+
+func scanAccountingEntry(row rowScanner) (*models.AccountingEntry, error) {
+	ae := &models.AccountingEntry{}
+	var counterpartyID sql.NullInt64
+	err := row.Scan(
+		&ae.ID,
+		&ae.EntryID,
+		&ae.AccountCode,
+		&ae.Amount,
+		&ae.Currency,
+		&ae.EntryDate,
+		&ae.Description,
+		&ae.InvoiceNumber,
+		&ae.EntryType,
+		&ae.CounterpartyIBAN,
+		&counterpartyID,
+		&ae.CreditorReference,
+		&ae.EndToEndID,
+		&ae.ExternalCorrelationID,
+		&ae.VoidedAt,
+		&ae.VoidReason,
+		&ae.VoidedBy,
+		&ae.OpenAmount,
+		&ae.Version,
+		&ae.CreatedAt,
+		&ae.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	ae.CounterpartyID = counterpartyID.Int64
+	return ae, nil
+}
+
+func scanAccountingEntries(rows *sql.Rows) ([]*models.AccountingEntry, error) {
+	defer rows.Close()
+
+	var entries []*models.AccountingEntry
+	for rows.Next() {
+		ae, err := scanAccountingEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, ae)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
 }
 
 func (r *accountingRepository) InsertAccountingEntry(tx *sql.Tx, ae *models.AccountingEntry) error {
 	query := `
 		INSERT INTO accounting_entries (
-			entry_id, account_code, amount,
-			entry_date, description, invoice_number
-		) VALUES (?, ?, ?, ?, ?, ?)
+			tenant_id, entry_id, account_code, amount, currency,
+			entry_date, description, invoice_number, entry_type,
+			counterparty_iban, counterparty_id, creditor_reference, end_to_end_id,
+			external_correlation_id
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 	result, err := tx.Exec(query,
+		r.tenant,
 		ae.EntryID,
 		ae.AccountCode,
 		ae.Amount,
+		ae.Currency,
 		ae.EntryDate,
 		ae.Description,
 		ae.InvoiceNumber,
+		ae.EntryType,
+		ae.CounterpartyIBAN,
+		nullableID(ae.CounterpartyID),
+		ae.CreditorReference,
+		ae.EndToEndID,
+		ae.ExternalCorrelationID,
 	)
 	if err != nil {
 		return err
@@ -53,27 +126,14 @@ func (r *accountingRepository) InsertAccountingEntry(tx *sql.Tx, ae *models.Acco
 }
 
 func (r *accountingRepository) GetAccountingEntryByID(id int64) (*models.AccountingEntry, error) {
-	ae := &models.AccountingEntry{}
 	query := `
-		SELECT id, entry_id, account_code, amount,
-		       entry_date, description, invoice_number,
-		       created_at, updated_at
-		FROM accounting_entries
-		WHERE id = ?
+		SELECT ` + accountingEntryColumns + `
+		FROM accounting_entries ae
+		WHERE ae.id = ? AND ae.tenant_id = ?
 	`
-	err := r.db.QueryRow(query, id).Scan(
-		&ae.ID,
-		&ae.EntryID,
-		&ae.AccountCode,
-		&ae.Amount,
-		&ae.EntryDate,
-		&ae.Description,
-		&ae.InvoiceNumber,
-		&ae.CreatedAt,
-		&ae.UpdatedAt,
-	)
+	ae, err := scanAccountingEntry(r.db.QueryRow(query, id, r.tenant))
 	if err == sql.ErrNoRows {
-		return nil, errors.New("accounting entry not found")
+		return nil, ErrAccountingEntryNotFound
 	}
 	if err != nil {
 		return nil, err
@@ -81,28 +141,31 @@ func (r *accountingRepository) GetAccountingEntryByID(id int64) (*models.Account
 	return ae, nil
 }
 
+// GetAccountingEntriesByCorrelationID lists the entries carrying an upstream
+// payment ID, oldest first
+func (r *accountingRepository) GetAccountingEntriesByCorrelationID(correlationID string) ([]*models.AccountingEntry, error) {
+	query := `
+		SELECT ` + accountingEntryColumns + `
+		FROM accounting_entries ae
+		WHERE ae.tenant_id = ? AND ae.external_correlation_id = ?
+		ORDER BY ae.id
+	`
+	rows, err := r.db.Query(query, r.tenant, correlationID)
+	if err != nil {
+		return nil, err
+	}
+	return scanAccountingEntries(rows)
+}
+
 func (r *accountingRepository) GetAccountingEntryByEntryID(entryID string) (*models.AccountingEntry, error) {
-	ae := &models.AccountingEntry{}
 	query := `
-		SELECT id, entry_id, account_code, amount,
-		       entry_date, description, invoice_number,
-		       created_at, updated_at
-		FROM accounting_entries
-		WHERE entry_id = ?
+		SELECT ` + accountingEntryColumns + `
+		FROM accounting_entries ae
+		WHERE ae.tenant_id = ? AND ae.entry_id = ?
 	`
-	err := r.db.QueryRow(query, entryID).Scan(
-		&ae.ID,
-		&ae.EntryID,
-		&ae.AccountCode,
-		&ae.Amount,
-		&ae.EntryDate,
-		&ae.Description,
-		&ae.InvoiceNumber,
-		&ae.CreatedAt,
-		&ae.UpdatedAt,
-	)
+	ae, err := scanAccountingEntry(r.db.QueryRow(query, r.tenant, entryID))
 	if err == sql.ErrNoRows {
-		return nil, errors.New("accounting entry not found")
+		return nil, ErrAccountingEntryNotFound
 	}
 	if err != nil {
 		return nil, err
@@ -110,117 +173,106 @@ func (r *accountingRepository) GetAccountingEntryByEntryID(entryID string) (*mod
 	return ae, nil
 }
 
-func (r *accountingRepository) GetUnreconciledEntries(fromDate, toDate string) ([]*models.AccountingEntry, error) {
+// GetUnreconciledEntries is GetUnreconciledTransactions for accounting entries
+func (r *accountingRepository) GetUnreconciledEntries(ctx context.Context, fromDate, toDate string) ([]*models.AccountingEntry, error) {
 	query := `
-		SELECT ae.id, ae.entry_id, ae.account_code, ae.amount,
-		       ae.entry_date, ae.description, ae.invoice_number,
-		       ae.created_at, ae.updated_at
+		SELECT ` + accountingEntryColumns + `
 		FROM accounting_entries ae
-		LEFT JOIN reconciliation_mappings rm ON ae.id = rm.accounting_entry_id
-		WHERE rm.id IS NULL
+		WHERE (ae.open_amount <> 0 OR NOT EXISTS (
+			SELECT 1 FROM reconciliation_mappings rm WHERE rm.accounting_entry_id = ae.id
+		))
+		AND ae.voided_at IS NULL
+		AND ae.tenant_id = ?
 		AND ae.entry_date BETWEEN ? AND ?
 	`
-	rows, err := r.db.Query(query, fromDate, toDate)
+	rows, err := r.db.QueryContext(ctx, query, r.tenant, fromDate, toDate)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var entries []*models.AccountingEntry
-	for rows.Next() {
-		ae := &models.AccountingEntry{}
-		err := rows.Scan(
-			&ae.ID,
-			&ae.EntryID,
-			&ae.AccountCode,
-			&ae.Amount,
-			&ae.EntryDate,
-			&ae.Description,
-			&ae.InvoiceNumber,
-			&ae.CreatedAt,
-			&ae.UpdatedAt,
-		)
-		if err != nil {
-			return nil, err
-		}
-		entries = append(entries, ae)
-	}
-	if err = rows.Err(); err != nil {
-		return nil, err
-	}
-	return entries, nil
+	return scanAccountingEntries(rows)
 }
 
-func (r *accountingRepository) GetEntriesByAmount(amount float64, fromDate, toDate string) ([]*models.AccountingEntry, error) {
+func (r *accountingRepository) GetEntriesByAmount(amount money.Amount, fromDate, toDate string) ([]*models.AccountingEntry, error) {
 	query := `
-		SELECT id, entry_id, account_code, amount,
-		       entry_date, description, invoice_number,
-		       created_at, updated_at
-		FROM accounting_entries
-		WHERE amount = ?
-		AND entry_date BETWEEN ? AND ?
+		SELECT ` + accountingEntryColumns + `
+		FROM accounting_entries ae
+		WHERE ae.tenant_id = ?
+		AND ae.voided_at IS NULL
+		AND ae.amount = ?
+		AND ae.entry_date BETWEEN ? AND ?
 	`
-	rows, err := r.db.Query(query, amount, fromDate, toDate)
+	rows, err := r.db.Query(query, r.tenant, amount, fromDate, toDate)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var entries []*models.AccountingEntry
-	for rows.Next() {
-		ae := &models.AccountingEntry{}
-		err := rows.Scan(
-			&ae.ID,
-			&ae.EntryID,
-			&ae.AccountCode,
-			&ae.Amount,
-			&ae.EntryDate,
-			&ae.Description,
-			&ae.InvoiceNumber,
-			&ae.CreatedAt,
-			&ae.UpdatedAt,
-		)
-		if err != nil {
-			return nil, err
-		}
-		entries = append(entries, ae)
-	}
-	if err = rows.Err(); err != nil {
-		return nil, err
-	}
-	return entries, nil
+	return scanAccountingEntries(rows)
 }
 
+// UpdateAccountingEntry applies the same version check as UpdateBankTransaction
 func (r *accountingRepository) UpdateAccountingEntry(tx *sql.Tx, ae *models.AccountingEntry) error {
 	query := `
 		UPDATE accounting_entries
 		SET account_code = ?,
 			amount = ?,
+			currency = ?,
 			entry_date = ?,
 			description = ?,
 			invoice_number = ?,
+			entry_type = ?,
+			counterparty_iban = ?,
+			counterparty_id = ?,
+			creditor_reference = ?,
+			end_to_end_id = ?,
+			external_correlation_id = ?,
+			version = version + 1,
 			updated_at = ?
-		WHERE id = ?
+		WHERE id = ? AND tenant_id = ? AND version = ?
 	`
 	result, err := tx.Exec(query,
 		ae.AccountCode,
 		ae.Amount,
+		ae.Currency,
 		ae.EntryDate,
 		ae.Description,
 		ae.InvoiceNumber,
+		ae.EntryType,
+		ae.CounterpartyIBAN,
+		nullableID(ae.CounterpartyID),
+		ae.CreditorReference,
+		ae.EndToEndID,
+		ae.ExternalCorrelationID,
 		time.Now(),
 		ae.ID,
+		r.tenant,
+		ae.Version,
 	)
 	if err != nil {
 		return err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	if err := checkVersionedUpdate(tx, result, "accounting_entries", r.tenant, ae.ID, ErrAccountingEntryNotFound); err != nil {
+		return err
+	}
+	ae.Version++
+	return nil
+}
+
+// VoidAccountingEntry is VoidBankTransaction for accounting entries
+func (r *accountingRepository) VoidAccountingEntry(tx *sql.Tx, ae *models.AccountingEntry) error {
+	now := time.Now()
+	result, err := tx.Exec(`
+		UPDATE accounting_entries
+		SET voided_at = ?, void_reason = ?, voided_by = ?, version = version + 1, updated_at = ?
+		WHERE id = ? AND tenant_id = ? AND version = ?
+	`, now, ae.VoidReason, ae.VoidedBy, now, ae.ID, r.tenant, ae.Version)
 	if err != nil {
 		return err
 	}
-	if rowsAffected == 0 {
-		return errors.New("accounting entry not found")
+
+	if err := checkVersionedUpdate(tx, result, "accounting_entries", r.tenant, ae.ID, ErrAccountingEntryNotFound); err != nil {
+		return err
 	}
+	ae.VoidedAt = &now
+	ae.Version++
 	return nil
 }
@@ -0,0 +1,114 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+
+	"reconciliation-service/internal/models"
+)
+
+var (
+	ErrAliasNotFound = errors.New("alias not found")
+
+	// ErrAliasConflict means the alias is already in the dictionary
+	ErrAliasConflict = errors.New("alias already exists")
+)
+
+type AliasRepository interface {
+	CreateAlias(alias *models.NameAlias) error
+	ListAliases() ([]*models.NameAlias, error)
+	DeleteAlias(id int64) error
+}
+
+type aliasRepository struct {
+	db *sql.DB
+}
+
+func NewAliasRepository(db *sql.DB) AliasRepository {
+	return &aliasRepository{db: db}
+}
+
+func (r *aliasRepository) CreateAlias(alias *models.NameAlias) error {
+	query := `
+		INSERT INTO name_aliases (
+			alias, canonical, source, user_id,
+			bank_transaction_id, accounting_entry_id
+		) VALUES (?, ?, ?, ?, ?, ?)
+	`
+	result, err := r.db.Exec(query,
+		alias.Alias,
+		alias.Canonical,
+		alias.Source,
+		alias.UserID,
+		nullableID(alias.BankTransactionID),
+		nullableID(alias.AccountingEntryID),
+	)
+	if IsDuplicateEntry(err) {
+		return ErrAliasConflict
+	}
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	alias.ID = id
+	return nil
+}
+
+func (r *aliasRepository) ListAliases() ([]*models.NameAlias, error) {
+	query := `
+		SELECT id, alias, canonical, source, user_id,
+		       bank_transaction_id, accounting_entry_id, created_at
+		FROM name_aliases
+		ORDER BY alias
+	`
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	aliases := []*models.NameAlias{}
+	for rows.Next() {
+		alias := &models.NameAlias{}
+		var bankTransactionID, accountingEntryID sql.NullInt64
+		err := rows.Scan(
+			&alias.ID,
+			&alias.Alias,
+			&alias.Canonical,
+			&alias.Source,
+			&alias.UserID,
+			&bankTransactionID,
+			&accountingEntryID,
+			&alias.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		alias.BankTransactionID = bankTransactionID.Int64
+		alias.AccountingEntryID = accountingEntryID.Int64
+		aliases = append(aliases, alias)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return aliases, nil
+}
+
+func (r *aliasRepository) DeleteAlias(id int64) error {
+	result, err := r.db.Exec("DELETE FROM name_aliases WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrAliasNotFound
+	}
+	return nil
+}
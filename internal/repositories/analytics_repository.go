@@ -0,0 +1,429 @@
+package repositories
+
+import (
+	"database/sql"
+
+	"reconciliation-service/internal/models"
+)
+
+type AnalyticsRepository interface {
+	GetCashPositions(date, accountNumber string) ([]*models.CashPosition, error)
+	GetOutstandingPayments(windowStart, accountNumber string) ([]*models.OutstandingPayment, error)
+	GetDailyBankActivity(fromDate, toDate string) ([]*models.DailyBankActivity, error)
+	GetMatchTypeStats(fromDate, toDate string) ([]*models.MatchTypeStats, error)
+	GetOperatorBacklog() (*models.OperatorBacklog, error)
+	GetDigestActivity(date, nextDate string) (*models.DigestActivity, error)
+	GetNewUnmatched(date, nextDate string) ([]*models.CurrencyTotal, error)
+	GetUnmatchedDatedOn(date string) ([]*models.CurrencyTotal, error)
+}
+
+type analyticsRepository struct {
+	db *sql.DB
+	// tenant whose balances and transactions are analysed
+	tenant string
+}
+
+func NewAnalyticsRepository(db *sql.DB, tenant string) AnalyticsRepository {
+	return &analyticsRepository{db: db, tenant: tenant}
+}
+
+// GetCashPositions returns, for every account with a statement balance on or
+// before date, optionally only one, its latest statement balance, the net of
+// its bank transactions dated after that balance up to date as Balance, and
+// the credits and debits up to date not mapped in a matched reconciliation.
+// Balance is left for the caller to add to the statement balance, and the
+// reconciled and projected balances to derive.
+func (r *analyticsRepository) GetCashPositions(date, accountNumber string) ([]*models.CashPosition, error) {
+	query := `
+		SELECT sb.account_number, sb.currency, sb.balance_date, sb.balance,
+		       COALESCE(SUM(CASE WHEN bt.transaction_date > sb.balance_date THEN bt.amount ELSE 0 END), 0),
+		       COALESCE(SUM(CASE WHEN m.bank_transaction_id IS NULL AND bt.amount > 0 THEN bt.amount ELSE 0 END), 0),
+		       COALESCE(SUM(CASE WHEN m.bank_transaction_id IS NULL AND bt.amount < 0 THEN bt.amount ELSE 0 END), 0),
+		       COUNT(CASE WHEN m.bank_transaction_id IS NULL THEN bt.id END)
+		FROM statement_balances sb
+		JOIN (
+		    SELECT account_number, MAX(balance_date) AS balance_date
+		    FROM statement_balances
+		    WHERE tenant_id = ? AND balance_date <= ?
+		    GROUP BY account_number
+		) latest ON latest.account_number = sb.account_number AND latest.balance_date = sb.balance_date
+		LEFT JOIN bank_transactions bt
+		       ON bt.account_number = sb.account_number
+		      AND bt.tenant_id = sb.tenant_id
+		      AND bt.transaction_date <= ?
+		LEFT JOIN (
+		    SELECT DISTINCT rm.bank_transaction_id
+		    FROM reconciliation_mappings rm
+		    JOIN reconciliations r ON r.id = rm.reconciliation_id
+		    WHERE r.status = ? AND rm.bank_transaction_id IS NOT NULL
+		) m ON m.bank_transaction_id = bt.id
+		WHERE sb.tenant_id = ?`
+	args := []interface{}{r.tenant, date, date, models.StatusMatched, r.tenant}
+	if accountNumber != "" {
+		query += ` AND sb.account_number = ?`
+		args = append(args, accountNumber)
+	}
+	query += `
+		GROUP BY sb.id, sb.account_number, sb.currency, sb.balance_date, sb.balance
+		ORDER BY sb.account_number`
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	positions := []*models.CashPosition{}
+	for rows.Next() {
+		position := &models.CashPosition{}
+		var statementDate sql.NullTime
+		err := rows.Scan(
+			&position.AccountNumber,
+			&position.Currency,
+			&statementDate,
+			&position.StatementBalance,
+			&position.Balance,
+			&position.UnreconciledInflows,
+			&position.UnreconciledOutflows,
+			&position.UnreconciledItems,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if statementDate.Valid {
+			position.StatementDate = statementDate.Time.Format("2006-01-02")
+		}
+		positions = append(positions, position)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return positions, nil
+}
+
+// GetOutstandingPayments returns the pending expected payments on a named
+// account whose window starts on or before windowStart, optionally on one
+// account, each with how many earlier expectations of its source and
+// direction were matched and missed
+func (r *analyticsRepository) GetOutstandingPayments(windowStart, accountNumber string) ([]*models.OutstandingPayment, error) {
+	query := `
+		SELECT ep.account_number, ep.source, ep.direction, ep.amount, ep.currency,
+		       COALESCE(history.matched, 0), COALESCE(history.missed, 0)
+		FROM expected_payments ep
+		LEFT JOIN (
+		    SELECT source, direction,
+		           SUM(CASE WHEN status = ? THEN 1 ELSE 0 END) AS matched,
+		           SUM(CASE WHEN status = ? THEN 1 ELSE 0 END) AS missed
+		    FROM expected_payments
+		    GROUP BY source, direction
+		) history ON history.source = ep.source AND history.direction = ep.direction
+		WHERE ep.status = ? AND ep.account_number <> '' AND ep.window_start <= ?`
+	args := []interface{}{models.ExpectedStatusMatched, models.ExpectedStatusMissed, models.ExpectedStatusPending, windowStart}
+	if accountNumber != "" {
+		query += ` AND ep.account_number = ?`
+		args = append(args, accountNumber)
+	}
+	query += ` ORDER BY ep.account_number, ep.window_start, ep.id`
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payments := []*models.OutstandingPayment{}
+	for rows.Next() {
+		payment := &models.OutstandingPayment{}
+		err := rows.Scan(
+			&payment.AccountNumber,
+			&payment.Source,
+			&payment.Direction,
+			&payment.Amount,
+			&payment.Currency,
+			&payment.Matched,
+			&payment.Missed,
+		)
+		if err != nil {
+			return nil, err
+		}
+		payments = append(payments, payment)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return payments, nil
+}
+
+// GetDailyBankActivity counts the bank transactions dated within the range by
+// day and currency, telling apart those a matched reconciliation maps
+func (r *analyticsRepository) GetDailyBankActivity(fromDate, toDate string) ([]*models.DailyBankActivity, error) {
+	rows, err := r.db.Query(`
+		SELECT DATE_FORMAT(bt.transaction_date, '%Y-%m-%d'), bt.currency,
+		       COUNT(*),
+		       COUNT(m.bank_transaction_id),
+		       COALESCE(SUM(CASE WHEN m.bank_transaction_id IS NOT NULL THEN ABS(bt.amount) ELSE 0 END), 0),
+		       COALESCE(SUM(CASE WHEN m.bank_transaction_id IS NULL THEN ABS(bt.amount) ELSE 0 END), 0)
+		FROM bank_transactions bt
+		LEFT JOIN (
+		    SELECT DISTINCT rm.bank_transaction_id
+		    FROM reconciliation_mappings rm
+		    JOIN reconciliations r ON r.id = rm.reconciliation_id
+		    WHERE r.tenant_id = ? AND r.status = ? AND rm.bank_transaction_id IS NOT NULL
+		) m ON m.bank_transaction_id = bt.id
+		WHERE bt.tenant_id = ? AND bt.voided_at IS NULL AND bt.transaction_date BETWEEN ? AND ?
+		GROUP BY bt.transaction_date, bt.currency
+		ORDER BY bt.transaction_date, bt.currency
+	`, r.tenant, models.StatusMatched, r.tenant, fromDate, toDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var activity []*models.DailyBankActivity
+	for rows.Next() {
+		day := &models.DailyBankActivity{}
+		err := rows.Scan(&day.Date, &day.Currency, &day.Count, &day.Matched, &day.MatchedAmount, &day.UnmatchedAmount)
+		if err != nil {
+			return nil, err
+		}
+		activity = append(activity, day)
+	}
+	return activity, rows.Err()
+}
+
+// GetMatchTypeStats counts the matched reconciliations mapping a bank
+// transaction dated within the range by mapping type, with their average
+// confidence
+func (r *analyticsRepository) GetMatchTypeStats(fromDate, toDate string) ([]*models.MatchTypeStats, error) {
+	rows, err := r.db.Query(`
+		SELECT matched.mapping_type, COUNT(*), COALESCE(AVG(matched.match_confidence), 0)
+		FROM (
+		    SELECT DISTINCT r.id, rm.mapping_type, r.match_confidence
+		    FROM reconciliations r
+		    JOIN reconciliation_mappings rm ON rm.reconciliation_id = r.id
+		    JOIN bank_transactions bt ON bt.id = rm.bank_transaction_id
+		    WHERE r.tenant_id = ? AND r.status = ?
+		    AND bt.transaction_date BETWEEN ? AND ?
+		) matched
+		GROUP BY matched.mapping_type
+		ORDER BY matched.mapping_type
+	`, r.tenant, models.StatusMatched, fromDate, toDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []*models.MatchTypeStats
+	for rows.Next() {
+		stat := &models.MatchTypeStats{}
+		if err := rows.Scan(&stat.MappingType, &stat.Count, &stat.AverageConfidence); err != nil {
+			return nil, err
+		}
+		stats = append(stats, stat)
+	}
+	return stats, rows.Err()
+}
+
+// settledStatuses are the reconciliation statuses that take a record off the
+// unmatched queue: matched, or paired and waiting on an operator
+var settledStatuses = []interface{}{models.StatusMatched, models.StatusPendingReview, models.StatusDisputed}
+
+// GetOperatorBacklog counts the work waiting on operators across all dates.
+// Exceptions count for the tenant of the record they were raised for.
+func (r *analyticsRepository) GetOperatorBacklog() (*models.OperatorBacklog, error) {
+	backlog := &models.OperatorBacklog{}
+	var err error
+	if backlog.UnmatchedBank, err = r.accountCounts(`
+		SELECT bt.account_number, '', COUNT(*)
+		FROM bank_transactions bt
+		WHERE bt.tenant_id = ? AND bt.voided_at IS NULL AND NOT EXISTS (
+		    SELECT 1
+		    FROM reconciliation_mappings rm
+		    JOIN reconciliations r ON r.id = rm.reconciliation_id
+		    WHERE rm.bank_transaction_id = bt.id AND r.status IN (`+placeholders(len(settledStatuses))+`)
+		)
+		GROUP BY bt.account_number
+	`, append([]interface{}{r.tenant}, settledStatuses...)...); err != nil {
+		return nil, err
+	}
+	if backlog.UnmatchedLedger, err = r.accountCounts(`
+		SELECT ae.account_code, '', COUNT(*)
+		FROM accounting_entries ae
+		WHERE ae.tenant_id = ? AND ae.voided_at IS NULL AND NOT EXISTS (
+		    SELECT 1
+		    FROM reconciliation_mappings rm
+		    JOIN reconciliations r ON r.id = rm.reconciliation_id
+		    WHERE rm.accounting_entry_id = ae.id AND r.status IN (`+placeholders(len(settledStatuses))+`)
+		)
+		GROUP BY ae.account_code
+	`, append([]interface{}{r.tenant}, settledStatuses...)...); err != nil {
+		return nil, err
+	}
+
+	byBankAccount := `
+		SELECT bt.account_number, r.status, COUNT(DISTINCT r.id)
+		FROM reconciliations r
+		JOIN reconciliation_mappings rm ON rm.reconciliation_id = r.id
+		JOIN bank_transactions bt ON bt.id = rm.bank_transaction_id
+		WHERE r.tenant_id = ? AND r.status = ?
+		GROUP BY bt.account_number, r.status
+	`
+	if backlog.PendingReview, err = r.accountCounts(byBankAccount, r.tenant, models.StatusPendingReview); err != nil {
+		return nil, err
+	}
+	if backlog.Disputed, err = r.accountCounts(byBankAccount, r.tenant, models.StatusDisputed); err != nil {
+		return nil, err
+	}
+
+	tenantExceptions := `
+		FROM reconciliation_exceptions e
+		LEFT JOIN bank_transactions bt ON e.record_type = ? AND bt.id = e.record_id
+		LEFT JOIN accounting_entries ae ON e.record_type = ? AND ae.id = e.record_id
+		WHERE COALESCE(bt.tenant_id, ae.tenant_id) = ?
+	`
+	if backlog.OpenExceptions, err = r.accountCounts(`
+		SELECT e.account, e.status, COUNT(*)
+		`+tenantExceptions+` AND e.status NOT IN (?, ?)
+		GROUP BY e.account, e.status
+	`, models.ExceptionRecordBankTransaction, models.ExceptionRecordAccountingEntry, r.tenant,
+		models.ExceptionStatusWrittenOff, models.ExceptionStatusResolved); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(`
+		SELECT e.account, COUNT(*), COALESCE(SUM(TIMESTAMPDIFF(SECOND, e.created_at, e.closed_at)), 0)
+		`+tenantExceptions+` AND e.closed_at IS NOT NULL
+		GROUP BY e.account
+		ORDER BY e.account
+	`, models.ExceptionRecordBankTransaction, models.ExceptionRecordAccountingEntry, r.tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		resolution := &models.ExceptionResolution{}
+		if err := rows.Scan(&resolution.Account, &resolution.Count, &resolution.Seconds); err != nil {
+			return nil, err
+		}
+		backlog.Resolutions = append(backlog.Resolutions, resolution)
+	}
+	return backlog, rows.Err()
+}
+
+// accountCounts runs a query selecting an account, a status and a count
+func (r *analyticsRepository) accountCounts(query string, args ...interface{}) ([]*models.AccountCount, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []*models.AccountCount
+	for rows.Next() {
+		count := &models.AccountCount{}
+		if err := rows.Scan(&count.Account, &count.Status, &count.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
+
+// GetDigestActivity counts the records created from date until nextDate, the
+// batches that wrote reconciliations in that time with the matched and
+// unmatched reconciliations they wrote, and the disputed matches open now
+func (r *analyticsRepository) GetDigestActivity(date, nextDate string) (*models.DigestActivity, error) {
+	activity := &models.DigestActivity{}
+	err := r.db.QueryRow(`
+		SELECT
+		    (SELECT COUNT(*) FROM bank_transactions
+		     WHERE tenant_id = ? AND created_at >= ? AND created_at < ?),
+		    (SELECT COUNT(*) FROM accounting_entries
+		     WHERE tenant_id = ? AND created_at >= ? AND created_at < ?),
+		    (SELECT COUNT(DISTINCT reconciliation_batch_id) FROM reconciliations
+		     WHERE tenant_id = ? AND created_at >= ? AND created_at < ?),
+		    (SELECT COALESCE(SUM(status = ?), 0) FROM reconciliations
+		     WHERE tenant_id = ? AND created_at >= ? AND created_at < ?),
+		    (SELECT COALESCE(SUM(status = ?), 0) FROM reconciliations
+		     WHERE tenant_id = ? AND created_at >= ? AND created_at < ?),
+		    (SELECT COUNT(*) FROM reconciliations WHERE tenant_id = ? AND status = ?)
+	`, r.tenant, date, nextDate,
+		r.tenant, date, nextDate,
+		r.tenant, date, nextDate,
+		models.StatusMatched, r.tenant, date, nextDate,
+		models.StatusUnmatched, r.tenant, date, nextDate,
+		r.tenant, models.StatusDisputed,
+	).Scan(&activity.BankTransactions, &activity.AccountingEntries, &activity.Batches,
+		&activity.Matched, &activity.Unmatched, &activity.OpenDisputes)
+	if err != nil {
+		return nil, err
+	}
+	return activity, nil
+}
+
+// GetNewUnmatched totals by currency the records created from date until
+// nextDate that are still unmatched
+func (r *analyticsRepository) GetNewUnmatched(date, nextDate string) ([]*models.CurrencyTotal, error) {
+	return r.unmatchedTotals(`bt.created_at >= ? AND bt.created_at < ?`, `ae.created_at >= ? AND ae.created_at < ?`, date, nextDate)
+}
+
+// GetUnmatchedDatedOn totals by currency the records dated date that are
+// still unmatched
+func (r *analyticsRepository) GetUnmatchedDatedOn(date string) ([]*models.CurrencyTotal, error) {
+	return r.unmatchedTotals(`bt.transaction_date = ?`, `ae.entry_date = ?`, date)
+}
+
+// unmatchedTotals totals by currency the bank transactions meeting
+// bankCondition and the accounting entries meeting entryCondition, both
+// taking args, that no settled reconciliation maps or that are left open by
+// partial matches, counting what is left open of the latter
+func (r *analyticsRepository) unmatchedTotals(bankCondition, entryCondition string, args ...interface{}) ([]*models.CurrencyTotal, error) {
+	settled := placeholders(len(settledStatuses))
+	query := `
+		SELECT unmatched.currency, COUNT(*), COALESCE(SUM(unmatched.amount), 0)
+		FROM (
+		    SELECT bt.currency, ABS(COALESCE(bt.open_amount, bt.amount)) AS amount
+		    FROM bank_transactions bt
+		    WHERE bt.tenant_id = ? AND bt.voided_at IS NULL AND ` + bankCondition + `
+		    AND (bt.open_amount <> 0 OR NOT EXISTS (
+		        SELECT 1
+		        FROM reconciliation_mappings rm
+		        JOIN reconciliations r ON r.id = rm.reconciliation_id
+		        WHERE rm.bank_transaction_id = bt.id AND r.status IN (` + settled + `)
+		    ))
+		    UNION ALL
+		    SELECT ae.currency, ABS(COALESCE(ae.open_amount, ae.amount)) AS amount
+		    FROM accounting_entries ae
+		    WHERE ae.tenant_id = ? AND ae.voided_at IS NULL AND ` + entryCondition + `
+		    AND (ae.open_amount <> 0 OR NOT EXISTS (
+		        SELECT 1
+		        FROM reconciliation_mappings rm
+		        JOIN reconciliations r ON r.id = rm.reconciliation_id
+		        WHERE rm.accounting_entry_id = ae.id AND r.status IN (` + settled + `)
+		    ))
+		) unmatched
+		GROUP BY unmatched.currency
+		ORDER BY unmatched.currency
+	`
+	var queryArgs []interface{}
+	for i := 0; i < 2; i++ {
+		queryArgs = append(queryArgs, r.tenant)
+		queryArgs = append(queryArgs, args...)
+		queryArgs = append(queryArgs, settledStatuses...)
+	}
+	rows, err := r.db.Query(query, queryArgs...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var totals []*models.CurrencyTotal
+	for rows.Next() {
+		total := &models.CurrencyTotal{}
+		if err := rows.Scan(&total.Currency, &total.Count, &total.Amount); err != nil {
+			return nil, err
+		}
+		totals = append(totals, total)
+	}
+	return totals, rows.Err()
+}
@@ -0,0 +1,203 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"reconciliation-service/internal/models"
+)
+
+var (
+	ErrAPIKeyNotFound = errors.New("API key not found")
+
+	// ErrAPIKeyReplaced means the key was rotated or revoked since it was
+	// read
+	ErrAPIKeyReplaced = errors.New("API key was already rotated or revoked")
+)
+
+type APIKeyRepository interface {
+	CreateKey(key *models.APIKey, hash string) error
+	GetKey(id int64) (*models.APIKey, error)
+	GetKeyByHash(hash string) (*models.APIKey, error)
+	ListKeys(tenant string) ([]*models.APIKey, error)
+	RotateKey(old, replacement *models.APIKey, hash string, expiresAt time.Time) error
+	RevokeKey(id int64, revokedBy string, at time.Time) error
+	TouchKey(id int64, at, before time.Time) error
+}
+
+type apiKeyRepository struct {
+	db *sql.DB
+}
+
+func NewAPIKeyRepository(db *sql.DB) APIKeyRepository {
+	return &apiKeyRepository{db: db}
+}
+
+func (r *apiKeyRepository) CreateKey(key *models.APIKey, hash string) error {
+	return createAPIKey(r.db, key, hash)
+}
+
+func createAPIKey(db execer, key *models.APIKey, hash string) error {
+	key.CreatedAt = time.Now()
+	result, err := db.Exec(`
+		INSERT INTO api_keys (tenant_id, name, prefix, key_hash, scope, expires_at, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, key.Tenant, key.Name, key.Prefix, hash, key.Scope, key.ExpiresAt, key.CreatedBy, key.CreatedAt)
+	if err != nil {
+		return err
+	}
+	key.ID, err = result.LastInsertId()
+	return err
+}
+
+const apiKeyColumns = `
+	id, tenant_id, name, prefix, scope, expires_at, last_used_at, replaced_by,
+	revoked_at, revoked_by, created_by, created_at`
+
+func scanAPIKey(row rowScanner) (*models.APIKey, error) {
+	key := &models.APIKey{}
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	var replacedBy sql.NullInt64
+	err := row.Scan(
+		&key.ID,
+		&key.Tenant,
+		&key.Name,
+		&key.Prefix,
+		&key.Scope,
+		&expiresAt,
+		&lastUsedAt,
+		&replacedBy,
+		&revokedAt,
+		&key.RevokedBy,
+		&key.CreatedBy,
+		&key.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	if replacedBy.Valid {
+		key.ReplacedBy = &replacedBy.Int64
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return key, nil
+}
+
+func (r *apiKeyRepository) getKey(where string, arg interface{}) (*models.APIKey, error) {
+	key, err := scanAPIKey(r.db.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys WHERE `+where, arg))
+	if err == sql.ErrNoRows {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (r *apiKeyRepository) GetKey(id int64) (*models.APIKey, error) {
+	return r.getKey(`id = ?`, id)
+}
+
+// GetKeyByHash finds the key whose secret hashes to hash, whatever its state
+func (r *apiKeyRepository) GetKeyByHash(hash string) (*models.APIKey, error) {
+	return r.getKey(`key_hash = ?`, hash)
+}
+
+// ListKeys lists the keys of a tenant, or of every tenant when it is empty,
+// newest first
+func (r *apiKeyRepository) ListKeys(tenant string) ([]*models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys`
+	var args []interface{}
+	if tenant != "" {
+		query += ` WHERE tenant_id = ?`
+		args = append(args, tenant)
+	}
+	rows, err := r.db.Query(query+` ORDER BY id DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// RotateKey stores the replacement of a key and has the old key expire at
+// expiresAt, unless it was rotated or revoked in the meantime
+func (r *apiKeyRepository) RotateKey(old, replacement *models.APIKey, hash string, expiresAt time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := createAPIKey(tx, replacement, hash); err != nil {
+		return err
+	}
+	result, err := tx.Exec(`
+		UPDATE api_keys SET replaced_by = ?, expires_at = ?
+		WHERE id = ? AND replaced_by IS NULL AND revoked_at IS NULL
+	`, replacement.ID, expiresAt, old.ID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrAPIKeyReplaced
+	}
+	old.ReplacedBy = &replacement.ID
+	old.ExpiresAt = &expiresAt
+	return tx.Commit()
+}
+
+// RevokeKey revokes a key at once. Revoking a revoked key keeps its first
+// revocation.
+func (r *apiKeyRepository) RevokeKey(id int64, revokedBy string, at time.Time) error {
+	result, err := r.db.Exec(`
+		UPDATE api_keys SET revoked_at = ?, revoked_by = ?
+		WHERE id = ? AND revoked_at IS NULL
+	`, at, revokedBy, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		_, err := r.GetKey(id)
+		return err
+	}
+	return nil
+}
+
+// TouchKey records that a key was used at a time, unless it was already
+// recorded as used since before
+func (r *apiKeyRepository) TouchKey(id int64, at, before time.Time) error {
+	_, err := r.db.Exec(`
+		UPDATE api_keys SET last_used_at = ?
+		WHERE id = ? AND (last_used_at IS NULL OR last_used_at < ?)
+	`, at, id, before)
+	return err
+}
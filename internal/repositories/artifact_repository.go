@@ -0,0 +1,112 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+
+	"reconciliation-service/internal/models"
+)
+
+var ErrArtifactNotFound = errors.New("artifact not found")
+
+type ArtifactRepository interface {
+	RegisterArtifact(artifact *models.ReportArtifact) error
+	GetArtifact(id int64) (*models.ReportArtifact, error)
+	FindArtifactsBySHA256(sha256 string) ([]*models.ReportArtifact, error)
+}
+
+type artifactRepository struct {
+	db *sql.DB
+	// tenant whose artifacts are registered and verified
+	tenant string
+}
+
+func NewArtifactRepository(db *sql.DB, tenant string) ArtifactRepository {
+	return &artifactRepository{db: db, tenant: tenant}
+}
+
+const artifactColumns = `id, tenant_id, kind, reference, format, filename, sha256, size_bytes, signature, created_at`
+
+// RegisterArtifact stores an artifact, or leaves the registration of the
+// same content under the same reference as it is. Either way artifact ends
+// up holding the stored registration.
+func (r *artifactRepository) RegisterArtifact(artifact *models.ReportArtifact) error {
+	artifact.Tenant = r.tenant
+	if _, err := r.db.Exec(`
+		INSERT IGNORE INTO report_artifacts (tenant_id, kind, reference, format, filename, sha256, size_bytes, signature)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		r.tenant,
+		artifact.Kind,
+		artifact.Reference,
+		artifact.Format,
+		artifact.Filename,
+		artifact.SHA256,
+		artifact.SizeBytes,
+		artifact.Signature,
+	); err != nil {
+		return err
+	}
+
+	return scanArtifact(r.db.QueryRow(`
+		SELECT `+artifactColumns+`
+		FROM report_artifacts
+		WHERE tenant_id = ? AND kind = ? AND reference = ? AND format = ? AND sha256 = ?
+	`, r.tenant, artifact.Kind, artifact.Reference, artifact.Format, artifact.SHA256), artifact)
+}
+
+func (r *artifactRepository) GetArtifact(id int64) (*models.ReportArtifact, error) {
+	artifact := &models.ReportArtifact{}
+	err := scanArtifact(r.db.QueryRow(`
+		SELECT `+artifactColumns+`
+		FROM report_artifacts
+		WHERE id = ? AND tenant_id = ?
+	`, id, r.tenant), artifact)
+	if err == sql.ErrNoRows {
+		return nil, ErrArtifactNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return artifact, nil
+}
+
+// FindArtifactsBySHA256 lists the registrations of a content hash, oldest
+// first
+func (r *artifactRepository) FindArtifactsBySHA256(sha256 string) ([]*models.ReportArtifact, error) {
+	rows, err := r.db.Query(`
+		SELECT `+artifactColumns+`
+		FROM report_artifacts
+		WHERE sha256 = ? AND tenant_id = ?
+		ORDER BY id
+	`, sha256, r.tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var artifacts []*models.ReportArtifact
+	for rows.Next() {
+		artifact := &models.ReportArtifact{}
+		if err := scanArtifact(rows, artifact); err != nil {
+			return nil, err
+		}
+		artifacts = append(artifacts, artifact)
+	}
+	return artifacts, rows.Err()
+}
+
+func scanArtifact(row rowScanner, artifact *models.ReportArtifact) error {
+	return row.Scan(
+		&artifact.ID,
+		&artifact.Tenant,
+		&artifact.Kind,
+		&artifact.Reference,
+		&artifact.Format,
+		&artifact.Filename,
+		&artifact.SHA256,
+		&artifact.SizeBytes,
+		&artifact.Signature,
+		&artifact.CreatedAt,
+	)
+}
@@ -1,6 +1,7 @@
 package repositories
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"time"
@@ -12,32 +13,126 @@ type BankRepository interface {
 	InsertBankTransaction(tx *sql.Tx, bt *models.BankTransaction) error
 	GetBankTransactionByID(id int64) (*models.BankTransaction, error)
 	GetBankTransactionByTransactionID(transactionID string) (*models.BankTransaction, error)
-	GetUnreconciledTransactions(fromDate, toDate string) ([]*models.BankTransaction, error)
+	GetBankTransactionForUpdate(tx *sql.Tx, transactionID string) (*models.BankTransaction, error)
+	GetBankTransactionsByCorrelationID(correlationID string) ([]*models.BankTransaction, error)
+	GetUnreconciledTransactions(ctx context.Context, fromDate, toDate string) ([]*models.BankTransaction, error)
+	GetUnreconciledTransactionsPartition(fromDate, toDate, strategy string, partition, partitions int) ([]*models.BankTransaction, error)
 	UpdateBankTransaction(tx *sql.Tx, bt *models.BankTransaction) error
+	VoidBankTransaction(tx *sql.Tx, bt *models.BankTransaction) error
+	GetAccountNumbers(fromDate, toDate string) ([]string, error)
+	SaveStatementBalance(tx *sql.Tx, balance *models.StatementBalance) error
 }
 
 type bankRepository struct {
-	db *sql.DB
+	db     *sql.DB
+	tenant string
 }
 
-func NewBankRepository(db *sql.DB) BankRepository {
-	return &bankRepository{db: db}
+// NewBankRepository reads and writes the bank transactions of one tenant
+func NewBankRepository(db *sql.DB, tenant string) BankRepository {
+	return &bankRepository{db: db, tenant: tenant}
+}
+
+const bankTransactionColumns = `
+		bt.id, bt.transaction_id, bt.account_number, bt.amount, bt.currency,
+		bt.transaction_date, bt.description, bt.reference_number,
+		bt.counterparty_iban, bt.counterparty_bic,
+		bt.counterparty_bank_name, bt.counterparty_bank_country, bt.counterparty_id,
+		bt.remittance_information, bt.creditor_reference, bt.end_to_end_id,
+		bt.external_correlation_id, bt.reversal, bt.return_reason,
+		bt.voided_at, bt.void_reason, bt.voided_by, bt.open_amount,
+		bt.version, bt.created_at, bt.updated_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanBankTransaction(row rowScanner) (*models.BankTransaction, error) {
+	bt := &models.BankTransaction{}
+	var counterpartyID sql.NullInt64
+	err := row.Scan(
+		&bt.ID,
+		&bt.TransactionID,
+		&bt.AccountNumber,
+		&bt.Amount,
+		&bt.Currency,
+		&bt.TransactionDate,
+		&bt.Description,
+		&bt.ReferenceNumber,
+		&bt.CounterpartyIBAN,
+		&bt.CounterpartyBIC,
+		&bt.CounterpartyBankName,
+		&bt.CounterpartyBankCountry,
+		&counterpartyID,
+		&bt.RemittanceInformation,
+		&bt.CreditorReference,
+		&bt.EndToEndID,
+		&bt.ExternalCorrelationID,
+		&bt.Reversal,
+		&bt.ReturnReason,
+		&bt.VoidedAt,
+		&bt.VoidReason,
+		&bt.VoidedBy,
+		&bt.OpenAmount,
+		&bt.Version,
+		&bt.CreatedAt,
+		&bt.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	bt.CounterpartyID = counterpartyID.Int64
+	return bt, nil
+}
+
+func scanBankTransactions(rows *sql.Rows) ([]*models.BankTransaction, error) {
+	defer rows.Close()
+
+	var transactions []*models.BankTransaction
+	for rows.Next() {
+		bt, err := scanBankTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, bt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return transactions, nil
 }
 
 func (r *bankRepository) InsertBankTransaction(tx *sql.Tx, bt *models.BankTransaction) error {
 	query := `
 		INSERT INTO bank_transactions (
-			transaction_id, account_number, amount, 
-			transaction_date, description, reference_number
-		) VALUES (?, ?, ?, ?, ?, ?)
+			tenant_id, transaction_id, account_number, amount, currency,
+			transaction_date, description, reference_number,
+			counterparty_iban, counterparty_bic,
+			counterparty_bank_name, counterparty_bank_country, counterparty_id,
+			remittance_information, creditor_reference, end_to_end_id,
+			external_correlation_id, reversal, return_reason
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 	result, err := tx.Exec(query,
+		r.tenant,
 		bt.TransactionID,
 		bt.AccountNumber,
 		bt.Amount,
+		bt.Currency,
 		bt.TransactionDate,
 		bt.Description,
 		bt.ReferenceNumber,
+		bt.CounterpartyIBAN,
+		bt.CounterpartyBIC,
+		bt.CounterpartyBankName,
+		bt.CounterpartyBankCountry,
+		nullableID(bt.CounterpartyID),
+		bt.RemittanceInformation,
+		bt.CreditorReference,
+		bt.EndToEndID,
+		bt.ExternalCorrelationID,
+		bt.Reversal,
+		bt.ReturnReason,
 	)
 	if err != nil {
 		return err
@@ -52,27 +147,14 @@ func (r *bankRepository) InsertBankTransaction(tx *sql.Tx, bt *models.BankTransa
 }
 
 func (r *bankRepository) GetBankTransactionByID(id int64) (*models.BankTransaction, error) {
-	bt := &models.BankTransaction{}
 	query := `
-		SELECT id, transaction_id, account_number, amount, 
-		       transaction_date, description, reference_number,
-		       created_at, updated_at
-		FROM bank_transactions
-		WHERE id = ?
+		SELECT ` + bankTransactionColumns + `
+		FROM bank_transactions bt
+		WHERE bt.id = ? AND bt.tenant_id = ?
 	`
-	err := r.db.QueryRow(query, id).Scan(
-		&bt.ID,
-		&bt.TransactionID,
-		&bt.AccountNumber,
-		&bt.Amount,
-		&bt.TransactionDate,
-		&bt.Description,
-		&bt.ReferenceNumber,
-		&bt.CreatedAt,
-		&bt.UpdatedAt,
-	)
+	bt, err := scanBankTransaction(r.db.QueryRow(query, id, r.tenant))
 	if err == sql.ErrNoRows {
-		return nil, errors.New("bank transaction not found")
+		return nil, ErrBankTransactionNotFound
 	}
 	if err != nil {
 		return nil, err
@@ -80,28 +162,50 @@ func (r *bankRepository) GetBankTransactionByID(id int64) (*models.BankTransacti
 	return bt, nil
 }
 
+// GetBankTransactionsByCorrelationID lists the transactions carrying an
+// upstream payment ID, oldest first
+func (r *bankRepository) GetBankTransactionsByCorrelationID(correlationID string) ([]*models.BankTransaction, error) {
+	query := `
+		SELECT ` + bankTransactionColumns + `
+		FROM bank_transactions bt
+		WHERE bt.tenant_id = ? AND bt.external_correlation_id = ?
+		ORDER BY bt.id
+	`
+	rows, err := r.db.Query(query, r.tenant, correlationID)
+	if err != nil {
+		return nil, err
+	}
+	return scanBankTransactions(rows)
+}
+
 func (r *bankRepository) GetBankTransactionByTransactionID(transactionID string) (*models.BankTransaction, error) {
-	bt := &models.BankTransaction{}
 	query := `
-		SELECT id, transaction_id, account_number, amount, 
-		       transaction_date, description, reference_number,
-		       created_at, updated_at
-		FROM bank_transactions
-		WHERE transaction_id = ?
+		SELECT ` + bankTransactionColumns + `
+		FROM bank_transactions bt
+		WHERE bt.tenant_id = ? AND bt.transaction_id = ?
 	`
-	err := r.db.QueryRow(query, transactionID).Scan(
-		&bt.ID,
-		&bt.TransactionID,
-		&bt.AccountNumber,
-		&bt.Amount,
-		&bt.TransactionDate,
-		&bt.Description,
-		&bt.ReferenceNumber,
-		&bt.CreatedAt,
-		&bt.UpdatedAt,
-	)
+	bt, err := scanBankTransaction(r.db.QueryRow(query, r.tenant, transactionID))
+	if err == sql.ErrNoRows {
+		return nil, ErrBankTransactionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bt, nil
+}
+
+// GetBankTransactionForUpdate reads and locks a bank transaction by its bank
+// transaction ID, including rows inserted earlier in tx
+func (r *bankRepository) GetBankTransactionForUpdate(tx *sql.Tx, transactionID string) (*models.BankTransaction, error) {
+	query := `
+		SELECT ` + bankTransactionColumns + `
+		FROM bank_transactions bt
+		WHERE bt.tenant_id = ? AND bt.transaction_id = ?
+		FOR UPDATE
+	`
+	bt, err := scanBankTransaction(tx.QueryRow(query, r.tenant, transactionID))
 	if err == sql.ErrNoRows {
-		return nil, errors.New("bank transaction not found")
+		return nil, ErrBankTransactionNotFound
 	}
 	if err != nil {
 		return nil, err
@@ -109,77 +213,200 @@ func (r *bankRepository) GetBankTransactionByTransactionID(transactionID string)
 	return bt, nil
 }
 
-func (r *bankRepository) GetUnreconciledTransactions(fromDate, toDate string) ([]*models.BankTransaction, error) {
+// GetUnreconciledTransactions returns the period's transactions without a
+// mapping, and those a partial match left an open amount of
+func (r *bankRepository) GetUnreconciledTransactions(ctx context.Context, fromDate, toDate string) ([]*models.BankTransaction, error) {
 	query := `
-		SELECT bt.id, bt.transaction_id, bt.account_number, bt.amount, 
-		       bt.transaction_date, bt.description, bt.reference_number,
-		       bt.created_at, bt.updated_at
+		SELECT ` + bankTransactionColumns + `
 		FROM bank_transactions bt
-		LEFT JOIN reconciliation_mappings rm ON bt.id = rm.bank_transaction_id
-		WHERE rm.id IS NULL
+		WHERE (bt.open_amount <> 0 OR NOT EXISTS (
+			SELECT 1 FROM reconciliation_mappings rm WHERE rm.bank_transaction_id = bt.id
+		))
+		AND bt.voided_at IS NULL
+		AND bt.tenant_id = ?
 		AND bt.transaction_date BETWEEN ? AND ?
 	`
-	rows, err := r.db.Query(query, fromDate, toDate)
+	rows, err := r.db.QueryContext(ctx, query, r.tenant, fromDate, toDate)
+	if err != nil {
+		return nil, err
+	}
+	return scanBankTransactions(rows)
+}
+
+// GetAccountNumbers lists the distinct bank accounts with transactions in the period
+func (r *bankRepository) GetAccountNumbers(fromDate, toDate string) ([]string, error) {
+	query := `
+		SELECT DISTINCT account_number
+		FROM bank_transactions
+		WHERE tenant_id = ? AND voided_at IS NULL AND transaction_date BETWEEN ? AND ?
+		ORDER BY account_number
+	`
+	rows, err := r.db.Query(query, r.tenant, fromDate, toDate)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var transactions []*models.BankTransaction
+	var accounts []string
 	for rows.Next() {
-		bt := &models.BankTransaction{}
-		err := rows.Scan(
-			&bt.ID,
-			&bt.TransactionID,
-			&bt.AccountNumber,
-			&bt.Amount,
-			&bt.TransactionDate,
-			&bt.Description,
-			&bt.ReferenceNumber,
-			&bt.CreatedAt,
-			&bt.UpdatedAt,
-		)
-		if err != nil {
+		var account string
+		if err := rows.Scan(&account); err != nil {
 			return nil, err
 		}
-		transactions = append(transactions, bt)
+		accounts = append(accounts, account)
 	}
 	if err = rows.Err(); err != nil {
 		return nil, err
 	}
-	return transactions, nil
+	return accounts, nil
 }
 
+// GetUnreconciledTransactionsPartition returns one of `partitions` disjoint
+// slices of the unreconciled transactions, split either by a hash of the
+// account number or by contiguous ID ranges
+func (r *bankRepository) GetUnreconciledTransactionsPartition(fromDate, toDate, strategy string, partition, partitions int) ([]*models.BankTransaction, error) {
+	query := `
+		SELECT ` + bankTransactionColumns + `
+		FROM bank_transactions bt
+		WHERE (bt.open_amount <> 0 OR NOT EXISTS (
+			SELECT 1 FROM reconciliation_mappings rm WHERE rm.bank_transaction_id = bt.id
+		))
+		AND bt.voided_at IS NULL
+		AND bt.tenant_id = ?
+		AND bt.transaction_date BETWEEN ? AND ?
+	`
+	args := []interface{}{r.tenant, fromDate, toDate}
+
+	switch strategy {
+	case models.PartitionByAccountHash:
+		query += ` AND MOD(CRC32(bt.account_number), ?) = ?`
+		args = append(args, partitions, partition)
+	case models.PartitionByIDRange:
+		var minID, maxID sql.NullInt64
+		err := r.db.QueryRow(`
+			SELECT MIN(id), MAX(id)
+			FROM bank_transactions
+			WHERE tenant_id = ? AND transaction_date BETWEEN ? AND ?
+		`, r.tenant, fromDate, toDate).Scan(&minID, &maxID)
+		if err != nil {
+			return nil, err
+		}
+		if !minID.Valid {
+			return nil, nil
+		}
+		width := (maxID.Int64 - minID.Int64 + int64(partitions)) / int64(partitions)
+		lo := minID.Int64 + int64(partition)*width
+		query += ` AND bt.id BETWEEN ? AND ?`
+		args = append(args, lo, lo+width-1)
+	default:
+		return nil, errors.New("unknown partition strategy")
+	}
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanBankTransactions(rows)
+}
+
+// UpdateBankTransaction is a compare-and-set on bt.Version: it returns
+// ErrVersionConflict when the row has moved on, and bumps bt.Version on success
 func (r *bankRepository) UpdateBankTransaction(tx *sql.Tx, bt *models.BankTransaction) error {
 	query := `
 		UPDATE bank_transactions
 		SET account_number = ?,
 			amount = ?,
+			currency = ?,
 			transaction_date = ?,
 			description = ?,
 			reference_number = ?,
+			counterparty_iban = ?,
+			counterparty_bic = ?,
+			counterparty_bank_name = ?,
+			counterparty_bank_country = ?,
+			counterparty_id = ?,
+			remittance_information = ?,
+			creditor_reference = ?,
+			end_to_end_id = ?,
+			external_correlation_id = ?,
+			reversal = ?,
+			return_reason = ?,
+			version = version + 1,
 			updated_at = ?
-		WHERE id = ?
+		WHERE id = ? AND tenant_id = ? AND version = ?
 	`
 	result, err := tx.Exec(query,
 		bt.AccountNumber,
 		bt.Amount,
+		bt.Currency,
 		bt.TransactionDate,
 		bt.Description,
 		bt.ReferenceNumber,
+		bt.CounterpartyIBAN,
+		bt.CounterpartyBIC,
+		bt.CounterpartyBankName,
+		bt.CounterpartyBankCountry,
+		nullableID(bt.CounterpartyID),
+		bt.RemittanceInformation,
+		bt.CreditorReference,
+		bt.EndToEndID,
+		bt.ExternalCorrelationID,
+		bt.Reversal,
+		bt.ReturnReason,
 		time.Now(),
 		bt.ID,
+		r.tenant,
+		bt.Version,
 	)
 	if err != nil {
 		return err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	if err := checkVersionedUpdate(tx, result, "bank_transactions", r.tenant, bt.ID, ErrBankTransactionNotFound); err != nil {
+		return err
+	}
+	bt.Version++
+	return nil
+}
+
+// VoidBankTransaction marks bt voided with its VoidReason and VoidedBy, with
+// the same version check as UpdateBankTransaction
+func (r *bankRepository) VoidBankTransaction(tx *sql.Tx, bt *models.BankTransaction) error {
+	now := time.Now()
+	result, err := tx.Exec(`
+		UPDATE bank_transactions
+		SET voided_at = ?, void_reason = ?, voided_by = ?, version = version + 1, updated_at = ?
+		WHERE id = ? AND tenant_id = ? AND version = ?
+	`, now, bt.VoidReason, bt.VoidedBy, now, bt.ID, r.tenant, bt.Version)
 	if err != nil {
 		return err
 	}
-	if rowsAffected == 0 {
-		return errors.New("bank transaction not found")
+
+	if err := checkVersionedUpdate(tx, result, "bank_transactions", r.tenant, bt.ID, ErrBankTransactionNotFound); err != nil {
+		return err
 	}
+	bt.VoidedAt = &now
+	bt.Version++
 	return nil
 }
+
+// SaveStatementBalance stores the closing balance of an account on a day,
+// replacing the one an earlier statement gave for that day
+func (r *bankRepository) SaveStatementBalance(tx *sql.Tx, balance *models.StatementBalance) error {
+	_, err := tx.Exec(`
+		INSERT INTO statement_balances (tenant_id, account_number, balance_date, balance, currency, source)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			balance = VALUES(balance),
+			currency = VALUES(currency),
+			source = VALUES(source)
+	`,
+		r.tenant,
+		balance.AccountNumber,
+		balance.BalanceDate,
+		balance.Balance,
+		balance.Currency,
+		balance.Source,
+	)
+	return err
+}
@@ -0,0 +1,182 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+
+	"reconciliation-service/internal/models"
+)
+
+var ErrBudgetNotFound = errors.New("budget not found")
+
+type BudgetRepository interface {
+	SaveBudgets(budgets []*models.Budget) error
+	ListBudgets(period, kind string) ([]*models.Budget, error)
+	DeleteBudget(id int64) error
+	GetVariances(period, kind, accountNumber, fromDate, toDate string) ([]*models.BudgetVariance, error)
+}
+
+type budgetRepository struct {
+	db *sql.DB
+	// tenant whose bank transactions budgets are compared with
+	tenant string
+}
+
+func NewBudgetRepository(db *sql.DB, tenant string) BudgetRepository {
+	return &budgetRepository{db: db, tenant: tenant}
+}
+
+// SaveBudgets stores budgets in one transaction, replacing the figure of an
+// account, period and kind already uploaded
+func (r *budgetRepository) SaveBudgets(budgets []*models.Budget) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, budget := range budgets {
+		_, err := tx.Exec(`
+			INSERT INTO budgets (account_number, period, kind, amount, currency, updated_by)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE
+				amount = VALUES(amount),
+				currency = VALUES(currency),
+				updated_by = VALUES(updated_by)
+		`,
+			budget.AccountNumber,
+			budget.Period,
+			budget.Kind,
+			budget.Amount,
+			budget.Currency,
+			budget.UpdatedBy,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ListBudgets returns the budgets by period and account, optionally of one
+// period or kind
+func (r *budgetRepository) ListBudgets(period, kind string) ([]*models.Budget, error) {
+	query := `
+		SELECT id, account_number, period, kind, amount, currency, updated_by, created_at, updated_at
+		FROM budgets
+		WHERE 1 = 1`
+	var args []interface{}
+	if period != "" {
+		query += ` AND period = ?`
+		args = append(args, period)
+	}
+	if kind != "" {
+		query += ` AND kind = ?`
+		args = append(args, kind)
+	}
+	query += ` ORDER BY period, account_number, kind`
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	budgets := []*models.Budget{}
+	for rows.Next() {
+		budget := &models.Budget{}
+		err := rows.Scan(
+			&budget.ID,
+			&budget.AccountNumber,
+			&budget.Period,
+			&budget.Kind,
+			&budget.Amount,
+			&budget.Currency,
+			&budget.UpdatedBy,
+			&budget.CreatedAt,
+			&budget.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		budgets = append(budgets, budget)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return budgets, nil
+}
+
+func (r *budgetRepository) DeleteBudget(id int64) error {
+	result, err := r.db.Exec("DELETE FROM budgets WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrBudgetNotFound
+	}
+	return nil
+}
+
+// GetVariances sums, for every budget of a period and kind, the bank
+// transactions of its account dated between two dates, and the part of them
+// mapped in a matched reconciliation. Variance and percentage are left to the
+// caller.
+func (r *budgetRepository) GetVariances(period, kind, accountNumber, fromDate, toDate string) ([]*models.BudgetVariance, error) {
+	query := `
+		SELECT b.account_number, b.period, b.kind, b.currency, b.amount,
+		       COALESCE(SUM(bt.amount), 0),
+		       COALESCE(SUM(CASE WHEN EXISTS (
+		           SELECT 1 FROM reconciliation_mappings rm
+		           JOIN reconciliations r ON r.id = rm.reconciliation_id
+		           WHERE rm.bank_transaction_id = bt.id AND r.status = ?
+		       ) THEN bt.amount ELSE 0 END), 0),
+		       COUNT(bt.id)
+		FROM budgets b
+		LEFT JOIN bank_transactions bt
+		       ON bt.account_number = b.account_number
+		      AND bt.tenant_id = ?
+		      AND bt.transaction_date BETWEEN ? AND ?
+		WHERE b.period = ? AND b.kind = ?`
+	args := []interface{}{models.StatusMatched, r.tenant, fromDate, toDate, period, kind}
+	if accountNumber != "" {
+		query += ` AND b.account_number = ?`
+		args = append(args, accountNumber)
+	}
+	query += `
+		GROUP BY b.id, b.account_number, b.period, b.kind, b.currency, b.amount
+		ORDER BY b.account_number`
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	variances := []*models.BudgetVariance{}
+	for rows.Next() {
+		variance := &models.BudgetVariance{}
+		err := rows.Scan(
+			&variance.AccountNumber,
+			&variance.Period,
+			&variance.Kind,
+			&variance.Currency,
+			&variance.Budget,
+			&variance.Actual,
+			&variance.Reconciled,
+			&variance.Transactions,
+		)
+		if err != nil {
+			return nil, err
+		}
+		variances = append(variances, variance)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return variances, nil
+}
@@ -0,0 +1,231 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"reconciliation-service/internal/models"
+)
+
+var ErrCalendarNotFound = errors.New("calendar not found")
+
+type CalendarRepository interface {
+	CreateCalendar(cal *models.BusinessCalendar) error
+	GetCalendar(code string) (*models.BusinessCalendar, error)
+	ListCalendars() ([]*models.BusinessCalendar, error)
+	UpdateCalendar(cal *models.BusinessCalendar) error
+	DeleteCalendar(code string) error
+	AddHoliday(calendarID int64, holiday models.CalendarHoliday) error
+	DeleteHoliday(calendarID int64, date string) error
+	ReplaceYearHolidays(calendarID int64, year int, holidays []models.CalendarHoliday) error
+}
+
+type calendarRepository struct {
+	db *sql.DB
+}
+
+func NewCalendarRepository(db *sql.DB) CalendarRepository {
+	return &calendarRepository{db: db}
+}
+
+func (r *calendarRepository) CreateCalendar(cal *models.BusinessCalendar) error {
+	weekend, err := json.Marshal(cal.WeekendDays)
+	if err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO business_calendars (code, country, name, weekend_days)
+		VALUES (?, ?, ?, ?)
+	`
+	result, err := r.db.Exec(query, cal.Code, cal.Country, cal.Name, weekend)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	cal.ID = id
+	return nil
+}
+
+// GetCalendar returns the calendar with all of its holidays
+func (r *calendarRepository) GetCalendar(code string) (*models.BusinessCalendar, error) {
+	cal := &models.BusinessCalendar{}
+	var weekend []byte
+	query := `
+		SELECT id, code, country, name, weekend_days, created_at, updated_at
+		FROM business_calendars
+		WHERE code = ?
+	`
+	err := r.db.QueryRow(query, code).Scan(
+		&cal.ID,
+		&cal.Code,
+		&cal.Country,
+		&cal.Name,
+		&weekend,
+		&cal.CreatedAt,
+		&cal.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrCalendarNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(weekend, &cal.WeekendDays); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(`
+		SELECT DATE_FORMAT(holiday_date, '%Y-%m-%d'), name
+		FROM calendar_holidays
+		WHERE calendar_id = ?
+		ORDER BY holiday_date
+	`, cal.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var holiday models.CalendarHoliday
+		if err := rows.Scan(&holiday.Date, &holiday.Name); err != nil {
+			return nil, err
+		}
+		cal.Holidays = append(cal.Holidays, holiday)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return cal, nil
+}
+
+// ListCalendars returns all calendars without their holidays
+func (r *calendarRepository) ListCalendars() ([]*models.BusinessCalendar, error) {
+	query := `
+		SELECT id, code, country, name, weekend_days, created_at, updated_at
+		FROM business_calendars
+		ORDER BY code
+	`
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var calendars []*models.BusinessCalendar
+	for rows.Next() {
+		cal := &models.BusinessCalendar{}
+		var weekend []byte
+		err := rows.Scan(
+			&cal.ID,
+			&cal.Code,
+			&cal.Country,
+			&cal.Name,
+			&weekend,
+			&cal.CreatedAt,
+			&cal.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(weekend, &cal.WeekendDays); err != nil {
+			return nil, err
+		}
+		calendars = append(calendars, cal)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return calendars, nil
+}
+
+func (r *calendarRepository) UpdateCalendar(cal *models.BusinessCalendar) error {
+	weekend, err := json.Marshal(cal.WeekendDays)
+	if err != nil {
+		return err
+	}
+	query := `
+		UPDATE business_calendars
+		SET country = ?, name = ?, weekend_days = ?
+		WHERE id = ?
+	`
+	_, err = r.db.Exec(query, cal.Country, cal.Name, weekend, cal.ID)
+	return err
+}
+
+func (r *calendarRepository) DeleteCalendar(code string) error {
+	result, err := r.db.Exec("DELETE FROM business_calendars WHERE code = ?", code)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrCalendarNotFound
+	}
+	return nil
+}
+
+// AddHoliday inserts a holiday, renaming it when the date already exists
+func (r *calendarRepository) AddHoliday(calendarID int64, holiday models.CalendarHoliday) error {
+	query := `
+		INSERT INTO calendar_holidays (calendar_id, holiday_date, name)
+		VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE name = VALUES(name)
+	`
+	_, err := r.db.Exec(query, calendarID, holiday.Date, holiday.Name)
+	return err
+}
+
+func (r *calendarRepository) DeleteHoliday(calendarID int64, date string) error {
+	result, err := r.db.Exec("DELETE FROM calendar_holidays WHERE calendar_id = ? AND holiday_date = ?", calendarID, date)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errors.New("holiday not found")
+	}
+	return nil
+}
+
+// ReplaceYearHolidays swaps every holiday of the year for the given list in
+// one transaction, so an import never leaves a half-loaded year behind
+func (r *calendarRepository) ReplaceYearHolidays(calendarID int64, year int, holidays []models.CalendarHoliday) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM calendar_holidays WHERE calendar_id = ? AND YEAR(holiday_date) = ?", calendarID, year)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO calendar_holidays (calendar_id, holiday_date, name)
+		VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE name = VALUES(name)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, holiday := range holidays {
+		if _, err := stmt.Exec(calendarID, holiday.Date, holiday.Name); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
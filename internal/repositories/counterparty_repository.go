@@ -0,0 +1,334 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+
+	"reconciliation-service/internal/models"
+)
+
+var (
+	ErrCounterpartyNotFound = errors.New("counterparty not found")
+
+	// ErrCounterpartyConflict means the code, an alias or an IBAN already
+	// belongs to another counterparty
+	ErrCounterpartyConflict = errors.New("counterparty code, alias or IBAN already in use")
+)
+
+type CounterpartyRepository interface {
+	CreateCounterparty(cp *models.Counterparty) error
+	GetCounterparty(code string) (*models.Counterparty, error)
+	ListCounterparties() ([]*models.Counterparty, error)
+	UpdateCounterparty(cp *models.Counterparty) error
+	DeleteCounterparty(code string) error
+	GetExpectedLags() (map[int64]int, error)
+	EnrichFromBatch(batchID string) error
+}
+
+type counterpartyRepository struct {
+	db *sql.DB
+	// tenant whose batches counterparties learn from
+	tenant string
+}
+
+func NewCounterpartyRepository(db *sql.DB, tenant string) CounterpartyRepository {
+	return &counterpartyRepository{db: db, tenant: tenant}
+}
+
+// CreateCounterparty stores the counterparty with its aliases, IBANs and
+// default accounts in one transaction
+func (r *counterpartyRepository) CreateCounterparty(cp *models.Counterparty) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO counterparties (code, name, expected_lag_days)
+		VALUES (?, ?, ?)
+	`, cp.Code, cp.Name, cp.ExpectedLagDays)
+	if err != nil {
+		return counterpartyWriteError(err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	if err := insertCounterpartyDetails(tx, id, cp); err != nil {
+		return counterpartyWriteError(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	cp.ID = id
+	return nil
+}
+
+// UpdateCounterparty replaces the name, lag and every alias, IBAN and default
+// account of an existing counterparty
+func (r *counterpartyRepository) UpdateCounterparty(cp *models.Counterparty) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE counterparties
+		SET name = ?, expected_lag_days = ?
+		WHERE id = ?
+	`, cp.Name, cp.ExpectedLagDays, cp.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"counterparty_aliases", "counterparty_ibans", "counterparty_accounts"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE counterparty_id = ?", cp.ID); err != nil {
+			return err
+		}
+	}
+	if err := insertCounterpartyDetails(tx, cp.ID, cp); err != nil {
+		return counterpartyWriteError(err)
+	}
+	return tx.Commit()
+}
+
+func insertCounterpartyDetails(tx *sql.Tx, id int64, cp *models.Counterparty) error {
+	for _, alias := range cp.Aliases {
+		if _, err := tx.Exec("INSERT INTO counterparty_aliases (counterparty_id, alias) VALUES (?, ?)", id, alias); err != nil {
+			return err
+		}
+	}
+	for _, iban := range cp.IBANs {
+		if _, err := tx.Exec("INSERT INTO counterparty_ibans (counterparty_id, iban) VALUES (?, ?)", id, iban); err != nil {
+			return err
+		}
+	}
+	for _, account := range cp.DefaultAccounts {
+		if _, err := tx.Exec("INSERT INTO counterparty_accounts (counterparty_id, account_code) VALUES (?, ?)", id, account); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func counterpartyWriteError(err error) error {
+	if IsDuplicateEntry(err) {
+		return ErrCounterpartyConflict
+	}
+	return err
+}
+
+// GetCounterparty returns the counterparty with all of its details
+func (r *counterpartyRepository) GetCounterparty(code string) (*models.Counterparty, error) {
+	cp := &models.Counterparty{}
+	err := r.db.QueryRow(`
+		SELECT id, code, name, expected_lag_days, created_at, updated_at
+		FROM counterparties
+		WHERE code = ?
+	`, code).Scan(
+		&cp.ID,
+		&cp.Code,
+		&cp.Name,
+		&cp.ExpectedLagDays,
+		&cp.CreatedAt,
+		&cp.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrCounterpartyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.loadDetails(map[int64]*models.Counterparty{cp.ID: cp}, "WHERE counterparty_id = ?", cp.ID); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// ListCounterparties returns every counterparty with its details, which
+// ingestion needs in full to resolve counterparties from names and IBANs
+func (r *counterpartyRepository) ListCounterparties() ([]*models.Counterparty, error) {
+	rows, err := r.db.Query(`
+		SELECT id, code, name, expected_lag_days, created_at, updated_at
+		FROM counterparties
+		ORDER BY code
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counterparties := []*models.Counterparty{}
+	byID := make(map[int64]*models.Counterparty)
+	for rows.Next() {
+		cp := &models.Counterparty{}
+		err := rows.Scan(
+			&cp.ID,
+			&cp.Code,
+			&cp.Name,
+			&cp.ExpectedLagDays,
+			&cp.CreatedAt,
+			&cp.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		counterparties = append(counterparties, cp)
+		byID[cp.ID] = cp
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := r.loadDetails(byID, ""); err != nil {
+		return nil, err
+	}
+	return counterparties, nil
+}
+
+// loadDetails fills in the aliases, IBANs and default accounts of the given
+// counterparties from the child rows matching where
+func (r *counterpartyRepository) loadDetails(byID map[int64]*models.Counterparty, where string, args ...interface{}) error {
+	for _, cp := range byID {
+		cp.Aliases = []string{}
+		cp.IBANs = []string{}
+		cp.DefaultAccounts = []string{}
+	}
+
+	details := []struct {
+		query  string
+		target func(cp *models.Counterparty) *[]string
+	}{
+		{"SELECT counterparty_id, alias FROM counterparty_aliases " + where + " ORDER BY alias",
+			func(cp *models.Counterparty) *[]string { return &cp.Aliases }},
+		{"SELECT counterparty_id, iban FROM counterparty_ibans " + where + " ORDER BY iban",
+			func(cp *models.Counterparty) *[]string { return &cp.IBANs }},
+		{"SELECT counterparty_id, account_code FROM counterparty_accounts " + where + " ORDER BY account_code",
+			func(cp *models.Counterparty) *[]string { return &cp.DefaultAccounts }},
+	}
+	for _, detail := range details {
+		rows, err := r.db.Query(detail.query, args...)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var id int64
+			var value string
+			if err := rows.Scan(&id, &value); err != nil {
+				rows.Close()
+				return err
+			}
+			if cp, ok := byID[id]; ok {
+				target := detail.target(cp)
+				*target = append(*target, value)
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteCounterparty removes the counterparty and its details; records that
+// referenced it keep their data but lose the link
+func (r *counterpartyRepository) DeleteCounterparty(code string) error {
+	result, err := r.db.Exec("DELETE FROM counterparties WHERE code = ?", code)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrCounterpartyNotFound
+	}
+	return nil
+}
+
+// GetExpectedLags maps counterparty IDs to their expected lag, leaving out
+// counterparties without one
+func (r *counterpartyRepository) GetExpectedLags() (map[int64]int, error) {
+	rows, err := r.db.Query("SELECT id, expected_lag_days FROM counterparties WHERE expected_lag_days <> 0")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lags := make(map[int64]int)
+	for rows.Next() {
+		var id int64
+		var lag int
+		if err := rows.Scan(&id, &lag); err != nil {
+			return nil, err
+		}
+		lags[id] = lag
+	}
+	return lags, rows.Err()
+}
+
+// batchMatchedPairs joins the matched bank transaction and accounting entry
+// pairs of one batch
+const batchMatchedPairs = `
+		reconciliation_mappings rm
+		JOIN reconciliations r ON r.id = rm.reconciliation_id
+		JOIN bank_transactions bt ON bt.id = rm.bank_transaction_id
+		JOIN accounting_entries ae ON ae.id = rm.accounting_entry_id`
+
+// EnrichFromBatch learns from the matched pairs of a batch: a side without a
+// counterparty takes the one of the side it matched, and the counterparty
+// picks up the pair's IBANs and the entry's account as a default account. An
+// IBAN already known for another counterparty stays with that one.
+func (r *counterpartyRepository) EnrichFromBatch(batchID string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		`UPDATE ` + batchMatchedPairs + `
+		SET bt.counterparty_id = ae.counterparty_id, bt.version = bt.version + 1
+		WHERE r.tenant_id = ? AND r.reconciliation_batch_id = ? AND r.status = 'matched'
+		AND bt.counterparty_id IS NULL AND ae.counterparty_id IS NOT NULL`,
+
+		`UPDATE ` + batchMatchedPairs + `
+		SET ae.counterparty_id = bt.counterparty_id, ae.version = ae.version + 1
+		WHERE r.tenant_id = ? AND r.reconciliation_batch_id = ? AND r.status = 'matched'
+		AND ae.counterparty_id IS NULL AND bt.counterparty_id IS NOT NULL`,
+
+		`INSERT INTO counterparty_ibans (counterparty_id, iban)
+		SELECT DISTINCT bt.counterparty_id, bt.counterparty_iban
+		FROM ` + batchMatchedPairs + `
+		WHERE r.tenant_id = ? AND r.reconciliation_batch_id = ? AND r.status = 'matched'
+		AND bt.counterparty_id IS NOT NULL AND bt.counterparty_iban <> ''
+		ON DUPLICATE KEY UPDATE counterparty_ibans.counterparty_id = counterparty_ibans.counterparty_id`,
+
+		`INSERT INTO counterparty_ibans (counterparty_id, iban)
+		SELECT DISTINCT ae.counterparty_id, ae.counterparty_iban
+		FROM ` + batchMatchedPairs + `
+		WHERE r.tenant_id = ? AND r.reconciliation_batch_id = ? AND r.status = 'matched'
+		AND ae.counterparty_id IS NOT NULL AND ae.counterparty_iban <> ''
+		ON DUPLICATE KEY UPDATE counterparty_ibans.counterparty_id = counterparty_ibans.counterparty_id`,
+
+		`INSERT INTO counterparty_accounts (counterparty_id, account_code)
+		SELECT DISTINCT ae.counterparty_id, ae.account_code
+		FROM ` + batchMatchedPairs + `
+		WHERE r.tenant_id = ? AND r.reconciliation_batch_id = ? AND r.status = 'matched'
+		AND ae.counterparty_id IS NOT NULL
+		ON DUPLICATE KEY UPDATE counterparty_accounts.counterparty_id = counterparty_accounts.counterparty_id`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, r.tenant, batchID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
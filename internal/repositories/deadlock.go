@@ -0,0 +1,47 @@
+package repositories
+
+import (
+	"errors"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// mysqlDeadlock is ER_LOCK_DEADLOCK: InnoDB picked this transaction as the
+// deadlock victim and rolled it back
+const mysqlDeadlock = 1213
+
+// IsDeadlock reports whether err means the transaction was rolled back to
+// break a deadlock and can be retried from the start
+func IsDeadlock(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDeadlock
+}
+
+// mysqlDuplicateEntry is ER_DUP_ENTRY: the row would repeat a unique key
+const mysqlDuplicateEntry = 1062
+
+// IsDuplicateEntry reports whether err is a unique key violation
+func IsDuplicateEntry(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry
+}
+
+// mysqlNoReferencedRow is ER_NO_REFERENCED_ROW_2: a foreign key names a row
+// that does not exist
+const mysqlNoReferencedRow = 1452
+
+// IsForeignKeyViolation reports whether err is a foreign key naming a
+// missing row
+func IsForeignKeyViolation(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlNoReferencedRow
+}
+
+// mysqlCheckViolated is ER_CHECK_CONSTRAINT_VIOLATED
+const mysqlCheckViolated = 3819
+
+// IsCheckViolation reports whether err is a CHECK constraint violation
+func IsCheckViolation(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlCheckViolated
+}
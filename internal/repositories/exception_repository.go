@@ -0,0 +1,400 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+
+	"reconciliation-service/internal/models"
+)
+
+var (
+	ErrExceptionNotFound = errors.New("exception not found")
+
+	// ErrExceptionConflict means the exception changed since the version the
+	// caller saw
+	ErrExceptionConflict = errors.New("exception was modified by another request")
+)
+
+type ExceptionRepository interface {
+	RaiseAged(cutoff string) (int, error)
+	ResolveMatched() (int, error)
+	GetException(id int64) (*models.ReconciliationException, error)
+	ListExceptions(status, owner, recordType, afterDate string, afterID int64, limit int) ([]*models.ReconciliationException, error)
+	ListForPeriod(fromDate, toDate string) ([]*models.ReconciliationException, error)
+	GetEvents(exceptionID int64) ([]*models.ExceptionEvent, error)
+	UpdateException(exception *models.ReconciliationException, version int, event *models.ExceptionEvent) error
+	CreateEvent(event *models.ExceptionEvent) error
+}
+
+type exceptionRepository struct {
+	db *sql.DB
+	// tenant whose aged records are raised
+	tenant string
+}
+
+func NewExceptionRepository(db *sql.DB, tenant string) ExceptionRepository {
+	return &exceptionRepository{db: db, tenant: tenant}
+}
+
+// RaiseAged queues the bank transactions and accounting entries without a
+// mapping dated before cutoff that have no exception yet, each with a
+// created event, and returns how many it queued
+func (r *exceptionRepository) RaiseAged(cutoff string) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	bankResult, err := tx.Exec(`
+		INSERT INTO reconciliation_exceptions (record_type, record_id, reference, account, amount, currency, record_date, status)
+		SELECT ?, bt.id, bt.transaction_id, bt.account_number, bt.amount, bt.currency, bt.transaction_date, ?
+		FROM bank_transactions bt
+		LEFT JOIN reconciliation_mappings rm ON rm.bank_transaction_id = bt.id
+		LEFT JOIN reconciliation_exceptions e ON e.record_type = ? AND e.record_id = bt.id
+		WHERE rm.id IS NULL AND e.id IS NULL AND bt.voided_at IS NULL AND bt.tenant_id = ? AND bt.transaction_date < ?
+	`, models.ExceptionRecordBankTransaction, models.ExceptionStatusNew, models.ExceptionRecordBankTransaction, r.tenant, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	entryResult, err := tx.Exec(`
+		INSERT INTO reconciliation_exceptions (record_type, record_id, reference, account, amount, currency, record_date, status)
+		SELECT ?, ae.id, ae.entry_id, ae.account_code, ae.amount, ae.currency, ae.entry_date, ?
+		FROM accounting_entries ae
+		LEFT JOIN reconciliation_mappings rm ON rm.accounting_entry_id = ae.id
+		LEFT JOIN reconciliation_exceptions e ON e.record_type = ? AND e.record_id = ae.id
+		WHERE rm.id IS NULL AND e.id IS NULL AND ae.voided_at IS NULL AND ae.tenant_id = ? AND ae.entry_date < ?
+	`, models.ExceptionRecordAccountingEntry, models.ExceptionStatusNew, models.ExceptionRecordAccountingEntry, r.tenant, cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	raised := 0
+	for _, result := range []sql.Result{bankResult, entryResult} {
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		raised += int(affected)
+	}
+	if raised == 0 {
+		return 0, nil
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO exception_events (exception_id, action, status_after)
+		SELECT e.id, ?, e.status
+		FROM reconciliation_exceptions e
+		LEFT JOIN exception_events ev ON ev.exception_id = e.id
+		WHERE ev.id IS NULL
+	`, models.ExceptionEventCreated); err != nil {
+		return 0, err
+	}
+	return raised, tx.Commit()
+}
+
+// ResolveMatched resolves the open exceptions whose record has been matched
+// or voided since they were raised, each with a transitioned event, and
+// returns how many it resolved
+func (r *exceptionRepository) ResolveMatched() (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	mapped := `EXISTS (
+		SELECT 1 FROM reconciliation_mappings rm
+		WHERE (e.record_type = ? AND rm.bank_transaction_id = e.record_id)
+		   OR (e.record_type = ? AND rm.accounting_entry_id = e.record_id)
+	)`
+	rows, err := tx.Query(`
+		SELECT e.id, e.status, `+mapped+`
+		FROM reconciliation_exceptions e
+		WHERE e.status IN (?, ?, ?)
+		  AND (`+mapped+`
+		       OR EXISTS (
+		           SELECT 1 FROM bank_transactions bt
+		           WHERE e.record_type = ? AND bt.id = e.record_id AND bt.voided_at IS NOT NULL
+		       )
+		       OR EXISTS (
+		           SELECT 1 FROM accounting_entries ae
+		           WHERE e.record_type = ? AND ae.id = e.record_id AND ae.voided_at IS NOT NULL
+		       ))
+		FOR UPDATE
+	`,
+		models.ExceptionRecordBankTransaction,
+		models.ExceptionRecordAccountingEntry,
+		models.ExceptionStatusNew,
+		models.ExceptionStatusInvestigating,
+		models.ExceptionStatusEscalated,
+		models.ExceptionRecordBankTransaction,
+		models.ExceptionRecordAccountingEntry,
+		models.ExceptionRecordBankTransaction,
+		models.ExceptionRecordAccountingEntry,
+	)
+	if err != nil {
+		return 0, err
+	}
+	var matched []*models.ExceptionEvent
+	for rows.Next() {
+		event := &models.ExceptionEvent{
+			Action:      models.ExceptionEventTransitioned,
+			StatusAfter: models.ExceptionStatusResolved,
+			Comment:     "record matched",
+		}
+		var recordMatched bool
+		if err := rows.Scan(&event.ExceptionID, &event.StatusBefore, &recordMatched); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if !recordMatched {
+			event.Comment = "record voided"
+		}
+		matched = append(matched, event)
+	}
+	if err := rows.Close(); err != nil {
+		return 0, err
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, event := range matched {
+		if _, err := tx.Exec(`
+			UPDATE reconciliation_exceptions
+			SET status = ?, closed_at = CURRENT_TIMESTAMP, version = version + 1
+			WHERE id = ?
+		`, models.ExceptionStatusResolved, event.ExceptionID); err != nil {
+			return 0, err
+		}
+		if err := createExceptionEvent(tx, event); err != nil {
+			return 0, err
+		}
+	}
+	return len(matched), tx.Commit()
+}
+
+const exceptionColumns = `
+	id, record_type, record_id, reference, account, amount, currency, record_date,
+	status, owner, version, closed_at, created_at, updated_at`
+
+func scanException(row rowScanner) (*models.ReconciliationException, error) {
+	exception := &models.ReconciliationException{}
+	var recordDate sql.NullTime
+	var closedAt sql.NullTime
+	err := row.Scan(
+		&exception.ID,
+		&exception.RecordType,
+		&exception.RecordID,
+		&exception.Reference,
+		&exception.Account,
+		&exception.Amount,
+		&exception.Currency,
+		&recordDate,
+		&exception.Status,
+		&exception.Owner,
+		&exception.Version,
+		&closedAt,
+		&exception.CreatedAt,
+		&exception.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if recordDate.Valid {
+		exception.RecordDate = recordDate.Time.Format("2006-01-02")
+	}
+	if closedAt.Valid {
+		exception.ClosedAt = &closedAt.Time
+	}
+	return exception, nil
+}
+
+func (r *exceptionRepository) GetException(id int64) (*models.ReconciliationException, error) {
+	exception, err := scanException(r.db.QueryRow(`SELECT `+exceptionColumns+` FROM reconciliation_exceptions WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrExceptionNotFound
+	}
+	return exception, err
+}
+
+// ListExceptions returns the oldest records first, optionally of one status,
+// owner or record type, from those after the record dated afterDate with ID
+// afterID when afterID is not zero
+func (r *exceptionRepository) ListExceptions(status, owner, recordType, afterDate string, afterID int64, limit int) ([]*models.ReconciliationException, error) {
+	query := `SELECT ` + exceptionColumns + ` FROM reconciliation_exceptions WHERE 1 = 1`
+	var args []interface{}
+	if status != "" {
+		query += ` AND status = ?`
+		args = append(args, status)
+	}
+	if owner != "" {
+		query += ` AND owner = ?`
+		args = append(args, owner)
+	}
+	if recordType != "" {
+		query += ` AND record_type = ?`
+		args = append(args, recordType)
+	}
+	if afterID > 0 {
+		query += ` AND (record_date > ? OR (record_date = ? AND id > ?))`
+		args = append(args, afterDate, afterDate, afterID)
+	}
+	query += ` ORDER BY record_date, id LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exceptions := []*models.ReconciliationException{}
+	for rows.Next() {
+		exception, err := scanException(rows)
+		if err != nil {
+			return nil, err
+		}
+		exceptions = append(exceptions, exception)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return exceptions, nil
+}
+
+// ListForPeriod returns the exceptions of records dated in the period, open
+// or closed
+func (r *exceptionRepository) ListForPeriod(fromDate, toDate string) ([]*models.ReconciliationException, error) {
+	rows, err := r.db.Query(`
+		SELECT `+exceptionColumns+`
+		FROM reconciliation_exceptions
+		WHERE record_date BETWEEN ? AND ?
+		ORDER BY record_date, id
+	`, fromDate, toDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var exceptions []*models.ReconciliationException
+	for rows.Next() {
+		exception, err := scanException(rows)
+		if err != nil {
+			return nil, err
+		}
+		exceptions = append(exceptions, exception)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return exceptions, nil
+}
+
+// GetEvents returns the audit trail of an exception in order
+func (r *exceptionRepository) GetEvents(exceptionID int64) ([]*models.ExceptionEvent, error) {
+	rows, err := r.db.Query(`
+		SELECT id, exception_id, action, status_before, status_after, owner, COALESCE(comment, ''), user_id, created_at
+		FROM exception_events
+		WHERE exception_id = ?
+		ORDER BY id
+	`, exceptionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*models.ExceptionEvent{}
+	for rows.Next() {
+		event := &models.ExceptionEvent{}
+		err := rows.Scan(
+			&event.ID,
+			&event.ExceptionID,
+			&event.Action,
+			&event.StatusBefore,
+			&event.StatusAfter,
+			&event.Owner,
+			&event.Comment,
+			&event.UserID,
+			&event.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// UpdateException stores the status, owner and closing time of an exception
+// still at version, together with the event recording the change, and bumps
+// its version
+func (r *exceptionRepository) UpdateException(exception *models.ReconciliationException, version int, event *models.ExceptionEvent) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE reconciliation_exceptions
+		SET status = ?, owner = ?, closed_at = ?, version = version + 1
+		WHERE id = ? AND version = ?
+	`, exception.Status, exception.Owner, exception.ClosedAt, exception.ID, version)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		var exists bool
+		if err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM reconciliation_exceptions WHERE id = ?)`, exception.ID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return ErrExceptionNotFound
+		}
+		return ErrExceptionConflict
+	}
+	exception.Version = version + 1
+
+	event.ExceptionID = exception.ID
+	if err := createExceptionEvent(tx, event); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *exceptionRepository) CreateEvent(event *models.ExceptionEvent) error {
+	return createExceptionEvent(r.db, event)
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func createExceptionEvent(db execer, event *models.ExceptionEvent) error {
+	result, err := db.Exec(`
+		INSERT INTO exception_events (exception_id, action, status_before, status_after, owner, comment, user_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`,
+		event.ExceptionID,
+		event.Action,
+		event.StatusBefore,
+		event.StatusAfter,
+		event.Owner,
+		event.Comment,
+		event.UserID,
+	)
+	if err != nil {
+		return err
+	}
+	event.ID, err = result.LastInsertId()
+	return err
+}
@@ -0,0 +1,284 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"reconciliation-service/internal/models"
+)
+
+var (
+	ErrExpectationNotFound = errors.New("expectation not found")
+
+	// ErrExpectationConflict means the source already registered an
+	// expectation under the external ID
+	ErrExpectationConflict = errors.New("expectation already registered")
+)
+
+type ExpectationRepository interface {
+	CreateExpectation(expectation *models.ExpectedPayment) error
+	GetExpectation(id int64) (*models.ExpectedPayment, error)
+	ListExpectations(status, source string, beforeID int64, limit int) ([]*models.ExpectedPayment, error)
+	ListOpen(fromDate, toDate string) ([]*models.ExpectedPayment, error)
+	FulfilExpectation(tx *sql.Tx, id, bankTransactionID int64, batchID string) (bool, error)
+	CancelExpectation(id int64) (bool, error)
+	MarkMissed(before string) ([]*models.ExpectedPayment, error)
+}
+
+type expectationRepository struct {
+	db *sql.DB
+}
+
+func NewExpectationRepository(db *sql.DB) ExpectationRepository {
+	return &expectationRepository{db: db}
+}
+
+func (r *expectationRepository) CreateExpectation(expectation *models.ExpectedPayment) error {
+	result, err := r.db.Exec(`
+		INSERT INTO expected_payments (
+			source, external_id, direction, account_number, amount, currency,
+			reference, window_start, window_end, status, created_by
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		expectation.Source,
+		expectation.ExternalID,
+		expectation.Direction,
+		expectation.AccountNumber,
+		expectation.Amount,
+		expectation.Currency,
+		expectation.Reference,
+		expectation.WindowStart,
+		expectation.WindowEnd,
+		models.ExpectedStatusPending,
+		expectation.CreatedBy,
+	)
+	if IsDuplicateEntry(err) {
+		return ErrExpectationConflict
+	}
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	expectation.ID = id
+	return nil
+}
+
+const expectationColumns = `
+		id, source, external_id, direction, account_number, amount, currency,
+		reference, DATE_FORMAT(window_start, '%Y-%m-%d'), DATE_FORMAT(window_end, '%Y-%m-%d'),
+		status, bank_transaction_id, batch_id, matched_at, missed_at,
+		created_by, created_at, updated_at`
+
+func scanExpectation(row rowScanner) (*models.ExpectedPayment, error) {
+	expectation := &models.ExpectedPayment{}
+	var bankTransactionID sql.NullInt64
+	var matchedAt, missedAt sql.NullTime
+	err := row.Scan(
+		&expectation.ID,
+		&expectation.Source,
+		&expectation.ExternalID,
+		&expectation.Direction,
+		&expectation.AccountNumber,
+		&expectation.Amount,
+		&expectation.Currency,
+		&expectation.Reference,
+		&expectation.WindowStart,
+		&expectation.WindowEnd,
+		&expectation.Status,
+		&bankTransactionID,
+		&expectation.BatchID,
+		&matchedAt,
+		&missedAt,
+		&expectation.CreatedBy,
+		&expectation.CreatedAt,
+		&expectation.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	expectation.BankTransactionID = bankTransactionID.Int64
+	if matchedAt.Valid {
+		expectation.MatchedAt = &matchedAt.Time
+	}
+	if missedAt.Valid {
+		expectation.MissedAt = &missedAt.Time
+	}
+	return expectation, nil
+}
+
+func (r *expectationRepository) GetExpectation(id int64) (*models.ExpectedPayment, error) {
+	expectation, err := scanExpectation(r.db.QueryRow(`SELECT `+expectationColumns+` FROM expected_payments WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrExpectationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return expectation, nil
+}
+
+// ListExpectations returns the latest expectations, optionally of one status
+// or source, from those older than beforeID when it is not zero
+func (r *expectationRepository) ListExpectations(status, source string, beforeID int64, limit int) ([]*models.ExpectedPayment, error) {
+	query := `SELECT ` + expectationColumns + ` FROM expected_payments WHERE 1 = 1`
+	var args []interface{}
+	if status != "" {
+		query += ` AND status = ?`
+		args = append(args, status)
+	}
+	if source != "" {
+		query += ` AND source = ?`
+		args = append(args, source)
+	}
+	if beforeID > 0 {
+		query += ` AND id < ?`
+		args = append(args, beforeID)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, limit)
+	return r.queryExpectations(query, args...)
+}
+
+// ListOpen returns the pending and missed expectations whose window overlaps
+// two dates, the earliest window end first
+func (r *expectationRepository) ListOpen(fromDate, toDate string) ([]*models.ExpectedPayment, error) {
+	return r.queryExpectations(`
+		SELECT `+expectationColumns+`
+		FROM expected_payments
+		WHERE status IN (?, ?)
+		AND window_start <= ? AND window_end >= ?
+		ORDER BY window_end, id
+	`, models.ExpectedStatusPending, models.ExpectedStatusMissed, toDate, fromDate)
+}
+
+func (r *expectationRepository) queryExpectations(query string, args ...interface{}) ([]*models.ExpectedPayment, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	expectations := []*models.ExpectedPayment{}
+	for rows.Next() {
+		expectation, err := scanExpectation(rows)
+		if err != nil {
+			return nil, err
+		}
+		expectations = append(expectations, expectation)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return expectations, nil
+}
+
+// FulfilExpectation links an open expectation to the bank transaction that
+// fulfils it. It reports false when the expectation was closed meanwhile or
+// the transaction already fulfils another.
+func (r *expectationRepository) FulfilExpectation(tx *sql.Tx, id, bankTransactionID int64, batchID string) (bool, error) {
+	result, err := tx.Exec(`
+		UPDATE expected_payments
+		SET status = ?, bank_transaction_id = ?, batch_id = ?, matched_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND status IN (?, ?)
+	`,
+		models.ExpectedStatusMatched, bankTransactionID, batchID,
+		id, models.ExpectedStatusPending, models.ExpectedStatusMissed,
+	)
+	if IsDuplicateEntry(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// CancelExpectation withdraws an open expectation. It reports false when the
+// expectation exists but is already matched or cancelled.
+func (r *expectationRepository) CancelExpectation(id int64) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE expected_payments SET status = ?
+		WHERE id = ? AND status IN (?, ?)
+	`, models.ExpectedStatusCancelled, id, models.ExpectedStatusPending, models.ExpectedStatusMissed)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if affected == 0 {
+		if _, err := r.GetExpectation(id); err != nil {
+			return false, err
+		}
+	}
+	return affected > 0, nil
+}
+
+// MarkMissed marks the pending expectations whose window ended before a date
+// as missed and returns them
+func (r *expectationRepository) MarkMissed(before string) ([]*models.ExpectedPayment, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT id FROM expected_payments
+		WHERE status = ? AND window_end < ?
+		FOR UPDATE
+	`, models.ExpectedStatusPending, before)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	args := []interface{}{models.ExpectedStatusMissed, time.Now()}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	if _, err := tx.Exec(`
+		UPDATE expected_payments SET status = ?, missed_at = ?
+		WHERE id IN (`+placeholders(len(ids))+`)
+	`, args...); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	missed := make([]*models.ExpectedPayment, 0, len(ids))
+	for _, id := range ids {
+		expectation, err := r.GetExpectation(id)
+		if err != nil {
+			return nil, err
+		}
+		missed = append(missed, expectation)
+	}
+	return missed, nil
+}
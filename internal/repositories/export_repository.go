@@ -0,0 +1,157 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"reconciliation-service/internal/models"
+)
+
+var ErrExportNotFound = errors.New("export not found")
+
+type ExportRepository interface {
+	CreateExport(export *models.ExportJob) error
+	GetExport(id int64) (*models.ExportJob, error)
+	ClaimExport(instanceID string, staleBefore time.Time) (*models.ExportJob, error)
+	FinishExport(export *models.ExportJob) error
+	ReleaseExport(id int64) error
+}
+
+type exportRepository struct {
+	db *sql.DB
+}
+
+func NewExportRepository(db *sql.DB) ExportRepository {
+	return &exportRepository{db: db}
+}
+
+func (r *exportRepository) CreateExport(export *models.ExportJob) error {
+	result, err := r.db.Exec(`
+		INSERT INTO export_jobs (kind, format, params, locale, status, callback_url, requested_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`,
+		export.Kind,
+		export.Format,
+		[]byte(export.Params),
+		export.Locale,
+		export.Status,
+		export.CallbackURL,
+		export.RequestedBy,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	export.ID = id
+	return nil
+}
+
+func (r *exportRepository) GetExport(id int64) (*models.ExportJob, error) {
+	export := &models.ExportJob{}
+	var params []byte
+	var startedAt, finishedAt sql.NullTime
+	var artifactID sql.NullInt64
+	err := r.db.QueryRow(`
+		SELECT id, kind, format, params, locale, status, callback_url, requested_by,
+		       instance_id, object_key, size_bytes, COALESCE(error, ''),
+		       created_at, started_at, finished_at, artifact_id
+		FROM export_jobs
+		WHERE id = ?
+	`, id).Scan(
+		&export.ID,
+		&export.Kind,
+		&export.Format,
+		&params,
+		&export.Locale,
+		&export.Status,
+		&export.CallbackURL,
+		&export.RequestedBy,
+		&export.InstanceID,
+		&export.ObjectKey,
+		&export.SizeBytes,
+		&export.Error,
+		&export.CreatedAt,
+		&startedAt,
+		&finishedAt,
+		&artifactID,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrExportNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	export.Params = params
+	if startedAt.Valid {
+		export.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		export.FinishedAt = &finishedAt.Time
+	}
+	if artifactID.Valid {
+		export.ArtifactID = &artifactID.Int64
+	}
+	return export, nil
+}
+
+// ClaimExport takes the oldest queued export for this instance, or one whose
+// instance started it before staleBefore and has not finished it since. It
+// returns nil when there is none.
+func (r *exportRepository) ClaimExport(instanceID string, staleBefore time.Time) (*models.ExportJob, error) {
+	result, err := r.db.Exec(`
+		UPDATE export_jobs
+		SET id = LAST_INSERT_ID(id),
+		    status = ?,
+		    instance_id = ?,
+		    started_at = CURRENT_TIMESTAMP
+		WHERE status = ? OR (status = ? AND started_at < ?)
+		ORDER BY id
+		LIMIT 1
+	`,
+		models.ExportStatusRunning, instanceID,
+		models.ExportStatusQueued, models.ExportStatusRunning, staleBefore,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected == 0 {
+		return nil, nil
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return r.GetExport(id)
+}
+
+// FinishExport records the outcome of a running export
+func (r *exportRepository) FinishExport(export *models.ExportJob) error {
+	_, err := r.db.Exec(`
+		UPDATE export_jobs
+		SET status = ?, object_key = ?, size_bytes = ?, error = ?, finished_at = ?, artifact_id = ?
+		WHERE id = ?
+	`, export.Status, export.ObjectKey, export.SizeBytes, export.Error, export.FinishedAt, export.ArtifactID, export.ID)
+	return err
+}
+
+// ReleaseExport puts a running export back in the queue, such as when its
+// instance shuts down before finishing it
+func (r *exportRepository) ReleaseExport(id int64) error {
+	_, err := r.db.Exec(`
+		UPDATE export_jobs
+		SET status = ?, instance_id = '', started_at = NULL
+		WHERE id = ? AND status = ?
+	`, models.ExportStatusQueued, id, models.ExportStatusRunning)
+	return err
+}
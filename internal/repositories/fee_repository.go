@@ -0,0 +1,280 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+
+	"reconciliation-service/internal/models"
+)
+
+var (
+	ErrFeeScheduleNotFound = errors.New("fee schedule not found")
+
+	// ErrFeeScheduleConflict means the account already has a schedule of
+	// that name
+	ErrFeeScheduleConflict = errors.New("fee schedule already exists")
+)
+
+type FeeRepository interface {
+	CreateSchedule(schedule *models.FeeSchedule) error
+	UpdateSchedule(schedule *models.FeeSchedule) error
+	GetSchedule(id int64) (*models.FeeSchedule, error)
+	ListSchedules(accountNumber string, activeOnly bool) ([]*models.FeeSchedule, error)
+	DeleteSchedule(id int64) error
+	SaveCharge(tx *sql.Tx, charge *models.FeeCharge) error
+	ListCharges(period string) ([]*models.FeeCharge, error)
+	CountTransactions(accountNumber, fromDate, toDate string) (int, error)
+}
+
+type feeRepository struct {
+	db *sql.DB
+	// tenant whose transactions fees are counted over
+	tenant string
+}
+
+func NewFeeRepository(db *sql.DB, tenant string) FeeRepository {
+	return &feeRepository{db: db, tenant: tenant}
+}
+
+func (r *feeRepository) CreateSchedule(schedule *models.FeeSchedule) error {
+	result, err := r.db.Exec(`
+		INSERT INTO fee_schedules (
+			account_number, name, fee_type, amount, currency, tolerance,
+			description_pattern, active, updated_by
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		schedule.AccountNumber,
+		schedule.Name,
+		schedule.FeeType,
+		schedule.Amount,
+		schedule.Currency,
+		schedule.Tolerance,
+		schedule.DescriptionPattern,
+		schedule.Active,
+		schedule.UpdatedBy,
+	)
+	if IsDuplicateEntry(err) {
+		return ErrFeeScheduleConflict
+	}
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	schedule.ID = id
+	return nil
+}
+
+func (r *feeRepository) UpdateSchedule(schedule *models.FeeSchedule) error {
+	result, err := r.db.Exec(`
+		UPDATE fee_schedules
+		SET account_number = ?, name = ?, fee_type = ?, amount = ?, currency = ?,
+		    tolerance = ?, description_pattern = ?, active = ?, updated_by = ?
+		WHERE id = ?
+	`,
+		schedule.AccountNumber,
+		schedule.Name,
+		schedule.FeeType,
+		schedule.Amount,
+		schedule.Currency,
+		schedule.Tolerance,
+		schedule.DescriptionPattern,
+		schedule.Active,
+		schedule.UpdatedBy,
+		schedule.ID,
+	)
+	if IsDuplicateEntry(err) {
+		return ErrFeeScheduleConflict
+	}
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		// An update that changes nothing affects no rows either
+		if _, err := r.GetSchedule(schedule.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const feeScheduleColumns = `
+		id, account_number, name, fee_type, amount, currency, tolerance,
+		description_pattern, active, updated_by, created_at, updated_at`
+
+func scanFeeSchedule(row rowScanner) (*models.FeeSchedule, error) {
+	schedule := &models.FeeSchedule{}
+	err := row.Scan(
+		&schedule.ID,
+		&schedule.AccountNumber,
+		&schedule.Name,
+		&schedule.FeeType,
+		&schedule.Amount,
+		&schedule.Currency,
+		&schedule.Tolerance,
+		&schedule.DescriptionPattern,
+		&schedule.Active,
+		&schedule.UpdatedBy,
+		&schedule.CreatedAt,
+		&schedule.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+func (r *feeRepository) GetSchedule(id int64) (*models.FeeSchedule, error) {
+	schedule, err := scanFeeSchedule(r.db.QueryRow(`SELECT `+feeScheduleColumns+` FROM fee_schedules WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrFeeScheduleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+// ListSchedules returns the schedules by account and name, optionally of one
+// account or only the active ones
+func (r *feeRepository) ListSchedules(accountNumber string, activeOnly bool) ([]*models.FeeSchedule, error) {
+	query := `SELECT ` + feeScheduleColumns + ` FROM fee_schedules WHERE 1 = 1`
+	var args []interface{}
+	if accountNumber != "" {
+		query += ` AND account_number = ?`
+		args = append(args, accountNumber)
+	}
+	if activeOnly {
+		query += ` AND active = TRUE`
+	}
+	query += ` ORDER BY account_number, name`
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := []*models.FeeSchedule{}
+	for rows.Next() {
+		schedule, err := scanFeeSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+func (r *feeRepository) DeleteSchedule(id int64) error {
+	result, err := r.db.Exec("DELETE FROM fee_schedules WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrFeeScheduleNotFound
+	}
+	return nil
+}
+
+// SaveCharge records a recognized fee. A transaction recognized again, as
+// after its fee reconciliation was unmatched, is moved to the new batch.
+func (r *feeRepository) SaveCharge(tx *sql.Tx, charge *models.FeeCharge) error {
+	result, err := tx.Exec(`
+		INSERT INTO fee_charges (fee_schedule_id, bank_transaction_id, period, amount, reconciliation_id, batch_id)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			id = LAST_INSERT_ID(id),
+			fee_schedule_id = VALUES(fee_schedule_id),
+			period = VALUES(period),
+			amount = VALUES(amount),
+			reconciliation_id = VALUES(reconciliation_id),
+			batch_id = VALUES(batch_id)
+	`,
+		charge.FeeScheduleID,
+		charge.BankTransactionID,
+		charge.Period,
+		charge.Amount,
+		nullableID(charge.ReconciliationID),
+		charge.BatchID,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	charge.ID = id
+	return nil
+}
+
+// ListCharges returns the fees recognized in a period
+func (r *feeRepository) ListCharges(period string) ([]*models.FeeCharge, error) {
+	rows, err := r.db.Query(`
+		SELECT id, fee_schedule_id, bank_transaction_id, period, amount,
+		       reconciliation_id, batch_id, created_at
+		FROM fee_charges
+		WHERE period = ?
+		ORDER BY id
+	`, period)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	charges := []*models.FeeCharge{}
+	for rows.Next() {
+		charge := &models.FeeCharge{}
+		var reconciliationID sql.NullInt64
+		err := rows.Scan(
+			&charge.ID,
+			&charge.FeeScheduleID,
+			&charge.BankTransactionID,
+			&charge.Period,
+			&charge.Amount,
+			&reconciliationID,
+			&charge.BatchID,
+			&charge.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		charge.ReconciliationID = reconciliationID.Int64
+		charges = append(charges, charge)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return charges, nil
+}
+
+// CountTransactions counts the transactions of an account between two dates
+// that are not themselves recognized fees
+func (r *feeRepository) CountTransactions(accountNumber, fromDate, toDate string) (int, error) {
+	var count int
+	err := r.db.QueryRow(`
+		SELECT COUNT(*)
+		FROM bank_transactions bt
+		LEFT JOIN fee_charges fc ON fc.bank_transaction_id = bt.id
+		WHERE bt.tenant_id = ? AND bt.account_number = ?
+		AND bt.transaction_date BETWEEN ? AND ?
+		AND fc.id IS NULL
+	`, r.tenant, accountNumber, fromDate, toDate).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,100 @@
+package repositories
+
+import (
+	"database/sql"
+
+	"reconciliation-service/internal/models"
+)
+
+// FixtureRepository reads every record of a date range, reconciled or not,
+// for a fixture bundle
+type FixtureRepository interface {
+	ListBankTransactions(fromDate, toDate string, limit int) ([]*models.BankTransaction, error)
+	ListAccountingEntries(fromDate, toDate string, limit int) ([]*models.AccountingEntry, error)
+	ListMappedRecords(fromDate, toDate string) ([]*models.MappedRecord, error)
+}
+
+type fixtureRepository struct {
+	db     *sql.DB
+	tenant string
+}
+
+func NewFixtureRepository(db *sql.DB, tenant string) FixtureRepository {
+	return &fixtureRepository{db: db, tenant: tenant}
+}
+
+func (r *fixtureRepository) ListBankTransactions(fromDate, toDate string, limit int) ([]*models.BankTransaction, error) {
+	rows, err := r.db.Query(`
+		SELECT `+bankTransactionColumns+`
+		FROM bank_transactions bt
+		WHERE bt.tenant_id = ? AND bt.voided_at IS NULL AND bt.transaction_date BETWEEN ? AND ?
+		ORDER BY bt.id
+		LIMIT ?
+	`, r.tenant, fromDate, toDate, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanBankTransactions(rows)
+}
+
+func (r *fixtureRepository) ListAccountingEntries(fromDate, toDate string, limit int) ([]*models.AccountingEntry, error) {
+	rows, err := r.db.Query(`
+		SELECT `+accountingEntryColumns+`
+		FROM accounting_entries ae
+		WHERE ae.tenant_id = ? AND ae.voided_at IS NULL AND ae.entry_date BETWEEN ? AND ?
+		ORDER BY ae.id
+		LIMIT ?
+	`, r.tenant, fromDate, toDate, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanAccountingEntries(rows)
+}
+
+// ListMappedRecords lists the records of every live reconciliation that
+// maps a bank transaction or accounting entry dated in the range. Records
+// of such a reconciliation dated outside the range are listed too.
+func (r *fixtureRepository) ListMappedRecords(fromDate, toDate string) ([]*models.MappedRecord, error) {
+	rows, err := r.db.Query(`
+		SELECT r.id, r.reconciliation_batch_id, r.status, r.match_confidence, r.amount_difference,
+			rm.mapping_type, COALESCE(bt.transaction_id, ''), COALESCE(ae.entry_id, '')
+		FROM reconciliations r
+		JOIN reconciliation_mappings rm ON rm.reconciliation_id = r.id
+		LEFT JOIN bank_transactions bt ON bt.id = rm.bank_transaction_id
+		LEFT JOIN accounting_entries ae ON ae.id = rm.accounting_entry_id
+		WHERE r.tenant_id = ? AND r.status <> ? AND r.id IN (
+			SELECT m.reconciliation_id
+			FROM reconciliation_mappings m
+			LEFT JOIN bank_transactions mbt ON mbt.id = m.bank_transaction_id
+			LEFT JOIN accounting_entries mae ON mae.id = m.accounting_entry_id
+			WHERE mbt.transaction_date BETWEEN ? AND ? OR mae.entry_date BETWEEN ? AND ?
+		)
+		ORDER BY r.id, rm.id
+	`, r.tenant, models.StatusUnmatched, fromDate, toDate, fromDate, toDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []*models.MappedRecord
+	for rows.Next() {
+		record := &models.MappedRecord{}
+		if err := rows.Scan(
+			&record.ReconciliationID,
+			&record.BatchID,
+			&record.Status,
+			&record.MatchConfidence,
+			&record.AmountDifference,
+			&record.MappingType,
+			&record.TransactionID,
+			&record.EntryID,
+		); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
@@ -0,0 +1,117 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"reconciliation-service/internal/models"
+)
+
+var ErrFXRateNotFound = errors.New("exchange rate not found")
+
+type FXRateRepository interface {
+	SaveRate(rate *models.FXRate) error
+	GetRate(id int64) (*models.FXRate, error)
+	ListRates(fromCurrency, toCurrency string) ([]*models.FXRate, error)
+}
+
+type fxRateRepository struct {
+	db *sql.DB
+}
+
+func NewFXRateRepository(db *sql.DB) FXRateRepository {
+	return &fxRateRepository{db: db}
+}
+
+// SaveRate stores the rate of a currency pair for a day, replacing the rate
+// already stored for that day
+func (r *fxRateRepository) SaveRate(rate *models.FXRate) error {
+	result, err := r.db.Exec(`
+		INSERT INTO fx_rates (from_currency, to_currency, rate, rate_date, updated_by)
+		VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id), rate = VALUES(rate), updated_by = VALUES(updated_by)
+	`, rate.FromCurrency, rate.ToCurrency, rate.Rate, rate.RateDate, rate.UpdatedBy)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	rate.ID = id
+	return nil
+}
+
+const fxRateColumns = `
+		id, from_currency, to_currency, rate, DATE_FORMAT(rate_date, '%Y-%m-%d'),
+		updated_by, created_at, updated_at`
+
+func scanFXRate(row rowScanner) (*models.FXRate, error) {
+	rate := &models.FXRate{}
+	err := row.Scan(
+		&rate.ID,
+		&rate.FromCurrency,
+		&rate.ToCurrency,
+		&rate.Rate,
+		&rate.RateDate,
+		&rate.UpdatedBy,
+		&rate.CreatedAt,
+		&rate.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return rate, nil
+}
+
+func (r *fxRateRepository) GetRate(id int64) (*models.FXRate, error) {
+	rate, err := scanFXRate(r.db.QueryRow(`SELECT `+fxRateColumns+` FROM fx_rates WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrFXRateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rate, nil
+}
+
+// ListRates returns the stored rates, newest first, optionally limited to
+// one source or target currency
+func (r *fxRateRepository) ListRates(fromCurrency, toCurrency string) ([]*models.FXRate, error) {
+	query := `SELECT ` + fxRateColumns + ` FROM fx_rates`
+	var conditions []string
+	var args []interface{}
+	if fromCurrency != "" {
+		conditions = append(conditions, "from_currency = ?")
+		args = append(args, fromCurrency)
+	}
+	if toCurrency != "" {
+		conditions = append(conditions, "to_currency = ?")
+		args = append(args, toCurrency)
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY rate_date DESC, from_currency, to_currency"
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := []*models.FXRate{}
+	for rows.Next() {
+		rate, err := scanFXRate(rows)
+		if err != nil {
+			return nil, err
+		}
+		rates = append(rates, rate)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
@@ -0,0 +1,90 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"reconciliation-service/internal/models"
+)
+
+type HeartbeatRepository interface {
+	Beat(instanceID string, workers []*models.WorkerHeartbeat, at time.Time) error
+	RemoveWorker(instanceID, worker string) error
+	ListHeartbeats() ([]*models.WorkerHeartbeat, error)
+	PruneHeartbeats(before time.Time) (int64, error)
+}
+
+type heartbeatRepository struct {
+	db *sql.DB
+	// tenant whose workers and running jobs this instance beats for
+	tenant string
+}
+
+func NewHeartbeatRepository(db *sql.DB, tenant string) HeartbeatRepository {
+	return &heartbeatRepository{db: db, tenant: tenant}
+}
+
+// Beat records the workers as alive at at, and with them the tenant's jobs
+// the instance is running
+func (r *heartbeatRepository) Beat(instanceID string, workers []*models.WorkerHeartbeat, at time.Time) error {
+	for _, worker := range workers {
+		_, err := r.db.Exec(`
+			INSERT INTO worker_heartbeats (instance_id, worker, tenant_id, started_at, beat_at)
+			VALUES (?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE beat_at = VALUES(beat_at)
+		`, instanceID, worker.Worker, r.tenant, worker.StartedAt, at)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := r.db.Exec(`
+		UPDATE reconciliation_jobs
+		SET heartbeat_at = ?
+		WHERE tenant_id = ? AND instance_id = ? AND status = ?
+	`, at, r.tenant, instanceID, models.JobStatusRunning)
+	return err
+}
+
+// RemoveWorker forgets a worker that stopped
+func (r *heartbeatRepository) RemoveWorker(instanceID, worker string) error {
+	_, err := r.db.Exec(`
+		DELETE FROM worker_heartbeats
+		WHERE instance_id = ? AND worker = ? AND tenant_id = ?
+	`, instanceID, worker, r.tenant)
+	return err
+}
+
+// ListHeartbeats lists the workers of every instance and tenant, the longest
+// silent first
+func (r *heartbeatRepository) ListHeartbeats() ([]*models.WorkerHeartbeat, error) {
+	rows, err := r.db.Query(`
+		SELECT instance_id, worker, tenant_id, started_at, beat_at
+		FROM worker_heartbeats
+		ORDER BY beat_at, instance_id, worker, tenant_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var heartbeats []*models.WorkerHeartbeat
+	for rows.Next() {
+		heartbeat := &models.WorkerHeartbeat{}
+		err := rows.Scan(&heartbeat.InstanceID, &heartbeat.Worker, &heartbeat.Tenant, &heartbeat.StartedAt, &heartbeat.BeatAt)
+		if err != nil {
+			return nil, err
+		}
+		heartbeats = append(heartbeats, heartbeat)
+	}
+	return heartbeats, rows.Err()
+}
+
+// PruneHeartbeats deletes the workers of every instance silent since before,
+// left by instances that are gone
+func (r *heartbeatRepository) PruneHeartbeats(before time.Time) (int64, error) {
+	result, err := r.db.Exec(`DELETE FROM worker_heartbeats WHERE beat_at < ?`, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
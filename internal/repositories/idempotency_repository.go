@@ -0,0 +1,126 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"reconciliation-service/internal/models"
+)
+
+var (
+	ErrIdempotencyKeyNotFound = errors.New("idempotency key not found")
+	// ErrIdempotencyKeyExists means the caller already holds the key
+	ErrIdempotencyKeyExists = errors.New("idempotency key already exists")
+)
+
+// pruneBatch bounds the expired keys deleted alongside each new one
+const pruneBatch = 100
+
+type IdempotencyRepository interface {
+	CreateKey(key *models.IdempotencyKey) error
+	GetKey(caller, key string) (*models.IdempotencyKey, error)
+	CompleteKey(id int64, batchID string, status int, response []byte) error
+	DeleteKey(id int64) error
+}
+
+type idempotencyRepository struct {
+	db *sql.DB
+}
+
+func NewIdempotencyRepository(db *sql.DB) IdempotencyRepository {
+	return &idempotencyRepository{db: db}
+}
+
+// CreateKey stores a pending key. An expired key of the same caller and
+// name is replaced, and a few other expired keys are pruned on the way.
+func (r *idempotencyRepository) CreateKey(key *models.IdempotencyKey) error {
+	now := time.Now()
+	if _, err := r.db.Exec(`
+		DELETE FROM idempotency_keys
+		WHERE caller = ? AND idempotency_key = ? AND expires_at < ?
+	`, key.Caller, key.Key, now); err != nil {
+		return err
+	}
+	if _, err := r.db.Exec(`DELETE FROM idempotency_keys WHERE expires_at < ? LIMIT ?`, now, pruneBatch); err != nil {
+		return err
+	}
+
+	result, err := r.db.Exec(`
+		INSERT INTO idempotency_keys (caller, idempotency_key, operation, request_hash, status, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`,
+		key.Caller,
+		key.Key,
+		key.Operation,
+		key.RequestHash,
+		models.IdempotencyStatusPending,
+		key.ExpiresAt,
+	)
+	if IsDuplicateEntry(err) {
+		return ErrIdempotencyKeyExists
+	}
+	if err != nil {
+		return err
+	}
+	key.ID, err = result.LastInsertId()
+	key.Status = models.IdempotencyStatusPending
+	return err
+}
+
+func (r *idempotencyRepository) GetKey(caller, key string) (*models.IdempotencyKey, error) {
+	record := &models.IdempotencyKey{}
+	var batchID sql.NullString
+	var responseStatus sql.NullInt64
+	var response sql.NullString
+	var completedAt sql.NullTime
+	err := r.db.QueryRow(`
+		SELECT id, caller, idempotency_key, operation, request_hash, status,
+			reconciliation_batch_id, response_status, response, created_at, completed_at, expires_at
+		FROM idempotency_keys
+		WHERE caller = ? AND idempotency_key = ?
+	`, caller, key).Scan(
+		&record.ID,
+		&record.Caller,
+		&record.Key,
+		&record.Operation,
+		&record.RequestHash,
+		&record.Status,
+		&batchID,
+		&responseStatus,
+		&response,
+		&record.CreatedAt,
+		&completedAt,
+		&record.ExpiresAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrIdempotencyKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	record.BatchID = batchID.String
+	record.ResponseStatus = int(responseStatus.Int64)
+	if response.Valid {
+		record.Response = []byte(response.String)
+	}
+	if completedAt.Valid {
+		record.CompletedAt = &completedAt.Time
+	}
+	return record, nil
+}
+
+// CompleteKey stores the response a pending key's request got
+func (r *idempotencyRepository) CompleteKey(id int64, batchID string, status int, response []byte) error {
+	_, err := r.db.Exec(`
+		UPDATE idempotency_keys
+		SET status = ?, reconciliation_batch_id = ?, response_status = ?, response = ?, completed_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND status = ?
+	`, models.IdempotencyStatusCompleted, batchID, status, string(response), id, models.IdempotencyStatusPending)
+	return err
+}
+
+func (r *idempotencyRepository) DeleteKey(id int64) error {
+	_, err := r.db.Exec(`DELETE FROM idempotency_keys WHERE id = ?`, id)
+	return err
+}
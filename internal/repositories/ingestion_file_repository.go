@@ -0,0 +1,307 @@
+package repositories
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+	"unicode/utf8"
+
+	"reconciliation-service/internal/models"
+)
+
+type IngestionFileRepository interface {
+	ClaimFile(file *models.IngestionFile, staleBefore time.Time) (bool, error)
+	FinishFile(file *models.IngestionFile) error
+	ListFiles(status string, beforeID int64, limit int) ([]*models.IngestionFile, error)
+	ProcessedObjects(bucket, prefix string) (map[string]string, error)
+	RecordObject(bucket, key, etag string, fileID int64) error
+	RecordEmail(email *models.IngestionEmail) error
+	ListEmails(status string, beforeID int64, limit int) ([]*models.IngestionEmail, error)
+	LastSequence(accountNumber string) (int64, bool, error)
+	RecordSequence(accountNumber string, sequence, fileID int64) error
+	FeedActivity(source string, since time.Time) (int, int, error)
+}
+
+type ingestionFileRepository struct {
+	db *sql.DB
+}
+
+func NewIngestionFileRepository(db *sql.DB) IngestionFileRepository {
+	return &ingestionFileRepository{db: db}
+}
+
+// ClaimFile records a file as being processed, keyed on its checksum, and
+// reports whether the caller got to process it. Content seen before is
+// claimed again only when it failed, or when whoever was processing it has
+// not finished since staleBefore. Otherwise file is filled in with the
+// stored row, so the caller can tell what became of it.
+func (r *ingestionFileRepository) ClaimFile(file *models.IngestionFile, staleBefore time.Time) (bool, error) {
+	result, err := r.db.Exec(`
+		INSERT INTO ingestion_files (source, file_name, checksum, size, status)
+		VALUES (?, ?, ?, ?, ?)
+	`, file.Source, file.FileName, file.Checksum, file.Size, models.IngestionFileProcessing)
+	if err == nil {
+		file.ID, err = result.LastInsertId()
+		file.Status = models.IngestionFileProcessing
+		return err == nil, err
+	}
+	if !IsDuplicateEntry(err) {
+		return false, err
+	}
+
+	result, err = r.db.Exec(`
+		UPDATE ingestion_files
+		SET source = ?, file_name = ?, size = ?, status = ?, error = NULL, updated_at = ?
+		WHERE checksum = ? AND (status = ? OR (status = ? AND updated_at < ?))
+	`, file.Source, file.FileName, file.Size, models.IngestionFileProcessing, time.Now(),
+		file.Checksum, models.IngestionFileFailed, models.IngestionFileProcessing, staleBefore)
+	if err != nil {
+		return false, err
+	}
+	claimed, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	stored, err := scanIngestionFile(r.db.QueryRow(`SELECT `+ingestionFileColumns+` FROM ingestion_files WHERE checksum = ?`, file.Checksum))
+	if err != nil {
+		return false, err
+	}
+	*file = *stored
+	return claimed == 1, nil
+}
+
+// FinishFile records what became of a claimed file
+func (r *ingestionFileRepository) FinishFile(file *models.IngestionFile) error {
+	var fileError, jobID interface{}
+	if file.Error != "" {
+		fileError = file.Error
+	}
+	if file.JobID != 0 {
+		jobID = file.JobID
+	}
+	_, err := r.db.Exec(`
+		UPDATE ingestion_files
+		SET format = ?, status = ?, records = ?, quality_score = ?, error = ?, archived_path = ?, job_id = ?, updated_at = ?
+		WHERE id = ?
+	`, file.Format, file.Status, file.Records, file.QualityScore, fileError, file.ArchivedPath, jobID, time.Now(), file.ID)
+	return err
+}
+
+// ListFiles lists files newest first, optionally of one status, below
+// beforeID when it is set
+func (r *ingestionFileRepository) ListFiles(status string, beforeID int64, limit int) ([]*models.IngestionFile, error) {
+	query := `SELECT ` + ingestionFileColumns + ` FROM ingestion_files WHERE 1 = 1`
+	var args []interface{}
+	if status != "" {
+		query += ` AND status = ?`
+		args = append(args, status)
+	}
+	if beforeID != 0 {
+		query += ` AND id < ?`
+		args = append(args, beforeID)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := []*models.IngestionFile{}
+	for rows.Next() {
+		file, err := scanIngestionFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// ProcessedObjects returns, by key, the ETag every object processed under a
+// bucket prefix was last processed with
+func (r *ingestionFileRepository) ProcessedObjects(bucket, prefix string) (map[string]string, error) {
+	rows, err := r.db.Query(`
+		SELECT object_key, etag FROM ingestion_objects
+		WHERE bucket = ? AND LEFT(object_key, ?) = ?
+		ORDER BY id
+	`, bucket, utf8.RuneCountInString(prefix), prefix)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	processed := make(map[string]string)
+	for rows.Next() {
+		var key, etag string
+		if err := rows.Scan(&key, &etag); err != nil {
+			return nil, err
+		}
+		processed[key] = etag
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return processed, nil
+}
+
+// RecordObject records an object as processed into the ingestion file its
+// content was claimed as. Recording it twice is not an error.
+func (r *ingestionFileRepository) RecordObject(bucket, key, etag string, fileID int64) error {
+	sum := sha256.Sum256([]byte(bucket + "\x00" + key + "\x00" + etag))
+	_, err := r.db.Exec(`
+		INSERT IGNORE INTO ingestion_objects (bucket, object_key, etag, object_hash, ingestion_file_id)
+		VALUES (?, ?, ?, ?, ?)
+	`, bucket, key, etag, hex.EncodeToString(sum[:]), fileID)
+	return err
+}
+
+// RecordEmail stores a delivery of a statement email with the outcome of
+// each attachment
+func (r *ingestionFileRepository) RecordEmail(email *models.IngestionEmail) error {
+	attachments, err := json.Marshal(email.Attachments)
+	if err != nil {
+		return err
+	}
+	var emailError interface{}
+	if email.Error != "" {
+		emailError = email.Error
+	}
+	email.CreatedAt = time.Now()
+	result, err := r.db.Exec(`
+		INSERT INTO ingestion_emails (message_id, mailbox, sender, subject, status, error, attachments, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, email.MessageID, email.Mailbox, email.Sender, email.Subject, email.Status, emailError, attachments, email.CreatedAt)
+	if err != nil {
+		return err
+	}
+	email.ID, err = result.LastInsertId()
+	return err
+}
+
+// ListEmails lists emails newest first, optionally of one status, below
+// beforeID when it is set
+func (r *ingestionFileRepository) ListEmails(status string, beforeID int64, limit int) ([]*models.IngestionEmail, error) {
+	query := `
+		SELECT id, message_id, mailbox, sender, subject, status, COALESCE(error, ''), attachments, created_at
+		FROM ingestion_emails WHERE 1 = 1`
+	var args []interface{}
+	if status != "" {
+		query += ` AND status = ?`
+		args = append(args, status)
+	}
+	if beforeID != 0 {
+		query += ` AND id < ?`
+		args = append(args, beforeID)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	emails := []*models.IngestionEmail{}
+	for rows.Next() {
+		email := &models.IngestionEmail{}
+		var attachments []byte
+		err := rows.Scan(&email.ID, &email.MessageID, &email.Mailbox, &email.Sender, &email.Subject,
+			&email.Status, &email.Error, &attachments, &email.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		email.Attachments = []*models.IngestionEmailAttachment{}
+		if len(attachments) > 0 {
+			if err := json.Unmarshal(attachments, &email.Attachments); err != nil {
+				return nil, err
+			}
+		}
+		emails = append(emails, email)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return emails, nil
+}
+
+// LastSequence returns the last statement sequence number recorded for an
+// account, and whether there is one
+func (r *ingestionFileRepository) LastSequence(accountNumber string) (int64, bool, error) {
+	var sequence int64
+	err := r.db.QueryRow(`SELECT last_sequence FROM ingestion_sequences WHERE account_number = ?`, accountNumber).Scan(&sequence)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return sequence, true, nil
+}
+
+// RecordSequence records a statement sequence number ingested for an
+// account. A restarted numbering, sequence 1, replaces the last number; any
+// other lower than it leaves it.
+func (r *ingestionFileRepository) RecordSequence(accountNumber string, sequence, fileID int64) error {
+	_, err := r.db.Exec(`
+		INSERT INTO ingestion_sequences (account_number, last_sequence, ingestion_file_id)
+		VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			ingestion_file_id = IF(VALUES(last_sequence) = 1 OR VALUES(last_sequence) > last_sequence, VALUES(ingestion_file_id), ingestion_file_id),
+			last_sequence = IF(VALUES(last_sequence) = 1, 1, GREATEST(last_sequence, VALUES(last_sequence)))
+	`, accountNumber, sequence, fileID)
+	return err
+}
+
+// FeedActivity returns how many files of a source were finished since a
+// time, and how many records those ingested brought
+func (r *ingestionFileRepository) FeedActivity(source string, since time.Time) (int, int, error) {
+	var files, records int
+	err := r.db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(CASE WHEN status = ? THEN records ELSE 0 END), 0)
+		FROM ingestion_files
+		WHERE source = ? AND updated_at >= ? AND status <> ?
+	`, models.IngestionFileIngested, source, since, models.IngestionFileProcessing).Scan(&files, &records)
+	return files, records, err
+}
+
+const ingestionFileColumns = `
+	id, source, file_name, checksum, size, format, status, records, quality_score,
+	COALESCE(error, ''), archived_path, COALESCE(job_id, 0), created_at, updated_at`
+
+func scanIngestionFile(row rowScanner) (*models.IngestionFile, error) {
+	file := &models.IngestionFile{}
+	var qualityScore sql.NullFloat64
+	err := row.Scan(
+		&file.ID,
+		&file.Source,
+		&file.FileName,
+		&file.Checksum,
+		&file.Size,
+		&file.Format,
+		&file.Status,
+		&file.Records,
+		&qualityScore,
+		&file.Error,
+		&file.ArchivedPath,
+		&file.JobID,
+		&file.CreatedAt,
+		&file.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if qualityScore.Valid {
+		file.QualityScore = &qualityScore.Float64
+	}
+	return file, nil
+}
@@ -0,0 +1,565 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/money"
+)
+
+var (
+	ErrIntegrityFindingNotFound = errors.New("integrity finding not found")
+
+	// ErrIntegrityFindingClosed rejects repairing a finding that was already
+	// repaired, went stale or was superseded by a later run
+	ErrIntegrityFindingClosed = errors.New("integrity finding is no longer open")
+)
+
+type IntegrityRepository interface {
+	FindOrphanMappings(limit int) ([]*models.IntegrityFinding, error)
+	FindMultiplyMapped(limit int) ([]*models.IntegrityFinding, error)
+	FindSumMismatches(baseCurrency string, limit int) ([]*models.IntegrityFinding, error)
+	CountUncheckedSums(baseCurrency string) (int, error)
+	RecheckFinding(tx *sql.Tx, finding *models.IntegrityFinding, baseCurrency string) (*models.IntegrityFinding, error)
+	SaveRun(run *models.IntegrityRun, findings []*models.IntegrityFinding) error
+	ListRuns(beforeID int64, limit int) ([]*models.IntegrityRun, error)
+	ListFindings(runID int64, kind, status string, beforeID int64, limit int) ([]*models.IntegrityFinding, error)
+	GetFinding(id int64) (*models.IntegrityFinding, error)
+	GetFindingForUpdate(tx *sql.Tx, id int64) (*models.IntegrityFinding, error)
+	CloseFinding(tx *sql.Tx, id int64, status, userID string) error
+	DeleteMapping(tx *sql.Tx, id int64) error
+	SetAmountDifference(tx *sql.Tx, reconciliationID int64, amount money.Amount) error
+}
+
+type integrityRepository struct {
+	db *sql.DB
+	// tenant whose mappings and reconciliations are checked
+	tenant string
+}
+
+func NewIntegrityRepository(db *sql.DB, tenant string) IntegrityRepository {
+	return &integrityRepository{db: db, tenant: tenant}
+}
+
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// FindOrphanMappings lists up to limit mappings to a bank transaction,
+// accounting entry or reconciliation that does not exist, to no record at
+// all, or kept by an unmatched reconciliation
+func (r *integrityRepository) FindOrphanMappings(limit int) ([]*models.IntegrityFinding, error) {
+	return findOrphanMappings(r.db, "m.tenant_id = ?", []interface{}{r.tenant}, limit)
+}
+
+func findOrphanMappings(q querier, filter string, args []interface{}, limit int) ([]*models.IntegrityFinding, error) {
+	rows, err := q.Query(`
+		SELECT m.id, m.reconciliation_id, m.bank_transaction_id, m.accounting_entry_id, m.mapping_type,
+		       r.id IS NULL, COALESCE(r.status = ?, FALSE),
+		       m.bank_transaction_id IS NOT NULL AND b.id IS NULL,
+		       m.accounting_entry_id IS NOT NULL AND a.id IS NULL
+		FROM reconciliation_mappings m
+		LEFT JOIN reconciliations r ON r.id = m.reconciliation_id
+		LEFT JOIN bank_transactions b ON b.id = m.bank_transaction_id
+		LEFT JOIN accounting_entries a ON a.id = m.accounting_entry_id
+		WHERE (r.id IS NULL OR r.status = ?
+		       OR (m.bank_transaction_id IS NULL AND m.accounting_entry_id IS NULL)
+		       OR (m.bank_transaction_id IS NOT NULL AND b.id IS NULL)
+		       OR (m.accounting_entry_id IS NOT NULL AND a.id IS NULL))
+		  AND `+filter+`
+		ORDER BY m.id
+		LIMIT ?
+	`, append(append([]interface{}{models.StatusUnmatched, models.StatusUnmatched}, args...), limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	findings := []*models.IntegrityFinding{}
+	for rows.Next() {
+		finding := &models.IntegrityFinding{
+			Kind:   models.IntegrityOrphanMapping,
+			Repair: models.IntegrityRepairDeleteMapping,
+		}
+		var bankTransactionID, accountingEntryID sql.NullInt64
+		var reconciliationMissing, reconciliationUnmatched, bankMissing, entryMissing bool
+		err := rows.Scan(
+			&finding.MappingID,
+			&finding.ReconciliationID,
+			&bankTransactionID,
+			&accountingEntryID,
+			&finding.Details.MappingType,
+			&reconciliationMissing,
+			&reconciliationUnmatched,
+			&bankMissing,
+			&entryMissing,
+		)
+		if err != nil {
+			return nil, err
+		}
+		finding.Details.BankTransactionID = bankTransactionID.Int64
+		finding.Details.AccountingEntryID = accountingEntryID.Int64
+		switch {
+		case bankMissing:
+			finding.Details.Reason = models.IntegrityReasonBankTransactionMissing
+			finding.RecordType = models.ExceptionRecordBankTransaction
+			finding.RecordID = bankTransactionID.Int64
+		case entryMissing:
+			finding.Details.Reason = models.IntegrityReasonAccountingEntryMissing
+			finding.RecordType = models.ExceptionRecordAccountingEntry
+			finding.RecordID = accountingEntryID.Int64
+		case reconciliationMissing:
+			finding.Details.Reason = models.IntegrityReasonReconciliationMissing
+		case reconciliationUnmatched:
+			finding.Details.Reason = models.IntegrityReasonReconciliationUnmatched
+		default:
+			finding.Details.Reason = models.IntegrityReasonNoRecords
+		}
+		findings = append(findings, finding)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return findings, nil
+}
+
+// integritySides are the record columns of a mapping, by record type
+var integritySides = []struct {
+	recordType string
+	column     string
+}{
+	{models.ExceptionRecordBankTransaction, "bank_transaction_id"},
+	{models.ExceptionRecordAccountingEntry, "accounting_entry_id"},
+}
+
+// FindMultiplyMapped lists up to limit bank transactions and accounting
+// entries, each side in turn, that reconciliations of more than one batch
+// still map. Returns are left out: they map a transaction already matched.
+func (r *integrityRepository) FindMultiplyMapped(limit int) ([]*models.IntegrityFinding, error) {
+	findings := []*models.IntegrityFinding{}
+	for _, side := range integritySides {
+		found, err := findMultiplyMapped(r.db, side.recordType, side.column, "m.tenant_id = ?", []interface{}{r.tenant}, limit-len(findings))
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, found...)
+		if len(findings) >= limit {
+			break
+		}
+	}
+	return findings, nil
+}
+
+func findMultiplyMapped(q querier, recordType, column, filter string, args []interface{}, limit int) ([]*models.IntegrityFinding, error) {
+	rows, err := q.Query(fmt.Sprintf(`
+		SELECT m.%[1]s,
+		       GROUP_CONCAT(DISTINCT r.id ORDER BY r.id SEPARATOR ','),
+		       GROUP_CONCAT(DISTINCT r.reconciliation_batch_id ORDER BY r.reconciliation_batch_id SEPARATOR '\n')
+		FROM reconciliation_mappings m
+		JOIN reconciliations r ON r.id = m.reconciliation_id
+		WHERE m.%[1]s IS NOT NULL AND m.mapping_type <> ? AND r.status <> ? AND %[2]s
+		GROUP BY m.%[1]s
+		HAVING COUNT(DISTINCT r.reconciliation_batch_id) > 1
+		ORDER BY m.%[1]s
+		LIMIT ?
+	`, column, filter), append(append([]interface{}{models.MappingReturn, models.StatusUnmatched}, args...), limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	findings := []*models.IntegrityFinding{}
+	for rows.Next() {
+		finding := &models.IntegrityFinding{
+			Kind:       models.IntegrityMultiplyMapped,
+			RecordType: recordType,
+			Repair:     models.IntegrityRepairUnmatchDuplicates,
+		}
+		var reconciliationIDs, batchIDs string
+		if err := rows.Scan(&finding.RecordID, &reconciliationIDs, &batchIDs); err != nil {
+			return nil, err
+		}
+		for _, id := range strings.Split(reconciliationIDs, ",") {
+			reconciliationID, err := strconv.ParseInt(id, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid reconciliation ID %q mapping %s %d", id, recordType, finding.RecordID)
+			}
+			finding.Details.ReconciliationIDs = append(finding.Details.ReconciliationIDs, reconciliationID)
+		}
+		finding.Details.BatchIDs = strings.Split(batchIDs, "\n")
+		// The earliest reconciliation is the one a repair keeps
+		finding.ReconciliationID = finding.Details.ReconciliationIDs[0]
+		if recordType == models.ExceptionRecordBankTransaction {
+			finding.Details.BankTransactionID = finding.RecordID
+		} else {
+			finding.Details.AccountingEntryID = finding.RecordID
+		}
+		findings = append(findings, finding)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return findings, nil
+}
+
+// integrityGroups totals each side of every one-to-many and many-to-one
+// group still matched, counting the currencies on each side with records
+// stored without one in the base currency. It takes the base currency four
+// times.
+const integrityGroups = `
+	FROM reconciliations r
+	JOIN (
+		SELECT reconciliation_id, MIN(mapping_type) AS mapping_type
+		FROM reconciliation_mappings
+		WHERE mapping_type IN ('one_to_many', 'many_to_one')
+		GROUP BY reconciliation_id
+	) g ON g.reconciliation_id = r.id
+	JOIN (
+		SELECT s.reconciliation_id, SUM(b.amount) AS total,
+		       COUNT(DISTINCT COALESCE(NULLIF(b.currency, ''), ?)) AS currencies,
+		       MIN(COALESCE(NULLIF(b.currency, ''), ?)) AS currency
+		FROM (
+			SELECT DISTINCT reconciliation_id, bank_transaction_id
+			FROM reconciliation_mappings
+			WHERE mapping_type IN ('one_to_many', 'many_to_one')
+		) s
+		JOIN bank_transactions b ON b.id = s.bank_transaction_id
+		GROUP BY s.reconciliation_id
+	) bank ON bank.reconciliation_id = r.id
+	JOIN (
+		SELECT s.reconciliation_id, SUM(CASE WHEN a.entry_type = 'credit_note' THEN -ABS(a.amount) ELSE a.amount END) AS total,
+		       COUNT(DISTINCT COALESCE(NULLIF(a.currency, ''), ?)) AS currencies,
+		       MIN(COALESCE(NULLIF(a.currency, ''), ?)) AS currency
+		FROM (
+			SELECT DISTINCT reconciliation_id, accounting_entry_id
+			FROM reconciliation_mappings
+			WHERE mapping_type IN ('one_to_many', 'many_to_one')
+		) s
+		JOIN accounting_entries a ON a.id = s.accounting_entry_id
+		GROUP BY s.reconciliation_id
+	) ledger ON ledger.reconciliation_id = r.id
+	WHERE r.status <> 'unmatched'`
+
+// integrityComparable holds for groups whose records are all in one currency
+const integrityComparable = `bank.currencies = 1 AND ledger.currencies = 1 AND bank.currency = ledger.currency`
+
+// FindSumMismatches lists up to limit groups in one currency whose totals no
+// longer differ by the amount difference they were matched with. Credit notes
+// take their amount off the ledger total, as they did when matched.
+func (r *integrityRepository) FindSumMismatches(baseCurrency string, limit int) ([]*models.IntegrityFinding, error) {
+	return findSumMismatches(r.db, baseCurrency, "r.tenant_id = ?", []interface{}{r.tenant}, limit)
+}
+
+func findSumMismatches(q querier, baseCurrency, filter string, args []interface{}, limit int) ([]*models.IntegrityFinding, error) {
+	queryArgs := []interface{}{baseCurrency, baseCurrency, baseCurrency, baseCurrency}
+	queryArgs = append(append(queryArgs, args...), limit)
+	rows, err := q.Query(`
+		SELECT r.id, r.reconciliation_batch_id, g.mapping_type, bank.currency,
+		       bank.total, ledger.total, r.amount_difference
+	`+integrityGroups+`
+		  AND `+integrityComparable+`
+		  AND ABS(ABS(bank.total - ledger.total) - r.amount_difference) >= 0.01
+		  AND `+filter+`
+		ORDER BY r.id
+		LIMIT ?
+	`, queryArgs...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	findings := []*models.IntegrityFinding{}
+	for rows.Next() {
+		finding := &models.IntegrityFinding{
+			Kind:   models.IntegritySumMismatch,
+			Repair: models.IntegrityRepairReviewMatch,
+		}
+		var batchID string
+		var bankTotal, ledgerTotal, amountDifference money.Amount
+		err := rows.Scan(
+			&finding.ReconciliationID,
+			&batchID,
+			&finding.Details.MappingType,
+			&finding.Details.Currency,
+			&bankTotal,
+			&ledgerTotal,
+			&amountDifference,
+		)
+		if err != nil {
+			return nil, err
+		}
+		actualDifference := (bankTotal - ledgerTotal).Abs()
+		finding.Details.BatchIDs = []string{batchID}
+		finding.Details.BankTotal = &bankTotal
+		finding.Details.LedgerTotal = &ledgerTotal
+		finding.Details.AmountDifference = &amountDifference
+		finding.Details.ActualDifference = &actualDifference
+		findings = append(findings, finding)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return findings, nil
+}
+
+// CountUncheckedSums counts the groups with records in more than one
+// currency, whose totals cannot be compared without the rates they were
+// matched at
+func (r *integrityRepository) CountUncheckedSums(baseCurrency string) (int, error) {
+	var count int
+	err := r.db.QueryRow(`SELECT COUNT(*)`+integrityGroups+` AND r.tenant_id = ? AND NOT (`+integrityComparable+`)`,
+		baseCurrency, baseCurrency, baseCurrency, baseCurrency, r.tenant).Scan(&count)
+	return count, err
+}
+
+// RecheckFinding checks a finding again inside tx and returns it as it
+// stands now, or nil when it no longer holds
+func (r *integrityRepository) RecheckFinding(tx *sql.Tx, finding *models.IntegrityFinding, baseCurrency string) (*models.IntegrityFinding, error) {
+	var found []*models.IntegrityFinding
+	var err error
+	switch finding.Kind {
+	case models.IntegrityOrphanMapping:
+		found, err = findOrphanMappings(tx, "m.tenant_id = ? AND m.id = ?", []interface{}{r.tenant, finding.MappingID}, 1)
+	case models.IntegrityMultiplyMapped:
+		for _, side := range integritySides {
+			if side.recordType == finding.RecordType {
+				found, err = findMultiplyMapped(tx, side.recordType, side.column, "m.tenant_id = ? AND m."+side.column+" = ?", []interface{}{r.tenant, finding.RecordID}, 1)
+			}
+		}
+	case models.IntegritySumMismatch:
+		found, err = findSumMismatches(tx, baseCurrency, "r.tenant_id = ? AND r.id = ?", []interface{}{r.tenant, finding.ReconciliationID}, 1)
+	}
+	if err != nil || len(found) == 0 {
+		return nil, err
+	}
+	current := found[0]
+	current.ID = finding.ID
+	current.RunID = finding.RunID
+	current.Status = finding.Status
+	current.CreatedAt = finding.CreatedAt
+	return current, nil
+}
+
+// SaveRun records a run with its findings, superseding the findings earlier
+// runs left open
+func (r *integrityRepository) SaveRun(run *models.IntegrityRun, findings []*models.IntegrityFinding) error {
+	metrics, err := json.Marshal(run.Metrics)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO integrity_runs (triggered_by, metrics, started_at, finished_at)
+		VALUES (?, ?, ?, ?)
+	`, run.TriggeredBy, metrics, run.StartedAt, run.FinishedAt)
+	if err != nil {
+		return err
+	}
+	if run.ID, err = result.LastInsertId(); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE integrity_findings SET status = ? WHERE status = ?`,
+		models.IntegrityStatusSuperseded, models.IntegrityStatusOpen)
+	if err != nil {
+		return err
+	}
+
+	for _, finding := range findings {
+		details, err := json.Marshal(finding.Details)
+		if err != nil {
+			return err
+		}
+		finding.RunID = run.ID
+		finding.Status = models.IntegrityStatusOpen
+		result, err := tx.Exec(`
+			INSERT INTO integrity_findings (
+				run_id, kind, reconciliation_id, mapping_id, record_type, record_id, details, repair, status
+			) VALUES (?, ?, NULLIF(?, 0), NULLIF(?, 0), NULLIF(?, ''), NULLIF(?, 0), ?, ?, ?)
+		`, finding.RunID, finding.Kind, finding.ReconciliationID, finding.MappingID, finding.RecordType, finding.RecordID,
+			details, finding.Repair, finding.Status)
+		if err != nil {
+			return err
+		}
+		if finding.ID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ListRuns lists the latest integrity runs, newest first, from those older
+// than beforeID when it is not zero
+func (r *integrityRepository) ListRuns(beforeID int64, limit int) ([]*models.IntegrityRun, error) {
+	rows, err := r.db.Query(`
+		SELECT id, triggered_by, metrics, started_at, finished_at
+		FROM integrity_runs
+		WHERE ? = 0 OR id < ?
+		ORDER BY id DESC
+		LIMIT ?
+	`, beforeID, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []*models.IntegrityRun{}
+	for rows.Next() {
+		run := &models.IntegrityRun{}
+		var metrics []byte
+		if err := rows.Scan(&run.ID, &run.TriggeredBy, &metrics, &run.StartedAt, &run.FinishedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(metrics, &run.Metrics); err != nil {
+			return nil, fmt.Errorf("invalid metrics of integrity run %d: %v", run.ID, err)
+		}
+		runs = append(runs, run)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+const integrityFindingColumns = `
+	id, run_id, kind, COALESCE(reconciliation_id, 0), COALESCE(mapping_id, 0),
+	COALESCE(record_type, ''), COALESCE(record_id, 0), details, repair, status,
+	resolved_by, resolved_at, created_at`
+
+func scanIntegrityFinding(row rowScanner) (*models.IntegrityFinding, error) {
+	finding := &models.IntegrityFinding{}
+	var details []byte
+	var resolvedAt sql.NullTime
+	err := row.Scan(
+		&finding.ID,
+		&finding.RunID,
+		&finding.Kind,
+		&finding.ReconciliationID,
+		&finding.MappingID,
+		&finding.RecordType,
+		&finding.RecordID,
+		&details,
+		&finding.Repair,
+		&finding.Status,
+		&finding.ResolvedBy,
+		&resolvedAt,
+		&finding.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(details, &finding.Details); err != nil {
+		return nil, fmt.Errorf("invalid details of integrity finding %d: %v", finding.ID, err)
+	}
+	if resolvedAt.Valid {
+		finding.ResolvedAt = &resolvedAt.Time
+	}
+	return finding, nil
+}
+
+// ListFindings lists findings newest first, optionally of one run, kind or
+// status, from those older than beforeID when it is not zero
+func (r *integrityRepository) ListFindings(runID int64, kind, status string, beforeID int64, limit int) ([]*models.IntegrityFinding, error) {
+	query := `SELECT ` + integrityFindingColumns + ` FROM integrity_findings WHERE 1 = 1`
+	var args []interface{}
+	if runID != 0 {
+		query += ` AND run_id = ?`
+		args = append(args, runID)
+	}
+	if kind != "" {
+		query += ` AND kind = ?`
+		args = append(args, kind)
+	}
+	if status != "" {
+		query += ` AND status = ?`
+		args = append(args, status)
+	}
+	if beforeID != 0 {
+		query += ` AND id < ?`
+		args = append(args, beforeID)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	findings := []*models.IntegrityFinding{}
+	for rows.Next() {
+		finding, err := scanIntegrityFinding(rows)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, finding)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return findings, nil
+}
+
+func (r *integrityRepository) GetFinding(id int64) (*models.IntegrityFinding, error) {
+	finding, err := scanIntegrityFinding(r.db.QueryRow(`SELECT `+integrityFindingColumns+` FROM integrity_findings WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrIntegrityFindingNotFound
+	}
+	return finding, err
+}
+
+// GetFindingForUpdate reads and locks a finding while it is repaired
+func (r *integrityRepository) GetFindingForUpdate(tx *sql.Tx, id int64) (*models.IntegrityFinding, error) {
+	finding, err := scanIntegrityFinding(tx.QueryRow(`SELECT `+integrityFindingColumns+` FROM integrity_findings WHERE id = ? FOR UPDATE`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrIntegrityFindingNotFound
+	}
+	return finding, err
+}
+
+// CloseFinding moves an open finding to status, recording who closed it
+func (r *integrityRepository) CloseFinding(tx *sql.Tx, id int64, status, userID string) error {
+	result, err := tx.Exec(`
+		UPDATE integrity_findings
+		SET status = ?, resolved_by = ?, resolved_at = ?
+		WHERE id = ? AND status = ?
+	`, status, userID, time.Now(), id, models.IntegrityStatusOpen)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrIntegrityFindingClosed
+	}
+	return nil
+}
+
+// DeleteMapping removes a single mapping, leaving the rest of its
+// reconciliation in place
+func (r *integrityRepository) DeleteMapping(tx *sql.Tx, id int64) error {
+	_, err := tx.Exec("DELETE FROM reconciliation_mappings WHERE id = ? AND tenant_id = ?", id, r.tenant)
+	return err
+}
+
+// SetAmountDifference corrects the amount difference a reconciliation
+// records; the caller moves its version on with the status
+func (r *integrityRepository) SetAmountDifference(tx *sql.Tx, reconciliationID int64, amount money.Amount) error {
+	_, err := tx.Exec("UPDATE reconciliations SET amount_difference = ? WHERE id = ? AND tenant_id = ?", amount, reconciliationID, r.tenant)
+	return err
+}
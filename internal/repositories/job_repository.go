@@ -0,0 +1,518 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"reconciliation-service/internal/models"
+)
+
+var ErrJobNotFound = errors.New("job not found")
+
+type JobRepository interface {
+	CreateJob(job *models.ReconciliationJob) error
+	UpdateJob(job *models.ReconciliationJob) error
+	GetJobByID(id int64) (*models.ReconciliationJob, error)
+	ListJobs(status string, beforeID int64, limit int) ([]*models.ReconciliationJob, error)
+	ListJobsByBatch(batchID string) ([]*models.ReconciliationJob, error)
+	ClaimQueuedJob(jobType, instanceID string, maxRunning, maxTenantRunning int) (*models.ReconciliationJob, error)
+	TransitionJobStatus(id int64, from, to string) (bool, error)
+	ListQueuedJobs(jobType string) ([]*models.ReconciliationJob, error)
+	UpdateQueuedJobPriority(id int64, priority int) error
+	MaxQueuedPriority(jobType string) (int, error)
+	CreateJobExclusive(job *models.ReconciliationJob, accounts []string, staleAfter time.Duration) (int64, error)
+	LockJobAccounts(job *models.ReconciliationJob, accounts []string, staleAfter time.Duration) (int64, error)
+	ListStuckJobs(staleBefore time.Time) ([]*models.ReconciliationJob, error)
+	RequeueStuckJob(id int64, staleBefore time.Time, reason string) (bool, error)
+}
+
+type jobRepository struct {
+	db     *sql.DB
+	tenant string
+}
+
+// NewJobRepository reads and writes the jobs of one tenant
+func NewJobRepository(db *sql.DB, tenant string) JobRepository {
+	return &jobRepository{db: db, tenant: tenant}
+}
+
+const jobColumns = `
+		id, job_type, reconciliation_batch_id, status, priority,
+		COALESCE(DATE_FORMAT(from_date, '%Y-%m-%d'), ''),
+		COALESCE(DATE_FORMAT(to_date, '%Y-%m-%d'), ''),
+		instance_id, requested_by, usage_entity, checkpoint, COALESCE(error, ''),
+		queued_at, started_at, heartbeat_at, finished_at, updated_at`
+
+func scanJob(row rowScanner) (*models.ReconciliationJob, error) {
+	job := &models.ReconciliationJob{}
+	var checkpoint []byte
+	var heartbeatAt, finishedAt sql.NullTime
+	err := row.Scan(
+		&job.ID,
+		&job.JobType,
+		&job.BatchID,
+		&job.Status,
+		&job.Priority,
+		&job.FromDate,
+		&job.ToDate,
+		&job.InstanceID,
+		&job.RequestedBy,
+		&job.UsageEntity,
+		&checkpoint,
+		&job.Error,
+		&job.QueuedAt,
+		&job.StartedAt,
+		&heartbeatAt,
+		&finishedAt,
+		&job.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	job.Checkpoint = checkpoint
+	if heartbeatAt.Valid {
+		job.HeartbeatAt = &heartbeatAt.Time
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+	return job, nil
+}
+
+func nullableDate(date string) interface{} {
+	if date == "" {
+		return nil
+	}
+	return date
+}
+
+// nullableID stores an unset (zero) foreign key as NULL
+func nullableID(id int64) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+func nullableJSON(data []byte) interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+	return data
+}
+
+func (r *jobRepository) CreateJob(job *models.ReconciliationJob) error {
+	query := `
+		INSERT INTO reconciliation_jobs (
+			tenant_id, job_type, reconciliation_batch_id, status, priority,
+			from_date, to_date, instance_id, requested_by, usage_entity, checkpoint
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	result, err := r.db.Exec(query,
+		r.tenant,
+		job.JobType,
+		job.BatchID,
+		job.Status,
+		job.Priority,
+		nullableDate(job.FromDate),
+		nullableDate(job.ToDate),
+		job.InstanceID,
+		job.RequestedBy,
+		job.UsageEntity,
+		nullableJSON(job.Checkpoint),
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	job.ID = id
+	return nil
+}
+
+func (r *jobRepository) UpdateJob(job *models.ReconciliationJob) error {
+	query := `
+		UPDATE reconciliation_jobs
+		SET reconciliation_batch_id = ?,
+		    status = ?,
+		    checkpoint = ?,
+		    error = ?,
+		    finished_at = ?
+		WHERE id = ? AND tenant_id = ?
+	`
+	result, err := r.db.Exec(query,
+		job.BatchID,
+		job.Status,
+		nullableJSON(job.Checkpoint),
+		job.Error,
+		job.FinishedAt,
+		job.ID,
+		r.tenant,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return errors.New("job not found")
+	}
+	return nil
+}
+
+func (r *jobRepository) GetJobByID(id int64) (*models.ReconciliationJob, error) {
+	query := `SELECT ` + jobColumns + ` FROM reconciliation_jobs WHERE id = ? AND tenant_id = ?`
+	job, err := scanJob(r.db.QueryRow(query, id, r.tenant))
+	if err == sql.ErrNoRows {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// ListJobs lists the latest jobs, newest first, from those older than
+// beforeID when it is not zero
+func (r *jobRepository) ListJobs(status string, beforeID int64, limit int) ([]*models.ReconciliationJob, error) {
+	query := `
+		SELECT ` + jobColumns + `
+		FROM reconciliation_jobs
+		WHERE tenant_id = ? AND (? = '' OR status = ?) AND (? = 0 OR id < ?)
+		ORDER BY id DESC
+		LIMIT ?
+	`
+	rows, err := r.db.Query(query, r.tenant, status, status, beforeID, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanJobs(rows)
+}
+
+func (r *jobRepository) ListJobsByBatch(batchID string) ([]*models.ReconciliationJob, error) {
+	query := `
+		SELECT ` + jobColumns + `
+		FROM reconciliation_jobs
+		WHERE tenant_id = ? AND reconciliation_batch_id = ?
+		ORDER BY id
+	`
+	rows, err := r.db.Query(query, r.tenant, batchID)
+	if err != nil {
+		return nil, err
+	}
+	return scanJobs(rows)
+}
+
+// ClaimQueuedJob atomically moves the highest priority queued job of the given
+// type to running for this instance, oldest first within a priority. When
+// maxRunning is positive nothing is claimed while that many jobs of the type are
+// already running across all instances and tenants, nor when maxTenantRunning
+// is positive and this tenant already runs that many. It returns nil when
+// nothing is claimable.
+func (r *jobRepository) ClaimQueuedJob(jobType, instanceID string, maxRunning, maxTenantRunning int) (*models.ReconciliationJob, error) {
+	query := `
+		UPDATE reconciliation_jobs
+		SET id = LAST_INSERT_ID(id),
+		    status = ?,
+		    instance_id = ?,
+		    started_at = CURRENT_TIMESTAMP,
+		    heartbeat_at = CURRENT_TIMESTAMP
+		WHERE tenant_id = ? AND status = ? AND job_type = ?
+		AND (? <= 0 OR (
+			SELECT COUNT(*) FROM (
+				SELECT id FROM reconciliation_jobs WHERE status = ? AND job_type = ?
+			) AS running
+		) < ?)
+		AND (? <= 0 OR (
+			SELECT COUNT(*) FROM (
+				SELECT id FROM reconciliation_jobs WHERE tenant_id = ? AND status = ? AND job_type = ?
+			) AS tenant_running
+		) < ?)
+		ORDER BY priority DESC, id
+		LIMIT 1
+	`
+	result, err := r.db.Exec(query,
+		models.JobStatusRunning, instanceID,
+		r.tenant, models.JobStatusQueued, jobType,
+		maxRunning, models.JobStatusRunning, jobType, maxRunning,
+		maxTenantRunning, r.tenant, models.JobStatusRunning, jobType, maxTenantRunning,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected == 0 {
+		return nil, nil
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return r.GetJobByID(id)
+}
+
+// TransitionJobStatus is a compare-and-set on the job status; it reports
+// whether this caller won the transition
+func (r *jobRepository) TransitionJobStatus(id int64, from, to string) (bool, error) {
+	query := `
+		UPDATE reconciliation_jobs
+		SET status = ?
+		WHERE id = ? AND tenant_id = ? AND status = ?
+	`
+	result, err := r.db.Exec(query, to, id, r.tenant, from)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+func (r *jobRepository) ListQueuedJobs(jobType string) ([]*models.ReconciliationJob, error) {
+	query := `
+		SELECT ` + jobColumns + `
+		FROM reconciliation_jobs
+		WHERE tenant_id = ? AND status = ? AND job_type = ?
+		ORDER BY priority DESC, id
+	`
+	rows, err := r.db.Query(query, r.tenant, models.JobStatusQueued, jobType)
+	if err != nil {
+		return nil, err
+	}
+	return scanJobs(rows)
+}
+
+func (r *jobRepository) UpdateQueuedJobPriority(id int64, priority int) error {
+	query := `
+		UPDATE reconciliation_jobs
+		SET priority = ?
+		WHERE id = ? AND tenant_id = ? AND status = ?
+	`
+	result, err := r.db.Exec(query, priority, id, r.tenant, models.JobStatusQueued)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return errors.New("queued job not found")
+	}
+	return nil
+}
+
+func (r *jobRepository) MaxQueuedPriority(jobType string) (int, error) {
+	var priority sql.NullInt64
+	query := `
+		SELECT MAX(priority)
+		FROM reconciliation_jobs
+		WHERE tenant_id = ? AND status = ? AND job_type = ?
+	`
+	if err := r.db.QueryRow(query, r.tenant, models.JobStatusQueued, jobType).Scan(&priority); err != nil {
+		return 0, err
+	}
+	return int(priority.Int64), nil
+}
+
+// AllAccounts is the account scope of a job that locks every account
+const AllAccounts = "*"
+
+// jobGuardLock is the MySQL named lock serializing the overlap check with the
+// recording of a job's account scope, across all instances
+const jobGuardLock = "reconciliation_job_guard"
+
+// CreateJobExclusive creates the running job and records its account scope,
+// unless a running job with an overlapping date range shares an account. It
+// returns the ID of the conflicting job, or 0 once the job was created.
+func (r *jobRepository) CreateJobExclusive(job *models.ReconciliationJob, accounts []string, staleAfter time.Duration) (int64, error) {
+	var conflict int64
+	err := r.withJobGuard(func(conn *sql.Conn) error {
+		var err error
+		conflict, err = findOverlappingJob(conn, r.tenant, 0, job.FromDate, job.ToDate, accounts, staleAfter)
+		if err != nil || conflict != 0 {
+			return err
+		}
+		if err := r.CreateJob(job); err != nil {
+			return err
+		}
+		return insertJobAccounts(conn, job.ID, accounts)
+	})
+	return conflict, err
+}
+
+// LockJobAccounts records the account scope of an already running job, such as
+// one claimed from the queue, under the same overlap rule as CreateJobExclusive
+func (r *jobRepository) LockJobAccounts(job *models.ReconciliationJob, accounts []string, staleAfter time.Duration) (int64, error) {
+	var conflict int64
+	err := r.withJobGuard(func(conn *sql.Conn) error {
+		var err error
+		conflict, err = findOverlappingJob(conn, r.tenant, job.ID, job.FromDate, job.ToDate, accounts, staleAfter)
+		if err != nil || conflict != 0 {
+			return err
+		}
+		if _, err := conn.ExecContext(context.Background(), "DELETE FROM reconciliation_job_accounts WHERE job_id = ?", job.ID); err != nil {
+			return err
+		}
+		return insertJobAccounts(conn, job.ID, accounts)
+	})
+	return conflict, err
+}
+
+// ListStuckJobs lists the running jobs whose instance has not beaten for them
+// since staleBefore, oldest first. A job never beaten for counts from its
+// start. Partitioned runs are left out: their partitions run elsewhere and
+// the last one to finish completes them.
+func (r *jobRepository) ListStuckJobs(staleBefore time.Time) ([]*models.ReconciliationJob, error) {
+	query := `
+		SELECT ` + jobColumns + `
+		FROM reconciliation_jobs
+		WHERE tenant_id = ? AND status = ? AND job_type <> ?
+		AND COALESCE(heartbeat_at, started_at) < ?
+		ORDER BY id
+	`
+	rows, err := r.db.Query(query, r.tenant, models.JobStatusRunning, models.JobTypePartitionedRun, staleBefore)
+	if err != nil {
+		return nil, err
+	}
+	return scanJobs(rows)
+}
+
+// RequeueStuckJob moves a job still stuck since staleBefore back to the
+// queue, recording why; it reports whether the job was requeued
+func (r *jobRepository) RequeueStuckJob(id int64, staleBefore time.Time, reason string) (bool, error) {
+	query := `
+		UPDATE reconciliation_jobs
+		SET status = ?, error = ?, instance_id = '', heartbeat_at = NULL
+		WHERE id = ? AND tenant_id = ? AND status = ?
+		AND COALESCE(heartbeat_at, started_at) < ?
+	`
+	result, err := r.db.Exec(query, models.JobStatusQueued, reason, id, r.tenant, models.JobStatusRunning, staleBefore)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+func (r *jobRepository) withJobGuard(fn func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 10)", jobGuardLock).Scan(&acquired); err != nil {
+		return err
+	}
+	if acquired.Int64 != 1 {
+		return errors.New("timed out waiting for the job guard lock")
+	}
+	defer conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", jobGuardLock)
+
+	return fn(conn)
+}
+
+// findOverlappingJob returns a running job of the tenant, other than
+// excludeID, whose date range overlaps the given one and whose account scope
+// intersects accounts. Jobs running longer than staleAfter are presumed dead
+// and ignored.
+func findOverlappingJob(conn *sql.Conn, tenant string, excludeID int64, fromDate, toDate string, accounts []string, staleAfter time.Duration) (int64, error) {
+	query := `
+		SELECT j.id
+		FROM reconciliation_jobs j
+		JOIN reconciliation_job_accounts a ON a.job_id = j.id
+		WHERE j.tenant_id = ? AND j.status = ? AND j.id <> ?
+		AND j.from_date <= ? AND j.to_date >= ?
+		AND j.started_at > DATE_SUB(CURRENT_TIMESTAMP, INTERVAL ? SECOND)
+	`
+	args := []interface{}{tenant, models.JobStatusRunning, excludeID, toDate, fromDate, int64(staleAfter.Seconds())}
+
+	if !lockScopeAll(accounts) {
+		query += fmt.Sprintf(" AND (a.account_number = ? OR a.account_number IN (%s))",
+			strings.TrimSuffix(strings.Repeat("?, ", len(accounts)), ", "))
+		args = append(args, AllAccounts)
+		for _, account := range accounts {
+			args = append(args, account)
+		}
+	}
+	query += " LIMIT 1"
+
+	var id int64
+	err := conn.QueryRowContext(context.Background(), query, args...).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+func insertJobAccounts(conn *sql.Conn, jobID int64, accounts []string) error {
+	if lockScopeAll(accounts) {
+		accounts = []string{AllAccounts}
+	}
+	for _, account := range accounts {
+		_, err := conn.ExecContext(context.Background(),
+			"INSERT IGNORE INTO reconciliation_job_accounts (job_id, account_number) VALUES (?, ?)",
+			jobID, account)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockScopeAll reports whether the scope covers every account: either no
+// account is known yet or the wildcard was given
+func lockScopeAll(accounts []string) bool {
+	if len(accounts) == 0 {
+		return true
+	}
+	for _, account := range accounts {
+		if account == AllAccounts {
+			return true
+		}
+	}
+	return false
+}
+
+func scanJobs(rows *sql.Rows) ([]*models.ReconciliationJob, error) {
+	defer rows.Close()
+
+	var jobs []*models.ReconciliationJob
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
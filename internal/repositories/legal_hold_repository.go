@@ -0,0 +1,311 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"reconciliation-service/internal/models"
+)
+
+var (
+	ErrLegalHoldNotFound = errors.New("legal hold not found")
+
+	// ErrLegalHoldConflict means the subject is already on hold
+	ErrLegalHoldConflict = errors.New("legal hold already exists")
+)
+
+type LegalHoldRepository interface {
+	CreateHold(hold *models.LegalHold) error
+	GetHold(id int64) (*models.LegalHold, error)
+	ListHolds() ([]*models.LegalHold, error)
+	LiftHold(id int64, userID string) (*models.LegalHold, error)
+	ListAudit(holdID, beforeID int64, limit int) ([]*models.LegalHoldAudit, error)
+	FindHold(subjects models.LegalHoldSubjects) (*models.LegalHold, error)
+	HeldBatchIDs() ([]string, error)
+}
+
+type legalHoldRepository struct {
+	db *sql.DB
+}
+
+func NewLegalHoldRepository(db *sql.DB) LegalHoldRepository {
+	return &legalHoldRepository{db: db}
+}
+
+const legalHoldColumns = "id, scope, scope_id, reason, created_by, created_at"
+
+func scanLegalHold(scanner rowScanner) (*models.LegalHold, error) {
+	hold := &models.LegalHold{}
+	err := scanner.Scan(&hold.ID, &hold.Scope, &hold.ScopeID, &hold.Reason, &hold.CreatedBy, &hold.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// CreateHold places a hold and records its placement
+func (r *legalHoldRepository) CreateHold(hold *models.LegalHold) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO legal_holds (scope, scope_id, reason, created_by)
+		VALUES (?, ?, ?, ?)
+	`, hold.Scope, hold.ScopeID, hold.Reason, hold.CreatedBy)
+	if IsDuplicateEntry(err) {
+		return ErrLegalHoldConflict
+	}
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	hold.ID = id
+	hold.CreatedAt = time.Now()
+
+	if err := recordLegalHoldAudit(tx, hold, models.LegalHoldActionPlaced, hold.CreatedBy); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *legalHoldRepository) GetHold(id int64) (*models.LegalHold, error) {
+	row := r.db.QueryRow("SELECT "+legalHoldColumns+" FROM legal_holds WHERE id = ?", id)
+	hold, err := scanLegalHold(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrLegalHoldNotFound
+	}
+	return hold, err
+}
+
+func (r *legalHoldRepository) ListHolds() ([]*models.LegalHold, error) {
+	return r.queryHolds("SELECT " + legalHoldColumns + " FROM legal_holds ORDER BY id")
+}
+
+func (r *legalHoldRepository) queryHolds(query string, args ...interface{}) ([]*models.LegalHold, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	holds := []*models.LegalHold{}
+	for rows.Next() {
+		hold, err := scanLegalHold(rows)
+		if err != nil {
+			return nil, err
+		}
+		holds = append(holds, hold)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return holds, nil
+}
+
+// LiftHold removes a hold and records who lifted it. It returns the hold as
+// it was.
+func (r *legalHoldRepository) LiftHold(id int64, userID string) (*models.LegalHold, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRow("SELECT "+legalHoldColumns+" FROM legal_holds WHERE id = ? FOR UPDATE", id)
+	hold, err := scanLegalHold(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrLegalHoldNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec("DELETE FROM legal_holds WHERE id = ?", id); err != nil {
+		return nil, err
+	}
+	if err := recordLegalHoldAudit(tx, hold, models.LegalHoldActionLifted, userID); err != nil {
+		return nil, err
+	}
+	return hold, tx.Commit()
+}
+
+func recordLegalHoldAudit(tx *sql.Tx, hold *models.LegalHold, action, userID string) error {
+	_, err := tx.Exec(`
+		INSERT INTO legal_hold_audit (legal_hold_id, action, scope, scope_id, reason, user_id)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, hold.ID, action, hold.Scope, hold.ScopeID, hold.Reason, userID)
+	return err
+}
+
+// ListAudit lists the latest placements and lifts of holds, newest first,
+// for one hold when holdID is not zero and from the entries older than
+// beforeID when it is not zero
+func (r *legalHoldRepository) ListAudit(holdID, beforeID int64, limit int) ([]*models.LegalHoldAudit, error) {
+	query := `
+		SELECT id, legal_hold_id, action, scope, scope_id, reason, user_id, created_at
+		FROM legal_hold_audit
+		WHERE 1 = 1`
+	args := []interface{}{}
+	if holdID != 0 {
+		query += " AND legal_hold_id = ?"
+		args = append(args, holdID)
+	}
+	if beforeID != 0 {
+		query += " AND id < ?"
+		args = append(args, beforeID)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*models.LegalHoldAudit{}
+	for rows.Next() {
+		entry := &models.LegalHoldAudit{}
+		err := rows.Scan(
+			&entry.ID,
+			&entry.LegalHoldID,
+			&entry.Action,
+			&entry.Scope,
+			&entry.ScopeID,
+			&entry.Reason,
+			&entry.UserID,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// FindHold returns the first hold on any of the subjects, or on the accounts
+// of their records, and nil when none of them is held
+func (r *legalHoldRepository) FindHold(subjects models.LegalHoldSubjects) (*models.LegalHold, error) {
+	var conditions []string
+	var args []interface{}
+	scoped := func(scope string, ids []string) {
+		if len(ids) == 0 {
+			return
+		}
+		conditions = append(conditions, "(scope = ? AND scope_id IN ("+placeholders(len(ids))+"))")
+		args = append(args, scope)
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+	bankIDs := formatIDs(subjects.BankTransactionIDs)
+	entryIDs := formatIDs(subjects.AccountingEntryIDs)
+	scoped(models.LegalHoldScopeBatch, subjects.BatchIDs)
+	scoped(models.LegalHoldScopeBankTransaction, bankIDs)
+	scoped(models.LegalHoldScopeAccountingEntry, entryIDs)
+
+	var accounts []string
+	var accountArgs []interface{}
+	if len(bankIDs) > 0 {
+		accounts = append(accounts, "SELECT account_number FROM bank_transactions WHERE id IN ("+placeholders(len(bankIDs))+")")
+		for _, id := range subjects.BankTransactionIDs {
+			accountArgs = append(accountArgs, id)
+		}
+	}
+	if len(entryIDs) > 0 {
+		accounts = append(accounts, "SELECT account_code FROM accounting_entries WHERE id IN ("+placeholders(len(entryIDs))+")")
+		for _, id := range subjects.AccountingEntryIDs {
+			accountArgs = append(accountArgs, id)
+		}
+	}
+	if len(accounts) > 0 {
+		conditions = append(conditions, "(scope = ? AND scope_id IN ("+strings.Join(accounts, " UNION ")+"))")
+		args = append(args, models.LegalHoldScopeAccount)
+		args = append(args, accountArgs...)
+	}
+	if len(conditions) == 0 {
+		return nil, nil
+	}
+
+	holds, err := r.queryHolds("SELECT "+legalHoldColumns+" FROM legal_holds WHERE "+strings.Join(conditions, " OR ")+" ORDER BY id LIMIT 1", args...)
+	if err != nil || len(holds) == 0 {
+		return nil, err
+	}
+	return holds[0], nil
+}
+
+// HeldBatchIDs lists the batches that are held, directly or through a hold
+// on a record or account reconciled in them
+func (r *legalHoldRepository) HeldBatchIDs() ([]string, error) {
+	rows, err := r.db.Query(`
+		SELECT scope_id
+		FROM legal_holds
+		WHERE scope = ?
+		UNION
+		SELECT rc.reconciliation_batch_id
+		FROM legal_holds h
+		JOIN reconciliation_mappings m
+		  ON (h.scope = ? AND m.bank_transaction_id = CAST(h.scope_id AS UNSIGNED))
+		  OR (h.scope = ? AND m.accounting_entry_id = CAST(h.scope_id AS UNSIGNED))
+		JOIN reconciliations rc ON rc.id = m.reconciliation_id
+		UNION
+		SELECT rc.reconciliation_batch_id
+		FROM legal_holds h
+		JOIN bank_transactions bt ON bt.account_number = h.scope_id
+		JOIN reconciliation_mappings m ON m.bank_transaction_id = bt.id
+		JOIN reconciliations rc ON rc.id = m.reconciliation_id
+		WHERE h.scope = ?
+		UNION
+		SELECT rc.reconciliation_batch_id
+		FROM legal_holds h
+		JOIN accounting_entries ae ON ae.account_code = h.scope_id
+		JOIN reconciliation_mappings m ON m.accounting_entry_id = ae.id
+		JOIN reconciliations rc ON rc.id = m.reconciliation_id
+		WHERE h.scope = ?
+	`,
+		models.LegalHoldScopeBatch,
+		models.LegalHoldScopeBankTransaction,
+		models.LegalHoldScopeAccountingEntry,
+		models.LegalHoldScopeAccount,
+		models.LegalHoldScopeAccount,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	batchIDs := []string{}
+	for rows.Next() {
+		var batchID string
+		if err := rows.Scan(&batchID); err != nil {
+			return nil, err
+		}
+		batchIDs = append(batchIDs, batchID)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return batchIDs, nil
+}
+
+func formatIDs(ids []int64) []string {
+	formatted := make([]string, len(ids))
+	for i, id := range ids {
+		formatted[i] = strconv.FormatInt(id, 10)
+	}
+	return formatted
+}
@@ -0,0 +1,69 @@
+package repositories
+
+import (
+	"database/sql"
+
+	"reconciliation-service/internal/models"
+)
+
+type MaintenanceRepository interface {
+	GetMaintenanceMode() (*models.MaintenanceMode, error)
+	UpdateMaintenanceMode(mode *models.MaintenanceMode) error
+}
+
+type maintenanceRepository struct {
+	db *sql.DB
+}
+
+func NewMaintenanceRepository(db *sql.DB) MaintenanceRepository {
+	return &maintenanceRepository{db: db}
+}
+
+func (r *maintenanceRepository) GetMaintenanceMode() (*models.MaintenanceMode, error) {
+	mode := &models.MaintenanceMode{}
+	var enabledAt sql.NullTime
+	query := `
+		SELECT enabled, message, retry_after_seconds, updated_by, enabled_at, updated_at
+		FROM maintenance_mode
+		WHERE id = 1
+	`
+	err := r.db.QueryRow(query).Scan(
+		&mode.Enabled,
+		&mode.Message,
+		&mode.RetryAfterSeconds,
+		&mode.UpdatedBy,
+		&enabledAt,
+		&mode.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return mode, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if enabledAt.Valid {
+		mode.EnabledAt = &enabledAt.Time
+	}
+	return mode, nil
+}
+
+func (r *maintenanceRepository) UpdateMaintenanceMode(mode *models.MaintenanceMode) error {
+	query := `
+		INSERT INTO maintenance_mode (id, enabled, message, retry_after_seconds, updated_by, enabled_at)
+		VALUES (1, ?, ?, ?, ?, IF(?, CURRENT_TIMESTAMP, NULL))
+		ON DUPLICATE KEY UPDATE
+			enabled_at = IF(VALUES(enabled), IF(enabled, enabled_at, CURRENT_TIMESTAMP), NULL),
+			enabled = VALUES(enabled),
+			message = VALUES(message),
+			retry_after_seconds = VALUES(retry_after_seconds),
+			updated_by = VALUES(updated_by)
+	`
+	_, err := r.db.Exec(query,
+		mode.Enabled,
+		mode.Message,
+		mode.RetryAfterSeconds,
+		mode.UpdatedBy,
+		mode.Enabled,
+	)
+	return err
+}
@@ -0,0 +1,244 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"reconciliation-service/internal/models"
+)
+
+var ErrPreferencesNotFound = errors.New("notification preferences not found")
+
+type NotificationRepository interface {
+	GetPreferences(userID string) (*models.NotificationPreferences, error)
+	ListPreferences() ([]*models.NotificationPreferences, error)
+	SavePreferences(prefs *models.NotificationPreferences) error
+	DeletePreferences(userID string) error
+	GetRoutes(eventType string) ([]models.NotificationRoute, error)
+	ClaimDispatch(eventType, entity string, window time.Duration) (*models.NotificationDispatch, error)
+}
+
+type notificationRepository struct {
+	db *sql.DB
+}
+
+func NewNotificationRepository(db *sql.DB) NotificationRepository {
+	return &notificationRepository{db: db}
+}
+
+func (r *notificationRepository) GetPreferences(userID string) (*models.NotificationPreferences, error) {
+	prefs := &models.NotificationPreferences{}
+	query := `
+		SELECT user_id, email, webhook_url, locale, updated_at
+		FROM notification_settings
+		WHERE user_id = ?
+	`
+	err := r.db.QueryRow(query, userID).Scan(
+		&prefs.UserID,
+		&prefs.Email,
+		&prefs.WebhookURL,
+		&prefs.Locale,
+		&prefs.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrPreferencesNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(`
+		SELECT event_type, channel, delivery
+		FROM notification_subscriptions
+		WHERE user_id = ?
+		ORDER BY event_type, channel
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	prefs.Subscriptions = []models.NotificationSubscription{}
+	for rows.Next() {
+		var sub models.NotificationSubscription
+		if err := rows.Scan(&sub.EventType, &sub.Channel, &sub.Delivery); err != nil {
+			return nil, err
+		}
+		prefs.Subscriptions = append(prefs.Subscriptions, sub)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return prefs, nil
+}
+
+// ListPreferences returns the preferences of every user, by user ID
+func (r *notificationRepository) ListPreferences() ([]*models.NotificationPreferences, error) {
+	rows, err := r.db.Query("SELECT user_id FROM notification_settings ORDER BY user_id")
+	if err != nil {
+		return nil, err
+	}
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	preferences := make([]*models.NotificationPreferences, 0, len(userIDs))
+	for _, userID := range userIDs {
+		prefs, err := r.GetPreferences(userID)
+		if err != nil {
+			return nil, err
+		}
+		preferences = append(preferences, prefs)
+	}
+	return preferences, nil
+}
+
+// SavePreferences upserts the settings and replaces the subscriptions of a
+// user in one transaction
+func (r *notificationRepository) SavePreferences(prefs *models.NotificationPreferences) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO notification_settings (user_id, email, webhook_url, locale)
+		VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			email = VALUES(email),
+			webhook_url = VALUES(webhook_url),
+			locale = VALUES(locale)
+	`, prefs.UserID, prefs.Email, prefs.WebhookURL, prefs.Locale)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM notification_subscriptions WHERE user_id = ?", prefs.UserID); err != nil {
+		return err
+	}
+	for _, sub := range prefs.Subscriptions {
+		_, err := tx.Exec(`
+			INSERT INTO notification_subscriptions (user_id, event_type, channel, delivery)
+			VALUES (?, ?, ?, ?)
+		`, prefs.UserID, sub.EventType, sub.Channel, sub.Delivery)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *notificationRepository) DeletePreferences(userID string) error {
+	result, err := r.db.Exec("DELETE FROM notification_settings WHERE user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrPreferencesNotFound
+	}
+	return nil
+}
+
+// GetRoutes lists every subscription to the event together with the address
+// of its channel
+func (r *notificationRepository) GetRoutes(eventType string) ([]models.NotificationRoute, error) {
+	query := `
+		SELECT s.user_id, s.channel, s.delivery,
+		       CASE s.channel WHEN 'email' THEN n.email WHEN 'webhook' THEN n.webhook_url ELSE '' END,
+		       n.locale
+		FROM notification_subscriptions s
+		JOIN notification_settings n ON n.user_id = s.user_id
+		WHERE s.event_type = ?
+		ORDER BY s.user_id, s.channel
+	`
+	rows, err := r.db.Query(query, eventType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var routes []models.NotificationRoute
+	for rows.Next() {
+		var route models.NotificationRoute
+		if err := rows.Scan(&route.UserID, &route.Channel, &route.Delivery, &route.Address, &route.Locale); err != nil {
+			return nil, err
+		}
+		routes = append(routes, route)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return routes, nil
+}
+
+// ClaimDispatch decides whether an occurrence of the event for the entity is
+// delivered. It is when the last delivery is older than window; otherwise it
+// only counts as suppressed. The row is locked so concurrent occurrences
+// cannot both be delivered.
+func (r *notificationRepository) ClaimDispatch(eventType, entity string, window time.Duration) (*models.NotificationDispatch, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT IGNORE INTO notification_dispatches (event_type, entity)
+		VALUES (?, ?)
+	`, eventType, entity)
+	if err != nil {
+		return nil, err
+	}
+
+	dispatch := &models.NotificationDispatch{EventType: eventType, Entity: entity}
+	var lastSentAt sql.NullTime
+	var now time.Time
+	err = tx.QueryRow(`
+		SELECT last_sent_at, suppressed, NOW()
+		FROM notification_dispatches
+		WHERE event_type = ? AND entity = ?
+		FOR UPDATE
+	`, eventType, entity).Scan(&lastSentAt, &dispatch.Suppressed, &now)
+	if err != nil {
+		return nil, err
+	}
+
+	if lastSentAt.Valid && now.Sub(lastSentAt.Time) < window {
+		dispatch.Suppressed++
+		dispatch.LastSentAt = lastSentAt.Time
+		_, err = tx.Exec(`
+			UPDATE notification_dispatches SET suppressed = suppressed + 1
+			WHERE event_type = ? AND entity = ?
+		`, eventType, entity)
+	} else {
+		dispatch.Sent = true
+		dispatch.LastSentAt = now
+		_, err = tx.Exec(`
+			UPDATE notification_dispatches SET last_sent_at = ?, suppressed = 0
+			WHERE event_type = ? AND entity = ?
+		`, now, eventType, entity)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return dispatch, nil
+}
@@ -0,0 +1,133 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"reconciliation-service/internal/models"
+)
+
+type PolicyPackRepository interface {
+	ListAssignments() ([]*models.PolicyPackAssignment, error)
+	SaveAssignment(assignment *models.PolicyPackAssignment) error
+	DeleteAssignment(account string) error
+	ListAssignedPacks() ([]string, error)
+	SaveBatchPolicy(tx *sql.Tx, batchID string, policy *models.BatchPolicy) error
+	GetBatchPolicy(batchID string) (*models.BatchPolicy, error)
+}
+
+type policyPackRepository struct {
+	db *sql.DB
+	// tenant whose assignments and batches are read and written
+	tenant string
+}
+
+func NewPolicyPackRepository(db *sql.DB, tenant string) PolicyPackRepository {
+	return &policyPackRepository{db: db, tenant: tenant}
+}
+
+// ListAssignments lists the tenant's assignments, its own first
+func (r *policyPackRepository) ListAssignments() ([]*models.PolicyPackAssignment, error) {
+	rows, err := r.db.Query(`
+		SELECT account, pack, assigned_by, updated_at
+		FROM policy_pack_assignments
+		WHERE tenant_id = ?
+		ORDER BY account
+	`, r.tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assignments := []*models.PolicyPackAssignment{}
+	for rows.Next() {
+		assignment := &models.PolicyPackAssignment{}
+		if err := rows.Scan(&assignment.Account, &assignment.Pack, &assignment.AssignedBy, &assignment.UpdatedAt); err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, assignment)
+	}
+	return assignments, rows.Err()
+}
+
+func (r *policyPackRepository) SaveAssignment(assignment *models.PolicyPackAssignment) error {
+	_, err := r.db.Exec(`
+		INSERT INTO policy_pack_assignments (tenant_id, account, pack, assigned_by)
+		VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE pack = VALUES(pack), assigned_by = VALUES(assigned_by)
+	`, r.tenant, assignment.Account, assignment.Pack, assignment.AssignedBy)
+	return err
+}
+
+func (r *policyPackRepository) DeleteAssignment(account string) error {
+	_, err := r.db.Exec(`
+		DELETE FROM policy_pack_assignments
+		WHERE tenant_id = ? AND account = ?
+	`, r.tenant, account)
+	return err
+}
+
+// ListAssignedPacks lists the packs assigned anywhere in the deployment, for
+// the settings that are not kept per tenant
+func (r *policyPackRepository) ListAssignedPacks() ([]string, error) {
+	rows, err := r.db.Query(`
+		SELECT DISTINCT pack
+		FROM policy_pack_assignments
+		ORDER BY pack
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var packs []string
+	for rows.Next() {
+		var pack string
+		if err := rows.Scan(&pack); err != nil {
+			return nil, err
+		}
+		packs = append(packs, pack)
+	}
+	return packs, rows.Err()
+}
+
+// SaveBatchPolicy records the packs of a batch. A batch written in several
+// transactions, such as the partitions of a run, keeps the first record.
+func (r *policyPackRepository) SaveBatchPolicy(tx *sql.Tx, batchID string, policy *models.BatchPolicy) error {
+	var accountPacks []byte
+	if len(policy.AccountPacks) > 0 {
+		var err error
+		if accountPacks, err = json.Marshal(policy.AccountPacks); err != nil {
+			return err
+		}
+	}
+	_, err := tx.Exec(`
+		INSERT IGNORE INTO batch_policy_packs (tenant_id, reconciliation_batch_id, policy_pack, account_packs)
+		VALUES (?, ?, ?, ?)
+	`, r.tenant, batchID, policy.PolicyPack, accountPacks)
+	return err
+}
+
+// GetBatchPolicy returns the packs a batch ran under, or nil for a batch
+// run before packs were recorded
+func (r *policyPackRepository) GetBatchPolicy(batchID string) (*models.BatchPolicy, error) {
+	policy := &models.BatchPolicy{}
+	var accountPacks []byte
+	err := r.db.QueryRow(`
+		SELECT policy_pack, account_packs
+		FROM batch_policy_packs
+		WHERE tenant_id = ? AND reconciliation_batch_id = ?
+	`, r.tenant, batchID).Scan(&policy.PolicyPack, &accountPacks)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(accountPacks) > 0 {
+		if err := json.Unmarshal(accountPacks, &policy.AccountPacks); err != nil {
+			return nil, err
+		}
+	}
+	return policy, nil
+}
@@ -1,38 +1,78 @@
 package repositories
 
 import (
+	"context"
 	"database/sql"
-	"errors"
+	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
 
 	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/money"
 )
 
 type ReconciliationRepository interface {
 	CreateReconciliation(tx *sql.Tx, rec *models.Reconciliation) error
 	GetReconciliationByID(id int64) (*models.Reconciliation, error)
-	GetReconciliationByBatchID(batchID string) (*models.Reconciliation, error)
-	UpdateReconciliationStatus(tx *sql.Tx, id int64, status string) error
+	GetReconciliationByBatchID(ctx context.Context, batchID string) (*models.Reconciliation, error)
+	UpdateReconciliationStatus(tx *sql.Tx, id int64, status string, version int) error
 	CreateMapping(tx *sql.Tx, mapping *models.ReconciliationMapping) error
+	CreateMappings(tx *sql.Tx, mappings []*models.ReconciliationMapping) error
+	GetMappingsForUpdate(tx *sql.Tx, reconciliationID int64) ([]*models.ReconciliationMapping, error)
+	DeleteMappings(tx *sql.Tx, reconciliationID int64) error
+	UpdateOpenAmounts(tx *sql.Tx, bankTransactionIDs, accountingEntryIDs []int64) error
+	GetLaterSettlements(tx *sql.Tx, reconciliationID int64) ([]int64, error)
 	CreateAuditEntry(tx *sql.Tx, audit *models.ReconciliationAudit) error
+	CreateAuditEntries(tx *sql.Tx, audits []*models.ReconciliationAudit) error
+	ListAuditTrail(filter models.AuditTrailFilter) ([]*models.AuditTrailEntry, error)
 	GetUnmatchedRecords(fromDate, toDate string) (map[string]interface{}, error)
+	LockMappedAccountingEntries(tx *sql.Tx, entries []*models.AccountingEntry) (map[int64]bool, error)
+	CreateResultItems(tx *sql.Tx, batchID, kind string, payloads [][]byte) error
+	GetResultItems(batchID, kind string, afterID int64, offset, limit int) ([]*models.ResultItem, int, error)
+	StreamBatchMappings(batchID string, fn func(*models.BatchReportRow) error) error
+	CountBatchReportRows(batchID string) (int, error)
+	GetBatchSummary(tx *sql.Tx, batchID string) (models.BatchSummary, error)
+	GetBatchDetails(tx *sql.Tx, batchID string) ([]*models.ReconciliationDetail, error)
+	ListPendingReview(tx *sql.Tx, batchID string, afterID int64, limit int) ([]*models.ReconciliationDetail, error)
+	GetBatchIDsForBankTransaction(tx *sql.Tx, id int64) ([]string, error)
+	GetBatchIDsForAccountingEntry(tx *sql.Tx, id int64) ([]string, error)
+	GetReconciliationIDsForBankTransaction(tx *sql.Tx, id int64) ([]int64, error)
+	GetReconciliationIDsForAccountingEntry(tx *sql.Tx, id int64) ([]int64, error)
+	GetRecordMappings(bankTransactionIDs, accountingEntryIDs []int64) ([]*models.RecordMapping, error)
+	CreateBatchDelta(tx *sql.Tx, delta *models.BatchDelta) error
+	GetBatchDeltas(batchIDs []string) ([]*models.BatchDelta, error)
+	GetClassificationHistory(limit int) ([]*models.ClassifiedTransaction, error)
+	GetClassificationVersion() (string, error)
+	SaveBatchKPIs(batchID, tenant string, kpis []*models.BatchKPI) error
+	GetBatchKPIs(batchID string) ([]*models.BatchKPI, error)
+	SaveAccountOutcomes(tx *sql.Tx, batchID string, outcomes []*models.AccountOutcome) error
+	GetAccountOutcomes(batchID string) ([]*models.AccountOutcome, error)
+	ReferenceTaken(reference string) (bool, error)
+	SaveBatchReference(tx *sql.Tx, batchID, reference string) error
+	GetBatchIDByReference(reference string) (string, error)
+	GetBatchReference(batchID string) (string, error)
 }
 
 type reconciliationRepository struct {
-	db *sql.DB
+	db     *sql.DB
+	tenant string
 }
 
-func NewReconciliationRepository(db *sql.DB) ReconciliationRepository {
-	return &reconciliationRepository{db: db}
+// NewReconciliationRepository reads and writes the reconciliations of one
+// tenant, with their mappings, audit entries and batch results
+func NewReconciliationRepository(db *sql.DB, tenant string) ReconciliationRepository {
+	return &reconciliationRepository{db: db, tenant: tenant}
 }
 
 func (r *reconciliationRepository) CreateReconciliation(tx *sql.Tx, rec *models.Reconciliation) error {
 	query := `
 		INSERT INTO reconciliations (
-			reconciliation_batch_id, status, match_confidence, amount_difference
-		) VALUES (?, ?, ?, ?)
+			tenant_id, reconciliation_batch_id, status, match_confidence, amount_difference
+		) VALUES (?, ?, ?, ?, ?)
 	`
 	result, err := tx.Exec(query,
+		r.tenant,
 		rec.BatchID,
 		rec.Status,
 		rec.MatchConfidence,
@@ -54,21 +94,22 @@ func (r *reconciliationRepository) GetReconciliationByID(id int64) (*models.Reco
 	rec := &models.Reconciliation{}
 	query := `
 		SELECT id, reconciliation_batch_id, status, match_confidence,
-		       amount_difference, created_at, updated_at
+		       amount_difference, version, created_at, updated_at
 		FROM reconciliations
-		WHERE id = ?
+		WHERE id = ? AND tenant_id = ?
 	`
-	err := r.db.QueryRow(query, id).Scan(
+	err := r.db.QueryRow(query, id, r.tenant).Scan(
 		&rec.ID,
 		&rec.BatchID,
 		&rec.Status,
 		&rec.MatchConfidence,
 		&rec.AmountDifference,
+		&rec.Version,
 		&rec.CreatedAt,
 		&rec.UpdatedAt,
 	)
 	if err == sql.ErrNoRows {
-		return nil, errors.New("reconciliation not found")
+		return nil, ErrReconciliationNotFound
 	}
 	if err != nil {
 		return nil, err
@@ -76,25 +117,26 @@ func (r *reconciliationRepository) GetReconciliationByID(id int64) (*models.Reco
 	return rec, nil
 }
 
-func (r *reconciliationRepository) GetReconciliationByBatchID(batchID string) (*models.Reconciliation, error) {
+func (r *reconciliationRepository) GetReconciliationByBatchID(ctx context.Context, batchID string) (*models.Reconciliation, error) {
 	rec := &models.Reconciliation{}
 	query := `
 		SELECT id, reconciliation_batch_id, status, match_confidence,
-		       amount_difference, created_at, updated_at
+		       amount_difference, version, created_at, updated_at
 		FROM reconciliations
-		WHERE reconciliation_batch_id = ?
+		WHERE tenant_id = ? AND reconciliation_batch_id = ?
 	`
-	err := r.db.QueryRow(query, batchID).Scan(
+	err := r.db.QueryRowContext(ctx, query, r.tenant, batchID).Scan(
 		&rec.ID,
 		&rec.BatchID,
 		&rec.Status,
 		&rec.MatchConfidence,
 		&rec.AmountDifference,
+		&rec.Version,
 		&rec.CreatedAt,
 		&rec.UpdatedAt,
 	)
 	if err == sql.ErrNoRows {
-		return nil, errors.New("reconciliation not found")
+		return nil, ErrReconciliationNotFound
 	}
 	if err != nil {
 		return nil, err
@@ -102,42 +144,41 @@ func (r *reconciliationRepository) GetReconciliationByBatchID(batchID string) (*
 	return rec, nil
 }
 
-func (r *reconciliationRepository) UpdateReconciliationStatus(tx *sql.Tx, id int64, status string) error {
+// UpdateReconciliationStatus changes the status only while the row is still
+// at version, returning ErrVersionConflict otherwise
+func (r *reconciliationRepository) UpdateReconciliationStatus(tx *sql.Tx, id int64, status string, version int) error {
 	query := `
 		UPDATE reconciliations
 		SET status = ?,
+		    version = version + 1,
 		    updated_at = ?
-		WHERE id = ?
+		WHERE id = ? AND tenant_id = ? AND version = ?
 	`
-	result, err := tx.Exec(query, status, time.Now(), id)
+	result, err := tx.Exec(query, status, time.Now(), id, r.tenant, version)
 	if err != nil {
 		return err
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return err
-	}
-	if rowsAffected == 0 {
-		return errors.New("reconciliation not found")
-	}
-	return nil
+	return checkVersionedUpdate(tx, result, "reconciliations", r.tenant, id, ErrReconciliationNotFound)
 }
 
 func (r *reconciliationRepository) CreateMapping(tx *sql.Tx, mapping *models.ReconciliationMapping) error {
 	query := `
 		INSERT INTO reconciliation_mappings (
-			reconciliation_id, bank_transaction_id, accounting_entry_id, mapping_type
-		) VALUES (?, ?, ?, ?)
+			tenant_id, reconciliation_id, bank_transaction_id, accounting_entry_id, mapping_type, amount, details
+		) VALUES (?, ?, ?, ?, ?, ?, ?)
 	`
 	result, err := tx.Exec(query,
+		r.tenant,
 		mapping.ReconciliationID,
 		mapping.BankTransactionID,
 		mapping.AccountingEntryID,
 		mapping.MappingType,
+		mapping.Amount,
+		nullableJSON(mapping.Details),
 	)
 	if err != nil {
-		return err
+		return mappingError(err, mapping)
 	}
 
 	id, err := result.LastInsertId()
@@ -148,13 +189,189 @@ func (r *reconciliationRepository) CreateMapping(tx *sql.Tx, mapping *models.Rec
 	return nil
 }
 
+// CreateMappings inserts mappings in the given order, many to a statement.
+// Unlike CreateMapping it leaves their IDs unset.
+func (r *reconciliationRepository) CreateMappings(tx *sql.Tx, mappings []*models.ReconciliationMapping) error {
+	for start := 0; start < len(mappings); start += insertChunk {
+		chunk := mappings[start:min(start+insertChunk, len(mappings))]
+
+		values := make([]string, 0, len(chunk))
+		args := make([]interface{}, 0, 7*len(chunk))
+		for _, mapping := range chunk {
+			values = append(values, "(?, ?, ?, ?, ?, ?, ?)")
+			args = append(args, r.tenant, mapping.ReconciliationID, mapping.BankTransactionID,
+				mapping.AccountingEntryID, mapping.MappingType, mapping.Amount, nullableJSON(mapping.Details))
+		}
+
+		query := `INSERT INTO reconciliation_mappings (tenant_id, reconciliation_id, bank_transaction_id, accounting_entry_id, mapping_type, amount, details) VALUES ` + strings.Join(values, ", ")
+		if _, err := tx.Exec(query, args...); err != nil {
+			return mappingsError(err, chunk)
+		}
+	}
+	return nil
+}
+
+// mappingsError explains a statement of mappings the schema's constraints
+// refused; MySQL does not say which of them it refused
+func mappingsError(err error, mappings []*models.ReconciliationMapping) error {
+	if len(mappings) == 1 {
+		return mappingError(err, mappings[0])
+	}
+	records := fmt.Sprintf("a mapping of reconciliations %d to %d",
+		mappings[0].ReconciliationID, mappings[len(mappings)-1].ReconciliationID)
+	switch {
+	case IsDuplicateEntry(err):
+		return fmt.Errorf("%w: %s", ErrMappingConflict, records)
+	case IsForeignKeyViolation(err):
+		return fmt.Errorf("%w: %s", ErrMappingRecordMissing, records)
+	case IsCheckViolation(err):
+		return fmt.Errorf("%w: %s", ErrMappingWithoutRecord, records)
+	}
+	return err
+}
+
+// mappingError explains a mapping the schema's constraints refused
+func mappingError(err error, mapping *models.ReconciliationMapping) error {
+	records := fmt.Sprintf("reconciliation %d, bank transaction %d, accounting entry %d",
+		mapping.ReconciliationID, mapping.BankTransactionID.Int64, mapping.AccountingEntryID.Int64)
+	switch {
+	case IsDuplicateEntry(err):
+		return fmt.Errorf("%w: %s", ErrMappingConflict, records)
+	case IsForeignKeyViolation(err):
+		return fmt.Errorf("%w: %s", ErrMappingRecordMissing, records)
+	case IsCheckViolation(err):
+		return fmt.Errorf("%w: reconciliation %d", ErrMappingWithoutRecord, mapping.ReconciliationID)
+	}
+	return err
+}
+
+// GetMappingsForUpdate reads and locks the mappings of a reconciliation
+func (r *reconciliationRepository) GetMappingsForUpdate(tx *sql.Tx, reconciliationID int64) ([]*models.ReconciliationMapping, error) {
+	rows, err := tx.Query(`
+		SELECT id, reconciliation_id, bank_transaction_id, accounting_entry_id,
+		       mapping_type, amount, created_at
+		FROM reconciliation_mappings
+		WHERE tenant_id = ? AND reconciliation_id = ?
+		ORDER BY id
+		FOR UPDATE
+	`, r.tenant, reconciliationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mappings []*models.ReconciliationMapping
+	for rows.Next() {
+		mapping := &models.ReconciliationMapping{}
+		err := rows.Scan(
+			&mapping.ID,
+			&mapping.ReconciliationID,
+			&mapping.BankTransactionID,
+			&mapping.AccountingEntryID,
+			&mapping.MappingType,
+			&mapping.Amount,
+			&mapping.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		mappings = append(mappings, mapping)
+	}
+	return mappings, rows.Err()
+}
+
+// DeleteMappings removes every mapping of a reconciliation, which releases
+// its bank transactions and entries to later runs
+func (r *reconciliationRepository) DeleteMappings(tx *sql.Tx, reconciliationID int64) error {
+	_, err := tx.Exec("DELETE FROM reconciliation_mappings WHERE tenant_id = ? AND reconciliation_id = ?", r.tenant, reconciliationID)
+	return err
+}
+
+// UpdateOpenAmounts works out what is left open of records from their
+// mappings. Only records a partial mapping touched are tracked: nothing is
+// left of one a whole match settled as well, and the others keep their
+// amount less what their partial mappings settled.
+func (r *reconciliationRepository) UpdateOpenAmounts(tx *sql.Tx, bankTransactionIDs, accountingEntryIDs []int64) error {
+	sides := []struct {
+		table  string
+		column string
+		ids    []int64
+	}{
+		{"bank_transactions", "bank_transaction_id", bankTransactionIDs},
+		{"accounting_entries", "accounting_entry_id", accountingEntryIDs},
+	}
+	for _, side := range sides {
+		if len(side.ids) == 0 {
+			continue
+		}
+		args := make([]interface{}, 0, len(side.ids)+3)
+		args = append(args, models.MappingPartial, models.MappingPartial, models.MappingPartial, r.tenant)
+		for _, id := range side.ids {
+			args = append(args, id)
+		}
+		_, err := tx.Exec(`
+			UPDATE `+side.table+` t
+			LEFT JOIN (
+				SELECT `+side.column+` AS record_id,
+				       SUM(mapping_type = ?) AS partials,
+				       SUM(mapping_type <> ?) AS whole,
+				       SUM(CASE WHEN mapping_type = ? THEN amount ELSE 0 END) AS settled
+				FROM reconciliation_mappings
+				WHERE `+side.column+` IS NOT NULL
+				GROUP BY `+side.column+`
+			) m ON m.record_id = t.id
+			SET t.open_amount = CASE
+				WHEN m.partials IS NULL OR m.partials = 0 THEN NULL
+				WHEN m.whole > 0 THEN 0
+				ELSE t.amount - m.settled
+			END
+			WHERE t.tenant_id = ? AND t.id IN (`+placeholders(len(side.ids))+`)
+		`, args...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetLaterSettlements lists the other reconciliations mapping records of the
+// given one in full, which settled what its partial mappings left open
+func (r *reconciliationRepository) GetLaterSettlements(tx *sql.Tx, reconciliationID int64) ([]int64, error) {
+	rows, err := tx.Query(`
+		SELECT DISTINCT other.reconciliation_id
+		FROM reconciliation_mappings rm
+		JOIN reconciliation_mappings other
+		  ON (other.bank_transaction_id = rm.bank_transaction_id OR other.accounting_entry_id = rm.accounting_entry_id)
+		 AND other.reconciliation_id <> rm.reconciliation_id
+		WHERE rm.tenant_id = ? AND rm.reconciliation_id = ?
+		AND rm.mapping_type = ? AND other.mapping_type <> ?
+		AND other.id > rm.id
+		ORDER BY other.reconciliation_id
+	`, r.tenant, reconciliationID, models.MappingPartial, models.MappingPartial)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
 func (r *reconciliationRepository) CreateAuditEntry(tx *sql.Tx, audit *models.ReconciliationAudit) error {
 	query := `
 		INSERT INTO reconciliation_audit (
-			reconciliation_id, action, details, user_id
-		) VALUES (?, ?, ?, ?)
+			tenant_id, reconciliation_id, action, details, user_id
+		) VALUES (?, ?, ?, ?, ?)
 	`
 	result, err := tx.Exec(query,
+		r.tenant,
 		audit.ReconciliationID,
 		audit.Action,
 		audit.Details,
@@ -172,15 +389,113 @@ func (r *reconciliationRepository) CreateAuditEntry(tx *sql.Tx, audit *models.Re
 	return nil
 }
 
+// CreateAuditEntries inserts audit entries in the given order, many to a
+// statement. Unlike CreateAuditEntry it leaves their IDs unset.
+func (r *reconciliationRepository) CreateAuditEntries(tx *sql.Tx, audits []*models.ReconciliationAudit) error {
+	for start := 0; start < len(audits); start += insertChunk {
+		end := min(start+insertChunk, len(audits))
+
+		values := make([]string, 0, end-start)
+		args := make([]interface{}, 0, 5*(end-start))
+		for _, audit := range audits[start:end] {
+			values = append(values, "(?, ?, ?, ?, ?)")
+			args = append(args, r.tenant, audit.ReconciliationID, audit.Action, audit.Details, audit.UserID)
+		}
+
+		query := `INSERT INTO reconciliation_audit (tenant_id, reconciliation_id, action, details, user_id) VALUES ` + strings.Join(values, ", ")
+		if _, err := tx.Exec(query, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListAuditTrail returns the audit entries of the tenant's reconciliations
+// that match filter, newest first
+func (r *reconciliationRepository) ListAuditTrail(filter models.AuditTrailFilter) ([]*models.AuditTrailEntry, error) {
+	query := `
+		SELECT a.id, a.reconciliation_id, r.reconciliation_batch_id, a.action,
+		       a.details, COALESCE(a.user_id, ''), a.created_at
+		FROM reconciliation_audit a
+		JOIN reconciliations r ON r.id = a.reconciliation_id
+	`
+	conditions := []string{"a.tenant_id = ?"}
+	args := []interface{}{r.tenant}
+	if filter.BatchID != "" {
+		conditions = append(conditions, "r.reconciliation_batch_id = ?")
+		args = append(args, filter.BatchID)
+	}
+	if filter.UserID != "" {
+		conditions = append(conditions, "a.user_id = ?")
+		args = append(args, filter.UserID)
+	}
+	if filter.Action != "" {
+		conditions = append(conditions, "a.action = ?")
+		args = append(args, filter.Action)
+	}
+	if filter.From != "" {
+		conditions = append(conditions, "a.created_at >= ?")
+		args = append(args, filter.From)
+	}
+	if filter.To != "" {
+		conditions = append(conditions, "a.created_at < DATE_ADD(?, INTERVAL 1 DAY)")
+		args = append(args, filter.To)
+	}
+	if filter.BeforeID > 0 {
+		conditions = append(conditions, "a.id < ?")
+		args = append(args, filter.BeforeID)
+	}
+	query += " WHERE " + strings.Join(conditions, " AND ") + " ORDER BY a.id DESC LIMIT ?"
+	args = append(args, filter.Limit)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*models.AuditTrailEntry{}
+	for rows.Next() {
+		entry := &models.AuditTrailEntry{}
+		var details []byte
+		err := rows.Scan(
+			&entry.ID,
+			&entry.ReconciliationID,
+			&entry.BatchID,
+			&entry.Action,
+			&details,
+			&entry.UserID,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if len(details) > 0 {
+			entry.Details = details
+		}
+		entries = append(entries, entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
 func (r *reconciliationRepository) GetUnmatchedRecords(fromDate, toDate string) (map[string]interface{}, error) {
 	bankQuery := `
-		SELECT bt.id, bt.transaction_id, bt.amount, bt.transaction_date
+		SELECT bt.id, bt.transaction_id, bt.amount, bt.open_amount, bt.currency, bt.transaction_date,
+		       COALESCE(s.owner, ''), COALESCE(s.on_hold, FALSE), s.tags, COALESCE(s.reason_code, '')
 		FROM bank_transactions bt
-		LEFT JOIN reconciliation_mappings rm ON bt.id = rm.bank_transaction_id
-		WHERE rm.id IS NULL
+		LEFT JOIN unmatched_item_states s ON s.tenant_id = bt.tenant_id
+		     AND s.record_type = 'bank_transaction' AND s.record_id = bt.id
+		WHERE (bt.open_amount <> 0 OR NOT EXISTS (
+			SELECT 1 FROM reconciliation_mappings rm WHERE rm.bank_transaction_id = bt.id
+		))
+		AND bt.voided_at IS NULL
+		AND bt.tenant_id = ?
 		AND bt.transaction_date BETWEEN ? AND ?
 	`
-	bankRows, err := r.db.Query(bankQuery, fromDate, toDate)
+	bankRows, err := r.db.Query(bankQuery, r.tenant, fromDate, toDate)
 	if err != nil {
 		return nil, err
 	}
@@ -190,30 +505,46 @@ func (r *reconciliationRepository) GetUnmatchedRecords(fromDate, toDate string)
 	for bankRows.Next() {
 		var id int64
 		var transactionID string
-		var amount float64
+		var amount money.Amount
+		var openAmount *money.Amount
+		var currency string
 		var transactionDate string
+		var state unmatchedStateColumns
 
-		err := bankRows.Scan(&id, &transactionID, &amount, &transactionDate)
+		err := bankRows.Scan(&id, &transactionID, &amount, &openAmount, &currency, &transactionDate,
+			&state.owner, &state.onHold, &state.tags, &state.reasonCode)
 		if err != nil {
 			return nil, err
 		}
 
-		unmatchedBankTransactions = append(unmatchedBankTransactions, map[string]interface{}{
+		record := map[string]interface{}{
 			"id":               id,
 			"transaction_id":   transactionID,
 			"amount":           amount,
+			"currency":         currency,
 			"transaction_date": transactionDate,
-		})
+		}
+		addOpenAmount(record, openAmount)
+		if err := state.addTo(record); err != nil {
+			return nil, err
+		}
+		unmatchedBankTransactions = append(unmatchedBankTransactions, record)
 	}
 
 	accountingQuery := `
-		SELECT ae.id, ae.entry_id, ae.amount, ae.entry_date
+		SELECT ae.id, ae.entry_id, ae.amount, ae.open_amount, ae.currency, ae.entry_date,
+		       COALESCE(s.owner, ''), COALESCE(s.on_hold, FALSE), s.tags, COALESCE(s.reason_code, '')
 		FROM accounting_entries ae
-		LEFT JOIN reconciliation_mappings rm ON ae.id = rm.accounting_entry_id
-		WHERE rm.id IS NULL
+		LEFT JOIN unmatched_item_states s ON s.tenant_id = ae.tenant_id
+		     AND s.record_type = 'accounting_entry' AND s.record_id = ae.id
+		WHERE (ae.open_amount <> 0 OR NOT EXISTS (
+			SELECT 1 FROM reconciliation_mappings rm WHERE rm.accounting_entry_id = ae.id
+		))
+		AND ae.voided_at IS NULL
+		AND ae.tenant_id = ?
 		AND ae.entry_date BETWEEN ? AND ?
 	`
-	accountingRows, err := r.db.Query(accountingQuery, fromDate, toDate)
+	accountingRows, err := r.db.Query(accountingQuery, r.tenant, fromDate, toDate)
 	if err != nil {
 		return nil, err
 	}
@@ -223,20 +554,30 @@ func (r *reconciliationRepository) GetUnmatchedRecords(fromDate, toDate string)
 	for accountingRows.Next() {
 		var id int64
 		var entryID string
-		var amount float64
+		var amount money.Amount
+		var openAmount *money.Amount
+		var currency string
 		var entryDate string
+		var state unmatchedStateColumns
 
-		err := accountingRows.Scan(&id, &entryID, &amount, &entryDate)
+		err := accountingRows.Scan(&id, &entryID, &amount, &openAmount, &currency, &entryDate,
+			&state.owner, &state.onHold, &state.tags, &state.reasonCode)
 		if err != nil {
 			return nil, err
 		}
 
-		unmatchedAccountingEntries = append(unmatchedAccountingEntries, map[string]interface{}{
+		record := map[string]interface{}{
 			"id":         id,
 			"entry_id":   entryID,
 			"amount":     amount,
+			"currency":   currency,
 			"entry_date": entryDate,
-		})
+		}
+		addOpenAmount(record, openAmount)
+		if err := state.addTo(record); err != nil {
+			return nil, err
+		}
+		unmatchedAccountingEntries = append(unmatchedAccountingEntries, record)
 	}
 
 	return map[string]interface{}{
@@ -244,3 +585,875 @@ func (r *reconciliationRepository) GetUnmatchedRecords(fromDate, toDate string)
 		"unmatched_accounting_entries": unmatchedAccountingEntries,
 	}, nil
 }
+
+// addOpenAmount marks an unmatched record a partial match settled part of
+// with what is left of it
+func addOpenAmount(record map[string]interface{}, openAmount *money.Amount) {
+	if openAmount != nil {
+		record["open_amount"] = *openAmount
+		record["partially_matched"] = true
+	}
+}
+
+// unmatchedStateColumns holds the work state scanned with an unmatched
+// record
+type unmatchedStateColumns struct {
+	owner      string
+	onHold     bool
+	tags       []byte
+	reasonCode string
+}
+
+// addTo adds the state that is set to an unmatched record
+func (c unmatchedStateColumns) addTo(record map[string]interface{}) error {
+	if c.owner != "" {
+		record["owner"] = c.owner
+	}
+	if c.onHold {
+		record["on_hold"] = true
+	}
+	if len(c.tags) > 0 {
+		var tags []string
+		if err := json.Unmarshal(c.tags, &tags); err != nil {
+			return err
+		}
+		record["tags"] = tags
+	}
+	if c.reasonCode != "" {
+		record["reason_code"] = c.reasonCode
+	}
+	return nil
+}
+
+// LockMappedAccountingEntries takes row locks on the given accounting entries
+// and reports which of them were mapped since they were read, so concurrent
+// runs can't map the same entry twice: an entry read without an open amount
+// that has a mapping now, or one whose open amount has moved on
+func (r *reconciliationRepository) LockMappedAccountingEntries(tx *sql.Tx, entries []*models.AccountingEntry) (map[int64]bool, error) {
+	args := make([]interface{}, 0, len(entries)+1)
+	args = append(args, r.tenant)
+	for _, ae := range entries {
+		args = append(args, ae.ID)
+	}
+
+	lockQuery := `SELECT id, open_amount FROM accounting_entries WHERE tenant_id = ? AND id IN (` + placeholders(len(entries)) + `) ORDER BY id FOR UPDATE`
+	lockRows, err := tx.Query(lockQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	open := make(map[int64]*money.Amount)
+	for lockRows.Next() {
+		var id int64
+		var amount *money.Amount
+		if err := lockRows.Scan(&id, &amount); err != nil {
+			lockRows.Close()
+			return nil, err
+		}
+		open[id] = amount
+	}
+	lockRows.Close()
+	if err = lockRows.Err(); err != nil {
+		return nil, err
+	}
+
+	mappedQuery := `SELECT DISTINCT accounting_entry_id FROM reconciliation_mappings WHERE tenant_id = ? AND accounting_entry_id IN (` + placeholders(len(entries)) + `)`
+	rows, err := tx.Query(mappedQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hasMapping := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		hasMapping[id] = true
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	mapped := make(map[int64]bool)
+	for _, ae := range entries {
+		if ae.OpenAmount == nil {
+			mapped[ae.ID] = hasMapping[ae.ID]
+			continue
+		}
+		current := open[ae.ID]
+		mapped[ae.ID] = current == nil || *current != *ae.OpenAmount
+	}
+	return mapped, nil
+}
+
+// insertChunk keeps multi-row inserts well under max_allowed_packet
+const insertChunk = 500
+
+// CreateResultItems appends result items to a batch in the given order
+func (r *reconciliationRepository) CreateResultItems(tx *sql.Tx, batchID, kind string, payloads [][]byte) error {
+	for start := 0; start < len(payloads); start += insertChunk {
+		end := min(start+insertChunk, len(payloads))
+
+		values := make([]string, 0, end-start)
+		args := make([]interface{}, 0, 4*(end-start))
+		for _, payload := range payloads[start:end] {
+			values = append(values, "(?, ?, ?, ?)")
+			args = append(args, r.tenant, batchID, kind, payload)
+		}
+
+		query := `INSERT INTO reconciliation_results (tenant_id, reconciliation_batch_id, kind, payload) VALUES ` + strings.Join(values, ", ")
+		if _, err := tx.Exec(query, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetResultItems pages through a batch's result items of one kind in the
+// order they were written, from those after afterID when it is not zero,
+// together with how many there are in total
+func (r *reconciliationRepository) GetResultItems(batchID, kind string, afterID int64, offset, limit int) ([]*models.ResultItem, int, error) {
+	var total int
+	err := r.db.QueryRow(`
+		SELECT COUNT(*)
+		FROM reconciliation_results
+		WHERE tenant_id = ? AND reconciliation_batch_id = ? AND kind = ?
+	`, r.tenant, batchID, kind).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.Query(`
+		SELECT id, payload
+		FROM reconciliation_results
+		WHERE tenant_id = ? AND reconciliation_batch_id = ? AND kind = ? AND id > ?
+		ORDER BY id
+		LIMIT ? OFFSET ?
+	`, r.tenant, batchID, kind, afterID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	items := []*models.ResultItem{}
+	for rows.Next() {
+		item := &models.ResultItem{}
+		var payload []byte
+		if err := rows.Scan(&item.ID, &payload); err != nil {
+			return nil, 0, err
+		}
+		item.Payload = json.RawMessage(payload)
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	return items, total, nil
+}
+
+// StreamBatchMappings calls fn with each mapping of a batch's
+// reconciliations, in the order they were written, without holding them all
+// in memory. An error from fn stops the stream and is returned.
+func (r *reconciliationRepository) StreamBatchMappings(batchID string, fn func(*models.BatchReportRow) error) error {
+	rows, err := r.db.Query(`
+		SELECT r.id, r.status, rm.mapping_type, COALESCE(r.match_confidence, 0), r.amount_difference,
+		       COALESCE(bt.transaction_id, ''), COALESCE(bt.account_number, ''),
+		       COALESCE(DATE_FORMAT(bt.transaction_date, '%Y-%m-%d'), ''), bt.amount, COALESCE(bt.currency, ''),
+		       COALESCE(ae.entry_id, ''), COALESCE(ae.account_code, ''),
+		       COALESCE(DATE_FORMAT(ae.entry_date, '%Y-%m-%d'), ''), ae.amount, COALESCE(ae.currency, '')
+		FROM reconciliations r
+		JOIN reconciliation_mappings rm ON rm.reconciliation_id = r.id
+		LEFT JOIN bank_transactions bt ON bt.id = rm.bank_transaction_id
+		LEFT JOIN accounting_entries ae ON ae.id = rm.accounting_entry_id
+		WHERE r.tenant_id = ? AND r.reconciliation_batch_id = ?
+		ORDER BY r.id, rm.id
+	`, r.tenant, batchID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		row := &models.BatchReportRow{Section: models.ResultKindMatch}
+		err := rows.Scan(
+			&row.ReconciliationID,
+			&row.Status,
+			&row.MappingType,
+			&row.MatchConfidence,
+			&row.AmountDifference,
+			&row.TransactionID,
+			&row.AccountNumber,
+			&row.TransactionDate,
+			&row.BankAmount,
+			&row.BankCurrency,
+			&row.EntryID,
+			&row.AccountCode,
+			&row.EntryDate,
+			&row.AccountingAmount,
+			&row.EntryCurrency,
+		)
+		if err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// CountBatchReportRows counts the lines of a batch's report: its mappings
+// and its unmatched result items
+func (r *reconciliationRepository) CountBatchReportRows(batchID string) (int, error) {
+	var count int
+	err := r.db.QueryRow(`
+		SELECT (
+			SELECT COUNT(*)
+			FROM reconciliations r
+			JOIN reconciliation_mappings rm ON rm.reconciliation_id = r.id
+			WHERE r.tenant_id = ? AND r.reconciliation_batch_id = ?
+		) + (
+			SELECT COUNT(*)
+			FROM reconciliation_results
+			WHERE tenant_id = ? AND reconciliation_batch_id = ? AND kind = ?
+		)
+	`, r.tenant, batchID, r.tenant, batchID, models.ResultKindUnmatched).Scan(&count)
+	return count, err
+}
+
+// GetBatchSummary totals a batch as it stands within tx. The matched amount
+// counts each bank transaction of a matched reconciliation once, however many
+// entries it was split across.
+func (r *reconciliationRepository) GetBatchSummary(tx *sql.Tx, batchID string) (models.BatchSummary, error) {
+	var summary models.BatchSummary
+	err := tx.QueryRow(`
+		SELECT COALESCE(SUM(status = 'matched'), 0),
+		       COALESCE(SUM(status = 'unmatched'), 0),
+		       COALESCE(SUM(status = 'disputed'), 0),
+		       COALESCE(SUM(status = 'pending_review'), 0),
+		       COALESCE(SUM(amount_difference), 0)
+		FROM reconciliations
+		WHERE tenant_id = ? AND reconciliation_batch_id = ?
+	`, r.tenant, batchID).Scan(&summary.Matched, &summary.Unmatched, &summary.Disputed, &summary.PendingReview, &summary.AmountDifference)
+	if err != nil {
+		return summary, err
+	}
+
+	// A partial match counts for what it settled, not the whole transaction
+	var settled money.Amount
+	err = tx.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(rm.amount), 0)
+		FROM reconciliation_mappings rm
+		JOIN reconciliations r ON r.id = rm.reconciliation_id
+		WHERE r.tenant_id = ? AND r.reconciliation_batch_id = ? AND rm.mapping_type = 'partial'
+		AND r.status = 'matched'
+	`, r.tenant, batchID).Scan(&summary.PartiallyMatched, &settled)
+	if err != nil {
+		return summary, err
+	}
+
+	err = tx.QueryRow(`
+		SELECT COALESCE(SUM(bt.amount), 0)
+		FROM bank_transactions bt
+		WHERE bt.id IN (
+			SELECT rm.bank_transaction_id
+			FROM reconciliation_mappings rm
+			JOIN reconciliations r ON r.id = rm.reconciliation_id
+			WHERE r.tenant_id = ? AND r.reconciliation_batch_id = ? AND r.status = 'matched'
+			AND rm.mapping_type <> 'partial'
+		)
+	`, r.tenant, batchID).Scan(&summary.MatchedAmount)
+	summary.MatchedAmount += settled
+	return summary, err
+}
+
+// GetBatchDetails reads every reconciliation of a batch within tx, in the
+// order they were written, with their mappings and audit entries
+func (r *reconciliationRepository) GetBatchDetails(tx *sql.Tx, batchID string) ([]*models.ReconciliationDetail, error) {
+	return reconciliationDetails(tx, `r.tenant_id = ? AND r.reconciliation_batch_id = ?`, []interface{}{r.tenant, batchID}, 0)
+}
+
+// ListPendingReview reads the matches waiting for review within tx, oldest
+// first, optionally of one batch, from those after afterID when it is not
+// zero, with their mappings and audit entries
+func (r *reconciliationRepository) ListPendingReview(tx *sql.Tx, batchID string, afterID int64, limit int) ([]*models.ReconciliationDetail, error) {
+	where := `r.tenant_id = ? AND r.status = ? AND r.id > ?`
+	args := []interface{}{r.tenant, models.StatusPendingReview, afterID}
+	if batchID != "" {
+		where += ` AND r.reconciliation_batch_id = ?`
+		args = append(args, batchID)
+	}
+	return reconciliationDetails(tx, where, args, limit)
+}
+
+// reconciliationDetails reads the reconciliations r matching where, by ID,
+// with their mappings and audit entries. A limit of 0 reads them all.
+func reconciliationDetails(tx *sql.Tx, where string, args []interface{}, limit int) ([]*models.ReconciliationDetail, error) {
+	// Without a limit the mappings and audits are read by the same filter;
+	// with one, by the IDs of the page read
+	related, relatedArgs := where, args
+	query := `
+		SELECT r.id, r.reconciliation_batch_id, r.status, COALESCE(r.match_confidence, 0),
+		       r.amount_difference, r.version, r.created_at, r.updated_at
+		FROM reconciliations r
+		WHERE ` + where + `
+		ORDER BY r.id`
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	details := []*models.ReconciliationDetail{}
+	byID := make(map[int64]*models.ReconciliationDetail)
+	for rows.Next() {
+		detail := &models.ReconciliationDetail{}
+		err := rows.Scan(
+			&detail.ID,
+			&detail.BatchID,
+			&detail.Status,
+			&detail.MatchConfidence,
+			&detail.AmountDifference,
+			&detail.Version,
+			&detail.CreatedAt,
+			&detail.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		details = append(details, detail)
+		byID[detail.ID] = detail
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(details) == 0 {
+		return details, nil
+	}
+
+	if limit > 0 {
+		relatedArgs = make([]interface{}, len(details))
+		for i, detail := range details {
+			relatedArgs[i] = detail.ID
+		}
+		related = `r.id IN (?` + strings.Repeat(`, ?`, len(details)-1) + `)`
+	}
+
+	mappings, err := tx.Query(`
+		SELECT rm.reconciliation_id, rm.mapping_type,
+		       COALESCE(rm.bank_transaction_id, 0), COALESCE(bt.transaction_id, ''),
+		       COALESCE(rm.accounting_entry_id, 0), COALESCE(ae.entry_id, ''), rm.amount, rm.details
+		FROM reconciliations r
+		JOIN reconciliation_mappings rm ON rm.reconciliation_id = r.id
+		LEFT JOIN bank_transactions bt ON bt.id = rm.bank_transaction_id
+		LEFT JOIN accounting_entries ae ON ae.id = rm.accounting_entry_id
+		WHERE `+related+`
+		ORDER BY rm.id
+	`, relatedArgs...)
+	if err != nil {
+		return nil, err
+	}
+	defer mappings.Close()
+
+	for mappings.Next() {
+		var reconciliationID int64
+		var details []byte
+		pair := &models.MappedPair{}
+		err := mappings.Scan(
+			&reconciliationID,
+			&pair.MappingType,
+			&pair.BankTransactionID,
+			&pair.TransactionID,
+			&pair.AccountingEntryID,
+			&pair.EntryID,
+			&pair.Amount,
+			&details,
+		)
+		if err != nil {
+			return nil, err
+		}
+		pair.Details = details
+		if detail := byID[reconciliationID]; detail != nil {
+			detail.Mappings = append(detail.Mappings, pair)
+		}
+	}
+	if err := mappings.Err(); err != nil {
+		return nil, err
+	}
+
+	audits, err := tx.Query(`
+		SELECT a.id, a.reconciliation_id, a.action, a.details, COALESCE(a.user_id, ''), a.created_at
+		FROM reconciliations r
+		JOIN reconciliation_audit a ON a.reconciliation_id = r.id
+		WHERE `+related+`
+		ORDER BY a.id
+	`, relatedArgs...)
+	if err != nil {
+		return nil, err
+	}
+	defer audits.Close()
+
+	for audits.Next() {
+		audit := &models.ReconciliationAudit{}
+		var auditDetails []byte
+		err := audits.Scan(&audit.ID, &audit.ReconciliationID, &audit.Action, &auditDetails, &audit.UserID, &audit.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		audit.Details = auditDetails
+		if detail := byID[audit.ReconciliationID]; detail != nil {
+			detail.Audit = append(detail.Audit, audit)
+		}
+	}
+	return details, audits.Err()
+}
+
+// GetBatchIDsForBankTransaction lists the batches a bank transaction is mapped in
+func (r *reconciliationRepository) GetBatchIDsForBankTransaction(tx *sql.Tx, id int64) ([]string, error) {
+	return mappedBatchIDs(tx, r.tenant, "bank_transaction_id", id)
+}
+
+// GetBatchIDsForAccountingEntry lists the batches an accounting entry is mapped in
+func (r *reconciliationRepository) GetBatchIDsForAccountingEntry(tx *sql.Tx, id int64) ([]string, error) {
+	return mappedBatchIDs(tx, r.tenant, "accounting_entry_id", id)
+}
+
+// GetRecordMappings lists the mappings of any of the given records with the
+// reconciliations they belong to, oldest first
+func (r *reconciliationRepository) GetRecordMappings(bankTransactionIDs, accountingEntryIDs []int64) ([]*models.RecordMapping, error) {
+	var conditions []string
+	var args []interface{}
+	if len(bankTransactionIDs) > 0 {
+		conditions = append(conditions, "rm.bank_transaction_id IN ("+placeholders(len(bankTransactionIDs))+")")
+		for _, id := range bankTransactionIDs {
+			args = append(args, id)
+		}
+	}
+	if len(accountingEntryIDs) > 0 {
+		conditions = append(conditions, "rm.accounting_entry_id IN ("+placeholders(len(accountingEntryIDs))+")")
+		for _, id := range accountingEntryIDs {
+			args = append(args, id)
+		}
+	}
+	if len(conditions) == 0 {
+		return []*models.RecordMapping{}, nil
+	}
+
+	rows, err := r.db.Query(`
+		SELECT r.id, r.reconciliation_batch_id, r.status, r.match_confidence, rm.mapping_type,
+		       COALESCE(rm.bank_transaction_id, 0), COALESCE(rm.accounting_entry_id, 0)
+		FROM reconciliation_mappings rm
+		JOIN reconciliations r ON r.id = rm.reconciliation_id
+		WHERE r.tenant_id = ? AND (`+strings.Join(conditions, " OR ")+`)
+		ORDER BY r.id, rm.id
+	`, append([]interface{}{r.tenant}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mappings := []*models.RecordMapping{}
+	for rows.Next() {
+		mapping := &models.RecordMapping{}
+		err := rows.Scan(
+			&mapping.ReconciliationID,
+			&mapping.BatchID,
+			&mapping.Status,
+			&mapping.MatchConfidence,
+			&mapping.MappingType,
+			&mapping.BankTransactionID,
+			&mapping.AccountingEntryID,
+		)
+		if err != nil {
+			return nil, err
+		}
+		mappings = append(mappings, mapping)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return mappings, nil
+}
+
+// mappedBatchIDs is only called with the two fixed mapping columns
+// GetReconciliationIDsForBankTransaction lists the reconciliations mapping a
+// bank transaction
+func (r *reconciliationRepository) GetReconciliationIDsForBankTransaction(tx *sql.Tx, id int64) ([]int64, error) {
+	return mappedReconciliationIDs(tx, r.tenant, "bank_transaction_id", id)
+}
+
+// GetReconciliationIDsForAccountingEntry lists the reconciliations mapping an
+// accounting entry
+func (r *reconciliationRepository) GetReconciliationIDsForAccountingEntry(tx *sql.Tx, id int64) ([]int64, error) {
+	return mappedReconciliationIDs(tx, r.tenant, "accounting_entry_id", id)
+}
+
+func mappedReconciliationIDs(tx *sql.Tx, tenant, column string, id int64) ([]int64, error) {
+	rows, err := tx.Query(`
+		SELECT DISTINCT r.id
+		FROM reconciliation_mappings rm
+		JOIN reconciliations r ON r.id = rm.reconciliation_id
+		WHERE r.tenant_id = ? AND rm.`+column+` = ?
+		ORDER BY r.id
+	`, tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var reconciliationID int64
+		if err := rows.Scan(&reconciliationID); err != nil {
+			return nil, err
+		}
+		ids = append(ids, reconciliationID)
+	}
+	return ids, rows.Err()
+}
+
+func mappedBatchIDs(tx *sql.Tx, tenant, column string, id int64) ([]string, error) {
+	rows, err := tx.Query(`
+		SELECT DISTINCT r.reconciliation_batch_id
+		FROM reconciliation_mappings rm
+		JOIN reconciliations r ON r.id = rm.reconciliation_id
+		WHERE r.tenant_id = ? AND rm.`+column+` = ?
+		ORDER BY r.reconciliation_batch_id
+	`, tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var batchIDs []string
+	for rows.Next() {
+		var batchID string
+		if err := rows.Scan(&batchID); err != nil {
+			return nil, err
+		}
+		batchIDs = append(batchIDs, batchID)
+	}
+	return batchIDs, rows.Err()
+}
+
+func (r *reconciliationRepository) CreateBatchDelta(tx *sql.Tx, delta *models.BatchDelta) error {
+	before, err := json.Marshal(delta.SummaryBefore)
+	if err != nil {
+		return err
+	}
+	after, err := json.Marshal(delta.SummaryAfter)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO reconciliation_batch_deltas (
+			tenant_id, reconciliation_batch_id, action, user_id, changes, summary_before, summary_after
+		) VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	result, err := tx.Exec(query,
+		r.tenant,
+		delta.BatchID,
+		delta.Action,
+		delta.UserID,
+		delta.Changes,
+		before,
+		after,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	delta.ID = id
+	return nil
+}
+
+// GetBatchDeltas returns the deltas of the given batches, oldest first
+func (r *reconciliationRepository) GetBatchDeltas(batchIDs []string) ([]*models.BatchDelta, error) {
+	if len(batchIDs) == 0 {
+		return nil, nil
+	}
+	args := make([]interface{}, 0, len(batchIDs)+1)
+	args = append(args, r.tenant)
+	for _, batchID := range batchIDs {
+		args = append(args, batchID)
+	}
+
+	rows, err := r.db.Query(`
+		SELECT id, reconciliation_batch_id, action, user_id, changes,
+		       summary_before, summary_after, created_at
+		FROM reconciliation_batch_deltas
+		WHERE tenant_id = ? AND reconciliation_batch_id IN (`+placeholders(len(batchIDs))+`)
+		ORDER BY id
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deltas []*models.BatchDelta
+	for rows.Next() {
+		delta := &models.BatchDelta{}
+		var changes, before, after []byte
+		err := rows.Scan(
+			&delta.ID,
+			&delta.BatchID,
+			&delta.Action,
+			&delta.UserID,
+			&changes,
+			&before,
+			&after,
+			&delta.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		delta.Changes = json.RawMessage(changes)
+		if err := json.Unmarshal(before, &delta.SummaryBefore); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(after, &delta.SummaryAfter); err != nil {
+			return nil, err
+		}
+		deltas = append(deltas, delta)
+	}
+	return deltas, rows.Err()
+}
+
+func placeholders(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	return strings.Repeat("?, ", n-1) + "?"
+}
+
+// GetClassificationHistory returns the most recently matched bank
+// transactions with the account code of the entry they matched
+func (r *reconciliationRepository) GetClassificationHistory(limit int) ([]*models.ClassifiedTransaction, error) {
+	rows, err := r.db.Query(`
+		SELECT bt.description, bt.counterparty_id, ae.account_code
+		FROM reconciliation_mappings rm
+		JOIN reconciliations r ON r.id = rm.reconciliation_id
+		JOIN bank_transactions bt ON bt.id = rm.bank_transaction_id
+		JOIN accounting_entries ae ON ae.id = rm.accounting_entry_id
+		WHERE r.tenant_id = ? AND r.status = 'matched'
+		ORDER BY rm.id DESC
+		LIMIT ?
+	`, r.tenant, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []*models.ClassifiedTransaction
+	for rows.Next() {
+		item := &models.ClassifiedTransaction{}
+		var counterpartyID sql.NullInt64
+		if err := rows.Scan(&item.Description, &counterpartyID, &item.AccountCode); err != nil {
+			return nil, err
+		}
+		item.CounterpartyID = counterpartyID.Int64
+		history = append(history, item)
+	}
+	return history, rows.Err()
+}
+
+// GetClassificationVersion fingerprints what GetClassificationHistory and
+// account suggestions learn from. It changes when a match is written,
+// reviewed, resolved or undone, each of which is audited, and when a
+// counterparty, its accounts or a name alias change.
+func (r *reconciliationRepository) GetClassificationVersion() (string, error) {
+	var audit, mapping, counterparties, counterpartyUpdated, accounts, account, aliases, alias int64
+	err := r.db.QueryRow(`
+		SELECT
+			(SELECT COALESCE(MAX(id), 0) FROM reconciliation_audit WHERE tenant_id = ?),
+			(SELECT COALESCE(MAX(id), 0) FROM reconciliation_mappings WHERE tenant_id = ?),
+			(SELECT COUNT(*) FROM counterparties),
+			(SELECT COALESCE(UNIX_TIMESTAMP(MAX(updated_at)), 0) FROM counterparties),
+			(SELECT COUNT(*) FROM counterparty_accounts),
+			(SELECT COALESCE(MAX(id), 0) FROM counterparty_accounts),
+			(SELECT COUNT(*) FROM name_aliases),
+			(SELECT COALESCE(MAX(id), 0) FROM name_aliases)
+	`, r.tenant, r.tenant).Scan(&audit, &mapping, &counterparties, &counterpartyUpdated, &accounts, &account, &aliases, &alias)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d-%d-%d-%d-%d-%d-%d-%d", audit, mapping, counterparties, counterpartyUpdated, accounts, account, aliases, alias), nil
+}
+
+// SaveBatchKPIs stores the KPIs evaluated over a batch for a tenant
+func (r *reconciliationRepository) SaveBatchKPIs(batchID, tenant string, kpis []*models.BatchKPI) error {
+	if len(kpis) == 0 {
+		return nil
+	}
+	args := make([]interface{}, 0, len(kpis)*7)
+	values := make([]string, len(kpis))
+	for i, kpi := range kpis {
+		kpi.BatchID = batchID
+		kpi.Tenant = tenant
+		values[i] = "(?, ?, ?, ?, ?, ?, ?)"
+		args = append(args, r.tenant, batchID, tenant, kpi.Name, kpi.Label, kpi.Expression, kpi.Value)
+	}
+	_, err := r.db.Exec(`
+		INSERT INTO batch_kpis (tenant_id, reconciliation_batch_id, tenant, name, label, expression, value)
+		VALUES `+strings.Join(values, ", "), args...)
+	return err
+}
+
+// GetBatchKPIs returns the KPIs of a batch in the order they were defined
+func (r *reconciliationRepository) GetBatchKPIs(batchID string) ([]*models.BatchKPI, error) {
+	rows, err := r.db.Query(`
+		SELECT reconciliation_batch_id, tenant, name, label, expression, value, created_at
+		FROM batch_kpis
+		WHERE tenant_id = ? AND reconciliation_batch_id = ?
+		ORDER BY id
+	`, r.tenant, batchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var kpis []*models.BatchKPI
+	for rows.Next() {
+		kpi := &models.BatchKPI{}
+		var value sql.NullFloat64
+		err := rows.Scan(&kpi.BatchID, &kpi.Tenant, &kpi.Name, &kpi.Label, &kpi.Expression, &value, &kpi.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if value.Valid {
+			kpi.Value = &value.Float64
+		}
+		kpis = append(kpis, kpi)
+	}
+	return kpis, rows.Err()
+}
+
+// SaveAccountOutcomes stores the per-account outcomes of a batch with the
+// batch's own writes. Outcomes of an account already stored, by another
+// partition of the run, are added to.
+func (r *reconciliationRepository) SaveAccountOutcomes(tx *sql.Tx, batchID string, outcomes []*models.AccountOutcome) error {
+	if len(outcomes) == 0 {
+		return nil
+	}
+	args := make([]interface{}, 0, len(outcomes)*8)
+	values := make([]string, len(outcomes))
+	for i, outcome := range outcomes {
+		outcome.BatchID = batchID
+		values[i] = "(?, ?, ?, ?, ?, ?, ?, ?)"
+		args = append(args, r.tenant, batchID, outcome.Side, outcome.Account,
+			outcome.MatchedCount, outcome.MatchedAmount, outcome.UnmatchedCount, outcome.UnmatchedAmount)
+	}
+	_, err := tx.Exec(`
+		INSERT INTO batch_account_outcomes (
+			tenant_id, reconciliation_batch_id, side, account,
+			matched_count, matched_amount, unmatched_count, unmatched_amount
+		) VALUES `+strings.Join(values, ", ")+`
+		ON DUPLICATE KEY UPDATE
+			matched_count = matched_count + VALUES(matched_count),
+			matched_amount = matched_amount + VALUES(matched_amount),
+			unmatched_count = unmatched_count + VALUES(unmatched_count),
+			unmatched_amount = unmatched_amount + VALUES(unmatched_amount)`, args...)
+	return err
+}
+
+// GetAccountOutcomes returns the per-account outcomes of a batch, bank
+// accounts first, each side by the most unmatched records
+func (r *reconciliationRepository) GetAccountOutcomes(batchID string) ([]*models.AccountOutcome, error) {
+	rows, err := r.db.Query(`
+		SELECT reconciliation_batch_id, side, account,
+		       matched_count, matched_amount, unmatched_count, unmatched_amount
+		FROM batch_account_outcomes
+		WHERE tenant_id = ? AND reconciliation_batch_id = ?
+		ORDER BY side, unmatched_count DESC, account
+	`, r.tenant, batchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var outcomes []*models.AccountOutcome
+	for rows.Next() {
+		outcome := &models.AccountOutcome{}
+		err := rows.Scan(&outcome.BatchID, &outcome.Side, &outcome.Account,
+			&outcome.MatchedCount, &outcome.MatchedAmount, &outcome.UnmatchedCount, &outcome.UnmatchedAmount)
+		if err != nil {
+			return nil, err
+		}
+		outcomes = append(outcomes, outcome)
+	}
+	return outcomes, rows.Err()
+}
+
+// ReferenceTaken reports whether an external reference already names a batch
+// of the tenant or is the ID of one
+func (r *reconciliationRepository) ReferenceTaken(reference string) (bool, error) {
+	var taken bool
+	err := r.db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM batch_references WHERE tenant_id = ? AND external_reference = ?
+		) OR EXISTS (
+			SELECT 1 FROM reconciliations WHERE tenant_id = ? AND reconciliation_batch_id = ?
+		)
+	`, r.tenant, reference, r.tenant, reference).Scan(&taken)
+	return taken, err
+}
+
+// SaveBatchReference records the external reference a batch was started
+// with, returning ErrDuplicateReference when it is taken
+func (r *reconciliationRepository) SaveBatchReference(tx *sql.Tx, batchID, reference string) error {
+	var isBatchID bool
+	if err := tx.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM reconciliations WHERE tenant_id = ? AND reconciliation_batch_id = ?)
+	`, r.tenant, reference).Scan(&isBatchID); err != nil {
+		return err
+	}
+	if isBatchID {
+		return ErrDuplicateReference
+	}
+	_, err := tx.Exec(`
+		INSERT INTO batch_references (tenant_id, reconciliation_batch_id, external_reference)
+		VALUES (?, ?, ?)
+	`, r.tenant, batchID, reference)
+	if IsDuplicateEntry(err) {
+		return ErrDuplicateReference
+	}
+	return err
+}
+
+// GetBatchIDByReference returns the batch an external reference names, or
+// an empty ID when it names none
+func (r *reconciliationRepository) GetBatchIDByReference(reference string) (string, error) {
+	var batchID string
+	err := r.db.QueryRow(`
+		SELECT reconciliation_batch_id FROM batch_references
+		WHERE tenant_id = ? AND external_reference = ?
+	`, r.tenant, reference).Scan(&batchID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return batchID, err
+}
+
+// GetBatchReference returns the external reference of a batch, empty when it
+// was started without one
+func (r *reconciliationRepository) GetBatchReference(batchID string) (string, error) {
+	var reference string
+	err := r.db.QueryRow(`
+		SELECT external_reference FROM batch_references
+		WHERE tenant_id = ? AND reconciliation_batch_id = ?
+	`, r.tenant, batchID).Scan(&reference)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return reference, err
+}
@@ -0,0 +1,189 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+
+	"reconciliation-service/internal/models"
+)
+
+var ErrReportNotFound = errors.New("report not found")
+
+type ReportRepository interface {
+	CreateReport(report *models.ReportDefinition) error
+	GetReport(id int64) (*models.ReportDefinition, error)
+	ListReports() ([]*models.ReportDefinition, error)
+	UpdateReport(report *models.ReportDefinition) error
+	DeleteReport(id int64) error
+	RunQuery(query string, args []interface{}) ([][]interface{}, error)
+}
+
+type reportRepository struct {
+	db *sql.DB
+}
+
+func NewReportRepository(db *sql.DB) ReportRepository {
+	return &reportRepository{db: db}
+}
+
+func (r *reportRepository) CreateReport(report *models.ReportDefinition) error {
+	query := `
+		INSERT INTO report_definitions (name, description, source, definition, created_by)
+		VALUES (?, ?, ?, ?, ?)
+	`
+	result, err := r.db.Exec(query,
+		report.Name,
+		report.Description,
+		report.Source,
+		report.Definition,
+		report.CreatedBy,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	report.ID = id
+	return nil
+}
+
+func (r *reportRepository) GetReport(id int64) (*models.ReportDefinition, error) {
+	report := &models.ReportDefinition{}
+	var description sql.NullString
+	var definition []byte
+	query := `
+		SELECT id, name, description, source, definition, created_by, created_at, updated_at
+		FROM report_definitions
+		WHERE id = ?
+	`
+	err := r.db.QueryRow(query, id).Scan(
+		&report.ID,
+		&report.Name,
+		&description,
+		&report.Source,
+		&definition,
+		&report.CreatedBy,
+		&report.CreatedAt,
+		&report.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrReportNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	report.Description = description.String
+	report.Definition = definition
+	return report, nil
+}
+
+func (r *reportRepository) ListReports() ([]*models.ReportDefinition, error) {
+	query := `
+		SELECT id, name, description, source, definition, created_by, created_at, updated_at
+		FROM report_definitions
+		ORDER BY name
+	`
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []*models.ReportDefinition
+	for rows.Next() {
+		report := &models.ReportDefinition{}
+		var description sql.NullString
+		var definition []byte
+		err := rows.Scan(
+			&report.ID,
+			&report.Name,
+			&description,
+			&report.Source,
+			&definition,
+			&report.CreatedBy,
+			&report.CreatedAt,
+			&report.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		report.Description = description.String
+		report.Definition = definition
+		reports = append(reports, report)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+func (r *reportRepository) UpdateReport(report *models.ReportDefinition) error {
+	query := `
+		UPDATE report_definitions
+		SET name = ?, description = ?, source = ?, definition = ?
+		WHERE id = ?
+	`
+	_, err := r.db.Exec(query,
+		report.Name,
+		report.Description,
+		report.Source,
+		report.Definition,
+		report.ID,
+	)
+	return err
+}
+
+func (r *reportRepository) DeleteReport(id int64) error {
+	result, err := r.db.Exec("DELETE FROM report_definitions WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrReportNotFound
+	}
+	return nil
+}
+
+// RunQuery executes a query rendered by the reports package and returns the
+// raw rows. Text columns come back as strings rather than byte slices.
+func (r *reportRepository) RunQuery(query string, args []interface{}) ([][]interface{}, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	result := [][]interface{}{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		for i, v := range values {
+			if b, ok := v.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		result = append(result, values)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
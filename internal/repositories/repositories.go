@@ -0,0 +1,94 @@
+package repositories
+
+import "database/sql"
+
+// Repositories are the stores the services of one tenant are wired on. New
+// builds all of them on the database; a test or a local run replaces any of
+// them with a fake of its interface before the services are wired.
+type Repositories struct {
+	Bank           BankRepository
+	Accounting     AccountingRepository
+	Reconciliation ReconciliationRepository
+	Usage          UsageRepository
+	Maintenance    MaintenanceRepository
+	Job            JobRepository
+	Snapshot       SnapshotRepository
+	Report         ReportRepository
+	Calendar       CalendarRepository
+	Notification   NotificationRepository
+	Counterparty   CounterpartyRepository
+	Alias          AliasRepository
+	Shadow         ShadowRepository
+	RuleSet        RuleSetRepository
+	Safety         SafetyRepository
+	User           UserRepository
+	FXRate         FXRateRepository
+	RequestAudit   RequestAuditRepository
+	Schedule       ScheduleRepository
+	Export         ExportRepository
+	Retention      RetentionRepository
+	LegalHold      LegalHoldRepository
+	Fee            FeeRepository
+	Expectation    ExpectationRepository
+	Return         ReturnRepository
+	Budget         BudgetRepository
+	Exception      ExceptionRepository
+	Analytics      AnalyticsRepository
+	Idempotency    IdempotencyRepository
+	Integrity      IntegrityRepository
+	IngestionFile  IngestionFileRepository
+	Fixture        FixtureRepository
+	PolicyPack     PolicyPackRepository
+	Artifact       ArtifactRepository
+	Webhook        WebhookRepository
+	UnmatchedItem  UnmatchedItemRepository
+	Heartbeat      HeartbeatRepository
+	Sandbox        SandboxRepository
+	APIKey         APIKeyRepository
+}
+
+// New builds the repositories of a tenant on db. Deployment-wide ones, such
+// as notifications and webhooks, ignore the tenant.
+func New(db *sql.DB, tenant string) *Repositories {
+	return &Repositories{
+		Bank:           NewBankRepository(db, tenant),
+		Accounting:     NewAccountingRepository(db, tenant),
+		Reconciliation: NewReconciliationRepository(db, tenant),
+		Usage:          NewUsageRepository(db),
+		Maintenance:    NewMaintenanceRepository(db),
+		Job:            NewJobRepository(db, tenant),
+		Snapshot:       NewSnapshotRepository(db, tenant),
+		Report:         NewReportRepository(db),
+		Calendar:       NewCalendarRepository(db),
+		Notification:   NewNotificationRepository(db),
+		Counterparty:   NewCounterpartyRepository(db, tenant),
+		Alias:          NewAliasRepository(db),
+		Shadow:         NewShadowRepository(db),
+		RuleSet:        NewRuleSetRepository(db),
+		Safety:         NewSafetyRepository(db),
+		User:           NewUserRepository(db),
+		FXRate:         NewFXRateRepository(db),
+		RequestAudit:   NewRequestAuditRepository(db),
+		Schedule:       NewScheduleRepository(db),
+		Export:         NewExportRepository(db),
+		Retention:      NewRetentionRepository(db),
+		LegalHold:      NewLegalHoldRepository(db),
+		Fee:            NewFeeRepository(db, tenant),
+		Expectation:    NewExpectationRepository(db),
+		Return:         NewReturnRepository(db, tenant),
+		Budget:         NewBudgetRepository(db, tenant),
+		Exception:      NewExceptionRepository(db, tenant),
+		Analytics:      NewAnalyticsRepository(db, tenant),
+		Idempotency:    NewIdempotencyRepository(db),
+		Integrity:      NewIntegrityRepository(db, tenant),
+		IngestionFile:  NewIngestionFileRepository(db),
+		Fixture:        NewFixtureRepository(db, tenant),
+		PolicyPack:     NewPolicyPackRepository(db, tenant),
+		Artifact:       NewArtifactRepository(db, tenant),
+		Webhook:        NewWebhookRepository(db),
+		UnmatchedItem:  NewUnmatchedItemRepository(db, tenant),
+		Heartbeat:      NewHeartbeatRepository(db, tenant),
+		Sandbox:        NewSandboxRepository(db, tenant),
+		APIKey:         NewAPIKeyRepository(db),
+	}
+}
@@ -0,0 +1,125 @@
+// Package repotest holds in-memory repositories for tests that build services
+// or handlers without a database.
+package repotest
+
+import (
+	"sync"
+	"time"
+
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+)
+
+// APIKeys keeps API keys, and the hashes they are looked up by, in memory
+type APIKeys struct {
+	mu     sync.Mutex
+	keys   map[int64]*models.APIKey
+	hashes map[string]int64
+}
+
+func NewAPIKeys() *APIKeys {
+	return &APIKeys{keys: map[int64]*models.APIKey{}, hashes: map[string]int64{}}
+}
+
+func (m *APIKeys) CreateKey(key *models.APIKey, hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key.ID = int64(len(m.keys) + 1)
+	key.CreatedAt = time.Now()
+	stored := *key
+	m.keys[key.ID] = &stored
+	m.hashes[hash] = key.ID
+	return nil
+}
+
+func (m *APIKeys) GetKey(id int64) (*models.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key, ok := m.keys[id]
+	if !ok {
+		return nil, repositories.ErrAPIKeyNotFound
+	}
+	found := *key
+	return &found, nil
+}
+
+func (m *APIKeys) GetKeyByHash(hash string) (*models.APIKey, error) {
+	m.mu.Lock()
+	id, ok := m.hashes[hash]
+	m.mu.Unlock()
+	if !ok {
+		return nil, repositories.ErrAPIKeyNotFound
+	}
+	return m.GetKey(id)
+}
+
+func (m *APIKeys) ListKeys(tenant string) ([]*models.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := []*models.APIKey{}
+	for _, key := range m.keys {
+		if tenant == "" || key.Tenant == tenant {
+			found := *key
+			keys = append(keys, &found)
+		}
+	}
+	return keys, nil
+}
+
+func (m *APIKeys) RotateKey(old, replacement *models.APIKey, hash string, expiresAt time.Time) error {
+	m.mu.Lock()
+	stored := m.keys[old.ID]
+	retired := stored.ReplacedBy != nil || stored.RevokedAt != nil
+	m.mu.Unlock()
+	if retired {
+		return repositories.ErrAPIKeyReplaced
+	}
+	if err := m.CreateKey(replacement, hash); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored.ReplacedBy = &replacement.ID
+	stored.ExpiresAt = &expiresAt
+	return nil
+}
+
+func (m *APIKeys) RevokeKey(id int64, revokedBy string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key, ok := m.keys[id]
+	if !ok {
+		return repositories.ErrAPIKeyNotFound
+	}
+	if key.RevokedAt == nil {
+		key.RevokedAt = &at
+		key.RevokedBy = revokedBy
+	}
+	return nil
+}
+
+func (m *APIKeys) TouchKey(id int64, at, before time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if key, ok := m.keys[id]; ok && (key.LastUsedAt == nil || key.LastUsedAt.Before(before)) {
+		key.LastUsedAt = &at
+	}
+	return nil
+}
+
+// HasHash reports whether a key is looked up by hash
+func (m *APIKeys) HasHash(hash string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.hashes[hash]
+	return ok
+}
+
+// Expire moves the expiry of a stored key to at
+func (m *APIKeys) Expire(id int64, at time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if key, ok := m.keys[id]; ok {
+		key.ExpiresAt = &at
+	}
+}
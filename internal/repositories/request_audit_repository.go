@@ -0,0 +1,167 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"reconciliation-service/internal/models"
+)
+
+type RequestAuditRepository interface {
+	RecordRequest(audit *models.RequestAudit) error
+	ListRequests(filter models.RequestAuditFilter) ([]*models.RequestAudit, error)
+	DeleteRequestsBefore(cutoff time.Time, limit int) (int64, error)
+}
+
+type requestAuditRepository struct {
+	db *sql.DB
+}
+
+func NewRequestAuditRepository(db *sql.DB) RequestAuditRepository {
+	return &requestAuditRepository{db: db}
+}
+
+func (r *requestAuditRepository) RecordRequest(audit *models.RequestAudit) error {
+	var resourceIDs []byte
+	if len(audit.ResourceIDs) > 0 {
+		var err error
+		if resourceIDs, err = json.Marshal(audit.ResourceIDs); err != nil {
+			return err
+		}
+	}
+
+	result, err := r.db.Exec(`
+		INSERT INTO request_audits (
+			method, route, path, user_id, caller, remote_addr, user_agent,
+			content_type, payload, payload_bytes, payload_sha256, payload_truncated,
+			resource_ids, status_code, duration_ms
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		audit.Method,
+		audit.Route,
+		audit.Path,
+		audit.UserID,
+		audit.Caller,
+		audit.RemoteAddr,
+		audit.UserAgent,
+		audit.ContentType,
+		audit.Payload,
+		audit.PayloadBytes,
+		audit.PayloadSHA256,
+		audit.PayloadTruncated,
+		nullableJSON(resourceIDs),
+		audit.StatusCode,
+		audit.DurationMS,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	audit.ID = id
+	return nil
+}
+
+func (r *requestAuditRepository) ListRequests(filter models.RequestAuditFilter) ([]*models.RequestAudit, error) {
+	query := `
+		SELECT id, method, route, path, user_id, caller, remote_addr, user_agent,
+			content_type, COALESCE(payload, ''), payload_bytes, payload_sha256, payload_truncated,
+			resource_ids, status_code, duration_ms, created_at
+		FROM request_audits
+	`
+	var conditions []string
+	var args []interface{}
+	if filter.UserID != "" {
+		conditions = append(conditions, "user_id = ?")
+		args = append(args, filter.UserID)
+	}
+	if filter.Route != "" {
+		conditions = append(conditions, "route = ?")
+		args = append(args, filter.Route)
+	}
+	if filter.Method != "" {
+		conditions = append(conditions, "method = ?")
+		args = append(args, filter.Method)
+	}
+	if filter.From != "" {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.From)
+	}
+	if filter.To != "" {
+		conditions = append(conditions, "created_at < DATE_ADD(?, INTERVAL 1 DAY)")
+		args = append(args, filter.To)
+	}
+	if filter.BeforeID > 0 {
+		conditions = append(conditions, "id < ?")
+		args = append(args, filter.BeforeID)
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, filter.Limit)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	audits := []*models.RequestAudit{}
+	for rows.Next() {
+		audit := &models.RequestAudit{}
+		var resourceIDs []byte
+		err := rows.Scan(
+			&audit.ID,
+			&audit.Method,
+			&audit.Route,
+			&audit.Path,
+			&audit.UserID,
+			&audit.Caller,
+			&audit.RemoteAddr,
+			&audit.UserAgent,
+			&audit.ContentType,
+			&audit.Payload,
+			&audit.PayloadBytes,
+			&audit.PayloadSHA256,
+			&audit.PayloadTruncated,
+			&resourceIDs,
+			&audit.StatusCode,
+			&audit.DurationMS,
+			&audit.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if len(resourceIDs) > 0 {
+			if err := json.Unmarshal(resourceIDs, &audit.ResourceIDs); err != nil {
+				return nil, err
+			}
+		}
+		audits = append(audits, audit)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return audits, nil
+}
+
+// DeleteRequestsBefore removes up to limit audits recorded before cutoff,
+// oldest first, and reports how many it removed
+func (r *requestAuditRepository) DeleteRequestsBefore(cutoff time.Time, limit int) (int64, error) {
+	result, err := r.db.Exec(`
+		DELETE FROM request_audits
+		WHERE created_at < ?
+		ORDER BY id
+		LIMIT ?
+	`, cutoff, limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,254 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"reconciliation-service/internal/models"
+)
+
+var ErrRetentionPolicyNotFound = errors.New("retention policy not found")
+
+// retentionClass says where the records of a data class are, when each was
+// recorded and which batch it belongs to
+type retentionClass struct {
+	table     string // table the records are deleted from
+	from      string // FROM clause, aliasing the table as t
+	timestamp string // when a record was recorded
+	batch     string // the batch a record belongs to
+	where     string // further condition on the records that may expire
+}
+
+var retentionClasses = map[string]retentionClass{
+	models.RetentionClassResults: {
+		table:     "reconciliation_results",
+		from:      "reconciliation_results t",
+		timestamp: "t.created_at",
+		batch:     "t.reconciliation_batch_id",
+	},
+	models.RetentionClassAudit: {
+		table:     "reconciliation_audit",
+		from:      "reconciliation_audit t JOIN reconciliations r ON r.id = t.reconciliation_id",
+		timestamp: "t.created_at",
+		batch:     "r.reconciliation_batch_id",
+	},
+	models.RetentionClassExports: {
+		table:     "export_jobs",
+		from:      "export_jobs t",
+		timestamp: "t.finished_at",
+		batch:     "JSON_UNQUOTE(JSON_EXTRACT(t.params, '$.batch_id'))",
+		where:     fmt.Sprintf("t.status IN ('%s', '%s')", models.ExportStatusCompleted, models.ExportStatusFailed),
+	},
+}
+
+type RetentionRepository interface {
+	ListPolicies() ([]*models.RetentionPolicy, error)
+	SavePolicy(policy *models.RetentionPolicy) error
+	CountExpired(dataClass string, cutoff time.Time, heldBatches []string) (expired, held int64, err error)
+	ListExpired(dataClass string, cutoff time.Time, heldBatches []string, limit int) ([]int64, error)
+	DeleteRecords(dataClass string, ids []int64) (int64, error)
+	CreateRun(run *models.RetentionRun) error
+	ListRuns(beforeID int64, limit int) ([]*models.RetentionRun, error)
+}
+
+type retentionRepository struct {
+	db *sql.DB
+}
+
+func NewRetentionRepository(db *sql.DB) RetentionRepository {
+	return &retentionRepository{db: db}
+}
+
+func (r *retentionRepository) ListPolicies() ([]*models.RetentionPolicy, error) {
+	rows, err := r.db.Query(`
+		SELECT data_class, retention_days, updated_by, updated_at
+		FROM retention_policies
+		ORDER BY data_class
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policies := []*models.RetentionPolicy{}
+	for rows.Next() {
+		policy := &models.RetentionPolicy{}
+		if err := rows.Scan(&policy.DataClass, &policy.RetentionDays, &policy.UpdatedBy, &policy.UpdatedAt); err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+// SavePolicy sets the retention of a data class the repository knows
+func (r *retentionRepository) SavePolicy(policy *models.RetentionPolicy) error {
+	if _, ok := retentionClasses[policy.DataClass]; !ok {
+		return ErrRetentionPolicyNotFound
+	}
+	_, err := r.db.Exec(`
+		INSERT INTO retention_policies (data_class, retention_days, updated_by)
+		VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE retention_days = VALUES(retention_days), updated_by = VALUES(updated_by)
+	`, policy.DataClass, policy.RetentionDays, policy.UpdatedBy)
+	return err
+}
+
+// expiredCondition selects the records of a class recorded before cutoff
+func (c retentionClass) expiredCondition() string {
+	condition := c.timestamp + " < ?"
+	if c.where != "" {
+		condition += " AND " + c.where
+	}
+	return condition
+}
+
+// heldCondition is true for records of the held batches
+func (c retentionClass) heldCondition(heldBatches []string) (string, []interface{}) {
+	if len(heldBatches) == 0 {
+		return "FALSE", nil
+	}
+	args := make([]interface{}, len(heldBatches))
+	for i, batchID := range heldBatches {
+		args[i] = batchID
+	}
+	return fmt.Sprintf("COALESCE(%s IN (%s), FALSE)", c.batch, placeholders(len(heldBatches))), args
+}
+
+// CountExpired counts the records of a class recorded before cutoff, and how
+// many of them belong to held batches
+func (r *retentionRepository) CountExpired(dataClass string, cutoff time.Time, heldBatches []string) (int64, int64, error) {
+	class, ok := retentionClasses[dataClass]
+	if !ok {
+		return 0, 0, ErrRetentionPolicyNotFound
+	}
+	held, heldArgs := class.heldCondition(heldBatches)
+	args := append(heldArgs, cutoff)
+
+	var expired, heldCount int64
+	err := r.db.QueryRow(fmt.Sprintf(`
+		SELECT COUNT(*), COALESCE(SUM(%s), 0)
+		FROM %s
+		WHERE %s
+	`, held, class.from, class.expiredCondition()), args...).Scan(&expired, &heldCount)
+	return expired, heldCount, err
+}
+
+// ListExpired lists up to limit records of a class recorded before cutoff
+// that belong to no held batch, oldest first
+func (r *retentionRepository) ListExpired(dataClass string, cutoff time.Time, heldBatches []string, limit int) ([]int64, error) {
+	class, ok := retentionClasses[dataClass]
+	if !ok {
+		return nil, ErrRetentionPolicyNotFound
+	}
+	held, heldArgs := class.heldCondition(heldBatches)
+	args := append([]interface{}{cutoff}, heldArgs...)
+	args = append(args, limit)
+
+	rows, err := r.db.Query(fmt.Sprintf(`
+		SELECT t.id
+		FROM %s
+		WHERE %s AND NOT %s
+		ORDER BY t.id
+		LIMIT ?
+	`, class.from, class.expiredCondition(), held), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// DeleteRecords deletes records of a class by ID and reports how many it
+// deleted
+func (r *retentionRepository) DeleteRecords(dataClass string, ids []int64) (int64, error) {
+	class, ok := retentionClasses[dataClass]
+	if !ok {
+		return 0, ErrRetentionPolicyNotFound
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	result, err := r.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE id IN (%s)", class.table, placeholders(len(ids))), args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (r *retentionRepository) CreateRun(run *models.RetentionRun) error {
+	report, err := json.Marshal(run.Classes)
+	if err != nil {
+		return err
+	}
+	result, err := r.db.Exec(`
+		INSERT INTO retention_runs (dry_run, triggered_by, report, started_at, finished_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, run.DryRun, run.TriggeredBy, report, run.StartedAt, run.FinishedAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	run.ID = id
+	return nil
+}
+
+// ListRuns lists the latest retention runs, newest first, from those older
+// than beforeID when it is not zero
+func (r *retentionRepository) ListRuns(beforeID int64, limit int) ([]*models.RetentionRun, error) {
+	rows, err := r.db.Query(`
+		SELECT id, dry_run, triggered_by, report, started_at, finished_at
+		FROM retention_runs
+		WHERE ? = 0 OR id < ?
+		ORDER BY id DESC
+		LIMIT ?
+	`, beforeID, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []*models.RetentionRun{}
+	for rows.Next() {
+		run := &models.RetentionRun{}
+		var report []byte
+		err := rows.Scan(&run.ID, &run.DryRun, &run.TriggeredBy, &report, &run.StartedAt, &run.FinishedAt)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(report, &run.Classes); err != nil {
+			return nil, fmt.Errorf("invalid report of retention run %d: %v", run.ID, err)
+		}
+		runs = append(runs, run)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
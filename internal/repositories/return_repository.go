@@ -0,0 +1,224 @@
+package repositories
+
+import (
+	"database/sql"
+	"strings"
+
+	"reconciliation-service/internal/models"
+)
+
+type ReturnRepository interface {
+	FindOriginal(ret *models.BankTransaction) (*models.BankTransaction, error)
+	GetMatchedReconciliation(tx *sql.Tx, bankTransactionID int64) (*models.Reconciliation, error)
+	CreateReturn(tx *sql.Tx, ret *models.BankReturn) error
+	ListReturns(beforeID int64, limit int) ([]*models.BankReturn, error)
+	ReturnRates(fromDate, toDate string) ([]*models.CounterpartyReturnRate, error)
+}
+
+type returnRepository struct {
+	db *sql.DB
+	// tenant whose transactions returns are linked among
+	tenant string
+}
+
+func NewReturnRepository(db *sql.DB, tenant string) ReturnRepository {
+	return &returnRepository{db: db, tenant: tenant}
+}
+
+// FindOriginal looks up the transaction a return gives back: on the same
+// account, of the opposite amount, dated no later than the return and
+// sharing its end-to-end ID, reference or creditor reference. Transactions
+// that are returns themselves or were returned already are skipped, and of
+// several candidates the latest is taken. It returns nil when none fits or
+// the return is linked already.
+func (r *returnRepository) FindOriginal(ret *models.BankTransaction) (*models.BankTransaction, error) {
+	var conditions []string
+	var args []interface{}
+	for _, ref := range []struct{ column, value string }{
+		{"bt.end_to_end_id", ret.EndToEndID},
+		{"bt.reference_number", ret.ReferenceNumber},
+		{"bt.creditor_reference", ret.CreditorReference},
+	} {
+		if ref.value != "" {
+			conditions = append(conditions, ref.column+" = ?")
+			args = append(args, ref.value)
+		}
+	}
+	if len(conditions) == 0 {
+		return nil, nil
+	}
+
+	query := `
+		SELECT ` + bankTransactionColumns + `
+		FROM bank_transactions bt
+		WHERE bt.tenant_id = ?
+		AND bt.account_number = ?
+		AND bt.amount = ?
+		AND bt.id <> ?
+		AND bt.transaction_date <= ?
+		AND bt.reversal = FALSE AND bt.return_reason = ''
+		AND NOT EXISTS (
+			SELECT 1 FROM bank_returns br
+			WHERE br.original_transaction_id = bt.id OR br.return_transaction_id = bt.id
+			OR br.return_transaction_id = ?
+		)
+		AND (` + strings.Join(conditions, " OR ") + `)
+		ORDER BY bt.transaction_date DESC, bt.id DESC
+		LIMIT 1
+	`
+	args = append([]interface{}{r.tenant, ret.AccountNumber, -ret.Amount, ret.ID, ret.TransactionDate, ret.ID}, args...)
+	original, err := scanBankTransaction(r.db.QueryRow(query, args...))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return original, nil
+}
+
+// GetMatchedReconciliation locks and returns the reconciliation a bank
+// transaction is mapped in, or nil when it is mapped in none
+func (r *returnRepository) GetMatchedReconciliation(tx *sql.Tx, bankTransactionID int64) (*models.Reconciliation, error) {
+	rec := &models.Reconciliation{}
+	err := tx.QueryRow(`
+		SELECT r.id, r.reconciliation_batch_id, r.status, r.match_confidence,
+		       r.amount_difference, r.version, r.created_at, r.updated_at
+		FROM reconciliations r
+		JOIN reconciliation_mappings rm ON rm.reconciliation_id = r.id
+		WHERE r.tenant_id = ? AND rm.bank_transaction_id = ?
+		ORDER BY r.id DESC
+		LIMIT 1
+		FOR UPDATE
+	`, r.tenant, bankTransactionID).Scan(
+		&rec.ID,
+		&rec.BatchID,
+		&rec.Status,
+		&rec.MatchConfidence,
+		&rec.AmountDifference,
+		&rec.Version,
+		&rec.CreatedAt,
+		&rec.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+func (r *returnRepository) CreateReturn(tx *sql.Tx, ret *models.BankReturn) error {
+	result, err := tx.Exec(`
+		INSERT INTO bank_returns (
+			return_transaction_id, original_transaction_id, reconciliation_id,
+			reason_code, action, batch_id
+		) VALUES (?, ?, ?, ?, ?, ?)
+	`,
+		ret.ReturnTransactionID,
+		ret.OriginalTransactionID,
+		nullableID(ret.ReconciliationID),
+		ret.ReasonCode,
+		ret.Action,
+		ret.BatchID,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	ret.ID = id
+	return nil
+}
+
+// ListReturns returns the latest linked returns, from those older than
+// beforeID when it is not zero
+func (r *returnRepository) ListReturns(beforeID int64, limit int) ([]*models.BankReturn, error) {
+	rows, err := r.db.Query(`
+		SELECT id, return_transaction_id, original_transaction_id, reconciliation_id,
+		       reason_code, action, batch_id, created_at
+		FROM bank_returns
+		WHERE ? = 0 OR id < ?
+		ORDER BY id DESC
+		LIMIT ?
+	`, beforeID, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	returns := []*models.BankReturn{}
+	for rows.Next() {
+		ret := &models.BankReturn{}
+		var reconciliationID sql.NullInt64
+		err := rows.Scan(
+			&ret.ID,
+			&ret.ReturnTransactionID,
+			&ret.OriginalTransactionID,
+			&reconciliationID,
+			&ret.ReasonCode,
+			&ret.Action,
+			&ret.BatchID,
+			&ret.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		ret.ReconciliationID = reconciliationID.Int64
+		returns = append(returns, ret)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return returns, nil
+}
+
+// ReturnRates counts, per counterparty, the transactions dated between two
+// dates and how many of them were returned since. Returns themselves are not
+// counted, and counterparties without returns are left out.
+func (r *returnRepository) ReturnRates(fromDate, toDate string) ([]*models.CounterpartyReturnRate, error) {
+	rows, err := r.db.Query(`
+		SELECT COALESCE(bt.counterparty_id, 0), COALESCE(c.code, ''), COALESCE(c.name, ''),
+		       COUNT(*), COUNT(br.id),
+		       COALESCE(SUM(CASE WHEN br.id IS NOT NULL THEN ABS(bt.amount) END), 0)
+		FROM bank_transactions bt
+		LEFT JOIN bank_returns br ON br.original_transaction_id = bt.id
+		LEFT JOIN bank_returns rr ON rr.return_transaction_id = bt.id
+		LEFT JOIN counterparties c ON c.id = bt.counterparty_id
+		WHERE bt.tenant_id = ? AND bt.transaction_date BETWEEN ? AND ?
+		AND rr.id IS NULL
+		AND bt.reversal = FALSE AND bt.return_reason = ''
+		GROUP BY bt.counterparty_id, c.code, c.name
+		HAVING COUNT(br.id) > 0
+		ORDER BY COUNT(br.id) / COUNT(*) DESC, COUNT(br.id) DESC, c.code
+	`, r.tenant, fromDate, toDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := []*models.CounterpartyReturnRate{}
+	for rows.Next() {
+		rate := &models.CounterpartyReturnRate{}
+		err := rows.Scan(
+			&rate.CounterpartyID,
+			&rate.Code,
+			&rate.Name,
+			&rate.Transactions,
+			&rate.Returns,
+			&rate.ReturnedAmount,
+		)
+		if err != nil {
+			return nil, err
+		}
+		rates = append(rates, rate)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
@@ -0,0 +1,227 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+
+	"reconciliation-service/internal/models"
+)
+
+var (
+	ErrRuleSetChangeNotFound = errors.New("rule set change not found")
+
+	// ErrRuleSetConflict means a rule set with the version exists
+	ErrRuleSetConflict = errors.New("rule set version already exists")
+
+	// ErrRuleSetChangeNotPending means the change was already reviewed
+	ErrRuleSetChangeNotPending = errors.New("rule set change is not pending")
+
+	// ErrRuleSetStale means another change became active after this one was
+	// proposed, so its diff no longer describes what approving it would do
+	ErrRuleSetStale = errors.New("rule set change is based on a rule set that is no longer active")
+)
+
+type RuleSetRepository interface {
+	CreateChange(change *models.RuleSetChange) error
+	GetChange(id int64) (*models.RuleSetChange, error)
+	ListChanges() ([]*models.RuleSetChange, error)
+	GetActiveChange() (*models.RuleSetChange, error)
+	ActivateChange(id int64, activeVersion, reviewer, note string) error
+	RejectChange(id int64, reviewer, note string) error
+}
+
+type ruleSetRepository struct {
+	db *sql.DB
+}
+
+func NewRuleSetRepository(db *sql.DB) RuleSetRepository {
+	return &ruleSetRepository{db: db}
+}
+
+const ruleSetChangeColumns = `
+		id, version, base_version, rules, diff, status, author, reason,
+		reviewed_by, review_note, reviewed_at, created_at`
+
+func scanRuleSetChange(row rowScanner) (*models.RuleSetChange, error) {
+	change := &models.RuleSetChange{}
+	var rules, diff []byte
+	var reason, reviewedBy, reviewNote sql.NullString
+	var reviewedAt sql.NullTime
+	err := row.Scan(
+		&change.ID,
+		&change.Version,
+		&change.BaseVersion,
+		&rules,
+		&diff,
+		&change.Status,
+		&change.Author,
+		&reason,
+		&reviewedBy,
+		&reviewNote,
+		&reviewedAt,
+		&change.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	change.Rules = rules
+	change.Diff = diff
+	change.Reason = reason.String
+	change.ReviewedBy = reviewedBy.String
+	change.ReviewNote = reviewNote.String
+	if reviewedAt.Valid {
+		change.ReviewedAt = &reviewedAt.Time
+	}
+	return change, nil
+}
+
+func (r *ruleSetRepository) CreateChange(change *models.RuleSetChange) error {
+	query := `
+		INSERT INTO rule_set_changes (
+			version, base_version, rules, diff, status, author, reason
+		) VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	result, err := r.db.Exec(query,
+		change.Version,
+		change.BaseVersion,
+		[]byte(change.Rules),
+		[]byte(change.Diff),
+		change.Status,
+		change.Author,
+		change.Reason,
+	)
+	if IsDuplicateEntry(err) {
+		return ErrRuleSetConflict
+	}
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	change.ID = id
+	return nil
+}
+
+func (r *ruleSetRepository) GetChange(id int64) (*models.RuleSetChange, error) {
+	query := "SELECT " + ruleSetChangeColumns + " FROM rule_set_changes WHERE id = ?"
+	change, err := scanRuleSetChange(r.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrRuleSetChangeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+// ListChanges is the changelog, newest first
+func (r *ruleSetRepository) ListChanges() ([]*models.RuleSetChange, error) {
+	query := "SELECT " + ruleSetChangeColumns + " FROM rule_set_changes ORDER BY id DESC"
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []*models.RuleSetChange{}
+	for rows.Next() {
+		change, err := scanRuleSetChange(rows)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// GetActiveChange returns the change that set the production rules, or nil
+// while the built-in defaults are still in force
+func (r *ruleSetRepository) GetActiveChange() (*models.RuleSetChange, error) {
+	query := "SELECT " + ruleSetChangeColumns + " FROM rule_set_changes WHERE status = ?"
+	change, err := scanRuleSetChange(r.db.QueryRow(query, models.RuleSetStatusActive))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+// ActivateChange approves a pending change and makes it the production rule
+// set, superseding the active one. activeVersion is the version the caller
+// expects to be active: the change's base, checked under lock so two changes
+// proposed against the same base cannot both be approved.
+func (r *ruleSetRepository) ActivateChange(id int64, activeVersion, reviewer, note string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var status string
+	err = tx.QueryRow("SELECT status FROM rule_set_changes WHERE id = ? FOR UPDATE", id).Scan(&status)
+	if err == sql.ErrNoRows {
+		return ErrRuleSetChangeNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if status != models.RuleSetStatusPending {
+		return ErrRuleSetChangeNotPending
+	}
+
+	// No active row means the built-in defaults, expected as ""
+	var current string
+	err = tx.QueryRow("SELECT version FROM rule_set_changes WHERE status = ? FOR UPDATE", models.RuleSetStatusActive).Scan(&current)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if current != activeVersion {
+		return ErrRuleSetStale
+	}
+
+	if current != "" {
+		_, err = tx.Exec("UPDATE rule_set_changes SET status = ? WHERE version = ?", models.RuleSetStatusSuperseded, current)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`
+		UPDATE rule_set_changes
+		SET status = ?, reviewed_by = ?, review_note = ?, reviewed_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, models.RuleSetStatusActive, reviewer, note, id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *ruleSetRepository) RejectChange(id int64, reviewer, note string) error {
+	result, err := r.db.Exec(`
+		UPDATE rule_set_changes
+		SET status = ?, reviewed_by = ?, review_note = ?, reviewed_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND status = ?
+	`, models.RuleSetStatusRejected, reviewer, note, id, models.RuleSetStatusPending)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected > 0 {
+		return nil
+	}
+	if _, err := r.GetChange(id); err != nil {
+		return err
+	}
+	return ErrRuleSetChangeNotPending
+}
@@ -0,0 +1,73 @@
+package repositories
+
+import (
+	"database/sql"
+
+	"reconciliation-service/internal/models"
+)
+
+type SafetyRepository interface {
+	RecordOverride(override *models.SafetyOverride) error
+	ListOverrides(limit int) ([]*models.SafetyOverride, error)
+}
+
+type safetyRepository struct {
+	db *sql.DB
+}
+
+func NewSafetyRepository(db *sql.DB) SafetyRepository {
+	return &safetyRepository{db: db}
+}
+
+func (r *safetyRepository) RecordOverride(override *models.SafetyOverride) error {
+	result, err := r.db.Exec(`
+		INSERT INTO safety_overrides (environment, operation, method, path, caller)
+		VALUES (?, ?, ?, ?, ?)
+	`, override.Environment, override.Operation, override.Method, override.Path, override.Caller)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	override.ID = id
+	return nil
+}
+
+// ListOverrides returns the latest overrides, newest first
+func (r *safetyRepository) ListOverrides(limit int) ([]*models.SafetyOverride, error) {
+	rows, err := r.db.Query(`
+		SELECT id, environment, operation, method, path, caller, created_at
+		FROM safety_overrides
+		ORDER BY id DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	overrides := []*models.SafetyOverride{}
+	for rows.Next() {
+		override := &models.SafetyOverride{}
+		err := rows.Scan(
+			&override.ID,
+			&override.Environment,
+			&override.Operation,
+			&override.Method,
+			&override.Path,
+			&override.Caller,
+			&override.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, override)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return overrides, nil
+}
@@ -0,0 +1,162 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"reconciliation-service/internal/models"
+)
+
+// ErrSandboxBusy refuses clearing the sandbox while one of its jobs runs
+var ErrSandboxBusy = errors.New("a sandbox job is running, reset it once the job finishes")
+
+type SandboxRepository interface {
+	ClaimReset(resetDate, triggeredBy string) (*models.SandboxReset, bool, error)
+	ReleaseReset(id int64) error
+	FinishReset(reset *models.SandboxReset) error
+	LatestReset() (*models.SandboxReset, error)
+	ClearRecords() error
+}
+
+type sandboxRepository struct {
+	db *sql.DB
+	// tenant whose records are synthetic and wiped on every reset
+	tenant string
+}
+
+func NewSandboxRepository(db *sql.DB, tenant string) SandboxRepository {
+	return &sandboxRepository{db: db, tenant: tenant}
+}
+
+const sandboxResetColumns = `
+		id, COALESCE(DATE_FORMAT(reset_date, '%Y-%m-%d'), ''), triggered_by,
+		bank_transactions, accounting_entries, COALESCE(error, ''), started_at, finished_at`
+
+func scanSandboxReset(row rowScanner) (*models.SandboxReset, error) {
+	reset := &models.SandboxReset{}
+	var finishedAt sql.NullTime
+	err := row.Scan(
+		&reset.ID,
+		&reset.ResetDate,
+		&reset.TriggeredBy,
+		&reset.BankTransactions,
+		&reset.AccountingEntries,
+		&reset.Error,
+		&reset.StartedAt,
+		&finishedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if finishedAt.Valid {
+		reset.FinishedAt = &finishedAt.Time
+	}
+	return reset, nil
+}
+
+// ClaimReset records a reset as started and reports whether the caller got
+// to run it. A reset for a date is claimed once; one for no date always is.
+func (r *sandboxRepository) ClaimReset(resetDate, triggeredBy string) (*models.SandboxReset, bool, error) {
+	reset := &models.SandboxReset{
+		ResetDate:   resetDate,
+		TriggeredBy: triggeredBy,
+		StartedAt:   time.Now(),
+	}
+	result, err := r.db.Exec(`
+		INSERT INTO sandbox_resets (tenant_id, reset_date, triggered_by, started_at)
+		VALUES (?, ?, ?, ?)
+	`, r.tenant, nullableDate(resetDate), triggeredBy, reset.StartedAt)
+	if IsDuplicateEntry(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if reset.ID, err = result.LastInsertId(); err != nil {
+		return nil, false, err
+	}
+	return reset, true, nil
+}
+
+// ReleaseReset forgets a claimed reset that did not run, so it can be
+// claimed again
+func (r *sandboxRepository) ReleaseReset(id int64) error {
+	_, err := r.db.Exec(`DELETE FROM sandbox_resets WHERE id = ? AND tenant_id = ?`, id, r.tenant)
+	return err
+}
+
+// FinishReset records what a reset generated, or why it failed
+func (r *sandboxRepository) FinishReset(reset *models.SandboxReset) error {
+	finishedAt := time.Now()
+	var resetError interface{}
+	if reset.Error != "" {
+		resetError = reset.Error
+	}
+	_, err := r.db.Exec(`
+		UPDATE sandbox_resets
+		SET bank_transactions = ?, accounting_entries = ?, error = ?, finished_at = ?
+		WHERE id = ? AND tenant_id = ?
+	`, reset.BankTransactions, reset.AccountingEntries, resetError, finishedAt, reset.ID, r.tenant)
+	if err == nil {
+		reset.FinishedAt = &finishedAt
+	}
+	return err
+}
+
+// LatestReset returns the last reset started, or nil before the first
+func (r *sandboxRepository) LatestReset() (*models.SandboxReset, error) {
+	reset, err := scanSandboxReset(r.db.QueryRow(`
+		SELECT `+sandboxResetColumns+`
+		FROM sandbox_resets
+		WHERE tenant_id = ?
+		ORDER BY id DESC
+		LIMIT 1
+	`, r.tenant))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return reset, err
+}
+
+// ClearRecords deletes every record of the sandbox tenant in one
+// transaction. Deleting reconciliations takes their mappings and audits
+// along; jobs take their account locks.
+func (r *sandboxRepository) ClearRecords() error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var running int
+	if err := tx.QueryRow(`
+		SELECT COUNT(*) FROM reconciliation_jobs
+		WHERE tenant_id = ? AND status = ?
+		FOR UPDATE
+	`, r.tenant, models.JobStatusRunning).Scan(&running); err != nil {
+		return err
+	}
+	if running > 0 {
+		return ErrSandboxBusy
+	}
+
+	for _, table := range []string{
+		"reconciliations",
+		"reconciliation_results",
+		"reconciliation_batch_deltas",
+		"batch_kpis",
+		"batch_account_outcomes",
+		"batch_references",
+		"reconciliation_jobs",
+		"statement_balances",
+		"unmatched_item_states",
+		"bank_transactions",
+		"accounting_entries",
+	} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE tenant_id = ?`, r.tenant); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,281 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"reconciliation-service/internal/models"
+)
+
+var (
+	ErrScheduleNotFound = errors.New("schedule not found")
+
+	// ErrScheduleConflict means a schedule with the name exists
+	ErrScheduleConflict = errors.New("schedule already exists")
+)
+
+type ScheduleRepository interface {
+	CreateSchedule(schedule *models.ReconciliationSchedule) error
+	GetSchedule(id int64) (*models.ReconciliationSchedule, error)
+	ListSchedules() ([]*models.ReconciliationSchedule, error)
+	UpdateSchedule(schedule *models.ReconciliationSchedule) error
+	DeleteSchedule(id int64) error
+	ListDueSchedules(now time.Time) ([]*models.ReconciliationSchedule, error)
+	ClaimSchedule(id int64, due, next time.Time) (bool, error)
+	CreateRun(run *models.ScheduleRun) error
+	FinishRun(run *models.ScheduleRun) error
+	ListRuns(scheduleID, beforeID int64, limit int) ([]*models.ScheduleRun, error)
+}
+
+type scheduleRepository struct {
+	db *sql.DB
+}
+
+func NewScheduleRepository(db *sql.DB) ScheduleRepository {
+	return &scheduleRepository{db: db}
+}
+
+const scheduleColumns = `
+	id, name, cron_expression, period, timezone, enabled, next_run_at,
+	last_run_at, updated_by, created_at, updated_at`
+
+func scanSchedule(scanner rowScanner) (*models.ReconciliationSchedule, error) {
+	schedule := &models.ReconciliationSchedule{}
+	var nextRunAt, lastRunAt sql.NullTime
+	err := scanner.Scan(
+		&schedule.ID,
+		&schedule.Name,
+		&schedule.CronExpression,
+		&schedule.Period,
+		&schedule.Timezone,
+		&schedule.Enabled,
+		&nextRunAt,
+		&lastRunAt,
+		&schedule.UpdatedBy,
+		&schedule.CreatedAt,
+		&schedule.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if nextRunAt.Valid {
+		schedule.NextRunAt = &nextRunAt.Time
+	}
+	if lastRunAt.Valid {
+		schedule.LastRunAt = &lastRunAt.Time
+	}
+	return schedule, nil
+}
+
+func (r *scheduleRepository) CreateSchedule(schedule *models.ReconciliationSchedule) error {
+	result, err := r.db.Exec(`
+		INSERT INTO reconciliation_schedules (
+			name, cron_expression, period, timezone, enabled, next_run_at, updated_by
+		) VALUES (?, ?, ?, ?, ?, ?, ?)
+	`,
+		schedule.Name,
+		schedule.CronExpression,
+		schedule.Period,
+		schedule.Timezone,
+		schedule.Enabled,
+		schedule.NextRunAt,
+		schedule.UpdatedBy,
+	)
+	if IsDuplicateEntry(err) {
+		return ErrScheduleConflict
+	}
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	schedule.ID = id
+	return nil
+}
+
+func (r *scheduleRepository) GetSchedule(id int64) (*models.ReconciliationSchedule, error) {
+	row := r.db.QueryRow("SELECT "+scheduleColumns+" FROM reconciliation_schedules WHERE id = ?", id)
+	schedule, err := scanSchedule(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrScheduleNotFound
+	}
+	return schedule, err
+}
+
+func (r *scheduleRepository) ListSchedules() ([]*models.ReconciliationSchedule, error) {
+	return r.querySchedules("SELECT " + scheduleColumns + " FROM reconciliation_schedules ORDER BY name")
+}
+
+// ListDueSchedules lists the enabled schedules whose next run is at or
+// before now, the longest overdue first
+func (r *scheduleRepository) ListDueSchedules(now time.Time) ([]*models.ReconciliationSchedule, error) {
+	return r.querySchedules(`
+		SELECT `+scheduleColumns+`
+		FROM reconciliation_schedules
+		WHERE enabled = TRUE AND next_run_at <= ?
+		ORDER BY next_run_at
+	`, now)
+}
+
+func (r *scheduleRepository) querySchedules(query string, args ...interface{}) ([]*models.ReconciliationSchedule, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := []*models.ReconciliationSchedule{}
+	for rows.Next() {
+		schedule, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+func (r *scheduleRepository) UpdateSchedule(schedule *models.ReconciliationSchedule) error {
+	result, err := r.db.Exec(`
+		UPDATE reconciliation_schedules
+		SET name = ?, cron_expression = ?, period = ?, timezone = ?, enabled = ?,
+		    next_run_at = ?, updated_by = ?
+		WHERE id = ?
+	`,
+		schedule.Name,
+		schedule.CronExpression,
+		schedule.Period,
+		schedule.Timezone,
+		schedule.Enabled,
+		schedule.NextRunAt,
+		schedule.UpdatedBy,
+		schedule.ID,
+	)
+	if IsDuplicateEntry(err) {
+		return ErrScheduleConflict
+	}
+	if err != nil {
+		return err
+	}
+	return r.expectSchedule(result)
+}
+
+func (r *scheduleRepository) DeleteSchedule(id int64) error {
+	result, err := r.db.Exec("DELETE FROM reconciliation_schedules WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	return r.expectSchedule(result)
+}
+
+func (r *scheduleRepository) expectSchedule(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrScheduleNotFound
+	}
+	return nil
+}
+
+// ClaimSchedule moves a schedule due at due on to its next run. Only one
+// instance can move it, so only the instance that gets true starts the run.
+func (r *scheduleRepository) ClaimSchedule(id int64, due, next time.Time) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE reconciliation_schedules
+		SET next_run_at = ?, last_run_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND enabled = TRUE AND next_run_at = ?
+	`, next, id, due)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func (r *scheduleRepository) CreateRun(run *models.ScheduleRun) error {
+	result, err := r.db.Exec(`
+		INSERT INTO schedule_runs (schedule_id, scheduled_for, from_date, to_date, status)
+		VALUES (?, ?, ?, ?, ?)
+	`, run.ScheduleID, run.ScheduledFor, run.FromDate, run.ToDate, run.Status)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	run.ID = id
+	run.StartedAt = time.Now()
+	return nil
+}
+
+func (r *scheduleRepository) FinishRun(run *models.ScheduleRun) error {
+	_, err := r.db.Exec(`
+		UPDATE schedule_runs
+		SET status = ?, job_id = ?, reconciliation_batch_id = ?, error = ?, finished_at = ?
+		WHERE id = ?
+	`, run.Status, nullableID(run.JobID), run.BatchID, run.Error, run.FinishedAt, run.ID)
+	return err
+}
+
+// ListRuns lists the latest runs of a schedule, newest first, from those
+// older than beforeID when it is not zero
+func (r *scheduleRepository) ListRuns(scheduleID, beforeID int64, limit int) ([]*models.ScheduleRun, error) {
+	rows, err := r.db.Query(`
+		SELECT id, schedule_id, scheduled_for,
+		       DATE_FORMAT(from_date, '%Y-%m-%d'), DATE_FORMAT(to_date, '%Y-%m-%d'),
+		       status, COALESCE(job_id, 0), reconciliation_batch_id, COALESCE(error, ''),
+		       started_at, finished_at
+		FROM schedule_runs
+		WHERE schedule_id = ? AND (? = 0 OR id < ?)
+		ORDER BY id DESC
+		LIMIT ?
+	`, scheduleID, beforeID, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []*models.ScheduleRun{}
+	for rows.Next() {
+		run := &models.ScheduleRun{}
+		var finishedAt sql.NullTime
+		err := rows.Scan(
+			&run.ID,
+			&run.ScheduleID,
+			&run.ScheduledFor,
+			&run.FromDate,
+			&run.ToDate,
+			&run.Status,
+			&run.JobID,
+			&run.BatchID,
+			&run.Error,
+			&run.StartedAt,
+			&finishedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if finishedAt.Valid {
+			run.FinishedAt = &finishedAt.Time
+		}
+		runs = append(runs, run)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
@@ -0,0 +1,324 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"reconciliation-service/internal/models"
+)
+
+var (
+	ErrShadowCandidateNotFound = errors.New("shadow candidate not found")
+	ErrShadowRunNotFound       = errors.New("shadow run not found")
+
+	// ErrShadowCandidateConflict means a candidate with the version exists
+	ErrShadowCandidateConflict = errors.New("shadow candidate already exists")
+)
+
+type ShadowRepository interface {
+	CreateCandidate(candidate *models.ShadowCandidate) error
+	ListCandidates(enabledOnly bool) ([]*models.ShadowCandidate, error)
+	SetCandidateEnabled(version string, enabled bool) error
+	DeleteCandidate(version string) error
+	CreateShadowRun(run *models.ShadowRun, matches []*models.ShadowMatch) error
+	GetShadowRuns(batchID string) ([]*models.ShadowRun, error)
+	GetShadowMatches(runID int64, agreement string) ([]*models.ShadowMatch, error)
+}
+
+type shadowRepository struct {
+	db *sql.DB
+}
+
+func NewShadowRepository(db *sql.DB) ShadowRepository {
+	return &shadowRepository{db: db}
+}
+
+func (r *shadowRepository) CreateCandidate(candidate *models.ShadowCandidate) error {
+	result, err := r.db.Exec(
+		"INSERT INTO shadow_candidates (version, rules, enabled) VALUES (?, ?, ?)",
+		candidate.Version, []byte(candidate.Rules), candidate.Enabled,
+	)
+	if IsDuplicateEntry(err) {
+		return ErrShadowCandidateConflict
+	}
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	candidate.ID = id
+	return nil
+}
+
+func (r *shadowRepository) ListCandidates(enabledOnly bool) ([]*models.ShadowCandidate, error) {
+	query := `
+		SELECT id, version, rules, enabled, created_at
+		FROM shadow_candidates
+	`
+	if enabledOnly {
+		query += " WHERE enabled = TRUE"
+	}
+	query += " ORDER BY version"
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	candidates := []*models.ShadowCandidate{}
+	for rows.Next() {
+		candidate := &models.ShadowCandidate{}
+		var rules []byte
+		if err := rows.Scan(&candidate.ID, &candidate.Version, &rules, &candidate.Enabled, &candidate.CreatedAt); err != nil {
+			return nil, err
+		}
+		candidate.Rules = rules
+		candidates = append(candidates, candidate)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return candidates, nil
+}
+
+func (r *shadowRepository) SetCandidateEnabled(version string, enabled bool) error {
+	result, err := r.db.Exec(
+		"UPDATE shadow_candidates SET enabled = ? WHERE version = ?",
+		enabled, version,
+	)
+	if err != nil {
+		return err
+	}
+	return requireCandidate(r.db, result, version)
+}
+
+func (r *shadowRepository) DeleteCandidate(version string) error {
+	result, err := r.db.Exec("DELETE FROM shadow_candidates WHERE version = ?", version)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrShadowCandidateNotFound
+	}
+	return nil
+}
+
+// requireCandidate tells an update that changed nothing apart from one that
+// found no candidate, as MySQL reports only changed rows as affected
+func requireCandidate(db *sql.DB, result sql.Result, version string) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected > 0 {
+		return nil
+	}
+	var exists bool
+	err = db.QueryRow("SELECT EXISTS(SELECT 1 FROM shadow_candidates WHERE version = ?)", version).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrShadowCandidateNotFound
+	}
+	return nil
+}
+
+// CreateShadowRun stores a run and its matches together
+func (r *shadowRepository) CreateShadowRun(run *models.ShadowRun, matches []*models.ShadowMatch) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO shadow_runs (
+			reconciliation_batch_id, candidate_version, rules,
+			production_matches, shadow_matches, agreed, confidence_changed,
+			production_only, shadow_only, agreement_rate
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		run.BatchID,
+		run.CandidateVersion,
+		[]byte(run.Rules),
+		run.ProductionMatches,
+		run.ShadowMatches,
+		run.Agreed,
+		run.ConfidenceChanged,
+		run.ProductionOnly,
+		run.ShadowOnly,
+		run.AgreementRate,
+	)
+	if err != nil {
+		return err
+	}
+	if run.ID, err = result.LastInsertId(); err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO shadow_matches (
+			shadow_run_id, match_type, confidence, amount_difference,
+			bank_transaction_ids, accounting_entry_ids, match_criteria, agreement
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, match := range matches {
+		bankIDs, err := json.Marshal(match.BankTransactionIDs)
+		if err != nil {
+			return err
+		}
+		entryIDs, err := json.Marshal(match.AccountingEntryIDs)
+		if err != nil {
+			return err
+		}
+		criteria, err := json.Marshal(match.MatchCriteria)
+		if err != nil {
+			return err
+		}
+		result, err := stmt.Exec(
+			run.ID,
+			match.MatchType,
+			match.Confidence,
+			match.AmountDifference,
+			bankIDs,
+			entryIDs,
+			criteria,
+			match.Agreement,
+		)
+		if err != nil {
+			return err
+		}
+		if match.ID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+		match.ShadowRunID = run.ID
+	}
+
+	return tx.Commit()
+}
+
+func (r *shadowRepository) GetShadowRuns(batchID string) ([]*models.ShadowRun, error) {
+	rows, err := r.db.Query(`
+		SELECT id, reconciliation_batch_id, candidate_version, rules,
+		       production_matches, shadow_matches, agreed, confidence_changed,
+		       production_only, shadow_only, agreement_rate, created_at
+		FROM shadow_runs
+		WHERE reconciliation_batch_id = ?
+		ORDER BY id
+	`, batchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []*models.ShadowRun{}
+	for rows.Next() {
+		run := &models.ShadowRun{}
+		var rules []byte
+		err := rows.Scan(
+			&run.ID,
+			&run.BatchID,
+			&run.CandidateVersion,
+			&rules,
+			&run.ProductionMatches,
+			&run.ShadowMatches,
+			&run.Agreed,
+			&run.ConfidenceChanged,
+			&run.ProductionOnly,
+			&run.ShadowOnly,
+			&run.AgreementRate,
+			&run.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		run.Rules = rules
+		runs = append(runs, run)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+// GetShadowMatches lists the matches of a run, only those with the given
+// agreement when it is not empty
+func (r *shadowRepository) GetShadowMatches(runID int64, agreement string) ([]*models.ShadowMatch, error) {
+	var exists bool
+	if err := r.db.QueryRow("SELECT EXISTS(SELECT 1 FROM shadow_runs WHERE id = ?)", runID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrShadowRunNotFound
+	}
+
+	query := `
+		SELECT id, shadow_run_id, match_type, confidence, amount_difference,
+		       bank_transaction_ids, accounting_entry_ids, match_criteria, agreement
+		FROM shadow_matches
+		WHERE shadow_run_id = ?
+	`
+	args := []interface{}{runID}
+	if agreement != "" {
+		query += " AND agreement = ?"
+		args = append(args, agreement)
+	}
+	query += " ORDER BY id"
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	matches := []*models.ShadowMatch{}
+	for rows.Next() {
+		match := &models.ShadowMatch{}
+		var bankIDs, entryIDs, criteria []byte
+		err := rows.Scan(
+			&match.ID,
+			&match.ShadowRunID,
+			&match.MatchType,
+			&match.Confidence,
+			&match.AmountDifference,
+			&bankIDs,
+			&entryIDs,
+			&criteria,
+			&match.Agreement,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(bankIDs, &match.BankTransactionIDs); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(entryIDs, &match.AccountingEntryIDs); err != nil {
+			return nil, err
+		}
+		if len(criteria) > 0 {
+			if err := json.Unmarshal(criteria, &match.MatchCriteria); err != nil {
+				return nil, err
+			}
+		}
+		matches = append(matches, match)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
@@ -0,0 +1,226 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+
+	"reconciliation-service/internal/models"
+)
+
+// ErrJournalNotFound answers for snapshots taken before differences journals
+// were stored with them
+var ErrJournalNotFound = errors.New("snapshot has no differences journal")
+
+type SnapshotRepository interface {
+	CreateSnapshot(snapshot *models.ReconciliationSnapshot, journal *models.SnapshotJournal) error
+	GetJournal(snapshotID string) (*models.SnapshotJournal, error)
+	GetSnapshotBySnapshotID(snapshotID string) (*models.ReconciliationSnapshot, error)
+	ListSnapshots(fromDate, toDate string) ([]*models.ReconciliationSnapshot, error)
+	GetMatchedItems(fromDate, toDate string) ([]models.SnapshotMatchedItem, error)
+}
+
+type snapshotRepository struct {
+	db *sql.DB
+	// tenant whose matches are snapshotted
+	tenant string
+}
+
+func NewSnapshotRepository(db *sql.DB, tenant string) SnapshotRepository {
+	return &snapshotRepository{db: db, tenant: tenant}
+}
+
+// CreateSnapshot stores a snapshot and its differences journal in one
+// transaction
+func (r *snapshotRepository) CreateSnapshot(snapshot *models.ReconciliationSnapshot, journal *models.SnapshotJournal) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO reconciliation_snapshots (
+			snapshot_id, period_from, period_to, label,
+			created_by, summary, items, checksum
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	result, err := tx.Exec(query,
+		snapshot.SnapshotID,
+		snapshot.PeriodFrom,
+		snapshot.PeriodTo,
+		snapshot.Label,
+		snapshot.CreatedBy,
+		snapshot.Summary,
+		string(snapshot.Items),
+		snapshot.Checksum,
+	)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	result, err = tx.Exec(`
+		INSERT INTO snapshot_journals (snapshot_id, line_count, csv, csv_checksum, pdf, pdf_checksum)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, journal.SnapshotID, journal.LineCount, journal.CSV, journal.CSVChecksum, journal.PDF, journal.PDFChecksum)
+	if err != nil {
+		return err
+	}
+	journalID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	snapshot.ID = id
+	journal.ID = journalID
+	return nil
+}
+
+// GetJournal returns the differences journal of a snapshot
+func (r *snapshotRepository) GetJournal(snapshotID string) (*models.SnapshotJournal, error) {
+	journal := &models.SnapshotJournal{}
+	err := r.db.QueryRow(`
+		SELECT id, snapshot_id, line_count, csv, csv_checksum, pdf, pdf_checksum, created_at
+		FROM snapshot_journals
+		WHERE snapshot_id = ?
+	`, snapshotID).Scan(
+		&journal.ID,
+		&journal.SnapshotID,
+		&journal.LineCount,
+		&journal.CSV,
+		&journal.CSVChecksum,
+		&journal.PDF,
+		&journal.PDFChecksum,
+		&journal.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrJournalNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return journal, nil
+}
+
+func (r *snapshotRepository) GetSnapshotBySnapshotID(snapshotID string) (*models.ReconciliationSnapshot, error) {
+	snapshot := &models.ReconciliationSnapshot{}
+	var summary, items []byte
+	query := `
+		SELECT id, snapshot_id, DATE_FORMAT(period_from, '%Y-%m-%d'), DATE_FORMAT(period_to, '%Y-%m-%d'),
+		       label, created_by, summary, items, checksum, created_at
+		FROM reconciliation_snapshots
+		WHERE snapshot_id = ?
+	`
+	err := r.db.QueryRow(query, snapshotID).Scan(
+		&snapshot.ID,
+		&snapshot.SnapshotID,
+		&snapshot.PeriodFrom,
+		&snapshot.PeriodTo,
+		&snapshot.Label,
+		&snapshot.CreatedBy,
+		&summary,
+		&items,
+		&snapshot.Checksum,
+		&snapshot.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("snapshot not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	snapshot.Summary = summary
+	snapshot.Items = items
+	return snapshot, nil
+}
+
+// ListSnapshots returns snapshots overlapping the period, without their item lists
+func (r *snapshotRepository) ListSnapshots(fromDate, toDate string) ([]*models.ReconciliationSnapshot, error) {
+	query := `
+		SELECT id, snapshot_id, DATE_FORMAT(period_from, '%Y-%m-%d'), DATE_FORMAT(period_to, '%Y-%m-%d'),
+		       label, created_by, summary, checksum, created_at
+		FROM reconciliation_snapshots
+		WHERE period_from <= ? AND period_to >= ?
+		ORDER BY created_at DESC
+	`
+	rows, err := r.db.Query(query, toDate, fromDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snapshots []*models.ReconciliationSnapshot
+	for rows.Next() {
+		snapshot := &models.ReconciliationSnapshot{}
+		var summary []byte
+		err := rows.Scan(
+			&snapshot.ID,
+			&snapshot.SnapshotID,
+			&snapshot.PeriodFrom,
+			&snapshot.PeriodTo,
+			&snapshot.Label,
+			&snapshot.CreatedBy,
+			&summary,
+			&snapshot.Checksum,
+			&snapshot.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.Summary = summary
+		snapshots = append(snapshots, snapshot)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
+
+// GetMatchedItems lists every mapping whose bank transaction falls in the period
+func (r *snapshotRepository) GetMatchedItems(fromDate, toDate string) ([]models.SnapshotMatchedItem, error) {
+	query := `
+		SELECT r.id, r.reconciliation_batch_id, r.status, COALESCE(r.match_confidence, 0),
+		       rm.mapping_type, bt.transaction_id, bt.amount,
+		       COALESCE(ae.entry_id, ''), COALESCE(ae.amount, 0)
+		FROM reconciliation_mappings rm
+		JOIN reconciliations r ON r.id = rm.reconciliation_id
+		JOIN bank_transactions bt ON bt.id = rm.bank_transaction_id
+		LEFT JOIN accounting_entries ae ON ae.id = rm.accounting_entry_id
+		WHERE r.tenant_id = ? AND bt.transaction_date BETWEEN ? AND ?
+		ORDER BY r.id, rm.id
+	`
+	rows, err := r.db.Query(query, r.tenant, fromDate, toDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []models.SnapshotMatchedItem
+	for rows.Next() {
+		var item models.SnapshotMatchedItem
+		err := rows.Scan(
+			&item.ReconciliationID,
+			&item.BatchID,
+			&item.Status,
+			&item.MatchConfidence,
+			&item.MappingType,
+			&item.BankTransactionID,
+			&item.BankAmount,
+			&item.AccountingEntryID,
+			&item.AccountingAmount,
+		)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
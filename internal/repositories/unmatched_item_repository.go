@@ -0,0 +1,219 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	"reconciliation-service/internal/models"
+)
+
+type UnmatchedItemRepository interface {
+	ListUnmatched(filter models.UnmatchedItemFilter, limit int) ([]*models.UnmatchedItem, error)
+	CountUnmatched(filter models.UnmatchedItemFilter) (int, error)
+	GetUnmatched(refs []models.UnmatchedItemRef) ([]*models.UnmatchedItem, error)
+	SaveStates(items []*models.UnmatchedItem, userID string) error
+}
+
+type unmatchedItemRepository struct {
+	db *sql.DB
+	// tenant whose records are selected and annotated
+	tenant string
+}
+
+// NewUnmatchedItemRepository reads the unmatched records of one tenant with
+// the work state operators set on them, and writes that state
+func NewUnmatchedItemRepository(db *sql.DB, tenant string) UnmatchedItemRepository {
+	return &unmatchedItemRepository{db: db, tenant: tenant}
+}
+
+// unmatchedSide describes the table of one kind of unmatched record
+type unmatchedSide struct {
+	recordType    string
+	table         string
+	alias         string
+	mappingColumn string
+	reference     string
+	account       string
+	date          string
+}
+
+var unmatchedSides = []unmatchedSide{
+	{models.ExceptionRecordBankTransaction, "bank_transactions", "bt", "bank_transaction_id", "transaction_id", "account_number", "transaction_date"},
+	{models.ExceptionRecordAccountingEntry, "accounting_entries", "ae", "accounting_entry_id", "entry_id", "account_code", "entry_date"},
+}
+
+// selectSide returns the query of the side's records without a mapping, or
+// with an amount a partial match left open, that match filter, optionally only the given IDs, with their arguments. Its
+// columns are those scanUnmatchedItems reads.
+func (r *unmatchedItemRepository) selectSide(side unmatchedSide, filter models.UnmatchedItemFilter, ids []int64) (string, []interface{}) {
+	a := side.alias
+	query := `
+		SELECT '` + side.recordType + `' AS record_type, ` + a + `.id AS record_id,
+		       ` + a + `.` + side.reference + `, ` + a + `.` + side.account + `,
+		       ` + a + `.amount, ` + a + `.open_amount, ` + a + `.currency, ` + a + `.` + side.date + ` AS record_date,
+		       COALESCE(s.owner, ''), COALESCE(s.on_hold, FALSE), s.tags,
+		       COALESCE(s.reason_code, ''), COALESCE(s.updated_by, '')
+		FROM ` + side.table + ` ` + a + `
+		LEFT JOIN unmatched_item_states s ON s.tenant_id = ` + a + `.tenant_id
+		     AND s.record_type = '` + side.recordType + `' AND s.record_id = ` + a + `.id
+	`
+	unmatched := "(" + a + ".open_amount <> 0 OR NOT EXISTS (SELECT 1 FROM reconciliation_mappings rm WHERE rm." + side.mappingColumn + " = " + a + ".id))"
+	conditions := []string{unmatched, a + ".voided_at IS NULL", a + ".tenant_id = ?"}
+	args := []interface{}{r.tenant}
+	if ids != nil {
+		conditions = append(conditions, a+".id IN ("+placeholders(len(ids))+")")
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+	if filter.FromDate != "" {
+		conditions = append(conditions, a+"."+side.date+" >= ?")
+		args = append(args, filter.FromDate)
+	}
+	if filter.ToDate != "" {
+		conditions = append(conditions, a+"."+side.date+" <= ?")
+		args = append(args, filter.ToDate)
+	}
+	if filter.Account != "" {
+		conditions = append(conditions, a+"."+side.account+" = ?")
+		args = append(args, filter.Account)
+	}
+	if filter.Currency != "" {
+		conditions = append(conditions, a+".currency = ?")
+		args = append(args, filter.Currency)
+	}
+	if filter.Owner != "" {
+		conditions = append(conditions, "s.owner = ?")
+		args = append(args, filter.Owner)
+	}
+	if filter.Tag != "" {
+		conditions = append(conditions, "JSON_CONTAINS(s.tags, JSON_QUOTE(?))")
+		args = append(args, filter.Tag)
+	}
+	if filter.ReasonCode != "" {
+		conditions = append(conditions, "s.reason_code = ?")
+		args = append(args, filter.ReasonCode)
+	}
+	if filter.OnHold != nil {
+		conditions = append(conditions, "COALESCE(s.on_hold, FALSE) = ?")
+		args = append(args, *filter.OnHold)
+	}
+	return query + " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// selectUnmatched unions the sides filter selects
+func (r *unmatchedItemRepository) selectUnmatched(filter models.UnmatchedItemFilter) (string, []interface{}) {
+	var queries []string
+	var args []interface{}
+	for _, side := range unmatchedSides {
+		if filter.RecordType != "" && filter.RecordType != side.recordType {
+			continue
+		}
+		query, sideArgs := r.selectSide(side, filter, nil)
+		queries = append(queries, query)
+		args = append(args, sideArgs...)
+	}
+	return strings.Join(queries, " UNION ALL "), args
+}
+
+// ListUnmatched returns up to limit unmatched records matching filter,
+// oldest first
+func (r *unmatchedItemRepository) ListUnmatched(filter models.UnmatchedItemFilter, limit int) ([]*models.UnmatchedItem, error) {
+	query, args := r.selectUnmatched(filter)
+	rows, err := r.db.Query(query+" ORDER BY record_date, record_type, record_id LIMIT ?", append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	return scanUnmatchedItems(rows)
+}
+
+func (r *unmatchedItemRepository) CountUnmatched(filter models.UnmatchedItemFilter) (int, error) {
+	query, args := r.selectUnmatched(filter)
+	var count int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM ("+query+") u", args...).Scan(&count)
+	return count, err
+}
+
+// GetUnmatched returns those of refs that name a record of the tenant still
+// unmatched, in no particular order
+func (r *unmatchedItemRepository) GetUnmatched(refs []models.UnmatchedItemRef) ([]*models.UnmatchedItem, error) {
+	var queries []string
+	var args []interface{}
+	for _, side := range unmatchedSides {
+		var ids []int64
+		for _, ref := range refs {
+			if ref.RecordType == side.recordType {
+				ids = append(ids, ref.ID)
+			}
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		query, sideArgs := r.selectSide(side, models.UnmatchedItemFilter{}, ids)
+		queries = append(queries, query)
+		args = append(args, sideArgs...)
+	}
+	if len(queries) == 0 {
+		return nil, nil
+	}
+	rows, err := r.db.Query(strings.Join(queries, " UNION ALL "), args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanUnmatchedItems(rows)
+}
+
+func scanUnmatchedItems(rows *sql.Rows) ([]*models.UnmatchedItem, error) {
+	defer rows.Close()
+
+	items := []*models.UnmatchedItem{}
+	for rows.Next() {
+		item := &models.UnmatchedItem{}
+		var tags []byte
+		if err := rows.Scan(&item.RecordType, &item.RecordID, &item.Reference, &item.Account,
+			&item.Amount, &item.OpenAmount, &item.Currency, &item.RecordDate, &item.Owner, &item.OnHold, &tags,
+			&item.ReasonCode, &item.UpdatedBy); err != nil {
+			return nil, err
+		}
+		if len(tags) > 0 {
+			if err := json.Unmarshal(tags, &item.Tags); err != nil {
+				return nil, err
+			}
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// SaveStates writes the work state of the items, a chunk of them per
+// statement, as set by userID
+func (r *unmatchedItemRepository) SaveStates(items []*models.UnmatchedItem, userID string) error {
+	for start := 0; start < len(items); start += insertChunk {
+		chunk := items[start:min(start+insertChunk, len(items))]
+
+		values := make([]string, 0, len(chunk))
+		args := make([]interface{}, 0, 8*len(chunk))
+		for _, item := range chunk {
+			var tags []byte
+			if len(item.Tags) > 0 {
+				var err error
+				if tags, err = json.Marshal(item.Tags); err != nil {
+					return err
+				}
+			}
+			values = append(values, "(?, ?, ?, ?, ?, ?, ?, ?)")
+			args = append(args, r.tenant, item.RecordType, item.RecordID, item.Owner, item.OnHold,
+				nullableJSON(tags), item.ReasonCode, userID)
+		}
+
+		query := `INSERT INTO unmatched_item_states (tenant_id, record_type, record_id, owner, on_hold, tags, reason_code, updated_by)
+			VALUES ` + strings.Join(values, ", ") + `
+			ON DUPLICATE KEY UPDATE owner = VALUES(owner), on_hold = VALUES(on_hold), tags = VALUES(tags),
+				reason_code = VALUES(reason_code), updated_by = VALUES(updated_by)`
+		if _, err := r.db.Exec(query, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
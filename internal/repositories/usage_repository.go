@@ -0,0 +1,136 @@
+package repositories
+
+import (
+	"database/sql"
+
+	"reconciliation-service/internal/models"
+)
+
+type UsageRepository interface {
+	IncrementUsage(entity, period string, requests, rowsIngested, batchesRun int64) error
+	GetUsage(entity, period string) (*models.APIUsage, error)
+	ListUsage(period string) ([]*models.APIUsage, error)
+	GetQuota(entity string) (*models.APIQuota, error)
+	UpsertQuota(quota *models.APIQuota) error
+}
+
+type usageRepository struct {
+	db *sql.DB
+}
+
+func NewUsageRepository(db *sql.DB) UsageRepository {
+	return &usageRepository{db: db}
+}
+
+func (r *usageRepository) IncrementUsage(entity, period string, requests, rowsIngested, batchesRun int64) error {
+	query := `
+		INSERT INTO api_usage (entity, period, requests, rows_ingested, batches_run)
+		VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			requests = requests + VALUES(requests),
+			rows_ingested = rows_ingested + VALUES(rows_ingested),
+			batches_run = batches_run + VALUES(batches_run)
+	`
+	_, err := r.db.Exec(query, entity, period, requests, rowsIngested, batchesRun)
+	return err
+}
+
+// GetUsage returns zeroed usage when the entity has no activity in the period
+func (r *usageRepository) GetUsage(entity, period string) (*models.APIUsage, error) {
+	usage := &models.APIUsage{Entity: entity, Period: period}
+	query := `
+		SELECT requests, rows_ingested, batches_run, updated_at
+		FROM api_usage
+		WHERE entity = ? AND period = ?
+	`
+	err := r.db.QueryRow(query, entity, period).Scan(
+		&usage.Requests,
+		&usage.RowsIngested,
+		&usage.BatchesRun,
+		&usage.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return usage, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+func (r *usageRepository) ListUsage(period string) ([]*models.APIUsage, error) {
+	query := `
+		SELECT entity, period, requests, rows_ingested, batches_run, updated_at
+		FROM api_usage
+		WHERE period = ?
+		ORDER BY entity
+	`
+	rows, err := r.db.Query(query, period)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usages []*models.APIUsage
+	for rows.Next() {
+		usage := &models.APIUsage{}
+		err := rows.Scan(
+			&usage.Entity,
+			&usage.Period,
+			&usage.Requests,
+			&usage.RowsIngested,
+			&usage.BatchesRun,
+			&usage.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		usages = append(usages, usage)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return usages, nil
+}
+
+// GetQuota returns nil without error when no override exists for the entity
+func (r *usageRepository) GetQuota(entity string) (*models.APIQuota, error) {
+	quota := &models.APIQuota{}
+	query := `
+		SELECT entity, max_requests, max_rows_ingested, max_batches, updated_at
+		FROM api_quotas
+		WHERE entity = ?
+	`
+	err := r.db.QueryRow(query, entity).Scan(
+		&quota.Entity,
+		&quota.MaxRequests,
+		&quota.MaxRowsIngested,
+		&quota.MaxBatches,
+		&quota.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return quota, nil
+}
+
+func (r *usageRepository) UpsertQuota(quota *models.APIQuota) error {
+	query := `
+		INSERT INTO api_quotas (entity, max_requests, max_rows_ingested, max_batches)
+		VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			max_requests = VALUES(max_requests),
+			max_rows_ingested = VALUES(max_rows_ingested),
+			max_batches = VALUES(max_batches)
+	`
+	_, err := r.db.Exec(query,
+		quota.Entity,
+		quota.MaxRequests,
+		quota.MaxRowsIngested,
+		quota.MaxBatches,
+	)
+	return err
+}
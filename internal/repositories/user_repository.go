@@ -0,0 +1,181 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+
+	"reconciliation-service/internal/models"
+)
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+
+	// ErrLastAdmin refuses to remove or demote the only remaining admin
+	ErrLastAdmin = errors.New("at least one admin must remain")
+)
+
+type UserRepository interface {
+	ListRoles() ([]*models.Role, error)
+	ListUsers() ([]*models.User, error)
+	GetUser(id string) (*models.User, error)
+	SaveUser(user *models.User) (bool, error)
+	DeleteUser(id string) error
+}
+
+type userRepository struct {
+	db *sql.DB
+}
+
+func NewUserRepository(db *sql.DB) UserRepository {
+	return &userRepository{db: db}
+}
+
+const userColumns = "id, display_name, role, updated_by, created_at, updated_at"
+
+func scanUser(row rowScanner) (*models.User, error) {
+	user := &models.User{}
+	err := row.Scan(
+		&user.ID,
+		&user.DisplayName,
+		&user.Role,
+		&user.UpdatedBy,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (r *userRepository) ListRoles() ([]*models.Role, error) {
+	rows, err := r.db.Query("SELECT name, level, description FROM roles ORDER BY level")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []*models.Role{}
+	for rows.Next() {
+		role := &models.Role{}
+		if err := rows.Scan(&role.Name, &role.Level, &role.Description); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (r *userRepository) ListUsers() ([]*models.User, error) {
+	rows, err := r.db.Query("SELECT " + userColumns + " FROM users ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *userRepository) GetUser(id string) (*models.User, error) {
+	user, err := scanUser(r.db.QueryRow("SELECT "+userColumns+" FROM users WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// SaveUser creates or replaces a user's role assignment, reporting whether it
+// was created. Demoting the last admin fails with ErrLastAdmin.
+func (r *userRepository) SaveUser(user *models.User) (bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var current string
+	err = tx.QueryRow("SELECT role FROM users WHERE id = ? FOR UPDATE", user.ID).Scan(&current)
+	created := err == sql.ErrNoRows
+	if err != nil && !created {
+		return false, err
+	}
+	if current == models.RoleAdmin && user.Role != models.RoleAdmin {
+		if err := checkOtherAdmins(tx, user.ID); err != nil {
+			return false, err
+		}
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO users (id, display_name, role, updated_by)
+		VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			display_name = VALUES(display_name),
+			role = VALUES(role),
+			updated_by = VALUES(updated_by)
+	`, user.ID, user.DisplayName, user.Role, user.UpdatedBy)
+	if err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return created, nil
+}
+
+// DeleteUser removes a user's role assignment; the last admin stays
+func (r *userRepository) DeleteUser(id string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var role string
+	err = tx.QueryRow("SELECT role FROM users WHERE id = ? FOR UPDATE", id).Scan(&role)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if role == models.RoleAdmin {
+		if err := checkOtherAdmins(tx, id); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM users WHERE id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// checkOtherAdmins locks the admins and fails unless one besides id remains
+func checkOtherAdmins(tx *sql.Tx, id string) error {
+	var others int
+	err := tx.QueryRow("SELECT COUNT(*) FROM users WHERE role = ? AND id <> ? FOR UPDATE", models.RoleAdmin, id).Scan(&others)
+	if err != nil {
+		return err
+	}
+	if others == 0 {
+		return ErrLastAdmin
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+)
+
+var (
+	ErrBankTransactionNotFound = errors.New("bank transaction not found")
+	ErrAccountingEntryNotFound = errors.New("accounting entry not found")
+	ErrReconciliationNotFound  = errors.New("reconciliation not found")
+
+	// ErrVersionConflict rejects an update whose expected version is no longer
+	// current because someone else changed the row first
+	ErrVersionConflict = errors.New("record was modified by someone else")
+
+	// ErrMappingConflict rejects mapping a pair a reconciliation already
+	// maps
+	ErrMappingConflict = errors.New("reconciliation already maps these records")
+
+	// ErrMappingRecordMissing rejects a mapping to a bank transaction,
+	// accounting entry or reconciliation that does not exist
+	ErrMappingRecordMissing = errors.New("mapping refers to a record that does not exist")
+
+	// ErrMappingWithoutRecord rejects a mapping naming neither a bank
+	// transaction nor an accounting entry
+	ErrMappingWithoutRecord = errors.New("mapping must name a bank transaction or an accounting entry")
+
+	// ErrDuplicateReference rejects an external reference that already names
+	// a batch of the tenant, or is the ID of one
+	ErrDuplicateReference = errors.New("external reference already names a batch")
+)
+
+// checkVersionedUpdate tells a stale version apart from a missing row after a
+// compare-and-set UPDATE ... WHERE id = ? AND version = ? matched nothing. A
+// row of another tenant is missing.
+func checkVersionedUpdate(tx *sql.Tx, result sql.Result, table, tenant string, id int64, notFound error) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected > 0 {
+		return nil
+	}
+
+	var exists bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM "+table+" WHERE id = ? AND tenant_id = ?)", id, tenant).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return notFound
+	}
+	return ErrVersionConflict
+}
@@ -0,0 +1,326 @@
+package repositories
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"reconciliation-service/internal/models"
+)
+
+var ErrWebhookEndpointNotFound = errors.New("webhook endpoint not found")
+
+type WebhookRepository interface {
+	CreateEndpoint(endpoint *models.WebhookEndpoint) error
+	UpdateEndpoint(endpoint *models.WebhookEndpoint) error
+	GetEndpoint(id int64) (*models.WebhookEndpoint, error)
+	ListEndpoints() ([]*models.WebhookEndpoint, error)
+	DeleteEndpoint(id int64) error
+	CreateEvent(event *models.WebhookEvent, dedupKey string) (bool, error)
+	DueDeliveries(now time.Time, limit int) ([]*models.WebhookDelivery, error)
+	ClaimDelivery(id int64, now, until time.Time) (bool, error)
+	RecordAttempt(delivery *models.WebhookDelivery) error
+	ListDeliveries(endpointID int64, status string, beforeID int64, limit int) ([]*models.WebhookDelivery, error)
+}
+
+type webhookRepository struct {
+	db *sql.DB
+}
+
+func NewWebhookRepository(db *sql.DB) WebhookRepository {
+	return &webhookRepository{db: db}
+}
+
+func (r *webhookRepository) CreateEndpoint(endpoint *models.WebhookEndpoint) error {
+	eventTypes, err := json.Marshal(endpoint.EventTypes)
+	if err != nil {
+		return err
+	}
+	result, err := r.db.Exec(`
+		INSERT INTO webhook_endpoints (url, secret, event_types, description, active, updated_by)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, endpoint.URL, endpoint.Secret, eventTypes, endpoint.Description, endpoint.Active, endpoint.UpdatedBy)
+	if err != nil {
+		return err
+	}
+	endpoint.ID, err = result.LastInsertId()
+	return err
+}
+
+// UpdateEndpoint replaces an endpoint, keeping its secret
+func (r *webhookRepository) UpdateEndpoint(endpoint *models.WebhookEndpoint) error {
+	eventTypes, err := json.Marshal(endpoint.EventTypes)
+	if err != nil {
+		return err
+	}
+	result, err := r.db.Exec(`
+		UPDATE webhook_endpoints
+		SET url = ?, event_types = ?, description = ?, active = ?, updated_by = ?
+		WHERE id = ?
+	`, endpoint.URL, eventTypes, endpoint.Description, endpoint.Active, endpoint.UpdatedBy, endpoint.ID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		// An update that changes nothing affects no rows either
+		if _, err := r.GetEndpoint(endpoint.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const webhookEndpointColumns = `
+	id, url, secret, event_types, description, active, updated_by, created_at, updated_at`
+
+func scanWebhookEndpoint(row rowScanner) (*models.WebhookEndpoint, error) {
+	endpoint := &models.WebhookEndpoint{}
+	var eventTypes []byte
+	err := row.Scan(
+		&endpoint.ID,
+		&endpoint.URL,
+		&endpoint.Secret,
+		&eventTypes,
+		&endpoint.Description,
+		&endpoint.Active,
+		&endpoint.UpdatedBy,
+		&endpoint.CreatedAt,
+		&endpoint.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	endpoint.EventTypes = []string{}
+	if err := json.Unmarshal(eventTypes, &endpoint.EventTypes); err != nil {
+		return nil, err
+	}
+	return endpoint, nil
+}
+
+func (r *webhookRepository) GetEndpoint(id int64) (*models.WebhookEndpoint, error) {
+	endpoint, err := scanWebhookEndpoint(r.db.QueryRow(`SELECT `+webhookEndpointColumns+` FROM webhook_endpoints WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrWebhookEndpointNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return endpoint, nil
+}
+
+func (r *webhookRepository) ListEndpoints() ([]*models.WebhookEndpoint, error) {
+	rows, err := r.db.Query(`SELECT ` + webhookEndpointColumns + ` FROM webhook_endpoints ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	endpoints := []*models.WebhookEndpoint{}
+	for rows.Next() {
+		endpoint, err := scanWebhookEndpoint(rows)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return endpoints, nil
+}
+
+// DeleteEndpoint deletes an endpoint with its deliveries
+func (r *webhookRepository) DeleteEndpoint(id int64) error {
+	result, err := r.db.Exec("DELETE FROM webhook_endpoints WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrWebhookEndpointNotFound
+	}
+	return nil
+}
+
+// CreateEvent stores an event with a pending delivery to every active
+// endpoint subscribed to its type, and reports whether it was stored. An
+// event whose dedup key was stored before is not stored again.
+func (r *webhookRepository) CreateEvent(event *models.WebhookEvent, dedupKey string) (bool, error) {
+	payload, err := json.Marshal(event.Data)
+	if err != nil {
+		return false, err
+	}
+	sum := sha256.Sum256([]byte(dedupKey))
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	event.CreatedAt = time.Now()
+	result, err := tx.Exec(`
+		INSERT INTO webhook_events (event_type, dedup_key, payload, created_at)
+		VALUES (?, ?, ?, ?)
+	`, event.EventType, hex.EncodeToString(sum[:]), payload, event.CreatedAt)
+	if IsDuplicateEntry(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if event.ID, err = result.LastInsertId(); err != nil {
+		return false, err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO webhook_deliveries (event_id, endpoint_id, status)
+		SELECT ?, id, ? FROM webhook_endpoints
+		WHERE active = TRUE AND JSON_CONTAINS(event_types, JSON_QUOTE(?))
+	`, event.ID, models.WebhookDeliveryPending, event.EventType)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+const webhookDeliveryColumns = `
+	d.id, d.event_id, d.endpoint_id, d.status, d.attempts, d.last_status, COALESCE(d.last_error, ''),
+	d.next_attempt_at, d.delivered_at, d.created_at,
+	e.event_type, e.payload, e.created_at, w.url, w.secret`
+
+func scanWebhookDelivery(row rowScanner) (*models.WebhookDelivery, error) {
+	delivery := &models.WebhookDelivery{Event: &models.WebhookEvent{}}
+	var nextAttemptAt, deliveredAt sql.NullTime
+	var payload []byte
+	err := row.Scan(
+		&delivery.ID,
+		&delivery.EventID,
+		&delivery.EndpointID,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.LastStatus,
+		&delivery.LastError,
+		&nextAttemptAt,
+		&deliveredAt,
+		&delivery.CreatedAt,
+		&delivery.Event.EventType,
+		&payload,
+		&delivery.Event.CreatedAt,
+		&delivery.URL,
+		&delivery.Secret,
+	)
+	if err != nil {
+		return nil, err
+	}
+	delivery.Event.ID = delivery.EventID
+	if err := json.Unmarshal(payload, &delivery.Event.Data); err != nil {
+		return nil, err
+	}
+	if nextAttemptAt.Valid {
+		delivery.NextAttemptAt = &nextAttemptAt.Time
+	}
+	if deliveredAt.Valid {
+		delivery.DeliveredAt = &deliveredAt.Time
+	}
+	return delivery, nil
+}
+
+func (r *webhookRepository) queryDeliveries(query string, args ...interface{}) ([]*models.WebhookDelivery, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*models.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// DueDeliveries returns the pending deliveries due by now, oldest first
+func (r *webhookRepository) DueDeliveries(now time.Time, limit int) ([]*models.WebhookDelivery, error) {
+	return r.queryDeliveries(`
+		SELECT `+webhookDeliveryColumns+`
+		FROM webhook_deliveries d
+		JOIN webhook_events e ON e.id = d.event_id
+		JOIN webhook_endpoints w ON w.id = d.endpoint_id
+		WHERE d.status = ? AND (d.next_attempt_at IS NULL OR d.next_attempt_at <= ?)
+		ORDER BY d.id
+		LIMIT ?
+	`, models.WebhookDeliveryPending, now, limit)
+}
+
+// ClaimDelivery holds a due delivery until a time, so other instances pass
+// it over while it is being sent, and reports whether it was still due
+func (r *webhookRepository) ClaimDelivery(id int64, now, until time.Time) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE webhook_deliveries SET next_attempt_at = ?
+		WHERE id = ? AND status = ? AND (next_attempt_at IS NULL OR next_attempt_at <= ?)
+	`, until, id, models.WebhookDeliveryPending, now)
+	if err != nil {
+		return false, err
+	}
+	claimed, err := result.RowsAffected()
+	return claimed == 1, err
+}
+
+// RecordAttempt records the outcome of an attempt to send a delivery
+func (r *webhookRepository) RecordAttempt(delivery *models.WebhookDelivery) error {
+	var lastError interface{}
+	if delivery.LastError != "" {
+		lastError = delivery.LastError
+	}
+	_, err := r.db.Exec(`
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = ?, last_status = ?, last_error = ?, next_attempt_at = ?, delivered_at = ?
+		WHERE id = ?
+	`, delivery.Status, delivery.Attempts, delivery.LastStatus, lastError, delivery.NextAttemptAt, delivery.DeliveredAt, delivery.ID)
+	return err
+}
+
+// ListDeliveries lists deliveries newest first with their events, optionally
+// of one endpoint or status, below beforeID when it is set
+func (r *webhookRepository) ListDeliveries(endpointID int64, status string, beforeID int64, limit int) ([]*models.WebhookDelivery, error) {
+	query := `
+		SELECT ` + webhookDeliveryColumns + `
+		FROM webhook_deliveries d
+		JOIN webhook_events e ON e.id = d.event_id
+		JOIN webhook_endpoints w ON w.id = d.endpoint_id
+		WHERE 1 = 1`
+	var args []interface{}
+	if endpointID != 0 {
+		query += ` AND d.endpoint_id = ?`
+		args = append(args, endpointID)
+	}
+	if status != "" {
+		query += ` AND d.status = ?`
+		args = append(args, status)
+	}
+	if beforeID != 0 {
+		query += ` AND d.id < ?`
+		args = append(args, beforeID)
+	}
+	query += ` ORDER BY d.id DESC LIMIT ?`
+	args = append(args, limit)
+	return r.queryDeliveries(query, args...)
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+)
+
+var (
+	// ErrInvalidUser wraps every rejection of a role assignment
+	ErrInvalidUser = errors.New("invalid user")
+
+	// ErrNoRole means an authenticated caller has no role assigned
+	ErrNoRole = errors.New("no role is assigned to this user")
+
+	// ErrForbidden means the caller's role is below the one the route needs
+	ErrForbidden = errors.New("your role does not allow this operation")
+)
+
+const roleCacheTTL = 30 * time.Second
+
+// roleLevels orders the roles; a role is allowed whatever a lower one is
+var roleLevels = map[string]int{
+	models.RoleViewer:   1,
+	models.RoleOperator: 2,
+	models.RoleAdmin:    3,
+}
+
+type cachedRole struct {
+	role     string
+	cachedAt time.Time
+}
+
+// AccessService resolves the role of an authenticated user. Roles are cached
+// briefly so authorization doesn't hit the database on every request; a
+// change made here applies at once, on other instances within the TTL.
+// Bootstrap admins are admins without a users row, so a fresh installation
+// can assign the first roles.
+type AccessService struct {
+	userRepo        repositories.UserRepository
+	bootstrapAdmins map[string]bool
+
+	mu    sync.Mutex
+	cache map[string]cachedRole
+}
+
+func NewAccessService(userRepo repositories.UserRepository, bootstrapAdmins []string) *AccessService {
+	admins := make(map[string]bool, len(bootstrapAdmins))
+	for _, id := range bootstrapAdmins {
+		if id = strings.TrimSpace(id); id != "" {
+			admins[id] = true
+		}
+	}
+	return &AccessService{
+		userRepo:        userRepo,
+		bootstrapAdmins: admins,
+		cache:           make(map[string]cachedRole),
+	}
+}
+
+// Role returns the role of userID, ErrNoRole when it has none
+func (s *AccessService) Role(userID string) (string, error) {
+	if s.bootstrapAdmins[userID] {
+		return models.RoleAdmin, nil
+	}
+
+	s.mu.Lock()
+	cached, ok := s.cache[userID]
+	s.mu.Unlock()
+	if ok && time.Since(cached.cachedAt) < roleCacheTTL {
+		if cached.role == "" {
+			return "", ErrNoRole
+		}
+		return cached.role, nil
+	}
+
+	var role string
+	user, err := s.userRepo.GetUser(userID)
+	switch {
+	case errors.Is(err, repositories.ErrUserNotFound):
+	case err != nil:
+		return "", fmt.Errorf("failed to load user role: %v", err)
+	default:
+		role = user.Role
+	}
+
+	s.mu.Lock()
+	s.cache[userID] = cachedRole{role: role, cachedAt: time.Now()}
+	s.mu.Unlock()
+	if role == "" {
+		return "", ErrNoRole
+	}
+	return role, nil
+}
+
+// Authorize checks that userID holds at least the required role
+func (s *AccessService) Authorize(userID, required string) error {
+	role, err := s.Role(userID)
+	if err != nil {
+		return err
+	}
+	return s.AuthorizeRole(role, required)
+}
+
+// AuthorizeRole checks that role is at least the required one
+func (s *AccessService) AuthorizeRole(role, required string) error {
+	if roleLevels[role] < roleLevels[required] {
+		return fmt.Errorf("%w: requires the %s role", ErrForbidden, required)
+	}
+	return nil
+}
+
+func (s *AccessService) ListRoles() ([]*models.Role, error) {
+	return s.userRepo.ListRoles()
+}
+
+func (s *AccessService) ListUsers() ([]*models.User, error) {
+	return s.userRepo.ListUsers()
+}
+
+func (s *AccessService) GetUser(id string) (*models.User, error) {
+	return s.userRepo.GetUser(id)
+}
+
+// SaveUser assigns a role to a user, creating the user when it is new, and
+// reports whether it was created
+func (s *AccessService) SaveUser(user *models.User) (bool, error) {
+	user.ID = strings.TrimSpace(user.ID)
+	user.Role = strings.ToLower(strings.TrimSpace(user.Role))
+	user.DisplayName = strings.TrimSpace(user.DisplayName)
+	if user.ID == "" {
+		return false, fmt.Errorf("%w: id is required", ErrInvalidUser)
+	}
+	if len(user.ID) > 100 {
+		return false, fmt.Errorf("%w: id must be at most 100 characters", ErrInvalidUser)
+	}
+	if _, ok := roleLevels[user.Role]; !ok {
+		return false, fmt.Errorf("%w: role must be %s, %s or %s", ErrInvalidUser, models.RoleViewer, models.RoleOperator, models.RoleAdmin)
+	}
+
+	created, err := s.userRepo.SaveUser(user)
+	if err != nil {
+		if errors.Is(err, repositories.ErrLastAdmin) {
+			return false, err
+		}
+		return false, fmt.Errorf("failed to save user: %v", err)
+	}
+	s.forget(user.ID)
+	log.Printf("User %s assigned role %s by %q", user.ID, user.Role, user.UpdatedBy)
+	return created, nil
+}
+
+func (s *AccessService) DeleteUser(id string) error {
+	if err := s.userRepo.DeleteUser(id); err != nil {
+		return err
+	}
+	s.forget(id)
+	return nil
+}
+
+func (s *AccessService) forget(userID string) {
+	s.mu.Lock()
+	delete(s.cache, userID)
+	s.mu.Unlock()
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"sort"
+
+	"reconciliation-service/internal/matching"
+	"reconciliation-service/internal/models"
+)
+
+// accountOutcomes breaks what a batch matched and left unmatched down by bank
+// account and by ledger account code, in the order GetAccountOutcomes reads
+// them back: bank accounts first, each side by the most unmatched records.
+// Fees and returns are neither, so they are left out. A partition leaves
+// unmatchedEntries to the run's finalization, whose outcomes add to its own.
+func accountOutcomes(config matching.Config, kept []*matching.MatchResult, unmatchedBank []*models.BankTransaction, unmatchedEntries []*models.AccountingEntry) []*models.AccountOutcome {
+	amounts := batchAmounts{config: config}
+	bySide := map[string]map[string]*models.AccountOutcome{
+		models.AccountSideBank:   {},
+		models.AccountSideLedger: {},
+	}
+	outcome := func(side, account string) *models.AccountOutcome {
+		o, ok := bySide[side][account]
+		if !ok {
+			o = &models.AccountOutcome{Side: side, Account: account}
+			bySide[side][account] = o
+		}
+		return o
+	}
+
+	matchedTransactions := make(map[int64]bool)
+	matchedEntries := make(map[int64]bool)
+	for _, match := range kept {
+		// A partial match counts on both sides for what it settled
+		partial := match.Type == models.MappingPartial
+		for _, bt := range match.AllBankTransactions() {
+			if matchedTransactions[bt.ID] {
+				continue
+			}
+			matchedTransactions[bt.ID] = true
+			o := outcome(models.AccountSideBank, bt.AccountNumber)
+			o.MatchedCount++
+			amount := bt.Amount
+			if partial {
+				amount = match.SettledAmount
+			}
+			if converted, ok := amounts.convert(amount, bt.Currency, bt.TransactionDate); ok {
+				o.MatchedAmount += converted
+			}
+		}
+		for _, ae := range match.AccountingEntries {
+			if matchedEntries[ae.ID] {
+				continue
+			}
+			matchedEntries[ae.ID] = true
+			o := outcome(models.AccountSideLedger, ae.AccountCode)
+			o.MatchedCount++
+			amount := ae.Amount
+			if partial {
+				amount = match.SettledAmount
+			}
+			if converted, ok := amounts.convert(amount, ae.Currency, ae.EntryDate); ok {
+				o.MatchedAmount += converted
+			}
+		}
+	}
+	for _, bt := range unmatchedBank {
+		o := outcome(models.AccountSideBank, bt.AccountNumber)
+		o.UnmatchedCount++
+		if converted, ok := amounts.convert(bt.Amount, bt.Currency, bt.TransactionDate); ok {
+			o.UnmatchedAmount += converted
+		}
+	}
+	for _, ae := range unmatchedEntries {
+		o := outcome(models.AccountSideLedger, ae.AccountCode)
+		o.UnmatchedCount++
+		if converted, ok := amounts.convert(ae.Amount, ae.Currency, ae.EntryDate); ok {
+			o.UnmatchedAmount += converted
+		}
+	}
+
+	var outcomes []*models.AccountOutcome
+	for _, side := range []string{models.AccountSideBank, models.AccountSideLedger} {
+		start := len(outcomes)
+		for _, o := range bySide[side] {
+			outcomes = append(outcomes, o)
+		}
+		sideOutcomes := outcomes[start:]
+		sort.Slice(sideOutcomes, func(i, j int) bool {
+			if sideOutcomes[i].UnmatchedCount != sideOutcomes[j].UnmatchedCount {
+				return sideOutcomes[i].UnmatchedCount > sideOutcomes[j].UnmatchedCount
+			}
+			return sideOutcomes[i].Account < sideOutcomes[j].Account
+		})
+	}
+	return outcomes
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"reconciliation-service/internal/banking"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+)
+
+// ErrInvalidAlias wraps every rejection of an alias dictionary entry
+var ErrInvalidAlias = errors.New("invalid alias")
+
+type AliasService struct {
+	aliasRepo      repositories.AliasRepository
+	bankRepo       repositories.BankRepository
+	accountingRepo repositories.AccountingRepository
+}
+
+func NewAliasService(aliasRepo repositories.AliasRepository, bankRepo repositories.BankRepository, accountingRepo repositories.AccountingRepository) *AliasService {
+	return &AliasService{
+		aliasRepo:      aliasRepo,
+		bankRepo:       bankRepo,
+		accountingRepo: accountingRepo,
+	}
+}
+
+// CreateAlias adds an entry to the dictionary. An alias confirmed from a
+// suggested match names the bank transaction and entry of that match; the
+// alias must then appear in the description of one of them.
+func (s *AliasService) CreateAlias(alias *models.NameAlias) error {
+	alias.Alias = banking.NormalizeName(alias.Alias)
+	alias.Canonical = banking.NormalizeName(alias.Canonical)
+	alias.UserID = strings.TrimSpace(alias.UserID)
+	switch {
+	case alias.Alias == "":
+		return fmt.Errorf("%w: alias is required", ErrInvalidAlias)
+	case alias.Canonical == "":
+		return fmt.Errorf("%w: canonical is required", ErrInvalidAlias)
+	case alias.Alias == alias.Canonical:
+		return fmt.Errorf("%w: alias and canonical are the same", ErrInvalidAlias)
+	case len(alias.Alias) > maxAliasLength || len(alias.Canonical) > maxAliasLength:
+		return fmt.Errorf("%w: alias and canonical must be at most %d characters", ErrInvalidAlias, maxAliasLength)
+	}
+
+	// The dictionary is applied in a single pass, so a chain of aliases
+	// would rewrite text differently depending on where it starts
+	existing, err := s.aliasRepo.ListAliases()
+	if err != nil {
+		return fmt.Errorf("failed to load aliases: %v", err)
+	}
+	for _, other := range existing {
+		if other.Alias == alias.Canonical {
+			return fmt.Errorf("%w: %q is itself an alias of %q", ErrInvalidAlias, alias.Canonical, other.Canonical)
+		}
+		if other.Canonical == alias.Alias {
+			return fmt.Errorf("%w: %q is already the canonical name of %q", ErrInvalidAlias, alias.Alias, other.Alias)
+		}
+	}
+
+	alias.Source = models.AliasSourceManual
+	if alias.BankTransactionID != 0 || alias.AccountingEntryID != 0 {
+		if err := s.checkReviewedMatch(alias); err != nil {
+			return err
+		}
+		alias.Source = models.AliasSourceSuggestionReview
+	}
+
+	if err := s.aliasRepo.CreateAlias(alias); err != nil {
+		if errors.Is(err, repositories.ErrAliasConflict) {
+			return err
+		}
+		return fmt.Errorf("failed to store alias: %v", err)
+	}
+	return nil
+}
+
+func (s *AliasService) checkReviewedMatch(alias *models.NameAlias) error {
+	if alias.BankTransactionID == 0 || alias.AccountingEntryID == 0 {
+		return fmt.Errorf("%w: a reviewed match needs both bank_transaction_id and accounting_entry_id", ErrInvalidAlias)
+	}
+	bt, err := s.bankRepo.GetBankTransactionByID(alias.BankTransactionID)
+	if err != nil {
+		return fmt.Errorf("%w: bank transaction %d: %v", ErrInvalidAlias, alias.BankTransactionID, err)
+	}
+	ae, err := s.accountingRepo.GetAccountingEntryByID(alias.AccountingEntryID)
+	if err != nil {
+		return fmt.Errorf("%w: accounting entry %d: %v", ErrInvalidAlias, alias.AccountingEntryID, err)
+	}
+
+	word := " " + alias.Alias + " "
+	if !strings.Contains(" "+banking.NormalizeName(bt.Description)+" ", word) &&
+		!strings.Contains(" "+banking.NormalizeName(ae.Description)+" ", word) {
+		return fmt.Errorf("%w: %q appears in neither description of the match", ErrInvalidAlias, alias.Alias)
+	}
+	return nil
+}
+
+func (s *AliasService) ListAliases() ([]*models.NameAlias, error) {
+	return s.aliasRepo.ListAliases()
+}
+
+func (s *AliasService) DeleteAlias(id int64) error {
+	return s.aliasRepo.DeleteAlias(id)
+}
+
+// loadAliasDictionary reads the current dictionary, so aliases added through
+// the API apply to the next ingestion or batch without a restart
+func loadAliasDictionary(aliasRepo repositories.AliasRepository) (*banking.AliasDictionary, error) {
+	aliases, err := aliasRepo.ListAliases()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load aliases: %v", err)
+	}
+	dictionary := make(map[string]string, len(aliases))
+	for _, alias := range aliases {
+		dictionary[alias.Alias] = alias.Canonical
+	}
+	return banking.NewAliasDictionary(dictionary), nil
+}
@@ -0,0 +1,250 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/money"
+	"reconciliation-service/internal/repositories"
+)
+
+// ErrInvalidAnalyticsQuery rejects an analytics request
+var ErrInvalidAnalyticsQuery = errors.New("invalid analytics query")
+
+const (
+	// DefaultCashHorizonDays is how far past the position date expected
+	// payments count towards the projected balance
+	DefaultCashHorizonDays = 30
+	MaxCashHorizonDays     = 366
+
+	// MaxStatsDays bounds the date range of reconciliation statistics
+	MaxStatsDays = 366
+)
+
+// unmatchedAgeBuckets are the ages, in days since their transaction date, the
+// unmatched amount is broken down by. A zero maximum has no upper bound.
+var unmatchedAgeBuckets = []struct {
+	name             string
+	minDays, maxDays int
+}{
+	{"0-7", 0, 7},
+	{"8-30", 8, 30},
+	{"31-60", 31, 60},
+	{"61-90", 61, 90},
+	{"90+", 91, 0},
+}
+
+// AnalyticsService derives cash figures from ingested statement balances,
+// bank transactions, reconciliations and expected payments, and statistics of
+// how well the bank transactions reconcile.
+type AnalyticsService struct {
+	analyticsRepo repositories.AnalyticsRepository
+	fxRates       *FXRateService
+	baseCurrency  string
+}
+
+func NewAnalyticsService(analyticsRepo repositories.AnalyticsRepository, fxRates *FXRateService, baseCurrency string) *AnalyticsService {
+	return &AnalyticsService{
+		analyticsRepo: analyticsRepo,
+		fxRates:       fxRates,
+		baseCurrency:  baseCurrency,
+	}
+}
+
+// CashPositions reports the cash of each account, or of one, on a date
+// (YYYY-MM-DD). The balance is the latest statement balance on or before the
+// date plus the transactions booked after it; the reconciled balance leaves
+// out the transactions not matched with the ledger, which are reported as
+// unreconciled inflows and outflows. The projected balance adds the pending
+// expected payments whose window starts within horizonDays of the date, each
+// weighted by the confidence it arrives.
+func (s *AnalyticsService) CashPositions(date, accountNumber string, horizonDays int) ([]*models.CashPosition, error) {
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return nil, fmt.Errorf("%w: date must be YYYY-MM-DD", ErrInvalidAnalyticsQuery)
+	}
+	if horizonDays < 0 || horizonDays > MaxCashHorizonDays {
+		return nil, fmt.Errorf("%w: horizon_days must be between 0 and %d", ErrInvalidAnalyticsQuery, MaxCashHorizonDays)
+	}
+	accountNumber = strings.TrimSpace(accountNumber)
+
+	positions, err := s.analyticsRepo.GetCashPositions(date, accountNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cash positions: %v", err)
+	}
+	outstanding, err := s.analyticsRepo.GetOutstandingPayments(day.AddDate(0, 0, horizonDays).Format("2006-01-02"), accountNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get outstanding payments: %v", err)
+	}
+
+	byAccount := make(map[string]*models.CashPosition, len(positions))
+	for _, position := range positions {
+		position.Balance += position.StatementBalance
+		position.ReconciledBalance = position.Balance - position.UnreconciledInflows - position.UnreconciledOutflows
+		byAccount[position.AccountNumber] = position
+	}
+
+	weighted := make(map[string]float64)
+	for _, payment := range outstanding {
+		position, ok := byAccount[payment.AccountNumber]
+		if !ok || (payment.Currency != "" && position.Currency != "" && payment.Currency != position.Currency) {
+			continue
+		}
+		amount := payment.Amount
+		if payment.Direction == models.ExpectedDirectionOutgoing {
+			amount = -amount
+			position.ExpectedOutflows += amount
+		} else {
+			position.ExpectedInflows += amount
+		}
+		position.OutstandingItems++
+		weighted[payment.AccountNumber] += amount.Float64() * outstandingConfidence(payment)
+	}
+	for _, position := range positions {
+		position.ProjectedBalance = position.Balance + money.FromFloat(weighted[position.AccountNumber])
+	}
+	return positions, nil
+}
+
+// outstandingConfidence is the chance an expected payment arrives, judged by
+// how many expectations of its source and direction were matched rather than
+// missed. The counts are smoothed so a source without history counts half
+// and a short record does not count as certain.
+func outstandingConfidence(payment *models.OutstandingPayment) float64 {
+	return float64(payment.Matched+1) / float64(payment.Matched+payment.Missed+2)
+}
+
+// OperatorBacklog counts the work waiting on operators by account: unmatched
+// records, matches pending review, disputed matches and open exceptions, and
+// how long closed exceptions took to resolve
+func (s *AnalyticsService) OperatorBacklog() (*models.OperatorBacklog, error) {
+	return s.analyticsRepo.GetOperatorBacklog()
+}
+
+// ReconciliationStats sums up the reconciliation of the bank transactions
+// dated from fromDate to toDate (YYYY-MM-DD): how many a matched
+// reconciliation maps, the matches by mapping type with their average
+// confidence, the matched and unmatched amounts in the base currency, the
+// unmatched amount by age and the same figures day by day. Missing exchange
+// rates leave amounts out rather than fail the statistics.
+func (s *AnalyticsService) ReconciliationStats(fromDate, toDate string) (*models.ReconciliationStats, error) {
+	from, err := time.Parse("2006-01-02", fromDate)
+	if err != nil {
+		return nil, fmt.Errorf("%w: from_date must be YYYY-MM-DD", ErrInvalidAnalyticsQuery)
+	}
+	to, err := time.Parse("2006-01-02", toDate)
+	if err != nil {
+		return nil, fmt.Errorf("%w: to_date must be YYYY-MM-DD", ErrInvalidAnalyticsQuery)
+	}
+	if to.Before(from) {
+		return nil, fmt.Errorf("%w: to_date must not be before from_date", ErrInvalidAnalyticsQuery)
+	}
+	if to.Sub(from) >= MaxStatsDays*24*time.Hour {
+		return nil, fmt.Errorf("%w: the range must not be longer than %d days", ErrInvalidAnalyticsQuery, MaxStatsDays)
+	}
+
+	activity, err := s.analyticsRepo.GetDailyBankActivity(fromDate, toDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bank activity: %v", err)
+	}
+	matchTypes, err := s.analyticsRepo.GetMatchTypeStats(fromDate, toDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get match statistics: %v", err)
+	}
+	rates, err := s.fxRates.RateTable()
+	if err != nil {
+		log.Printf("exchange rates unavailable, counting only %s amounts: %v", s.baseCurrency, err)
+	}
+
+	stats := &models.ReconciliationStats{
+		FromDate:      fromDate,
+		ToDate:        toDate,
+		Currency:      s.baseCurrency,
+		MatchesByType: make(map[string]int),
+	}
+	for _, bucket := range unmatchedAgeBuckets {
+		stats.UnmatchedByAge = append(stats.UnmatchedByAge, &models.UnmatchedAgeBucket{
+			Bucket: bucket.name, MinDays: bucket.minDays, MaxDays: bucket.maxDays,
+		})
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	var trend *models.DailyMatchStats
+	for _, day := range activity {
+		if trend == nil || trend.Date != day.Date {
+			trend = &models.DailyMatchStats{Date: day.Date}
+			stats.Trend = append(stats.Trend, trend)
+		}
+		unmatched := day.Count - day.Matched
+		trend.BankTransactions += day.Count
+		trend.Matched += day.Matched
+		stats.BankTransactions += day.Count
+		stats.Matched += day.Matched
+		stats.Unmatched += unmatched
+
+		var aged *models.UnmatchedAgeBucket
+		date, _ := time.Parse("2006-01-02", day.Date)
+		age := int(today.Sub(date).Hours() / 24)
+		for _, bucket := range stats.UnmatchedByAge {
+			if age >= bucket.MinDays && (bucket.MaxDays == 0 || age <= bucket.MaxDays) {
+				aged = bucket
+				break
+			}
+		}
+		// Transactions dated after today are of no age yet
+		if aged != nil {
+			aged.Count += unmatched
+		}
+
+		currencyCode := day.Currency
+		if currencyCode == "" {
+			currencyCode = s.baseCurrency
+		}
+		matchedAmount, matchedOK := rates.Convert(day.MatchedAmount, currencyCode, s.baseCurrency, day.Date)
+		unmatchedAmount, unmatchedOK := rates.Convert(day.UnmatchedAmount, currencyCode, s.baseCurrency, day.Date)
+		if !matchedOK || !unmatchedOK {
+			stats.UnconvertedCount += day.Count
+			continue
+		}
+		trend.MatchedAmount += matchedAmount
+		trend.UnmatchedAmount += unmatchedAmount
+		stats.MatchedAmount += matchedAmount
+		stats.UnmatchedAmount += unmatchedAmount
+		if aged != nil {
+			aged.Amount += unmatchedAmount
+		}
+	}
+	for _, day := range stats.Trend {
+		day.MatchRate = matchRate(day.Matched, day.BankTransactions)
+	}
+	if stats.Trend == nil {
+		stats.Trend = []*models.DailyMatchStats{}
+	}
+	stats.MatchRate = matchRate(stats.Matched, stats.BankTransactions)
+
+	var matches int
+	var confidence float64
+	for _, matchType := range matchTypes {
+		stats.MatchesByType[matchType.MappingType] = matchType.Count
+		matches += matchType.Count
+		confidence += matchType.AverageConfidence * float64(matchType.Count)
+	}
+	if matches > 0 {
+		stats.AverageConfidence = math.Round(confidence/float64(matches)*10000) / 10000
+	}
+	return stats, nil
+}
+
+// matchRate is the share of matched out of total, to four decimals, or zero
+// when there is nothing to match
+func matchRate(matched, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(matched)/float64(total)*10000) / 10000
+}
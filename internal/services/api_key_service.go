@@ -0,0 +1,217 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"reconciliation-service/internal/config"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+)
+
+var (
+	// ErrInvalidAPIKey wraps every rejection of an API key to issue
+	ErrInvalidAPIKey = errors.New("invalid API key")
+
+	// ErrAPIKeyRejected means a presented key is unknown, expired or revoked
+	ErrAPIKeyRejected = errors.New("API key is not valid")
+
+	// ErrAPIKeyInactive means the key was rotated, revoked or has expired,
+	// so it cannot be rotated
+	ErrAPIKeyInactive = errors.New("API key is no longer active")
+)
+
+// APIKeyPrefix starts every issued key, so a leaked one is recognised
+const APIKeyPrefix = "rk_"
+
+// APIKeyRole is the role every API key acts with, whatever its scope: keys
+// never reach the admin endpoints
+const APIKeyRole = models.RoleOperator
+
+var apiKeyScopes = map[string]bool{
+	models.APIKeyScopeIngest: true,
+	models.APIKeyScopeFull:   true,
+}
+
+// apiKeyTouchInterval is how stale the recorded last use of a key may get,
+// so a busy uploader does not write on every request
+const apiKeyTouchInterval = time.Minute
+
+// APIKeyService issues the keys machine callers authenticate with, and
+// authenticates them. Only a hash of each key is stored, so a key is shown
+// once, when it is issued or rotated. A rotated key keeps working for the
+// rotation grace period, so the caller can switch without downtime; a
+// revoked one stops at once.
+type APIKeyService struct {
+	apiKeyRepo    repositories.APIKeyRepository
+	tenants       map[string]bool
+	defaultTenant string
+	config        config.APIKeyConfig
+}
+
+func NewAPIKeyService(apiKeyRepo repositories.APIKeyRepository, tenants []string, defaultTenant string, cfg config.APIKeyConfig) *APIKeyService {
+	known := make(map[string]bool, len(tenants))
+	for _, tenant := range tenants {
+		known[tenant] = true
+	}
+	return &APIKeyService{
+		apiKeyRepo:    apiKeyRepo,
+		tenants:       known,
+		defaultTenant: defaultTenant,
+		config:        cfg,
+	}
+}
+
+// Issue validates and stores a key for a tenant, the primary one unless
+// named. The key is returned with its secret, which is not shown again.
+func (s *APIKeyService) Issue(key *models.APIKey, userID string) (*models.APIKey, error) {
+	key.Name = strings.TrimSpace(key.Name)
+	key.Scope = strings.ToLower(strings.TrimSpace(key.Scope))
+	key.Tenant = strings.TrimSpace(key.Tenant)
+	if key.Tenant == "" {
+		key.Tenant = s.defaultTenant
+	}
+	switch {
+	case key.Name == "":
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidAPIKey)
+	case len(key.Name) > 255:
+		return nil, fmt.Errorf("%w: name must be at most 255 characters", ErrInvalidAPIKey)
+	case !apiKeyScopes[key.Scope]:
+		return nil, fmt.Errorf("%w: scope must be %s or %s", ErrInvalidAPIKey, models.APIKeyScopeIngest, models.APIKeyScopeFull)
+	case !s.tenants[key.Tenant]:
+		return nil, fmt.Errorf("%w: unknown tenant %q", ErrInvalidAPIKey, key.Tenant)
+	case key.ExpiresAt != nil && !key.ExpiresAt.After(time.Now()):
+		return nil, fmt.Errorf("%w: expires_at must be in the future", ErrInvalidAPIKey)
+	}
+	key.CreatedBy = userID
+
+	secret, hash, err := newAPIKeySecret()
+	if err != nil {
+		return nil, err
+	}
+	key.Prefix = secret[:len(APIKeyPrefix)+8]
+	if err := s.apiKeyRepo.CreateKey(key, hash); err != nil {
+		return nil, fmt.Errorf("failed to store API key: %v", err)
+	}
+	issued, err := s.apiKeyRepo.GetKey(key.ID)
+	if err != nil {
+		return nil, err
+	}
+	issued.Key = secret
+	return issued, nil
+}
+
+func (s *APIKeyService) GetKey(id int64) (*models.APIKey, error) {
+	return s.apiKeyRepo.GetKey(id)
+}
+
+// ListKeys lists the keys of a tenant, or of every tenant when it is empty,
+// newest first
+func (s *APIKeyService) ListKeys(tenant string) ([]*models.APIKey, error) {
+	return s.apiKeyRepo.ListKeys(strings.TrimSpace(tenant))
+}
+
+// Rotate issues a key with the name, tenant, scope and expiry of an active
+// one, which expires after the rotation grace period unless it expires
+// sooner. The new key is returned with its secret.
+func (s *APIKeyService) Rotate(id int64, userID string) (*models.APIKey, error) {
+	old, err := s.apiKeyRepo.GetKey(id)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if !apiKeyActive(old, now) || old.ReplacedBy != nil {
+		return nil, ErrAPIKeyInactive
+	}
+
+	secret, hash, err := newAPIKeySecret()
+	if err != nil {
+		return nil, err
+	}
+	replacement := &models.APIKey{
+		Tenant:    old.Tenant,
+		Name:      old.Name,
+		Prefix:    secret[:len(APIKeyPrefix)+8],
+		Scope:     old.Scope,
+		ExpiresAt: old.ExpiresAt,
+		CreatedBy: userID,
+	}
+	expiresAt := now.Add(s.config.RotationGrace)
+	if old.ExpiresAt != nil && old.ExpiresAt.Before(expiresAt) {
+		expiresAt = *old.ExpiresAt
+	}
+	if err := s.apiKeyRepo.RotateKey(old, replacement, hash, expiresAt); err != nil {
+		if errors.Is(err, repositories.ErrAPIKeyReplaced) {
+			return nil, ErrAPIKeyInactive
+		}
+		return nil, fmt.Errorf("failed to rotate API key: %v", err)
+	}
+	rotated, err := s.apiKeyRepo.GetKey(replacement.ID)
+	if err != nil {
+		return nil, err
+	}
+	rotated.Key = secret
+	return rotated, nil
+}
+
+// Revoke stops a key from authenticating at once
+func (s *APIKeyService) Revoke(id int64, userID string) (*models.APIKey, error) {
+	if err := s.apiKeyRepo.RevokeKey(id, userID, time.Now()); err != nil {
+		return nil, err
+	}
+	return s.apiKeyRepo.GetKey(id)
+}
+
+// Authenticate returns the active key a caller presented
+func (s *APIKeyService) Authenticate(secret string) (*models.APIKey, error) {
+	secret = strings.TrimSpace(secret)
+	if !strings.HasPrefix(secret, APIKeyPrefix) {
+		return nil, ErrAPIKeyRejected
+	}
+	key, err := s.apiKeyRepo.GetKeyByHash(hashAPIKey(secret))
+	if errors.Is(err, repositories.ErrAPIKeyNotFound) {
+		return nil, ErrAPIKeyRejected
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if !apiKeyActive(key, now) {
+		return nil, ErrAPIKeyRejected
+	}
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchInterval {
+		if err := s.apiKeyRepo.TouchKey(key.ID, now, now.Add(-apiKeyTouchInterval)); err != nil {
+			log.Printf("api keys: failed to record the use of key %d: %v", key.ID, err)
+		}
+	}
+	return key, nil
+}
+
+// apiKeyActive reports whether a key is neither revoked nor expired. A
+// rotated key stays active until it expires.
+func apiKeyActive(key *models.APIKey, now time.Time) bool {
+	return key.RevokedAt == nil && (key.ExpiresAt == nil || now.Before(*key.ExpiresAt))
+}
+
+// newAPIKeySecret draws a key and returns it with its hash
+func newAPIKeySecret() (string, string, error) {
+	random := make([]byte, 24)
+	if _, err := rand.Read(random); err != nil {
+		return "", "", fmt.Errorf("failed to draw API key: %v", err)
+	}
+	secret := APIKeyPrefix + hex.EncodeToString(random)
+	return secret, hashAPIKey(secret), nil
+}
+
+// hashAPIKey is the stored form of a key. Keys are random enough that a
+// plain hash cannot be reversed by guessing.
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
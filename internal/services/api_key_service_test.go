@@ -0,0 +1,191 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"reconciliation-service/internal/config"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories/repotest"
+)
+
+func newTestAPIKeyService() (*APIKeyService, *repotest.APIKeys) {
+	repo := repotest.NewAPIKeys()
+	return NewAPIKeyService(repo, []string{"acme", "globex"}, "acme", config.APIKeyConfig{RotationGrace: time.Hour}), repo
+}
+
+func TestAPIKeyIssue(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(24 * time.Hour)
+
+	tests := []struct {
+		name       string
+		key        models.APIKey
+		wantErr    bool
+		wantTenant string
+	}{
+		{name: "defaults to the primary tenant", key: models.APIKey{Name: "uploader", Scope: "ingest"}, wantTenant: "acme"},
+		{name: "named tenant and scope in any case", key: models.APIKey{Name: " uploader ", Scope: " FULL ", Tenant: "globex", ExpiresAt: &future}, wantTenant: "globex"},
+		{name: "name required", key: models.APIKey{Name: "  ", Scope: "ingest"}, wantErr: true},
+		{name: "name too long", key: models.APIKey{Name: strings.Repeat("k", 256), Scope: "ingest"}, wantErr: true},
+		{name: "unknown scope", key: models.APIKey{Name: "uploader", Scope: "admin"}, wantErr: true},
+		{name: "unknown tenant", key: models.APIKey{Name: "uploader", Scope: "ingest", Tenant: "initech"}, wantErr: true},
+		{name: "already expired", key: models.APIKey{Name: "uploader", Scope: "ingest", ExpiresAt: &past}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, repo := newTestAPIKeyService()
+			key := tt.key
+			issued, err := service.Issue(&key, "admin")
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidAPIKey) {
+					t.Fatalf("error = %v, want ErrInvalidAPIKey", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if issued.Tenant != tt.wantTenant {
+				t.Errorf("tenant = %q, want %q", issued.Tenant, tt.wantTenant)
+			}
+			if !strings.HasPrefix(issued.Key, APIKeyPrefix) || !strings.HasPrefix(issued.Key, issued.Prefix) {
+				t.Errorf("key %q does not start with %q and its prefix %q", issued.Key, APIKeyPrefix, issued.Prefix)
+			}
+			if repo.HasHash(issued.Key) {
+				t.Error("the key itself was stored instead of its hash")
+			}
+			if stored, _ := repo.GetKey(issued.ID); stored.Key != "" {
+				t.Error("the key was stored with the record")
+			}
+			if issued.CreatedBy != "admin" {
+				t.Errorf("created by %q, want admin", issued.CreatedBy)
+			}
+		})
+	}
+}
+
+func TestAPIKeyAuthenticate(t *testing.T) {
+	service, repo := newTestAPIKeyService()
+	issue := func() *models.APIKey {
+		issued, err := service.Issue(&models.APIKey{Name: "uploader", Scope: "ingest"}, "admin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return issued
+	}
+
+	active := issue()
+	revoked := issue()
+	if _, err := service.Revoke(revoked.ID, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	expired := issue()
+	gone := time.Now().Add(-time.Second)
+	repo.Expire(expired.ID, gone)
+	rotated := issue()
+	replacement, err := service.Rotate(rotated.ID, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	retired := issue()
+	if _, err := service.Rotate(retired.ID, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	repo.Expire(retired.ID, gone)
+
+	tests := []struct {
+		name   string
+		secret string
+		wantID int64
+	}{
+		{name: "active key", secret: active.Key, wantID: active.ID},
+		{name: "surrounding space", secret: " " + active.Key + "\n", wantID: active.ID},
+		{name: "rotated key within its grace period", secret: rotated.Key, wantID: rotated.ID},
+		{name: "replacement of a rotated key", secret: replacement.Key, wantID: replacement.ID},
+		{name: "rotated key after its grace period", secret: retired.Key},
+		{name: "revoked key", secret: revoked.Key},
+		{name: "expired key", secret: expired.Key},
+		{name: "unknown key", secret: APIKeyPrefix + strings.Repeat("0", 48)},
+		{name: "not a key", secret: "Bearer " + active.Key},
+		{name: "empty", secret: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := service.Authenticate(tt.secret)
+			if tt.wantID == 0 {
+				if !errors.Is(err, ErrAPIKeyRejected) {
+					t.Fatalf("error = %v, want ErrAPIKeyRejected", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key.ID != tt.wantID {
+				t.Errorf("authenticated key %d, want %d", key.ID, tt.wantID)
+			}
+			if stored, _ := repo.GetKey(key.ID); stored.LastUsedAt == nil {
+				t.Error("the use of the key was not recorded")
+			}
+		})
+	}
+}
+
+func TestAPIKeyRotate(t *testing.T) {
+	soon := time.Now().Add(10 * time.Minute)
+	later := time.Now().Add(48 * time.Hour)
+
+	tests := []struct {
+		name      string
+		expiresAt *time.Time
+		// how long the old key may keep working at most
+		wantGrace time.Duration
+	}{
+		{name: "never expiring key gets the grace period", wantGrace: time.Hour},
+		{name: "key expiring after the grace period", expiresAt: &later, wantGrace: time.Hour},
+		{name: "key expiring within the grace period keeps its expiry", expiresAt: &soon, wantGrace: 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, repo := newTestAPIKeyService()
+			old, err := service.Issue(&models.APIKey{Name: "uploader", Scope: "full", Tenant: "globex", ExpiresAt: tt.expiresAt}, "admin")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rotated, err := service.Rotate(old.ID, "ops")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rotated.Key == old.Key || rotated.Tenant != "globex" || rotated.Scope != "full" || rotated.CreatedBy != "ops" {
+				t.Errorf("replacement %+v does not carry over the old key", rotated)
+			}
+			stored, err := repo.GetKey(old.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.ReplacedBy == nil || *stored.ReplacedBy != rotated.ID {
+				t.Errorf("old key replaced by %v, want %d", stored.ReplacedBy, rotated.ID)
+			}
+			if grace := time.Until(*stored.ExpiresAt); grace > tt.wantGrace || grace < tt.wantGrace-time.Minute {
+				t.Errorf("old key expires in %v, want about %v", grace, tt.wantGrace)
+			}
+
+			if _, err := service.Rotate(old.ID, "ops"); !errors.Is(err, ErrAPIKeyInactive) {
+				t.Errorf("rotating a rotated key: error = %v, want ErrAPIKeyInactive", err)
+			}
+			if _, err := service.Revoke(rotated.ID, "ops"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := service.Rotate(rotated.ID, "ops"); !errors.Is(err, ErrAPIKeyInactive) {
+				t.Errorf("rotating a revoked key: error = %v, want ErrAPIKeyInactive", err)
+			}
+		})
+	}
+}
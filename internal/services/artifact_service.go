@@ -0,0 +1,109 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+)
+
+// ArtifactService signs the report files handed out and verifies files
+// against them. Every file is registered by the SHA-256 of its content with
+// an HMAC over the registration, so a recipient can prove a report was not
+// altered after it was issued, and an edited registration shows too.
+type ArtifactService struct {
+	artifactRepo repositories.ArtifactRepository
+	// tenant the artifacts are issued to, part of what is signed
+	tenant string
+	key    []byte
+}
+
+func NewArtifactService(artifactRepo repositories.ArtifactRepository, tenant, signingKey string) *ArtifactService {
+	return &ArtifactService{
+		artifactRepo: artifactRepo,
+		tenant:       tenant,
+		key:          []byte(signingKey),
+	}
+}
+
+// Sign registers content as an artifact of kind for reference. Signing the
+// same content again returns the first registration.
+func (s *ArtifactService) Sign(kind, reference, format, filename string, content []byte) (*models.ReportArtifact, error) {
+	sum := sha256.Sum256(content)
+	return s.SignHash(kind, reference, format, filename, hex.EncodeToString(sum[:]), int64(len(content)))
+}
+
+// SignHash registers an artifact by the hash and size of its content, for
+// files hashed as they were written
+func (s *ArtifactService) SignHash(kind, reference, format, filename, sha256Hex string, size int64) (*models.ReportArtifact, error) {
+	artifact := &models.ReportArtifact{
+		Tenant:    s.tenant,
+		Kind:      kind,
+		Reference: reference,
+		Format:    format,
+		Filename:  filename,
+		SHA256:    sha256Hex,
+		SizeBytes: size,
+	}
+	artifact.Signature = s.signature(artifact)
+	if err := s.artifactRepo.RegisterArtifact(artifact); err != nil {
+		return nil, fmt.Errorf("failed to register artifact: %v", err)
+	}
+	return artifact, nil
+}
+
+func (s *ArtifactService) GetArtifact(id int64) (*models.ReportArtifact, error) {
+	return s.artifactRepo.GetArtifact(id)
+}
+
+// Verify hashes a file and checks it against the artifacts registered with
+// the same content
+func (s *ArtifactService) Verify(file io.Reader) (*models.ArtifactVerification, error) {
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %v", err)
+	}
+	verification := &models.ArtifactVerification{
+		SHA256:    hex.EncodeToString(hash.Sum(nil)),
+		SizeBytes: size,
+	}
+
+	artifacts, err := s.artifactRepo.FindArtifactsBySHA256(verification.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up artifacts: %v", err)
+	}
+	verification.Artifacts = make([]*models.ReportArtifact, 0, len(artifacts))
+	for _, artifact := range artifacts {
+		if artifact.SizeBytes != size || !s.Verified(artifact) {
+			continue
+		}
+		verification.Valid = true
+		verification.Artifacts = append(verification.Artifacts, artifact)
+	}
+
+	switch {
+	case len(artifacts) == 0:
+		verification.Reason = "no report with this content was issued"
+	case !verification.Valid:
+		verification.Reason = "the registration of this content does not match its signature"
+		verification.Artifacts = artifacts
+	}
+	return verification, nil
+}
+
+// Verified reports whether an artifact's signature holds
+func (s *ArtifactService) Verified(artifact *models.ReportArtifact) bool {
+	return hmac.Equal([]byte(artifact.Signature), []byte(s.signature(artifact)))
+}
+
+func (s *ArtifactService) signature(artifact *models.ReportArtifact) string {
+	mac := hmac.New(sha256.New, s.key)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n%s\n%s\n%d",
+		artifact.Tenant, artifact.Kind, artifact.Reference, artifact.Format, artifact.Filename, artifact.SHA256, artifact.SizeBytes)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/pagination"
+)
+
+// ErrInvalidAuditQuery wraps every rejection of an audit trail search
+var ErrInvalidAuditQuery = errors.New("invalid audit trail query")
+
+const (
+	defaultAuditTrailLimit = 100
+	maxAuditTrailLimit     = 1000
+	auditTrailCursor       = "audit"
+)
+
+// auditActions are the actions the audit trail records
+var auditActions = []string{
+	models.AuditActionCreated,
+	models.AuditActionMatched,
+	models.AuditActionUnmatched,
+	models.AuditActionDisputed,
+	models.AuditActionResolved,
+	models.AuditActionApproved,
+	models.AuditActionRejected,
+	models.AuditActionRepaired,
+}
+
+// ListAuditTrail searches the audit trail of the tenant's reconciliations
+// newest first, continuing below filter.BeforeID or from the cursor of a
+// previous page, and returns the cursor of the next page. A batch to search
+// in must exist.
+func (s *ReconciliationService) ListAuditTrail(ctx context.Context, filter models.AuditTrailFilter, cursor string) ([]*models.AuditTrailEntry, string, error) {
+	if _, err := time.Parse("2006-01-02", filter.From); filter.From != "" && err != nil {
+		return nil, "", fmt.Errorf("%w: from must be YYYY-MM-DD", ErrInvalidAuditQuery)
+	}
+	if _, err := time.Parse("2006-01-02", filter.To); filter.To != "" && err != nil {
+		return nil, "", fmt.Errorf("%w: to must be YYYY-MM-DD", ErrInvalidAuditQuery)
+	}
+	filter.Action = strings.ToLower(strings.TrimSpace(filter.Action))
+	if filter.Action != "" && !slices.Contains(auditActions, filter.Action) {
+		return nil, "", fmt.Errorf("%w: action must be one of %s", ErrInvalidAuditQuery, strings.Join(auditActions, ", "))
+	}
+	switch {
+	case filter.Limit == 0:
+		filter.Limit = defaultAuditTrailLimit
+	case filter.Limit < 0 || filter.Limit > maxAuditTrailLimit:
+		return nil, "", fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidAuditQuery, maxAuditTrailLimit)
+	}
+	if cursor != "" {
+		if filter.BeforeID != 0 {
+			return nil, "", fmt.Errorf("%w: before_id and cursor cannot be combined", ErrInvalidAuditQuery)
+		}
+		after, err := pagination.Decode(cursor, auditTrailCursor)
+		if err != nil {
+			return nil, "", err
+		}
+		_, filter.BeforeID = after.Key()
+	}
+	if filter.BatchID != "" {
+		if _, err := s.reconciliationRepo.GetReconciliationByBatchID(ctx, filter.BatchID); err != nil {
+			return nil, "", fmt.Errorf("failed to get reconciliation: %w", err)
+		}
+	}
+
+	limit := filter.Limit
+	filter.Limit++
+	entries, err := s.reconciliationRepo.ListAuditTrail(filter)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list audit trail: %v", err)
+	}
+	entries, next := pagination.Next(entries, limit, func(entry *models.AuditTrailEntry) pagination.Cursor {
+		return pagination.Cursor{List: auditTrailCursor, ID: entry.ID}
+	})
+	return entries, next, nil
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+)
+
+// Batch results are committed in a single transaction at the end of a run, so
+// every batch a manual change can reach is already closed. The change is
+// bracketed by batchSummaries before and recordBatchDeltas after, inside the
+// same transaction, so a delta is only kept together with the change itself.
+
+// batchSummaries reads the current summary of each batch
+func batchSummaries(repo repositories.ReconciliationRepository, tx *sql.Tx, batchIDs []string) (map[string]models.BatchSummary, error) {
+	summaries := make(map[string]models.BatchSummary, len(batchIDs))
+	for _, batchID := range batchIDs {
+		summary, err := repo.GetBatchSummary(tx, batchID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to summarize batch %s: %v", batchID, err)
+		}
+		summaries[batchID] = summary
+	}
+	return summaries, nil
+}
+
+// recordBatchDeltas stores a delta for every batch in before whose summary the
+// change moved. Batches the change left untouched get no delta.
+func recordBatchDeltas(repo repositories.ReconciliationRepository, tx *sql.Tx, before map[string]models.BatchSummary, action, userID string, changes interface{}) error {
+	details, err := json.Marshal(changes)
+	if err != nil {
+		return fmt.Errorf("failed to encode batch changes: %v", err)
+	}
+
+	batchIDs := make([]string, 0, len(before))
+	for batchID := range before {
+		batchIDs = append(batchIDs, batchID)
+	}
+	sort.Strings(batchIDs)
+
+	for _, batchID := range batchIDs {
+		summaryBefore := before[batchID]
+		summaryAfter, err := repo.GetBatchSummary(tx, batchID)
+		if err != nil {
+			return fmt.Errorf("failed to summarize batch %s: %v", batchID, err)
+		}
+		if summaryAfter == summaryBefore {
+			continue
+		}
+
+		delta := &models.BatchDelta{
+			BatchID:       batchID,
+			Action:        action,
+			UserID:        userID,
+			Changes:       details,
+			SummaryBefore: summaryBefore,
+			SummaryAfter:  summaryAfter,
+		}
+		if err := repo.CreateBatchDelta(tx, delta); err != nil {
+			return fmt.Errorf("failed to record delta for batch %s: %v", batchID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"reconciliation-service/internal/matching"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+)
+
+// BatchDetails is a batch's results rebuilt from what is stored now: its
+// reconciliations, their mappings and their audit trails. Unlike the
+// response of the run, it reflects unmatches, resolutions and corrections
+// made since, and it is available for as long as the batch is.
+type BatchDetails struct {
+	BatchID   string              `json:"reconciliation_id"`
+	Summary   models.BatchSummary `json:"summary"`
+	Matches   []*MatchDetail      `json:"matches"`
+	Unmatched []*UnmatchedDetail  `json:"unmatched"`
+	KPIs      []*models.BatchKPI  `json:"kpis,omitempty"`
+	// What the run matched and left unmatched on each account, as it ran
+	Accounts []*models.AccountOutcome `json:"accounts,omitempty"`
+}
+
+// MatchDetail is a reconciliation with mappings, reported with the fields of
+// a run's matches
+type MatchDetail struct {
+	ReconciliationID int64  `json:"reconciliation_id"`
+	Status           string `json:"status"`
+	Version          int    `json:"version"`
+	*matching.MatchesResult
+	Audit []*AuditEntry `json:"audit"`
+}
+
+// UnmatchedDetail is a reconciliation without mappings: an entry the run left
+// unmatched, or a match undone since. It is reported with the fields of a
+// run's unmatched items.
+type UnmatchedDetail struct {
+	ReconciliationID int64  `json:"reconciliation_id"`
+	Status           string `json:"status"`
+	Version          int    `json:"version"`
+	*matching.UnmatchResult
+	Audit []*AuditEntry `json:"audit"`
+}
+
+// AuditEntry is one entry of a reconciliation's audit trail
+type AuditEntry struct {
+	Action    string          `json:"action"`
+	Details   json.RawMessage `json:"details,omitempty"`
+	UserID    string          `json:"user_id,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// matchedAuditDetails is what a run records for each match
+type matchedAuditDetails struct {
+	MatchCriteria []string `json:"match_criteria"`
+}
+
+// mappingDetails is what a run records on the mappings of a match
+type mappingDetails struct {
+	Netting *matching.Netting `json:"netting,omitempty"`
+}
+
+// unmatchedAuditDetails is what a run records for each entry it left
+// unmatched, or, with Mappings, what an unmatch released
+type unmatchedAuditDetails struct {
+	BankTransactions  string   `json:"bank_transactions"`
+	AccountingEntries []string `json:"accounting_entries"`
+	Mappings          []struct {
+		BankTransactionID int64 `json:"bank_transaction_id"`
+		AccountingEntryID int64 `json:"accounting_entry_id"`
+	} `json:"mappings"`
+}
+
+// GetBatchDetails rebuilds a batch's matches and unmatched items, each with
+// its reconciliation and audit trail, from one consistent read
+func (s *ReconciliationService) GetBatchDetails(batchID string) (*BatchDetails, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	reconciliations, err := s.reconciliationRepo.GetBatchDetails(tx, batchID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get batch details: %v", err)
+	}
+	if len(reconciliations) == 0 {
+		return nil, fmt.Errorf("failed to get reconciliation: %w", repositories.ErrReconciliationNotFound)
+	}
+	summary, err := s.reconciliationRepo.GetBatchSummary(tx, batchID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize batch %s: %v", batchID, err)
+	}
+
+	details := &BatchDetails{
+		BatchID:   batchID,
+		Summary:   summary,
+		Matches:   []*MatchDetail{},
+		Unmatched: []*UnmatchedDetail{},
+	}
+	for _, rec := range reconciliations {
+		if len(rec.Mappings) > 0 {
+			details.Matches = append(details.Matches, &MatchDetail{
+				ReconciliationID: rec.ID,
+				Status:           rec.Status,
+				Version:          rec.Version,
+				MatchesResult:    matchFromMappings(rec),
+				Audit:            auditEntries(rec.Audit),
+			})
+			continue
+		}
+
+		unmatched, err := s.unmatchedFromAudit(rec)
+		if err != nil {
+			return nil, err
+		}
+		details.Unmatched = append(details.Unmatched, &UnmatchedDetail{
+			ReconciliationID: rec.ID,
+			Status:           rec.Status,
+			Version:          rec.Version,
+			UnmatchResult:    unmatched,
+			Audit:            auditEntries(rec.Audit),
+		})
+	}
+
+	if details.KPIs, err = s.reconciliationRepo.GetBatchKPIs(batchID); err != nil {
+		return nil, err
+	}
+	if details.Accounts, err = s.reconciliationRepo.GetAccountOutcomes(batchID); err != nil {
+		return nil, err
+	}
+	return details, nil
+}
+
+// matchFromMappings renders a reconciliation's mappings the way matchViews
+// renders a run's matches. The match criteria come from the run's audit
+// entry, the netting from the mappings.
+func matchFromMappings(rec *models.ReconciliationDetail) *matching.MatchesResult {
+	var transactionIDs, entryIDs []string
+	seenTransactions := make(map[int64]bool)
+	seenEntries := make(map[int64]bool)
+	for _, pair := range rec.Mappings {
+		if pair.BankTransactionID != 0 && !seenTransactions[pair.BankTransactionID] {
+			seenTransactions[pair.BankTransactionID] = true
+			transactionIDs = append(transactionIDs, pair.TransactionID)
+		}
+		if pair.AccountingEntryID != 0 && !seenEntries[pair.AccountingEntryID] {
+			seenEntries[pair.AccountingEntryID] = true
+			entryIDs = append(entryIDs, pair.EntryID)
+		}
+	}
+
+	match := &matching.MatchesResult{
+		Type:             rec.Mappings[0].MappingType,
+		Confidence:       rec.MatchConfidence,
+		AccountingEntry:  fmt.Sprintf("%v", entryIDs),
+		AmountDifference: rec.AmountDifference,
+	}
+	if match.Type == models.MappingManyToOne || match.Type == models.MappingReturn || match.Type == models.MappingReversal {
+		match.BankTransaction = fmt.Sprintf("%v", transactionIDs)
+	} else if len(transactionIDs) > 0 {
+		match.BankTransaction = transactionIDs[0]
+	}
+	if audit := latestAudit(rec.Audit, models.AuditActionMatched); audit != nil {
+		var recorded matchedAuditDetails
+		if err := json.Unmarshal(audit.Details, &recorded); err == nil {
+			match.MatchCriteria = recorded.MatchCriteria
+		}
+	}
+	if amount := rec.Mappings[0].Amount; amount != nil {
+		match.SettledAmount = *amount
+	}
+	if details := rec.Mappings[0].Details; len(details) > 0 {
+		var recorded mappingDetails
+		if err := json.Unmarshal(details, &recorded); err == nil {
+			match.Netting = recorded.Netting
+		}
+	}
+	return match
+}
+
+// unmatchedFromAudit recovers what a reconciliation without mappings left
+// unmatched from its latest unmatched audit entry. The records an unmatch
+// released are recorded by ID and looked up; one deleted since is left out.
+func (s *ReconciliationService) unmatchedFromAudit(rec *models.ReconciliationDetail) (*matching.UnmatchResult, error) {
+	unmatched := &matching.UnmatchResult{AccountingEntries: []string{}}
+	audit := latestAudit(rec.Audit, models.AuditActionUnmatched)
+	if audit == nil {
+		return unmatched, nil
+	}
+	var recorded unmatchedAuditDetails
+	if err := json.Unmarshal(audit.Details, &recorded); err != nil {
+		return unmatched, nil
+	}
+	if len(recorded.Mappings) == 0 {
+		unmatched.BankTransactions = recorded.BankTransactions
+		if recorded.AccountingEntries != nil {
+			unmatched.AccountingEntries = recorded.AccountingEntries
+		}
+		return unmatched, nil
+	}
+
+	var transactionIDs []string
+	seenTransactions := make(map[int64]bool)
+	seenEntries := make(map[int64]bool)
+	for _, mapping := range recorded.Mappings {
+		if mapping.BankTransactionID != 0 && !seenTransactions[mapping.BankTransactionID] {
+			seenTransactions[mapping.BankTransactionID] = true
+			transaction, err := s.bankRepo.GetBankTransactionByID(mapping.BankTransactionID)
+			if err != nil && !errors.Is(err, repositories.ErrBankTransactionNotFound) {
+				return nil, fmt.Errorf("failed to get bank transaction: %w", err)
+			}
+			if transaction != nil {
+				transactionIDs = append(transactionIDs, transaction.TransactionID)
+			}
+		}
+		if mapping.AccountingEntryID != 0 && !seenEntries[mapping.AccountingEntryID] {
+			seenEntries[mapping.AccountingEntryID] = true
+			entry, err := s.accountingRepo.GetAccountingEntryByID(mapping.AccountingEntryID)
+			if err != nil && !errors.Is(err, repositories.ErrAccountingEntryNotFound) {
+				return nil, fmt.Errorf("failed to get accounting entry: %w", err)
+			}
+			if entry != nil {
+				unmatched.AccountingEntries = append(unmatched.AccountingEntries, entry.EntryID)
+			}
+		}
+	}
+	switch len(transactionIDs) {
+	case 0:
+	case 1:
+		unmatched.BankTransactions = transactionIDs[0]
+	default:
+		unmatched.BankTransactions = fmt.Sprintf("%v", transactionIDs)
+	}
+	return unmatched, nil
+}
+
+func latestAudit(audit []*models.ReconciliationAudit, action string) *models.ReconciliationAudit {
+	for i := len(audit) - 1; i >= 0; i-- {
+		if audit[i].Action == action {
+			return audit[i]
+		}
+	}
+	return nil
+}
+
+func auditEntries(audit []*models.ReconciliationAudit) []*AuditEntry {
+	entries := make([]*AuditEntry, len(audit))
+	for i, a := range audit {
+		entries[i] = &AuditEntry{
+			Action:    a.Action,
+			Details:   a.Details,
+			UserID:    a.UserID,
+			CreatedAt: a.CreatedAt,
+		}
+	}
+	return entries
+}
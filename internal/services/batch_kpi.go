@@ -0,0 +1,131 @@
+package services
+
+import (
+	"log"
+
+	"reconciliation-service/internal/kpi"
+	"reconciliation-service/internal/matching"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/money"
+)
+
+// batchAmounts sums the gross amounts of records in the base currency, each
+// converted at the rate of its date. Records without a rate are left out.
+type batchAmounts struct {
+	config matching.Config
+}
+
+func (a batchAmounts) convert(amount money.Amount, currencyCode, date string) (money.Amount, bool) {
+	if currencyCode == "" {
+		currencyCode = a.config.BaseCurrency
+	}
+	return a.config.FXRates.Convert(amount.Abs(), currencyCode, a.config.BaseCurrency, dateOnly(date))
+}
+
+func (a batchAmounts) bank(transactions []*models.BankTransaction) float64 {
+	total := money.Amount(0)
+	for _, bt := range transactions {
+		if converted, ok := a.convert(bt.Amount, bt.Currency, bt.TransactionDate); ok {
+			total += converted
+		}
+	}
+	return total.Float64()
+}
+
+func (a batchAmounts) ledger(entries []*models.AccountingEntry) float64 {
+	total := money.Amount(0)
+	for _, ae := range entries {
+		if converted, ok := a.convert(ae.Amount, ae.Currency, ae.EntryDate); ok {
+			total += converted
+		}
+	}
+	return total.Float64()
+}
+
+// unconverted counts the records without a rate to the base currency
+func (a batchAmounts) unconverted(transactions []*models.BankTransaction, entries []*models.AccountingEntry) int {
+	count := 0
+	for _, bt := range transactions {
+		if _, ok := a.convert(bt.Amount, bt.Currency, bt.TransactionDate); !ok {
+			count++
+		}
+	}
+	for _, ae := range entries {
+		if _, ok := a.convert(ae.Amount, ae.Currency, ae.EntryDate); !ok {
+			count++
+		}
+	}
+	return count
+}
+
+// measureBatch computes the metrics of kpi.Metrics for a batch
+func measureBatch(config matching.Config, bankTransactions []*models.BankTransaction, accountingEntries []*models.AccountingEntry,
+	kept []*matching.MatchResult, unmatchedBank []*models.BankTransaction, fees []*feeMatch, returns, fulfilled, disputed int) map[string]float64 {
+	amounts := batchAmounts{config: config}
+
+	var matchedBank []*models.BankTransaction
+	var matchedEntries []*models.AccountingEntry
+	matchedEntryIDs := make(map[int64]bool)
+	difference := money.Amount(0)
+	for _, match := range kept {
+		matchedBank = append(matchedBank, match.AllBankTransactions()...)
+		for _, ae := range match.AccountingEntries {
+			if !matchedEntryIDs[ae.ID] {
+				matchedEntryIDs[ae.ID] = true
+				matchedEntries = append(matchedEntries, ae)
+			}
+		}
+		difference += match.AmountDifference.Abs()
+	}
+	var unmatchedEntries []*models.AccountingEntry
+	for _, ae := range accountingEntries {
+		if !matchedEntryIDs[ae.ID] {
+			unmatchedEntries = append(unmatchedEntries, ae)
+		}
+	}
+	feeTransactions := make([]*models.BankTransaction, len(fees))
+	for i, fee := range fees {
+		feeTransactions[i] = fee.bankTransaction
+	}
+
+	return map[string]float64{
+		"bank_transactions":         float64(len(bankTransactions)),
+		"accounting_entries":        float64(len(accountingEntries)),
+		"matched":                   float64(len(kept)),
+		"matched_bank_transactions": float64(len(matchedBank)),
+		"matched_entries":           float64(len(matchedEntries)),
+		"unmatched":                 float64(len(unmatchedBank)),
+		"unmatched_entries":         float64(len(unmatchedEntries)),
+		"fees":                      float64(len(fees)),
+		"returns":                   float64(returns),
+		"expected_paid":             float64(fulfilled),
+		"disputed":                  float64(disputed),
+		"amount_difference":         difference.Float64(),
+		"bank_amount":               amounts.bank(bankTransactions),
+		"matched_amount":            amounts.bank(matchedBank),
+		"unmatched_amount":          amounts.bank(unmatchedBank),
+		"fee_amount":                amounts.bank(feeTransactions),
+		"ledger_amount":             amounts.ledger(accountingEntries),
+		"matched_ledger_amount":     amounts.ledger(matchedEntries),
+		"unmatched_ledger_amount":   amounts.ledger(unmatchedEntries),
+		"unconverted":               float64(amounts.unconverted(bankTransactions, accountingEntries)),
+	}
+}
+
+// recordKPIs evaluates the KPIs configured for the tenant over a batch, adds
+// them to its summary and stores them for its details and reports. The
+// batch stands without them.
+func (s *ReconciliationService) recordKPIs(result *ReconciliationResult, tenant string) {
+	definitions := s.kpis.For(tenant)
+	if len(definitions) == 0 || result.metrics == nil {
+		return
+	}
+	kpis := kpi.Evaluate(definitions, result.metrics)
+	result.Summary["kpis"] = kpis
+	if result.DryRun {
+		return
+	}
+	if err := s.reconciliationRepo.SaveBatchKPIs(result.BatchID, tenant, kpis); err != nil {
+		log.Printf("failed to store KPIs of batch %s: %v", result.BatchID, err)
+	}
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"reconciliation-service/internal/matching"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+	"reconciliation-service/internal/spreadsheet"
+)
+
+// ErrInvalidReportFormat rejects a batch report format other than CSV or XLSX
+var ErrInvalidReportFormat = errors.New("format must be csv or xlsx")
+
+const (
+	ReportFormatCSV  = "csv"
+	ReportFormatXLSX = "xlsx"
+)
+
+// BatchReportColumns are the columns of a batch report, in order
+var BatchReportColumns = []string{
+	"section", "reconciliation_id", "status", "mapping_type", "match_confidence", "amount_difference",
+	"transaction_id", "account_number", "transaction_date", "bank_amount", "bank_currency",
+	"entry_id", "account_code", "entry_date", "accounting_amount", "entry_currency",
+}
+
+// ReportContentType is the media type of a batch report format
+func ReportContentType(format string) string {
+	if format == ReportFormatXLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv"
+}
+
+// BatchReportFilename names the file a batch report is downloaded as
+func BatchReportFilename(batchID, format string) string {
+	return fmt.Sprintf("reconciliation-%s.%s", batchID, format)
+}
+
+func validReportFormat(format string) error {
+	if format != ReportFormatCSV && format != ReportFormatXLSX {
+		return ErrInvalidReportFormat
+	}
+	return nil
+}
+
+// StreamBatchReport calls fn with every line of a batch's report: each
+// mapping of its reconciliations, then each accounting entry it left
+// unmatched. A batch with no reconciliations fails with
+// repositories.ErrReconciliationNotFound before fn is called.
+func (s *ReconciliationService) StreamBatchReport(ctx context.Context, batchID string, fn func(*models.BatchReportRow) error) error {
+	if _, err := s.reconciliationRepo.GetReconciliationByBatchID(ctx, batchID); err != nil {
+		return fmt.Errorf("failed to get reconciliation: %w", err)
+	}
+	if err := s.reconciliationRepo.StreamBatchMappings(batchID, fn); err != nil {
+		return fmt.Errorf("failed to get batch mappings: %w", err)
+	}
+
+	var afterID int64
+	for {
+		items, _, err := s.reconciliationRepo.GetResultItems(batchID, models.ResultKindUnmatched, afterID, 0, MaxResultPageSize)
+		if err != nil {
+			return fmt.Errorf("failed to get results: %w", err)
+		}
+		for _, item := range items {
+			afterID = item.ID
+			var unmatched matching.UnmatchResult
+			if err := json.Unmarshal(item.Payload, &unmatched); err != nil {
+				return fmt.Errorf("failed to decode unmatched item: %w", err)
+			}
+			for _, entryID := range unmatched.AccountingEntries {
+				row := &models.BatchReportRow{
+					Section: models.ResultKindUnmatched,
+					Status:  models.StatusUnmatched,
+					EntryID: entryID,
+				}
+				// An entry deleted since the run is still reported by its ID
+				entry, err := s.accountingRepo.GetAccountingEntryByEntryID(entryID)
+				if err != nil && !errors.Is(err, repositories.ErrAccountingEntryNotFound) {
+					return fmt.Errorf("failed to get accounting entry: %w", err)
+				}
+				if entry != nil {
+					row.AccountCode = entry.AccountCode
+					row.EntryDate = dateOnly(entry.EntryDate)
+					row.AccountingAmount = entry.Amount
+					row.EntryCurrency = entry.Currency
+				}
+				if err := fn(row); err != nil {
+					return err
+				}
+			}
+		}
+		if len(items) < MaxResultPageSize {
+			return nil
+		}
+	}
+}
+
+// CountBatchReportRows counts the lines a batch's report has
+func (s *ReconciliationService) CountBatchReportRows(batchID string) (int, error) {
+	return s.reconciliationRepo.CountBatchReportRows(batchID)
+}
+
+// WriteBatchReport writes a batch's report in the given format, headed by
+// labels. open is called for the destination once the batch is known to
+// exist, so an error returned before then means nothing was written.
+func (s *ReconciliationService) WriteBatchReport(ctx context.Context, batchID, format string, labels []string, open func() (io.Writer, error)) error {
+	if err := validReportFormat(format); err != nil {
+		return err
+	}
+
+	var writer reportRowWriter
+	start := func() error {
+		w, err := open()
+		if err != nil {
+			return err
+		}
+		if format == ReportFormatXLSX {
+			sheet, err := spreadsheet.NewWriter(w, "Reconciliation")
+			if err != nil {
+				return err
+			}
+			writer = sheet
+		} else {
+			writer = &csvRowWriter{writer: csv.NewWriter(w)}
+		}
+		header := make([]interface{}, len(labels))
+		for i, label := range labels {
+			header[i] = label
+		}
+		return writer.WriteRow(header)
+	}
+
+	err := s.StreamBatchReport(ctx, batchID, func(row *models.BatchReportRow) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if writer == nil {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		return writer.WriteRow(batchReportValues(row))
+	})
+	if err != nil {
+		return err
+	}
+	if writer == nil {
+		if err := start(); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// reportRowWriter writes the rows of a batch report in one file format
+type reportRowWriter interface {
+	WriteRow(values []interface{}) error
+	Close() error
+}
+
+type csvRowWriter struct {
+	writer *csv.Writer
+}
+
+func (c *csvRowWriter) WriteRow(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		switch v := value.(type) {
+		case nil:
+		case float64:
+			record[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			record[i] = fmt.Sprint(v)
+		}
+	}
+	return c.writer.Write(record)
+}
+
+func (c *csvRowWriter) Close() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+// batchReportValues lays a report row out in BatchReportColumns order. A
+// side that is missing, or no longer on file, has no date and its amount is
+// left empty.
+func batchReportValues(row *models.BatchReportRow) []interface{} {
+	values := []interface{}{
+		row.Section, nil, row.Status, row.MappingType, row.MatchConfidence, spreadsheet.Number(row.AmountDifference.String()),
+		row.TransactionID, row.AccountNumber, row.TransactionDate, nil, row.BankCurrency,
+		row.EntryID, row.AccountCode, row.EntryDate, nil, row.EntryCurrency,
+	}
+	if row.ReconciliationID != 0 {
+		values[1] = row.ReconciliationID
+	}
+	if row.TransactionDate != "" {
+		values[9] = spreadsheet.Number(row.BankAmount.String())
+	}
+	if row.EntryDate != "" {
+		values[14] = spreadsheet.Number(row.AccountingAmount.String())
+	}
+	return values
+}
@@ -0,0 +1,205 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"time"
+
+	"reconciliation-service/internal/matching"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/money"
+	"reconciliation-service/internal/repositories"
+)
+
+// Batch persistence writes in one canonical order so concurrent batches take
+// their locks in the same sequence instead of deadlocking on each other:
+// accounting entry locks by ID, then reconciliations, then mappings, then
+// audits, each table in ascending bank transaction / accounting entry order.
+
+const (
+	// maxBatchAttempts bounds how often a batch is retried after InnoDB
+	// chose it as a deadlock victim
+	maxBatchAttempts = 4
+	deadlockBackoff  = 50 * time.Millisecond
+)
+
+// batchTxOptions uses READ COMMITTED, which stops InnoDB taking gap locks on
+// the index ranges the batch reads and so removes most insert deadlocks. The
+// batch re-checks what it writes under explicit row locks, so it does not
+// need repeatable reads.
+var batchTxOptions = &sql.TxOptions{Isolation: sql.LevelReadCommitted}
+
+// withDeadlockRetry runs fn in a batch transaction and commits it, starting
+// over in a fresh transaction when MySQL reports a deadlock. fn must not
+// keep state from a failed attempt.
+func (s *ReconciliationService) withDeadlockRetry(batchID string, fn func(tx *sql.Tx) error) error {
+	var err error
+	for attempt := 1; attempt <= maxBatchAttempts; attempt++ {
+		err = s.runBatchTx(fn)
+		if err == nil || !repositories.IsDeadlock(err) {
+			return err
+		}
+		if attempt < maxBatchAttempts {
+			backoff := deadlockBackoff*time.Duration(1<<(attempt-1)) + time.Duration(rand.Int63n(int64(deadlockBackoff)))
+			log.Printf("batch %s deadlocked on attempt %d, retrying in %s", batchID, attempt, backoff)
+			time.Sleep(backoff)
+		}
+	}
+	return fmt.Errorf("batch %s still deadlocked after %d attempts: %w", batchID, maxBatchAttempts, err)
+}
+
+func (s *ReconciliationService) runBatchTx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(context.Background(), batchTxOptions)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// withRollback runs fn in a batch transaction and rolls it back, so a dry run
+// takes the same locks and sees the same conflicts as the batch it previews
+// without keeping anything. A deadlock fails the preview rather than retrying.
+func (s *ReconciliationService) withRollback(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(context.Background(), batchTxOptions)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	return fn(tx)
+}
+
+// sortMatches puts matches and the entries inside each into canonical order.
+// The engine already orders the bank side of many-to-one matches.
+func sortMatches(matches []*matching.MatchResult) {
+	for _, m := range matches {
+		sort.Slice(m.AccountingEntries, func(i, j int) bool {
+			return m.AccountingEntries[i].ID < m.AccountingEntries[j].ID
+		})
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.BankTransaction.ID != b.BankTransaction.ID {
+			return a.BankTransaction.ID < b.BankTransaction.ID
+		}
+		return firstEntryID(a) < firstEntryID(b)
+	})
+}
+
+func firstEntryID(m *matching.MatchResult) int64 {
+	if len(m.AccountingEntries) == 0 {
+		return 0
+	}
+	return m.AccountingEntries[0].ID
+}
+
+// persistMatches writes the matches, already in canonical order, one table at
+// a time, sequentially on the batch transaction. Mappings and audits go in
+// multi-row inserts, so a large batch costs a handful of statements per
+// table rather than one per row.
+func (s *ReconciliationService) persistMatches(tx *sql.Tx, batchID string, matches []*matching.MatchResult, policy *packPolicy, userID string) error {
+	reconciliations := make([]*models.Reconciliation, len(matches))
+	for i, m := range matches {
+		reconciliations[i] = &models.Reconciliation{
+			BatchID:          batchID,
+			Status:           s.matchStatus(policy, m),
+			MatchConfidence:  m.Confidence,
+			AmountDifference: m.AmountDifference,
+		}
+		if err := s.reconciliationRepo.CreateReconciliation(tx, reconciliations[i]); err != nil {
+			return fmt.Errorf("failed to create reconciliation batch: %w", err)
+		}
+	}
+
+	// One mapping row per bank transaction and accounting entry pair; only
+	// one side has more than one record. Each row of a netted match carries
+	// the netting, so it can be audited from any of them.
+	var mappings []*models.ReconciliationMapping
+	for i, m := range matches {
+		var details []byte
+		if m.Netting != nil {
+			details, _ = json.Marshal(mappingDetails{Netting: m.Netting})
+		}
+		var amount *money.Amount
+		if m.Type == models.MappingPartial {
+			amount = &m.SettledAmount
+		}
+		for _, bt := range m.AllBankTransactions() {
+			for _, ae := range m.AccountingEntries {
+				mappings = append(mappings, &models.ReconciliationMapping{
+					ReconciliationID:  reconciliations[i].ID,
+					BankTransactionID: sql.NullInt64{Int64: bt.ID, Valid: true},
+					AccountingEntryID: sql.NullInt64{Int64: ae.ID, Valid: true},
+					MappingType:       m.Type,
+					Amount:            amount,
+					Details:           details,
+				})
+			}
+		}
+	}
+	if err := s.reconciliationRepo.CreateMappings(tx, mappings); err != nil {
+		return fmt.Errorf("failed to create mappings: %w", err)
+	}
+	if err := s.updateOpenAmounts(tx, matches); err != nil {
+		return err
+	}
+
+	audits := make([]*models.ReconciliationAudit, len(matches))
+	for i, m := range matches {
+		details := map[string]interface{}{
+			"match_type":     m.Type,
+			"confidence":     m.Confidence,
+			"match_criteria": m.MatchCriteria,
+			"status":         reconciliations[i].Status,
+		}
+		if m.Type == models.MappingPartial {
+			details["settled_amount"] = m.SettledAmount
+		}
+		auditDetails, _ := json.Marshal(details)
+		audits[i] = &models.ReconciliationAudit{
+			ReconciliationID: reconciliations[i].ID,
+			Action:           models.AuditActionMatched,
+			Details:          auditDetails,
+			UserID:           userID,
+		}
+	}
+	if err := s.reconciliationRepo.CreateAuditEntries(tx, audits); err != nil {
+		return fmt.Errorf("failed to create audit entries: %w", err)
+	}
+	return nil
+}
+
+// updateOpenAmounts works out what is left open of the records of partial
+// matches, and of records partly settled before that a match took the rest of
+func (s *ReconciliationService) updateOpenAmounts(tx *sql.Tx, matches []*matching.MatchResult) error {
+	var bankIDs, entryIDs []int64
+	for _, m := range matches {
+		partial := m.Type == models.MappingPartial
+		for _, bt := range m.AllBankTransactions() {
+			if partial || bt.OpenAmount != nil {
+				bankIDs = append(bankIDs, bt.ID)
+			}
+		}
+		for _, ae := range m.AccountingEntries {
+			if partial || ae.OpenAmount != nil {
+				entryIDs = append(entryIDs, ae.ID)
+			}
+		}
+	}
+	if err := s.reconciliationRepo.UpdateOpenAmounts(tx, bankIDs, entryIDs); err != nil {
+		return fmt.Errorf("failed to update open amounts: %w", err)
+	}
+	return nil
+}
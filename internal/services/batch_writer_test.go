@@ -0,0 +1,311 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+
+	"reconciliation-service/internal/matching"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+)
+
+// recordingReconciliations records the writes of a batch. Any other method
+// of the repository panics.
+type recordingReconciliations struct {
+	repositories.ReconciliationRepository
+
+	mu       sync.Mutex
+	busy     bool
+	calls    []string
+	nextID   int64
+	mappings [][2]int64
+	audits   []int64
+}
+
+// enter fails the test's writes if two of them overlap, as they would on a
+// transaction shared between goroutines
+func (r *recordingReconciliations) enter(call string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.busy {
+		panic("concurrent write on the batch transaction")
+	}
+	r.busy = true
+	r.calls = append(r.calls, call)
+}
+
+func (r *recordingReconciliations) leave() {
+	r.mu.Lock()
+	r.busy = false
+	r.mu.Unlock()
+}
+
+func (r *recordingReconciliations) CreateReconciliation(tx *sql.Tx, reconciliation *models.Reconciliation) error {
+	r.enter("reconciliation")
+	defer r.leave()
+	r.nextID++
+	reconciliation.ID = r.nextID
+	return nil
+}
+
+func (r *recordingReconciliations) CreateMappings(tx *sql.Tx, mappings []*models.ReconciliationMapping) error {
+	r.enter("mappings")
+	defer r.leave()
+	for _, mapping := range mappings {
+		r.mappings = append(r.mappings, [2]int64{mapping.BankTransactionID.Int64, mapping.AccountingEntryID.Int64})
+	}
+	return nil
+}
+
+func (r *recordingReconciliations) UpdateOpenAmounts(tx *sql.Tx, bankIDs, entryIDs []int64) error {
+	r.enter("open amounts")
+	defer r.leave()
+	return nil
+}
+
+func (r *recordingReconciliations) CreateAuditEntries(tx *sql.Tx, audits []*models.ReconciliationAudit) error {
+	r.enter("audits")
+	defer r.leave()
+	for _, audit := range audits {
+		r.audits = append(r.audits, audit.ReconciliationID)
+	}
+	return nil
+}
+
+func oneToOne(bankID, entryID int64) *matching.MatchResult {
+	return &matching.MatchResult{
+		Type:              models.MappingOneToOne,
+		Confidence:        1,
+		BankTransaction:   &models.BankTransaction{ID: bankID},
+		AccountingEntries: []*models.AccountingEntry{{ID: entryID}},
+	}
+}
+
+// TestPersistMatchesInsertsEachTableOnce checks that a batch is written
+// sequentially, a table at a time, with every mapping and audit of the batch
+// handed to the repository in one call, whatever the size of the batch
+func TestPersistMatchesInsertsEachTableOnce(t *testing.T) {
+	large := make([]*matching.MatchResult, 2000)
+	for i := range large {
+		large[i] = oneToOne(int64(i+1), int64(i+1))
+	}
+
+	tests := []struct {
+		name         string
+		matches      []*matching.MatchResult
+		wantMappings [][2]int64
+	}{
+		{
+			name:         "one to one",
+			matches:      []*matching.MatchResult{oneToOne(1, 10), oneToOne(2, 20)},
+			wantMappings: [][2]int64{{1, 10}, {2, 20}},
+		},
+		{
+			name: "one to many",
+			matches: []*matching.MatchResult{{
+				Type:              models.MappingOneToMany,
+				Confidence:        1,
+				BankTransaction:   &models.BankTransaction{ID: 1},
+				AccountingEntries: []*models.AccountingEntry{{ID: 10}, {ID: 11}, {ID: 12}},
+			}},
+			wantMappings: [][2]int64{{1, 10}, {1, 11}, {1, 12}},
+		},
+		{
+			name: "many to one",
+			matches: []*matching.MatchResult{{
+				Type:              models.MappingManyToOne,
+				Confidence:        1,
+				BankTransaction:   &models.BankTransaction{ID: 1},
+				BankTransactions:  []*models.BankTransaction{{ID: 1}, {ID: 2}},
+				AccountingEntries: []*models.AccountingEntry{{ID: 10}},
+			}},
+			wantMappings: [][2]int64{{1, 10}, {2, 10}},
+		},
+		{
+			name:    "large batch",
+			matches: large,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &recordingReconciliations{}
+			s := &ReconciliationService{reconciliationRepo: repo}
+			if err := s.persistMatches(nil, "batch", tt.matches, nil, "alice"); err != nil {
+				t.Fatal(err)
+			}
+
+			var want []string
+			for range tt.matches {
+				want = append(want, "reconciliation")
+			}
+			want = append(want, "mappings", "open amounts", "audits")
+			if !reflect.DeepEqual(repo.calls, want) {
+				t.Errorf("writes = %s, want %s", summarizeCalls(repo.calls), summarizeCalls(want))
+			}
+			if tt.wantMappings != nil && !reflect.DeepEqual(repo.mappings, tt.wantMappings) {
+				t.Errorf("mappings = %v, want %v", repo.mappings, tt.wantMappings)
+			}
+			if len(repo.audits) != len(tt.matches) {
+				t.Errorf("%d audits, want one per match (%d)", len(repo.audits), len(tt.matches))
+			}
+			for i, id := range repo.audits {
+				if id != int64(i+1) {
+					t.Fatalf("audit %d is for reconciliation %d, want %d", i, id, i+1)
+				}
+			}
+		})
+	}
+}
+
+// summarizeCalls collapses runs of the same call, so a failure stays short
+func summarizeCalls(calls []string) string {
+	summary := ""
+	for i := 0; i < len(calls); {
+		j := i
+		for j < len(calls) && calls[j] == calls[i] {
+			j++
+		}
+		summary += fmt.Sprintf("[%s x%d]", calls[i], j-i)
+		i = j
+	}
+	return summary
+}
+
+func TestSortMatchesCanonicalOrder(t *testing.T) {
+	match := func(bankID int64, entryIDs ...int64) *matching.MatchResult {
+		m := &matching.MatchResult{BankTransaction: &models.BankTransaction{ID: bankID}}
+		for _, id := range entryIDs {
+			m.AccountingEntries = append(m.AccountingEntries, &models.AccountingEntry{ID: id})
+		}
+		return m
+	}
+
+	tests := []struct {
+		name    string
+		matches []*matching.MatchResult
+		want    [][]int64
+	}{
+		{
+			name:    "by bank transaction",
+			matches: []*matching.MatchResult{match(3, 30), match(1, 10), match(2, 20)},
+			want:    [][]int64{{1, 10}, {2, 20}, {3, 30}},
+		},
+		{
+			name:    "entries inside a match",
+			matches: []*matching.MatchResult{match(1, 12, 10, 11)},
+			want:    [][]int64{{1, 10, 11, 12}},
+		},
+		{
+			name:    "same bank transaction by first entry",
+			matches: []*matching.MatchResult{match(1, 20, 5), match(1, 7), match(1)},
+			want:    [][]int64{{1}, {1, 5, 20}, {1, 7}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sortMatches(tt.matches)
+			var got [][]int64
+			for _, m := range tt.matches {
+				ids := []int64{m.BankTransaction.ID}
+				for _, ae := range m.AccountingEntries {
+					ids = append(ids, ae.ID)
+				}
+				got = append(got, ids)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithDeadlockRetry(t *testing.T) {
+	deadlock := &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}
+	duplicate := &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}
+
+	tests := []struct {
+		name         string
+		failures     []error
+		wantAttempts int
+		wantCommits  int
+		wantErr      error
+	}{
+		{name: "commits at once", wantAttempts: 1, wantCommits: 1},
+		{name: "retries deadlocks", failures: []error{deadlock, deadlock}, wantAttempts: 3, wantCommits: 1},
+		{name: "gives up after the last attempt", failures: []error{deadlock, deadlock, deadlock, deadlock}, wantAttempts: maxBatchAttempts, wantErr: deadlock},
+		{name: "other errors are not retried", failures: []error{duplicate}, wantAttempts: 1, wantErr: duplicate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counts := &txCounts{}
+			s := &ReconciliationService{db: sql.OpenDB(txConnector{counts})}
+			defer s.db.Close()
+
+			attempts := 0
+			err := s.withDeadlockRetry("batch", func(tx *sql.Tx) error {
+				attempts++
+				if attempts <= len(tt.failures) {
+					return fmt.Errorf("failed to create mappings: %w", tt.failures[attempts-1])
+				}
+				return nil
+			})
+
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+			if counts.commits != tt.wantCommits || counts.begins != attempts || counts.rollbacks != attempts-tt.wantCommits {
+				t.Errorf("begins = %d, commits = %d, rollbacks = %d", counts.begins, counts.commits, counts.rollbacks)
+			}
+		})
+	}
+}
+
+// txCounts counts the transactions of a database that runs no statements
+type txCounts struct {
+	mu                         sync.Mutex
+	begins, commits, rollbacks int
+}
+
+func (c *txCounts) count(n *int) {
+	c.mu.Lock()
+	*n++
+	c.mu.Unlock()
+}
+
+type txConnector struct{ counts *txCounts }
+
+func (c txConnector) Connect(context.Context) (driver.Conn, error) { return txConn{c.counts}, nil }
+func (c txConnector) Driver() driver.Driver                        { return nil }
+
+type txConn struct{ counts *txCounts }
+
+func (c txConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("statements are not supported")
+}
+func (c txConn) Close() error { return nil }
+func (c txConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+func (c txConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	c.counts.count(&c.counts.begins)
+	return txTx{c.counts}, nil
+}
+
+type txTx struct{ counts *txCounts }
+
+func (t txTx) Commit() error   { t.counts.count(&t.counts.commits); return nil }
+func (t txTx) Rollback() error { t.counts.count(&t.counts.rollbacks); return nil }
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"reconciliation-service/internal/currency"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+)
+
+// ErrInvalidBudget wraps every rejection of budget input or variance queries
+var ErrInvalidBudget = errors.New("invalid budget")
+
+// MaxBudgetUpload caps the figures a single upload may carry
+const MaxBudgetUpload = 10000
+
+// BudgetService keeps the budget and forecast figures finance uploads per
+// bank account and month, and compares them with the cash that actually
+// moved on the accounts.
+type BudgetService struct {
+	budgetRepo repositories.BudgetRepository
+}
+
+func NewBudgetService(budgetRepo repositories.BudgetRepository) *BudgetService {
+	return &BudgetService{
+		budgetRepo: budgetRepo,
+	}
+}
+
+// SaveBudgets validates and stores an upload, replacing the figures of the
+// accounts, periods and kinds it names. Nothing is stored when any figure is
+// invalid.
+func (s *BudgetService) SaveBudgets(budgets []*models.Budget, userID string) (int, error) {
+	if len(budgets) == 0 {
+		return 0, fmt.Errorf("%w: budgets are required", ErrInvalidBudget)
+	}
+	if len(budgets) > MaxBudgetUpload {
+		return 0, fmt.Errorf("%w: at most %d budgets per upload", ErrInvalidBudget, MaxBudgetUpload)
+	}
+	for i, budget := range budgets {
+		if err := normalizeBudget(budget); err != nil {
+			return 0, fmt.Errorf("%w: budget %d: %v", ErrInvalidBudget, i+1, err)
+		}
+		budget.UpdatedBy = userID
+	}
+	if err := s.budgetRepo.SaveBudgets(budgets); err != nil {
+		return 0, fmt.Errorf("failed to store budgets: %v", err)
+	}
+	return len(budgets), nil
+}
+
+func normalizeBudget(budget *models.Budget) error {
+	budget.AccountNumber = strings.TrimSpace(budget.AccountNumber)
+	budget.Period = strings.TrimSpace(budget.Period)
+	budget.Kind = strings.ToLower(strings.TrimSpace(budget.Kind))
+	budget.Currency = strings.ToUpper(strings.TrimSpace(budget.Currency))
+	if budget.Kind == "" {
+		budget.Kind = models.BudgetKindBudget
+	}
+
+	switch {
+	case budget.AccountNumber == "":
+		return errors.New("account_number is required")
+	case len(budget.AccountNumber) > 50:
+		return errors.New("account_number must be at most 50 characters")
+	case budget.Kind != models.BudgetKindBudget && budget.Kind != models.BudgetKindForecast:
+		return fmt.Errorf("kind must be %s or %s", models.BudgetKindBudget, models.BudgetKindForecast)
+	case budget.Currency != "" && !currency.Supported(budget.Currency):
+		return fmt.Errorf("unsupported currency %q", budget.Currency)
+	}
+	if _, err := time.Parse(feePeriodLayout, budget.Period); err != nil {
+		return errors.New("period must be YYYY-MM")
+	}
+	return nil
+}
+
+// ListBudgets lists the uploaded figures, optionally of one period or kind
+func (s *BudgetService) ListBudgets(period, kind string) ([]*models.Budget, error) {
+	period, kind = strings.TrimSpace(period), strings.ToLower(strings.TrimSpace(kind))
+	if period != "" {
+		if _, err := time.Parse(feePeriodLayout, period); err != nil {
+			return nil, fmt.Errorf("%w: period must be YYYY-MM", ErrInvalidBudget)
+		}
+	}
+	return s.budgetRepo.ListBudgets(period, kind)
+}
+
+func (s *BudgetService) DeleteBudget(id int64) error {
+	return s.budgetRepo.DeleteBudget(id)
+}
+
+// Variances compares the budgets of a kind for a period (YYYY-MM), or of
+// one account, with the net movement of the bank transactions booked in it.
+// The variance is actual less budget, so an account that took in more or
+// paid out less than planned shows a positive variance.
+func (s *BudgetService) Variances(period, kind, accountNumber string) ([]*models.BudgetVariance, error) {
+	start, err := time.Parse(feePeriodLayout, period)
+	if err != nil {
+		return nil, fmt.Errorf("%w: period must be YYYY-MM", ErrInvalidBudget)
+	}
+	kind = strings.ToLower(strings.TrimSpace(kind))
+	if kind == "" {
+		kind = models.BudgetKindBudget
+	}
+	if kind != models.BudgetKindBudget && kind != models.BudgetKindForecast {
+		return nil, fmt.Errorf("%w: kind must be %s or %s", ErrInvalidBudget, models.BudgetKindBudget, models.BudgetKindForecast)
+	}
+	end := start.AddDate(0, 1, -1)
+
+	variances, err := s.budgetRepo.GetVariances(period, kind, strings.TrimSpace(accountNumber), start.Format("2006-01-02"), end.Format("2006-01-02"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute budget variances: %v", err)
+	}
+	for _, variance := range variances {
+		variance.Variance = variance.Actual - variance.Budget
+		if variance.Budget != 0 {
+			percent := math.Round(float64(variance.Variance)/float64(variance.Budget.Abs())*10000) / 100
+			variance.VariancePercent = &percent
+		}
+	}
+	return variances, nil
+}
+
+// ClosedPeriodVariances returns the budget variances of the months that
+// ended between two dates
+func (s *BudgetService) ClosedPeriodVariances(fromDate, toDate string) ([]*models.BudgetVariance, error) {
+	from, err := time.Parse("2006-01-02", fromDate)
+	if err != nil {
+		return nil, err
+	}
+	to, err := time.Parse("2006-01-02", toDate)
+	if err != nil {
+		return nil, err
+	}
+
+	variances := []*models.BudgetVariance{}
+	for month := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC); !month.After(to); month = month.AddDate(0, 1, 0) {
+		end := month.AddDate(0, 1, -1)
+		if end.Before(from) || end.After(to) {
+			continue
+		}
+		monthly, err := s.Variances(month.Format(feePeriodLayout), models.BudgetKindBudget, "")
+		if err != nil {
+			return nil, err
+		}
+		variances = append(variances, monthly...)
+	}
+	return variances, nil
+}
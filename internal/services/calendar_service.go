@@ -0,0 +1,204 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"reconciliation-service/internal/calendar"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+)
+
+// ErrInvalidCalendar wraps every rejection of calendar or holiday input
+var ErrInvalidCalendar = errors.New("invalid calendar")
+
+var (
+	calendarCodePattern = regexp.MustCompile(`^[A-Z0-9][A-Z0-9_-]{0,49}$`)
+	countryPattern      = regexp.MustCompile(`^[A-Z]{2}$`)
+)
+
+type CalendarService struct {
+	calendarRepo repositories.CalendarRepository
+}
+
+func NewCalendarService(calendarRepo repositories.CalendarRepository) *CalendarService {
+	return &CalendarService{
+		calendarRepo: calendarRepo,
+	}
+}
+
+func (s *CalendarService) CreateCalendar(cal *models.BusinessCalendar) error {
+	if err := normalizeCalendar(cal); err != nil {
+		return err
+	}
+	if err := normalizeHolidays(cal.Holidays, 0); err != nil {
+		return err
+	}
+	if err := s.calendarRepo.CreateCalendar(cal); err != nil {
+		return fmt.Errorf("failed to store calendar: %v", err)
+	}
+	for _, holiday := range cal.Holidays {
+		if err := s.calendarRepo.AddHoliday(cal.ID, holiday); err != nil {
+			return fmt.Errorf("failed to store holiday %s: %v", holiday.Date, err)
+		}
+	}
+	return nil
+}
+
+func (s *CalendarService) GetCalendar(code string) (*models.BusinessCalendar, error) {
+	return s.calendarRepo.GetCalendar(strings.ToUpper(code))
+}
+
+func (s *CalendarService) ListCalendars() ([]*models.BusinessCalendar, error) {
+	return s.calendarRepo.ListCalendars()
+}
+
+// UpdateCalendar changes the country, name and weekend of a calendar. Holidays
+// are managed through their own endpoints.
+func (s *CalendarService) UpdateCalendar(cal *models.BusinessCalendar) (*models.BusinessCalendar, error) {
+	if err := normalizeCalendar(cal); err != nil {
+		return nil, err
+	}
+	existing, err := s.calendarRepo.GetCalendar(cal.Code)
+	if err != nil {
+		return nil, err
+	}
+	cal.ID = existing.ID
+	if err := s.calendarRepo.UpdateCalendar(cal); err != nil {
+		return nil, fmt.Errorf("failed to update calendar: %v", err)
+	}
+	return s.calendarRepo.GetCalendar(cal.Code)
+}
+
+func (s *CalendarService) DeleteCalendar(code string) error {
+	return s.calendarRepo.DeleteCalendar(strings.ToUpper(code))
+}
+
+func (s *CalendarService) AddHoliday(code string, holiday models.CalendarHoliday) error {
+	cal, err := s.calendarRepo.GetCalendar(strings.ToUpper(code))
+	if err != nil {
+		return err
+	}
+	holidays := []models.CalendarHoliday{holiday}
+	if err := normalizeHolidays(holidays, 0); err != nil {
+		return err
+	}
+	return s.calendarRepo.AddHoliday(cal.ID, holidays[0])
+}
+
+func (s *CalendarService) DeleteHoliday(code, date string) error {
+	cal, err := s.calendarRepo.GetCalendar(strings.ToUpper(code))
+	if err != nil {
+		return err
+	}
+	return s.calendarRepo.DeleteHoliday(cal.ID, date)
+}
+
+// ImportHolidays replaces the holidays of one year with a published list.
+// Every date must fall in that year.
+func (s *CalendarService) ImportHolidays(code string, year int, holidays []models.CalendarHoliday) (*models.BusinessCalendar, error) {
+	if year < 1900 || year > 9999 {
+		return nil, fmt.Errorf("%w: invalid year %d", ErrInvalidCalendar, year)
+	}
+	cal, err := s.calendarRepo.GetCalendar(strings.ToUpper(code))
+	if err != nil {
+		return nil, err
+	}
+	if err := normalizeHolidays(holidays, year); err != nil {
+		return nil, err
+	}
+	if err := s.calendarRepo.ReplaceYearHolidays(cal.ID, year, holidays); err != nil {
+		return nil, fmt.Errorf("failed to import holidays: %v", err)
+	}
+	return s.calendarRepo.GetCalendar(cal.Code)
+}
+
+// Calendar loads a calendar for business-day arithmetic
+func (s *CalendarService) Calendar(code string) (*calendar.Calendar, error) {
+	cal, err := s.calendarRepo.GetCalendar(strings.ToUpper(code))
+	if err != nil {
+		return nil, err
+	}
+	weekend := make([]time.Weekday, len(cal.WeekendDays))
+	for i, day := range cal.WeekendDays {
+		weekend[i] = time.Weekday(day)
+	}
+	holidays := make([]string, len(cal.Holidays))
+	for i, holiday := range cal.Holidays {
+		holidays[i] = holiday.Date
+	}
+	return calendar.New(weekend, holidays), nil
+}
+
+// BusinessDaysBetween counts business days between two YYYY-MM-DD dates, as
+// used for SLA ageing
+func (s *CalendarService) BusinessDaysBetween(code, fromDate, toDate string) (int, error) {
+	from, err := time.Parse("2006-01-02", fromDate)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid from_date %q", ErrInvalidCalendar, fromDate)
+	}
+	to, err := time.Parse("2006-01-02", toDate)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid to_date %q", ErrInvalidCalendar, toDate)
+	}
+	cal, err := s.Calendar(code)
+	if err != nil {
+		return 0, err
+	}
+	return cal.BusinessDaysBetween(from, to), nil
+}
+
+func normalizeCalendar(cal *models.BusinessCalendar) error {
+	cal.Code = strings.ToUpper(strings.TrimSpace(cal.Code))
+	cal.Country = strings.ToUpper(strings.TrimSpace(cal.Country))
+	if !calendarCodePattern.MatchString(cal.Code) {
+		return fmt.Errorf("%w: code must be 1-50 letters, digits, '-' or '_'", ErrInvalidCalendar)
+	}
+	if !countryPattern.MatchString(cal.Country) {
+		return fmt.Errorf("%w: country must be an ISO 3166 alpha-2 code", ErrInvalidCalendar)
+	}
+	if cal.WeekendDays == nil {
+		for _, day := range calendar.DefaultWeekend {
+			cal.WeekendDays = append(cal.WeekendDays, int(day))
+		}
+	}
+	seen := make(map[int]bool)
+	for _, day := range cal.WeekendDays {
+		if day < 0 || day > 6 {
+			return fmt.Errorf("%w: weekend days must be 0 (Sunday) to 6 (Saturday)", ErrInvalidCalendar)
+		}
+		if seen[day] {
+			return fmt.Errorf("%w: duplicate weekend day %d", ErrInvalidCalendar, day)
+		}
+		seen[day] = true
+	}
+	if len(cal.WeekendDays) == 7 {
+		return fmt.Errorf("%w: a calendar needs at least one working weekday", ErrInvalidCalendar)
+	}
+	return nil
+}
+
+// normalizeHolidays validates dates and, when year is non-zero, that every
+// date falls in it
+func normalizeHolidays(holidays []models.CalendarHoliday, year int) error {
+	seen := make(map[string]bool)
+	for i := range holidays {
+		date, err := time.Parse("2006-01-02", strings.TrimSpace(holidays[i].Date))
+		if err != nil {
+			return fmt.Errorf("%w: invalid holiday date %q. Use YYYY-MM-DD", ErrInvalidCalendar, holidays[i].Date)
+		}
+		if year != 0 && date.Year() != year {
+			return fmt.Errorf("%w: holiday %s is outside %d", ErrInvalidCalendar, holidays[i].Date, year)
+		}
+		holidays[i].Date = date.Format("2006-01-02")
+		holidays[i].Name = strings.TrimSpace(holidays[i].Name)
+		if seen[holidays[i].Date] {
+			return fmt.Errorf("%w: duplicate holiday %s", ErrInvalidCalendar, holidays[i].Date)
+		}
+		seen[holidays[i].Date] = true
+	}
+	return nil
+}
@@ -0,0 +1,352 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"reconciliation-service/internal/matching"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+)
+
+// ConfigBundleFormat is the version of the bundle layout; imports reject any
+// other
+const ConfigBundleFormat = 1
+
+// ErrInvalidConfigBundle rejects a bundle that cannot be imported at all
+var ErrInvalidConfigBundle = errors.New("invalid configuration bundle")
+
+// ConfigBundle is the complete configuration of an installation, keyed by
+// natural keys (codes, aliases, versions, user IDs) so it can be imported
+// into a database with different row IDs
+type ConfigBundle struct {
+	Format                  int                               `json:"format"`
+	ExportedAt              time.Time                         `json:"exported_at"`
+	Rules                   matching.Rules                    `json:"rules"`
+	Calendars               []*models.BusinessCalendar        `json:"calendars"`
+	Counterparties          []*models.Counterparty            `json:"counterparties"`
+	Aliases                 []*models.NameAlias               `json:"aliases"`
+	ShadowCandidates        []*models.ShadowCandidate         `json:"shadow_candidates"`
+	NotificationPreferences []*models.NotificationPreferences `json:"notification_preferences"`
+}
+
+// ConfigImportCounts counts what an import did with one section
+type ConfigImportCounts struct {
+	Created   int `json:"created"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	Failed    int `json:"failed"`
+}
+
+type ConfigImportResult struct {
+	Success  bool                           `json:"success"`
+	Sections map[string]*ConfigImportCounts `json:"sections"`
+
+	// The pending change proposed when the bundle's rules differ from the
+	// active ones; it still needs approval
+	RuleSetChange *models.RuleSetChange `json:"rule_set_change,omitempty"`
+
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Import sections, in import order
+const (
+	ConfigSectionRules                   = "rules"
+	ConfigSectionCalendars               = "calendars"
+	ConfigSectionCounterparties          = "counterparties"
+	ConfigSectionAliases                 = "aliases"
+	ConfigSectionShadowCandidates        = "shadow_candidates"
+	ConfigSectionNotificationPreferences = "notification_preferences"
+)
+
+type ConfigBundleService struct {
+	ruleSets       *RuleSetService
+	calendars      *CalendarService
+	counterparties *CounterpartyService
+	aliases        *AliasService
+	shadows        *ShadowService
+	notifications  *NotificationService
+}
+
+func NewConfigBundleService(
+	ruleSets *RuleSetService,
+	calendars *CalendarService,
+	counterparties *CounterpartyService,
+	aliases *AliasService,
+	shadows *ShadowService,
+	notifications *NotificationService,
+) *ConfigBundleService {
+	return &ConfigBundleService{
+		ruleSets:       ruleSets,
+		calendars:      calendars,
+		counterparties: counterparties,
+		aliases:        aliases,
+		shadows:        shadows,
+		notifications:  notifications,
+	}
+}
+
+func (s *ConfigBundleService) Export() (*ConfigBundle, error) {
+	rules, err := s.ruleSets.ActiveRules()
+	if err != nil {
+		return nil, err
+	}
+
+	calendars, err := s.calendars.ListCalendars()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list calendars: %v", err)
+	}
+	// The list leaves holidays out
+	for i, cal := range calendars {
+		if calendars[i], err = s.calendars.GetCalendar(cal.Code); err != nil {
+			return nil, fmt.Errorf("failed to load calendar %s: %v", cal.Code, err)
+		}
+	}
+
+	counterparties, err := s.counterparties.ListCounterparties()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list counterparties: %v", err)
+	}
+	aliases, err := s.aliases.ListAliases()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list aliases: %v", err)
+	}
+	candidates, err := s.shadows.ListCandidates()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list shadow candidates: %v", err)
+	}
+	preferences, err := s.notifications.ListPreferences()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notification preferences: %v", err)
+	}
+
+	return &ConfigBundle{
+		Format:                  ConfigBundleFormat,
+		ExportedAt:              time.Now().UTC(),
+		Rules:                   rules,
+		Calendars:               calendars,
+		Counterparties:          counterparties,
+		Aliases:                 aliases,
+		ShadowCandidates:        candidates,
+		NotificationPreferences: preferences,
+	}, nil
+}
+
+// Import applies a bundle section by section through the same validation as
+// the individual endpoints. Items are created or replaced by natural key and
+// nothing absent from the bundle is deleted, so importing the same bundle
+// again changes nothing. A failing item is reported and skipped. Rules are
+// never activated by an import: differing rules become a pending change by
+// userID that needs the usual approval.
+func (s *ConfigBundleService) Import(bundle *ConfigBundle, userID string) (*ConfigImportResult, error) {
+	if bundle.Format != ConfigBundleFormat {
+		return nil, fmt.Errorf("%w: format %d is not supported, expected %d", ErrInvalidConfigBundle, bundle.Format, ConfigBundleFormat)
+	}
+	userID = strings.TrimSpace(userID)
+	if userID == "" {
+		return nil, fmt.Errorf("%w: user_id is required", ErrInvalidConfigBundle)
+	}
+
+	result := &ConfigImportResult{Sections: make(map[string]*ConfigImportCounts)}
+	section := func(name string) *ConfigImportCounts {
+		counts := &ConfigImportCounts{}
+		result.Sections[name] = counts
+		return counts
+	}
+	fail := func(counts *ConfigImportCounts, format string, args ...interface{}) {
+		counts.Failed++
+		result.Errors = append(result.Errors, fmt.Sprintf(format, args...))
+	}
+
+	counts := section(ConfigSectionRules)
+	if change, changed, err := s.importRules(bundle.Rules, userID); err != nil {
+		fail(counts, "rules %s: %v", bundle.Rules.Version, err)
+	} else if changed {
+		counts.Created++
+		result.RuleSetChange = change
+	} else {
+		counts.Unchanged++
+	}
+
+	counts = section(ConfigSectionCalendars)
+	for _, cal := range bundle.Calendars {
+		created, err := s.importCalendar(cal)
+		switch {
+		case err != nil:
+			fail(counts, "calendar %s: %v", cal.Code, err)
+		case created:
+			counts.Created++
+		default:
+			counts.Updated++
+		}
+	}
+
+	counts = section(ConfigSectionCounterparties)
+	for _, cp := range bundle.Counterparties {
+		_, err := s.counterparties.GetCounterparty(cp.Code)
+		switch {
+		case errors.Is(err, repositories.ErrCounterpartyNotFound):
+			if err := s.counterparties.CreateCounterparty(cp); err != nil {
+				fail(counts, "counterparty %s: %v", cp.Code, err)
+				continue
+			}
+			counts.Created++
+		case err != nil:
+			fail(counts, "counterparty %s: %v", cp.Code, err)
+		default:
+			if _, err := s.counterparties.UpdateCounterparty(cp); err != nil {
+				fail(counts, "counterparty %s: %v", cp.Code, err)
+				continue
+			}
+			counts.Updated++
+		}
+	}
+
+	counts = section(ConfigSectionAliases)
+	if err := s.importAliases(bundle.Aliases, userID, counts, fail); err != nil {
+		return nil, err
+	}
+
+	counts = section(ConfigSectionShadowCandidates)
+	for _, candidate := range bundle.ShadowCandidates {
+		created, err := s.shadows.CreateCandidate(candidate.Version, candidate.Rules)
+		switch {
+		case errors.Is(err, repositories.ErrShadowCandidateConflict):
+			// Candidate rules are fixed per version, so an existing one is
+			// the same candidate; only its switch may differ
+			counts.Unchanged++
+		case err != nil:
+			fail(counts, "shadow candidate %s: %v", candidate.Version, err)
+			continue
+		default:
+			counts.Created++
+			candidate.Version = created.Version
+		}
+		if err := s.shadows.SetCandidateEnabled(candidate.Version, candidate.Enabled); err != nil {
+			fail(counts, "shadow candidate %s: %v", candidate.Version, err)
+		}
+	}
+
+	counts = section(ConfigSectionNotificationPreferences)
+	for _, prefs := range bundle.NotificationPreferences {
+		_, err := s.notifications.GetPreferences(prefs.UserID)
+		created := errors.Is(err, repositories.ErrPreferencesNotFound)
+		if err != nil && !created {
+			fail(counts, "notification preferences of %s: %v", prefs.UserID, err)
+			continue
+		}
+		if _, err := s.notifications.SavePreferences(prefs); err != nil {
+			fail(counts, "notification preferences of %s: %v", prefs.UserID, err)
+			continue
+		}
+		if created {
+			counts.Created++
+		} else {
+			counts.Updated++
+		}
+	}
+
+	result.Success = len(result.Errors) == 0
+	return result, nil
+}
+
+// importRules proposes the bundle's rules when they differ from the active
+// ones. Rules exported before any approved change carry the reserved baseline
+// version and are proposed under an import version instead.
+func (s *ConfigBundleService) importRules(rules matching.Rules, userID string) (*models.RuleSetChange, bool, error) {
+	active, err := s.ruleSets.ActiveRules()
+	if err != nil {
+		return nil, false, err
+	}
+	diff, err := rulesDiff(active, rules)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(diff) == 0 {
+		return nil, false, nil
+	}
+
+	version := rules.Version
+	if version == "" || s.ruleSets.isBaseline(version) {
+		version = "import-" + time.Now().UTC().Format("20060102-150405")
+	}
+	encoded, err := json.Marshal(rules)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to encode rules: %v", err)
+	}
+	change, err := s.ruleSets.ProposeChange(version, encoded, userID, "Imported from configuration bundle")
+	if err != nil {
+		return nil, false, err
+	}
+	return change, true, nil
+}
+
+// importCalendar creates or updates a calendar and replaces the holidays of
+// every year the bundle has holidays for
+func (s *ConfigBundleService) importCalendar(cal *models.BusinessCalendar) (bool, error) {
+	holidays := cal.Holidays
+	_, err := s.calendars.GetCalendar(cal.Code)
+	if errors.Is(err, repositories.ErrCalendarNotFound) {
+		return true, s.calendars.CreateCalendar(cal)
+	}
+	if err != nil {
+		return false, err
+	}
+	if _, err := s.calendars.UpdateCalendar(cal); err != nil {
+		return false, err
+	}
+
+	byYear := make(map[int][]models.CalendarHoliday)
+	for _, holiday := range holidays {
+		date, err := time.Parse("2006-01-02", holiday.Date)
+		if err != nil {
+			return false, fmt.Errorf("%w: invalid holiday date %q", ErrInvalidCalendar, holiday.Date)
+		}
+		byYear[date.Year()] = append(byYear[date.Year()], holiday)
+	}
+	for year, yearHolidays := range byYear {
+		if _, err := s.calendars.ImportHolidays(cal.Code, year, yearHolidays); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// importAliases adds the aliases the dictionary lacks. Record IDs of reviewed
+// matches belong to the exporting database, so imported aliases are manual.
+func (s *ConfigBundleService) importAliases(aliases []*models.NameAlias, userID string, counts *ConfigImportCounts, fail func(*ConfigImportCounts, string, ...interface{})) error {
+	existing, err := s.aliases.ListAliases()
+	if err != nil {
+		return fmt.Errorf("failed to list aliases: %v", err)
+	}
+	canonical := make(map[string]string, len(existing))
+	for _, alias := range existing {
+		canonical[alias.Alias] = alias.Canonical
+	}
+
+	for _, alias := range aliases {
+		if current, ok := canonical[alias.Alias]; ok {
+			if current != alias.Canonical {
+				fail(counts, "alias %s: already an alias of %q", alias.Alias, current)
+				continue
+			}
+			counts.Unchanged++
+			continue
+		}
+		imported := &models.NameAlias{
+			Alias:     alias.Alias,
+			Canonical: alias.Canonical,
+			UserID:    userID,
+		}
+		if err := s.aliases.CreateAlias(imported); err != nil {
+			fail(counts, "alias %s: %v", alias.Alias, err)
+			continue
+		}
+		canonical[imported.Alias] = imported.Canonical
+		counts.Created++
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"reconciliation-service/internal/models"
+)
+
+var (
+	// ErrInvalidCorrelationID rejects a lookup by an ID no record could carry
+	ErrInvalidCorrelationID = errors.New("invalid external correlation id")
+
+	// ErrCorrelationNotFound means no record carries the ID looked up
+	ErrCorrelationNotFound = errors.New("no record carries this external correlation id")
+)
+
+// LookupCorrelation finds the bank transactions and accounting entries
+// ingested with an upstream payment ID, and the reconciliations they are
+// mapped in
+func (s *ReconciliationService) LookupCorrelation(correlationID string) (*models.CorrelationLookup, error) {
+	correlationID = strings.TrimSpace(correlationID)
+	if correlationID == "" || len(correlationID) > maxCorrelationIDLength {
+		return nil, fmt.Errorf("%w: must be 1 to %d characters", ErrInvalidCorrelationID, maxCorrelationIDLength)
+	}
+
+	transactions, err := s.bankRepo.GetBankTransactionsByCorrelationID(correlationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bank transactions: %v", err)
+	}
+	entries, err := s.accountingRepo.GetAccountingEntriesByCorrelationID(correlationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get accounting entries: %v", err)
+	}
+	if len(transactions) == 0 && len(entries) == 0 {
+		return nil, ErrCorrelationNotFound
+	}
+
+	lookup := &models.CorrelationLookup{
+		ExternalCorrelationID: correlationID,
+		BankTransactions:      transactions,
+		AccountingEntries:     entries,
+	}
+	if lookup.BankTransactions == nil {
+		lookup.BankTransactions = []*models.BankTransaction{}
+	}
+	if lookup.AccountingEntries == nil {
+		lookup.AccountingEntries = []*models.AccountingEntry{}
+	}
+
+	bankIDs := make([]int64, len(transactions))
+	for i, bt := range transactions {
+		bankIDs[i] = bt.ID
+	}
+	entryIDs := make([]int64, len(entries))
+	for i, ae := range entries {
+		entryIDs[i] = ae.ID
+	}
+	if lookup.Mappings, err = s.reconciliationRepo.GetRecordMappings(bankIDs, entryIDs); err != nil {
+		return nil, fmt.Errorf("failed to get mappings: %v", err)
+	}
+	return lookup, nil
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"reconciliation-service/internal/banking"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+)
+
+// ErrInvalidCounterparty wraps every rejection of counterparty input
+var ErrInvalidCounterparty = errors.New("invalid counterparty")
+
+const (
+	maxCounterpartyLagDays = 365
+	maxAliasLength         = 255
+	maxAccountCodeLength   = 50
+)
+
+type CounterpartyService struct {
+	counterpartyRepo repositories.CounterpartyRepository
+}
+
+func NewCounterpartyService(counterpartyRepo repositories.CounterpartyRepository) *CounterpartyService {
+	return &CounterpartyService{
+		counterpartyRepo: counterpartyRepo,
+	}
+}
+
+func (s *CounterpartyService) CreateCounterparty(cp *models.Counterparty) error {
+	if err := normalizeCounterparty(cp); err != nil {
+		return err
+	}
+	if err := s.counterpartyRepo.CreateCounterparty(cp); err != nil {
+		if errors.Is(err, repositories.ErrCounterpartyConflict) {
+			return err
+		}
+		return fmt.Errorf("failed to store counterparty: %v", err)
+	}
+	return nil
+}
+
+func (s *CounterpartyService) GetCounterparty(code string) (*models.Counterparty, error) {
+	return s.counterpartyRepo.GetCounterparty(strings.ToUpper(code))
+}
+
+func (s *CounterpartyService) ListCounterparties() ([]*models.Counterparty, error) {
+	return s.counterpartyRepo.ListCounterparties()
+}
+
+// UpdateCounterparty replaces the name, lag, aliases, IBANs and default
+// accounts of a counterparty. Details learned from matched history are part
+// of what is replaced, so clients should send back what they read.
+func (s *CounterpartyService) UpdateCounterparty(cp *models.Counterparty) (*models.Counterparty, error) {
+	if err := normalizeCounterparty(cp); err != nil {
+		return nil, err
+	}
+	existing, err := s.counterpartyRepo.GetCounterparty(cp.Code)
+	if err != nil {
+		return nil, err
+	}
+	cp.ID = existing.ID
+	if err := s.counterpartyRepo.UpdateCounterparty(cp); err != nil {
+		if errors.Is(err, repositories.ErrCounterpartyConflict) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to update counterparty: %v", err)
+	}
+	return s.counterpartyRepo.GetCounterparty(cp.Code)
+}
+
+func (s *CounterpartyService) DeleteCounterparty(code string) error {
+	return s.counterpartyRepo.DeleteCounterparty(strings.ToUpper(code))
+}
+
+func normalizeCounterparty(cp *models.Counterparty) error {
+	cp.Code = strings.ToUpper(strings.TrimSpace(cp.Code))
+	if !calendarCodePattern.MatchString(cp.Code) {
+		return fmt.Errorf("%w: code must be 1-50 letters, digits, '_' or '-'", ErrInvalidCounterparty)
+	}
+	cp.Name = strings.TrimSpace(cp.Name)
+	if cp.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidCounterparty)
+	}
+	if cp.ExpectedLagDays < 0 || cp.ExpectedLagDays > maxCounterpartyLagDays {
+		return fmt.Errorf("%w: expected_lag_days must be between 0 and %d", ErrInvalidCounterparty, maxCounterpartyLagDays)
+	}
+
+	aliases := uniqueStrings(cp.Aliases, banking.NormalizeName)
+	for _, alias := range aliases {
+		if len(alias) > maxAliasLength {
+			return fmt.Errorf("%w: alias %q is longer than %d characters", ErrInvalidCounterparty, alias, maxAliasLength)
+		}
+	}
+	cp.Aliases = aliases
+
+	ibans := uniqueStrings(cp.IBANs, banking.NormalizeIBAN)
+	for _, iban := range ibans {
+		if err := banking.ValidateIBAN(iban); err != nil {
+			return fmt.Errorf("%w: iban %q: %v", ErrInvalidCounterparty, iban, err)
+		}
+	}
+	cp.IBANs = ibans
+
+	accounts := uniqueStrings(cp.DefaultAccounts, strings.TrimSpace)
+	for _, account := range accounts {
+		if len(account) > maxAccountCodeLength {
+			return fmt.Errorf("%w: account code %q is longer than %d characters", ErrInvalidCounterparty, account, maxAccountCodeLength)
+		}
+	}
+	cp.DefaultAccounts = accounts
+	return nil
+}
+
+// uniqueStrings normalizes values, dropping empty results and repeats
+func uniqueStrings(values []string, normalize func(string) string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := []string{}
+	for _, value := range values {
+		value = normalize(value)
+		if value == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		unique = append(unique, value)
+	}
+	return unique
+}
+
+// counterpartyIndex resolves the counterparty of an incoming record. It is
+// built once per ingestion request from the full master data. Names and
+// descriptions both go through the alias dictionary, so an alias in either
+// compares as its canonical name.
+type counterpartyIndex struct {
+	byCode     map[string]int64
+	byIBAN     map[string]int64
+	names      map[string]int64 // normalized names and aliases
+	dictionary *banking.AliasDictionary
+}
+
+func newCounterpartyIndex(counterparties []*models.Counterparty, dictionary *banking.AliasDictionary) *counterpartyIndex {
+	index := &counterpartyIndex{
+		byCode:     make(map[string]int64),
+		byIBAN:     make(map[string]int64),
+		names:      make(map[string]int64),
+		dictionary: dictionary,
+	}
+	for _, cp := range counterparties {
+		index.byCode[cp.Code] = cp.ID
+		for _, iban := range cp.IBANs {
+			index.byIBAN[iban] = cp.ID
+		}
+		if name := dictionary.Apply(cp.Name); name != "" {
+			index.addName(name, cp.ID)
+		}
+		for _, alias := range cp.Aliases {
+			index.addName(dictionary.Apply(alias), cp.ID)
+		}
+	}
+	return index
+}
+
+// addName records a name, marking it ambiguous with ID zero when two
+// counterparties share it
+func (ix *counterpartyIndex) addName(name string, id int64) {
+	if existing, ok := ix.names[name]; ok && existing != id {
+		id = 0
+	}
+	ix.names[name] = id
+}
+
+// link returns the counterparty ID for a record: the explicitly given code,
+// else the owner of the IBAN, else the counterparty whose longest name or
+// alias appears as whole words in the description. A tie between different
+// counterparties links none. Zero means no counterparty.
+func (ix *counterpartyIndex) link(code, iban, description string) (int64, error) {
+	if code = strings.ToUpper(strings.TrimSpace(code)); code != "" {
+		id, ok := ix.byCode[code]
+		if !ok {
+			return 0, fmt.Errorf("unknown counterparty %q", code)
+		}
+		return id, nil
+	}
+	if id, ok := ix.byIBAN[banking.NormalizeIBAN(iban)]; ok {
+		return id, nil
+	}
+
+	text := " " + ix.dictionary.Apply(description) + " "
+	if text == "  " {
+		return 0, nil
+	}
+	var best int64
+	bestLength := 0
+	for name, id := range ix.names {
+		if !strings.Contains(text, " "+name+" ") {
+			continue
+		}
+		switch {
+		case len(name) > bestLength:
+			best, bestLength = id, len(name)
+		case len(name) == bestLength && id != best:
+			best = 0
+		}
+	}
+	return best, nil
+}
@@ -1,18 +1,41 @@
 package services
 
 import (
+	"bytes"
 	"database/sql"
+	"encoding/csv"
+	"errors"
 	"fmt"
+	"io"
+	"strings"
 
+	"reconciliation-service/internal/banking"
+	"reconciliation-service/internal/currency"
+	"reconciliation-service/internal/ingestion/camt053"
+	"reconciliation-service/internal/ingestion/charset"
+	"reconciliation-service/internal/ingestion/detect"
+	"reconciliation-service/internal/ingestion/mt940"
 	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/money"
 	"reconciliation-service/internal/repositories"
 )
 
+// ErrInvalidStatement wraps every rejection of an uploaded statement file
+var ErrInvalidStatement = errors.New("invalid statement file")
+
+// ErrInvalidCorrection wraps every rejection of a correction to a stored record
+var ErrInvalidCorrection = errors.New("invalid correction")
+
 type DataIngestionService struct {
 	db                 *sql.DB
 	bankRepo           repositories.BankRepository
 	accountingRepo     repositories.AccountingRepository
 	reconciliationRepo repositories.ReconciliationRepository
+	counterpartyRepo   repositories.CounterpartyRepository
+	aliasRepo          repositories.AliasRepository
+	legalHoldRepo      repositories.LegalHoldRepository
+	baseCurrency       string
+	lanes              IngestionLanes
 }
 
 func NewDataIngestionService(
@@ -20,31 +43,65 @@ func NewDataIngestionService(
 	bankRepo repositories.BankRepository,
 	accountingRepo repositories.AccountingRepository,
 	reconciliationRepo repositories.ReconciliationRepository,
+	counterpartyRepo repositories.CounterpartyRepository,
+	aliasRepo repositories.AliasRepository,
+	legalHoldRepo repositories.LegalHoldRepository,
+	baseCurrency string,
+	lanes IngestionLanes,
 ) *DataIngestionService {
 	return &DataIngestionService{
 		db:                 db,
 		bankRepo:           bankRepo,
 		accountingRepo:     accountingRepo,
 		reconciliationRepo: reconciliationRepo,
+		counterpartyRepo:   counterpartyRepo,
+		aliasRepo:          aliasRepo,
+		legalHoldRepo:      legalHoldRepo,
+		baseCurrency:       strings.ToUpper(baseCurrency),
+		lanes:              lanes,
 	}
 }
 
 type BankTransactionInput struct {
-	TransactionID   string  `json:"transaction_id"`
-	AccountNumber   string  `json:"account_number"`
-	Amount          float64 `json:"amount"`
-	TransactionDate string  `json:"transaction_date"`
-	Description     string  `json:"description,omitempty"`
-	ReferenceNumber string  `json:"reference_number,omitempty"`
+	TransactionID    string       `json:"transaction_id"`
+	AccountNumber    string       `json:"account_number"`
+	Amount           money.Amount `json:"amount"`
+	Currency         string       `json:"currency,omitempty"`
+	TransactionDate  string       `json:"transaction_date"`
+	Description      string       `json:"description,omitempty"`
+	ReferenceNumber  string       `json:"reference_number,omitempty"`
+	CounterpartyIBAN string       `json:"counterparty_iban,omitempty"`
+	CounterpartyBIC  string       `json:"counterparty_bic,omitempty"`
+
+	// Code of the counterparty; when empty it is resolved from the IBAN
+	// and description
+	Counterparty string `json:"counterparty,omitempty"`
+
+	RemittanceInformation string `json:"remittance_information,omitempty"`
+	CreditorReference     string `json:"creditor_reference,omitempty"`
+	EndToEndID            string `json:"end_to_end_id,omitempty"`
+	ExternalCorrelationID string `json:"external_correlation_id,omitempty"`
+
+	// Set for a return or reversal of an earlier transaction
+	Reversal     bool   `json:"reversal,omitempty"`
+	ReturnReason string `json:"return_reason,omitempty"`
 }
 
 type AccountingEntryInput struct {
-	EntryID       string  `json:"entry_id"`
-	AccountCode   string  `json:"account_code"`
-	Amount        float64 `json:"amount"`
-	EntryDate     string  `json:"entry_date"`
-	Description   string  `json:"description,omitempty"`
-	InvoiceNumber string  `json:"invoice_number,omitempty"`
+	EntryID           string       `json:"entry_id"`
+	AccountCode       string       `json:"account_code"`
+	Amount            money.Amount `json:"amount"`
+	Currency          string       `json:"currency,omitempty"`
+	EntryDate         string       `json:"entry_date"`
+	Description       string       `json:"description,omitempty"`
+	InvoiceNumber     string       `json:"invoice_number,omitempty"`
+	EntryType         string       `json:"entry_type,omitempty"`
+	CounterpartyIBAN  string       `json:"counterparty_iban,omitempty"`
+	Counterparty      string       `json:"counterparty,omitempty"`
+	CreditorReference string       `json:"creditor_reference,omitempty"`
+	EndToEndID        string       `json:"end_to_end_id,omitempty"`
+
+	ExternalCorrelationID string `json:"external_correlation_id,omitempty"`
 }
 
 type IngestionResult struct {
@@ -52,20 +109,76 @@ type IngestionResult struct {
 	RecordsCount int                    `json:"records_count"`
 	Errors       []string               `json:"errors,omitempty"`
 	Details      map[string]interface{} `json:"details,omitempty"`
+
+	// Committed reports whether the records counted were stored. Unless the
+	// ingestion is a partial commit, one failed record rolls back them all,
+	// or on the bulk lane its chunk, after which no further chunk is ingested.
+	Committed bool `json:"committed"`
+	// IDs of the records this ingestion inserted or updated
+	StoredIDs []string `json:"stored_ids,omitempty"`
+	// Lane the records were ingested on, realtime or bulk
+	Lane string `json:"lane"`
+
+	// Encoding reports how an uploaded statement file was converted to UTF-8
+	Encoding *charset.Result `json:"encoding,omitempty"`
+}
+
+// IngestBankTransactions stores bank transactions keyed on their transaction
+// ID, so resending a statement is safe. A new ID is inserted; a known one is
+// skipped when nothing changed and updated in place otherwise. A transaction
+// that is already mapped is never rewritten by ingestion: changes to it are
+// skipped and reported, and must go through CorrectBankTransaction so the
+// batches it is mapped in get their deltas. Changes to a transaction under
+// legal hold are skipped and reported too. The closing balances of the
+// statements the transactions came from, if any, are stored with them.
+//
+// Every transaction is stored or none is. A partial commit instead stores the
+// valid transactions and reports the failed ones; the balances are then
+// stored only if none failed. On the bulk lane this holds per chunk, see
+// ingestChunks.
+func (s *DataIngestionService) IngestBankTransactions(lane string, transactions []BankTransactionInput, balances []*models.StatementBalance, partial bool) (*IngestionResult, error) {
+	if lane != IngestionLaneBulk {
+		result, err := s.ingestBankTransactions(s.lanes.Realtime, transactions, balances, partial)
+		if err != nil {
+			return nil, err
+		}
+		result.Lane = IngestionLaneRealtime
+		return result, nil
+	}
+	return s.ingestChunks(len(transactions), partial, func(from, to int, clean bool) (*IngestionResult, error) {
+		// The balances close the statement, so they go with its last chunk
+		var chunkBalances []*models.StatementBalance
+		last := to == len(transactions)
+		if last && clean {
+			chunkBalances = balances
+		}
+		result, err := s.ingestBankTransactions(s.lanes.Bulk, transactions[from:to], chunkBalances, partial)
+		if err == nil && last && !clean && len(balances) > 0 {
+			result.Details["balances_skipped"] = len(balances)
+		}
+		return result, err
+	})
 }
 
-func (s *DataIngestionService) IngestBankTransactions(transactions []BankTransactionInput) (*IngestionResult, error) {
+func (s *DataIngestionService) ingestBankTransactions(db *sql.DB, transactions []BankTransactionInput, balances []*models.StatementBalance, partial bool) (*IngestionResult, error) {
 	result := &IngestionResult{
 		Success: true,
 		Details: make(map[string]interface{}),
 	}
 
-	tx, err := s.db.Begin()
+	counterparties, err := s.counterpartyIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
 	if err != nil {
 		return nil, fmt.Errorf("failed to begin transaction: %v", err)
 	}
 	defer tx.Rollback()
 
+	var inserted, updated, skipped int
+	var reconciled, held, stored []string
 	for _, input := range transactions {
 		if err := validateBankTransaction(input); err != nil {
 			result.Errors = append(result.Errors, fmt.Sprintf("Invalid transaction %s: %v", input.TransactionID, err))
@@ -76,17 +189,86 @@ func (s *DataIngestionService) IngestBankTransactions(transactions []BankTransac
 			TransactionID:   input.TransactionID,
 			AccountNumber:   input.AccountNumber,
 			Amount:          input.Amount,
+			Currency:        s.recordCurrency(input.Currency, ""),
 			TransactionDate: input.TransactionDate,
 			Description:     input.Description,
 			ReferenceNumber: input.ReferenceNumber,
-		}
+			EndToEndID:      normalizeEndToEndID(input.EndToEndID),
+			Reversal:        input.Reversal,
+			ReturnReason:    strings.TrimSpace(input.ReturnReason),
 
-		err := s.bankRepo.InsertBankTransaction(tx, transaction)
+			ExternalCorrelationID: strings.TrimSpace(input.ExternalCorrelationID),
+		}
+		enrichCounterparty(transaction, input.CounterpartyIBAN, input.CounterpartyBIC)
+		parseRemittance(transaction, input.RemittanceInformation, input.CreditorReference)
+		transaction.CounterpartyID, err = counterparties.link(input.Counterparty, transaction.CounterpartyIBAN, transaction.Description)
 		if err != nil {
-			result.Errors = append(result.Errors, fmt.Sprintf("Failed to insert transaction %s: %v", input.TransactionID, err))
+			result.Errors = append(result.Errors, fmt.Sprintf("Invalid transaction %s: %v", input.TransactionID, err))
 			continue
 		}
 
+		existing, err := s.bankRepo.GetBankTransactionForUpdate(tx, input.TransactionID)
+		switch {
+		case errors.Is(err, repositories.ErrBankTransactionNotFound):
+			if err := s.bankRepo.InsertBankTransaction(tx, transaction); err != nil {
+				if repositories.IsDeadlock(err) {
+					return nil, errIngestionDeadlock(err)
+				}
+				result.Errors = append(result.Errors, fmt.Sprintf("Failed to insert transaction %s: %v", input.TransactionID, err))
+				continue
+			}
+			inserted++
+			stored = append(stored, input.TransactionID)
+		case repositories.IsDeadlock(err):
+			return nil, errIngestionDeadlock(err)
+		case err != nil:
+			result.Errors = append(result.Errors, fmt.Sprintf("Failed to look up transaction %s: %v", input.TransactionID, err))
+			continue
+		default:
+			if transaction.CounterpartyID == 0 {
+				transaction.CounterpartyID = existing.CounterpartyID
+			}
+			if existing.Currency == "" {
+				// Stored before currencies were tracked, so in the base currency
+				existing.Currency = s.baseCurrency
+			}
+			if sameBankTransaction(existing, transaction) {
+				skipped++
+				break
+			}
+			batchIDs, err := s.reconciliationRepo.GetBatchIDsForBankTransaction(tx, existing.ID)
+			if err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("Failed to get batches of transaction %s: %v", input.TransactionID, err))
+				continue
+			}
+			if len(batchIDs) > 0 {
+				skipped++
+				reconciled = append(reconciled, input.TransactionID)
+				break
+			}
+			err = checkLegalHold(s.legalHoldRepo, models.LegalHoldSubjects{BankTransactionIDs: []int64{existing.ID}})
+			if errors.Is(err, ErrLegalHold) {
+				skipped++
+				held = append(held, input.TransactionID)
+				break
+			}
+			if err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("Failed to check transaction %s: %v", input.TransactionID, err))
+				continue
+			}
+			transaction.ID = existing.ID
+			transaction.Version = existing.Version
+			if err := s.bankRepo.UpdateBankTransaction(tx, transaction); err != nil {
+				if repositories.IsDeadlock(err) {
+					return nil, errIngestionDeadlock(err)
+				}
+				result.Errors = append(result.Errors, fmt.Sprintf("Failed to update transaction %s: %v", input.TransactionID, err))
+				continue
+			}
+			updated++
+			stored = append(stored, input.TransactionID)
+		}
+
 		result.RecordsCount++
 	}
 
@@ -94,29 +276,409 @@ func (s *DataIngestionService) IngestBankTransactions(transactions []BankTransac
 	result.Details["total_records"] = len(transactions)
 	result.Details["successful"] = result.RecordsCount
 	result.Details["failed"] = len(result.Errors)
+	result.Details["inserted"] = inserted
+	result.Details["updated"] = updated
+	result.Details["skipped"] = skipped
+	if len(reconciled) > 0 {
+		result.Details["skipped_reconciled"] = reconciled
+	}
+	if len(held) > 0 {
+		result.Details["skipped_held"] = held
+	}
 
 	if result.Success {
-		err = tx.Commit()
-		if err != nil {
-			return nil, fmt.Errorf("failed to commit transaction: %v", err)
+		for _, balance := range balances {
+			if err := s.bankRepo.SaveStatementBalance(tx, balance); err != nil {
+				return nil, fmt.Errorf("failed to store the balance of account %s on %s: %v", balance.AccountNumber, balance.BalanceDate, err)
+			}
+		}
+		if len(balances) > 0 {
+			result.Details["balances"] = len(balances)
 		}
+	} else if partial && len(balances) > 0 {
+		result.Details["balances_skipped"] = len(balances)
 	}
 
+	if err := commitIngestion(tx, result, partial, stored); err != nil {
+		return nil, err
+	}
 	return result, nil
 }
 
-func (s *DataIngestionService) IngestAccountingEntries(entries []AccountingEntryInput) (*IngestionResult, error) {
+// commitIngestion commits an ingestion in which every record succeeded, or
+// any partial commit. Otherwise the records that succeeded are rolled back
+// with the rest and reported as such instead of as stored.
+func commitIngestion(tx *sql.Tx, result *IngestionResult, partial bool, stored []string) error {
+	if !result.Success && !partial {
+		result.Details["rolled_back"] = result.RecordsCount
+		result.Details["successful"] = 0
+		result.RecordsCount = 0
+		return nil
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	result.Committed = true
+	result.StoredIDs = stored
+	return nil
+}
+
+// errIngestionDeadlock fails an ingestion chosen as a deadlock victim. The
+// whole transaction is gone by then, so not even a partial commit can keep
+// the records before it.
+func errIngestionDeadlock(err error) error {
+	return fmt.Errorf("ingestion deadlocked and was rolled back, retry it: %w", err)
+}
+
+// sameBankTransaction reports whether an ingested transaction carries nothing
+// new over the stored one
+func sameBankTransaction(stored, ingested *models.BankTransaction) bool {
+	return stored.AccountNumber == ingested.AccountNumber &&
+		stored.Amount == ingested.Amount &&
+		stored.Currency == ingested.Currency &&
+		dateOnly(stored.TransactionDate) == dateOnly(ingested.TransactionDate) &&
+		stored.Description == ingested.Description &&
+		stored.ReferenceNumber == ingested.ReferenceNumber &&
+		stored.CounterpartyIBAN == ingested.CounterpartyIBAN &&
+		stored.CounterpartyBIC == ingested.CounterpartyBIC &&
+		stored.CounterpartyBankName == ingested.CounterpartyBankName &&
+		stored.CounterpartyBankCountry == ingested.CounterpartyBankCountry &&
+		stored.CounterpartyID == ingested.CounterpartyID &&
+		stored.RemittanceInformation == ingested.RemittanceInformation &&
+		stored.CreditorReference == ingested.CreditorReference &&
+		stored.EndToEndID == ingested.EndToEndID &&
+		stored.ExternalCorrelationID == ingested.ExternalCorrelationID &&
+		stored.Reversal == ingested.Reversal &&
+		stored.ReturnReason == ingested.ReturnReason
+}
+
+// dateOnly drops the time the driver appends to DATE columns
+func dateOnly(date string) string {
+	if len(date) > 10 {
+		return date[:10]
+	}
+	return date
+}
+
+// ParseMT940 converts an MT940 statement file into bank transaction inputs
+// and the closing balances of its statements. Entries without a bank
+// reference get an ID from the statement reference, statement number and
+// line position, so uploading the same file twice is skipped by transaction
+// ID instead of duplicating rows.
+func ParseMT940(r io.Reader) ([]BankTransactionInput, []*models.StatementBalance, error) {
+	statements, err := mt940.Parse(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidStatement, err)
+	}
+
+	var transactions []BankTransactionInput
+	var balances []*models.StatementBalance
+	for _, statement := range statements {
+		if statement.ClosingDate != "" {
+			balances = append(balances, &models.StatementBalance{
+				AccountNumber: statement.AccountID,
+				BalanceDate:   statement.ClosingDate,
+				Balance:       statement.ClosingBalance,
+				Currency:      statement.Currency,
+				Source:        detect.FormatMT940,
+			})
+		}
+		for i, entry := range statement.Transactions {
+			transactionID := entry.BankReference
+			if transactionID == "" || transactionID == "NONREF" {
+				transactionID = fmt.Sprintf("%s/%s/%d", statement.TransactionReference, statement.StatementNumber, i+1)
+			}
+
+			input := BankTransactionInput{
+				TransactionID:         transactionID,
+				AccountNumber:         statement.AccountID,
+				Amount:                entry.Amount,
+				Currency:              statement.Currency,
+				TransactionDate:       entry.ValueDate,
+				Description:           entry.CounterpartyName,
+				ReferenceNumber:       entry.CustomerReference,
+				RemittanceInformation: entry.Remittance,
+				Reversal:              entry.Reversal,
+				ReturnReason:          entry.ReturnReason,
+			}
+			if input.Description == "" {
+				input.Description = entry.SupplementaryDetails
+			}
+			if input.Description == "" {
+				input.Description = entry.Information
+			}
+			// Structured :86: fields carry local account numbers and bank codes
+			// as often as IBANs and BICs; keep only the valid ones
+			if banking.ValidateIBAN(entry.CounterpartyAccount) == nil {
+				input.CounterpartyIBAN = entry.CounterpartyAccount
+			}
+			if banking.ValidateBIC(entry.CounterpartyBankID) == nil {
+				input.CounterpartyBIC = entry.CounterpartyBankID
+			}
+			transactions = append(transactions, input)
+		}
+	}
+	return transactions, balances, nil
+}
+
+// ParseCAMT053 converts a camt.053 statement into bank transaction inputs
+// and the closing booked balances of its statements.
+// A batch booking with per-transaction amounts becomes one input per
+// <TxDtls>; any other entry becomes a single input. IDs prefer the bank's
+// servicer reference and fall back to the statement ID and position. The
+// payer's end-to-end ID is kept for matching against invoice numbers.
+func ParseCAMT053(r io.Reader) ([]BankTransactionInput, []*models.StatementBalance, error) {
+	statements, err := camt053.Parse(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidStatement, err)
+	}
+
+	var transactions []BankTransactionInput
+	var balances []*models.StatementBalance
+	for _, statement := range statements {
+		if statement.ClosingDate != "" {
+			balances = append(balances, &models.StatementBalance{
+				AccountNumber: statement.AccountID,
+				BalanceDate:   statement.ClosingDate,
+				Balance:       statement.ClosingBalance,
+				Currency:      statement.Currency,
+				Source:        detect.FormatCAMT053,
+			})
+		}
+		for i, entry := range statement.Entries {
+			entryID := entry.ServicerReference
+			if entryID == "" {
+				entryID = entry.Reference
+			}
+			if entryID == "" {
+				entryID = fmt.Sprintf("%s/%d", statement.ID, i+1)
+			}
+
+			// The entry states its currency; older statements only the account's
+			entryCurrency := entry.Currency
+			if entryCurrency == "" {
+				entryCurrency = statement.Currency
+			}
+
+			details := entry.Transactions
+			if !splitBatch(entry) {
+				// One transaction for the whole entry, described by its
+				// first details block when there is one
+				details = details[:min(len(details), 1)]
+				if len(details) == 0 {
+					details = []camt053.Transaction{{}}
+				}
+				details[0].Amount = entry.Amount
+			}
+
+			for j, detail := range details {
+				transactionID := entryID
+				if len(details) > 1 {
+					transactionID = detail.ServicerReference
+					if transactionID == "" {
+						transactionID = fmt.Sprintf("%s/%d", entryID, j+1)
+					}
+				}
+
+				input := BankTransactionInput{
+					TransactionID:         transactionID,
+					AccountNumber:         statement.AccountID,
+					Amount:                detail.Amount,
+					Currency:              entryCurrency,
+					TransactionDate:       entry.ValueDate,
+					Description:           detail.CounterpartyName,
+					RemittanceInformation: detail.Remittance,
+					CreditorReference:     detail.CreditorReference,
+					EndToEndID:            detail.EndToEndID,
+					Reversal:              entry.Reversal,
+					ReturnReason:          detail.ReturnReason,
+				}
+				if input.Description == "" {
+					input.Description = detail.AdditionalInfo
+				}
+				if input.Description == "" {
+					input.Description = entry.AdditionalInfo
+				}
+				if banking.ValidateIBAN(detail.CounterpartyIBAN) == nil {
+					input.CounterpartyIBAN = detail.CounterpartyIBAN
+				}
+				if banking.ValidateBIC(detail.CounterpartyBIC) == nil {
+					input.CounterpartyBIC = detail.CounterpartyBIC
+				}
+				// Only checksum-valid RF references are kept; others are
+				// still searchable in the remittance text
+				if banking.ValidateCreditorReference(input.CreditorReference) != nil {
+					input.CreditorReference = ""
+				}
+				transactions = append(transactions, input)
+			}
+		}
+	}
+	return transactions, balances, nil
+}
+
+// splitBatch reports whether a batch booking can be booked as its individual
+// transactions, which needs every one of them to state its amount
+func splitBatch(entry camt053.Entry) bool {
+	if len(entry.Transactions) < 2 {
+		return false
+	}
+	for _, tx := range entry.Transactions {
+		if tx.Amount == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseCSVStatement converts a delimited bank statement into bank
+// transaction inputs. Its header row names the columns after the fields of a
+// JSON bank transaction, in any order and case; transaction_id, amount and
+// transaction_date are required, unknown columns are ignored. A CSV carries
+// no statement balances.
+func ParseCSVStatement(r io.Reader, delimiter rune) ([]BankTransactionInput, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: no header row: %v", ErrInvalidStatement, err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, required := range []string{"transaction_id", "amount", "transaction_date"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("%w: missing %s column", ErrInvalidStatement, required)
+		}
+	}
+
+	var transactions []BankTransactionInput
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidStatement, err)
+		}
+		field := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+		if len(record) == 1 && field("transaction_id") == "" {
+			continue // blank line
+		}
+
+		amount, err := money.Parse(field("amount"))
+		if err != nil {
+			return nil, fmt.Errorf("%w: row %d: invalid amount: %v", ErrInvalidStatement, row, err)
+		}
+		reversal := strings.ToLower(field("reversal"))
+		transactions = append(transactions, BankTransactionInput{
+			TransactionID:         field("transaction_id"),
+			AccountNumber:         field("account_number"),
+			Amount:                amount,
+			Currency:              field("currency"),
+			TransactionDate:       field("transaction_date"),
+			Description:           field("description"),
+			ReferenceNumber:       field("reference_number"),
+			CounterpartyIBAN:      field("counterparty_iban"),
+			CounterpartyBIC:       field("counterparty_bic"),
+			Counterparty:          field("counterparty"),
+			RemittanceInformation: field("remittance_information"),
+			CreditorReference:     field("creditor_reference"),
+			EndToEndID:            field("end_to_end_id"),
+			ExternalCorrelationID: field("external_correlation_id"),
+			Reversal:              reversal == "true" || reversal == "1",
+			ReturnReason:          field("return_reason"),
+		})
+	}
+	return transactions, nil
+}
+
+// MaxStatementSize bounds a fetched statement file; uploads are bounded by
+// IngestionLanes.MaxStatementBytes
+const MaxStatementSize = 10 << 20
+
+// MinDetectionConfidence is the least confidence a detected format needs
+// before a file is ingested as that format
+const MinDetectionConfidence = 0.6
+
+// StatementIngestible reports whether a detection is certain enough, and of
+// a format there is a parser for
+func StatementIngestible(detection detect.Detection) bool {
+	if detection.Confidence < MinDetectionConfidence {
+		return false
+	}
+	switch detection.Format {
+	case detect.FormatCSV, detect.FormatMT940, detect.FormatCAMT053:
+		return true
+	}
+	return false
+}
+
+// ParseStatement parses a UTF-8 statement file with the parser of its
+// detected format, which must be ingestible
+func ParseStatement(detection detect.Detection, text []byte) ([]BankTransactionInput, []*models.StatementBalance, error) {
+	switch detection.Format {
+	case detect.FormatCSV:
+		delimiter := ','
+		if detection.Delimiter != "" {
+			delimiter = []rune(detection.Delimiter)[0]
+		}
+		transactions, err := ParseCSVStatement(bytes.NewReader(text), delimiter)
+		return transactions, nil, err
+	case detect.FormatMT940:
+		return ParseMT940(bytes.NewReader(text))
+	case detect.FormatCAMT053:
+		return ParseCAMT053(bytes.NewReader(text))
+	}
+	return nil, nil, fmt.Errorf("%w: format %q is not supported", ErrInvalidStatement, detection.Format)
+}
+
+// IngestAccountingEntries inserts accounting entries. Every entry is stored or
+// none is, unless the ingestion is a partial commit, which stores the valid
+// entries and reports the failed ones. On the bulk lane this holds per chunk,
+// see ingestChunks.
+func (s *DataIngestionService) IngestAccountingEntries(lane string, entries []AccountingEntryInput, partial bool) (*IngestionResult, error) {
+	if lane != IngestionLaneBulk {
+		result, err := s.ingestAccountingEntries(s.lanes.Realtime, entries, partial)
+		if err != nil {
+			return nil, err
+		}
+		result.Lane = IngestionLaneRealtime
+		return result, nil
+	}
+	return s.ingestChunks(len(entries), partial, func(from, to int, clean bool) (*IngestionResult, error) {
+		return s.ingestAccountingEntries(s.lanes.Bulk, entries[from:to], partial)
+	})
+}
+
+func (s *DataIngestionService) ingestAccountingEntries(db *sql.DB, entries []AccountingEntryInput, partial bool) (*IngestionResult, error) {
 	result := &IngestionResult{
 		Success: true,
 		Details: make(map[string]interface{}),
 	}
 
-	tx, err := s.db.Begin()
+	counterparties, err := s.counterpartyIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
 	if err != nil {
 		return nil, fmt.Errorf("failed to begin transaction: %v", err)
 	}
 	defer tx.Rollback()
 
+	var stored []string
 	for _, input := range entries {
 		if err := validateAccountingEntry(input); err != nil {
 			result.Errors = append(result.Errors, fmt.Sprintf("Invalid entry %s: %v", input.EntryID, err))
@@ -124,21 +686,37 @@ func (s *DataIngestionService) IngestAccountingEntries(entries []AccountingEntry
 		}
 
 		entry := &models.AccountingEntry{
-			EntryID:       input.EntryID,
-			AccountCode:   input.AccountCode,
-			Amount:        input.Amount,
-			EntryDate:     input.EntryDate,
-			Description:   input.Description,
-			InvoiceNumber: input.InvoiceNumber,
+			EntryID:           input.EntryID,
+			AccountCode:       input.AccountCode,
+			Amount:            input.Amount,
+			Currency:          s.recordCurrency(input.Currency, ""),
+			EntryDate:         input.EntryDate,
+			Description:       input.Description,
+			InvoiceNumber:     input.InvoiceNumber,
+			EntryType:         entryType(input.EntryType, ""),
+			CounterpartyIBAN:  banking.NormalizeIBAN(input.CounterpartyIBAN),
+			CreditorReference: banking.NormalizeCreditorReference(input.CreditorReference),
+			EndToEndID:        normalizeEndToEndID(input.EndToEndID),
+
+			ExternalCorrelationID: strings.TrimSpace(input.ExternalCorrelationID),
+		}
+		entry.CounterpartyID, err = counterparties.link(input.Counterparty, entry.CounterpartyIBAN, entry.Description)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("Invalid entry %s: %v", input.EntryID, err))
+			continue
 		}
 
 		err := s.accountingRepo.InsertAccountingEntry(tx, entry)
+		if repositories.IsDeadlock(err) {
+			return nil, errIngestionDeadlock(err)
+		}
 		if err != nil {
 			result.Errors = append(result.Errors, fmt.Sprintf("Failed to insert entry %s: %v", input.EntryID, err))
 			continue
 		}
 
 		result.RecordsCount++
+		stored = append(stored, input.EntryID)
 	}
 
 	result.Success = len(result.Errors) == 0
@@ -146,16 +724,214 @@ func (s *DataIngestionService) IngestAccountingEntries(entries []AccountingEntry
 	result.Details["successful"] = result.RecordsCount
 	result.Details["failed"] = len(result.Errors)
 
-	if result.Success {
-		err = tx.Commit()
-		if err != nil {
-			return nil, fmt.Errorf("failed to commit transaction: %v", err)
-		}
+	if err := commitIngestion(tx, result, partial, stored); err != nil {
+		return nil, err
 	}
-
 	return result, nil
 }
 
+// CorrectBankTransaction replaces the editable fields of a stored bank
+// transaction. version must be the one the caller read; if the row changed
+// since, repositories.ErrVersionConflict is returned and nothing is written.
+// The transaction ID identifies the record and cannot be corrected. Batches
+// the transaction is mapped in get a delta when the correction moves their
+// numbers. A transaction that is held, itself, through its account or through
+// a batch it is mapped in, cannot be corrected, nor can a voided one.
+func (s *DataIngestionService) CorrectBankTransaction(id int64, input BankTransactionInput, version int, userID string) (*models.BankTransaction, error) {
+	if version <= 0 {
+		return nil, fmt.Errorf("%w: version is required", ErrInvalidCorrection)
+	}
+	existing, err := s.bankRepo.GetBankTransactionByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if existing.VoidedAt != nil {
+		return nil, fmt.Errorf("%w: bank transaction %d is voided", ErrRecordVoided, id)
+	}
+
+	input.TransactionID = existing.TransactionID
+	if err := validateBankTransaction(input); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCorrection, err)
+	}
+
+	transaction := &models.BankTransaction{
+		ID:              existing.ID,
+		TransactionID:   existing.TransactionID,
+		AccountNumber:   input.AccountNumber,
+		Amount:          input.Amount,
+		Currency:        s.recordCurrency(input.Currency, existing.Currency),
+		TransactionDate: input.TransactionDate,
+		Description:     input.Description,
+		ReferenceNumber: input.ReferenceNumber,
+		EndToEndID:      normalizeEndToEndID(input.EndToEndID),
+		Reversal:        input.Reversal,
+		ReturnReason:    strings.TrimSpace(input.ReturnReason),
+		Version:         version,
+		CreatedAt:       existing.CreatedAt,
+
+		ExternalCorrelationID: strings.TrimSpace(input.ExternalCorrelationID),
+	}
+	enrichCounterparty(transaction, input.CounterpartyIBAN, input.CounterpartyBIC)
+	parseRemittance(transaction, input.RemittanceInformation, input.CreditorReference)
+	if transaction.CounterpartyID, err = s.relinkCounterparty(existing.CounterpartyID, input.Counterparty, transaction.CounterpartyIBAN, transaction.Description); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	batchIDs, err := s.reconciliationRepo.GetBatchIDsForBankTransaction(tx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get batches of bank transaction %d: %v", id, err)
+	}
+	held := models.LegalHoldSubjects{BatchIDs: batchIDs, BankTransactionIDs: []int64{id}}
+	if err := checkLegalHold(s.legalHoldRepo, held); err != nil {
+		return nil, err
+	}
+	before, err := batchSummaries(s.reconciliationRepo, tx, batchIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.bankRepo.UpdateBankTransaction(tx, transaction); err != nil {
+		return nil, fmt.Errorf("failed to correct bank transaction %d: %w", id, err)
+	}
+
+	changes := map[string]interface{}{
+		"transaction_id": existing.TransactionID,
+		"before":         existing,
+		"after":          transaction,
+	}
+	if err := recordBatchDeltas(s.reconciliationRepo, tx, before, models.DeltaActionBankCorrection, userID, changes); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return transaction, nil
+}
+
+// CorrectAccountingEntry is CorrectBankTransaction for accounting entries,
+// whose entry ID is likewise fixed
+func (s *DataIngestionService) CorrectAccountingEntry(id int64, input AccountingEntryInput, version int, userID string) (*models.AccountingEntry, error) {
+	if version <= 0 {
+		return nil, fmt.Errorf("%w: version is required", ErrInvalidCorrection)
+	}
+	existing, err := s.accountingRepo.GetAccountingEntryByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if existing.VoidedAt != nil {
+		return nil, fmt.Errorf("%w: accounting entry %d is voided", ErrRecordVoided, id)
+	}
+
+	input.EntryID = existing.EntryID
+	if err := validateAccountingEntry(input); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCorrection, err)
+	}
+
+	entry := &models.AccountingEntry{
+		ID:                existing.ID,
+		EntryID:           existing.EntryID,
+		AccountCode:       input.AccountCode,
+		Amount:            input.Amount,
+		Currency:          s.recordCurrency(input.Currency, existing.Currency),
+		EntryDate:         input.EntryDate,
+		Description:       input.Description,
+		InvoiceNumber:     input.InvoiceNumber,
+		EntryType:         entryType(input.EntryType, existing.EntryType),
+		CounterpartyIBAN:  banking.NormalizeIBAN(input.CounterpartyIBAN),
+		CreditorReference: banking.NormalizeCreditorReference(input.CreditorReference),
+		EndToEndID:        normalizeEndToEndID(input.EndToEndID),
+		Version:           version,
+		CreatedAt:         existing.CreatedAt,
+
+		ExternalCorrelationID: strings.TrimSpace(input.ExternalCorrelationID),
+	}
+	if entry.CounterpartyID, err = s.relinkCounterparty(existing.CounterpartyID, input.Counterparty, entry.CounterpartyIBAN, entry.Description); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	batchIDs, err := s.reconciliationRepo.GetBatchIDsForAccountingEntry(tx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get batches of accounting entry %d: %v", id, err)
+	}
+	held := models.LegalHoldSubjects{BatchIDs: batchIDs, AccountingEntryIDs: []int64{id}}
+	if err := checkLegalHold(s.legalHoldRepo, held); err != nil {
+		return nil, err
+	}
+	before, err := batchSummaries(s.reconciliationRepo, tx, batchIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.accountingRepo.UpdateAccountingEntry(tx, entry); err != nil {
+		return nil, fmt.Errorf("failed to correct accounting entry %d: %w", id, err)
+	}
+
+	changes := map[string]interface{}{
+		"entry_id": existing.EntryID,
+		"before":   existing,
+		"after":    entry,
+	}
+	if err := recordBatchDeltas(s.reconciliationRepo, tx, before, models.DeltaActionAccountingCorrection, userID, changes); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return entry, nil
+}
+
+// counterpartyIndex loads the counterparty master data and alias dictionary
+// for one request
+func (s *DataIngestionService) counterpartyIndex() (*counterpartyIndex, error) {
+	counterparties, err := s.counterpartyRepo.ListCounterparties()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load counterparties: %v", err)
+	}
+	dictionary, err := loadAliasDictionary(s.aliasRepo)
+	if err != nil {
+		return nil, err
+	}
+	return newCounterpartyIndex(counterparties, dictionary), nil
+}
+
+// relinkCounterparty resolves the counterparty of a corrected record. A link
+// that no longer resolves from the corrected data, such as one learned from
+// matched history, is kept.
+func (s *DataIngestionService) relinkCounterparty(current int64, code, iban, description string) (int64, error) {
+	counterparties, err := s.counterpartyIndex()
+	if err != nil {
+		return 0, err
+	}
+	id, err := counterparties.link(code, iban, description)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidCorrection, err)
+	}
+	if id == 0 {
+		return current, nil
+	}
+	return id, nil
+}
+
+func (s *DataIngestionService) GetBankTransaction(id int64) (*models.BankTransaction, error) {
+	return s.bankRepo.GetBankTransactionByID(id)
+}
+
+func (s *DataIngestionService) GetAccountingEntry(id int64) (*models.AccountingEntry, error) {
+	return s.accountingRepo.GetAccountingEntryByID(id)
+}
+
 func validateBankTransaction(input BankTransactionInput) error {
 	if input.TransactionID == "" {
 		return fmt.Errorf("transaction_id is required")
@@ -169,6 +945,30 @@ func validateBankTransaction(input BankTransactionInput) error {
 	if input.TransactionDate == "" {
 		return fmt.Errorf("transaction_date is required")
 	}
+	if input.Currency != "" && !currency.Supported(input.Currency) {
+		return fmt.Errorf("currency: unsupported currency %q", input.Currency)
+	}
+	if input.CounterpartyIBAN != "" {
+		if err := banking.ValidateIBAN(input.CounterpartyIBAN); err != nil {
+			return fmt.Errorf("counterparty_iban: %v", err)
+		}
+	}
+	if input.CounterpartyBIC != "" {
+		if err := banking.ValidateBIC(input.CounterpartyBIC); err != nil {
+			return fmt.Errorf("counterparty_bic: %v", err)
+		}
+	}
+	if input.CreditorReference != "" {
+		if err := banking.ValidateCreditorReference(input.CreditorReference); err != nil {
+			return fmt.Errorf("creditor_reference: %v", err)
+		}
+	}
+	if len(input.EndToEndID) > maxEndToEndIDLength {
+		return fmt.Errorf("end_to_end_id must be at most %d characters", maxEndToEndIDLength)
+	}
+	if len(strings.TrimSpace(input.ExternalCorrelationID)) > maxCorrelationIDLength {
+		return fmt.Errorf("external_correlation_id must be at most %d characters", maxCorrelationIDLength)
+	}
 	return nil
 }
 
@@ -185,5 +985,101 @@ func validateAccountingEntry(input AccountingEntryInput) error {
 	if input.EntryDate == "" {
 		return fmt.Errorf("entry_date is required")
 	}
+	if input.Currency != "" && !currency.Supported(input.Currency) {
+		return fmt.Errorf("currency: unsupported currency %q", input.Currency)
+	}
+	switch entryType(input.EntryType, "") {
+	case models.EntryTypeInvoice, models.EntryTypeCreditNote, models.EntryTypeReversal, models.EntryTypeAdjustment:
+	default:
+		return fmt.Errorf("entry_type must be invoice, credit_note, reversal or adjustment")
+	}
+	if input.CounterpartyIBAN != "" {
+		if err := banking.ValidateIBAN(input.CounterpartyIBAN); err != nil {
+			return fmt.Errorf("counterparty_iban: %v", err)
+		}
+	}
+	if input.CreditorReference != "" {
+		if err := banking.ValidateCreditorReference(input.CreditorReference); err != nil {
+			return fmt.Errorf("creditor_reference: %v", err)
+		}
+	}
+	if len(input.EndToEndID) > maxEndToEndIDLength {
+		return fmt.Errorf("end_to_end_id must be at most %d characters", maxEndToEndIDLength)
+	}
+	if len(strings.TrimSpace(input.ExternalCorrelationID)) > maxCorrelationIDLength {
+		return fmt.Errorf("external_correlation_id must be at most %d characters", maxCorrelationIDLength)
+	}
 	return nil
 }
+
+// entryType is the type an entry is stored with: the one given, else the one
+// it already has, else invoice
+func entryType(value, current string) string {
+	switch value = strings.ToLower(strings.TrimSpace(value)); {
+	case value != "":
+		return value
+	case current != "":
+		return current
+	default:
+		return models.EntryTypeInvoice
+	}
+}
+
+// recordCurrency is the currency a record is stored in: the one given, else
+// the one it already has, else the base currency
+func (s *DataIngestionService) recordCurrency(code, current string) string {
+	switch {
+	case code != "":
+		return strings.ToUpper(strings.TrimSpace(code))
+	case current != "":
+		return current
+	default:
+		return s.baseCurrency
+	}
+}
+
+// maxEndToEndIDLength is the ISO 20022 Max35Text limit
+const maxEndToEndIDLength = 35
+
+// maxCorrelationIDLength is the width of the external_correlation_id columns
+const maxCorrelationIDLength = 100
+
+// normalizeEndToEndID drops the NOTPROVIDED placeholder payers send when they
+// have no reference of their own
+func normalizeEndToEndID(id string) string {
+	id = strings.TrimSpace(id)
+	if strings.EqualFold(id, "NOTPROVIDED") {
+		return ""
+	}
+	return id
+}
+
+// parseRemittance keeps the raw remittance text and resolves the structured
+// creditor reference, preferring an explicitly supplied one over one found in the text
+func parseRemittance(bt *models.BankTransaction, remittance, creditorReference string) {
+	bt.RemittanceInformation = remittance
+	if creditorReference != "" {
+		bt.CreditorReference = banking.NormalizeCreditorReference(creditorReference)
+		return
+	}
+	if ref, ok := banking.ExtractCreditorReference(remittance); ok {
+		bt.CreditorReference = ref
+	}
+}
+
+// enrichCounterparty stores the normalized counterparty IBAN/BIC and fills in
+// the bank name and country from the embedded BIC registry
+func enrichCounterparty(bt *models.BankTransaction, iban, bic string) {
+	bt.CounterpartyIBAN = banking.NormalizeIBAN(iban)
+	bt.CounterpartyBIC = banking.NormalizeBIC(bic)
+
+	if bt.CounterpartyBIC != "" {
+		bt.CounterpartyBankCountry = banking.BICCountry(bt.CounterpartyBIC)
+		if info, ok := banking.LookupBIC(bt.CounterpartyBIC); ok {
+			bt.CounterpartyBankName = info.Name
+			bt.CounterpartyBankCountry = info.Country
+		}
+	} else if bt.CounterpartyIBAN != "" {
+		bt.CounterpartyBankCountry = banking.IBANCountry(bt.CounterpartyIBAN)
+	}
+}
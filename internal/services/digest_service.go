@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"reconciliation-service/internal/config"
+	"reconciliation-service/internal/currency"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/money"
+	"reconciliation-service/internal/repositories"
+)
+
+// ErrInvalidDigestQuery rejects a digest request
+var ErrInvalidDigestQuery = errors.New("invalid digest query")
+
+// DigestService sums up a tenant's day for the operators who start theirs
+// with it: what was ingested, the batches run and how well they matched,
+// what was left unmatched, what aged past the thresholds and the disputes
+// still open. A sender dispatches yesterday's digest once a day as a
+// daily_digest notification.
+type DigestService struct {
+	analyticsRepo       repositories.AnalyticsRepository
+	fxRates             *FXRateService
+	notificationService *NotificationService
+	jobService          *JobService
+	maintenanceService  *MaintenanceService
+	tenant              string
+	baseCurrency        string
+	config              config.DigestConfig
+	// lastSent is the date of the last digest this instance dispatched
+	lastSent string
+}
+
+func NewDigestService(analyticsRepo repositories.AnalyticsRepository, fxRates *FXRateService, notificationService *NotificationService, jobService *JobService, maintenanceService *MaintenanceService, tenant, baseCurrency string, cfg config.DigestConfig) *DigestService {
+	return &DigestService{
+		analyticsRepo:       analyticsRepo,
+		fxRates:             fxRates,
+		notificationService: notificationService,
+		jobService:          jobService,
+		maintenanceService:  maintenanceService,
+		tenant:              tenant,
+		baseCurrency:        baseCurrency,
+		config:              cfg,
+	}
+}
+
+// Daily builds the digest of a day (YYYY-MM-DD, UTC), yesterday when date is
+// empty. Unmatched amounts are what is unmatched now, in the base currency;
+// missing exchange rates leave amounts out rather than fail the digest.
+func (s *DigestService) Daily(date string) (*models.DailyDigest, error) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	day := today.AddDate(0, 0, -1)
+	if date != "" {
+		var err error
+		if day, err = time.Parse("2006-01-02", date); err != nil {
+			return nil, fmt.Errorf("%w: date must be YYYY-MM-DD", ErrInvalidDigestQuery)
+		}
+		if day.After(today) {
+			return nil, fmt.Errorf("%w: date must not be in the future", ErrInvalidDigestQuery)
+		}
+	}
+	date = day.Format("2006-01-02")
+	nextDate := day.AddDate(0, 0, 1).Format("2006-01-02")
+
+	activity, err := s.analyticsRepo.GetDigestActivity(date, nextDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get digest activity: %v", err)
+	}
+	newUnmatched, err := s.analyticsRepo.GetNewUnmatched(date, nextDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get new unmatched records: %v", err)
+	}
+	rates, err := s.fxRates.RateTable()
+	if err != nil {
+		log.Printf("exchange rates unavailable, counting only %s amounts: %v", s.baseCurrency, err)
+	}
+
+	digest := &models.DailyDigest{
+		Tenant:                    s.tenant,
+		Date:                      date,
+		Currency:                  s.baseCurrency,
+		BankTransactionsIngested:  activity.BankTransactions,
+		AccountingEntriesIngested: activity.AccountingEntries,
+		BatchesRun:                activity.Batches,
+		Matched:                   activity.Matched,
+		Unmatched:                 activity.Unmatched,
+		MatchRate:                 matchRate(activity.Matched, activity.Matched+activity.Unmatched),
+		OpenDisputes:              activity.OpenDisputes,
+		AgedItems:                 []*models.DigestAgedItems{},
+	}
+	for _, total := range newUnmatched {
+		digest.NewUnmatchedCount += total.Count
+		if amount, ok := s.convert(rates, total, date); ok {
+			digest.NewUnmatchedAmount += amount
+		} else {
+			digest.UnconvertedCount += total.Count
+		}
+	}
+
+	// A record crosses a threshold on the day it turns that many days old
+	for _, days := range s.config.AgingThresholds {
+		recordDate := day.AddDate(0, 0, -days).Format("2006-01-02")
+		totals, err := s.analyticsRepo.GetUnmatchedDatedOn(recordDate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get aged records: %v", err)
+		}
+		aged := &models.DigestAgedItems{ThresholdDays: days}
+		for _, total := range totals {
+			aged.Count += total.Count
+			if amount, ok := s.convert(rates, total, recordDate); ok {
+				aged.Amount += amount
+			} else {
+				digest.UnconvertedCount += total.Count
+			}
+		}
+		digest.AgedItems = append(digest.AgedItems, aged)
+	}
+	return digest, nil
+}
+
+// convert expresses a total in the base currency at the rate of date;
+// records without a currency are in the base currency
+func (s *DigestService) convert(rates *currency.RateTable, total *models.CurrencyTotal, date string) (money.Amount, bool) {
+	currencyCode := total.Currency
+	if currencyCode == "" {
+		currencyCode = s.baseCurrency
+	}
+	return rates.Convert(total.Amount, currencyCode, s.baseCurrency, date)
+}
+
+// RunSender dispatches yesterday's digest once the send hour has passed,
+// checking every check interval until ctx is cancelled. Nothing is sent
+// while the service drains or is in maintenance.
+func (s *DigestService) RunSender(ctx context.Context) {
+	ticker := time.NewTicker(s.config.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		if !s.jobService.Draining() && !s.maintenanceService.Enabled() {
+			if err := s.Send(time.Now()); err != nil {
+				log.Printf("digest: %v", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Send dispatches the digest of the day before now as a daily_digest
+// notification for the tenant and logs it rendered for every route, unless
+// the send hour has not passed or it was sent already. The notification
+// dedup window keeps instances from sending the same day twice.
+func (s *DigestService) Send(now time.Time) error {
+	now = now.UTC()
+	date := now.AddDate(0, 0, -1).Format("2006-01-02")
+	if now.Hour() < s.config.Hour || s.lastSent == date {
+		return nil
+	}
+
+	digest, err := s.Daily(date)
+	if err != nil {
+		return err
+	}
+	dispatch, err := s.notificationService.Dispatch(models.NotificationEventDailyDigest, s.tenant+"/"+date)
+	if err != nil {
+		return fmt.Errorf("failed to dispatch the digest of %s: %v", date, err)
+	}
+	s.lastSent = date
+
+	var agedCount int
+	var agedAmount money.Amount
+	for _, aged := range digest.AgedItems {
+		agedCount += aged.Count
+		agedAmount += aged.Amount
+	}
+	subjectArgs := []interface{}{s.tenant, date}
+	bodyArgs := []interface{}{
+		date, digest.BankTransactionsIngested, digest.AccountingEntriesIngested, digest.BatchesRun,
+		digest.Matched, digest.Unmatched, strconv.FormatFloat(digest.MatchRate*100, 'f', 2, 64),
+		digest.NewUnmatchedCount, digest.NewUnmatchedAmount, digest.Currency,
+		agedCount, agedAmount, digest.Currency, digest.OpenDisputes,
+	}
+	for _, route := range dispatch.Routes {
+		subject, body := s.notificationService.Render(route, models.NotificationEventDailyDigest, subjectArgs, bodyArgs)
+		log.Printf("digest: %s to %s by %s (%s): %s: %s", route.UserID, route.Address, route.Channel, route.Delivery, subject, body)
+	}
+	return nil
+}
@@ -0,0 +1,376 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"reconciliation-service/internal/config"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/pagination"
+	"reconciliation-service/internal/repositories"
+)
+
+var (
+	// ErrInvalidEmail rejects a message that cannot be read as an email
+	ErrInvalidEmail = errors.New("invalid email")
+
+	// ErrEmailSignature rejects a message not signed with the signing key
+	ErrEmailSignature = errors.New("invalid email signature")
+
+	// ErrEmailRefused means the mailbox or sender of an email is not allowed
+	ErrEmailRefused = errors.New("email refused")
+
+	// ErrEmailDisabled refuses email when no mailbox is configured
+	ErrEmailDisabled = errors.New("email ingestion is not configured")
+
+	// ErrEmailPaused refuses email during maintenance or while draining, so
+	// the provider delivers it again later
+	ErrEmailPaused = errors.New("email ingestion is paused")
+)
+
+const (
+	// MaxEmailSize is the largest raw message accepted, attachments encoded
+	MaxEmailSize = 25 << 20
+	// Most attachments of one email that are ingested
+	maxEmailAttachments = 20
+	// Deepest nesting of multipart bodies searched for attachments
+	maxEmailNesting = 5
+
+	// ingestionEmailsCursor names the ingestion email list in its page cursors
+	ingestionEmailsCursor = "ingestion_emails"
+)
+
+// emailAttachment is an attachment decoded from a message
+type emailAttachment struct {
+	name string
+	data []byte
+}
+
+// EmailIngestionService ingests statements mailed by banks that deliver no
+// other way. The email provider forwards each message received at a
+// configured mailbox, raw and signed with the signing key. A message from a
+// sender the mailbox allows has each attachment ingested like an upload to
+// /bank-statements, as an ingestion file with source email:<mailbox>;
+// content ingested before, over any channel, is not ingested again. Every
+// delivery, refused ones included, is recorded with what became of its
+// attachments.
+type EmailIngestionService struct {
+	dataIngestionService *DataIngestionService
+	jobService           *JobService
+	maintenanceService   *MaintenanceService
+	anomalyService       *IngestionAnomalyService
+	fileRepo             repositories.IngestionFileRepository
+	config               config.EmailConfig
+}
+
+func NewEmailIngestionService(dataIngestionService *DataIngestionService, jobService *JobService, maintenanceService *MaintenanceService, anomalyService *IngestionAnomalyService, fileRepo repositories.IngestionFileRepository, cfg config.EmailConfig) *EmailIngestionService {
+	return &EmailIngestionService{
+		dataIngestionService: dataIngestionService,
+		jobService:           jobService,
+		maintenanceService:   maintenanceService,
+		anomalyService:       anomalyService,
+		fileRepo:             fileRepo,
+		config:               cfg,
+	}
+}
+
+// Receive ingests the attachments of a raw message whose signature, the hex
+// HMAC-SHA256 of the message, checks out. A message from a mailbox or sender
+// not allowed is recorded and returned with ErrEmailRefused. The recorded
+// email is returned; an attachment that failed for a reason that may pass
+// leaves it with a failed attachment, and a later delivery ingests it.
+func (s *EmailIngestionService) Receive(raw []byte, signature string) (*models.IngestionEmail, error) {
+	if !s.config.Enabled() {
+		return nil, ErrEmailDisabled
+	}
+	if !s.validSignature(raw, signature) {
+		return nil, ErrEmailSignature
+	}
+	if s.jobService.Draining() || s.maintenanceService.Enabled() {
+		return nil, ErrEmailPaused
+	}
+	if len(raw) > MaxEmailSize {
+		return nil, fmt.Errorf("%w: larger than %d bytes", ErrInvalidEmail, MaxEmailSize)
+	}
+
+	message, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEmail, err)
+	}
+	email := &models.IngestionEmail{
+		MessageID:   truncate(strings.Trim(strings.TrimSpace(message.Header.Get("Message-ID")), "<>"), 255),
+		Subject:     truncate(decodeHeader(message.Header.Get("Subject")), 255),
+		Attachments: []*models.IngestionEmailAttachment{},
+	}
+	from, err := mail.ParseAddress(message.Header.Get("From"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: unreadable From address: %v", ErrInvalidEmail, err)
+	}
+	email.Sender = truncate(strings.ToLower(from.Address), 255)
+
+	senders, refusal := s.mailbox(message.Header, email)
+	if refusal == "" && !senderAllowed(email.Sender, senders) {
+		refusal = fmt.Sprintf("sender %s may not mail %s", email.Sender, email.Mailbox)
+	}
+	if refusal != "" {
+		email.Status, email.Error = models.IngestionEmailRefused, refusal
+		if err := s.fileRepo.RecordEmail(email); err != nil {
+			return nil, fmt.Errorf("failed to record email: %v", err)
+		}
+		return email, fmt.Errorf("%w: %s", ErrEmailRefused, refusal)
+	}
+
+	attachments, err := readAttachments(message.Header.Get("Content-Type"), message.Header.Get("Content-Transfer-Encoding"), message.Body, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEmail, err)
+	}
+	if len(attachments) > maxEmailAttachments {
+		email.Error = fmt.Sprintf("only the first %d of %d attachments were ingested", maxEmailAttachments, len(attachments))
+		attachments = attachments[:maxEmailAttachments]
+	}
+
+	email.Status = models.IngestionEmailProcessed
+	if len(attachments) == 0 {
+		email.Status = models.IngestionEmailEmpty
+	}
+	for _, attachment := range attachments {
+		email.Attachments = append(email.Attachments, s.ingestAttachment(email.Mailbox, attachment))
+	}
+	if err := s.fileRepo.RecordEmail(email); err != nil {
+		return nil, fmt.Errorf("failed to record email: %v", err)
+	}
+	return email, nil
+}
+
+// ListEmails lists received emails newest first, optionally of one status,
+// from the cursor a previous page returned, and the cursor of the next page
+func (s *EmailIngestionService) ListEmails(status, cursor string, limit int) ([]*models.IngestionEmail, string, error) {
+	status = strings.ToLower(strings.TrimSpace(status))
+	switch status {
+	case "", models.IngestionEmailProcessed, models.IngestionEmailRefused, models.IngestionEmailEmpty:
+	default:
+		return nil, "", fmt.Errorf("%w: unknown status %q", ErrInvalidIngestionFiles, status)
+	}
+	switch {
+	case limit == 0:
+		limit = defaultIngestionFilesLimit
+	case limit < 0 || limit > maxIngestionFilesLimit:
+		return nil, "", fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidIngestionFiles, maxIngestionFilesLimit)
+	}
+	after, err := pagination.Decode(cursor, ingestionEmailsCursor)
+	if err != nil {
+		return nil, "", err
+	}
+	_, beforeID := after.Key()
+	emails, err := s.fileRepo.ListEmails(status, beforeID, limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	emails, next := pagination.Next(emails, limit, func(email *models.IngestionEmail) pagination.Cursor {
+		return pagination.Cursor{List: ingestionEmailsCursor, ID: email.ID}
+	})
+	return emails, next, nil
+}
+
+func (s *EmailIngestionService) validSignature(raw []byte, signature string) bool {
+	mac := hmac.New(sha256.New, []byte(s.config.SigningKey))
+	mac.Write(raw)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	signature = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(signature), "sha256="))
+	return hmac.Equal([]byte(signature), []byte(expected))
+}
+
+// mailbox finds the configured mailbox a message was delivered to, from the
+// Delivered-To header the provider adds or else the recipients, and returns
+// its allowed senders, or why the message is refused
+func (s *EmailIngestionService) mailbox(header mail.Header, email *models.IngestionEmail) ([]string, string) {
+	var recipients []string
+	for _, key := range []string{"Delivered-To", "X-Original-To", "To", "Cc"} {
+		addresses, err := header.AddressList(key)
+		if err != nil {
+			continue
+		}
+		for _, address := range addresses {
+			recipient := strings.ToLower(address.Address)
+			if senders, ok := s.config.Mailboxes[recipient]; ok {
+				email.Mailbox = recipient
+				return senders, ""
+			}
+			recipients = append(recipients, recipient)
+		}
+	}
+	if len(recipients) > 0 {
+		email.Mailbox = truncate(recipients[0], 255)
+	}
+	return nil, "not addressed to a configured mailbox"
+}
+
+// ingestAttachment claims and ingests one attachment as an ingestion file
+func (s *EmailIngestionService) ingestAttachment(mailbox string, attachment emailAttachment) *models.IngestionEmailAttachment {
+	sum := sha256.Sum256(attachment.data)
+	outcome := &models.IngestionEmailAttachment{
+		FileName: attachment.name,
+		Checksum: hex.EncodeToString(sum[:]),
+		Size:     int64(len(attachment.data)),
+	}
+
+	file := &models.IngestionFile{
+		Source:   "email:" + mailbox,
+		FileName: attachment.name,
+		Checksum: outcome.Checksum,
+		Size:     outcome.Size,
+	}
+	claimed, err := s.fileRepo.ClaimFile(file, time.Now().Add(-ingestionFileStaleAfter))
+	if err != nil {
+		outcome.Status, outcome.Error = models.IngestionFileFailed, err.Error()
+		return outcome
+	}
+	outcome.IngestionFileID = file.ID
+	if !claimed {
+		switch file.Status {
+		case models.IngestionFileIngested, models.IngestionFileRejected:
+			outcome.Status = models.IngestionAttachmentDuplicate
+			s.anomalyService.DuplicateFile("email:"+mailbox, attachment.name, file)
+		default:
+			outcome.Status = models.IngestionAttachmentSkipped
+		}
+		return outcome
+	}
+
+	result := &FetchResult{}
+	err = ingestStatementFile(s.dataIngestionService, s.jobService, s.anomalyService, file, attachment.data)
+	recordFileOutcome(file, err, result)
+	finishFile(s.fileRepo, file, result)
+	outcome.Status, outcome.Error = file.Status, file.Error
+	if outcome.Error == "" && len(result.Errors) > 0 {
+		outcome.Error = strings.Join(result.Errors, "; ")
+	}
+	return outcome
+}
+
+// readAttachments decodes the attachments of a message body of the given
+// content type, searching nested multipart bodies. Parts named by a filename
+// are attachments; the text and HTML of the message are not.
+func readAttachments(contentType, encoding string, body io.Reader, depth int) ([]emailAttachment, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		return nil, nil
+	}
+	if depth >= maxEmailNesting {
+		return nil, fmt.Errorf("multipart bodies nested deeper than %d", maxEmailNesting)
+	}
+
+	var attachments []emailAttachment
+	reader := multipart.NewReader(decodeTransfer(encoding, body), params["boundary"])
+	for {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			return attachments, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		partType := part.Header.Get("Content-Type")
+		partEncoding := part.Header.Get("Content-Transfer-Encoding")
+		if strings.HasPrefix(strings.ToLower(strings.TrimSpace(partType)), "multipart/") {
+			nested, err := readAttachments(partType, partEncoding, part, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			attachments = append(attachments, nested...)
+			continue
+		}
+
+		name := attachmentName(part.Header.Get("Content-Disposition"), partType)
+		if name == "" {
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(decodeTransfer(partEncoding, part), MaxStatementSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("attachment %s: %v", name, err)
+		}
+		attachments = append(attachments, emailAttachment{name: name, data: data})
+	}
+}
+
+// attachmentName is the file name of a part, from its Content-Disposition
+// or else the name parameter of its Content-Type, without any directories
+func attachmentName(disposition, contentType string) string {
+	var name string
+	if _, params, err := mime.ParseMediaType(disposition); err == nil {
+		name = params["filename"]
+	}
+	if name == "" {
+		if _, params, err := mime.ParseMediaType(contentType); err == nil {
+			name = params["name"]
+		}
+	}
+	name = path.Base(strings.ReplaceAll(decodeHeader(name), "\\", "/"))
+	if name == "." || name == "/" {
+		return ""
+	}
+	return truncate(name, 255)
+}
+
+func decodeTransfer(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		// The decoder skips the line breaks base64 bodies are wrapped with
+		return base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	default:
+		return body
+	}
+}
+
+// decodeHeader decodes the encoded words of a header value, leaving a value
+// that cannot be decoded as it is
+func decodeHeader(value string) string {
+	decoded, err := new(mime.WordDecoder).DecodeHeader(value)
+	if err != nil {
+		return strings.TrimSpace(value)
+	}
+	return strings.TrimSpace(decoded)
+}
+
+// senderAllowed reports whether a sender is one of the allowed addresses,
+// or in one of the allowed @domains
+func senderAllowed(sender string, allowed []string) bool {
+	for _, entry := range allowed {
+		if strings.HasPrefix(entry, "@") {
+			if strings.HasSuffix(sender, entry) {
+				return true
+			}
+		} else if sender == entry {
+			return true
+		}
+	}
+	return false
+}
+
+// truncate cuts a header value to at most length bytes, on a character
+// boundary
+func truncate(value string, length int) string {
+	if len(value) <= length {
+		return value
+	}
+	for length > 0 && !utf8.RuneStart(value[length]) {
+		length--
+	}
+	return value[:length]
+}
@@ -0,0 +1,288 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/pagination"
+	"reconciliation-service/internal/repositories"
+)
+
+// ErrInvalidException wraps every rejection of an exception query or
+// workflow change
+var ErrInvalidException = errors.New("invalid exception")
+
+const (
+	DefaultExceptionLimit = 100
+	MaxExceptionLimit     = 1000
+)
+
+// exceptionTransitions lists the states each open state may move to;
+// written_off and resolved are final
+var exceptionTransitions = map[string][]string{
+	models.ExceptionStatusNew: {
+		models.ExceptionStatusInvestigating,
+		models.ExceptionStatusEscalated,
+		models.ExceptionStatusWrittenOff,
+		models.ExceptionStatusResolved,
+	},
+	models.ExceptionStatusInvestigating: {
+		models.ExceptionStatusEscalated,
+		models.ExceptionStatusWrittenOff,
+		models.ExceptionStatusResolved,
+	},
+	models.ExceptionStatusEscalated: {
+		models.ExceptionStatusInvestigating,
+		models.ExceptionStatusWrittenOff,
+		models.ExceptionStatusResolved,
+	},
+}
+
+// ExceptionService runs the suspense queue. A sweeper moves the records left
+// unmatched longer than the configured age into it and resolves the ones
+// matched since; operators assign, comment on and move the rest through the
+// workflow, every change leaving an event in the exception's audit trail.
+type ExceptionService struct {
+	exceptionRepo      repositories.ExceptionRepository
+	policies           *PolicyPackService
+	jobService         *JobService
+	maintenanceService *MaintenanceService
+}
+
+func NewExceptionService(exceptionRepo repositories.ExceptionRepository, policies *PolicyPackService, jobService *JobService, maintenanceService *MaintenanceService) *ExceptionService {
+	return &ExceptionService{
+		exceptionRepo:      exceptionRepo,
+		policies:           policies,
+		jobService:         jobService,
+		maintenanceService: maintenanceService,
+	}
+}
+
+// exceptionsCursor names the exception queue in its cursors
+const exceptionsCursor = "exceptions"
+
+// ListExceptions lists the queue oldest record first, optionally of one
+// status, owner or record type, from the cursor a previous page returned,
+// and the cursor of the next page
+func (s *ExceptionService) ListExceptions(status, owner, recordType, cursor string, limit int) ([]*models.ReconciliationException, string, error) {
+	status = strings.ToLower(strings.TrimSpace(status))
+	recordType = strings.ToLower(strings.TrimSpace(recordType))
+	if status != "" && !validExceptionStatus(status) {
+		return nil, "", fmt.Errorf("%w: unknown status %q", ErrInvalidException, status)
+	}
+	if recordType != "" && recordType != models.ExceptionRecordBankTransaction && recordType != models.ExceptionRecordAccountingEntry {
+		return nil, "", fmt.Errorf("%w: record_type must be %s or %s", ErrInvalidException,
+			models.ExceptionRecordBankTransaction, models.ExceptionRecordAccountingEntry)
+	}
+	if limit <= 0 {
+		limit = DefaultExceptionLimit
+	}
+	if limit > MaxExceptionLimit {
+		limit = MaxExceptionLimit
+	}
+	after, err := pagination.Decode(cursor, exceptionsCursor)
+	if err != nil {
+		return nil, "", err
+	}
+	afterDate, afterID := after.Key()
+	exceptions, err := s.exceptionRepo.ListExceptions(status, strings.TrimSpace(owner), recordType, afterDate, afterID, limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	exceptions, next := pagination.Next(exceptions, limit, func(exception *models.ReconciliationException) pagination.Cursor {
+		return pagination.Cursor{List: exceptionsCursor, ID: exception.ID, Date: exception.RecordDate}
+	})
+	return exceptions, next, nil
+}
+
+// GetException returns an exception with its audit trail
+func (s *ExceptionService) GetException(id int64) (*models.ReconciliationException, error) {
+	exception, err := s.exceptionRepo.GetException(id)
+	if err != nil {
+		return nil, err
+	}
+	if exception.Events, err = s.exceptionRepo.GetEvents(id); err != nil {
+		return nil, fmt.Errorf("failed to get exception events: %v", err)
+	}
+	return exception, nil
+}
+
+// Transition moves an exception to another state. A version of 0 skips the
+// concurrency check. Writing an exception off requires a comment saying why,
+// and is refused above the write-off limit of its account's policy pack.
+func (s *ExceptionService) Transition(id int64, version int, status, comment, userID string) (*models.ReconciliationException, error) {
+	status = strings.ToLower(strings.TrimSpace(status))
+	comment = strings.TrimSpace(comment)
+	if status == models.ExceptionStatusWrittenOff && comment == "" {
+		return nil, fmt.Errorf("%w: a comment is required to write an exception off", ErrInvalidException)
+	}
+
+	exception, version, err := s.load(id, version)
+	if err != nil {
+		return nil, err
+	}
+	if !canTransition(exception.Status, status) {
+		return nil, fmt.Errorf("%w: cannot move from %s to %q", ErrInvalidException, exception.Status, status)
+	}
+	if status == models.ExceptionStatusWrittenOff && s.policies != nil {
+		pack, err := s.policies.AccountPack(exception.Account)
+		if err != nil {
+			return nil, err
+		}
+		if pack != nil && exception.Amount.Abs() > pack.WriteOffLimit {
+			return nil, fmt.Errorf("%w: policy pack %s writes off at most %s", ErrInvalidException, pack.Name, pack.WriteOffLimit)
+		}
+	}
+
+	event := &models.ExceptionEvent{
+		Action:       models.ExceptionEventTransitioned,
+		StatusBefore: exception.Status,
+		StatusAfter:  status,
+		Owner:        exception.Owner,
+		Comment:      comment,
+		UserID:       userID,
+	}
+	exception.Status = status
+	if status == models.ExceptionStatusWrittenOff || status == models.ExceptionStatusResolved {
+		now := time.Now()
+		exception.ClosedAt = &now
+	}
+	if err := s.exceptionRepo.UpdateException(exception, version, event); err != nil {
+		return nil, err
+	}
+	return exception, nil
+}
+
+// Assign hands an open exception to an owner; an empty owner unassigns it
+func (s *ExceptionService) Assign(id int64, version int, owner, comment, userID string) (*models.ReconciliationException, error) {
+	owner = strings.TrimSpace(owner)
+	if len(owner) > 100 {
+		return nil, fmt.Errorf("%w: owner must be at most 100 characters", ErrInvalidException)
+	}
+
+	exception, version, err := s.load(id, version)
+	if err != nil {
+		return nil, err
+	}
+	if _, open := exceptionTransitions[exception.Status]; !open {
+		return nil, fmt.Errorf("%w: exception is %s", ErrInvalidException, exception.Status)
+	}
+
+	event := &models.ExceptionEvent{
+		Action:       models.ExceptionEventAssigned,
+		StatusBefore: exception.Status,
+		StatusAfter:  exception.Status,
+		Owner:        owner,
+		Comment:      strings.TrimSpace(comment),
+		UserID:       userID,
+	}
+	exception.Owner = owner
+	if err := s.exceptionRepo.UpdateException(exception, version, event); err != nil {
+		return nil, err
+	}
+	return exception, nil
+}
+
+// AddComment adds a comment to the audit trail of an exception, open or
+// closed
+func (s *ExceptionService) AddComment(id int64, comment, userID string) (*models.ExceptionEvent, error) {
+	comment = strings.TrimSpace(comment)
+	if comment == "" {
+		return nil, fmt.Errorf("%w: comment is required", ErrInvalidException)
+	}
+	exception, err := s.exceptionRepo.GetException(id)
+	if err != nil {
+		return nil, err
+	}
+
+	event := &models.ExceptionEvent{
+		ExceptionID:  exception.ID,
+		Action:       models.ExceptionEventCommented,
+		StatusBefore: exception.Status,
+		StatusAfter:  exception.Status,
+		Owner:        exception.Owner,
+		Comment:      comment,
+		UserID:       userID,
+	}
+	if err := s.exceptionRepo.CreateEvent(event); err != nil {
+		return nil, fmt.Errorf("failed to add comment: %v", err)
+	}
+	return event, nil
+}
+
+// load returns an exception and the version to update it at, its current
+// one when the caller gave none
+func (s *ExceptionService) load(id int64, version int) (*models.ReconciliationException, int, error) {
+	exception, err := s.exceptionRepo.GetException(id)
+	if err != nil {
+		return nil, 0, err
+	}
+	if version == 0 {
+		version = exception.Version
+	}
+	if version != exception.Version {
+		return nil, 0, repositories.ErrExceptionConflict
+	}
+	return exception, version, nil
+}
+
+// Sweep resolves the exceptions whose record has been matched or voided and
+// queues the records left unmatched for more than ageDays
+func (s *ExceptionService) Sweep(ageDays int) (raised, resolved int, err error) {
+	if resolved, err = s.exceptionRepo.ResolveMatched(); err != nil {
+		return 0, 0, fmt.Errorf("failed to resolve matched exceptions: %v", err)
+	}
+	cutoff := time.Now().AddDate(0, 0, -ageDays).Format("2006-01-02")
+	if raised, err = s.exceptionRepo.RaiseAged(cutoff); err != nil {
+		return 0, resolved, fmt.Errorf("failed to raise exceptions: %v", err)
+	}
+	return raised, resolved, nil
+}
+
+// RunSweeper sweeps the queue every interval until ctx is cancelled. Nothing
+// is swept during maintenance or shutdown.
+func (s *ExceptionService) RunSweeper(ctx context.Context, interval time.Duration, ageDays int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if !s.jobService.Draining() && !s.maintenanceService.Enabled() {
+			raised, resolved, err := s.Sweep(ageDays)
+			if err != nil {
+				log.Printf("exceptions: %v", err)
+			}
+			if raised > 0 || resolved > 0 {
+				log.Printf("exceptions: queued %d records unmatched for over %d days, resolved %d matched since", raised, ageDays, resolved)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func validExceptionStatus(status string) bool {
+	switch status {
+	case models.ExceptionStatusNew, models.ExceptionStatusInvestigating, models.ExceptionStatusEscalated,
+		models.ExceptionStatusWrittenOff, models.ExceptionStatusResolved:
+		return true
+	}
+	return false
+}
+
+func canTransition(from, to string) bool {
+	for _, allowed := range exceptionTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
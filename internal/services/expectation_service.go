@@ -0,0 +1,303 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"reconciliation-service/internal/currency"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/pagination"
+	"reconciliation-service/internal/repositories"
+)
+
+var (
+	// ErrInvalidExpectation wraps every rejection of an expected payment
+	ErrInvalidExpectation = errors.New("invalid expectation")
+
+	// ErrExpectationClosed means the expectation was already matched or
+	// cancelled
+	ErrExpectationClosed = errors.New("expectation is already closed")
+)
+
+const (
+	DefaultExpectationLimit = 100
+	MaxExpectationLimit     = 1000
+)
+
+// ExpectationService keeps the registry of payments upstream systems expect
+// on the bank accounts. Batches match bank transactions against it before
+// matching the ledger, and a watcher marks the expectations nothing
+// fulfilled within their window as missed.
+type ExpectationService struct {
+	expectationRepo    repositories.ExpectationRepository
+	jobService         *JobService
+	maintenanceService *MaintenanceService
+}
+
+func NewExpectationService(expectationRepo repositories.ExpectationRepository, jobService *JobService, maintenanceService *MaintenanceService) *ExpectationService {
+	return &ExpectationService{
+		expectationRepo:    expectationRepo,
+		jobService:         jobService,
+		maintenanceService: maintenanceService,
+	}
+}
+
+// Register validates and stores an expectation, returning it as stored. An
+// external ID may be registered once per source.
+func (s *ExpectationService) Register(expectation *models.ExpectedPayment, userID string) (*models.ExpectedPayment, error) {
+	expectation.Source = strings.TrimSpace(expectation.Source)
+	expectation.ExternalID = strings.TrimSpace(expectation.ExternalID)
+	expectation.Direction = strings.ToLower(strings.TrimSpace(expectation.Direction))
+	expectation.AccountNumber = strings.TrimSpace(expectation.AccountNumber)
+	expectation.Currency = strings.ToUpper(strings.TrimSpace(expectation.Currency))
+	expectation.Reference = strings.TrimSpace(expectation.Reference)
+	expectation.CreatedBy = userID
+
+	switch {
+	case expectation.ExternalID == "":
+		return nil, fmt.Errorf("%w: external_id is required", ErrInvalidExpectation)
+	case len(expectation.ExternalID) > 100 || len(expectation.Source) > 100:
+		return nil, fmt.Errorf("%w: source and external_id must be at most 100 characters", ErrInvalidExpectation)
+	case expectation.Direction != models.ExpectedDirectionIncoming && expectation.Direction != models.ExpectedDirectionOutgoing:
+		return nil, fmt.Errorf("%w: direction must be %s or %s", ErrInvalidExpectation, models.ExpectedDirectionIncoming, models.ExpectedDirectionOutgoing)
+	case expectation.Amount <= 0:
+		return nil, fmt.Errorf("%w: amount must be positive", ErrInvalidExpectation)
+	case expectation.Currency != "" && !currency.Supported(expectation.Currency):
+		return nil, fmt.Errorf("%w: unsupported currency %q", ErrInvalidExpectation, expectation.Currency)
+	case expectation.Reference == "":
+		return nil, fmt.Errorf("%w: reference is required", ErrInvalidExpectation)
+	case len(expectation.Reference) > 255:
+		return nil, fmt.Errorf("%w: reference must be at most 255 characters", ErrInvalidExpectation)
+	}
+	start, err := time.Parse("2006-01-02", expectation.WindowStart)
+	if err != nil {
+		return nil, fmt.Errorf("%w: window_start must be YYYY-MM-DD", ErrInvalidExpectation)
+	}
+	end, err := time.Parse("2006-01-02", expectation.WindowEnd)
+	if err != nil {
+		return nil, fmt.Errorf("%w: window_end must be YYYY-MM-DD", ErrInvalidExpectation)
+	}
+	if end.Before(start) {
+		return nil, fmt.Errorf("%w: window_end is before window_start", ErrInvalidExpectation)
+	}
+
+	if err := s.expectationRepo.CreateExpectation(expectation); err != nil {
+		if errors.Is(err, repositories.ErrExpectationConflict) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to store expectation: %v", err)
+	}
+	return s.expectationRepo.GetExpectation(expectation.ID)
+}
+
+func (s *ExpectationService) GetExpectation(id int64) (*models.ExpectedPayment, error) {
+	return s.expectationRepo.GetExpectation(id)
+}
+
+// expectationsCursor names the expectation list in its cursors
+const expectationsCursor = "expectations"
+
+// ListExpectations lists the latest expectations, optionally of one status
+// or source, from the cursor a previous page returned, and the cursor of the
+// next page
+func (s *ExpectationService) ListExpectations(status, source, cursor string, limit int) ([]*models.ExpectedPayment, string, error) {
+	switch status {
+	case "", models.ExpectedStatusPending, models.ExpectedStatusMatched, models.ExpectedStatusMissed, models.ExpectedStatusCancelled:
+	default:
+		return nil, "", fmt.Errorf("%w: unknown status %q", ErrInvalidExpectation, status)
+	}
+	if limit <= 0 {
+		limit = DefaultExpectationLimit
+	}
+	if limit > MaxExpectationLimit {
+		limit = MaxExpectationLimit
+	}
+	after, err := pagination.Decode(cursor, expectationsCursor)
+	if err != nil {
+		return nil, "", err
+	}
+	_, beforeID := after.Key()
+	expectations, err := s.expectationRepo.ListExpectations(status, strings.TrimSpace(source), beforeID, limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	expectations, next := pagination.Next(expectations, limit, func(expectation *models.ExpectedPayment) pagination.Cursor {
+		return pagination.Cursor{List: expectationsCursor, ID: expectation.ID}
+	})
+	return expectations, next, nil
+}
+
+// Cancel withdraws an expectation that has not been matched
+func (s *ExpectationService) Cancel(id int64) error {
+	cancelled, err := s.expectationRepo.CancelExpectation(id)
+	if err != nil {
+		return err
+	}
+	if !cancelled {
+		return ErrExpectationClosed
+	}
+	return nil
+}
+
+// MarkMissed marks the pending expectations whose window ended before today
+// less graceDays as missed and returns them
+func (s *ExpectationService) MarkMissed(graceDays int) ([]*models.ExpectedPayment, error) {
+	before := time.Now().AddDate(0, 0, -graceDays).Format("2006-01-02")
+	missed, err := s.expectationRepo.MarkMissed(before)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark missed expectations: %v", err)
+	}
+	return missed, nil
+}
+
+// RunWatcher marks missed expectations every interval until ctx is
+// cancelled and logs each; the alerting senders deliver them as
+// expectation_missed events. Nothing is marked during maintenance or
+// shutdown.
+func (s *ExpectationService) RunWatcher(ctx context.Context, interval time.Duration, graceDays int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if !s.jobService.Draining() && !s.maintenanceService.Enabled() {
+			missed, err := s.MarkMissed(graceDays)
+			if err != nil {
+				log.Printf("expectations: %v", err)
+			}
+			for _, expectation := range missed {
+				log.Printf("expectations: %s payment %s/%s of %s expected %s to %s was not seen (%s)",
+					expectation.Direction, expectation.Source, expectation.ExternalID, expectation.Amount,
+					expectation.WindowStart, expectation.WindowEnd, models.NotificationEventExpectationMissed)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// expectationMatcher pairs bank transactions with the open expectations
+// they fulfil
+type expectationMatcher struct {
+	open []*models.ExpectedPayment
+}
+
+// loadExpectationMatcher loads the expectations open over the dates of a
+// batch's bank transactions
+func loadExpectationMatcher(expectationRepo repositories.ExpectationRepository, bankTransactions []*models.BankTransaction) (*expectationMatcher, error) {
+	if len(bankTransactions) == 0 {
+		return &expectationMatcher{}, nil
+	}
+	from, to := dateOnly(bankTransactions[0].TransactionDate), dateOnly(bankTransactions[0].TransactionDate)
+	for _, bt := range bankTransactions[1:] {
+		date := dateOnly(bt.TransactionDate)
+		if date < from {
+			from = date
+		}
+		if date > to {
+			to = date
+		}
+	}
+	open, err := expectationRepo.ListOpen(from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load expectations: %v", err)
+	}
+	return &expectationMatcher{open: open}, nil
+}
+
+// expectationMatch is a bank transaction fulfilling an expectation
+type expectationMatch struct {
+	expectation     *models.ExpectedPayment
+	bankTransaction *models.BankTransaction
+}
+
+// match pairs each expectation with at most one transaction and each
+// transaction with at most one expectation. Transactions are taken by date
+// and ID, expectations by the earliest window end.
+func (m *expectationMatcher) match(bankTransactions []*models.BankTransaction) []*expectationMatch {
+	if m == nil || len(m.open) == 0 {
+		return nil
+	}
+	ordered := append([]*models.BankTransaction(nil), bankTransactions...)
+	sort.Slice(ordered, func(i, j int) bool {
+		if di, dj := dateOnly(ordered[i].TransactionDate), dateOnly(ordered[j].TransactionDate); di != dj {
+			return di < dj
+		}
+		return ordered[i].ID < ordered[j].ID
+	})
+
+	taken := make(map[int64]bool)
+	var matches []*expectationMatch
+	for _, bt := range ordered {
+		for _, expectation := range m.open {
+			if !taken[expectation.ID] && fulfils(bt, expectation) {
+				taken[expectation.ID] = true
+				matches = append(matches, &expectationMatch{expectation: expectation, bankTransaction: bt})
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// fulfils reports whether a bank transaction is the expected payment: the
+// same direction and amount, on the account and in the currency when the
+// expectation names them, dated in the window, with the reference in one of
+// its reference fields or its description
+func fulfils(bt *models.BankTransaction, expectation *models.ExpectedPayment) bool {
+	switch expectation.Direction {
+	case models.ExpectedDirectionIncoming:
+		if bt.Amount != expectation.Amount {
+			return false
+		}
+	case models.ExpectedDirectionOutgoing:
+		if bt.Amount != -expectation.Amount {
+			return false
+		}
+	default:
+		return false
+	}
+	if expectation.AccountNumber != "" && bt.AccountNumber != expectation.AccountNumber {
+		return false
+	}
+	if expectation.Currency != "" && bt.Currency != "" && bt.Currency != expectation.Currency {
+		return false
+	}
+	date := dateOnly(bt.TransactionDate)
+	if date < expectation.WindowStart || date > expectation.WindowEnd {
+		return false
+	}
+
+	reference := strings.ToUpper(expectation.Reference)
+	for _, field := range []string{bt.ReferenceNumber, bt.EndToEndID, bt.CreditorReference, bt.RemittanceInformation, bt.Description} {
+		if strings.Contains(strings.ToUpper(field), reference) {
+			return true
+		}
+	}
+	return false
+}
+
+// fulfilExpectations links the expectations a batch's transactions fulfil.
+// One closed or fulfilled by a concurrent batch meanwhile is left out.
+func fulfilExpectations(tx *sql.Tx, expectationRepo repositories.ExpectationRepository, batchID string, matches []*expectationMatch) ([]*expectationMatch, error) {
+	var fulfilled []*expectationMatch
+	for _, match := range matches {
+		ok, err := expectationRepo.FulfilExpectation(tx, match.expectation.ID, match.bankTransaction.ID, batchID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fulfil expectation %d: %w", match.expectation.ID, err)
+		}
+		if ok {
+			fulfilled = append(fulfilled, match)
+		}
+	}
+	return fulfilled, nil
+}
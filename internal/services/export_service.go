@@ -0,0 +1,377 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"reconciliation-service/internal/i18n"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+	"reconciliation-service/internal/storage"
+)
+
+var (
+	// ErrInvalidExport wraps every rejection of an export request
+	ErrInvalidExport = errors.New("invalid export")
+
+	// ErrExportNotReady means the export has not completed, so there is
+	// nothing to download
+	ErrExportNotReady = errors.New("export is not ready")
+
+	// ErrInvalidDownloadLink means a download link was tampered with or has
+	// expired
+	ErrInvalidDownloadLink = errors.New("download link is invalid or expired")
+)
+
+const (
+	// exportStaleAfter is how long an export may run before another
+	// instance takes it over, as after a crash
+	exportStaleAfter = 30 * time.Minute
+
+	exportCallbackTimeout = 10 * time.Second
+)
+
+type batchReportParams struct {
+	BatchID string `json:"batch_id"`
+}
+
+// ExportLinks signs download links to completed exports, so they can be
+// handed to clients that do not hold an API token
+type ExportLinks struct {
+	key     []byte
+	ttl     time.Duration
+	baseURL string
+}
+
+// NewExportLinks signs links valid for ttl with key. baseURL, such as
+// https://recon.example.com, makes links absolute; links are relative to the
+// server without it.
+func NewExportLinks(key string, ttl time.Duration, baseURL string) *ExportLinks {
+	return &ExportLinks{key: []byte(key), ttl: ttl, baseURL: strings.TrimRight(baseURL, "/")}
+}
+
+// Sign returns a link to an export's download and when it expires
+func (l *ExportLinks) Sign(id int64, now time.Time) (string, time.Time) {
+	expires := now.Add(l.ttl).Truncate(time.Second)
+	link := fmt.Sprintf("%s/api/v1/exports/%d/download?expires=%d&signature=%s",
+		l.baseURL, id, expires.Unix(), l.signature(id, expires.Unix()))
+	return link, expires
+}
+
+// Verify reports whether a link's expiry and signature are the ones Sign
+// gave and the expiry has not passed
+func (l *ExportLinks) Verify(id, expires int64, signature string, now time.Time) bool {
+	if now.Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(l.signature(id, expires)))
+}
+
+func (l *ExportLinks) signature(id, expires int64) string {
+	mac := hmac.New(sha256.New, l.key)
+	fmt.Fprintf(mac, "%d:%d", id, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ExportService writes exports too large to stream in a request. They are
+// queued as export jobs that a worker on any instance writes to object
+// storage; the client polls the job, or is called back when it finishes, and
+// downloads the file through a signed link.
+type ExportService struct {
+	exportRepo            repositories.ExportRepository
+	reconciliationService *ReconciliationService
+	jobService            *JobService
+	maintenanceService    *MaintenanceService
+	store                 storage.Store
+	links                 *ExportLinks
+	artifacts             *ArtifactService
+	rowThreshold          int
+	instanceID            string
+	client                *http.Client
+}
+
+func NewExportService(
+	exportRepo repositories.ExportRepository,
+	reconciliationService *ReconciliationService,
+	jobService *JobService,
+	maintenanceService *MaintenanceService,
+	store storage.Store,
+	links *ExportLinks,
+	artifacts *ArtifactService,
+	rowThreshold int,
+	instanceID string,
+) *ExportService {
+	return &ExportService{
+		exportRepo:            exportRepo,
+		reconciliationService: reconciliationService,
+		jobService:            jobService,
+		maintenanceService:    maintenanceService,
+		store:                 store,
+		links:                 links,
+		artifacts:             artifacts,
+		rowThreshold:          rowThreshold,
+		instanceID:            instanceID,
+		client:                &http.Client{Timeout: exportCallbackTimeout},
+	}
+}
+
+// ExceedsThreshold reports whether a batch's report has more rows than may
+// be streamed in a request
+func (s *ExportService) ExceedsThreshold(batchID string) (bool, error) {
+	if s.rowThreshold <= 0 {
+		return false, nil
+	}
+	rows, err := s.reconciliationService.CountBatchReportRows(batchID)
+	if err != nil {
+		return false, fmt.Errorf("failed to count report rows: %v", err)
+	}
+	return rows > s.rowThreshold, nil
+}
+
+// RequestBatchReport queues an export of a batch's report. callbackURL, when
+// given, is sent the finished export.
+func (s *ExportService) RequestBatchReport(ctx context.Context, batchID, format, locale, callbackURL, requestedBy string) (*models.ExportJob, error) {
+	if err := validReportFormat(format); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidExport, err)
+	}
+	callbackURL = strings.TrimSpace(callbackURL)
+	if callbackURL != "" {
+		u, err := url.Parse(callbackURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("%w: callback_url must be an http(s) URL", ErrInvalidExport)
+		}
+	}
+	if _, err := s.reconciliationService.reconciliationRepo.GetReconciliationByBatchID(ctx, batchID); err != nil {
+		return nil, fmt.Errorf("failed to get reconciliation: %w", err)
+	}
+
+	params, err := json.Marshal(batchReportParams{BatchID: batchID})
+	if err != nil {
+		return nil, err
+	}
+	export := &models.ExportJob{
+		Kind:        models.ExportKindBatchReport,
+		Format:      format,
+		Params:      params,
+		Locale:      locale,
+		Status:      models.ExportStatusQueued,
+		CallbackURL: callbackURL,
+		RequestedBy: requestedBy,
+	}
+	if err := s.exportRepo.CreateExport(export); err != nil {
+		return nil, fmt.Errorf("failed to queue export: %v", err)
+	}
+	return s.GetExport(export.ID)
+}
+
+// GetExport returns an export, with its artifact and a fresh download link
+// once it has completed
+func (s *ExportService) GetExport(id int64) (*models.ExportJob, error) {
+	export, err := s.exportRepo.GetExport(id)
+	if err != nil {
+		return nil, err
+	}
+	if export.ArtifactID != nil {
+		if export.Artifact, err = s.artifacts.GetArtifact(*export.ArtifactID); err != nil {
+			return nil, fmt.Errorf("failed to get artifact: %w", err)
+		}
+	}
+	if export.Status == models.ExportStatusCompleted {
+		link, expires := s.links.Sign(export.ID, time.Now())
+		export.DownloadURL = link
+		export.DownloadExpiresAt = &expires
+	}
+	return export, nil
+}
+
+// OpenDownload checks a signed link and opens the file of its export
+func (s *ExportService) OpenDownload(id int64, expires, signature string) (*models.ExportJob, io.ReadCloser, error) {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || !s.links.Verify(id, expiresAt, signature, time.Now()) {
+		return nil, nil, ErrInvalidDownloadLink
+	}
+	export, err := s.exportRepo.GetExport(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if export.Status != models.ExportStatusCompleted {
+		return nil, nil, ErrExportNotReady
+	}
+	file, err := s.store.Open(export.ObjectKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open export: %w", err)
+	}
+	return export, file, nil
+}
+
+// ExportFilename names the file an export is downloaded as
+func ExportFilename(export *models.ExportJob) string {
+	return export.ObjectKey[strings.LastIndex(export.ObjectKey, "/")+1:]
+}
+
+// ExportContentType is the media type of an export's file
+func ExportContentType(export *models.ExportJob) string {
+	return ReportContentType(export.Format)
+}
+
+// RunWorker writes queued exports every pollInterval until ctx is
+// cancelled. Nothing is started during maintenance or shutdown; an export
+// interrupted by shutdown goes back in the queue.
+func (s *ExportService) RunWorker(ctx context.Context, pollInterval time.Duration) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		for ctx.Err() == nil && !s.jobService.Draining() && !s.maintenanceService.Enabled() {
+			if !s.runNext(ctx) {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runNext writes one claimed export and reports whether there was one
+func (s *ExportService) runNext(ctx context.Context) bool {
+	export, err := s.exportRepo.ClaimExport(s.instanceID, time.Now().Add(-exportStaleAfter))
+	if err != nil {
+		log.Printf("export worker: failed to claim export: %v", err)
+		return false
+	}
+	if export == nil {
+		return false
+	}
+
+	log.Printf("Writing export %d (%s, %s)", export.ID, export.Kind, export.Format)
+	key, size, artifact, err := s.write(ctx, export)
+	if err != nil && ctx.Err() != nil {
+		if err := s.exportRepo.ReleaseExport(export.ID); err != nil {
+			log.Printf("export worker: failed to release export %d: %v", export.ID, err)
+		}
+		return false
+	}
+
+	now := time.Now()
+	export.FinishedAt = &now
+	if err != nil {
+		export.Status = models.ExportStatusFailed
+		export.Error = err.Error()
+		log.Printf("Export %d failed: %v", export.ID, err)
+	} else {
+		export.Status = models.ExportStatusCompleted
+		export.ObjectKey = key
+		export.SizeBytes = size
+		export.ArtifactID = &artifact.ID
+	}
+	if err := s.exportRepo.FinishExport(export); err != nil {
+		log.Printf("export worker: failed to record completion of export %d: %v", export.ID, err)
+		return true
+	}
+	if export.CallbackURL != "" {
+		s.callback(export.ID)
+	}
+	return true
+}
+
+// write stores an export's file, registers it as a signed artifact and
+// returns its key, size and artifact. A partly written file, or one that
+// could not be registered, is removed.
+func (s *ExportService) write(ctx context.Context, export *models.ExportJob) (string, int64, *models.ReportArtifact, error) {
+	if export.Kind != models.ExportKindBatchReport {
+		return "", 0, nil, fmt.Errorf("unknown export kind %q", export.Kind)
+	}
+	var params batchReportParams
+	if err := json.Unmarshal(export.Params, &params); err != nil {
+		return "", 0, nil, fmt.Errorf("invalid export params: %v", err)
+	}
+
+	labels := make([]string, len(BatchReportColumns))
+	for i, column := range BatchReportColumns {
+		labels[i] = i18n.Label(export.Locale, column)
+	}
+
+	filename := BatchReportFilename(params.BatchID, export.Format)
+	key := fmt.Sprintf("exports/%d/%s", export.ID, filename)
+	var file io.WriteCloser
+	hash := sha256.New()
+	counter := &countingWriter{}
+	err := s.reconciliationService.WriteBatchReport(ctx, params.BatchID, export.Format, labels, func() (io.Writer, error) {
+		created, err := s.store.Create(key)
+		if err != nil {
+			return nil, err
+		}
+		file = created
+		counter.w = io.MultiWriter(created, hash)
+		return counter, nil
+	})
+	if file != nil {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	var artifact *models.ReportArtifact
+	if err == nil {
+		artifact, err = s.artifacts.SignHash(models.ArtifactKindBatchReport, params.BatchID, export.Format, filename,
+			hex.EncodeToString(hash.Sum(nil)), counter.n)
+	}
+	if err != nil {
+		if file != nil {
+			s.store.Delete(key)
+		}
+		return "", 0, nil, err
+	}
+	return key, counter.n, artifact, nil
+}
+
+// callback posts a finished export, with its download link, to the callback
+// URL it was requested with. It is tried once; a client that misses it can
+// still poll the export.
+func (s *ExportService) callback(id int64) {
+	export, err := s.GetExport(id)
+	if err != nil {
+		log.Printf("export worker: failed to load export %d for its callback: %v", id, err)
+		return
+	}
+	body, err := json.Marshal(export)
+	if err != nil {
+		return
+	}
+	resp, err := s.client.Post(export.CallbackURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("export worker: callback for export %d failed: %v", id, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("export worker: callback for export %d answered %s", id, resp.Status)
+	}
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"reconciliation-service/internal/config"
+	"reconciliation-service/internal/models"
+)
+
+var (
+	ErrReadOnly    = errors.New("the primary database is unavailable, the service is read-only")
+	ErrOutboxFull  = errors.New("the write outbox is full")
+	ErrNotQueueing = errors.New("writes are not being queued")
+)
+
+// FailoverService watches the primary database. After FailureThreshold
+// failed pings in a row the service turns read-only: reads go to the replica
+// when there is one, and idempotent writes are held in an in-memory outbox.
+// Once the primary answers again the outbox is replayed in order, and the
+// service turns writable when it is empty, so queued writes are not
+// overtaken by new ones.
+type FailoverService struct {
+	primary *sql.DB
+	replica bool
+	config  config.FailoverConfig
+
+	mu        sync.Mutex
+	readOnly  bool
+	since     time.Time
+	lastError string
+	failures  int
+	outbox    []*models.QueuedWrite
+	nextID    int64
+	replayed  int
+	failed    int
+
+	// replay sends a queued write to the primary and returns its status
+	replay func(*models.QueuedWrite) int
+}
+
+func NewFailoverService(primary *sql.DB, replica bool, cfg config.FailoverConfig) *FailoverService {
+	return &FailoverService{
+		primary: primary,
+		replica: replica,
+		config:  cfg,
+	}
+}
+
+// SetReplayer names what replays queued writes; without one none is queued
+func (s *FailoverService) SetReplayer(replay func(*models.QueuedWrite) int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replay = replay
+}
+
+// ReadOnly reports whether writes are currently held back. A nil service is
+// never read-only.
+func (s *FailoverService) ReadOnly() bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.readOnly
+}
+
+// Replica reports whether reads go to a replica while read-only
+func (s *FailoverService) Replica() bool {
+	return s != nil && s.replica
+}
+
+// RetryAfter is how long a refused write should wait before trying again
+func (s *FailoverService) RetryAfter() time.Duration {
+	return time.Duration(s.config.FailureThreshold) * s.config.CheckInterval
+}
+
+func (s *FailoverService) Status() *models.FailoverStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := &models.FailoverStatus{
+		ReadOnly:            s.readOnly,
+		LastError:           s.lastError,
+		ConsecutiveFailures: s.failures,
+		Replica:             s.replica,
+		QueuedWrites:        len(s.outbox),
+		OutboxCapacity:      s.config.OutboxSize,
+		Replayed:            s.replayed,
+		ReplayFailed:        s.failed,
+	}
+	if s.readOnly {
+		since := s.since
+		status.Since = &since
+	}
+	return status
+}
+
+// Enqueue holds a write for replay and returns its position in the outbox
+func (s *FailoverService) Enqueue(write *models.QueuedWrite) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.readOnly || s.replay == nil {
+		return 0, ErrNotQueueing
+	}
+	if len(s.outbox) >= s.config.OutboxSize {
+		return 0, fmt.Errorf("%w: %d writes are waiting", ErrOutboxFull, len(s.outbox))
+	}
+	s.nextID++
+	write.ID = s.nextID
+	write.QueuedAt = time.Now()
+	s.outbox = append(s.outbox, write)
+	return len(s.outbox), nil
+}
+
+// RunMonitor pings the primary every check interval until ctx is done
+func (s *FailoverService) RunMonitor(ctx context.Context) {
+	ticker := time.NewTicker(s.config.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		s.check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *FailoverService) check(ctx context.Context) {
+	err := s.ping(ctx)
+
+	s.mu.Lock()
+	if err != nil {
+		s.failures++
+		s.lastError = err.Error()
+		if !s.readOnly && s.failures >= s.config.FailureThreshold {
+			s.readOnly = true
+			s.since = time.Now()
+			log.Printf("primary database unavailable after %d failed checks, switching to read-only: %v", s.failures, err)
+		}
+		s.mu.Unlock()
+		return
+	}
+	s.failures = 0
+	recovering := s.readOnly
+	s.mu.Unlock()
+
+	if recovering {
+		s.recover(ctx)
+	}
+}
+
+func (s *FailoverService) ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, s.config.CheckInterval)
+	defer cancel()
+	return s.primary.PingContext(ctx)
+}
+
+// recover replays the outbox in order and turns the service writable once it
+// is empty. A primary lost again midway leaves the rest queued for the next
+// recovery.
+func (s *FailoverService) recover(ctx context.Context) {
+	for {
+		s.mu.Lock()
+		if len(s.outbox) == 0 {
+			s.readOnly = false
+			s.lastError = ""
+			s.mu.Unlock()
+			log.Printf("primary database is back, read-only mode off")
+			return
+		}
+		write, replay := s.outbox[0], s.replay
+		s.mu.Unlock()
+
+		if err := s.ping(ctx); err != nil {
+			s.mu.Lock()
+			s.lastError = err.Error()
+			s.mu.Unlock()
+			return
+		}
+
+		status := replay(write)
+		s.mu.Lock()
+		s.outbox = s.outbox[1:]
+		if status >= 200 && status < 300 {
+			s.replayed++
+		} else {
+			s.failed++
+			log.Printf("queued write %d (%s %s by %s) was refused on replay with status %d", write.ID, write.Method, write.URI, write.Caller, status)
+		}
+		s.mu.Unlock()
+	}
+}
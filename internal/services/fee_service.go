@@ -0,0 +1,334 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"reconciliation-service/internal/currency"
+	"reconciliation-service/internal/matching"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/money"
+	"reconciliation-service/internal/repositories"
+)
+
+// ErrInvalidFeeSchedule wraps every rejection of fee schedule input
+var ErrInvalidFeeSchedule = errors.New("invalid fee schedule")
+
+const feePeriodLayout = "2006-01"
+
+// FeeService keeps the bank fee schedules of each account. Batches classify
+// the debits a schedule describes as fees, so they are not left unmatched
+// for want of an accounting entry, and each period's fees are compared with
+// what the contract expects.
+type FeeService struct {
+	feeRepo repositories.FeeRepository
+}
+
+func NewFeeService(feeRepo repositories.FeeRepository) *FeeService {
+	return &FeeService{
+		feeRepo: feeRepo,
+	}
+}
+
+// CreateSchedule validates and stores a schedule, returning it as stored
+func (s *FeeService) CreateSchedule(schedule *models.FeeSchedule, userID string) (*models.FeeSchedule, error) {
+	if err := normalizeFeeSchedule(schedule); err != nil {
+		return nil, err
+	}
+	schedule.UpdatedBy = userID
+	if err := s.feeRepo.CreateSchedule(schedule); err != nil {
+		if errors.Is(err, repositories.ErrFeeScheduleConflict) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to store fee schedule: %v", err)
+	}
+	return s.feeRepo.GetSchedule(schedule.ID)
+}
+
+// UpdateSchedule replaces a schedule. Fees already recognized keep the
+// schedule they were recognized for.
+func (s *FeeService) UpdateSchedule(schedule *models.FeeSchedule, userID string) (*models.FeeSchedule, error) {
+	if err := normalizeFeeSchedule(schedule); err != nil {
+		return nil, err
+	}
+	schedule.UpdatedBy = userID
+	if err := s.feeRepo.UpdateSchedule(schedule); err != nil {
+		if errors.Is(err, repositories.ErrFeeScheduleNotFound) || errors.Is(err, repositories.ErrFeeScheduleConflict) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to update fee schedule: %v", err)
+	}
+	return s.feeRepo.GetSchedule(schedule.ID)
+}
+
+func normalizeFeeSchedule(schedule *models.FeeSchedule) error {
+	schedule.AccountNumber = strings.TrimSpace(schedule.AccountNumber)
+	schedule.Name = strings.TrimSpace(schedule.Name)
+	schedule.Currency = strings.ToUpper(strings.TrimSpace(schedule.Currency))
+	schedule.DescriptionPattern = strings.TrimSpace(schedule.DescriptionPattern)
+	switch {
+	case schedule.AccountNumber == "":
+		return fmt.Errorf("%w: account_number is required", ErrInvalidFeeSchedule)
+	case schedule.Name == "":
+		return fmt.Errorf("%w: name is required", ErrInvalidFeeSchedule)
+	case len(schedule.Name) > 100:
+		return fmt.Errorf("%w: name must be at most 100 characters", ErrInvalidFeeSchedule)
+	case schedule.FeeType != models.FeeTypeMonthly && schedule.FeeType != models.FeeTypePerTransaction:
+		return fmt.Errorf("%w: fee_type must be %s or %s", ErrInvalidFeeSchedule, models.FeeTypeMonthly, models.FeeTypePerTransaction)
+	case schedule.Amount <= 0:
+		return fmt.Errorf("%w: amount must be positive", ErrInvalidFeeSchedule)
+	case schedule.Tolerance < 0:
+		return fmt.Errorf("%w: tolerance must not be negative", ErrInvalidFeeSchedule)
+	case schedule.Currency != "" && !currency.Supported(schedule.Currency):
+		return fmt.Errorf("%w: unsupported currency %q", ErrInvalidFeeSchedule, schedule.Currency)
+	case schedule.DescriptionPattern == "":
+		return fmt.Errorf("%w: description_pattern is required", ErrInvalidFeeSchedule)
+	case len(schedule.DescriptionPattern) > 255:
+		return fmt.Errorf("%w: description_pattern must be at most 255 characters", ErrInvalidFeeSchedule)
+	}
+	return nil
+}
+
+func (s *FeeService) GetSchedule(id int64) (*models.FeeSchedule, error) {
+	return s.feeRepo.GetSchedule(id)
+}
+
+func (s *FeeService) ListSchedules(accountNumber string) ([]*models.FeeSchedule, error) {
+	return s.feeRepo.ListSchedules(strings.TrimSpace(accountNumber), false)
+}
+
+func (s *FeeService) DeleteSchedule(id int64) error {
+	return s.feeRepo.DeleteSchedule(id)
+}
+
+// Expectations compares every active schedule's expected fees in a period
+// (YYYY-MM) with the fees recognized in it. A per-transaction fee is
+// expected once for each other transaction of the account in the period.
+func (s *FeeService) Expectations(period string) ([]*models.FeeExpectation, error) {
+	start, err := time.Parse(feePeriodLayout, period)
+	if err != nil {
+		return nil, fmt.Errorf("%w: period must be YYYY-MM", ErrInvalidFeeSchedule)
+	}
+	end := start.AddDate(0, 1, -1)
+
+	schedules, err := s.feeRepo.ListSchedules("", true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load fee schedules: %v", err)
+	}
+	charges, err := s.feeRepo.ListCharges(period)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load fee charges: %v", err)
+	}
+	bySchedule := make(map[int64][]*models.FeeCharge)
+	for _, charge := range charges {
+		bySchedule[charge.FeeScheduleID] = append(bySchedule[charge.FeeScheduleID], charge)
+	}
+
+	expectations := make([]*models.FeeExpectation, 0, len(schedules))
+	for _, schedule := range schedules {
+		expectation := &models.FeeExpectation{
+			FeeScheduleID:  schedule.ID,
+			Name:           schedule.Name,
+			AccountNumber:  schedule.AccountNumber,
+			FeeType:        schedule.FeeType,
+			Currency:       schedule.Currency,
+			Period:         period,
+			ExpectedAmount: schedule.Amount,
+		}
+		if schedule.FeeType == models.FeeTypePerTransaction {
+			count, err := s.feeRepo.CountTransactions(schedule.AccountNumber, start.Format("2006-01-02"), end.Format("2006-01-02"))
+			if err != nil {
+				return nil, fmt.Errorf("failed to count transactions of %s: %v", schedule.AccountNumber, err)
+			}
+			expectation.Transactions = count
+			expectation.ExpectedAmount = schedule.Amount * money.Amount(count)
+		}
+		for _, charge := range bySchedule[schedule.ID] {
+			expectation.ChargedAmount += charge.Amount
+			expectation.Charges++
+		}
+		expectation.Difference = expectation.ChargedAmount - expectation.ExpectedAmount
+
+		switch {
+		case expectation.Difference.Abs() <= schedule.Tolerance:
+			expectation.Status = models.FeeStatusOK
+		case expectation.Charges == 0:
+			expectation.Status = models.FeeStatusMissing
+		default:
+			expectation.Status = models.FeeStatusDifferent
+		}
+		expectations = append(expectations, expectation)
+	}
+	return expectations, nil
+}
+
+// Exceptions returns the expectations of the periods that ended between two
+// dates whose fees are missing or differ from the contract
+func (s *FeeService) Exceptions(fromDate, toDate string) ([]*models.FeeExpectation, error) {
+	from, err := time.Parse("2006-01-02", fromDate)
+	if err != nil {
+		return nil, err
+	}
+	to, err := time.Parse("2006-01-02", toDate)
+	if err != nil {
+		return nil, err
+	}
+
+	exceptions := []*models.FeeExpectation{}
+	for month := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC); !month.After(to); month = month.AddDate(0, 1, 0) {
+		end := month.AddDate(0, 1, -1)
+		if end.Before(from) || end.After(to) {
+			continue
+		}
+		expectations, err := s.Expectations(month.Format(feePeriodLayout))
+		if err != nil {
+			return nil, err
+		}
+		for _, expectation := range expectations {
+			if expectation.Status != models.FeeStatusOK {
+				exceptions = append(exceptions, expectation)
+			}
+		}
+	}
+	return exceptions, nil
+}
+
+// feeClassifier recognizes the debits of an account that its fee schedules
+// describe
+type feeClassifier struct {
+	byAccount map[string][]*models.FeeSchedule
+}
+
+// classifier loads the active schedules for a batch, so changes apply
+// without a restart
+func (s *FeeService) classifier() (*feeClassifier, error) {
+	schedules, err := s.feeRepo.ListSchedules("", true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load fee schedules: %v", err)
+	}
+	c := &feeClassifier{byAccount: make(map[string][]*models.FeeSchedule)}
+	for _, schedule := range schedules {
+		c.byAccount[schedule.AccountNumber] = append(c.byAccount[schedule.AccountNumber], schedule)
+	}
+	return c, nil
+}
+
+// classify returns the schedule a debit is the fee of, or nil. The pattern
+// is matched case-insensitively; a schedule without a currency takes debits
+// in any.
+func (c *feeClassifier) classify(bt *models.BankTransaction) *models.FeeSchedule {
+	if c == nil || bt.Amount >= 0 {
+		return nil
+	}
+	description := strings.ToUpper(bt.Description)
+	for _, schedule := range c.byAccount[bt.AccountNumber] {
+		if schedule.Currency != "" && bt.Currency != "" && schedule.Currency != bt.Currency {
+			continue
+		}
+		if strings.Contains(description, strings.ToUpper(schedule.DescriptionPattern)) {
+			return schedule
+		}
+	}
+	return nil
+}
+
+// feeMatch is a bank debit classified as a scheduled fee
+type feeMatch struct {
+	schedule        *models.FeeSchedule
+	bankTransaction *models.BankTransaction
+}
+
+// persistFees records a reconciliation for every debit classified as a fee,
+// mapped to no accounting entry, in the canonical batch write order, and
+// the fee charges of those and of the matched debits that are fees too
+func (s *ReconciliationService) persistFees(tx *sql.Tx, batchID string, fees []*feeMatch, matchedFees []*feeMatch, userID string) error {
+	reconciliations := make([]*models.Reconciliation, len(fees))
+	for i := range fees {
+		reconciliations[i] = &models.Reconciliation{
+			BatchID:         batchID,
+			Status:          models.StatusMatched,
+			MatchConfidence: 1,
+		}
+		if err := s.reconciliationRepo.CreateReconciliation(tx, reconciliations[i]); err != nil {
+			return fmt.Errorf("failed to create reconciliation batch: %w", err)
+		}
+	}
+
+	for i, fee := range fees {
+		mapping := &models.ReconciliationMapping{
+			ReconciliationID:  reconciliations[i].ID,
+			BankTransactionID: sql.NullInt64{Int64: fee.bankTransaction.ID, Valid: true},
+			MappingType:       models.MappingFee,
+		}
+		if err := s.reconciliationRepo.CreateMapping(tx, mapping); err != nil {
+			return fmt.Errorf("failed to create mapping: %w", err)
+		}
+	}
+
+	for i, fee := range fees {
+		auditDetails, _ := json.Marshal(map[string]interface{}{
+			"match_type":      models.MappingFee,
+			"confidence":      1,
+			"match_criteria":  feeMatchCriteria(fee),
+			"fee_schedule_id": fee.schedule.ID,
+			"period":          feePeriod(fee.bankTransaction),
+		})
+		audit := &models.ReconciliationAudit{
+			ReconciliationID: reconciliations[i].ID,
+			Action:           models.AuditActionMatched,
+			Details:          auditDetails,
+			UserID:           userID,
+		}
+		if err := s.reconciliationRepo.CreateAuditEntry(tx, audit); err != nil {
+			return fmt.Errorf("failed to create audit entry: %w", err)
+		}
+	}
+
+	for i, fee := range append(fees, matchedFees...) {
+		charge := &models.FeeCharge{
+			FeeScheduleID:     fee.schedule.ID,
+			BankTransactionID: fee.bankTransaction.ID,
+			Period:            feePeriod(fee.bankTransaction),
+			Amount:            fee.bankTransaction.Amount.Abs(),
+			BatchID:           batchID,
+		}
+		if i < len(reconciliations) {
+			charge.ReconciliationID = reconciliations[i].ID
+		}
+		if err := s.fees.feeRepo.SaveCharge(tx, charge); err != nil {
+			return fmt.Errorf("failed to record fee charge: %w", err)
+		}
+	}
+	return nil
+}
+
+// feeViews renders classified fees the way batch results report matches
+func feeViews(fees []*feeMatch) []*matching.MatchesResult {
+	var m []*matching.MatchesResult
+	for _, fee := range fees {
+		m = append(m, &matching.MatchesResult{
+			Type:            models.MappingFee,
+			Confidence:      1,
+			BankTransaction: fee.bankTransaction.TransactionID,
+			AccountingEntry: fmt.Sprintf("%v", []string(nil)),
+			MatchCriteria:   feeMatchCriteria(fee),
+		})
+	}
+	return m
+}
+
+func feeMatchCriteria(fee *feeMatch) []string {
+	return []string{"fee_schedule:" + fee.schedule.Name}
+}
+
+// feePeriod is the month a fee was charged in
+func feePeriod(bt *models.BankTransaction) string {
+	if len(bt.TransactionDate) < len(feePeriodLayout) {
+		return bt.TransactionDate
+	}
+	return bt.TransactionDate[:len(feePeriodLayout)]
+}
@@ -0,0 +1,338 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"reconciliation-service/internal/banking"
+	"reconciliation-service/internal/matching"
+	"reconciliation-service/internal/money"
+	"reconciliation-service/internal/repositories"
+)
+
+// FixtureBundleFormat is the version of the fixture layout; imports reject
+// any other
+const FixtureBundleFormat = 1
+
+const (
+	// DefaultFixtureJitter bounds how far amounts are scaled when the export
+	// names no jitter; the most it may name is maxFixtureJitter
+	DefaultFixtureJitter = 0.05
+	maxFixtureJitter     = 0.5
+
+	// maxFixtureRecords bounds the bank transactions, and separately the
+	// accounting entries, one bundle holds
+	maxFixtureRecords = 100000
+)
+
+var (
+	// ErrInvalidFixture wraps every rejection of a fixture export or import
+	ErrInvalidFixture = errors.New("invalid fixture")
+
+	// ErrFixtureImportDisabled refuses loading a fixture where
+	// FIXTURE_IMPORT_ENABLED is not set, as in production
+	ErrFixtureImportDisabled = errors.New("fixture import is disabled")
+)
+
+// FixtureBundle is an anonymized copy of the records of a date range, to be
+// loaded into staging to replay a matching problem seen in production.
+// Records are in the format of the ingestion endpoints. Matches are what
+// production made of them, by the records' anonymized IDs; a match of a
+// record in the range may name records outside it.
+type FixtureBundle struct {
+	Format            int                    `json:"format"`
+	ExportedAt        time.Time              `json:"exported_at"`
+	FromDate          string                 `json:"from_date"`
+	ToDate            string                 `json:"to_date"`
+	Jitter            float64                `json:"jitter"`
+	Rules             matching.Rules         `json:"rules"`
+	BankTransactions  []BankTransactionInput `json:"bank_transactions"`
+	AccountingEntries []AccountingEntryInput `json:"accounting_entries"`
+	Matches           []*FixtureMatch        `json:"matches"`
+}
+
+// FixtureMatch is a reconciliation production made, by the anonymized IDs of
+// its records
+type FixtureMatch struct {
+	BatchID            string       `json:"reconciliation_batch_id"`
+	Status             string       `json:"status"`
+	MatchType          string       `json:"match_type"`
+	Confidence         float64      `json:"confidence"`
+	AmountDifference   money.Amount `json:"amount_difference"`
+	BankTransactionIDs []string     `json:"bank_transaction_ids"`
+	AccountingEntryIDs []string     `json:"accounting_entry_ids"`
+}
+
+// FixtureImportResult is what loading a bundle stored of each kind of record
+type FixtureImportResult struct {
+	BankTransactions  *IngestionResult `json:"bank_transactions"`
+	AccountingEntries *IngestionResult `json:"accounting_entries"`
+}
+
+// FixtureService exports the records of a date range as an anonymized
+// fixture bundle, and loads such a bundle where fixture import is enabled.
+type FixtureService struct {
+	fixtureRepo          repositories.FixtureRepository
+	ruleSets             *RuleSetService
+	dataIngestionService *DataIngestionService
+	importEnabled        bool
+}
+
+func NewFixtureService(fixtureRepo repositories.FixtureRepository, ruleSets *RuleSetService, dataIngestionService *DataIngestionService, importEnabled bool) *FixtureService {
+	return &FixtureService{
+		fixtureRepo:          fixtureRepo,
+		ruleSets:             ruleSets,
+		dataIngestionService: dataIngestionService,
+		importEnabled:        importEnabled,
+	}
+}
+
+// Export anonymizes the records dated in the range. Identifiers and words
+// of free text are replaced by keyed hashes, so values equal in production
+// stay equal in the bundle, and IBANs, BICs and creditor references stay
+// valid. Every amount is scaled by one random factor within jitter, so equal
+// amounts stay equal and sums stay within a cent per record. The key and
+// factor are drawn for each export and not kept, so a bundle cannot be
+// traced back, nor two bundles linked.
+func (s *FixtureService) Export(fromDate, toDate string, jitter float64) (*FixtureBundle, error) {
+	if jitter < 0 || jitter > maxFixtureJitter {
+		return nil, fmt.Errorf("%w: jitter must be between 0 and %g", ErrInvalidFixture, maxFixtureJitter)
+	}
+	anonymizer, err := newFixtureAnonymizer(jitter)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := s.ruleSets.ActiveRules()
+	if err != nil {
+		return nil, err
+	}
+	transactions, err := s.fixtureRepo.ListBankTransactions(fromDate, toDate, maxFixtureRecords+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bank transactions: %v", err)
+	}
+	entries, err := s.fixtureRepo.ListAccountingEntries(fromDate, toDate, maxFixtureRecords+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list accounting entries: %v", err)
+	}
+	if len(transactions) > maxFixtureRecords || len(entries) > maxFixtureRecords {
+		return nil, fmt.Errorf("%w: the range holds more than %d records of a kind, export a shorter one", ErrInvalidFixture, maxFixtureRecords)
+	}
+	mapped, err := s.fixtureRepo.ListMappedRecords(fromDate, toDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list matches: %v", err)
+	}
+
+	bundle := &FixtureBundle{
+		Format:            FixtureBundleFormat,
+		ExportedAt:        time.Now().UTC(),
+		FromDate:          fromDate,
+		ToDate:            toDate,
+		Jitter:            jitter,
+		Rules:             rules,
+		BankTransactions:  make([]BankTransactionInput, 0, len(transactions)),
+		AccountingEntries: make([]AccountingEntryInput, 0, len(entries)),
+		Matches:           []*FixtureMatch{},
+	}
+	for _, bt := range transactions {
+		bundle.BankTransactions = append(bundle.BankTransactions, BankTransactionInput{
+			TransactionID:         anonymizer.id(bt.TransactionID),
+			AccountNumber:         anonymizer.id(bt.AccountNumber),
+			Amount:                anonymizer.amount(bt.Amount),
+			Currency:              bt.Currency,
+			TransactionDate:       dateOnly(bt.TransactionDate),
+			Description:           anonymizer.text(bt.Description),
+			ReferenceNumber:       anonymizer.id(bt.ReferenceNumber),
+			CounterpartyIBAN:      anonymizer.iban(bt.CounterpartyIBAN),
+			CounterpartyBIC:       anonymizer.bic(bt.CounterpartyBIC),
+			RemittanceInformation: anonymizer.text(bt.RemittanceInformation),
+			CreditorReference:     anonymizer.creditorReference(bt.CreditorReference),
+			EndToEndID:            anonymizer.id(bt.EndToEndID),
+			ExternalCorrelationID: anonymizer.id(bt.ExternalCorrelationID),
+			Reversal:              bt.Reversal,
+			ReturnReason:          bt.ReturnReason,
+		})
+	}
+	for _, ae := range entries {
+		bundle.AccountingEntries = append(bundle.AccountingEntries, AccountingEntryInput{
+			EntryID:           anonymizer.id(ae.EntryID),
+			AccountCode:       ae.AccountCode,
+			Amount:            anonymizer.amount(ae.Amount),
+			Currency:          ae.Currency,
+			EntryDate:         dateOnly(ae.EntryDate),
+			Description:       anonymizer.text(ae.Description),
+			InvoiceNumber:     anonymizer.id(ae.InvoiceNumber),
+			EntryType:         ae.EntryType,
+			CounterpartyIBAN:  anonymizer.iban(ae.CounterpartyIBAN),
+			CreditorReference: anonymizer.creditorReference(ae.CreditorReference),
+			EndToEndID:        anonymizer.id(ae.EndToEndID),
+
+			ExternalCorrelationID: anonymizer.id(ae.ExternalCorrelationID),
+		})
+	}
+
+	var match *FixtureMatch
+	var reconciliationID int64
+	for _, record := range mapped {
+		if match == nil || record.ReconciliationID != reconciliationID {
+			reconciliationID = record.ReconciliationID
+			match = &FixtureMatch{
+				BatchID:            record.BatchID,
+				Status:             record.Status,
+				MatchType:          record.MappingType,
+				Confidence:         record.MatchConfidence,
+				AmountDifference:   anonymizer.amount(record.AmountDifference),
+				BankTransactionIDs: []string{},
+				AccountingEntryIDs: []string{},
+			}
+			bundle.Matches = append(bundle.Matches, match)
+		}
+		if record.TransactionID != "" {
+			match.BankTransactionIDs = append(match.BankTransactionIDs, anonymizer.id(record.TransactionID))
+		}
+		if record.EntryID != "" {
+			match.AccountingEntryIDs = append(match.AccountingEntryIDs, anonymizer.id(record.EntryID))
+		}
+	}
+	return bundle, nil
+}
+
+// Import ingests the records of a bundle, each kind all or nothing, as if
+// they were sent to the ingestion endpoints. Rules and matches are left for
+// the operator to compare against: rules can be proposed with a
+// configuration import, and a reconciliation over the range replays the
+// matching.
+func (s *FixtureService) Import(bundle *FixtureBundle) (*FixtureImportResult, error) {
+	if !s.importEnabled {
+		return nil, ErrFixtureImportDisabled
+	}
+	if bundle.Format != FixtureBundleFormat {
+		return nil, fmt.Errorf("%w: format %d is not supported, expected %d", ErrInvalidFixture, bundle.Format, FixtureBundleFormat)
+	}
+
+	result := &FixtureImportResult{}
+	var err error
+	if result.BankTransactions, err = s.dataIngestionService.IngestBankTransactions(IngestionLaneBulk, bundle.BankTransactions, nil, false); err != nil {
+		return nil, err
+	}
+	if result.AccountingEntries, err = s.dataIngestionService.IngestAccountingEntries(IngestionLaneBulk, bundle.AccountingEntries, false); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// fixtureAnonymizer replaces the values of one export
+type fixtureAnonymizer struct {
+	key   []byte
+	scale float64
+}
+
+func newFixtureAnonymizer(jitter float64) (*fixtureAnonymizer, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to draw anonymization key: %v", err)
+	}
+	var draw [8]byte
+	if _, err := rand.Read(draw[:]); err != nil {
+		return nil, fmt.Errorf("failed to draw amount scale: %v", err)
+	}
+	// Uniform in [-1, 1)
+	unit := float64(binary.BigEndian.Uint64(draw[:])>>11)/(1<<52) - 1
+	return &fixtureAnonymizer{key: key, scale: 1 + jitter*unit}, nil
+}
+
+// digest is the keyed hash of a value, the same for the same value
+func (a *fixtureAnonymizer) digest(value string) []byte {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+// alphabet draws n characters of charset from the digest of value
+func (a *fixtureAnonymizer) alphabet(value, charset string, n int) string {
+	sum := a.digest(value)
+	out := make([]byte, n)
+	for i := range out {
+		out[i] = charset[int(sum[i%len(sum)]+byte(i/len(sum)))%len(charset)]
+	}
+	return string(out)
+}
+
+const (
+	fixtureDigits  = "0123456789"
+	fixtureLetters = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	fixtureAlnum   = fixtureDigits + fixtureLetters
+)
+
+// id replaces an identifier. Case and surrounding space are ignored, as
+// matching ignores them.
+func (a *fixtureAnonymizer) id(value string) string {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	if value == "" {
+		return ""
+	}
+	return a.alphabet(value, fixtureAlnum, 12)
+}
+
+// text replaces every word of free text on its own, so a reference quoted
+// in remittance information still equals its replaced reference field
+func (a *fixtureAnonymizer) text(value string) string {
+	words := strings.Fields(value)
+	for i, word := range words {
+		words[i] = a.id(word)
+	}
+	return strings.Join(words, " ")
+}
+
+// amount scales an amount, keeping it non-zero
+func (a *fixtureAnonymizer) amount(amount money.Amount) money.Amount {
+	scaled := money.Amount(math.Round(float64(amount) * a.scale))
+	switch {
+	case scaled == 0 && amount > 0:
+		return 1
+	case scaled == 0 && amount < 0:
+		return -1
+	}
+	return scaled
+}
+
+// iban replaces an IBAN with a valid one of the same country and length.
+// Invalid ones, which ingestion would refuse, are dropped, as are BICs and
+// creditor references below.
+func (a *fixtureAnonymizer) iban(value string) string {
+	iban := banking.NormalizeIBAN(value)
+	if banking.ValidateIBAN(iban) != nil {
+		return ""
+	}
+	return banking.WithCheckDigits(iban[:2], a.alphabet(iban, fixtureDigits, len(iban)-4))
+}
+
+// bic replaces a BIC with a well-formed one of the same country and length
+func (a *fixtureAnonymizer) bic(value string) string {
+	bic := banking.NormalizeBIC(value)
+	if banking.ValidateBIC(bic) != nil {
+		return ""
+	}
+	replaced := a.alphabet(bic, fixtureLetters, 4) + bic[4:6] + a.alphabet(bic+"/location", fixtureAlnum, 2)
+	if len(bic) == 11 {
+		replaced += a.alphabet(bic+"/branch", fixtureAlnum, 3)
+	}
+	return replaced
+}
+
+// creditorReference replaces an RF reference with a valid one of the same
+// length
+func (a *fixtureAnonymizer) creditorReference(value string) string {
+	ref := banking.NormalizeCreditorReference(value)
+	if banking.ValidateCreditorReference(ref) != nil {
+		return ""
+	}
+	return banking.WithCheckDigits("RF", a.alphabet(ref, fixtureAlnum, len(ref)-4))
+}
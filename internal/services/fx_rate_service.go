@@ -0,0 +1,80 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"reconciliation-service/internal/currency"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+)
+
+// ErrInvalidFXRate wraps every rejection of exchange rate input
+var ErrInvalidFXRate = errors.New("invalid exchange rate")
+
+// fxRatePattern is a positive decimal that fits the DECIMAL(18,8) column
+var fxRatePattern = regexp.MustCompile(`^[0-9]{1,10}(\.[0-9]{1,8})?$`)
+
+type FXRateService struct {
+	fxRateRepo repositories.FXRateRepository
+}
+
+func NewFXRateService(fxRateRepo repositories.FXRateRepository) *FXRateService {
+	return &FXRateService{
+		fxRateRepo: fxRateRepo,
+	}
+}
+
+// SaveRate stores the rate of a currency pair for a day, replacing one
+// already stored for that pair and day, and returns it as stored
+func (s *FXRateService) SaveRate(rate *models.FXRate, userID string) (*models.FXRate, error) {
+	rate.FromCurrency = strings.ToUpper(strings.TrimSpace(rate.FromCurrency))
+	rate.ToCurrency = strings.ToUpper(strings.TrimSpace(rate.ToCurrency))
+	rate.Rate = strings.TrimSpace(rate.Rate)
+	rate.UpdatedBy = userID
+
+	if !currency.Supported(rate.FromCurrency) {
+		return nil, fmt.Errorf("%w: unsupported from_currency %q", ErrInvalidFXRate, rate.FromCurrency)
+	}
+	if !currency.Supported(rate.ToCurrency) {
+		return nil, fmt.Errorf("%w: unsupported to_currency %q", ErrInvalidFXRate, rate.ToCurrency)
+	}
+	if rate.FromCurrency == rate.ToCurrency {
+		return nil, fmt.Errorf("%w: from_currency and to_currency must differ", ErrInvalidFXRate)
+	}
+	if !fxRatePattern.MatchString(rate.Rate) || strings.Trim(rate.Rate, "0.") == "" {
+		return nil, fmt.Errorf("%w: rate must be a positive decimal with at most 8 decimal places", ErrInvalidFXRate)
+	}
+	if _, err := time.Parse("2006-01-02", rate.RateDate); err != nil {
+		return nil, fmt.Errorf("%w: rate_date must be YYYY-MM-DD", ErrInvalidFXRate)
+	}
+
+	if err := s.fxRateRepo.SaveRate(rate); err != nil {
+		return nil, fmt.Errorf("failed to store exchange rate: %v", err)
+	}
+	return s.fxRateRepo.GetRate(rate.ID)
+}
+
+// ListRates lists stored rates, newest first, optionally for one source or
+// target currency
+func (s *FXRateService) ListRates(fromCurrency, toCurrency string) ([]*models.FXRate, error) {
+	return s.fxRateRepo.ListRates(strings.ToUpper(fromCurrency), strings.ToUpper(toCurrency))
+}
+
+// RateTable loads every stored rate for matching
+func (s *FXRateService) RateTable() (*currency.RateTable, error) {
+	rates, err := s.fxRateRepo.ListRates("", "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load exchange rates: %v", err)
+	}
+	table := currency.NewRateTable()
+	for _, rate := range rates {
+		if err := table.Add(rate.FromCurrency, rate.ToCurrency, rate.RateDate, rate.Rate); err != nil {
+			return nil, err
+		}
+	}
+	return table, nil
+}
@@ -0,0 +1,201 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"reconciliation-service/internal/config"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+)
+
+// heartbeatRetention is how long the workers of an instance that stopped
+// beating stay listed before they are pruned
+const heartbeatRetention = 24 * time.Hour
+
+// StuckJobs are the running jobs of a tenant whose instance stopped beating
+// for them
+type StuckJobs struct {
+	Threshold string                      `json:"threshold"`
+	Requeue   bool                        `json:"requeue"`
+	Jobs      []*models.ReconciliationJob `json:"jobs"`
+}
+
+// HeartbeatService beats for the background workers of this instance and the
+// jobs it runs, and watches for jobs whose instance stopped beating: a job
+// left running by an instance that crashed or hung is stuck. Stuck
+// reconciliation and partition jobs may be put back on the queue for another
+// instance to run again; their batches are written in one transaction, so
+// nothing of the stuck run was kept.
+type HeartbeatService struct {
+	heartbeatRepo repositories.HeartbeatRepository
+	jobRepo       repositories.JobRepository
+	instanceID    string
+	config        config.HeartbeatConfig
+
+	mu      sync.Mutex
+	workers map[string]time.Time
+}
+
+func NewHeartbeatService(heartbeatRepo repositories.HeartbeatRepository, jobRepo repositories.JobRepository, instanceID string, cfg config.HeartbeatConfig) *HeartbeatService {
+	return &HeartbeatService{
+		heartbeatRepo: heartbeatRepo,
+		jobRepo:       jobRepo,
+		instanceID:    instanceID,
+		config:        cfg,
+		workers:       make(map[string]time.Time),
+	}
+}
+
+// Track runs a background worker until it returns, beating for it meanwhile
+func (s *HeartbeatService) Track(ctx context.Context, worker string, run func(ctx context.Context)) {
+	startedAt := time.Now()
+	s.mu.Lock()
+	s.workers[worker] = startedAt
+	s.mu.Unlock()
+
+	heartbeat := []*models.WorkerHeartbeat{{Worker: worker, StartedAt: startedAt}}
+	if err := s.heartbeatRepo.Beat(s.instanceID, heartbeat, startedAt); err != nil {
+		log.Printf("heartbeat: failed to register worker %s: %v", worker, err)
+	}
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.workers, worker)
+		s.mu.Unlock()
+		if err := s.heartbeatRepo.RemoveWorker(s.instanceID, worker); err != nil {
+			log.Printf("heartbeat: failed to remove worker %s: %v", worker, err)
+		}
+	}()
+	run(ctx)
+}
+
+// RunBeater beats for the tracked workers and the running jobs of this
+// instance every interval until ctx is cancelled. It beats on through
+// maintenance and shutdown, while jobs may still be running.
+func (s *HeartbeatService) RunBeater(ctx context.Context) {
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.beat(); err != nil {
+			log.Printf("heartbeat: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *HeartbeatService) beat() error {
+	s.mu.Lock()
+	workers := make([]*models.WorkerHeartbeat, 0, len(s.workers))
+	for worker, startedAt := range s.workers {
+		workers = append(workers, &models.WorkerHeartbeat{Worker: worker, StartedAt: startedAt})
+	}
+	s.mu.Unlock()
+
+	return s.heartbeatRepo.Beat(s.instanceID, workers, time.Now())
+}
+
+// RunMonitor looks for stuck jobs every interval until ctx is cancelled,
+// logging them and, when configured, requeueing those that can run again
+func (s *HeartbeatService) RunMonitor(ctx context.Context) {
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.monitor()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *HeartbeatService) monitor() {
+	staleBefore := time.Now().Add(-s.config.StuckThreshold)
+	jobs, err := s.jobRepo.ListStuckJobs(staleBefore)
+	if err != nil {
+		log.Printf("heartbeat: failed to list stuck jobs: %v", err)
+		return
+	}
+	for _, job := range jobs {
+		if !s.config.Requeue || !requeueable(job) {
+			log.Printf("heartbeat: job %d (%s) of instance %s is stuck, no beat since %s",
+				job.ID, job.JobType, job.InstanceID, lastBeat(job).Format(time.RFC3339))
+			continue
+		}
+		reason := fmt.Sprintf("requeued after instance %s stopped beating for it", job.InstanceID)
+		requeued, err := s.jobRepo.RequeueStuckJob(job.ID, staleBefore, reason)
+		if err != nil {
+			log.Printf("heartbeat: failed to requeue stuck job %d: %v", job.ID, err)
+			continue
+		}
+		if requeued {
+			log.Printf("heartbeat: job %d (%s) %s", job.ID, job.JobType, reason)
+		}
+	}
+
+	if pruned, err := s.heartbeatRepo.PruneHeartbeats(time.Now().Add(-heartbeatRetention)); err != nil {
+		log.Printf("heartbeat: failed to prune heartbeats: %v", err)
+	} else if pruned > 0 {
+		log.Printf("heartbeat: pruned %d workers of instances gone for over %v", pruned, heartbeatRetention)
+	}
+}
+
+// requeueable reports whether a job can be run again from the queue: a
+// reconciliation claimed by the queue worker or a partition claimed by the
+// partition worker. An ingestion cannot run again without the request that
+// carried its records.
+func requeueable(job *models.ReconciliationJob) bool {
+	return job.JobType == models.JobTypeReconciliation || job.JobType == models.JobTypePartition
+}
+
+func lastBeat(job *models.ReconciliationJob) time.Time {
+	if job.HeartbeatAt != nil {
+		return *job.HeartbeatAt
+	}
+	return job.StartedAt
+}
+
+// StuckJobs lists the tenant's jobs stuck now, oldest first
+func (s *HeartbeatService) StuckJobs() (*StuckJobs, error) {
+	jobs, err := s.jobRepo.ListStuckJobs(time.Now().Add(-s.config.StuckThreshold))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stuck jobs: %v", err)
+	}
+	if jobs == nil {
+		jobs = []*models.ReconciliationJob{}
+	}
+	return &StuckJobs{
+		Threshold: s.config.StuckThreshold.String(),
+		Requeue:   s.config.Requeue,
+		Jobs:      jobs,
+	}, nil
+}
+
+// Workers lists the workers of every instance, flagging those silent for
+// longer than the stuck threshold
+func (s *HeartbeatService) Workers() ([]*models.WorkerHeartbeat, error) {
+	heartbeats, err := s.heartbeatRepo.ListHeartbeats()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list worker heartbeats: %v", err)
+	}
+	staleBefore := time.Now().Add(-s.config.StuckThreshold)
+	for _, heartbeat := range heartbeats {
+		heartbeat.Stale = heartbeat.BeatAt.Before(staleBefore)
+	}
+	if heartbeats == nil {
+		heartbeats = []*models.WorkerHeartbeat{}
+	}
+	return heartbeats, nil
+}
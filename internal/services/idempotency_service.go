@@ -0,0 +1,142 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+)
+
+var (
+	ErrInvalidIdempotencyKey = errors.New("idempotency key must be 1 to 255 printable ASCII characters")
+	// ErrIdempotencyKeyReused means the key came with a different request
+	// than the one it was first used for
+	ErrIdempotencyKeyReused = errors.New("idempotency key was already used for a different request")
+	// ErrIdempotencyKeyInProgress means the first request with the key has
+	// not been answered yet
+	ErrIdempotencyKeyInProgress = errors.New("a request with this idempotency key is still in progress")
+)
+
+const maxIdempotencyKeyLength = 255
+
+const (
+	// Tries at storing the response of a request whose work is committed.
+	// Its key must not be released, so a store that keeps failing leaves it
+	// pending until it expires.
+	maxCompleteAttempts = 4
+	completeBackoff     = 100 * time.Millisecond
+)
+
+// IdempotencyService remembers the keys callers send with requests that
+// must not run twice, and the response each got, so a retry gets the first
+// response back instead of running again.
+type IdempotencyService struct {
+	idempotencyRepo repositories.IdempotencyRepository
+	ttl             time.Duration
+}
+
+func NewIdempotencyService(idempotencyRepo repositories.IdempotencyRepository, ttl time.Duration) *IdempotencyService {
+	return &IdempotencyService{
+		idempotencyRepo: idempotencyRepo,
+		ttl:             ttl,
+	}
+}
+
+// Begin claims a caller's key for a request, fingerprint identifying what
+// the request asks for. A new key is returned pending: Complete it with the
+// response, or Release it when the request failed so a retry runs again. A
+// key whose request already succeeded is returned completed, to replay.
+func (s *IdempotencyService) Begin(caller, key, operation, fingerprint string) (*models.IdempotencyKey, error) {
+	if !validIdempotencyKey(key) {
+		return nil, ErrInvalidIdempotencyKey
+	}
+	sum := sha256.Sum256([]byte(operation + "\n" + fingerprint))
+	record := &models.IdempotencyKey{
+		Caller:      caller,
+		Key:         key,
+		Operation:   operation,
+		RequestHash: hex.EncodeToString(sum[:]),
+		ExpiresAt:   time.Now().Add(s.ttl),
+	}
+
+	err := s.idempotencyRepo.CreateKey(record)
+	if err == nil {
+		return record, nil
+	}
+	if !errors.Is(err, repositories.ErrIdempotencyKeyExists) {
+		return nil, fmt.Errorf("failed to store idempotency key: %v", err)
+	}
+
+	existing, err := s.idempotencyRepo.GetKey(caller, key)
+	if errors.Is(err, repositories.ErrIdempotencyKeyNotFound) {
+		// Released by the first request between our insert and read
+		return nil, ErrIdempotencyKeyInProgress
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get idempotency key: %v", err)
+	}
+	if existing.Operation != record.Operation || existing.RequestHash != record.RequestHash {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if existing.Status != models.IdempotencyStatusCompleted {
+		return nil, ErrIdempotencyKeyInProgress
+	}
+	return existing, nil
+}
+
+// Complete stores the response a pending key's request got, for retries. The
+// request's work is already committed, so a failed store is tried again
+// with backoff rather than given up on.
+func (s *IdempotencyService) Complete(record *models.IdempotencyKey, batchID string, status int, response interface{}) error {
+	encoded, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	for attempt := 1; attempt <= maxCompleteAttempts; attempt++ {
+		err = s.idempotencyRepo.CompleteKey(record.ID, batchID, status, encoded)
+		if err == nil {
+			break
+		}
+		if attempt < maxCompleteAttempts {
+			time.Sleep(completeBackoff * time.Duration(1<<(attempt-1)))
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to complete idempotency key after %d attempts: %v", maxCompleteAttempts, err)
+	}
+	record.Status = models.IdempotencyStatusCompleted
+	record.BatchID = batchID
+	record.ResponseStatus = status
+	record.Response = encoded
+	return nil
+}
+
+// Release forgets a pending key whose request failed before committing
+// anything. A key whose work committed is never released, even when
+// Complete failed: a retry would run the work again.
+func (s *IdempotencyService) Release(record *models.IdempotencyKey) error {
+	if record.Status != models.IdempotencyStatusPending {
+		return nil
+	}
+	if err := s.idempotencyRepo.DeleteKey(record.ID); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %v", err)
+	}
+	return nil
+}
+
+func validIdempotencyKey(key string) bool {
+	if key == "" || len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
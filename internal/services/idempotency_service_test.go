@@ -0,0 +1,57 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+)
+
+// flakyIdempotencyKeys fails as many stores of a response as failures. Any
+// other method of the repository panics.
+type flakyIdempotencyKeys struct {
+	repositories.IdempotencyRepository
+
+	failures  int
+	completes int
+}
+
+func (r *flakyIdempotencyKeys) CompleteKey(id int64, batchID string, status int, response []byte) error {
+	r.completes++
+	if r.completes <= r.failures {
+		return errors.New("connection reset")
+	}
+	return nil
+}
+
+func TestCompleteRetriesFailedStores(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		wantErr  bool
+	}{
+		{name: "stored at once", failures: 0},
+		{name: "stored on retry", failures: maxCompleteAttempts - 1},
+		{name: "never stored", failures: maxCompleteAttempts, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &flakyIdempotencyKeys{failures: tt.failures}
+			svc := NewIdempotencyService(repo, time.Hour)
+			record := &models.IdempotencyKey{ID: 7, Status: models.IdempotencyStatusPending}
+
+			err := svc.Complete(record, "batch-1", 200, map[string]string{"batch_id": "batch-1"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Complete() error = %v, want error %v", err, tt.wantErr)
+			}
+			if want := min(tt.failures+1, maxCompleteAttempts); repo.completes != want {
+				t.Errorf("stores tried = %d, want %d", repo.completes, want)
+			}
+			if !tt.wantErr && record.Status != models.IdempotencyStatusCompleted {
+				t.Errorf("status = %s, want %s", record.Status, models.IdempotencyStatusCompleted)
+			}
+		})
+	}
+}
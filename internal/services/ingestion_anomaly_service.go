@@ -0,0 +1,225 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"reconciliation-service/internal/config"
+	"reconciliation-service/internal/ingestion/camt053"
+	"reconciliation-service/internal/ingestion/detect"
+	"reconciliation-service/internal/ingestion/mt940"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+)
+
+// IngestionAnomalyService raises webhooks for what is wrong with the
+// statement feeds, so upstream teams fix them before the reconciliation run:
+// a fetched file that was ingested or rejected before, a statement whose
+// sequence number skips some after the last one of its account, a file
+// whose transactions score below the data-quality threshold, and an expected
+// feed that brought no transactions by the cutoff. A nil service raises
+// nothing.
+type IngestionAnomalyService struct {
+	fileRepo           repositories.IngestionFileRepository
+	webhookService     *WebhookService
+	jobService         *JobService
+	maintenanceService *MaintenanceService
+	config             config.AnomalyConfig
+}
+
+func NewIngestionAnomalyService(fileRepo repositories.IngestionFileRepository, webhookService *WebhookService, jobService *JobService, maintenanceService *MaintenanceService, cfg config.AnomalyConfig) *IngestionAnomalyService {
+	return &IngestionAnomalyService{
+		fileRepo:           fileRepo,
+		webhookService:     webhookService,
+		jobService:         jobService,
+		maintenanceService: maintenanceService,
+		config:             cfg,
+	}
+}
+
+// DuplicateFile reports a file fetched from source whose content is that of
+// the stored file, which was ingested or rejected before. The same file
+// found again under the same name is reported once.
+func (s *IngestionAnomalyService) DuplicateFile(source, name string, stored *models.IngestionFile) {
+	if s == nil {
+		return
+	}
+	s.emit(models.WebhookEventDuplicateFile, source+"/"+name+"/"+stored.Checksum, map[string]interface{}{
+		"source":             source,
+		"file_name":          name,
+		"checksum":           stored.Checksum,
+		"original_file_id":   stored.ID,
+		"original_source":    stored.Source,
+		"original_file_name": stored.FileName,
+		"original_status":    stored.Status,
+	})
+}
+
+// Ingested checks a file once its transactions are stored: its data-quality
+// score against the threshold, and the sequence numbers of its statements
+// against the last ones ingested for their accounts
+func (s *IngestionAnomalyService) Ingested(file *models.IngestionFile, detection detect.Detection, text []byte) {
+	if s == nil {
+		return
+	}
+	if file.QualityScore != nil && *file.QualityScore < s.config.QualityThreshold {
+		s.emit(models.WebhookEventQualityBelowThreshold, strconv.FormatInt(file.ID, 10), map[string]interface{}{
+			"source":        file.Source,
+			"file_name":     file.FileName,
+			"file_id":       file.ID,
+			"format":        file.Format,
+			"records":       file.Records,
+			"quality_score": *file.QualityScore,
+			"threshold":     s.config.QualityThreshold,
+		})
+	}
+
+	for _, sequence := range statementSequences(detection, text) {
+		last, ok, err := s.fileRepo.LastSequence(sequence.account)
+		if err != nil {
+			log.Printf("anomalies: failed to load the last statement of %s: %v", sequence.account, err)
+			continue
+		}
+		// Numbering restarts at 1, yearly at many banks
+		if ok && sequence.number > last+1 && sequence.number != 1 {
+			s.emit(models.WebhookEventSequenceGap, sequence.account+"/"+strconv.FormatInt(sequence.number, 10), map[string]interface{}{
+				"source":         file.Source,
+				"file_name":      file.FileName,
+				"file_id":        file.ID,
+				"account_number": sequence.account,
+				"expected":       last + 1,
+				"received":       sequence.number,
+				"missing":        sequence.number - last - 1,
+			})
+		}
+		if err := s.fileRepo.RecordSequence(sequence.account, sequence.number, file.ID); err != nil {
+			log.Printf("anomalies: failed to record statement %d of %s: %v", sequence.number, sequence.account, err)
+		}
+	}
+}
+
+// RunFeedWatcher checks the expected feeds every check interval until ctx
+// is cancelled. Nothing is checked while the service drains or is in
+// maintenance.
+func (s *IngestionAnomalyService) RunFeedWatcher(ctx context.Context) {
+	ticker := time.NewTicker(s.config.FeedCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		if !s.jobService.Draining() && !s.maintenanceService.Enabled() {
+			s.CheckFeeds(time.Now())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckFeeds reports every expected feed that brought no transactions on a
+// weekday by the cutoff hour, once per feed and day
+func (s *IngestionAnomalyService) CheckFeeds(now time.Time) {
+	now = now.UTC()
+	if now.Weekday() == time.Saturday || now.Weekday() == time.Sunday || now.Hour() < s.config.FeedCutoffHour {
+		return
+	}
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	for _, feed := range s.config.ExpectedFeeds {
+		files, records, err := s.fileRepo.FeedActivity(feed, day)
+		if err != nil {
+			log.Printf("anomalies: failed to check feed %s: %v", feed, err)
+			continue
+		}
+		if records > 0 {
+			continue
+		}
+		s.emit(models.WebhookEventFeedEmpty, feed+"/"+day.Format("2006-01-02"), map[string]interface{}{
+			"source":      feed,
+			"date":        day.Format("2006-01-02"),
+			"cutoff_hour": s.config.FeedCutoffHour,
+			"files":       files,
+		})
+	}
+}
+
+func (s *IngestionAnomalyService) emit(eventType, dedupKey string, data map[string]interface{}) {
+	if err := s.webhookService.Emit(eventType, dedupKey, data); err != nil {
+		log.Printf("anomalies: %v", err)
+	}
+}
+
+// qualityScore is the share of three checks the transactions of a file pass:
+// a reference to match on, a counterparty, and remittance information.
+// Transactions failing them are the ones reconciliation cannot match but by
+// amount and date.
+func qualityScore(transactions []BankTransactionInput) float64 {
+	if len(transactions) == 0 {
+		return 0
+	}
+	passed := 0
+	for _, tx := range transactions {
+		if tx.ReferenceNumber != "" || tx.EndToEndID != "" || tx.CreditorReference != "" || tx.ExternalCorrelationID != "" {
+			passed++
+		}
+		if tx.Description != "" || tx.Counterparty != "" || tx.CounterpartyIBAN != "" {
+			passed++
+		}
+		if tx.RemittanceInformation != "" {
+			passed++
+		}
+	}
+	return math.Round(float64(passed)/float64(3*len(transactions))*1000) / 1000
+}
+
+// statementSequence is the sequence number of a statement of an account
+type statementSequence struct {
+	account string
+	number  int64
+}
+
+// statementSequences reads the sequence numbers of the statements of an
+// MT940 (:28C:, the statement number before the page) or camt.053
+// (ElctrncSeqNb) file, by account and number. Other formats carry none.
+func statementSequences(detection detect.Detection, text []byte) []statementSequence {
+	var sequences []statementSequence
+	add := func(account, number string) {
+		n, err := strconv.ParseInt(strings.TrimSpace(number), 10, 64)
+		if account != "" && err == nil && n > 0 {
+			sequences = append(sequences, statementSequence{account: account, number: n})
+		}
+	}
+	switch detection.Format {
+	case detect.FormatMT940:
+		statements, err := mt940.Parse(bytes.NewReader(text))
+		if err != nil {
+			return nil
+		}
+		for _, statement := range statements {
+			number, _, _ := strings.Cut(statement.StatementNumber, "/")
+			add(statement.AccountID, number)
+		}
+	case detect.FormatCAMT053:
+		statements, err := camt053.Parse(bytes.NewReader(text))
+		if err != nil {
+			return nil
+		}
+		for _, statement := range statements {
+			add(statement.AccountID, statement.SequenceNumber)
+		}
+	}
+	sort.SliceStable(sequences, func(i, j int) bool {
+		if sequences[i].account != sequences[j].account {
+			return sequences[i].account < sequences[j].account
+		}
+		return sequences[i].number < sequences[j].number
+	})
+	return sequences
+}
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Ingestion lanes. Single records and small arrays posted by real-time
+// systems take the real-time lane, which runs each ingestion in one short
+// transaction. Statement files and large arrays take the bulk lane, which
+// commits them in chunks. Each lane has a connection pool of its own, so a
+// nightly file load waits for bulk connections instead of taking the ones
+// real-time posting needs.
+const (
+	IngestionLaneRealtime = "realtime"
+	IngestionLaneBulk     = "bulk"
+)
+
+// IngestionLanes holds the connection pools of the ingestion lanes and how
+// records are split between them
+type IngestionLanes struct {
+	Realtime *sql.DB
+	Bulk     *sql.DB
+
+	// Largest JSON array ingested on the real-time lane
+	RealtimeMaxRecords int
+	// Records the bulk lane commits per transaction
+	BulkChunkSize int
+
+	// Largest request bodies the upload endpoints read, for JSON arrays and
+	// statement files
+	MaxJSONBytes      int64
+	MaxStatementBytes int64
+}
+
+// LaneFor returns the lane a JSON array of count records is ingested on
+func (s *DataIngestionService) LaneFor(count int) string {
+	if count > s.lanes.RealtimeMaxRecords {
+		return IngestionLaneBulk
+	}
+	return IngestionLaneRealtime
+}
+
+// MaxJSONBytes bounds the body of an uploaded JSON array
+func (s *DataIngestionService) MaxJSONBytes() int64 {
+	return s.lanes.MaxJSONBytes
+}
+
+// MaxStatementBytes bounds an uploaded statement file, which is read whole
+func (s *DataIngestionService) MaxStatementBytes() int64 {
+	return s.lanes.MaxStatementBytes
+}
+
+// ingestChunks ingests count records on the bulk lane, a chunk at a time,
+// each in a transaction of its own, so a large file neither keeps one
+// transaction open for its whole length nor holds the locks of all its rows.
+// ingest gets the bounds of a chunk and whether every chunk before it
+// succeeded. A chunk with a failed record is rolled back as a whole unless
+// the ingestion is a partial commit, and then no further chunk is ingested;
+// the chunks before it stay stored. So do those before a chunk that fails
+// with an error, and their result is returned with it.
+func (s *DataIngestionService) ingestChunks(count int, partial bool, ingest func(from, to int, clean bool) (*IngestionResult, error)) (*IngestionResult, error) {
+	result := &IngestionResult{
+		Success: true,
+		Lane:    IngestionLaneBulk,
+		Details: make(map[string]interface{}),
+	}
+
+	chunks, to := 0, 0
+	for from := 0; ; from = to {
+		to = min(from+s.lanes.BulkChunkSize, count)
+		chunk, err := ingest(from, to, result.Success)
+		if err != nil {
+			if !result.Committed {
+				return nil, err
+			}
+			result.Success = false
+			summarizeChunks(result, count, chunks, from)
+			return result, fmt.Errorf("records %d to %d: %w; the %d records before them are stored", from+1, to, err, result.RecordsCount)
+		}
+		chunks++
+		mergeIngestion(result, chunk)
+		if to == count || (!chunk.Success && !partial) {
+			break
+		}
+	}
+
+	summarizeChunks(result, count, chunks, to)
+	return result, nil
+}
+
+// summarizeChunks reports in the details of a bulk ingestion how many chunks
+// it took and how many of its total records it did not ingest
+func summarizeChunks(result *IngestionResult, total, chunks, ingested int) {
+	result.Details["total_records"] = total
+	result.Details["chunks"] = chunks
+	if ingested < total {
+		result.Details["not_ingested"] = total - ingested
+	}
+}
+
+// mergeIngestion adds the result of a chunk to the result of its ingestion
+func mergeIngestion(total, chunk *IngestionResult) {
+	total.Success = total.Success && chunk.Success
+	total.RecordsCount += chunk.RecordsCount
+	total.Errors = append(total.Errors, chunk.Errors...)
+	total.Committed = total.Committed || chunk.Committed
+	total.StoredIDs = append(total.StoredIDs, chunk.StoredIDs...)
+	for key, value := range chunk.Details {
+		switch value := value.(type) {
+		case int:
+			sum, _ := total.Details[key].(int)
+			total.Details[key] = sum + value
+		case []string:
+			list, _ := total.Details[key].([]string)
+			total.Details[key] = append(list, value...)
+		}
+	}
+}
+
+// ErrInvalidPayload wraps a record of an uploaded JSON array that could not
+// be decoded
+var ErrInvalidPayload = errors.New("invalid request payload")
+
+// ErrNoRecords means an uploaded JSON array was empty
+var ErrNoRecords = errors.New("no records provided")
+
+// RecordStream yields the records of an uploaded JSON array as they are
+// decoded; ok is false once the array ends
+type RecordStream[T any] func() (record T, ok bool, err error)
+
+// IngestBankTransactionStream ingests a JSON array of bank transactions as it
+// is decoded, like IngestBankTransactions, without holding the whole array.
+// See ingestStream.
+func (s *DataIngestionService) IngestBankTransactionStream(transactions RecordStream[BankTransactionInput], partial bool, progress func(lane string, decoded int)) (*IngestionResult, error) {
+	return ingestStream(s, transactions, partial, progress, func(db *sql.DB, chunk []BankTransactionInput) (*IngestionResult, error) {
+		return s.ingestBankTransactions(db, chunk, nil, partial)
+	})
+}
+
+// IngestAccountingEntryStream ingests a JSON array of accounting entries as it
+// is decoded, like IngestAccountingEntries. See ingestStream.
+func (s *DataIngestionService) IngestAccountingEntryStream(entries RecordStream[AccountingEntryInput], partial bool, progress func(lane string, decoded int)) (*IngestionResult, error) {
+	return ingestStream(s, entries, partial, progress, func(db *sql.DB, chunk []AccountingEntryInput) (*IngestionResult, error) {
+		return s.ingestAccountingEntries(db, chunk, partial)
+	})
+}
+
+// ingestStream ingests the records of an uploaded JSON array while it is
+// decoded. An array that ends within RealtimeMaxRecords takes the real-time
+// lane as a whole. A longer one takes the bulk lane, a chunk at a time as
+// each chunk is decoded, so no more than a chunk of it is ever held; its
+// chunks are committed as ingestChunks commits them. Once a chunk fails and
+// the ingestion is not a partial commit, the rest of the array is only
+// decoded to be counted.
+//
+// A record that cannot be decoded fails the ingestion with ErrInvalidPayload.
+// On the bulk lane the chunks committed before it, or before a chunk that
+// could not be stored, stay stored: their result is returned with the error.
+// progress is told the lane once it is chosen and the records decoded after
+// each chunk.
+func ingestStream[T any](s *DataIngestionService, records RecordStream[T], partial bool, progress func(lane string, decoded int), ingest func(db *sql.DB, chunk []T) (*IngestionResult, error)) (*IngestionResult, error) {
+	decoded := 0
+	next := func() (T, bool, error) {
+		record, ok, err := records()
+		if err != nil {
+			return record, false, fmt.Errorf("%w: record %d: %w", ErrInvalidPayload, decoded+1, err)
+		}
+		if ok {
+			decoded++
+		}
+		return record, ok, nil
+	}
+
+	buffer := make([]T, 0, s.lanes.RealtimeMaxRecords+1)
+	for len(buffer) <= s.lanes.RealtimeMaxRecords {
+		record, ok, err := next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		buffer = append(buffer, record)
+	}
+	if len(buffer) == 0 {
+		return nil, ErrNoRecords
+	}
+	if len(buffer) <= s.lanes.RealtimeMaxRecords {
+		progress(IngestionLaneRealtime, decoded)
+		result, err := ingest(s.lanes.Realtime, buffer)
+		if err != nil {
+			return nil, err
+		}
+		result.Lane = IngestionLaneRealtime
+		return result, nil
+	}
+	progress(IngestionLaneBulk, decoded)
+
+	result := &IngestionResult{
+		Success: true,
+		Lane:    IngestionLaneBulk,
+		Details: make(map[string]interface{}),
+	}
+	chunks, ingested, done := 0, 0, false
+	// failed ends the ingestion with err, returning what the chunks before
+	// it stored
+	failed := func(err error) (*IngestionResult, error) {
+		if !result.Committed {
+			return nil, err
+		}
+		result.Success = false
+		summarizeChunks(result, decoded, chunks, ingested)
+		return result, err
+	}
+	for {
+		for !done && len(buffer) < s.lanes.BulkChunkSize {
+			record, ok, err := next()
+			if err != nil {
+				if result.Committed {
+					err = fmt.Errorf("%w; the %d records before it are stored", err, result.RecordsCount)
+				}
+				return failed(err)
+			}
+			if !ok {
+				done = true
+				break
+			}
+			buffer = append(buffer, record)
+		}
+		if len(buffer) == 0 {
+			break
+		}
+
+		size := min(len(buffer), s.lanes.BulkChunkSize)
+		chunk, err := ingest(s.lanes.Bulk, buffer[:size])
+		if err != nil {
+			if result.Committed {
+				err = fmt.Errorf("records %d to %d: %w; the %d records before them are stored", ingested+1, ingested+size, err, result.RecordsCount)
+			}
+			return failed(err)
+		}
+		chunks++
+		ingested += size
+		mergeIngestion(result, chunk)
+		progress(IngestionLaneBulk, decoded)
+		buffer = append(buffer[:0], buffer[size:]...)
+		if !chunk.Success && !partial {
+			break
+		}
+	}
+
+	// The rest of a failed ingestion is counted, not kept
+	for !done {
+		if _, ok, err := next(); err != nil || !ok {
+			break
+		}
+	}
+
+	summarizeChunks(result, decoded, chunks, ingested)
+	return result, nil
+}
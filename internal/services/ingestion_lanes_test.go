@@ -0,0 +1,204 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// storeRecords stands in for the database: it stores every record of a
+// chunk and fails the chunk that holds failAt
+func storeRecords(failAt string) func(db *sql.DB, chunk []string) (*IngestionResult, error) {
+	return func(db *sql.DB, chunk []string) (*IngestionResult, error) {
+		for _, record := range chunk {
+			if record == failAt {
+				return nil, errors.New("deadlock found when trying to get lock")
+			}
+		}
+		return &IngestionResult{
+			Success:      true,
+			RecordsCount: len(chunk),
+			Committed:    true,
+			StoredIDs:    append([]string(nil), chunk...),
+			Details:      map[string]interface{}{},
+		}, nil
+	}
+}
+
+// recordStream yields count records named r1, r2, ..., failing to decode
+// badAt, if it is not 0
+func recordStream(count, badAt int) RecordStream[string] {
+	i := 0
+	return func() (string, bool, error) {
+		if i == count {
+			return "", false, nil
+		}
+		i++
+		if i == badAt {
+			return "", false, errors.New("unexpected end of JSON input")
+		}
+		return fmt.Sprintf("r%d", i), true, nil
+	}
+}
+
+func TestIngestStreamKeepsCommittedChunksOnError(t *testing.T) {
+	s := &DataIngestionService{lanes: IngestionLanes{RealtimeMaxRecords: 2, BulkChunkSize: 3}}
+
+	tests := []struct {
+		name       string
+		count      int
+		badAt      int
+		failAt     string
+		wantErr    error
+		wantLane   string
+		wantStored []string
+		wantResult bool
+	}{
+		{
+			name:       "realtime lane",
+			count:      2,
+			wantLane:   IngestionLaneRealtime,
+			wantStored: []string{"r1", "r2"},
+			wantResult: true,
+		},
+		{
+			name:       "bulk lane",
+			count:      7,
+			wantLane:   IngestionLaneBulk,
+			wantStored: []string{"r1", "r2", "r3", "r4", "r5", "r6", "r7"},
+			wantResult: true,
+		},
+		{
+			name:    "undecodable record before any chunk",
+			count:   7,
+			badAt:   2,
+			wantErr: ErrInvalidPayload,
+		},
+		{
+			name:       "undecodable record after a chunk",
+			count:      7,
+			badAt:      5,
+			wantErr:    ErrInvalidPayload,
+			wantLane:   IngestionLaneBulk,
+			wantStored: []string{"r1", "r2", "r3"},
+			wantResult: true,
+		},
+		{
+			name:    "database error in the first chunk",
+			count:   7,
+			failAt:  "r2",
+			wantErr: errors.New(""),
+		},
+		{
+			name:       "database error after chunks",
+			count:      10,
+			failAt:     "r8",
+			wantErr:    errors.New(""),
+			wantLane:   IngestionLaneBulk,
+			wantStored: []string{"r1", "r2", "r3", "r4", "r5", "r6"},
+			wantResult: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ingestStream(s, recordStream(tt.count, tt.badAt), false, func(string, int) {}, storeRecords(tt.failAt))
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantErr != nil && err == nil:
+				t.Fatal("expected an error")
+			case tt.wantErr == ErrInvalidPayload && !errors.Is(err, ErrInvalidPayload):
+				t.Fatalf("error = %v, want ErrInvalidPayload", err)
+			}
+			if !tt.wantResult {
+				if result != nil {
+					t.Fatalf("expected no result, got %+v", result)
+				}
+				return
+			}
+			if result == nil {
+				t.Fatal("expected the result of the committed chunks")
+			}
+			if result.Lane != tt.wantLane {
+				t.Errorf("lane = %q, want %q", result.Lane, tt.wantLane)
+			}
+			if !reflect.DeepEqual(result.StoredIDs, tt.wantStored) {
+				t.Errorf("stored = %v, want %v", result.StoredIDs, tt.wantStored)
+			}
+			if result.RecordsCount != len(tt.wantStored) || !result.Committed {
+				t.Errorf("records = %d, committed = %v; want %d, true", result.RecordsCount, result.Committed, len(tt.wantStored))
+			}
+			if result.Success != (tt.wantErr == nil) {
+				t.Errorf("success = %v, want %v", result.Success, tt.wantErr == nil)
+			}
+		})
+	}
+}
+
+func TestIngestChunksKeepsCommittedChunksOnError(t *testing.T) {
+	s := &DataIngestionService{lanes: IngestionLanes{BulkChunkSize: 3}}
+	records := make([]string, 8)
+	for i := range records {
+		records[i] = fmt.Sprintf("r%d", i+1)
+	}
+
+	tests := []struct {
+		name       string
+		failAt     string
+		wantErr    bool
+		wantStored []string
+		wantResult bool
+	}{
+		{
+			name:       "every chunk stored",
+			wantStored: records,
+			wantResult: true,
+		},
+		{
+			name:    "first chunk fails",
+			failAt:  "r1",
+			wantErr: true,
+		},
+		{
+			name:       "later chunk fails",
+			failAt:     "r7",
+			wantErr:    true,
+			wantStored: records[:6],
+			wantResult: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := storeRecords(tt.failAt)
+			result, err := s.ingestChunks(len(records), false, func(from, to int, clean bool) (*IngestionResult, error) {
+				return store(nil, records[from:to])
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want one: %v", err, tt.wantErr)
+			}
+			if !tt.wantResult {
+				if result != nil {
+					t.Fatalf("expected no result, got %+v", result)
+				}
+				return
+			}
+			if result == nil {
+				t.Fatal("expected the result of the committed chunks")
+			}
+			if !reflect.DeepEqual(result.StoredIDs, tt.wantStored) {
+				t.Errorf("stored = %v, want %v", result.StoredIDs, tt.wantStored)
+			}
+			if !result.Committed || result.Success == tt.wantErr {
+				t.Errorf("committed = %v, success = %v", result.Committed, result.Success)
+			}
+			notIngested, _ := result.Details["not_ingested"].(int)
+			if want := len(records) - len(tt.wantStored); notIngested != want {
+				t.Errorf("not_ingested = %d, want %d", notIngested, want)
+			}
+		})
+	}
+}
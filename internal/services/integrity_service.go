@@ -0,0 +1,415 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/pagination"
+	"reconciliation-service/internal/repositories"
+)
+
+// ErrInvalidIntegrity wraps every rejection of an integrity query
+var ErrInvalidIntegrity = errors.New("invalid integrity query")
+
+const (
+	// integrityFindingLimit bounds how many findings of each kind a run
+	// records
+	integrityFindingLimit = 1000
+
+	defaultIntegrityLimit = 50
+	maxIntegrityLimit     = 500
+)
+
+// IntegrityService checks that the mappings still tie together what they
+// matched: a mapping whose record or reconciliation is gone, or which an
+// unmatched reconciliation kept, is an orphan; a record mapped by more than
+// one batch was reconciled twice; and a one-to-many or many-to-one group
+// whose totals moved no longer differs by what it was matched with. Each
+// run records its findings with the repair each takes, and supersedes what
+// earlier runs left open. A repair checks its finding again first, so one
+// that no longer holds goes stale instead of changing anything.
+type IntegrityService struct {
+	db                    *sql.DB
+	integrityRepo         repositories.IntegrityRepository
+	reconciliationRepo    repositories.ReconciliationRepository
+	legalHoldRepo         repositories.LegalHoldRepository
+	reconciliationService *ReconciliationService
+	jobService            *JobService
+	maintenanceService    *MaintenanceService
+	baseCurrency          string
+}
+
+func NewIntegrityService(
+	db *sql.DB,
+	integrityRepo repositories.IntegrityRepository,
+	reconciliationRepo repositories.ReconciliationRepository,
+	legalHoldRepo repositories.LegalHoldRepository,
+	reconciliationService *ReconciliationService,
+	jobService *JobService,
+	maintenanceService *MaintenanceService,
+	baseCurrency string,
+) *IntegrityService {
+	return &IntegrityService{
+		db:                    db,
+		integrityRepo:         integrityRepo,
+		reconciliationRepo:    reconciliationRepo,
+		legalHoldRepo:         legalHoldRepo,
+		reconciliationService: reconciliationService,
+		jobService:            jobService,
+		maintenanceService:    maintenanceService,
+		baseCurrency:          baseCurrency,
+	}
+}
+
+// Check looks for every kind of drift and records the run with its findings
+func (s *IntegrityService) Check(triggeredBy string) (*models.IntegrityRun, error) {
+	run := &models.IntegrityRun{
+		TriggeredBy: triggeredBy,
+		StartedAt:   time.Now(),
+	}
+
+	orphans, err := s.integrityRepo.FindOrphanMappings(integrityFindingLimit + 1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find orphan mappings: %v", err)
+	}
+	multiplyMapped, err := s.integrityRepo.FindMultiplyMapped(integrityFindingLimit + 1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find multiply mapped records: %v", err)
+	}
+	sumMismatches, err := s.integrityRepo.FindSumMismatches(s.baseCurrency, integrityFindingLimit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find sum mismatches: %v", err)
+	}
+	if run.Metrics.SumUnchecked, err = s.integrityRepo.CountUncheckedSums(s.baseCurrency); err != nil {
+		return nil, fmt.Errorf("failed to count unchecked groups: %v", err)
+	}
+
+	var findings []*models.IntegrityFinding
+	for _, found := range [][]*models.IntegrityFinding{orphans, multiplyMapped, sumMismatches} {
+		if len(found) > integrityFindingLimit {
+			found = found[:integrityFindingLimit]
+			run.Metrics.Truncated = true
+		}
+		findings = append(findings, found...)
+	}
+	run.Metrics.OrphanMappings = min(len(orphans), integrityFindingLimit)
+	run.Metrics.MultiplyMapped = min(len(multiplyMapped), integrityFindingLimit)
+	run.Metrics.SumMismatches = min(len(sumMismatches), integrityFindingLimit)
+
+	run.FinishedAt = time.Now()
+	if err := s.integrityRepo.SaveRun(run, findings); err != nil {
+		return nil, fmt.Errorf("failed to record integrity run: %v", err)
+	}
+	return run, nil
+}
+
+// integrityRunsCursor and integrityFindingsCursor name the integrity lists in
+// their cursors
+const (
+	integrityRunsCursor     = "integrity_runs"
+	integrityFindingsCursor = "integrity_findings"
+)
+
+func integrityLimit(limit int) (int, error) {
+	switch {
+	case limit == 0:
+		return defaultIntegrityLimit, nil
+	case limit < 0 || limit > maxIntegrityLimit:
+		return 0, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidIntegrity, maxIntegrityLimit)
+	}
+	return limit, nil
+}
+
+// ListRuns lists the latest integrity runs, newest first, from the cursor a
+// previous page returned, and the cursor of the next page
+func (s *IntegrityService) ListRuns(cursor string, limit int) ([]*models.IntegrityRun, string, error) {
+	limit, err := integrityLimit(limit)
+	if err != nil {
+		return nil, "", err
+	}
+	after, err := pagination.Decode(cursor, integrityRunsCursor)
+	if err != nil {
+		return nil, "", err
+	}
+	_, beforeID := after.Key()
+	runs, err := s.integrityRepo.ListRuns(beforeID, limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	runs, next := pagination.Next(runs, limit, func(run *models.IntegrityRun) pagination.Cursor {
+		return pagination.Cursor{List: integrityRunsCursor, ID: run.ID}
+	})
+	return runs, next, nil
+}
+
+// ListFindings lists findings newest first, optionally of one run, kind or
+// status, from the cursor a previous page returned, and the cursor of the
+// next page
+func (s *IntegrityService) ListFindings(runID int64, kind, status, cursor string, limit int) ([]*models.IntegrityFinding, string, error) {
+	kind = strings.ToLower(strings.TrimSpace(kind))
+	status = strings.ToLower(strings.TrimSpace(status))
+	switch kind {
+	case "", models.IntegrityOrphanMapping, models.IntegrityMultiplyMapped, models.IntegritySumMismatch:
+	default:
+		return nil, "", fmt.Errorf("%w: unknown kind %q", ErrInvalidIntegrity, kind)
+	}
+	switch status {
+	case "", models.IntegrityStatusOpen, models.IntegrityStatusRepaired, models.IntegrityStatusStale, models.IntegrityStatusSuperseded:
+	default:
+		return nil, "", fmt.Errorf("%w: unknown status %q", ErrInvalidIntegrity, status)
+	}
+	limit, err := integrityLimit(limit)
+	if err != nil {
+		return nil, "", err
+	}
+	after, err := pagination.Decode(cursor, integrityFindingsCursor)
+	if err != nil {
+		return nil, "", err
+	}
+	_, beforeID := after.Key()
+	findings, err := s.integrityRepo.ListFindings(runID, kind, status, beforeID, limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	findings, next := pagination.Next(findings, limit, func(finding *models.IntegrityFinding) pagination.Cursor {
+		return pagination.Cursor{List: integrityFindingsCursor, ID: finding.ID}
+	})
+	return findings, next, nil
+}
+
+// RepairFinding applies the repair of an open finding. A finding that no
+// longer holds is closed as stale without changing anything. Repairs touching
+// a held batch, record or account fail with ErrLegalHold.
+func (s *IntegrityService) RepairFinding(id int64, userID string) (*models.IntegrityFinding, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	finding, err := s.integrityRepo.GetFindingForUpdate(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if finding.Status != models.IntegrityStatusOpen {
+		return nil, repositories.ErrIntegrityFindingClosed
+	}
+	current, err := s.integrityRepo.RecheckFinding(tx, finding, s.baseCurrency)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check finding again: %v", err)
+	}
+
+	status := models.IntegrityStatusStale
+	if current != nil {
+		switch current.Kind {
+		case models.IntegrityOrphanMapping:
+			err = s.deleteOrphanMapping(tx, current, userID)
+		case models.IntegrityMultiplyMapped:
+			err = s.unmatchDuplicates(tx, current, userID)
+		case models.IntegritySumMismatch:
+			err = s.holdForReview(tx, current, userID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		status = models.IntegrityStatusRepaired
+	}
+	if err := s.integrityRepo.CloseFinding(tx, id, status, userID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return s.integrityRepo.GetFinding(id)
+}
+
+// deleteOrphanMapping deletes the mapping, auditing it on its reconciliation
+// when that still exists
+func (s *IntegrityService) deleteOrphanMapping(tx *sql.Tx, finding *models.IntegrityFinding, userID string) error {
+	var held models.LegalHoldSubjects
+	if finding.Details.BankTransactionID != 0 {
+		held.BankTransactionIDs = []int64{finding.Details.BankTransactionID}
+	}
+	if finding.Details.AccountingEntryID != 0 {
+		held.AccountingEntryIDs = []int64{finding.Details.AccountingEntryID}
+	}
+	reconciliation, err := s.reconciliationRepo.GetReconciliationByID(finding.ReconciliationID)
+	switch {
+	case errors.Is(err, repositories.ErrReconciliationNotFound):
+		reconciliation = nil
+	case err != nil:
+		return fmt.Errorf("failed to get reconciliation: %v", err)
+	default:
+		held.BatchIDs = []string{reconciliation.BatchID}
+	}
+	if err := checkLegalHold(s.legalHoldRepo, held); err != nil {
+		return err
+	}
+
+	before, err := batchSummaries(s.reconciliationRepo, tx, held.BatchIDs)
+	if err != nil {
+		return err
+	}
+	if err := s.integrityRepo.DeleteMapping(tx, finding.MappingID); err != nil {
+		return fmt.Errorf("failed to delete mapping: %v", err)
+	}
+	if reconciliation == nil {
+		return nil
+	}
+	changes := map[string]interface{}{
+		"integrity_finding_id": finding.ID,
+		"repair":               finding.Repair,
+		"reconciliation_id":    reconciliation.ID,
+		"mapping_id":           finding.MappingID,
+		"reason":               finding.Details.Reason,
+		"bank_transaction_id":  finding.Details.BankTransactionID,
+		"accounting_entry_id":  finding.Details.AccountingEntryID,
+		"mapping_type":         finding.Details.MappingType,
+	}
+	if err := s.auditRepair(tx, reconciliation.ID, userID, changes); err != nil {
+		return err
+	}
+	return recordBatchDeltas(s.reconciliationRepo, tx, before, models.DeltaActionIntegrityRepair, userID, changes)
+}
+
+// unmatchDuplicates unmatches every reconciliation mapping the record but
+// the earliest, which keeps it
+func (s *IntegrityService) unmatchDuplicates(tx *sql.Tx, finding *models.IntegrityFinding, userID string) error {
+	kept := finding.Details.ReconciliationIDs[0]
+	duplicates := make([]*models.Reconciliation, 0, len(finding.Details.ReconciliationIDs)-1)
+	var batchIDs []string
+	for _, id := range finding.Details.ReconciliationIDs[1:] {
+		reconciliation, err := s.reconciliationRepo.GetReconciliationByID(id)
+		if err != nil {
+			return fmt.Errorf("failed to get reconciliation: %w", err)
+		}
+		duplicates = append(duplicates, reconciliation)
+		batchIDs = append(batchIDs, reconciliation.BatchID)
+	}
+
+	before, err := batchSummaries(s.reconciliationRepo, tx, batchIDs)
+	if err != nil {
+		return err
+	}
+	reason := fmt.Sprintf("integrity finding %d: %s %d is also mapped by reconciliation %d", finding.ID, finding.RecordType, finding.RecordID, kept)
+	unmatched := make([]map[string]interface{}, 0, len(duplicates))
+	for _, reconciliation := range duplicates {
+		changes, err := s.reconciliationService.unmatch(tx, reconciliation, reconciliation.Version, userID, reason)
+		if err != nil {
+			return err
+		}
+		unmatched = append(unmatched, changes)
+	}
+	return recordBatchDeltas(s.reconciliationRepo, tx, before, models.DeltaActionIntegrityRepair, userID, map[string]interface{}{
+		"integrity_finding_id": finding.ID,
+		"repair":               finding.Repair,
+		"record_type":          finding.RecordType,
+		"record_id":            finding.RecordID,
+		"kept_reconciliation":  kept,
+		"unmatched":            unmatched,
+	})
+}
+
+// holdForReview records the difference the group's totals make now and
+// holds a matched reconciliation for review, where it is approved at that
+// difference or rejected
+func (s *IntegrityService) holdForReview(tx *sql.Tx, finding *models.IntegrityFinding, userID string) error {
+	reconciliation, err := s.reconciliationRepo.GetReconciliationByID(finding.ReconciliationID)
+	if err != nil {
+		return fmt.Errorf("failed to get reconciliation: %w", err)
+	}
+	if err := checkLegalHold(s.legalHoldRepo, models.LegalHoldSubjects{BatchIDs: []string{reconciliation.BatchID}}); err != nil {
+		return err
+	}
+
+	before, err := batchSummaries(s.reconciliationRepo, tx, []string{reconciliation.BatchID})
+	if err != nil {
+		return err
+	}
+	if err := s.integrityRepo.SetAmountDifference(tx, reconciliation.ID, *finding.Details.ActualDifference); err != nil {
+		return fmt.Errorf("failed to set amount difference: %v", err)
+	}
+	status := reconciliation.Status
+	if status == models.StatusMatched {
+		status = models.StatusPendingReview
+	}
+	if err := s.reconciliationRepo.UpdateReconciliationStatus(tx, reconciliation.ID, status, reconciliation.Version); err != nil {
+		return fmt.Errorf("failed to update reconciliation status: %w", err)
+	}
+
+	changes := map[string]interface{}{
+		"integrity_finding_id":     finding.ID,
+		"repair":                   finding.Repair,
+		"reconciliation_id":        reconciliation.ID,
+		"status_before":            reconciliation.Status,
+		"status_after":             status,
+		"amount_difference_before": reconciliation.AmountDifference,
+		"amount_difference_after":  *finding.Details.ActualDifference,
+		"bank_total":               *finding.Details.BankTotal,
+		"ledger_total":             *finding.Details.LedgerTotal,
+		"currency":                 finding.Details.Currency,
+	}
+	if err := s.auditRepair(tx, reconciliation.ID, userID, changes); err != nil {
+		return err
+	}
+	return recordBatchDeltas(s.reconciliationRepo, tx, before, models.DeltaActionIntegrityRepair, userID, changes)
+}
+
+func (s *IntegrityService) auditRepair(tx *sql.Tx, reconciliationID int64, userID string, changes map[string]interface{}) error {
+	details, err := json.Marshal(changes)
+	if err != nil {
+		return fmt.Errorf("failed to encode repair details: %v", err)
+	}
+	audit := &models.ReconciliationAudit{
+		ReconciliationID: reconciliationID,
+		Action:           models.AuditActionRepaired,
+		Details:          details,
+		UserID:           userID,
+	}
+	if err := s.reconciliationRepo.CreateAuditEntry(tx, audit); err != nil {
+		return fmt.Errorf("failed to create audit entry: %v", err)
+	}
+	return nil
+}
+
+// RunChecker checks the mappings every interval until ctx is cancelled,
+// skipping runs during maintenance or shutdown
+func (s *IntegrityService) RunChecker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if !s.jobService.Draining() && !s.maintenanceService.Enabled() {
+			s.logRun()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *IntegrityService) logRun() {
+	run, err := s.Check("checker")
+	if err != nil {
+		log.Printf("integrity: %v", err)
+		return
+	}
+	metrics := run.Metrics
+	if metrics.OrphanMappings > 0 || metrics.MultiplyMapped > 0 || metrics.SumMismatches > 0 {
+		log.Printf("integrity: run %d found %d orphan mappings, %d multiply mapped records and %d sum mismatches (truncated: %t)",
+			run.ID, metrics.OrphanMappings, metrics.MultiplyMapped, metrics.SumMismatches, metrics.Truncated)
+	}
+	if metrics.SumUnchecked > 0 {
+		log.Printf("integrity: %d groups in more than one currency left unchecked", metrics.SumUnchecked)
+	}
+}
@@ -0,0 +1,245 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/pagination"
+	"reconciliation-service/internal/repositories"
+)
+
+var ErrDraining = errors.New("service is shutting down and not accepting new work")
+
+// ErrOverlappingRun rejects a reconciliation whose date range and bank accounts
+// overlap a run already in progress on any instance
+var ErrOverlappingRun = errors.New("a reconciliation covering overlapping dates and accounts is already in progress")
+
+// runGuardStaleAfter bounds how long a running job holds its accounts, so a
+// job orphaned by a crashed instance does not block reconciliation forever
+const runGuardStaleAfter = 6 * time.Hour
+
+// JobService records long-running work in the job table and coordinates
+// draining it on shutdown: once draining starts no new job may begin, and jobs
+// still running at the deadline are checkpointed so they can be resumed.
+type JobService struct {
+	jobRepo    repositories.JobRepository
+	instanceID string
+
+	mu       sync.Mutex
+	draining bool
+	active   map[int64]*models.ReconciliationJob
+	wg       sync.WaitGroup
+}
+
+func NewJobService(jobRepo repositories.JobRepository, instanceID string) *JobService {
+	return &JobService{
+		jobRepo:    jobRepo,
+		instanceID: instanceID,
+		active:     make(map[int64]*models.ReconciliationJob),
+	}
+}
+
+func (s *JobService) Begin(jobType, fromDate, toDate string) (*models.ReconciliationJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.draining {
+		return nil, ErrDraining
+	}
+
+	job := &models.ReconciliationJob{
+		JobType:    jobType,
+		Status:     models.JobStatusRunning,
+		FromDate:   fromDate,
+		ToDate:     toDate,
+		InstanceID: s.instanceID,
+		StartedAt:  time.Now(),
+	}
+	if err := s.jobRepo.CreateJob(job); err != nil {
+		return nil, fmt.Errorf("failed to create job: %v", err)
+	}
+
+	s.active[job.ID] = job
+	s.wg.Add(1)
+	return job, nil
+}
+
+// BeginExclusive is Begin for reconciliation runs: the job is only created
+// when no running job has an overlapping date range and shares one of the
+// bank accounts. An empty account list locks every account in the range.
+func (s *JobService) BeginExclusive(jobType, fromDate, toDate string, accounts []string) (*models.ReconciliationJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.draining {
+		return nil, ErrDraining
+	}
+
+	job := &models.ReconciliationJob{
+		JobType:    jobType,
+		Status:     models.JobStatusRunning,
+		FromDate:   fromDate,
+		ToDate:     toDate,
+		InstanceID: s.instanceID,
+		StartedAt:  time.Now(),
+	}
+	conflict, err := s.jobRepo.CreateJobExclusive(job, accounts, runGuardStaleAfter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job: %v", err)
+	}
+	if conflict != 0 {
+		return nil, fmt.Errorf("%w (job %d)", ErrOverlappingRun, conflict)
+	}
+
+	s.active[job.ID] = job
+	s.wg.Add(1)
+	return job, nil
+}
+
+// LockAccounts applies the BeginExclusive overlap rule to a job that is
+// already running, such as one claimed from the queue
+func (s *JobService) LockAccounts(job *models.ReconciliationJob, accounts []string) error {
+	conflict, err := s.jobRepo.LockJobAccounts(job, accounts, runGuardStaleAfter)
+	if err != nil {
+		return fmt.Errorf("failed to lock accounts for job %d: %v", job.ID, err)
+	}
+	if conflict != 0 {
+		return fmt.Errorf("%w (job %d)", ErrOverlappingRun, conflict)
+	}
+	return nil
+}
+
+// Adopt starts tracking a job that was claimed from the queue rather than
+// created through Begin
+func (s *JobService) Adopt(job *models.ReconciliationJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.draining {
+		return ErrDraining
+	}
+	s.active[job.ID] = job
+	s.wg.Add(1)
+	return nil
+}
+
+// Checkpoint stores how far a job got, so a drain can persist resumable state
+func (s *JobService) Checkpoint(job *models.ReconciliationJob, progress map[string]interface{}) {
+	data, err := json.Marshal(progress)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	job.Checkpoint = data
+	s.mu.Unlock()
+}
+
+func (s *JobService) Finish(job *models.ReconciliationJob, batchID string, jobErr error) {
+	s.mu.Lock()
+	if _, ok := s.active[job.ID]; !ok {
+		s.mu.Unlock()
+		return
+	}
+	delete(s.active, job.ID)
+
+	now := time.Now()
+	job.BatchID = batchID
+	job.FinishedAt = &now
+	job.Status = models.JobStatusCompleted
+	if jobErr != nil {
+		job.Status = models.JobStatusFailed
+		job.Error = jobErr.Error()
+	}
+	s.mu.Unlock()
+
+	if err := s.jobRepo.UpdateJob(job); err != nil {
+		log.Printf("failed to record completion of job %d: %v", job.ID, err)
+	}
+	s.wg.Done()
+}
+
+func (s *JobService) Draining() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.draining
+}
+
+// Drain stops new jobs from starting and waits for in-flight ones until ctx
+// expires. Whatever is still running then is checkpointed in the job table.
+func (s *JobService) Drain(ctx context.Context) error {
+	s.mu.Lock()
+	s.draining = true
+	inFlight := len(s.active)
+	s.mu.Unlock()
+
+	log.Printf("Draining %d in-flight job(s)", inFlight)
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Println("All jobs drained")
+		return nil
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	remaining := make([]*models.ReconciliationJob, 0, len(s.active))
+	for id, job := range s.active {
+		job.Status = models.JobStatusCheckpointed
+		job.Error = "interrupted by shutdown before completion"
+		remaining = append(remaining, job)
+		delete(s.active, id)
+	}
+	s.mu.Unlock()
+
+	for _, job := range remaining {
+		if err := s.jobRepo.UpdateJob(job); err != nil {
+			log.Printf("failed to checkpoint job %d: %v", job.ID, err)
+			continue
+		}
+		log.Printf("Checkpointed job %d (%s %s..%s)", job.ID, job.JobType, job.FromDate, job.ToDate)
+	}
+	return fmt.Errorf("drain deadline exceeded, %d job(s) checkpointed", len(remaining))
+}
+
+// GetJob returns a job of any status, so a client handed a job ID can follow
+// it to its batch
+func (s *JobService) GetJob(id int64) (*models.ReconciliationJob, error) {
+	return s.jobRepo.GetJobByID(id)
+}
+
+// jobsCursor names the job list in its cursors
+const jobsCursor = "jobs"
+
+// ListJobs lists the latest jobs, newest first, from the cursor a previous
+// page returned, and the cursor of the next page
+func (s *JobService) ListJobs(status, cursor string, limit int) ([]*models.ReconciliationJob, string, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	after, err := pagination.Decode(cursor, jobsCursor)
+	if err != nil {
+		return nil, "", err
+	}
+	_, beforeID := after.Key()
+	jobs, err := s.jobRepo.ListJobs(status, beforeID, limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	jobs, next := pagination.Next(jobs, limit, func(job *models.ReconciliationJob) pagination.Cursor {
+		return pagination.Cursor{List: jobsCursor, ID: job.ID}
+	})
+	return jobs, next, nil
+}
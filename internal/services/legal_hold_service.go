@@ -0,0 +1,132 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/pagination"
+	"reconciliation-service/internal/repositories"
+)
+
+var (
+	// ErrInvalidLegalHold wraps every rejection of a legal hold
+	ErrInvalidLegalHold = errors.New("invalid legal hold")
+
+	// ErrLegalHold means a change touches data under legal hold
+	ErrLegalHold = errors.New("data is under legal hold")
+)
+
+const (
+	defaultLegalHoldAuditLimit = 100
+	maxLegalHoldAuditLimit     = 1000
+)
+
+var legalHoldScopes = map[string]bool{
+	models.LegalHoldScopeBatch:           true,
+	models.LegalHoldScopeTenant:          true,
+	models.LegalHoldScopeAccount:         true,
+	models.LegalHoldScopeBankTransaction: true,
+	models.LegalHoldScopeAccountingEntry: true,
+}
+
+// LegalHoldService places and lifts legal holds. Every placement and lift is
+// audited; the changes holds block are refused by the services making them.
+type LegalHoldService struct {
+	legalHoldRepo repositories.LegalHoldRepository
+}
+
+func NewLegalHoldService(legalHoldRepo repositories.LegalHoldRepository) *LegalHoldService {
+	return &LegalHoldService{legalHoldRepo: legalHoldRepo}
+}
+
+// PlaceHold holds a batch, account, bank transaction, accounting entry or
+// tenant. Records are held by their numeric ID.
+func (s *LegalHoldService) PlaceHold(hold *models.LegalHold, userID string) (*models.LegalHold, error) {
+	hold.Scope = strings.ToLower(strings.TrimSpace(hold.Scope))
+	hold.ScopeID = strings.TrimSpace(hold.ScopeID)
+	hold.Reason = strings.TrimSpace(hold.Reason)
+	hold.CreatedBy = userID
+
+	if !legalHoldScopes[hold.Scope] {
+		return nil, fmt.Errorf("%w: scope must be batch, account, bank_transaction, accounting_entry or tenant", ErrInvalidLegalHold)
+	}
+	if hold.ScopeID == "" {
+		return nil, fmt.Errorf("%w: scope_id is required", ErrInvalidLegalHold)
+	}
+	if len(hold.ScopeID) > 255 {
+		return nil, fmt.Errorf("%w: scope_id must be at most 255 characters", ErrInvalidLegalHold)
+	}
+	if hold.Scope == models.LegalHoldScopeBankTransaction || hold.Scope == models.LegalHoldScopeAccountingEntry {
+		if id, err := strconv.ParseInt(hold.ScopeID, 10, 64); err != nil || id <= 0 {
+			return nil, fmt.Errorf("%w: scope_id of a %s hold must be its numeric ID", ErrInvalidLegalHold, hold.Scope)
+		}
+	}
+	if hold.Reason == "" {
+		return nil, fmt.Errorf("%w: reason is required", ErrInvalidLegalHold)
+	}
+	if len(hold.Reason) > 500 {
+		return nil, fmt.Errorf("%w: reason must be at most 500 characters", ErrInvalidLegalHold)
+	}
+	if err := s.legalHoldRepo.CreateHold(hold); err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+func (s *LegalHoldService) GetHold(id int64) (*models.LegalHold, error) {
+	return s.legalHoldRepo.GetHold(id)
+}
+
+func (s *LegalHoldService) ListHolds() ([]*models.LegalHold, error) {
+	return s.legalHoldRepo.ListHolds()
+}
+
+// LiftHold releases what a hold froze; expired data it kept is purged by the
+// next retention run
+func (s *LegalHoldService) LiftHold(id int64, userID string) (*models.LegalHold, error) {
+	return s.legalHoldRepo.LiftHold(id, userID)
+}
+
+// legalHoldAuditCursor names the legal hold audit trail in its cursors
+const legalHoldAuditCursor = "legal_hold_audit"
+
+// ListAudit lists the latest placements and lifts, of one hold when id is
+// not zero, from the cursor a previous page returned, and the cursor of the
+// next page
+func (s *LegalHoldService) ListAudit(id int64, cursor string, limit int) ([]*models.LegalHoldAudit, string, error) {
+	switch {
+	case limit == 0:
+		limit = defaultLegalHoldAuditLimit
+	case limit < 0 || limit > maxLegalHoldAuditLimit:
+		return nil, "", fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidLegalHold, maxLegalHoldAuditLimit)
+	}
+	after, err := pagination.Decode(cursor, legalHoldAuditCursor)
+	if err != nil {
+		return nil, "", err
+	}
+	_, beforeID := after.Key()
+	entries, err := s.legalHoldRepo.ListAudit(id, beforeID, limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	entries, next := pagination.Next(entries, limit, func(entry *models.LegalHoldAudit) pagination.Cursor {
+		return pagination.Cursor{List: legalHoldAuditCursor, ID: entry.ID}
+	})
+	return entries, next, nil
+}
+
+// checkLegalHold refuses a change touching held subjects with ErrLegalHold,
+// naming the hold
+func checkLegalHold(legalHoldRepo repositories.LegalHoldRepository, subjects models.LegalHoldSubjects) error {
+	hold, err := legalHoldRepo.FindHold(subjects)
+	if err != nil {
+		return fmt.Errorf("failed to check legal holds: %v", err)
+	}
+	if hold != nil {
+		return fmt.Errorf("%w: %s %s is held by legal hold %d", ErrLegalHold, hold.Scope, hold.ScopeID, hold.ID)
+	}
+	return nil
+}
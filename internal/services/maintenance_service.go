@@ -0,0 +1,91 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+)
+
+const (
+	defaultMaintenanceMessage = "Service is under maintenance, write operations are temporarily disabled"
+	maintenanceCacheTTL       = 5 * time.Second
+)
+
+// MaintenanceService exposes the shared maintenance switch. The state is cached
+// briefly so the middleware doesn't hit the database on every request, while
+// other instances still pick up a toggle within a few seconds.
+type MaintenanceService struct {
+	maintenanceRepo repositories.MaintenanceRepository
+
+	mu       sync.Mutex
+	cached   *models.MaintenanceMode
+	cachedAt time.Time
+}
+
+func NewMaintenanceService(maintenanceRepo repositories.MaintenanceRepository) *MaintenanceService {
+	return &MaintenanceService{
+		maintenanceRepo: maintenanceRepo,
+	}
+}
+
+func (s *MaintenanceService) GetMode() (*models.MaintenanceMode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cached != nil && time.Since(s.cachedAt) < maintenanceCacheTTL {
+		return s.cached, nil
+	}
+
+	mode, err := s.maintenanceRepo.GetMaintenanceMode()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get maintenance mode: %v", err)
+	}
+	if mode.Message == "" {
+		mode.Message = defaultMaintenanceMessage
+	}
+	s.cached = mode
+	s.cachedAt = time.Now()
+	return mode, nil
+}
+
+// Enabled reports whether writes and scheduled jobs should currently be held
+// back. Lookup failures are treated as "not in maintenance" so a database
+// hiccup doesn't lock everyone out.
+func (s *MaintenanceService) Enabled() bool {
+	mode, err := s.GetMode()
+	if err != nil {
+		log.Printf("maintenance mode lookup failed: %v", err)
+		return false
+	}
+	return mode.Enabled
+}
+
+func (s *MaintenanceService) SetMode(enabled bool, message string, retryAfterSeconds int, updatedBy string) (*models.MaintenanceMode, error) {
+	if retryAfterSeconds < 0 {
+		return nil, fmt.Errorf("retry_after_seconds must not be negative")
+	}
+	if retryAfterSeconds == 0 {
+		retryAfterSeconds = 300
+	}
+
+	mode := &models.MaintenanceMode{
+		Enabled:           enabled,
+		Message:           message,
+		RetryAfterSeconds: retryAfterSeconds,
+		UpdatedBy:         updatedBy,
+	}
+	if err := s.maintenanceRepo.UpdateMaintenanceMode(mode); err != nil {
+		return nil, fmt.Errorf("failed to update maintenance mode: %v", err)
+	}
+
+	s.mu.Lock()
+	s.cached = nil
+	s.mu.Unlock()
+
+	log.Printf("Maintenance mode set to %v by %q", enabled, updatedBy)
+	return s.GetMode()
+}
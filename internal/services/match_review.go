@@ -0,0 +1,240 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"reconciliation-service/internal/matching"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/pagination"
+)
+
+var (
+	// ErrInvalidReview wraps every rejection of a review request
+	ErrInvalidReview = errors.New("invalid review")
+	// ErrNotPendingReview rejects reviewing a reconciliation that is not
+	// waiting for review
+	ErrNotPendingReview = errors.New("reconciliation is not pending review")
+)
+
+// Review decisions
+const (
+	ReviewApprove = "approve"
+	ReviewReject  = "reject"
+)
+
+const (
+	DefaultPendingReviewLimit = 100
+	MaxPendingReviewLimit     = 1000
+	// Most matches one bulk review may decide
+	MaxBulkReview = 500
+
+	pendingReviewCursor = "pending_review"
+)
+
+// PendingMatch is a match waiting for review, with the fields of a run's
+// matches
+type PendingMatch struct {
+	ReconciliationID int64  `json:"reconciliation_id"`
+	BatchID          string `json:"batch_id"`
+	Version          int    `json:"version"`
+	*matching.MatchesResult
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ReviewOutcome is what became of one match of a bulk review: its status
+// after the review, or why it was left as it was
+type ReviewOutcome struct {
+	ReconciliationID int64  `json:"reconciliation_id"`
+	Status           string `json:"status,omitempty"`
+	Error            string `json:"error,omitempty"`
+}
+
+// matchStatus is the status a run stores a match with: pending review below
+// the review confidence, matched otherwise. The policy pack of the match's
+// bank account, or of the tenant, sets the review confidence in place of
+// the configured one.
+func (s *ReconciliationService) matchStatus(policy *packPolicy, m *matching.MatchResult) string {
+	reviewConfidence := s.reviewConfidence
+	if pack := policy.forAccount(m.AllBankTransactions()[0].AccountNumber); pack != nil {
+		reviewConfidence = pack.ReviewConfidence
+	}
+	if m.Confidence < reviewConfidence {
+		return models.StatusPendingReview
+	}
+	return models.StatusMatched
+}
+
+func (s *ReconciliationService) countPendingReview(policy *packPolicy, matches []*matching.MatchResult) int {
+	count := 0
+	for _, m := range matches {
+		if s.matchStatus(policy, m) == models.StatusPendingReview {
+			count++
+		}
+	}
+	return count
+}
+
+// ListPendingReview lists the matches waiting for review oldest first,
+// optionally of one batch, from the cursor a previous page returned, and the
+// cursor of the next page
+func (s *ReconciliationService) ListPendingReview(batchID, cursor string, limit int) ([]*PendingMatch, string, error) {
+	switch {
+	case limit == 0:
+		limit = DefaultPendingReviewLimit
+	case limit < 0 || limit > MaxPendingReviewLimit:
+		return nil, "", fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidReview, MaxPendingReviewLimit)
+	}
+	after, err := pagination.Decode(cursor, pendingReviewCursor)
+	if err != nil {
+		return nil, "", err
+	}
+	_, afterID := after.Key()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	reconciliations, err := s.reconciliationRepo.ListPendingReview(tx, strings.TrimSpace(batchID), afterID, limit+1)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list matches pending review: %v", err)
+	}
+	reconciliations, next := pagination.Next(reconciliations, limit, func(rec *models.ReconciliationDetail) pagination.Cursor {
+		return pagination.Cursor{List: pendingReviewCursor, ID: rec.ID}
+	})
+
+	pending := make([]*PendingMatch, len(reconciliations))
+	for i, rec := range reconciliations {
+		pending[i] = &PendingMatch{
+			ReconciliationID: rec.ID,
+			BatchID:          rec.BatchID,
+			Version:          rec.Version,
+			MatchesResult:    matchFromMappings(rec),
+			CreatedAt:        rec.CreatedAt,
+		}
+	}
+	return pending, next, nil
+}
+
+// ReviewMatch approves or rejects a match pending review. Approval makes it
+// matched; rejection releases its records like an unmatch and leaves it
+// unmatched, and requires a reason. Either is audited and recorded as a
+// batch delta. A zero version reviews whatever version is current.
+func (s *ReconciliationService) ReviewMatch(id int64, decision string, version int, userID, reason string) (*models.Reconciliation, error) {
+	decision = strings.ToLower(strings.TrimSpace(decision))
+	reason = strings.TrimSpace(reason)
+	if decision != ReviewApprove && decision != ReviewReject {
+		return nil, fmt.Errorf("%w: decision must be %s or %s", ErrInvalidReview, ReviewApprove, ReviewReject)
+	}
+	if decision == ReviewReject && reason == "" {
+		return nil, fmt.Errorf("%w: rejecting a match requires a reason", ErrInvalidReview)
+	}
+
+	reconciliation, err := s.reconciliationRepo.GetReconciliationByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reconciliation: %w", err)
+	}
+	if reconciliation.Status != models.StatusPendingReview {
+		return nil, ErrNotPendingReview
+	}
+	if version == 0 {
+		version = reconciliation.Version
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	before, err := batchSummaries(s.reconciliationRepo, tx, []string{reconciliation.BatchID})
+	if err != nil {
+		return nil, err
+	}
+
+	status, action, deltaAction := models.StatusMatched, models.AuditActionApproved, models.DeltaActionApprove
+	changes := map[string]interface{}{
+		"reconciliation_id": id,
+		"status_before":     reconciliation.Status,
+		"match_confidence":  reconciliation.MatchConfidence,
+		"reason":            reason,
+	}
+	if decision == ReviewReject {
+		status, action, deltaAction = models.StatusUnmatched, models.AuditActionRejected, models.DeltaActionReject
+		released, err := s.releaseMappings(tx, reconciliation)
+		if err != nil {
+			return nil, err
+		}
+		changes["mappings"] = released
+	} else if err := checkLegalHold(s.legalHoldRepo, models.LegalHoldSubjects{BatchIDs: []string{reconciliation.BatchID}}); err != nil {
+		return nil, err
+	}
+	changes["status_after"] = status
+
+	if err := s.reconciliationRepo.UpdateReconciliationStatus(tx, id, status, version); err != nil {
+		return nil, fmt.Errorf("failed to update reconciliation status: %w", err)
+	}
+	details, err := json.Marshal(changes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode review details: %v", err)
+	}
+	audit := &models.ReconciliationAudit{
+		ReconciliationID: id,
+		Action:           action,
+		Details:          details,
+		UserID:           userID,
+	}
+	if err := s.reconciliationRepo.CreateAuditEntry(tx, audit); err != nil {
+		return nil, fmt.Errorf("failed to create audit entry: %v", err)
+	}
+	if err := recordBatchDeltas(s.reconciliationRepo, tx, before, deltaAction, userID, changes); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	return s.reconciliationRepo.GetReconciliationByID(id)
+}
+
+// ReviewMatches approves or rejects several matches pending review with the
+// same decision and reason. Each is reviewed on its own, so one that cannot
+// be reviewed is reported in its outcome without holding up the others.
+func (s *ReconciliationService) ReviewMatches(ids []int64, decision, userID, reason string) ([]*ReviewOutcome, error) {
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("%w: ids are required", ErrInvalidReview)
+	}
+	if len(ids) > MaxBulkReview {
+		return nil, fmt.Errorf("%w: at most %d matches can be reviewed at once", ErrInvalidReview, MaxBulkReview)
+	}
+	decision = strings.ToLower(strings.TrimSpace(decision))
+	if decision != ReviewApprove && decision != ReviewReject {
+		return nil, fmt.Errorf("%w: decision must be %s or %s", ErrInvalidReview, ReviewApprove, ReviewReject)
+	}
+	if decision == ReviewReject && strings.TrimSpace(reason) == "" {
+		return nil, fmt.Errorf("%w: rejecting a match requires a reason", ErrInvalidReview)
+	}
+
+	outcomes := make([]*ReviewOutcome, 0, len(ids))
+	seen := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		outcome := &ReviewOutcome{ReconciliationID: id}
+		if reconciliation, err := s.ReviewMatch(id, decision, 0, userID, reason); err != nil {
+			outcome.Error = err.Error()
+		} else {
+			outcome.Status = reconciliation.Status
+		}
+		outcomes = append(outcomes, outcome)
+	}
+	return outcomes, nil
+}
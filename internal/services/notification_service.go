@@ -0,0 +1,200 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"reconciliation-service/internal/i18n"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+)
+
+// ErrInvalidPreferences wraps every rejection of notification preferences
+var ErrInvalidPreferences = errors.New("invalid notification preferences")
+
+var notificationEvents = map[string]bool{
+	models.NotificationEventReconciliationCompleted: true,
+	models.NotificationEventReconciliationFailed:    true,
+	models.NotificationEventQuotaExceeded:           true,
+	models.NotificationEventMaintenanceEnabled:      true,
+	models.NotificationEventBatchChanged:            true,
+	models.NotificationEventExpectationMissed:       true,
+	models.NotificationEventDailyDigest:             true,
+}
+
+var notificationChannels = map[string]bool{
+	models.NotificationChannelEmail:   true,
+	models.NotificationChannelWebhook: true,
+}
+
+var notificationDeliveries = map[string]bool{
+	models.NotificationDeliveryImmediate: true,
+	models.NotificationDeliveryDigest:    true,
+}
+
+type NotificationService struct {
+	notificationRepo repositories.NotificationRepository
+	defaultLocale    string
+	dedupWindow      time.Duration
+}
+
+func NewNotificationService(notificationRepo repositories.NotificationRepository, defaultLocale string, dedupWindow time.Duration) *NotificationService {
+	if !i18n.Supported(defaultLocale) {
+		defaultLocale = i18n.DefaultLocale
+	}
+	return &NotificationService{
+		notificationRepo: notificationRepo,
+		defaultLocale:    defaultLocale,
+		dedupWindow:      dedupWindow,
+	}
+}
+
+func (s *NotificationService) GetPreferences(userID string) (*models.NotificationPreferences, error) {
+	return s.notificationRepo.GetPreferences(userID)
+}
+
+func (s *NotificationService) ListPreferences() ([]*models.NotificationPreferences, error) {
+	return s.notificationRepo.ListPreferences()
+}
+
+// SavePreferences replaces a user's settings and subscriptions. Every
+// subscribed channel needs its address configured.
+func (s *NotificationService) SavePreferences(prefs *models.NotificationPreferences) (*models.NotificationPreferences, error) {
+	if err := validatePreferences(prefs); err != nil {
+		return nil, err
+	}
+	if err := s.notificationRepo.SavePreferences(prefs); err != nil {
+		return nil, fmt.Errorf("failed to save notification preferences: %v", err)
+	}
+	return s.notificationRepo.GetPreferences(prefs.UserID)
+}
+
+func (s *NotificationService) DeletePreferences(userID string) error {
+	return s.notificationRepo.DeletePreferences(userID)
+}
+
+// Routes resolves who receives an event on which channel and how. The
+// alerting, webhook and email senders deliver immediate routes at once and
+// collect digest routes for the periodic summary.
+func (s *NotificationService) Routes(eventType string) ([]models.NotificationRoute, error) {
+	if !notificationEvents[eventType] {
+		return nil, fmt.Errorf("%w: unknown event type %q", ErrInvalidPreferences, eventType)
+	}
+	routes, err := s.notificationRepo.GetRoutes(eventType)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := []models.NotificationRoute{}
+	for _, route := range routes {
+		if route.Address == "" {
+			continue
+		}
+		if !i18n.Supported(route.Locale) {
+			route.Locale = s.defaultLocale
+		}
+		resolved = append(resolved, route)
+	}
+	return resolved, nil
+}
+
+// Dispatch is asked by the senders before delivering an occurrence of an
+// event for an entity, such as a batch ID or a tenant. The first occurrence
+// in the dedup window is sent to its routes; repeats inside the window, as
+// from a flapping condition, are suppressed and counted, and the count is
+// reported with the next delivery. A zero window sends every occurrence.
+func (s *NotificationService) Dispatch(eventType, entity string) (*models.NotificationDispatch, error) {
+	entity = strings.TrimSpace(entity)
+	if !notificationEvents[eventType] {
+		return nil, fmt.Errorf("%w: unknown event type %q", ErrInvalidPreferences, eventType)
+	}
+	if len(entity) > 255 {
+		return nil, fmt.Errorf("%w: entity must be at most 255 characters", ErrInvalidPreferences)
+	}
+
+	dispatch := &models.NotificationDispatch{
+		EventType:  eventType,
+		Entity:     entity,
+		Sent:       true,
+		LastSentAt: time.Now(),
+	}
+	if s.dedupWindow > 0 {
+		var err error
+		if dispatch, err = s.notificationRepo.ClaimDispatch(eventType, entity, s.dedupWindow); err != nil {
+			return nil, fmt.Errorf("failed to claim notification dispatch: %v", err)
+		}
+	}
+
+	dispatch.Routes = []models.NotificationRoute{}
+	if !dispatch.Sent {
+		return dispatch, nil
+	}
+	routes, err := s.Routes(eventType)
+	if err != nil {
+		return nil, err
+	}
+	dispatch.Routes = routes
+	return dispatch, nil
+}
+
+// Render produces the localized subject and body of an event for a route
+func (s *NotificationService) Render(route models.NotificationRoute, eventType string, subjectArgs, bodyArgs []interface{}) (string, string) {
+	prefix := "notification." + eventType
+	return i18n.T(route.Locale, prefix+".subject", subjectArgs...), i18n.T(route.Locale, prefix+".body", bodyArgs...)
+}
+
+func validatePreferences(prefs *models.NotificationPreferences) error {
+	prefs.UserID = strings.TrimSpace(prefs.UserID)
+	prefs.Email = strings.TrimSpace(prefs.Email)
+	prefs.WebhookURL = strings.TrimSpace(prefs.WebhookURL)
+	prefs.Locale = strings.ToLower(strings.TrimSpace(prefs.Locale))
+
+	if prefs.UserID == "" {
+		return fmt.Errorf("%w: user_id is required", ErrInvalidPreferences)
+	}
+	if prefs.Email != "" {
+		if _, err := mail.ParseAddress(prefs.Email); err != nil {
+			return fmt.Errorf("%w: invalid email %q", ErrInvalidPreferences, prefs.Email)
+		}
+	}
+	if prefs.WebhookURL != "" {
+		u, err := url.Parse(prefs.WebhookURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("%w: webhook_url must be an http(s) URL", ErrInvalidPreferences)
+		}
+	}
+	if prefs.Locale != "" && !i18n.Supported(prefs.Locale) {
+		return fmt.Errorf("%w: unsupported locale %q", ErrInvalidPreferences, prefs.Locale)
+	}
+
+	seen := make(map[string]bool)
+	for i, sub := range prefs.Subscriptions {
+		if !notificationEvents[sub.EventType] {
+			return fmt.Errorf("%w: unknown event type %q", ErrInvalidPreferences, sub.EventType)
+		}
+		if !notificationChannels[sub.Channel] {
+			return fmt.Errorf("%w: unknown channel %q", ErrInvalidPreferences, sub.Channel)
+		}
+		if sub.Delivery == "" {
+			prefs.Subscriptions[i].Delivery = models.NotificationDeliveryImmediate
+		} else if !notificationDeliveries[sub.Delivery] {
+			return fmt.Errorf("%w: delivery must be immediate or digest", ErrInvalidPreferences)
+		}
+		if sub.Channel == models.NotificationChannelEmail && prefs.Email == "" {
+			return fmt.Errorf("%w: email channel requires an email address", ErrInvalidPreferences)
+		}
+		if sub.Channel == models.NotificationChannelWebhook && prefs.WebhookURL == "" {
+			return fmt.Errorf("%w: webhook channel requires a webhook_url", ErrInvalidPreferences)
+		}
+		key := sub.EventType + "/" + sub.Channel
+		if seen[key] {
+			return fmt.Errorf("%w: duplicate subscription %s on %s", ErrInvalidPreferences, sub.EventType, sub.Channel)
+		}
+		seen[key] = true
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"reconciliation-service/internal/config"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+)
+
+// objectFetchTimeout bounds listing a prefix, and downloading one object
+const objectFetchTimeout = 5 * time.Minute
+
+// ObjectFetchService pulls statement files from S3-compatible buckets. Every
+// object below a bucket prefix is ingested like an upload to
+// /bank-statements, as an ingestion file with source s3:<bucket>. Objects
+// are left where they are; the key and ETag of each one processed are
+// recorded, so later polls download only new or overwritten objects. An
+// object whose content was ingested before, under any key or over SFTP, is
+// not ingested again. One that failed for a reason that may pass is not
+// recorded and is pulled again.
+type ObjectFetchService struct {
+	dataIngestionService *DataIngestionService
+	jobService           *JobService
+	maintenanceService   *MaintenanceService
+	anomalyService       *IngestionAnomalyService
+	fileRepo             repositories.IngestionFileRepository
+	config               config.S3Config
+	// running keeps fetches of this instance from overlapping
+	running sync.Mutex
+}
+
+func NewObjectFetchService(dataIngestionService *DataIngestionService, jobService *JobService, maintenanceService *MaintenanceService, anomalyService *IngestionAnomalyService, fileRepo repositories.IngestionFileRepository, cfg config.S3Config) *ObjectFetchService {
+	return &ObjectFetchService{
+		dataIngestionService: dataIngestionService,
+		jobService:           jobService,
+		maintenanceService:   maintenanceService,
+		anomalyService:       anomalyService,
+		fileRepo:             fileRepo,
+		config:               cfg,
+	}
+}
+
+// RunFetcher pulls the configured sources every interval until ctx is
+// cancelled. Nothing is pulled while the service drains or is in
+// maintenance.
+func (s *ObjectFetchService) RunFetcher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if !s.jobService.Draining() && !s.maintenanceService.Enabled() {
+			s.logFetch()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *ObjectFetchService) logFetch() {
+	result, err := s.Fetch("fetcher")
+	if errors.Is(err, ErrFetchRunning) {
+		return
+	}
+	if err != nil {
+		log.Printf("s3: %v", err)
+		return
+	}
+	for _, failure := range result.Errors {
+		log.Printf("s3: %s", failure)
+	}
+	if result.Ingested > 0 || result.Rejected > 0 || result.Failed > 0 || result.Duplicates > 0 {
+		log.Printf("s3: ingested %d objects, rejected %d, failed %d and skipped %d duplicates",
+			result.Ingested, result.Rejected, result.Failed, result.Duplicates)
+	}
+}
+
+// Fetch pulls every configured source once
+func (s *ObjectFetchService) Fetch(triggeredBy string) (*FetchResult, error) {
+	if !s.config.Enabled() {
+		return nil, ErrFetchDisabled
+	}
+	sources := make([][2]string, 0, len(s.config.Sources))
+	for _, source := range s.config.Sources {
+		bucket, prefix, _ := strings.Cut(source, "/")
+		sources = append(sources, [2]string{bucket, prefix})
+	}
+	return s.fetch(sources, triggeredBy)
+}
+
+// FetchPrefix pulls the objects below one bucket prefix now, whether or not
+// it is a configured source
+func (s *ObjectFetchService) FetchPrefix(bucket, prefix, triggeredBy string) (*FetchResult, error) {
+	if s.config.Endpoint == "" {
+		return nil, ErrFetchDisabled
+	}
+	bucket = strings.TrimSpace(bucket)
+	if bucket == "" {
+		return nil, fmt.Errorf("%w: bucket is required", ErrInvalidIngestionFiles)
+	}
+	return s.fetch([][2]string{{bucket, strings.TrimPrefix(prefix, "/")}}, triggeredBy)
+}
+
+func (s *ObjectFetchService) fetch(sources [][2]string, triggeredBy string) (*FetchResult, error) {
+	if !s.running.TryLock() {
+		return nil, ErrFetchRunning
+	}
+	defer s.running.Unlock()
+
+	client, err := minio.New(s.config.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(s.config.AccessKey, s.config.SecretKey, ""),
+		Secure: s.config.UseSSL,
+		Region: s.config.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint %s: %w", s.config.Endpoint, err)
+	}
+
+	result := &FetchResult{TriggeredBy: triggeredBy}
+	for _, source := range sources {
+		bucket, prefix := source[0], source[1]
+		if err := s.fetchPrefix(client, bucket, prefix, result); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", path.Join(bucket, prefix), err))
+			if errors.Is(err, ErrDraining) {
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// fetchPrefix ingests the objects below a prefix not processed before.
+// Folder markers, keys ending in a slash, are passed over.
+func (s *ObjectFetchService) fetchPrefix(client *minio.Client, bucket, prefix string, result *FetchResult) error {
+	processed, err := s.fileRepo.ProcessedObjects(bucket, prefix)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), objectFetchTimeout)
+	defer cancel()
+	var objects []minio.ObjectInfo
+	for object := range client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if object.Err != nil {
+			return object.Err
+		}
+		if strings.HasSuffix(object.Key, "/") || processed[object.Key] == object.ETag {
+			continue
+		}
+		objects = append(objects, object)
+	}
+
+	for _, object := range objects {
+		if err := s.fetchObject(client, bucket, object, result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchObject claims and ingests a single object. Problems with the object
+// are counted in result; the error returned stops the fetch of the prefix,
+// and is only returned once the service drains.
+func (s *ObjectFetchService) fetchObject(client *minio.Client, bucket string, object minio.ObjectInfo, result *FetchResult) error {
+	data, checksum, err := readObject(client, bucket, object.Key)
+	if err != nil {
+		result.Failed++
+		result.Errors = append(result.Errors, fmt.Sprintf("%s/%s: %v", bucket, object.Key, err))
+		return nil
+	}
+
+	file := &models.IngestionFile{
+		Source:   "s3:" + bucket,
+		FileName: object.Key,
+		Checksum: checksum,
+		Size:     object.Size,
+	}
+	claimed, err := s.fileRepo.ClaimFile(file, time.Now().Add(-ingestionFileStaleAfter))
+	if err != nil {
+		result.Failed++
+		result.Errors = append(result.Errors, fmt.Sprintf("%s/%s: %v", bucket, object.Key, err))
+		return nil
+	}
+	if !claimed {
+		switch file.Status {
+		case models.IngestionFileIngested, models.IngestionFileRejected:
+			log.Printf("s3: %s/%s has the content of file %d (%s), not ingested again", bucket, object.Key, file.ID, file.FileName)
+			s.anomalyService.DuplicateFile("s3:"+bucket, object.Key, file)
+			s.recordObject(bucket, object, file.ID, result)
+			result.Duplicates++
+		default:
+			result.Skipped++
+		}
+		return nil
+	}
+
+	err = ingestStatementFile(s.dataIngestionService, s.jobService, s.anomalyService, file, data)
+	recordFileOutcome(file, err, result)
+	finishFile(s.fileRepo, file, result)
+	if file.Status != models.IngestionFileFailed {
+		s.recordObject(bucket, object, file.ID, result)
+	}
+	if errors.Is(err, ErrDraining) {
+		return err
+	}
+	return nil
+}
+
+func (s *ObjectFetchService) recordObject(bucket string, object minio.ObjectInfo, fileID int64, result *FetchResult) {
+	if err := s.fileRepo.RecordObject(bucket, object.Key, object.ETag, fileID); err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("%s/%s: failed to record as processed: %v", bucket, object.Key, err))
+	}
+}
+
+// readObject reads an object up to one byte past the statement size limit,
+// which is enough to refuse it, and the SHA-256 of its whole content
+func readObject(client *minio.Client, bucket, key string) ([]byte, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), objectFetchTimeout)
+	defer cancel()
+	object, err := client.GetObject(ctx, bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, "", err
+	}
+	defer object.Close()
+
+	hash := sha256.New()
+	data, err := io.ReadAll(io.LimitReader(io.TeeReader(object, hash), MaxStatementSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := io.Copy(hash, object); err != nil {
+		return nil, "", err
+	}
+	return data, hex.EncodeToString(hash.Sum(nil)), nil
+}
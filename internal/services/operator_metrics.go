@@ -0,0 +1,116 @@
+package services
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"sort"
+
+	"reconciliation-service/internal/metrics"
+	"reconciliation-service/internal/models"
+)
+
+// ErrMetricsUnauthorized means a scrape did not carry the metrics token
+var ErrMetricsUnauthorized = errors.New("invalid metrics token")
+
+const metricsPrefix = "reconciliation_"
+
+// OperatorMetricsService reports the operational backlog of every tenant,
+// labeled by tenant and account, for Prometheus to scrape. The sandbox is
+// left out: its records are synthetic.
+type OperatorMetricsService struct {
+	tenants   []string
+	analytics map[string]*AnalyticsService
+	// Bearer token scrapes must carry; empty leaves the metrics public
+	token string
+}
+
+func NewOperatorMetricsService(graphs map[string]*Services, token string) *OperatorMetricsService {
+	service := &OperatorMetricsService{
+		analytics: make(map[string]*AnalyticsService, len(graphs)),
+		token:     token,
+	}
+	for tenant, svc := range graphs {
+		if svc.Sandbox != nil {
+			continue
+		}
+		service.tenants = append(service.tenants, tenant)
+		service.analytics[tenant] = svc.Analytics
+	}
+	sort.Strings(service.tenants)
+	return service
+}
+
+// Authorize checks the bearer token of a scrape
+func (s *OperatorMetricsService) Authorize(token string) error {
+	if s.token == "" {
+		return nil
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+		return ErrMetricsUnauthorized
+	}
+	return nil
+}
+
+// Collect reads the backlog of every tenant. A tenant whose backlog cannot
+// be read is logged and reported down rather than failing the scrape.
+func (s *OperatorMetricsService) Collect() []metrics.Family {
+	up := family("metrics_tenant_up", metrics.TypeGauge, "Whether the backlog of the tenant could be read.")
+	unmatched := family("unmatched_items", metrics.TypeGauge, "Bank transactions and accounting entries no match settles, by account.")
+	pending := family("pending_reviews", metrics.TypeGauge, "Matches waiting on review, by the bank account of their transactions.")
+	disputed := family("open_disputes", metrics.TypeGauge, "Disputed matches, by the bank account of their transactions.")
+	exceptions := family("open_exceptions", metrics.TypeGauge, "Exceptions neither resolved nor written off, by account and status.")
+	resolution := family("exception_resolution_seconds", metrics.TypeSummary, "Time from raising an exception to closing it.")
+	meanResolution := family("exception_mean_time_to_resolve_seconds", metrics.TypeGauge, "Mean time from raising an exception to closing it.")
+
+	for _, tenant := range s.tenants {
+		backlog, err := s.analytics[tenant].OperatorBacklog()
+		if err != nil {
+			log.Printf("Failed to read the operator backlog of tenant %s: %v", tenant, err)
+			up.Samples = append(up.Samples, metrics.Sample{Labels: map[string]string{"tenant": tenant}, Value: 0})
+			continue
+		}
+		up.Samples = append(up.Samples, metrics.Sample{Labels: map[string]string{"tenant": tenant}, Value: 1})
+
+		addCounts(unmatched, tenant, backlog.UnmatchedBank, "side", "bank")
+		addCounts(unmatched, tenant, backlog.UnmatchedLedger, "side", "ledger")
+		addCounts(pending, tenant, backlog.PendingReview)
+		addCounts(disputed, tenant, backlog.Disputed)
+		for _, count := range backlog.OpenExceptions {
+			exceptions.Samples = append(exceptions.Samples, metrics.Sample{
+				Labels: map[string]string{"tenant": tenant, "account": count.Account, "status": count.Status},
+				Value:  float64(count.Count),
+			})
+		}
+		addResolutions(resolution, meanResolution, tenant, backlog.Resolutions)
+	}
+	return []metrics.Family{*up, *unmatched, *pending, *disputed, *exceptions, *resolution, *meanResolution}
+}
+
+func family(name, kind, help string) *metrics.Family {
+	return &metrics.Family{Name: metricsPrefix + name, Type: kind, Help: help}
+}
+
+// addCounts adds a sample per account, labeled with the extra label pairs
+func addCounts(f *metrics.Family, tenant string, counts []*models.AccountCount, extra ...string) {
+	for _, count := range counts {
+		labels := map[string]string{"tenant": tenant, "account": count.Account}
+		for i := 0; i+1 < len(extra); i += 2 {
+			labels[extra[i]] = extra[i+1]
+		}
+		f.Samples = append(f.Samples, metrics.Sample{Labels: labels, Value: float64(count.Count)})
+	}
+}
+
+func addResolutions(summary, mean *metrics.Family, tenant string, resolutions []*models.ExceptionResolution) {
+	for _, resolution := range resolutions {
+		labels := map[string]string{"tenant": tenant, "account": resolution.Account}
+		summary.Samples = append(summary.Samples,
+			metrics.Sample{Suffix: "_sum", Labels: labels, Value: resolution.Seconds},
+			metrics.Sample{Suffix: "_count", Labels: labels, Value: float64(resolution.Count)},
+		)
+		if resolution.Count > 0 {
+			mean.Samples = append(mean.Samples, metrics.Sample{Labels: labels, Value: resolution.Seconds / float64(resolution.Count)})
+		}
+	}
+}
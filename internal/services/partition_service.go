@@ -0,0 +1,398 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"reconciliation-service/internal/matching"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+)
+
+const maxPartitions = 64
+
+// PartitionService splits a large reconciliation into partition jobs that any
+// instance's worker can claim from the job table. All partitions write under
+// one batch ID, and whichever worker completes the last partition finalizes
+// the batch.
+type PartitionService struct {
+	reconciliationService *ReconciliationService
+	bankRepo              repositories.BankRepository
+	accountingRepo        repositories.AccountingRepository
+	jobRepo               repositories.JobRepository
+	maintenanceService    *MaintenanceService
+	usageService          *UsageService
+	instanceID            string
+}
+
+func NewPartitionService(
+	reconciliationService *ReconciliationService,
+	bankRepo repositories.BankRepository,
+	accountingRepo repositories.AccountingRepository,
+	jobRepo repositories.JobRepository,
+	maintenanceService *MaintenanceService,
+	usageService *UsageService,
+	instanceID string,
+) *PartitionService {
+	return &PartitionService{
+		reconciliationService: reconciliationService,
+		bankRepo:              bankRepo,
+		accountingRepo:        accountingRepo,
+		jobRepo:               jobRepo,
+		maintenanceService:    maintenanceService,
+		usageService:          usageService,
+		instanceID:            instanceID,
+	}
+}
+
+type partitionState struct {
+	Strategy   string `json:"strategy"`
+	Partition  int    `json:"partition"`
+	Partitions int    `json:"partitions"`
+	// Dates of the bank transactions and accounting entries a date_range
+	// partition reconciled
+	WindowFrom    string `json:"window_from,omitempty"`
+	WindowTo      string `json:"window_to,omitempty"`
+	EntriesFrom   string `json:"entries_from,omitempty"`
+	EntriesTo     string `json:"entries_to,omitempty"`
+	BankCount     int    `json:"bank_transactions,omitempty"`
+	Matched       int    `json:"matched,omitempty"`
+	UnmatchedBank int    `json:"unmatched_bank,omitempty"`
+}
+
+type PartitionedRun struct {
+	BatchID    string                      `json:"reconciliation_id"`
+	Status     string                      `json:"status"`
+	Run        *models.ReconciliationJob   `json:"run"`
+	Partitions []*models.ReconciliationJob `json:"partitions"`
+}
+
+// StartPartitionedRun queues the partitions of a run. Its batch is counted as
+// one batch run of usageEntity once every partition completed.
+func (s *PartitionService) StartPartitionedRun(fromDate, toDate, strategy string, partitions int, requestedBy, usageEntity string) (*PartitionedRun, error) {
+	if strategy == "" {
+		strategy = models.PartitionByAccountHash
+	}
+	if strategy != models.PartitionByAccountHash && strategy != models.PartitionByIDRange && strategy != models.PartitionByDateRange {
+		return nil, fmt.Errorf("strategy must be %s, %s or %s", models.PartitionByAccountHash, models.PartitionByIDRange, models.PartitionByDateRange)
+	}
+	if partitions < 1 || partitions > maxPartitions {
+		return nil, fmt.Errorf("partitions must be between 1 and %d", maxPartitions)
+	}
+	if strategy == models.PartitionByDateRange {
+		days, err := periodDays(fromDate, toDate)
+		if err != nil {
+			return nil, err
+		}
+		if partitions > days {
+			return nil, fmt.Errorf("a %s run of %d day(s) takes at most %d partitions", models.PartitionByDateRange, days, days)
+		}
+	}
+
+	batchID := s.reconciliationService.newBatchID()
+	state, _ := json.Marshal(partitionState{Strategy: strategy, Partitions: partitions})
+	parent := &models.ReconciliationJob{
+		JobType:     models.JobTypePartitionedRun,
+		BatchID:     batchID,
+		Status:      models.JobStatusRunning,
+		FromDate:    fromDate,
+		ToDate:      toDate,
+		InstanceID:  s.instanceID,
+		RequestedBy: requestedBy,
+		UsageEntity: usageEntity,
+		Checkpoint:  state,
+	}
+	if err := s.jobRepo.CreateJob(parent); err != nil {
+		return nil, fmt.Errorf("failed to create partitioned run: %v", err)
+	}
+
+	run := &PartitionedRun{BatchID: batchID, Status: parent.Status, Run: parent}
+	for i := 0; i < partitions; i++ {
+		state, _ := json.Marshal(partitionState{Strategy: strategy, Partition: i, Partitions: partitions})
+		child := &models.ReconciliationJob{
+			JobType:     models.JobTypePartition,
+			BatchID:     batchID,
+			Status:      models.JobStatusQueued,
+			FromDate:    fromDate,
+			ToDate:      toDate,
+			RequestedBy: requestedBy,
+			Checkpoint:  state,
+		}
+		if err := s.jobRepo.CreateJob(child); err != nil {
+			return nil, fmt.Errorf("failed to queue partition %d: %v", i, err)
+		}
+		run.Partitions = append(run.Partitions, child)
+	}
+
+	log.Printf("Queued partitioned run %s with %d partition(s) by %s", batchID, partitions, strategy)
+	return run, nil
+}
+
+func (s *PartitionService) GetPartitionedRun(batchID string) (*PartitionedRun, error) {
+	jobs, err := s.jobRepo.ListJobsByBatch(batchID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get partitioned run: %v", err)
+	}
+
+	run := &PartitionedRun{BatchID: batchID}
+	for _, job := range jobs {
+		switch job.JobType {
+		case models.JobTypePartitionedRun:
+			run.Run = job
+			run.Status = job.Status
+		case models.JobTypePartition:
+			run.Partitions = append(run.Partitions, job)
+		}
+	}
+	if run.Run == nil {
+		return nil, fmt.Errorf("partitioned run not found")
+	}
+	return run, nil
+}
+
+// RunWorker claims and processes partition jobs until ctx is cancelled.
+// Claiming pauses while maintenance mode is on.
+func (s *PartitionService) RunWorker(ctx context.Context, pollInterval time.Duration) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		for !s.maintenanceService.Enabled() {
+			processed, err := s.processNext()
+			if err != nil {
+				log.Printf("partition worker: %v", err)
+			}
+			if !processed || ctx.Err() != nil {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *PartitionService) processNext() (bool, error) {
+	job, err := s.jobRepo.ClaimQueuedJob(models.JobTypePartition, s.instanceID, 0, 0)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim partition: %v", err)
+	}
+	if job == nil {
+		return false, nil
+	}
+
+	state, err := s.processPartition(job)
+	now := time.Now()
+	job.FinishedAt = &now
+	job.Status = models.JobStatusCompleted
+	if err != nil {
+		job.Status = models.JobStatusFailed
+		job.Error = err.Error()
+	} else {
+		job.Checkpoint, _ = json.Marshal(state)
+	}
+	if updateErr := s.jobRepo.UpdateJob(job); updateErr != nil {
+		return true, fmt.Errorf("failed to record partition %d: %v", job.ID, updateErr)
+	}
+
+	if err := s.finalizeIfComplete(job.BatchID); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+func (s *PartitionService) processPartition(job *models.ReconciliationJob) (*partitionState, error) {
+	var state partitionState
+	if err := json.Unmarshal(job.Checkpoint, &state); err != nil {
+		return nil, fmt.Errorf("invalid partition state: %v", err)
+	}
+
+	var bankTransactions []*models.BankTransaction
+	var accountingEntries []*models.AccountingEntry
+	var err error
+	if state.Strategy == models.PartitionByDateRange {
+		bankTransactions, accountingEntries, err = s.windowRecords(job, &state)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		bankTransactions, err = s.bankRepo.GetUnreconciledTransactionsPartition(job.FromDate, job.ToDate, state.Strategy, state.Partition, state.Partitions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get partition bank transactions: %v", err)
+		}
+		accountingEntries, err = s.accountingRepo.GetUnreconciledEntries(context.Background(), job.FromDate, job.ToDate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get unreconciled accounting entries: %v", err)
+		}
+	}
+
+	result, err := s.reconciliationService.processBatch(job.BatchID, bankTransactions, accountingEntries, batchOptions{
+		skipContended: true,
+		userID:        job.RequestedBy,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	state.BankCount = len(bankTransactions)
+	state.Matched = len(result.Matches)
+	state.UnmatchedBank = state.BankCount - state.Matched
+	return &state, nil
+}
+
+// windowRecords loads the unreconciled bank transactions of a date_range
+// partition's window and the unreconciled entries that can match them,
+// recording both ranges in state
+func (s *PartitionService) windowRecords(job *models.ReconciliationJob, state *partitionState) ([]*models.BankTransaction, []*models.AccountingEntry, error) {
+	windowFrom, windowTo, err := dateWindow(job.FromDate, job.ToDate, state.Partition, state.Partitions)
+	if err != nil {
+		return nil, nil, err
+	}
+	config, err := s.reconciliationService.batchMatchConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	entriesFrom, entriesTo := entryDates(config, windowFrom, windowTo)
+	// The run reconciles the entries of its period, like an unpartitioned one
+	entriesFrom = max(entriesFrom, job.FromDate)
+	entriesTo = min(entriesTo, job.ToDate)
+
+	bankTransactions, err := s.bankRepo.GetUnreconciledTransactions(context.Background(), windowFrom, windowTo)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get partition bank transactions: %v", err)
+	}
+	accountingEntries, err := s.accountingRepo.GetUnreconciledEntries(context.Background(), entriesFrom, entriesTo)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get unreconciled accounting entries: %v", err)
+	}
+	state.WindowFrom, state.WindowTo = windowFrom, windowTo
+	state.EntriesFrom, state.EntriesTo = entriesFrom, entriesTo
+	return bankTransactions, accountingEntries, nil
+}
+
+// periodDays counts the days from fromDate to toDate, both included
+func periodDays(fromDate, toDate string) (int, error) {
+	from, err := time.Parse("2006-01-02", fromDate)
+	if err != nil {
+		return 0, fmt.Errorf("invalid from_date: %v", err)
+	}
+	to, err := time.Parse("2006-01-02", toDate)
+	if err != nil {
+		return 0, fmt.Errorf("invalid to_date: %v", err)
+	}
+	if to.Before(from) {
+		return 0, fmt.Errorf("to_date must not be before from_date")
+	}
+	return int(to.Sub(from).Hours()/24) + 1, nil
+}
+
+// dateWindow returns the dates of the partition-th of partitions windows the
+// period is split into, as even in days as they can be
+func dateWindow(fromDate, toDate string, partition, partitions int) (string, string, error) {
+	days, err := periodDays(fromDate, toDate)
+	if err != nil {
+		return "", "", err
+	}
+	from, _ := time.Parse("2006-01-02", fromDate)
+	start := from.AddDate(0, 0, partition*days/partitions)
+	end := from.AddDate(0, 0, (partition+1)*days/partitions-1)
+	return start.Format("2006-01-02"), end.Format("2006-01-02"), nil
+}
+
+// entryDates widens a window of bank transaction dates to the entry dates
+// that can match them: the date tolerance on either side, and the longest
+// counterparty lag before, since a lagged entry is compared that many days
+// later. A day more on each side covers how the calendar counts days that
+// are not business days.
+func entryDates(config matching.Config, windowFrom, windowTo string) (string, string) {
+	earliest, latest := 0, 0
+	for _, lag := range config.ExpectedLags {
+		earliest = max(earliest, lag)
+		latest = max(latest, -lag)
+	}
+	before := config.Rules.DateToleranceDays + earliest
+	after := config.Rules.DateToleranceDays + latest
+
+	from, _ := time.Parse("2006-01-02", windowFrom)
+	to, _ := time.Parse("2006-01-02", windowTo)
+	if config.Calendar != nil {
+		from = config.Calendar.AddBusinessDays(from, -before)
+		to = config.Calendar.AddBusinessDays(to, after)
+	} else {
+		from = from.AddDate(0, 0, -before)
+		to = to.AddDate(0, 0, after)
+	}
+	return from.AddDate(0, 0, -1).Format("2006-01-02"), to.AddDate(0, 0, 1).Format("2006-01-02")
+}
+
+// finalizeIfComplete merges the partition results once every partition has
+// finished. The compare-and-set on the parent job guarantees only one worker
+// records the batch-level unmatched entries.
+func (s *PartitionService) finalizeIfComplete(batchID string) error {
+	run, err := s.GetPartitionedRun(batchID)
+	if err != nil {
+		return err
+	}
+
+	merged := map[string]interface{}{}
+	var matched, unmatchedBank, bankCount int
+	failed := false
+	for _, p := range run.Partitions {
+		switch p.Status {
+		case models.JobStatusQueued, models.JobStatusRunning:
+			return nil
+		case models.JobStatusFailed:
+			failed = true
+		}
+		var state partitionState
+		if json.Unmarshal(p.Checkpoint, &state) == nil {
+			matched += state.Matched
+			unmatchedBank += state.UnmatchedBank
+			bankCount += state.BankCount
+		}
+	}
+
+	won, err := s.jobRepo.TransitionJobStatus(run.Run.ID, models.JobStatusRunning, models.JobStatusCompleted)
+	if err != nil || !won {
+		return err
+	}
+
+	parent := run.Run
+	now := time.Now()
+	parent.FinishedAt = &now
+	parent.Status = models.JobStatusCompleted
+
+	unmatchedAccounting := 0
+	if failed {
+		parent.Status = models.JobStatusFailed
+		parent.Error = "one or more partitions failed"
+	} else {
+		unmatchedAccounting, err = s.reconciliationService.recordRemainingUnmatched(batchID, parent.FromDate, parent.ToDate, parent.RequestedBy)
+		if err != nil {
+			parent.Status = models.JobStatusFailed
+			parent.Error = err.Error()
+		}
+	}
+
+	merged["partitions"] = len(run.Partitions)
+	merged["bank_transactions"] = bankCount
+	merged["matched"] = matched
+	merged["unmatched_bank"] = unmatchedBank
+	merged["unmatched_accounting"] = unmatchedAccounting
+	parent.Checkpoint, _ = json.Marshal(merged)
+
+	if err := s.jobRepo.UpdateJob(parent); err != nil {
+		return fmt.Errorf("failed to finalize partitioned run %s: %v", batchID, err)
+	}
+	if parent.Status == models.JobStatusCompleted {
+		recordJobBatchRun(s.usageService, parent)
+	}
+	log.Printf("Partitioned run %s finished with status %s", batchID, parent.Status)
+	return nil
+}
@@ -0,0 +1,231 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"reconciliation-service/internal/matching"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/money"
+	"reconciliation-service/internal/repositories"
+)
+
+// ErrInvalidPolicyPack wraps every rejection of a policy pack assignment
+var ErrInvalidPolicyPack = errors.New("invalid policy pack")
+
+// Policy packs shipped with the service
+const (
+	PolicyPackStrictAudit        = "strict-audit"
+	PolicyPackHighAutomation     = "high-automation"
+	PolicyPackGatewaySettlements = "gateway-settlements"
+)
+
+// policyPacks are the packs a tenant or an account can be put under
+var policyPacks = []*models.PolicyPack{
+	{
+		Name:                       PolicyPackStrictAudit,
+		Description:                "Exact amounts, near dates and a reviewer on every match short of certain; small write-offs only; seven years of audit trail",
+		MinConfidence:              matching.MediumMatchConfidence,
+		MinGroupConfidence:         matching.HighMatchConfidence,
+		AmountToleranceBasisPoints: 0,
+		DateToleranceDays:          1,
+		ReviewConfidence:           1,
+		WriteOffLimit:              100 * money.Scale,
+		RetentionDays: map[string]int{
+			models.RetentionClassAudit:   2555,
+			models.RetentionClassResults: 2555,
+			models.RetentionClassExports: 365,
+		},
+	},
+	{
+		Name:                       PolicyPackHighAutomation,
+		Description:                "The widest tolerances and no review, for high volumes of low-risk payments",
+		MinConfidence:              matching.LowMatchConfidence,
+		MinGroupConfidence:         matching.MediumMatchConfidence,
+		AmountToleranceBasisPoints: matching.AmountToleranceBasisPoints,
+		DateToleranceDays:          5,
+		ReviewConfidence:           0,
+		WriteOffLimit:              10000 * money.Scale,
+		RetentionDays: map[string]int{
+			models.RetentionClassAudit:   1095,
+			models.RetentionClassResults: 365,
+		},
+	},
+	{
+		Name:                       PolicyPackGatewaySettlements,
+		Description:                "Payment gateway payouts, settled days late and net of fees; weak matches go to review",
+		MinConfidence:              0.70,
+		MinGroupConfidence:         matching.MediumMatchConfidence,
+		AmountToleranceBasisPoints: 300,
+		DateToleranceDays:          3,
+		ReviewConfidence:           matching.MediumMatchConfidence,
+		WriteOffLimit:              1000 * money.Scale,
+		RetentionDays: map[string]int{
+			models.RetentionClassAudit:   1825,
+			models.RetentionClassResults: 730,
+		},
+	},
+}
+
+// policyPack returns the shipped pack of a name, or nil
+func policyPack(name string) *models.PolicyPack {
+	for _, pack := range policyPacks {
+		if pack.Name == name {
+			return pack
+		}
+	}
+	return nil
+}
+
+// PolicyPackService assigns policy packs to the tenant and its accounts. The
+// tenant's pack sets the matching thresholds of its batches; the pack of an
+// account, else the tenant's, decides which of its matches wait for review
+// and how much of its exceptions may be written off. Retention is kept
+// deployment-wide, so every pack assigned anywhere sets a floor under it.
+type PolicyPackService struct {
+	policyRepo repositories.PolicyPackRepository
+}
+
+func NewPolicyPackService(policyRepo repositories.PolicyPackRepository) *PolicyPackService {
+	return &PolicyPackService{policyRepo: policyRepo}
+}
+
+// ListPacks lists the packs that can be assigned
+func (s *PolicyPackService) ListPacks() []*models.PolicyPack {
+	return policyPacks
+}
+
+func (s *PolicyPackService) ListAssignments() ([]*models.PolicyPackAssignment, error) {
+	return s.policyRepo.ListAssignments()
+}
+
+// Assign puts an account, or the tenant when account is empty, under a
+// pack; an empty pack lifts the assignment. It returns the assignments after
+// the change.
+func (s *PolicyPackService) Assign(account, pack, userID string) ([]*models.PolicyPackAssignment, error) {
+	account = strings.TrimSpace(account)
+	pack = strings.ToLower(strings.TrimSpace(pack))
+	if len(account) > 50 {
+		return nil, fmt.Errorf("%w: account must be at most 50 characters", ErrInvalidPolicyPack)
+	}
+
+	var err error
+	if pack == "" {
+		err = s.policyRepo.DeleteAssignment(account)
+	} else if policyPack(pack) == nil {
+		return nil, fmt.Errorf("%w: unknown pack %q", ErrInvalidPolicyPack, pack)
+	} else {
+		err = s.policyRepo.SaveAssignment(&models.PolicyPackAssignment{Account: account, Pack: pack, AssignedBy: userID})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to save policy pack assignment: %v", err)
+	}
+	return s.policyRepo.ListAssignments()
+}
+
+// GetBatchPolicy returns the packs a batch ran under, or nil for a batch run
+// before they were recorded
+func (s *PolicyPackService) GetBatchPolicy(batchID string) (*models.BatchPolicy, error) {
+	return s.policyRepo.GetBatchPolicy(batchID)
+}
+
+// packPolicy is the tenant's pack and those of its accounts, as assigned
+// when a batch starts
+type packPolicy struct {
+	tenant   *models.PolicyPack
+	accounts map[string]*models.PolicyPack
+}
+
+// resolve reads the current assignments. An assignment naming a pack the
+// service no longer ships is skipped.
+func (s *PolicyPackService) resolve() (*packPolicy, error) {
+	assignments, err := s.policyRepo.ListAssignments()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get policy pack assignments: %v", err)
+	}
+	policy := &packPolicy{accounts: make(map[string]*models.PolicyPack)}
+	for _, assignment := range assignments {
+		pack := policyPack(assignment.Pack)
+		switch {
+		case pack == nil:
+			log.Printf("policy pack %q assigned to account %q is unknown, ignoring it", assignment.Pack, assignment.Account)
+		case assignment.Account == "":
+			policy.tenant = pack
+		default:
+			policy.accounts[assignment.Account] = pack
+		}
+	}
+	return policy, nil
+}
+
+// forAccount returns the pack of an account, else the tenant's, else nil
+func (p *packPolicy) forAccount(account string) *models.PolicyPack {
+	if p == nil {
+		return nil
+	}
+	if pack, ok := p.accounts[account]; ok {
+		return pack
+	}
+	return p.tenant
+}
+
+// applyRules sets the matching thresholds of the tenant's pack
+func (p *packPolicy) applyRules(rules *matching.Rules) {
+	if p == nil || p.tenant == nil {
+		return
+	}
+	rules.MinConfidence = p.tenant.MinConfidence
+	rules.MinGroupConfidence = p.tenant.MinGroupConfidence
+	rules.AmountToleranceBasisPoints = p.tenant.AmountToleranceBasisPoints
+	rules.DateToleranceDays = p.tenant.DateToleranceDays
+}
+
+// record is what a batch records of the policy
+func (p *packPolicy) record() *models.BatchPolicy {
+	record := &models.BatchPolicy{}
+	if p == nil {
+		return record
+	}
+	if p.tenant != nil {
+		record.PolicyPack = p.tenant.Name
+	}
+	if len(p.accounts) > 0 {
+		record.AccountPacks = make(map[string]string, len(p.accounts))
+		for account, pack := range p.accounts {
+			record.AccountPacks[account] = pack.Name
+		}
+	}
+	return record
+}
+
+// AccountPack returns the pack an account is under, its own or the
+// tenant's, or nil when neither has one
+func (s *PolicyPackService) AccountPack(account string) (*models.PolicyPack, error) {
+	policy, err := s.resolve()
+	if err != nil {
+		return nil, err
+	}
+	return policy.forAccount(account), nil
+}
+
+// RetentionFloors returns the least days each data class must be kept for
+// the packs assigned anywhere in the deployment
+func (s *PolicyPackService) RetentionFloors() (map[string]int, error) {
+	packs, err := s.policyRepo.ListAssignedPacks()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list assigned policy packs: %v", err)
+	}
+	floors := make(map[string]int)
+	for _, name := range packs {
+		pack := policyPack(name)
+		if pack == nil {
+			continue
+		}
+		for class, days := range pack.RetentionDays {
+			floors[class] = max(floors[class], days)
+		}
+	}
+	return floors, nil
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// QueueScheduler claims the queued reconciliations of every tenant on this
+// instance. While several tenants have jobs waiting, claims go to them by
+// smooth weighted round-robin, so a tenant queueing a long backfill gets its
+// share of the capacity instead of all of it; the per-tenant cap of each
+// QueueService bounds that share across instances.
+type QueueScheduler struct {
+	tenants []string
+	queues  map[string]*QueueService
+	// claims each tenant is owed, carried from one round to the next
+	credit map[string]int
+}
+
+func NewQueueScheduler(graphs map[string]*Services) *QueueScheduler {
+	scheduler := &QueueScheduler{
+		queues: make(map[string]*QueueService, len(graphs)),
+		credit: make(map[string]int, len(graphs)),
+	}
+	for tenant, svc := range graphs {
+		scheduler.tenants = append(scheduler.tenants, tenant)
+		scheduler.queues[tenant] = svc.Queue
+	}
+	sort.Strings(scheduler.tenants)
+	return scheduler
+}
+
+// RunWorker claims queued jobs whenever capacity allows, until ctx is
+// cancelled
+func (s *QueueScheduler) RunWorker(ctx context.Context, pollInterval time.Duration) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.claimRound(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// claimRound claims jobs until no tenant can claim another
+func (s *QueueScheduler) claimRound(ctx context.Context) {
+	waiting := make(map[string]bool, len(s.tenants))
+	for _, tenant := range s.tenants {
+		waiting[tenant] = true
+	}
+	for ctx.Err() == nil && len(waiting) > 0 {
+		tenant := s.next(waiting)
+		if !s.queues[tenant].claimNext() {
+			delete(waiting, tenant)
+		}
+	}
+}
+
+// next picks the waiting tenant owed the most claims: every waiting tenant
+// earns its weight, and the one picked pays back what they earned together
+func (s *QueueScheduler) next(waiting map[string]bool) string {
+	picked, total := "", 0
+	for _, tenant := range s.tenants {
+		if !waiting[tenant] {
+			continue
+		}
+		weight := s.queues[tenant].weight
+		s.credit[tenant] += weight
+		total += weight
+		if picked == "" || s.credit[tenant] > s.credit[picked] {
+			picked = tenant
+		}
+	}
+	s.credit[picked] -= total
+	return picked
+}
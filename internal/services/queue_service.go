@@ -0,0 +1,193 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+)
+
+var jobPriorities = map[string]int{
+	"urgent":  models.JobPriorityUrgent,
+	"high":    models.JobPriorityHigh,
+	"normal":  models.JobPriorityNormal,
+	"routine": models.JobPriorityRoutine,
+}
+
+// QueueService runs queued reconciliation jobs in priority order, with a cap on
+// how many run at once across all instances and on how many of those one
+// tenant runs. QueueScheduler decides which tenant claims next.
+type QueueService struct {
+	reconciliationService *ReconciliationService
+	jobService            *JobService
+	jobRepo               repositories.JobRepository
+	maintenanceService    *MaintenanceService
+	usageService          *UsageService
+	instanceID            string
+	maxConcurrent         int
+	maxTenantConcurrent   int
+	weight                int
+}
+
+func NewQueueService(
+	reconciliationService *ReconciliationService,
+	jobService *JobService,
+	jobRepo repositories.JobRepository,
+	maintenanceService *MaintenanceService,
+	usageService *UsageService,
+	instanceID string,
+	maxConcurrent int,
+	maxTenantConcurrent int,
+	weight int,
+) *QueueService {
+	return &QueueService{
+		reconciliationService: reconciliationService,
+		jobService:            jobService,
+		jobRepo:               jobRepo,
+		maintenanceService:    maintenanceService,
+		usageService:          usageService,
+		instanceID:            instanceID,
+		maxConcurrent:         maxConcurrent,
+		maxTenantConcurrent:   maxTenantConcurrent,
+		weight:                weight,
+	}
+}
+
+type QueueStatus struct {
+	MaxConcurrent int `json:"max_concurrent"`
+	// Jobs this tenant may run at once; 0 when only MaxConcurrent applies
+	TenantMaxConcurrent int `json:"tenant_max_concurrent"`
+	// This tenant's share of the claims while other tenants have jobs queued
+	Weight int                         `json:"weight"`
+	Queued []*models.ReconciliationJob `json:"queued"`
+}
+
+// ParseJobPriority maps a named priority to its numeric value; empty means normal
+func ParseJobPriority(name string) (int, error) {
+	if name == "" {
+		return models.JobPriorityNormal, nil
+	}
+	priority, ok := jobPriorities[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("priority must be one of urgent, high, normal, routine")
+	}
+	return priority, nil
+}
+
+// Enqueue queues a reconciliation job. Its batch is counted as a batch run of
+// usageEntity once it completes.
+func (s *QueueService) Enqueue(fromDate, toDate string, priority int, requestedBy, usageEntity string) (*models.ReconciliationJob, error) {
+	job := &models.ReconciliationJob{
+		JobType:     models.JobTypeReconciliation,
+		Status:      models.JobStatusQueued,
+		Priority:    priority,
+		FromDate:    fromDate,
+		ToDate:      toDate,
+		RequestedBy: requestedBy,
+		UsageEntity: usageEntity,
+	}
+	if err := s.jobRepo.CreateJob(job); err != nil {
+		return nil, fmt.Errorf("failed to queue reconciliation: %v", err)
+	}
+	return job, nil
+}
+
+func (s *QueueService) GetQueue() (*QueueStatus, error) {
+	queued, err := s.jobRepo.ListQueuedJobs(models.JobTypeReconciliation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list queue: %v", err)
+	}
+	return &QueueStatus{
+		MaxConcurrent:       s.maxConcurrent,
+		TenantMaxConcurrent: s.maxTenantConcurrent,
+		Weight:              s.weight,
+		Queued:              queued,
+	}, nil
+}
+
+func (s *QueueService) SetPriority(jobID int64, priority int) error {
+	return s.jobRepo.UpdateQueuedJobPriority(jobID, priority)
+}
+
+// Reorder moves the given queued jobs to the front of the queue, in the order given
+func (s *QueueService) Reorder(jobIDs []int64) error {
+	if len(jobIDs) == 0 {
+		return fmt.Errorf("job_ids is required")
+	}
+
+	top, err := s.jobRepo.MaxQueuedPriority(models.JobTypeReconciliation)
+	if err != nil {
+		return fmt.Errorf("failed to read queue priorities: %v", err)
+	}
+	for i, id := range jobIDs {
+		if err := s.jobRepo.UpdateQueuedJobPriority(id, top+len(jobIDs)-i); err != nil {
+			return fmt.Errorf("job %d: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// claimNext claims this tenant's next queued job and starts it, reporting
+// whether it did. Nothing is claimed during maintenance or shutdown, nor while
+// the queue or the tenant runs as many jobs as allowed.
+func (s *QueueService) claimNext() bool {
+	if s.jobService.Draining() || s.maintenanceService.Enabled() {
+		return false
+	}
+	job, err := s.jobRepo.ClaimQueuedJob(models.JobTypeReconciliation, s.instanceID, s.maxConcurrent, s.maxTenantConcurrent)
+	if err != nil {
+		log.Printf("queue worker: failed to claim job: %v", err)
+		return false
+	}
+	if job == nil {
+		return false
+	}
+	if err := s.lockAccounts(job); err != nil {
+		// The job stays at the head of the queue until the overlapping run ends
+		if !errors.Is(err, ErrOverlappingRun) {
+			log.Printf("queue worker: %v", err)
+		}
+		s.jobRepo.TransitionJobStatus(job.ID, models.JobStatusRunning, models.JobStatusQueued)
+		return false
+	}
+	if err := s.jobService.Adopt(job); err != nil {
+		s.jobRepo.TransitionJobStatus(job.ID, models.JobStatusRunning, models.JobStatusQueued)
+		return false
+	}
+	go s.run(job)
+	return true
+}
+
+func (s *QueueService) lockAccounts(job *models.ReconciliationJob) error {
+	accounts, err := s.reconciliationService.AccountScope(job.FromDate, job.ToDate)
+	if err != nil {
+		return err
+	}
+	return s.jobService.LockAccounts(job, accounts)
+}
+
+func (s *QueueService) run(job *models.ReconciliationJob) {
+	log.Printf("Running queued reconciliation job %d (%s..%s, priority %d)", job.ID, job.FromDate, job.ToDate, job.Priority)
+
+	result, err := s.reconciliationService.StartReconciliation(job.FromDate, job.ToDate, job.RequestedBy)
+	if err != nil {
+		s.jobService.Finish(job, "", err)
+		return
+	}
+	s.jobService.Finish(job, result.BatchID, nil)
+	recordJobBatchRun(s.usageService, job)
+}
+
+// recordJobBatchRun counts the batch of a job that completed for the usage
+// entity that queued it
+func recordJobBatchRun(usageService *UsageService, job *models.ReconciliationJob) {
+	if job.UsageEntity == "" {
+		return
+	}
+	if err := usageService.RecordBatchRun(job.UsageEntity); err != nil {
+		log.Printf("failed to record batch usage for %s: %v", job.UsageEntity, err)
+	}
+}
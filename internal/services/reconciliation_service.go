@@ -1,23 +1,50 @@
 package services
 
 import (
+	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"sync"
+	"log"
+	"regexp"
+	"sort"
 	"time"
 
+	"reconciliation-service/internal/config"
+	"reconciliation-service/internal/kpi"
 	"reconciliation-service/internal/matching"
 	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/pagination"
 	"reconciliation-service/internal/repositories"
 )
 
 type ReconciliationService struct {
 	db                 *sql.DB
-	matchEngine        *matching.MatchEngine
+	matchConfig        matching.Config
 	bankRepo           repositories.BankRepository
 	accountingRepo     repositories.AccountingRepository
 	reconciliationRepo repositories.ReconciliationRepository
+	counterpartyRepo   repositories.CounterpartyRepository
+	aliasRepo          repositories.AliasRepository
+	legalHoldRepo      repositories.LegalHoldRepository
+	expectationRepo    repositories.ExpectationRepository
+	calendars          *CalendarService
+	ruleSets           *RuleSetService
+	shadows            *ShadowService
+	fxRates            *FXRateService
+	fees               *FeeService
+	returns            *ReturnService
+	budgets            *BudgetService
+	policies           *PolicyPackService
+	kpis               *kpi.File
+	matchCalendar      string
+	inlineResultLimit  int
+	// Matches below this confidence are stored pending review
+	reviewConfidence float64
+	newBatchID       BatchIDGenerator
 }
 
 func NewReconciliationService(
@@ -25,13 +52,48 @@ func NewReconciliationService(
 	bankRepo repositories.BankRepository,
 	accountingRepo repositories.AccountingRepository,
 	reconciliationRepo repositories.ReconciliationRepository,
+	counterpartyRepo repositories.CounterpartyRepository,
+	aliasRepo repositories.AliasRepository,
+	legalHoldRepo repositories.LegalHoldRepository,
+	expectationRepo repositories.ExpectationRepository,
+	matchConfig matching.Config,
+	calendars *CalendarService,
+	ruleSets *RuleSetService,
+	shadows *ShadowService,
+	fxRates *FXRateService,
+	fees *FeeService,
+	returns *ReturnService,
+	budgets *BudgetService,
+	policies *PolicyPackService,
+	kpis *kpi.File,
+	matchCalendar string,
+	inlineResultLimit int,
+	reviewConfidence float64,
+	batchIDs BatchIDGenerator,
 ) *ReconciliationService {
 	return &ReconciliationService{
 		db:                 db,
-		matchEngine:        matching.NewMatchEngine(),
+		matchConfig:        matchConfig,
 		bankRepo:           bankRepo,
 		accountingRepo:     accountingRepo,
 		reconciliationRepo: reconciliationRepo,
+		counterpartyRepo:   counterpartyRepo,
+		aliasRepo:          aliasRepo,
+		legalHoldRepo:      legalHoldRepo,
+		expectationRepo:    expectationRepo,
+		calendars:          calendars,
+		ruleSets:           ruleSets,
+		shadows:            shadows,
+		fxRates:            fxRates,
+		fees:               fees,
+		returns:            returns,
+		budgets:            budgets,
+		policies:           policies,
+		kpis:               kpis,
+		matchCalendar:      matchCalendar,
+		inlineResultLimit:  inlineResultLimit,
+		reviewConfidence:   reviewConfidence,
+		newBatchID:         batchIDs,
 	}
 }
 
@@ -41,196 +103,521 @@ type ReconciliationResult struct {
 	Matches   []*matching.MatchesResult `json:"matches"`
 	Unmatched []*matching.UnmatchResult `json:"unmatched,omitempty"`
 	Summary   map[string]interface{}    `json:"summary"`
+	Version   int                       `json:"version,omitempty"`
+
+	// Set when Matches or Unmatched were cut to the inline limit; the full
+	// lists are served by the paginated results endpoint
+	Truncated      bool              `json:"truncated,omitempty"`
+	TotalMatches   int               `json:"total_matches,omitempty"`
+	TotalUnmatched int               `json:"total_unmatched,omitempty"`
+	Links          map[string]string `json:"links,omitempty"`
+
+	// Set on a preview: nothing the result lists was recorded
+	DryRun bool `json:"dry_run,omitempty"`
+
+	// The caller's own reference the batch was started with; it looks the
+	// batch up as well as its ID does
+	ExternalReference string `json:"external_reference,omitempty"`
+
+	// The policy packs the batch ran under
+	Policy *models.BatchPolicy `json:"policy,omitempty"`
+
+	// What the batch measured, for the KPIs evaluated over it
+	metrics map[string]float64
 }
 
-func (s *ReconciliationService) GetBankTransactions(fromDate, toDate string) ([]*models.BankTransaction, error) {
-	return s.bankRepo.GetUnreconciledTransactions(fromDate, toDate)
+// ResultPage is one page of a batch's persisted result items. Page is left
+// out for a page read through a cursor; NextCursor is the cursor of the
+// page after it, empty on the last page.
+type ResultPage struct {
+	BatchID    string            `json:"reconciliation_id"`
+	Kind       string            `json:"kind"`
+	Page       int               `json:"page,omitempty"`
+	PageSize   int               `json:"page_size"`
+	Total      int               `json:"total"`
+	Items      []json.RawMessage `json:"items"`
+	NextCursor string            `json:"next_cursor,omitempty"`
 }
 
-func (s *ReconciliationService) GetAccountingEntries(fromDate, toDate string) ([]*models.AccountingEntry, error) {
-	return s.accountingRepo.GetUnreconciledEntries(fromDate, toDate)
+// ErrInvalidResultQuery rejects a results page request
+var ErrInvalidResultQuery = errors.New("invalid results query")
+
+// ErrInvalidReference rejects an external reference that is empty, too long
+// or has characters other than letters, digits, '.', '_', ':' and '-'
+var ErrInvalidReference = errors.New("external_reference must be 1-100 letters, digits or . _ : -")
+
+var externalReferencePattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,100}$`)
+
+const (
+	DefaultResultPageSize = 100
+	MaxResultPageSize     = 1000
+)
+
+func (s *ReconciliationService) GetBankTransactions(ctx context.Context, fromDate, toDate string) ([]*models.BankTransaction, error) {
+	return s.bankRepo.GetUnreconciledTransactions(ctx, fromDate, toDate)
 }
 
-func (s *ReconciliationService) StartReconciliation(fromDate, toDate string) (*ReconciliationResult, error) {
-	bankTransactions, err := s.bankRepo.GetUnreconciledTransactions(fromDate, toDate)
+func (s *ReconciliationService) GetAccountingEntries(ctx context.Context, fromDate, toDate string) ([]*models.AccountingEntry, error) {
+	return s.accountingRepo.GetUnreconciledEntries(ctx, fromDate, toDate)
+}
+
+// AccountScope lists the bank accounts a reconciliation of the period touches,
+// used to lock out overlapping runs
+func (s *ReconciliationService) AccountScope(fromDate, toDate string) ([]string, error) {
+	accounts, err := s.bankRepo.GetAccountNumbers(fromDate, toDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get accounts for the period: %v", err)
+	}
+	return accounts, nil
+}
+
+// StartReconciliation reconciles the period's unreconciled records, with the
+// batch's audits attributed to userID
+func (s *ReconciliationService) StartReconciliation(fromDate, toDate, userID string) (*ReconciliationResult, error) {
+	bankTransactions, err := s.bankRepo.GetUnreconciledTransactions(context.Background(), fromDate, toDate)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get unreconciled bank transactions: %v", err)
 	}
 
-	accountingEntries, err := s.accountingRepo.GetUnreconciledEntries(fromDate, toDate)
+	accountingEntries, err := s.accountingRepo.GetUnreconciledEntries(context.Background(), fromDate, toDate)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get unreconciled accounting entries: %v", err)
 	}
 
-	return s.ProcessReconciliationWithData(fromDate, toDate, bankTransactions, accountingEntries)
+	return s.ProcessReconciliationWithData(fromDate, toDate, bankTransactions, accountingEntries, userID, "", "")
 }
 
-func (s *ReconciliationService) ProcessReconciliationWithData(fromDate, toDate string, bankTransactions []*models.BankTransaction, accountingEntries []*models.AccountingEntry) (*ReconciliationResult, error) {
-	tx, err := s.db.Begin()
+// batchOptions tunes processBatch for the callers that persist only part of a
+// batch, such as a single partition of a partitioned run
+type batchOptions struct {
+	// Record accounting entries left without a match as unmatched reconciliations
+	recordUnmatchedAccounting bool
+	// Lock matched accounting entries and drop matches whose entries were
+	// already mapped by a concurrent run
+	skipContended bool
+	// The user the batch's audit entries are attributed to
+	userID string
+	// Roll the batch's writes back instead of committing them
+	dryRun bool
+	// The caller's reference recorded with the batch, if any
+	externalReference string
+}
+
+// BatchIDGenerator returns the ID of a new batch. An ID must be unique and at
+// most 50 characters long.
+type BatchIDGenerator func() string
+
+// NewBatchIDGenerator returns the generator of a BATCH_ID_FORMAT
+func NewBatchIDGenerator(format string) BatchIDGenerator {
+	if format == config.BatchIDFormatUUID {
+		return uuidBatchID
+	}
+	return timestampBatchID
+}
+
+// timestampBatchID returns a timestamped batch ID. The random suffix keeps IDs
+// unique when several queued or partitioned runs start within the same second.
+func timestampBatchID() string {
+	suffix := make([]byte, 2)
+	rand.Read(suffix)
+	return fmt.Sprintf("REC-%s-%s", time.Now().Format("20060102-150405"), hex.EncodeToString(suffix))
+}
+
+// uuidBatchID returns a random (version 4) UUID as the batch ID
+func uuidBatchID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// CheckExternalReference validates a reference a batch is to be started with,
+// returning repositories.ErrDuplicateReference when it already names a batch
+// or is the ID of one. Recording it with the batch checks again.
+func (s *ReconciliationService) CheckExternalReference(reference string) error {
+	if !externalReferencePattern.MatchString(reference) {
+		return ErrInvalidReference
+	}
+	taken, err := s.reconciliationRepo.ReferenceTaken(reference)
 	if err != nil {
-		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+		return fmt.Errorf("failed to check external reference: %v", err)
 	}
-	defer tx.Rollback()
+	if taken {
+		return repositories.ErrDuplicateReference
+	}
+	return nil
+}
+
+// ResolveBatchID returns the batch an external reference names, or id itself
+// when no batch has it as its reference
+func (s *ReconciliationService) ResolveBatchID(id string) (string, error) {
+	if !externalReferencePattern.MatchString(id) {
+		return id, nil
+	}
+	batchID, err := s.reconciliationRepo.GetBatchIDByReference(id)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve batch reference: %v", err)
+	}
+	if batchID == "" {
+		return id, nil
+	}
+	return batchID, nil
+}
+
+// ProcessReconciliationWithData reconciles the given records as a new batch,
+// recorded with externalReference unless it is empty. The KPIs in its summary
+// are the defaults and those of tenant.
+func (s *ReconciliationService) ProcessReconciliationWithData(fromDate, toDate string, bankTransactions []*models.BankTransaction, accountingEntries []*models.AccountingEntry, userID, tenant, externalReference string) (*ReconciliationResult, error) {
+	result, err := s.processBatch(s.newBatchID(), bankTransactions, accountingEntries, batchOptions{
+		recordUnmatchedAccounting: true,
+		userID:                    userID,
+		externalReference:         externalReference,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.flagFeeExceptions(result, fromDate, toDate)
+	s.reportBudgetVariance(result, fromDate, toDate)
+	s.recordKPIs(result, tenant)
+	return result, nil
+}
 
-	batchID := fmt.Sprintf("REC-%s", time.Now().Format("20060102-150405"))
+// PreviewReconciliationWithData reconciles the given records as
+// ProcessReconciliationWithData would, returning the full result lists and
+// summary, but keeps none of the batch's reconciliations, mappings or audits
+func (s *ReconciliationService) PreviewReconciliationWithData(fromDate, toDate string, bankTransactions []*models.BankTransaction, accountingEntries []*models.AccountingEntry, userID, tenant, externalReference string) (*ReconciliationResult, error) {
+	result, err := s.processBatch(s.newBatchID(), bankTransactions, accountingEntries, batchOptions{
+		recordUnmatchedAccounting: true,
+		userID:                    userID,
+		dryRun:                    true,
+		externalReference:         externalReference,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.flagFeeExceptions(result, fromDate, toDate)
+	s.reportBudgetVariance(result, fromDate, toDate)
+	s.recordKPIs(result, tenant)
+	return result, nil
+}
 
-	s.matchEngine.SetData(bankTransactions, accountingEntries)
+// flagFeeExceptions adds to a batch's summary the scheduled fees of the
+// months the batch's range closes that are missing or differ from the
+// contract. The batch stands without them.
+func (s *ReconciliationService) flagFeeExceptions(result *ReconciliationResult, fromDate, toDate string) {
+	if s.fees == nil {
+		return
+	}
+	exceptions, err := s.fees.Exceptions(fromDate, toDate)
+	if err != nil {
+		log.Printf("failed to check fee expectations for batch %s: %v", result.BatchID, err)
+		return
+	}
+	if len(exceptions) > 0 {
+		result.Summary["fee_exceptions"] = exceptions
+	}
+}
 
-	matchChan := make(chan []*matching.MatchResult, 1)
-	matchErrChan := make(chan error, 1)
+// reportBudgetVariance adds to a batch's summary how the cash that moved in
+// the months the batch's range closes compares with their budgets. The batch
+// stands without it.
+func (s *ReconciliationService) reportBudgetVariance(result *ReconciliationResult, fromDate, toDate string) {
+	if s.budgets == nil {
+		return
+	}
+	variances, err := s.budgets.ClosedPeriodVariances(fromDate, toDate)
+	if err != nil {
+		log.Printf("failed to compute budget variances for batch %s: %v", result.BatchID, err)
+		return
+	}
+	if len(variances) > 0 {
+		result.Summary["budget_variance"] = variances
+	}
+}
 
-	go func() {
-		matches, err := s.matchEngine.ProcessMatches()
+// batchMatchConfig loads the active rules, the configured business calendar,
+// the counterparty lags, the alias dictionary and the exchange rates for each
+// batch so changes apply without a restart. A missing calendar falls back to
+// calendar days, missing lags and aliases to none, missing rates to keeping
+// currencies apart; rules that cannot be loaded fail the batch rather than
+// match it under rules nobody approved.
+func (s *ReconciliationService) batchMatchConfig() (matching.Config, error) {
+	config := s.matchConfig
+	if s.ruleSets != nil {
+		rules, err := s.ruleSets.ActiveRules()
 		if err != nil {
-			matchErrChan <- fmt.Errorf("failed to process matches: %v", err)
-			return
+			return config, err
 		}
-		matchChan <- matches
-	}()
+		config.Rules = rules
+	} else if config.Rules.Version == "" {
+		config.Rules = matching.DefaultRules()
+	}
+	lags, err := s.counterpartyRepo.GetExpectedLags()
+	if err != nil {
+		log.Printf("counterparty lags unavailable, matching without them: %v", err)
+	} else {
+		config.ExpectedLags = lags
+	}
+	if aliases, err := loadAliasDictionary(s.aliasRepo); err != nil {
+		log.Printf("alias dictionary unavailable, matching without it: %v", err)
+	} else {
+		config.Aliases = aliases
+	}
+	if s.fxRates != nil {
+		if rates, err := s.fxRates.RateTable(); err != nil {
+			log.Printf("exchange rates unavailable, matching each currency apart: %v", err)
+		} else {
+			config.FXRates = rates
+		}
+	}
+	if s.matchCalendar == "" || s.calendars == nil {
+		return config, nil
+	}
+	cal, err := s.calendars.Calendar(s.matchCalendar)
+	if err != nil {
+		log.Printf("matching calendar %s unavailable, using calendar days: %v", s.matchCalendar, err)
+		return config, nil
+	}
+	config.Calendar = cal
+	return config, nil
+}
 
-	var matches []*matching.MatchResult
-	select {
-	case err := <-matchErrChan:
+func (s *ReconciliationService) processBatch(batchID string, bankTransactions []*models.BankTransaction, accountingEntries []*models.AccountingEntry, opts batchOptions) (*ReconciliationResult, error) {
+	config, err := s.batchMatchConfig()
+	if err != nil {
 		return nil, err
-	case matches = <-matchChan:
 	}
+	var policy *packPolicy
+	if s.policies != nil {
+		if policy, err = s.policies.resolve(); err != nil {
+			return nil, err
+		}
+	}
+	policy.applyRules(&config.Rules)
+	record := policy.record()
 
-	type processResult struct {
-		bankIDs       map[int64]bool
-		accountingIDs map[int64]bool
-		err           error
+	// Returns are linked to the transactions they give back; neither side
+	// of a linked pair is matched with the ledger
+	var returns []*returnMatch
+	matchable := bankTransactions
+	if s.returns != nil {
+		returns, matchable = s.returns.link(bankTransactions)
 	}
-	processChan := make(chan processResult, len(matches))
 
-	var wg sync.WaitGroup
-	for _, match := range matches {
-		wg.Add(1)
-		go func(m *matching.MatchResult) {
-			defer wg.Done()
+	// Registered expectations are settled next; a transaction that fulfils
+	// one still goes on to be matched with the ledger
+	var expected []*expectationMatch
+	if s.expectationRepo != nil {
+		if matcher, err := loadExpectationMatcher(s.expectationRepo, matchable); err != nil {
+			log.Printf("expectations unavailable, matching none: %v", err)
+		} else {
+			expected = matcher.match(matchable)
+		}
+	}
 
-			result := processResult{
-				bankIDs:       make(map[int64]bool),
-				accountingIDs: make(map[int64]bool),
-			}
+	matchEngine := matching.NewMatchEngine(config)
+	matchEngine.SetData(matchable, accountingEntries)
 
-			reconciliation := &models.Reconciliation{
-				BatchID:          batchID,
-				Status:           "matched",
-				MatchConfidence:  m.Confidence,
-				AmountDifference: m.AmountDifference,
-			}
+	matches, err := matchEngine.ProcessMatches()
+	if err != nil {
+		return nil, fmt.Errorf("failed to process matches: %v", err)
+	}
+	sortMatches(matches)
+	reversals := matchEngine.Reversals()
 
-			err := s.reconciliationRepo.CreateReconciliation(tx, reconciliation)
-			if err != nil {
-				result.err = fmt.Errorf("failed to create reconciliation batch: %v", err)
-				processChan <- result
-				return
-			}
+	var classifier *feeClassifier
+	if s.fees != nil {
+		if classifier, err = s.fees.classifier(); err != nil {
+			log.Printf("fee schedules unavailable, classifying no fees: %v", err)
+		}
+	}
 
-			mapping := &models.ReconciliationMapping{
-				ReconciliationID: reconciliation.ID,
-				BankTransactionID: sql.NullInt64{
-					Int64: m.BankTransaction.ID,
-					Valid: true,
-				},
-				MappingType: m.Type,
+	// Everything the write pass decides is reassigned on each attempt, so a
+	// deadlock retry starts from the engine's matches again
+	var kept []*matching.MatchResult
+	var unmatchedBank []*models.BankTransaction
+	var fees []*feeMatch
+	var fulfilled []*expectationMatch
+	var returnViews, reversalViews []*matching.MatchesResult
+	var disputed int
+	var m []*matching.MatchesResult
+	var um []*matching.UnmatchResult
+	var accounts []*models.AccountOutcome
+	write := func(fn func(tx *sql.Tx) error) error {
+		return s.withDeadlockRetry(batchID, fn)
+	}
+	if opts.dryRun {
+		write = s.withRollback
+	}
+	err = write(func(tx *sql.Tx) error {
+		var err error
+		if opts.externalReference != "" {
+			if err := s.reconciliationRepo.SaveBatchReference(tx, batchID, opts.externalReference); err != nil {
+				return err
 			}
-
-			if m.Type == models.MappingOneToOne {
-				mapping.AccountingEntryID = sql.NullInt64{
-					Int64: m.AccountingEntries[0].ID,
-					Valid: true,
-				}
-				err = s.reconciliationRepo.CreateMapping(tx, mapping)
-				if err != nil {
-					result.err = fmt.Errorf("failed to create mapping: %v", err)
-					processChan <- result
-					return
-				}
-
-				result.bankIDs[m.BankTransaction.ID] = true
-				result.accountingIDs[m.AccountingEntries[0].ID] = true
-			} else {
-				for _, ae := range m.AccountingEntries {
-					mapping.AccountingEntryID = sql.NullInt64{
-						Int64: ae.ID,
-						Valid: true,
-					}
-					err = s.reconciliationRepo.CreateMapping(tx, mapping)
-					if err != nil {
-						result.err = fmt.Errorf("failed to create mapping: %v", err)
-						processChan <- result
-						return
-					}
-					result.accountingIDs[ae.ID] = true
-				}
-				result.bankIDs[m.BankTransaction.ID] = true
+		}
+		if s.policies != nil {
+			if err := s.policies.policyRepo.SaveBatchPolicy(tx, batchID, record); err != nil {
+				return fmt.Errorf("failed to record policy packs: %v", err)
 			}
+		}
+		if fulfilled, err = fulfilExpectations(tx, s.expectationRepo, batchID, expected); err != nil {
+			return err
+		}
+		if returnViews, disputed, err = s.persistReturns(tx, batchID, returns, opts.userID); err != nil {
+			return err
+		}
+		if reversalViews, err = s.persistReversals(tx, batchID, reversals, opts.userID); err != nil {
+			return err
+		}
 
-			auditDetails, _ := json.Marshal(map[string]interface{}{
-				"match_type":     m.Type,
-				"confidence":     m.Confidence,
-				"match_criteria": m.MatchCriteria,
-			})
+		kept = matches
+		if opts.skipContended {
+			if kept, err = s.dropContendedMatches(tx, matches); err != nil {
+				return err
+			}
+		}
+		if err := s.persistMatches(tx, batchID, kept, policy, opts.userID); err != nil {
+			return err
+		}
 
-			audit := &models.ReconciliationAudit{
-				ReconciliationID: reconciliation.ID,
-				Action:           models.AuditActionMatched,
-				Details:          auditDetails,
+		processedBankIDs := make(map[int64]bool)
+		processedAccountingIDs := make(map[int64]bool)
+		for _, m := range kept {
+			for _, bt := range m.AllBankTransactions() {
+				processedBankIDs[bt.ID] = true
 			}
-			err = s.reconciliationRepo.CreateAuditEntry(tx, audit)
-			if err != nil {
-				result.err = fmt.Errorf("failed to create audit entry: %v", err)
-				processChan <- result
-				return
+			for _, ae := range m.AccountingEntries {
+				processedAccountingIDs[ae.ID] = true
+			}
+		}
+		reversedBankIDs := make(map[int64]bool)
+		for _, reversal := range reversals {
+			for _, bt := range reversal.BankTransactions {
+				reversedBankIDs[bt.ID] = true
+			}
+			for _, ae := range reversal.AccountingEntries {
+				processedAccountingIDs[ae.ID] = true
 			}
-
-			processChan <- result
-		}(match)
-	}
-
-	go func() {
-		wg.Wait()
-		close(processChan)
-	}()
-
-	processedBankIDs := make(map[int64]bool)
-	processedAccountingIDs := make(map[int64]bool)
-
-	for result := range processChan {
-		if result.err != nil {
-			return nil, result.err
 		}
-		for id := range result.bankIDs {
-			processedBankIDs[id] = true
+
+		// Debits a fee schedule describes are classified as fees when
+		// nothing in the ledger matched them, and recorded as charges of
+		// their schedule either way. Reversed debits cancel out and are
+		// neither.
+		unmatchedBank, fees = nil, nil
+		var matchedFees []*feeMatch
+		for _, bt := range matchable {
+			if reversedBankIDs[bt.ID] {
+				continue
+			}
+			schedule := classifier.classify(bt)
+			switch {
+			case schedule != nil && processedBankIDs[bt.ID]:
+				matchedFees = append(matchedFees, &feeMatch{schedule: schedule, bankTransaction: bt})
+			case schedule != nil:
+				fees = append(fees, &feeMatch{schedule: schedule, bankTransaction: bt})
+			case !processedBankIDs[bt.ID]:
+				unmatchedBank = append(unmatchedBank, bt)
+			}
 		}
-		for id := range result.accountingIDs {
-			processedAccountingIDs[id] = true
+		if err := s.persistFees(tx, batchID, fees, matchedFees, opts.userID); err != nil {
+			return err
 		}
-	}
 
-	var unmatchedBank []*models.BankTransaction
-	var unmatchedAccounting []*models.AccountingEntry
+		um = nil
+		var unmatchedAccounting []*models.AccountingEntry
+		if opts.recordUnmatchedAccounting {
+			for _, ae := range accountingEntries {
+				if !processedAccountingIDs[ae.ID] {
+					unmatchedAccounting = append(unmatchedAccounting, ae)
+				}
+			}
+			var err error
+			if um, err = s.recordUnmatchedAccounting(tx, batchID, unmatchedAccounting, bankTransactions, opts.userID); err != nil {
+				return err
+			}
+		}
 
-	for _, bt := range bankTransactions {
-		if !processedBankIDs[bt.ID] {
-			unmatchedBank = append(unmatchedBank, bt)
+		accounts = accountOutcomes(config, kept, unmatchedBank, unmatchedAccounting)
+		if err := s.reconciliationRepo.SaveAccountOutcomes(tx, batchID, accounts); err != nil {
+			return fmt.Errorf("failed to store account outcomes: %v", err)
 		}
+
+		m = append(matchViews(kept), feeViews(fees)...)
+		m = append(m, returnViews...)
+		m = append(m, reversalViews...)
+		return s.persistResultItems(tx, batchID, m, um)
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	for _, ae := range accountingEntries {
-		if !processedAccountingIDs[ae.ID] {
-			unmatchedAccounting = append(unmatchedAccounting, ae)
+	// The batch stands on its own; what the counterparties learn from it is
+	// a bonus for later runs
+	if len(kept) > 0 && !opts.dryRun {
+		if err := s.counterpartyRepo.EnrichFromBatch(batchID); err != nil {
+			log.Printf("failed to enrich counterparties from batch %s: %v", batchID, err)
 		}
 	}
+	// Candidate rule sets see the same inputs and are judged against the
+	// matches the batch kept
+	if s.shadows != nil && !opts.dryRun {
+		s.shadows.Evaluate(batchID, config, matchable, accountingEntries, kept)
+	}
 
 	summary := map[string]interface{}{
-		"total_processed": len(bankTransactions) + len(accountingEntries),
-		"matched":         len(matches),
-		"unmatched":       len(unmatchedBank),
-		"disputed":        0,
+		"total_processed":   len(bankTransactions) + len(accountingEntries),
+		"matched":           len(kept),
+		"partially_matched": countPartial(kept),
+		"fees":              len(fees),
+		"expected_paid":     len(fulfilled),
+		"returns":           len(returns),
+		"reversals":         len(reversals),
+		"unmatched":         len(unmatchedBank),
+		"disputed":          disputed,
+		"pending_review":    s.countPendingReview(policy, kept),
+		"rules_version":     config.Rules.Version,
+		"policy_pack":       record.PolicyPack,
+		"accounts":          accounts,
+	}
+	if len(record.AccountPacks) > 0 {
+		summary["account_policy_packs"] = record.AccountPacks
+	}
+
+	var status string
+	if len(um) > 0 {
+		status = "completed"
+	} else {
+		status = "matches"
 	}
 
+	return &ReconciliationResult{
+		BatchID:           batchID,
+		ExternalReference: opts.externalReference,
+		Status:            status,
+		Matches:           m,
+		Unmatched:         um,
+		Summary:           summary,
+		DryRun:            opts.dryRun,
+		metrics:           measureBatch(config, bankTransactions, accountingEntries, kept, unmatchedBank, fees, len(returns), len(fulfilled), disputed),
+	}, nil
+}
+
+// countPartial counts the matches that settled part of a record
+func countPartial(matches []*matching.MatchResult) int {
+	n := 0
+	for _, m := range matches {
+		if m.Type == models.MappingPartial {
+			n++
+		}
+	}
+	return n
+}
+
+// matchViews renders matches the way batch results report them
+func matchViews(matches []*matching.MatchResult) []*matching.MatchesResult {
 	var m []*matching.MatchesResult
 	for _, match := range matches {
 		var entryIDs []string
@@ -238,115 +625,193 @@ func (s *ReconciliationService) ProcessReconciliationWithData(fromDate, toDate s
 			entryIDs = append(entryIDs, ae.EntryID)
 		}
 
+		bankTransaction := match.BankTransaction.TransactionID
+		if match.Type == models.MappingManyToOne {
+			var transactionIDs []string
+			for _, bt := range match.BankTransactions {
+				transactionIDs = append(transactionIDs, bt.TransactionID)
+			}
+			bankTransaction = fmt.Sprintf("%v", transactionIDs)
+		}
+
 		data := matching.MatchesResult{
 			Type:             match.Type,
 			Confidence:       match.Confidence,
-			BankTransaction:  match.BankTransaction.TransactionID,
+			BankTransaction:  bankTransaction,
 			AccountingEntry:  fmt.Sprintf("%v", entryIDs),
 			AmountDifference: match.AmountDifference,
 			MatchCriteria:    match.MatchCriteria,
+			Netting:          match.Netting,
+			SettledAmount:    match.SettledAmount,
 		}
 		m = append(m, &data)
 	}
+	return m
+}
 
-	var um []*matching.UnmatchResult
-	for _, unmatch := range unmatchedAccounting {
-		var entryIDs []string
-		var trID string
-		entryIDs = append(entryIDs, unmatch.EntryID)
-
-		invoiceMap := make(map[string]struct{})
-		invoiceMap[unmatch.InvoiceNumber] = struct{}{}
-
-		for _, transaction := range bankTransactions {
-			if _, exists := invoiceMap[transaction.ReferenceNumber]; exists {
-				trID = transaction.TransactionID
-			}
-		}
-
-		data := matching.UnmatchResult{
-			BankTransactions:  trID,
-			AccountingEntries: entryIDs,
-		}
-
-		reconciliation := &models.Reconciliation{
-			BatchID:          batchID,
-			Status:           "unmatched",
-			MatchConfidence:  0,
-			AmountDifference: 0,
-		}
-		err = s.reconciliationRepo.CreateReconciliation(tx, reconciliation)
+// persistResultItems stores the full result lists of a batch, however much of
+// them a response returns inline
+func (s *ReconciliationService) persistResultItems(tx *sql.Tx, batchID string, matches []*matching.MatchesResult, unmatched []*matching.UnmatchResult) error {
+	payloads := make([][]byte, 0, len(matches))
+	for _, match := range matches {
+		payload, err := json.Marshal(match)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create reconciliation batch: %v", err)
+			return err
 		}
+		payloads = append(payloads, payload)
+	}
+	if err := s.reconciliationRepo.CreateResultItems(tx, batchID, models.ResultKindMatch, payloads); err != nil {
+		return fmt.Errorf("failed to store match results: %w", err)
+	}
 
-		auditDetails, _ := json.Marshal(map[string]interface{}{
-			"bank_transactions":  trID,
-			"accounting_entries": entryIDs,
-		})
-
-		audit := &models.ReconciliationAudit{
-			ReconciliationID: reconciliation.ID,
-			Action:           models.AuditActionUnmatched,
-			Details:          auditDetails,
-		}
-		err = s.reconciliationRepo.CreateAuditEntry(tx, audit)
+	payloads = make([][]byte, 0, len(unmatched))
+	for _, item := range unmatched {
+		payload, err := json.Marshal(item)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create audit entry: %v", err)
+			return err
 		}
+		payloads = append(payloads, payload)
+	}
+	if err := s.reconciliationRepo.CreateResultItems(tx, batchID, models.ResultKindUnmatched, payloads); err != nil {
+		return fmt.Errorf("failed to store unmatched results: %w", err)
+	}
+	return nil
+}
 
-		um = append(um, &data)
+// CapInline cuts the result lists to the configured inline limit and reports
+// whether anything was left out. A limit of 0 returns everything inline.
+func (s *ReconciliationService) CapInline(result *ReconciliationResult) bool {
+	limit := s.inlineResultLimit
+	if limit <= 0 || (len(result.Matches) <= limit && len(result.Unmatched) <= limit) {
+		return false
 	}
 
-	// Commit transaction
-	err = tx.Commit()
-	if err != nil {
-		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	result.Truncated = true
+	result.TotalMatches = len(result.Matches)
+	result.TotalUnmatched = len(result.Unmatched)
+	if len(result.Matches) > limit {
+		result.Matches = result.Matches[:limit]
 	}
+	if len(result.Unmatched) > limit {
+		result.Unmatched = result.Unmatched[:limit]
+	}
+	return true
+}
 
-	var status string
-	if len(um) > 0 {
-		status = "completed"
-	} else {
-		status = "matches"
+// GetResults returns a page of a batch's persisted matches or unmatched
+// items, by page number or from the cursor a previous page returned. A page
+// number of zero is the first page.
+func (s *ReconciliationService) GetResults(batchID, kind string, page, pageSize int, cursor string) (*ResultPage, error) {
+	if kind != models.ResultKindMatch && kind != models.ResultKindUnmatched {
+		return nil, fmt.Errorf("%w: kind must be %s or %s", ErrInvalidResultQuery, models.ResultKindMatch, models.ResultKindUnmatched)
+	}
+	if page < 0 {
+		return nil, fmt.Errorf("%w: page must be at least 1", ErrInvalidResultQuery)
+	}
+	if page > 0 && cursor != "" {
+		return nil, fmt.Errorf("%w: page and cursor cannot be combined", ErrInvalidResultQuery)
+	}
+	if page == 0 && cursor == "" {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > MaxResultPageSize {
+		return nil, fmt.Errorf("%w: page_size must be between 1 and %d", ErrInvalidResultQuery, MaxResultPageSize)
+	}
+	list := "results_" + kind
+	after, err := pagination.Decode(cursor, list)
+	if err != nil {
+		return nil, err
 	}
 
-	return &ReconciliationResult{
-		BatchID:   batchID,
-		Status:    status,
-		Matches:   m,
-		Unmatched: um,
-		Summary:   summary,
+	offset := 0
+	if page > 0 {
+		offset = (page - 1) * pageSize
+	}
+	_, afterID := after.Key()
+	rows, total, err := s.reconciliationRepo.GetResultItems(batchID, kind, afterID, offset, pageSize+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get results: %v", err)
+	}
+	rows, next := pagination.Next(rows, pageSize, func(item *models.ResultItem) pagination.Cursor {
+		return pagination.Cursor{List: list, ID: item.ID}
+	})
+	items := make([]json.RawMessage, len(rows))
+	for i, row := range rows {
+		items[i] = row.Payload
+	}
+	return &ResultPage{
+		BatchID:    batchID,
+		Kind:       kind,
+		Page:       page,
+		PageSize:   pageSize,
+		Total:      total,
+		Items:      items,
+		NextCursor: next,
 	}, nil
 }
 
-func (s *ReconciliationService) GetReconciliationStatus(batchID string) (*ReconciliationResult, error) {
-	reconciliation, err := s.reconciliationRepo.GetReconciliationByBatchID(batchID)
+func (s *ReconciliationService) GetReconciliationStatus(ctx context.Context, batchID string) (*ReconciliationResult, error) {
+	reconciliation, err := s.reconciliationRepo.GetReconciliationByBatchID(ctx, batchID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get reconciliation: %v", err)
 	}
 
+	reference, err := s.reconciliationRepo.GetBatchReference(reconciliation.BatchID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get batch reference: %v", err)
+	}
+	var policy *models.BatchPolicy
+	if s.policies != nil {
+		if policy, err = s.policies.GetBatchPolicy(reconciliation.BatchID); err != nil {
+			return nil, fmt.Errorf("failed to get batch policy packs: %v", err)
+		}
+	}
+
 	return &ReconciliationResult{
-		BatchID: reconciliation.BatchID,
-		Status:  reconciliation.Status,
+		BatchID:           reconciliation.BatchID,
+		ExternalReference: reference,
+		Status:            reconciliation.Status,
+		Version:           reconciliation.Version,
+		Policy:            policy,
 	}, nil
 }
 
-func (s *ReconciliationService) ResolveDispute(batchID string, resolution map[string]interface{}) error {
+// GetReconciliation returns a reconciliation of any batch by its ID
+func (s *ReconciliationService) GetReconciliation(id int64) (*models.Reconciliation, error) {
+	return s.reconciliationRepo.GetReconciliationByID(id)
+}
+
+// ResolveDispute marks the batch's reconciliation as matched. A non-zero
+// version must be the one the operator saw, so a resolution made on stale
+// data fails with repositories.ErrVersionConflict; zero skips that check but
+// still guards against a concurrent resolution. A resolution that moves the
+// batch's numbers is recorded as a batch delta.
+func (s *ReconciliationService) ResolveDispute(batchID string, resolution map[string]interface{}, version int, userID string) error {
 	tx, err := s.db.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %v", err)
 	}
 	defer tx.Rollback()
 
-	reconciliation, err := s.reconciliationRepo.GetReconciliationByBatchID(batchID)
+	reconciliation, err := s.reconciliationRepo.GetReconciliationByBatchID(context.Background(), batchID)
+	if err != nil {
+		return fmt.Errorf("failed to get reconciliation: %w", err)
+	}
+	if version == 0 {
+		version = reconciliation.Version
+	}
+	if err := checkLegalHold(s.legalHoldRepo, models.LegalHoldSubjects{BatchIDs: []string{batchID}}); err != nil {
+		return err
+	}
+
+	before, err := batchSummaries(s.reconciliationRepo, tx, []string{batchID})
 	if err != nil {
-		return fmt.Errorf("failed to get reconciliation: %v", err)
+		return err
 	}
 
-	err = s.reconciliationRepo.UpdateReconciliationStatus(tx, reconciliation.ID, models.StatusMatched)
+	err = s.reconciliationRepo.UpdateReconciliationStatus(tx, reconciliation.ID, models.StatusMatched, version)
 	if err != nil {
-		return fmt.Errorf("failed to update reconciliation status: %v", err)
+		return fmt.Errorf("failed to update reconciliation status: %w", err)
 	}
 
 	resolutionDetails, _ := json.Marshal(resolution)
@@ -354,15 +819,300 @@ func (s *ReconciliationService) ResolveDispute(batchID string, resolution map[st
 		ReconciliationID: reconciliation.ID,
 		Action:           models.AuditActionResolved,
 		Details:          resolutionDetails,
+		UserID:           userID,
 	}
 	err = s.reconciliationRepo.CreateAuditEntry(tx, audit)
 	if err != nil {
 		return fmt.Errorf("failed to create audit entry: %v", err)
 	}
 
+	changes := map[string]interface{}{
+		"reconciliation_id": reconciliation.ID,
+		"status_before":     reconciliation.Status,
+		"status_after":      models.StatusMatched,
+		"resolution":        resolution,
+	}
+	if err := recordBatchDeltas(s.reconciliationRepo, tx, before, models.DeltaActionResolve, userID, changes); err != nil {
+		return err
+	}
+
 	return tx.Commit()
 }
 
+var (
+	// ErrNothingToUnmatch rejects undoing a reconciliation that has no
+	// mappings
+	ErrNothingToUnmatch = errors.New("reconciliation has no match to undo")
+
+	// ErrSettledLater rejects undoing a partial match once a later match
+	// settled the rest of its records; that one is undone first
+	ErrSettledLater = errors.New("a later match settled the rest of the partially matched records")
+)
+
+// UnmatchReconciliation reverses a match: its mappings are deleted, so the
+// bank transactions and entries return to the unreconciled pool for later
+// runs, and the reconciliation becomes unmatched. The audit entry keeps the
+// deleted mappings so the match can be traced, and the batch gets a delta.
+// A zero version unmatches whatever version is current. A match in a held
+// batch, or of held records or accounts, cannot be undone.
+func (s *ReconciliationService) UnmatchReconciliation(id int64, version int, userID, reason string) (*models.Reconciliation, error) {
+	reconciliation, err := s.reconciliationRepo.GetReconciliationByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reconciliation: %w", err)
+	}
+	if version == 0 {
+		version = reconciliation.Version
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	before, err := batchSummaries(s.reconciliationRepo, tx, []string{reconciliation.BatchID})
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := s.unmatch(tx, reconciliation, version, userID, reason)
+	if err != nil {
+		return nil, err
+	}
+	if err := recordBatchDeltas(s.reconciliationRepo, tx, before, models.DeltaActionUnmatch, userID, changes); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	return s.reconciliationRepo.GetReconciliationByID(id)
+}
+
+// unmatch releases the mappings of a reconciliation at version inside tx,
+// marks it unmatched and audits it, returning the changes for the caller's
+// batch delta
+func (s *ReconciliationService) unmatch(tx *sql.Tx, reconciliation *models.Reconciliation, version int, userID, reason string) (map[string]interface{}, error) {
+	released, err := s.releaseMappings(tx, reconciliation)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.reconciliationRepo.UpdateReconciliationStatus(tx, reconciliation.ID, models.StatusUnmatched, version); err != nil {
+		return nil, fmt.Errorf("failed to update reconciliation status: %w", err)
+	}
+
+	changes := map[string]interface{}{
+		"reconciliation_id": reconciliation.ID,
+		"status_before":     reconciliation.Status,
+		"status_after":      models.StatusUnmatched,
+		"match_confidence":  reconciliation.MatchConfidence,
+		"mappings":          released,
+		"reason":            reason,
+	}
+	details, err := json.Marshal(changes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode unmatch details: %v", err)
+	}
+	audit := &models.ReconciliationAudit{
+		ReconciliationID: reconciliation.ID,
+		Action:           models.AuditActionUnmatched,
+		Details:          details,
+		UserID:           userID,
+	}
+	if err := s.reconciliationRepo.CreateAuditEntry(tx, audit); err != nil {
+		return nil, fmt.Errorf("failed to create audit entry: %v", err)
+	}
+	return changes, nil
+}
+
+// releaseMappings deletes the mappings of a reconciliation, returning its
+// records to the unreconciled pool with what they had open, and returns what
+// was deleted for the audit trail. A reconciliation without mappings fails
+// with ErrNothingToUnmatch; one in a held batch, or of held records or
+// accounts, with ErrLegalHold; a partial match whose records a later match
+// settled with ErrSettledLater.
+func (s *ReconciliationService) releaseMappings(tx *sql.Tx, reconciliation *models.Reconciliation) ([]map[string]interface{}, error) {
+	mappings, err := s.reconciliationRepo.GetMappingsForUpdate(tx, reconciliation.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mappings: %v", err)
+	}
+	if len(mappings) == 0 {
+		return nil, ErrNothingToUnmatch
+	}
+	held := models.LegalHoldSubjects{BatchIDs: []string{reconciliation.BatchID}}
+	for _, mapping := range mappings {
+		if mapping.BankTransactionID.Valid {
+			held.BankTransactionIDs = append(held.BankTransactionIDs, mapping.BankTransactionID.Int64)
+		}
+		if mapping.AccountingEntryID.Valid {
+			held.AccountingEntryIDs = append(held.AccountingEntryIDs, mapping.AccountingEntryID.Int64)
+		}
+	}
+	if err := checkLegalHold(s.legalHoldRepo, held); err != nil {
+		return nil, err
+	}
+	if mappings[0].MappingType == models.MappingPartial {
+		later, err := s.reconciliationRepo.GetLaterSettlements(tx, reconciliation.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get later settlements: %v", err)
+		}
+		if len(later) > 0 {
+			return nil, fmt.Errorf("%w: undo reconciliations %v first", ErrSettledLater, later)
+		}
+	}
+	released := make([]map[string]interface{}, 0, len(mappings))
+	for _, mapping := range mappings {
+		record := map[string]interface{}{
+			"bank_transaction_id": mapping.BankTransactionID.Int64,
+			"accounting_entry_id": mapping.AccountingEntryID.Int64,
+			"mapping_type":        mapping.MappingType,
+		}
+		if mapping.Amount != nil {
+			record["amount"] = *mapping.Amount
+		}
+		released = append(released, record)
+	}
+	if err := s.reconciliationRepo.DeleteMappings(tx, reconciliation.ID); err != nil {
+		return nil, fmt.Errorf("failed to delete mappings: %v", err)
+	}
+	if err := s.reconciliationRepo.UpdateOpenAmounts(tx, held.BankTransactionIDs, held.AccountingEntryIDs); err != nil {
+		return nil, fmt.Errorf("failed to update open amounts: %v", err)
+	}
+	return released, nil
+}
+
+// GetBatchDeltas lists the manual changes recorded against a batch, oldest first
+func (s *ReconciliationService) GetBatchDeltas(batchID string) ([]*models.BatchDelta, error) {
+	deltas, err := s.reconciliationRepo.GetBatchDeltas([]string{batchID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get batch deltas: %v", err)
+	}
+	if deltas == nil {
+		deltas = []*models.BatchDelta{}
+	}
+	return deltas, nil
+}
+
 func (s *ReconciliationService) GetUnmatchedRecords(fromDate, toDate string) (map[string]interface{}, error) {
 	return s.reconciliationRepo.GetUnmatchedRecords(fromDate, toDate)
 }
+
+// recordUnmatchedAccounting stores an unmatched reconciliation with audit entry
+// for every accounting entry that found no bank counterpart, in the canonical
+// batch write order: entries by ID, all reconciliations before their audits
+func (s *ReconciliationService) recordUnmatchedAccounting(tx *sql.Tx, batchID string, unmatchedAccounting []*models.AccountingEntry, bankTransactions []*models.BankTransaction, userID string) ([]*matching.UnmatchResult, error) {
+	unmatchedAccounting = append([]*models.AccountingEntry(nil), unmatchedAccounting...)
+	sort.Slice(unmatchedAccounting, func(i, j int) bool {
+		return unmatchedAccounting[i].ID < unmatchedAccounting[j].ID
+	})
+
+	var um []*matching.UnmatchResult
+	reconciliations := make([]*models.Reconciliation, len(unmatchedAccounting))
+	for i, unmatch := range unmatchedAccounting {
+		var trID string
+		for _, transaction := range bankTransactions {
+			if transaction.ReferenceNumber == unmatch.InvoiceNumber {
+				trID = transaction.TransactionID
+			}
+		}
+		um = append(um, &matching.UnmatchResult{
+			BankTransactions:  trID,
+			AccountingEntries: []string{unmatch.EntryID},
+		})
+
+		reconciliations[i] = &models.Reconciliation{
+			BatchID:          batchID,
+			Status:           models.StatusUnmatched,
+			MatchConfidence:  0,
+			AmountDifference: 0,
+		}
+		if err := s.reconciliationRepo.CreateReconciliation(tx, reconciliations[i]); err != nil {
+			return nil, fmt.Errorf("failed to create reconciliation batch: %w", err)
+		}
+	}
+
+	for i, data := range um {
+		auditDetails, _ := json.Marshal(map[string]interface{}{
+			"bank_transactions":  data.BankTransactions,
+			"accounting_entries": data.AccountingEntries,
+		})
+
+		audit := &models.ReconciliationAudit{
+			ReconciliationID: reconciliations[i].ID,
+			Action:           models.AuditActionUnmatched,
+			Details:          auditDetails,
+			UserID:           userID,
+		}
+		if err := s.reconciliationRepo.CreateAuditEntry(tx, audit); err != nil {
+			return nil, fmt.Errorf("failed to create audit entry: %w", err)
+		}
+	}
+
+	return um, nil
+}
+
+// dropContendedMatches locks the accounting entries about to be mapped and
+// discards matches that lost the race to another concurrent run
+func (s *ReconciliationService) dropContendedMatches(tx *sql.Tx, matches []*matching.MatchResult) ([]*matching.MatchResult, error) {
+	var entries []*models.AccountingEntry
+	for _, m := range matches {
+		entries = append(entries, m.AccountingEntries...)
+	}
+	if len(entries) == 0 {
+		return matches, nil
+	}
+
+	mapped, err := s.reconciliationRepo.LockMappedAccountingEntries(tx, entries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock accounting entries: %v", err)
+	}
+
+	var kept []*matching.MatchResult
+	for _, m := range matches {
+		contended := false
+		for _, ae := range m.AccountingEntries {
+			if mapped[ae.ID] {
+				contended = true
+				break
+			}
+		}
+		if !contended {
+			kept = append(kept, m)
+		}
+	}
+	return kept, nil
+}
+
+// recordRemainingUnmatched closes a partitioned batch by recording the
+// accounting entries in the range that no partition matched
+func (s *ReconciliationService) recordRemainingUnmatched(batchID, fromDate, toDate, userID string) (int, error) {
+	accountingEntries, err := s.accountingRepo.GetUnreconciledEntries(context.Background(), fromDate, toDate)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get unreconciled accounting entries: %v", err)
+	}
+	bankTransactions, err := s.bankRepo.GetUnreconciledTransactions(context.Background(), fromDate, toDate)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get unreconciled bank transactions: %v", err)
+	}
+
+	config, err := s.batchMatchConfig()
+	if err != nil {
+		return 0, err
+	}
+
+	var um []*matching.UnmatchResult
+	err = s.withDeadlockRetry(batchID, func(tx *sql.Tx) error {
+		var err error
+		if um, err = s.recordUnmatchedAccounting(tx, batchID, accountingEntries, bankTransactions, userID); err != nil {
+			return err
+		}
+		if err := s.reconciliationRepo.SaveAccountOutcomes(tx, batchID, accountOutcomes(config, nil, nil, accountingEntries)); err != nil {
+			return fmt.Errorf("failed to store account outcomes: %v", err)
+		}
+		return s.persistResultItems(tx, batchID, nil, um)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(um), nil
+}
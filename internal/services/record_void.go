@@ -0,0 +1,186 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"reconciliation-service/internal/models"
+)
+
+var (
+	// ErrInvalidVoid wraps every rejection of a void request
+	ErrInvalidVoid = errors.New("invalid void")
+
+	// ErrRecordVoided rejects changing a record that has been voided
+	ErrRecordVoided = errors.New("record is voided")
+)
+
+// Longest reason a record can be voided with
+const maxVoidReasonLength = 255
+
+// VoidBankTransaction soft deletes a bank transaction a bank has reversed or
+// sent in error. The row is kept with the reason, but leaves matching, the
+// unmatched listings and the exception queue. Every reconciliation mapping it
+// is unmatched and audited first, and batches it was mapped in get a delta.
+// version must be the one the caller read. A held transaction cannot be
+// voided.
+func (s *ReconciliationService) VoidBankTransaction(id int64, version int, userID, reason string) (*models.BankTransaction, error) {
+	reason, err := validateVoid(version, reason)
+	if err != nil {
+		return nil, err
+	}
+	transaction, err := s.bankRepo.GetBankTransactionByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if transaction.VoidedAt != nil {
+		return nil, fmt.Errorf("%w: bank transaction %d is already voided", ErrRecordVoided, id)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	batchIDs, err := s.reconciliationRepo.GetBatchIDsForBankTransaction(tx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get batches of bank transaction %d: %v", id, err)
+	}
+	held := models.LegalHoldSubjects{BatchIDs: batchIDs, BankTransactionIDs: []int64{id}}
+	if err := checkLegalHold(s.legalHoldRepo, held); err != nil {
+		return nil, err
+	}
+	before, err := batchSummaries(s.reconciliationRepo, tx, batchIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	reconciliationIDs, err := s.reconciliationRepo.GetReconciliationIDsForBankTransaction(tx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reconciliations of bank transaction %d: %v", id, err)
+	}
+	unmatched, err := s.unmatchVoided(tx, reconciliationIDs, userID, reason)
+	if err != nil {
+		return nil, err
+	}
+
+	transaction.Version = version
+	transaction.VoidReason = reason
+	transaction.VoidedBy = userID
+	if err := s.bankRepo.VoidBankTransaction(tx, transaction); err != nil {
+		return nil, fmt.Errorf("failed to void bank transaction %d: %w", id, err)
+	}
+
+	changes := map[string]interface{}{
+		"transaction_id": transaction.TransactionID,
+		"reason":         reason,
+		"unmatched":      unmatched,
+	}
+	if err := recordBatchDeltas(s.reconciliationRepo, tx, before, models.DeltaActionBankVoid, userID, changes); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return transaction, nil
+}
+
+// VoidAccountingEntry is VoidBankTransaction for accounting entries
+func (s *ReconciliationService) VoidAccountingEntry(id int64, version int, userID, reason string) (*models.AccountingEntry, error) {
+	reason, err := validateVoid(version, reason)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := s.accountingRepo.GetAccountingEntryByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if entry.VoidedAt != nil {
+		return nil, fmt.Errorf("%w: accounting entry %d is already voided", ErrRecordVoided, id)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	batchIDs, err := s.reconciliationRepo.GetBatchIDsForAccountingEntry(tx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get batches of accounting entry %d: %v", id, err)
+	}
+	held := models.LegalHoldSubjects{BatchIDs: batchIDs, AccountingEntryIDs: []int64{id}}
+	if err := checkLegalHold(s.legalHoldRepo, held); err != nil {
+		return nil, err
+	}
+	before, err := batchSummaries(s.reconciliationRepo, tx, batchIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	reconciliationIDs, err := s.reconciliationRepo.GetReconciliationIDsForAccountingEntry(tx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reconciliations of accounting entry %d: %v", id, err)
+	}
+	unmatched, err := s.unmatchVoided(tx, reconciliationIDs, userID, reason)
+	if err != nil {
+		return nil, err
+	}
+
+	entry.Version = version
+	entry.VoidReason = reason
+	entry.VoidedBy = userID
+	if err := s.accountingRepo.VoidAccountingEntry(tx, entry); err != nil {
+		return nil, fmt.Errorf("failed to void accounting entry %d: %w", id, err)
+	}
+
+	changes := map[string]interface{}{
+		"entry_id":  entry.EntryID,
+		"reason":    reason,
+		"unmatched": unmatched,
+	}
+	if err := recordBatchDeltas(s.reconciliationRepo, tx, before, models.DeltaActionAccountingVoid, userID, changes); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return entry, nil
+}
+
+// validateVoid checks a void request and returns its trimmed reason
+func validateVoid(version int, reason string) (string, error) {
+	if version <= 0 {
+		return "", fmt.Errorf("%w: version is required", ErrInvalidVoid)
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return "", fmt.Errorf("%w: reason is required", ErrInvalidVoid)
+	}
+	if len(reason) > maxVoidReasonLength {
+		return "", fmt.Errorf("%w: reason must be at most %d characters", ErrInvalidVoid, maxVoidReasonLength)
+	}
+	return reason, nil
+}
+
+// unmatchVoided unmatches the reconciliations mapping a record being voided,
+// so their other records return to the unreconciled pool, and returns the
+// changes of each for the batch delta
+func (s *ReconciliationService) unmatchVoided(tx *sql.Tx, reconciliationIDs []int64, userID, reason string) ([]map[string]interface{}, error) {
+	unmatched := make([]map[string]interface{}, 0, len(reconciliationIDs))
+	for _, reconciliationID := range reconciliationIDs {
+		reconciliation, err := s.reconciliationRepo.GetReconciliationByID(reconciliationID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get reconciliation %d: %w", reconciliationID, err)
+		}
+		changes, err := s.unmatch(tx, reconciliation, reconciliation.Version, userID, "record voided: "+reason)
+		if err != nil {
+			return nil, err
+		}
+		unmatched = append(unmatched, changes)
+	}
+	return unmatched, nil
+}
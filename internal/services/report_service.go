@@ -0,0 +1,180 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"reconciliation-service/internal/currency"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/reports"
+	"reconciliation-service/internal/repositories"
+)
+
+// ErrInvalidReport wraps every rejection of a report definition by validation
+var ErrInvalidReport = errors.New("invalid report")
+
+type ReportService struct {
+	reportRepo         repositories.ReportRepository
+	reconciliationRepo repositories.ReconciliationRepository
+	defaultCurrency    string
+	// tenant whose records reports run over
+	tenant string
+}
+
+func NewReportService(reportRepo repositories.ReportRepository, reconciliationRepo repositories.ReconciliationRepository, defaultCurrency, tenant string) *ReportService {
+	return &ReportService{
+		reportRepo:         reportRepo,
+		reconciliationRepo: reconciliationRepo,
+		defaultCurrency:    strings.ToUpper(defaultCurrency),
+		tenant:             tenant,
+	}
+}
+
+// CreateReport validates and stores a report definition
+func (s *ReportService) CreateReport(report *models.ReportDefinition) error {
+	if err := validateReport(report); err != nil {
+		return err
+	}
+	if err := s.reportRepo.CreateReport(report); err != nil {
+		return fmt.Errorf("failed to store report: %v", err)
+	}
+	return nil
+}
+
+func (s *ReportService) GetReport(id int64) (*models.ReportDefinition, error) {
+	return s.reportRepo.GetReport(id)
+}
+
+func (s *ReportService) ListReports() ([]*models.ReportDefinition, error) {
+	return s.reportRepo.ListReports()
+}
+
+// UpdateReport replaces the name, description, source and definition of an
+// existing report
+func (s *ReportService) UpdateReport(report *models.ReportDefinition) (*models.ReportDefinition, error) {
+	if _, err := s.reportRepo.GetReport(report.ID); err != nil {
+		return nil, err
+	}
+	if err := validateReport(report); err != nil {
+		return nil, err
+	}
+	if err := s.reportRepo.UpdateReport(report); err != nil {
+		return nil, fmt.Errorf("failed to update report: %v", err)
+	}
+	return s.reportRepo.GetReport(report.ID)
+}
+
+func (s *ReportService) DeleteReport(id int64) error {
+	return s.reportRepo.DeleteReport(id)
+}
+
+// RunReport executes a stored report over the period. An empty period runs
+// the report over all data; an empty currency uses the configured default.
+func (s *ReportService) RunReport(id int64, fromDate, toDate, currencyCode string) (*models.ReportResult, error) {
+	if currencyCode == "" {
+		currencyCode = s.defaultCurrency
+	}
+	currencyCode = strings.ToUpper(currencyCode)
+	if !currency.Supported(currencyCode) {
+		return nil, fmt.Errorf("%w: unsupported currency %q", ErrInvalidReport, currencyCode)
+	}
+
+	report, err := s.reportRepo.GetReport(id)
+	if err != nil {
+		return nil, err
+	}
+
+	definition, err := decodeDefinition(report.Definition)
+	if err != nil {
+		return nil, err
+	}
+	// Whitelists may have narrowed since the report was saved
+	if err := definition.Validate(report.Source); err != nil {
+		return nil, fmt.Errorf("stored report is no longer valid: %v", err)
+	}
+
+	query, args, columns := definition.BuildQuery(report.Source, s.tenant, fromDate, toDate)
+	rows, err := s.reportRepo.RunQuery(query, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run report: %v", err)
+	}
+
+	result := &models.ReportResult{
+		ReportID:      report.ID,
+		Name:          report.Name,
+		FromDate:      fromDate,
+		ToDate:        toDate,
+		Currency:      currencyCode,
+		Columns:       columns,
+		AmountColumns: definition.AmountColumns(report.Source),
+		Rows:          rows,
+	}
+	if report.Source != reports.SourceBatchDeltas {
+		if result.Deltas, err = s.reconciliationRepo.GetBatchDeltas(reportBatchIDs(columns, rows)); err != nil {
+			return nil, fmt.Errorf("failed to get batch deltas: %v", err)
+		}
+	}
+	return result, nil
+}
+
+// reportBatchIDs collects the distinct batch IDs of a report's rows, if the
+// report returns them at all
+func reportBatchIDs(columns []string, rows [][]interface{}) []string {
+	column := -1
+	for i, name := range columns {
+		if name == "batch_id" {
+			column = i
+		}
+	}
+	if column < 0 {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var batchIDs []string
+	for _, row := range rows {
+		batchID, ok := row[column].(string)
+		if !ok || seen[batchID] {
+			continue
+		}
+		seen[batchID] = true
+		batchIDs = append(batchIDs, batchID)
+	}
+	return batchIDs
+}
+
+func validateReport(report *models.ReportDefinition) error {
+	report.Name = strings.TrimSpace(report.Name)
+	if report.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidReport)
+	}
+	definition, err := decodeDefinition(report.Definition)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidReport, err)
+	}
+	if err := definition.Validate(report.Source); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidReport, err)
+	}
+	normalized, err := json.Marshal(definition)
+	if err != nil {
+		return fmt.Errorf("failed to encode report definition: %v", err)
+	}
+	report.Definition = normalized
+	return nil
+}
+
+func decodeDefinition(raw json.RawMessage) (*reports.Definition, error) {
+	definition := &reports.Definition{}
+	if len(raw) == 0 {
+		return definition, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(definition); err != nil {
+		return nil, fmt.Errorf("malformed definition: %v", err)
+	}
+	return definition, nil
+}
@@ -0,0 +1,214 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/pagination"
+	"reconciliation-service/internal/repositories"
+)
+
+// ErrInvalidRequestAuditQuery wraps every rejection of a request audit search
+var ErrInvalidRequestAuditQuery = errors.New("invalid request audit query")
+
+const (
+	defaultRequestAuditLimit = 100
+	requestAuditsCursor      = "request_audits"
+	maxRequestAuditLimit     = 1000
+
+	// Rows removed per retention DELETE, so a large backlog is purged in
+	// short statements instead of one long lock
+	requestAuditPurgeBatch = 5000
+
+	redactedValue = "[REDACTED]"
+)
+
+// sensitiveKeyParts mark payload fields whose values are credentials; a key
+// containing any of them is redacted
+var sensitiveKeyParts = []string{
+	"password",
+	"secret",
+	"token",
+	"api_key",
+	"apikey",
+	"authorization",
+	"credential",
+	"private_key",
+}
+
+// RequestAuditService keeps the request audit trail: a sanitized copy of
+// every mutating API request, who sent it and what it touched, held for the
+// retention period. Business audits stay in reconciliation_audit.
+type RequestAuditService struct {
+	requestAuditRepo repositories.RequestAuditRepository
+	retention        time.Duration
+	maxPayload       int
+}
+
+func NewRequestAuditService(requestAuditRepo repositories.RequestAuditRepository, retention time.Duration, maxPayload int) *RequestAuditService {
+	return &RequestAuditService{
+		requestAuditRepo: requestAuditRepo,
+		retention:        retention,
+		maxPayload:       maxPayload,
+	}
+}
+
+// MaxPayload is the largest request body stored; a larger one keeps only its
+// size and hash
+func (s *RequestAuditService) MaxPayload() int {
+	return s.maxPayload
+}
+
+// Record stores a request with the given body as its payload. A JSON body is
+// stored with its credential fields redacted, a text body as sent; a binary
+// or truncated body is not stored at all.
+func (s *RequestAuditService) Record(audit *models.RequestAudit, body []byte) error {
+	if !audit.PayloadTruncated {
+		audit.Payload = sanitizePayload(body)
+	}
+	return s.requestAuditRepo.RecordRequest(audit)
+}
+
+// ListRequests searches the audit trail newest first, continuing below
+// filter.BeforeID or from the cursor of a previous page, and returns the
+// cursor of the next page
+func (s *RequestAuditService) ListRequests(filter models.RequestAuditFilter, cursor string) ([]*models.RequestAudit, string, error) {
+	if _, err := time.Parse("2006-01-02", filter.From); filter.From != "" && err != nil {
+		return nil, "", fmt.Errorf("%w: from_date must be YYYY-MM-DD", ErrInvalidRequestAuditQuery)
+	}
+	if _, err := time.Parse("2006-01-02", filter.To); filter.To != "" && err != nil {
+		return nil, "", fmt.Errorf("%w: to_date must be YYYY-MM-DD", ErrInvalidRequestAuditQuery)
+	}
+	switch {
+	case filter.Limit == 0:
+		filter.Limit = defaultRequestAuditLimit
+	case filter.Limit < 0 || filter.Limit > maxRequestAuditLimit:
+		return nil, "", fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidRequestAuditQuery, maxRequestAuditLimit)
+	}
+	if cursor != "" {
+		if filter.BeforeID != 0 {
+			return nil, "", fmt.Errorf("%w: before_id and cursor cannot be combined", ErrInvalidRequestAuditQuery)
+		}
+		after, err := pagination.Decode(cursor, requestAuditsCursor)
+		if err != nil {
+			return nil, "", err
+		}
+		_, filter.BeforeID = after.Key()
+	}
+	filter.Method = strings.ToUpper(filter.Method)
+
+	limit := filter.Limit
+	filter.Limit++
+	audits, err := s.requestAuditRepo.ListRequests(filter)
+	if err != nil {
+		return nil, "", err
+	}
+	audits, next := pagination.Next(audits, limit, func(audit *models.RequestAudit) pagination.Cursor {
+		return pagination.Cursor{List: requestAuditsCursor, ID: audit.ID}
+	})
+	return audits, next, nil
+}
+
+// RunRetention purges audits older than the retention period every interval
+// until ctx is done. A zero retention keeps them forever.
+func (s *RequestAuditService) RunRetention(ctx context.Context, interval time.Duration) {
+	if s.retention <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if purged, err := s.purge(ctx); err != nil {
+			log.Printf("request audit retention: %v", err)
+		} else if purged > 0 {
+			log.Printf("request audit retention: purged %d audits older than %s", purged, s.retention)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *RequestAuditService) purge(ctx context.Context) (int64, error) {
+	cutoff := time.Now().Add(-s.retention)
+	var total int64
+	for ctx.Err() == nil {
+		purged, err := s.requestAuditRepo.DeleteRequestsBefore(cutoff, requestAuditPurgeBatch)
+		if err != nil {
+			return total, fmt.Errorf("failed to purge request audits: %v", err)
+		}
+		total += purged
+		if purged < requestAuditPurgeBatch {
+			break
+		}
+	}
+	return total, nil
+}
+
+// sanitizePayload prepares a request body for storage
+func sanitizePayload(body []byte) string {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return ""
+	}
+	if trimmed[0] == '{' || trimmed[0] == '[' {
+		decoder := json.NewDecoder(bytes.NewReader(trimmed))
+		decoder.UseNumber()
+		var value interface{}
+		if err := decoder.Decode(&value); err == nil {
+			if sanitized, err := json.Marshal(redactCredentials(value)); err == nil {
+				return string(sanitized)
+			}
+		}
+		// Malformed JSON may still carry credentials; keep nothing of it
+		return ""
+	}
+	if !utf8.Valid(body) {
+		return ""
+	}
+	return string(body)
+}
+
+// redactCredentials replaces the values of credential fields at any depth
+func redactCredentials(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if sensitiveKey(key) {
+				v[key] = redactedValue
+				continue
+			}
+			v[key] = redactCredentials(field)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactCredentials(item)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func sensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, part := range sensitiveKeyParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,274 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/pagination"
+	"reconciliation-service/internal/repositories"
+	"reconciliation-service/internal/storage"
+)
+
+// ErrInvalidRetention wraps every rejection of a retention policy
+var ErrInvalidRetention = errors.New("invalid retention settings")
+
+const (
+	// retentionPurgeBatch bounds how many records one delete removes
+	retentionPurgeBatch = 1000
+
+	defaultRetentionRunsLimit = 50
+	maxRetentionRunsLimit     = 500
+)
+
+// RetentionService purges each class of data once it is older than the
+// class's retention policy, or than the longest retention of the policy
+// packs assigned, whichever keeps it longer. Records of a batch under legal
+// hold are kept, and a hold on an account or record keeps the batches it was
+// reconciled in; records carry no tenant, so a tenant hold suspends purging
+// altogether while it stands. Every run, and every dry run, records what it
+// found.
+type RetentionService struct {
+	retentionRepo      repositories.RetentionRepository
+	legalHoldRepo      repositories.LegalHoldRepository
+	exportRepo         repositories.ExportRepository
+	store              storage.Store
+	policies           *PolicyPackService
+	jobService         *JobService
+	maintenanceService *MaintenanceService
+}
+
+func NewRetentionService(
+	retentionRepo repositories.RetentionRepository,
+	legalHoldRepo repositories.LegalHoldRepository,
+	exportRepo repositories.ExportRepository,
+	store storage.Store,
+	policies *PolicyPackService,
+	jobService *JobService,
+	maintenanceService *MaintenanceService,
+) *RetentionService {
+	return &RetentionService{
+		retentionRepo:      retentionRepo,
+		legalHoldRepo:      legalHoldRepo,
+		exportRepo:         exportRepo,
+		store:              store,
+		policies:           policies,
+		jobService:         jobService,
+		maintenanceService: maintenanceService,
+	}
+}
+
+func (s *RetentionService) ListPolicies() ([]*models.RetentionPolicy, error) {
+	return s.retentionRepo.ListPolicies()
+}
+
+// SetPolicy sets how many days a data class is kept; zero keeps it forever
+func (s *RetentionService) SetPolicy(dataClass string, retentionDays int, userID string) (*models.RetentionPolicy, error) {
+	if retentionDays < 0 {
+		return nil, fmt.Errorf("%w: retention_days must not be negative", ErrInvalidRetention)
+	}
+	policy := &models.RetentionPolicy{
+		DataClass:     strings.ToLower(strings.TrimSpace(dataClass)),
+		RetentionDays: retentionDays,
+		UpdatedBy:     userID,
+	}
+	if err := s.retentionRepo.SavePolicy(policy); err != nil {
+		return nil, err
+	}
+
+	policies, err := s.retentionRepo.ListPolicies()
+	if err != nil {
+		return nil, err
+	}
+	for _, saved := range policies {
+		if saved.DataClass == policy.DataClass {
+			return saved, nil
+		}
+	}
+	return nil, repositories.ErrRetentionPolicyNotFound
+}
+
+// retentionRunsCursor names the retention run list in its cursors
+const retentionRunsCursor = "retention_runs"
+
+// ListRuns lists the latest retention runs, newest first, from the cursor a
+// previous page returned, and the cursor of the next page
+func (s *RetentionService) ListRuns(cursor string, limit int) ([]*models.RetentionRun, string, error) {
+	switch {
+	case limit == 0:
+		limit = defaultRetentionRunsLimit
+	case limit < 0 || limit > maxRetentionRunsLimit:
+		return nil, "", fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidRetention, maxRetentionRunsLimit)
+	}
+	after, err := pagination.Decode(cursor, retentionRunsCursor)
+	if err != nil {
+		return nil, "", err
+	}
+	_, beforeID := after.Key()
+	runs, err := s.retentionRepo.ListRuns(beforeID, limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	runs, next := pagination.Next(runs, limit, func(run *models.RetentionRun) pagination.Cursor {
+		return pagination.Cursor{List: retentionRunsCursor, ID: run.ID}
+	})
+	return runs, next, nil
+}
+
+// Run applies every retention policy and records the run. A dry run only
+// counts what would be purged.
+func (s *RetentionService) Run(ctx context.Context, dryRun bool, triggeredBy string) (*models.RetentionRun, error) {
+	run := &models.RetentionRun{
+		DryRun:      dryRun,
+		TriggeredBy: triggeredBy,
+		StartedAt:   time.Now(),
+	}
+
+	policies, err := s.retentionRepo.ListPolicies()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list retention policies: %v", err)
+	}
+	holds, err := s.legalHoldRepo.ListHolds()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list legal holds: %v", err)
+	}
+	suspended := false
+	for _, hold := range holds {
+		if hold.Scope == models.LegalHoldScopeTenant {
+			suspended = true
+		}
+	}
+	heldBatches, err := s.legalHoldRepo.HeldBatchIDs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list held batches: %v", err)
+	}
+	floors, err := s.policies.RetentionFloors()
+	if err != nil {
+		return nil, err
+	}
+
+	run.Classes = make([]*models.RetentionClassReport, 0, len(policies))
+	for _, policy := range policies {
+		report := &models.RetentionClassReport{
+			DataClass:     policy.DataClass,
+			RetentionDays: policy.RetentionDays,
+			Suspended:     suspended,
+		}
+		run.Classes = append(run.Classes, report)
+		if policy.RetentionDays == 0 {
+			continue
+		}
+		// A policy pack in use anywhere keeps the class at least its days
+		if floor := floors[policy.DataClass]; floor > report.RetentionDays {
+			report.RetentionDays = floor
+			report.PolicyPackFloor = true
+		}
+
+		cutoff := run.StartedAt.AddDate(0, 0, -report.RetentionDays).Truncate(time.Second)
+		report.Cutoff = &cutoff
+		report.Expired, report.Held, err = s.retentionRepo.CountExpired(policy.DataClass, cutoff, heldBatches)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count expired %s: %v", policy.DataClass, err)
+		}
+		if dryRun || suspended {
+			continue
+		}
+		if report.Purged, err = s.purge(ctx, policy.DataClass, cutoff, heldBatches); err != nil {
+			return nil, fmt.Errorf("failed to purge %s: %v", policy.DataClass, err)
+		}
+	}
+
+	run.FinishedAt = time.Now()
+	if err := s.retentionRepo.CreateRun(run); err != nil {
+		return nil, fmt.Errorf("failed to record retention run: %v", err)
+	}
+	return run, nil
+}
+
+// purge deletes the expired, unheld records of a class in batches until
+// none are left or ctx is done
+func (s *RetentionService) purge(ctx context.Context, dataClass string, cutoff time.Time, heldBatches []string) (int64, error) {
+	var total int64
+	for ctx.Err() == nil {
+		ids, err := s.retentionRepo.ListExpired(dataClass, cutoff, heldBatches, retentionPurgeBatch)
+		if err != nil {
+			return total, err
+		}
+		if len(ids) == 0 {
+			break
+		}
+		if dataClass == models.RetentionClassExports {
+			s.deleteExportFiles(ids)
+		}
+		purged, err := s.retentionRepo.DeleteRecords(dataClass, ids)
+		if err != nil {
+			return total, err
+		}
+		total += purged
+		if len(ids) < retentionPurgeBatch {
+			break
+		}
+	}
+	return total, nil
+}
+
+// deleteExportFiles removes the stored files of exports about to be purged.
+// A file that cannot be removed is logged and left behind; the record is
+// purged regardless.
+func (s *RetentionService) deleteExportFiles(ids []int64) {
+	for _, id := range ids {
+		export, err := s.exportRepo.GetExport(id)
+		if err != nil {
+			log.Printf("retention: failed to load export %d: %v", id, err)
+			continue
+		}
+		if export.ObjectKey == "" {
+			continue
+		}
+		if err := s.store.Delete(export.ObjectKey); err != nil {
+			log.Printf("retention: failed to delete file of export %d: %v", id, err)
+		}
+	}
+}
+
+// RunPurger applies the retention policies every interval until ctx is
+// cancelled, skipping runs during maintenance or shutdown. With dryRun the
+// purger only reports.
+func (s *RetentionService) RunPurger(ctx context.Context, interval time.Duration, dryRun bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if !s.jobService.Draining() && !s.maintenanceService.Enabled() {
+			s.logRun(ctx, dryRun)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *RetentionService) logRun(ctx context.Context, dryRun bool) {
+	run, err := s.Run(ctx, dryRun, "purger")
+	if err != nil {
+		log.Printf("retention: %v", err)
+		return
+	}
+	for _, report := range run.Classes {
+		switch {
+		case report.Suspended && report.Expired > 0:
+			log.Printf("retention: %d expired %s kept, purging is suspended by a tenant legal hold", report.Expired, report.DataClass)
+		case dryRun && report.Expired > 0:
+			log.Printf("retention: dry run, %d expired %s (%d held)", report.Expired, report.DataClass, report.Held)
+		case report.Purged > 0:
+			log.Printf("retention: purged %d %s older than %d days", report.Purged, report.DataClass, report.RetentionDays)
+		}
+	}
+}
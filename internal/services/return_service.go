@@ -0,0 +1,343 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"time"
+
+	"reconciliation-service/internal/matching"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/pagination"
+	"reconciliation-service/internal/repositories"
+)
+
+// ErrInvalidReturnQuery rejects a return listing or rate report request
+var ErrInvalidReturnQuery = errors.New("invalid return query")
+
+// What a batch does to the match of a returned transaction
+const (
+	ReturnsActionUnmatch = "unmatch"
+	ReturnsActionFlag    = "flag"
+)
+
+const (
+	DefaultReturnLimit = 100
+	MaxReturnLimit     = 1000
+)
+
+// returnMarker recognizes a return in the description or remittance
+// information of a transaction the bank did not mark as one
+var returnMarker = regexp.MustCompile(`(?i)\b(RTRN|REVERSAL|RETURNED DIRECT DEBIT|DIRECT DEBIT RETURN|CHARGEBACK)\b`)
+
+// ReturnService links direct debit and standing order returns
+// (R-transactions) to the transactions they give back, and reports how often
+// each counterparty's payments come back. Batches link the returns among
+// their bank transactions before matching the ledger.
+type ReturnService struct {
+	returnRepo repositories.ReturnRepository
+	action     string
+}
+
+func NewReturnService(returnRepo repositories.ReturnRepository, action string) *ReturnService {
+	switch action {
+	case ReturnsActionUnmatch, ReturnsActionFlag:
+	default:
+		log.Printf("unknown returns action %q, unmatching returned transactions", action)
+		action = ReturnsActionUnmatch
+	}
+	return &ReturnService{returnRepo: returnRepo, action: action}
+}
+
+// returnsCursor names the return list in its cursors
+const returnsCursor = "returns"
+
+// ListReturns lists the latest linked returns from the cursor a previous page
+// returned, and the cursor of the next page
+func (s *ReturnService) ListReturns(cursor string, limit int) ([]*models.BankReturn, string, error) {
+	if limit <= 0 {
+		limit = DefaultReturnLimit
+	}
+	if limit > MaxReturnLimit {
+		limit = MaxReturnLimit
+	}
+	after, err := pagination.Decode(cursor, returnsCursor)
+	if err != nil {
+		return nil, "", err
+	}
+	_, beforeID := after.Key()
+	returns, err := s.returnRepo.ListReturns(beforeID, limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	returns, next := pagination.Next(returns, limit, func(ret *models.BankReturn) pagination.Cursor {
+		return pagination.Cursor{List: returnsCursor, ID: ret.ID}
+	})
+	return returns, next, nil
+}
+
+// ReturnRates reports the share of each counterparty's transactions between
+// two dates that were returned
+func (s *ReturnService) ReturnRates(fromDate, toDate string) ([]*models.CounterpartyReturnRate, error) {
+	from, err := time.Parse("2006-01-02", fromDate)
+	if err != nil {
+		return nil, fmt.Errorf("%w: from_date must be YYYY-MM-DD", ErrInvalidReturnQuery)
+	}
+	to, err := time.Parse("2006-01-02", toDate)
+	if err != nil {
+		return nil, fmt.Errorf("%w: to_date must be YYYY-MM-DD", ErrInvalidReturnQuery)
+	}
+	if to.Before(from) {
+		return nil, fmt.Errorf("%w: to_date is before from_date", ErrInvalidReturnQuery)
+	}
+
+	rates, err := s.returnRepo.ReturnRates(fromDate, toDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get return rates: %v", err)
+	}
+	for _, rate := range rates {
+		if rate.Transactions > 0 {
+			rate.ReturnRate = math.Round(float64(rate.Returns)/float64(rate.Transactions)*10000) / 10000
+		}
+	}
+	return rates, nil
+}
+
+// isReturn reports whether a bank transaction returns or reverses an earlier
+// one
+func isReturn(bt *models.BankTransaction) bool {
+	return bt.Reversal || bt.ReturnReason != "" ||
+		returnMarker.MatchString(bt.Description) || returnMarker.MatchString(bt.RemittanceInformation)
+}
+
+// returnMatch is a return linked to the transaction it gives back
+type returnMatch struct {
+	ret      *models.BankTransaction
+	original *models.BankTransaction
+}
+
+// link finds the originals of the returns among a batch's transactions and
+// returns them together with the transactions left for matching, which
+// include neither side of a linked pair. A return whose original cannot be
+// found is matched like any other transaction.
+func (s *ReturnService) link(bankTransactions []*models.BankTransaction) ([]*returnMatch, []*models.BankTransaction) {
+	var returns []*returnMatch
+	linked := make(map[int64]bool)
+	for _, bt := range bankTransactions {
+		if !isReturn(bt) {
+			continue
+		}
+		original, err := s.returnRepo.FindOriginal(bt)
+		if err != nil {
+			log.Printf("failed to look up the original of return %s: %v", bt.TransactionID, err)
+			continue
+		}
+		if original == nil || linked[original.ID] || linked[bt.ID] {
+			continue
+		}
+		linked[bt.ID], linked[original.ID] = true, true
+		returns = append(returns, &returnMatch{ret: bt, original: original})
+	}
+	if len(returns) == 0 {
+		return nil, bankTransactions
+	}
+
+	matchable := make([]*models.BankTransaction, 0, len(bankTransactions))
+	for _, bt := range bankTransactions {
+		if !linked[bt.ID] {
+			matchable = append(matchable, bt)
+		}
+	}
+	return returns, matchable
+}
+
+// persistReturns records a batch's linked returns. A matched original is
+// unmatched, releasing its accounting entries, or marked disputed, as the
+// returns action says, unless a legal hold keeps it; either way the batch
+// gets a delta. Original and return are then mapped together as a matched
+// return, or the return alone as disputed when the original's match stays.
+func (s *ReconciliationService) persistReturns(tx *sql.Tx, batchID string, returns []*returnMatch, userID string) ([]*matching.MatchesResult, int, error) {
+	var views []*matching.MatchesResult
+	disputed := 0
+	for _, rm := range returns {
+		record := &models.BankReturn{
+			ReturnTransactionID:   rm.ret.ID,
+			OriginalTransactionID: rm.original.ID,
+			ReasonCode:            rm.ret.ReturnReason,
+			Action:                models.ReturnActionPaired,
+			BatchID:               batchID,
+		}
+		original, err := s.returns.returnRepo.GetMatchedReconciliation(tx, rm.original.ID)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to get the match of returned transaction %s: %v", rm.original.TransactionID, err)
+		}
+		if original != nil {
+			record.ReconciliationID = original.ID
+			if record.Action, err = s.undoReturnedMatch(tx, original, rm, userID); err != nil {
+				return nil, 0, err
+			}
+		}
+
+		status := models.StatusMatched
+		mapped := []*models.BankTransaction{rm.ret, rm.original}
+		if record.Action == models.ReturnActionFlagged || record.Action == models.ReturnActionHeld {
+			status = models.StatusDisputed
+			mapped = mapped[:1]
+			disputed++
+		}
+		reconciliation := &models.Reconciliation{
+			BatchID:         batchID,
+			Status:          status,
+			MatchConfidence: 1,
+		}
+		if err := s.reconciliationRepo.CreateReconciliation(tx, reconciliation); err != nil {
+			return nil, 0, fmt.Errorf("failed to create reconciliation batch: %w", err)
+		}
+		for _, bt := range mapped {
+			mapping := &models.ReconciliationMapping{
+				ReconciliationID:  reconciliation.ID,
+				BankTransactionID: sql.NullInt64{Int64: bt.ID, Valid: true},
+				MappingType:       models.MappingReturn,
+			}
+			if err := s.reconciliationRepo.CreateMapping(tx, mapping); err != nil {
+				return nil, 0, fmt.Errorf("failed to create mapping: %w", err)
+			}
+		}
+
+		criteria := returnMatchCriteria(rm)
+		auditAction := models.AuditActionMatched
+		if status == models.StatusDisputed {
+			auditAction = models.AuditActionDisputed
+		}
+		auditDetails, _ := json.Marshal(map[string]interface{}{
+			"match_type":              models.MappingReturn,
+			"confidence":              1,
+			"match_criteria":          criteria,
+			"original_transaction_id": rm.original.ID,
+			"return_action":           record.Action,
+		})
+		audit := &models.ReconciliationAudit{
+			ReconciliationID: reconciliation.ID,
+			Action:           auditAction,
+			Details:          auditDetails,
+			UserID:           userID,
+		}
+		if err := s.reconciliationRepo.CreateAuditEntry(tx, audit); err != nil {
+			return nil, 0, fmt.Errorf("failed to create audit entry: %w", err)
+		}
+
+		if err := s.returns.returnRepo.CreateReturn(tx, record); err != nil {
+			return nil, 0, fmt.Errorf("failed to record return %s: %w", rm.ret.TransactionID, err)
+		}
+
+		transactionIDs := make([]string, 0, len(mapped))
+		for _, bt := range mapped {
+			transactionIDs = append(transactionIDs, bt.TransactionID)
+		}
+		views = append(views, &matching.MatchesResult{
+			Type:            models.MappingReturn,
+			Confidence:      1,
+			BankTransaction: fmt.Sprintf("%v", transactionIDs),
+			AccountingEntry: fmt.Sprintf("%v", []string(nil)),
+			MatchCriteria:   criteria,
+		})
+	}
+	return views, disputed, nil
+}
+
+// undoReturnedMatch unmatches or disputes the reconciliation a returned
+// transaction is mapped in and reports the return action taken. A match that
+// is disputed already is left as it is.
+func (s *ReconciliationService) undoReturnedMatch(tx *sql.Tx, original *models.Reconciliation, rm *returnMatch, userID string) (string, error) {
+	if original.Status == models.StatusDisputed {
+		return models.ReturnActionFlagged, nil
+	}
+
+	mappings, err := s.reconciliationRepo.GetMappingsForUpdate(tx, original.ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get mappings: %v", err)
+	}
+	held := models.LegalHoldSubjects{BatchIDs: []string{original.BatchID}}
+	for _, mapping := range mappings {
+		if mapping.BankTransactionID.Valid {
+			held.BankTransactionIDs = append(held.BankTransactionIDs, mapping.BankTransactionID.Int64)
+		}
+		if mapping.AccountingEntryID.Valid {
+			held.AccountingEntryIDs = append(held.AccountingEntryIDs, mapping.AccountingEntryID.Int64)
+		}
+	}
+	if err := checkLegalHold(s.legalHoldRepo, held); err != nil {
+		if errors.Is(err, ErrLegalHold) {
+			log.Printf("return %s left reconciliation %d as it is: %v", rm.ret.TransactionID, original.ID, err)
+			return models.ReturnActionHeld, nil
+		}
+		return "", err
+	}
+
+	before, err := batchSummaries(s.reconciliationRepo, tx, []string{original.BatchID})
+	if err != nil {
+		return "", err
+	}
+	changes := map[string]interface{}{
+		"reconciliation_id":     original.ID,
+		"status_before":         original.Status,
+		"match_confidence":      original.MatchConfidence,
+		"return_transaction_id": rm.ret.ID,
+		"return_reason":         rm.ret.ReturnReason,
+		"reason":                fmt.Sprintf("returned by bank transaction %s", rm.ret.TransactionID),
+	}
+
+	action, auditAction := models.ReturnActionFlagged, models.AuditActionDisputed
+	status := models.StatusDisputed
+	if s.returns.action == ReturnsActionUnmatch {
+		action, auditAction = models.ReturnActionUnmatched, models.AuditActionUnmatched
+		status = models.StatusUnmatched
+
+		released := make([]map[string]interface{}, 0, len(mappings))
+		for _, mapping := range mappings {
+			released = append(released, map[string]interface{}{
+				"bank_transaction_id": mapping.BankTransactionID.Int64,
+				"accounting_entry_id": mapping.AccountingEntryID.Int64,
+				"mapping_type":        mapping.MappingType,
+			})
+		}
+		changes["mappings"] = released
+		if err := s.reconciliationRepo.DeleteMappings(tx, original.ID); err != nil {
+			return "", fmt.Errorf("failed to delete mappings: %v", err)
+		}
+	}
+	changes["status_after"] = status
+	if err := s.reconciliationRepo.UpdateReconciliationStatus(tx, original.ID, status, original.Version); err != nil {
+		return "", fmt.Errorf("failed to update reconciliation status: %w", err)
+	}
+
+	details, err := json.Marshal(changes)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode return details: %v", err)
+	}
+	audit := &models.ReconciliationAudit{
+		ReconciliationID: original.ID,
+		Action:           auditAction,
+		Details:          details,
+		UserID:           userID,
+	}
+	if err := s.reconciliationRepo.CreateAuditEntry(tx, audit); err != nil {
+		return "", fmt.Errorf("failed to create audit entry: %v", err)
+	}
+	if err := recordBatchDeltas(s.reconciliationRepo, tx, before, models.DeltaActionReturn, userID, changes); err != nil {
+		return "", err
+	}
+	return action, nil
+}
+
+func returnMatchCriteria(rm *returnMatch) []string {
+	criteria := []string{"return_of:" + rm.original.TransactionID}
+	if rm.ret.ReturnReason != "" {
+		criteria = append(criteria, "return_reason:"+rm.ret.ReturnReason)
+	}
+	return criteria
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"reconciliation-service/internal/matching"
+	"reconciliation-service/internal/models"
+)
+
+// persistReversals records the reversal pairs the engine netted out of a
+// batch. Each pair is mapped as a matched reconciliation of its own, so
+// neither record goes back to the unmatched pool.
+func (s *ReconciliationService) persistReversals(tx *sql.Tx, batchID string, reversals []*matching.Reversal, userID string) ([]*matching.MatchesResult, error) {
+	var views []*matching.MatchesResult
+	for _, reversal := range reversals {
+		reconciliation := &models.Reconciliation{
+			BatchID:         batchID,
+			Status:          models.StatusMatched,
+			MatchConfidence: 1,
+		}
+		if err := s.reconciliationRepo.CreateReconciliation(tx, reconciliation); err != nil {
+			return nil, fmt.Errorf("failed to create reconciliation batch: %w", err)
+		}
+
+		var transactionIDs, entryIDs []string
+		for _, bt := range reversal.BankTransactions {
+			mapping := &models.ReconciliationMapping{
+				ReconciliationID:  reconciliation.ID,
+				BankTransactionID: sql.NullInt64{Int64: bt.ID, Valid: true},
+				MappingType:       models.MappingReversal,
+			}
+			if err := s.reconciliationRepo.CreateMapping(tx, mapping); err != nil {
+				return nil, fmt.Errorf("failed to create mapping: %w", err)
+			}
+			transactionIDs = append(transactionIDs, bt.TransactionID)
+		}
+		for _, ae := range reversal.AccountingEntries {
+			mapping := &models.ReconciliationMapping{
+				ReconciliationID:  reconciliation.ID,
+				AccountingEntryID: sql.NullInt64{Int64: ae.ID, Valid: true},
+				MappingType:       models.MappingReversal,
+			}
+			if err := s.reconciliationRepo.CreateMapping(tx, mapping); err != nil {
+				return nil, fmt.Errorf("failed to create mapping: %w", err)
+			}
+			entryIDs = append(entryIDs, ae.EntryID)
+		}
+
+		auditDetails, _ := json.Marshal(map[string]interface{}{
+			"match_type":     models.MappingReversal,
+			"confidence":     1,
+			"match_criteria": reversal.MatchCriteria,
+		})
+		audit := &models.ReconciliationAudit{
+			ReconciliationID: reconciliation.ID,
+			Action:           models.AuditActionMatched,
+			Details:          auditDetails,
+			UserID:           userID,
+		}
+		if err := s.reconciliationRepo.CreateAuditEntry(tx, audit); err != nil {
+			return nil, fmt.Errorf("failed to create audit entry: %w", err)
+		}
+
+		views = append(views, &matching.MatchesResult{
+			Type:            models.MappingReversal,
+			Confidence:      1,
+			BankTransaction: fmt.Sprintf("%v", transactionIDs),
+			AccountingEntry: fmt.Sprintf("%v", entryIDs),
+			MatchCriteria:   reversal.MatchCriteria,
+		})
+	}
+	return views, nil
+}
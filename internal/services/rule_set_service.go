@@ -0,0 +1,276 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"reconciliation-service/internal/matching"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+)
+
+var (
+	// ErrInvalidRuleSetChange wraps every rejection of a proposed rule change
+	ErrInvalidRuleSetChange = errors.New("invalid rule set change")
+
+	// ErrSelfApproval rejects a review by the author of the change
+	ErrSelfApproval = errors.New("a rule set change must be reviewed by someone other than its author")
+)
+
+var rulesVersionPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,49}$`)
+
+// RuleSetService keeps the production matching rules. Each change is a new
+// version, proposed by one operator and approved by another before it is
+// used; until the first approval the baseline applies, the built-in
+// defaults unless a rule file overlays them.
+type RuleSetService struct {
+	ruleSetRepo repositories.RuleSetRepository
+	baseline    matching.Rules
+}
+
+func NewRuleSetService(ruleSetRepo repositories.RuleSetRepository, baseline matching.Rules) *RuleSetService {
+	if baseline.Version == "" {
+		baseline = matching.DefaultRules()
+	}
+	return &RuleSetService{
+		ruleSetRepo: ruleSetRepo,
+		baseline:    baseline,
+	}
+}
+
+// isBaseline reports whether a version names the rules in force before any
+// approved change
+func (s *RuleSetService) isBaseline(version string) bool {
+	return version == s.baseline.Version || version == matching.DefaultRulesVersion
+}
+
+// ActiveRules returns the production rules
+func (s *RuleSetService) ActiveRules() (matching.Rules, error) {
+	change, err := s.ruleSetRepo.GetActiveChange()
+	if err != nil {
+		return matching.Rules{}, fmt.Errorf("failed to load active rule set: %v", err)
+	}
+	if change == nil {
+		return s.baseline, nil
+	}
+	var rules matching.Rules
+	if err := json.Unmarshal(change.Rules, &rules); err != nil {
+		return matching.Rules{}, fmt.Errorf("failed to decode rule set %s: %v", change.Version, err)
+	}
+	return rules, nil
+}
+
+// ProposeChange records a pending change to the active rules. rules sets
+// only the fields to change; the change stores the complete rule set and the
+// diff against the active one.
+func (s *RuleSetService) ProposeChange(version string, rules json.RawMessage, author, reason string) (*models.RuleSetChange, error) {
+	author = strings.TrimSpace(author)
+	if author == "" {
+		return nil, fmt.Errorf("%w: author is required", ErrInvalidRuleSetChange)
+	}
+
+	version = strings.TrimSpace(version)
+	if s.isBaseline(version) {
+		return nil, fmt.Errorf("%w: version %q is reserved for the baseline rules", ErrInvalidRuleSetChange, version)
+	}
+	base, err := s.ActiveRules()
+	if err != nil {
+		return nil, err
+	}
+	proposed, err := applyRules(base, version, rules)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRuleSetChange, err)
+	}
+	diff, err := rulesDiff(base, proposed)
+	if err != nil {
+		return nil, err
+	}
+	if len(diff) == 0 {
+		return nil, fmt.Errorf("%w: rules are the same as version %s", ErrInvalidRuleSetChange, base.Version)
+	}
+
+	encodedRules, err := json.Marshal(proposed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode rules: %v", err)
+	}
+	encodedDiff, err := json.Marshal(diff)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode diff: %v", err)
+	}
+	change := &models.RuleSetChange{
+		Version:     proposed.Version,
+		BaseVersion: base.Version,
+		Rules:       encodedRules,
+		Diff:        encodedDiff,
+		Status:      models.RuleSetStatusPending,
+		Author:      author,
+		Reason:      strings.TrimSpace(reason),
+	}
+	if err := s.ruleSetRepo.CreateChange(change); err != nil {
+		if errors.Is(err, repositories.ErrRuleSetConflict) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to store rule set change: %v", err)
+	}
+	return change, nil
+}
+
+// ApproveChange activates a pending change. The reviewer must not be its
+// author, and the rule set it was proposed against must still be active;
+// otherwise repositories.ErrRuleSetStale asks for a fresh proposal.
+func (s *RuleSetService) ApproveChange(id int64, reviewer, note string) (*models.RuleSetChange, error) {
+	change, err := s.checkReview(id, reviewer)
+	if err != nil {
+		return nil, err
+	}
+	activeVersion := change.BaseVersion
+	if s.isBaseline(activeVersion) {
+		activeVersion = ""
+	}
+	if err := s.ruleSetRepo.ActivateChange(id, activeVersion, strings.TrimSpace(reviewer), strings.TrimSpace(note)); err != nil {
+		return nil, err
+	}
+	return s.ruleSetRepo.GetChange(id)
+}
+
+func (s *RuleSetService) RejectChange(id int64, reviewer, note string) (*models.RuleSetChange, error) {
+	if _, err := s.checkReview(id, reviewer); err != nil {
+		return nil, err
+	}
+	if err := s.ruleSetRepo.RejectChange(id, strings.TrimSpace(reviewer), strings.TrimSpace(note)); err != nil {
+		return nil, err
+	}
+	return s.ruleSetRepo.GetChange(id)
+}
+
+func (s *RuleSetService) checkReview(id int64, reviewer string) (*models.RuleSetChange, error) {
+	reviewer = strings.TrimSpace(reviewer)
+	if reviewer == "" {
+		return nil, fmt.Errorf("%w: reviewer is required", ErrInvalidRuleSetChange)
+	}
+	change, err := s.ruleSetRepo.GetChange(id)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(change.Author, reviewer) {
+		return nil, ErrSelfApproval
+	}
+	return change, nil
+}
+
+func (s *RuleSetService) GetChange(id int64) (*models.RuleSetChange, error) {
+	return s.ruleSetRepo.GetChange(id)
+}
+
+func (s *RuleSetService) ListChanges() ([]*models.RuleSetChange, error) {
+	return s.ruleSetRepo.ListChanges()
+}
+
+// applyRuleFile loads a rule file into the match configuration and returns
+// the baseline rules it defines: its rules overlaid on the built-in defaults
+// under its version. Strategies, netting entry types and the creditor
+// reference setting replace the environment's when the file sets them.
+func applyRuleFile(path string, config *matching.Config) (matching.Rules, error) {
+	file, err := matching.LoadRuleFile(path)
+	if err != nil {
+		return matching.Rules{}, err
+	}
+	rules, err := applyRules(matching.DefaultRules(), strings.TrimSpace(file.Version), file.Rules)
+	if err != nil {
+		return matching.Rules{}, fmt.Errorf("rule file %s: %v", path, err)
+	}
+
+	if file.CreditorReferenceMatching != nil {
+		config.CreditorReferenceMatching = *file.CreditorReferenceMatching
+	}
+	if len(file.Strategies) > 0 {
+		config.Strategies = file.Strategies
+	}
+	if file.NettingEntryTypes != nil {
+		config.NettingEntryTypes = *file.NettingEntryTypes
+	}
+	if file.ReversalWindowDays != nil {
+		config.ReversalWindowDays = *file.ReversalWindowDays
+	}
+	config.Exclusions = file.Exclusions
+	return rules, nil
+}
+
+// applyRules overlays the fields set in overrides on base and names the
+// result version
+func applyRules(base matching.Rules, version string, overrides json.RawMessage) (matching.Rules, error) {
+	if !rulesVersionPattern.MatchString(version) {
+		return matching.Rules{}, errors.New("version must be 1-50 letters, digits, dots, dashes or underscores")
+	}
+	if version == matching.DefaultRulesVersion {
+		return matching.Rules{}, fmt.Errorf("version %q is reserved for the built-in rules", version)
+	}
+
+	rules := base
+	if len(overrides) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(overrides))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&rules); err != nil {
+			return matching.Rules{}, fmt.Errorf("rules: %v", err)
+		}
+	}
+	rules.Version = version
+	return rules, validateRules(rules)
+}
+
+func validateRules(rules matching.Rules) error {
+	switch {
+	case rules.MinConfidence <= 0 || rules.MinConfidence > 1:
+		return errors.New("min_confidence must be above 0 and at most 1")
+	case rules.MinGroupConfidence <= 0 || rules.MinGroupConfidence > 1:
+		return errors.New("min_group_confidence must be above 0 and at most 1")
+	case rules.AmountToleranceBasisPoints < 0 || rules.AmountToleranceBasisPoints > 10000:
+		return errors.New("amount_tolerance_basis_points must be between 0 and 10000")
+	case rules.DateToleranceDays < 0 || rules.DateToleranceDays > 365:
+		return errors.New("date_tolerance_days must be between 0 and 365")
+	case rules.CounterpartyIBANWeight < 0 || rules.CounterpartyIBANWeight > 1,
+		rules.CounterpartyWeight < 0 || rules.CounterpartyWeight > 1,
+		rules.DescriptionWeight < 0 || rules.DescriptionWeight > 1:
+		return errors.New("weights must be between 0 and 1")
+	case rules.DescriptionMinSharedWords < 1:
+		return errors.New("description_min_shared_words must be at least 1")
+	case rules.DescriptionOverlap <= 0 || rules.DescriptionOverlap > 1:
+		return errors.New("description_overlap must be above 0 and at most 1")
+	}
+	return nil
+}
+
+// rulesDiff maps each rule that differs between two rule sets, by its JSON
+// name, to its old and new value. The version itself is not a rule.
+func rulesDiff(from, to matching.Rules) (map[string]map[string]interface{}, error) {
+	var before, after map[string]interface{}
+	if err := roundTrip(from, &before); err != nil {
+		return nil, err
+	}
+	if err := roundTrip(to, &after); err != nil {
+		return nil, err
+	}
+	delete(before, "version")
+	delete(after, "version")
+
+	diff := make(map[string]map[string]interface{})
+	for name, value := range after {
+		if !reflect.DeepEqual(before[name], value) {
+			diff[name] = map[string]interface{}{"from": before[name], "to": value}
+		}
+	}
+	return diff, nil
+}
+
+func roundTrip(value interface{}, into *map[string]interface{}) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode rules: %v", err)
+	}
+	return json.Unmarshal(encoded, into)
+}
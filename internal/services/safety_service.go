@@ -0,0 +1,105 @@
+package services
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+)
+
+var (
+	// ErrConfirmationRequired means a destructive operation in production was
+	// sent without a confirmation token
+	ErrConfirmationRequired = errors.New("this operation requires a confirmation token in production")
+
+	// ErrConfirmationInvalid means the confirmation token did not match
+	ErrConfirmationInvalid = errors.New("invalid confirmation token")
+
+	// ErrConfirmationUnavailable means production has no confirmation token
+	// configured, so destructive operations cannot be confirmed at all
+	ErrConfirmationUnavailable = errors.New("destructive operations are disabled in production")
+)
+
+// Destructive operations guarded by SafetyService
+const (
+	SafetyOperationUnmatch                 = "unmatch"
+	SafetyOperationConfigImport            = "config_import"
+	SafetyOperationDeleteReport            = "delete_report"
+	SafetyOperationDeleteCalendar          = "delete_calendar"
+	SafetyOperationDeleteHoliday           = "delete_holiday"
+	SafetyOperationDeleteCounterparty      = "delete_counterparty"
+	SafetyOperationDeleteAlias             = "delete_alias"
+	SafetyOperationDeleteShadowCandidate   = "delete_shadow_candidate"
+	SafetyOperationDeleteNotificationPrefs = "delete_notification_preferences"
+	SafetyOperationDeleteSchedule          = "delete_schedule"
+	SafetyOperationLiftLegalHold           = "lift_legal_hold"
+	SafetyOperationRetentionPurge          = "retention_purge"
+	SafetyOperationDeleteFeeSchedule       = "delete_fee_schedule"
+	SafetyOperationIntegrityRepair         = "integrity_repair"
+)
+
+const (
+	productionEnvironment = "production"
+	safetyOverridesLimit  = 500
+)
+
+// SafetyService guards destructive operations by environment. Outside
+// production they run unrestricted; in production each one needs the
+// configured confirmation token and is recorded as an override before it
+// runs.
+type SafetyService struct {
+	safetyRepo   repositories.SafetyRepository
+	environment  string
+	confirmToken string
+}
+
+func NewSafetyService(safetyRepo repositories.SafetyRepository, environment, confirmToken string) *SafetyService {
+	return &SafetyService{
+		safetyRepo:   safetyRepo,
+		environment:  strings.ToLower(strings.TrimSpace(environment)),
+		confirmToken: confirmToken,
+	}
+}
+
+// Guarded reports whether destructive operations need confirmation
+func (s *SafetyService) Guarded() bool {
+	return s.environment == productionEnvironment || s.environment == "prod"
+}
+
+// Confirm lets a destructive operation through. In production token must
+// match the configured one, and the override is recorded first: an override
+// that cannot be audited is refused.
+func (s *SafetyService) Confirm(operation, token, method, path, caller string) error {
+	if !s.Guarded() {
+		return nil
+	}
+	if s.confirmToken == "" {
+		return ErrConfirmationUnavailable
+	}
+	if token == "" {
+		return ErrConfirmationRequired
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.confirmToken)) != 1 {
+		return ErrConfirmationInvalid
+	}
+
+	override := &models.SafetyOverride{
+		Environment: s.environment,
+		Operation:   operation,
+		Method:      method,
+		Path:        path,
+		Caller:      caller,
+	}
+	if err := s.safetyRepo.RecordOverride(override); err != nil {
+		return fmt.Errorf("failed to record safety override: %v", err)
+	}
+	return nil
+}
+
+// ListOverrides returns the latest confirmed overrides, newest first
+func (s *SafetyService) ListOverrides() ([]*models.SafetyOverride, error) {
+	return s.safetyRepo.ListOverrides(safetyOverridesLimit)
+}
@@ -0,0 +1,276 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"reconciliation-service/internal/banking"
+	"reconciliation-service/internal/config"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/money"
+	"reconciliation-service/internal/repositories"
+)
+
+var (
+	// ErrSandboxDisabled answers the sandbox routes of every tenant but the
+	// sandbox
+	ErrSandboxDisabled = errors.New("sandbox is not enabled for this tenant")
+
+	// ErrSandboxResetting refuses a reset while this instance is resetting
+	ErrSandboxResetting = errors.New("sandbox reset is already running")
+)
+
+const (
+	// sandboxCheckInterval is how often the resetter looks whether the
+	// nightly reset is due
+	sandboxCheckInterval = 5 * time.Minute
+
+	// sandboxDays is how many days back generated records are dated
+	sandboxDays = 30
+
+	sandboxBankAccount   = "SANDBOX-0001"
+	sandboxLedgerAccount = "1100"
+)
+
+// sandboxCustomers are the made-up counterparties of generated records
+var sandboxCustomers = []string{
+	"Northwind Traders", "Contoso Retail", "Fabrikam Industries", "Tailspin Toys",
+	"Wide World Importers", "Adventure Works", "Litware Inc", "Proseware Ltd",
+	"Lucerne Publishing", "Alpine Ski House",
+}
+
+// SandboxStatus is what integrating teams see of their sandbox
+type SandboxStatus struct {
+	Tenant      string               `json:"tenant"`
+	LastReset   *models.SandboxReset `json:"last_reset,omitempty"`
+	NextResetAt time.Time            `json:"next_reset_at"`
+}
+
+// SandboxService keeps the sandbox tenant filled with synthetic data. Each
+// night its records are wiped and generated afresh: bank transactions with
+// ledger entries that mostly match, some a few days apart, some short by a
+// bank charge, and a few with nothing to match.
+type SandboxService struct {
+	sandboxRepo          repositories.SandboxRepository
+	dataIngestionService *DataIngestionService
+	jobService           *JobService
+	maintenanceService   *MaintenanceService
+	config               config.SandboxConfig
+	// running keeps resets of this instance from overlapping
+	running sync.Mutex
+}
+
+func NewSandboxService(sandboxRepo repositories.SandboxRepository, dataIngestionService *DataIngestionService, jobService *JobService, maintenanceService *MaintenanceService, cfg config.SandboxConfig) *SandboxService {
+	return &SandboxService{
+		sandboxRepo:          sandboxRepo,
+		dataIngestionService: dataIngestionService,
+		jobService:           jobService,
+		maintenanceService:   maintenanceService,
+		config:               cfg,
+	}
+}
+
+// RunResetter resets the sandbox each night until ctx is cancelled. An
+// empty sandbox is filled at once. Nothing is reset while the service drains
+// or is in maintenance.
+func (s *SandboxService) RunResetter(ctx context.Context) {
+	ticker := time.NewTicker(sandboxCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		if !s.jobService.Draining() && !s.maintenanceService.Enabled() {
+			s.resetNightly()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *SandboxService) resetNightly() {
+	now := time.Now().UTC()
+	latest, err := s.sandboxRepo.LatestReset()
+	if err != nil {
+		log.Printf("sandbox: %v", err)
+		return
+	}
+	if latest != nil && now.Hour() < s.config.ResetHour {
+		return
+	}
+
+	// Each day's reset is claimed by one instance
+	reset, err := s.reset(now.Format("2006-01-02"), "resetter")
+	switch {
+	case reset == nil && err == nil, errors.Is(err, ErrSandboxResetting):
+	case errors.Is(err, repositories.ErrSandboxBusy):
+		log.Printf("sandbox: reset postponed, %v", err)
+	case err != nil:
+		log.Printf("sandbox: %v", err)
+	default:
+		log.Printf("sandbox: reset with %d bank transactions and %d accounting entries",
+			reset.BankTransactions, reset.AccountingEntries)
+	}
+}
+
+// Reset wipes the sandbox and generates its data now
+func (s *SandboxService) Reset(triggeredBy string) (*models.SandboxReset, error) {
+	return s.reset("", triggeredBy)
+}
+
+// reset claims the reset for resetDate, or one for no date, and runs it. A
+// reset already claimed returns nil and no error.
+func (s *SandboxService) reset(resetDate, triggeredBy string) (*models.SandboxReset, error) {
+	if !s.running.TryLock() {
+		return nil, ErrSandboxResetting
+	}
+	defer s.running.Unlock()
+
+	reset, claimed, err := s.sandboxRepo.ClaimReset(resetDate, triggeredBy)
+	if err != nil || !claimed {
+		return nil, err
+	}
+	if err := s.sandboxRepo.ClearRecords(); err != nil {
+		if errors.Is(err, repositories.ErrSandboxBusy) {
+			if releaseErr := s.sandboxRepo.ReleaseReset(reset.ID); releaseErr != nil {
+				log.Printf("sandbox: failed to release reset %d: %v", reset.ID, releaseErr)
+			}
+			return nil, err
+		}
+		return s.finish(reset, fmt.Errorf("failed to clear the sandbox: %w", err))
+	}
+
+	transactions, entries := generateSandboxData(reset.StartedAt.UTC(), s.config.Transactions)
+	bankResult, err := s.dataIngestionService.IngestBankTransactions(IngestionLaneBulk, transactions, nil, false)
+	if err == nil && !bankResult.Success {
+		err = fmt.Errorf("bank transactions rejected: %s", strings.Join(bankResult.Errors, "; "))
+	}
+	if err != nil {
+		return s.finish(reset, err)
+	}
+	reset.BankTransactions = bankResult.RecordsCount
+
+	entryResult, err := s.dataIngestionService.IngestAccountingEntries(IngestionLaneBulk, entries, false)
+	if err == nil && !entryResult.Success {
+		err = fmt.Errorf("accounting entries rejected: %s", strings.Join(entryResult.Errors, "; "))
+	}
+	if err != nil {
+		return s.finish(reset, err)
+	}
+	reset.AccountingEntries = entryResult.RecordsCount
+	return s.finish(reset, nil)
+}
+
+// finish records the outcome of a reset, returning resetErr
+func (s *SandboxService) finish(reset *models.SandboxReset, resetErr error) (*models.SandboxReset, error) {
+	if resetErr != nil {
+		reset.Error = resetErr.Error()
+	}
+	if err := s.sandboxRepo.FinishReset(reset); err != nil && resetErr == nil {
+		return nil, fmt.Errorf("failed to record sandbox reset: %w", err)
+	}
+	return reset, resetErr
+}
+
+// Status returns the last reset and when the next nightly one is due
+func (s *SandboxService) Status() (*SandboxStatus, error) {
+	latest, err := s.sandboxRepo.LatestReset()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	next := time.Date(now.Year(), now.Month(), now.Day(), s.config.ResetHour, 0, 0, 0, time.UTC)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return &SandboxStatus{
+		Tenant:      s.config.Tenant,
+		LastReset:   latest,
+		NextResetAt: next,
+	}, nil
+}
+
+// sandboxCounterparties keeps matches in the sandbox from teaching the
+// counterparties, which are shared by every tenant
+type sandboxCounterparties struct {
+	repositories.CounterpartyRepository
+}
+
+func (sandboxCounterparties) EnrichFromBatch(string) error {
+	return nil
+}
+
+// generateSandboxData makes count invoices dated in the days before day,
+// most with the payment that settles them: some a few days apart, some short
+// by a bank charge. A few payments come without an invoice and a few
+// invoices are not yet paid. The same day always generates the same
+// records, so instances resetting at once store the same data.
+func generateSandboxData(day time.Time, count int) ([]BankTransactionInput, []AccountingEntryInput) {
+	stamp := day.Format("20060102")
+	rng := rand.New(rand.NewSource(int64(day.Year()*10000 + int(day.Month())*100 + day.Day())))
+
+	ibans := make([]string, len(sandboxCustomers))
+	for i := range sandboxCustomers {
+		ibans[i] = banking.WithCheckDigits("DE", fmt.Sprintf("%08d%010d", 10020030+i, 4711+i*97))
+	}
+
+	transactions := make([]BankTransactionInput, 0, count)
+	entries := make([]AccountingEntryInput, 0, count+count/20)
+	for i := 1; i <= count; i++ {
+		customer := rng.Intn(len(sandboxCustomers))
+		invoice := fmt.Sprintf("INV-%s-%04d", stamp, i)
+		date := day.AddDate(0, 0, -1-rng.Intn(sandboxDays))
+		amount := money.Amount(5000 + rng.Int63n(2500000))
+
+		entry := AccountingEntryInput{
+			EntryID:          fmt.Sprintf("SBX-AE-%s-%04d", stamp, i),
+			AccountCode:      sandboxLedgerAccount,
+			Amount:           amount,
+			EntryDate:        date.Format("2006-01-02"),
+			Description:      "Invoice " + invoice + " " + sandboxCustomers[customer],
+			InvoiceNumber:    invoice,
+			CounterpartyIBAN: ibans[customer],
+		}
+		transaction := BankTransactionInput{
+			TransactionID:    fmt.Sprintf("SBX-BT-%s-%04d", stamp, i),
+			AccountNumber:    sandboxBankAccount,
+			Amount:           amount,
+			TransactionDate:  date.Format("2006-01-02"),
+			Description:      "Payment " + sandboxCustomers[customer] + " " + invoice,
+			ReferenceNumber:  invoice,
+			CounterpartyIBAN: ibans[customer],
+		}
+
+		switch roll := rng.Float64(); {
+		case roll < 0.78:
+			// Matches exactly
+		case roll < 0.88:
+			// Booked in the ledger a few days before the payment arrived
+			entry.EntryDate = date.AddDate(0, 0, -1-rng.Intn(3)).Format("2006-01-02")
+		case roll < 0.94:
+			// Paid short of a bank charge
+			transaction.Amount -= money.Amount(100 + rng.Int63n(2400))
+		case roll < 0.97:
+			// Paid without an invoice on the books
+			transaction.Description = "Payment " + sandboxCustomers[customer]
+			transaction.ReferenceNumber = ""
+			transactions = append(transactions, transaction)
+			continue
+		default:
+			// Invoiced and not yet paid
+			entries = append(entries, entry)
+			continue
+		}
+		transactions = append(transactions, transaction)
+		entries = append(entries, entry)
+	}
+	return transactions, entries
+}
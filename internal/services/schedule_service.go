@@ -0,0 +1,282 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/pagination"
+	"reconciliation-service/internal/repositories"
+	"reconciliation-service/internal/schedule"
+)
+
+// ErrInvalidSchedule wraps every rejection of schedule input
+var ErrInvalidSchedule = errors.New("invalid schedule")
+
+const (
+	defaultScheduleRunsLimit = 50
+	maxScheduleRunsLimit     = 500
+)
+
+var schedulePeriods = map[string]bool{
+	models.SchedulePeriodPreviousDay:  true,
+	models.SchedulePeriodPreviousWeek: true,
+}
+
+// ScheduleService starts reconciliations on cron schedules. Every instance
+// runs the scheduler; each firing is claimed by exactly one of them. A
+// firing missed while no instance was up runs once when one is back, not
+// once per missed occurrence.
+type ScheduleService struct {
+	scheduleRepo          repositories.ScheduleRepository
+	reconciliationService *ReconciliationService
+	jobService            *JobService
+	maintenanceService    *MaintenanceService
+}
+
+func NewScheduleService(
+	scheduleRepo repositories.ScheduleRepository,
+	reconciliationService *ReconciliationService,
+	jobService *JobService,
+	maintenanceService *MaintenanceService,
+) *ScheduleService {
+	return &ScheduleService{
+		scheduleRepo:          scheduleRepo,
+		reconciliationService: reconciliationService,
+		jobService:            jobService,
+		maintenanceService:    maintenanceService,
+	}
+}
+
+func (s *ScheduleService) CreateSchedule(sched *models.ReconciliationSchedule, userID string) (*models.ReconciliationSchedule, error) {
+	if err := s.prepare(sched, userID); err != nil {
+		return nil, err
+	}
+	if err := s.scheduleRepo.CreateSchedule(sched); err != nil {
+		return nil, err
+	}
+	return s.scheduleRepo.GetSchedule(sched.ID)
+}
+
+func (s *ScheduleService) GetSchedule(id int64) (*models.ReconciliationSchedule, error) {
+	return s.scheduleRepo.GetSchedule(id)
+}
+
+func (s *ScheduleService) ListSchedules() ([]*models.ReconciliationSchedule, error) {
+	return s.scheduleRepo.ListSchedules()
+}
+
+// UpdateSchedule replaces a schedule's settings. Its next run is worked out
+// afresh from the new expression.
+func (s *ScheduleService) UpdateSchedule(sched *models.ReconciliationSchedule, userID string) (*models.ReconciliationSchedule, error) {
+	if err := s.prepare(sched, userID); err != nil {
+		return nil, err
+	}
+	if err := s.scheduleRepo.UpdateSchedule(sched); err != nil {
+		return nil, err
+	}
+	return s.scheduleRepo.GetSchedule(sched.ID)
+}
+
+func (s *ScheduleService) DeleteSchedule(id int64) error {
+	return s.scheduleRepo.DeleteSchedule(id)
+}
+
+// scheduleRunsCursor names the schedule run lists in their cursors
+const scheduleRunsCursor = "schedule_runs"
+
+// ListRuns lists the latest firings of a schedule, newest first, from the
+// cursor a previous page returned, and the cursor of the next page
+func (s *ScheduleService) ListRuns(id int64, cursor string, limit int) ([]*models.ScheduleRun, string, error) {
+	if _, err := s.scheduleRepo.GetSchedule(id); err != nil {
+		return nil, "", err
+	}
+	switch {
+	case limit == 0:
+		limit = defaultScheduleRunsLimit
+	case limit < 0 || limit > maxScheduleRunsLimit:
+		return nil, "", fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidSchedule, maxScheduleRunsLimit)
+	}
+	after, err := pagination.Decode(cursor, scheduleRunsCursor)
+	if err != nil {
+		return nil, "", err
+	}
+	_, beforeID := after.Key()
+	runs, err := s.scheduleRepo.ListRuns(id, beforeID, limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	runs, next := pagination.Next(runs, limit, func(run *models.ScheduleRun) pagination.Cursor {
+		return pagination.Cursor{List: scheduleRunsCursor, ID: run.ID}
+	})
+	return runs, next, nil
+}
+
+// prepare validates a schedule and sets its next run
+func (s *ScheduleService) prepare(sched *models.ReconciliationSchedule, userID string) error {
+	sched.Name = strings.TrimSpace(sched.Name)
+	sched.CronExpression = strings.TrimSpace(sched.CronExpression)
+	sched.Period = strings.ToLower(strings.TrimSpace(sched.Period))
+	sched.Timezone = strings.TrimSpace(sched.Timezone)
+	sched.UpdatedBy = userID
+
+	if sched.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidSchedule)
+	}
+	if len(sched.Name) > 100 {
+		return fmt.Errorf("%w: name must be at most 100 characters", ErrInvalidSchedule)
+	}
+	if !schedulePeriods[sched.Period] {
+		return fmt.Errorf("%w: period must be previous_day or previous_week", ErrInvalidSchedule)
+	}
+	if sched.Timezone == "" {
+		sched.Timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(sched.Timezone)
+	if err != nil {
+		return fmt.Errorf("%w: unknown timezone %q", ErrInvalidSchedule, sched.Timezone)
+	}
+	expr, err := schedule.Parse(sched.CronExpression)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+	next := expr.Next(time.Now().In(loc))
+	if next.IsZero() {
+		return fmt.Errorf("%w: cron_expression never fires", ErrInvalidSchedule)
+	}
+	sched.NextRunAt = &next
+	return nil
+}
+
+// RunWorker starts the reconciliations of due schedules every pollInterval
+// until ctx is cancelled. Nothing is started during maintenance or shutdown;
+// the schedules stay due until then.
+func (s *ScheduleService) RunWorker(ctx context.Context, pollInterval time.Duration) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if !s.jobService.Draining() && !s.maintenanceService.Enabled() {
+			s.fireDue()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *ScheduleService) fireDue() {
+	now := time.Now()
+	due, err := s.scheduleRepo.ListDueSchedules(now)
+	if err != nil {
+		log.Printf("scheduler: failed to list due schedules: %v", err)
+		return
+	}
+
+	for _, sched := range due {
+		loc, err := time.LoadLocation(sched.Timezone)
+		if err != nil {
+			log.Printf("scheduler: schedule %d has unknown timezone %q", sched.ID, sched.Timezone)
+			continue
+		}
+		expr, err := schedule.Parse(sched.CronExpression)
+		if err != nil {
+			log.Printf("scheduler: schedule %d: %v", sched.ID, err)
+			continue
+		}
+
+		// The next run is worked out from now, so missed firings collapse
+		// into this one
+		next := expr.Next(now.In(loc))
+		claimed, err := s.scheduleRepo.ClaimSchedule(sched.ID, *sched.NextRunAt, next)
+		if err != nil {
+			log.Printf("scheduler: failed to claim schedule %d: %v", sched.ID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		fromDate, toDate := scheduledPeriod(sched.Period, sched.NextRunAt.In(loc))
+		run := &models.ScheduleRun{
+			ScheduleID:   sched.ID,
+			ScheduledFor: *sched.NextRunAt,
+			FromDate:     fromDate,
+			ToDate:       toDate,
+			Status:       models.ScheduleRunStatusRunning,
+		}
+		if err := s.scheduleRepo.CreateRun(run); err != nil {
+			log.Printf("scheduler: failed to record run of schedule %d: %v", sched.ID, err)
+			continue
+		}
+		go s.run(sched, run)
+	}
+}
+
+// run reconciles a firing's period under the same overlap guard as a run
+// started through the API. An overlapping run skips the firing.
+func (s *ScheduleService) run(sched *models.ReconciliationSchedule, run *models.ScheduleRun) {
+	log.Printf("Running schedule %q (%s..%s)", sched.Name, run.FromDate, run.ToDate)
+
+	var runErr error
+	defer func() {
+		now := time.Now()
+		run.FinishedAt = &now
+		if runErr != nil {
+			run.Error = runErr.Error()
+			if run.Status == models.ScheduleRunStatusRunning {
+				run.Status = models.ScheduleRunStatusFailed
+			}
+			log.Printf("Schedule %q %s: %v", sched.Name, run.Status, runErr)
+		} else {
+			run.Status = models.ScheduleRunStatusCompleted
+		}
+		if err := s.scheduleRepo.FinishRun(run); err != nil {
+			log.Printf("scheduler: failed to record completion of run %d: %v", run.ID, err)
+		}
+	}()
+
+	accounts, err := s.reconciliationService.AccountScope(run.FromDate, run.ToDate)
+	if err != nil {
+		runErr = err
+		return
+	}
+	job, err := s.jobService.BeginExclusive(models.JobTypeReconciliation, run.FromDate, run.ToDate, accounts)
+	if err != nil {
+		if errors.Is(err, ErrOverlappingRun) || errors.Is(err, ErrDraining) {
+			run.Status = models.ScheduleRunStatusSkipped
+		}
+		runErr = err
+		return
+	}
+	run.JobID = job.ID
+
+	result, err := s.reconciliationService.StartReconciliation(run.FromDate, run.ToDate, fmt.Sprintf("schedule:%d", sched.ID))
+	if err != nil {
+		s.jobService.Finish(job, "", err)
+		runErr = err
+		return
+	}
+	run.BatchID = result.BatchID
+	s.jobService.Finish(job, result.BatchID, nil)
+}
+
+// scheduledPeriod is the date range a firing at the given time reconciles:
+// the day before it, or the Monday to Sunday week before its week
+func scheduledPeriod(period string, firedAt time.Time) (string, string) {
+	day := time.Date(firedAt.Year(), firedAt.Month(), firedAt.Day(), 0, 0, 0, 0, time.UTC)
+	if period == models.SchedulePeriodPreviousWeek {
+		sinceMonday := (int(day.Weekday()) + 6) % 7
+		monday := day.AddDate(0, 0, -sinceMonday-7)
+		return monday.Format("2006-01-02"), monday.AddDate(0, 0, 6).Format("2006-01-02")
+	}
+	previous := day.AddDate(0, 0, -1)
+	return previous.Format("2006-01-02"), previous.Format("2006-01-02")
+}
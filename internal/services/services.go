@@ -0,0 +1,402 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+
+	"reconciliation-service/internal/auth"
+	"reconciliation-service/internal/config"
+	"reconciliation-service/internal/i18n"
+	"reconciliation-service/internal/kpi"
+	"reconciliation-service/internal/matching"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+	"reconciliation-service/internal/storage"
+)
+
+// Services is the wired service layer of one tenant, shared by the HTTP
+// router and the background workers started from main
+type Services struct {
+	// Tenant whose records the services read and write
+	Tenant         string
+	Reconciliation *ReconciliationService
+	DataIngestion  *DataIngestionService
+	Usage          *UsageService
+	Maintenance    *MaintenanceService
+	Jobs           *JobService
+	Partitions     *PartitionService
+	Queue          *QueueService
+	Snapshots      *SnapshotService
+	Reports        *ReportService
+	Locales        *i18n.Resolver
+	// Auth verifies bearer tokens; nil when authentication is off
+	Auth           *auth.Verifier
+	Calendars      *CalendarService
+	Notifications  *NotificationService
+	Counterparties *CounterpartyService
+	Aliases        *AliasService
+	Suggestions    *SuggestionService
+	Shadows        *ShadowService
+	RuleSets       *RuleSetService
+	ConfigBundles  *ConfigBundleService
+	Safety         *SafetyService
+	Access         *AccessService
+	FXRates        *FXRateService
+	RequestAudits  *RequestAuditService
+	Schedules      *ScheduleService
+	Exports        *ExportService
+	Artifacts      *ArtifactService
+	Retention      *RetentionService
+	LegalHolds     *LegalHoldService
+	Fees           *FeeService
+	Expectations   *ExpectationService
+	Returns        *ReturnService
+	Budgets        *BudgetService
+	PolicyPacks    *PolicyPackService
+	Exceptions     *ExceptionService
+	UnmatchedItems *UnmatchedItemService
+	Analytics      *AnalyticsService
+	Digests        *DigestService
+	Idempotency    *IdempotencyService
+	Streams        *StreamService
+	Integrity      *IntegrityService
+	Fetches        *StatementFetchService
+	ObjectFetches  *ObjectFetchService
+	Emails         *EmailIngestionService
+	Webhooks       *WebhookService
+	Anomalies      *IngestionAnomalyService
+	Fixtures       *FixtureService
+	Heartbeats     *HeartbeatService
+	// APIKeys are deployment-wide: a key names the tenant it acts for
+	APIKeys *APIKeyService
+	// Metrics reports the backlog of every tenant and is shared by all of
+	// them
+	Metrics *OperatorMetricsService
+	// Failover watches the primary database for every tenant
+	Failover *FailoverService
+	// Sandbox is set only in the sandbox tenant's services
+	Sandbox *SandboxService
+}
+
+// NewTenantServices wires the services of every configured tenant, or of
+// config.DefaultTenant alone when tenants are not isolated, and of the
+// sandbox when it is enabled
+func NewTenantServices(db *sql.DB, lanes IngestionLanes, cfg *config.Config, instanceID string) (map[string]*Services, error) {
+	tenants := cfg.Tenants.IDs
+	if !cfg.Tenants.Enabled() {
+		tenants = []string{config.DefaultTenant}
+	}
+	if cfg.Sandbox.Enabled() {
+		tenants = append(tenants[:len(tenants):len(tenants)], cfg.Sandbox.Tenant)
+	}
+	graphs := make(map[string]*Services, len(tenants))
+	for _, tenant := range tenants {
+		svc, err := NewServices(db, lanes, cfg, instanceID, tenant)
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s: %w", tenant, err)
+		}
+		graphs[tenant] = svc
+	}
+	operatorMetrics := NewOperatorMetricsService(graphs, cfg.Metrics.Token)
+	failover := NewFailoverService(db, cfg.GetReplicaDSN() != "", cfg.Failover)
+	for _, svc := range graphs {
+		svc.Metrics = operatorMetrics
+		svc.Failover = failover
+	}
+	return graphs, nil
+}
+
+// NewReplicaServices wires the services of every tenant again on the read
+// replica, to serve reads while the primary is unavailable. They share the
+// primary graphs' metrics and failover state and run no workers.
+func NewReplicaServices(replica *sql.DB, primary map[string]*Services, lanes IngestionLanes, cfg *config.Config, instanceID string) (map[string]*Services, error) {
+	graphs, err := NewTenantServices(replica, lanes, cfg, instanceID)
+	if err != nil {
+		return nil, err
+	}
+	for tenant, svc := range graphs {
+		svc.Metrics = primary[tenant].Metrics
+		svc.Failover = primary[tenant].Failover
+	}
+	return graphs, nil
+}
+
+// NewServices wires the services of one tenant on the repositories of db.
+// Expectations, returns, fees, budgets and shadow runs keep their records
+// deployment-wide, so only the primary tenant's reconciliations use them.
+func NewServices(db *sql.DB, lanes IngestionLanes, cfg *config.Config, instanceID, tenant string) (*Services, error) {
+	return NewServicesWithRepositories(db, repositories.New(db, tenant), lanes, cfg, instanceID, tenant)
+}
+
+// NewServicesWithRepositories wires the services of one tenant on repos,
+// which may hold fakes. db still carries the transactions that batches,
+// ingestion and integrity checks span across repositories.
+func NewServicesWithRepositories(db *sql.DB, repos *repositories.Repositories, lanes IngestionLanes, cfg *config.Config, instanceID, tenant string) (*Services, error) {
+	bankRepo := repos.Bank
+	accountingRepo := repos.Accounting
+	reconciliationRepo := repos.Reconciliation
+	usageRepo := repos.Usage
+	maintenanceRepo := repos.Maintenance
+	jobRepo := repos.Job
+	snapshotRepo := repos.Snapshot
+	reportRepo := repos.Report
+	calendarRepo := repos.Calendar
+	notificationRepo := repos.Notification
+	counterpartyRepo := repos.Counterparty
+	aliasRepo := repos.Alias
+	shadowRepo := repos.Shadow
+	ruleSetRepo := repos.RuleSet
+	safetyRepo := repos.Safety
+	userRepo := repos.User
+	fxRateRepo := repos.FXRate
+	requestAuditRepo := repos.RequestAudit
+	scheduleRepo := repos.Schedule
+	exportRepo := repos.Export
+	retentionRepo := repos.Retention
+	legalHoldRepo := repos.LegalHold
+	feeRepo := repos.Fee
+	expectationRepo := repos.Expectation
+	returnRepo := repos.Return
+	budgetRepo := repos.Budget
+	exceptionRepo := repos.Exception
+	analyticsRepo := repos.Analytics
+	idempotencyRepo := repos.Idempotency
+	integrityRepo := repos.Integrity
+	ingestionFileRepo := repos.IngestionFile
+	fixtureRepo := repos.Fixture
+	sandbox := cfg.Sandbox.Enabled() && tenant == cfg.Sandbox.Tenant
+
+	if _, err := matching.Pipeline(cfg.Matching.Strategies); err != nil {
+		return nil, fmt.Errorf("invalid MATCH_STRATEGIES: %w", err)
+	}
+	if err := matching.CheckNettingEntryTypes(cfg.Matching.NettingEntryTypes); err != nil {
+		return nil, fmt.Errorf("invalid MATCH_NETTING_ENTRY_TYPES: %w", err)
+	}
+	matchConfig := matching.Config{
+		CreditorReferenceMatching: cfg.Matching.CreditorReferenceMatching,
+		BaseCurrency:              cfg.Matching.BaseCurrency,
+		FXToleranceBasisPoints:    cfg.Matching.FXToleranceBasisPoints,
+		Strategies:                cfg.Matching.Strategies,
+		NettingEntryTypes:         cfg.Matching.NettingEntryTypes,
+		ReversalWindowDays:        cfg.Matching.ReversalWindowDays,
+	}
+	baseline := matching.DefaultRules()
+	if cfg.Matching.RulesFile != "" {
+		var err error
+		if baseline, err = applyRuleFile(cfg.Matching.RulesFile, &matchConfig); err != nil {
+			return nil, err
+		}
+	}
+
+	var kpis *kpi.File
+	if cfg.KPI.File != "" {
+		var err error
+		if kpis, err = kpi.LoadFile(cfg.KPI.File); err != nil {
+			return nil, err
+		}
+	}
+
+	calendarService := NewCalendarService(calendarRepo)
+	ruleSetService := NewRuleSetService(ruleSetRepo, baseline)
+	shadowService := NewShadowService(shadowRepo, ruleSetService)
+	fxRateService := NewFXRateService(fxRateRepo)
+	feeService := NewFeeService(feeRepo)
+	returnService := NewReturnService(returnRepo, cfg.Returns.Action)
+	budgetService := NewBudgetService(budgetRepo)
+	policyPackService := NewPolicyPackService(repos.PolicyPack)
+
+	// Reconciliations of other tenants leave out the deployment-wide features
+	optionalExpectations := expectationRepo
+	optionalShadows, optionalFees, optionalReturns, optionalBudgets := shadowService, feeService, returnService, budgetService
+	if tenant != cfg.Tenants.Primary() {
+		optionalExpectations = nil
+		optionalShadows, optionalFees, optionalReturns, optionalBudgets = nil, nil, nil, nil
+	}
+	learningCounterparties := counterpartyRepo
+	if sandbox {
+		learningCounterparties = sandboxCounterparties{counterpartyRepo}
+	}
+
+	// Initialize services
+	reconciliationService := NewReconciliationService(
+		db,
+		bankRepo,
+		accountingRepo,
+		reconciliationRepo,
+		learningCounterparties,
+		aliasRepo,
+		legalHoldRepo,
+		optionalExpectations,
+		matchConfig,
+		calendarService,
+		ruleSetService,
+		optionalShadows,
+		fxRateService,
+		optionalFees,
+		optionalReturns,
+		optionalBudgets,
+		policyPackService,
+		kpis,
+		cfg.Matching.Calendar,
+		cfg.Results.InlineLimit,
+		cfg.Matching.ReviewConfidence,
+		NewBatchIDGenerator(cfg.BatchIDs.Format),
+	)
+
+	dataIngestionService := NewDataIngestionService(
+		db,
+		bankRepo,
+		accountingRepo,
+		reconciliationRepo,
+		counterpartyRepo,
+		aliasRepo,
+		legalHoldRepo,
+		cfg.Matching.BaseCurrency,
+		lanes,
+	)
+
+	usageService := NewUsageService(usageRepo, models.APIQuota{
+		MaxRequests:     cfg.Quota.MonthlyRequests,
+		MaxRowsIngested: cfg.Quota.MonthlyRowsIngested,
+		MaxBatches:      cfg.Quota.MonthlyBatches,
+	})
+
+	maintenanceService := NewMaintenanceService(maintenanceRepo)
+
+	partitionService := NewPartitionService(
+		reconciliationService,
+		bankRepo,
+		accountingRepo,
+		jobRepo,
+		maintenanceService,
+		usageService,
+		instanceID,
+	)
+
+	jobService := NewJobService(jobRepo, instanceID)
+
+	queueService := NewQueueService(
+		reconciliationService,
+		jobService,
+		jobRepo,
+		maintenanceService,
+		usageService,
+		instanceID,
+		cfg.Queue.MaxConcurrentJobs,
+		cfg.Queue.TenantMaxConcurrentJobs,
+		cfg.Queue.TenantWeight(tenant),
+	)
+
+	notificationService := NewNotificationService(notificationRepo, cfg.I18n.DefaultLocale, cfg.Notification.DedupWindow)
+	counterpartyService := NewCounterpartyService(counterpartyRepo)
+	aliasService := NewAliasService(aliasRepo, bankRepo, accountingRepo)
+
+	configBundleService := NewConfigBundleService(
+		ruleSetService,
+		calendarService,
+		counterpartyService,
+		aliasService,
+		shadowService,
+		notificationService,
+	)
+
+	exportStore, err := storage.NewFileStore(cfg.Export.StorageDir)
+	if err != nil {
+		return nil, err
+	}
+	signingKey := cfg.Export.SigningKey
+	if signingKey == "" {
+		signingKey = cfg.Auth.JWTSecret
+	}
+	artifactKey := cfg.Artifacts.SigningKey
+	if artifactKey == "" {
+		artifactKey = signingKey
+	}
+	artifactService := NewArtifactService(repos.Artifact, tenant, artifactKey)
+	exportService := NewExportService(
+		exportRepo,
+		reconciliationService,
+		jobService,
+		maintenanceService,
+		exportStore,
+		NewExportLinks(signingKey, cfg.Export.LinkTTL, cfg.Export.PublicURL),
+		artifactService,
+		cfg.Export.AsyncRowThreshold,
+		instanceID,
+	)
+
+	// Sandbox callers hold a sandbox API key instead of a token; the tenant
+	// router authenticates it, and it acts with the role of any API key
+	var verifier *auth.Verifier
+	if cfg.Auth.JWTSecret != "" && !sandbox {
+		verifier = auth.NewVerifier(cfg.Auth.JWTSecret, cfg.Auth.JWTIssuer, cfg.Auth.JWTAudience, cfg.Auth.ClockSkew)
+	}
+
+	webhookService := NewWebhookService(repos.Webhook, jobService, maintenanceService, cfg.Webhooks)
+	anomalyService := NewIngestionAnomalyService(ingestionFileRepo, webhookService, jobService, maintenanceService, cfg.Anomalies)
+
+	keyTenants := cfg.Tenants.IDs
+	if !cfg.Tenants.Enabled() {
+		keyTenants = []string{config.DefaultTenant}
+	}
+
+	var sandboxService *SandboxService
+	if sandbox {
+		sandboxService = NewSandboxService(repos.Sandbox, dataIngestionService, jobService, maintenanceService, cfg.Sandbox)
+	}
+
+	return &Services{
+		Tenant:         tenant,
+		Reconciliation: reconciliationService,
+		DataIngestion:  dataIngestionService,
+		Usage:          usageService,
+		Maintenance:    maintenanceService,
+		Jobs:           jobService,
+		Partitions:     partitionService,
+		Queue:          queueService,
+		Snapshots:      NewSnapshotService(snapshotRepo, bankRepo, accountingRepo, exceptionRepo),
+		Reports:        NewReportService(reportRepo, reconciliationRepo, cfg.Export.Currency, tenant),
+		Locales:        i18n.NewResolver(cfg.I18n.DefaultLocale, i18n.ParseTenantLocales(cfg.I18n.TenantLocales)),
+		Auth:           verifier,
+		Calendars:      calendarService,
+		Notifications:  notificationService,
+		Counterparties: counterpartyService,
+		Aliases:        aliasService,
+		Suggestions:    NewSuggestionService(bankRepo, reconciliationRepo, counterpartyRepo, aliasRepo),
+		Shadows:        shadowService,
+		RuleSets:       ruleSetService,
+		ConfigBundles:  configBundleService,
+		Access:         NewAccessService(userRepo, cfg.Access.BootstrapAdmins),
+		Safety:         NewSafetyService(safetyRepo, cfg.Environment, cfg.Safety.ConfirmToken),
+		FXRates:        fxRateService,
+		RequestAudits:  NewRequestAuditService(requestAuditRepo, cfg.RequestAudit.Retention, cfg.RequestAudit.MaxPayload),
+		Schedules:      NewScheduleService(scheduleRepo, reconciliationService, jobService, maintenanceService),
+		Exports:        exportService,
+		Artifacts:      artifactService,
+		LegalHolds:     NewLegalHoldService(legalHoldRepo),
+		Retention:      NewRetentionService(retentionRepo, legalHoldRepo, exportRepo, exportStore, policyPackService, jobService, maintenanceService),
+		Fees:           feeService,
+		Expectations:   NewExpectationService(expectationRepo, jobService, maintenanceService),
+		Returns:        returnService,
+		Budgets:        budgetService,
+		PolicyPacks:    policyPackService,
+		Exceptions:     NewExceptionService(exceptionRepo, policyPackService, jobService, maintenanceService),
+		UnmatchedItems: NewUnmatchedItemService(repos.UnmatchedItem),
+		Analytics:      NewAnalyticsService(analyticsRepo, fxRateService, cfg.Matching.BaseCurrency),
+		Digests: NewDigestService(analyticsRepo, fxRateService, notificationService, jobService, maintenanceService,
+			tenant, cfg.Matching.BaseCurrency, cfg.Digest),
+		Idempotency: NewIdempotencyService(idempotencyRepo, cfg.Idempotency.KeyTTL),
+		Streams:     NewStreamService(dataIngestionService, jobService, maintenanceService, cfg.Kafka),
+		Integrity: NewIntegrityService(db, integrityRepo, reconciliationRepo, legalHoldRepo, reconciliationService,
+			jobService, maintenanceService, cfg.Matching.BaseCurrency),
+		Fetches:       NewStatementFetchService(dataIngestionService, jobService, maintenanceService, anomalyService, ingestionFileRepo, cfg.SFTP),
+		ObjectFetches: NewObjectFetchService(dataIngestionService, jobService, maintenanceService, anomalyService, ingestionFileRepo, cfg.S3),
+		Emails:        NewEmailIngestionService(dataIngestionService, jobService, maintenanceService, anomalyService, ingestionFileRepo, cfg.Email),
+		Webhooks:      webhookService,
+		Anomalies:     anomalyService,
+		Fixtures:      NewFixtureService(fixtureRepo, ruleSetService, dataIngestionService, cfg.Fixtures.ImportEnabled),
+		Heartbeats:    NewHeartbeatService(repos.Heartbeat, jobRepo, instanceID, cfg.Heartbeat),
+		APIKeys:       NewAPIKeyService(repos.APIKey, keyTenants, cfg.Tenants.Primary(), cfg.APIKeys),
+		Sandbox:       sandboxService,
+	}, nil
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+
+	"reconciliation-service/internal/matching"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+)
+
+// ErrInvalidShadowCandidate wraps every rejection of a candidate rule set
+var ErrInvalidShadowCandidate = errors.New("invalid shadow candidate")
+
+type ShadowService struct {
+	shadowRepo repositories.ShadowRepository
+	ruleSets   *RuleSetService
+}
+
+func NewShadowService(shadowRepo repositories.ShadowRepository, ruleSets *RuleSetService) *ShadowService {
+	return &ShadowService{
+		shadowRepo: shadowRepo,
+		ruleSets:   ruleSets,
+	}
+}
+
+// CreateCandidate stores a candidate rule set under version. rules may set
+// only the fields that differ from the active production rules; the stored
+// candidate holds the complete rule set. A new candidate is enabled.
+func (s *ShadowService) CreateCandidate(version string, rules json.RawMessage) (*models.ShadowCandidate, error) {
+	version = strings.TrimSpace(version)
+	base, err := s.ruleSets.ActiveRules()
+	if err != nil {
+		return nil, err
+	}
+	candidateRules, err := applyRules(base, version, rules)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidShadowCandidate, err)
+	}
+
+	encoded, err := json.Marshal(candidateRules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode rules: %v", err)
+	}
+	candidate := &models.ShadowCandidate{
+		Version: version,
+		Rules:   encoded,
+		Enabled: true,
+	}
+	if err := s.shadowRepo.CreateCandidate(candidate); err != nil {
+		if errors.Is(err, repositories.ErrShadowCandidateConflict) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to store shadow candidate: %v", err)
+	}
+	return candidate, nil
+}
+
+func (s *ShadowService) ListCandidates() ([]*models.ShadowCandidate, error) {
+	return s.shadowRepo.ListCandidates(false)
+}
+
+// SetCandidateEnabled pauses or resumes the shadow runs of a candidate,
+// keeping the runs it already made
+func (s *ShadowService) SetCandidateEnabled(version string, enabled bool) error {
+	return s.shadowRepo.SetCandidateEnabled(version, enabled)
+}
+
+// DeleteCandidate stops a candidate for good; its runs stay reported under
+// its version
+func (s *ShadowService) DeleteCandidate(version string) error {
+	return s.shadowRepo.DeleteCandidate(version)
+}
+
+func (s *ShadowService) GetShadowRuns(batchID string) ([]*models.ShadowRun, error) {
+	return s.shadowRepo.GetShadowRuns(batchID)
+}
+
+// GetShadowMatches lists a run's matches, only those with the given agreement
+// when it is not empty
+func (s *ShadowService) GetShadowMatches(runID int64, agreement string) ([]*models.ShadowMatch, error) {
+	return s.shadowRepo.GetShadowMatches(runID, agreement)
+}
+
+// Evaluate runs every enabled candidate on the inputs of a batch with the
+// batch's matching config, swapping in only the candidate's rules, and stores
+// how its matches compare to the ones the batch kept. Candidates are
+// independent: a failing one is logged and the others still run.
+func (s *ShadowService) Evaluate(batchID string, config matching.Config, bankTransactions []*models.BankTransaction, accountingEntries []*models.AccountingEntry, production []*matching.MatchResult) {
+	candidates, err := s.shadowRepo.ListCandidates(true)
+	if err != nil {
+		log.Printf("failed to load shadow candidates for batch %s: %v", batchID, err)
+		return
+	}
+
+	for _, candidate := range candidates {
+		if err := s.evaluateCandidate(batchID, candidate, config, bankTransactions, accountingEntries, production); err != nil {
+			log.Printf("shadow candidate %s failed on batch %s: %v", candidate.Version, batchID, err)
+		}
+	}
+}
+
+func (s *ShadowService) evaluateCandidate(batchID string, candidate *models.ShadowCandidate, config matching.Config, bankTransactions []*models.BankTransaction, accountingEntries []*models.AccountingEntry, production []*matching.MatchResult) error {
+	var rules matching.Rules
+	if err := json.Unmarshal(candidate.Rules, &rules); err != nil {
+		return fmt.Errorf("failed to decode rules: %v", err)
+	}
+	config.Rules = rules
+
+	engine := matching.NewMatchEngine(config)
+	engine.SetData(bankTransactions, accountingEntries)
+	shadow, err := engine.ProcessMatches()
+	if err != nil {
+		return fmt.Errorf("failed to process matches: %v", err)
+	}
+
+	run, matches := compareShadow(production, shadow)
+	run.BatchID = batchID
+	run.CandidateVersion = candidate.Version
+	run.Rules = candidate.Rules
+	return s.shadowRepo.CreateShadowRun(run, matches)
+}
+
+// compareShadow counts how the shadow matches agree with production. Two
+// matches agree when they pair exactly the same records; an agreed match
+// with a different confidence still agrees but is counted as changed.
+func compareShadow(production, shadow []*matching.MatchResult) (*models.ShadowRun, []*models.ShadowMatch) {
+	productionConfidence := make(map[string]float64, len(production))
+	for _, match := range production {
+		productionConfidence[matchKey(match)] = match.Confidence
+	}
+
+	run := &models.ShadowRun{
+		ProductionMatches: len(production),
+		ShadowMatches:     len(shadow),
+	}
+	matches := make([]*models.ShadowMatch, 0, len(shadow))
+	for _, match := range shadow {
+		shadowMatch := &models.ShadowMatch{
+			MatchType:        match.Type,
+			Confidence:       match.Confidence,
+			AmountDifference: match.AmountDifference,
+			MatchCriteria:    match.MatchCriteria,
+			Agreement:        models.ShadowAgreementShadowOnly,
+		}
+		for _, bt := range match.AllBankTransactions() {
+			shadowMatch.BankTransactionIDs = append(shadowMatch.BankTransactionIDs, bt.ID)
+		}
+		for _, ae := range match.AccountingEntries {
+			shadowMatch.AccountingEntryIDs = append(shadowMatch.AccountingEntryIDs, ae.ID)
+		}
+
+		if confidence, ok := productionConfidence[matchKey(match)]; ok {
+			shadowMatch.Agreement = models.ShadowAgreementAgreed
+			run.Agreed++
+			if math.Abs(confidence-match.Confidence) >= 0.005 {
+				run.ConfidenceChanged++
+			}
+		} else {
+			run.ShadowOnly++
+		}
+		matches = append(matches, shadowMatch)
+	}
+	run.ProductionOnly = run.ProductionMatches - run.Agreed
+
+	// Share of all distinct matches both sides made; two empty sides agree
+	if total := run.Agreed + run.ProductionOnly + run.ShadowOnly; total > 0 {
+		run.AgreementRate = math.Round(float64(run.Agreed)/float64(total)*10000) / 10000
+	} else {
+		run.AgreementRate = 1
+	}
+	return run, matches
+}
+
+// matchKey identifies a match by the records it pairs, whatever its type
+func matchKey(match *matching.MatchResult) string {
+	var bankIDs, entryIDs []int64
+	for _, bt := range match.AllBankTransactions() {
+		bankIDs = append(bankIDs, bt.ID)
+	}
+	for _, ae := range match.AccountingEntries {
+		entryIDs = append(entryIDs, ae.ID)
+	}
+	sort.Slice(bankIDs, func(i, j int) bool { return bankIDs[i] < bankIDs[j] })
+	sort.Slice(entryIDs, func(i, j int) bool { return entryIDs[i] < entryIDs[j] })
+	return fmt.Sprintf("%v|%v", bankIDs, entryIDs)
+}
@@ -0,0 +1,306 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/money"
+	"reconciliation-service/internal/pdf"
+)
+
+var (
+	// ErrInvalidJournalFormat rejects a journal format other than CSV or PDF
+	ErrInvalidJournalFormat = errors.New("format must be csv or pdf")
+
+	// ErrJournalTampered answers a stored journal that no longer matches its
+	// checksum
+	ErrJournalTampered = errors.New("stored journal does not match its checksum")
+)
+
+const JournalFormatPDF = "pdf"
+
+// Reason codes of the differences journal, from which side the record is
+// missing its counterpart and whether it was written off
+const (
+	JournalReasonBankNotInLedger  = "BNL"
+	JournalReasonLedgerNotInBank  = "LNB"
+	JournalReasonBankWrittenOff   = "WOB"
+	JournalReasonLedgerWrittenOff = "WOL"
+)
+
+// journalNotRaised is the exception status of a record no exception was
+// raised for yet
+const journalNotRaised = "not_raised"
+
+// journalReasons describes the reason codes in the PDF legend
+var journalReasons = []struct{ code, description string }{
+	{JournalReasonBankNotInLedger, "Bank transaction without a ledger entry"},
+	{JournalReasonLedgerNotInBank, "Ledger entry without a bank transaction"},
+	{JournalReasonBankWrittenOff, "Bank transaction written off"},
+	{JournalReasonLedgerWrittenOff, "Ledger entry written off"},
+}
+
+// JournalColumns are the columns of a differences journal CSV, in order
+var JournalColumns = []string{
+	"section", "reason_code", "record_type", "reference", "account", "record_date", "amount", "currency",
+	"age_days", "age_bucket", "exception_status", "owner", "comment",
+}
+
+// JournalContentType is the media type of a differences journal format
+func JournalContentType(format string) string {
+	if format == JournalFormatPDF {
+		return "application/pdf"
+	}
+	return "text/csv"
+}
+
+// JournalFilename names the file a differences journal is downloaded as
+func JournalFilename(snapshotID, format string) string {
+	return fmt.Sprintf("differences-journal-%s.%s", snapshotID, format)
+}
+
+// GetJournal returns a snapshot's differences journal in the given format,
+// after checking it against its stored checksum
+func (s *SnapshotService) GetJournal(snapshotID, format string) ([]byte, error) {
+	if format != ReportFormatCSV && format != JournalFormatPDF {
+		return nil, ErrInvalidJournalFormat
+	}
+	journal, err := s.snapshotRepo.GetJournal(snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	content, checksum := journal.CSV, journal.CSVChecksum
+	if format == JournalFormatPDF {
+		content, checksum = journal.PDF, journal.PDFChecksum
+	}
+	if journalChecksum(content) != checksum {
+		return nil, ErrJournalTampered
+	}
+	return content, nil
+}
+
+// buildJournal lists the unmatched records of a snapshot with the exception
+// raised for each, aged at the end of the period: first those still open,
+// then those written off, each oldest first
+func (s *SnapshotService) buildJournal(snapshot *models.ReconciliationSnapshot, items snapshotItems) (*models.SnapshotJournal, error) {
+	exceptions, err := s.exceptionRepo.ListForPeriod(snapshot.PeriodFrom, snapshot.PeriodTo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect exceptions: %v", err)
+	}
+	type recordKey struct {
+		recordType string
+		recordID   int64
+	}
+	byRecord := make(map[recordKey]*models.ReconciliationException, len(exceptions))
+	for _, exception := range exceptions {
+		byRecord[recordKey{exception.RecordType, exception.RecordID}] = exception
+	}
+
+	periodEnd, err := time.Parse("2006-01-02", snapshot.PeriodTo)
+	if err != nil {
+		return nil, fmt.Errorf("invalid period end: %v", err)
+	}
+
+	lines := make([]*models.JournalLine, 0, len(items.UnmatchedBank)+len(items.UnmatchedAccounting))
+	addLine := func(recordType string, recordID int64, line *models.JournalLine) error {
+		line.RecordType = recordType
+		line.Section = models.JournalSectionUnmatched
+		line.ExceptionStatus = journalNotRaised
+		if recordType == models.ExceptionRecordBankTransaction {
+			line.ReasonCode = JournalReasonBankNotInLedger
+		} else {
+			line.ReasonCode = JournalReasonLedgerNotInBank
+		}
+
+		if exception := byRecord[recordKey{recordType, recordID}]; exception != nil {
+			line.ExceptionStatus = exception.Status
+			line.Owner = exception.Owner
+			if exception.Status == models.ExceptionStatusWrittenOff {
+				line.Section = models.JournalSectionWrittenOff
+				if recordType == models.ExceptionRecordBankTransaction {
+					line.ReasonCode = JournalReasonBankWrittenOff
+				} else {
+					line.ReasonCode = JournalReasonLedgerWrittenOff
+				}
+				comment, err := s.writeOffComment(exception.ID)
+				if err != nil {
+					return err
+				}
+				line.Comment = comment
+			}
+		}
+
+		if date, err := time.Parse("2006-01-02", dateOnly(line.RecordDate)); err == nil {
+			line.RecordDate = date.Format("2006-01-02")
+			line.AgeDays = int(periodEnd.Sub(date).Hours() / 24)
+			for _, bucket := range unmatchedAgeBuckets {
+				if line.AgeDays >= bucket.minDays && (bucket.maxDays == 0 || line.AgeDays <= bucket.maxDays) {
+					line.AgeBucket = bucket.name
+					break
+				}
+			}
+		}
+		lines = append(lines, line)
+		return nil
+	}
+	for _, bt := range items.UnmatchedBank {
+		if err := addLine(models.ExceptionRecordBankTransaction, bt.ID, &models.JournalLine{
+			Reference:  bt.TransactionID,
+			Account:    bt.AccountNumber,
+			RecordDate: bt.TransactionDate,
+			Amount:     bt.Amount,
+			Currency:   bt.Currency,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	for _, ae := range items.UnmatchedAccounting {
+		if err := addLine(models.ExceptionRecordAccountingEntry, ae.ID, &models.JournalLine{
+			Reference:  ae.EntryID,
+			Account:    ae.AccountCode,
+			RecordDate: ae.EntryDate,
+			Amount:     ae.Amount,
+			Currency:   ae.Currency,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(lines, func(i, j int) bool {
+		a, b := lines[i], lines[j]
+		if a.Section != b.Section {
+			return a.Section == models.JournalSectionUnmatched
+		}
+		if a.RecordDate != b.RecordDate {
+			return a.RecordDate < b.RecordDate
+		}
+		if a.RecordType != b.RecordType {
+			return a.RecordType < b.RecordType
+		}
+		return a.Reference < b.Reference
+	})
+
+	csvContent, err := journalCSV(lines)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write differences journal: %v", err)
+	}
+	pdfContent := journalPDF(snapshot, lines)
+	return &models.SnapshotJournal{
+		SnapshotID:  snapshot.SnapshotID,
+		LineCount:   len(lines),
+		CSV:         csvContent,
+		CSVChecksum: journalChecksum(csvContent),
+		PDF:         pdfContent,
+		PDFChecksum: journalChecksum(pdfContent),
+	}, nil
+}
+
+// writeOffComment returns the comment given when an exception was written off
+func (s *SnapshotService) writeOffComment(exceptionID int64) (string, error) {
+	events, err := s.exceptionRepo.GetEvents(exceptionID)
+	if err != nil {
+		return "", fmt.Errorf("failed to collect exception events: %v", err)
+	}
+	comment := ""
+	for _, event := range events {
+		if event.Action == models.ExceptionEventTransitioned && event.StatusAfter == models.ExceptionStatusWrittenOff {
+			comment = event.Comment
+		}
+	}
+	return comment, nil
+}
+
+func journalCSV(lines []*models.JournalLine) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	if err := writer.Write(JournalColumns); err != nil {
+		return nil, err
+	}
+	for _, line := range lines {
+		if err := writer.Write([]string{
+			line.Section, line.ReasonCode, line.RecordType, line.Reference, line.Account, line.RecordDate,
+			line.Amount.String(), line.Currency, strconv.Itoa(line.AgeDays), line.AgeBucket,
+			line.ExceptionStatus, line.Owner, line.Comment,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+// journalRow lays out a line of the PDF table in fixed-width columns
+func journalRow(code, recordType, reference, account, date, amount, currency, age, bucket, status, owner, comment string) string {
+	return fmt.Sprintf("%-4.4s %-7.7s %-24.24s %-16.16s %-10.10s %16.16s %-3.3s %5.5s %-6.6s %-13.13s %-16.16s %s",
+		code, recordType, reference, account, date, amount, currency, age, bucket, status, owner, comment)
+}
+
+func journalPDF(snapshot *models.ReconciliationSnapshot, lines []*models.JournalLine) []byte {
+	doc := pdf.New("Differences journal " + snapshot.SnapshotID)
+	doc.SetHeader(
+		fmt.Sprintf("DIFFERENCES JOURNAL   Snapshot %s   Period %s to %s   Taken %s by %s",
+			snapshot.SnapshotID, snapshot.PeriodFrom, snapshot.PeriodTo,
+			snapshot.CreatedAt.UTC().Format("2006-01-02 15:04 UTC"), snapshot.CreatedBy),
+		"Snapshot checksum "+snapshot.Checksum,
+		"",
+		journalRow("Code", "Record", "Reference", "Account", "Date", "Amount", "Cur", "Age", "Bucket", "Exception", "Owner", "Comment"),
+		strings.Repeat("-", pdf.Columns),
+	)
+
+	for _, section := range []struct{ name, title string }{
+		{models.JournalSectionUnmatched, "UNMATCHED AT PERIOD END"},
+		{models.JournalSectionWrittenOff, "WRITTEN OFF"},
+	} {
+		doc.Line(section.title)
+		count := 0
+		totals := make(map[string]money.Amount)
+		for _, line := range lines {
+			if line.Section != section.name {
+				continue
+			}
+			recordType := "bank"
+			if line.RecordType == models.ExceptionRecordAccountingEntry {
+				recordType = "ledger"
+			}
+			doc.Line(journalRow(line.ReasonCode, recordType, line.Reference, line.Account, line.RecordDate,
+				line.Amount.String(), line.Currency, strconv.Itoa(line.AgeDays), line.AgeBucket,
+				line.ExceptionStatus, line.Owner, line.Comment))
+			count++
+			totals[line.Currency] += line.Amount
+		}
+		if count == 0 {
+			doc.Line("  None")
+		}
+		currencies := make([]string, 0, len(totals))
+		for currency := range totals {
+			currencies = append(currencies, currency)
+		}
+		sort.Strings(currencies)
+		for _, currency := range currencies {
+			doc.Line(journalRow("", "", "Total", "", "", totals[currency].String(), currency, "", "", "", "", ""))
+		}
+		doc.Line(fmt.Sprintf("  %d items", count))
+		doc.Line("")
+	}
+
+	doc.Line("REASON CODES")
+	for _, reason := range journalReasons {
+		doc.Line(fmt.Sprintf("  %-4s %s", reason.code, reason.description))
+	}
+	doc.Line("")
+	doc.Line("Age is counted in days from the record date to the end of the period.")
+	return doc.Bytes()
+}
+
+func journalChecksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/money"
+	"reconciliation-service/internal/repositories"
+)
+
+type SnapshotService struct {
+	snapshotRepo   repositories.SnapshotRepository
+	bankRepo       repositories.BankRepository
+	accountingRepo repositories.AccountingRepository
+	exceptionRepo  repositories.ExceptionRepository
+}
+
+func NewSnapshotService(
+	snapshotRepo repositories.SnapshotRepository,
+	bankRepo repositories.BankRepository,
+	accountingRepo repositories.AccountingRepository,
+	exceptionRepo repositories.ExceptionRepository,
+) *SnapshotService {
+	return &SnapshotService{
+		snapshotRepo:   snapshotRepo,
+		bankRepo:       bankRepo,
+		accountingRepo: accountingRepo,
+		exceptionRepo:  exceptionRepo,
+	}
+}
+
+type snapshotTotal struct {
+	Count  int          `json:"count"`
+	Amount money.Amount `json:"amount"`
+}
+
+type snapshotSummary struct {
+	MatchedBank         snapshotTotal `json:"matched_bank"`
+	MatchedAccounting   snapshotTotal `json:"matched_accounting"`
+	UnmatchedBank       snapshotTotal `json:"unmatched_bank"`
+	UnmatchedAccounting snapshotTotal `json:"unmatched_accounting"`
+	Reconciliations     int           `json:"reconciliations"`
+}
+
+type snapshotItems struct {
+	Matched             []models.SnapshotMatchedItem `json:"matched"`
+	UnmatchedBank       []*models.BankTransaction    `json:"unmatched_bank"`
+	UnmatchedAccounting []*models.AccountingEntry    `json:"unmatched_accounting"`
+}
+
+// CreateSnapshot freezes the current reconciliation state of a period. The
+// stored checksum covers summary and items so later tampering is detectable.
+// The differences journal of the period is stored along with it.
+func (s *SnapshotService) CreateSnapshot(fromDate, toDate, label, createdBy string) (*models.ReconciliationSnapshot, error) {
+	matched, err := s.snapshotRepo.GetMatchedItems(fromDate, toDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect matched items: %v", err)
+	}
+	unmatchedBank, err := s.bankRepo.GetUnreconciledTransactions(context.Background(), fromDate, toDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect unmatched bank transactions: %v", err)
+	}
+	unmatchedAccounting, err := s.accountingRepo.GetUnreconciledEntries(context.Background(), fromDate, toDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect unmatched accounting entries: %v", err)
+	}
+
+	var summary snapshotSummary
+	seenBank := make(map[string]bool)
+	seenAccounting := make(map[string]bool)
+	seenReconciliation := make(map[int64]bool)
+	for _, item := range matched {
+		if !seenBank[item.BankTransactionID] {
+			seenBank[item.BankTransactionID] = true
+			summary.MatchedBank.Count++
+			summary.MatchedBank.Amount += item.BankAmount
+		}
+		if item.AccountingEntryID != "" && !seenAccounting[item.AccountingEntryID] {
+			seenAccounting[item.AccountingEntryID] = true
+			summary.MatchedAccounting.Count++
+			summary.MatchedAccounting.Amount += item.AccountingAmount
+		}
+		seenReconciliation[item.ReconciliationID] = true
+	}
+	summary.Reconciliations = len(seenReconciliation)
+	for _, bt := range unmatchedBank {
+		summary.UnmatchedBank.Count++
+		summary.UnmatchedBank.Amount += bt.Amount
+	}
+	for _, ae := range unmatchedAccounting {
+		summary.UnmatchedAccounting.Count++
+		summary.UnmatchedAccounting.Amount += ae.Amount
+	}
+
+	summaryJSON, err := json.Marshal(summary)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode snapshot summary: %v", err)
+	}
+	items := snapshotItems{
+		Matched:             matched,
+		UnmatchedBank:       unmatchedBank,
+		UnmatchedAccounting: unmatchedAccounting,
+	}
+	itemsJSON, err := json.Marshal(items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode snapshot items: %v", err)
+	}
+
+	snapshot := &models.ReconciliationSnapshot{
+		SnapshotID: newSnapshotID(),
+		PeriodFrom: fromDate,
+		PeriodTo:   toDate,
+		Label:      label,
+		CreatedBy:  createdBy,
+		Summary:    summaryJSON,
+		Items:      itemsJSON,
+		Checksum:   snapshotChecksum(summaryJSON, itemsJSON),
+		CreatedAt:  time.Now(),
+	}
+	journal, err := s.buildJournal(snapshot, items)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.snapshotRepo.CreateSnapshot(snapshot, journal); err != nil {
+		return nil, fmt.Errorf("failed to store snapshot: %v", err)
+	}
+	return snapshot, nil
+}
+
+func (s *SnapshotService) GetSnapshot(snapshotID string) (*models.ReconciliationSnapshot, error) {
+	return s.snapshotRepo.GetSnapshotBySnapshotID(snapshotID)
+}
+
+func (s *SnapshotService) ListSnapshots(fromDate, toDate string) ([]*models.ReconciliationSnapshot, error) {
+	return s.snapshotRepo.ListSnapshots(fromDate, toDate)
+}
+
+func newSnapshotID() string {
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+	return fmt.Sprintf("SNAP-%s-%s", time.Now().Format("20060102-150405"), hex.EncodeToString(suffix))
+}
+
+func snapshotChecksum(summary, items []byte) string {
+	h := sha256.New()
+	h.Write(summary)
+	h.Write(items)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+
+	"reconciliation-service/internal/config"
+	"reconciliation-service/internal/database"
+	"reconciliation-service/internal/money"
+)
+
+// newSQLiteServices builds the services of the primary tenant on a migrated
+// in-memory SQLite database
+func newSQLiteServices(t *testing.T) *Services {
+	t.Helper()
+	cfg := &config.Config{
+		Database:  config.DatabaseConfig{Driver: config.DriverSQLite, Name: config.SQLiteMemory},
+		Migration: config.MigrationConfig{Dir: "../../migrations"},
+		Matching:  config.MatchingConfig{BaseCurrency: "USD", CreditorReferenceMatching: true, ReversalWindowDays: 5},
+		Export:    config.ExportConfig{StorageDir: t.TempDir()},
+		Results:   config.ResultsConfig{InlineLimit: 100},
+		Returns:   config.ReturnsConfig{Action: ReturnsActionUnmatch},
+		I18n:      config.I18nConfig{DefaultLocale: "en"},
+	}
+
+	db, err := database.NewConnection(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	m, err := database.NewMigration(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		t.Fatalf("migrating: %v", err)
+	}
+	m.Close()
+
+	lanes := IngestionLanes{Realtime: db, Bulk: db, RealtimeMaxRecords: 100, BulkChunkSize: 100}
+	svc, err := NewServices(db, lanes, cfg, "test-instance", cfg.Tenants.Primary())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return svc
+}
+
+func TestSQLiteIngestAndReconcile(t *testing.T) {
+	svc := newSQLiteServices(t)
+	amount := func(value string) money.Amount {
+		a, err := money.Parse(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+
+	bank, err := svc.DataIngestion.IngestBankTransactions(IngestionLaneRealtime, []BankTransactionInput{
+		{TransactionID: "BT-1", AccountNumber: "NL01BANK0001", Amount: amount("100.00"), TransactionDate: "2024-01-15", ReferenceNumber: "INV-1"},
+		{TransactionID: "BT-2", AccountNumber: "NL01BANK0001", Amount: amount("250.50"), TransactionDate: "2024-01-16", ReferenceNumber: "INV-2"},
+		{TransactionID: "BT-3", AccountNumber: "NL01BANK0001", Amount: amount("75.00"), TransactionDate: "2024-01-17"},
+	}, nil, false)
+	if err != nil {
+		t.Fatalf("ingesting bank transactions: %v", err)
+	}
+	if !bank.Success || bank.RecordsCount != 3 {
+		t.Fatalf("bank ingestion = %+v, want 3 records stored", bank)
+	}
+
+	entries, err := svc.DataIngestion.IngestAccountingEntries(IngestionLaneRealtime, []AccountingEntryInput{
+		{EntryID: "AE-1", AccountCode: "1100", Amount: amount("100.00"), EntryDate: "2024-01-15", InvoiceNumber: "INV-1"},
+		{EntryID: "AE-2", AccountCode: "1100", Amount: amount("250.50"), EntryDate: "2024-01-16", InvoiceNumber: "INV-2"},
+	}, false)
+	if err != nil {
+		t.Fatalf("ingesting accounting entries: %v", err)
+	}
+	if !entries.Success || entries.RecordsCount != 2 {
+		t.Fatalf("accounting ingestion = %+v, want 2 records stored", entries)
+	}
+
+	result, err := svc.Reconciliation.StartReconciliation("2024-01-01", "2024-01-31", "tester")
+	if err != nil {
+		t.Fatalf("reconciling: %v", err)
+	}
+	matched := map[string]string{}
+	for _, match := range result.Matches {
+		matched[match.BankTransaction] = match.AccountingEntry
+	}
+	want := map[string]string{"BT-1": "[AE-1]", "BT-2": "[AE-2]"}
+	if len(matched) != len(want) {
+		t.Fatalf("matches = %v, want %v", matched, want)
+	}
+	for bt, ae := range want {
+		if matched[bt] != ae {
+			t.Errorf("%s matched %q, want %s", bt, matched[bt], ae)
+		}
+	}
+
+	// The batch is stored: reading it back finds the reconciled records gone
+	// from the unreconciled ones
+	stored, err := svc.Reconciliation.GetReconciliationStatus(context.Background(), result.BatchID)
+	if err != nil {
+		t.Fatalf("reading back batch %s: %v", result.BatchID, err)
+	}
+	if stored.BatchID != result.BatchID {
+		t.Errorf("stored batch = %s, want %s", stored.BatchID, result.BatchID)
+	}
+	left, err := svc.Reconciliation.GetBankTransactions(context.Background(), "2024-01-01", "2024-01-31")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 1 || left[0].TransactionID != "BT-3" {
+		t.Errorf("unreconciled bank transactions = %v, want only BT-3", left)
+	}
+}
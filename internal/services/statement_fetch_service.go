@@ -0,0 +1,438 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"reconciliation-service/internal/config"
+	"reconciliation-service/internal/ingestion/charset"
+	"reconciliation-service/internal/ingestion/detect"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/pagination"
+	"reconciliation-service/internal/repositories"
+)
+
+var (
+	// ErrInvalidIngestionFiles wraps every rejection of an ingestion file query
+	ErrInvalidIngestionFiles = errors.New("invalid ingestion file query")
+
+	// ErrFetchRunning refuses a fetch while this instance is already fetching
+	ErrFetchRunning = errors.New("statement fetch is already running")
+
+	// ErrFetchDisabled refuses a fetch when no SFTP server is configured
+	ErrFetchDisabled = errors.New("statement fetch is not configured")
+)
+
+const (
+	// A claimed file not finished within this was left behind by an instance
+	// that stopped, and is fetched again
+	ingestionFileStaleAfter = time.Hour
+	sftpDialTimeout         = 30 * time.Second
+
+	defaultIngestionFilesLimit = 50
+	maxIngestionFilesLimit     = 500
+
+	// ingestionFilesCursor names the ingestion file list in its page cursors
+	ingestionFilesCursor = "ingestion_files"
+)
+
+// FetchResult counts what a fetch did with the files it found
+type FetchResult struct {
+	TriggeredBy string `json:"triggered_by"`
+	Ingested    int    `json:"ingested"`
+	Rejected    int    `json:"rejected"`
+	Failed      int    `json:"failed"`
+	// Files whose content was fetched before, archived or set aside again
+	// without ingesting them
+	Duplicates int `json:"duplicates"`
+	// Files still being uploaded or claimed by another instance, left for
+	// the next fetch
+	Skipped int      `json:"skipped"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+// StatementFetchService fetches statement files banks drop on an SFTP server.
+// Each configured directory is polled for files, which are ingested like an
+// upload to /bank-statements: every transaction is stored or none is. An
+// ingested file is moved to the archive directory; one that is not an
+// ingestible statement, or whose transactions fail validation, is moved to
+// the rejected directory. A file that failed for a reason that may pass is
+// left in place and fetched again.
+//
+// Files are recorded by the checksum of their content, so a file dropped
+// twice, or fetched by two instances at once, is ingested once.
+type StatementFetchService struct {
+	dataIngestionService *DataIngestionService
+	jobService           *JobService
+	maintenanceService   *MaintenanceService
+	anomalyService       *IngestionAnomalyService
+	fileRepo             repositories.IngestionFileRepository
+	config               config.SFTPConfig
+	// running keeps fetches of this instance from overlapping
+	running sync.Mutex
+}
+
+func NewStatementFetchService(dataIngestionService *DataIngestionService, jobService *JobService, maintenanceService *MaintenanceService, anomalyService *IngestionAnomalyService, fileRepo repositories.IngestionFileRepository, cfg config.SFTPConfig) *StatementFetchService {
+	return &StatementFetchService{
+		dataIngestionService: dataIngestionService,
+		jobService:           jobService,
+		maintenanceService:   maintenanceService,
+		anomalyService:       anomalyService,
+		fileRepo:             fileRepo,
+		config:               cfg,
+	}
+}
+
+// ListFiles lists fetched files newest first, optionally of one status, from
+// the cursor a previous page returned, and the cursor of the next page
+func (s *StatementFetchService) ListFiles(status, cursor string, limit int) ([]*models.IngestionFile, string, error) {
+	status = strings.ToLower(strings.TrimSpace(status))
+	switch status {
+	case "", models.IngestionFileProcessing, models.IngestionFileIngested, models.IngestionFileFailed, models.IngestionFileRejected:
+	default:
+		return nil, "", fmt.Errorf("%w: unknown status %q", ErrInvalidIngestionFiles, status)
+	}
+	switch {
+	case limit == 0:
+		limit = defaultIngestionFilesLimit
+	case limit < 0 || limit > maxIngestionFilesLimit:
+		return nil, "", fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidIngestionFiles, maxIngestionFilesLimit)
+	}
+	after, err := pagination.Decode(cursor, ingestionFilesCursor)
+	if err != nil {
+		return nil, "", err
+	}
+	_, beforeID := after.Key()
+	files, err := s.fileRepo.ListFiles(status, beforeID, limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	files, next := pagination.Next(files, limit, func(file *models.IngestionFile) pagination.Cursor {
+		return pagination.Cursor{List: ingestionFilesCursor, ID: file.ID}
+	})
+	return files, next, nil
+}
+
+// RunFetcher fetches statement files every interval until ctx is cancelled.
+// Nothing is fetched while the service drains or is in maintenance.
+func (s *StatementFetchService) RunFetcher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if !s.jobService.Draining() && !s.maintenanceService.Enabled() {
+			s.logFetch()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *StatementFetchService) logFetch() {
+	result, err := s.Fetch("fetcher")
+	if errors.Is(err, ErrFetchRunning) {
+		return
+	}
+	if err != nil {
+		log.Printf("sftp: %v", err)
+		return
+	}
+	for _, failure := range result.Errors {
+		log.Printf("sftp: %s", failure)
+	}
+	if result.Ingested > 0 || result.Rejected > 0 || result.Failed > 0 || result.Duplicates > 0 {
+		log.Printf("sftp: ingested %d files, rejected %d, failed %d and set aside %d duplicates",
+			result.Ingested, result.Rejected, result.Failed, result.Duplicates)
+	}
+}
+
+// Fetch polls every configured directory once. An error is returned only
+// when the server cannot be reached; what went wrong with single files or
+// directories is reported in the result.
+func (s *StatementFetchService) Fetch(triggeredBy string) (*FetchResult, error) {
+	if !s.config.Enabled() {
+		return nil, ErrFetchDisabled
+	}
+	if !s.running.TryLock() {
+		return nil, ErrFetchRunning
+	}
+	defer s.running.Unlock()
+
+	conn, client, err := s.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	defer client.Close()
+
+	result := &FetchResult{TriggeredBy: triggeredBy}
+	for _, dir := range s.config.Directories {
+		if err := s.fetchDirectory(client, dir, result); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", dir, err))
+			if errors.Is(err, ErrDraining) {
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// dial connects to the server, which must present a host key listed in the
+// known hosts file
+func (s *StatementFetchService) dial() (*ssh.Client, *sftp.Client, error) {
+	hostKeys, err := knownhosts.New(s.config.KnownHostsFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read known hosts: %w", err)
+	}
+
+	var auth []ssh.AuthMethod
+	if s.config.PrivateKeyFile != "" {
+		key, err := os.ReadFile(s.config.PrivateKeyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read private key: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid private key: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if s.config.Password != "" {
+		auth = append(auth, ssh.Password(s.config.Password))
+	}
+
+	conn, err := ssh.Dial("tcp", s.config.Host, &ssh.ClientConfig{
+		User:            s.config.User,
+		Auth:            auth,
+		HostKeyCallback: hostKeys,
+		Timeout:         sftpDialTimeout,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to %s: %w", s.config.Host, err)
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to start sftp on %s: %w", s.config.Host, err)
+	}
+	return conn, client, nil
+}
+
+// fetchDirectory ingests the settled files of a directory. Hidden files and
+// subdirectories, including the archive and rejected ones, are passed over.
+func (s *StatementFetchService) fetchDirectory(client *sftp.Client, dir string, result *FetchResult) error {
+	entries, err := client.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	settledBefore := time.Now().Add(-s.config.SettleTime)
+	for _, entry := range entries {
+		if !entry.Mode().IsRegular() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		if entry.ModTime().After(settledBefore) {
+			result.Skipped++
+			continue
+		}
+		if err := s.fetchFile(client, dir, entry, result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchFile claims, ingests and moves a single file. Problems with the file
+// are counted in result; the error returned stops the fetch of the
+// directory, and is only returned once the service drains.
+func (s *StatementFetchService) fetchFile(client *sftp.Client, dir string, entry os.FileInfo, result *FetchResult) error {
+	remotePath := path.Join(dir, entry.Name())
+	data, checksum, err := readRemoteFile(client, remotePath)
+	if err != nil {
+		result.Failed++
+		result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", remotePath, err))
+		return nil
+	}
+
+	file := &models.IngestionFile{
+		Source:   "sftp:" + dir,
+		FileName: entry.Name(),
+		Checksum: checksum,
+		Size:     entry.Size(),
+	}
+	claimed, err := s.fileRepo.ClaimFile(file, time.Now().Add(-ingestionFileStaleAfter))
+	if err != nil {
+		result.Failed++
+		result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", remotePath, err))
+		return nil
+	}
+	if !claimed {
+		s.setAsideDuplicate(client, dir, entry.Name(), file, result)
+		return nil
+	}
+
+	err = ingestStatementFile(s.dataIngestionService, s.jobService, s.anomalyService, file, data)
+	recordFileOutcome(file, err, result)
+	switch file.Status {
+	case models.IngestionFileIngested:
+		file.ArchivedPath = s.move(client, dir, entry.Name(), s.config.ArchiveDir, file.ID, result)
+	case models.IngestionFileRejected:
+		file.ArchivedPath = s.move(client, dir, entry.Name(), s.config.RejectedDir, file.ID, result)
+	}
+	finishFile(s.fileRepo, file, result)
+	if errors.Is(err, ErrDraining) {
+		return err
+	}
+	return nil
+}
+
+// setAsideDuplicate moves a file whose content was ingested or rejected
+// before where that first copy went. One being processed elsewhere is left.
+func (s *StatementFetchService) setAsideDuplicate(client *sftp.Client, dir, name string, stored *models.IngestionFile, result *FetchResult) {
+	switch stored.Status {
+	case models.IngestionFileIngested:
+		s.move(client, dir, name, s.config.ArchiveDir, stored.ID, result)
+	case models.IngestionFileRejected:
+		s.move(client, dir, name, s.config.RejectedDir, stored.ID, result)
+	default:
+		result.Skipped++
+		return
+	}
+	log.Printf("sftp: %s/%s has the content of file %d (%s), not ingested again", dir, name, stored.ID, stored.FileName)
+	s.anomalyService.DuplicateFile("sftp:"+dir, name, stored)
+	result.Duplicates++
+}
+
+// ingestStatementFile parses a claimed file and stores its transactions as
+// an ingestion job, recording the format, quality score, job and record
+// count on file, and has anomalies check the file once it is stored. A file
+// that cannot be parsed, or whose transactions fail validation, is an
+// ErrInvalidStatement.
+func ingestStatementFile(dataIngestionService *DataIngestionService, jobService *JobService, anomalies *IngestionAnomalyService, file *models.IngestionFile, data []byte) error {
+	if len(data) > MaxStatementSize {
+		return fmt.Errorf("%w: larger than %d bytes", ErrInvalidStatement, MaxStatementSize)
+	}
+	decoded, err := charset.Decode(data, "")
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidStatement, err)
+	}
+	detection := detect.Detect(decoded.Text)
+	file.Format = detection.Format
+	if !StatementIngestible(detection) {
+		return fmt.Errorf("%w: format %q detected with confidence %.2f is not supported", ErrInvalidStatement, detection.Format, detection.Confidence)
+	}
+	transactions, balances, err := ParseStatement(detection, decoded.Text)
+	if err != nil {
+		return err
+	}
+	if len(transactions) == 0 {
+		return fmt.Errorf("%w: no transactions", ErrInvalidStatement)
+	}
+	score := qualityScore(transactions)
+	file.QualityScore = &score
+
+	job, err := jobService.Begin(models.JobTypeIngestion, "", "")
+	if err != nil {
+		return err
+	}
+	file.JobID = job.ID
+	jobService.Checkpoint(job, map[string]interface{}{
+		"source":  file.Source + "/" + file.FileName,
+		"records": len(transactions),
+	})
+
+	result, err := dataIngestionService.IngestBankTransactions(IngestionLaneBulk, transactions, balances, false)
+	jobService.Finish(job, "", err)
+	if err != nil {
+		return err
+	}
+	// Chunks before a failed one stay stored; ingesting the corrected file
+	// again skips them
+	if !result.Success {
+		return fmt.Errorf("%w: %s", ErrInvalidStatement, strings.Join(result.Errors, "; "))
+	}
+	file.Records = result.RecordsCount
+	anomalies.Ingested(file, detection, decoded.Text)
+	return nil
+}
+
+// move moves a file into target, relative to dir unless absolute, under a
+// name prefixed with the time and the ID of its ingestion file. It returns
+// the path moved to, or "" when the move failed; the file is then found
+// again by the next fetch and moved as a duplicate.
+func (s *StatementFetchService) move(client *sftp.Client, dir, name, target string, id int64, result *FetchResult) string {
+	if !path.IsAbs(target) {
+		target = path.Join(dir, target)
+	}
+	if err := client.MkdirAll(target); err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("%s: failed to create %s: %v", path.Join(dir, name), target, err))
+		return ""
+	}
+	moved := path.Join(target, fmt.Sprintf("%s-%d-%s", time.Now().UTC().Format("20060102T150405Z"), id, name))
+	if err := client.Rename(path.Join(dir, name), moved); err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("%s: failed to move to %s: %v", path.Join(dir, name), target, err))
+		return ""
+	}
+	return moved
+}
+
+// recordFileOutcome sets the status of a claimed file from the error
+// ingesting it returned, and counts it
+func recordFileOutcome(file *models.IngestionFile, err error, result *FetchResult) {
+	switch {
+	case err == nil:
+		file.Status = models.IngestionFileIngested
+		result.Ingested++
+	case errors.Is(err, ErrInvalidStatement):
+		file.Status = models.IngestionFileRejected
+		file.Error = err.Error()
+		result.Rejected++
+	default:
+		file.Status = models.IngestionFileFailed
+		file.Error = err.Error()
+		result.Failed++
+	}
+}
+
+func finishFile(fileRepo repositories.IngestionFileRepository, file *models.IngestionFile, result *FetchResult) {
+	if err := fileRepo.FinishFile(file); err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("%s: failed to record outcome %s: %v", file.FileName, file.Status, err))
+	}
+}
+
+// readRemoteFile reads a file up to one byte past the statement size limit,
+// which is enough to refuse it, and the SHA-256 of its whole content
+func readRemoteFile(client *sftp.Client, remotePath string) ([]byte, string, error) {
+	f, err := client.Open(remotePath)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	data, err := io.ReadAll(io.LimitReader(io.TeeReader(f, hash), MaxStatementSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := io.Copy(hash, f); err != nil {
+		return nil, "", err
+	}
+	return data, hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,218 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"reconciliation-service/internal/config"
+	"reconciliation-service/internal/models"
+)
+
+const (
+	// First and longest wait before a batch that failed to store is retried
+	streamRetryDelay    = time.Second
+	maxStreamRetryDelay = time.Minute
+	// Time offsets of a stored batch get to be committed, even at shutdown
+	streamCommitTimeout = 10 * time.Second
+)
+
+// StreamService ingests bank transactions and accounting entries streamed
+// from Kafka topics, one record per message. Records are ingested in batches
+// as partial commits, so a bad record is logged and skipped rather than
+// holding up the stream. A batch's offsets are committed only once the batch
+// is stored, so records are delivered at least once: a batch stored but not
+// committed comes again and is ingested as a resent statement would be.
+type StreamService struct {
+	dataIngestionService *DataIngestionService
+	jobService           *JobService
+	maintenanceService   *MaintenanceService
+	config               config.KafkaConfig
+}
+
+func NewStreamService(dataIngestionService *DataIngestionService, jobService *JobService, maintenanceService *MaintenanceService, cfg config.KafkaConfig) *StreamService {
+	return &StreamService{
+		dataIngestionService: dataIngestionService,
+		jobService:           jobService,
+		maintenanceService:   maintenanceService,
+		config:               cfg,
+	}
+}
+
+// streamIngest stores the records of a batch of messages
+type streamIngest func(batch []kafka.Message) (*IngestionResult, error)
+
+// RunConsumer consumes the configured topics until ctx is cancelled or the
+// service drains. Nothing is ingested during maintenance; the stream waits.
+func (s *StreamService) RunConsumer(ctx context.Context) {
+	var wg sync.WaitGroup
+	consume := func(topic string, ingest streamIngest) {
+		if topic == "" {
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.consume(ctx, topic, ingest)
+		}()
+	}
+	consume(s.config.BankTopic, s.ingestBankTransactions)
+	consume(s.config.AccountingTopic, s.ingestAccountingEntries)
+	wg.Wait()
+}
+
+func (s *StreamService) consume(ctx context.Context, topic string, ingest streamIngest) {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers: s.config.Brokers,
+		GroupID: s.config.GroupID,
+		Topic:   topic,
+		MaxWait: s.config.BatchWait,
+	})
+	defer reader.Close()
+	log.Printf("Consuming %s as %s", topic, s.config.GroupID)
+
+	for ctx.Err() == nil && !s.jobService.Draining() {
+		if s.maintenanceService.Enabled() {
+			sleepContext(ctx, streamRetryDelay)
+			continue
+		}
+
+		batch, err := s.fetchBatch(ctx, reader)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("stream %s: failed to fetch messages: %v", topic, err)
+				sleepContext(ctx, streamRetryDelay)
+			}
+			continue
+		}
+		if !s.ingestBatch(ctx, topic, batch, ingest) {
+			return
+		}
+
+		commitCtx, cancel := context.WithTimeout(context.Background(), streamCommitTimeout)
+		if err := reader.CommitMessages(commitCtx, batch...); err != nil {
+			log.Printf("stream %s: stored %d records but failed to commit their offsets, they will be redelivered: %v", topic, len(batch), err)
+		}
+		cancel()
+	}
+}
+
+// fetchBatch waits for a message, then takes whatever else arrives within
+// the batch wait, up to the batch size. A batch cut short by shutdown is
+// left to be redelivered.
+func (s *StreamService) fetchBatch(ctx context.Context, reader *kafka.Reader) ([]kafka.Message, error) {
+	first, err := reader.FetchMessage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	batch := []kafka.Message{first}
+
+	fillCtx, cancel := context.WithTimeout(ctx, s.config.BatchWait)
+	defer cancel()
+	for len(batch) < s.config.BatchSize {
+		message, err := reader.FetchMessage(fillCtx)
+		if err != nil {
+			break
+		}
+		batch = append(batch, message)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+// ingestBatch stores a batch as an ingestion job, retrying with backoff until
+// it is stored. It gives up, leaving the batch to be redelivered, only when
+// ctx is cancelled or the service drains.
+func (s *StreamService) ingestBatch(ctx context.Context, topic string, batch []kafka.Message, ingest streamIngest) bool {
+	delay := streamRetryDelay
+	for {
+		err := s.ingestOnce(topic, batch, ingest)
+		if err == nil {
+			return true
+		}
+		if err == ErrDraining {
+			return false
+		}
+		log.Printf("stream %s: failed to store %d records, retrying in %v: %v", topic, len(batch), delay, err)
+		if !sleepContext(ctx, delay) {
+			return false
+		}
+		delay = min(delay*2, maxStreamRetryDelay)
+	}
+}
+
+func (s *StreamService) ingestOnce(topic string, batch []kafka.Message, ingest streamIngest) error {
+	job, err := s.jobService.Begin(models.JobTypeIngestion, "", "")
+	if err != nil {
+		return err
+	}
+	s.jobService.Checkpoint(job, map[string]interface{}{
+		"source":  "kafka:" + topic,
+		"records": len(batch),
+	})
+
+	result, err := ingest(batch)
+	s.jobService.Finish(job, "", err)
+	if err != nil {
+		return err
+	}
+	for _, failure := range result.Errors {
+		log.Printf("stream %s: %s", topic, failure)
+	}
+	return nil
+}
+
+func (s *StreamService) ingestBankTransactions(batch []kafka.Message) (*IngestionResult, error) {
+	transactions, undecodable := decodeStreamRecords[BankTransactionInput](batch)
+	result, err := s.dataIngestionService.IngestBankTransactions(IngestionLaneRealtime, transactions, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	result.Errors = append(result.Errors, undecodable...)
+	return result, nil
+}
+
+func (s *StreamService) ingestAccountingEntries(batch []kafka.Message) (*IngestionResult, error) {
+	entries, undecodable := decodeStreamRecords[AccountingEntryInput](batch)
+	result, err := s.dataIngestionService.IngestAccountingEntries(IngestionLaneRealtime, entries, true)
+	if err != nil {
+		return nil, err
+	}
+	result.Errors = append(result.Errors, undecodable...)
+	return result, nil
+}
+
+// decodeStreamRecords decodes the record of each message, reporting the
+// messages that do not hold one
+func decodeStreamRecords[T any](batch []kafka.Message) ([]T, []string) {
+	records := make([]T, 0, len(batch))
+	var undecodable []string
+	for _, message := range batch {
+		var record T
+		if err := json.Unmarshal(message.Value, &record); err != nil {
+			undecodable = append(undecodable, fmt.Sprintf("Skipped message at partition %d offset %d: %v", message.Partition, message.Offset, err))
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, undecodable
+}
+
+// sleepContext waits for d and reports whether ctx was still live after it
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,287 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"reconciliation-service/internal/banking"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+)
+
+const (
+	// Matched pairs, newest first, that account suggestions learn from
+	SuggestionHistoryLimit = 5000
+
+	MaxAccountSuggestions     = 3
+	MinAccountSuggestionScore = 0.3
+
+	// Score of a default account set on the counterparty by hand, which
+	// history for that counterparty outweighs
+	CounterpartyDefaultScore = 0.5
+
+	// How long scored suggestions are reused while the classification
+	// version stays the same. Corrections to matched entries do not change
+	// the version, so they show once this passes.
+	suggestionCacheTTL = 5 * time.Minute
+)
+
+// Account suggestion bases
+const (
+	SuggestionBasisCounterparty        = "counterparty"
+	SuggestionBasisCounterpartyDefault = "counterparty_default"
+	SuggestionBasisDescription         = "description"
+)
+
+// AccountSuggestion is a likely ledger account for an unmatched bank
+// transaction, scored from 0 to 1
+type AccountSuggestion struct {
+	AccountCode string  `json:"account_code"`
+	Score       float64 `json:"score"`
+	Basis       string  `json:"basis"`
+}
+
+// BankSuggestion lists the account suggestions for one unmatched bank
+// transaction, best first
+type BankSuggestion struct {
+	BankTransaction *models.BankTransaction `json:"bank_transaction"`
+	AccountCodes    []AccountSuggestion     `json:"account_codes"`
+}
+
+// SuggestionService scores account suggestions. During a clean-up session
+// the same transactions are asked for again and again, so the classifier and
+// the suggestions it scored are kept until what they were learned from
+// changes.
+type SuggestionService struct {
+	bankRepo           repositories.BankRepository
+	reconciliationRepo repositories.ReconciliationRepository
+	counterpartyRepo   repositories.CounterpartyRepository
+	aliasRepo          repositories.AliasRepository
+
+	mu    sync.Mutex
+	cache *suggestionCache
+}
+
+// suggestionCache holds the classifier learned at one classification
+// version and the suggestions it scored, by bank transaction ID
+type suggestionCache struct {
+	version    string
+	builtAt    time.Time
+	classifier *accountClassifier
+	scored     map[int64]scoredSuggestions
+}
+
+// scoredSuggestions are the suggestions for one version of a bank
+// transaction; a corrected transaction is scored again
+type scoredSuggestions struct {
+	version     int
+	suggestions []AccountSuggestion
+}
+
+func NewSuggestionService(
+	bankRepo repositories.BankRepository,
+	reconciliationRepo repositories.ReconciliationRepository,
+	counterpartyRepo repositories.CounterpartyRepository,
+	aliasRepo repositories.AliasRepository,
+) *SuggestionService {
+	return &SuggestionService{
+		bankRepo:           bankRepo,
+		reconciliationRepo: reconciliationRepo,
+		counterpartyRepo:   counterpartyRepo,
+		aliasRepo:          aliasRepo,
+	}
+}
+
+// SuggestAccounts proposes ledger accounts for the unmatched bank
+// transactions of the period, so adjustment entries can be booked without
+// looking the account up. Accounts are scored by how the same counterparty
+// and the same description words were booked in matched history.
+// Suggestions scored before are reused while nothing they were learned from
+// changed.
+func (s *SuggestionService) SuggestAccounts(fromDate, toDate string) ([]*BankSuggestion, error) {
+	transactions, err := s.bankRepo.GetUnreconciledTransactions(context.Background(), fromDate, toDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unreconciled bank transactions: %v", err)
+	}
+	cache, err := s.currentCache()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	suggestions := make([]*BankSuggestion, 0, len(transactions))
+	for _, bt := range transactions {
+		scored, ok := cache.scored[bt.ID]
+		if !ok || scored.version != bt.Version {
+			scored = scoredSuggestions{version: bt.Version, suggestions: cache.classifier.suggest(bt)}
+			cache.scored[bt.ID] = scored
+		}
+		suggestions = append(suggestions, &BankSuggestion{
+			BankTransaction: bt,
+			AccountCodes:    scored.suggestions,
+		})
+	}
+	return suggestions, nil
+}
+
+// currentCache returns the suggestion cache of the current classification
+// version, learning the classifier again when the version moved on or the
+// cache expired
+func (s *SuggestionService) currentCache() (*suggestionCache, error) {
+	version, err := s.reconciliationRepo.GetClassificationVersion()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get classification version: %v", err)
+	}
+	s.mu.Lock()
+	cache := s.cache
+	s.mu.Unlock()
+	if cache != nil && cache.version == version && time.Since(cache.builtAt) < suggestionCacheTTL {
+		return cache, nil
+	}
+
+	history, err := s.reconciliationRepo.GetClassificationHistory(SuggestionHistoryLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get classification history: %v", err)
+	}
+	counterparties, err := s.counterpartyRepo.ListCounterparties()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load counterparties: %v", err)
+	}
+	dictionary, err := loadAliasDictionary(s.aliasRepo)
+	if err != nil {
+		return nil, err
+	}
+
+	cache = &suggestionCache{
+		version:    version,
+		builtAt:    time.Now(),
+		classifier: newAccountClassifier(history, counterparties, dictionary),
+		scored:     make(map[int64]scoredSuggestions),
+	}
+	s.mu.Lock()
+	s.cache = cache
+	s.mu.Unlock()
+	return cache, nil
+}
+
+// accountClassifier counts how matched history was booked, by counterparty
+// and by description word
+type accountClassifier struct {
+	dictionary     *banking.AliasDictionary
+	byCounterparty map[int64]map[string]int
+	byWord         map[string]map[string]int
+	defaults       map[int64][]string
+}
+
+func newAccountClassifier(history []*models.ClassifiedTransaction, counterparties []*models.Counterparty, dictionary *banking.AliasDictionary) *accountClassifier {
+	c := &accountClassifier{
+		dictionary:     dictionary,
+		byCounterparty: make(map[int64]map[string]int),
+		byWord:         make(map[string]map[string]int),
+		defaults:       make(map[int64][]string),
+	}
+	for _, item := range history {
+		if item.CounterpartyID != 0 {
+			c.byCounterparty[item.CounterpartyID] = addCount(c.byCounterparty[item.CounterpartyID], item.AccountCode)
+		}
+		for _, word := range c.words(item.Description) {
+			c.byWord[word] = addCount(c.byWord[word], item.AccountCode)
+		}
+	}
+	for _, cp := range counterparties {
+		c.defaults[cp.ID] = cp.DefaultAccounts
+	}
+	return c
+}
+
+func addCount(counts map[string]int, account string) map[string]int {
+	if counts == nil {
+		counts = make(map[string]int)
+	}
+	counts[account]++
+	return counts
+}
+
+// words lists the distinct description words worth classifying on; numbers
+// are mostly invoice and reference numbers that never repeat
+func (c *accountClassifier) words(description string) []string {
+	seen := make(map[string]bool)
+	var words []string
+	for _, word := range strings.Fields(c.dictionary.Apply(description)) {
+		if seen[word] || strings.Trim(word, "0123456789") == "" {
+			continue
+		}
+		seen[word] = true
+		words = append(words, word)
+	}
+	return words
+}
+
+// suggest scores each account by the share of the counterparty's history
+// booked on it and by the average, over the transaction's words, of the share
+// of each word's history booked on it. An account keeps its best score.
+func (c *accountClassifier) suggest(bt *models.BankTransaction) []AccountSuggestion {
+	best := make(map[string]AccountSuggestion)
+	consider := func(account string, score float64, basis string) {
+		if current, ok := best[account]; !ok || score > current.Score {
+			best[account] = AccountSuggestion{AccountCode: account, Score: score, Basis: basis}
+		}
+	}
+
+	if bt.CounterpartyID != 0 {
+		for _, account := range c.defaults[bt.CounterpartyID] {
+			consider(account, CounterpartyDefaultScore, SuggestionBasisCounterpartyDefault)
+		}
+		counts := c.byCounterparty[bt.CounterpartyID]
+		total := sumCounts(counts)
+		for account, count := range counts {
+			consider(account, float64(count)/float64(total), SuggestionBasisCounterparty)
+		}
+	}
+
+	words := c.words(bt.Description)
+	scores := make(map[string]float64)
+	for _, word := range words {
+		counts := c.byWord[word]
+		total := sumCounts(counts)
+		for account, count := range counts {
+			scores[account] += float64(count) / float64(total) / float64(len(words))
+		}
+	}
+	for account, score := range scores {
+		consider(account, score, SuggestionBasisDescription)
+	}
+
+	suggestions := []AccountSuggestion{}
+	for _, suggestion := range best {
+		if suggestion.Score < MinAccountSuggestionScore {
+			continue
+		}
+		suggestion.Score = math.Round(suggestion.Score*100) / 100
+		suggestions = append(suggestions, suggestion)
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Score != suggestions[j].Score {
+			return suggestions[i].Score > suggestions[j].Score
+		}
+		return suggestions[i].AccountCode < suggestions[j].AccountCode
+	})
+	if len(suggestions) > MaxAccountSuggestions {
+		suggestions = suggestions[:MaxAccountSuggestions]
+	}
+	return suggestions
+}
+
+func sumCounts(counts map[string]int) int {
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+	return total
+}
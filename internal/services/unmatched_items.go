@@ -0,0 +1,296 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+)
+
+// ErrInvalidBulkAction wraps every rejection of a bulk action on unmatched
+// records
+var ErrInvalidBulkAction = errors.New("invalid bulk action")
+
+// Bulk actions on unmatched records
+const (
+	BulkActionAssign        = "assign"
+	BulkActionHold          = "hold"
+	BulkActionRelease       = "release"
+	BulkActionTag           = "tag"
+	BulkActionSetReasonCode = "set_reason_code"
+)
+
+// What became of one record of a bulk action
+const (
+	BulkItemApplied   = "applied"
+	BulkItemUnchanged = "unchanged"
+	BulkItemFailed    = "failed"
+)
+
+const (
+	// Most records one bulk action may change
+	MaxBulkActionItems = 10000
+	// Most tags one record may carry
+	MaxUnmatchedItemTags = 20
+)
+
+var reasonCodePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,50}$`)
+
+// UnmatchedBulkAction is one action over the unmatched records a filter
+// selects, or over a list of them. Owner, Tags and ReasonCode are the
+// arguments of assign, tag and set_reason_code.
+type UnmatchedBulkAction struct {
+	Action     string                      `json:"action"`
+	Owner      string                      `json:"owner,omitempty"`
+	Tags       []string                    `json:"tags,omitempty"`
+	ReasonCode string                      `json:"reason_code,omitempty"`
+	Filter     *models.UnmatchedItemFilter `json:"filter,omitempty"`
+	Items      []models.UnmatchedItemRef   `json:"items,omitempty"`
+	DryRun     bool                        `json:"dry_run,omitempty"`
+}
+
+// BulkItemOutcome is what became of one record of a bulk action, or why it
+// was left as it was
+type BulkItemOutcome struct {
+	RecordType string `json:"record_type"`
+	RecordID   int64  `json:"record_id"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+}
+
+// BulkActionResult counts the records a bulk action selected and, unless
+// it was a dry run, reports each of them
+type BulkActionResult struct {
+	Action    string             `json:"action"`
+	DryRun    bool               `json:"dry_run"`
+	Selected  int                `json:"selected"`
+	Applied   int                `json:"applied"`
+	Unchanged int                `json:"unchanged"`
+	Failed    int                `json:"failed"`
+	Results   []*BulkItemOutcome `json:"results,omitempty"`
+}
+
+// UnmatchedItemService keeps the work state operators set on records still
+// unmatched, changed in bulk when an outage leaves thousands of them behind
+type UnmatchedItemService struct {
+	unmatchedRepo repositories.UnmatchedItemRepository
+}
+
+func NewUnmatchedItemService(unmatchedRepo repositories.UnmatchedItemRepository) *UnmatchedItemService {
+	return &UnmatchedItemService{unmatchedRepo: unmatchedRepo}
+}
+
+// BulkAction applies one action to every selected record still unmatched and
+// reports per record whether it changed. A dry run only counts the records
+// the action would select. Records of an ID list that are unknown or matched
+// fail on their own without holding up the others.
+func (s *UnmatchedItemService) BulkAction(action UnmatchedBulkAction, userID string) (*BulkActionResult, error) {
+	if err := normalizeBulkAction(&action); err != nil {
+		return nil, err
+	}
+	result := &BulkActionResult{Action: action.Action, DryRun: action.DryRun}
+
+	var items []*models.UnmatchedItem
+	var err error
+	if action.Filter != nil {
+		if action.DryRun {
+			if result.Selected, err = s.unmatchedRepo.CountUnmatched(*action.Filter); err != nil {
+				return nil, fmt.Errorf("failed to count unmatched records: %v", err)
+			}
+			return result, nil
+		}
+		if items, err = s.unmatchedRepo.ListUnmatched(*action.Filter, MaxBulkActionItems+1); err != nil {
+			return nil, fmt.Errorf("failed to select unmatched records: %v", err)
+		}
+		if len(items) > MaxBulkActionItems {
+			return nil, fmt.Errorf("%w: the filter selects more than %d records; narrow it", ErrInvalidBulkAction, MaxBulkActionItems)
+		}
+	} else {
+		found, err := s.unmatchedRepo.GetUnmatched(action.Items)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get unmatched records: %v", err)
+		}
+		if action.DryRun {
+			result.Selected = len(found)
+			return result, nil
+		}
+		byRef := make(map[models.UnmatchedItemRef]*models.UnmatchedItem, len(found))
+		for _, item := range found {
+			byRef[models.UnmatchedItemRef{RecordType: item.RecordType, ID: item.RecordID}] = item
+		}
+		items = make([]*models.UnmatchedItem, len(action.Items))
+		for i, ref := range action.Items {
+			items[i] = byRef[ref]
+		}
+	}
+
+	var changed []*models.UnmatchedItem
+	result.Results = make([]*BulkItemOutcome, len(items))
+	for i, item := range items {
+		outcome := &BulkItemOutcome{Status: BulkItemUnchanged}
+		switch {
+		case item == nil:
+			outcome.RecordType, outcome.RecordID = action.Items[i].RecordType, action.Items[i].ID
+			outcome.Status, outcome.Error = BulkItemFailed, "record not found or already matched"
+		default:
+			outcome.RecordType, outcome.RecordID = item.RecordType, item.RecordID
+			result.Selected++
+			applied, err := applyBulkAction(action, item)
+			if err != nil {
+				outcome.Status, outcome.Error = BulkItemFailed, err.Error()
+			} else if applied {
+				outcome.Status = BulkItemApplied
+				changed = append(changed, item)
+			}
+		}
+		switch outcome.Status {
+		case BulkItemApplied:
+			result.Applied++
+		case BulkItemUnchanged:
+			result.Unchanged++
+		case BulkItemFailed:
+			result.Failed++
+		}
+		result.Results[i] = outcome
+	}
+
+	if err := s.unmatchedRepo.SaveStates(changed, userID); err != nil {
+		return nil, fmt.Errorf("failed to save unmatched record states: %v", err)
+	}
+	return result, nil
+}
+
+// normalizeBulkAction checks an action and its selection, trimming its
+// arguments and dropping repeated records
+func normalizeBulkAction(action *UnmatchedBulkAction) error {
+	action.Action = strings.ToLower(strings.TrimSpace(action.Action))
+	action.Owner = strings.TrimSpace(action.Owner)
+	action.ReasonCode = strings.TrimSpace(action.ReasonCode)
+	switch action.Action {
+	case BulkActionAssign:
+		if len(action.Owner) > 100 {
+			return fmt.Errorf("%w: owner must be at most 100 characters", ErrInvalidBulkAction)
+		}
+	case BulkActionHold, BulkActionRelease:
+	case BulkActionTag:
+		tags := make([]string, 0, len(action.Tags))
+		for _, tag := range action.Tags {
+			tag = strings.TrimSpace(tag)
+			if tag == "" || len(tag) > 50 {
+				return fmt.Errorf("%w: tags must be between 1 and 50 characters", ErrInvalidBulkAction)
+			}
+			tags = append(tags, tag)
+		}
+		if len(tags) == 0 {
+			return fmt.Errorf("%w: tags are required", ErrInvalidBulkAction)
+		}
+		action.Tags = tags
+	case BulkActionSetReasonCode:
+		if action.ReasonCode != "" && !reasonCodePattern.MatchString(action.ReasonCode) {
+			return fmt.Errorf("%w: reason_code must be up to 50 letters, digits, '_', '.' or '-'", ErrInvalidBulkAction)
+		}
+	default:
+		return fmt.Errorf("%w: action must be %s, %s, %s, %s or %s", ErrInvalidBulkAction,
+			BulkActionAssign, BulkActionHold, BulkActionRelease, BulkActionTag, BulkActionSetReasonCode)
+	}
+
+	switch {
+	case action.Filter != nil && len(action.Items) > 0:
+		return fmt.Errorf("%w: give either a filter or items, not both", ErrInvalidBulkAction)
+	case action.Filter != nil:
+		return normalizeUnmatchedFilter(action.Filter)
+	case len(action.Items) == 0:
+		return fmt.Errorf("%w: a filter or items are required", ErrInvalidBulkAction)
+	case len(action.Items) > MaxBulkActionItems:
+		return fmt.Errorf("%w: at most %d items can be changed at once", ErrInvalidBulkAction, MaxBulkActionItems)
+	}
+	seen := make(map[models.UnmatchedItemRef]bool, len(action.Items))
+	refs := action.Items[:0]
+	for _, ref := range action.Items {
+		ref.RecordType = strings.ToLower(strings.TrimSpace(ref.RecordType))
+		if !validUnmatchedRecordType(ref.RecordType) || ref.ID <= 0 {
+			return fmt.Errorf("%w: every item needs a record_type of %s or %s and an id", ErrInvalidBulkAction,
+				models.ExceptionRecordBankTransaction, models.ExceptionRecordAccountingEntry)
+		}
+		if !seen[ref] {
+			seen[ref] = true
+			refs = append(refs, ref)
+		}
+	}
+	action.Items = refs
+	return nil
+}
+
+// normalizeUnmatchedFilter checks a bulk action's filter, which must bound
+// the records by date like the unmatched records listing
+func normalizeUnmatchedFilter(filter *models.UnmatchedItemFilter) error {
+	filter.RecordType = strings.ToLower(strings.TrimSpace(filter.RecordType))
+	filter.Account = strings.TrimSpace(filter.Account)
+	filter.Currency = strings.ToUpper(strings.TrimSpace(filter.Currency))
+	filter.Owner = strings.TrimSpace(filter.Owner)
+	filter.Tag = strings.TrimSpace(filter.Tag)
+	filter.ReasonCode = strings.TrimSpace(filter.ReasonCode)
+	if filter.RecordType != "" && !validUnmatchedRecordType(filter.RecordType) {
+		return fmt.Errorf("%w: record_type must be %s or %s", ErrInvalidBulkAction,
+			models.ExceptionRecordBankTransaction, models.ExceptionRecordAccountingEntry)
+	}
+	from, err := time.Parse("2006-01-02", filter.FromDate)
+	if err != nil {
+		return fmt.Errorf("%w: filter.from_date must be a YYYY-MM-DD date", ErrInvalidBulkAction)
+	}
+	to, err := time.Parse("2006-01-02", filter.ToDate)
+	if err != nil {
+		return fmt.Errorf("%w: filter.to_date must be a YYYY-MM-DD date", ErrInvalidBulkAction)
+	}
+	if to.Before(from) {
+		return fmt.Errorf("%w: filter.to_date is before filter.from_date", ErrInvalidBulkAction)
+	}
+	return nil
+}
+
+// applyBulkAction changes the state of one record and reports whether it
+// changed
+func applyBulkAction(action UnmatchedBulkAction, item *models.UnmatchedItem) (bool, error) {
+	switch action.Action {
+	case BulkActionAssign:
+		if item.Owner == action.Owner {
+			return false, nil
+		}
+		item.Owner = action.Owner
+	case BulkActionHold, BulkActionRelease:
+		hold := action.Action == BulkActionHold
+		if item.OnHold == hold {
+			return false, nil
+		}
+		item.OnHold = hold
+	case BulkActionTag:
+		tags := item.Tags
+		for _, tag := range action.Tags {
+			if !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+		if len(tags) == len(item.Tags) {
+			return false, nil
+		}
+		if len(tags) > MaxUnmatchedItemTags {
+			return false, fmt.Errorf("a record carries at most %d tags", MaxUnmatchedItemTags)
+		}
+		item.Tags = tags
+	case BulkActionSetReasonCode:
+		if item.ReasonCode == action.ReasonCode {
+			return false, nil
+		}
+		item.ReasonCode = action.ReasonCode
+	}
+	return true, nil
+}
+
+func validUnmatchedRecordType(recordType string) bool {
+	return recordType == models.ExceptionRecordBankTransaction || recordType == models.ExceptionRecordAccountingEntry
+}
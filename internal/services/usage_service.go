@@ -0,0 +1,123 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/repositories"
+)
+
+var (
+	ErrRequestQuotaExceeded = errors.New("monthly request quota exceeded")
+	ErrRowQuotaExceeded     = errors.New("monthly ingestion row quota exceeded")
+	ErrBatchQuotaExceeded   = errors.New("monthly reconciliation batch quota exceeded")
+)
+
+type UsageService struct {
+	usageRepo    repositories.UsageRepository
+	defaultQuota models.APIQuota
+}
+
+func NewUsageService(usageRepo repositories.UsageRepository, defaultQuota models.APIQuota) *UsageService {
+	return &UsageService{
+		usageRepo:    usageRepo,
+		defaultQuota: defaultQuota,
+	}
+}
+
+type UsageReport struct {
+	Usage *models.APIUsage `json:"usage"`
+	Quota models.APIQuota  `json:"quota"`
+}
+
+// CurrentPeriod returns the billing period (calendar month, UTC) for now
+func CurrentPeriod() string {
+	return time.Now().UTC().Format("2006-01")
+}
+
+// NextPeriodStart returns the instant the current billing period resets
+func NextPeriodStart() time.Time {
+	now := time.Now().UTC()
+	return time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func (s *UsageService) RecordRequest(entity string) error {
+	return s.usageRepo.IncrementUsage(entity, CurrentPeriod(), 1, 0, 0)
+}
+
+func (s *UsageService) RecordRowsIngested(entity string, rows int) error {
+	if rows <= 0 {
+		return nil
+	}
+	return s.usageRepo.IncrementUsage(entity, CurrentPeriod(), 0, int64(rows), 0)
+}
+
+func (s *UsageService) RecordBatchRun(entity string) error {
+	return s.usageRepo.IncrementUsage(entity, CurrentPeriod(), 0, 0, 1)
+}
+
+// EffectiveQuota returns the entity's override, or the configured defaults
+func (s *UsageService) EffectiveQuota(entity string) (models.APIQuota, error) {
+	quota, err := s.usageRepo.GetQuota(entity)
+	if err != nil {
+		return models.APIQuota{}, fmt.Errorf("failed to get quota: %v", err)
+	}
+	if quota == nil {
+		q := s.defaultQuota
+		q.Entity = entity
+		return q, nil
+	}
+	return *quota, nil
+}
+
+// CheckQuota reports which quota, if any, blocks the next request. Ingestion
+// and batch limits only apply when the request would consume them.
+func (s *UsageService) CheckQuota(entity string, ingests, runsBatch bool) error {
+	quota, err := s.EffectiveQuota(entity)
+	if err != nil {
+		return err
+	}
+	usage, err := s.usageRepo.GetUsage(entity, CurrentPeriod())
+	if err != nil {
+		return fmt.Errorf("failed to get usage: %v", err)
+	}
+
+	if quota.MaxRequests > 0 && usage.Requests >= quota.MaxRequests {
+		return ErrRequestQuotaExceeded
+	}
+	if ingests && quota.MaxRowsIngested > 0 && usage.RowsIngested >= quota.MaxRowsIngested {
+		return ErrRowQuotaExceeded
+	}
+	if runsBatch && quota.MaxBatches > 0 && usage.BatchesRun >= quota.MaxBatches {
+		return ErrBatchQuotaExceeded
+	}
+	return nil
+}
+
+func (s *UsageService) GetUsageReport(entity, period string) (*UsageReport, error) {
+	usage, err := s.usageRepo.GetUsage(entity, period)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage: %v", err)
+	}
+	quota, err := s.EffectiveQuota(entity)
+	if err != nil {
+		return nil, err
+	}
+	return &UsageReport{Usage: usage, Quota: quota}, nil
+}
+
+func (s *UsageService) ListUsage(period string) ([]*models.APIUsage, error) {
+	return s.usageRepo.ListUsage(period)
+}
+
+func (s *UsageService) SetQuota(quota *models.APIQuota) error {
+	if quota.Entity == "" {
+		return fmt.Errorf("entity is required")
+	}
+	if quota.MaxRequests < 0 || quota.MaxRowsIngested < 0 || quota.MaxBatches < 0 {
+		return fmt.Errorf("quota limits must not be negative")
+	}
+	return s.usageRepo.UpsertQuota(quota)
+}
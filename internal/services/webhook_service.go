@@ -0,0 +1,339 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"reconciliation-service/internal/config"
+	"reconciliation-service/internal/models"
+	"reconciliation-service/internal/pagination"
+	"reconciliation-service/internal/repositories"
+)
+
+var (
+	// ErrInvalidWebhookEndpoint wraps every rejection of a webhook endpoint
+	ErrInvalidWebhookEndpoint = errors.New("invalid webhook endpoint")
+
+	// ErrInvalidWebhookDeliveries wraps every rejection of a delivery query
+	ErrInvalidWebhookDeliveries = errors.New("invalid webhook delivery query")
+)
+
+var webhookEvents = map[string]bool{
+	models.WebhookEventDuplicateFile:         true,
+	models.WebhookEventSequenceGap:           true,
+	models.WebhookEventQualityBelowThreshold: true,
+	models.WebhookEventFeedEmpty:             true,
+}
+
+const (
+	defaultWebhookDeliveriesLimit = 50
+	maxWebhookDeliveriesLimit     = 500
+
+	// webhookDeliveriesCursor names the delivery list in its page cursors
+	webhookDeliveriesCursor = "webhook_deliveries"
+
+	// Deliveries each pass of the sender sends at most
+	webhookSendBatch = 100
+	// The longest wait before a retry, however many attempts failed
+	maxWebhookBackoff = 6 * time.Hour
+	// Bytes of an endpoint's answer kept as the error of a failed attempt
+	webhookErrorBody = 512
+)
+
+// WebhookService tells the endpoints upstream teams register of ingestion
+// anomalies. Each event is stored once with a delivery to every endpoint
+// subscribed to its type; a sender posts pending deliveries, signed with the
+// endpoint's secret, and retries those not answered with a 2xx with a
+// doubling backoff until they run out of attempts.
+type WebhookService struct {
+	webhookRepo        repositories.WebhookRepository
+	jobService         *JobService
+	maintenanceService *MaintenanceService
+	config             config.WebhookConfig
+	client             *http.Client
+}
+
+func NewWebhookService(webhookRepo repositories.WebhookRepository, jobService *JobService, maintenanceService *MaintenanceService, cfg config.WebhookConfig) *WebhookService {
+	return &WebhookService{
+		webhookRepo:        webhookRepo,
+		jobService:         jobService,
+		maintenanceService: maintenanceService,
+		config:             cfg,
+		client:             &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+// CreateEndpoint validates and stores an endpoint under a new secret. The
+// endpoint is returned with the secret, which is not shown again.
+func (s *WebhookService) CreateEndpoint(endpoint *models.WebhookEndpoint, userID string) (*models.WebhookEndpoint, error) {
+	if err := normalizeWebhookEndpoint(endpoint); err != nil {
+		return nil, err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to draw webhook secret: %v", err)
+	}
+	endpoint.Secret = hex.EncodeToString(secret)
+	endpoint.UpdatedBy = userID
+	if err := s.webhookRepo.CreateEndpoint(endpoint); err != nil {
+		return nil, fmt.Errorf("failed to store webhook endpoint: %v", err)
+	}
+	return s.webhookRepo.GetEndpoint(endpoint.ID)
+}
+
+// UpdateEndpoint replaces an endpoint, keeping its secret. Deliveries
+// already pending go to the new URL.
+func (s *WebhookService) UpdateEndpoint(endpoint *models.WebhookEndpoint, userID string) (*models.WebhookEndpoint, error) {
+	if err := normalizeWebhookEndpoint(endpoint); err != nil {
+		return nil, err
+	}
+	endpoint.UpdatedBy = userID
+	if err := s.webhookRepo.UpdateEndpoint(endpoint); err != nil {
+		if errors.Is(err, repositories.ErrWebhookEndpointNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to update webhook endpoint: %v", err)
+	}
+	return s.GetEndpoint(endpoint.ID)
+}
+
+func normalizeWebhookEndpoint(endpoint *models.WebhookEndpoint) error {
+	endpoint.URL = strings.TrimSpace(endpoint.URL)
+	endpoint.Description = strings.TrimSpace(endpoint.Description)
+	u, err := url.Parse(endpoint.URL)
+	switch {
+	case err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "":
+		return fmt.Errorf("%w: url must be an http(s) URL", ErrInvalidWebhookEndpoint)
+	case len(endpoint.URL) > 1024:
+		return fmt.Errorf("%w: url must be at most 1024 characters", ErrInvalidWebhookEndpoint)
+	case len(endpoint.Description) > 255:
+		return fmt.Errorf("%w: description must be at most 255 characters", ErrInvalidWebhookEndpoint)
+	case len(endpoint.EventTypes) == 0:
+		return fmt.Errorf("%w: event_types is required", ErrInvalidWebhookEndpoint)
+	}
+	seen := make(map[string]bool, len(endpoint.EventTypes))
+	eventTypes := make([]string, 0, len(endpoint.EventTypes))
+	for _, eventType := range endpoint.EventTypes {
+		eventType = strings.ToLower(strings.TrimSpace(eventType))
+		if !webhookEvents[eventType] {
+			return fmt.Errorf("%w: unknown event type %q", ErrInvalidWebhookEndpoint, eventType)
+		}
+		if !seen[eventType] {
+			seen[eventType] = true
+			eventTypes = append(eventTypes, eventType)
+		}
+	}
+	endpoint.EventTypes = eventTypes
+	return nil
+}
+
+// GetEndpoint returns an endpoint without its secret
+func (s *WebhookService) GetEndpoint(id int64) (*models.WebhookEndpoint, error) {
+	endpoint, err := s.webhookRepo.GetEndpoint(id)
+	if err != nil {
+		return nil, err
+	}
+	endpoint.Secret = ""
+	return endpoint, nil
+}
+
+// ListEndpoints lists the endpoints without their secrets
+func (s *WebhookService) ListEndpoints() ([]*models.WebhookEndpoint, error) {
+	endpoints, err := s.webhookRepo.ListEndpoints()
+	if err != nil {
+		return nil, err
+	}
+	for _, endpoint := range endpoints {
+		endpoint.Secret = ""
+	}
+	return endpoints, nil
+}
+
+func (s *WebhookService) DeleteEndpoint(id int64) error {
+	return s.webhookRepo.DeleteEndpoint(id)
+}
+
+// ListDeliveries lists deliveries newest first, optionally of one endpoint
+// or status, from the cursor a previous page returned, and the cursor of the
+// next page
+func (s *WebhookService) ListDeliveries(endpointID int64, status, cursor string, limit int) ([]*models.WebhookDelivery, string, error) {
+	status = strings.ToLower(strings.TrimSpace(status))
+	switch status {
+	case "", models.WebhookDeliveryPending, models.WebhookDeliveryDelivered, models.WebhookDeliveryFailed:
+	default:
+		return nil, "", fmt.Errorf("%w: unknown status %q", ErrInvalidWebhookDeliveries, status)
+	}
+	switch {
+	case limit == 0:
+		limit = defaultWebhookDeliveriesLimit
+	case limit < 0 || limit > maxWebhookDeliveriesLimit:
+		return nil, "", fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidWebhookDeliveries, maxWebhookDeliveriesLimit)
+	}
+	after, err := pagination.Decode(cursor, webhookDeliveriesCursor)
+	if err != nil {
+		return nil, "", err
+	}
+	_, beforeID := after.Key()
+	deliveries, err := s.webhookRepo.ListDeliveries(endpointID, status, beforeID, limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	deliveries, next := pagination.Next(deliveries, limit, func(delivery *models.WebhookDelivery) pagination.Cursor {
+		return pagination.Cursor{List: webhookDeliveriesCursor, ID: delivery.ID}
+	})
+	return deliveries, next, nil
+}
+
+// Emit raises an event for the endpoints subscribed to its type. An event
+// emitted again under the same dedup key is dropped. A nil service emits
+// nothing.
+func (s *WebhookService) Emit(eventType, dedupKey string, data map[string]interface{}) error {
+	if s == nil {
+		return nil
+	}
+	event := &models.WebhookEvent{EventType: eventType, Data: data}
+	created, err := s.webhookRepo.CreateEvent(event, eventType+"/"+dedupKey)
+	if err != nil {
+		return fmt.Errorf("failed to store %s event: %v", eventType, err)
+	}
+	if created {
+		log.Printf("webhooks: %s event %d raised for %s", eventType, event.ID, dedupKey)
+	}
+	return nil
+}
+
+// RunSender sends due deliveries every interval until ctx is cancelled.
+// Nothing is sent while the service drains or is in maintenance.
+func (s *WebhookService) RunSender(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if !s.jobService.Draining() && !s.maintenanceService.Enabled() {
+			if err := s.SendDue(ctx); err != nil {
+				log.Printf("webhooks: %v", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SendDue sends the deliveries due now. Each is claimed first, so instances
+// sending at once post it once.
+func (s *WebhookService) SendDue(ctx context.Context) error {
+	now := time.Now()
+	deliveries, err := s.webhookRepo.DueDeliveries(now, webhookSendBatch)
+	if err != nil {
+		return fmt.Errorf("failed to load due deliveries: %v", err)
+	}
+	for _, delivery := range deliveries {
+		if ctx.Err() != nil {
+			return nil
+		}
+		claimed, err := s.webhookRepo.ClaimDelivery(delivery.ID, now, time.Now().Add(2*s.config.Timeout))
+		if err != nil {
+			return fmt.Errorf("failed to claim delivery %d: %v", delivery.ID, err)
+		}
+		if !claimed {
+			continue
+		}
+		s.send(ctx, delivery)
+		if err := s.webhookRepo.RecordAttempt(delivery); err != nil {
+			return fmt.Errorf("failed to record delivery %d: %v", delivery.ID, err)
+		}
+	}
+	return nil
+}
+
+// send posts a delivery once and records the outcome on it
+func (s *WebhookService) send(ctx context.Context, delivery *models.WebhookDelivery) {
+	delivery.Attempts++
+	status, err := s.post(ctx, delivery)
+	delivery.LastStatus = status
+	now := time.Now()
+	if err == nil {
+		delivery.Status = models.WebhookDeliveryDelivered
+		delivery.LastError = ""
+		delivery.NextAttemptAt = nil
+		delivery.DeliveredAt = &now
+		return
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= s.config.MaxAttempts {
+		delivery.Status = models.WebhookDeliveryFailed
+		delivery.NextAttemptAt = nil
+		log.Printf("webhooks: delivery %d of %s event %d to endpoint %d failed after %d attempts: %v",
+			delivery.ID, delivery.Event.EventType, delivery.EventID, delivery.EndpointID, delivery.Attempts, err)
+		return
+	}
+	backoff := s.config.RetryBackoff << (delivery.Attempts - 1)
+	if backoff <= 0 || backoff > maxWebhookBackoff {
+		backoff = maxWebhookBackoff
+	}
+	next := now.Add(backoff)
+	delivery.NextAttemptAt = &next
+}
+
+// post sends a delivery's event to its endpoint and returns the status the
+// endpoint answered with. The body is signed as
+// HMAC-SHA256(secret, timestamp + "." + body), so a receiver can refuse a
+// replayed delivery by its timestamp.
+func (s *WebhookService) post(ctx context.Context, delivery *models.WebhookDelivery) (int, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"id":         delivery.EventID,
+		"type":       delivery.Event.EventType,
+		"created_at": delivery.Event.CreatedAt,
+		"data":       delivery.Event.Data,
+	})
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(delivery.Secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", delivery.Event.EventType)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	answer, _ := io.ReadAll(io.LimitReader(resp.Body, webhookErrorBody))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		if detail := strings.TrimSpace(string(answer)); detail != "" {
+			return resp.StatusCode, fmt.Errorf("endpoint answered %d: %s", resp.StatusCode, detail)
+		}
+		return resp.StatusCode, fmt.Errorf("endpoint answered %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
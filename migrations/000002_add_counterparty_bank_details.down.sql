@@ -0,0 +1,10 @@
+ALTER TABLE accounting_entries
+    DROP INDEX idx_counterparty_iban,
+    DROP COLUMN counterparty_iban;
+
+ALTER TABLE bank_transactions
+    DROP INDEX idx_counterparty_iban,
+    DROP COLUMN counterparty_bank_country,
+    DROP COLUMN counterparty_bank_name,
+    DROP COLUMN counterparty_bic,
+    DROP COLUMN counterparty_iban;
@@ -0,0 +1,8 @@
+ALTER TABLE accounting_entries
+    DROP INDEX idx_creditor_reference,
+    DROP COLUMN creditor_reference;
+
+ALTER TABLE bank_transactions
+    DROP INDEX idx_creditor_reference,
+    DROP COLUMN creditor_reference,
+    DROP COLUMN remittance_information;
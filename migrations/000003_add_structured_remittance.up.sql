@@ -0,0 +1,9 @@
+-- ISO 20022 remittance information and ISO 11649 creditor references
+ALTER TABLE bank_transactions
+    ADD COLUMN remittance_information TEXT,
+    ADD COLUMN creditor_reference VARCHAR(25) NOT NULL DEFAULT '',
+    ADD INDEX idx_creditor_reference (creditor_reference);
+
+ALTER TABLE accounting_entries
+    ADD COLUMN creditor_reference VARCHAR(25) NOT NULL DEFAULT '',
+    ADD INDEX idx_creditor_reference (creditor_reference);
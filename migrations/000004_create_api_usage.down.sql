@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS api_quotas;
+DROP TABLE IF EXISTS api_usage;
@@ -0,0 +1,20 @@
+-- Monthly API usage per calling entity (API key or tenant)
+CREATE TABLE IF NOT EXISTS api_usage (
+    entity VARCHAR(100) NOT NULL,
+    period CHAR(7) NOT NULL,
+    requests BIGINT NOT NULL DEFAULT 0,
+    rows_ingested BIGINT NOT NULL DEFAULT 0,
+    batches_run BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (entity, period),
+    INDEX idx_period (period)
+);
+
+-- Per-entity monthly quota overrides; 0 means unlimited
+CREATE TABLE IF NOT EXISTS api_quotas (
+    entity VARCHAR(100) PRIMARY KEY,
+    max_requests BIGINT NOT NULL DEFAULT 0,
+    max_rows_ingested BIGINT NOT NULL DEFAULT 0,
+    max_batches BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
@@ -0,0 +1,12 @@
+-- Single-row switch shared by all service instances
+CREATE TABLE IF NOT EXISTS maintenance_mode (
+    id TINYINT PRIMARY KEY,
+    enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    message VARCHAR(500) NOT NULL DEFAULT '',
+    retry_after_seconds INT NOT NULL DEFAULT 300,
+    updated_by VARCHAR(100) NOT NULL DEFAULT '',
+    enabled_at TIMESTAMP NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+INSERT INTO maintenance_mode (id, enabled) VALUES (1, FALSE);
@@ -0,0 +1,17 @@
+-- Units of background or long-running work, used for draining and resuming
+CREATE TABLE IF NOT EXISTS reconciliation_jobs (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    job_type VARCHAR(50) NOT NULL,
+    reconciliation_batch_id VARCHAR(100) NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL,
+    from_date DATE NULL,
+    to_date DATE NULL,
+    instance_id VARCHAR(100) NOT NULL DEFAULT '',
+    checkpoint JSON,
+    error TEXT,
+    started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX idx_job_status (status),
+    INDEX idx_job_batch (reconciliation_batch_id)
+);
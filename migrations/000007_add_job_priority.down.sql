@@ -0,0 +1,4 @@
+ALTER TABLE reconciliation_jobs
+    DROP INDEX idx_job_queue,
+    DROP COLUMN queued_at,
+    DROP COLUMN priority;
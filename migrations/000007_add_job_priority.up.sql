@@ -0,0 +1,4 @@
+ALTER TABLE reconciliation_jobs
+    ADD COLUMN priority INT NOT NULL DEFAULT 0,
+    ADD COLUMN queued_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    ADD INDEX idx_job_queue (status, job_type, priority, id);
@@ -0,0 +1,24 @@
+-- Immutable period-end copies of the reconciliation state
+CREATE TABLE IF NOT EXISTS reconciliation_snapshots (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    snapshot_id VARCHAR(100) UNIQUE NOT NULL,
+    period_from DATE NOT NULL,
+    period_to DATE NOT NULL,
+    label VARCHAR(255) NOT NULL DEFAULT '',
+    created_by VARCHAR(100) NOT NULL DEFAULT '',
+    summary JSON NOT NULL,
+    items LONGTEXT NOT NULL,
+    checksum CHAR(64) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_snapshot_period (period_from, period_to)
+);
+
+CREATE TRIGGER trg_reconciliation_snapshots_no_update
+BEFORE UPDATE ON reconciliation_snapshots
+FOR EACH ROW
+SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'reconciliation snapshots are immutable';
+
+CREATE TRIGGER trg_reconciliation_snapshots_no_delete
+BEFORE DELETE ON reconciliation_snapshots
+FOR EACH ROW
+SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'reconciliation snapshots are immutable';
@@ -0,0 +1,11 @@
+-- Saved custom report definitions, executed on demand for a period
+CREATE TABLE IF NOT EXISTS report_definitions (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    name VARCHAR(255) UNIQUE NOT NULL,
+    description TEXT,
+    source VARCHAR(50) NOT NULL,
+    definition JSON NOT NULL,
+    created_by VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS calendar_holidays;
+DROP TABLE IF EXISTS business_calendars;
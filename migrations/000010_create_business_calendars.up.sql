@@ -0,0 +1,20 @@
+-- Business calendars used for date tolerances and SLA calculations
+CREATE TABLE IF NOT EXISTS business_calendars (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    code VARCHAR(50) UNIQUE NOT NULL,
+    country CHAR(2) NOT NULL,
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    weekend_days JSON NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS calendar_holidays (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    calendar_id BIGINT NOT NULL,
+    holiday_date DATE NOT NULL,
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_calendar_holiday (calendar_id, holiday_date),
+    FOREIGN KEY (calendar_id) REFERENCES business_calendars(id) ON DELETE CASCADE
+);
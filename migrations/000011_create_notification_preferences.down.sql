@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS notification_subscriptions;
+DROP TABLE IF EXISTS notification_settings;
@@ -0,0 +1,20 @@
+-- Per-operator notification settings and event subscriptions
+CREATE TABLE IF NOT EXISTS notification_settings (
+    user_id VARCHAR(100) PRIMARY KEY,
+    email VARCHAR(255) NOT NULL DEFAULT '',
+    webhook_url VARCHAR(1024) NOT NULL DEFAULT '',
+    locale VARCHAR(10) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS notification_subscriptions (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    user_id VARCHAR(100) NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    channel VARCHAR(20) NOT NULL,
+    delivery VARCHAR(20) NOT NULL,
+    UNIQUE KEY uq_notification_subscription (user_id, event_type, channel),
+    INDEX idx_subscription_event (event_type),
+    FOREIGN KEY (user_id) REFERENCES notification_settings(user_id) ON DELETE CASCADE
+);
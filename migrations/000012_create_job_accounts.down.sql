@@ -0,0 +1,2 @@
+ALTER TABLE reconciliation_jobs DROP INDEX idx_job_running_range;
+DROP TABLE IF EXISTS reconciliation_job_accounts;
@@ -0,0 +1,12 @@
+-- Bank accounts a running reconciliation job has locked for its date range.
+-- '*' locks every account.
+CREATE TABLE IF NOT EXISTS reconciliation_job_accounts (
+    job_id BIGINT NOT NULL,
+    account_number VARCHAR(50) NOT NULL,
+    PRIMARY KEY (job_id, account_number),
+    INDEX idx_job_account (account_number),
+    FOREIGN KEY (job_id) REFERENCES reconciliation_jobs(id) ON DELETE CASCADE
+);
+
+ALTER TABLE reconciliation_jobs
+    ADD INDEX idx_job_running_range (status, from_date, to_date);
@@ -0,0 +1,7 @@
+ALTER TABLE accounting_entries
+    DROP INDEX idx_end_to_end_id,
+    DROP COLUMN end_to_end_id;
+
+ALTER TABLE bank_transactions
+    DROP INDEX idx_end_to_end_id,
+    DROP COLUMN end_to_end_id;
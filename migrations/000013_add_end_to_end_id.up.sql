@@ -0,0 +1,9 @@
+-- ISO 20022 end-to-end identification, set by the payer and carried unchanged
+-- through to the statement
+ALTER TABLE bank_transactions
+    ADD COLUMN end_to_end_id VARCHAR(35) NOT NULL DEFAULT '',
+    ADD INDEX idx_end_to_end_id (end_to_end_id);
+
+ALTER TABLE accounting_entries
+    ADD COLUMN end_to_end_id VARCHAR(35) NOT NULL DEFAULT '',
+    ADD INDEX idx_end_to_end_id (end_to_end_id);
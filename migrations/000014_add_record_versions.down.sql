@@ -0,0 +1,8 @@
+ALTER TABLE reconciliations
+    DROP COLUMN version;
+
+ALTER TABLE accounting_entries
+    DROP COLUMN version;
+
+ALTER TABLE bank_transactions
+    DROP COLUMN version;
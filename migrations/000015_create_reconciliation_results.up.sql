@@ -0,0 +1,10 @@
+-- Full per-item results of every batch, so responses can cap what they return
+-- inline and point to a paginated endpoint for the rest
+CREATE TABLE IF NOT EXISTS reconciliation_results (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    reconciliation_batch_id VARCHAR(100) NOT NULL,
+    kind ENUM('match', 'unmatched') NOT NULL,
+    payload JSON NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_result_batch_kind (reconciliation_batch_id, kind, id)
+);
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS trg_reconciliation_batch_deltas_no_delete;
+DROP TRIGGER IF EXISTS trg_reconciliation_batch_deltas_no_update;
+DROP TABLE IF EXISTS reconciliation_batch_deltas;
@@ -0,0 +1,23 @@
+-- What each manual change did to an already persisted batch, so reports
+-- regenerated after sign-off show how the numbers moved
+CREATE TABLE IF NOT EXISTS reconciliation_batch_deltas (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    reconciliation_batch_id VARCHAR(100) NOT NULL,
+    action VARCHAR(50) NOT NULL,
+    user_id VARCHAR(100) NOT NULL DEFAULT '',
+    changes JSON NOT NULL,
+    summary_before JSON NOT NULL,
+    summary_after JSON NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_delta_batch (reconciliation_batch_id, id)
+);
+
+CREATE TRIGGER trg_reconciliation_batch_deltas_no_update
+BEFORE UPDATE ON reconciliation_batch_deltas
+FOR EACH ROW
+SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'batch deltas are immutable';
+
+CREATE TRIGGER trg_reconciliation_batch_deltas_no_delete
+BEFORE DELETE ON reconciliation_batch_deltas
+FOR EACH ROW
+SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'batch deltas are immutable';
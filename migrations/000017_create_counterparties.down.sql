@@ -0,0 +1,14 @@
+ALTER TABLE accounting_entries
+    DROP FOREIGN KEY fk_accounting_counterparty,
+    DROP INDEX idx_accounting_counterparty,
+    DROP COLUMN counterparty_id;
+
+ALTER TABLE bank_transactions
+    DROP FOREIGN KEY fk_bank_counterparty,
+    DROP INDEX idx_bank_counterparty,
+    DROP COLUMN counterparty_id;
+
+DROP TABLE IF EXISTS counterparty_accounts;
+DROP TABLE IF EXISTS counterparty_ibans;
+DROP TABLE IF EXISTS counterparty_aliases;
+DROP TABLE IF EXISTS counterparties;
@@ -0,0 +1,45 @@
+-- Counterparty master data: who pays and gets paid, under which names and
+-- accounts, how late their payments usually arrive and where they are booked
+CREATE TABLE IF NOT EXISTS counterparties (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    code VARCHAR(50) UNIQUE NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    expected_lag_days INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+-- Aliases are stored normalized; each names at most one counterparty
+CREATE TABLE IF NOT EXISTS counterparty_aliases (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    counterparty_id BIGINT NOT NULL,
+    alias VARCHAR(255) NOT NULL,
+    UNIQUE KEY uq_counterparty_alias (alias),
+    FOREIGN KEY (counterparty_id) REFERENCES counterparties(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS counterparty_ibans (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    counterparty_id BIGINT NOT NULL,
+    iban VARCHAR(34) NOT NULL,
+    UNIQUE KEY uq_counterparty_iban (iban),
+    FOREIGN KEY (counterparty_id) REFERENCES counterparties(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS counterparty_accounts (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    counterparty_id BIGINT NOT NULL,
+    account_code VARCHAR(50) NOT NULL,
+    UNIQUE KEY uq_counterparty_account (counterparty_id, account_code),
+    FOREIGN KEY (counterparty_id) REFERENCES counterparties(id) ON DELETE CASCADE
+);
+
+ALTER TABLE bank_transactions
+    ADD COLUMN counterparty_id BIGINT NULL AFTER counterparty_bank_country,
+    ADD INDEX idx_bank_counterparty (counterparty_id),
+    ADD CONSTRAINT fk_bank_counterparty FOREIGN KEY (counterparty_id) REFERENCES counterparties(id) ON DELETE SET NULL;
+
+ALTER TABLE accounting_entries
+    ADD COLUMN counterparty_id BIGINT NULL AFTER counterparty_iban,
+    ADD INDEX idx_accounting_counterparty (counterparty_id),
+    ADD CONSTRAINT fk_accounting_counterparty FOREIGN KEY (counterparty_id) REFERENCES counterparties(id) ON DELETE SET NULL;
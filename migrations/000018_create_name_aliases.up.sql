@@ -0,0 +1,17 @@
+-- Alias dictionary applied when normalizing descriptions and counterparty
+-- names: every occurrence of alias is read as canonical. Both are stored
+-- normalized. Aliases confirmed from a reviewed match keep the pair they came
+-- from.
+CREATE TABLE IF NOT EXISTS name_aliases (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    alias VARCHAR(255) NOT NULL,
+    canonical VARCHAR(255) NOT NULL,
+    source ENUM('manual', 'suggestion_review') NOT NULL DEFAULT 'manual',
+    user_id VARCHAR(100) NOT NULL DEFAULT '',
+    bank_transaction_id BIGINT NULL,
+    accounting_entry_id BIGINT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_name_alias (alias),
+    FOREIGN KEY (bank_transaction_id) REFERENCES bank_transactions(id) ON DELETE SET NULL,
+    FOREIGN KEY (accounting_entry_id) REFERENCES accounting_entries(id) ON DELETE SET NULL
+);
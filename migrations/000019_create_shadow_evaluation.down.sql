@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS shadow_matches;
+DROP TABLE IF EXISTS shadow_runs;
+DROP TABLE IF EXISTS shadow_candidates;
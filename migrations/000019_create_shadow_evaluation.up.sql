@@ -0,0 +1,45 @@
+-- Candidate matching rule sets run in shadow next to the production rules.
+-- rules holds the complete rule set, defaults filled in.
+CREATE TABLE IF NOT EXISTS shadow_candidates (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    version VARCHAR(50) NOT NULL,
+    rules JSON NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_shadow_candidate_version (version)
+);
+
+-- One evaluation of a candidate on the inputs of a batch, with how its
+-- matches compare to the ones the batch kept
+CREATE TABLE IF NOT EXISTS shadow_runs (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    reconciliation_batch_id VARCHAR(50) NOT NULL,
+    candidate_version VARCHAR(50) NOT NULL,
+    rules JSON NOT NULL,
+    production_matches INT NOT NULL DEFAULT 0,
+    shadow_matches INT NOT NULL DEFAULT 0,
+    agreed INT NOT NULL DEFAULT 0,
+    confidence_changed INT NOT NULL DEFAULT 0,
+    production_only INT NOT NULL DEFAULT 0,
+    shadow_only INT NOT NULL DEFAULT 0,
+    agreement_rate DECIMAL(5,4) NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_shadow_runs_batch (reconciliation_batch_id),
+    INDEX idx_shadow_runs_candidate (candidate_version, created_at)
+);
+
+-- The would-be matches of a shadow run. They are never mapped, so the
+-- records stay unreconciled whatever the candidate decided.
+CREATE TABLE IF NOT EXISTS shadow_matches (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    shadow_run_id BIGINT NOT NULL,
+    match_type ENUM('one_to_one', 'one_to_many', 'many_to_one') NOT NULL,
+    confidence DECIMAL(5,2) NOT NULL,
+    amount_difference DECIMAL(15,2) NOT NULL DEFAULT 0,
+    bank_transaction_ids JSON NOT NULL,
+    accounting_entry_ids JSON NOT NULL,
+    match_criteria JSON,
+    agreement ENUM('agreed', 'shadow_only') NOT NULL,
+    INDEX idx_shadow_matches_run (shadow_run_id, agreement),
+    FOREIGN KEY (shadow_run_id) REFERENCES shadow_runs(id) ON DELETE CASCADE
+);
@@ -0,0 +1,24 @@
+-- Every mutating API request as received: who sent it, a sanitized copy of
+-- its payload and the resources it touched. Kept apart from the business
+-- audits in reconciliation_audit and purged after the retention period.
+CREATE TABLE IF NOT EXISTS request_audits (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    method VARCHAR(10) NOT NULL,
+    route VARCHAR(255) NOT NULL,
+    path VARCHAR(2048) NOT NULL,
+    user_id VARCHAR(255) NOT NULL DEFAULT '',
+    caller VARCHAR(255) NOT NULL,
+    remote_addr VARCHAR(100) NOT NULL DEFAULT '',
+    user_agent VARCHAR(255) NOT NULL DEFAULT '',
+    content_type VARCHAR(255) NOT NULL DEFAULT '',
+    payload MEDIUMTEXT,
+    payload_bytes BIGINT NOT NULL DEFAULT 0,
+    payload_sha256 CHAR(64) NOT NULL,
+    payload_truncated BOOLEAN NOT NULL DEFAULT FALSE,
+    resource_ids JSON,
+    status_code INT NOT NULL,
+    duration_ms BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_request_audits_created (created_at),
+    INDEX idx_request_audits_user (user_id, created_at)
+);
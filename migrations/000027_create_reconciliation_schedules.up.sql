@@ -0,0 +1,34 @@
+-- Reconciliations started by the internal scheduler. Each schedule fires on
+-- its cron expression, evaluated in its time zone, and reconciles the period
+-- before the firing (the previous day or week).
+CREATE TABLE IF NOT EXISTS reconciliation_schedules (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    name VARCHAR(100) NOT NULL,
+    cron_expression VARCHAR(100) NOT NULL,
+    period VARCHAR(20) NOT NULL,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    next_run_at TIMESTAMP NULL,
+    last_run_at TIMESTAMP NULL,
+    updated_by VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_reconciliation_schedule_name (name),
+    INDEX idx_schedules_due (enabled, next_run_at)
+);
+
+-- One row per firing of a schedule, kept after the schedule is deleted
+CREATE TABLE IF NOT EXISTS schedule_runs (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    schedule_id BIGINT NOT NULL,
+    scheduled_for TIMESTAMP NOT NULL,
+    from_date DATE NOT NULL,
+    to_date DATE NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    job_id BIGINT NULL,
+    reconciliation_batch_id VARCHAR(100) NOT NULL DEFAULT '',
+    error TEXT,
+    started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP NULL,
+    INDEX idx_schedule_runs_schedule (schedule_id, id)
+);
@@ -0,0 +1,21 @@
+-- Exports too large to stream in a request. A worker writes the file to
+-- object storage under object_key; the client polls the job or is called
+-- back at callback_url with a signed download link.
+CREATE TABLE IF NOT EXISTS export_jobs (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    kind VARCHAR(50) NOT NULL,
+    format VARCHAR(10) NOT NULL,
+    params JSON NOT NULL,
+    locale VARCHAR(20) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    callback_url VARCHAR(2048) NOT NULL DEFAULT '',
+    requested_by VARCHAR(100) NOT NULL DEFAULT '',
+    instance_id VARCHAR(100) NOT NULL DEFAULT '',
+    object_key VARCHAR(255) NOT NULL DEFAULT '',
+    size_bytes BIGINT NOT NULL DEFAULT 0,
+    error TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP NULL,
+    finished_at TIMESTAMP NULL,
+    INDEX idx_export_jobs_status (status, id)
+);
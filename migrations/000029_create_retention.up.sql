@@ -0,0 +1,35 @@
+-- How long each class of data is kept before the retention purger deletes
+-- it; 0 keeps it forever
+CREATE TABLE IF NOT EXISTS retention_policies (
+    data_class VARCHAR(50) PRIMARY KEY,
+    retention_days INT NOT NULL,
+    updated_by VARCHAR(100) NOT NULL DEFAULT '',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+INSERT INTO retention_policies (data_class, retention_days) VALUES
+    ('results', 90),
+    ('audit', 2555),
+    ('exports', 730);
+
+-- Legal holds exempt a batch, or everything of a tenant, from purging
+CREATE TABLE IF NOT EXISTS legal_holds (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    scope VARCHAR(20) NOT NULL,
+    scope_id VARCHAR(255) NOT NULL,
+    reason VARCHAR(500) NOT NULL DEFAULT '',
+    created_by VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_legal_hold_scope (scope, scope_id)
+);
+
+-- One row per purge or dry run, with what each data class had expired
+CREATE TABLE IF NOT EXISTS retention_runs (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    dry_run BOOLEAN NOT NULL,
+    triggered_by VARCHAR(100) NOT NULL DEFAULT '',
+    report JSON NOT NULL,
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP NOT NULL,
+    INDEX idx_retention_runs_started (started_at)
+);
@@ -0,0 +1,7 @@
+DELETE FROM reconciliation_mappings WHERE mapping_type = 'fee';
+
+ALTER TABLE reconciliation_mappings
+    MODIFY mapping_type ENUM('one_to_one', 'one_to_many', 'many_to_one') NOT NULL;
+
+DROP TABLE IF EXISTS fee_charges;
+DROP TABLE IF EXISTS fee_schedules;
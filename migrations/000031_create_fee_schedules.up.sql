@@ -0,0 +1,42 @@
+-- Fees a bank charges an account under its contract: a flat monthly
+-- maintenance fee, or a fee for every transaction on the account. Debits of
+-- the account whose description contains description_pattern are the fee;
+-- amount is what the contract charges, tolerance how far a period's charges
+-- may stray from it.
+CREATE TABLE IF NOT EXISTS fee_schedules (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    account_number VARCHAR(50) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    fee_type ENUM('monthly', 'per_transaction') NOT NULL,
+    amount DECIMAL(15,2) NOT NULL,
+    currency CHAR(3) NOT NULL DEFAULT '',
+    tolerance DECIMAL(15,2) NOT NULL DEFAULT 0,
+    description_pattern VARCHAR(255) NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    updated_by VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_fee_schedule (account_number, name)
+);
+
+-- Bank debits recognized as the fee of a schedule, by the month (YYYY-MM)
+-- they were charged in. A fee with no accounting entry is classified by a
+-- reconciliation of its own, mapped with type 'fee'.
+CREATE TABLE IF NOT EXISTS fee_charges (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    fee_schedule_id BIGINT NOT NULL,
+    bank_transaction_id BIGINT NOT NULL,
+    period CHAR(7) NOT NULL,
+    amount DECIMAL(15,2) NOT NULL,
+    reconciliation_id BIGINT NULL,
+    batch_id VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_fee_charge_transaction (bank_transaction_id),
+    INDEX idx_fee_charges_period (period, fee_schedule_id),
+    FOREIGN KEY (fee_schedule_id) REFERENCES fee_schedules(id) ON DELETE CASCADE,
+    FOREIGN KEY (bank_transaction_id) REFERENCES bank_transactions(id) ON DELETE CASCADE,
+    FOREIGN KEY (reconciliation_id) REFERENCES reconciliations(id) ON DELETE SET NULL
+);
+
+ALTER TABLE reconciliation_mappings
+    MODIFY mapping_type ENUM('one_to_one', 'one_to_many', 'many_to_one', 'fee') NOT NULL;
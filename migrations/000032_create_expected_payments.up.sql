@@ -0,0 +1,28 @@
+-- Payments upstream systems expect to see on a bank account: an amount in a
+-- direction, due between two dates, identified by a reference. Batches match
+-- bank transactions against open expectations before matching the ledger;
+-- one still pending after its window is marked missed.
+CREATE TABLE IF NOT EXISTS expected_payments (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    source VARCHAR(100) NOT NULL DEFAULT '',
+    external_id VARCHAR(100) NOT NULL,
+    direction ENUM('incoming', 'outgoing') NOT NULL,
+    account_number VARCHAR(50) NOT NULL DEFAULT '',
+    amount DECIMAL(15,2) NOT NULL,
+    currency CHAR(3) NOT NULL DEFAULT '',
+    reference VARCHAR(255) NOT NULL,
+    window_start DATE NOT NULL,
+    window_end DATE NOT NULL,
+    status ENUM('pending', 'matched', 'missed', 'cancelled') NOT NULL DEFAULT 'pending',
+    bank_transaction_id BIGINT NULL,
+    batch_id VARCHAR(100) NOT NULL DEFAULT '',
+    matched_at TIMESTAMP NULL,
+    missed_at TIMESTAMP NULL,
+    created_by VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_expected_payment (source, external_id),
+    UNIQUE KEY uq_expected_payment_transaction (bank_transaction_id),
+    INDEX idx_expected_payments_window (status, window_start, window_end),
+    FOREIGN KEY (bank_transaction_id) REFERENCES bank_transactions(id) ON DELETE SET NULL
+);
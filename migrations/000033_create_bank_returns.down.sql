@@ -0,0 +1,10 @@
+DELETE FROM reconciliation_mappings WHERE mapping_type = 'return';
+
+ALTER TABLE reconciliation_mappings
+    MODIFY mapping_type ENUM('one_to_one', 'one_to_many', 'many_to_one', 'fee') NOT NULL;
+
+DROP TABLE IF EXISTS bank_returns;
+
+ALTER TABLE bank_transactions
+    DROP COLUMN return_reason,
+    DROP COLUMN reversal;
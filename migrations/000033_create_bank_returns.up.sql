@@ -0,0 +1,28 @@
+-- Returns and reversals (R-transactions) as the bank reports them: the
+-- reversal indicator of the booking and the ISO 20022 return reason code
+ALTER TABLE bank_transactions
+    ADD COLUMN reversal BOOLEAN NOT NULL DEFAULT FALSE AFTER end_to_end_id,
+    ADD COLUMN return_reason VARCHAR(35) NOT NULL DEFAULT '' AFTER reversal;
+
+-- A return linked to the transaction it returns. action records what was
+-- done to the original's match: unmatched, flagged as disputed, left alone
+-- because of a legal hold, or none to undo when the pair was never matched.
+CREATE TABLE IF NOT EXISTS bank_returns (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    return_transaction_id BIGINT NOT NULL,
+    original_transaction_id BIGINT NOT NULL,
+    reconciliation_id BIGINT NULL,
+    reason_code VARCHAR(35) NOT NULL DEFAULT '',
+    action ENUM('unmatched', 'flagged', 'held', 'paired') NOT NULL,
+    batch_id VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_bank_return (return_transaction_id),
+    UNIQUE KEY uq_bank_return_original (original_transaction_id),
+    INDEX idx_bank_returns_created (created_at),
+    FOREIGN KEY (return_transaction_id) REFERENCES bank_transactions(id) ON DELETE CASCADE,
+    FOREIGN KEY (original_transaction_id) REFERENCES bank_transactions(id) ON DELETE CASCADE,
+    FOREIGN KEY (reconciliation_id) REFERENCES reconciliations(id) ON DELETE SET NULL
+);
+
+ALTER TABLE reconciliation_mappings
+    MODIFY mapping_type ENUM('one_to_one', 'one_to_many', 'many_to_one', 'fee', 'return') NOT NULL;
@@ -0,0 +1,16 @@
+-- Budget and forecast figures finance uploads per bank account and month:
+-- the net cash movement expected on the account in the period, credits
+-- positive and debits negative, compared with the bank transactions booked
+CREATE TABLE IF NOT EXISTS budgets (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    account_number VARCHAR(50) NOT NULL,
+    period CHAR(7) NOT NULL,
+    kind ENUM('budget', 'forecast') NOT NULL DEFAULT 'budget',
+    amount DECIMAL(15,2) NOT NULL,
+    currency CHAR(3) NOT NULL DEFAULT '',
+    updated_by VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_budget (account_number, period, kind),
+    INDEX idx_budgets_period (period, kind)
+);
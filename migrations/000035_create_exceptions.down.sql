@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS exception_events;
+DROP TABLE IF EXISTS reconciliation_exceptions;
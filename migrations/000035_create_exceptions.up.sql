@@ -0,0 +1,38 @@
+-- Suspense queue: bank transactions and accounting entries left unmatched
+-- longer than the configured age, worked through a fixed set of states by an
+-- owner. The record's amount and date are copied so the queue reads without
+-- joining both record tables.
+CREATE TABLE IF NOT EXISTS reconciliation_exceptions (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    record_type ENUM('bank_transaction', 'accounting_entry') NOT NULL,
+    record_id BIGINT NOT NULL,
+    reference VARCHAR(100) NOT NULL DEFAULT '',
+    account VARCHAR(50) NOT NULL DEFAULT '',
+    amount DECIMAL(15,2) NOT NULL,
+    currency CHAR(3) NOT NULL DEFAULT '',
+    record_date DATE NOT NULL,
+    status ENUM('new', 'investigating', 'escalated', 'written_off', 'resolved') NOT NULL DEFAULT 'new',
+    owner VARCHAR(100) NOT NULL DEFAULT '',
+    version INT NOT NULL DEFAULT 1,
+    closed_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_exception_record (record_type, record_id),
+    INDEX idx_exceptions_status (status, owner)
+);
+
+-- Audit trail of an exception: its creation, every transition, assignment
+-- and comment
+CREATE TABLE IF NOT EXISTS exception_events (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    exception_id BIGINT NOT NULL,
+    action ENUM('created', 'transitioned', 'assigned', 'commented') NOT NULL,
+    status_before VARCHAR(20) NOT NULL DEFAULT '',
+    status_after VARCHAR(20) NOT NULL DEFAULT '',
+    owner VARCHAR(100) NOT NULL DEFAULT '',
+    comment TEXT,
+    user_id VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_exception_events (exception_id, id),
+    FOREIGN KEY (exception_id) REFERENCES reconciliation_exceptions(id) ON DELETE CASCADE
+);
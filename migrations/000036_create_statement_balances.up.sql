@@ -0,0 +1,14 @@
+-- Closing booked balances of ingested bank statements, one per account and
+-- day; a later statement for the same day replaces the figure. Cash position
+-- reporting starts from the latest of them.
+CREATE TABLE IF NOT EXISTS statement_balances (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    account_number VARCHAR(50) NOT NULL,
+    balance_date DATE NOT NULL,
+    balance DECIMAL(15,2) NOT NULL,
+    currency CHAR(3) NOT NULL DEFAULT '',
+    source VARCHAR(20) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_statement_balance (account_number, balance_date)
+);
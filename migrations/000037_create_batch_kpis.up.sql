@@ -0,0 +1,14 @@
+-- Tenant-defined summary figures of each batch, evaluated when it finishes
+-- with the definitions then configured. A NULL value is a KPI undefined for
+-- the batch, such as a share of nothing.
+CREATE TABLE IF NOT EXISTS batch_kpis (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    reconciliation_batch_id VARCHAR(100) NOT NULL,
+    tenant VARCHAR(100) NOT NULL DEFAULT '',
+    name VARCHAR(64) NOT NULL,
+    label VARCHAR(255) NOT NULL,
+    expression TEXT NOT NULL,
+    value DECIMAL(24,4) NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_batch_kpi (reconciliation_batch_id, name)
+);
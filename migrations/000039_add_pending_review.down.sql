@@ -0,0 +1,10 @@
+UPDATE reconciliation_audit SET action = 'resolved' WHERE action IN ('approved', 'rejected');
+
+ALTER TABLE reconciliation_audit
+    MODIFY action ENUM('created', 'matched', 'unmatched', 'disputed', 'resolved') NOT NULL;
+
+-- Matches still awaiting review stay out of the matched totals as disputed
+UPDATE reconciliations SET status = 'disputed' WHERE status = 'pending_review';
+
+ALTER TABLE reconciliations
+    MODIFY status ENUM('matched', 'unmatched', 'disputed') NOT NULL;
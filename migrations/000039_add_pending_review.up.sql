@@ -0,0 +1,7 @@
+-- Matches below the review confidence wait as pending_review, still holding
+-- their records, until a reviewer approves or rejects them
+ALTER TABLE reconciliations
+    MODIFY status ENUM('matched', 'unmatched', 'disputed', 'pending_review') NOT NULL;
+
+ALTER TABLE reconciliation_audit
+    MODIFY action ENUM('created', 'matched', 'unmatched', 'disputed', 'resolved', 'approved', 'rejected') NOT NULL;
@@ -0,0 +1,15 @@
+-- What a batch matched and left unmatched on each bank account and ledger
+-- account code, stored with the batch so a bad run can be traced to the
+-- account behind it. Amounts are gross, in the base currency.
+CREATE TABLE IF NOT EXISTS batch_account_outcomes (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    reconciliation_batch_id VARCHAR(100) NOT NULL,
+    side ENUM('bank', 'ledger') NOT NULL,
+    account VARCHAR(50) NOT NULL,
+    matched_count INT NOT NULL DEFAULT 0,
+    matched_amount DECIMAL(20,2) NOT NULL DEFAULT 0,
+    unmatched_count INT NOT NULL DEFAULT 0,
+    unmatched_amount DECIMAL(20,2) NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_batch_account_outcome (reconciliation_batch_id, side, account)
+);
@@ -0,0 +1,7 @@
+UPDATE reconciliation_audit SET action = 'resolved' WHERE action = 'repaired';
+
+ALTER TABLE reconciliation_audit
+    MODIFY action ENUM('created', 'matched', 'unmatched', 'disputed', 'resolved', 'approved', 'rejected') NOT NULL;
+
+DROP TABLE IF EXISTS integrity_findings;
+DROP TABLE IF EXISTS integrity_runs;
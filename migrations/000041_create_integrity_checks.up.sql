@@ -0,0 +1,35 @@
+-- One row per pass of the mapping integrity checker, with how many of each
+-- kind of finding it made
+CREATE TABLE IF NOT EXISTS integrity_runs (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    triggered_by VARCHAR(100) NOT NULL DEFAULT '',
+    metrics JSON NOT NULL,
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP NOT NULL,
+    INDEX idx_integrity_runs_started (started_at)
+);
+
+-- Mappings that drifted from the records they tie together, each with the
+-- repair it takes. A later run supersedes the open findings of earlier ones.
+CREATE TABLE IF NOT EXISTS integrity_findings (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    run_id BIGINT NOT NULL,
+    kind ENUM('orphan_mapping', 'multiply_mapped', 'sum_mismatch') NOT NULL,
+    reconciliation_id BIGINT NULL,
+    mapping_id BIGINT NULL,
+    record_type ENUM('bank_transaction', 'accounting_entry') NULL,
+    record_id BIGINT NULL,
+    details JSON NOT NULL,
+    repair ENUM('delete_mapping', 'unmatch_duplicates', 'review_match') NOT NULL,
+    status ENUM('open', 'repaired', 'stale', 'superseded') NOT NULL DEFAULT 'open',
+    resolved_by VARCHAR(100) NOT NULL DEFAULT '',
+    resolved_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_integrity_findings_run (run_id, id),
+    INDEX idx_integrity_findings_status (status, kind),
+    FOREIGN KEY (run_id) REFERENCES integrity_runs(id) ON DELETE CASCADE
+);
+
+-- Repairs are recorded in the audit trail of the reconciliation they change
+ALTER TABLE reconciliation_audit
+    MODIFY action ENUM('created', 'matched', 'unmatched', 'disputed', 'resolved', 'approved', 'rejected', 'repaired') NOT NULL;
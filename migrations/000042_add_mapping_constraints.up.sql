@@ -0,0 +1,46 @@
+-- Mappings already reference their reconciliation, bank transaction and
+-- accounting entry by foreign key; these constraints close the gaps the keys
+-- leave. Rows that would break them are moved aside first, with the reason,
+-- for an operator to review: a mapping naming no record, and a repeat of an
+-- earlier mapping of the same reconciliation and pair.
+CREATE TABLE IF NOT EXISTS reconciliation_mappings_quarantine (
+    id BIGINT PRIMARY KEY,
+    reconciliation_id BIGINT NOT NULL,
+    bank_transaction_id BIGINT,
+    accounting_entry_id BIGINT,
+    mapping_type VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP NULL,
+    reason ENUM('no_record', 'duplicate') NOT NULL,
+    quarantined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO reconciliation_mappings_quarantine
+    (id, reconciliation_id, bank_transaction_id, accounting_entry_id, mapping_type, created_at, reason)
+SELECT id, reconciliation_id, bank_transaction_id, accounting_entry_id, mapping_type, created_at, 'no_record'
+FROM reconciliation_mappings
+WHERE bank_transaction_id IS NULL AND accounting_entry_id IS NULL;
+
+INSERT INTO reconciliation_mappings_quarantine
+    (id, reconciliation_id, bank_transaction_id, accounting_entry_id, mapping_type, created_at, reason)
+SELECT m.id, m.reconciliation_id, m.bank_transaction_id, m.accounting_entry_id, m.mapping_type, m.created_at, 'duplicate'
+FROM reconciliation_mappings m
+WHERE (m.bank_transaction_id IS NOT NULL OR m.accounting_entry_id IS NOT NULL)
+AND EXISTS (
+    SELECT 1 FROM reconciliation_mappings kept
+    WHERE kept.reconciliation_id = m.reconciliation_id
+      AND kept.bank_transaction_id <=> m.bank_transaction_id
+      AND kept.accounting_entry_id <=> m.accounting_entry_id
+      AND kept.id < m.id
+);
+
+DELETE m FROM reconciliation_mappings m
+JOIN reconciliation_mappings_quarantine q ON q.id = m.id;
+
+-- Every mapping names at least one record, and a reconciliation maps each
+-- pair once. A side left NULL (fees, returns) counts as 0 in the key, since
+-- NULLs never collide in a plain unique key.
+ALTER TABLE reconciliation_mappings
+    ADD CONSTRAINT chk_mapping_has_record
+        CHECK (bank_transaction_id IS NOT NULL OR accounting_entry_id IS NOT NULL),
+    ADD UNIQUE KEY uq_reconciliation_mapping
+        (reconciliation_id, (COALESCE(bank_transaction_id, 0)), (COALESCE(accounting_entry_id, 0)));
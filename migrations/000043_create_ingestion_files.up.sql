@@ -0,0 +1,20 @@
+-- Statement files fetched from SFTP, one row per distinct content. The
+-- checksum makes a file resent under another name, or fetched by two
+-- instances at once, ingest only once.
+CREATE TABLE IF NOT EXISTS ingestion_files (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    source VARCHAR(255) NOT NULL,
+    file_name VARCHAR(255) NOT NULL,
+    checksum CHAR(64) NOT NULL,
+    size BIGINT NOT NULL DEFAULT 0,
+    format VARCHAR(20) NOT NULL DEFAULT '',
+    status ENUM('processing', 'ingested', 'failed', 'rejected') NOT NULL DEFAULT 'processing',
+    records INT NOT NULL DEFAULT 0,
+    error TEXT NULL,
+    archived_path VARCHAR(1024) NOT NULL DEFAULT '',
+    job_id BIGINT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_ingestion_files_checksum (checksum),
+    INDEX idx_ingestion_files_status (status, id)
+);
@@ -0,0 +1,16 @@
+-- Objects pulled from S3-compatible buckets, by key and ETag, so a poll
+-- downloads only objects it has not processed. An object overwritten under
+-- the same key has a new ETag and is pulled again.
+CREATE TABLE IF NOT EXISTS ingestion_objects (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    bucket VARCHAR(63) NOT NULL,
+    object_key VARCHAR(1024) NOT NULL,
+    etag VARCHAR(100) NOT NULL,
+    -- SHA-256 of the bucket, key and ETag; the key is too long to index whole
+    object_hash CHAR(64) NOT NULL,
+    ingestion_file_id BIGINT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_ingestion_objects_hash (object_hash),
+    INDEX idx_ingestion_objects_key (bucket, object_key(255)),
+    FOREIGN KEY (ingestion_file_id) REFERENCES ingestion_files(id) ON DELETE CASCADE
+);
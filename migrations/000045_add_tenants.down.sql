@@ -0,0 +1,48 @@
+ALTER TABLE batch_account_outcomes
+    DROP INDEX idx_batch_account_outcomes_tenant_batch,
+    DROP COLUMN tenant_id;
+
+ALTER TABLE batch_kpis
+    DROP INDEX idx_batch_kpis_tenant_batch,
+    DROP COLUMN tenant_id;
+
+ALTER TABLE reconciliation_batch_deltas
+    DROP INDEX idx_reconciliation_batch_deltas_tenant_batch,
+    DROP COLUMN tenant_id;
+
+ALTER TABLE reconciliation_results
+    DROP INDEX idx_reconciliation_results_tenant_batch,
+    DROP COLUMN tenant_id;
+
+ALTER TABLE statement_balances
+    DROP INDEX uq_statement_balance,
+    ADD UNIQUE KEY uq_statement_balance (account_number, balance_date),
+    DROP COLUMN tenant_id;
+
+ALTER TABLE reconciliation_jobs
+    DROP INDEX idx_reconciliation_jobs_tenant_status,
+    DROP COLUMN tenant_id;
+
+ALTER TABLE reconciliation_audit
+    DROP INDEX idx_reconciliation_audit_tenant,
+    DROP COLUMN tenant_id;
+
+ALTER TABLE reconciliation_mappings
+    DROP INDEX idx_reconciliation_mappings_tenant,
+    DROP COLUMN tenant_id;
+
+ALTER TABLE reconciliations
+    DROP INDEX idx_reconciliations_tenant_batch,
+    DROP COLUMN tenant_id;
+
+ALTER TABLE accounting_entries
+    DROP INDEX idx_accounting_entries_tenant_date,
+    DROP INDEX uq_accounting_entry,
+    ADD UNIQUE KEY entry_id (entry_id),
+    DROP COLUMN tenant_id;
+
+ALTER TABLE bank_transactions
+    DROP INDEX idx_bank_transactions_tenant_date,
+    DROP INDEX uq_bank_transaction,
+    ADD UNIQUE KEY transaction_id (transaction_id),
+    DROP COLUMN tenant_id;
@@ -0,0 +1,50 @@
+-- Records of one tenant are kept apart from those of another. Everything
+-- stored before belongs to the default tenant.
+ALTER TABLE bank_transactions
+    ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' AFTER id,
+    DROP INDEX transaction_id,
+    ADD UNIQUE KEY uq_bank_transaction (tenant_id, transaction_id),
+    ADD INDEX idx_bank_transactions_tenant_date (tenant_id, transaction_date);
+
+ALTER TABLE accounting_entries
+    ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' AFTER id,
+    DROP INDEX entry_id,
+    ADD UNIQUE KEY uq_accounting_entry (tenant_id, entry_id),
+    ADD INDEX idx_accounting_entries_tenant_date (tenant_id, entry_date);
+
+ALTER TABLE reconciliations
+    ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' AFTER id,
+    ADD INDEX idx_reconciliations_tenant_batch (tenant_id, reconciliation_batch_id);
+
+ALTER TABLE reconciliation_mappings
+    ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' AFTER id,
+    ADD INDEX idx_reconciliation_mappings_tenant (tenant_id);
+
+ALTER TABLE reconciliation_audit
+    ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' AFTER id,
+    ADD INDEX idx_reconciliation_audit_tenant (tenant_id);
+
+ALTER TABLE reconciliation_jobs
+    ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' AFTER id,
+    ADD INDEX idx_reconciliation_jobs_tenant_status (tenant_id, status);
+
+ALTER TABLE statement_balances
+    ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' AFTER id,
+    DROP INDEX uq_statement_balance,
+    ADD UNIQUE KEY uq_statement_balance (tenant_id, account_number, balance_date);
+
+ALTER TABLE reconciliation_results
+    ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' AFTER id,
+    ADD INDEX idx_reconciliation_results_tenant_batch (tenant_id, reconciliation_batch_id);
+
+ALTER TABLE reconciliation_batch_deltas
+    ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' AFTER id,
+    ADD INDEX idx_reconciliation_batch_deltas_tenant_batch (tenant_id, reconciliation_batch_id);
+
+ALTER TABLE batch_kpis
+    ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' AFTER id,
+    ADD INDEX idx_batch_kpis_tenant_batch (tenant_id, reconciliation_batch_id);
+
+ALTER TABLE batch_account_outcomes
+    ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' AFTER id,
+    ADD INDEX idx_batch_account_outcomes_tenant_batch (tenant_id, reconciliation_batch_id);
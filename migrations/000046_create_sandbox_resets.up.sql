@@ -0,0 +1,16 @@
+-- Resets of the sandbox tenant's synthetic data. A nightly reset names the
+-- day it is for, so of several instances only one runs it; a reset asked
+-- for through the API names none.
+CREATE TABLE IF NOT EXISTS sandbox_resets (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    tenant_id VARCHAR(64) NOT NULL,
+    reset_date DATE NULL,
+    triggered_by VARCHAR(255) NOT NULL,
+    bank_transactions INT NOT NULL DEFAULT 0,
+    accounting_entries INT NOT NULL DEFAULT 0,
+    error TEXT NULL,
+    started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP NULL,
+    UNIQUE KEY uq_sandbox_reset_date (tenant_id, reset_date),
+    INDEX idx_sandbox_resets_tenant (tenant_id, id)
+);
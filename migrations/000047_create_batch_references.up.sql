@@ -0,0 +1,12 @@
+-- External references callers give their batches on start, so orchestration
+-- tools can follow a batch by their own correlation ID. A reference names
+-- one batch of its tenant, and a batch has at most one reference.
+CREATE TABLE IF NOT EXISTS batch_references (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    tenant_id VARCHAR(64) NOT NULL,
+    reconciliation_batch_id VARCHAR(100) NOT NULL,
+    external_reference VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_batch_reference (tenant_id, external_reference),
+    UNIQUE KEY uq_batch_reference_batch (tenant_id, reconciliation_batch_id)
+);
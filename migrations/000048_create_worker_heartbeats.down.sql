@@ -0,0 +1,5 @@
+ALTER TABLE reconciliation_jobs
+    DROP INDEX idx_job_heartbeat,
+    DROP COLUMN heartbeat_at;
+
+DROP TABLE IF EXISTS worker_heartbeats;
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS trg_snapshot_journals_no_delete;
+DROP TRIGGER IF EXISTS trg_snapshot_journals_no_update;
+DROP TABLE IF EXISTS snapshot_journals;
@@ -0,0 +1,21 @@
+-- Differences journals of period-end snapshots, as downloaded by auditors
+CREATE TABLE IF NOT EXISTS snapshot_journals (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    snapshot_id VARCHAR(100) UNIQUE NOT NULL,
+    line_count INT NOT NULL,
+    csv LONGBLOB NOT NULL,
+    csv_checksum CHAR(64) NOT NULL,
+    pdf LONGBLOB NOT NULL,
+    pdf_checksum CHAR(64) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TRIGGER trg_snapshot_journals_no_update
+BEFORE UPDATE ON snapshot_journals
+FOR EACH ROW
+SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'snapshot journals are immutable';
+
+CREATE TRIGGER trg_snapshot_journals_no_delete
+BEFORE DELETE ON snapshot_journals
+FOR EACH ROW
+SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'snapshot journals are immutable';
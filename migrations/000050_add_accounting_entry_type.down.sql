@@ -0,0 +1,2 @@
+ALTER TABLE accounting_entries
+    DROP COLUMN entry_type;
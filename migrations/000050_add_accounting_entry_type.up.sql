@@ -0,0 +1,3 @@
+-- Kind of ledger entry: invoice, credit_note, reversal or adjustment
+ALTER TABLE accounting_entries
+    ADD COLUMN entry_type VARCHAR(20) NOT NULL DEFAULT 'invoice';
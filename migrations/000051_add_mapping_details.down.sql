@@ -0,0 +1,2 @@
+ALTER TABLE reconciliation_mappings
+    DROP COLUMN details;
@@ -0,0 +1,4 @@
+-- What a mapping was matched on beyond its records, such as how its
+-- entries were netted
+ALTER TABLE reconciliation_mappings
+    ADD COLUMN details JSON NULL;
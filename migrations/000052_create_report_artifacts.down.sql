@@ -0,0 +1,6 @@
+ALTER TABLE export_jobs
+    DROP COLUMN artifact_id;
+
+DROP TRIGGER IF EXISTS trg_report_artifacts_no_delete;
+DROP TRIGGER IF EXISTS trg_report_artifacts_no_update;
+DROP TABLE IF EXISTS report_artifacts;
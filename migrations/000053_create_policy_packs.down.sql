@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS batch_policy_packs;
+DROP TABLE IF EXISTS policy_pack_assignments;
@@ -0,0 +1,22 @@
+-- The policy pack each tenant, or one of its accounts, reconciles under. An
+-- empty account is the tenant's own assignment.
+CREATE TABLE IF NOT EXISTS policy_pack_assignments (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    tenant_id VARCHAR(64) NOT NULL,
+    account VARCHAR(50) NOT NULL DEFAULT '',
+    pack VARCHAR(50) NOT NULL,
+    assigned_by VARCHAR(100) NOT NULL DEFAULT '',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_policy_pack_assignment (tenant_id, account)
+);
+
+-- The packs a batch ran under, as they were when it started
+CREATE TABLE IF NOT EXISTS batch_policy_packs (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    tenant_id VARCHAR(64) NOT NULL,
+    reconciliation_batch_id VARCHAR(100) NOT NULL,
+    policy_pack VARCHAR(50) NOT NULL DEFAULT '',
+    account_packs JSON NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_batch_policy_pack (tenant_id, reconciliation_batch_id)
+);
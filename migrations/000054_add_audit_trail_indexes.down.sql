@@ -0,0 +1,3 @@
+ALTER TABLE reconciliation_audit
+    DROP INDEX idx_reconciliation_audit_tenant_action,
+    DROP INDEX idx_reconciliation_audit_tenant_user;
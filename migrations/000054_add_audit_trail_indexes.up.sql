@@ -0,0 +1,4 @@
+-- The audit trail is searched by user and by action within a tenant
+ALTER TABLE reconciliation_audit
+    ADD INDEX idx_reconciliation_audit_tenant_user (tenant_id, user_id),
+    ADD INDEX idx_reconciliation_audit_tenant_action (tenant_id, action);
@@ -0,0 +1,7 @@
+ALTER TABLE accounting_entries
+    DROP INDEX idx_accounting_entries_tenant_correlation,
+    DROP COLUMN external_correlation_id;
+
+ALTER TABLE bank_transactions
+    DROP INDEX idx_bank_transactions_tenant_correlation,
+    DROP COLUMN external_correlation_id;
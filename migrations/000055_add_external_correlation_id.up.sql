@@ -0,0 +1,9 @@
+-- ID of the payment in an upstream system, such as a PSP payment ID, so a
+-- payment can be looked up from the system that made it
+ALTER TABLE bank_transactions
+    ADD COLUMN external_correlation_id VARCHAR(100) NOT NULL DEFAULT '' AFTER end_to_end_id,
+    ADD INDEX idx_bank_transactions_tenant_correlation (tenant_id, external_correlation_id);
+
+ALTER TABLE accounting_entries
+    ADD COLUMN external_correlation_id VARCHAR(100) NOT NULL DEFAULT '' AFTER end_to_end_id,
+    ADD INDEX idx_accounting_entries_tenant_correlation (tenant_id, external_correlation_id);
@@ -0,0 +1,17 @@
+-- Work state operators set on bank transactions and accounting entries still
+-- unmatched: an owner, a hold, tags and a reason code. A record without a row
+-- has none of them.
+CREATE TABLE IF NOT EXISTS unmatched_item_states (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    tenant_id VARCHAR(64) NOT NULL,
+    record_type ENUM('bank_transaction', 'accounting_entry') NOT NULL,
+    record_id BIGINT NOT NULL,
+    owner VARCHAR(100) NOT NULL DEFAULT '',
+    on_hold BOOLEAN NOT NULL DEFAULT FALSE,
+    tags JSON NULL,
+    reason_code VARCHAR(50) NOT NULL DEFAULT '',
+    updated_by VARCHAR(100) NOT NULL DEFAULT '',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_unmatched_item_state (tenant_id, record_type, record_id),
+    INDEX idx_unmatched_item_owner (tenant_id, owner)
+);
@@ -0,0 +1,9 @@
+ALTER TABLE accounting_entries
+    DROP COLUMN voided_by,
+    DROP COLUMN void_reason,
+    DROP COLUMN voided_at;
+
+ALTER TABLE bank_transactions
+    DROP COLUMN voided_by,
+    DROP COLUMN void_reason,
+    DROP COLUMN voided_at;
@@ -0,0 +1,11 @@
+-- A voided record stays stored for the audit trail but leaves matching and
+-- the unmatched pool. Voids are made through the API, with a reason.
+ALTER TABLE bank_transactions
+    ADD COLUMN voided_at TIMESTAMP NULL AFTER return_reason,
+    ADD COLUMN void_reason VARCHAR(255) NOT NULL DEFAULT '' AFTER voided_at,
+    ADD COLUMN voided_by VARCHAR(100) NOT NULL DEFAULT '' AFTER void_reason;
+
+ALTER TABLE accounting_entries
+    ADD COLUMN voided_at TIMESTAMP NULL AFTER external_correlation_id,
+    ADD COLUMN void_reason VARCHAR(255) NOT NULL DEFAULT '' AFTER voided_at,
+    ADD COLUMN voided_by VARCHAR(100) NOT NULL DEFAULT '' AFTER void_reason;
@@ -0,0 +1,16 @@
+-- Statement emails forwarded by the email provider, one row per delivery,
+-- with what became of each attachment. Attachments are ingested as
+-- ingestion files, so content mailed twice is ingested once.
+CREATE TABLE IF NOT EXISTS ingestion_emails (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    message_id VARCHAR(255) NOT NULL DEFAULT '',
+    mailbox VARCHAR(255) NOT NULL DEFAULT '',
+    sender VARCHAR(255) NOT NULL DEFAULT '',
+    subject VARCHAR(255) NOT NULL DEFAULT '',
+    status ENUM('processed', 'refused', 'empty') NOT NULL,
+    error TEXT NULL,
+    attachments JSON NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_ingestion_emails_message (message_id),
+    INDEX idx_ingestion_emails_status (status, id)
+);
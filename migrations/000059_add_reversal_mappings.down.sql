@@ -0,0 +1,4 @@
+DELETE FROM reconciliation_mappings WHERE mapping_type = 'reversal';
+
+ALTER TABLE reconciliation_mappings
+    MODIFY mapping_type ENUM('one_to_one', 'one_to_many', 'many_to_one', 'fee', 'return') NOT NULL;
@@ -0,0 +1,4 @@
+-- A record paired with the one reversing it on the same side, netted out of
+-- matching
+ALTER TABLE reconciliation_mappings
+    MODIFY mapping_type ENUM('one_to_one', 'one_to_many', 'many_to_one', 'fee', 'return', 'reversal') NOT NULL;
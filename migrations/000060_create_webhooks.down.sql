@@ -0,0 +1,7 @@
+ALTER TABLE ingestion_files
+    DROP INDEX idx_ingestion_files_source,
+    DROP COLUMN quality_score;
+DROP TABLE IF EXISTS ingestion_sequences;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhook_events;
+DROP TABLE IF EXISTS webhook_endpoints;
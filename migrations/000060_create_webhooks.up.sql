@@ -0,0 +1,57 @@
+-- Endpoints upstream teams register to be told of ingestion anomalies, the
+-- events raised, and one delivery of each event to each endpoint
+-- subscribed to it. The dedup key makes an anomaly seen again, such as a
+-- duplicate file left in place, raise its event once.
+CREATE TABLE IF NOT EXISTS webhook_endpoints (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    url VARCHAR(1024) NOT NULL,
+    secret VARCHAR(255) NOT NULL,
+    event_types JSON NOT NULL,
+    description VARCHAR(255) NOT NULL DEFAULT '',
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    updated_by VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS webhook_events (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    event_type VARCHAR(64) NOT NULL,
+    dedup_key CHAR(64) NOT NULL,
+    payload JSON NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_webhook_events_dedup (dedup_key),
+    INDEX idx_webhook_events_type (event_type, id)
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    event_id BIGINT NOT NULL,
+    endpoint_id BIGINT NOT NULL,
+    status ENUM('pending', 'delivered', 'failed') NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    last_status INT NOT NULL DEFAULT 0,
+    last_error TEXT NULL,
+    next_attempt_at TIMESTAMP NULL,
+    delivered_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_webhook_deliveries_due (status, next_attempt_at),
+    INDEX idx_webhook_deliveries_endpoint (endpoint_id, id),
+    FOREIGN KEY (event_id) REFERENCES webhook_events(id) ON DELETE CASCADE,
+    FOREIGN KEY (endpoint_id) REFERENCES webhook_endpoints(id) ON DELETE CASCADE
+);
+
+-- The last statement sequence number ingested for each account, to tell a
+-- statement that skipped some
+CREATE TABLE IF NOT EXISTS ingestion_sequences (
+    account_number VARCHAR(50) PRIMARY KEY,
+    last_sequence BIGINT NOT NULL,
+    ingestion_file_id BIGINT NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+-- Share of the data-quality checks the transactions of a file passed, NULL
+-- until it was parsed
+ALTER TABLE ingestion_files
+    ADD COLUMN quality_score DECIMAL(4,3) NULL AFTER records,
+    ADD INDEX idx_ingestion_files_source (source, updated_at);
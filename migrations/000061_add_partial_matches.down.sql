@@ -0,0 +1,11 @@
+DELETE FROM reconciliation_mappings WHERE mapping_type = 'partial';
+
+ALTER TABLE reconciliation_mappings
+    DROP COLUMN amount,
+    MODIFY mapping_type ENUM('one_to_one', 'one_to_many', 'many_to_one', 'fee', 'return', 'reversal') NOT NULL;
+
+ALTER TABLE accounting_entries
+    DROP COLUMN open_amount;
+
+ALTER TABLE bank_transactions
+    DROP COLUMN open_amount;
@@ -0,0 +1,13 @@
+-- What is left of a record a partial match settled part of. NULL is a record
+-- no partial match touched: its mappings alone say whether it is reconciled.
+ALTER TABLE bank_transactions
+    ADD COLUMN open_amount DECIMAL(15,2) NULL;
+
+ALTER TABLE accounting_entries
+    ADD COLUMN open_amount DECIMAL(15,2) NULL;
+
+-- A partial match pairs a payment with part of an entry, or an entry with
+-- part of a payment, for the amount the mapping records
+ALTER TABLE reconciliation_mappings
+    MODIFY mapping_type ENUM('one_to_one', 'one_to_many', 'many_to_one', 'fee', 'return', 'reversal', 'partial') NOT NULL,
+    ADD COLUMN amount DECIMAL(15,2) NULL;
@@ -0,0 +1,4 @@
+-- The usage entity a queued or partitioned run is counted for once its batch
+-- finishes, captured from the request that queued it
+ALTER TABLE reconciliation_jobs
+    ADD COLUMN usage_entity VARCHAR(255) NOT NULL DEFAULT '' AFTER requested_by;
@@ -0,0 +1,99 @@
+-- Create bank transactions table
+CREATE TABLE IF NOT EXISTS bank_transactions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    transaction_id VARCHAR(100) NOT NULL,
+    account_number VARCHAR(50) NOT NULL,
+    amount DECIMAL(15,2) NOT NULL,
+    transaction_date DATE NOT NULL,
+    description TEXT,
+    reference_number VARCHAR(100),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS transaction_id ON bank_transactions (transaction_id);
+CREATE INDEX IF NOT EXISTS idx_transaction_date ON bank_transactions (transaction_date);
+CREATE INDEX IF NOT EXISTS bank_transactions_idx_amount ON bank_transactions (amount);
+CREATE INDEX IF NOT EXISTS idx_reference ON bank_transactions (reference_number);
+
+CREATE TRIGGER IF NOT EXISTS trg_bank_transactions_updated_at
+AFTER UPDATE ON bank_transactions
+FOR EACH ROW WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE bank_transactions SET updated_at = CURRENT_TIMESTAMP WHERE rowid = NEW.rowid;
+END;
+
+-- Create accounting entries table
+CREATE TABLE IF NOT EXISTS accounting_entries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    entry_id VARCHAR(100) NOT NULL,
+    account_code VARCHAR(50) NOT NULL,
+    amount DECIMAL(15,2) NOT NULL,
+    entry_date DATE NOT NULL,
+    description TEXT,
+    invoice_number VARCHAR(100),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS entry_id ON accounting_entries (entry_id);
+CREATE INDEX IF NOT EXISTS idx_entry_date ON accounting_entries (entry_date);
+CREATE INDEX IF NOT EXISTS accounting_entries_idx_amount ON accounting_entries (amount);
+CREATE INDEX IF NOT EXISTS idx_invoice ON accounting_entries (invoice_number);
+
+CREATE TRIGGER IF NOT EXISTS trg_accounting_entries_updated_at
+AFTER UPDATE ON accounting_entries
+FOR EACH ROW WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE accounting_entries SET updated_at = CURRENT_TIMESTAMP WHERE rowid = NEW.rowid;
+END;
+
+-- Create reconciliations table
+CREATE TABLE IF NOT EXISTS reconciliations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    reconciliation_batch_id VARCHAR(100) NOT NULL,
+    status TEXT NOT NULL,
+    match_confidence DECIMAL(3,2),
+    amount_difference DECIMAL(15,2) DEFAULT 0.00,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_batch ON reconciliations (reconciliation_batch_id);
+CREATE INDEX IF NOT EXISTS idx_status ON reconciliations (status);
+
+CREATE TRIGGER IF NOT EXISTS trg_reconciliations_updated_at
+AFTER UPDATE ON reconciliations
+FOR EACH ROW WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE reconciliations SET updated_at = CURRENT_TIMESTAMP WHERE rowid = NEW.rowid;
+END;
+
+-- Create reconciliation mappings table
+CREATE TABLE IF NOT EXISTS reconciliation_mappings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    reconciliation_id BIGINT NOT NULL,
+    bank_transaction_id BIGINT,
+    accounting_entry_id BIGINT,
+    mapping_type TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (reconciliation_id) REFERENCES reconciliations(id) ON DELETE CASCADE,
+    FOREIGN KEY (bank_transaction_id) REFERENCES bank_transactions(id),
+    FOREIGN KEY (accounting_entry_id) REFERENCES accounting_entries(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_reconciliation ON reconciliation_mappings (reconciliation_id);
+
+-- Create reconciliation audit table
+CREATE TABLE IF NOT EXISTS reconciliation_audit (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    reconciliation_id BIGINT NOT NULL,
+    action TEXT NOT NULL,
+    details JSON,
+    user_id VARCHAR(100),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (reconciliation_id) REFERENCES reconciliations(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_reconciliation_audit ON reconciliation_audit (reconciliation_id);
+CREATE INDEX IF NOT EXISTS idx_action ON reconciliation_audit (action);
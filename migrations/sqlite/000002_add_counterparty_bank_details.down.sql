@@ -0,0 +1,13 @@
+DROP INDEX IF EXISTS accounting_entries_idx_counterparty_iban;
+
+ALTER TABLE accounting_entries DROP COLUMN counterparty_iban;
+
+DROP INDEX IF EXISTS bank_transactions_idx_counterparty_iban;
+
+ALTER TABLE bank_transactions DROP COLUMN counterparty_bank_country;
+
+ALTER TABLE bank_transactions DROP COLUMN counterparty_bank_name;
+
+ALTER TABLE bank_transactions DROP COLUMN counterparty_bic;
+
+ALTER TABLE bank_transactions DROP COLUMN counterparty_iban;
@@ -0,0 +1,15 @@
+-- Counterparty bank details carried on statements
+ALTER TABLE bank_transactions ADD COLUMN counterparty_iban VARCHAR(34) NOT NULL DEFAULT '';
+
+ALTER TABLE bank_transactions ADD COLUMN counterparty_bic VARCHAR(11) NOT NULL DEFAULT '';
+
+ALTER TABLE bank_transactions ADD COLUMN counterparty_bank_name VARCHAR(255) NOT NULL DEFAULT '';
+
+ALTER TABLE bank_transactions ADD COLUMN counterparty_bank_country CHAR(2) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS bank_transactions_idx_counterparty_iban ON bank_transactions (counterparty_iban);
+
+-- Counterparty IBAN known to the ledger (e.g. vendor or customer master data)
+ALTER TABLE accounting_entries ADD COLUMN counterparty_iban VARCHAR(34) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS accounting_entries_idx_counterparty_iban ON accounting_entries (counterparty_iban);
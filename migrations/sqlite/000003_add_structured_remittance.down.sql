@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS accounting_entries_idx_creditor_reference;
+
+ALTER TABLE accounting_entries DROP COLUMN creditor_reference;
+
+DROP INDEX IF EXISTS bank_transactions_idx_creditor_reference;
+
+ALTER TABLE bank_transactions DROP COLUMN creditor_reference;
+
+ALTER TABLE bank_transactions DROP COLUMN remittance_information;
@@ -0,0 +1,10 @@
+-- ISO 20022 remittance information and ISO 11649 creditor references
+ALTER TABLE bank_transactions ADD COLUMN remittance_information TEXT;
+
+ALTER TABLE bank_transactions ADD COLUMN creditor_reference VARCHAR(25) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS bank_transactions_idx_creditor_reference ON bank_transactions (creditor_reference);
+
+ALTER TABLE accounting_entries ADD COLUMN creditor_reference VARCHAR(25) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS accounting_entries_idx_creditor_reference ON accounting_entries (creditor_reference);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS api_quotas;
+
+DROP TABLE IF EXISTS api_usage;
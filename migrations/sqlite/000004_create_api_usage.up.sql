@@ -0,0 +1,35 @@
+-- Monthly API usage per calling entity (API key or tenant)
+CREATE TABLE IF NOT EXISTS api_usage (
+    entity VARCHAR(100) NOT NULL,
+    period CHAR(7) NOT NULL,
+    requests BIGINT NOT NULL DEFAULT 0,
+    rows_ingested BIGINT NOT NULL DEFAULT 0,
+    batches_run BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (entity, period)
+);
+
+CREATE INDEX IF NOT EXISTS idx_period ON api_usage (period);
+
+CREATE TRIGGER IF NOT EXISTS trg_api_usage_updated_at
+AFTER UPDATE ON api_usage
+FOR EACH ROW WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE api_usage SET updated_at = CURRENT_TIMESTAMP WHERE rowid = NEW.rowid;
+END;
+
+-- Per-entity monthly quota overrides; 0 means unlimited
+CREATE TABLE IF NOT EXISTS api_quotas (
+    entity VARCHAR(100) PRIMARY KEY,
+    max_requests BIGINT NOT NULL DEFAULT 0,
+    max_rows_ingested BIGINT NOT NULL DEFAULT 0,
+    max_batches BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TRIGGER IF NOT EXISTS trg_api_quotas_updated_at
+AFTER UPDATE ON api_quotas
+FOR EACH ROW WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE api_quotas SET updated_at = CURRENT_TIMESTAMP WHERE rowid = NEW.rowid;
+END;
@@ -0,0 +1,19 @@
+-- Single-row switch shared by all service instances
+CREATE TABLE IF NOT EXISTS maintenance_mode (
+    id TINYINT PRIMARY KEY,
+    enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    message VARCHAR(500) NOT NULL DEFAULT '',
+    retry_after_seconds INT NOT NULL DEFAULT 300,
+    updated_by VARCHAR(100) NOT NULL DEFAULT '',
+    enabled_at TIMESTAMP NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TRIGGER IF NOT EXISTS trg_maintenance_mode_updated_at
+AFTER UPDATE ON maintenance_mode
+FOR EACH ROW WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE maintenance_mode SET updated_at = CURRENT_TIMESTAMP WHERE rowid = NEW.rowid;
+END;
+
+INSERT INTO maintenance_mode (id, enabled) VALUES (1, FALSE);
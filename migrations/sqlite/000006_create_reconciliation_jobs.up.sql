@@ -0,0 +1,25 @@
+-- Units of background or long-running work, used for draining and resuming
+CREATE TABLE IF NOT EXISTS reconciliation_jobs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    job_type VARCHAR(50) NOT NULL,
+    reconciliation_batch_id VARCHAR(100) NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL,
+    from_date DATE NULL,
+    to_date DATE NULL,
+    instance_id VARCHAR(100) NOT NULL DEFAULT '',
+    checkpoint JSON,
+    error TEXT,
+    started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_status ON reconciliation_jobs (status);
+CREATE INDEX IF NOT EXISTS idx_job_batch ON reconciliation_jobs (reconciliation_batch_id);
+
+CREATE TRIGGER IF NOT EXISTS trg_reconciliation_jobs_updated_at
+AFTER UPDATE ON reconciliation_jobs
+FOR EACH ROW WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE reconciliation_jobs SET updated_at = CURRENT_TIMESTAMP WHERE rowid = NEW.rowid;
+END;
@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS trg_reconciliation_jobs_queued_at;
+
+DROP INDEX IF EXISTS idx_job_queue;
+
+ALTER TABLE reconciliation_jobs DROP COLUMN queued_at;
+
+ALTER TABLE reconciliation_jobs DROP COLUMN priority;
@@ -0,0 +1,16 @@
+ALTER TABLE reconciliation_jobs ADD COLUMN priority INT NOT NULL DEFAULT 0;
+
+-- SQLite adds no column defaulting to CURRENT_TIMESTAMP; a trigger stamps
+-- new jobs instead
+ALTER TABLE reconciliation_jobs ADD COLUMN queued_at TIMESTAMP NULL;
+
+UPDATE reconciliation_jobs SET queued_at = CURRENT_TIMESTAMP;
+
+CREATE TRIGGER IF NOT EXISTS trg_reconciliation_jobs_queued_at
+AFTER INSERT ON reconciliation_jobs
+FOR EACH ROW WHEN NEW.queued_at IS NULL
+BEGIN
+    UPDATE reconciliation_jobs SET queued_at = CURRENT_TIMESTAMP WHERE rowid = NEW.rowid;
+END;
+
+CREATE INDEX IF NOT EXISTS idx_job_queue ON reconciliation_jobs (status, job_type, priority, id);
@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS trg_reconciliation_snapshots_no_delete;
+
+DROP TRIGGER IF EXISTS trg_reconciliation_snapshots_no_update;
+
+DROP TABLE IF EXISTS reconciliation_snapshots;
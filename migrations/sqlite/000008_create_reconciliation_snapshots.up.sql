@@ -0,0 +1,30 @@
+-- Immutable period-end copies of the reconciliation state
+CREATE TABLE IF NOT EXISTS reconciliation_snapshots (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    snapshot_id VARCHAR(100) NOT NULL,
+    period_from DATE NOT NULL,
+    period_to DATE NOT NULL,
+    label VARCHAR(255) NOT NULL DEFAULT '',
+    created_by VARCHAR(100) NOT NULL DEFAULT '',
+    summary JSON NOT NULL,
+    items LONGTEXT NOT NULL,
+    checksum CHAR(64) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS reconciliation_snapshots_snapshot_id ON reconciliation_snapshots (snapshot_id);
+CREATE INDEX IF NOT EXISTS idx_snapshot_period ON reconciliation_snapshots (period_from, period_to);
+
+CREATE TRIGGER IF NOT EXISTS trg_reconciliation_snapshots_no_update
+BEFORE UPDATE ON reconciliation_snapshots
+FOR EACH ROW
+BEGIN
+    SELECT RAISE(ABORT, 'reconciliation snapshots are immutable');
+END;
+
+CREATE TRIGGER IF NOT EXISTS trg_reconciliation_snapshots_no_delete
+BEFORE DELETE ON reconciliation_snapshots
+FOR EACH ROW
+BEGIN
+    SELECT RAISE(ABORT, 'reconciliation snapshots are immutable');
+END;
@@ -0,0 +1,20 @@
+-- Saved custom report definitions, executed on demand for a period
+CREATE TABLE IF NOT EXISTS report_definitions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    source VARCHAR(50) NOT NULL,
+    definition JSON NOT NULL,
+    created_by VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS name ON report_definitions (name);
+
+CREATE TRIGGER IF NOT EXISTS trg_report_definitions_updated_at
+AFTER UPDATE ON report_definitions
+FOR EACH ROW WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE report_definitions SET updated_at = CURRENT_TIMESTAMP WHERE rowid = NEW.rowid;
+END;
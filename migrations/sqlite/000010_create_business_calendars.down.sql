@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS calendar_holidays;
+
+DROP TABLE IF EXISTS business_calendars;
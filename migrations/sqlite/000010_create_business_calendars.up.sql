@@ -0,0 +1,30 @@
+-- Business calendars used for date tolerances and SLA calculations
+CREATE TABLE IF NOT EXISTS business_calendars (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    code VARCHAR(50) NOT NULL,
+    country CHAR(2) NOT NULL,
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    weekend_days JSON NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS business_calendars_code ON business_calendars (code);
+
+CREATE TRIGGER IF NOT EXISTS trg_business_calendars_updated_at
+AFTER UPDATE ON business_calendars
+FOR EACH ROW WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE business_calendars SET updated_at = CURRENT_TIMESTAMP WHERE rowid = NEW.rowid;
+END;
+
+CREATE TABLE IF NOT EXISTS calendar_holidays (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    calendar_id BIGINT NOT NULL,
+    holiday_date DATE NOT NULL,
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (calendar_id) REFERENCES business_calendars(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_calendar_holiday ON calendar_holidays (calendar_id, holiday_date);
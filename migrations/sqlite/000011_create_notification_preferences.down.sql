@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS notification_subscriptions;
+
+DROP TABLE IF EXISTS notification_settings;
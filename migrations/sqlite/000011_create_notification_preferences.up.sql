@@ -0,0 +1,28 @@
+-- Per-operator notification settings and event subscriptions
+CREATE TABLE IF NOT EXISTS notification_settings (
+    user_id VARCHAR(100) PRIMARY KEY,
+    email VARCHAR(255) NOT NULL DEFAULT '',
+    webhook_url VARCHAR(1024) NOT NULL DEFAULT '',
+    locale VARCHAR(10) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TRIGGER IF NOT EXISTS trg_notification_settings_updated_at
+AFTER UPDATE ON notification_settings
+FOR EACH ROW WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE notification_settings SET updated_at = CURRENT_TIMESTAMP WHERE rowid = NEW.rowid;
+END;
+
+CREATE TABLE IF NOT EXISTS notification_subscriptions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id VARCHAR(100) NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    channel VARCHAR(20) NOT NULL,
+    delivery VARCHAR(20) NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES notification_settings(user_id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_notification_subscription ON notification_subscriptions (user_id, event_type, channel);
+CREATE INDEX IF NOT EXISTS idx_subscription_event ON notification_subscriptions (event_type);
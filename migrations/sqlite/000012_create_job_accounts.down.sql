@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_job_running_range;
+
+DROP TABLE IF EXISTS reconciliation_job_accounts;
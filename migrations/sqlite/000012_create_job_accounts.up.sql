@@ -0,0 +1,12 @@
+-- Bank accounts a running reconciliation job has locked for its date range.
+-- '*' locks every account.
+CREATE TABLE IF NOT EXISTS reconciliation_job_accounts (
+    job_id BIGINT NOT NULL,
+    account_number VARCHAR(50) NOT NULL,
+    PRIMARY KEY (job_id, account_number),
+    FOREIGN KEY (job_id) REFERENCES reconciliation_jobs(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_account ON reconciliation_job_accounts (account_number);
+
+CREATE INDEX IF NOT EXISTS idx_job_running_range ON reconciliation_jobs (status, from_date, to_date);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS accounting_entries_idx_end_to_end_id;
+
+ALTER TABLE accounting_entries DROP COLUMN end_to_end_id;
+
+DROP INDEX IF EXISTS bank_transactions_idx_end_to_end_id;
+
+ALTER TABLE bank_transactions DROP COLUMN end_to_end_id;
@@ -0,0 +1,9 @@
+-- ISO 20022 end-to-end identification, set by the payer and carried unchanged
+-- through to the statement
+ALTER TABLE bank_transactions ADD COLUMN end_to_end_id VARCHAR(35) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS bank_transactions_idx_end_to_end_id ON bank_transactions (end_to_end_id);
+
+ALTER TABLE accounting_entries ADD COLUMN end_to_end_id VARCHAR(35) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS accounting_entries_idx_end_to_end_id ON accounting_entries (end_to_end_id);
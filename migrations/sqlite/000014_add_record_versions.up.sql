@@ -0,0 +1,7 @@
+-- Row versions for optimistic locking: every update must name the version it
+-- read and bumps it, so concurrent edits are detected instead of overwritten
+ALTER TABLE bank_transactions ADD COLUMN version INT NOT NULL DEFAULT 1;
+
+ALTER TABLE accounting_entries ADD COLUMN version INT NOT NULL DEFAULT 1;
+
+ALTER TABLE reconciliations ADD COLUMN version INT NOT NULL DEFAULT 1;
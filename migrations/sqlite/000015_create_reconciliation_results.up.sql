@@ -0,0 +1,11 @@
+-- Full per-item results of every batch, so responses can cap what they return
+-- inline and point to a paginated endpoint for the rest
+CREATE TABLE IF NOT EXISTS reconciliation_results (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    reconciliation_batch_id VARCHAR(100) NOT NULL,
+    kind TEXT NOT NULL,
+    payload JSON NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_result_batch_kind ON reconciliation_results (reconciliation_batch_id, kind, id);
@@ -0,0 +1,28 @@
+-- What each manual change did to an already persisted batch, so reports
+-- regenerated after sign-off show how the numbers moved
+CREATE TABLE IF NOT EXISTS reconciliation_batch_deltas (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    reconciliation_batch_id VARCHAR(100) NOT NULL,
+    action VARCHAR(50) NOT NULL,
+    user_id VARCHAR(100) NOT NULL DEFAULT '',
+    changes JSON NOT NULL,
+    summary_before JSON NOT NULL,
+    summary_after JSON NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_delta_batch ON reconciliation_batch_deltas (reconciliation_batch_id, id);
+
+CREATE TRIGGER IF NOT EXISTS trg_reconciliation_batch_deltas_no_update
+BEFORE UPDATE ON reconciliation_batch_deltas
+FOR EACH ROW
+BEGIN
+    SELECT RAISE(ABORT, 'batch deltas are immutable');
+END;
+
+CREATE TRIGGER IF NOT EXISTS trg_reconciliation_batch_deltas_no_delete
+BEFORE DELETE ON reconciliation_batch_deltas
+FOR EACH ROW
+BEGIN
+    SELECT RAISE(ABORT, 'batch deltas are immutable');
+END;
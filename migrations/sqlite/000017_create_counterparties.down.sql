@@ -0,0 +1,17 @@
+DROP TRIGGER IF EXISTS trg_counterparties_unlink;
+
+DROP INDEX IF EXISTS idx_accounting_counterparty;
+
+ALTER TABLE accounting_entries DROP COLUMN counterparty_id;
+
+DROP INDEX IF EXISTS idx_bank_counterparty;
+
+ALTER TABLE bank_transactions DROP COLUMN counterparty_id;
+
+DROP TABLE IF EXISTS counterparty_accounts;
+
+DROP TABLE IF EXISTS counterparty_ibans;
+
+DROP TABLE IF EXISTS counterparty_aliases;
+
+DROP TABLE IF EXISTS counterparties;
@@ -0,0 +1,66 @@
+-- Counterparty master data: who pays and gets paid, under which names and
+-- accounts, how late their payments usually arrive and where they are booked
+CREATE TABLE IF NOT EXISTS counterparties (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    code VARCHAR(50) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    expected_lag_days INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS counterparties_code ON counterparties (code);
+
+CREATE TRIGGER IF NOT EXISTS trg_counterparties_updated_at
+AFTER UPDATE ON counterparties
+FOR EACH ROW WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE counterparties SET updated_at = CURRENT_TIMESTAMP WHERE rowid = NEW.rowid;
+END;
+
+-- Aliases are stored normalized; each names at most one counterparty
+CREATE TABLE IF NOT EXISTS counterparty_aliases (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    counterparty_id BIGINT NOT NULL,
+    alias VARCHAR(255) NOT NULL,
+    FOREIGN KEY (counterparty_id) REFERENCES counterparties(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_counterparty_alias ON counterparty_aliases (alias);
+
+CREATE TABLE IF NOT EXISTS counterparty_ibans (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    counterparty_id BIGINT NOT NULL,
+    iban VARCHAR(34) NOT NULL,
+    FOREIGN KEY (counterparty_id) REFERENCES counterparties(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_counterparty_iban ON counterparty_ibans (iban);
+
+CREATE TABLE IF NOT EXISTS counterparty_accounts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    counterparty_id BIGINT NOT NULL,
+    account_code VARCHAR(50) NOT NULL,
+    FOREIGN KEY (counterparty_id) REFERENCES counterparties(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_counterparty_account ON counterparty_accounts (counterparty_id, account_code);
+
+ALTER TABLE bank_transactions ADD COLUMN counterparty_id BIGINT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_bank_counterparty ON bank_transactions (counterparty_id);
+
+
+ALTER TABLE accounting_entries ADD COLUMN counterparty_id BIGINT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_accounting_counterparty ON accounting_entries (counterparty_id);
+
+-- SQLite drops no column a foreign key is declared on, so a trigger does what
+-- ON DELETE SET NULL does for the counterparty of a record
+CREATE TRIGGER IF NOT EXISTS trg_counterparties_unlink
+AFTER DELETE ON counterparties
+FOR EACH ROW
+BEGIN
+    UPDATE bank_transactions SET counterparty_id = NULL WHERE counterparty_id = OLD.id;
+    UPDATE accounting_entries SET counterparty_id = NULL WHERE counterparty_id = OLD.id;
+END;
@@ -0,0 +1,18 @@
+-- Alias dictionary applied when normalizing descriptions and counterparty
+-- names: every occurrence of alias is read as canonical. Both are stored
+-- normalized. Aliases confirmed from a reviewed match keep the pair they came
+-- from.
+CREATE TABLE IF NOT EXISTS name_aliases (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    alias VARCHAR(255) NOT NULL,
+    canonical VARCHAR(255) NOT NULL,
+    source TEXT NOT NULL DEFAULT 'manual',
+    user_id VARCHAR(100) NOT NULL DEFAULT '',
+    bank_transaction_id BIGINT NULL,
+    accounting_entry_id BIGINT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (bank_transaction_id) REFERENCES bank_transactions(id) ON DELETE SET NULL,
+    FOREIGN KEY (accounting_entry_id) REFERENCES accounting_entries(id) ON DELETE SET NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_name_alias ON name_aliases (alias);
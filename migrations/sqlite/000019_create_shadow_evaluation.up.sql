@@ -0,0 +1,48 @@
+-- Candidate matching rule sets run in shadow next to the production rules.
+-- rules holds the complete rule set, defaults filled in.
+CREATE TABLE IF NOT EXISTS shadow_candidates (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    version VARCHAR(50) NOT NULL,
+    rules JSON NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_shadow_candidate_version ON shadow_candidates (version);
+
+-- One evaluation of a candidate on the inputs of a batch, with how its
+-- matches compare to the ones the batch kept
+CREATE TABLE IF NOT EXISTS shadow_runs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    reconciliation_batch_id VARCHAR(50) NOT NULL,
+    candidate_version VARCHAR(50) NOT NULL,
+    rules JSON NOT NULL,
+    production_matches INT NOT NULL DEFAULT 0,
+    shadow_matches INT NOT NULL DEFAULT 0,
+    agreed INT NOT NULL DEFAULT 0,
+    confidence_changed INT NOT NULL DEFAULT 0,
+    production_only INT NOT NULL DEFAULT 0,
+    shadow_only INT NOT NULL DEFAULT 0,
+    agreement_rate DECIMAL(5,4) NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_shadow_runs_batch ON shadow_runs (reconciliation_batch_id);
+CREATE INDEX IF NOT EXISTS idx_shadow_runs_candidate ON shadow_runs (candidate_version, created_at);
+
+-- The would-be matches of a shadow run. They are never mapped, so the
+-- records stay unreconciled whatever the candidate decided.
+CREATE TABLE IF NOT EXISTS shadow_matches (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    shadow_run_id BIGINT NOT NULL,
+    match_type TEXT NOT NULL,
+    confidence DECIMAL(5,2) NOT NULL,
+    amount_difference DECIMAL(15,2) NOT NULL DEFAULT 0,
+    bank_transaction_ids JSON NOT NULL,
+    accounting_entry_ids JSON NOT NULL,
+    match_criteria JSON,
+    agreement TEXT NOT NULL,
+    FOREIGN KEY (shadow_run_id) REFERENCES shadow_runs(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_shadow_matches_run ON shadow_matches (shadow_run_id, agreement);
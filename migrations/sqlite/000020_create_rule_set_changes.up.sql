@@ -0,0 +1,21 @@
+-- Every change to the production matching rules. A change is proposed
+-- against the active rule set (base_version), reviewed by someone other than
+-- its author and becomes active only once approved. rules holds the complete
+-- rule set, diff the fields that differ from the base.
+CREATE TABLE IF NOT EXISTS rule_set_changes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    version VARCHAR(50) NOT NULL,
+    base_version VARCHAR(50) NOT NULL,
+    rules JSON NOT NULL,
+    diff JSON NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    author VARCHAR(100) NOT NULL,
+    reason TEXT,
+    reviewed_by VARCHAR(100) NULL,
+    review_note TEXT,
+    reviewed_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_rule_set_version ON rule_set_changes (version);
+CREATE INDEX IF NOT EXISTS idx_rule_set_status ON rule_set_changes (status);
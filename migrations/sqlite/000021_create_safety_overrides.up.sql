@@ -0,0 +1,13 @@
+-- Destructive operations confirmed with the confirmation token in a guarded
+-- environment, one row per confirmed request
+CREATE TABLE IF NOT EXISTS safety_overrides (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    environment VARCHAR(50) NOT NULL,
+    operation VARCHAR(100) NOT NULL,
+    method VARCHAR(10) NOT NULL,
+    path VARCHAR(500) NOT NULL,
+    caller VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_safety_overrides_created ON safety_overrides (created_at);
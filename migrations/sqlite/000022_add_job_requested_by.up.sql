@@ -0,0 +1,3 @@
+-- The authenticated user who started or queued a job, attributed in the
+-- audits of the batch it runs
+ALTER TABLE reconciliation_jobs ADD COLUMN requested_by VARCHAR(100) NOT NULL DEFAULT '';
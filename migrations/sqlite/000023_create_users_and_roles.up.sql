@@ -0,0 +1,31 @@
+-- Access roles, from least to most privileged by level
+CREATE TABLE IF NOT EXISTS roles (
+    name VARCHAR(20) PRIMARY KEY,
+    level INT NOT NULL,
+    description VARCHAR(255) NOT NULL
+);
+
+INSERT INTO roles (name, level, description) VALUES
+    ('viewer', 1, 'Reads reconciliation status, results, unmatched records and reports'),
+    ('operator', 2, 'Starts reconciliations, resolves disputes, ingests data and maintains master data'),
+    ('admin', 3, 'Manages users, quotas, maintenance, rule approvals and configuration');
+
+-- Users are keyed by the subject of their bearer token
+CREATE TABLE IF NOT EXISTS users (
+    id VARCHAR(100) PRIMARY KEY,
+    display_name VARCHAR(255) NOT NULL DEFAULT '',
+    role VARCHAR(20) NOT NULL,
+    updated_by VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (role) REFERENCES roles(name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_users_role ON users (role);
+
+CREATE TRIGGER IF NOT EXISTS trg_users_updated_at
+AFTER UPDATE ON users
+FOR EACH ROW WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE users SET updated_at = CURRENT_TIMESTAMP WHERE rowid = NEW.rowid;
+END;
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS fx_rates;
+
+ALTER TABLE accounting_entries DROP COLUMN currency;
+
+ALTER TABLE bank_transactions DROP COLUMN currency;
@@ -0,0 +1,28 @@
+-- ISO 4217 currency of each record; empty on rows stored before currencies
+-- were tracked, which are in the configured base currency
+ALTER TABLE bank_transactions ADD COLUMN currency CHAR(3) NOT NULL DEFAULT '';
+
+ALTER TABLE accounting_entries ADD COLUMN currency CHAR(3) NOT NULL DEFAULT '';
+
+-- Exchange rates by day: one unit of from_currency is worth rate units of
+-- to_currency. The matcher uses the latest rate on or before the bank date,
+-- in either direction.
+CREATE TABLE IF NOT EXISTS fx_rates (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    from_currency CHAR(3) NOT NULL,
+    to_currency CHAR(3) NOT NULL,
+    rate DECIMAL(18,8) NOT NULL,
+    rate_date DATE NOT NULL,
+    updated_by VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_fx_rate ON fx_rates (from_currency, to_currency, rate_date);
+
+CREATE TRIGGER IF NOT EXISTS trg_fx_rates_updated_at
+AFTER UPDATE ON fx_rates
+FOR EACH ROW WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE fx_rates SET updated_at = CURRENT_TIMESTAMP WHERE rowid = NEW.rowid;
+END;
@@ -0,0 +1,18 @@
+-- The last delivery of each event for each entity, so repeats of a flapping
+-- condition inside the dedup window are suppressed and counted instead of
+-- sent again. An empty entity stands for the event as a whole.
+CREATE TABLE IF NOT EXISTS notification_dispatches (
+    event_type VARCHAR(50) NOT NULL,
+    entity VARCHAR(255) NOT NULL DEFAULT '',
+    last_sent_at TIMESTAMP NULL,
+    suppressed INT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (event_type, entity)
+);
+
+CREATE TRIGGER IF NOT EXISTS trg_notification_dispatches_updated_at
+AFTER UPDATE ON notification_dispatches
+FOR EACH ROW WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE notification_dispatches SET updated_at = CURRENT_TIMESTAMP WHERE rowid = NEW.rowid;
+END;
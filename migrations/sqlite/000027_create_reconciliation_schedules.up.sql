@@ -0,0 +1,43 @@
+-- Reconciliations started by the internal scheduler. Each schedule fires on
+-- its cron expression, evaluated in its time zone, and reconciles the period
+-- before the firing (the previous day or week).
+CREATE TABLE IF NOT EXISTS reconciliation_schedules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(100) NOT NULL,
+    cron_expression VARCHAR(100) NOT NULL,
+    period VARCHAR(20) NOT NULL,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    next_run_at TIMESTAMP NULL,
+    last_run_at TIMESTAMP NULL,
+    updated_by VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_reconciliation_schedule_name ON reconciliation_schedules (name);
+CREATE INDEX IF NOT EXISTS idx_schedules_due ON reconciliation_schedules (enabled, next_run_at);
+
+CREATE TRIGGER IF NOT EXISTS trg_reconciliation_schedules_updated_at
+AFTER UPDATE ON reconciliation_schedules
+FOR EACH ROW WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE reconciliation_schedules SET updated_at = CURRENT_TIMESTAMP WHERE rowid = NEW.rowid;
+END;
+
+-- One row per firing of a schedule, kept after the schedule is deleted
+CREATE TABLE IF NOT EXISTS schedule_runs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    schedule_id BIGINT NOT NULL,
+    scheduled_for TIMESTAMP NOT NULL,
+    from_date DATE NOT NULL,
+    to_date DATE NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    job_id BIGINT NULL,
+    reconciliation_batch_id VARCHAR(100) NOT NULL DEFAULT '',
+    error TEXT,
+    started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_schedule_runs_schedule ON schedule_runs (schedule_id, id);
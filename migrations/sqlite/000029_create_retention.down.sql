@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS retention_runs;
+
+DROP TABLE IF EXISTS legal_holds;
+
+DROP TABLE IF EXISTS retention_policies;
@@ -0,0 +1,44 @@
+-- How long each class of data is kept before the retention purger deletes
+-- it; 0 keeps it forever
+CREATE TABLE IF NOT EXISTS retention_policies (
+    data_class VARCHAR(50) PRIMARY KEY,
+    retention_days INT NOT NULL,
+    updated_by VARCHAR(100) NOT NULL DEFAULT '',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TRIGGER IF NOT EXISTS trg_retention_policies_updated_at
+AFTER UPDATE ON retention_policies
+FOR EACH ROW WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE retention_policies SET updated_at = CURRENT_TIMESTAMP WHERE rowid = NEW.rowid;
+END;
+
+INSERT INTO retention_policies (data_class, retention_days) VALUES
+    ('results', 90),
+    ('audit', 2555),
+    ('exports', 730);
+
+-- Legal holds exempt a batch, or everything of a tenant, from purging
+CREATE TABLE IF NOT EXISTS legal_holds (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    scope VARCHAR(20) NOT NULL,
+    scope_id VARCHAR(255) NOT NULL,
+    reason VARCHAR(500) NOT NULL DEFAULT '',
+    created_by VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_legal_hold_scope ON legal_holds (scope, scope_id);
+
+-- One row per purge or dry run, with what each data class had expired
+CREATE TABLE IF NOT EXISTS retention_runs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    dry_run BOOLEAN NOT NULL,
+    triggered_by VARCHAR(100) NOT NULL DEFAULT '',
+    report JSON NOT NULL,
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_retention_runs_started ON retention_runs (started_at);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS legal_hold_audit;
@@ -0,0 +1,19 @@
+-- Placing and lifting legal holds, kept after a hold is lifted
+CREATE TABLE IF NOT EXISTS legal_hold_audit (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    legal_hold_id BIGINT NOT NULL,
+    action TEXT NOT NULL,
+    scope VARCHAR(20) NOT NULL,
+    scope_id VARCHAR(255) NOT NULL,
+    reason VARCHAR(500) NOT NULL DEFAULT '',
+    user_id VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_legal_hold_audit_hold ON legal_hold_audit (legal_hold_id);
+CREATE INDEX IF NOT EXISTS idx_legal_hold_audit_scope ON legal_hold_audit (scope, scope_id);
+
+-- Holds placed before this migration get their placement recorded
+INSERT INTO legal_hold_audit (legal_hold_id, action, scope, scope_id, reason, user_id, created_at)
+SELECT id, 'placed', scope, scope_id, reason, created_by, created_at
+FROM legal_holds;
@@ -0,0 +1,7 @@
+DELETE FROM reconciliation_mappings WHERE mapping_type = 'fee';
+
+-- reconciliation_mappings.mapping_type is plain TEXT in SQLite: nothing to change
+
+DROP TABLE IF EXISTS fee_charges;
+
+DROP TABLE IF EXISTS fee_schedules;
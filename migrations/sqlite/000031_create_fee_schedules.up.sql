@@ -0,0 +1,50 @@
+-- Fees a bank charges an account under its contract: a flat monthly
+-- maintenance fee, or a fee for every transaction on the account. Debits of
+-- the account whose description contains description_pattern are the fee;
+-- amount is what the contract charges, tolerance how far a period's charges
+-- may stray from it.
+CREATE TABLE IF NOT EXISTS fee_schedules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    account_number VARCHAR(50) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    fee_type TEXT NOT NULL,
+    amount DECIMAL(15,2) NOT NULL,
+    currency CHAR(3) NOT NULL DEFAULT '',
+    tolerance DECIMAL(15,2) NOT NULL DEFAULT 0,
+    description_pattern VARCHAR(255) NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    updated_by VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_fee_schedule ON fee_schedules (account_number, name);
+
+CREATE TRIGGER IF NOT EXISTS trg_fee_schedules_updated_at
+AFTER UPDATE ON fee_schedules
+FOR EACH ROW WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE fee_schedules SET updated_at = CURRENT_TIMESTAMP WHERE rowid = NEW.rowid;
+END;
+
+-- Bank debits recognized as the fee of a schedule, by the month (YYYY-MM)
+-- they were charged in. A fee with no accounting entry is classified by a
+-- reconciliation of its own, mapped with type 'fee'.
+CREATE TABLE IF NOT EXISTS fee_charges (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    fee_schedule_id BIGINT NOT NULL,
+    bank_transaction_id BIGINT NOT NULL,
+    period CHAR(7) NOT NULL,
+    amount DECIMAL(15,2) NOT NULL,
+    reconciliation_id BIGINT NULL,
+    batch_id VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (fee_schedule_id) REFERENCES fee_schedules(id) ON DELETE CASCADE,
+    FOREIGN KEY (bank_transaction_id) REFERENCES bank_transactions(id) ON DELETE CASCADE,
+    FOREIGN KEY (reconciliation_id) REFERENCES reconciliations(id) ON DELETE SET NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_fee_charge_transaction ON fee_charges (bank_transaction_id);
+CREATE INDEX IF NOT EXISTS idx_fee_charges_period ON fee_charges (period, fee_schedule_id);
+
+-- reconciliation_mappings.mapping_type is plain TEXT in SQLite: nothing to change
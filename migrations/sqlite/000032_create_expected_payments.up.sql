@@ -0,0 +1,36 @@
+-- Payments upstream systems expect to see on a bank account: an amount in a
+-- direction, due between two dates, identified by a reference. Batches match
+-- bank transactions against open expectations before matching the ledger;
+-- one still pending after its window is marked missed.
+CREATE TABLE IF NOT EXISTS expected_payments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    source VARCHAR(100) NOT NULL DEFAULT '',
+    external_id VARCHAR(100) NOT NULL,
+    direction TEXT NOT NULL,
+    account_number VARCHAR(50) NOT NULL DEFAULT '',
+    amount DECIMAL(15,2) NOT NULL,
+    currency CHAR(3) NOT NULL DEFAULT '',
+    reference VARCHAR(255) NOT NULL,
+    window_start DATE NOT NULL,
+    window_end DATE NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    bank_transaction_id BIGINT NULL,
+    batch_id VARCHAR(100) NOT NULL DEFAULT '',
+    matched_at TIMESTAMP NULL,
+    missed_at TIMESTAMP NULL,
+    created_by VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (bank_transaction_id) REFERENCES bank_transactions(id) ON DELETE SET NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_expected_payment ON expected_payments (source, external_id);
+CREATE UNIQUE INDEX IF NOT EXISTS uq_expected_payment_transaction ON expected_payments (bank_transaction_id);
+CREATE INDEX IF NOT EXISTS idx_expected_payments_window ON expected_payments (status, window_start, window_end);
+
+CREATE TRIGGER IF NOT EXISTS trg_expected_payments_updated_at
+AFTER UPDATE ON expected_payments
+FOR EACH ROW WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE expected_payments SET updated_at = CURRENT_TIMESTAMP WHERE rowid = NEW.rowid;
+END;
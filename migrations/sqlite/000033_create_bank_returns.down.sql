@@ -0,0 +1,9 @@
+DELETE FROM reconciliation_mappings WHERE mapping_type = 'return';
+
+-- reconciliation_mappings.mapping_type is plain TEXT in SQLite: nothing to change
+
+DROP TABLE IF EXISTS bank_returns;
+
+ALTER TABLE bank_transactions DROP COLUMN return_reason;
+
+ALTER TABLE bank_transactions DROP COLUMN reversal;
@@ -0,0 +1,28 @@
+-- Returns and reversals (R-transactions) as the bank reports them: the
+-- reversal indicator of the booking and the ISO 20022 return reason code
+ALTER TABLE bank_transactions ADD COLUMN reversal BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE bank_transactions ADD COLUMN return_reason VARCHAR(35) NOT NULL DEFAULT '';
+
+-- A return linked to the transaction it returns. action records what was
+-- done to the original's match: unmatched, flagged as disputed, left alone
+-- because of a legal hold, or none to undo when the pair was never matched.
+CREATE TABLE IF NOT EXISTS bank_returns (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    return_transaction_id BIGINT NOT NULL,
+    original_transaction_id BIGINT NOT NULL,
+    reconciliation_id BIGINT NULL,
+    reason_code VARCHAR(35) NOT NULL DEFAULT '',
+    action TEXT NOT NULL,
+    batch_id VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (return_transaction_id) REFERENCES bank_transactions(id) ON DELETE CASCADE,
+    FOREIGN KEY (original_transaction_id) REFERENCES bank_transactions(id) ON DELETE CASCADE,
+    FOREIGN KEY (reconciliation_id) REFERENCES reconciliations(id) ON DELETE SET NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_bank_return ON bank_returns (return_transaction_id);
+CREATE UNIQUE INDEX IF NOT EXISTS uq_bank_return_original ON bank_returns (original_transaction_id);
+CREATE INDEX IF NOT EXISTS idx_bank_returns_created ON bank_returns (created_at);
+
+-- reconciliation_mappings.mapping_type is plain TEXT in SQLite: nothing to change
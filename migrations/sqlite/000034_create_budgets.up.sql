@@ -0,0 +1,24 @@
+-- Budget and forecast figures finance uploads per bank account and month:
+-- the net cash movement expected on the account in the period, credits
+-- positive and debits negative, compared with the bank transactions booked
+CREATE TABLE IF NOT EXISTS budgets (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    account_number VARCHAR(50) NOT NULL,
+    period CHAR(7) NOT NULL,
+    kind TEXT NOT NULL DEFAULT 'budget',
+    amount DECIMAL(15,2) NOT NULL,
+    currency CHAR(3) NOT NULL DEFAULT '',
+    updated_by VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_budget ON budgets (account_number, period, kind);
+CREATE INDEX IF NOT EXISTS idx_budgets_period ON budgets (period, kind);
+
+CREATE TRIGGER IF NOT EXISTS trg_budgets_updated_at
+AFTER UPDATE ON budgets
+FOR EACH ROW WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE budgets SET updated_at = CURRENT_TIMESTAMP WHERE rowid = NEW.rowid;
+END;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS exception_events;
+
+DROP TABLE IF EXISTS reconciliation_exceptions;
@@ -0,0 +1,47 @@
+-- Suspense queue: bank transactions and accounting entries left unmatched
+-- longer than the configured age, worked through a fixed set of states by an
+-- owner. The record's amount and date are copied so the queue reads without
+-- joining both record tables.
+CREATE TABLE IF NOT EXISTS reconciliation_exceptions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    record_type TEXT NOT NULL,
+    record_id BIGINT NOT NULL,
+    reference VARCHAR(100) NOT NULL DEFAULT '',
+    account VARCHAR(50) NOT NULL DEFAULT '',
+    amount DECIMAL(15,2) NOT NULL,
+    currency CHAR(3) NOT NULL DEFAULT '',
+    record_date DATE NOT NULL,
+    status TEXT NOT NULL DEFAULT 'new',
+    owner VARCHAR(100) NOT NULL DEFAULT '',
+    version INT NOT NULL DEFAULT 1,
+    closed_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_exception_record ON reconciliation_exceptions (record_type, record_id);
+CREATE INDEX IF NOT EXISTS idx_exceptions_status ON reconciliation_exceptions (status, owner);
+
+CREATE TRIGGER IF NOT EXISTS trg_reconciliation_exceptions_updated_at
+AFTER UPDATE ON reconciliation_exceptions
+FOR EACH ROW WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE reconciliation_exceptions SET updated_at = CURRENT_TIMESTAMP WHERE rowid = NEW.rowid;
+END;
+
+-- Audit trail of an exception: its creation, every transition, assignment
+-- and comment
+CREATE TABLE IF NOT EXISTS exception_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    exception_id BIGINT NOT NULL,
+    action TEXT NOT NULL,
+    status_before VARCHAR(20) NOT NULL DEFAULT '',
+    status_after VARCHAR(20) NOT NULL DEFAULT '',
+    owner VARCHAR(100) NOT NULL DEFAULT '',
+    comment TEXT,
+    user_id VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (exception_id) REFERENCES reconciliation_exceptions(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_exception_events ON exception_events (exception_id, id);
@@ -0,0 +1,22 @@
+-- Closing booked balances of ingested bank statements, one per account and
+-- day; a later statement for the same day replaces the figure. Cash position
+-- reporting starts from the latest of them.
+CREATE TABLE IF NOT EXISTS statement_balances (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    account_number VARCHAR(50) NOT NULL,
+    balance_date DATE NOT NULL,
+    balance DECIMAL(15,2) NOT NULL,
+    currency CHAR(3) NOT NULL DEFAULT '',
+    source VARCHAR(20) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_statement_balance ON statement_balances (account_number, balance_date);
+
+CREATE TRIGGER IF NOT EXISTS trg_statement_balances_updated_at
+AFTER UPDATE ON statement_balances
+FOR EACH ROW WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE statement_balances SET updated_at = CURRENT_TIMESTAMP WHERE rowid = NEW.rowid;
+END;
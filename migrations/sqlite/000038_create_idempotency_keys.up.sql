@@ -0,0 +1,19 @@
+-- Idempotency keys callers send with a reconciliation start, per caller, so a
+-- retried request returns the batch the first one ran instead of a second one
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    caller VARCHAR(255) NOT NULL,
+    idempotency_key VARCHAR(255) NOT NULL,
+    operation VARCHAR(64) NOT NULL,
+    request_hash CHAR(64) NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    reconciliation_batch_id VARCHAR(100) NULL,
+    response_status INT NULL,
+    response LONGTEXT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_idempotency_key ON idempotency_keys (caller, idempotency_key);
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires ON idempotency_keys (expires_at);
@@ -0,0 +1,8 @@
+UPDATE reconciliation_audit SET action = 'resolved' WHERE action IN ('approved', 'rejected');
+
+-- reconciliation_audit.action is plain TEXT in SQLite: nothing to change
+
+-- Matches still awaiting review stay out of the matched totals as disputed
+UPDATE reconciliations SET status = 'disputed' WHERE status = 'pending_review';
+
+-- reconciliations.status is plain TEXT in SQLite: nothing to change
@@ -0,0 +1,5 @@
+-- Matches below the review confidence wait as pending_review, still holding
+-- their records, until a reviewer approves or rejects them
+-- reconciliations.status is plain TEXT in SQLite: nothing to change
+
+-- reconciliation_audit.action is plain TEXT in SQLite: nothing to change
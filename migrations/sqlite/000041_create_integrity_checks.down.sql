@@ -0,0 +1,7 @@
+UPDATE reconciliation_audit SET action = 'resolved' WHERE action = 'repaired';
+
+-- reconciliation_audit.action is plain TEXT in SQLite: nothing to change
+
+DROP TABLE IF EXISTS integrity_findings;
+
+DROP TABLE IF EXISTS integrity_runs;
@@ -0,0 +1,36 @@
+-- One row per pass of the mapping integrity checker, with how many of each
+-- kind of finding it made
+CREATE TABLE IF NOT EXISTS integrity_runs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    triggered_by VARCHAR(100) NOT NULL DEFAULT '',
+    metrics JSON NOT NULL,
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_integrity_runs_started ON integrity_runs (started_at);
+
+-- Mappings that drifted from the records they tie together, each with the
+-- repair it takes. A later run supersedes the open findings of earlier ones.
+CREATE TABLE IF NOT EXISTS integrity_findings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    run_id BIGINT NOT NULL,
+    kind TEXT NOT NULL,
+    reconciliation_id BIGINT NULL,
+    mapping_id BIGINT NULL,
+    record_type TEXT NULL,
+    record_id BIGINT NULL,
+    details JSON NOT NULL,
+    repair TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'open',
+    resolved_by VARCHAR(100) NOT NULL DEFAULT '',
+    resolved_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (run_id) REFERENCES integrity_runs(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_integrity_findings_run ON integrity_findings (run_id, id);
+CREATE INDEX IF NOT EXISTS idx_integrity_findings_status ON integrity_findings (status, kind);
+
+-- Repairs are recorded in the audit trail of the reconciliation they change
+-- reconciliation_audit.action is plain TEXT in SQLite: nothing to change
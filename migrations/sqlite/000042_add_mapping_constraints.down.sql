@@ -0,0 +1,13 @@
+DROP INDEX IF EXISTS uq_reconciliation_mapping;
+
+DROP TRIGGER IF EXISTS chk_mapping_has_record_update;
+
+DROP TRIGGER IF EXISTS chk_mapping_has_record_insert;
+
+-- Quarantined mappings go back where they came from
+INSERT INTO reconciliation_mappings
+    (id, reconciliation_id, bank_transaction_id, accounting_entry_id, mapping_type, created_at)
+SELECT id, reconciliation_id, bank_transaction_id, accounting_entry_id, mapping_type, created_at
+FROM reconciliation_mappings_quarantine;
+
+DROP TABLE IF EXISTS reconciliation_mappings_quarantine;
@@ -0,0 +1,58 @@
+-- Mappings already reference their reconciliation, bank transaction and
+-- accounting entry by foreign key; these constraints close the gaps the keys
+-- leave. Rows that would break them are moved aside first, with the reason,
+-- for an operator to review: a mapping naming no record, and a repeat of an
+-- earlier mapping of the same reconciliation and pair.
+CREATE TABLE IF NOT EXISTS reconciliation_mappings_quarantine (
+    id BIGINT PRIMARY KEY,
+    reconciliation_id BIGINT NOT NULL,
+    bank_transaction_id BIGINT,
+    accounting_entry_id BIGINT,
+    mapping_type VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP NULL,
+    reason TEXT NOT NULL,
+    quarantined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO reconciliation_mappings_quarantine
+    (id, reconciliation_id, bank_transaction_id, accounting_entry_id, mapping_type, created_at, reason)
+SELECT id, reconciliation_id, bank_transaction_id, accounting_entry_id, mapping_type, created_at, 'no_record'
+FROM reconciliation_mappings
+WHERE bank_transaction_id IS NULL AND accounting_entry_id IS NULL;
+
+INSERT INTO reconciliation_mappings_quarantine
+    (id, reconciliation_id, bank_transaction_id, accounting_entry_id, mapping_type, created_at, reason)
+SELECT m.id, m.reconciliation_id, m.bank_transaction_id, m.accounting_entry_id, m.mapping_type, m.created_at, 'duplicate'
+FROM reconciliation_mappings m
+WHERE (m.bank_transaction_id IS NOT NULL OR m.accounting_entry_id IS NOT NULL)
+AND EXISTS (
+    SELECT 1 FROM reconciliation_mappings kept
+    WHERE kept.reconciliation_id = m.reconciliation_id
+      AND kept.bank_transaction_id IS m.bank_transaction_id
+      AND kept.accounting_entry_id IS m.accounting_entry_id
+      AND kept.id < m.id
+);
+
+DELETE FROM reconciliation_mappings
+WHERE id IN (SELECT id FROM reconciliation_mappings_quarantine);
+
+-- Every mapping names at least one record, and a reconciliation maps each
+-- pair once. A side left NULL (fees, returns) counts as 0 in the key, since
+-- NULLs never collide in a plain unique key.
+-- SQLite adds no CHECK to an existing table; triggers raise the error the
+-- constraint would
+CREATE TRIGGER IF NOT EXISTS chk_mapping_has_record_insert
+BEFORE INSERT ON reconciliation_mappings
+FOR EACH ROW WHEN NEW.bank_transaction_id IS NULL AND NEW.accounting_entry_id IS NULL
+BEGIN
+    SELECT RAISE(ABORT, 'CHECK constraint failed: chk_mapping_has_record');
+END;
+
+CREATE TRIGGER IF NOT EXISTS chk_mapping_has_record_update
+BEFORE UPDATE ON reconciliation_mappings
+FOR EACH ROW WHEN NEW.bank_transaction_id IS NULL AND NEW.accounting_entry_id IS NULL
+BEGIN
+    SELECT RAISE(ABORT, 'CHECK constraint failed: chk_mapping_has_record');
+END;
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_reconciliation_mapping ON reconciliation_mappings (reconciliation_id, COALESCE(bank_transaction_id, 0), COALESCE(accounting_entry_id, 0));
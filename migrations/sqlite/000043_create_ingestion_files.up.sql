@@ -0,0 +1,28 @@
+-- Statement files fetched from SFTP, one row per distinct content. The
+-- checksum makes a file resent under another name, or fetched by two
+-- instances at once, ingest only once.
+CREATE TABLE IF NOT EXISTS ingestion_files (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    source VARCHAR(255) NOT NULL,
+    file_name VARCHAR(255) NOT NULL,
+    checksum CHAR(64) NOT NULL,
+    size BIGINT NOT NULL DEFAULT 0,
+    format VARCHAR(20) NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'processing',
+    records INT NOT NULL DEFAULT 0,
+    error TEXT NULL,
+    archived_path VARCHAR(1024) NOT NULL DEFAULT '',
+    job_id BIGINT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_ingestion_files_checksum ON ingestion_files (checksum);
+CREATE INDEX IF NOT EXISTS idx_ingestion_files_status ON ingestion_files (status, id);
+
+CREATE TRIGGER IF NOT EXISTS trg_ingestion_files_updated_at
+AFTER UPDATE ON ingestion_files
+FOR EACH ROW WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE ingestion_files SET updated_at = CURRENT_TIMESTAMP WHERE rowid = NEW.rowid;
+END;
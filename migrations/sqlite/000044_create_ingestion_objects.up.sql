@@ -0,0 +1,17 @@
+-- Objects pulled from S3-compatible buckets, by key and ETag, so a poll
+-- downloads only objects it has not processed. An object overwritten under
+-- the same key has a new ETag and is pulled again.
+CREATE TABLE IF NOT EXISTS ingestion_objects (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    bucket VARCHAR(63) NOT NULL,
+    object_key VARCHAR(1024) NOT NULL,
+    etag VARCHAR(100) NOT NULL,
+    -- SHA-256 of the bucket, key and ETag; the key is too long to index whole
+    object_hash CHAR(64) NOT NULL,
+    ingestion_file_id BIGINT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (ingestion_file_id) REFERENCES ingestion_files(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_ingestion_objects_hash ON ingestion_objects (object_hash);
+CREATE INDEX IF NOT EXISTS idx_ingestion_objects_key ON ingestion_objects (bucket, object_key);
@@ -0,0 +1,53 @@
+DROP INDEX IF EXISTS idx_batch_account_outcomes_tenant_batch;
+
+ALTER TABLE batch_account_outcomes DROP COLUMN tenant_id;
+
+DROP INDEX IF EXISTS idx_batch_kpis_tenant_batch;
+
+ALTER TABLE batch_kpis DROP COLUMN tenant_id;
+
+DROP INDEX IF EXISTS idx_reconciliation_batch_deltas_tenant_batch;
+
+ALTER TABLE reconciliation_batch_deltas DROP COLUMN tenant_id;
+
+DROP INDEX IF EXISTS idx_reconciliation_results_tenant_batch;
+
+ALTER TABLE reconciliation_results DROP COLUMN tenant_id;
+
+DROP INDEX IF EXISTS uq_statement_balance;
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_statement_balance ON statement_balances (account_number, balance_date);
+
+ALTER TABLE statement_balances DROP COLUMN tenant_id;
+
+DROP INDEX IF EXISTS idx_reconciliation_jobs_tenant_status;
+
+ALTER TABLE reconciliation_jobs DROP COLUMN tenant_id;
+
+DROP INDEX IF EXISTS idx_reconciliation_audit_tenant;
+
+ALTER TABLE reconciliation_audit DROP COLUMN tenant_id;
+
+DROP INDEX IF EXISTS idx_reconciliation_mappings_tenant;
+
+ALTER TABLE reconciliation_mappings DROP COLUMN tenant_id;
+
+DROP INDEX IF EXISTS idx_reconciliations_tenant_batch;
+
+ALTER TABLE reconciliations DROP COLUMN tenant_id;
+
+DROP INDEX IF EXISTS idx_accounting_entries_tenant_date;
+
+DROP INDEX IF EXISTS uq_accounting_entry;
+
+CREATE UNIQUE INDEX IF NOT EXISTS entry_id ON accounting_entries (entry_id);
+
+ALTER TABLE accounting_entries DROP COLUMN tenant_id;
+
+DROP INDEX IF EXISTS idx_bank_transactions_tenant_date;
+
+DROP INDEX IF EXISTS uq_bank_transaction;
+
+CREATE UNIQUE INDEX IF NOT EXISTS transaction_id ON bank_transactions (transaction_id);
+
+ALTER TABLE bank_transactions DROP COLUMN tenant_id;
@@ -0,0 +1,55 @@
+-- Records of one tenant are kept apart from those of another. Everything
+-- stored before belongs to the default tenant.
+ALTER TABLE bank_transactions ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+
+DROP INDEX IF EXISTS transaction_id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_bank_transaction ON bank_transactions (tenant_id, transaction_id);
+
+CREATE INDEX IF NOT EXISTS idx_bank_transactions_tenant_date ON bank_transactions (tenant_id, transaction_date);
+
+ALTER TABLE accounting_entries ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+
+DROP INDEX IF EXISTS entry_id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_accounting_entry ON accounting_entries (tenant_id, entry_id);
+
+CREATE INDEX IF NOT EXISTS idx_accounting_entries_tenant_date ON accounting_entries (tenant_id, entry_date);
+
+ALTER TABLE reconciliations ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+
+CREATE INDEX IF NOT EXISTS idx_reconciliations_tenant_batch ON reconciliations (tenant_id, reconciliation_batch_id);
+
+ALTER TABLE reconciliation_mappings ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+
+CREATE INDEX IF NOT EXISTS idx_reconciliation_mappings_tenant ON reconciliation_mappings (tenant_id);
+
+ALTER TABLE reconciliation_audit ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+
+CREATE INDEX IF NOT EXISTS idx_reconciliation_audit_tenant ON reconciliation_audit (tenant_id);
+
+ALTER TABLE reconciliation_jobs ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+
+CREATE INDEX IF NOT EXISTS idx_reconciliation_jobs_tenant_status ON reconciliation_jobs (tenant_id, status);
+
+ALTER TABLE statement_balances ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+
+DROP INDEX IF EXISTS uq_statement_balance;
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_statement_balance ON statement_balances (tenant_id, account_number, balance_date);
+
+ALTER TABLE reconciliation_results ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+
+CREATE INDEX IF NOT EXISTS idx_reconciliation_results_tenant_batch ON reconciliation_results (tenant_id, reconciliation_batch_id);
+
+ALTER TABLE reconciliation_batch_deltas ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+
+CREATE INDEX IF NOT EXISTS idx_reconciliation_batch_deltas_tenant_batch ON reconciliation_batch_deltas (tenant_id, reconciliation_batch_id);
+
+ALTER TABLE batch_kpis ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+
+CREATE INDEX IF NOT EXISTS idx_batch_kpis_tenant_batch ON batch_kpis (tenant_id, reconciliation_batch_id);
+
+ALTER TABLE batch_account_outcomes ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+
+CREATE INDEX IF NOT EXISTS idx_batch_account_outcomes_tenant_batch ON batch_account_outcomes (tenant_id, reconciliation_batch_id);
@@ -0,0 +1,17 @@
+-- Resets of the sandbox tenant's synthetic data. A nightly reset names the
+-- day it is for, so of several instances only one runs it; a reset asked
+-- for through the API names none.
+CREATE TABLE IF NOT EXISTS sandbox_resets (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant_id VARCHAR(64) NOT NULL,
+    reset_date DATE NULL,
+    triggered_by VARCHAR(255) NOT NULL,
+    bank_transactions INT NOT NULL DEFAULT 0,
+    accounting_entries INT NOT NULL DEFAULT 0,
+    error TEXT NULL,
+    started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_sandbox_reset_date ON sandbox_resets (tenant_id, reset_date);
+CREATE INDEX IF NOT EXISTS idx_sandbox_resets_tenant ON sandbox_resets (tenant_id, id);
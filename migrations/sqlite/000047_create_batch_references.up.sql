@@ -0,0 +1,13 @@
+-- External references callers give their batches on start, so orchestration
+-- tools can follow a batch by their own correlation ID. A reference names
+-- one batch of its tenant, and a batch has at most one reference.
+CREATE TABLE IF NOT EXISTS batch_references (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant_id VARCHAR(64) NOT NULL,
+    reconciliation_batch_id VARCHAR(100) NOT NULL,
+    external_reference VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_batch_reference ON batch_references (tenant_id, external_reference);
+CREATE UNIQUE INDEX IF NOT EXISTS uq_batch_reference_batch ON batch_references (tenant_id, reconciliation_batch_id);
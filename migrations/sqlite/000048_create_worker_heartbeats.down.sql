@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_job_heartbeat;
+
+ALTER TABLE reconciliation_jobs DROP COLUMN heartbeat_at;
+
+DROP TABLE IF EXISTS worker_heartbeats;
@@ -0,0 +1,18 @@
+-- Signs of life of the background workers of each instance, written while
+-- they run. A worker whose beat stops has died with its instance.
+CREATE TABLE IF NOT EXISTS worker_heartbeats (
+    instance_id VARCHAR(100) NOT NULL,
+    worker VARCHAR(50) NOT NULL,
+    tenant_id VARCHAR(64) NOT NULL DEFAULT '',
+    started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    beat_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (instance_id, worker, tenant_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_worker_heartbeats_beat ON worker_heartbeats (beat_at);
+
+-- Running jobs are beaten by the instance running them; a job whose beat
+-- stops is stuck
+ALTER TABLE reconciliation_jobs ADD COLUMN heartbeat_at TIMESTAMP NULL;
+
+CREATE INDEX IF NOT EXISTS idx_job_heartbeat ON reconciliation_jobs (status, heartbeat_at);
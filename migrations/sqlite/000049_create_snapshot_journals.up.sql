@@ -0,0 +1,27 @@
+-- Differences journals of period-end snapshots, as downloaded by auditors
+CREATE TABLE IF NOT EXISTS snapshot_journals (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    snapshot_id VARCHAR(100) NOT NULL,
+    line_count INT NOT NULL,
+    csv LONGBLOB NOT NULL,
+    csv_checksum CHAR(64) NOT NULL,
+    pdf LONGBLOB NOT NULL,
+    pdf_checksum CHAR(64) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS snapshot_journals_snapshot_id ON snapshot_journals (snapshot_id);
+
+CREATE TRIGGER IF NOT EXISTS trg_snapshot_journals_no_update
+BEFORE UPDATE ON snapshot_journals
+FOR EACH ROW
+BEGIN
+    SELECT RAISE(ABORT, 'snapshot journals are immutable');
+END;
+
+CREATE TRIGGER IF NOT EXISTS trg_snapshot_journals_no_delete
+BEFORE DELETE ON snapshot_journals
+FOR EACH ROW
+BEGIN
+    SELECT RAISE(ABORT, 'snapshot journals are immutable');
+END;
@@ -0,0 +1 @@
+ALTER TABLE accounting_entries DROP COLUMN entry_type;
@@ -0,0 +1 @@
+ALTER TABLE reconciliation_mappings DROP COLUMN details;
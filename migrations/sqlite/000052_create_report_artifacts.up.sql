@@ -0,0 +1,34 @@
+-- Reports handed out as files, registered by their SHA-256 and an HMAC over
+-- the registration, so a recipient can prove a file was not altered since
+CREATE TABLE IF NOT EXISTS report_artifacts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',
+    kind VARCHAR(50) NOT NULL,
+    reference VARCHAR(100) NOT NULL,
+    format VARCHAR(10) NOT NULL,
+    filename VARCHAR(255) NOT NULL,
+    sha256 CHAR(64) NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    signature CHAR(64) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_report_artifact ON report_artifacts (tenant_id, kind, reference, format, sha256);
+CREATE INDEX IF NOT EXISTS idx_report_artifacts_sha256 ON report_artifacts (sha256);
+
+CREATE TRIGGER IF NOT EXISTS trg_report_artifacts_no_update
+BEFORE UPDATE ON report_artifacts
+FOR EACH ROW
+BEGIN
+    SELECT RAISE(ABORT, 'report artifacts are immutable');
+END;
+
+CREATE TRIGGER IF NOT EXISTS trg_report_artifacts_no_delete
+BEFORE DELETE ON report_artifacts
+FOR EACH ROW
+BEGIN
+    SELECT RAISE(ABORT, 'report artifacts are immutable');
+END;
+
+-- The artifact an export's file was registered as
+ALTER TABLE export_jobs ADD COLUMN artifact_id BIGINT NULL;
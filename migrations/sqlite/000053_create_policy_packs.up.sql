@@ -0,0 +1,31 @@
+-- The policy pack each tenant, or one of its accounts, reconciles under. An
+-- empty account is the tenant's own assignment.
+CREATE TABLE IF NOT EXISTS policy_pack_assignments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant_id VARCHAR(64) NOT NULL,
+    account VARCHAR(50) NOT NULL DEFAULT '',
+    pack VARCHAR(50) NOT NULL,
+    assigned_by VARCHAR(100) NOT NULL DEFAULT '',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_policy_pack_assignment ON policy_pack_assignments (tenant_id, account);
+
+CREATE TRIGGER IF NOT EXISTS trg_policy_pack_assignments_updated_at
+AFTER UPDATE ON policy_pack_assignments
+FOR EACH ROW WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE policy_pack_assignments SET updated_at = CURRENT_TIMESTAMP WHERE rowid = NEW.rowid;
+END;
+
+-- The packs a batch ran under, as they were when it started
+CREATE TABLE IF NOT EXISTS batch_policy_packs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant_id VARCHAR(64) NOT NULL,
+    reconciliation_batch_id VARCHAR(100) NOT NULL,
+    policy_pack VARCHAR(50) NOT NULL DEFAULT '',
+    account_packs JSON NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_batch_policy_pack ON batch_policy_packs (tenant_id, reconciliation_batch_id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_reconciliation_audit_tenant_action;
+
+DROP INDEX IF EXISTS idx_reconciliation_audit_tenant_user;
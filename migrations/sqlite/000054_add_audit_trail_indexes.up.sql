@@ -0,0 +1,4 @@
+-- The audit trail is searched by user and by action within a tenant
+CREATE INDEX IF NOT EXISTS idx_reconciliation_audit_tenant_user ON reconciliation_audit (tenant_id, user_id);
+
+CREATE INDEX IF NOT EXISTS idx_reconciliation_audit_tenant_action ON reconciliation_audit (tenant_id, action);
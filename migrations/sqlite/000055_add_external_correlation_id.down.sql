@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_accounting_entries_tenant_correlation;
+
+ALTER TABLE accounting_entries DROP COLUMN external_correlation_id;
+
+DROP INDEX IF EXISTS idx_bank_transactions_tenant_correlation;
+
+ALTER TABLE bank_transactions DROP COLUMN external_correlation_id;
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS unmatched_item_states;
@@ -0,0 +1,25 @@
+-- Work state operators set on bank transactions and accounting entries still
+-- unmatched: an owner, a hold, tags and a reason code. A record without a row
+-- has none of them.
+CREATE TABLE IF NOT EXISTS unmatched_item_states (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant_id VARCHAR(64) NOT NULL,
+    record_type TEXT NOT NULL,
+    record_id BIGINT NOT NULL,
+    owner VARCHAR(100) NOT NULL DEFAULT '',
+    on_hold BOOLEAN NOT NULL DEFAULT FALSE,
+    tags JSON NULL,
+    reason_code VARCHAR(50) NOT NULL DEFAULT '',
+    updated_by VARCHAR(100) NOT NULL DEFAULT '',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_unmatched_item_state ON unmatched_item_states (tenant_id, record_type, record_id);
+CREATE INDEX IF NOT EXISTS idx_unmatched_item_owner ON unmatched_item_states (tenant_id, owner);
+
+CREATE TRIGGER IF NOT EXISTS trg_unmatched_item_states_updated_at
+AFTER UPDATE ON unmatched_item_states
+FOR EACH ROW WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE unmatched_item_states SET updated_at = CURRENT_TIMESTAMP WHERE rowid = NEW.rowid;
+END;
@@ -0,0 +1,11 @@
+ALTER TABLE accounting_entries DROP COLUMN voided_by;
+
+ALTER TABLE accounting_entries DROP COLUMN void_reason;
+
+ALTER TABLE accounting_entries DROP COLUMN voided_at;
+
+ALTER TABLE bank_transactions DROP COLUMN voided_by;
+
+ALTER TABLE bank_transactions DROP COLUMN void_reason;
+
+ALTER TABLE bank_transactions DROP COLUMN voided_at;
@@ -0,0 +1,13 @@
+-- A voided record stays stored for the audit trail but leaves matching and
+-- the unmatched pool. Voids are made through the API, with a reason.
+ALTER TABLE bank_transactions ADD COLUMN voided_at TIMESTAMP NULL;
+
+ALTER TABLE bank_transactions ADD COLUMN void_reason VARCHAR(255) NOT NULL DEFAULT '';
+
+ALTER TABLE bank_transactions ADD COLUMN voided_by VARCHAR(100) NOT NULL DEFAULT '';
+
+ALTER TABLE accounting_entries ADD COLUMN voided_at TIMESTAMP NULL;
+
+ALTER TABLE accounting_entries ADD COLUMN void_reason VARCHAR(255) NOT NULL DEFAULT '';
+
+ALTER TABLE accounting_entries ADD COLUMN voided_by VARCHAR(100) NOT NULL DEFAULT '';
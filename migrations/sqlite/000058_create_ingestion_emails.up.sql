@@ -0,0 +1,17 @@
+-- Statement emails forwarded by the email provider, one row per delivery,
+-- with what became of each attachment. Attachments are ingested as
+-- ingestion files, so content mailed twice is ingested once.
+CREATE TABLE IF NOT EXISTS ingestion_emails (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    message_id VARCHAR(255) NOT NULL DEFAULT '',
+    mailbox VARCHAR(255) NOT NULL DEFAULT '',
+    sender VARCHAR(255) NOT NULL DEFAULT '',
+    subject VARCHAR(255) NOT NULL DEFAULT '',
+    status TEXT NOT NULL,
+    error TEXT NULL,
+    attachments JSON NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_ingestion_emails_message ON ingestion_emails (message_id);
+CREATE INDEX IF NOT EXISTS idx_ingestion_emails_status ON ingestion_emails (status, id);
@@ -0,0 +1,3 @@
+DELETE FROM reconciliation_mappings WHERE mapping_type = 'reversal';
+
+-- reconciliation_mappings.mapping_type is plain TEXT in SQLite: nothing to change
@@ -0,0 +1,3 @@
+-- A record paired with the one reversing it on the same side, netted out of
+-- matching
+-- reconciliation_mappings.mapping_type is plain TEXT in SQLite: nothing to change
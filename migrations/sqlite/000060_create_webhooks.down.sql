@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS idx_ingestion_files_source;
+
+ALTER TABLE ingestion_files DROP COLUMN quality_score;
+
+DROP TABLE IF EXISTS ingestion_sequences;
+
+DROP TABLE IF EXISTS webhook_deliveries;
+
+DROP TABLE IF EXISTS webhook_events;
+
+DROP TABLE IF EXISTS webhook_endpoints;
@@ -0,0 +1,73 @@
+-- Endpoints upstream teams register to be told of ingestion anomalies, the
+-- events raised, and one delivery of each event to each endpoint
+-- subscribed to it. The dedup key makes an anomaly seen again, such as a
+-- duplicate file left in place, raise its event once.
+CREATE TABLE IF NOT EXISTS webhook_endpoints (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    url VARCHAR(1024) NOT NULL,
+    secret VARCHAR(255) NOT NULL,
+    event_types JSON NOT NULL,
+    description VARCHAR(255) NOT NULL DEFAULT '',
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    updated_by VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TRIGGER IF NOT EXISTS trg_webhook_endpoints_updated_at
+AFTER UPDATE ON webhook_endpoints
+FOR EACH ROW WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE webhook_endpoints SET updated_at = CURRENT_TIMESTAMP WHERE rowid = NEW.rowid;
+END;
+
+CREATE TABLE IF NOT EXISTS webhook_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_type VARCHAR(64) NOT NULL,
+    dedup_key CHAR(64) NOT NULL,
+    payload JSON NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_webhook_events_dedup ON webhook_events (dedup_key);
+CREATE INDEX IF NOT EXISTS idx_webhook_events_type ON webhook_events (event_type, id);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_id BIGINT NOT NULL,
+    endpoint_id BIGINT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    last_status INT NOT NULL DEFAULT 0,
+    last_error TEXT NULL,
+    next_attempt_at TIMESTAMP NULL,
+    delivered_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (event_id) REFERENCES webhook_events(id) ON DELETE CASCADE,
+    FOREIGN KEY (endpoint_id) REFERENCES webhook_endpoints(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries (status, next_attempt_at);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_endpoint ON webhook_deliveries (endpoint_id, id);
+
+-- The last statement sequence number ingested for each account, to tell a
+-- statement that skipped some
+CREATE TABLE IF NOT EXISTS ingestion_sequences (
+    account_number VARCHAR(50) PRIMARY KEY,
+    last_sequence BIGINT NOT NULL,
+    ingestion_file_id BIGINT NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TRIGGER IF NOT EXISTS trg_ingestion_sequences_updated_at
+AFTER UPDATE ON ingestion_sequences
+FOR EACH ROW WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE ingestion_sequences SET updated_at = CURRENT_TIMESTAMP WHERE rowid = NEW.rowid;
+END;
+
+-- Share of the data-quality checks the transactions of a file passed, NULL
+-- until it was parsed
+ALTER TABLE ingestion_files ADD COLUMN quality_score DECIMAL(4,3) NULL;
+
+CREATE INDEX IF NOT EXISTS idx_ingestion_files_source ON ingestion_files (source, updated_at);
@@ -0,0 +1,9 @@
+DELETE FROM reconciliation_mappings WHERE mapping_type = 'partial';
+
+ALTER TABLE reconciliation_mappings DROP COLUMN amount;
+
+-- reconciliation_mappings.mapping_type is plain TEXT in SQLite: nothing to change
+
+ALTER TABLE accounting_entries DROP COLUMN open_amount;
+
+ALTER TABLE bank_transactions DROP COLUMN open_amount;
@@ -0,0 +1,11 @@
+-- What is left of a record a partial match settled part of. NULL is a record
+-- no partial match touched: its mappings alone say whether it is reconciled.
+ALTER TABLE bank_transactions ADD COLUMN open_amount DECIMAL(15,2) NULL;
+
+ALTER TABLE accounting_entries ADD COLUMN open_amount DECIMAL(15,2) NULL;
+
+-- A partial match pairs a payment with part of an entry, or an entry with
+-- part of a payment, for the amount the mapping records
+-- reconciliation_mappings.mapping_type is plain TEXT in SQLite: nothing to change
+
+ALTER TABLE reconciliation_mappings ADD COLUMN amount DECIMAL(15,2) NULL;
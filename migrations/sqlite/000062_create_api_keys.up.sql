@@ -0,0 +1,22 @@
+-- Keys machine callers, such as the statement uploader, authenticate with
+-- instead of a user's bearer token. Only the SHA-256 hash of a key is kept;
+-- its prefix tells keys apart in listings. A rotated key names the key that
+-- replaced it and stays valid until it expires.
+CREATE TABLE IF NOT EXISTS api_keys (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',
+    name VARCHAR(255) NOT NULL,
+    prefix VARCHAR(16) NOT NULL,
+    key_hash CHAR(64) NOT NULL,
+    scope TEXT NOT NULL,
+    expires_at TIMESTAMP NULL,
+    last_used_at TIMESTAMP NULL,
+    replaced_by BIGINT NULL,
+    revoked_at TIMESTAMP NULL,
+    revoked_by VARCHAR(255) NOT NULL DEFAULT '',
+    created_by VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_api_keys_hash ON api_keys (key_hash);
+CREATE INDEX IF NOT EXISTS idx_api_keys_tenant ON api_keys (tenant_id, id);
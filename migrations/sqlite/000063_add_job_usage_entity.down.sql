@@ -0,0 +1 @@
+ALTER TABLE reconciliation_jobs DROP COLUMN usage_entity;